@@ -0,0 +1,191 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit 记录安全相关操作（索引创建删除、mapping/settings 变更、文档删除、认证失败等）的审计日志
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 审计事件类型
+const (
+	EventIndexCreate           = "index_create"
+	EventIndexDelete           = "index_delete"
+	EventIndexOpen             = "index_open"
+	EventIndexClose            = "index_close"
+	EventMappingUpdate         = "mapping_update"
+	EventSettingsUpdate        = "settings_update"
+	EventAliasUpdate           = "alias_update"
+	EventDocumentDelete        = "document_delete"
+	EventClusterSettingsUpdate = "cluster_settings_update"
+	EventScriptUpdate          = "script_update"
+	EventAuthFailure           = "auth_failure"
+	EventAccessDenied          = "access_denied"
+)
+
+// EventTypes 所有审计事件类型
+var EventTypes = []string{
+	EventIndexCreate, EventIndexDelete, EventIndexOpen, EventIndexClose,
+	EventMappingUpdate, EventSettingsUpdate, EventAliasUpdate, EventDocumentDelete,
+	EventClusterSettingsUpdate, EventScriptUpdate, EventAuthFailure, EventAccessDenied,
+}
+
+// Config 审计日志配置
+type Config struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// 审计日志文件路径，以 JSON Lines 格式追加写入
+	Path string `json:"path" yaml:"path"`
+	// 记录的事件类型，为空时记录全部
+	Events []string `json:"events,omitempty" yaml:"events,omitempty"`
+	// 不记录的事件类型（优先于 Events）
+	ExcludeEvents []string `json:"exclude_events,omitempty" yaml:"exclude_events,omitempty"`
+}
+
+// Validate 验证审计配置
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Path == "" {
+		return fmt.Errorf("audit log path is required")
+	}
+	known := make(map[string]bool, len(EventTypes))
+	for _, t := range EventTypes {
+		known[t] = true
+	}
+	for _, list := range [][]string{c.Events, c.ExcludeEvents} {
+		for _, t := range list {
+			if !known[t] {
+				return fmt.Errorf("unknown audit event type [%s]", t)
+			}
+		}
+	}
+	return nil
+}
+
+// Event 审计事件
+type Event struct {
+	Timestamp    time.Time `json:"@timestamp"`
+	Type         string    `json:"event"`
+	Outcome      string    `json:"outcome"` // success 或 failure
+	User         string    `json:"user,omitempty"`
+	Tenant       string    `json:"tenant,omitempty"`
+	SourceIP     string    `json:"source_ip"`
+	ForwardedFor string    `json:"forwarded_for,omitempty"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Index        string    `json:"index,omitempty"`
+	Status       int       `json:"status"`
+	DurationMs   int64     `json:"duration_ms"`
+	Summary      string    `json:"summary,omitempty"`
+}
+
+// Logger 审计日志记录器（追加写入，并发安全）
+type Logger struct {
+	mu       sync.Mutex
+	file     *os.File
+	include  map[string]bool
+	excludes map[string]bool
+}
+
+// NewLogger 创建审计日志记录器，打开（或创建）审计日志文件
+func NewLogger(config *Config) (*Logger, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(config.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	l := &Logger{file: file, excludes: toSet(config.ExcludeEvents)}
+	if len(config.Events) > 0 {
+		l.include = toSet(config.Events)
+	}
+	return l, nil
+}
+
+func toSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, item := range list {
+		set[item] = true
+	}
+	return set
+}
+
+// Enabled 返回事件类型是否需要记录
+func (l *Logger) Enabled(eventType string) bool {
+	if l == nil || l.excludes[eventType] {
+		return false
+	}
+	return l.include == nil || l.include[eventType]
+}
+
+// Log 写入一条审计事件（未启用的事件类型被忽略）
+func (l *Logger) Log(event *Event) error {
+	if !l.Enabled(event.Type) {
+		return nil
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	_, err = l.file.Write(data)
+	return err
+}
+
+// Close 关闭审计日志文件
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+type eventContextKey struct{}
+
+// WithEvent 返回携带审计事件的 context，内层中间件和处理器可以通过 EventFromContext 补充事件信息
+func WithEvent(ctx context.Context, event *Event) context.Context {
+	return context.WithValue(ctx, eventContextKey{}, event)
+}
+
+// EventFromContext 返回请求的审计事件，未启用审计时返回 nil
+func EventFromContext(ctx context.Context) *Event {
+	event, _ := ctx.Value(eventContextKey{}).(*Event)
+	return event
+}
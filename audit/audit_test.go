@@ -0,0 +1,88 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readEvents(t *testing.T, path string) []Event {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer file.Close()
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestLogger_FiltersAndAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	config := &Config{
+		Enabled:       true,
+		Path:          path,
+		Events:        []string{EventIndexDelete, EventAuthFailure, EventAccessDenied},
+		ExcludeEvents: []string{EventAccessDenied},
+	}
+	l, err := NewLogger(config)
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	for _, eventType := range []string{EventIndexDelete, EventIndexCreate, EventAccessDenied, EventAuthFailure} {
+		if err := l.Log(&Event{Type: eventType, Index: "logs"}); err != nil {
+			t.Fatalf("Log %s: %v", eventType, err)
+		}
+	}
+	l.Close()
+
+	// 重新打开时追加写入
+	l, err = NewLogger(config)
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	l.Log(&Event{Type: EventIndexDelete, Index: "other"})
+	l.Close()
+
+	events := readEvents(t, path)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", events)
+	}
+	if events[0].Type != EventIndexDelete || events[1].Type != EventAuthFailure || events[2].Index != "other" {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+	if events[0].Timestamp.IsZero() {
+		t.Errorf("Expected timestamp to be set")
+	}
+
+	if err := (&Config{Enabled: true, Path: path, Events: []string{"unknown"}}).Validate(); err == nil {
+		t.Errorf("Expected unknown event type to be rejected")
+	}
+	if err := (&Config{Enabled: true}).Validate(); err == nil {
+		t.Errorf("Expected missing path to be rejected")
+	}
+}
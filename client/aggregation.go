@@ -0,0 +1,187 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+// Aggregation 聚合，结果通过 SearchResult.Buckets 与 SearchResult.Metric 读取
+type Aggregation interface {
+	Source() map[string]interface{}
+}
+
+// RawAggregation 原样传入的聚合 DSL，如 {"percentiles": {"field": "latency"}}
+type RawAggregation map[string]interface{}
+
+// Source 实现 Aggregation 接口
+func (a RawAggregation) Source() map[string]interface{} {
+	return a
+}
+
+// MetricAggregation 单值指标聚合：avg、sum、min、max、cardinality、value_count
+type MetricAggregation struct {
+	typ   string
+	field string
+}
+
+// NewAvgAggregation 创建 avg 聚合
+func NewAvgAggregation(field string) *MetricAggregation {
+	return &MetricAggregation{typ: "avg", field: field}
+}
+
+// NewSumAggregation 创建 sum 聚合
+func NewSumAggregation(field string) *MetricAggregation {
+	return &MetricAggregation{typ: "sum", field: field}
+}
+
+// NewMinAggregation 创建 min 聚合
+func NewMinAggregation(field string) *MetricAggregation {
+	return &MetricAggregation{typ: "min", field: field}
+}
+
+// NewMaxAggregation 创建 max 聚合
+func NewMaxAggregation(field string) *MetricAggregation {
+	return &MetricAggregation{typ: "max", field: field}
+}
+
+// NewCardinalityAggregation 创建 cardinality 聚合（去重计数）
+func NewCardinalityAggregation(field string) *MetricAggregation {
+	return &MetricAggregation{typ: "cardinality", field: field}
+}
+
+// NewValueCountAggregation 创建 value_count 聚合
+func NewValueCountAggregation(field string) *MetricAggregation {
+	return &MetricAggregation{typ: "value_count", field: field}
+}
+
+// Source 实现 Aggregation 接口
+func (a *MetricAggregation) Source() map[string]interface{} {
+	return map[string]interface{}{a.typ: map[string]interface{}{"field": a.field}}
+}
+
+// bucketAggregation 桶聚合的公共部分：聚合参数与子聚合
+type bucketAggregation struct {
+	typ     string
+	options map[string]interface{}
+	subAggs map[string]Aggregation
+}
+
+func (a *bucketAggregation) addSubAggregation(name string, agg Aggregation) {
+	if a.subAggs == nil {
+		a.subAggs = make(map[string]Aggregation)
+	}
+	a.subAggs[name] = agg
+}
+
+func (a *bucketAggregation) source() map[string]interface{} {
+	body := map[string]interface{}{a.typ: a.options}
+	if len(a.subAggs) > 0 {
+		aggs := make(map[string]interface{}, len(a.subAggs))
+		for name, agg := range a.subAggs {
+			aggs[name] = agg.Source()
+		}
+		body["aggs"] = aggs
+	}
+	return body
+}
+
+// TermsAggregation 按字段值分桶
+type TermsAggregation struct {
+	bucketAggregation
+}
+
+// NewTermsAggregation 创建 terms 聚合
+func NewTermsAggregation(field string) *TermsAggregation {
+	return &TermsAggregation{bucketAggregation{typ: "terms", options: map[string]interface{}{"field": field}}}
+}
+
+// Size 设置返回的桶数
+func (a *TermsAggregation) Size(size int) *TermsAggregation {
+	a.options["size"] = size
+	return a
+}
+
+// MinDocCount 设置桶的最小文档数
+func (a *TermsAggregation) MinDocCount(minDocCount int64) *TermsAggregation {
+	a.options["min_doc_count"] = minDocCount
+	return a
+}
+
+// Order 设置桶的排序，如 ("_count", false)、("_key", true) 或按子聚合名排序
+func (a *TermsAggregation) Order(key string, ascending bool) *TermsAggregation {
+	order := "desc"
+	if ascending {
+		order = "asc"
+	}
+	a.options["order"] = map[string]interface{}{key: order}
+	return a
+}
+
+// SubAggregation 添加子聚合
+func (a *TermsAggregation) SubAggregation(name string, agg Aggregation) *TermsAggregation {
+	a.addSubAggregation(name, agg)
+	return a
+}
+
+// Source 实现 Aggregation 接口
+func (a *TermsAggregation) Source() map[string]interface{} {
+	return a.source()
+}
+
+// DateHistogramAggregation 按时间间隔分桶
+type DateHistogramAggregation struct {
+	bucketAggregation
+}
+
+// NewDateHistogramAggregation 创建 date_histogram 聚合，interval 为固定间隔，如 "1h"、"1d"
+func NewDateHistogramAggregation(field, interval string) *DateHistogramAggregation {
+	return &DateHistogramAggregation{bucketAggregation{typ: "date_histogram", options: map[string]interface{}{
+		"field":          field,
+		"fixed_interval": interval,
+	}}}
+}
+
+// CalendarInterval 改用日历间隔，如 "month"、"1M"、"year"
+func (a *DateHistogramAggregation) CalendarInterval(interval string) *DateHistogramAggregation {
+	delete(a.options, "fixed_interval")
+	a.options["calendar_interval"] = interval
+	return a
+}
+
+// Format 设置 key_as_string 的日期格式
+func (a *DateHistogramAggregation) Format(format string) *DateHistogramAggregation {
+	a.options["format"] = format
+	return a
+}
+
+// TimeZone 设置分桶使用的时区，如 "+08:00"
+func (a *DateHistogramAggregation) TimeZone(timeZone string) *DateHistogramAggregation {
+	a.options["time_zone"] = timeZone
+	return a
+}
+
+// MinDocCount 设置桶的最小文档数
+func (a *DateHistogramAggregation) MinDocCount(minDocCount int64) *DateHistogramAggregation {
+	a.options["min_doc_count"] = minDocCount
+	return a
+}
+
+// SubAggregation 添加子聚合
+func (a *DateHistogramAggregation) SubAggregation(name string, agg Aggregation) *DateHistogramAggregation {
+	a.addSubAggregation(name, agg)
+	return a
+}
+
+// Source 实现 Aggregation 接口
+func (a *DateHistogramAggregation) Source() map[string]interface{} {
+	return a.source()
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 批量写入
+// BulkIndexer 把条目编码为 _bulk 的 NDJSON 请求体累积在内存中，条目数或字节数达到阈值时在 Add 中同步发送
+// （发送期间其他 Add 调用等待，调用方因此受到反压），FlushInterval 定时发送未满的批次。单条失败通过条目回调
+// 与统计报告，整个请求失败时 Add/Flush 返回错误，该批次的条目计入失败数。
+
+// BulkIndexer 默认配置
+const (
+	DefaultBulkFlushItems    = 1000
+	DefaultBulkFlushBytes    = 5 << 20
+	DefaultBulkFlushInterval = 30 * time.Second
+)
+
+// BulkIndexerConfig 批量写入配置
+type BulkIndexerConfig struct {
+	Index         string        // 条目未指定索引时使用的索引
+	FlushItems    int           // 累积条目数达到该值时发送，默认 1000
+	FlushBytes    int           // 请求体达到该字节数时发送，默认 5MB
+	FlushInterval time.Duration // 定时发送未满的批次，默认 30s，负数表示不定时发送
+	Refresh       string        // 每个批次请求的 refresh 参数：true、false 或 wait_for
+
+	// OnError 定时发送失败时调用（Add、Flush 与 Close 中的失败直接返回给调用方）
+	OnError func(ctx context.Context, err error)
+}
+
+// BulkIndexerItem 批量写入的条目
+type BulkIndexerItem struct {
+	Action  string      // index（默认）、create、update 或 delete
+	Index   string      // 为空时使用 BulkIndexerConfig.Index
+	ID      string      // index 时可为空，由服务端生成
+	Routing string      // 路由值
+	Body    interface{} // index、create 为文档；update 为 {"doc": ...} 等更新体；delete 不需要
+
+	OnSuccess func(ctx context.Context, item BulkIndexerItem, result BulkResponseItem)
+	OnFailure func(ctx context.Context, item BulkIndexerItem, result BulkResponseItem, err error)
+}
+
+// BulkResponseItem _bulk 响应中单个条目的结果
+type BulkResponseItem struct {
+	Index   string `json:"_index"`
+	ID      string `json:"_id"`
+	Version int64  `json:"_version"`
+	Result  string `json:"result"`
+	Status  int    `json:"status"`
+	Error   *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error,omitempty"`
+}
+
+// BulkIndexerStats 批量写入统计
+type BulkIndexerStats struct {
+	NumAdded    uint64 // 已添加的条目数
+	NumFlushed  uint64 // 已发送且成功的条目数
+	NumFailed   uint64 // 失败的条目数
+	NumRequests uint64 // 已发送的 _bulk 请求数
+}
+
+// BulkIndexer 批量写入器，可被多个 goroutine 并发使用，使用完毕后必须调用 Close
+type BulkIndexer struct {
+	client *Client
+	config BulkIndexerConfig
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	items  []BulkIndexerItem
+	stats  BulkIndexerStats
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBulkIndexer 创建批量写入器
+func (c *Client) NewBulkIndexer(config BulkIndexerConfig) (*BulkIndexer, error) {
+	if config.FlushItems < 0 || config.FlushBytes < 0 {
+		return nil, fmt.Errorf("flush thresholds cannot be negative")
+	}
+	if config.FlushItems == 0 {
+		config.FlushItems = DefaultBulkFlushItems
+	}
+	if config.FlushBytes == 0 {
+		config.FlushBytes = DefaultBulkFlushBytes
+	}
+	if config.FlushInterval == 0 {
+		config.FlushInterval = DefaultBulkFlushInterval
+	}
+	b := &BulkIndexer{client: c, config: config, stop: make(chan struct{}), done: make(chan struct{})}
+	if config.FlushInterval > 0 {
+		go b.flushPeriodically()
+	} else {
+		close(b.done)
+	}
+	return b, nil
+}
+
+// flushPeriodically 按 FlushInterval 发送未满的批次，直到 Close
+func (b *BulkIndexer) flushPeriodically() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			ctx := context.Background()
+			if err := b.Flush(ctx); err != nil && b.config.OnError != nil {
+				b.config.OnError(ctx, err)
+			}
+		}
+	}
+}
+
+// Add 添加条目，达到阈值时同步发送当前批次
+func (b *BulkIndexer) Add(ctx context.Context, item BulkIndexerItem) error {
+	data, err := b.encode(&item)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return fmt.Errorf("bulk indexer is closed")
+	}
+	// 加入后超过字节阈值时先发送已累积的条目
+	if len(b.items) > 0 && b.buf.Len()+len(data) > b.config.FlushBytes {
+		if err := b.flushLocked(ctx); err != nil {
+			return err
+		}
+	}
+	b.buf.Write(data)
+	b.items = append(b.items, item)
+	b.stats.NumAdded++
+	if len(b.items) >= b.config.FlushItems || b.buf.Len() >= b.config.FlushBytes {
+		return b.flushLocked(ctx)
+	}
+	return nil
+}
+
+// encode 将条目编码为 _bulk 的操作行与数据行
+func (b *BulkIndexer) encode(item *BulkIndexerItem) ([]byte, error) {
+	if item.Action == "" {
+		item.Action = "index"
+	}
+	if item.Index == "" {
+		item.Index = b.config.Index
+	}
+	if item.Index == "" {
+		return nil, fmt.Errorf("index is required")
+	}
+	switch item.Action {
+	case "index", "create", "update", "delete":
+	default:
+		return nil, fmt.Errorf("unsupported bulk action [%s]", item.Action)
+	}
+	if item.Action != "index" && item.ID == "" {
+		return nil, fmt.Errorf("id is required for bulk action [%s]", item.Action)
+	}
+	if item.Action != "delete" && item.Body == nil {
+		return nil, fmt.Errorf("body is required for bulk action [%s]", item.Action)
+	}
+
+	meta := map[string]interface{}{"_index": item.Index}
+	if item.ID != "" {
+		meta["_id"] = item.ID
+	}
+	if item.Routing != "" {
+		meta["routing"] = item.Routing
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{item.Action: meta}); err != nil {
+		return nil, err
+	}
+	if item.Action != "delete" {
+		if err := json.NewEncoder(&buf).Encode(item.Body); err != nil {
+			return nil, fmt.Errorf("failed to encode document [%s]: %w", item.ID, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Flush 发送已累积的条目
+func (b *BulkIndexer) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked(ctx)
+}
+
+// flushLocked 发送当前批次并按条目结果调用回调（调用方持有 mu）
+func (b *BulkIndexer) flushLocked(ctx context.Context) error {
+	if len(b.items) == 0 {
+		return nil
+	}
+	items := b.items
+	body := append([]byte(nil), b.buf.Bytes()...)
+	b.items = nil
+	b.buf.Reset()
+
+	params := url.Values{}
+	if b.config.Refresh != "" {
+		params.Set("refresh", b.config.Refresh)
+	}
+	var resp struct {
+		Errors bool                          `json:"errors"`
+		Items  []map[string]BulkResponseItem `json:"items"`
+	}
+	b.stats.NumRequests++
+	_, err := b.client.perform(ctx, &request{
+		method:      http.MethodPost,
+		path:        "/_bulk",
+		params:      params,
+		body:        bytes.NewReader(body),
+		contentType: "application/x-ndjson",
+	}, &resp)
+	if err == nil && len(resp.Items) != len(items) {
+		err = fmt.Errorf("tigerdb: bulk response has %d items, expected %d", len(resp.Items), len(items))
+	}
+	if err != nil {
+		b.stats.NumFailed += uint64(len(items))
+		for _, item := range items {
+			if item.OnFailure != nil {
+				item.OnFailure(ctx, item, BulkResponseItem{}, err)
+			}
+		}
+		return err
+	}
+
+	for i, item := range items {
+		var result BulkResponseItem
+		for _, r := range resp.Items[i] {
+			result = r
+		}
+		if result.Error != nil || result.Status >= http.StatusMultipleChoices {
+			b.stats.NumFailed++
+			if item.OnFailure != nil {
+				item.OnFailure(ctx, item, result, nil)
+			}
+			continue
+		}
+		b.stats.NumFlushed++
+		if item.OnSuccess != nil {
+			item.OnSuccess(ctx, item, result)
+		}
+	}
+	return nil
+}
+
+// Close 停止定时发送并发送剩余条目，之后不能再添加条目
+func (b *BulkIndexer) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.stop)
+	<-b.done
+	return b.Flush(ctx)
+}
+
+// Stats 返回批量写入统计
+func (b *BulkIndexer) Stats() BulkIndexerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client 提供 TigerDB 的 Go 客户端：通过 ES 兼容的 HTTP 接口管理索引、写入与搜索文档
+//
+//	c, err := client.New(&client.Config{Address: "http://localhost:9200"})
+//	_, err = c.Index().Index("orders").Id("1").BodyJson(order).Refresh("true").Do(ctx)
+//	result, err := c.Search("orders").Query(client.NewTermQuery("region", "eu")).Size(10).Do(ctx)
+//
+// 客户端不做产品与版本检查，只依赖标准库。
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout 单次请求的默认超时
+const DefaultTimeout = 30 * time.Second
+
+// Config 客户端配置，认证方式三选一（APIKey、Token、Username/Password）
+type Config struct {
+	Address  string            `json:"address" yaml:"address"`                     // 服务地址，如 http://localhost:9200
+	APIKey   string            `json:"api_key,omitempty" yaml:"api_key,omitempty"` // 以 X-API-Key 头发送
+	Token    string            `json:"token,omitempty" yaml:"token,omitempty"`     // 以 Bearer Token 发送
+	Username string            `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string            `json:"password,omitempty" yaml:"password,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // 额外请求头
+	Timeout  time.Duration     `json:"timeout" yaml:"timeout"`                     // 单次请求超时，默认 30s
+
+	// HTTPClient 自定义 HTTP 客户端（TLS、代理等），设置后忽略 Timeout
+	HTTPClient *http.Client `json:"-" yaml:"-"`
+}
+
+// Validate 验证客户端配置
+func (c *Config) Validate() error {
+	if c.Address == "" {
+		return fmt.Errorf("address is required")
+	}
+	u, err := url.Parse(c.Address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid address [%s]", c.Address)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	return nil
+}
+
+// Client TigerDB 客户端，可被多个 goroutine 并发使用
+type Client struct {
+	config  *Config
+	baseURL string
+	http    *http.Client
+}
+
+// New 创建客户端
+func New(config *Config) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		timeout := config.Timeout
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		httpClient = &http.Client{Timeout: timeout}
+	}
+	return &Client{
+		config:  config,
+		baseURL: strings.TrimRight(config.Address, "/"),
+		http:    httpClient,
+	}, nil
+}
+
+// Error 服务端返回的错误响应
+type Error struct {
+	Status int    // HTTP 状态码
+	Type   string // 错误类型，如 index_not_found_exception
+	Reason string // 错误原因
+}
+
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("tigerdb: status %d: %s", e.Status, e.Reason)
+	}
+	return fmt.Sprintf("tigerdb: status %d: [%s] %s", e.Status, e.Type, e.Reason)
+}
+
+// IsNotFound 判断错误是否为 404（索引或文档不存在）
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Status == http.StatusNotFound
+}
+
+// request 一次 HTTP 请求
+type request struct {
+	method      string
+	path        string
+	params      url.Values
+	body        io.Reader
+	contentType string
+}
+
+// jsonRequest 构造 JSON 请求体的请求，body 为 nil 时不带请求体
+func jsonRequest(method, path string, params url.Values, body interface{}) (*request, error) {
+	req := &request{method: method, path: path, params: params}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request body: %w", err)
+		}
+		req.body = bytes.NewReader(data)
+		req.contentType = "application/json"
+	}
+	return req, nil
+}
+
+// perform 发送请求，状态码 >= 300 时返回 *Error，否则将响应体解码到 out（out 为 nil 时丢弃）
+func (c *Client) perform(ctx context.Context, req *request, out interface{}) (int, error) {
+	target := c.baseURL + req.path
+	if len(req.params) > 0 {
+		target += "?" + req.params.Encode()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, req.body)
+	if err != nil {
+		return 0, err
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	for k, v := range c.config.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	switch {
+	case c.config.APIKey != "":
+		httpReq.Header.Set("X-API-Key", c.config.APIKey)
+	case c.config.Token != "":
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.Token)
+	case c.config.Username != "":
+		httpReq.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("tigerdb: %s %s failed: %w", req.method, req.path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, decodeError(resp)
+	}
+	if out == nil || req.method == http.MethodHead {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("tigerdb: failed to decode response of %s %s: %w", req.method, req.path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// decodeError 解析 {"error": {"type": ..., "reason": ...}} 或 {"error": "..."} 格式的错误响应
+func decodeError(resp *http.Response) error {
+	e := &Error{Status: resp.StatusCode, Reason: http.StatusText(resp.StatusCode)}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil || len(body) == 0 {
+		return e
+	}
+	var parsed struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) != nil || len(parsed.Error) == 0 {
+		e.Reason = string(bytes.TrimSpace(body))
+		return e
+	}
+	var info struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(parsed.Error, &info) == nil {
+		e.Type, e.Reason = info.Type, info.Reason
+	} else {
+		var reason string
+		if json.Unmarshal(parsed.Error, &reason) == nil {
+			e.Reason = reason
+		}
+	}
+	return e
+}
+
+// escapePath 转义路径中的索引名与文档 ID
+func escapePath(segment string) string {
+	return url.PathEscape(segment)
+}
+
+// CreateIndex 创建索引，body 为 {"settings": ..., "mappings": ...}，可以为 nil
+// PUT /{index}
+func (c *Client) CreateIndex(ctx context.Context, index string, body interface{}) error {
+	req, err := jsonRequest(http.MethodPut, "/"+escapePath(index), nil, body)
+	if err != nil {
+		return err
+	}
+	_, err = c.perform(ctx, req, nil)
+	return err
+}
+
+// DeleteIndex 删除索引
+// DELETE /{index}
+func (c *Client) DeleteIndex(ctx context.Context, index string) error {
+	_, err := c.perform(ctx, &request{method: http.MethodDelete, path: "/" + escapePath(index)}, nil)
+	return err
+}
+
+// IndexExists 判断索引是否存在
+// HEAD /{index}
+func (c *Client) IndexExists(ctx context.Context, index string) (bool, error) {
+	_, err := c.perform(ctx, &request{method: http.MethodHead, path: "/" + escapePath(index)}, nil)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// PutMapping 更新索引 mapping，mapping 为 {"properties": ...}
+// PUT /{index}/_mapping
+func (c *Client) PutMapping(ctx context.Context, index string, mapping interface{}) error {
+	req, err := jsonRequest(http.MethodPut, "/"+escapePath(index)+"/_mapping", nil, mapping)
+	if err != nil {
+		return err
+	}
+	_, err = c.perform(ctx, req, nil)
+	return err
+}
+
+// Refresh 刷新索引，使此前的写入对搜索可见
+// POST /{index}/_refresh
+func (c *Client) Refresh(ctx context.Context, indices ...string) error {
+	path := "/_refresh"
+	if len(indices) > 0 {
+		path = "/" + escapePath(strings.Join(indices, ",")) + "/_refresh"
+	}
+	_, err := c.perform(ctx, &request{method: http.MethodPost, path: path}, nil)
+	return err
+}
+
+// GetResult 获取文档的结果
+type GetResult struct {
+	Index       string          `json:"_index"`
+	ID          string          `json:"_id"`
+	Version     int64           `json:"_version"`
+	SeqNo       int64           `json:"_seq_no"`
+	PrimaryTerm int64           `json:"_primary_term"`
+	Routing     string          `json:"_routing,omitempty"`
+	Found       bool            `json:"found"`
+	Source      json.RawMessage `json:"_source,omitempty"`
+}
+
+// Decode 将 _source 解码到 v
+func (r *GetResult) Decode(v interface{}) error {
+	return json.Unmarshal(r.Source, v)
+}
+
+// Get 获取文档，文档不存在时返回 Found 为 false 的结果；routing 为空时不指定
+// GET /{index}/_doc/{id}
+func (c *Client) Get(ctx context.Context, index, id, routing string) (*GetResult, error) {
+	params := url.Values{}
+	if routing != "" {
+		params.Set("routing", routing)
+	}
+	var result GetResult
+	_, err := c.perform(ctx, &request{method: http.MethodGet, path: "/" + escapePath(index) + "/_doc/" + escapePath(id), params: params}, &result)
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound && e.Type != "index_not_found_exception" {
+			return &GetResult{Index: index, ID: id}, nil
+		}
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Delete 删除文档，文档不存在时返回 Result 为 not_found 的结果；routing 为空时不指定
+// DELETE /{index}/_doc/{id}
+func (c *Client) Delete(ctx context.Context, index, id, routing string) (*WriteResult, error) {
+	params := url.Values{}
+	if routing != "" {
+		params.Set("routing", routing)
+	}
+	var result WriteResult
+	_, err := c.perform(ctx, &request{method: http.MethodDelete, path: "/" + escapePath(index) + "/_doc/" + escapePath(id), params: params}, &result)
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound && e.Type != "index_not_found_exception" {
+			return &WriteResult{Index: index, ID: id, Result: "not_found"}, nil
+		}
+		return nil, err
+	}
+	return &result, nil
+}
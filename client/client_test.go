@@ -0,0 +1,249 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	es "github.com/lscgzwd/tiggerdb/protocols/es"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+// setupTestServer 启动使用临时目录的 ES 协议服务，返回服务地址
+func setupTestServer(t *testing.T) (string, func()) {
+	tempDir, err := os.MkdirTemp("", "tigerdb_client_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	dirMgr, err := directory.NewDirectoryManager(directory.DefaultDirectoryConfig(tempDir))
+	if err != nil {
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create directory manager: %v", err)
+	}
+	metaStore, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{StorageType: "memory"})
+	if err != nil {
+		dirMgr.Cleanup()
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+
+	config := es.DefaultConfig()
+	config.ServerConfig = server.DefaultServerConfig()
+	config.ServerConfig.Port = 0
+	config.ServerConfig.LogLevel = "error"
+	esSrv, err := es.NewServer(dirMgr, metaStore, config)
+	if err != nil {
+		metaStore.Close()
+		dirMgr.Cleanup()
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create ES server: %v", err)
+	}
+	go esSrv.Start()
+	// 等待服务启动并分配实际端口
+	deadline := time.Now().Add(5 * time.Second)
+	for !esSrv.IsRunning() || strings.HasSuffix(esSrv.Address(), ":0") {
+		if time.Now().After(deadline) {
+			t.Fatalf("ES server did not start in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return "http://" + esSrv.Address(), func() {
+		esSrv.Stop()
+		metaStore.Close()
+		dirMgr.Cleanup()
+		os.RemoveAll(tempDir)
+	}
+}
+
+type order struct {
+	Region string `json:"region"`
+	Amount int    `json:"amount"`
+}
+
+func TestClient(t *testing.T) {
+	address, cleanup := setupTestServer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	c, err := New(&Config{Address: address})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	err = c.CreateIndex(ctx, "orders", map[string]interface{}{
+		"mappings": map[string]interface{}{"properties": map[string]interface{}{
+			"region": map[string]interface{}{"type": "keyword"},
+			"amount": map[string]interface{}{"type": "long"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("CreateIndex: %v", err)
+	}
+	if exists, err := c.IndexExists(ctx, "orders"); err != nil || !exists {
+		t.Fatalf("IndexExists(orders) = %v, %v", exists, err)
+	}
+	if exists, err := c.IndexExists(ctx, "missing"); err != nil || exists {
+		t.Fatalf("IndexExists(missing) = %v, %v", exists, err)
+	}
+
+	written, err := c.Index().Index("orders").Id("1").BodyJson(order{Region: "eu", Amount: 10}).Refresh("true").Do(ctx)
+	if err != nil || written.ID != "1" || written.Result != "created" {
+		t.Fatalf("Index: %+v, %v", written, err)
+	}
+	got, err := c.Get(ctx, "orders", "1", "")
+	if err != nil || !got.Found {
+		t.Fatalf("Get: %+v, %v", got, err)
+	}
+	var doc order
+	if err := got.Decode(&doc); err != nil || doc != (order{Region: "eu", Amount: 10}) {
+		t.Fatalf("Decode: %+v, %v", doc, err)
+	}
+
+	// 每 2 条发送一次，最后一批在 Close 时发送；写入非法索引名的条目单独失败
+	bulk, err := c.NewBulkIndexer(BulkIndexerConfig{Index: "orders", FlushItems: 2, FlushInterval: -1, Refresh: "true"})
+	if err != nil {
+		t.Fatalf("NewBulkIndexer: %v", err)
+	}
+	var failed []string
+	for i, o := range []order{{"eu", 30}, {"us", 20}, {"us", 40}, {"eu", 50}} {
+		if err := bulk.Add(ctx, BulkIndexerItem{ID: fmt.Sprint(i + 2), Body: o}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	err = bulk.Add(ctx, BulkIndexerItem{
+		Index: "Invalid",
+		ID:    "missing",
+		Body:  order{},
+		OnFailure: func(ctx context.Context, item BulkIndexerItem, result BulkResponseItem, err error) {
+			failed = append(failed, item.ID)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := bulk.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if stats := bulk.Stats(); stats.NumAdded != 5 || stats.NumFlushed != 4 || stats.NumFailed != 1 || stats.NumRequests != 3 {
+		t.Errorf("Unexpected bulk stats: %+v", stats)
+	}
+	if len(failed) != 1 || failed[0] != "missing" {
+		t.Errorf("Expected the item with an invalid index name to fail, got %v", failed)
+	}
+	if err := bulk.Add(ctx, BulkIndexerItem{ID: "6", Body: order{}}); err == nil {
+		t.Errorf("Expected Add to fail after Close")
+	}
+
+	result, err := c.Search("orders").
+		Query(NewBoolQuery().Filter(NewRangeQuery("amount").Gte(20))).
+		Sort("amount", true).
+		Size(10).
+		Aggregation("regions", NewTermsAggregation("region").SubAggregation("total", NewSumAggregation("amount"))).
+		Do(ctx)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if result.Hits.Total.Value != 4 || len(result.Hits.Hits) != 4 || result.Hits.Hits[0].ID != "3" {
+		t.Fatalf("Unexpected hits: %+v", result.Hits)
+	}
+	if err := result.Hits.Hits[3].Decode(&doc); err != nil || doc.Amount != 50 {
+		t.Errorf("Expected the last hit to have amount 50, got %+v, %v", doc, err)
+	}
+	buckets, err := result.Buckets("regions")
+	if err != nil || len(buckets) != 2 {
+		t.Fatalf("Buckets: %+v, %v", buckets, err)
+	}
+	for _, bucket := range buckets {
+		total, err := bucket.Metric("total")
+		if err != nil || total == nil || bucket.DocCount != 2 {
+			t.Fatalf("Unexpected bucket %+v: %v", bucket, err)
+		}
+		if want := map[string]float64{"eu": 80, "us": 60}[fmt.Sprint(bucket.Key)]; *total != want {
+			t.Errorf("Expected total %v for [%v], got %v", want, bucket.Key, *total)
+		}
+	}
+
+	if n, err := c.Count(ctx, NewTermQuery("region", "eu"), "orders"); err != nil || n != 3 {
+		t.Errorf("Count = %d, %v", n, err)
+	}
+
+	if deleted, err := c.Delete(ctx, "orders", "1", ""); err != nil || deleted.Result != "deleted" {
+		t.Fatalf("Delete: %+v, %v", deleted, err)
+	}
+	if got, err := c.Get(ctx, "orders", "1", ""); err != nil || got.Found {
+		t.Errorf("Expected a deleted document not to be found, got %+v, %v", got, err)
+	}
+	if _, err := c.Search("missing").Do(ctx); !IsNotFound(err) || !strings.Contains(err.Error(), "index_not_found_exception") {
+		t.Errorf("Expected index_not_found_exception, got %v", err)
+	}
+}
+
+func TestClientAuthAndErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "secret" || r.Header.Get("X-Tenant") != "acme" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"type": "security_exception", "reason": "missing authentication credentials"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error": "rate limit exceeded"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(&Config{Address: srv.URL})
+	err := c.Refresh(context.Background())
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusUnauthorized || e.Type != "security_exception" {
+		t.Errorf("Expected a security_exception, got %v", err)
+	}
+
+	c, _ = New(&Config{Address: srv.URL, APIKey: "secret", Headers: map[string]string{"X-Tenant": "acme"}})
+	err = c.Refresh(context.Background())
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusTooManyRequests || e.Reason != "rate limit exceeded" {
+		t.Errorf("Expected a 429 error, got %v", err)
+	}
+
+	if _, err := New(&Config{Address: "localhost:9200"}); err == nil {
+		t.Errorf("Expected an address without scheme to be rejected")
+	}
+}
+
+func TestQuerySource(t *testing.T) {
+	q := NewBoolQuery().
+		Must(NewMatchQuery("title", "quick fox").Operator("and")).
+		MustNot(NewTermsQuery("status", "deleted", "archived")).
+		MinimumShouldMatch("1")
+	src := q.Source()["bool"].(map[string]interface{})
+	if src["minimum_should_match"] != "1" || len(src["must"].([]interface{})) != 1 || src["should"] != nil {
+		t.Fatalf("Unexpected bool query: %v", src)
+	}
+	match := src["must"].([]interface{})[0].(map[string]interface{})["match"].(map[string]interface{})["title"].(map[string]interface{})
+	if match["query"] != "quick fox" || match["operator"] != "and" {
+		t.Errorf("Unexpected match query: %v", match)
+	}
+
+	agg := NewDateHistogramAggregation("created", "1h").CalendarInterval("month").Source()["date_histogram"].(map[string]interface{})
+	if agg["calendar_interval"] != "month" || agg["fixed_interval"] != nil {
+		t.Errorf("Unexpected date_histogram aggregation: %v", agg)
+	}
+}
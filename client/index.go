@@ -0,0 +1,108 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// WriteResult 写入或删除单个文档的结果
+type WriteResult struct {
+	Index       string `json:"_index"`
+	ID          string `json:"_id"`
+	Version     int64  `json:"_version"`
+	Result      string `json:"result"` // created、updated、deleted 或 not_found
+	SeqNo       int64  `json:"_seq_no"`
+	PrimaryTerm int64  `json:"_primary_term"`
+}
+
+// IndexService 写入单个文档
+// PUT /{index}/_doc/{id}，未指定 ID 时 POST /{index}/_doc 由服务端生成
+type IndexService struct {
+	client  *Client
+	index   string
+	id      string
+	routing string
+	refresh string
+	body    interface{}
+}
+
+// Index 创建写入单个文档的请求
+func (c *Client) Index() *IndexService {
+	return &IndexService{client: c}
+}
+
+// Index 设置目标索引
+func (s *IndexService) Index(index string) *IndexService {
+	s.index = index
+	return s
+}
+
+// Id 设置文档 ID
+func (s *IndexService) Id(id string) *IndexService {
+	s.id = id
+	return s
+}
+
+// Routing 设置路由值
+func (s *IndexService) Routing(routing string) *IndexService {
+	s.routing = routing
+	return s
+}
+
+// Refresh 设置写入后的刷新方式：true、false 或 wait_for
+func (s *IndexService) Refresh(refresh string) *IndexService {
+	s.refresh = refresh
+	return s
+}
+
+// BodyJson 设置文档内容，按 JSON 序列化
+func (s *IndexService) BodyJson(body interface{}) *IndexService {
+	s.body = body
+	return s
+}
+
+// Do 执行写入
+func (s *IndexService) Do(ctx context.Context) (*WriteResult, error) {
+	if s.index == "" {
+		return nil, fmt.Errorf("index is required")
+	}
+	if s.body == nil {
+		return nil, fmt.Errorf("document body is required")
+	}
+	params := url.Values{}
+	if s.routing != "" {
+		params.Set("routing", s.routing)
+	}
+	if s.refresh != "" {
+		params.Set("refresh", s.refresh)
+	}
+	method, path := http.MethodPost, "/"+escapePath(s.index)+"/_doc"
+	if s.id != "" {
+		method, path = http.MethodPut, path+"/"+escapePath(s.id)
+	}
+	req, err := jsonRequest(method, path, params, s.body)
+	if err != nil {
+		return nil, err
+	}
+	var result WriteResult
+	if _, err := s.client.perform(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
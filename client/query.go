@@ -0,0 +1,437 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+// 查询构造器：每个类型对应一种 Query DSL 查询，Source 返回序列化为 JSON 的查询体。
+// 未提供构造器的查询可以用 RawQuery 直接传入 DSL。
+
+// Query Query DSL 查询
+type Query interface {
+	Source() map[string]interface{}
+}
+
+// RawQuery 原样传入的 DSL 查询，如 {"geo_distance": {...}}
+type RawQuery map[string]interface{}
+
+// Source 实现 Query 接口
+func (q RawQuery) Source() map[string]interface{} {
+	return q
+}
+
+// MatchAllQuery 匹配所有文档
+type MatchAllQuery struct {
+	boost *float64
+}
+
+// NewMatchAllQuery 创建 match_all 查询
+func NewMatchAllQuery() *MatchAllQuery {
+	return &MatchAllQuery{}
+}
+
+// Boost 设置评分权重
+func (q *MatchAllQuery) Boost(boost float64) *MatchAllQuery {
+	q.boost = &boost
+	return q
+}
+
+// Source 实现 Query 接口
+func (q *MatchAllQuery) Source() map[string]interface{} {
+	body := map[string]interface{}{}
+	if q.boost != nil {
+		body["boost"] = *q.boost
+	}
+	return map[string]interface{}{"match_all": body}
+}
+
+// MatchQuery 全文匹配查询
+type MatchQuery struct {
+	field   string
+	options map[string]interface{}
+}
+
+// NewMatchQuery 创建 match 查询
+func NewMatchQuery(field string, text interface{}) *MatchQuery {
+	return &MatchQuery{field: field, options: map[string]interface{}{"query": text}}
+}
+
+// Operator 设置词项之间的关系：or（默认）或 and
+func (q *MatchQuery) Operator(operator string) *MatchQuery {
+	q.options["operator"] = operator
+	return q
+}
+
+// Fuzziness 设置模糊匹配的编辑距离，如 "AUTO"、"1"
+func (q *MatchQuery) Fuzziness(fuzziness string) *MatchQuery {
+	q.options["fuzziness"] = fuzziness
+	return q
+}
+
+// Analyzer 设置查询文本使用的分词器
+func (q *MatchQuery) Analyzer(analyzer string) *MatchQuery {
+	q.options["analyzer"] = analyzer
+	return q
+}
+
+// MinimumShouldMatch 设置最少匹配的词项数，如 "2"、"75%"
+func (q *MatchQuery) MinimumShouldMatch(minimumShouldMatch string) *MatchQuery {
+	q.options["minimum_should_match"] = minimumShouldMatch
+	return q
+}
+
+// Boost 设置评分权重
+func (q *MatchQuery) Boost(boost float64) *MatchQuery {
+	q.options["boost"] = boost
+	return q
+}
+
+// Source 实现 Query 接口
+func (q *MatchQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"match": map[string]interface{}{q.field: q.options}}
+}
+
+// MatchPhraseQuery 短语匹配查询
+type MatchPhraseQuery struct {
+	field   string
+	options map[string]interface{}
+}
+
+// NewMatchPhraseQuery 创建 match_phrase 查询
+func NewMatchPhraseQuery(field string, text string) *MatchPhraseQuery {
+	return &MatchPhraseQuery{field: field, options: map[string]interface{}{"query": text}}
+}
+
+// Slop 设置词项之间允许的距离
+func (q *MatchPhraseQuery) Slop(slop int) *MatchPhraseQuery {
+	q.options["slop"] = slop
+	return q
+}
+
+// Boost 设置评分权重
+func (q *MatchPhraseQuery) Boost(boost float64) *MatchPhraseQuery {
+	q.options["boost"] = boost
+	return q
+}
+
+// Source 实现 Query 接口
+func (q *MatchPhraseQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"match_phrase": map[string]interface{}{q.field: q.options}}
+}
+
+// MultiMatchQuery 多字段全文匹配查询
+type MultiMatchQuery struct {
+	options map[string]interface{}
+}
+
+// NewMultiMatchQuery 创建 multi_match 查询，字段支持 "title^2" 形式的权重
+func NewMultiMatchQuery(text interface{}, fields ...string) *MultiMatchQuery {
+	return &MultiMatchQuery{options: map[string]interface{}{"query": text, "fields": fields}}
+}
+
+// Type 设置匹配方式：best_fields（默认）、most_fields、cross_fields、phrase、phrase_prefix
+func (q *MultiMatchQuery) Type(typ string) *MultiMatchQuery {
+	q.options["type"] = typ
+	return q
+}
+
+// Operator 设置词项之间的关系：or（默认）或 and
+func (q *MultiMatchQuery) Operator(operator string) *MultiMatchQuery {
+	q.options["operator"] = operator
+	return q
+}
+
+// Source 实现 Query 接口
+func (q *MultiMatchQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"multi_match": q.options}
+}
+
+// TermQuery 精确词项查询
+type TermQuery struct {
+	field   string
+	options map[string]interface{}
+}
+
+// NewTermQuery 创建 term 查询
+func NewTermQuery(field string, value interface{}) *TermQuery {
+	return &TermQuery{field: field, options: map[string]interface{}{"value": value}}
+}
+
+// Boost 设置评分权重
+func (q *TermQuery) Boost(boost float64) *TermQuery {
+	q.options["boost"] = boost
+	return q
+}
+
+// Source 实现 Query 接口
+func (q *TermQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{q.field: q.options}}
+}
+
+// TermsQuery 匹配任一词项的查询
+type TermsQuery struct {
+	field  string
+	values []interface{}
+}
+
+// NewTermsQuery 创建 terms 查询
+func NewTermsQuery(field string, values ...interface{}) *TermsQuery {
+	return &TermsQuery{field: field, values: values}
+}
+
+// Source 实现 Query 接口
+func (q *TermsQuery) Source() map[string]interface{} {
+	values := q.values
+	if values == nil {
+		values = []interface{}{}
+	}
+	return map[string]interface{}{"terms": map[string]interface{}{q.field: values}}
+}
+
+// RangeQuery 范围查询
+type RangeQuery struct {
+	field   string
+	options map[string]interface{}
+}
+
+// NewRangeQuery 创建 range 查询
+func NewRangeQuery(field string) *RangeQuery {
+	return &RangeQuery{field: field, options: map[string]interface{}{}}
+}
+
+// Gt 大于
+func (q *RangeQuery) Gt(value interface{}) *RangeQuery {
+	q.options["gt"] = value
+	return q
+}
+
+// Gte 大于等于
+func (q *RangeQuery) Gte(value interface{}) *RangeQuery {
+	q.options["gte"] = value
+	return q
+}
+
+// Lt 小于
+func (q *RangeQuery) Lt(value interface{}) *RangeQuery {
+	q.options["lt"] = value
+	return q
+}
+
+// Lte 小于等于
+func (q *RangeQuery) Lte(value interface{}) *RangeQuery {
+	q.options["lte"] = value
+	return q
+}
+
+// Format 设置日期值的格式
+func (q *RangeQuery) Format(format string) *RangeQuery {
+	q.options["format"] = format
+	return q
+}
+
+// TimeZone 设置日期值的时区，如 "+08:00"
+func (q *RangeQuery) TimeZone(timeZone string) *RangeQuery {
+	q.options["time_zone"] = timeZone
+	return q
+}
+
+// Source 实现 Query 接口
+func (q *RangeQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"range": map[string]interface{}{q.field: q.options}}
+}
+
+// ExistsQuery 匹配字段有值的文档
+type ExistsQuery struct {
+	field string
+}
+
+// NewExistsQuery 创建 exists 查询
+func NewExistsQuery(field string) *ExistsQuery {
+	return &ExistsQuery{field: field}
+}
+
+// Source 实现 Query 接口
+func (q *ExistsQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"exists": map[string]interface{}{"field": q.field}}
+}
+
+// PrefixQuery 前缀查询
+type PrefixQuery struct {
+	field  string
+	prefix string
+}
+
+// NewPrefixQuery 创建 prefix 查询
+func NewPrefixQuery(field, prefix string) *PrefixQuery {
+	return &PrefixQuery{field: field, prefix: prefix}
+}
+
+// Source 实现 Query 接口
+func (q *PrefixQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"prefix": map[string]interface{}{q.field: map[string]interface{}{"value": q.prefix}}}
+}
+
+// WildcardQuery 通配符查询，支持 * 与 ?
+type WildcardQuery struct {
+	field   string
+	pattern string
+}
+
+// NewWildcardQuery 创建 wildcard 查询
+func NewWildcardQuery(field, pattern string) *WildcardQuery {
+	return &WildcardQuery{field: field, pattern: pattern}
+}
+
+// Source 实现 Query 接口
+func (q *WildcardQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"wildcard": map[string]interface{}{q.field: map[string]interface{}{"value": q.pattern}}}
+}
+
+// IdsQuery 按文档 ID 查询
+type IdsQuery struct {
+	ids []string
+}
+
+// NewIdsQuery 创建 ids 查询
+func NewIdsQuery(ids ...string) *IdsQuery {
+	return &IdsQuery{ids: ids}
+}
+
+// Source 实现 Query 接口
+func (q *IdsQuery) Source() map[string]interface{} {
+	ids := q.ids
+	if ids == nil {
+		ids = []string{}
+	}
+	return map[string]interface{}{"ids": map[string]interface{}{"values": ids}}
+}
+
+// QueryStringQuery Lucene 语法的查询字符串
+type QueryStringQuery struct {
+	options map[string]interface{}
+}
+
+// NewQueryStringQuery 创建 query_string 查询
+func NewQueryStringQuery(query string) *QueryStringQuery {
+	return &QueryStringQuery{options: map[string]interface{}{"query": query}}
+}
+
+// DefaultField 设置查询字符串未指定字段时使用的字段
+func (q *QueryStringQuery) DefaultField(field string) *QueryStringQuery {
+	q.options["default_field"] = field
+	return q
+}
+
+// DefaultOperator 设置词项之间的默认关系：OR（默认）或 AND
+func (q *QueryStringQuery) DefaultOperator(operator string) *QueryStringQuery {
+	q.options["default_operator"] = operator
+	return q
+}
+
+// Source 实现 Query 接口
+func (q *QueryStringQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"query_string": q.options}
+}
+
+// BoolQuery 组合查询
+type BoolQuery struct {
+	must, should, filter, mustNot []Query
+	options                       map[string]interface{}
+}
+
+// NewBoolQuery 创建 bool 查询
+func NewBoolQuery() *BoolQuery {
+	return &BoolQuery{options: map[string]interface{}{}}
+}
+
+// Must 文档必须匹配，参与评分
+func (q *BoolQuery) Must(queries ...Query) *BoolQuery {
+	q.must = append(q.must, queries...)
+	return q
+}
+
+// Should 文档应当匹配，参与评分
+func (q *BoolQuery) Should(queries ...Query) *BoolQuery {
+	q.should = append(q.should, queries...)
+	return q
+}
+
+// Filter 文档必须匹配，不参与评分
+func (q *BoolQuery) Filter(queries ...Query) *BoolQuery {
+	q.filter = append(q.filter, queries...)
+	return q
+}
+
+// MustNot 文档不能匹配
+func (q *BoolQuery) MustNot(queries ...Query) *BoolQuery {
+	q.mustNot = append(q.mustNot, queries...)
+	return q
+}
+
+// MinimumShouldMatch 设置最少匹配的 should 子句数，如 "1"、"50%"
+func (q *BoolQuery) MinimumShouldMatch(minimumShouldMatch string) *BoolQuery {
+	q.options["minimum_should_match"] = minimumShouldMatch
+	return q
+}
+
+// Boost 设置评分权重
+func (q *BoolQuery) Boost(boost float64) *BoolQuery {
+	q.options["boost"] = boost
+	return q
+}
+
+// Source 实现 Query 接口
+func (q *BoolQuery) Source() map[string]interface{} {
+	body := make(map[string]interface{}, len(q.options)+4)
+	for k, v := range q.options {
+		body[k] = v
+	}
+	for name, clauses := range map[string][]Query{"must": q.must, "should": q.should, "filter": q.filter, "must_not": q.mustNot} {
+		if len(clauses) == 0 {
+			continue
+		}
+		sources := make([]interface{}, 0, len(clauses))
+		for _, clause := range clauses {
+			sources = append(sources, clause.Source())
+		}
+		body[name] = sources
+	}
+	return map[string]interface{}{"bool": body}
+}
+
+// NestedQuery 嵌套对象查询
+type NestedQuery struct {
+	path    string
+	query   Query
+	options map[string]interface{}
+}
+
+// NewNestedQuery 创建 nested 查询
+func NewNestedQuery(path string, query Query) *NestedQuery {
+	return &NestedQuery{path: path, query: query, options: map[string]interface{}{}}
+}
+
+// ScoreMode 设置嵌套文档得分的合并方式：avg（默认）、max、min、sum、none
+func (q *NestedQuery) ScoreMode(scoreMode string) *NestedQuery {
+	q.options["score_mode"] = scoreMode
+	return q
+}
+
+// Source 实现 Query 接口
+func (q *NestedQuery) Source() map[string]interface{} {
+	body := map[string]interface{}{"path": q.path, "query": q.query.Source()}
+	for k, v := range q.options {
+		body[k] = v
+	}
+	return map[string]interface{}{"nested": body}
+}
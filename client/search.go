@@ -0,0 +1,332 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SearchService 搜索请求
+// POST /{index}/_search，未指定索引时搜索所有索引
+type SearchService struct {
+	client       *Client
+	indices      []string
+	query        Query
+	from, size   *int
+	sort         []interface{}
+	source       interface{}
+	searchAfter  []interface{}
+	aggregations map[string]Aggregation
+	trackTotal   interface{}
+	routing      string
+}
+
+// Search 创建搜索请求，indices 支持逗号分隔与通配符
+func (c *Client) Search(indices ...string) *SearchService {
+	return &SearchService{client: c, indices: indices}
+}
+
+// Query 设置查询，未设置时匹配所有文档
+func (s *SearchService) Query(query Query) *SearchService {
+	s.query = query
+	return s
+}
+
+// From 设置结果的起始位置
+func (s *SearchService) From(from int) *SearchService {
+	s.from = &from
+	return s
+}
+
+// Size 设置返回的文档数
+func (s *SearchService) Size(size int) *SearchService {
+	s.size = &size
+	return s
+}
+
+// Sort 按字段排序，可多次调用；字段为 _score 时按相关性排序
+func (s *SearchService) Sort(field string, ascending bool) *SearchService {
+	order := "desc"
+	if ascending {
+		order = "asc"
+	}
+	s.sort = append(s.sort, map[string]interface{}{field: map[string]interface{}{"order": order}})
+	return s
+}
+
+// SearchAfter 设置上一页最后一条结果的排序值，用于深度分页
+func (s *SearchService) SearchAfter(values ...interface{}) *SearchService {
+	s.searchAfter = values
+	return s
+}
+
+// FetchSource 设置是否返回 _source
+func (s *SearchService) FetchSource(fetch bool) *SearchService {
+	s.source = fetch
+	return s
+}
+
+// SourceIncludes 设置返回的 _source 字段，支持通配符
+func (s *SearchService) SourceIncludes(fields ...string) *SearchService {
+	s.source = fields
+	return s
+}
+
+// Aggregation 添加聚合
+func (s *SearchService) Aggregation(name string, agg Aggregation) *SearchService {
+	if s.aggregations == nil {
+		s.aggregations = make(map[string]Aggregation)
+	}
+	s.aggregations[name] = agg
+	return s
+}
+
+// TrackTotalHits 设置是否精确统计命中总数
+func (s *SearchService) TrackTotalHits(track bool) *SearchService {
+	s.trackTotal = track
+	return s
+}
+
+// Routing 只搜索指定路由值的文档
+func (s *SearchService) Routing(routing string) *SearchService {
+	s.routing = routing
+	return s
+}
+
+// Source 返回请求体
+func (s *SearchService) Source() map[string]interface{} {
+	body := make(map[string]interface{})
+	if s.query != nil {
+		body["query"] = s.query.Source()
+	}
+	if s.from != nil {
+		body["from"] = *s.from
+	}
+	if s.size != nil {
+		body["size"] = *s.size
+	}
+	if len(s.sort) > 0 {
+		body["sort"] = s.sort
+	}
+	if len(s.searchAfter) > 0 {
+		body["search_after"] = s.searchAfter
+	}
+	if s.source != nil {
+		body["_source"] = s.source
+	}
+	if s.trackTotal != nil {
+		body["track_total_hits"] = s.trackTotal
+	}
+	if len(s.aggregations) > 0 {
+		aggs := make(map[string]interface{}, len(s.aggregations))
+		for name, agg := range s.aggregations {
+			aggs[name] = agg.Source()
+		}
+		body["aggs"] = aggs
+	}
+	return body
+}
+
+// Do 执行搜索
+func (s *SearchService) Do(ctx context.Context) (*SearchResult, error) {
+	path := "/_search"
+	if len(s.indices) > 0 {
+		path = "/" + escapePath(strings.Join(s.indices, ",")) + "/_search"
+	}
+	params := url.Values{}
+	if s.routing != "" {
+		params.Set("routing", s.routing)
+	}
+	req, err := jsonRequest(http.MethodPost, path, params, s.Source())
+	if err != nil {
+		return nil, err
+	}
+	var result SearchResult
+	if _, err := s.client.perform(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SearchResult 搜索结果
+type SearchResult struct {
+	Took         int64                      `json:"took"`
+	TimedOut     bool                       `json:"timed_out"`
+	Hits         SearchHits                 `json:"hits"`
+	Aggregations map[string]json.RawMessage `json:"aggregations,omitempty"`
+}
+
+// SearchHits 命中的文档
+type SearchHits struct {
+	Total    TotalHits    `json:"total"`
+	MaxScore *float64     `json:"max_score"`
+	Hits     []*SearchHit `json:"hits"`
+}
+
+// TotalHits 命中总数，Relation 为 gte 时 Value 是下限
+type TotalHits struct {
+	Value    int64  `json:"value"`
+	Relation string `json:"relation"`
+}
+
+// SearchHit 单个命中的文档
+type SearchHit struct {
+	Index   string          `json:"_index"`
+	ID      string          `json:"_id"`
+	Score   *float64        `json:"_score"`
+	Routing string          `json:"_routing,omitempty"`
+	Source  json.RawMessage `json:"_source,omitempty"`
+	Sort    []interface{}   `json:"sort,omitempty"`
+}
+
+// Decode 将 _source 解码到 v
+func (h *SearchHit) Decode(v interface{}) error {
+	return json.Unmarshal(h.Source, v)
+}
+
+// Bucket 桶聚合的单个桶，子聚合保存在 Aggregations 中
+type Bucket struct {
+	Key          interface{}                `json:"key"`
+	KeyAsString  string                     `json:"key_as_string,omitempty"`
+	DocCount     int64                      `json:"doc_count"`
+	Aggregations map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析桶，key、key_as_string 与 doc_count 以外的字段作为子聚合
+// TigerDB 把子聚合放在桶的 aggregations 字段中，与直接放在桶中的 ES 格式一并支持
+func (b *Bucket) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	type plain Bucket
+	if err := json.Unmarshal(data, (*plain)(b)); err != nil {
+		return err
+	}
+	for name, raw := range fields {
+		if name == "key" || name == "key_as_string" || name == "doc_count" {
+			continue
+		}
+		if b.Aggregations == nil {
+			b.Aggregations = make(map[string]json.RawMessage)
+		}
+		if name == "aggregations" {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &nested); err == nil {
+				for subName, subRaw := range nested {
+					b.Aggregations[subName] = subRaw
+				}
+				continue
+			}
+		}
+		b.Aggregations[name] = raw
+	}
+	return nil
+}
+
+// Buckets 解析名为 name 的桶聚合（terms、histogram、date_histogram、range 等）的结果
+func (r *SearchResult) Buckets(name string) ([]*Bucket, error) {
+	return decodeBuckets(r.Aggregations, name)
+}
+
+// Buckets 解析子聚合中名为 name 的桶聚合的结果
+func (b *Bucket) Buckets(name string) ([]*Bucket, error) {
+	return decodeBuckets(b.Aggregations, name)
+}
+
+// Metric 解析名为 name 的单值指标聚合（avg、sum、min、max、cardinality、value_count）的结果，没有值时返回 nil
+func (r *SearchResult) Metric(name string) (*float64, error) {
+	return decodeMetric(r.Aggregations, name)
+}
+
+// Metric 解析子聚合中名为 name 的单值指标聚合的结果
+func (b *Bucket) Metric(name string) (*float64, error) {
+	return decodeMetric(b.Aggregations, name)
+}
+
+func decodeBuckets(aggs map[string]json.RawMessage, name string) ([]*Bucket, error) {
+	raw, ok := aggs[name]
+	if !ok {
+		return nil, fmt.Errorf("aggregation [%s] not found", name)
+	}
+	var agg struct {
+		Buckets json.RawMessage `json:"buckets"`
+	}
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return nil, fmt.Errorf("invalid aggregation [%s]: %w", name, err)
+	}
+	var buckets []*Bucket
+	if len(agg.Buckets) > 0 && agg.Buckets[0] == '{' {
+		// keyed 桶：{"key": {...}}
+		var keyed map[string]*Bucket
+		if err := json.Unmarshal(agg.Buckets, &keyed); err != nil {
+			return nil, fmt.Errorf("invalid aggregation [%s]: %w", name, err)
+		}
+		for key, bucket := range keyed {
+			if bucket.Key == nil {
+				bucket.Key = key
+			}
+			buckets = append(buckets, bucket)
+		}
+		return buckets, nil
+	}
+	if err := json.Unmarshal(agg.Buckets, &buckets); err != nil {
+		return nil, fmt.Errorf("invalid aggregation [%s]: %w", name, err)
+	}
+	return buckets, nil
+}
+
+func decodeMetric(aggs map[string]json.RawMessage, name string) (*float64, error) {
+	raw, ok := aggs[name]
+	if !ok {
+		return nil, fmt.Errorf("aggregation [%s] not found", name)
+	}
+	var agg struct {
+		Value *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return nil, fmt.Errorf("invalid aggregation [%s]: %w", name, err)
+	}
+	return agg.Value, nil
+}
+
+// Count 统计匹配查询的文档数，query 为 nil 时统计所有文档
+// POST /{index}/_count
+func (c *Client) Count(ctx context.Context, query Query, indices ...string) (int64, error) {
+	path := "/_count"
+	if len(indices) > 0 {
+		path = "/" + escapePath(strings.Join(indices, ",")) + "/_count"
+	}
+	body := map[string]interface{}{}
+	if query != nil {
+		body["query"] = query.Source()
+	}
+	req, err := jsonRequest(http.MethodPost, path, nil, body)
+	if err != nil {
+		return 0, err
+	}
+	var result struct {
+		Count int64 `json:"count"`
+	}
+	if _, err := c.perform(ctx, req, &result); err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
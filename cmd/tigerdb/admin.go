@@ -0,0 +1,1024 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorilla/mux"
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/config"
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/handler"
+	es "github.com/lscgzwd/tiggerdb/protocols/es/index"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// 离线管理命令：直接操作数据目录，不需要启动 HTTP 服务（用于运维恢复场景）
+// 运行前需停止使用同一数据目录的 tigerdb 服务：命令先获取数据目录锁（见 lockDataDir），锁被占用时直接拒绝执行；
+// 不支持文件锁的平台上，索引文件锁被占用时命令会在 adminOpenTimeout 后失败
+
+const (
+	// adminOpenTimeout 打开索引时等待文件锁的最长时间
+	adminOpenTimeout = "1s"
+	// adminPageSize 遍历文档时每页的文档数
+	adminPageSize = 1000
+	// defaultImportBatchSize 导入时每次 bulk 提交的文档数
+	defaultImportBatchSize = 1000
+	// maxImportLineSize 导入文件单行最大字节数
+	maxImportLineSize = 64 * 1024 * 1024
+	// maxReportedProblems 每个索引最多输出的问题数
+	maxReportedProblems = 10
+)
+
+// indexBodySuffix 导出时与文档文件一同写出的索引定义文件后缀（创建索引的请求体：settings、mappings、aliases）
+const indexBodySuffix = ".index.json"
+
+var adminCommands = map[string]func(args []string) error{
+	"index":    runIndexCommand,
+	"export":   runExportCommand,
+	"import":   runImportCommand,
+	"compact":  runCompactCommand,
+	"metadata": runMetadataCommand,
+}
+
+// isAdminCommand 判断命令行第一个参数是否为离线管理命令
+func isAdminCommand(name string) bool {
+	_, ok := adminCommands[name]
+	return ok
+}
+
+// runAdminCommand 执行离线管理命令，返回进程退出码
+func runAdminCommand(args []string) int {
+	if err := adminCommands[args[0]](args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// adminFlags 离线管理命令的公共参数
+type adminFlags struct {
+	fs         *flag.FlagSet
+	configFile *string
+	c          *string
+	dataDir    *string
+}
+
+func newAdminFlags(name, usage string) *adminFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	f := &adminFlags{
+		fs:         fs,
+		configFile: fs.String("config", "", "Configuration file path"),
+		c:          fs.String("c", "", "Configuration file path (short)"),
+		dataDir:    fs.String("data-dir", "", "Data directory path"),
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  tigerdb %s\n\nFlags:\n", usage)
+		fs.PrintDefaults()
+	}
+	return f
+}
+
+// adminEnv 离线管理命令共享的核心组件
+type adminEnv struct {
+	dirMgr       directory.DirectoryManager
+	metaStore    metadata.MetadataStore
+	indexMgr     *es.IndexManager
+	indexHandler *handler.IndexHandler
+	docHandler   *handler.DocumentHandler
+	lock         *dataDirLock
+}
+
+// loadConfig 按配置优先级（命令行 > 环境变量 > 配置文件 > 默认值）加载配置并初始化日志，要求数据目录已存在
+func (f *adminFlags) loadConfig() (*config.GlobalConfig, error) {
+	configPath := *f.configFile
+	if *f.c != "" {
+		configPath = *f.c
+	}
+	if configPath == "" {
+		configPath = "config.yaml"
+	}
+	globalConfig, err := LoadGlobalConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	globalConfig.ApplyEnvOverrides()
+	if *f.dataDir != "" {
+		globalConfig.DataDir = *f.dataDir
+	}
+	if err := globalConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	if err := initLogger(globalConfig); err != nil {
+		return nil, err
+	}
+	// 管理命令只输出警告及以上级别的日志，避免干扰命令输出
+	if logger.GetGlobalLogger().GetLevel() < logger.LevelWarn {
+		logger.SetLevel(logger.LevelWarn)
+	}
+
+	// 数据目录不存在时直接报错，避免在错误的路径上初始化空的数据目录
+	dataDir := globalConfig.GetDataDir()
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, fmt.Errorf("data directory %s is not accessible: %w", dataDir, err)
+	}
+	return globalConfig, nil
+}
+
+// metadataStoreConfig 返回数据目录下指定存储类型的元数据存储配置
+func metadataStoreConfig(dataDir, storageType string) *metadata.MetadataStoreConfig {
+	return &metadata.MetadataStoreConfig{
+		StorageType:      storageType,
+		FilePath:         filepath.Join(dataDir, "metadata"),
+		EnableCache:      true,
+		EnableVersioning: true,
+	}
+}
+
+// openEnv 加载配置、获取数据目录锁并打开核心组件
+func (f *adminFlags) openEnv() (*adminEnv, error) {
+	globalConfig, err := f.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	dataDir := globalConfig.GetDataDir()
+	lock, err := lockDataDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dirMgr, err := directory.NewDirectoryManager(globalConfig.DirectoryConfig())
+	if err != nil {
+		lock.Release()
+		return nil, fmt.Errorf("failed to create directory manager: %w", err)
+	}
+	metaStore, err := metadata.NewMetadataStore(metadataStoreConfig(dataDir, globalConfig.GetMetadataStorageType()))
+	if err != nil {
+		lock.Release()
+		return nil, fmt.Errorf("failed to create metadata store: %w", err)
+	}
+
+	indexMgr := es.NewIndexManager(dirMgr, metaStore)
+	indexMgr.SetOpenConfig(map[string]interface{}{"bolt_timeout": adminOpenTimeout})
+	indexHandler := handler.NewIndexHandler(dirMgr, metaStore)
+	indexHandler.SetIndexManager(indexMgr)
+
+	return &adminEnv{
+		dirMgr:       dirMgr,
+		metaStore:    metaStore,
+		indexMgr:     indexMgr,
+		indexHandler: indexHandler,
+		docHandler:   handler.NewDocumentHandler(indexMgr, dirMgr, metaStore),
+		lock:         lock,
+	}, nil
+}
+
+// Close 关闭所有已打开的索引和元数据存储，并释放数据目录锁
+func (e *adminEnv) Close() {
+	if err := e.indexMgr.CloseAll(); err != nil {
+		logger.Warn("Failed to close indices: %v", err)
+	}
+	if err := e.metaStore.Close(); err != nil {
+		logger.Warn("Failed to close metadata store: %v", err)
+	}
+	e.lock.Release()
+}
+
+// resolveIndices 返回指定的索引（必须存在），未指定时返回所有索引
+func (e *adminEnv) resolveIndices(indexName string) ([]string, error) {
+	if indexName != "" {
+		if !e.dirMgr.IndexExists(indexName) {
+			return nil, fmt.Errorf("index [%s] not found", indexName)
+		}
+		return []string{indexName}, nil
+	}
+	names, err := e.dirMgr.ListIndices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indices: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// rootDocCount 返回索引的根文档数（不含 nested 子文档）
+func rootDocCount(idx bleve.Index) (uint64, error) {
+	req := bleve.NewSearchRequestOptions(dsl.ExcludeNestedDocuments(query.NewMatchAllQuery()), 0, 0, false)
+	res, err := idx.Search(req)
+	if err != nil {
+		return 0, err
+	}
+	return res.Total, nil
+}
+
+// forEachDocument 按 _id 顺序分页遍历匹配 q 的文档
+func forEachDocument(idx bleve.Index, q query.Query, fn func(id string) error) error {
+	var after []string
+	for {
+		req := bleve.NewSearchRequestOptions(q, adminPageSize, 0, false)
+		req.SortBy([]string{"_id"})
+		req.SearchAfter = after
+		res, err := idx.Search(req)
+		if err != nil {
+			return err
+		}
+		for _, hit := range res.Hits {
+			if err := fn(hit.ID); err != nil {
+				return err
+			}
+		}
+		if len(res.Hits) < adminPageSize {
+			return nil
+		}
+		after = []string{res.Hits[len(res.Hits)-1].ID}
+	}
+}
+
+// dirSize 返回目录下所有文件的总大小
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// runIndexCommand tigerdb index list|inspect|verify
+func runIndexCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: tigerdb index <list|inspect|verify> [flags]")
+	}
+	switch args[0] {
+	case "list":
+		return runIndexList(args[1:])
+	case "inspect":
+		return runIndexInspect(args[1:])
+	case "verify":
+		return runIndexVerify(args[1:])
+	default:
+		return fmt.Errorf("unknown index command [%s], expected list, inspect or verify", args[0])
+	}
+}
+
+// runIndexList 列出所有索引及其状态
+func runIndexList(args []string) error {
+	f := newAdminFlags("index list", "index list [--data-dir DIR]")
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	env, err := f.openEnv()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	names, err := env.resolveIndices("")
+	if err != nil {
+		return err
+	}
+	metas, err := env.metaStore.ListIndexMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list index metadata: %w", err)
+	}
+	hasMeta := make(map[string]bool, len(metas))
+	for _, meta := range metas {
+		hasMeta[meta.Name] = true
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tSTATUS\tDOCS\tSEGMENTS\tSIZE")
+	for _, name := range names {
+		status, docs, segments := "ok", "-", "-"
+		if !hasMeta[name] {
+			status = "no_metadata"
+		}
+		if idx, err := env.indexMgr.GetIndex(name); err != nil {
+			status = "unreadable"
+		} else {
+			if n, err := rootDocCount(idx); err == nil {
+				docs = fmt.Sprintf("%d", n)
+			}
+			if n, err := env.indexMgr.SegmentCount(name); err == nil {
+				segments = fmt.Sprintf("%d", n)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", name, status, docs, segments, dirSize(env.dirMgr.GetIndexPath(name)))
+	}
+	// 只有元数据没有数据目录的索引
+	for _, meta := range metas {
+		if !env.dirMgr.IndexExists(meta.Name) {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t0\n", meta.Name, "no_data")
+		}
+	}
+	return w.Flush()
+}
+
+// runIndexInspect 以 JSON 格式输出索引的详细信息
+func runIndexInspect(args []string) error {
+	f := newAdminFlags("index inspect", "index inspect [--data-dir DIR] --index NAME")
+	indexName := f.fs.String("index", "", "Index name")
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	if *indexName == "" {
+		*indexName = f.fs.Arg(0)
+	}
+	if *indexName == "" {
+		return fmt.Errorf("--index is required")
+	}
+	env, err := f.openEnv()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	if _, err := env.resolveIndices(*indexName); err != nil {
+		return err
+	}
+	info := map[string]interface{}{
+		"index":         *indexName,
+		"path":          env.dirMgr.GetIndexPath(*indexName),
+		"size_in_bytes": dirSize(env.dirMgr.GetIndexPath(*indexName)),
+	}
+	if meta, err := env.metaStore.GetIndexMetadata(*indexName); err == nil {
+		info["metadata"] = meta
+	} else {
+		info["metadata_error"] = err.Error()
+	}
+
+	idx, err := env.indexMgr.GetIndex(*indexName)
+	if err != nil {
+		info["store_error"] = err.Error()
+	} else {
+		docs := map[string]interface{}{}
+		if n, err := rootDocCount(idx); err == nil {
+			docs["count"] = n
+		}
+		if n, err := idx.DocCount(); err == nil {
+			docs["total_including_nested"] = n
+		}
+		info["docs"] = docs
+		if n, err := env.indexMgr.SegmentCount(*indexName); err == nil {
+			info["segments"] = n
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(info)
+}
+
+// runIndexVerify 校验索引：元数据存在、存储可以打开、每个文档都可以读取
+func runIndexVerify(args []string) error {
+	f := newAdminFlags("index verify", "index verify [--data-dir DIR] [--index NAME]")
+	indexName := f.fs.String("index", "", "Index name (default: all indices)")
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	if *indexName == "" {
+		*indexName = f.fs.Arg(0)
+	}
+	env, err := f.openEnv()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	names, err := env.resolveIndices(*indexName)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, name := range names {
+		checked, problems := env.verifyIndex(name)
+		if len(problems) == 0 {
+			fmt.Printf("index [%s]: OK (%d documents checked)\n", name, checked)
+			continue
+		}
+		failed++
+		fmt.Printf("index [%s]: FAILED (%d documents checked)\n", name, checked)
+		for i, p := range problems {
+			if i == maxReportedProblems {
+				fmt.Printf("  ... and %d more problems\n", len(problems)-maxReportedProblems)
+				break
+			}
+			fmt.Printf("  - %s\n", p)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("verification failed for %d of %d indices", failed, len(names))
+	}
+	return nil
+}
+
+func (e *adminEnv) verifyIndex(name string) (int, []string) {
+	var problems []string
+	if _, err := e.metaStore.GetIndexMetadata(name); err != nil {
+		problems = append(problems, fmt.Sprintf("metadata: %v", err))
+	}
+	idx, err := e.indexMgr.GetIndex(name)
+	if err != nil {
+		return 0, append(problems, fmt.Sprintf("store: %v", err))
+	}
+	if verification, err := es.VerifyStore(idx); err != nil {
+		problems = append(problems, fmt.Sprintf("segments: %v", err))
+	} else if !verification.Valid() {
+		// 段文件已损坏时读取文档可能越界，不再逐个读取
+		return 0, append(problems, verification.Problems...)
+	}
+	total, err := idx.DocCount()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("doc count: %v", err))
+	}
+
+	checked := 0
+	err = forEachDocument(idx, query.NewMatchAllQuery(), func(id string) error {
+		checked++
+		doc, err := idx.Document(id)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("document [%s]: %v", id, err))
+		} else if doc == nil {
+			problems = append(problems, fmt.Sprintf("document [%s]: matched by search but stored fields are missing", id))
+		}
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("search: %v", err))
+	} else if total != uint64(checked) {
+		problems = append(problems, fmt.Sprintf("doc count is %d but %d documents are searchable", total, checked))
+	}
+	return checked, problems
+}
+
+// runExportCommand 将索引的文档导出为 bulk 格式的 NDJSON，并写出创建索引的请求体
+func runExportCommand(args []string) error {
+	f := newAdminFlags("export", "export [--data-dir DIR] --index NAME --out FILE.ndjson")
+	indexName := f.fs.String("index", "", "Index name")
+	out := f.fs.String("out", "", "Output file (bulk NDJSON); index settings and mappings are written to FILE"+indexBodySuffix)
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	if *indexName == "" || *out == "" {
+		return fmt.Errorf("--index and --out are required")
+	}
+	env, err := f.openEnv()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	if _, err := env.resolveIndices(*indexName); err != nil {
+		return err
+	}
+	idx, err := env.indexMgr.GetIndex(*indexName)
+	if err != nil {
+		return err
+	}
+
+	if meta, err := env.metaStore.GetIndexMetadata(*indexName); err == nil {
+		if err := writeIndexBody(*out+indexBodySuffix, meta); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: index [%s] has no metadata, only documents are exported\n", *indexName)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Close()
+	bw := bufio.NewWriter(file)
+	enc := json.NewEncoder(bw)
+
+	exported := 0
+	err = forEachDocument(idx, dsl.ExcludeNestedDocuments(query.NewMatchAllQuery()), func(id string) error {
+		doc, err := idx.Document(id)
+		if err != nil {
+			return fmt.Errorf("failed to read document [%s]: %w", id, err)
+		}
+		if doc == nil {
+			return nil
+		}
+		action := map[string]interface{}{"index": map[string]interface{}{"_index": *indexName, "_id": id}}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(env.docHandler.DocumentSource(doc)); err != nil {
+			return err
+		}
+		exported++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	fmt.Printf("exported %d documents from index [%s] to %s\n", exported, *indexName, *out)
+	return nil
+}
+
+// writeIndexBody 写出创建索引的请求体（不包含 blocks 设置，避免导入时被只读 block 拒绝写入）
+func writeIndexBody(path string, meta *metadata.IndexMetadata) error {
+	settings := make(map[string]interface{}, len(meta.Settings))
+	for k, v := range meta.Settings {
+		if k == "blocks" {
+			continue
+		}
+		if k == "index" {
+			if m, ok := v.(map[string]interface{}); ok {
+				copied := make(map[string]interface{}, len(m))
+				for ik, iv := range m {
+					if ik != "blocks" {
+						copied[ik] = iv
+					}
+				}
+				v = copied
+			}
+		}
+		settings[k] = v
+	}
+	aliases := make(map[string]interface{}, len(meta.Aliases))
+	for _, alias := range meta.Aliases {
+		aliases[alias] = map[string]interface{}{}
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"settings": settings,
+		"mappings": meta.Mapping,
+		"aliases":  aliases,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write index definition: %w", err)
+	}
+	return nil
+}
+
+// runImportCommand 导入 bulk 格式的 NDJSON（与 POST /_bulk 的请求体相同）
+// 目标索引不存在时，使用导出时写出的索引定义文件（如果存在）创建索引
+func runImportCommand(args []string) error {
+	f := newAdminFlags("import", "import [--data-dir DIR] --in FILE.ndjson [--index NAME] [--batch-size N]")
+	in := f.fs.String("in", "", "Input file (bulk NDJSON)")
+	indexName := f.fs.String("index", "", "Target index (overrides _index in the action lines)")
+	indexBody := f.fs.String("index-body", "", "Create-index request body used when the target index does not exist (default: FILE"+indexBodySuffix+" if present)")
+	batchSize := f.fs.Int("batch-size", defaultImportBatchSize, "Number of documents per bulk batch")
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return fmt.Errorf("--in is required")
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("--batch-size must be positive")
+	}
+	if *indexBody == "" {
+		if _, err := os.Stat(*in + indexBodySuffix); err == nil {
+			*indexBody = *in + indexBodySuffix
+		}
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer file.Close()
+
+	env, err := f.openEnv()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	imp := &bulkImporter{env: env, targetIndex: *indexName, indexBody: *indexBody, created: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineSize)
+	lineNum := 0
+	expectSource := false
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if expectSource {
+			imp.buf.Write(line)
+			imp.buf.WriteByte('\n')
+			expectSource = false
+		} else if err := imp.addAction(line, lineNum, &expectSource); err != nil {
+			return err
+		}
+		if imp.pending >= *batchSize && !expectSource {
+			if err := imp.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read input file at line %d: %w", lineNum+1, err)
+	}
+	if expectSource {
+		return fmt.Errorf("missing document source after the last action line")
+	}
+	if err := imp.flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("imported %d documents, %d failed\n", imp.succeeded, imp.failed)
+	for _, reason := range imp.reasons {
+		fmt.Printf("  - %s\n", reason)
+	}
+	if imp.failed > 0 {
+		return fmt.Errorf("%d documents failed to import", imp.failed)
+	}
+	return nil
+}
+
+// bulkImporter 按批次通过 bulk 处理器导入文档（与 HTTP _bulk 走相同的写入流程）
+type bulkImporter struct {
+	env         *adminEnv
+	targetIndex string
+	indexBody   string
+	created     map[string]bool
+
+	buf       bytes.Buffer
+	pending   int
+	succeeded int
+	failed    int
+	reasons   []string
+}
+
+// addAction 写入一行操作（按 --index 改写 _index），expectSource 表示其后是否应跟随文档行
+func (imp *bulkImporter) addAction(line []byte, lineNum int, expectSource *bool) error {
+	var actionLine map[string]map[string]interface{}
+	if err := json.Unmarshal(line, &actionLine); err != nil || len(actionLine) != 1 {
+		return fmt.Errorf("invalid action at line %d", lineNum)
+	}
+	for action, meta := range actionLine {
+		if meta == nil {
+			return fmt.Errorf("invalid action at line %d", lineNum)
+		}
+		if imp.targetIndex != "" {
+			meta["_index"] = imp.targetIndex
+		}
+		name, _ := meta["_index"].(string)
+		if name == "" {
+			return fmt.Errorf("missing _index at line %d (use --index to set the target index)", lineNum)
+		}
+		if err := imp.ensureIndex(name); err != nil {
+			return err
+		}
+		data, err := json.Marshal(actionLine)
+		if err != nil {
+			return err
+		}
+		imp.buf.Write(data)
+		imp.buf.WriteByte('\n')
+		*expectSource = action != "delete"
+	}
+	imp.pending++
+	return nil
+}
+
+// ensureIndex 目标索引不存在时创建索引
+func (imp *bulkImporter) ensureIndex(name string) error {
+	if imp.created[name] || imp.env.dirMgr.IndexExists(name) {
+		return nil
+	}
+	var body []byte
+	if imp.indexBody != "" {
+		var err error
+		if body, err = os.ReadFile(imp.indexBody); err != nil {
+			return fmt.Errorf("failed to read index definition: %w", err)
+		}
+	}
+	status, resp := callHandler(imp.env.indexHandler.CreateIndex, http.MethodPut, "/"+name, map[string]string{"index": name}, body, "application/json")
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to create index [%s]: %s", name, resp)
+	}
+	// CreateIndex 不处理 aliases，导入时按索引定义恢复别名
+	if len(body) > 0 {
+		var def struct {
+			Aliases map[string]interface{} `json:"aliases"`
+		}
+		if err := json.Unmarshal(body, &def); err == nil && len(def.Aliases) > 0 {
+			if meta, err := imp.env.metaStore.GetIndexMetadata(name); err == nil {
+				for alias := range def.Aliases {
+					meta.Aliases = append(meta.Aliases, alias)
+				}
+				sort.Strings(meta.Aliases)
+				if err := imp.env.metaStore.SaveIndexMetadata(name, meta); err != nil {
+					return fmt.Errorf("failed to restore aliases of index [%s]: %w", name, err)
+				}
+			}
+		}
+	}
+	imp.created[name] = true
+	fmt.Printf("created index [%s]\n", name)
+	return nil
+}
+
+// flush 提交当前批次
+func (imp *bulkImporter) flush() error {
+	if imp.pending == 0 {
+		return nil
+	}
+	status, resp := callHandler(imp.env.docHandler.Bulk, http.MethodPost, "/_bulk", nil, imp.buf.Bytes(), "application/x-ndjson")
+	imp.buf.Reset()
+	imp.pending = 0
+	if status != http.StatusOK {
+		return fmt.Errorf("bulk request failed: %s", resp)
+	}
+
+	var bulkResp handler.BulkResponse
+	if err := json.Unmarshal(resp, &bulkResp); err != nil {
+		return fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	for _, item := range bulkResp.Items {
+		for _, v := range item {
+			result, _ := v.(map[string]interface{})
+			if code, _ := result["status"].(float64); code >= 300 {
+				imp.failed++
+				if len(imp.reasons) < maxReportedProblems {
+					imp.reasons = append(imp.reasons, fmt.Sprintf("[%v][%v]: %v", result["_index"], result["_id"], result["error"]))
+				}
+			} else {
+				imp.succeeded++
+			}
+		}
+	}
+	return nil
+}
+
+// callHandler 在进程内调用 ES 处理器（不经过 HTTP 服务），返回状态码和响应体
+func callHandler(h http.HandlerFunc, method, path string, vars map[string]string, body []byte, contentType string) (int, []byte) {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if vars != nil {
+		req = mux.SetURLVars(req, vars)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	resp, _ := io.ReadAll(rec.Result().Body)
+	return rec.Code, resp
+}
+
+// runCompactCommand 强制合并索引段（与 POST /<index>/_forcemerge 相同）
+func runCompactCommand(args []string) error {
+	f := newAdminFlags("compact", "compact [--data-dir DIR] [--index NAME] [--max-num-segments N] [--only-expunge-deletes]")
+	indexName := f.fs.String("index", "", "Index name (default: all indices)")
+	maxNumSegments := f.fs.Int("max-num-segments", 1, "Target number of segments")
+	onlyExpungeDeletes := f.fs.Bool("only-expunge-deletes", false, "Only merge segments containing deleted documents")
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	env, err := f.openEnv()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	names, err := env.resolveIndices(*indexName)
+	if err != nil {
+		return err
+	}
+	opts := es.ForceMergeOptions{MaxNumSegments: *maxNumSegments, OnlyExpungeDeletes: *onlyExpungeDeletes}
+	failed := 0
+	for _, name := range names {
+		start := time.Now()
+		result, err := env.indexMgr.ForceMerge(context.Background(), name, opts)
+		if err != nil {
+			failed++
+			fmt.Printf("index [%s]: FAILED: %v\n", name, err)
+			continue
+		}
+		fmt.Printf("index [%s]: segments %d -> %d (took %s)\n", name, result.SegmentsBefore, result.SegmentsAfter, time.Since(start).Round(time.Millisecond))
+	}
+	if failed > 0 {
+		return fmt.Errorf("compaction failed for %d of %d indices", failed, len(names))
+	}
+	return nil
+}
+
+// runMetadataCommand tigerdb metadata repair|migrate
+func runMetadataCommand(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "repair":
+			return runMetadataRepair(args[1:])
+		case "migrate":
+			return runMetadataMigrate(args[1:])
+		}
+	}
+	return fmt.Errorf("usage: tigerdb metadata repair|migrate [flags]")
+}
+
+// runMetadataMigrate 把元数据从一种存储类型复制到另一种（如 file -> bolt），源存储不做修改
+// 迁移完成后把配置中的 metadata.storage_type 改为目标类型再启动服务
+func runMetadataMigrate(args []string) error {
+	f := newAdminFlags("metadata migrate", "metadata migrate --from TYPE --to TYPE [--data-dir DIR] [--force]")
+	from := f.fs.String("from", "", "Source metadata storage type (file, bolt)")
+	to := f.fs.String("to", "", "Target metadata storage type (file, bolt)")
+	force := f.fs.Bool("force", false, "Migrate even if the target store already contains metadata")
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return fmt.Errorf("--from and --to are required")
+	}
+	if *from == *to {
+		return fmt.Errorf("source and target storage type are both %s", *from)
+	}
+	for _, storageType := range []string{*from, *to} {
+		if storageType != "file" && storageType != "bolt" {
+			return fmt.Errorf("unsupported metadata storage type: %s", storageType)
+		}
+	}
+	globalConfig, err := f.loadConfig()
+	if err != nil {
+		return err
+	}
+	dataDir := globalConfig.GetDataDir()
+	lock, err := lockDataDir(dataDir)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	src, err := metadata.NewMetadataStore(metadataStoreConfig(dataDir, *from))
+	if err != nil {
+		return fmt.Errorf("failed to open %s metadata store: %w", *from, err)
+	}
+	defer src.Close()
+	dst, err := metadata.NewMetadataStore(metadataStoreConfig(dataDir, *to))
+	if err != nil {
+		return fmt.Errorf("failed to open %s metadata store: %w", *to, err)
+	}
+	defer dst.Close()
+
+	// 目标存储已有元数据时默认拒绝，避免覆盖之前迁移后又修改过的数据
+	existing, err := dst.ListIndexMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list target index metadata: %w", err)
+	}
+	if len(existing) > 0 && !*force {
+		return fmt.Errorf("target %s metadata store already contains %d indices, use --force to overwrite", *to, len(existing))
+	}
+
+	stats, err := metadata.Migrate(src, dst)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("migrated %d indices, %d tables, %d stored scripts, %d watches, %d transforms, %d api keys and %d cluster settings from %s to %s\n",
+		stats.Indexes, stats.Tables, stats.Scripts, stats.Watches, stats.Transforms, stats.APIKeys, stats.ClusterSettings, *from, *to)
+	if globalConfig.GetMetadataStorageType() != *to {
+		fmt.Printf("set metadata.storage_type to %q in the configuration before starting the server\n", *to)
+	}
+	return nil
+}
+
+// runMetadataRepair 使元数据与数据目录保持一致：
+// 删除数据目录已不存在的索引元数据；为缺少元数据但存储可读的索引重建元数据（mapping 为空，需要重新设置）
+func runMetadataRepair(args []string) error {
+	f := newAdminFlags("metadata repair", "metadata repair [--data-dir DIR] [--dry-run]")
+	dryRun := f.fs.Bool("dry-run", false, "Only report problems without changing anything")
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	env, err := f.openEnv()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	names, err := env.resolveIndices("")
+	if err != nil {
+		return err
+	}
+	metas, err := env.metaStore.ListIndexMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list index metadata: %w", err)
+	}
+	hasMeta := make(map[string]bool, len(metas))
+	for _, meta := range metas {
+		hasMeta[meta.Name] = true
+	}
+
+	found, repaired, unrepairable := 0, 0, 0
+	for _, meta := range metas {
+		if env.dirMgr.IndexExists(meta.Name) {
+			continue
+		}
+		found++
+		fmt.Printf("index [%s]: data directory is missing, removing metadata\n", meta.Name)
+		if *dryRun {
+			continue
+		}
+		if err := env.metaStore.DeleteIndexMetadata(meta.Name); err != nil {
+			unrepairable++
+			fmt.Printf("  failed: %v\n", err)
+			continue
+		}
+		repaired++
+	}
+
+	for _, name := range names {
+		if hasMeta[name] {
+			continue
+		}
+		found++
+		if _, err := env.indexMgr.GetIndex(name); err != nil {
+			unrepairable++
+			fmt.Printf("index [%s]: metadata is missing and the store is unreadable, skipping: %v\n", name, err)
+			continue
+		}
+		fmt.Printf("index [%s]: metadata is missing, recreating it with an empty mapping (re-apply the mapping with PUT /%s/_mapping)\n", name, name)
+		if *dryRun {
+			continue
+		}
+		now := time.Now()
+		meta := &metadata.IndexMetadata{
+			Name:      name,
+			Mapping:   map[string]interface{}{},
+			Settings:  map[string]interface{}{},
+			Aliases:   []string{},
+			Version:   1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := env.metaStore.SaveIndexMetadata(name, meta); err != nil {
+			unrepairable++
+			fmt.Printf("  failed: %v\n", err)
+			continue
+		}
+		repaired++
+	}
+
+	switch {
+	case found == 0:
+		fmt.Println("metadata is consistent with the data directory")
+	case *dryRun:
+		fmt.Printf("%d problems found (dry run, nothing changed)\n", found)
+	default:
+		fmt.Printf("%d problems found, %d repaired\n", found, repaired)
+	}
+	if unrepairable > 0 {
+		return fmt.Errorf("%d problems could not be repaired", unrepairable)
+	}
+	return nil
+}
+
+// adminUsage 管理命令的帮助信息（ShowUsage 中展示）
+var adminUsage = strings.TrimSpace(`
+Admin commands (offline, stop the server using the same data directory first):
+  tigerdb index list                               List indices with status, document and segment counts
+  tigerdb index inspect --index NAME               Show index metadata, document count, segments and size
+  tigerdb index verify [--index NAME]              Check metadata and that every document can be read
+  tigerdb export --index NAME --out FILE.ndjson    Export documents as bulk NDJSON (+ FILE.ndjson.index.json)
+  tigerdb import --in FILE.ndjson [--index NAME]   Import bulk NDJSON, creating the index if needed
+  tigerdb compact [--index NAME]                   Force merge index segments
+  tigerdb metadata repair [--dry-run]              Reconcile index metadata with the data directory
+  tigerdb metadata migrate --from file --to bolt   Copy metadata to another storage type [--force]
+
+  All admin commands accept -c/--config and --data-dir.
+`)
@@ -0,0 +1,198 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/metadata"
+)
+
+// openTestEnv 以 --data-dir 打开离线管理命令使用的核心组件
+func openTestEnv(t *testing.T, dataDir string) *adminEnv {
+	t.Helper()
+	f := newAdminFlags("test", "test")
+	if err := f.fs.Parse([]string{"--data-dir", dataDir}); err != nil {
+		t.Fatal(err)
+	}
+	env, err := f.openEnv()
+	if err != nil {
+		t.Fatalf("open env: %v", err)
+	}
+	return env
+}
+
+// seedTestIndex 在数据目录中创建 orders 索引并写入三个文档
+func seedTestIndex(t *testing.T, dataDir string) {
+	t.Helper()
+	env := openTestEnv(t, dataDir)
+	defer env.Close()
+
+	body := `{"mappings": {"properties": {"region": {"type": "keyword"}, "amount": {"type": "long"}}}}`
+	if status, resp := callHandler(env.indexHandler.CreateIndex, http.MethodPut, "/orders",
+		map[string]string{"index": "orders"}, []byte(body), "application/json"); status != http.StatusOK {
+		t.Fatalf("create index: got %d: %s", status, resp)
+	}
+	bulk := `{"index": {"_index": "orders", "_id": "1"}}
+{"region": "eu", "amount": 10}
+{"index": {"_index": "orders", "_id": "2"}}
+{"region": "us", "amount": 20}
+{"index": {"_index": "orders", "_id": "3"}}
+{"region": "eu", "amount": 30}
+`
+	status, resp := callHandler(env.docHandler.Bulk, http.MethodPost, "/_bulk?refresh=true", nil, []byte(bulk), "application/x-ndjson")
+	if status != http.StatusOK || strings.Contains(string(resp), `"errors":true`) {
+		t.Fatalf("bulk: got %d: %s", status, resp)
+	}
+}
+
+func TestAdminExportImportRoundTrip(t *testing.T) {
+	dataDir := t.TempDir()
+	seedTestIndex(t, dataDir)
+
+	out := filepath.Join(t.TempDir(), "orders.ndjson")
+	if err := runExportCommand([]string{"--data-dir", dataDir, "--index", "orders", "--out", out}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if _, err := os.Stat(out + indexBodySuffix); err != nil {
+		t.Fatalf("expected the index definition to be exported: %v", err)
+	}
+	if err := runImportCommand([]string{"--data-dir", dataDir, "--in", out, "--index", "orders-copy"}); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	env := openTestEnv(t, dataDir)
+	defer env.Close()
+	meta, err := env.metaStore.GetIndexMetadata("orders-copy")
+	if err != nil {
+		t.Fatalf("expected the imported index to have metadata: %v", err)
+	}
+	props, _ := meta.Mapping["properties"].(map[string]interface{})
+	if region, _ := props["region"].(map[string]interface{}); region["type"] != "keyword" {
+		t.Errorf("expected the mapping to be restored from the index definition, got %v", meta.Mapping)
+	}
+	idx, err := env.indexMgr.GetIndex("orders-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := rootDocCount(idx); err != nil || n != 3 {
+		t.Fatalf("expected 3 imported documents, got %d (%v)", n, err)
+	}
+	doc, err := idx.Document("2")
+	if err != nil || doc == nil {
+		t.Fatalf("expected document 2 to be imported: %v", err)
+	}
+	if source := env.docHandler.DocumentSource(doc); source["region"] != "us" {
+		t.Errorf("unexpected source of document 2: %v", source)
+	}
+}
+
+func TestAdminIndexVerifyCorruptedSegment(t *testing.T) {
+	dataDir := t.TempDir()
+	seedTestIndex(t, dataDir)
+	if err := runIndexVerify([]string{"--data-dir", dataDir, "--index", "orders"}); err != nil {
+		t.Fatalf("expected an intact index to verify, got %v", err)
+	}
+
+	env := openTestEnv(t, dataDir)
+	indexPath := env.dirMgr.GetIndexPath("orders")
+	env.Close()
+	files, err := filepath.Glob(filepath.Join(indexPath, "store", "store", "*.zap"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("expected segment files, got %v (%v)", files, err)
+	}
+	f, err := os.OpenFile(files[0], os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff, 0xff}, 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	err = runIndexVerify([]string{"--data-dir", dataDir, "--index", "orders"})
+	if err == nil || !strings.Contains(err.Error(), "verification failed") {
+		t.Fatalf("expected verification of a corrupted segment to fail, got %v", err)
+	}
+}
+
+func TestAdminMetadataRepair(t *testing.T) {
+	dataDir := t.TempDir()
+	seedTestIndex(t, dataDir)
+
+	// orders 丢失元数据，ghost 只有元数据没有数据目录
+	env := openTestEnv(t, dataDir)
+	if err := env.metaStore.DeleteIndexMetadata("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.metaStore.SaveIndexMetadata("ghost", &metadata.IndexMetadata{Name: "ghost"}); err != nil {
+		t.Fatal(err)
+	}
+	env.Close()
+
+	check := func(wantOrders, wantGhost bool) {
+		t.Helper()
+		env := openTestEnv(t, dataDir)
+		defer env.Close()
+		if _, err := env.metaStore.GetIndexMetadata("orders"); (err == nil) != wantOrders {
+			t.Errorf("orders metadata: expected present=%v, got err=%v", wantOrders, err)
+		}
+		if _, err := env.metaStore.GetIndexMetadata("ghost"); (err == nil) != wantGhost {
+			t.Errorf("ghost metadata: expected present=%v, got err=%v", wantGhost, err)
+		}
+	}
+
+	if err := runMetadataRepair([]string{"--data-dir", dataDir, "--dry-run"}); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	check(false, true)
+	if err := runMetadataRepair([]string{"--data-dir", dataDir}); err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	check(true, false)
+}
+
+func TestAdminRefusesLockedDataDir(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd":
+	default:
+		t.Skipf("data directory locking is not supported on %s", runtime.GOOS)
+	}
+	dataDir := t.TempDir()
+	lock, err := lockDataDir(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runIndexList([]string{"--data-dir", dataDir})
+	if !errors.Is(err, errDataDirLocked) {
+		t.Fatalf("expected admin commands to refuse a locked data directory, got %v", err)
+	}
+	err = runMetadataMigrate([]string{"--data-dir", dataDir, "--from", "file", "--to", "bolt"})
+	if !errors.Is(err, errDataDirLocked) {
+		t.Fatalf("expected metadata migrate to refuse a locked data directory, got %v", err)
+	}
+
+	lock.Release()
+	if err := runIndexList([]string{"--data-dir", dataDir}); err != nil {
+		t.Fatalf("expected the released data directory to be usable, got %v", err)
+	}
+}
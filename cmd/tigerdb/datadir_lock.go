@@ -0,0 +1,68 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// 数据目录锁：服务启动时以及离线管理命令打开数据目录前，对 <data-dir>/tigerdb.lock 加排他锁（不等待），
+// 锁被其他进程持有时拒绝运行，避免两个进程同时写同一数据目录。进程退出时操作系统自动释放锁
+
+// dataDirLockFile 数据目录锁文件名
+const dataDirLockFile = "tigerdb.lock"
+
+// errDataDirLocked 数据目录的锁被其他进程持有
+var errDataDirLocked = errors.New("data directory is in use by another tigerdb process")
+
+// dataDirLock 当前进程持有的数据目录锁
+type dataDirLock struct {
+	file *os.File
+}
+
+// lockDataDir 对数据目录加排他锁，锁被其他进程持有时返回 errDataDirLocked
+func lockDataDir(dataDir string) (*dataDirLock, error) {
+	path := filepath.Join(dataDir, dataDirLockFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %w", path, err)
+	}
+	if err := tryLockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, errDataDirLocked) {
+			return nil, fmt.Errorf("%w: %s (stop the server before running admin commands)", errDataDirLocked, dataDir)
+		}
+		return nil, fmt.Errorf("failed to lock data directory %s: %w", dataDir, err)
+	}
+	// 记录持有锁的进程号，便于排查（锁本身不依赖文件内容）
+	if err := file.Truncate(0); err == nil {
+		_, _ = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &dataDirLock{file: file}, nil
+}
+
+// Release 释放数据目录锁
+func (l *dataDirLock) Release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	_ = unlockFile(l.file)
+	_ = l.file.Close()
+	l.file = nil
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import "os"
+
+// tryLockFile 当前平台不支持 flock，不检查数据目录是否被其他进程使用
+func tryLockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile 当前平台不支持 flock，无需释放
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -24,6 +24,9 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// reloadConfig 按启动时的配置文件路径与命令行参数重新加载配置（SIGHUP 时调用）
+var reloadConfig func() (*config.GlobalConfig, error)
+
 // ParseFlags 解析命令行参数
 // 配置优先级：命令行参数 > 环境变量 > 配置文件 > 默认值
 func ParseFlags() (*config.GlobalConfig, error) {
@@ -70,24 +73,28 @@ func ParseFlags() (*config.GlobalConfig, error) {
 		configPath = "config.yaml"
 	}
 
-	// 1. 加载配置文件（如果存在）
-	globalConfig, err := LoadGlobalConfig(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
-	}
+	reloadConfig = func() (*config.GlobalConfig, error) {
+		// 1. 加载配置文件（如果存在）
+		globalConfig, err := LoadGlobalConfig(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
 
-	// 2. 应用环境变量覆盖（优先级高于配置文件）
-	globalConfig.ApplyEnvOverrides()
+		// 2. 应用环境变量覆盖（优先级高于配置文件）
+		globalConfig.ApplyEnvOverrides()
 
-	// 3. 应用命令行参数覆盖（最高优先级）
-	applyCommandLineOverrides(globalConfig, dataDir, esHost, esPort, esEnabled, esLogLevel)
+		// 3. 应用命令行参数覆盖（最高优先级）
+		applyCommandLineOverrides(globalConfig, dataDir, esHost, esPort, esEnabled, esLogLevel)
 
-	// 4. 验证配置
-	if err := globalConfig.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+		// 4. 验证配置
+		if err := globalConfig.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+
+		return globalConfig, nil
 	}
 
-	return globalConfig, nil
+	return reloadConfig()
 }
 
 // applyCommandLineOverrides 应用命令行参数覆盖（最高优先级）
@@ -15,18 +15,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/lscgzwd/tiggerdb/config"
 	"github.com/lscgzwd/tiggerdb/directory"
 	"github.com/lscgzwd/tiggerdb/logger"
 	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols"
 	"github.com/lscgzwd/tiggerdb/protocols/es"
 )
 
@@ -38,6 +42,11 @@ const (
 )
 
 func main() {
+	// 离线管理命令（index/export/import/compact/metadata）直接操作数据目录，不启动服务
+	if len(os.Args) > 1 && isAdminCommand(os.Args[1]) {
+		os.Exit(runAdminCommand(os.Args[1:]))
+	}
+
 	// 解析命令行参数
 	globalConfig, err := ParseFlags()
 	if err != nil {
@@ -57,16 +66,23 @@ func main() {
 	dataDir := globalConfig.GetDataDir()
 
 	// 创建目录管理器
-	dirConfig := directory.DefaultDirectoryConfig(dataDir)
+	dirConfig := globalConfig.DirectoryConfig()
 	dirMgr, err := directory.NewDirectoryManager(dirConfig)
 	if err != nil {
 		log.Fatalf("Failed to create directory manager: %v", err)
 	}
 	defer dirMgr.Cleanup()
 
+	// 数据目录排他锁：拒绝与另一个服务进程或离线管理命令同时使用同一数据目录
+	lock, err := lockDataDir(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to lock data directory: %v", err)
+	}
+	defer lock.Release()
+
 	// 创建元数据存储
 	metaConfig := &metadata.MetadataStoreConfig{
-		StorageType:      "file",
+		StorageType:      globalConfig.GetMetadataStorageType(),
 		FilePath:         filepath.Join(dataDir, "metadata"),
 		EnableCache:      true,
 		EnableVersioning: true,
@@ -77,84 +93,165 @@ func main() {
 	}
 	defer metaStore.Close()
 
-	// 2. 创建ES协议服务器（如果启用）
-	if globalConfig.ES == nil || !globalConfig.ES.Enabled {
-		log.Fatalf("ES protocol is not enabled or not configured")
-	}
-
-	esServer, err := es.NewServer(dirMgr, metaStore, globalConfig.ES)
+	// 2. 创建并注册所有已启用的协议服务器
+	registry := protocols.NewRegistry()
+	esServer, err := registerProtocolServers(registry, dirMgr, metaStore, globalConfig)
 	if err != nil {
-		log.Fatalf("Failed to create ES server: %v", err)
+		log.Fatalf("Failed to create protocol servers: %v", err)
 	}
 
 	// 3. 显示启动信息
 	fmt.Printf("%s %s starting\n", Name, Version)
 	fmt.Printf("Data Directory: %s\n", dataDir)
-	if globalConfig.ES.Enabled {
-		fmt.Printf("ES Protocol: %s\n", esServer.Address())
-		fmt.Printf("Health check: http://%s/_health\n", esServer.Address())
+	for _, s := range registry.Servers() {
+		fmt.Printf("%s Protocol: %s\n", strings.ToUpper(s.Name()), s.Address())
+	}
+	if esServer != nil {
+		fmt.Printf("Health check: http://%s/_health/live, http://%s/_health/ready\n", esServer.Address(), esServer.Address())
 		if globalConfig.ES.ServerConfig != nil && globalConfig.ES.ServerConfig.EnableMetrics {
 			fmt.Printf("Metrics: http://%s/_metrics\n", esServer.Address())
 		}
 	}
+	if globalConfig.Health != nil && globalConfig.Health.Enabled {
+		fmt.Printf("Readiness check: http://%s/_ready\n", globalConfig.Health.Address())
+	}
 
-	// 4. 启动ES服务器（支持优雅关闭）
-	if err := startESServerWithGracefulShutdown(esServer); err != nil {
-		log.Fatalf("ES server failed: %v", err)
+	// 4. 启动所有协议服务器（支持优雅关闭，SIGHUP 重新加载配置）
+	if err := runProtocolServers(registry, esServer, globalConfig); err != nil {
+		log.Fatalf("Protocol server failed: %v", err)
 	}
 }
 
-// startESServerWithGracefulShutdown 启动ES服务器并支持优雅关闭
-func startESServerWithGracefulShutdown(esServer *es.ESServer) error {
-	// 启动错误通道
-	errChan := make(chan error, 1)
+// registerProtocolServers 创建所有已启用的协议服务器并注册到 registry
+// 返回 ES 服务器（未启用时为 nil），用于 SIGHUP 时重新加载 ES 配置
+func registerProtocolServers(registry *protocols.Registry, dirMgr directory.DirectoryManager, metaStore metadata.MetadataStore, globalConfig *config.GlobalConfig) (*es.ESServer, error) {
+	var esServer *es.ESServer
+	if globalConfig.ES != nil && globalConfig.ES.Enabled {
+		var err error
+		esServer, err = es.NewServer(dirMgr, metaStore, globalConfig.ES)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ES server: %w", err)
+		}
+		if err := registry.Register(esServer); err != nil {
+			return nil, err
+		}
+	}
 
-	// 在goroutine中启动服务器
-	go func() {
-		if err := esServer.Start(); err != nil && err != http.ErrServerClosed {
-			errChan <- err
+	// 预留协议尚未实现，启用时只记录警告
+	reserved := []struct {
+		name    string
+		enabled bool
+	}{
+		{"redis", globalConfig.Redis != nil && globalConfig.Redis.Enabled},
+		{"mysql", globalConfig.MySQL != nil && globalConfig.MySQL.Enabled},
+		{"postgresql", globalConfig.PostgreSQL != nil && globalConfig.PostgreSQL.Enabled},
+	}
+	for _, p := range reserved {
+		if p.enabled {
+			logger.Warn("%s protocol is enabled but not implemented yet, skipping", p.name)
 		}
-	}()
+	}
 
-	// 等待服务器启动完成（检查服务器是否正在运行）
+	if registry.Len() == 0 {
+		return nil, fmt.Errorf("no protocol server is enabled")
+	}
+	return esServer, nil
+}
+
+// runProtocolServers 启动所有协议服务器和就绪检查端点，等待退出信号后统一优雅关闭
+// 任一协议服务器启动失败或运行期间异常退出时，停止所有服务器并返回错误
+func runProtocolServers(registry *protocols.Registry, esServer *es.ESServer, globalConfig *config.GlobalConfig) error {
 	// 最多等待5秒，避免无限等待
-	startTimeout := time.NewTimer(5 * time.Second)
-	defer startTimeout.Stop()
+	if err := registry.StartAll(5 * time.Second); err != nil {
+		return err
+	}
+
+	readinessServer := startReadinessServer(registry, globalConfig.Health)
+	shutdown := func() error {
+		if readinessServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := readinessServer.Shutdown(ctx); err != nil {
+				logger.Warn("Failed to stop readiness server: %v", err)
+			}
+		}
+		return registry.StopAll()
+	}
 
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+	// POST /_shutdown 请求关闭（ES 协议未启用时为 nil channel，永不触发）
+	var shutdownRequested <-chan struct{}
+	if esServer != nil {
+		shutdownRequested = esServer.ShutdownRequested()
+	}
 
+	// 等待中断信号，SIGHUP 时重新加载配置文件；SIGTERM/SIGINT 时排空进行中的请求后退出
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	for {
 		select {
-		case <-startTimeout.C:
-			// 超时，但继续运行（可能服务器正在启动中）
-			log.Printf("WARN: Server startup check timeout, continuing...")
-			goto waitForSignal
-		case err := <-errChan:
-			// 启动失败
-			return fmt.Errorf("server startup failed: %w", err)
-		case <-ticker.C:
-			// 检查服务器是否正在运行
-			if esServer.IsRunning() {
-				goto waitForSignal
+		case <-shutdownRequested:
+			return shutdown()
+		case sig := <-quit:
+			if sig == syscall.SIGHUP {
+				globalConfig = reloadGlobalConfig(esServer, globalConfig)
+				continue
 			}
+			return shutdown()
+		case err := <-registry.Errors():
+			logger.Error("%v", err)
+			shutdown()
+			return err
 		}
 	}
+}
 
-waitForSignal:
-	// 等待中断信号
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+// startReadinessServer 在独立端口启动聚合就绪检查端点 GET /_ready（未启用时返回 nil）
+func startReadinessServer(registry *protocols.Registry, healthConfig *config.HealthConfig) *http.Server {
+	if healthConfig == nil || !healthConfig.Enabled {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/_ready", registry.ReadinessHandler())
+	srv := &http.Server{
+		Addr:              healthConfig.Address(),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Readiness server failed: %v", err)
+		}
+	}()
+	return srv
+}
 
-	log.Println("Shutting down ES server...")
-	if err := esServer.Stop(); err != nil {
-		log.Printf("ES server forced to shutdown: %v", err)
-		return err
+// reloadGlobalConfig 重新加载配置文件并应用到协议服务器，失败时保留原配置
+func reloadGlobalConfig(esServer *es.ESServer, current *config.GlobalConfig) *config.GlobalConfig {
+	logger.Info("Received SIGHUP, reloading configuration")
+	newConfig, err := reloadConfig()
+	if err != nil {
+		logger.Error("Failed to reload configuration: %v", err)
+		return current
+	}
+	if newConfig.GetDataDir() != current.GetDataDir() {
+		logger.Warn("Data directory change (%s -> %s) requires restart", current.GetDataDir(), newConfig.GetDataDir())
 	}
 
-	log.Println("ES server exited")
-	return nil
+	esEnabled := newConfig.ES != nil && newConfig.ES.Enabled
+	if esEnabled != (esServer != nil) {
+		logger.Warn("Enabling or disabling the ES protocol requires restart")
+	}
+	if esServer != nil && esEnabled {
+		logLevel := ""
+		if newConfig.Log != nil {
+			logLevel = newConfig.Log.Level
+		}
+		if err := esServer.Reload(newConfig.ES, logLevel); err != nil {
+			logger.Error("Failed to reload ES configuration: %v", err)
+			return current
+		}
+	}
+	return newConfig
 }
 
 // ShowVersion 显示版本信息
@@ -169,6 +266,7 @@ func ShowUsage() {
 
 Usage:
   tigerdb [flags]
+  tigerdb <command> [flags]
 
 Flags:
   -h, --help                    Show help message
@@ -180,12 +278,15 @@ Flags:
       --es-enabled              Enable ES protocol (default true)
       --es-log-level string     ES protocol log level
 
+%s
+
 Examples:
   tigerdb                                    # Start with default configuration
   tigerdb -c myconfig.yaml                   # Start with custom configuration
   tigerdb --data-dir /var/lib/tigerdb        # Specify data directory
   tigerdb --es-host 127.0.0.1 --es-port 8080 # Start ES on specific host and port
   tigerdb --es-log-level debug               # Start with debug logging
+  tigerdb index verify --data-dir ./data     # Verify all indices offline
 
 Configuration file example (config.yaml):
   data_dir: "./data"
@@ -205,6 +306,9 @@ Configuration file example (config.yaml):
     enabled: false
     host: "0.0.0.0"
     port: 3306
+  health:
+    enabled: true
+    port: 9600
 
 Configuration Priority:
   1. Command line arguments (highest priority)
@@ -213,6 +317,6 @@ Configuration Priority:
   4. Default values (lowest priority)
 
 For more information, visit: https://github.com/lscgzwd/tiggerdb
-`, Name)
+`, Name, adminUsage)
 	os.Exit(0)
 }
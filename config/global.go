@@ -19,6 +19,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/lscgzwd/tiggerdb/directory"
 	"github.com/lscgzwd/tiggerdb/protocols/es"
 	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
 )
@@ -29,6 +30,11 @@ type GlobalConfig struct {
 	// 核心配置（所有协议共享）
 	DataDir string `yaml:"data_dir" json:"data_dir"` // 数据目录，所有协议共享
 
+	// 分层数据目录（可选）：data_dir 属于 data_dir_tier 层，data_paths 为其他层的附加数据目录
+	// 索引通过 index.routing.allocation.require.tier 设置选择所在的层
+	DataDirTier string               `yaml:"data_dir_tier,omitempty" json:"data_dir_tier,omitempty"` // data_dir 的层标签，默认 hot
+	DataPaths   []directory.DataPath `yaml:"data_paths,omitempty" json:"data_paths,omitempty"`       // 附加的分层数据目录
+
 	// 协议配置
 	ES         *es.Config        `yaml:"es,omitempty" json:"es,omitempty"`                 // Elasticsearch 协议配置
 	Redis      *RedisConfig      `yaml:"redis,omitempty" json:"redis,omitempty"`           // Redis 协议配置（预留）
@@ -40,6 +46,12 @@ type GlobalConfig struct {
 
 	// 监控配置（全局）
 	Metrics *MetricsConfig `yaml:"metrics,omitempty" json:"metrics,omitempty"`
+
+	// 聚合就绪检查配置（全局，独立于各协议端口）
+	Health *HealthConfig `yaml:"health,omitempty" json:"health,omitempty"`
+
+	// 元数据存储配置（全局）
+	Metadata *MetadataConfig `yaml:"metadata,omitempty" json:"metadata,omitempty"`
 }
 
 // LogConfig 日志配置
@@ -61,6 +73,33 @@ type MetricsConfig struct {
 	Path    string `yaml:"path" json:"path"`       // 监控端点路径
 }
 
+// HealthConfig 聚合就绪检查配置
+// 启用后在独立端口提供 GET /_ready，所有已启用的协议服务器都在运行时返回 200，否则返回 503
+type HealthConfig struct {
+	Enabled bool   `yaml:"enabled" json:"enabled"` // 是否启用就绪检查端点
+	Host    string `yaml:"host" json:"host"`       // 监听地址
+	Port    int    `yaml:"port" json:"port"`       // 监听端口
+}
+
+// Address 返回就绪检查端点的监听地址
+func (c *HealthConfig) Address() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// MetadataConfig 元数据存储配置
+// 数据位于 data_dir/metadata；切换存储类型前需要用 tigerdb metadata migrate 迁移已有元数据
+type MetadataConfig struct {
+	StorageType string `yaml:"storage_type" json:"storage_type"` // 存储类型：file（每个条目一个 JSON 文件）, bolt（单文件事务型 KV 存储）
+}
+
+// GetMetadataStorageType 获取元数据存储类型，未配置时为 file
+func (c *GlobalConfig) GetMetadataStorageType() string {
+	if c.Metadata == nil || c.Metadata.StorageType == "" {
+		return "file"
+	}
+	return c.Metadata.StorageType
+}
+
 // RedisConfig Redis 协议配置（预留）
 type RedisConfig struct {
 	Enabled bool   `yaml:"enabled" json:"enabled"` // 是否启用 Redis 协议
@@ -123,6 +162,14 @@ func DefaultGlobalConfig() *GlobalConfig {
 			Enabled: true,
 			Path:    "/_metrics",
 		},
+		Health: &HealthConfig{
+			Enabled: false,
+			Host:    "0.0.0.0",
+			Port:    9600,
+		},
+		Metadata: &MetadataConfig{
+			StorageType: "file",
+		},
 	}
 }
 
@@ -142,6 +189,20 @@ func (c *GlobalConfig) Validate() error {
 		c.DataDir = absPath
 	}
 
+	// 验证分层数据目录
+	for i := range c.DataPaths {
+		if c.DataPaths[i].Path != "" && !filepath.IsAbs(c.DataPaths[i].Path) {
+			absPath, err := filepath.Abs(c.DataPaths[i].Path)
+			if err != nil {
+				return fmt.Errorf("failed to resolve data_paths[%d] path: %w", i, err)
+			}
+			c.DataPaths[i].Path = absPath
+		}
+	}
+	if err := c.DirectoryConfig().Validate(); err != nil {
+		return err
+	}
+
 	// 验证 ES 配置
 	if c.ES != nil {
 		if err := c.ES.Validate(); err != nil {
@@ -170,6 +231,20 @@ func (c *GlobalConfig) Validate() error {
 		}
 	}
 
+	// 验证就绪检查配置（如果启用）
+	if c.Health != nil && c.Health.Enabled {
+		if c.Health.Port < 1 || c.Health.Port > 65535 {
+			return fmt.Errorf("invalid health port: %d", c.Health.Port)
+		}
+	}
+
+	// 验证元数据存储类型
+	switch c.GetMetadataStorageType() {
+	case "file", "bolt":
+	default:
+		return fmt.Errorf("invalid metadata storage_type: %s", c.GetMetadataStorageType())
+	}
+
 	return nil
 }
 
@@ -181,6 +256,16 @@ func (c *GlobalConfig) GetDataDir() string {
 	return "./data"
 }
 
+// DirectoryConfig 返回数据目录（含分层数据目录）的目录管理器配置
+func (c *GlobalConfig) DirectoryConfig() *directory.DirectoryConfig {
+	dirConfig := directory.DefaultDirectoryConfig(c.GetDataDir())
+	if c.DataDirTier != "" {
+		dirConfig.BaseTier = c.DataDirTier
+	}
+	dirConfig.DataPaths = append([]directory.DataPath(nil), c.DataPaths...)
+	return dirConfig
+}
+
 // ApplyEnvOverrides 应用环境变量覆盖
 func (c *GlobalConfig) ApplyEnvOverrides() {
 	// 数据目录
@@ -33,6 +33,10 @@ type DirectoryConfig struct {
 	EnableCompression bool   `json:"enable_compression,omitempty"` // 是否启用压缩
 	StorageType       string `json:"storage_type,omitempty"`       // 存储类型：disk, memory
 
+	// 分层存储配置：BaseDir 属于 BaseTier 层，DataPaths 为附加的数据目录（如 SSD 上的 hot 层、HDD 上的 warm 层）
+	BaseTier  string     `json:"base_tier,omitempty"`  // BaseDir 的层标签，默认 hot
+	DataPaths []DataPath `json:"data_paths,omitempty"` // 附加的分层数据目录
+
 	// 权限配置
 	DirPerm  os.FileMode `json:"dir_perm,omitempty"`  // 目录权限，默认0755
 	FilePerm os.FileMode `json:"file_perm,omitempty"` // 文件权限，默认0644
@@ -50,6 +54,15 @@ type DirectoryConfig struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// DataPath 带层标签的数据目录
+type DataPath struct {
+	Path string `json:"path" yaml:"path"` // 数据目录，索引位于其下的 indices/ 目录
+	Tier string `json:"tier" yaml:"tier"` // 层标签，如 hot、warm
+}
+
+// DefaultTier BaseDir 默认的层标签
+const DefaultTier = "hot"
+
 // DefaultDirectoryConfig 返回默认配置
 func DefaultDirectoryConfig(baseDir string) *DirectoryConfig {
 	return &DirectoryConfig{
@@ -58,6 +71,7 @@ func DefaultDirectoryConfig(baseDir string) *DirectoryConfig {
 		MaxTables:         100,  // 默认每个索引最大100个表
 		EnableCompression: false,
 		StorageType:       "disk",
+		BaseTier:          DefaultTier,
 		DirPerm:           0755,
 		FilePerm:          0644,
 		EnableAutoCleanup: false,
@@ -99,6 +113,24 @@ func (c *DirectoryConfig) Validate() error {
 		return fmt.Errorf("invalid storage_type: %s, must be 'disk' or 'memory'", c.StorageType)
 	}
 
+	if c.BaseTier == "" {
+		c.BaseTier = DefaultTier
+	}
+
+	paths := map[string]bool{filepath.Clean(c.BaseDir): true}
+	for i, dp := range c.DataPaths {
+		if dp.Path == "" {
+			return fmt.Errorf("data_paths[%d].path cannot be empty", i)
+		}
+		if dp.Tier == "" {
+			return fmt.Errorf("data_paths[%d].tier cannot be empty", i)
+		}
+		if paths[filepath.Clean(dp.Path)] {
+			return fmt.Errorf("duplicate data path: %s", dp.Path)
+		}
+		paths[filepath.Clean(dp.Path)] = true
+	}
+
 	if c.CleanupInterval <= 0 {
 		c.CleanupInterval = 24 * time.Hour
 	}
@@ -164,6 +196,7 @@ func (c *DirectoryConfig) IsExpired(maxAge time.Duration) bool {
 // Clone 克隆配置
 func (c *DirectoryConfig) Clone() *DirectoryConfig {
 	clone := *c
+	clone.DataPaths = append([]DataPath(nil), c.DataPaths...)
 	return &clone
 }
 
@@ -181,6 +214,12 @@ func (c *DirectoryConfig) Merge(src *DirectoryConfig) {
 	if src.StorageType != "" {
 		c.StorageType = src.StorageType
 	}
+	if src.BaseTier != "" {
+		c.BaseTier = src.BaseTier
+	}
+	if len(src.DataPaths) > 0 {
+		c.DataPaths = append([]DataPath(nil), src.DataPaths...)
+	}
 	if src.DirPerm != 0 {
 		c.DirPerm = src.DirPerm
 	}
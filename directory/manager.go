@@ -30,6 +30,13 @@ type DirectoryManager interface {
 	IndexExists(indexName string) bool
 	ListIndices() ([]string, error)
 
+	// 分层数据目录
+	CreateIndexOnTier(indexName, tier string) error
+	GetIndexTier(indexName string) string
+	ListTiers() []string
+	StageIndexOnTier(indexName, tier string) (string, error)
+	CommitIndexTier(indexName, stagingPath string) error
+
 	// 表目录管理
 	CreateTable(indexName, tableName string) error
 	DeleteTable(indexName, tableName string) error
@@ -37,6 +44,7 @@ type DirectoryManager interface {
 	ListTables(indexName string) ([]string, error)
 
 	// 路径获取
+	GetBaseDir() string
 	GetIndexPath(indexName string) string
 	GetTablePath(indexName, tableName string) string
 	GetIndexDataPath(indexName string) string
@@ -116,7 +124,7 @@ func NewDirectoryManager(config *DirectoryConfig) (DirectoryManager, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	pathMgr := NewPathManager(config.BaseDir)
+	pathMgr := NewTieredPathManager(config.BaseDir, config.BaseTier, config.DataPaths)
 	fs := NewDefaultFileSystem()
 	dirOps := NewDirectoryOperations(fs)
 	migrator := NewDirectoryMigrator(fs, DefaultMigrationOptions())
@@ -145,17 +153,24 @@ func (dm *DefaultDirectoryManager) initializeDirectories() error {
 		return fmt.Errorf("failed to create base directory: %w", err)
 	}
 
-	// 创建indices目录
-	indicesDir := filepath.Join(baseDir, "indices")
-	if err := dm.dirOps.CreateDirIfNotExists(indicesDir, dm.config.DirPerm); err != nil {
-		return fmt.Errorf("failed to create indices directory: %w", err)
+	// 创建各数据目录下的indices目录
+	for _, dp := range dm.pathMgr.GetDataPaths() {
+		indicesDir := filepath.Join(dp.Path, "indices")
+		if err := dm.dirOps.CreateDirIfNotExists(indicesDir, dm.config.DirPerm); err != nil {
+			return fmt.Errorf("failed to create indices directory: %w", err)
+		}
 	}
 
 	return nil
 }
 
-// CreateIndex 创建索引目录
+// CreateIndex 在基础目录创建索引目录
 func (dm *DefaultDirectoryManager) CreateIndex(indexName string) error {
+	return dm.CreateIndexOnTier(indexName, "")
+}
+
+// CreateIndexOnTier 在指定层的数据目录创建索引目录，tier 为空时使用基础目录
+func (dm *DefaultDirectoryManager) CreateIndexOnTier(indexName, tier string) error {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 
@@ -163,6 +178,14 @@ func (dm *DefaultDirectoryManager) CreateIndex(indexName string) error {
 		return fmt.Errorf("index name cannot be empty")
 	}
 
+	root := dm.pathMgr.GetBaseDir()
+	if tier != "" {
+		var ok bool
+		if root, ok = dm.pathMgr.GetTierRoot(tier); !ok {
+			return fmt.Errorf("no data path is configured for tier [%s]", tier)
+		}
+	}
+
 	if !isValidName(indexName) {
 		return fmt.Errorf("invalid index name: %s", indexName)
 	}
@@ -178,8 +201,13 @@ func (dm *DefaultDirectoryManager) CreateIndex(indexName string) error {
 		}
 	}
 
+	// 索引可能已存在于其他数据目录
+	if dm.IndexExists(indexName) {
+		return fmt.Errorf("index already exists: %s", indexName)
+	}
+
 	// 尝试创建索引目录（原子操作，如果已存在则失败）
-	indexPath := dm.GetIndexPath(indexName)
+	indexPath := filepath.Join(root, "indices", indexName)
 	if err := dm.fs.CreateDirExclusive(indexPath, dm.config.DirPerm); err != nil {
 		if os.IsExist(err) {
 			return fmt.Errorf("index already exists: %s", indexName)
@@ -249,6 +277,110 @@ func (dm *DefaultDirectoryManager) ListIndices() ([]string, error) {
 	return dm.pathMgr.ListIndices()
 }
 
+// GetIndexTier 返回索引所在数据目录的层标签
+func (dm *DefaultDirectoryManager) GetIndexTier(indexName string) string {
+	if !dm.IndexExists(indexName) {
+		return ""
+	}
+	return dm.pathMgr.GetIndexTier(indexName)
+}
+
+// ListTiers 按配置顺序列出所有层标签
+func (dm *DefaultDirectoryManager) ListTiers() []string {
+	var tiers []string
+	seen := make(map[string]bool)
+	for _, dp := range dm.pathMgr.GetDataPaths() {
+		if !seen[dp.Tier] {
+			seen[dp.Tier] = true
+			tiers = append(tiers, dp.Tier)
+		}
+	}
+	return tiers
+}
+
+// tierStagingPrefix 迁移到其他层期间的临时目录前缀，以点开头的目录不会被列为索引
+const tierStagingPrefix = ".tier-"
+
+// StageIndexOnTier 在目标层的数据目录创建索引的临时目录，并复制索引目录中除 store 外的文件
+// 返回临时目录，调用方填充 store 子目录后调用 CommitIndexTier 完成迁移
+func (dm *DefaultDirectoryManager) StageIndexOnTier(indexName, tier string) (string, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if !dm.IndexExists(indexName) {
+		return "", fmt.Errorf("index does not exist: %s", indexName)
+	}
+	root, ok := dm.pathMgr.GetTierRoot(tier)
+	if !ok {
+		return "", fmt.Errorf("no data path is configured for tier [%s]", tier)
+	}
+	indexPath := dm.GetIndexPath(indexName)
+	if filepath.Dir(filepath.Dir(indexPath)) == root {
+		return "", fmt.Errorf("index [%s] is already on tier [%s]", indexName, tier)
+	}
+
+	// 清理上次失败的迁移留下的临时目录
+	stagingPath := filepath.Join(root, "indices", tierStagingPrefix+indexName)
+	if err := dm.fs.RemoveDir(stagingPath); err != nil {
+		return "", fmt.Errorf("failed to remove staging directory: %w", err)
+	}
+	if err := dm.fs.CreateDir(stagingPath, dm.config.DirPerm); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	entries, err := dm.fs.ListDir(indexPath)
+	if err != nil {
+		dm.fs.RemoveDir(stagingPath)
+		return "", fmt.Errorf("failed to list index directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == "store" {
+			continue
+		}
+		if err := dm.dirOps.CopyDir(filepath.Join(indexPath, entry.Name()), filepath.Join(stagingPath, entry.Name())); err != nil {
+			dm.fs.RemoveDir(stagingPath)
+			return "", fmt.Errorf("failed to copy %s: %w", entry.Name(), err)
+		}
+	}
+	if err := dm.fs.CreateDir(filepath.Join(stagingPath, "store"), dm.config.DirPerm); err != nil {
+		dm.fs.RemoveDir(stagingPath)
+		return "", fmt.Errorf("failed to create staging store directory: %w", err)
+	}
+	return stagingPath, nil
+}
+
+// CommitIndexTier 用 StageIndexOnTier 准备好的临时目录替换索引目录
+// 先将临时目录改名为索引目录，再移走原目录后删除，过程中索引始终可以找到一份完整的目录
+func (dm *DefaultDirectoryManager) CommitIndexTier(indexName, stagingPath string) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if !dm.IndexExists(indexName) {
+		return fmt.Errorf("index does not exist: %s", indexName)
+	}
+	if filepath.Base(stagingPath) != tierStagingPrefix+indexName {
+		return fmt.Errorf("invalid staging directory for index [%s]: %s", indexName, stagingPath)
+	}
+	oldPath := dm.GetIndexPath(indexName)
+	newPath := filepath.Join(filepath.Dir(stagingPath), indexName)
+	if err := os.Rename(stagingPath, newPath); err != nil {
+		return fmt.Errorf("failed to move staging directory: %w", err)
+	}
+
+	trashPath := filepath.Join(filepath.Dir(oldPath), tierStagingPrefix+indexName)
+	if err := os.Rename(oldPath, trashPath); err != nil {
+		// 回滚，保留原目录
+		if rbErr := os.Rename(newPath, stagingPath); rbErr != nil {
+			return fmt.Errorf("failed to move index directory: %v (rollback failed: %v)", err, rbErr)
+		}
+		return fmt.Errorf("failed to move index directory: %w", err)
+	}
+	if err := dm.fs.RemoveDir(trashPath); err != nil {
+		return fmt.Errorf("failed to remove old index directory: %w", err)
+	}
+	return nil
+}
+
 // CreateTable 创建表目录
 func (dm *DefaultDirectoryManager) CreateTable(indexName, tableName string) error {
 	dm.mu.Lock()
@@ -349,6 +481,10 @@ func (dm *DefaultDirectoryManager) ListTables(indexName string) ([]string, error
 }
 
 // 路径获取方法
+func (dm *DefaultDirectoryManager) GetBaseDir() string {
+	return dm.pathMgr.GetBaseDir()
+}
+
 func (dm *DefaultDirectoryManager) GetIndexPath(indexName string) string {
 	return dm.pathMgr.GetIndexPath(indexName)
 }
@@ -23,7 +23,8 @@ import (
 
 // PathManager 路径生成和管理逻辑
 type PathManager struct {
-	baseDir string // 基础目录
+	baseDir string     // 基础目录
+	roots   []DataPath // 所有数据目录及其层标签，第一个为基础目录
 }
 
 // NewPathManager 创建新的路径管理器
@@ -37,16 +38,70 @@ func NewPathManager(baseDir string) *PathManager {
 
 	return &PathManager{
 		baseDir: absPath,
+		roots:   []DataPath{{Path: absPath}},
 	}
 }
 
+// NewTieredPathManager 创建支持分层数据目录的路径管理器
+// 基础目录属于 baseTier 层，dataPaths 为附加的数据目录，索引目录位于其中某一个数据目录的 indices/ 下
+func NewTieredPathManager(baseDir, baseTier string, dataPaths []DataPath) *PathManager {
+	pm := NewPathManager(baseDir)
+	pm.roots[0].Tier = baseTier
+	for _, dp := range dataPaths {
+		absPath, err := filepath.Abs(dp.Path)
+		if err != nil {
+			absPath = dp.Path
+		}
+		pm.roots = append(pm.roots, DataPath{Path: absPath, Tier: dp.Tier})
+	}
+	return pm
+}
+
+// indexRoot 返回索引目录所在的数据目录，索引不存在时返回基础目录
+func (pm *PathManager) indexRoot(indexName string) string {
+	if len(pm.roots) > 1 {
+		for _, root := range pm.roots {
+			if info, err := os.Stat(filepath.Join(root.Path, "indices", indexName)); err == nil && info.IsDir() {
+				return root.Path
+			}
+		}
+	}
+	return pm.baseDir
+}
+
+// GetDataPaths 返回所有数据目录及其层标签，第一个为基础目录
+func (pm *PathManager) GetDataPaths() []DataPath {
+	return append([]DataPath(nil), pm.roots...)
+}
+
+// GetTierRoot 返回层的第一个数据目录
+func (pm *PathManager) GetTierRoot(tier string) (string, bool) {
+	for _, root := range pm.roots {
+		if root.Tier == tier {
+			return root.Path, true
+		}
+	}
+	return "", false
+}
+
+// GetIndexTier 返回索引所在数据目录的层标签
+func (pm *PathManager) GetIndexTier(indexName string) string {
+	root := pm.indexRoot(indexName)
+	for _, dp := range pm.roots {
+		if dp.Path == root {
+			return dp.Tier
+		}
+	}
+	return ""
+}
+
 // GetBaseDir 获取基础目录
 func (pm *PathManager) GetBaseDir() string {
 	return pm.baseDir
 }
 
 // GetIndexPath 获取索引目录路径
-// 格式: {baseDir}/indices/{indexName}/
+// 格式: {dataPath}/indices/{indexName}/，dataPath 为索引所在的数据目录（默认为基础目录）
 func (pm *PathManager) GetIndexPath(indexName string) string {
 	if indexName == "" {
 		return ""
@@ -57,7 +112,7 @@ func (pm *PathManager) GetIndexPath(indexName string) string {
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName)
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName)
 }
 
 // GetTablePath 获取表目录路径
@@ -72,7 +127,7 @@ func (pm *PathManager) GetTablePath(indexName, tableName string) string {
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName, "tables", tableName)
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName, "tables", tableName)
 }
 
 // GetIndexMetadataPath 获取索引元数据路径
@@ -86,7 +141,7 @@ func (pm *PathManager) GetIndexMetadataPath(indexName string) string {
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName, "metadata.json")
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName, "metadata.json")
 }
 
 // GetTableMetadataPath 获取表元数据路径
@@ -100,7 +155,7 @@ func (pm *PathManager) GetTableMetadataPath(indexName, tableName string) string
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName, "tables", tableName, "metadata.json")
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName, "tables", tableName, "metadata.json")
 }
 
 // GetIndexDataPath 获取索引数据路径
@@ -114,7 +169,7 @@ func (pm *PathManager) GetIndexDataPath(indexName string) string {
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName, "data")
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName, "data")
 }
 
 // GetTableDataPath 获取表数据路径
@@ -128,7 +183,7 @@ func (pm *PathManager) GetTableDataPath(indexName, tableName string) string {
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName, "tables", tableName, "data")
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName, "tables", tableName, "data")
 }
 
 // GetIndexLockPath 获取索引锁文件路径
@@ -142,7 +197,7 @@ func (pm *PathManager) GetIndexLockPath(indexName string) string {
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName, ".lock")
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName, ".lock")
 }
 
 // GetTableLockPath 获取表锁文件路径
@@ -156,7 +211,7 @@ func (pm *PathManager) GetTableLockPath(indexName, tableName string) string {
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName, "tables", tableName, ".lock")
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName, "tables", tableName, ".lock")
 }
 
 // GetIndexConfigPath 获取索引配置文件路径
@@ -170,7 +225,7 @@ func (pm *PathManager) GetIndexConfigPath(indexName string) string {
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName, "config.json")
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName, "config.json")
 }
 
 // GetTableConfigPath 获取表配置文件路径
@@ -184,7 +239,7 @@ func (pm *PathManager) GetTableConfigPath(indexName, tableName string) string {
 		return ""
 	}
 
-	return filepath.Join(pm.baseDir, "indices", indexName, "tables", tableName, "config.json")
+	return filepath.Join(pm.indexRoot(indexName), "indices", indexName, "tables", tableName, "config.json")
 }
 
 // EnsureDir 确保目录存在，如果不存在则创建
@@ -216,36 +271,40 @@ func (pm *PathManager) IsValidPath(path string) bool {
 		return false
 	}
 
-	// 检查路径是否在基础目录下
-	relPath, err := filepath.Rel(pm.baseDir, path)
-	if err != nil {
-		return false
-	}
+	// 检查路径是否在某个数据目录下
+	for _, root := range pm.roots {
+		relPath, err := filepath.Rel(root.Path, path)
+		if err != nil {
+			continue
+		}
 
-	// 防止路径遍历攻击
-	if strings.HasPrefix(relPath, "..") {
-		return false
+		// 防止路径遍历攻击
+		if !strings.HasPrefix(relPath, "..") {
+			return true
+		}
 	}
 
-	return true
+	return false
 }
 
-// ListIndices 列出所有索引目录
+// ListIndices 列出所有数据目录下的索引目录
 func (pm *PathManager) ListIndices() ([]string, error) {
-	indicesDir := filepath.Join(pm.baseDir, "indices")
-
-	entries, err := os.ReadDir(indicesDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []string{}, nil
+	indices := []string{}
+	seen := make(map[string]bool)
+	for _, root := range pm.roots {
+		entries, err := os.ReadDir(filepath.Join(root.Path, "indices"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
 		}
-		return nil, err
-	}
 
-	var indices []string
-	for _, entry := range entries {
-		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
-			indices = append(indices, entry.Name())
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				indices = append(indices, entry.Name())
+			}
 		}
 	}
 
@@ -258,7 +317,7 @@ func (pm *PathManager) ListTables(indexName string) ([]string, error) {
 		return nil, fmt.Errorf("invalid index name: %s", indexName)
 	}
 
-	tablesDir := filepath.Join(pm.baseDir, "indices", indexName, "tables")
+	tablesDir := filepath.Join(pm.indexRoot(indexName), "indices", indexName, "tables")
 
 	entries, err := os.ReadDir(tablesDir)
 	if err != nil {
@@ -279,7 +338,7 @@ func (pm *PathManager) ListTables(indexName string) ([]string, error) {
 }
 
 // isValidName 验证名称是否有效
-// 规则：只能包含字母、数字、下划线和连字符，不能以点开头
+// 规则：只能包含字母、数字、下划线、连字符和点，不能以点开头，不能包含连续的点
 func isValidName(name string) bool {
 	if name == "" {
 		return false
@@ -290,15 +349,15 @@ func isValidName(name string) bool {
 		return false
 	}
 
-	// 不能以点开头
-	if strings.HasPrefix(name, ".") {
+	// 不能以点开头，不能包含连续的点
+	if strings.HasPrefix(name, ".") || strings.Contains(name, "..") {
 		return false
 	}
 
-	// 只允许字母、数字、下划线、连字符
+	// 只允许字母、数字、下划线、连字符、点
 	for _, r := range name {
 		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
-			(r >= '0' && r <= '9') || r == '_' || r == '-') {
+			(r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.') {
 			return false
 		}
 	}
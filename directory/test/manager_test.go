@@ -130,7 +130,7 @@ func TestDirectoryManager_IndexOperations_EdgeCases(t *testing.T) {
 	}
 
 	// 测试无效索引名
-	invalidNames := []string{".hidden", "invalid.name", "invalid/name", "invalid name"}
+	invalidNames := []string{".hidden", "invalid..name", "invalid/name", "invalid name"}
 	for _, name := range invalidNames {
 		err = manager.CreateIndex(name)
 		if err == nil {
@@ -402,7 +402,7 @@ func TestDirectoryManager_InvalidPathNames(t *testing.T) {
 	invalidNames := []string{
 		"",
 		".hidden",
-		"invalid.name",
+		"invalid..name",
 		"invalid/name",
 		"invalid name",
 		"a_very_long_name_that_exceeds_the_maximum_length_limit_of_255_characters_and_should_be_rejected_by_the_validation_function_but_is_actually_shorter_than_expected_so_we_need_to_make_it_even_longer_by_adding_more_text_until_it_reaches_256_characters_or_more_to_properly_test_the_length_validation_functionality" +
@@ -549,3 +549,98 @@ func TestDirectoryManager_ConcurrentOperations(t *testing.T) {
 		t.Fatalf("Expected 5 indices, got %d", len(indices))
 	}
 }
+
+func TestDirectoryManager_DataTiers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tigerdb_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	hotDir, warmDir := filepath.Join(tempDir, "hot"), filepath.Join(tempDir, "warm")
+	config := directory.DefaultDirectoryConfig(hotDir)
+	config.DataPaths = []directory.DataPath{{Path: warmDir, Tier: "warm"}}
+	manager, err := directory.NewDirectoryManager(config)
+	if err != nil {
+		t.Fatalf("Failed to create directory manager: %v", err)
+	}
+	defer manager.Cleanup()
+
+	if tiers := manager.ListTiers(); fmt.Sprint(tiers) != "[hot warm]" {
+		t.Errorf("Expected tiers [hot warm], got %v", tiers)
+	}
+	if err := manager.CreateIndex("hot_index"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := manager.CreateIndexOnTier("warm_index", "warm"); err != nil {
+		t.Fatalf("Failed to create index on tier: %v", err)
+	}
+	if err := manager.CreateIndexOnTier("cold_index", "cold"); err == nil {
+		t.Error("Expected error for unknown tier")
+	}
+	if err := manager.CreateIndexOnTier("hot_index", "warm"); err == nil {
+		t.Error("Expected error for index existing on another tier")
+	}
+
+	if tier := manager.GetIndexTier("warm_index"); tier != "warm" {
+		t.Errorf("Expected tier warm, got %q", tier)
+	}
+	if path := manager.GetIndexPath("warm_index"); path != filepath.Join(warmDir, "indices", "warm_index") {
+		t.Errorf("Unexpected index path: %s", path)
+	}
+	if path := manager.GetIndexDataPath("hot_index"); path != filepath.Join(hotDir, "indices", "hot_index", "data") {
+		t.Errorf("Unexpected index data path: %s", path)
+	}
+	indices, err := manager.ListIndices()
+	if err != nil {
+		t.Fatalf("Failed to list indices: %v", err)
+	}
+	if len(indices) != 2 {
+		t.Errorf("Expected 2 indices across tiers, got %v", indices)
+	}
+
+	// 迁移：临时目录复制 store 以外的文件，提交后替换原目录
+	if err := os.WriteFile(filepath.Join(manager.GetIndexDataPath("hot_index"), "doc"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := manager.StageIndexOnTier("hot_index", "hot"); err == nil {
+		t.Error("Expected error staging index on its current tier")
+	}
+	stagingPath, err := manager.StageIndexOnTier("hot_index", "warm")
+	if err != nil {
+		t.Fatalf("Failed to stage index: %v", err)
+	}
+	if filepath.Dir(stagingPath) != filepath.Join(warmDir, "indices") {
+		t.Errorf("Unexpected staging path: %s", stagingPath)
+	}
+	if indices, _ := manager.ListIndices(); len(indices) != 2 {
+		t.Errorf("Staging directory should not be listed as an index: %v", indices)
+	}
+	if err := manager.CommitIndexTier("hot_index", stagingPath); err != nil {
+		t.Fatalf("Failed to commit index tier: %v", err)
+	}
+	if tier := manager.GetIndexTier("hot_index"); tier != "warm" {
+		t.Errorf("Expected tier warm after migration, got %q", tier)
+	}
+	if data, err := os.ReadFile(filepath.Join(manager.GetIndexDataPath("hot_index"), "doc")); err != nil || string(data) != "data" {
+		t.Errorf("Expected data file to be migrated, got %q: %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(hotDir, "indices", "hot_index")); !os.IsNotExist(err) {
+		t.Errorf("Expected old index directory to be removed, got %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(hotDir, "indices"))
+	if len(entries) != 0 {
+		t.Errorf("Expected no leftover directories on hot tier, got %d", len(entries))
+	}
+
+	// 配置校验
+	invalid := directory.DefaultDirectoryConfig(hotDir)
+	invalid.DataPaths = []directory.DataPath{{Path: hotDir, Tier: "warm"}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Expected error for duplicate data path")
+	}
+	invalid.DataPaths = []directory.DataPath{{Path: warmDir}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Expected error for data path without tier")
+	}
+}
@@ -0,0 +1,212 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/search"
+)
+
+// parseIndexSort parses the "indexSort" config option, a list of field
+// sorts in the search sort object format, for example
+// [{"by": "field", "field": "timestamp", "desc": true}]
+func parseIndexSort(config map[string]interface{}) (search.SortOrder, error) {
+	v, ok := config["indexSort"]
+	if !ok || v == nil {
+		return nil, nil
+	}
+
+	var specs []map[string]interface{}
+	switch v := v.(type) {
+	case []map[string]interface{}:
+		specs = v
+	case []interface{}:
+		for _, spec := range v {
+			m, ok := spec.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("indexSort entries must be objects, got %T", spec)
+			}
+			specs = append(specs, m)
+		}
+	default:
+		return nil, fmt.Errorf("indexSort must be a list, got %T", v)
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	rv := make(search.SortOrder, 0, len(specs))
+	for _, spec := range specs {
+		ss, err := search.ParseSearchSortObj(spec)
+		if err != nil {
+			return nil, fmt.Errorf("indexSort: %v", err)
+		}
+		if _, ok := ss.(*search.SortField); !ok {
+			return nil, fmt.Errorf("indexSort only supports sorting by field")
+		}
+		rv = append(rv, ss)
+	}
+	return rv, nil
+}
+
+// sortDocuments orders the analyzed documents of a batch by the index
+// sort, so that the segment built from them stores its documents in
+// sorted order.
+func (s *Scorch) sortDocuments(docs []index.Document) {
+	sortOrder := s.indexSort.Copy()
+	sortFields := make(map[string]struct{}, len(sortOrder))
+	for _, field := range sortOrder.RequiredFields() {
+		sortFields[field] = struct{}{}
+	}
+
+	keys := make([][]string, len(docs))
+	for i, doc := range docs {
+		terms := make(map[string][][]byte, len(sortFields))
+		doc.VisitFields(func(field index.Field) {
+			if _, ok := sortFields[field.Name()]; !ok || !field.Options().IncludeDocValues() {
+				return
+			}
+			for _, tf := range field.AnalyzedTokenFrequencies() {
+				terms[field.Name()] = append(terms[field.Name()], tf.Term)
+			}
+		})
+		for field, fieldTerms := range terms {
+			// doc values are visited in term order
+			sort.Sort(search.BytesSlice(fieldTerms))
+			for _, term := range fieldTerms {
+				sortOrder.UpdateVisitor(field, term)
+			}
+		}
+		key := make([]string, len(sortOrder))
+		for j, ss := range sortOrder {
+			key[j] = ss.Value(nil)
+		}
+		keys[i] = key
+	}
+
+	perm := make([]int, len(docs))
+	for i := range perm {
+		perm[i] = i
+	}
+	sort.SliceStable(perm, func(a, b int) bool {
+		ka, kb := keys[perm[a]], keys[perm[b]]
+		for j, ss := range sortOrder {
+			c := strings.Compare(ka[j], kb[j])
+			if ss.Descending() {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	sorted := make([]index.Document, len(docs))
+	for i, p := range perm {
+		sorted[i] = docs[p]
+	}
+	copy(docs, sorted)
+}
+
+// mergedSortRuns computes the sorted runs of the segments produced by a
+// merge: every run of every merged segment remains sorted in the new
+// segment. A new segment gets nil runs if any of its inputs isn't sorted.
+func mergedSortRuns(nextMerge *segmentMerge) [][]uint64 {
+	rv := make([][]uint64, len(nextMerge.new))
+	unsorted := make([]bool, len(nextMerge.new))
+	for _, h := range nextMerge.mergedSegHistory {
+		if h.workerID >= uint64(len(rv)) || unsorted[h.workerID] {
+			continue
+		}
+		ss := h.oldSegment
+		count := ss.segment.Count()
+		if ss.sortRuns == nil || uint64(len(h.oldNewDocIDs)) != count {
+			unsorted[h.workerID] = true
+			continue
+		}
+		for i, start := range ss.sortRuns {
+			end := count
+			if i+1 < len(ss.sortRuns) {
+				end = ss.sortRuns[i+1]
+			}
+			// the run starts at its first document surviving the merge
+			for docNum := start; docNum < end; docNum++ {
+				if h.oldNewDocIDs[docNum] != math.MaxUint64 {
+					rv[h.workerID] = append(rv[h.workerID], h.oldNewDocIDs[docNum])
+					break
+				}
+			}
+		}
+	}
+	for i := range rv {
+		if unsorted[i] || len(rv[i]) == 0 {
+			rv[i] = nil
+			continue
+		}
+		sort.Slice(rv[i], func(a, b int) bool { return rv[i][a] < rv[i][b] })
+	}
+	return rv
+}
+
+// nextSortedRun returns the number of the first document following the
+// sorted run containing docNum, false if the segment isn't stored in
+// index sort order.
+func (s *SegmentSnapshot) nextSortedRun(docNum uint64) (uint64, bool) {
+	if s.sortRuns == nil {
+		return 0, false
+	}
+	i := sort.Search(len(s.sortRuns), func(i int) bool {
+		return s.sortRuns[i] > docNum
+	})
+	if i == len(s.sortRuns) {
+		return s.segment.Count(), true
+	}
+	return s.sortRuns[i], true
+}
+
+// IndexSort returns the sort order documents are stored in within each
+// sorted run of a segment, nil if the index isn't sorted.
+func (is *IndexSnapshot) IndexSort() search.SortOrder {
+	if is.parent == nil {
+		return nil
+	}
+	return is.parent.indexSort
+}
+
+// NextSortedRun returns the internal id of the first document following
+// the sorted run containing id. Collectors sorting by the index sort can
+// skip from a document to the next run once the rest of its run can no
+// longer be competitive.
+func (is *IndexSnapshot) NextSortedRun(id index.IndexInternalID) (index.IndexInternalID, bool) {
+	docNum, err := docInternalToNumber(id)
+	if err != nil {
+		return nil, false
+	}
+	segmentIndex, localDocNum := is.segmentIndexAndLocalDocNumFromGlobal(docNum)
+	if segmentIndex >= len(is.segment) {
+		return nil, false
+	}
+	next, ok := is.segment[segmentIndex].nextSortedRun(localDocNum)
+	if !ok {
+		return nil, false
+	}
+	return docNumberToBytes(nil, next+is.offsets[segmentIndex]), true
+}
@@ -0,0 +1,232 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/document"
+	"github.com/lscgzwd/tiggerdb/index/scorch/mergeplan"
+)
+
+func TestParseIndexSort(t *testing.T) {
+	tests := []struct {
+		config interface{}
+		fields []string
+		err    bool
+	}{
+		{config: nil},
+		{config: []interface{}{}},
+		{
+			config: []interface{}{
+				map[string]interface{}{"by": "field", "field": "ts", "desc": true},
+				map[string]interface{}{"by": "field", "field": "name"},
+			},
+			fields: []string{"ts", "name"},
+		},
+		{
+			config: []map[string]interface{}{{"by": "field", "field": "ts"}},
+			fields: []string{"ts"},
+		},
+		{config: "ts", err: true},
+		{config: []interface{}{"ts"}, err: true},
+		{config: []interface{}{map[string]interface{}{"by": "score"}}, err: true},
+	}
+
+	for i, test := range tests {
+		sortOrder, err := parseIndexSort(map[string]interface{}{"indexSort": test.config})
+		if test.err {
+			if err == nil {
+				t.Errorf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(test.fields) == 0 {
+			if sortOrder != nil {
+				t.Errorf("test %d: expected no index sort, got %v", i, sortOrder)
+			}
+			continue
+		}
+		if fields := sortOrder.RequiredFields(); !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("test %d: expected fields %v, got %v", i, test.fields, fields)
+		}
+	}
+}
+
+func TestIndexSort(t *testing.T) {
+	cfg := CreateConfig("TestIndexSort")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	cfg["indexSort"] = []interface{}{
+		map[string]interface{}{"by": "field", "field": "ts", "desc": true},
+	}
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+
+	timestamps := map[string]float64{}
+	batches := [][]float64{
+		{3, 9, 1, 7, 5},
+		{2, 10, 6},
+		{8, 4},
+	}
+	for b, values := range batches {
+		batch := index.NewBatch()
+		for i, ts := range values {
+			id := fmt.Sprintf("doc-%d-%d", b, i)
+			timestamps[id] = ts
+			doc := document.NewDocument(id)
+			doc.AddField(document.NewNumericFieldWithIndexingOptions("ts", []uint64{}, ts,
+				index.IndexField|index.DocValues))
+			batch.Update(doc)
+		}
+		err = idx.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// deleting the first document of a run moves the start of the run
+	err = idx.Delete("doc-1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(timestamps, "doc-1-1")
+
+	checkRuns := func(expectedRuns int) {
+		reader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := reader.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}()
+		snapshot := reader.(*IndexSnapshot)
+		if snapshot.IndexSort() == nil {
+			t.Fatalf("expected an index sort")
+		}
+
+		runs := 0
+		for i, ss := range snapshot.segment {
+			if ss.sortRuns == nil {
+				t.Fatalf("segment %d: expected sorted runs", i)
+			}
+			runs += len(ss.sortRuns)
+		}
+		if runs != expectedRuns {
+			t.Errorf("expected %d sorted runs, got %d", expectedRuns, runs)
+		}
+
+		docIDReader, err := reader.DocIDReaderAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = docIDReader.Close() }()
+
+		var runEnd index.IndexInternalID
+		var prev float64
+		seen := 0
+		for {
+			internalID, err := docIDReader.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if internalID == nil {
+				break
+			}
+			id, err := reader.ExternalID(internalID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := timestamps[id]
+			if runEnd == nil || internalID.Compare(runEnd) >= 0 {
+				// a new run starts
+				var ok bool
+				runEnd, ok = snapshot.NextSortedRun(internalID)
+				if !ok || internalID.Compare(runEnd) >= 0 {
+					t.Fatalf("expected next run after %s", id)
+				}
+			} else if ts > prev {
+				t.Errorf("%s: %v sorts before %v within a run", id, ts, prev)
+			}
+			prev = ts
+			seen++
+		}
+		if seen != len(timestamps) {
+			t.Errorf("expected %d documents, got %d", len(timestamps), seen)
+		}
+	}
+
+	checkRuns(len(batches))
+
+	si := idx.(*Scorch)
+	ctx := context.Background()
+	for atomic.LoadUint64(&si.stats.TotFileSegmentsAtRoot) != 1 {
+		err := si.ForceMerge(ctx, &mergeplan.MergePlanOptions{
+			MaxSegmentsPerTier:   1,
+			MaxSegmentSize:       10000,
+			SegmentsPerMergeTask: 10,
+			FloorSegmentSize:     10000,
+		})
+		if err != nil {
+			t.Fatalf("ForceMerge failed, err: %v", err)
+		}
+	}
+	checkRuns(len(batches))
+
+	// the runs survive reopening the index
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err = NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+	checkRuns(len(batches))
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
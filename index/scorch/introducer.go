@@ -27,6 +27,8 @@ import (
 type segmentIntroduction struct {
 	id        uint64
 	data      segment.Segment
+	sortRuns  []uint64
+	timeRange *timeRange
 	obsoletes map[uint64]*roaring.Bitmap
 	ids       []string
 	internal  map[string][]byte
@@ -151,6 +153,8 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 			cachedDocs: root.segment[i].cachedDocs,
 			cachedMeta: root.segment[i].cachedMeta,
 			creator:    root.segment[i].creator,
+			sortRuns:   root.segment[i].sortRuns,
+			timeRange:  root.segment[i].timeRange,
 		}
 
 		// apply new obsoletions
@@ -199,6 +203,8 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 			cachedDocs: &cachedDocs{cache: nil},
 			cachedMeta: &cachedMeta{meta: nil},
 			creator:    "introduceSegment",
+			sortRuns:   next.sortRuns,
+			timeRange:  next.timeRange,
 		}
 		newSnapshot.segment = append(newSnapshot.segment, newSegmentSnapshot)
 		newSnapshot.offsets = append(newSnapshot.offsets, running)
@@ -289,6 +295,8 @@ func (s *Scorch) introducePersist(persist *persistIntroduction) {
 				cachedMeta: segmentSnapshot.cachedMeta,
 				creator:    "introducePersist",
 				mmaped:     1,
+				sortRuns:   segmentSnapshot.sortRuns,
+				timeRange:  segmentSnapshot.timeRange,
 			}
 			newIndexSnapshot.segment[i] = newSegmentSnapshot
 			delete(persist.persisted, segmentSnapshot.id)
@@ -360,6 +368,10 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 		newSegmentDeleted[i] = roaring.NewBitmap()
 	}
 
+	// computed before the merge history is consumed below
+	sortRuns := mergedSortRuns(nextMerge)
+	timeRanges := mergedTimeRanges(nextMerge)
+
 	// iterate through current segments
 	for i := range root.segment {
 		segmentID := root.segment[i].id
@@ -395,6 +407,8 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 				cachedDocs: root.segment[i].cachedDocs,
 				cachedMeta: root.segment[i].cachedMeta,
 				creator:    root.segment[i].creator,
+				sortRuns:   root.segment[i].sortRuns,
+				timeRange:  root.segment[i].timeRange,
 			})
 			root.segment[i].segment.AddRef()
 			newSnapshot.offsets = append(newSnapshot.offsets, running)
@@ -450,6 +464,8 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 				cachedMeta: &cachedMeta{meta: nil},
 				creator:    "introduceMerge",
 				mmaped:     nextMerge.mmaped,
+				sortRuns:   sortRuns[i],
+				timeRange:  timeRanges[i],
 			})
 			newSnapshot.offsets = append(newSnapshot.offsets, running)
 			running += newMergedSegment.Count()
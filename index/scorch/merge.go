@@ -30,43 +30,6 @@ import (
 	"github.com/lscgzwd/tiggerdb/util"
 )
 
-// 全局合并信号量，限制同时进行的合并操作数量
-// 避免多个索引同时合并导致磁盘 IO 竞争
-var (
-	globalMergeSemaphore     chan struct{}
-	globalMergeSemaphoreOnce sync.Once
-	MaxConcurrentMerges      = 2 // 默认最多同时 2 个合并操作
-)
-
-// initGlobalMergeSemaphore 初始化全局合并信号量
-func initGlobalMergeSemaphore() {
-	globalMergeSemaphoreOnce.Do(func() {
-		globalMergeSemaphore = make(chan struct{}, MaxConcurrentMerges)
-	})
-}
-
-// acquireMergeSlot 获取合并槽位（带索引路径用于日志）
-func acquireMergeSlot(indexPath string) {
-	initGlobalMergeSemaphore()
-	// 尝试非阻塞获取
-	select {
-	case globalMergeSemaphore <- struct{}{}:
-		// 成功获取槽位
-		return
-	default:
-		// 槽位已满，需要等待
-		logger.Debug("[Merger] waiting for merge slot: %s", indexPath)
-		globalMergeSemaphore <- struct{}{}
-		logger.Debug("[Merger] acquired merge slot: %s", indexPath)
-	}
-}
-
-// releaseMergeSlot 释放合并槽位
-func releaseMergeSlot(indexPath string) {
-	<-globalMergeSemaphore
-	logger.Debug("[Merger] released merge slot: %s", indexPath)
-}
-
 func (s *Scorch) mergerLoop() {
 	defer func() {
 		if r := recover(); r != nil {
@@ -119,6 +82,11 @@ OUTER:
 				}
 				ctrlMsg = ctrlMsgDflt
 			}
+			// in ingest mode merges are delayed until bulk loading is done,
+			// forced merges still run
+			if ctrlMsg == ctrlMsgDflt && s.IngestMode() {
+				ctrlMsg = nil
+			}
 			if ctrlMsg != nil {
 				continueMerge := s.fireEvent(EventKindPreMergeCheck, 0)
 				// The default, if there's no handler, is to continue the merge.
@@ -137,15 +105,9 @@ OUTER:
 
 				startTime := time.Now()
 
-				// 获取全局合并槽位，限制并发合并数
-				acquireMergeSlot(s.path)
-
 				// lets get started
 				err := s.planMergeAtSnapshot(ctrlMsg.ctx, ctrlMsg.options,
 					ourSnapshot)
-
-				// 释放合并槽位
-				releaseMergeSlot(s.path)
 				if err != nil {
 					atomic.StoreUint64(&s.iStats.mergeEpoch, 0)
 					if err == segment.ErrClosed {
@@ -190,6 +152,9 @@ OUTER:
 				select {
 				case <-s.closeCh:
 					break OUTER
+				case ctrlMsg = <-s.forceMergeRequestCh:
+					// 等待期间收到强制合并请求，立即处理
+					continue OUTER
 				case <-time.After(5 * time.Second): // 等待5秒再检查
 					continue OUTER
 				}
@@ -371,155 +336,167 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 
 	atomic.AddUint64(&s.stats.TotFileMergePlanTasks, uint64(len(resultMergePlan.Tasks)))
 
-	// process tasks in serial for now
-	var filenames []string
-
 	cw := newCloseChWrapper(s.closeCh, ctx)
 	defer cw.close()
 
 	go cw.listen()
 
-	for _, task := range resultMergePlan.Tasks {
-		if len(task.Segments) == 0 {
-			atomic.AddUint64(&s.stats.TotFileMergePlanTasksSegmentsEmpty, 1)
-			continue
-		}
-
-		atomic.AddUint64(&s.stats.TotFileMergePlanTasksSegments, uint64(len(task.Segments)))
-
-		oldMap := make(map[uint64]*SegmentSnapshot, len(task.Segments))
-		newSegmentID := atomic.AddUint64(&s.nextSegmentID, 1)
-		segmentsToMerge := make([]segment.Segment, 0, len(task.Segments))
-		docsToDrop := make([]*roaring.Bitmap, 0, len(task.Segments))
-		mergedSegHistory := make(map[uint64]*mergedSegmentHistory, len(task.Segments))
-
-		for _, planSegment := range task.Segments {
-			if segSnapshot, ok := planSegment.(*SegmentSnapshot); ok {
-				oldMap[segSnapshot.id] = segSnapshot
-				mergedSegHistory[segSnapshot.id] = &mergedSegmentHistory{
-					workerID:   0,
-					oldSegment: segSnapshot,
-				}
-				if persistedSeg, ok := segSnapshot.segment.(segment.PersistedSegment); ok {
-					if segSnapshot.LiveSize() == 0 {
-						atomic.AddUint64(&s.stats.TotFileMergeSegmentsEmpty, 1)
-						oldMap[segSnapshot.id] = nil
-						delete(mergedSegHistory, segSnapshot.id)
-					} else {
-						segmentsToMerge = append(segmentsToMerge, segSnapshot.segment)
-						docsToDrop = append(docsToDrop, segSnapshot.deleted)
-					}
-					// track the files getting merged for unsetting the
-					// removal ineligibility. This helps to unflip files
-					// even with fast merger, slow persister work flows.
-					path := persistedSeg.Path()
-					filenames = append(filenames,
-						strings.TrimPrefix(path, s.path+string(os.PathSeparator)))
-				}
-			}
-		}
+	filenames, err := s.runMergeTasks(resultMergePlan.Tasks, cw)
+	if err != nil {
+		return err
+	}
 
-		var seg segment.Segment
-		var filename string
-		if len(segmentsToMerge) > 0 {
-			filename = zapFileName(newSegmentID)
-			s.markIneligibleForRemoval(filename)
-			path := s.path + string(os.PathSeparator) + filename
+	// once all the newly merged segment introductions are done,
+	// its safe to unflip the removal ineligibility for the replaced
+	// older segments
+	for _, f := range filenames {
+		s.unmarkIneligibleForRemoval(f)
+	}
 
-			fileMergeZapStartTime := time.Now()
+	return nil
+}
 
-			atomic.AddUint64(&s.stats.TotFileMergeZapBeg, 1)
-			prevBytesReadTotal := cumulateBytesRead(segmentsToMerge)
-			newDocNums, _, err := s.segPlugin.Merge(segmentsToMerge, docsToDrop, path,
-				cw.cancelCh, s)
-			atomic.AddUint64(&s.stats.TotFileMergeZapEnd, 1)
+// mergeTask merges the segments of a single task of a merge plan into a
+// new file segment, introduces it and returns the names of the files
+// that got merged.
+func (s *Scorch) mergeTask(task *mergeplan.MergeTask, cw *closeChWrapper) ([]string, error) {
+	var filenames []string
+	if len(task.Segments) == 0 {
+		atomic.AddUint64(&s.stats.TotFileMergePlanTasksSegmentsEmpty, 1)
+		return nil, nil
+	}
 
-			fileMergeZapTime := uint64(time.Since(fileMergeZapStartTime))
-			atomic.AddUint64(&s.stats.TotFileMergeZapTime, fileMergeZapTime)
-			if atomic.LoadUint64(&s.stats.MaxFileMergeZapTime) < fileMergeZapTime {
-				atomic.StoreUint64(&s.stats.MaxFileMergeZapTime, fileMergeZapTime)
+	atomic.AddUint64(&s.stats.TotFileMergePlanTasksSegments, uint64(len(task.Segments)))
+
+	oldMap := make(map[uint64]*SegmentSnapshot, len(task.Segments))
+	newSegmentID := atomic.AddUint64(&s.nextSegmentID, 1)
+	segmentsToMerge := make([]segment.Segment, 0, len(task.Segments))
+	docsToDrop := make([]*roaring.Bitmap, 0, len(task.Segments))
+	// snapshots of segmentsToMerge, in the same order
+	mergedSnapshots := make([]*SegmentSnapshot, 0, len(task.Segments))
+	mergedSegHistory := make(map[uint64]*mergedSegmentHistory, len(task.Segments))
+
+	for _, planSegment := range task.Segments {
+		if segSnapshot, ok := planSegment.(*SegmentSnapshot); ok {
+			oldMap[segSnapshot.id] = segSnapshot
+			mergedSegHistory[segSnapshot.id] = &mergedSegmentHistory{
+				workerID:   0,
+				oldSegment: segSnapshot,
 			}
-
-			if err != nil {
-				s.unmarkIneligibleForRemoval(filename)
-				atomic.AddUint64(&s.stats.TotFileMergePlanTasksErr, 1)
-				if err == segment.ErrClosed {
-					return err
+			if persistedSeg, ok := segSnapshot.segment.(segment.PersistedSegment); ok {
+				if segSnapshot.LiveSize() == 0 {
+					atomic.AddUint64(&s.stats.TotFileMergeSegmentsEmpty, 1)
+					oldMap[segSnapshot.id] = nil
+					delete(mergedSegHistory, segSnapshot.id)
+				} else {
+					segmentsToMerge = append(segmentsToMerge, segSnapshot.segment)
+					docsToDrop = append(docsToDrop, segSnapshot.deleted)
+					mergedSnapshots = append(mergedSnapshots, segSnapshot)
 				}
-				return fmt.Errorf("merging failed: %v", err)
-			}
-
-			seg, err = s.segPlugin.Open(path)
-			if err != nil {
-				s.unmarkIneligibleForRemoval(filename)
-				atomic.AddUint64(&s.stats.TotFileMergePlanTasksErr, 1)
-				return err
+				// track the files getting merged for unsetting the
+				// removal ineligibility. This helps to unflip files
+				// even with fast merger, slow persister work flows.
+				path := persistedSeg.Path()
+				filenames = append(filenames,
+					strings.TrimPrefix(path, s.path+string(os.PathSeparator)))
 			}
+		}
+	}
 
-			totalBytesRead := seg.BytesRead() + prevBytesReadTotal
-			seg.ResetBytesRead(totalBytesRead)
+	var seg segment.Segment
+	var filename string
+	if len(segmentsToMerge) > 0 {
+		filename = zapFileName(newSegmentID)
+		s.markIneligibleForRemoval(filename)
+		path := s.path + string(os.PathSeparator) + filename
+
+		fileMergeZapStartTime := time.Now()
+
+		atomic.AddUint64(&s.stats.TotFileMergeZapBeg, 1)
+		prevBytesReadTotal := cumulateBytesRead(segmentsToMerge)
+		newDocNums, _, err := s.segPlugin.Merge(segmentsToMerge, docsToDrop, path,
+			cw.cancelCh, &throttledStatsReporter{s: s, cancelCh: cw.cancelCh})
+		atomic.AddUint64(&s.stats.TotFileMergeZapEnd, 1)
+
+		fileMergeZapTime := uint64(time.Since(fileMergeZapStartTime))
+		atomic.AddUint64(&s.stats.TotFileMergeZapTime, fileMergeZapTime)
+		if atomic.LoadUint64(&s.stats.MaxFileMergeZapTime) < fileMergeZapTime {
+			atomic.StoreUint64(&s.stats.MaxFileMergeZapTime, fileMergeZapTime)
+		}
 
-			for i, segNewDocNums := range newDocNums {
-				if mergedSegHistory[task.Segments[i].Id()] != nil {
-					mergedSegHistory[task.Segments[i].Id()].oldNewDocIDs = segNewDocNums
-				}
+		if err != nil {
+			s.unmarkIneligibleForRemoval(filename)
+			atomic.AddUint64(&s.stats.TotFileMergePlanTasksErr, 1)
+			if err == segment.ErrClosed {
+				return nil, err
 			}
-
-			atomic.AddUint64(&s.stats.TotFileMergeSegments, uint64(len(segmentsToMerge)))
+			return nil, fmt.Errorf("merging failed: %v", err)
 		}
 
-		sm := &segmentMerge{
-			id:               []uint64{newSegmentID},
-			mergedSegHistory: mergedSegHistory,
-			new:              []segment.Segment{seg},
-			newCount:         seg.Count(),
-			notifyCh:         make(chan *mergeTaskIntroStatus),
-			mmaped:           1,
+		seg, err = s.segPlugin.Open(path)
+		if err != nil {
+			s.unmarkIneligibleForRemoval(filename)
+			atomic.AddUint64(&s.stats.TotFileMergePlanTasksErr, 1)
+			return nil, err
 		}
 
-		s.fireEvent(EventKindMergeTaskIntroductionStart, 0)
-
-		// give it to the introducer
-		select {
-		case <-s.closeCh:
-			_ = seg.Close()
-			return segment.ErrClosed
-		case s.merges <- sm:
-			atomic.AddUint64(&s.stats.TotFileMergeIntroductions, 1)
-		}
+		totalBytesRead := seg.BytesRead() + prevBytesReadTotal
+		seg.ResetBytesRead(totalBytesRead)
 
-		introStartTime := time.Now()
-		// it is safe to blockingly wait for the merge introduction
-		// here as the introducer is bound to handle the notify channel.
-		introStatus := <-sm.notifyCh
-		introTime := uint64(time.Since(introStartTime))
-		atomic.AddUint64(&s.stats.TotFileMergeZapIntroductionTime, introTime)
-		if atomic.LoadUint64(&s.stats.MaxFileMergeZapIntroductionTime) < introTime {
-			atomic.StoreUint64(&s.stats.MaxFileMergeZapIntroductionTime, introTime)
-		}
-		atomic.AddUint64(&s.stats.TotFileMergeIntroductionsDone, 1)
-		if introStatus != nil && introStatus.indexSnapshot != nil {
-			_ = introStatus.indexSnapshot.DecRef()
-			if introStatus.skipped {
-				// close the segment on skipping introduction.
-				s.unmarkIneligibleForRemoval(filename)
-				_ = seg.Close()
+		// newDocNums follows segmentsToMerge, which skips empty segments
+		for i, segNewDocNums := range newDocNums {
+			if mergedSegHistory[mergedSnapshots[i].id] != nil {
+				mergedSegHistory[mergedSnapshots[i].id].oldNewDocIDs = segNewDocNums
 			}
 		}
 
-		atomic.AddUint64(&s.stats.TotFileMergePlanTasksDone, 1)
+		atomic.AddUint64(&s.stats.TotFileMergeSegments, uint64(len(segmentsToMerge)))
+	}
+
+	sm := &segmentMerge{
+		id:               []uint64{newSegmentID},
+		mergedSegHistory: mergedSegHistory,
+		new:              []segment.Segment{seg},
+		newCount:         seg.Count(),
+		notifyCh:         make(chan *mergeTaskIntroStatus),
+		mmaped:           1,
+	}
+
+	s.fireEvent(EventKindMergeTaskIntroductionStart, 0)
 
-		s.fireEvent(EventKindMergeTaskIntroduction, 0)
+	// give it to the introducer
+	select {
+	case <-s.closeCh:
+		_ = seg.Close()
+		return nil, segment.ErrClosed
+	case s.merges <- sm:
+		atomic.AddUint64(&s.stats.TotFileMergeIntroductions, 1)
 	}
 
-	// once all the newly merged segment introductions are done,
-	// its safe to unflip the removal ineligibility for the replaced
-	// older segments
-	for _, f := range filenames {
-		s.unmarkIneligibleForRemoval(f)
+	introStartTime := time.Now()
+	// it is safe to blockingly wait for the merge introduction
+	// here as the introducer is bound to handle the notify channel.
+	introStatus := <-sm.notifyCh
+	introTime := uint64(time.Since(introStartTime))
+	atomic.AddUint64(&s.stats.TotFileMergeZapIntroductionTime, introTime)
+	if atomic.LoadUint64(&s.stats.MaxFileMergeZapIntroductionTime) < introTime {
+		atomic.StoreUint64(&s.stats.MaxFileMergeZapIntroductionTime, introTime)
+	}
+	atomic.AddUint64(&s.stats.TotFileMergeIntroductionsDone, 1)
+	if introStatus != nil && introStatus.indexSnapshot != nil {
+		_ = introStatus.indexSnapshot.DecRef()
+		if introStatus.skipped {
+			// close the segment on skipping introduction.
+			s.unmarkIneligibleForRemoval(filename)
+			_ = seg.Close()
+		}
 	}
 
-	return nil
+	atomic.AddUint64(&s.stats.TotFileMergePlanTasksDone, 1)
+
+	s.fireEvent(EventKindMergeTaskIntroduction, 0)
+
+	return filenames, nil
 }
 
 type mergeTaskIntroStatus struct {
@@ -0,0 +1,245 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/index/scorch/mergeplan"
+	"github.com/lscgzwd/tiggerdb/logger"
+)
+
+// DefaultMaxConcurrentMerges is the default number of file merge tasks
+// that may run at the same time across all the indexes of the process.
+const DefaultMaxConcurrentMerges = 2
+
+// minMergeThrottlePause is the smallest pause taken by a throttled merge,
+// shorter debts are carried over to the following writes.
+const minMergeThrottlePause = 10 * time.Millisecond
+
+// mergeSlots limits the number of file merge tasks running at the same
+// time across all the indexes, so that merges of different indexes don't
+// compete for disk IO. The limit can be changed while merges are running.
+var mergeSlots = struct {
+	sync.Mutex
+	cond   *sync.Cond
+	active int
+	limit  int
+}{limit: DefaultMaxConcurrentMerges}
+
+func init() {
+	mergeSlots.cond = sync.NewCond(&mergeSlots.Mutex)
+}
+
+// SetMaxConcurrentMerges sets the number of file merge tasks that may run
+// at the same time across all the indexes, n < 1 resets the default.
+func SetMaxConcurrentMerges(n int) {
+	if n < 1 {
+		n = DefaultMaxConcurrentMerges
+	}
+	mergeSlots.Lock()
+	mergeSlots.limit = n
+	mergeSlots.Unlock()
+	mergeSlots.cond.Broadcast()
+}
+
+// MaxConcurrentMerges returns the number of file merge tasks that may run
+// at the same time across all the indexes.
+func MaxConcurrentMerges() int {
+	mergeSlots.Lock()
+	defer mergeSlots.Unlock()
+	return mergeSlots.limit
+}
+
+// acquireMergeSlot waits for a merge slot and returns the time spent
+// waiting.
+func acquireMergeSlot(indexPath string) time.Duration {
+	mergeSlots.Lock()
+	defer mergeSlots.Unlock()
+	if mergeSlots.active < mergeSlots.limit {
+		mergeSlots.active++
+		return 0
+	}
+	logger.Debug("[Merger] waiting for merge slot: %s", indexPath)
+	start := time.Now()
+	for mergeSlots.active >= mergeSlots.limit {
+		mergeSlots.cond.Wait()
+	}
+	mergeSlots.active++
+	logger.Debug("[Merger] acquired merge slot: %s", indexPath)
+	return time.Since(start)
+}
+
+// releaseMergeSlot releases a slot acquired with acquireMergeSlot.
+func releaseMergeSlot(indexPath string) {
+	mergeSlots.Lock()
+	mergeSlots.active--
+	mergeSlots.Unlock()
+	mergeSlots.cond.Signal()
+	logger.Debug("[Merger] released merge slot: %s", indexPath)
+}
+
+// mergeRateLimiter paces the bytes written by file merges across all the
+// indexes. next is the time at which the bytes written so far are paid
+// for at the configured rate.
+type mergeRateLimiter struct {
+	m           sync.Mutex
+	bytesPerSec int64
+	next        time.Time
+}
+
+var mergeThrottle mergeRateLimiter
+
+// SetMergeThrottle limits the bytes per second written by file merges
+// across all the indexes, 0 removes the limit. Persisting in-memory
+// segments isn't throttled so that it never holds back indexing.
+func SetMergeThrottle(bytesPerSec int64) {
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	mergeThrottle.m.Lock()
+	mergeThrottle.bytesPerSec = bytesPerSec
+	mergeThrottle.next = time.Time{}
+	mergeThrottle.m.Unlock()
+}
+
+// MergeThrottle returns the bytes per second file merges are limited to,
+// 0 if they aren't limited.
+func MergeThrottle() int64 {
+	mergeThrottle.m.Lock()
+	defer mergeThrottle.m.Unlock()
+	return mergeThrottle.bytesPerSec
+}
+
+// reserve accounts for n written bytes and returns how long the writer
+// has to pause to keep to the rate.
+func (l *mergeRateLimiter) reserve(n uint64) time.Duration {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.bytesPerSec <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.bytesPerSec) * float64(time.Second)))
+	return l.next.Sub(now)
+}
+
+// throttledStatsReporter is the stats reporter given to the segment plugin
+// by file merges. The plugin reports every write synchronously, which
+// lets the reporter pause the merge to keep to the merge throttle.
+type throttledStatsReporter struct {
+	s        *Scorch
+	cancelCh chan struct{}
+}
+
+func (r *throttledStatsReporter) ReportBytesWritten(bytesWritten uint64) {
+	r.s.ReportBytesWritten(bytesWritten)
+
+	pause := mergeThrottle.reserve(bytesWritten)
+	if pause < minMergeThrottlePause {
+		return
+	}
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+	start := time.Now()
+	select {
+	case <-timer.C:
+	case <-r.cancelCh:
+	}
+	atomic.AddUint64(&r.s.stats.TotFileMergeThrottledTime, uint64(time.Since(start)))
+}
+
+// parseMaxConcurrentMerges parses the "maxConcurrentMerges" config option,
+// the number of tasks of a merge plan of the index that may run at the
+// same time, 1 if not set.
+func parseMaxConcurrentMerges(config map[string]interface{}) (int, error) {
+	v, ok := config["maxConcurrentMerges"]
+	if !ok || v == nil {
+		return 1, nil
+	}
+	n, err := parseToInteger(v)
+	if err != nil {
+		return 0, fmt.Errorf("maxConcurrentMerges parse err: %v", err)
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("maxConcurrentMerges must be at least 1, got %d", n)
+	}
+	return n, nil
+}
+
+// runMergeTasks runs the tasks of a merge plan, up to maxConcurrentMerges
+// of them at the same time, each holding one of the process wide merge
+// slots. No new task is started after a task fails, the first error is
+// returned once the running tasks are done.
+func (s *Scorch) runMergeTasks(tasks []*mergeplan.MergeTask, cw *closeChWrapper) ([]string, error) {
+	var (
+		m         sync.Mutex
+		wg        sync.WaitGroup
+		filenames []string
+		firstErr  error
+	)
+	sem := make(chan struct{}, s.maxConcurrentMerges)
+
+	run := func(task *mergeplan.MergeTask) {
+		wait := acquireMergeSlot(s.path)
+		atomic.AddUint64(&s.stats.TotFileMergeSlotWaitTime, uint64(wait))
+		atomic.AddUint64(&s.stats.CurFileMerges, 1)
+		names, err := s.mergeTask(task, cw)
+		atomic.AddUint64(&s.stats.CurFileMerges, ^uint64(0))
+		releaseMergeSlot(s.path)
+
+		m.Lock()
+		defer m.Unlock()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		filenames = append(filenames, names...)
+	}
+
+	for _, task := range tasks {
+		m.Lock()
+		failed := firstErr != nil
+		m.Unlock()
+		if failed {
+			break
+		}
+
+		if s.maxConcurrentMerges <= 1 {
+			run(task)
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(task *mergeplan.MergeTask) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			run(task)
+		}(task)
+	}
+	wg.Wait()
+
+	return filenames, firstErr
+}
@@ -0,0 +1,148 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/document"
+	"github.com/lscgzwd/tiggerdb/index/scorch/mergeplan"
+)
+
+func TestMergeThrottle(t *testing.T) {
+	cfg := CreateConfig("TestMergeThrottle")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	cfg["maxConcurrentMerges"] = 2
+
+	const bytesPerSec = 32 * 1024
+	SetMergeThrottle(bytesPerSec)
+	defer SetMergeThrottle(0)
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+	defer func() {
+		if err := idx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for b := 0; b < 8; b++ {
+		batch := index.NewBatch()
+		for i := 0; i < 10; i++ {
+			doc := document.NewDocument(fmt.Sprintf("doc-%d-%d", b, i))
+			doc.AddField(document.NewTextField("name", []uint64{}, []byte(fmt.Sprintf("name %d %d", b, i))))
+			batch.Update(doc)
+		}
+		if err := idx.Batch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// merge two segments per task, so that the tasks of a plan run
+	// concurrently
+	si := idx.(*Scorch)
+	start := time.Now()
+	for atomic.LoadUint64(&si.stats.TotFileSegmentsAtRoot) != 1 {
+		err := si.ForceMerge(context.Background(), &mergeplan.MergePlanOptions{
+			MaxSegmentsPerTier:   1,
+			MaxSegmentSize:       10000,
+			SegmentsPerMergeTask: 2,
+			FloorSegmentSize:     10000,
+		})
+		if err != nil {
+			t.Fatalf("ForceMerge failed, err: %v", err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	written := atomic.LoadUint64(&si.stats.TotFileMergeWrittenBytes)
+	if throttled := atomic.LoadUint64(&si.stats.TotFileMergeThrottledTime); throttled == 0 {
+		t.Errorf("expected merges to be throttled, wrote %d bytes", written)
+	}
+	// the writes are paid for at the throttle rate, less the last pause
+	// below minMergeThrottlePause
+	if minimum := time.Duration(float64(written)/bytesPerSec*float64(time.Second)) - minMergeThrottlePause; elapsed < minimum {
+		t.Errorf("expected merging %d bytes to take at least %v, took %v", written, minimum, elapsed)
+	}
+	if cur := atomic.LoadUint64(&si.stats.CurFileMerges); cur != 0 {
+		t.Errorf("expected no running merges, got %d", cur)
+	}
+	reader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = reader.Close() }()
+	count, err := reader.DocCount()
+	if err != nil || count != 80 {
+		t.Errorf("expected 80 docs after merging, got %d (%v)", count, err)
+	}
+}
+
+func TestMergeSlots(t *testing.T) {
+	defer SetMaxConcurrentMerges(DefaultMaxConcurrentMerges)
+	SetMaxConcurrentMerges(1)
+	if n := MaxConcurrentMerges(); n != 1 {
+		t.Fatalf("expected 1 merge slot, got %d", n)
+	}
+
+	acquireMergeSlot("first")
+	acquired := make(chan time.Duration)
+	go func() {
+		acquired <- acquireMergeSlot("second")
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("expected the second merge to wait for a slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// raising the limit lets the waiting merge run
+	SetMaxConcurrentMerges(2)
+	select {
+	case wait := <-acquired:
+		if wait <= 0 {
+			t.Errorf("expected a positive wait, got %v", wait)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the second merge to acquire a slot")
+	}
+	releaseMergeSlot("second")
+	releaseMergeSlot("first")
+
+	if _, err := parseMaxConcurrentMerges(map[string]interface{}{"maxConcurrentMerges": 0}); err == nil {
+		t.Error("expected an error for 0 concurrent merges")
+	}
+}
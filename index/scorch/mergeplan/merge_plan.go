@@ -120,6 +120,10 @@ type MergePlanOptions struct {
 	// Optional, defaults to mergeplan.ScoreSegments().
 	ScoreSegments func(segments []Segment, o *MergePlanOptions) float64
 
+	// Optional, restricts the segments that may take part in a merge,
+	// e.g. only segments that contain deletions.
+	Eligible func(segment Segment) bool
+
 	// Optional.
 	Logger func(string)
 }
@@ -215,6 +219,10 @@ func plan(segmentsIn []Segment, o *MergePlanOptions) (*MergePlan, error) {
 			isEligible = segment.FileSize() < o.MaxSegmentFileSize/2
 		}
 
+		if isEligible && o.Eligible != nil {
+			isEligible = o.Eligible(segment)
+		}
+
 		// Only small-enough segments are eligible.
 		if isEligible {
 			eligibles = append(eligibles, segment)
@@ -0,0 +1,83 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"sort"
+)
+
+// Partition splits the snapshot into at most n views over disjoint groups
+// of its segments, balanced by their number of documents, so that they can
+// be searched in parallel. The views take over the caller's reference on
+// the snapshot, which is released once all of them are closed; the
+// snapshot itself is returned if it can't be split.
+func (is *IndexSnapshot) Partition(n int) []*IndexSnapshot {
+	if n > len(is.segment) {
+		n = len(is.segment)
+	}
+	if n < 2 {
+		return []*IndexSnapshot{is}
+	}
+
+	// assign the largest segments first, each to the lightest group
+	order := make([]int, len(is.segment))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return is.segment[order[a]].Count() > is.segment[order[b]].Count()
+	})
+	groups := make([][]int, n)
+	weights := make([]uint64, n)
+	for _, s := range order {
+		lightest := 0
+		for g := 1; g < n; g++ {
+			if weights[g] < weights[lightest] {
+				lightest = g
+			}
+		}
+		groups[lightest] = append(groups[lightest], s)
+		weights[lightest] += is.segment[s].Count()
+	}
+
+	rv := make([]*IndexSnapshot, n)
+	for g, group := range groups {
+		sort.Ints(group)
+		view := &IndexSnapshot{
+			parent:        is.parent,
+			segment:       make([]*SegmentSnapshot, len(group)),
+			offsets:       make([]uint64, len(group)),
+			internal:      is.internal,
+			epoch:         is.epoch,
+			creator:       "Partition",
+			base:          is,
+			refs:          1,
+			updatedFields: is.updatedFields,
+		}
+		var running uint64
+		for i, s := range group {
+			view.segment[i] = is.segment[s]
+			view.offsets[i] = running
+			running += is.segment[s].Count()
+		}
+		view.updateSize()
+		rv[g] = view
+	}
+	// one reference on the snapshot per view
+	for g := 1; g < n; g++ {
+		is.AddRef()
+	}
+	return rv
+}
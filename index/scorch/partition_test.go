@@ -0,0 +1,143 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/document"
+)
+
+func TestPartition(t *testing.T) {
+	// in memory, so that neither the persister nor the merger replaces the
+	// segments or the references of the snapshots under test
+	cfg := CreateConfig("TestPartition")
+	cfg["path"] = ""
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// batches of different sizes, one segment each unless merged
+	var expectedIDs []string
+	for b, size := range []int{8, 1, 3, 5, 2} {
+		batch := index.NewBatch()
+		for d := 0; d < size; d++ {
+			id := fmt.Sprintf("doc-%d-%d", b, d)
+			expectedIDs = append(expectedIDs, id)
+			doc := document.NewDocument(id)
+			doc.AddField(document.NewTextField("name", []uint64{}, []byte(id)))
+			batch.Update(doc)
+		}
+		err = idx.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(expectedIDs)
+
+	viewIDs := func(view *IndexSnapshot) []string {
+		var rv []string
+		docIDReader, err := view.DocIDReaderAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = docIDReader.Close() }()
+		for {
+			internalID, err := docIDReader.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if internalID == nil {
+				return rv
+			}
+			id, err := view.ExternalID(internalID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rv = append(rv, id)
+		}
+	}
+
+	for _, n := range []int{1, 2, 3, 10} {
+		reader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		snapshot := reader.(*IndexSnapshot)
+		segments := len(snapshot.segment)
+		snapshot.m.Lock()
+		readerRefs := snapshot.refs
+		snapshot.m.Unlock()
+		views := snapshot.Partition(n)
+
+		expectedViews := n
+		if expectedViews > segments {
+			expectedViews = segments
+		}
+		if len(views) != expectedViews {
+			t.Errorf("n=%d: expected %d partitions of %d segments, got %d", n, expectedViews, segments, len(views))
+		}
+		if n == 1 && views[0] != snapshot {
+			t.Errorf("n=1: expected the snapshot itself")
+		}
+
+		// the partitions cover every document exactly once
+		var ids []string
+		for _, view := range views {
+			if len(view.segment) == 0 {
+				t.Errorf("n=%d: unexpected empty partition", n)
+			}
+			viewDocs := viewIDs(view)
+			count, _ := view.DocCount()
+			if int(count) != len(viewDocs) {
+				t.Errorf("n=%d: expected doc count %d, got %d", n, len(viewDocs), count)
+			}
+			ids = append(ids, viewDocs...)
+		}
+		sort.Strings(ids)
+		if fmt.Sprint(ids) != fmt.Sprint(expectedIDs) {
+			t.Errorf("n=%d: expected documents %v, got %v", n, expectedIDs, ids)
+		}
+
+		// closing every partition releases the reference of the reader
+		for _, view := range views {
+			if err := view.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		snapshot.m.Lock()
+		refs := snapshot.refs
+		snapshot.m.Unlock()
+		if refs != readerRefs-1 {
+			t.Errorf("n=%d: expected %d references on the snapshot, got %d", n, readerRefs-1, refs)
+		}
+	}
+}
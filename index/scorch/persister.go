@@ -16,6 +16,7 @@ package scorch
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -130,8 +131,9 @@ OUTER:
 		if ew != nil && ew.epoch > lastMergedEpoch {
 			lastMergedEpoch = ew.epoch
 		}
+		loopOptions := s.ingestPersisterOptions(po)
 		lastMergedEpoch, persistWatchers = s.pausePersisterForMergerCatchUp(lastPersistedEpoch,
-			lastMergedEpoch, persistWatchers, po)
+			lastMergedEpoch, persistWatchers, loopOptions)
 
 		var ourSnapshot *IndexSnapshot
 		var ourPersisted []chan error
@@ -154,7 +156,7 @@ OUTER:
 		if ourSnapshot != nil {
 			startTime := time.Now()
 
-			err := s.persistSnapshot(ourSnapshot, po)
+			err := s.persistSnapshot(ourSnapshot, loopOptions)
 			for _, ch := range ourPersisted {
 				if err != nil {
 					ch <- err
@@ -265,6 +267,36 @@ func notifyMergeWatchers(lastPersistedEpoch uint64,
 	return watchersNext
 }
 
+// Flush blocks until the root snapshot that is current at the time of the
+// call has been persisted by the persister loop, the index is closed, or the
+// context is done.
+func (s *Scorch) Flush(ctx context.Context) error {
+	if s.readOnly {
+		return nil
+	}
+
+	s.rootLock.RLock()
+	if s.root == nil {
+		s.rootLock.RUnlock()
+		return ErrClosed
+	}
+	epoch := s.root.epoch
+	s.rootLock.RUnlock()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadUint64(&s.stats.LastPersistedEpoch) < epoch {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.closeCh:
+			return ErrClosed
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
 func (s *Scorch) pausePersisterForMergerCatchUp(lastPersistedEpoch uint64,
 	lastMergedEpoch uint64, persistWatchers []*epochWatcher,
 	po *persisterOptions,
@@ -540,10 +572,12 @@ func (s *Scorch) persistSnapshotMaybeMerge(snapshot *IndexSnapshot, po *persiste
 	for _, segment := range newSnapshot.segment {
 		if _, ok := newMergedSegmentIDs[segment.id]; ok {
 			equiv.segment = append(equiv.segment, &SegmentSnapshot{
-				id:      segment.id,
-				segment: segment.segment,
-				deleted: nil, // nil since merging handled deletions
-				stats:   nil,
+				id:        segment.id,
+				segment:   segment.segment,
+				deleted:   nil, // nil since merging handled deletions
+				stats:     nil,
+				sortRuns:  segment.sortRuns,
+				timeRange: segment.timeRange,
 			})
 		}
 	}
@@ -556,12 +590,31 @@ func (s *Scorch) persistSnapshotMaybeMerge(snapshot *IndexSnapshot, po *persiste
 	return true, nil
 }
 
+// FileLinker is an optional interface of the index.Directory given to
+// CopyTo. Persisted segment files are immutable, so instead of copying them
+// they are offered to LinkFile, which may hard link srcPath to filePath in
+// the directory; it returns false to fall back to a regular copy.
+type FileLinker interface {
+	LinkFile(srcPath, filePath string) (bool, error)
+}
+
 func copyToDirectory(srcPath string, d index.Directory) (int64, error) {
 	if d == nil {
 		return 0, nil
 	}
 
-	dest, err := d.GetWriter(filepath.Join("store", filepath.Base(srcPath)))
+	destPath := filepath.Join("store", filepath.Base(srcPath))
+	if linker, ok := d.(FileLinker); ok {
+		linked, err := linker.LinkFile(srcPath, destPath)
+		if err != nil {
+			return 0, fmt.Errorf("LinkFile err: %v", err)
+		}
+		if linked {
+			return 0, nil
+		}
+	}
+
+	dest, err := d.GetWriter(destPath)
 	if err != nil {
 		return 0, fmt.Errorf("GetWriter err: %v", err)
 	}
@@ -752,6 +805,30 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 				return nil, nil, err
 			}
 		}
+
+		// store the sorted runs of segments written in index sort order
+		if segmentSnapshot.sortRuns != nil {
+			b, err := json.Marshal(segmentSnapshot.sortRuns)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = snapshotSegmentBucket.Put(util.BoltSortRunsKey, b)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		// store the range of the timestamp field
+		if segmentSnapshot.timeRange != nil {
+			b, err := json.Marshal(segmentSnapshot.timeRange)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = snapshotSegmentBucket.Put(util.BoltTimeRangeKey, b)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
 	}
 
 	return filenames, newSegmentPaths, nil
@@ -1055,6 +1132,28 @@ func (s *Scorch) loadSegment(segmentBucket *bolt.Bucket) (*SegmentSnapshot, erro
 		// Set the value within the segment base for use during merge
 		rv.UpdateFieldsInfo(rv.updatedFields)
 	}
+	sortRunsBytes := segmentBucket.Get(util.BoltSortRunsKey)
+	if sortRunsBytes != nil {
+		var sortRuns []uint64
+
+		err := json.Unmarshal(sortRunsBytes, &sortRuns)
+		if err != nil {
+			_ = seg.Close()
+			return nil, fmt.Errorf("error reading sort runs bytes: %v", err)
+		}
+		rv.sortRuns = sortRuns
+	}
+	timeRangeBytes := segmentBucket.Get(util.BoltTimeRangeKey)
+	if timeRangeBytes != nil {
+		var timeRange timeRange
+
+		err := json.Unmarshal(timeRangeBytes, &timeRange)
+		if err != nil {
+			_ = seg.Close()
+			return nil, fmt.Errorf("error reading time range bytes: %v", err)
+		}
+		rv.timeRange = &timeRange
+	}
 
 	return rv, nil
 }
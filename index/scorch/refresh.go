@@ -0,0 +1,137 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"sync/atomic"
+
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// SetAutoRefresh controls whether searches see every batch as soon as it
+// is introduced, which is the default. With auto refresh disabled the
+// searches keep seeing the root snapshot of the last Refresh, while
+// Reader still returns the latest root so that document lookups stay
+// realtime.
+func (s *Scorch) SetAutoRefresh(enabled bool) {
+	s.rootLock.Lock()
+	defer s.rootLock.Unlock()
+	if enabled {
+		if s.searchRoot != nil {
+			_ = s.searchRoot.DecRef()
+			s.searchRoot = nil
+		}
+		return
+	}
+	if s.searchRoot == nil && s.root != nil {
+		s.root.AddRef()
+		s.searchRoot = s.root
+	}
+}
+
+// AutoRefresh reports whether searches see every batch as soon as it is
+// introduced.
+func (s *Scorch) AutoRefresh() bool {
+	s.rootLock.RLock()
+	defer s.rootLock.RUnlock()
+	return s.searchRoot == nil
+}
+
+// Refresh makes the batches introduced so far visible to searches when
+// auto refresh is disabled.
+func (s *Scorch) Refresh() {
+	s.rootLock.Lock()
+	defer s.rootLock.Unlock()
+	if s.searchRoot == nil || s.root == nil || s.searchRoot == s.root {
+		return
+	}
+	s.root.AddRef()
+	_ = s.searchRoot.DecRef()
+	s.searchRoot = s.root
+	atomic.AddUint64(&s.stats.TotRefreshes, 1)
+}
+
+// SearchReader returns the reader searches run on, the snapshot of the
+// last Refresh when auto refresh is disabled and the latest root
+// otherwise.
+func (s *Scorch) SearchReader() (index.IndexReader, error) {
+	s.rootLock.RLock()
+	defer s.rootLock.RUnlock()
+	rv := s.searchRoot
+	if rv == nil {
+		rv = s.root
+	}
+	if rv != nil {
+		rv.AddRef()
+	}
+	return rv, nil
+}
+
+// releaseSearchRoot drops the snapshot held for searches when the index
+// is closed.
+func (s *Scorch) releaseSearchRoot() {
+	s.rootLock.Lock()
+	defer s.rootLock.Unlock()
+	if s.searchRoot != nil {
+		_ = s.searchRoot.DecRef()
+		s.searchRoot = nil
+	}
+}
+
+// SetIngestMode tunes the index for bulk loading. While in ingest mode
+// the persister naps longer and merges larger in-memory segments before
+// writing them, and the merger doesn't plan merges of file segments on
+// its own, forced merges still run.
+func (s *Scorch) SetIngestMode(enabled bool) {
+	var v uint32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreUint32(&s.ingestMode, v)
+}
+
+// IngestMode reports whether the index is tuned for bulk loading.
+func (s *Scorch) IngestMode() bool {
+	return atomic.LoadUint32(&s.ingestMode) == 1
+}
+
+// Persister options used while in ingest mode, the in-memory segments of
+// up to IngestMaxSizeInMemoryMerge bytes per worker are merged before being
+// persisted.
+var (
+	IngestPersisterNapTimeMSec      = 2000
+	IngestPersisterNapUnderNumFiles = 2000
+	IngestMaxSizeInMemoryMerge      = 256 * 1024 * 1024
+)
+
+// ingestPersisterOptions returns the persister options to use, po or its
+// ingest mode variant.
+func (s *Scorch) ingestPersisterOptions(po *persisterOptions) *persisterOptions {
+	if !s.IngestMode() {
+		return po
+	}
+	rv := *po
+	if rv.PersisterNapTimeMSec < IngestPersisterNapTimeMSec {
+		rv.PersisterNapTimeMSec = IngestPersisterNapTimeMSec
+	}
+	if rv.PersisterNapUnderNumFiles < IngestPersisterNapUnderNumFiles {
+		rv.PersisterNapUnderNumFiles = IngestPersisterNapUnderNumFiles
+	}
+	// 0 merges all the in-memory segments at once already
+	if rv.MaxSizeInMemoryMergePerWorker > 0 && rv.MaxSizeInMemoryMergePerWorker < IngestMaxSizeInMemoryMerge {
+		rv.MaxSizeInMemoryMergePerWorker = IngestMaxSizeInMemoryMerge
+	}
+	return &rv
+}
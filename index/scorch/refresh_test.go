@@ -0,0 +1,131 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"testing"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/document"
+)
+
+func TestAutoRefresh(t *testing.T) {
+	cfg := CreateConfig("TestAutoRefresh")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+	defer func() {
+		if err := idx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	si := idx.(*Scorch)
+
+	next := 0
+	indexDocs := func(n int) {
+		t.Helper()
+		batch := index.NewBatch()
+		for i := 0; i < n; i++ {
+			doc := document.NewDocument(fmt.Sprintf("doc-%d", next))
+			doc.AddField(document.NewTextField("name", []uint64{}, []byte("test")))
+			batch.Update(doc)
+			next++
+		}
+		if err := idx.Batch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	docCount := func(reader index.IndexReader, err error) uint64 {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = reader.Close() }()
+		count, err := reader.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	check := func(search, realtime uint64) {
+		t.Helper()
+		if count := docCount(si.SearchReader()); count != search {
+			t.Errorf("expected %d docs visible to searches, got %d", search, count)
+		}
+		if count := docCount(si.Reader()); count != realtime {
+			t.Errorf("expected %d docs visible to readers, got %d", realtime, count)
+		}
+	}
+
+	indexDocs(2)
+	check(2, 2)
+
+	// searches keep seeing the snapshot of the last refresh
+	si.SetAutoRefresh(false)
+	if si.AutoRefresh() {
+		t.Fatal("expected auto refresh to be disabled")
+	}
+	indexDocs(3)
+	check(2, 5)
+	si.Refresh()
+	check(5, 5)
+	indexDocs(1)
+	check(5, 6)
+	if si.stats.TotRefreshes != 1 {
+		t.Errorf("expected 1 refresh, got %d", si.stats.TotRefreshes)
+	}
+
+	// enabling auto refresh makes every batch visible again
+	si.SetAutoRefresh(true)
+	check(6, 6)
+	indexDocs(1)
+	check(7, 7)
+
+	// ingest mode raises the persister options only while it's on
+	po, err := si.parsePersisterOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := si.ingestPersisterOptions(po); got != po {
+		t.Errorf("expected the configured persister options, got %+v", got)
+	}
+	si.SetIngestMode(true)
+	if !si.IngestMode() {
+		t.Fatal("expected ingest mode")
+	}
+	got := si.ingestPersisterOptions(po)
+	if got.PersisterNapTimeMSec < IngestPersisterNapTimeMSec || got.PersisterNapUnderNumFiles < IngestPersisterNapUnderNumFiles {
+		t.Errorf("expected ingest persister options, got %+v", got)
+	}
+	si.SetIngestMode(false)
+}
@@ -32,6 +32,11 @@ func (r *RollbackPoint) GetInternal(key []byte) []byte {
 	return r.meta[string(key)]
 }
 
+// Epoch returns the epoch of the snapshot the rollback point refers to.
+func (r *RollbackPoint) Epoch() uint64 {
+	return r.epoch
+}
+
 // RollbackPoints returns an array of rollback points available for
 // the application to rollback to, with more recent rollback points
 // (higher epochs) coming first.
@@ -215,3 +220,52 @@ func Rollback(path string, to *RollbackPoint) error {
 
 	return err
 }
+
+// CheckRollbackPoint verifies that the snapshot of the rollback point can
+// be loaded, that is its metadata is intact and all of its segment files
+// can be opened. Opening the index silently falls back to an older
+// snapshot when the latest one can't be loaded, this allows applications
+// to find out beforehand.
+func CheckRollbackPoint(path string, p *RollbackPoint) (err error) {
+	if p == nil {
+		return fmt.Errorf("CheckRollbackPoint: RollbackPoint is nil")
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("CheckRollbackPoint: index path is empty")
+	}
+
+	rootBoltPath := path + string(os.PathSeparator) + "root.bolt"
+	rootBolt, err := bolt.Open(rootBoltPath, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil || rootBolt == nil {
+		return err
+	}
+	defer func() {
+		_ = rootBolt.Close()
+	}()
+
+	// segment files damaged in unexpected ways may make the segment
+	// plugin panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("CheckRollbackPoint: failed to load snapshot %d: %v", p.epoch, r)
+		}
+	}()
+
+	return rootBolt.View(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(util.BoltSnapshotsBucket)
+		if snapshots == nil {
+			return fmt.Errorf("CheckRollbackPoint: no persisted snapshots found in bolt")
+		}
+		snapshot := snapshots.Bucket(encodeUvarintAscending(nil, p.epoch))
+		if snapshot == nil {
+			return fmt.Errorf("CheckRollbackPoint: snapshot %d not found in bolt", p.epoch)
+		}
+		s := &Scorch{path: path}
+		indexSnapshot, err := s.loadSnapshot(snapshot)
+		if err != nil {
+			return fmt.Errorf("CheckRollbackPoint: failed to load snapshot %d: %v", p.epoch, err)
+		}
+		indexSnapshot.parent = nil
+		return indexSnapshot.DecRef()
+	})
+}
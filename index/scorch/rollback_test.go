@@ -621,3 +621,81 @@ func TestSparseMutationCheckpointing(t *testing.T) {
 		t.Fatalf("expected %d protected snapshots, got %d", NumSnapshotsToKeep, len(protectedSnapshots))
 	}
 }
+
+func TestCheckRollbackPoint(t *testing.T) {
+	cfg := CreateConfig("TestCheckRollbackPoint")
+	numSnapshotsToKeepOrig := NumSnapshotsToKeep
+	NumSnapshotsToKeep = 1000
+
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		NumSnapshotsToKeep = numSnapshotsToKeepOrig
+
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	// every batch is persisted in its own snapshot and segment file
+	analysisQueue := index.NewAnalysisQueue(1)
+	for i := 0; i < 2; i++ {
+		idx, err := NewScorch(Name, cfg, analysisQueue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = idx.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexDummyData(t, idx.(*Scorch), 2*i)
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	indexPath, _ := cfg["path"].(string)
+	rollbackPoints, err := RollbackPoints(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rollbackPoints) < 2 {
+		t.Fatalf("expected at least 2 rollbackPoints, got %d", len(rollbackPoints))
+	}
+	for _, p := range rollbackPoints {
+		err = CheckRollbackPoint(indexPath, p)
+		if err != nil {
+			t.Fatalf("expected snapshot %d to load, got %v", p.Epoch(), err)
+		}
+	}
+
+	// the newest segment file is only in the latest snapshots
+	files, err := filepath.Glob(filepath.Join(indexPath, "*.zap"))
+	if err != nil || len(files) < 2 {
+		t.Fatalf("expected segment files, got %v, %v", files, err)
+	}
+	newest := files[0]
+	for _, f := range files {
+		if f > newest {
+			newest = f
+		}
+	}
+	err = os.Remove(newest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckRollbackPoint(indexPath, rollbackPoints[0])
+	if err == nil {
+		t.Fatalf("expected latest snapshot %d to fail loading", rollbackPoints[0].Epoch())
+	}
+	last := rollbackPoints[len(rollbackPoints)-1]
+	err = CheckRollbackPoint(indexPath, last)
+	if err != nil {
+		t.Fatalf("expected oldest snapshot %d to load, got %v", last.Epoch(), err)
+	}
+}
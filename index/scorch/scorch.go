@@ -24,10 +24,11 @@ import (
 	"time"
 
 	"github.com/RoaringBitmap/roaring/v2"
-	"github.com/lscgzwd/tiggerdb/registry"
-	"github.com/lscgzwd/tiggerdb/util"
 	index "github.com/blevesearch/bleve_index_api"
 	segment "github.com/blevesearch/scorch_segment_api/v2"
+	"github.com/lscgzwd/tiggerdb/registry"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/util"
 	bolt "go.etcd.io/bbolt"
 )
 
@@ -86,6 +87,25 @@ type Scorch struct {
 	segPlugin SegmentPlugin
 
 	spatialPlugin index.SpatialAnalyzerPlugin
+
+	// indexSort, when set, is the order documents are stored in
+	// within the segments built from batches
+	indexSort search.SortOrder
+
+	// timestampField, when set, is the date field whose range of values
+	// is tracked per segment to skip segments in time range searches
+	timestampField string
+
+	// maxConcurrentMerges is the number of tasks of a merge plan that
+	// may run at the same time
+	maxConcurrentMerges int
+
+	// searchRoot, when set, is the snapshot searches run on instead of
+	// the root, see SetAutoRefresh; protected by rootLock
+	searchRoot *IndexSnapshot
+
+	// ingestMode is 1 while the index is tuned for bulk loading
+	ingestMode uint32
 }
 
 // AsyncPanicError is passed to scorch asyncErrorHandler when panic occurs in scorch background process
@@ -161,6 +181,18 @@ func NewScorch(storeName string,
 	if ok {
 		rv.onAsyncError = RegistryAsyncErrorCallbacks[aecbName]
 	}
+	rv.indexSort, err = parseIndexSort(config)
+	if err != nil {
+		return nil, err
+	}
+	rv.timestampField, err = parseTimestampField(config)
+	if err != nil {
+		return nil, err
+	}
+	rv.maxConcurrentMerges, err = parseMaxConcurrentMerges(config)
+	if err != nil {
+		return nil, err
+	}
 	// validate any custom persistor options to
 	// prevent an async error in the persistor routine
 	_, err = rv.parsePersisterOptions()
@@ -363,6 +395,7 @@ func (s *Scorch) Close() (err error) {
 	close(s.closeCh)
 	// wait for them to close
 	s.asyncTasks.Wait()
+	s.releaseSearchRoot()
 	// now close the root bolt
 	if s.rootBolt != nil {
 		err = s.rootBolt.Close()
@@ -462,10 +495,19 @@ func (s *Scorch) Batch(batch *index.Batch) (err error) {
 	indexStart := time.Now()
 
 	var newSegment segment.Segment
+	var sortRuns []uint64
+	var timeRange *timeRange
 	var bufBytes uint64
 	stats := newFieldStats()
 
 	if len(analysisResults) > 0 {
+		if s.indexSort != nil {
+			s.sortDocuments(analysisResults)
+			sortRuns = []uint64{0}
+		}
+		if s.timestampField != "" {
+			timeRange = s.documentsTimeRange(analysisResults)
+		}
 		newSegment, bufBytes, err = s.segPlugin.New(analysisResults)
 		if err != nil {
 			return err
@@ -482,7 +524,7 @@ func (s *Scorch) Batch(batch *index.Batch) (err error) {
 		atomic.AddUint64(&s.stats.TotBatchesEmpty, 1)
 	}
 
-	err = s.prepareSegment(newSegment, ids, batch.InternalOps, batch.PersistedCallback(), stats)
+	err = s.prepareSegment(newSegment, sortRuns, timeRange, ids, batch.InternalOps, batch.PersistedCallback(), stats)
 	if err != nil {
 		if newSegment != nil {
 			_ = newSegment.Close()
@@ -501,13 +543,15 @@ func (s *Scorch) Batch(batch *index.Batch) (err error) {
 	return err
 }
 
-func (s *Scorch) prepareSegment(newSegment segment.Segment, ids []string,
+func (s *Scorch) prepareSegment(newSegment segment.Segment, sortRuns []uint64, timeRange *timeRange, ids []string,
 	internalOps map[string][]byte, persistedCallback index.BatchCallback, stats *fieldStats,
 ) error {
 	// new introduction
 	introduction := &segmentIntroduction{
 		id:                atomic.AddUint64(&s.nextSegmentID, 1),
 		data:              newSegment,
+		sortRuns:          sortRuns,
+		timeRange:         timeRange,
 		ids:               ids,
 		internal:          internalOps,
 		stats:             stats,
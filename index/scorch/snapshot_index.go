@@ -76,6 +76,10 @@ type IndexSnapshot struct {
 	size     uint64
 	creator  string
 
+	// base is the snapshot a time pruned view was created from, the
+	// view shares its segments
+	base *IndexSnapshot
+
 	m    sync.Mutex // Protects the fields that follow.
 	refs int64
 
@@ -110,7 +114,9 @@ func (i *IndexSnapshot) AddRef() {
 func (i *IndexSnapshot) DecRef() (err error) {
 	i.m.Lock()
 	i.refs--
-	if i.refs == 0 {
+	if i.refs == 0 && i.base != nil {
+		err = i.base.DecRef()
+	} else if i.refs == 0 {
 		for _, s := range i.segment {
 			if s != nil {
 				err2 := s.segment.DecRef()
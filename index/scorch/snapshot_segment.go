@@ -43,6 +43,14 @@ type SegmentSnapshot struct {
 	stats         *fieldStats
 	updatedFields map[string]*index.UpdateFieldInfo
 
+	// sortRuns holds the numbers of the documents starting each run
+	// stored in index sort order, nil if the segment isn't sorted
+	sortRuns []uint64
+
+	// timeRange holds the range of the timestamp field over the
+	// documents of the segment, nil if it isn't known
+	timeRange *timeRange
+
 	cachedMeta *cachedMeta
 
 	cachedDocs *cachedDocs
@@ -54,6 +54,9 @@ type Stats struct {
 	TotKNNSearches     uint64
 	TotSynonymSearches uint64
 
+	TotTimePruningSearches uint64
+	TotTimePrunedSegments  uint64
+
 	TotEventTriggerStarted   uint64
 	TotEventTriggerCompleted uint64
 
@@ -112,6 +115,12 @@ type Stats struct {
 	TotFileSegmentsAtRoot     uint64
 	TotFileMergeWrittenBytes  uint64
 
+	TotRefreshes uint64
+
+	CurFileMerges             uint64
+	TotFileMergeThrottledTime uint64
+	TotFileMergeSlotWaitTime  uint64
+
 	TotFileMergeZapBeg              uint64
 	TotFileMergeZapEnd              uint64
 	TotFileMergeZapTime             uint64
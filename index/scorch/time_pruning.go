@@ -0,0 +1,183 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// timeRange is the smallest and largest value of the timestamp field over
+// the documents of a segment, in nanoseconds since the epoch. Count is the
+// number of values seen, a segment without any timestamp has none.
+type timeRange struct {
+	Min   int64  `json:"min"`
+	Max   int64  `json:"max"`
+	Count uint64 `json:"count"`
+}
+
+// add extends the range to include t
+func (r *timeRange) add(t int64) {
+	if r.Count == 0 || t < r.Min {
+		r.Min = t
+	}
+	if r.Count == 0 || t > r.Max {
+		r.Max = t
+	}
+	r.Count++
+}
+
+// union extends the range to include all the values of o
+func (r *timeRange) union(o *timeRange) {
+	if o.Count == 0 {
+		return
+	}
+	if r.Count == 0 || o.Min < r.Min {
+		r.Min = o.Min
+	}
+	if r.Count == 0 || o.Max > r.Max {
+		r.Max = o.Max
+	}
+	r.Count += o.Count
+}
+
+// overlaps reports whether some value of the range may fall in
+// [start, end]
+func (r *timeRange) overlaps(start, end int64) bool {
+	return r.Count > 0 && r.Max >= start && r.Min <= end
+}
+
+// parseTimestampField parses the "timestampField" config option, the name
+// of the date field whose range is tracked per segment
+func parseTimestampField(config map[string]interface{}) (string, error) {
+	v, ok := config["timestampField"]
+	if !ok || v == nil {
+		return "", nil
+	}
+	field, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("timestampField must be a string, got %T", v)
+	}
+	return field, nil
+}
+
+// documentsTimeRange computes the range of the timestamp field over the
+// analyzed documents of a batch.
+func (s *Scorch) documentsTimeRange(docs []index.Document) *timeRange {
+	rv := &timeRange{}
+	for _, doc := range docs {
+		doc.VisitFields(func(field index.Field) {
+			if field.Name() != s.timestampField {
+				return
+			}
+			dtf, ok := field.(index.DateTimeField)
+			if !ok {
+				return
+			}
+			t, _, err := dtf.DateTime()
+			if err != nil {
+				return
+			}
+			rv.add(t.UnixNano())
+		})
+	}
+	return rv
+}
+
+// mergedTimeRanges computes the time ranges of the segments produced by a
+// merge as the union of the ranges of their inputs. A new segment gets a
+// nil range if the range of any of its inputs isn't known.
+func mergedTimeRanges(nextMerge *segmentMerge) []*timeRange {
+	rv := make([]*timeRange, len(nextMerge.new))
+	unknown := make([]bool, len(nextMerge.new))
+	for _, h := range nextMerge.mergedSegHistory {
+		if h.workerID >= uint64(len(rv)) || unknown[h.workerID] {
+			continue
+		}
+		if h.oldSegment.timeRange == nil {
+			unknown[h.workerID] = true
+			rv[h.workerID] = nil
+			continue
+		}
+		if rv[h.workerID] == nil {
+			rv[h.workerID] = &timeRange{}
+		}
+		rv[h.workerID].union(h.oldSegment.timeRange)
+	}
+	return rv
+}
+
+// TimestampField returns the date field whose range is tracked per
+// segment, "" if none is.
+func (is *IndexSnapshot) TimestampField() string {
+	if is.parent == nil {
+		return ""
+	}
+	return is.parent.timestampField
+}
+
+// PruneByTime returns a view of the snapshot without the segments none of
+// whose timestamps fall in [start, end], along with the number of pruned
+// segments. A zero start or end leaves that side unbounded. The view takes
+// over the caller's reference on the snapshot, which is released when the
+// view is closed; the snapshot itself is returned if nothing is pruned.
+func (is *IndexSnapshot) PruneByTime(start, end time.Time) (*IndexSnapshot, int) {
+	if is.TimestampField() == "" {
+		return is, 0
+	}
+	atomic.AddUint64(&is.parent.stats.TotTimePruningSearches, 1)
+
+	startNanos, endNanos := int64(-1<<63), int64(1<<63-1)
+	if !start.IsZero() {
+		startNanos = start.UnixNano()
+	}
+	if !end.IsZero() {
+		endNanos = end.UnixNano()
+	}
+
+	keep := make([]*SegmentSnapshot, 0, len(is.segment))
+	for _, ss := range is.segment {
+		if ss.timeRange == nil || ss.timeRange.overlaps(startNanos, endNanos) {
+			keep = append(keep, ss)
+		}
+	}
+	pruned := len(is.segment) - len(keep)
+	if pruned == 0 {
+		return is, 0
+	}
+	atomic.AddUint64(&is.parent.stats.TotTimePrunedSegments, uint64(pruned))
+
+	rv := &IndexSnapshot{
+		parent:        is.parent,
+		segment:       keep,
+		offsets:       make([]uint64, len(keep)),
+		internal:      is.internal,
+		epoch:         is.epoch,
+		creator:       "PruneByTime",
+		base:          is,
+		refs:          1,
+		updatedFields: is.updatedFields,
+	}
+	var running uint64
+	for i, ss := range keep {
+		rv.offsets[i] = running
+		running += ss.Count()
+	}
+	rv.updateSize()
+	return rv, pruned
+}
@@ -0,0 +1,230 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/document"
+	"github.com/lscgzwd/tiggerdb/index/scorch/mergeplan"
+)
+
+func TestTimePruning(t *testing.T) {
+	cfg := CreateConfig("TestTimePruning")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	cfg["timestampField"] = "ts"
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+
+	// one batch per day, the last batch has no timestamps
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	timestamps := map[string]time.Time{}
+	for d := 0; d < 3; d++ {
+		batch := index.NewBatch()
+		for h := 0; h < 4; h++ {
+			id := fmt.Sprintf("doc-%d-%d", d, h)
+			timestamps[id] = base.Add(time.Duration(d)*day + time.Duration(h)*time.Hour)
+			doc := document.NewDocument(id)
+			field, err := document.NewDateTimeFieldWithIndexingOptions("ts", []uint64{},
+				timestamps[id], time.RFC3339, index.IndexField)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc.AddField(field)
+			batch.Update(doc)
+		}
+		err = idx.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch := index.NewBatch()
+	doc := document.NewDocument("untimed")
+	doc.AddField(document.NewTextField("name", []uint64{}, []byte("untimed")))
+	batch.Update(doc)
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// segmentDocs lists the documents of each segment of the snapshot,
+	// background merges decide how the batches are laid out
+	segmentDocs := func(snapshot *IndexSnapshot) [][]string {
+		rv := make([][]string, len(snapshot.segment))
+		docIDReader, err := snapshot.DocIDReaderAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = docIDReader.Close() }()
+		for {
+			internalID, err := docIDReader.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if internalID == nil {
+				break
+			}
+			id, err := snapshot.ExternalID(internalID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			segmentIndex, _, err := snapshot.segmentIndexAndLocalDocNum(internalID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rv[segmentIndex] = append(rv[segmentIndex], id)
+		}
+		return rv
+	}
+
+	var expectedPrunedTotal int
+	checkPruning := func(start, end time.Time) {
+		t.Helper()
+		reader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		snapshot := reader.(*IndexSnapshot)
+		if snapshot.TimestampField() != "ts" {
+			t.Fatalf("expected timestamp field ts, got %q", snapshot.TimestampField())
+		}
+
+		// every segment tracks the exact range of its documents and is
+		// pruned only if none of them is in range
+		expectedPruned := 0
+		var expectedIDs []string
+		for i, ids := range segmentDocs(snapshot) {
+			expectedRange := &timeRange{}
+			inRange := false
+			for _, id := range ids {
+				ts, ok := timestamps[id]
+				if !ok {
+					continue
+				}
+				expectedRange.add(ts.UnixNano())
+				if !ts.Before(start) && (end.IsZero() || !ts.After(end)) {
+					inRange = true
+				}
+			}
+			if tr := snapshot.segment[i].timeRange; tr == nil || *tr != *expectedRange {
+				t.Errorf("segment %d: expected time range %+v, got %+v", i, expectedRange, tr)
+			}
+			if inRange {
+				expectedIDs = append(expectedIDs, ids...)
+			} else {
+				expectedPruned++
+			}
+		}
+		sort.Strings(expectedIDs)
+		expectedPrunedTotal += expectedPruned
+
+		view, pruned := snapshot.PruneByTime(start, end)
+		defer func() {
+			if err := view.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}()
+		if pruned != expectedPruned {
+			t.Errorf("[%v, %v]: expected %d pruned segments, got %d", start, end, expectedPruned, pruned)
+		}
+		var ids []string
+		for _, segmentIDs := range segmentDocs(view) {
+			ids = append(ids, segmentIDs...)
+		}
+		sort.Strings(ids)
+		if fmt.Sprint(ids) != fmt.Sprint(expectedIDs) {
+			t.Errorf("[%v, %v]: expected documents %v, got %v", start, end, expectedIDs, ids)
+		}
+		count, _ := view.DocCount()
+		if int(count) != len(expectedIDs) {
+			t.Errorf("[%v, %v]: expected doc count %d, got %d", start, end, len(expectedIDs), count)
+		}
+	}
+
+	checkSegments := func() {
+		// the second day only
+		checkPruning(base.Add(day+time.Hour), base.Add(day+2*time.Hour))
+		// unbounded end
+		checkPruning(base.Add(2*day), time.Time{})
+		// before any document
+		checkPruning(base.Add(-day), base.Add(-time.Minute))
+	}
+
+	checkSegments()
+	si := idx.(*Scorch)
+	if n := atomic.LoadUint64(&si.stats.TotTimePrunedSegments); n != uint64(expectedPrunedTotal) {
+		t.Errorf("expected %d pruned segments in stats, got %d", expectedPrunedTotal, n)
+	}
+
+	// the ranges survive reopening the index
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err = NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+	checkSegments()
+
+	// a merged segment covers the union of its inputs
+	si = idx.(*Scorch)
+	ctx := context.Background()
+	for atomic.LoadUint64(&si.stats.TotFileSegmentsAtRoot) != 1 {
+		err := si.ForceMerge(ctx, &mergeplan.MergePlanOptions{
+			MaxSegmentsPerTier:   1,
+			MaxSegmentSize:       10000,
+			SegmentsPerMergeTask: 10,
+			FloorSegmentSize:     10000,
+		})
+		if err != nil {
+			t.Fatalf("ForceMerge failed, err: %v", err)
+		}
+	}
+	checkSegments()
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -53,6 +53,9 @@ type indexImpl struct {
 	mutex sync.RWMutex
 	open  bool
 	stats *IndexStat
+
+	// mappingMu guards m for Mapping(), which is called without holding mutex
+	mappingMu sync.RWMutex
 }
 
 const storePath = "store"
@@ -307,9 +310,39 @@ func (i *indexImpl) Advanced() (index.Index, error) {
 // Mapping returns the IndexMapping in use by this
 // Index.
 func (i *indexImpl) Mapping() mapping.IndexMapping {
+	i.mappingMu.RLock()
+	defer i.mappingMu.RUnlock()
 	return i.m
 }
 
+// SetMapping persists m and uses it for documents indexed from now on.
+// Documents already in the index are not re-indexed, so m should only
+// add to the existing mapping.
+func (i *indexImpl) SetMapping(m mapping.IndexMapping) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	mappingBytes, err := util.MarshalJSON(m)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if !i.open {
+		return ErrorIndexClosed
+	}
+	if err := i.i.SetInternal(util.MappingInternalKey, mappingBytes); err != nil {
+		return err
+	}
+
+	i.mappingMu.Lock()
+	i.m = m
+	i.mappingMu.Unlock()
+	return nil
+}
+
 // Index the object with the specified identifier.
 // The IndexMapping for this index will determine
 // how the object is indexed.
@@ -611,6 +644,20 @@ func (i *indexImpl) preSearch(ctx context.Context, req *SearchRequest, reader in
 	}, nil
 }
 
+// searchReaderIndex is implemented by indexes whose searches may run on an
+// older, refreshed view of the index than the one Reader returns
+type searchReaderIndex interface {
+	SearchReader() (index.IndexReader, error)
+}
+
+// searchIndexReader opens the reader searches run on
+func (i *indexImpl) searchIndexReader() (index.IndexReader, error) {
+	if sr, ok := i.i.(searchReaderIndex); ok {
+		return sr.SearchReader()
+	}
+	return i.i.Reader()
+}
+
 // SearchInContext executes a search request operation within the provided
 // Context. Returns a SearchResult object or an error.
 func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr *SearchResult, err error) {
@@ -624,10 +671,25 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 	}
 
 	// open a reader for this search
-	indexReader, err := i.i.Reader()
+	indexReader, err := i.searchIndexReader()
 	if err != nil {
 		return nil, fmt.Errorf("error opening index reader %v", err)
 	}
+
+	// split the snapshot into partitions searched in parallel when the
+	// caller asked for it, the partitions take over the reader
+	if partitions := partitionReader(ctx, req, indexReader); partitions != nil {
+		return i.searchPartitions(ctx, req, partitions, searchStart)
+	}
+
+	return i.searchReader(ctx, req, indexReader, searchStart)
+}
+
+// searchReader executes the search request against the given reader, which
+// is closed once the search is done.
+func (i *indexImpl) searchReader(ctx context.Context, req *SearchRequest,
+	indexReader index.IndexReader, searchStart time.Time,
+) (sr *SearchResult, err error) {
 	defer func() {
 		if cerr := indexReader.Close(); err == nil && cerr != nil {
 			err = cerr
@@ -754,6 +816,23 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 		setKnnHitsInCollector(knnHits, req, coll)
 	}
 
+	// skip the segments none of whose timestamps can match the query, knn
+	// hits already collected refer to documents of the whole snapshot
+	if is, ok := indexReader.(*scorch.IndexSnapshot); ok && !requestHasKNN(req) {
+		if field := is.TimestampField(); field != "" {
+			if start, end, ok := query.ExtractDateRange(req.Query, field); ok {
+				total := len(is.Segments())
+				pruned, n := is.PruneByTime(start, end)
+				indexReader = pruned
+				if stats, ok := ctx.Value(search.TimePruningStatsKey).(*search.TimePruningStats); ok {
+					stats.Field = field
+					stats.SegmentsTotal += total
+					stats.SegmentsPruned += n
+				}
+			}
+		}
+	}
+
 	if fts != nil {
 		if is, ok := indexReader.(*scorch.IndexSnapshot); ok {
 			is.UpdateSynonymSearchCount(1)
@@ -824,7 +903,12 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 	if req.Facets != nil {
 		facetsBuilder := search.NewFacetsBuilder(indexReader)
 		for facetName, facetRequest := range req.Facets {
-			if facetRequest.NumericRanges != nil {
+			if facetRequest.Cardinality != nil {
+				// build cardinality facet
+				facetBuilder := facet.NewCardinalityFacetBuilder(facetRequest.Field, facetRequest.Cardinality.PrecisionThreshold)
+				facetBuilder.SetMissing(facetRequest.Cardinality.Missing)
+				facetsBuilder.Add(facetName, facetBuilder)
+			} else if facetRequest.NumericRanges != nil {
 				// build numeric range facet
 				facetBuilder := facet.NewNumericFacetBuilder(facetRequest.Field, facetRequest.Size)
 				for _, nr := range facetRequest.NumericRanges {
@@ -923,19 +1007,23 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 	totalSearchCost += storedFieldsCost
 	search.RecordSearchCost(ctx, search.AddM, storedFieldsCost)
 
-	if req.PreSearchData == nil {
-		// increment the search count only if this is not a second-phase search
-		// (e.g., for Hybrid Search), since the first-phase search already increments it
-		atomic.AddUint64(&i.stats.searches, 1)
-	}
-	// increment the search time stat, as the first-phase search is part of
-	// the overall operation; adding second-phase time later keeps it accurate
+	// the search of a partition is accounted for once all the partitions
+	// are merged
 	searchDuration := time.Since(searchStart)
-	atomic.AddUint64(&i.stats.searchTime, uint64(searchDuration))
+	if _, partition := ctx.Value(searchPartitionKey).(bool); !partition {
+		if req.PreSearchData == nil {
+			// increment the search count only if this is not a second-phase search
+			// (e.g., for Hybrid Search), since the first-phase search already increments it
+			atomic.AddUint64(&i.stats.searches, 1)
+		}
+		// increment the search time stat, as the first-phase search is part of
+		// the overall operation; adding second-phase time later keeps it accurate
+		atomic.AddUint64(&i.stats.searchTime, uint64(searchDuration))
 
-	if Config.SlowSearchLogThreshold > 0 &&
-		searchDuration > Config.SlowSearchLogThreshold {
-		logger.Printf("slow search took %s - %v", searchDuration, req)
+		if Config.SlowSearchLogThreshold > 0 &&
+			searchDuration > Config.SlowSearchLogThreshold {
+			logger.Printf("slow search took %s - %v", searchDuration, req)
+		}
 	}
 
 	if reverseQueryExecution {
@@ -960,6 +1048,7 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 		Took:     searchDuration,
 		Facets:   coll.FacetResults(),
 	}
+	rv.TimedOut = coll.TimedOut()
 
 	// rescore if fusion flag is set
 	if rescorer != nil {
@@ -1383,6 +1472,32 @@ func (f FileSystemDirectory) GetWriter(filePath string) (io.WriteCloser,
 		os.O_RDWR|os.O_CREATE, 0o600)
 }
 
+// HardLinkDirectory is a FileSystemDirectory which hard links the
+// immutable segment files of the copied index instead of copying them,
+// falling back to a copy where linking isn't possible, for example across
+// file systems.
+type HardLinkDirectory string
+
+func (d HardLinkDirectory) GetWriter(filePath string) (io.WriteCloser,
+	error,
+) {
+	return FileSystemDirectory(d).GetWriter(filePath)
+}
+
+// LinkFile hard links srcPath to filePath in the directory, it returns
+// false if the link can't be created.
+func (d HardLinkDirectory) LinkFile(srcPath, filePath string) (bool, error) {
+	dst := filepath.Join(string(d), filePath)
+	err := os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Link(srcPath, dst); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
 func (i *indexImpl) FireIndexEvent() {
 	// get the internal index implementation
 	internalIndex, err := i.Advanced()
@@ -1036,6 +1036,64 @@ func TestIndexOpenMetaMissingOrCorrupt(t *testing.T) {
 	}
 }
 
+func TestIndexSetMapping(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	index, err := New(tmpIndexPath, NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = index.Index("a", map[string]interface{}{"tag": "Big Data"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewIndexMapping()
+	m.DefaultMapping.AddFieldMappingsAt("tag", NewKeywordFieldMapping())
+	if err = index.(*indexImpl).SetMapping(m); err != nil {
+		t.Fatal(err)
+	}
+	if index.Mapping() != m {
+		t.Fatalf("expected the new mapping to be in use")
+	}
+	if err = index.Index("b", map[string]interface{}{"tag": "Big Data"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the document indexed after the update uses the keyword mapping
+	q := NewTermQuery("Big Data")
+	q.SetField("tag")
+	res, err := index.Search(NewSearchRequest(q))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].ID != "b" {
+		t.Fatalf("expected only document b to match, got %v", res.Hits)
+	}
+	if err = index.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mapping is persisted
+	index, err = Open(tmpIndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := index.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if analyzer := index.Mapping().AnalyzerNameForPath("tag"); analyzer != "keyword" {
+		t.Errorf("expected the reopened index to use the keyword analyzer, got %q", analyzer)
+	}
+	invalid := NewIndexMapping()
+	invalid.DefaultAnalyzer = "missing"
+	if err = index.(*indexImpl).SetMapping(invalid); err == nil {
+		t.Errorf("expected an invalid mapping to be rejected")
+	}
+}
+
 func TestInMemIndex(t *testing.T) {
 	index, err := NewMemOnly(NewIndexMapping())
 	if err != nil {
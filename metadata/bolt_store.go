@@ -0,0 +1,853 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltMetadataFile bolt 元数据存储在 FilePath 目录下的数据库文件名
+const BoltMetadataFile = "metadata.db"
+
+// boltOpenTimeout 打开数据库时等待文件锁的最长时间（另一个进程正在使用同一数据目录时返回错误而不是一直等待）
+const boltOpenTimeout = 5 * time.Second
+
+var (
+	boltIndexesBucket    = []byte("indexes")
+	boltTablesBucket     = []byte("tables")  // 每个索引一个子 bucket：tableName -> metadata
+	boltHistoryBucket    = []byte("history") // 每个索引一个子 bucket：版本号（大端序）-> 历史版本
+	boltScriptsBucket    = []byte("scripts")
+	boltWatchesBucket    = []byte("watches")
+	boltTransformsBucket = []byte("transforms")
+	boltAPIKeysBucket    = []byte("api_keys")
+	boltClusterBucket    = []byte("cluster")
+	boltSnapshotsBucket  = []byte("snapshots")
+
+	boltSettingsKey = []byte("settings")
+	boltVersionKey  = []byte("version")
+)
+
+// BoltMetadataStore 基于 bbolt 的元数据存储实现
+// 每次修改在单个事务中完成（包括版本号递增），事务提交时落盘，进程崩溃不会留下写了一半的元数据
+type BoltMetadataStore struct {
+	config *MetadataStoreConfig
+	db     *bolt.DB
+	// 已解码的索引元数据缓存（EnableCache 时启用，写入时更新）
+	cache   map[string]*IndexMetadata
+	cacheMu sync.RWMutex
+}
+
+// boltSnapshot 快照内容
+type boltSnapshot struct {
+	Version   int64                                `json:"version"`
+	CreatedAt time.Time                            `json:"created_at"`
+	Indexes   map[string]*IndexMetadata            `json:"indexes"`
+	Tables    map[string]map[string]*TableMetadata `json:"tables"`
+	Scripts   map[string]*StoredScript             `json:"scripts"`
+	Settings  map[string]interface{}               `json:"settings"`
+}
+
+// NewBoltMetadataStore 创建基于 bbolt 的元数据存储，数据库文件位于 FilePath/metadata.db
+func NewBoltMetadataStore(config *MetadataStoreConfig) (*BoltMetadataStore, error) {
+	if config == nil {
+		config = DefaultMetadataStoreConfig()
+	}
+
+	if config.StorageType != "bolt" {
+		return nil, fmt.Errorf("invalid storage type for bolt store: %s", config.StorageType)
+	}
+
+	if config.FilePath == "" {
+		return nil, fmt.Errorf("file path cannot be empty for bolt store")
+	}
+
+	if err := os.MkdirAll(config.FilePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create base directory: %w", err)
+	}
+
+	dbPath := filepath.Join(config.FilePath, BoltMetadataFile)
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metadata database %s: %w", dbPath, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltIndexesBucket, boltTablesBucket, boltHistoryBucket, boltScriptsBucket, boltWatchesBucket, boltTransformsBucket, boltAPIKeysBucket, boltClusterBucket, boltSnapshotsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		cluster := tx.Bucket(boltClusterBucket)
+		if cluster.Get(boltVersionKey) == nil {
+			return putVersion(cluster, 1)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize metadata database: %w", err)
+	}
+
+	return &BoltMetadataStore{
+		config: config,
+		db:     db,
+		cache:  make(map[string]*IndexMetadata),
+	}, nil
+}
+
+func putVersion(cluster *bolt.Bucket, version int64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(version))
+	return cluster.Put(boltVersionKey, buf)
+}
+
+func getVersion(cluster *bolt.Bucket) int64 {
+	v := cluster.Get(boltVersionKey)
+	if len(v) != 8 {
+		return 1
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+// incrementVersion 在事务内递增版本号
+func incrementVersion(tx *bolt.Tx) error {
+	cluster := tx.Bucket(boltClusterBucket)
+	return putVersion(cluster, getVersion(cluster)+1)
+}
+
+// putJSON 在事务内写入 JSON 值并递增版本号
+func putJSON(tx *bolt.Tx, bucket *bolt.Bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := bucket.Put([]byte(key), data); err != nil {
+		return err
+	}
+	return incrementVersion(tx)
+}
+
+// SaveIndexMetadata 保存索引元数据
+func (bms *BoltMetadataStore) SaveIndexMetadata(indexName string, metadata *IndexMetadata) error {
+	err := bms.db.Update(func(tx *bolt.Tx) error {
+		if bms.config.EnableVersioning {
+			if err := recordBoltIndexHistory(tx, indexName, metadata); err != nil {
+				return err
+			}
+		}
+		return putJSON(tx, tx.Bucket(boltIndexesBucket), indexName, metadata)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save index metadata: %w", err)
+	}
+
+	if bms.config.EnableCache {
+		bms.cacheMu.Lock()
+		bms.cache[indexName] = metadata
+		bms.cacheMu.Unlock()
+	}
+	return nil
+}
+
+// SaveIndexMetadataBatch 在单个事务中保存多个索引元数据
+func (bms *BoltMetadataStore) SaveIndexMetadataBatch(metadatas []*IndexMetadata) error {
+	err := bms.db.Update(func(tx *bolt.Tx) error {
+		for _, metadata := range metadatas {
+			if metadata == nil || metadata.Name == "" {
+				return fmt.Errorf("index metadata in batch must have a name")
+			}
+			if bms.config.EnableVersioning {
+				if err := recordBoltIndexHistory(tx, metadata.Name, metadata); err != nil {
+					return err
+				}
+			}
+			if err := putJSON(tx, tx.Bucket(boltIndexesBucket), metadata.Name, metadata); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save index metadata: %w", err)
+	}
+
+	if bms.config.EnableCache {
+		bms.cacheMu.Lock()
+		for _, metadata := range metadatas {
+			bms.cache[metadata.Name] = metadata
+		}
+		bms.cacheMu.Unlock()
+	}
+	return nil
+}
+
+// GetIndexMetadata 获取索引元数据
+func (bms *BoltMetadataStore) GetIndexMetadata(indexName string) (*IndexMetadata, error) {
+	if bms.config.EnableCache {
+		bms.cacheMu.RLock()
+		metadata, exists := bms.cache[indexName]
+		bms.cacheMu.RUnlock()
+		if exists {
+			return metadata, nil
+		}
+	}
+
+	var metadata *IndexMetadata
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltIndexesBucket).Get([]byte(indexName))
+		if data == nil {
+			return nil
+		}
+		metadata = &IndexMetadata{}
+		return json.Unmarshal(data, metadata)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index metadata [%s]: %w", indexName, err)
+	}
+	if metadata == nil {
+		return nil, &MetadataNotFoundError{
+			ResourceType: "index",
+			ResourceName: indexName,
+		}
+	}
+
+	if bms.config.EnableCache {
+		bms.cacheMu.Lock()
+		bms.cache[indexName] = metadata
+		bms.cacheMu.Unlock()
+	}
+	return metadata, nil
+}
+
+// DeleteIndexMetadata 删除索引元数据（同时删除该索引的表元数据）
+func (bms *BoltMetadataStore) DeleteIndexMetadata(indexName string) error {
+	err := bms.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(boltIndexesBucket).Delete([]byte(indexName)); err != nil {
+			return err
+		}
+		for _, name := range [][]byte{boltTablesBucket, boltHistoryBucket} {
+			parent := tx.Bucket(name)
+			if parent.Bucket([]byte(indexName)) != nil {
+				if err := parent.DeleteBucket([]byte(indexName)); err != nil {
+					return err
+				}
+			}
+		}
+		return incrementVersion(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete index metadata: %w", err)
+	}
+
+	bms.cacheMu.Lock()
+	delete(bms.cache, indexName)
+	bms.cacheMu.Unlock()
+	return nil
+}
+
+// ListIndexMetadata 列出所有索引元数据（按索引名称排序）
+func (bms *BoltMetadataStore) ListIndexMetadata() ([]*IndexMetadata, error) {
+	var result []*IndexMetadata
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltIndexesBucket).ForEach(func(k, v []byte) error {
+			metadata := &IndexMetadata{}
+			if err := json.Unmarshal(v, metadata); err != nil {
+				return fmt.Errorf("invalid metadata for index [%s]: %w", k, err)
+			}
+			result = append(result, metadata)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func historyKey(version int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(version))
+	return key
+}
+
+// recordBoltIndexHistory 在保存索引元数据的同一事务中记录历史版本，并清理超出上限的旧版本
+func recordBoltIndexHistory(tx *bolt.Tx, indexName string, metadata *IndexMetadata) error {
+	bucket, err := tx.Bucket(boltHistoryBucket).CreateBucketIfNotExists([]byte(indexName))
+	if err != nil {
+		return err
+	}
+
+	var latest *IndexMetadataVersion
+	if _, v := bucket.Cursor().Last(); v != nil {
+		latest = &IndexMetadataVersion{}
+		if err := json.Unmarshal(v, latest); err != nil {
+			return fmt.Errorf("invalid index metadata history [%s]: %w", indexName, err)
+		}
+	}
+	next, err := nextIndexMetadataVersion(latest, metadata)
+	if err != nil || next == nil {
+		return err
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	if err := bucket.Put(historyKey(next.Version), data); err != nil {
+		return err
+	}
+
+	// 版本号连续递增，保留最新的 MaxIndexMetadataHistory 个版本
+	var expired [][]byte
+	c := bucket.Cursor()
+	for k, _ := c.First(); k != nil && int64(binary.BigEndian.Uint64(k)) <= next.Version-MaxIndexMetadataHistory; k, _ = c.Next() {
+		expired = append(expired, append([]byte(nil), k...))
+	}
+	for _, k := range expired {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListIndexMetadataHistory 列出索引元数据历史版本
+func (bms *BoltMetadataStore) ListIndexMetadataHistory(indexName string) ([]*IndexMetadataVersion, error) {
+	var result []*IndexMetadataVersion
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltHistoryBucket).Bucket([]byte(indexName))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			version := &IndexMetadataVersion{}
+			if err := json.Unmarshal(v, version); err != nil {
+				return fmt.Errorf("invalid index metadata history [%s]: %w", indexName, err)
+			}
+			result = append(result, version)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetIndexMetadataHistory 获取索引元数据的指定历史版本
+func (bms *BoltMetadataStore) GetIndexMetadataHistory(indexName string, version int64) (*IndexMetadataVersion, error) {
+	var result *IndexMetadataVersion
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltHistoryBucket).Bucket([]byte(indexName))
+		if bucket == nil {
+			return nil
+		}
+		data := bucket.Get(historyKey(version))
+		if data == nil {
+			return nil
+		}
+		result = &IndexMetadataVersion{}
+		return json.Unmarshal(data, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, &MetadataNotFoundError{
+			ResourceType: "index version",
+			ResourceName: fmt.Sprintf("%s/%d", indexName, version),
+		}
+	}
+	return result, nil
+}
+
+// SaveTableMetadata 保存表元数据
+func (bms *BoltMetadataStore) SaveTableMetadata(indexName, tableName string, metadata *TableMetadata) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(boltTablesBucket).CreateBucketIfNotExists([]byte(indexName))
+		if err != nil {
+			return err
+		}
+		return putJSON(tx, bucket, tableName, metadata)
+	})
+}
+
+// GetTableMetadata 获取表元数据
+func (bms *BoltMetadataStore) GetTableMetadata(indexName, tableName string) (*TableMetadata, error) {
+	var metadata *TableMetadata
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltTablesBucket).Bucket([]byte(indexName))
+		if bucket == nil {
+			return nil
+		}
+		data := bucket.Get([]byte(tableName))
+		if data == nil {
+			return nil
+		}
+		metadata = &TableMetadata{}
+		return json.Unmarshal(data, metadata)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		return nil, &MetadataNotFoundError{
+			ResourceType: "table",
+			ResourceName: indexName + "/" + tableName,
+		}
+	}
+	return metadata, nil
+}
+
+// DeleteTableMetadata 删除表元数据
+func (bms *BoltMetadataStore) DeleteTableMetadata(indexName, tableName string) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(boltTablesBucket).Bucket([]byte(indexName)); bucket != nil {
+			if err := bucket.Delete([]byte(tableName)); err != nil {
+				return err
+			}
+		}
+		return incrementVersion(tx)
+	})
+}
+
+// ListTableMetadata 列出指定索引的所有表元数据
+func (bms *BoltMetadataStore) ListTableMetadata(indexName string) ([]*TableMetadata, error) {
+	var result []*TableMetadata
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltTablesBucket).Bucket([]byte(indexName))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			metadata := &TableMetadata{}
+			if err := json.Unmarshal(v, metadata); err != nil {
+				return fmt.Errorf("invalid metadata for table [%s/%s]: %w", indexName, k, err)
+			}
+			result = append(result, metadata)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SaveStoredScript 保存存储脚本
+func (bms *BoltMetadataStore) SaveStoredScript(id string, script *StoredScript) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, tx.Bucket(boltScriptsBucket), id, script)
+	})
+}
+
+// GetStoredScript 获取存储脚本
+func (bms *BoltMetadataStore) GetStoredScript(id string) (*StoredScript, error) {
+	var script *StoredScript
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltScriptsBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		script = &StoredScript{}
+		return json.Unmarshal(data, script)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if script == nil {
+		return nil, &MetadataNotFoundError{
+			ResourceType: "script",
+			ResourceName: id,
+		}
+	}
+	return script, nil
+}
+
+// DeleteStoredScript 删除存储脚本
+func (bms *BoltMetadataStore) DeleteStoredScript(id string) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltScriptsBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return &MetadataNotFoundError{
+				ResourceType: "script",
+				ResourceName: id,
+			}
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return incrementVersion(tx)
+	})
+}
+
+// ListStoredScripts 列出所有存储脚本
+func (bms *BoltMetadataStore) ListStoredScripts() ([]*StoredScript, error) {
+	var result []*StoredScript
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltScriptsBucket).ForEach(func(k, v []byte) error {
+			script := &StoredScript{}
+			if err := json.Unmarshal(v, script); err != nil {
+				return fmt.Errorf("invalid stored script [%s]: %w", k, err)
+			}
+			result = append(result, script)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SaveWatch 保存 watch
+func (bms *BoltMetadataStore) SaveWatch(id string, watch *Watch) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, tx.Bucket(boltWatchesBucket), id, watch)
+	})
+}
+
+// GetWatch 获取 watch
+func (bms *BoltMetadataStore) GetWatch(id string) (*Watch, error) {
+	var watch *Watch
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltWatchesBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		watch = &Watch{}
+		return json.Unmarshal(data, watch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if watch == nil {
+		return nil, &MetadataNotFoundError{
+			ResourceType: "watch",
+			ResourceName: id,
+		}
+	}
+	return watch, nil
+}
+
+// DeleteWatch 删除 watch
+func (bms *BoltMetadataStore) DeleteWatch(id string) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltWatchesBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return &MetadataNotFoundError{
+				ResourceType: "watch",
+				ResourceName: id,
+			}
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return incrementVersion(tx)
+	})
+}
+
+// ListWatches 列出所有 watch
+func (bms *BoltMetadataStore) ListWatches() ([]*Watch, error) {
+	var result []*Watch
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltWatchesBucket).ForEach(func(k, v []byte) error {
+			watch := &Watch{}
+			if err := json.Unmarshal(v, watch); err != nil {
+				return fmt.Errorf("invalid watch [%s]: %w", k, err)
+			}
+			result = append(result, watch)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SaveTransform 保存 transform
+func (bms *BoltMetadataStore) SaveTransform(id string, transform *Transform) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, tx.Bucket(boltTransformsBucket), id, transform)
+	})
+}
+
+// GetTransform 获取 transform
+func (bms *BoltMetadataStore) GetTransform(id string) (*Transform, error) {
+	var transform *Transform
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltTransformsBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		transform = &Transform{}
+		return json.Unmarshal(data, transform)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if transform == nil {
+		return nil, &MetadataNotFoundError{
+			ResourceType: "transform",
+			ResourceName: id,
+		}
+	}
+	return transform, nil
+}
+
+// DeleteTransform 删除 transform
+func (bms *BoltMetadataStore) DeleteTransform(id string) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltTransformsBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return &MetadataNotFoundError{
+				ResourceType: "transform",
+				ResourceName: id,
+			}
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return incrementVersion(tx)
+	})
+}
+
+// ListTransforms 列出所有 transform
+func (bms *BoltMetadataStore) ListTransforms() ([]*Transform, error) {
+	var result []*Transform
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltTransformsBucket).ForEach(func(k, v []byte) error {
+			transform := &Transform{}
+			if err := json.Unmarshal(v, transform); err != nil {
+				return fmt.Errorf("invalid transform [%s]: %w", k, err)
+			}
+			result = append(result, transform)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SaveAPIKey 保存 API Key
+func (bms *BoltMetadataStore) SaveAPIKey(key *APIKey) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, tx.Bucket(boltAPIKeysBucket), key.ID, key)
+	})
+}
+
+// ListAPIKeys 列出所有 API Key
+func (bms *BoltMetadataStore) ListAPIKeys() ([]*APIKey, error) {
+	var result []*APIKey
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltAPIKeysBucket).ForEach(func(k, v []byte) error {
+			key := &APIKey{}
+			if err := json.Unmarshal(v, key); err != nil {
+				return fmt.Errorf("invalid api key [%s]: %w", k, err)
+			}
+			result = append(result, key)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SaveClusterSettings 保存集群持久化设置
+func (bms *BoltMetadataStore) SaveClusterSettings(settings map[string]interface{}) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, tx.Bucket(boltClusterBucket), string(boltSettingsKey), settings)
+	})
+}
+
+// GetClusterSettings 获取集群持久化设置
+func (bms *BoltMetadataStore) GetClusterSettings() (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltClusterBucket).Get(boltSettingsKey)
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetLatestVersion 获取最新版本
+func (bms *BoltMetadataStore) GetLatestVersion() (int64, error) {
+	var version int64
+	err := bms.db.View(func(tx *bolt.Tx) error {
+		version = getVersion(tx.Bucket(boltClusterBucket))
+		return nil
+	})
+	return version, err
+}
+
+// CreateSnapshot 创建快照（保存当前所有元数据的完整副本）
+func (bms *BoltMetadataStore) CreateSnapshot(version int64) error {
+	return bms.db.Update(func(tx *bolt.Tx) error {
+		snapshot := &boltSnapshot{
+			Version:   version,
+			CreatedAt: time.Now(),
+			Indexes:   make(map[string]*IndexMetadata),
+			Tables:    make(map[string]map[string]*TableMetadata),
+			Scripts:   make(map[string]*StoredScript),
+			Settings:  make(map[string]interface{}),
+		}
+		err := tx.Bucket(boltIndexesBucket).ForEach(func(k, v []byte) error {
+			metadata := &IndexMetadata{}
+			if err := json.Unmarshal(v, metadata); err != nil {
+				return err
+			}
+			snapshot.Indexes[string(k)] = metadata
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		tables := tx.Bucket(boltTablesBucket)
+		err = tables.ForEachBucket(func(indexName []byte) error {
+			indexTables := make(map[string]*TableMetadata)
+			err := tables.Bucket(indexName).ForEach(func(k, v []byte) error {
+				metadata := &TableMetadata{}
+				if err := json.Unmarshal(v, metadata); err != nil {
+					return err
+				}
+				indexTables[string(k)] = metadata
+				return nil
+			})
+			snapshot.Tables[string(indexName)] = indexTables
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(boltScriptsBucket).ForEach(func(k, v []byte) error {
+			script := &StoredScript{}
+			if err := json.Unmarshal(v, script); err != nil {
+				return err
+			}
+			snapshot.Scripts[string(k)] = script
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if data := tx.Bucket(boltClusterBucket).Get(boltSettingsKey); data != nil {
+			if err := json.Unmarshal(data, &snapshot.Settings); err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltSnapshotsBucket).Put([]byte(fmt.Sprintf("v%d", version)), data)
+	})
+}
+
+// RestoreSnapshot 恢复快照（在单个事务中替换所有元数据）
+func (bms *BoltMetadataStore) RestoreSnapshot(version int64) error {
+	err := bms.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltSnapshotsBucket).Get([]byte(fmt.Sprintf("v%d", version)))
+		if data == nil {
+			return &MetadataNotFoundError{
+				ResourceType: "snapshot",
+				ResourceName: fmt.Sprintf("v%d", version),
+			}
+		}
+		snapshot := &boltSnapshot{}
+		if err := json.Unmarshal(data, snapshot); err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{boltIndexesBucket, boltTablesBucket, boltScriptsBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		for name, metadata := range snapshot.Indexes {
+			if err := putJSON(tx, tx.Bucket(boltIndexesBucket), name, metadata); err != nil {
+				return err
+			}
+		}
+		for indexName, indexTables := range snapshot.Tables {
+			bucket, err := tx.Bucket(boltTablesBucket).CreateBucket([]byte(indexName))
+			if err != nil {
+				return err
+			}
+			for tableName, metadata := range indexTables {
+				if err := putJSON(tx, bucket, tableName, metadata); err != nil {
+					return err
+				}
+			}
+		}
+		for id, script := range snapshot.Scripts {
+			if err := putJSON(tx, tx.Bucket(boltScriptsBucket), id, script); err != nil {
+				return err
+			}
+		}
+		if err := putJSON(tx, tx.Bucket(boltClusterBucket), string(boltSettingsKey), snapshot.Settings); err != nil {
+			return err
+		}
+		return putVersion(tx.Bucket(boltClusterBucket), version)
+	})
+	if err != nil {
+		return err
+	}
+
+	bms.cacheMu.Lock()
+	bms.cache = make(map[string]*IndexMetadata)
+	bms.cacheMu.Unlock()
+	return nil
+}
+
+// Ping 执行一次只读事务，数据库已关闭时返回错误
+func (bms *BoltMetadataStore) Ping() error {
+	return bms.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltClusterBucket) == nil {
+			return fmt.Errorf("metadata bucket [%s] not found", boltClusterBucket)
+		}
+		return nil
+	})
+}
+
+// Close 关闭存储
+func (bms *BoltMetadataStore) Close() error {
+	bms.cacheMu.Lock()
+	bms.cache = make(map[string]*IndexMetadata)
+	bms.cacheMu.Unlock()
+
+	return bms.db.Close()
+}
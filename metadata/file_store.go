@@ -17,9 +17,12 @@ package metadata
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,15 +31,26 @@ import (
 
 // FileMetadataStore 基于文件的元数据存储实现
 type FileMetadataStore struct {
-	config    *MetadataStoreConfig
-	baseDir   string
-	indexes   map[string]*IndexMetadata
-	indexesMu sync.RWMutex
-	tables    map[string]map[string]*TableMetadata // indexName -> tableName -> metadata
-	cache     map[string]interface{}
-	cacheMu   sync.RWMutex
-	version   int64
-	versionMu sync.RWMutex
+	config       *MetadataStoreConfig
+	baseDir      string
+	indexes      map[string]*IndexMetadata
+	indexesMu    sync.RWMutex
+	tables       map[string]map[string]*TableMetadata // indexName -> tableName -> metadata
+	scripts      map[string]*StoredScript
+	scriptsMu    sync.RWMutex
+	watches      map[string]*Watch
+	watchesMu    sync.RWMutex
+	transforms   map[string]*Transform
+	transformsMu sync.RWMutex
+	apiKeys      map[string]*APIKey
+	apiKeysMu    sync.RWMutex
+	settings     map[string]interface{}
+	settingsMu   sync.RWMutex
+	cache        map[string]interface{}
+	cacheMu      sync.RWMutex
+	version      int64
+	versionMu    sync.RWMutex
+	historyMu    sync.Mutex
 }
 
 // NewFileMetadataStore 创建基于文件的元数据存储
@@ -54,12 +68,16 @@ func NewFileMetadataStore(config *MetadataStoreConfig) (*FileMetadataStore, erro
 	}
 
 	store := &FileMetadataStore{
-		config:  config,
-		baseDir: config.FilePath,
-		indexes: make(map[string]*IndexMetadata),
-		tables:  make(map[string]map[string]*TableMetadata),
-		cache:   make(map[string]interface{}),
-		version: 1,
+		config:     config,
+		baseDir:    config.FilePath,
+		indexes:    make(map[string]*IndexMetadata),
+		tables:     make(map[string]map[string]*TableMetadata),
+		scripts:    make(map[string]*StoredScript),
+		watches:    make(map[string]*Watch),
+		transforms: make(map[string]*Transform),
+		apiKeys:    make(map[string]*APIKey),
+		cache:      make(map[string]interface{}),
+		version:    1,
 	}
 
 	// 初始化目录结构
@@ -88,6 +106,12 @@ func (fms *FileMetadataStore) initializeDirectories() error {
 		return fmt.Errorf("failed to create indexes directory: %w", err)
 	}
 
+	// 创建存储脚本目录
+	scriptsDir := filepath.Join(fms.baseDir, "scripts")
+	if err := os.MkdirAll(scriptsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create scripts directory: %w", err)
+	}
+
 	// 创建版本目录
 	versionsDir := filepath.Join(fms.baseDir, "versions")
 	if err := os.MkdirAll(versionsDir, 0755); err != nil {
@@ -128,6 +152,176 @@ func (fms *FileMetadataStore) loadExistingMetadata() error {
 		}
 	}
 
+	// 加载存储脚本
+	if err := fms.loadStoredScripts(); err != nil {
+		return err
+	}
+
+	// 加载 watch
+	if err := fms.loadWatches(); err != nil {
+		return err
+	}
+
+	// 加载 transform
+	if err := fms.loadTransforms(); err != nil {
+		return err
+	}
+
+	// 加载 API Key
+	if err := fms.loadAPIKeys(); err != nil {
+		return err
+	}
+
+	// 加载集群持久化设置
+	return fms.loadClusterSettings()
+}
+
+// clusterSettingsPath 返回集群持久化设置的文件路径
+func (fms *FileMetadataStore) clusterSettingsPath() string {
+	return filepath.Join(fms.baseDir, "cluster_settings.json")
+}
+
+// loadClusterSettings 加载集群持久化设置
+func (fms *FileMetadataStore) loadClusterSettings() error {
+	data, err := os.ReadFile(fms.clusterSettingsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		logger.Warn("Failed to parse cluster settings: %v", err)
+		return nil
+	}
+	fms.settings = settings
+
+	return nil
+}
+
+// loadStoredScripts 加载存储脚本
+func (fms *FileMetadataStore) loadStoredScripts() error {
+	scriptsDir := filepath.Join(fms.baseDir, "scripts")
+	entries, err := os.ReadDir(scriptsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(scriptsDir, entry.Name()))
+		if err != nil {
+			logger.Warn("Failed to read stored script %s: %v", entry.Name(), err)
+			continue
+		}
+		var script StoredScript
+		if err := json.Unmarshal(data, &script); err != nil {
+			logger.Warn("Failed to parse stored script %s: %v", entry.Name(), err)
+			continue
+		}
+		fms.scripts[script.ID] = &script
+	}
+
+	return nil
+}
+
+// loadWatches 加载 watch
+func (fms *FileMetadataStore) loadWatches() error {
+	watchesDir := filepath.Join(fms.baseDir, "watches")
+	entries, err := os.ReadDir(watchesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(watchesDir, entry.Name()))
+		if err != nil {
+			logger.Warn("Failed to read watch %s: %v", entry.Name(), err)
+			continue
+		}
+		var watch Watch
+		if err := json.Unmarshal(data, &watch); err != nil {
+			logger.Warn("Failed to parse watch %s: %v", entry.Name(), err)
+			continue
+		}
+		fms.watches[watch.ID] = &watch
+	}
+
+	return nil
+}
+
+// loadTransforms 加载 transform
+func (fms *FileMetadataStore) loadTransforms() error {
+	transformsDir := filepath.Join(fms.baseDir, "transforms")
+	entries, err := os.ReadDir(transformsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(transformsDir, entry.Name()))
+		if err != nil {
+			logger.Warn("Failed to read transform %s: %v", entry.Name(), err)
+			continue
+		}
+		var transform Transform
+		if err := json.Unmarshal(data, &transform); err != nil {
+			logger.Warn("Failed to parse transform %s: %v", entry.Name(), err)
+			continue
+		}
+		fms.transforms[transform.ID] = &transform
+	}
+
+	return nil
+}
+
+// loadAPIKeys 加载 API Key
+func (fms *FileMetadataStore) loadAPIKeys() error {
+	apiKeysDir := filepath.Join(fms.baseDir, "api_keys")
+	entries, err := os.ReadDir(apiKeysDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(apiKeysDir, entry.Name()))
+		if err != nil {
+			logger.Warn("Failed to read api key %s: %v", entry.Name(), err)
+			continue
+		}
+		var key APIKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			logger.Warn("Failed to parse api key %s: %v", entry.Name(), err)
+			continue
+		}
+		fms.apiKeys[key.ID] = &key
+	}
+
 	return nil
 }
 
@@ -223,8 +417,9 @@ func (fms *FileMetadataStore) SaveIndexMetadata(indexName string, metadata *Inde
 			equalMaps(existingMetadata.Settings, metadata.Settings) &&
 			equalStringSlices(existingMetadata.Aliases, metadata.Aliases) {
 			// 数据没有变化，只更新内存缓存，不保存到文件
+			// 调用方可能直接修改了缓存中的同一个对象，历史版本仍以最新历史记录为准进行比较
 			logger.Debug("SaveIndexMetadata [%s] - No changes detected, skipping file save", indexName)
-			return nil
+			return fms.recordIndexHistory(indexName, metadata)
 		}
 		// 记录变化的原因（用于调试）
 		if existingMetadata.Name != metadata.Name {
@@ -261,9 +456,151 @@ func (fms *FileMetadataStore) SaveIndexMetadata(indexName string, metadata *Inde
 	// 清空相关缓存
 	fms.clearCache(fmt.Sprintf("index_%s", indexName))
 
+	return fms.recordIndexHistory(indexName, metadata)
+}
+
+// SaveIndexMetadataBatch 保存多个索引元数据
+// 文件存储无法跨文件原子提交：任一写入失败时把已写入的索引恢复为之前的元数据（之前不存在的则删除）
+func (fms *FileMetadataStore) SaveIndexMetadataBatch(metadatas []*IndexMetadata) error {
+	previous := make([]*IndexMetadata, len(metadatas))
+	for i, metadata := range metadatas {
+		if metadata == nil || metadata.Name == "" {
+			return fmt.Errorf("index metadata in batch must have a name")
+		}
+		// 从文件重新加载，不使用可能已被调用方修改的缓存对象
+		prev, err := fms.loadIndexMetadata(metadata.Name)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to load index metadata [%s]: %w", metadata.Name, err)
+		}
+		previous[i] = prev
+	}
+
+	for i, metadata := range metadatas {
+		err := fms.SaveIndexMetadata(metadata.Name, metadata)
+		if err == nil {
+			continue
+		}
+		for j := i; j >= 0; j-- {
+			name := metadatas[j].Name
+			var restoreErr error
+			if previous[j] != nil {
+				restoreErr = fms.SaveIndexMetadata(name, previous[j])
+			} else {
+				restoreErr = fms.DeleteIndexMetadata(name)
+			}
+			if restoreErr != nil {
+				logger.Error("SaveIndexMetadataBatch - failed to restore metadata of index [%s]: %v", name, restoreErr)
+			}
+		}
+		return fmt.Errorf("failed to save index metadata [%s]: %w", metadata.Name, err)
+	}
+	return nil
+}
+
+// indexHistoryDir 索引元数据历史目录，每个版本一个 v<N>.json 文件
+func (fms *FileMetadataStore) indexHistoryDir(indexName string) string {
+	return filepath.Join(fms.baseDir, "indexes", indexName, "history")
+}
+
+// recordIndexHistory 启用版本管理时，如果元数据与最新历史版本不同则写入新的历史版本，并清理超出上限的旧版本
+func (fms *FileMetadataStore) recordIndexHistory(indexName string, metadata *IndexMetadata) error {
+	if !fms.config.EnableVersioning {
+		return nil
+	}
+
+	fms.historyMu.Lock()
+	defer fms.historyMu.Unlock()
+
+	history, err := fms.loadIndexHistory(indexName)
+	if err != nil {
+		return err
+	}
+	var latest *IndexMetadataVersion
+	if len(history) > 0 {
+		latest = history[len(history)-1]
+	}
+	next, err := nextIndexMetadataVersion(latest, metadata)
+	if err != nil || next == nil {
+		return err
+	}
+
+	historyDir := fms.indexHistoryDir(indexName)
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	data, err := json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal index metadata history: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(historyDir, fmt.Sprintf("v%d.json", next.Version)), data, 0644); err != nil {
+		return fmt.Errorf("failed to write index metadata history: %w", err)
+	}
+
+	for i := 0; i < len(history)+1-MaxIndexMetadataHistory; i++ {
+		os.Remove(filepath.Join(historyDir, fmt.Sprintf("v%d.json", history[i].Version)))
+	}
 	return nil
 }
 
+// loadIndexHistory 从文件加载索引元数据历史（按版本号升序）
+func (fms *FileMetadataStore) loadIndexHistory(indexName string) ([]*IndexMetadataVersion, error) {
+	historyDir := fms.indexHistoryDir(indexName)
+	entries, err := os.ReadDir(historyDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+
+	var history []*IndexMetadataVersion
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "v") || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(historyDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index metadata history %s: %w", entry.Name(), err)
+		}
+		version := &IndexMetadataVersion{}
+		if err := json.Unmarshal(data, version); err != nil {
+			return nil, fmt.Errorf("failed to parse index metadata history %s: %w", entry.Name(), err)
+		}
+		history = append(history, version)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Version < history[j].Version
+	})
+	return history, nil
+}
+
+// ListIndexMetadataHistory 列出索引元数据历史版本
+func (fms *FileMetadataStore) ListIndexMetadataHistory(indexName string) ([]*IndexMetadataVersion, error) {
+	fms.historyMu.Lock()
+	defer fms.historyMu.Unlock()
+
+	return fms.loadIndexHistory(indexName)
+}
+
+// GetIndexMetadataHistory 获取索引元数据的指定历史版本
+func (fms *FileMetadataStore) GetIndexMetadataHistory(indexName string, version int64) (*IndexMetadataVersion, error) {
+	data, err := os.ReadFile(filepath.Join(fms.indexHistoryDir(indexName), fmt.Sprintf("v%d.json", version)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &MetadataNotFoundError{
+				ResourceType: "index version",
+				ResourceName: fmt.Sprintf("%s/%d", indexName, version),
+			}
+		}
+		return nil, err
+	}
+	result := &IndexMetadataVersion{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("failed to parse index metadata history: %w", err)
+	}
+	return result, nil
+}
+
 // equalMaps 比较两个 map 是否相等（深度比较）
 func equalMaps(m1, m2 map[string]interface{}) bool {
 	if len(m1) != len(m2) {
@@ -671,6 +1008,314 @@ func (fms *FileMetadataStore) ListTableMetadata(indexName string) ([]*TableMetad
 	return result, nil
 }
 
+// storedScriptPath 返回存储脚本的文件路径（ID 经过转义，避免路径穿越）
+func (fms *FileMetadataStore) storedScriptPath(id string) string {
+	return filepath.Join(fms.baseDir, "scripts", url.PathEscape(id)+".json")
+}
+
+// SaveStoredScript 保存存储脚本
+func (fms *FileMetadataStore) SaveStoredScript(id string, script *StoredScript) error {
+	data, err := json.MarshalIndent(script, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fms.scriptsMu.Lock()
+	defer fms.scriptsMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(fms.baseDir, "scripts"), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fms.storedScriptPath(id), data, 0644); err != nil {
+		return err
+	}
+	fms.scripts[id] = script
+
+	// 更新版本
+	fms.incrementVersion()
+
+	return nil
+}
+
+// GetStoredScript 获取存储脚本
+func (fms *FileMetadataStore) GetStoredScript(id string) (*StoredScript, error) {
+	fms.scriptsMu.RLock()
+	defer fms.scriptsMu.RUnlock()
+
+	if script, exists := fms.scripts[id]; exists {
+		return script, nil
+	}
+
+	return nil, &MetadataNotFoundError{
+		ResourceType: "script",
+		ResourceName: id,
+	}
+}
+
+// DeleteStoredScript 删除存储脚本
+func (fms *FileMetadataStore) DeleteStoredScript(id string) error {
+	fms.scriptsMu.Lock()
+	defer fms.scriptsMu.Unlock()
+
+	if _, exists := fms.scripts[id]; !exists {
+		return &MetadataNotFoundError{
+			ResourceType: "script",
+			ResourceName: id,
+		}
+	}
+	if err := os.Remove(fms.storedScriptPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(fms.scripts, id)
+
+	// 更新版本
+	fms.incrementVersion()
+
+	return nil
+}
+
+// ListStoredScripts 列出所有存储脚本
+func (fms *FileMetadataStore) ListStoredScripts() ([]*StoredScript, error) {
+	fms.scriptsMu.RLock()
+	defer fms.scriptsMu.RUnlock()
+
+	var result []*StoredScript
+	for _, script := range fms.scripts {
+		result = append(result, script)
+	}
+
+	return result, nil
+}
+
+// watchPath 返回 watch 的文件路径（ID 经过转义，避免路径穿越）
+func (fms *FileMetadataStore) watchPath(id string) string {
+	return filepath.Join(fms.baseDir, "watches", url.PathEscape(id)+".json")
+}
+
+// SaveWatch 保存 watch
+func (fms *FileMetadataStore) SaveWatch(id string, watch *Watch) error {
+	data, err := json.MarshalIndent(watch, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fms.watchesMu.Lock()
+	defer fms.watchesMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(fms.baseDir, "watches"), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fms.watchPath(id), data, 0644); err != nil {
+		return err
+	}
+	fms.watches[id] = watch
+
+	// 更新版本
+	fms.incrementVersion()
+
+	return nil
+}
+
+// GetWatch 获取 watch
+func (fms *FileMetadataStore) GetWatch(id string) (*Watch, error) {
+	fms.watchesMu.RLock()
+	defer fms.watchesMu.RUnlock()
+
+	if watch, exists := fms.watches[id]; exists {
+		return watch, nil
+	}
+
+	return nil, &MetadataNotFoundError{
+		ResourceType: "watch",
+		ResourceName: id,
+	}
+}
+
+// DeleteWatch 删除 watch
+func (fms *FileMetadataStore) DeleteWatch(id string) error {
+	fms.watchesMu.Lock()
+	defer fms.watchesMu.Unlock()
+
+	if _, exists := fms.watches[id]; !exists {
+		return &MetadataNotFoundError{
+			ResourceType: "watch",
+			ResourceName: id,
+		}
+	}
+	if err := os.Remove(fms.watchPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(fms.watches, id)
+
+	// 更新版本
+	fms.incrementVersion()
+
+	return nil
+}
+
+// ListWatches 列出所有 watch
+func (fms *FileMetadataStore) ListWatches() ([]*Watch, error) {
+	fms.watchesMu.RLock()
+	defer fms.watchesMu.RUnlock()
+
+	var result []*Watch
+	for _, watch := range fms.watches {
+		result = append(result, watch)
+	}
+
+	return result, nil
+}
+
+// transformPath 返回 transform 的文件路径（ID 经过转义，避免路径穿越）
+func (fms *FileMetadataStore) transformPath(id string) string {
+	return filepath.Join(fms.baseDir, "transforms", url.PathEscape(id)+".json")
+}
+
+// SaveTransform 保存 transform
+func (fms *FileMetadataStore) SaveTransform(id string, transform *Transform) error {
+	data, err := json.MarshalIndent(transform, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fms.transformsMu.Lock()
+	defer fms.transformsMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(fms.baseDir, "transforms"), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fms.transformPath(id), data, 0644); err != nil {
+		return err
+	}
+	fms.transforms[id] = transform
+
+	// 更新版本
+	fms.incrementVersion()
+
+	return nil
+}
+
+// GetTransform 获取 transform
+func (fms *FileMetadataStore) GetTransform(id string) (*Transform, error) {
+	fms.transformsMu.RLock()
+	defer fms.transformsMu.RUnlock()
+
+	if transform, exists := fms.transforms[id]; exists {
+		return transform, nil
+	}
+
+	return nil, &MetadataNotFoundError{
+		ResourceType: "transform",
+		ResourceName: id,
+	}
+}
+
+// DeleteTransform 删除 transform
+func (fms *FileMetadataStore) DeleteTransform(id string) error {
+	fms.transformsMu.Lock()
+	defer fms.transformsMu.Unlock()
+
+	if _, exists := fms.transforms[id]; !exists {
+		return &MetadataNotFoundError{
+			ResourceType: "transform",
+			ResourceName: id,
+		}
+	}
+	if err := os.Remove(fms.transformPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(fms.transforms, id)
+
+	// 更新版本
+	fms.incrementVersion()
+
+	return nil
+}
+
+// ListTransforms 列出所有 transform
+func (fms *FileMetadataStore) ListTransforms() ([]*Transform, error) {
+	fms.transformsMu.RLock()
+	defer fms.transformsMu.RUnlock()
+
+	var result []*Transform
+	for _, transform := range fms.transforms {
+		result = append(result, transform)
+	}
+
+	return result, nil
+}
+
+// SaveAPIKey 保存 API Key（ID 经过转义，避免路径穿越）
+func (fms *FileMetadataStore) SaveAPIKey(key *APIKey) error {
+	data, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fms.apiKeysMu.Lock()
+	defer fms.apiKeysMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(fms.baseDir, "api_keys"), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(fms.baseDir, "api_keys", url.PathEscape(key.ID)+".json"), data, 0600); err != nil {
+		return err
+	}
+	fms.apiKeys[key.ID] = key
+
+	// 更新版本
+	fms.incrementVersion()
+
+	return nil
+}
+
+// ListAPIKeys 列出所有 API Key
+func (fms *FileMetadataStore) ListAPIKeys() ([]*APIKey, error) {
+	fms.apiKeysMu.RLock()
+	defer fms.apiKeysMu.RUnlock()
+
+	var result []*APIKey
+	for _, key := range fms.apiKeys {
+		result = append(result, key)
+	}
+
+	return result, nil
+}
+
+// SaveClusterSettings 保存集群持久化设置
+func (fms *FileMetadataStore) SaveClusterSettings(settings map[string]interface{}) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fms.settingsMu.Lock()
+	defer fms.settingsMu.Unlock()
+
+	if err := os.WriteFile(fms.clusterSettingsPath(), data, 0644); err != nil {
+		return err
+	}
+	fms.settings = settings
+
+	// 更新版本
+	fms.incrementVersion()
+
+	return nil
+}
+
+// GetClusterSettings 获取集群持久化设置
+func (fms *FileMetadataStore) GetClusterSettings() (map[string]interface{}, error) {
+	fms.settingsMu.RLock()
+	defer fms.settingsMu.RUnlock()
+
+	result := make(map[string]interface{}, len(fms.settings))
+	for k, v := range fms.settings {
+		result[k] = v
+	}
+
+	return result, nil
+}
+
 // GetLatestVersion 获取最新版本
 func (fms *FileMetadataStore) GetLatestVersion() (int64, error) {
 	fms.versionMu.RLock()
@@ -732,6 +1377,18 @@ func (fms *FileMetadataStore) RestoreSnapshot(version int64) error {
 	return nil
 }
 
+// Ping 检查元数据目录是否可访问
+func (fms *FileMetadataStore) Ping() error {
+	info, err := os.Stat(fms.baseDir)
+	if err != nil {
+		return fmt.Errorf("metadata directory is not accessible: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("metadata path [%s] is not a directory", fms.baseDir)
+	}
+	return nil
+}
+
 // Close 关闭存储
 func (fms *FileMetadataStore) Close() error {
 	// 文件存储不需要特殊的关闭操作
@@ -0,0 +1,112 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// MaxIndexMetadataHistory 每个索引保留的最大历史版本数，超过后丢弃最旧的版本
+const MaxIndexMetadataHistory = 100
+
+// IndexMetadataHistoryStore 索引元数据历史
+// 启用 EnableVersioning 时，SaveIndexMetadata 在 mapping、settings、别名（含别名定义）或父子关系发生变化时记录一个新的历史版本；
+// 删除索引元数据时同时删除其历史
+type IndexMetadataHistoryStore interface {
+	// ListIndexMetadataHistory 按版本号升序返回索引的所有历史版本
+	ListIndexMetadataHistory(indexName string) ([]*IndexMetadataVersion, error)
+	// GetIndexMetadataHistory 获取索引的指定历史版本
+	GetIndexMetadataHistory(indexName string, version int64) (*IndexMetadataVersion, error)
+}
+
+// IndexMetadataVersion 索引元数据的一个历史版本（版本号在每个索引内从 1 开始递增）
+type IndexMetadataVersion struct {
+	Version          int64                       `json:"version"`
+	Mapping          map[string]interface{}      `json:"mapping"`
+	Settings         map[string]interface{}      `json:"settings"`
+	Aliases          []string                    `json:"aliases"`
+	JoinRelations    *JoinRelations              `json:"join_relations,omitempty"`
+	AliasDefinitions map[string]*AliasDefinition `json:"alias_definitions,omitempty"` // 别名定义（filter、路由）
+	CreatedAt        time.Time                   `json:"created_at"`
+}
+
+// indexMetadataContent 参与版本比较的元数据内容
+type indexMetadataContent struct {
+	Mapping          map[string]interface{}      `json:"mapping"`
+	Settings         map[string]interface{}      `json:"settings"`
+	Aliases          []string                    `json:"aliases"`
+	JoinRelations    *JoinRelations              `json:"join_relations,omitempty"`
+	AliasDefinitions map[string]*AliasDefinition `json:"alias_definitions,omitempty"`
+}
+
+// nextIndexMetadataVersion 当 metadata 的内容与 latest 不同时返回下一个历史版本（深拷贝），相同时返回 nil
+// latest 为 nil 表示还没有历史版本
+func nextIndexMetadataVersion(latest *IndexMetadataVersion, metadata *IndexMetadata) (*IndexMetadataVersion, error) {
+	data, err := json.Marshal(indexMetadataContent{
+		Mapping:          metadata.Mapping,
+		Settings:         metadata.Settings,
+		Aliases:          metadata.Aliases,
+		JoinRelations:    metadata.JoinRelations,
+		AliasDefinitions: metadata.AliasDefinitions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	next := &IndexMetadataVersion{Version: 1, CreatedAt: time.Now()}
+	if latest != nil {
+		prev, err := json.Marshal(indexMetadataContent{
+			Mapping:          latest.Mapping,
+			Settings:         latest.Settings,
+			Aliases:          latest.Aliases,
+			JoinRelations:    latest.JoinRelations,
+			AliasDefinitions: latest.AliasDefinitions,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(prev, data) {
+			return nil, nil
+		}
+		next.Version = latest.Version + 1
+	}
+
+	// 通过 JSON 往返深拷贝，调用方之后修改 metadata 不会影响历史版本
+	var content indexMetadataContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+	next.Mapping = content.Mapping
+	next.Settings = content.Settings
+	next.Aliases = content.Aliases
+	next.JoinRelations = content.JoinRelations
+	next.AliasDefinitions = content.AliasDefinitions
+	return next, nil
+}
+
+// clone 深拷贝历史版本
+func (v *IndexMetadataVersion) clone() *IndexMetadataVersion {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	result := &IndexMetadataVersion{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return v
+	}
+	return result
+}
@@ -15,17 +15,24 @@
 package metadata
 
 import (
+	"fmt"
 	"sync"
 )
 
 // MemoryMetadataStore 基于内存的元数据存储实现
 type MemoryMetadataStore struct {
-	config    *MetadataStoreConfig
-	indexes   map[string]*IndexMetadata
-	tables    map[string]map[string]*TableMetadata // indexName -> tableName -> metadata
-	version   int64
-	mu        sync.RWMutex
-	versionMu sync.RWMutex
+	config     *MetadataStoreConfig
+	indexes    map[string]*IndexMetadata
+	tables     map[string]map[string]*TableMetadata // indexName -> tableName -> metadata
+	scripts    map[string]*StoredScript
+	watches    map[string]*Watch
+	transforms map[string]*Transform
+	apiKeys    map[string]*APIKey
+	settings   map[string]interface{}
+	history    map[string][]*IndexMetadataVersion // indexName -> 历史版本（升序）
+	version    int64
+	mu         sync.RWMutex
+	versionMu  sync.RWMutex
 }
 
 // NewMemoryMetadataStore 创建基于内存的元数据存储
@@ -39,10 +46,15 @@ func NewMemoryMetadataStore(config *MetadataStoreConfig) (*MemoryMetadataStore,
 	}
 
 	return &MemoryMetadataStore{
-		config:  config,
-		indexes: make(map[string]*IndexMetadata),
-		tables:  make(map[string]map[string]*TableMetadata),
-		version: 1,
+		config:     config,
+		indexes:    make(map[string]*IndexMetadata),
+		tables:     make(map[string]map[string]*TableMetadata),
+		scripts:    make(map[string]*StoredScript),
+		watches:    make(map[string]*Watch),
+		transforms: make(map[string]*Transform),
+		apiKeys:    make(map[string]*APIKey),
+		history:    make(map[string][]*IndexMetadataVersion),
+		version:    1,
 	}, nil
 }
 
@@ -51,6 +63,51 @@ func (mms *MemoryMetadataStore) SaveIndexMetadata(indexName string, metadata *In
 	mms.mu.Lock()
 	defer mms.mu.Unlock()
 
+	return mms.saveIndexMetadataLocked(indexName, metadata)
+}
+
+// SaveIndexMetadataBatch 原子地保存多个索引元数据（在同一把锁内完成）
+func (mms *MemoryMetadataStore) SaveIndexMetadataBatch(metadatas []*IndexMetadata) error {
+	mms.mu.Lock()
+	defer mms.mu.Unlock()
+
+	// 先计算所有历史版本，避免部分写入
+	for _, metadata := range metadatas {
+		if metadata == nil || metadata.Name == "" {
+			return fmt.Errorf("index metadata in batch must have a name")
+		}
+		if _, err := nextIndexMetadataVersion(nil, metadata); err != nil {
+			return fmt.Errorf("failed to record index metadata history: %w", err)
+		}
+	}
+	for _, metadata := range metadatas {
+		if err := mms.saveIndexMetadataLocked(metadata.Name, metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mms *MemoryMetadataStore) saveIndexMetadataLocked(indexName string, metadata *IndexMetadata) error {
+	if mms.config.EnableVersioning {
+		history := mms.history[indexName]
+		var latest *IndexMetadataVersion
+		if len(history) > 0 {
+			latest = history[len(history)-1]
+		}
+		next, err := nextIndexMetadataVersion(latest, metadata)
+		if err != nil {
+			return fmt.Errorf("failed to record index metadata history: %w", err)
+		}
+		if next != nil {
+			history = append(history, next)
+			if len(history) > MaxIndexMetadataHistory {
+				history = history[len(history)-MaxIndexMetadataHistory:]
+			}
+			mms.history[indexName] = history
+		}
+	}
+
 	mms.indexes[indexName] = metadata
 	mms.incrementVersion()
 
@@ -79,6 +136,7 @@ func (mms *MemoryMetadataStore) DeleteIndexMetadata(indexName string) error {
 
 	delete(mms.indexes, indexName)
 	delete(mms.tables, indexName)
+	delete(mms.history, indexName)
 	mms.incrementVersion()
 
 	return nil
@@ -97,6 +155,35 @@ func (mms *MemoryMetadataStore) ListIndexMetadata() ([]*IndexMetadata, error) {
 	return result, nil
 }
 
+// ListIndexMetadataHistory 列出索引元数据历史版本
+func (mms *MemoryMetadataStore) ListIndexMetadataHistory(indexName string) ([]*IndexMetadataVersion, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	// 返回深拷贝，调用方修改返回值不会影响历史版本
+	result := make([]*IndexMetadataVersion, 0, len(mms.history[indexName]))
+	for _, v := range mms.history[indexName] {
+		result = append(result, v.clone())
+	}
+	return result, nil
+}
+
+// GetIndexMetadataHistory 获取索引元数据的指定历史版本
+func (mms *MemoryMetadataStore) GetIndexMetadataHistory(indexName string, version int64) (*IndexMetadataVersion, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	for _, v := range mms.history[indexName] {
+		if v.Version == version {
+			return v.clone(), nil
+		}
+	}
+	return nil, &MetadataNotFoundError{
+		ResourceType: "index version",
+		ResourceName: fmt.Sprintf("%s/%d", indexName, version),
+	}
+}
+
 // SaveTableMetadata 保存表元数据
 func (mms *MemoryMetadataStore) SaveTableMetadata(indexName, tableName string, metadata *TableMetadata) error {
 	mms.mu.Lock()
@@ -157,6 +244,222 @@ func (mms *MemoryMetadataStore) ListTableMetadata(indexName string) ([]*TableMet
 	return result, nil
 }
 
+// SaveStoredScript 保存存储脚本
+func (mms *MemoryMetadataStore) SaveStoredScript(id string, script *StoredScript) error {
+	mms.mu.Lock()
+	defer mms.mu.Unlock()
+
+	mms.scripts[id] = script
+	mms.incrementVersion()
+
+	return nil
+}
+
+// GetStoredScript 获取存储脚本
+func (mms *MemoryMetadataStore) GetStoredScript(id string) (*StoredScript, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	if script, exists := mms.scripts[id]; exists {
+		return script, nil
+	}
+
+	return nil, &MetadataNotFoundError{
+		ResourceType: "script",
+		ResourceName: id,
+	}
+}
+
+// DeleteStoredScript 删除存储脚本
+func (mms *MemoryMetadataStore) DeleteStoredScript(id string) error {
+	mms.mu.Lock()
+	defer mms.mu.Unlock()
+
+	if _, exists := mms.scripts[id]; !exists {
+		return &MetadataNotFoundError{
+			ResourceType: "script",
+			ResourceName: id,
+		}
+	}
+	delete(mms.scripts, id)
+	mms.incrementVersion()
+
+	return nil
+}
+
+// ListStoredScripts 列出所有存储脚本
+func (mms *MemoryMetadataStore) ListStoredScripts() ([]*StoredScript, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	var result []*StoredScript
+	for _, script := range mms.scripts {
+		result = append(result, script)
+	}
+
+	return result, nil
+}
+
+// SaveWatch 保存 watch
+func (mms *MemoryMetadataStore) SaveWatch(id string, watch *Watch) error {
+	mms.mu.Lock()
+	defer mms.mu.Unlock()
+
+	mms.watches[id] = watch
+	mms.incrementVersion()
+
+	return nil
+}
+
+// GetWatch 获取 watch
+func (mms *MemoryMetadataStore) GetWatch(id string) (*Watch, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	if watch, exists := mms.watches[id]; exists {
+		return watch, nil
+	}
+
+	return nil, &MetadataNotFoundError{
+		ResourceType: "watch",
+		ResourceName: id,
+	}
+}
+
+// DeleteWatch 删除 watch
+func (mms *MemoryMetadataStore) DeleteWatch(id string) error {
+	mms.mu.Lock()
+	defer mms.mu.Unlock()
+
+	if _, exists := mms.watches[id]; !exists {
+		return &MetadataNotFoundError{
+			ResourceType: "watch",
+			ResourceName: id,
+		}
+	}
+	delete(mms.watches, id)
+	mms.incrementVersion()
+
+	return nil
+}
+
+// ListWatches 列出所有 watch
+func (mms *MemoryMetadataStore) ListWatches() ([]*Watch, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	var result []*Watch
+	for _, watch := range mms.watches {
+		result = append(result, watch)
+	}
+
+	return result, nil
+}
+
+// SaveTransform 保存 transform
+func (mms *MemoryMetadataStore) SaveTransform(id string, transform *Transform) error {
+	mms.mu.Lock()
+	defer mms.mu.Unlock()
+
+	mms.transforms[id] = transform
+	mms.incrementVersion()
+
+	return nil
+}
+
+// GetTransform 获取 transform
+func (mms *MemoryMetadataStore) GetTransform(id string) (*Transform, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	if transform, exists := mms.transforms[id]; exists {
+		return transform, nil
+	}
+
+	return nil, &MetadataNotFoundError{
+		ResourceType: "transform",
+		ResourceName: id,
+	}
+}
+
+// DeleteTransform 删除 transform
+func (mms *MemoryMetadataStore) DeleteTransform(id string) error {
+	mms.mu.Lock()
+	defer mms.mu.Unlock()
+
+	if _, exists := mms.transforms[id]; !exists {
+		return &MetadataNotFoundError{
+			ResourceType: "transform",
+			ResourceName: id,
+		}
+	}
+	delete(mms.transforms, id)
+	mms.incrementVersion()
+
+	return nil
+}
+
+// ListTransforms 列出所有 transform
+func (mms *MemoryMetadataStore) ListTransforms() ([]*Transform, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	var result []*Transform
+	for _, transform := range mms.transforms {
+		result = append(result, transform)
+	}
+
+	return result, nil
+}
+
+// SaveAPIKey 保存 API Key
+func (mms *MemoryMetadataStore) SaveAPIKey(key *APIKey) error {
+	mms.mu.Lock()
+	defer mms.mu.Unlock()
+
+	mms.apiKeys[key.ID] = key
+	mms.incrementVersion()
+
+	return nil
+}
+
+// ListAPIKeys 列出所有 API Key
+func (mms *MemoryMetadataStore) ListAPIKeys() ([]*APIKey, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	var result []*APIKey
+	for _, key := range mms.apiKeys {
+		result = append(result, key)
+	}
+
+	return result, nil
+}
+
+// SaveClusterSettings 保存集群持久化设置
+func (mms *MemoryMetadataStore) SaveClusterSettings(settings map[string]interface{}) error {
+	mms.mu.Lock()
+	defer mms.mu.Unlock()
+
+	mms.settings = settings
+	mms.incrementVersion()
+
+	return nil
+}
+
+// GetClusterSettings 获取集群持久化设置
+func (mms *MemoryMetadataStore) GetClusterSettings() (map[string]interface{}, error) {
+	mms.mu.RLock()
+	defer mms.mu.RUnlock()
+
+	result := make(map[string]interface{}, len(mms.settings))
+	for k, v := range mms.settings {
+		result[k] = v
+	}
+
+	return result, nil
+}
+
 // GetLatestVersion 获取最新版本
 func (mms *MemoryMetadataStore) GetLatestVersion() (int64, error) {
 	mms.versionMu.RLock()
@@ -184,6 +487,11 @@ func (mms *MemoryMetadataStore) RestoreSnapshot(version int64) error {
 	}
 }
 
+// Ping 内存存储总是可访问
+func (mms *MemoryMetadataStore) Ping() error {
+	return nil
+}
+
 // Close 关闭存储
 func (mms *MemoryMetadataStore) Close() error {
 	mms.mu.Lock()
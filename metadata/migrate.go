@@ -0,0 +1,115 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+)
+
+// MigrationStats 元数据迁移统计
+type MigrationStats struct {
+	Indexes         int `json:"indexes"`
+	Tables          int `json:"tables"`
+	Scripts         int `json:"scripts"`
+	Watches         int `json:"watches"`
+	Transforms      int `json:"transforms"`
+	APIKeys         int `json:"api_keys"`
+	ClusterSettings int `json:"cluster_settings"`
+}
+
+// Migrate 把 src 中的所有元数据（索引、表、存储脚本、watch、transform、API Key、集群持久化设置）复制到 dst
+// dst 中已存在的同名条目会被覆盖，src 不做任何修改
+func Migrate(src, dst MetadataStore) (*MigrationStats, error) {
+	stats := &MigrationStats{}
+
+	indexes, err := src.ListIndexMetadata()
+	if err != nil {
+		return stats, fmt.Errorf("failed to list index metadata: %w", err)
+	}
+	for _, index := range indexes {
+		if err := dst.SaveIndexMetadata(index.Name, index); err != nil {
+			return stats, fmt.Errorf("failed to migrate index [%s]: %w", index.Name, err)
+		}
+		stats.Indexes++
+
+		tables, err := src.ListTableMetadata(index.Name)
+		if err != nil {
+			return stats, fmt.Errorf("failed to list tables of index [%s]: %w", index.Name, err)
+		}
+		for _, table := range tables {
+			if err := dst.SaveTableMetadata(index.Name, table.Name, table); err != nil {
+				return stats, fmt.Errorf("failed to migrate table [%s/%s]: %w", index.Name, table.Name, err)
+			}
+			stats.Tables++
+		}
+	}
+
+	scripts, err := src.ListStoredScripts()
+	if err != nil {
+		return stats, fmt.Errorf("failed to list stored scripts: %w", err)
+	}
+	for _, script := range scripts {
+		if err := dst.SaveStoredScript(script.ID, script); err != nil {
+			return stats, fmt.Errorf("failed to migrate stored script [%s]: %w", script.ID, err)
+		}
+		stats.Scripts++
+	}
+
+	watches, err := src.ListWatches()
+	if err != nil {
+		return stats, fmt.Errorf("failed to list watches: %w", err)
+	}
+	for _, watch := range watches {
+		if err := dst.SaveWatch(watch.ID, watch); err != nil {
+			return stats, fmt.Errorf("failed to migrate watch [%s]: %w", watch.ID, err)
+		}
+		stats.Watches++
+	}
+
+	transforms, err := src.ListTransforms()
+	if err != nil {
+		return stats, fmt.Errorf("failed to list transforms: %w", err)
+	}
+	for _, transform := range transforms {
+		if err := dst.SaveTransform(transform.ID, transform); err != nil {
+			return stats, fmt.Errorf("failed to migrate transform [%s]: %w", transform.ID, err)
+		}
+		stats.Transforms++
+	}
+
+	apiKeys, err := src.ListAPIKeys()
+	if err != nil {
+		return stats, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	for _, key := range apiKeys {
+		if err := dst.SaveAPIKey(key); err != nil {
+			return stats, fmt.Errorf("failed to migrate api key [%s]: %w", key.ID, err)
+		}
+		stats.APIKeys++
+	}
+
+	settings, err := src.GetClusterSettings()
+	if err != nil {
+		return stats, fmt.Errorf("failed to get cluster settings: %w", err)
+	}
+	if len(settings) > 0 {
+		if err := dst.SaveClusterSettings(settings); err != nil {
+			return stats, fmt.Errorf("failed to migrate cluster settings: %w", err)
+		}
+		stats.ClusterSettings = len(settings)
+	}
+
+	return stats, nil
+}
@@ -27,22 +27,81 @@ type TableMetadataStore interface {
 	ListTableMetadata(indexName string) ([]*TableMetadata, error)
 }
 
+// StoredScriptStore 存储脚本接口（search template、painless 脚本）
+type StoredScriptStore interface {
+	SaveStoredScript(id string, script *StoredScript) error
+	GetStoredScript(id string) (*StoredScript, error)
+	DeleteStoredScript(id string) error
+	ListStoredScripts() ([]*StoredScript, error)
+}
+
+// ClusterSettingsStore 集群持久化设置接口（PUT /_cluster/settings 的 persistent 部分）
+type ClusterSettingsStore interface {
+	SaveClusterSettings(settings map[string]interface{}) error
+	GetClusterSettings() (map[string]interface{}, error)
+}
+
+// WatchStore watch 存储接口（_watcher API 的告警定义与执行状态）
+type WatchStore interface {
+	SaveWatch(id string, watch *Watch) error
+	GetWatch(id string) (*Watch, error)
+	DeleteWatch(id string) error
+	ListWatches() ([]*Watch, error)
+}
+
+// TransformStore transform 存储接口（_transform API 的作业配置与检查点）
+type TransformStore interface {
+	SaveTransform(id string, transform *Transform) error
+	GetTransform(id string) (*Transform, error)
+	DeleteTransform(id string) error
+	ListTransforms() ([]*Transform, error)
+}
+
+// APIKeyStore API Key 存储接口（_security/api_key 创建的 Key 与撤销记录）
+type APIKeyStore interface {
+	SaveAPIKey(key *APIKey) error
+	ListAPIKeys() ([]*APIKey, error)
+}
+
 // MetadataStore 元数据存储接口
 type MetadataStore interface {
 	// 索引元数据操作
 	SaveIndexMetadata(indexName string, metadata *IndexMetadata) error
+	// SaveIndexMetadataBatch 原子地保存多个索引的元数据（以 metadata.Name 为索引名），全部成功或全部不生效
+	SaveIndexMetadataBatch(metadatas []*IndexMetadata) error
 	GetIndexMetadata(indexName string) (*IndexMetadata, error)
 	DeleteIndexMetadata(indexName string) error
 	ListIndexMetadata() ([]*IndexMetadata, error)
 
+	// 索引元数据历史
+	IndexMetadataHistoryStore
+
 	// 表元数据操作
 	TableMetadataStore
 
+	// 存储脚本操作
+	StoredScriptStore
+
+	// 集群设置操作
+	ClusterSettingsStore
+
+	// watch 操作
+	WatchStore
+
+	// transform 操作
+	TransformStore
+
+	// API Key 操作
+	APIKeyStore
+
 	// 版本管理
 	GetLatestVersion() (int64, error)
 	CreateSnapshot(version int64) error
 	RestoreSnapshot(version int64) error
 
+	// Ping 检查存储是否可访问（就绪检查使用）
+	Ping() error
+
 	// 关闭存储
 	Close() error
 }
@@ -54,9 +113,19 @@ type IndexMetadata struct {
 	Settings      map[string]interface{} `json:"settings"`       // 索引设置
 	Aliases       []string               `json:"aliases"`        // 索引别名
 	JoinRelations *JoinRelations         `json:"join_relations"` // 父子文档关系定义
-	Version       int64                  `json:"version"`
-	CreatedAt     time.Time              `json:"created_at"`
-	UpdatedAt     time.Time              `json:"updated_at"`
+	// 别名的过滤条件和路由（别名 -> 定义），只记录有定义的别名
+	AliasDefinitions map[string]*AliasDefinition `json:"alias_definitions,omitempty"`
+	Version          int64                       `json:"version"`
+	CreatedAt        time.Time                   `json:"created_at"`
+	UpdatedAt        time.Time                   `json:"updated_at"`
+}
+
+// AliasDefinition 别名定义
+// 通过带 filter 的别名搜索时，filter 会与查询做 AND；单分片模式下路由只会被保存并原样返回，不影响文档分布
+type AliasDefinition struct {
+	Filter        map[string]interface{} `json:"filter,omitempty"`
+	IndexRouting  string                 `json:"index_routing,omitempty"`
+	SearchRouting string                 `json:"search_routing,omitempty"`
 }
 
 // JoinRelations 父子文档关系定义
@@ -109,6 +178,78 @@ func (jr *JoinRelations) IsChildType(typeName string) (bool, string) {
 	return false, ""
 }
 
+// StoredScript 存储的脚本
+type StoredScript struct {
+	ID        string            `json:"id"`
+	Lang      string            `json:"lang"`   // mustache（search template）或 painless
+	Source    string            `json:"source"` // 脚本源码；对象形式的模板会序列化为 JSON 字符串
+	Options   map[string]string `json:"options,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Watch 告警 watch：Source 为 PUT 请求体原文，Status 随每次执行更新；
+// Tenant 为创建 watch 的租户，执行时 input 与 index action 的索引名按该租户加前缀
+type Watch struct {
+	ID        string                 `json:"id"`
+	Tenant    string                 `json:"tenant,omitempty"`
+	Source    map[string]interface{} `json:"source"`
+	Status    *WatchStatus           `json:"status"`
+	Version   int64                  `json:"version"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// WatchStatus watch 的激活状态与最近一次执行的结果
+type WatchStatus struct {
+	Active           bool                          `json:"active"`
+	StateTimestamp   time.Time                     `json:"state_timestamp"`
+	LastChecked      *time.Time                    `json:"last_checked,omitempty"`
+	LastMetCondition *time.Time                    `json:"last_met_condition,omitempty"`
+	ExecutionState   string                        `json:"execution_state,omitempty"`
+	Actions          map[string]*WatchActionStatus `json:"actions,omitempty"`
+}
+
+// WatchActionStatus watch 中单个 action 的执行记录（用于 throttle_period 限流）
+type WatchActionStatus struct {
+	LastExecution           *time.Time `json:"last_execution,omitempty"`
+	LastExecutionSuccessful bool       `json:"last_execution_successful"`
+	LastExecutionReason     string     `json:"last_execution_reason,omitempty"`
+	LastSuccessfulExecution *time.Time `json:"last_successful_execution,omitempty"`
+	LastThrottle            *time.Time `json:"last_throttle,omitempty"`
+	LastThrottleReason      string     `json:"last_throttle_reason,omitempty"`
+}
+
+// Transform transform 作业：Config 为 PUT 请求体原文，State 为启动状态与最近一次完成的检查点
+type Transform struct {
+	ID        string                 `json:"id"`
+	Config    map[string]interface{} `json:"config"`
+	State     *TransformState        `json:"state"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// TransformState transform 的启动状态与检查点（重启后从这里恢复）
+type TransformState struct {
+	Started             bool       `json:"started"`
+	Checkpoint          int64      `json:"checkpoint"`
+	CheckpointTimestamp *time.Time `json:"checkpoint_timestamp,omitempty"`
+	TimeUpperBound      *time.Time `json:"time_upper_bound,omitempty"` // 连续模式下已处理到的同步字段上界（不含）
+	ChangesLastDetected *time.Time `json:"changes_last_detected,omitempty"`
+}
+
+// APIKey 通过 API 创建的 API Key（只保存 Key 的 SHA-256 摘要）或配置文件中 Key 的撤销记录（KeyHash 为空）
+type APIKey struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	KeyHash      string     `json:"key_hash,omitempty"`
+	Roles        []string   `json:"roles,omitempty"`
+	RateLimitRPM int        `json:"rate_limit_rpm,omitempty"`
+	Expiration   *time.Time `json:"expiration,omitempty"`
+	Invalidated  bool       `json:"invalidated"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
 // TableMetadata 表元数据
 type TableMetadata struct {
 	Name        string             `json:"name"`
@@ -333,9 +474,9 @@ func (ti *TableIndex) Validate() error {
 
 // MetadataStoreConfig 元数据存储配置
 type MetadataStoreConfig struct {
-	// 存储类型：file, memory, database
+	// 存储类型：file, bolt, memory
 	StorageType string
-	// 文件存储路径（当StorageType为file时）
+	// 存储路径（当StorageType为file或bolt时；bolt 的数据库文件为 FilePath/metadata.db）
 	FilePath string
 	// 是否启用缓存
 	EnableCache bool
@@ -364,6 +505,8 @@ func NewMetadataStore(config *MetadataStoreConfig) (MetadataStore, error) {
 	switch config.StorageType {
 	case "file":
 		return NewFileMetadataStore(config)
+	case "bolt":
+		return NewBoltMetadataStore(config)
 	case "memory":
 		return NewMemoryMetadataStore(config)
 	default:
@@ -516,3 +516,632 @@ func TestMemoryMetadataStore_RestoreSnapshot(t *testing.T) {
 		t.Fatalf("Expected UnsupportedOperationError, got %T", err)
 	}
 }
+
+func TestFileMetadataStore_StoredScripts(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := &metadata.MetadataStoreConfig{
+		StorageType: "file",
+		FilePath:    tempDir,
+		EnableCache: true,
+	}
+
+	store, err := metadata.NewMetadataStore(config)
+	if err != nil {
+		t.Fatalf("Failed to create file metadata store: %v", err)
+	}
+
+	script := &metadata.StoredScript{
+		ID:        "my/template",
+		Lang:      "mustache",
+		Source:    `{"query":{"match":{"title":"{{q}}"}}}`,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := store.SaveStoredScript(script.ID, script); err != nil {
+		t.Fatalf("Failed to save stored script: %v", err)
+	}
+	store.Close()
+
+	// 重新打开，验证脚本已持久化
+	store, err = metadata.NewMetadataStore(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen file metadata store: %v", err)
+	}
+	defer store.Close()
+
+	loaded, err := store.GetStoredScript(script.ID)
+	if err != nil {
+		t.Fatalf("Failed to get stored script: %v", err)
+	}
+	if loaded.Lang != script.Lang || loaded.Source != script.Source {
+		t.Errorf("Stored script mismatch: %+v", loaded)
+	}
+	if scripts, _ := store.ListStoredScripts(); len(scripts) != 1 {
+		t.Errorf("Expected 1 stored script, got %d", len(scripts))
+	}
+
+	if err := store.DeleteStoredScript(script.ID); err != nil {
+		t.Fatalf("Failed to delete stored script: %v", err)
+	}
+	if _, err := store.GetStoredScript(script.ID); err == nil {
+		t.Error("Expected error for deleted stored script")
+	}
+	if _, ok := store.DeleteStoredScript(script.ID).(*metadata.MetadataNotFoundError); !ok {
+		t.Error("Expected MetadataNotFoundError when deleting a missing stored script")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "scripts")); err != nil {
+		t.Errorf("Expected scripts directory to exist: %v", err)
+	}
+}
+
+func TestMetadataStore_Watches(t *testing.T) {
+	for _, storageType := range []string{"file", "bolt", "memory"} {
+		t.Run(storageType, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			config := &metadata.MetadataStoreConfig{StorageType: storageType, FilePath: tempDir}
+			store, err := metadata.NewMetadataStore(config)
+			if err != nil {
+				t.Fatalf("Failed to create metadata store: %v", err)
+			}
+
+			now := time.Now().UTC().Truncate(time.Second)
+			watch := &metadata.Watch{
+				ID:     "cpu/high",
+				Source: map[string]interface{}{"trigger": map[string]interface{}{"schedule": map[string]interface{}{"interval": "10s"}}},
+				Status: &metadata.WatchStatus{
+					Active:         true,
+					StateTimestamp: now,
+					LastChecked:    &now,
+					Actions:        map[string]*metadata.WatchActionStatus{"log": {LastExecution: &now, LastExecutionSuccessful: true}},
+				},
+				Version:   1,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if err := store.SaveWatch(watch.ID, watch); err != nil {
+				t.Fatalf("Failed to save watch: %v", err)
+			}
+
+			// 持久化存储重新打开后 watch 仍然存在
+			if storageType != "memory" {
+				store.Close()
+				store, err = metadata.NewMetadataStore(config)
+				if err != nil {
+					t.Fatalf("Failed to reopen metadata store: %v", err)
+				}
+			}
+			defer store.Close()
+
+			loaded, err := store.GetWatch(watch.ID)
+			if err != nil {
+				t.Fatalf("Failed to get watch: %v", err)
+			}
+			if !loaded.Status.Active || !loaded.Status.LastChecked.Equal(now) ||
+				!loaded.Status.Actions["log"].LastExecutionSuccessful || loaded.Source["trigger"] == nil {
+				t.Errorf("Watch mismatch: %+v", loaded)
+			}
+			if watches, _ := store.ListWatches(); len(watches) != 1 {
+				t.Errorf("Expected 1 watch, got %d", len(watches))
+			}
+
+			if err := store.DeleteWatch(watch.ID); err != nil {
+				t.Fatalf("Failed to delete watch: %v", err)
+			}
+			if _, ok := store.DeleteWatch(watch.ID).(*metadata.MetadataNotFoundError); !ok {
+				t.Error("Expected MetadataNotFoundError when deleting a missing watch")
+			}
+			if _, err := store.GetWatch(watch.ID); err == nil {
+				t.Error("Expected error for deleted watch")
+			}
+		})
+	}
+}
+
+func TestMetadataStore_Transforms(t *testing.T) {
+	for _, storageType := range []string{"file", "bolt", "memory"} {
+		t.Run(storageType, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			config := &metadata.MetadataStoreConfig{StorageType: storageType, FilePath: tempDir}
+			store, err := metadata.NewMetadataStore(config)
+			if err != nil {
+				t.Fatalf("Failed to create metadata store: %v", err)
+			}
+
+			now := time.Now().UTC().Truncate(time.Second)
+			transform := &metadata.Transform{
+				ID:        "orders-by-customer",
+				Config:    map[string]interface{}{"source": map[string]interface{}{"index": "orders"}},
+				State:     &metadata.TransformState{Started: true, Checkpoint: 3, TimeUpperBound: &now},
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if err := store.SaveTransform(transform.ID, transform); err != nil {
+				t.Fatalf("Failed to save transform: %v", err)
+			}
+
+			// 持久化存储重新打开后 transform 仍然存在
+			if storageType != "memory" {
+				store.Close()
+				store, err = metadata.NewMetadataStore(config)
+				if err != nil {
+					t.Fatalf("Failed to reopen metadata store: %v", err)
+				}
+			}
+			defer store.Close()
+
+			loaded, err := store.GetTransform(transform.ID)
+			if err != nil {
+				t.Fatalf("Failed to get transform: %v", err)
+			}
+			if !loaded.State.Started || loaded.State.Checkpoint != 3 || !loaded.State.TimeUpperBound.Equal(now) || loaded.Config["source"] == nil {
+				t.Errorf("Transform mismatch: %+v", loaded)
+			}
+			if transforms, _ := store.ListTransforms(); len(transforms) != 1 {
+				t.Errorf("Expected 1 transform, got %d", len(transforms))
+			}
+
+			if err := store.DeleteTransform(transform.ID); err != nil {
+				t.Fatalf("Failed to delete transform: %v", err)
+			}
+			if _, ok := store.DeleteTransform(transform.ID).(*metadata.MetadataNotFoundError); !ok {
+				t.Error("Expected MetadataNotFoundError when deleting a missing transform")
+			}
+			if _, err := store.GetTransform(transform.ID); err == nil {
+				t.Error("Expected error for deleted transform")
+			}
+		})
+	}
+}
+
+func TestMetadataStore_APIKeys(t *testing.T) {
+	for _, storageType := range []string{"file", "bolt", "memory"} {
+		t.Run(storageType, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			config := &metadata.MetadataStoreConfig{StorageType: storageType, FilePath: tempDir}
+			store, err := metadata.NewMetadataStore(config)
+			if err != nil {
+				t.Fatalf("Failed to create metadata store: %v", err)
+			}
+
+			expiration := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+			key := &metadata.APIKey{
+				ID:           "k1",
+				Name:         "ingest",
+				KeyHash:      "abc",
+				Roles:        []string{"writer"},
+				RateLimitRPM: 60,
+				Expiration:   &expiration,
+				CreatedAt:    time.Now().UTC(),
+			}
+			if err := store.SaveAPIKey(key); err != nil {
+				t.Fatalf("Failed to save api key: %v", err)
+			}
+			if err := store.SaveAPIKey(&metadata.APIKey{ID: "config-key", Invalidated: true}); err != nil {
+				t.Fatalf("Failed to save api key invalidation: %v", err)
+			}
+
+			// 持久化存储重新打开后 API Key 仍然存在
+			if storageType != "memory" {
+				store.Close()
+				store, err = metadata.NewMetadataStore(config)
+				if err != nil {
+					t.Fatalf("Failed to reopen metadata store: %v", err)
+				}
+			}
+			defer store.Close()
+
+			keys, err := store.ListAPIKeys()
+			if err != nil {
+				t.Fatalf("Failed to list api keys: %v", err)
+			}
+			if len(keys) != 2 {
+				t.Fatalf("Expected 2 api keys, got %d", len(keys))
+			}
+			for _, loaded := range keys {
+				if loaded.ID == "k1" && (loaded.KeyHash != "abc" || loaded.RateLimitRPM != 60 || !loaded.Expiration.Equal(expiration) || loaded.Invalidated) {
+					t.Errorf("API key mismatch: %+v", loaded)
+				}
+				if loaded.ID == "config-key" && !loaded.Invalidated {
+					t.Errorf("Expected config-key to be invalidated: %+v", loaded)
+				}
+			}
+		})
+	}
+}
+
+func TestMetadataStore_Ping(t *testing.T) {
+	for _, storageType := range []string{"file", "bolt", "memory"} {
+		t.Run(storageType, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			store, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{StorageType: storageType, FilePath: tempDir})
+			if err != nil {
+				t.Fatalf("Failed to create metadata store: %v", err)
+			}
+			if err := store.Ping(); err != nil {
+				t.Errorf("Expected ping to succeed, got %v", err)
+			}
+
+			store.Close()
+			if storageType == "bolt" {
+				if err := store.Ping(); err == nil {
+					t.Errorf("Expected ping to fail after close")
+				}
+			}
+			if storageType == "file" {
+				os.RemoveAll(tempDir)
+				if err := store.Ping(); err == nil {
+					t.Errorf("Expected ping to fail after the metadata directory is removed")
+				}
+			}
+		})
+	}
+}
+
+func TestFileMetadataStore_ClusterSettings(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := &metadata.MetadataStoreConfig{
+		StorageType: "file",
+		FilePath:    tempDir,
+		EnableCache: true,
+	}
+
+	store, err := metadata.NewMetadataStore(config)
+	if err != nil {
+		t.Fatalf("Failed to create file metadata store: %v", err)
+	}
+	if settings, err := store.GetClusterSettings(); err != nil || len(settings) != 0 {
+		t.Fatalf("Expected empty cluster settings, got %v (err=%v)", settings, err)
+	}
+	if err := store.SaveClusterSettings(map[string]interface{}{"logger.level": "debug"}); err != nil {
+		t.Fatalf("Failed to save cluster settings: %v", err)
+	}
+	store.Close()
+
+	// 重新打开，验证设置已持久化
+	store, err = metadata.NewMetadataStore(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen file metadata store: %v", err)
+	}
+	defer store.Close()
+
+	settings, err := store.GetClusterSettings()
+	if err != nil {
+		t.Fatalf("Failed to get cluster settings: %v", err)
+	}
+	if settings["logger.level"] != "debug" {
+		t.Errorf("Cluster settings mismatch: %v", settings)
+	}
+}
+
+func TestBoltMetadataStore_Operations(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := &metadata.MetadataStoreConfig{
+		StorageType: "bolt",
+		FilePath:    tempDir,
+		EnableCache: true,
+	}
+
+	store, err := metadata.NewMetadataStore(config)
+	if err != nil {
+		t.Fatalf("Failed to create bolt metadata store: %v", err)
+	}
+	if _, ok := store.(*metadata.BoltMetadataStore); !ok {
+		t.Fatal("Expected BoltMetadataStore type")
+	}
+
+	now := time.Now()
+	indexMeta := &metadata.IndexMetadata{
+		Name:      "test_index",
+		Mapping:   map[string]interface{}{"properties": map[string]interface{}{"title": map[string]interface{}{"type": "text"}}},
+		Settings:  map[string]interface{}{"number_of_shards": float64(1)},
+		Aliases:   []string{"alias1"},
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.SaveIndexMetadata(indexMeta.Name, indexMeta); err != nil {
+		t.Fatalf("Failed to save index metadata: %v", err)
+	}
+	tableMeta := &metadata.TableMetadata{Name: "users", Version: 1, CreatedAt: now, UpdatedAt: now}
+	if err := store.SaveTableMetadata("test_index", "users", tableMeta); err != nil {
+		t.Fatalf("Failed to save table metadata: %v", err)
+	}
+	if err := store.SaveStoredScript("tpl", &metadata.StoredScript{ID: "tpl", Lang: "mustache", Source: "{}"}); err != nil {
+		t.Fatalf("Failed to save stored script: %v", err)
+	}
+	if err := store.SaveClusterSettings(map[string]interface{}{"logger.level": "debug"}); err != nil {
+		t.Fatalf("Failed to save cluster settings: %v", err)
+	}
+	version, _ := store.GetLatestVersion()
+	if version < 5 {
+		t.Errorf("Expected version to increase with every change, got %d", version)
+	}
+	store.Close()
+
+	// 重新打开，验证所有元数据已持久化
+	store, err = metadata.NewMetadataStore(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen bolt metadata store: %v", err)
+	}
+	defer store.Close()
+
+	loaded, err := store.GetIndexMetadata("test_index")
+	if err != nil {
+		t.Fatalf("Failed to get index metadata: %v", err)
+	}
+	if len(loaded.Aliases) != 1 || loaded.Aliases[0] != "alias1" || loaded.Settings["number_of_shards"] != float64(1) {
+		t.Errorf("Index metadata mismatch: %+v", loaded)
+	}
+	if tables, _ := store.ListTableMetadata("test_index"); len(tables) != 1 || tables[0].Name != "users" {
+		t.Errorf("Expected table users, got %v", tables)
+	}
+	if _, err := store.GetStoredScript("tpl"); err != nil {
+		t.Errorf("Failed to get stored script: %v", err)
+	}
+	if settings, _ := store.GetClusterSettings(); settings["logger.level"] != "debug" {
+		t.Errorf("Cluster settings mismatch: %v", settings)
+	}
+	if reopened, _ := store.GetLatestVersion(); reopened != version {
+		t.Errorf("Expected version %d after reopen, got %d", version, reopened)
+	}
+
+	// 快照与恢复
+	if err := store.CreateSnapshot(version); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	if err := store.DeleteIndexMetadata("test_index"); err != nil {
+		t.Fatalf("Failed to delete index metadata: %v", err)
+	}
+	if _, err := store.GetIndexMetadata("test_index"); err == nil {
+		t.Fatal("Expected error for deleted index metadata")
+	}
+	if tables, _ := store.ListTableMetadata("test_index"); len(tables) != 0 {
+		t.Errorf("Expected tables to be deleted with the index, got %d", len(tables))
+	}
+	if err := store.RestoreSnapshot(version); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	if _, err := store.GetTableMetadata("test_index", "users"); err != nil {
+		t.Errorf("Expected table metadata to be restored: %v", err)
+	}
+	if _, ok := store.RestoreSnapshot(version + 100).(*metadata.MetadataNotFoundError); !ok {
+		t.Error("Expected MetadataNotFoundError for a missing snapshot")
+	}
+	if _, ok := store.DeleteStoredScript("missing").(*metadata.MetadataNotFoundError); !ok {
+		t.Error("Expected MetadataNotFoundError when deleting a missing stored script")
+	}
+}
+
+func TestMigrate_FileToBolt(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	src, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{StorageType: "file", FilePath: tempDir})
+	if err != nil {
+		t.Fatalf("Failed to create file metadata store: %v", err)
+	}
+	defer src.Close()
+
+	now := time.Now()
+	for _, name := range []string{"index_a", "index_b"} {
+		meta := &metadata.IndexMetadata{Name: name, Mapping: map[string]interface{}{}, Version: 1, CreatedAt: now, UpdatedAt: now}
+		if err := src.SaveIndexMetadata(name, meta); err != nil {
+			t.Fatalf("Failed to save index metadata: %v", err)
+		}
+	}
+	if err := src.SaveTableMetadata("index_a", "orders", &metadata.TableMetadata{Name: "orders", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("Failed to save table metadata: %v", err)
+	}
+	if err := src.SaveStoredScript("tpl", &metadata.StoredScript{ID: "tpl", Lang: "mustache", Source: "{}"}); err != nil {
+		t.Fatalf("Failed to save stored script: %v", err)
+	}
+	if err := src.SaveWatch("cpu", &metadata.Watch{ID: "cpu", Source: map[string]interface{}{}, Status: &metadata.WatchStatus{Active: true}}); err != nil {
+		t.Fatalf("Failed to save watch: %v", err)
+	}
+	if err := src.SaveTransform("daily", &metadata.Transform{ID: "daily", Config: map[string]interface{}{}, State: &metadata.TransformState{Checkpoint: 2}}); err != nil {
+		t.Fatalf("Failed to save transform: %v", err)
+	}
+	if err := src.SaveAPIKey(&metadata.APIKey{ID: "k1", KeyHash: "abc"}); err != nil {
+		t.Fatalf("Failed to save api key: %v", err)
+	}
+	if err := src.SaveClusterSettings(map[string]interface{}{"logger.level": "warn"}); err != nil {
+		t.Fatalf("Failed to save cluster settings: %v", err)
+	}
+
+	// file 和 bolt 可以共用同一个目录
+	dst, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{StorageType: "bolt", FilePath: tempDir})
+	if err != nil {
+		t.Fatalf("Failed to create bolt metadata store: %v", err)
+	}
+	defer dst.Close()
+
+	stats, err := metadata.Migrate(src, dst)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if stats.Indexes != 2 || stats.Tables != 1 || stats.Scripts != 1 || stats.Watches != 1 || stats.Transforms != 1 || stats.APIKeys != 1 || stats.ClusterSettings != 1 {
+		t.Errorf("Unexpected migration stats: %+v", stats)
+	}
+
+	indexes, _ := dst.ListIndexMetadata()
+	if len(indexes) != 2 || indexes[0].Name != "index_a" || indexes[1].Name != "index_b" {
+		t.Errorf("Unexpected migrated indexes: %v", indexes)
+	}
+	if _, err := dst.GetTableMetadata("index_a", "orders"); err != nil {
+		t.Errorf("Expected migrated table metadata: %v", err)
+	}
+	if _, err := dst.GetStoredScript("tpl"); err != nil {
+		t.Errorf("Expected migrated stored script: %v", err)
+	}
+	if watch, err := dst.GetWatch("cpu"); err != nil || !watch.Status.Active {
+		t.Errorf("Expected migrated watch: %v", err)
+	}
+	if transform, err := dst.GetTransform("daily"); err != nil || transform.State.Checkpoint != 2 {
+		t.Errorf("Expected migrated transform: %v", err)
+	}
+	if keys, _ := dst.ListAPIKeys(); len(keys) != 1 || keys[0].KeyHash != "abc" {
+		t.Errorf("Expected migrated api key, got %v", keys)
+	}
+	if settings, _ := dst.GetClusterSettings(); settings["logger.level"] != "warn" {
+		t.Errorf("Unexpected migrated cluster settings: %v", settings)
+	}
+	if srcIndexes, _ := src.ListIndexMetadata(); len(srcIndexes) != 2 {
+		t.Errorf("Expected source store to be unchanged, got %d indexes", len(srcIndexes))
+	}
+}
+
+func TestMetadataStore_IndexMetadataHistory(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, storageType := range []string{"memory", "file", "bolt"} {
+		t.Run(storageType, func(t *testing.T) {
+			store, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{
+				StorageType:      storageType,
+				FilePath:         filepath.Join(tempDir, storageType),
+				EnableVersioning: true,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create %s metadata store: %v", storageType, err)
+			}
+			defer store.Close()
+
+			meta := &metadata.IndexMetadata{
+				Name:     "test_index",
+				Mapping:  map[string]interface{}{"properties": map[string]interface{}{}},
+				Settings: map[string]interface{}{},
+				Aliases:  []string{},
+			}
+			if err := store.SaveIndexMetadata(meta.Name, meta); err != nil {
+				t.Fatalf("Failed to save index metadata: %v", err)
+			}
+			// 内容未变化时不产生新版本
+			if err := store.SaveIndexMetadata(meta.Name, meta); err != nil {
+				t.Fatalf("Failed to save index metadata: %v", err)
+			}
+			// 直接修改已保存的对象后再保存也应产生新版本
+			meta.Aliases = append(meta.Aliases, "alias1")
+			if err := store.SaveIndexMetadata(meta.Name, meta); err != nil {
+				t.Fatalf("Failed to save index metadata: %v", err)
+			}
+
+			history, err := store.ListIndexMetadataHistory(meta.Name)
+			if err != nil {
+				t.Fatalf("Failed to list history: %v", err)
+			}
+			if len(history) != 2 || history[0].Version != 1 || history[1].Version != 2 {
+				t.Fatalf("Expected versions 1 and 2, got %d entries", len(history))
+			}
+			if len(history[0].Aliases) != 0 || len(history[1].Aliases) != 1 {
+				t.Errorf("Unexpected history aliases: %v, %v", history[0].Aliases, history[1].Aliases)
+			}
+
+			v1, err := store.GetIndexMetadataHistory(meta.Name, 1)
+			if err != nil || v1.Version != 1 {
+				t.Fatalf("Failed to get version 1: %v", err)
+			}
+			if _, err := store.GetIndexMetadataHistory(meta.Name, 3); !isNotFound(err) {
+				t.Errorf("Expected MetadataNotFoundError for a missing version, got %v", err)
+			}
+
+			// 删除索引元数据时同时删除历史
+			if err := store.DeleteIndexMetadata(meta.Name); err != nil {
+				t.Fatalf("Failed to delete index metadata: %v", err)
+			}
+			if history, _ := store.ListIndexMetadataHistory(meta.Name); len(history) != 0 {
+				t.Errorf("Expected history to be deleted with the index, got %d entries", len(history))
+			}
+		})
+	}
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(*metadata.MetadataNotFoundError)
+	return ok
+}
+
+func TestMetadataStore_SaveIndexMetadataBatch(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tigerdb_metadata_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, storageType := range []string{"memory", "file", "bolt"} {
+		t.Run(storageType, func(t *testing.T) {
+			store, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{
+				StorageType: storageType,
+				FilePath:    filepath.Join(tempDir, storageType),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create %s metadata store: %v", storageType, err)
+			}
+			defer store.Close()
+
+			batch := []*metadata.IndexMetadata{
+				{Name: "blue", Aliases: []string{}},
+				{Name: "green", Aliases: []string{"logs"}},
+			}
+			if err := store.SaveIndexMetadataBatch(batch); err != nil {
+				t.Fatalf("Failed to save batch: %v", err)
+			}
+			for _, meta := range batch {
+				loaded, err := store.GetIndexMetadata(meta.Name)
+				if err != nil {
+					t.Fatalf("Failed to get %s: %v", meta.Name, err)
+				}
+				if len(loaded.Aliases) != len(meta.Aliases) {
+					t.Errorf("Aliases mismatch for %s: %v", meta.Name, loaded.Aliases)
+				}
+			}
+
+			if err := store.SaveIndexMetadataBatch([]*metadata.IndexMetadata{{Name: "red"}, {}}); err == nil {
+				t.Error("Expected error for batch entry without name")
+			}
+			if _, err := store.GetIndexMetadata("red"); err == nil {
+				t.Error("Expected invalid batch not to be applied")
+			}
+		})
+	}
+}
@@ -15,8 +15,13 @@
 package es
 
 import (
+	"fmt"
+
+	"github.com/lscgzwd/tiggerdb/audit"
 	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
 	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+	"github.com/lscgzwd/tiggerdb/rerank"
+	"github.com/lscgzwd/tiggerdb/script"
 )
 
 // Config ES协议服务器配置
@@ -29,6 +34,51 @@ type Config struct {
 
 	// 认证配置
 	Auth *middleware.AuthConfig `json:"auth" yaml:"auth"`
+
+	// 多租户配置
+	Tenant *middleware.TenantConfig `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+
+	// 审计日志配置
+	Audit *audit.Config `json:"audit,omitempty" yaml:"audit,omitempty"`
+
+	// 脚本执行限制（未设置的项使用默认值）
+	Script *script.Limits `json:"script,omitempty" yaml:"script,omitempty"`
+
+	// 重排序服务（名称 -> HTTP 重排序服务配置），搜索请求通过 rescore.reranker.name 引用
+	Rerankers map[string]*rerank.HTTPConfig `json:"rerankers,omitempty" yaml:"rerankers,omitempty"`
+
+	// ES 客户端兼容配置
+	Compatibility *CompatibilityConfig `json:"compatibility,omitempty" yaml:"compatibility,omitempty"`
+
+	// 聚合执行配置
+	Aggregation *AggregationConfig `json:"aggregation,omitempty" yaml:"aggregation,omitempty"`
+
+	// 就绪检查配置（GET /_health/ready）
+	Readiness *ReadinessConfig `json:"readiness,omitempty" yaml:"readiness,omitempty"`
+
+	// 集群动态设置的初始值（键与 PUT /_cluster/settings 相同，如 logger.level、search.slowlog.threshold.query.warn），
+	// 可通过 SIGHUP 重新加载，persistent/transient 动态设置优先
+	Settings map[string]string `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+// AggregationConfig 聚合执行配置
+type AggregationConfig struct {
+	// 并发执行聚合额外搜索的 worker 上限，<= 0 时使用 GOMAXPROCS
+	MaxConcurrency int `json:"max_concurrency" yaml:"max_concurrency"`
+}
+
+// ReadinessConfig 就绪检查配置
+type ReadinessConfig struct {
+	// 关键索引：任一索引不能打开时节点未就绪（可通过 SIGHUP 重新加载）
+	CriticalIndices []string `json:"critical_indices,omitempty" yaml:"critical_indices,omitempty"`
+}
+
+// CompatibilityConfig ES 客户端兼容配置
+type CompatibilityConfig struct {
+	// 对外声明的 ES 版本号（GET / 的 version.number），为空时使用 7.10.2
+	Version string `json:"version" yaml:"version"`
+	// 关闭 X-Elastic-Product 响应头注入（官方客户端 7.14+ 会校验该头）
+	DisableProductHeader bool `json:"disable_product_header" yaml:"disable_product_header"`
 }
 
 // DefaultConfig 返回默认ES配置
@@ -44,5 +94,28 @@ func (c *Config) Validate() error {
 	if c.ServerConfig == nil {
 		c.ServerConfig = server.DefaultServerConfig()
 	}
+	if c.Auth != nil {
+		if err := c.Auth.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Tenant != nil {
+		if err := c.Tenant.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Audit != nil {
+		if err := c.Audit.Validate(); err != nil {
+			return err
+		}
+	}
+	for name, rc := range c.Rerankers {
+		if rc == nil {
+			return fmt.Errorf("reranker [%s] config is empty", name)
+		}
+		if err := rc.Validate(); err != nil {
+			return fmt.Errorf("reranker [%s]: %w", name, err)
+		}
+	}
 	return c.ServerConfig.Validate()
 }
@@ -15,7 +15,9 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/lscgzwd/tiggerdb/logger"
 	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
@@ -77,7 +79,8 @@ type NestedFieldAggregationInfo struct {
 
 // NestedFieldAggregationConfig Nested字段聚合配置
 type NestedFieldAggregationConfig struct {
-	Path            string                            // Nested字段路径
+	Path            string                            // Nested字段路径（reverse_nested 时为目标路径，空表示根文档）
+	Reverse         bool                              // 是否为 reverse_nested 聚合
 	SubAggregations map[string]map[string]interface{} // 子聚合配置
 }
 
@@ -122,25 +125,33 @@ type AggregationConfig struct {
 // 替代原来的8个返回值，使代码更清晰、易于扩展
 // 新增聚合类型只需在此结构体中添加字段，无需修改函数签名和所有调用点
 type ParsedAggregations struct {
-	Facets             bleve.FacetsRequest            // Bleve facets请求（用于terms、range等）
-	MetricsInfo        *MetricsAggregationInfo        // Metrics聚合信息（avg、sum、min、max等）
-	CompositeInfo      *CompositeAggregationInfo      // Composite聚合信息
-	NestedInfo         *NestedAggregationInfo         // 嵌套聚合信息
-	FilterInfo         *FilterAggregationInfo         // Filter聚合信息
-	TopHitsInfo        *TopHitsAggregationInfo        // TopHits聚合信息
-	NestedFieldInfo    *NestedFieldAggregationInfo    // Nested字段聚合信息
-	ScriptedMetricInfo *ScriptedMetricAggregationInfo // Scripted Metric聚合信息
-	BucketScriptInfo   *BucketScriptAggregationInfo   // Bucket Script聚合信息
+	Facets               bleve.FacetsRequest              // Bleve facets请求（用于terms、range等）
+	TermsInfo            *TermsAggregationInfo            // Terms聚合信息（排序、min_doc_count、include/exclude等）
+	MetricsInfo          *MetricsAggregationInfo          // Metrics聚合信息（avg、sum、min、max等）
+	CompositeInfo        *CompositeAggregationInfo        // Composite聚合信息
+	NestedInfo           *NestedAggregationInfo           // 嵌套聚合信息
+	FilterInfo           *FilterAggregationInfo           // Filter聚合信息
+	TopHitsInfo          *TopHitsAggregationInfo          // TopHits聚合信息
+	NestedFieldInfo      *NestedFieldAggregationInfo      // Nested字段聚合信息
+	ScriptedMetricInfo   *ScriptedMetricAggregationInfo   // Scripted Metric聚合信息
+	BucketScriptInfo     *BucketScriptAggregationInfo     // Bucket Script聚合信息
+	SignificantTermsInfo *SignificantTermsAggregationInfo // Significant Terms聚合信息
+	MultiTermsInfo       *MultiTermsAggregationInfo       // Multi Terms聚合信息
+	RareTermsInfo        *RareTermsAggregationInfo        // Rare Terms聚合信息
+	DateHistogramInfo    *DateHistogramAggregationInfo    // Date Histogram聚合信息
+	GeoInfo              *GeoAggregationInfo              // Geo聚合信息（geohash_grid、geotile_grid、geo_bounds、geo_centroid）
 }
 
 // parseAggregations P2-1: 解析ES聚合请求并转换为bleve FacetsRequest
 // 使用ParsedAggregations结构体封装返回值，提升可维护性和扩展性
-func (h *DocumentHandler) parseAggregations(aggs map[string]map[string]interface{}) (*ParsedAggregations, error) {
+// ctx 携带搜索目标索引的字段级安全限制，聚合中的查询（filter、background_filter）按未映射字段处理不可见字段
+func (h *DocumentHandler) parseAggregations(ctx context.Context, aggs map[string]map[string]interface{}) (*ParsedAggregations, error) {
 	if len(aggs) == 0 {
 		return &ParsedAggregations{}, nil
 	}
 
 	facets := make(bleve.FacetsRequest)
+	termsAggs := make(map[string]*TermsAggregationConfig)
 	metricsAggs := make(map[string]MetricsAggregationSpec)
 	compositeAggs := make(map[string]*CompositeAggregationConfig)
 	nestedAggs := make(map[string]map[string]map[string]interface{})
@@ -149,6 +160,11 @@ func (h *DocumentHandler) parseAggregations(aggs map[string]map[string]interface
 	nestedFieldAggs := make(map[string]*NestedFieldAggregationConfig)
 	scriptedMetricAggs := make(map[string]*ScriptedMetricAggregationConfig)
 	bucketScriptAggs := make(map[string]*BucketScriptAggregationConfig)
+	significantTermsAggs := make(map[string]*SignificantTermsAggregationConfig)
+	multiTermsAggs := make(map[string]*MultiTermsAggregationConfig)
+	rareTermsAggs := make(map[string]*RareTermsAggregationConfig)
+	dateHistogramAggs := make(map[string]*DateHistogramAggregationConfig)
+	geoAggs := make(map[string]*GeoAggregationConfig)
 	fieldMapping := make(map[string]string) // 聚合名称 -> 字段名
 
 	for aggName, aggSpec := range aggs {
@@ -172,12 +188,13 @@ func (h *DocumentHandler) parseAggregations(aggs map[string]map[string]interface
 		switch aggConfig.Type {
 		case "terms":
 			// Terms聚合: {"terms": {"field": "tags", "size": 10}}
-			facetReq, err := h.parseTermsAggregation(aggConfig.Config)
+			facetReq, termsConfig, err := h.parseTermsAggregation(aggConfig.Config)
 			if err != nil {
 				logger.Warn("Failed to parse terms aggregation [%s]: %v", aggName, err)
 				continue
 			}
 			facets[aggName] = facetReq
+			termsAggs[aggName] = termsConfig
 			// 保存字段名映射
 			if field, ok := aggConfig.Config["field"].(string); ok {
 				fieldMapping[aggName] = field
@@ -223,7 +240,7 @@ func (h *DocumentHandler) parseAggregations(aggs map[string]map[string]interface
 			for _, source := range compositeAgg.Sources {
 				if source.Terms != nil {
 					facetName := fmt.Sprintf("%s_%s", aggName, source.Name)
-					facetReq, err := h.parseTermsAggregation(map[string]interface{}{
+					facetReq, _, err := h.parseTermsAggregation(map[string]interface{}{
 						"field": source.Terms.Field,
 						"size":  compositeAgg.Size,
 					})
@@ -233,9 +250,8 @@ func (h *DocumentHandler) parseAggregations(aggs map[string]map[string]interface
 				}
 			}
 
-		case "avg", "sum", "min", "max", "stats", "cardinality":
+		case "avg", "sum", "min", "max", "stats":
 			// Metrics聚合: {"avg": {"field": "price"}}
-			// Cardinality聚合: {"cardinality": {"field": "user_id", "precision_threshold": 100}}
 			// 注意：bleve不直接支持metrics聚合，需要从搜索结果中计算
 			field, ok := aggConfig.Config["field"].(string)
 			if !ok || field == "" {
@@ -243,28 +259,40 @@ func (h *DocumentHandler) parseAggregations(aggs map[string]map[string]interface
 				continue
 			}
 			spec := MetricsAggregationSpec{
-				Type:  aggConfig.Type,
-				Field: field,
-			}
-			// 对于cardinality聚合，解析precision_threshold参数
-			if aggConfig.Type == "cardinality" {
-				if precisionThreshold, ok := aggConfig.Config["precision_threshold"].(float64); ok {
-					spec.PrecisionThreshold = int(precisionThreshold)
-				} else if precisionThreshold, ok := aggConfig.Config["precision_threshold"].(int); ok {
-					spec.PrecisionThreshold = precisionThreshold
-				}
+				Type:    aggConfig.Type,
+				Field:   field,
+				Missing: aggConfig.Config["missing"],
 			}
 			metricsAggs[aggName] = spec
 
+		case "cardinality":
+			// Cardinality聚合: {"cardinality": {"field": "user_id", "precision_threshold": 100}}
+			// 基于 HyperLogLog++ 的 facet，直接遍历字段的 doc values，不依赖获取的文档
+			facetReq, err := h.parseCardinalityAggregation(aggConfig.Config)
+			if err != nil {
+				logger.Warn("Failed to parse cardinality aggregation [%s]: %v", aggName, err)
+				continue
+			}
+			facets[aggName] = facetReq
+
 		case "filter":
 			// Filter聚合: {"filter": {"term": {"status": "fixed"}}, "aggs": {...}}
-			filterAgg, err := h.parseFilterAggregation(aggConfig.Config, aggConfig.SubAggregations)
+			filterAgg, err := h.parseFilterAggregation(ctx, aggConfig.Config, aggConfig.SubAggregations)
 			if err != nil {
 				logger.Warn("Failed to parse filter aggregation [%s]: %v", aggName, err)
 				continue
 			}
 			filterAggs[aggName] = filterAgg
 
+		case "missing":
+			// Missing聚合: {"missing": {"field": "price"}, "aggs": {...}}，统计缺少字段的文档
+			missingAgg, err := h.parseMissingAggregation(aggConfig.Config, aggConfig.SubAggregations)
+			if err != nil {
+				logger.Warn("Failed to parse missing aggregation [%s]: %v", aggName, err)
+				continue
+			}
+			filterAggs[aggName] = missingAgg
+
 		case "top_hits":
 			// TopHits聚合: {"top_hits": {"size": 5, "sort": [...], "_source": {...}}}
 			topHitsAgg, err := h.parseTopHitsAggregation(aggConfig.Config)
@@ -283,6 +311,15 @@ func (h *DocumentHandler) parseAggregations(aggs map[string]map[string]interface
 			}
 			nestedFieldAggs[aggName] = nestedFieldAgg
 
+		case "reverse_nested":
+			// Reverse Nested聚合: {"reverse_nested": {}, "aggs": {...}}，在 nested 聚合内回到根文档（或上级 nested 路径）
+			reverseNestedAgg, err := h.parseReverseNestedAggregation(aggConfig.Config, aggConfig.SubAggregations)
+			if err != nil {
+				logger.Warn("Failed to parse reverse nested aggregation [%s]: %v", aggName, err)
+				continue
+			}
+			nestedFieldAggs[aggName] = reverseNestedAgg
+
 		case "scripted_metric":
 			// Scripted Metric聚合: {"scripted_metric": {"init_script": "...", "map_script": "...", ...}}
 			scriptedMetricAgg := ParseScriptedMetricAggregation(aggConfig.Config)
@@ -295,6 +332,58 @@ func (h *DocumentHandler) parseAggregations(aggs map[string]map[string]interface
 			bucketScriptAggs[aggName] = bucketScriptAgg
 			logger.Debug("parseAggregations: found bucket_script aggregation [%s]", aggName)
 
+		case "significant_terms":
+			// Significant Terms聚合: {"significant_terms": {"field": "message", "background_filter": {...}}}
+			stAgg, err := h.parseSignificantTermsAggregation(ctx, aggConfig.Config)
+			if err != nil {
+				logger.Warn("Failed to parse significant_terms aggregation [%s]: %v", aggName, err)
+				continue
+			}
+			significantTermsAggs[aggName] = stAgg
+			logger.Debug("parseAggregations: found significant_terms aggregation [%s]", aggName)
+
+		case "multi_terms":
+			// Multi Terms聚合: {"multi_terms": {"terms": [{"field": "a"}, {"field": "b"}], "size": 10}}
+			multiTermsAgg, err := h.parseMultiTermsAggregation(aggConfig.Config, aggConfig.SubAggregations)
+			if err != nil {
+				logger.Warn("Failed to parse multi_terms aggregation [%s]: %v", aggName, err)
+				continue
+			}
+			multiTermsAggs[aggName] = multiTermsAgg
+			logger.Debug("parseAggregations: found multi_terms aggregation [%s]", aggName)
+
+		case "rare_terms":
+			// Rare Terms聚合: {"rare_terms": {"field": "user_agent", "max_doc_count": 1}}
+			rareTermsAgg, err := h.parseRareTermsAggregation(aggConfig.Config, aggConfig.SubAggregations)
+			if err != nil {
+				logger.Warn("Failed to parse rare_terms aggregation [%s]: %v", aggName, err)
+				continue
+			}
+			rareTermsAggs[aggName] = rareTermsAgg
+			logger.Debug("parseAggregations: found rare_terms aggregation [%s]", aggName)
+
+		case "date_histogram":
+			// Date Histogram聚合: {"date_histogram": {"field": "timestamp", "calendar_interval": "1d", "time_zone": "+08:00"}}
+			dateHistogramAgg, err := h.parseDateHistogramAggregation(aggConfig.Config, aggConfig.SubAggregations)
+			if err != nil {
+				logger.Warn("Failed to parse date_histogram aggregation [%s]: %v", aggName, err)
+				continue
+			}
+			dateHistogramAggs[aggName] = dateHistogramAgg
+
+		case "geohash_grid", "geotile_grid", "geo_bounds", "geo_centroid":
+			// Geo聚合: {"geohash_grid": {"field": "location", "precision": 5}}
+			geoAgg, err := h.parseGeoAggregation(aggConfig.Type, aggConfig.Config, aggConfig.SubAggregations)
+			if err != nil {
+				logger.Warn("Failed to parse %s aggregation [%s]: %v", aggConfig.Type, aggName, err)
+				continue
+			}
+			geoAggs[aggName] = geoAgg
+			logger.Debug("parseAggregations: found %s aggregation [%s]", aggConfig.Type, aggName)
+
+		case "bucket_selector", "derivative", "cumulative_sum", "moving_avg", "avg_bucket", "sum_bucket", "min_bucket", "max_bucket":
+			// 管道聚合在其他聚合结果构建完成后计算（见 applyPipelineAggregations）
+
 		default:
 			logger.Warn("Unsupported aggregation type [%s] for aggregation [%s]", aggConfig.Type, aggName)
 		}
@@ -363,18 +452,67 @@ func (h *DocumentHandler) parseAggregations(aggs map[string]map[string]interface
 		logger.Debug("parseAggregations: found bucket_script aggregations, count=%d", len(bucketScriptAggs))
 	}
 
+	var significantTermsInfo *SignificantTermsAggregationInfo
+	if len(significantTermsAggs) > 0 {
+		significantTermsInfo = &SignificantTermsAggregationInfo{
+			Aggregations: significantTermsAggs,
+		}
+		logger.Debug("parseAggregations: found significant_terms aggregations, count=%d", len(significantTermsAggs))
+	}
+
+	var multiTermsInfo *MultiTermsAggregationInfo
+	if len(multiTermsAggs) > 0 {
+		multiTermsInfo = &MultiTermsAggregationInfo{
+			Aggregations: multiTermsAggs,
+		}
+	}
+
+	var rareTermsInfo *RareTermsAggregationInfo
+	if len(rareTermsAggs) > 0 {
+		rareTermsInfo = &RareTermsAggregationInfo{
+			Aggregations: rareTermsAggs,
+		}
+	}
+
+	var dateHistogramInfo *DateHistogramAggregationInfo
+	if len(dateHistogramAggs) > 0 {
+		dateHistogramInfo = &DateHistogramAggregationInfo{
+			Aggregations: dateHistogramAggs,
+		}
+	}
+
+	var termsInfo *TermsAggregationInfo
+	if len(termsAggs) > 0 {
+		termsInfo = &TermsAggregationInfo{
+			Aggregations: termsAggs,
+		}
+	}
+
+	var geoInfo *GeoAggregationInfo
+	if len(geoAggs) > 0 {
+		geoInfo = &GeoAggregationInfo{
+			Aggregations: geoAggs,
+		}
+	}
+
 	// P2-1: 返回封装的结构体，替代原来的8个返回值
 	// 优势：新增聚合类型只需在此结构体中添加字段，无需修改函数签名和所有调用点
 	return &ParsedAggregations{
-		Facets:             facets,
-		MetricsInfo:        metricsInfo,
-		CompositeInfo:      compositeInfo,
-		NestedInfo:         nestedInfo,
-		FilterInfo:         filterInfo,
-		TopHitsInfo:        topHitsInfo,
-		NestedFieldInfo:    nestedFieldInfo,
-		ScriptedMetricInfo: scriptedMetricInfo,
-		BucketScriptInfo:   bucketScriptInfo,
+		Facets:               facets,
+		TermsInfo:            termsInfo,
+		MetricsInfo:          metricsInfo,
+		CompositeInfo:        compositeInfo,
+		NestedInfo:           nestedInfo,
+		FilterInfo:           filterInfo,
+		TopHitsInfo:          topHitsInfo,
+		NestedFieldInfo:      nestedFieldInfo,
+		ScriptedMetricInfo:   scriptedMetricInfo,
+		BucketScriptInfo:     bucketScriptInfo,
+		SignificantTermsInfo: significantTermsInfo,
+		MultiTermsInfo:       multiTermsInfo,
+		RareTermsInfo:        rareTermsInfo,
+		DateHistogramInfo:    dateHistogramInfo,
+		GeoInfo:              geoInfo,
 	}, nil
 }
 
@@ -406,11 +544,10 @@ func (h *DocumentHandler) parseSingleAggregation(aggName string, aggSpec map[str
 
 		// 检查是否是聚合类型（必须是map类型）
 		if valueMap, ok := value.(map[string]interface{}); ok {
-			// 确认这不是嵌套聚合容器
-			if key != "aggs" && key != "aggregations" {
+			// 不能在此 break：map 遍历顺序随机，aggs 可能排在聚合类型之后
+			if aggType == "" {
 				aggType = key
 				aggConfig = valueMap
-				break
 			}
 		}
 	}
@@ -426,21 +563,13 @@ func (h *DocumentHandler) parseSingleAggregation(aggName string, aggSpec map[str
 }
 
 // parseTermsAggregation 解析terms聚合
-// ES格式: {"terms": {"field": "tags", "size": 10}}
-func (h *DocumentHandler) parseTermsAggregation(config map[string]interface{}) (*bleve.FacetRequest, error) {
-	field, ok := config["field"].(string)
-	if !ok || field == "" {
-		return nil, fmt.Errorf("terms aggregation requires a 'field' parameter")
-	}
-
-	size := 10 // 默认大小
-	if sizeVal, ok := config["size"].(float64); ok {
-		size = int(sizeVal)
-	} else if sizeVal, ok := config["size"].(int); ok {
-		size = sizeVal
+// ES格式: {"terms": {"field": "tags", "size": 10}}，排序和过滤参数见 parseTermsAggregationConfig
+func (h *DocumentHandler) parseTermsAggregation(config map[string]interface{}) (*bleve.FacetRequest, *TermsAggregationConfig, error) {
+	termsConfig, err := parseTermsAggregationConfig(config)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return bleve.NewFacetRequest(field, size), nil
+	return bleve.NewFacetRequest(termsConfig.Field, termsConfig.facetSize()), termsConfig, nil
 }
 
 // parseRangeAggregation 解析numeric range聚合
@@ -483,20 +612,13 @@ func (h *DocumentHandler) parseRangeAggregation(config map[string]interface{}) (
 			max = &f
 		}
 
-		// 解析key（可选，用于命名范围）
+		// 解析key（可选，用于命名范围），未指定时与 ES 相同为 "from-to"
 		if keyVal, ok := rangeMap["key"].(string); ok {
 			name = keyVal
+		} else if min == nil && max == nil {
+			name = fmt.Sprintf("range_%d", i)
 		} else {
-			// 如果没有key，生成一个默认名称
-			if min != nil && max != nil {
-				name = fmt.Sprintf("%.0f-%.0f", *min, *max)
-			} else if min != nil {
-				name = fmt.Sprintf("%.0f+", *min)
-			} else if max != nil {
-				name = fmt.Sprintf("*-%.0f", *max)
-			} else {
-				name = fmt.Sprintf("range_%d", i)
-			}
+			name = numericRangeKey(min, max)
 		}
 
 		facetReq.AddNumericRange(name, min, max)
@@ -506,7 +628,8 @@ func (h *DocumentHandler) parseRangeAggregation(config map[string]interface{}) (
 }
 
 // parseDateRangeAggregation 解析date range聚合
-// ES格式: {"date_range": {"field": "date", "ranges": [{"to": "now"}, {"from": "now-1d"}]}}
+// ES格式: {"date_range": {"field": "date", "format": "yyyy-MM-dd", "time_zone": "+08:00", "ranges": [{"to": "now"}, {"from": "now-1d/d"}]}}
+// 边界在解析时计算为具体时间（format 与 time_zone 同时用于解析边界和生成默认桶键）
 func (h *DocumentHandler) parseDateRangeAggregation(config map[string]interface{}) (*bleve.FacetRequest, error) {
 	field, ok := config["field"].(string)
 	if !ok || field == "" {
@@ -518,6 +641,13 @@ func (h *DocumentHandler) parseDateRangeAggregation(config map[string]interface{
 		return nil, fmt.Errorf("date_range aggregation requires a 'ranges' parameter")
 	}
 
+	format, _ := config["format"].(string)
+	zone, _ := config["time_zone"].(string)
+	loc, err := parseTimeZone(zone)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
 	facetReq := bleve.NewFacetRequest(field, len(ranges))
 
 	for i, rangeSpec := range ranges {
@@ -526,46 +656,32 @@ func (h *DocumentHandler) parseDateRangeAggregation(config map[string]interface{
 			return nil, fmt.Errorf("invalid date range specification at index %d", i)
 		}
 
-		var start, end *string
-		var name string
-
-		// 解析from
-		if fromVal, ok := rangeMap["from"].(string); ok {
-			start = &fromVal
-		}
-
-		// 解析to
-		if toVal, ok := rangeMap["to"].(string); ok {
-			end = &toVal
+		var start, end time.Time
+		if fromVal, ok := rangeMap["from"]; ok && fromVal != nil {
+			t, err := parseDateMathBound(fromVal, format, loc, now, false)
+			if err != nil {
+				return nil, fmt.Errorf("invalid [from] in date range at index %d: %w", i, err)
+			}
+			start = t
 		}
-
-		// 解析key（可选）
-		if keyVal, ok := rangeMap["key"].(string); ok {
-			name = keyVal
-		} else {
-			// 生成默认名称
-			if start != nil && end != nil {
-				name = fmt.Sprintf("%s-%s", *start, *end)
-			} else if start != nil {
-				name = fmt.Sprintf("%s+", *start)
-			} else if end != nil {
-				name = fmt.Sprintf("*-%s", *end)
-			} else {
-				name = fmt.Sprintf("date_range_%d", i)
+		if toVal, ok := rangeMap["to"]; ok && toVal != nil {
+			t, err := parseDateMathBound(toVal, format, loc, now, false)
+			if err != nil {
+				return nil, fmt.Errorf("invalid [to] in date range at index %d: %w", i, err)
 			}
+			end = t
 		}
-
-		// 解析format（可选，用于日期解析器）
-		format := ""
-		if formatVal, ok := rangeMap["format"].(string); ok {
-			format = formatVal
+		if start.IsZero() && end.IsZero() {
+			return nil, fmt.Errorf("date range at index %d requires [from] or [to]", i)
 		}
 
-		if format != "" {
-			facetReq.AddDateTimeRangeStringWithParser(name, start, end, format)
-		} else {
-			facetReq.AddDateTimeRangeString(name, start, end)
+		// 解析key（可选），未指定时为格式化后的 "from-to"
+		name, ok := rangeMap["key"].(string)
+		if !ok {
+			name = dateRangeKey(start, end, format, loc)
 		}
+
+		facetReq.AddDateTimeRange(name, start, end)
 	}
 
 	return facetReq, nil
@@ -574,7 +690,7 @@ func (h *DocumentHandler) parseDateRangeAggregation(config map[string]interface{
 // parseFilterAggregation 解析filter聚合
 // ES格式: {"filter": {"term": {"status": "fixed"}}, "aggs": {...}}
 // 注意：config 参数就是 filter 查询本身（例如 {"term": {"status": "fixed"}}）
-func (h *DocumentHandler) parseFilterAggregation(config map[string]interface{}, subAggs map[string]map[string]interface{}) (*FilterAggregationConfig, error) {
+func (h *DocumentHandler) parseFilterAggregation(ctx context.Context, config map[string]interface{}, subAggs map[string]map[string]interface{}) (*FilterAggregationConfig, error) {
 	// config 本身就是 filter 查询，不需要再查找 "filter" 键
 	if len(config) == 0 {
 		return nil, fmt.Errorf("filter aggregation requires a 'filter' query")
@@ -582,6 +698,7 @@ func (h *DocumentHandler) parseFilterAggregation(config map[string]interface{},
 
 	// 使用DSL解析器解析查询
 	parser := dsl.NewQueryParser()
+	restrictQueryFields(parser, indexAccessFromContext(ctx))
 	filterQuery, err := parser.ParseQuery(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse filter query: %w", err)
@@ -645,3 +762,20 @@ func (h *DocumentHandler) parseNestedFieldAggregation(config map[string]interfac
 		SubAggregations: subAggs,
 	}, nil
 }
+
+// parseReverseNestedAggregation 解析reverse_nested聚合
+// ES格式: {"reverse_nested": {"path": "comments"}, "aggs": {...}}，path 可选，省略时回到根文档
+func (h *DocumentHandler) parseReverseNestedAggregation(config map[string]interface{}, subAggs map[string]map[string]interface{}) (*NestedFieldAggregationConfig, error) {
+	var path string
+	if v, ok := config["path"]; ok {
+		if path, ok = v.(string); !ok {
+			return nil, fmt.Errorf("reverse_nested aggregation 'path' must be a string, got [%v]", v)
+		}
+	}
+
+	return &NestedFieldAggregationConfig{
+		Path:            path,
+		Reverse:         true,
+		SubAggregations: subAggs,
+	}, nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// 聚合并发执行
+// 相互独立的顶层聚合（filter、nested 字段、top_hits 等）以及 bucket 子聚合各自需要额外的搜索，
+// 通过全局有界 worker 池并发执行。没有空闲 worker 时任务由调用方 goroutine 直接执行，
+// 因此嵌套聚合不会因互相等待 worker 而死锁，且并发数始终不超过上限。
+
+// aggregationPool 聚合任务 worker 池
+type aggregationPool struct {
+	mu    sync.RWMutex
+	slots chan struct{}
+	limit int
+
+	active     int64 // 正在 worker 中执行的任务数
+	largest    int64 // 历史最大并发数
+	completed  int64 // 已完成的任务数（含调用方执行）
+	callerRuns int64 // 因没有空闲 worker 而由调用方执行的任务数
+}
+
+var aggPool = newAggregationPool(0)
+
+// defaultAggregationConcurrency 默认并发上限
+func defaultAggregationConcurrency() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+func newAggregationPool(limit int) *aggregationPool {
+	p := &aggregationPool{}
+	p.setLimit(limit)
+	return p
+}
+
+// setLimit 调整并发上限，<= 0 时使用默认值（GOMAXPROCS）
+// 已在执行的任务归还到原来的 slots，不受影响
+func (p *aggregationPool) setLimit(limit int) {
+	if limit <= 0 {
+		limit = defaultAggregationConcurrency()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limit = limit
+	p.slots = make(chan struct{}, limit)
+}
+
+// run 并发执行相互独立的任务并等待全部完成
+// 任务中的 panic 会在全部任务结束后于调用方 goroutine 重新抛出
+func (p *aggregationPool) run(tasks []func()) {
+	if len(tasks) == 1 {
+		tasks[0]()
+		atomic.AddInt64(&p.completed, 1)
+		return
+	}
+
+	p.mu.RLock()
+	slots := p.slots
+	p.mu.RUnlock()
+
+	var (
+		wg        sync.WaitGroup
+		panicOnce sync.Once
+		panicVal  interface{}
+	)
+	for _, task := range tasks {
+		select {
+		case slots <- struct{}{}:
+			wg.Add(1)
+			p.started()
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						panicOnce.Do(func() { panicVal = r })
+					}
+					<-slots
+					atomic.AddInt64(&p.active, -1)
+					atomic.AddInt64(&p.completed, 1)
+					wg.Done()
+				}()
+				task()
+			}()
+		default:
+			atomic.AddInt64(&p.callerRuns, 1)
+			task()
+			atomic.AddInt64(&p.completed, 1)
+		}
+	}
+	wg.Wait()
+
+	if panicVal != nil {
+		panic(panicVal)
+	}
+}
+
+// started 记录任务进入 worker
+func (p *aggregationPool) started() {
+	active := atomic.AddInt64(&p.active, 1)
+	for {
+		largest := atomic.LoadInt64(&p.largest)
+		if active <= largest || atomic.CompareAndSwapInt64(&p.largest, largest, active) {
+			return
+		}
+	}
+}
+
+// stats 返回 worker 池指标
+func (p *aggregationPool) stats() map[string]interface{} {
+	p.mu.RLock()
+	limit := p.limit
+	p.mu.RUnlock()
+	return map[string]interface{}{
+		"max_concurrency": limit,
+		"active":          atomic.LoadInt64(&p.active),
+		"largest":         atomic.LoadInt64(&p.largest),
+		"completed":       atomic.LoadInt64(&p.completed),
+		"caller_runs":     atomic.LoadInt64(&p.callerRuns),
+	}
+}
+
+// SetAggregationConcurrency 设置聚合并发执行的 worker 上限，<= 0 时使用 GOMAXPROCS
+func SetAggregationConcurrency(limit int) {
+	aggPool.setLimit(limit)
+}
+
+// AggregationPoolStats 返回聚合 worker 池指标（用于 /_metrics）
+func AggregationPoolStats() interface{} {
+	return aggPool.stats()
+}
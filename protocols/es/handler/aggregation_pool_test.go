@@ -0,0 +1,130 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAggregationPool_BoundedConcurrency(t *testing.T) {
+	p := newAggregationPool(2)
+
+	var running, peak int64
+	var mu sync.Mutex
+	done := make(map[int]bool)
+	tasks := make([]func(), 0, 8)
+	for i := 0; i < 8; i++ {
+		tasks = append(tasks, func() {
+			n := atomic.AddInt64(&running, 1)
+			for {
+				old := atomic.LoadInt64(&peak)
+				if n <= old || atomic.CompareAndSwapInt64(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt64(&running, -1)
+			mu.Lock()
+			done[i] = true
+			mu.Unlock()
+		})
+	}
+	p.run(tasks)
+
+	if len(done) != 8 {
+		t.Fatalf("expected all 8 tasks to complete, got %d", len(done))
+	}
+	// 2 个 worker 加上执行任务的调用方
+	if peak > 3 {
+		t.Errorf("expected at most 3 concurrent tasks, got %d", peak)
+	}
+
+	stats := p.stats()
+	if stats["max_concurrency"] != 2 {
+		t.Errorf("expected max_concurrency 2, got %v", stats["max_concurrency"])
+	}
+	if stats["completed"] != int64(8) {
+		t.Errorf("expected 8 completed tasks, got %v", stats["completed"])
+	}
+	if stats["active"] != int64(0) {
+		t.Errorf("expected no active tasks, got %v", stats["active"])
+	}
+	if stats["largest"].(int64) > 2 {
+		t.Errorf("expected largest <= 2, got %v", stats["largest"])
+	}
+}
+
+func TestAggregationPool_NestedRunDoesNotDeadlock(t *testing.T) {
+	p := newAggregationPool(1)
+
+	var count int64
+	inner := func() {
+		p.run([]func(){
+			func() { atomic.AddInt64(&count, 1) },
+			func() { atomic.AddInt64(&count, 1) },
+		})
+	}
+	finished := make(chan struct{})
+	go func() {
+		p.run([]func(){inner, inner, inner})
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nested aggregation tasks deadlocked")
+	}
+	if count != 6 {
+		t.Errorf("expected 6 inner tasks, got %d", count)
+	}
+	if p.stats()["caller_runs"].(int64) == 0 {
+		t.Error("expected some tasks to run in the caller")
+	}
+}
+
+func TestAggregationPool_PanicPropagates(t *testing.T) {
+	p := newAggregationPool(4)
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("expected panic boom, got %v", r)
+		}
+	}()
+	p.run([]func(){
+		func() {},
+		func() { panic("boom") },
+	})
+	t.Fatal("expected run to panic")
+}
+
+func TestSetAggregationConcurrency(t *testing.T) {
+	defer SetAggregationConcurrency(0)
+
+	SetAggregationConcurrency(3)
+	stats := AggregationPoolStats().(map[string]interface{})
+	if stats["max_concurrency"] != 3 {
+		t.Errorf("expected max_concurrency 3, got %v", stats["max_concurrency"])
+	}
+
+	SetAggregationConcurrency(0)
+	stats = AggregationPoolStats().(map[string]interface{})
+	if stats["max_concurrency"] != defaultAggregationConcurrency() {
+		t.Errorf("expected default max_concurrency, got %v", stats["max_concurrency"])
+	}
+}
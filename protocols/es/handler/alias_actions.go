@@ -0,0 +1,386 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+)
+
+// aliasAction 解析后的 POST /_aliases 操作
+type aliasAction struct {
+	kind      string // add, remove, remove_index
+	indices   []string
+	aliases   []string
+	mustExist *bool
+	// add 操作的别名定义（filter、路由），nil 表示普通别名
+	definition *metadata.AliasDefinition
+}
+
+// parseAliasAction 解析单个操作：{"add"|"remove"|"remove_index": {"index"|"indices": ..., "alias"|"aliases": ...}}
+func parseAliasAction(item interface{}) (*aliasAction, common.APIError) {
+	var apiErr common.APIError
+	action, ok := item.(map[string]interface{})
+	if !ok || len(action) != 1 {
+		return nil, common.NewBadRequestError("each alias action must be an object with exactly one of [add, remove, remove_index]")
+	}
+
+	var kind string
+	var body map[string]interface{}
+	for k, v := range action {
+		kind = k
+		body, ok = v.(map[string]interface{})
+	}
+	switch kind {
+	case "add", "remove", "remove_index":
+	default:
+		return nil, common.NewBadRequestError("unknown alias action [" + kind + "]")
+	}
+	if !ok {
+		return nil, common.NewBadRequestError("[" + kind + "] action must be an object")
+	}
+
+	parsed := &aliasAction{kind: kind}
+	var err error
+	if parsed.indices, err = stringOrList(body, "index", "indices"); err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+	if len(parsed.indices) == 0 {
+		return nil, common.NewBadRequestError("one of [index] or [indices] is required for [" + kind + "] action")
+	}
+	if kind != "remove_index" {
+		if parsed.aliases, err = stringOrList(body, "alias", "aliases"); err != nil {
+			return nil, common.NewBadRequestError(err.Error())
+		}
+		if len(parsed.aliases) == 0 {
+			return nil, common.NewBadRequestError("one of [alias] or [aliases] is required for [" + kind + "] action")
+		}
+	}
+	if v, exists := body["must_exist"]; exists {
+		b, err := parseSettingBool(v)
+		if err != nil {
+			return nil, common.NewBadRequestError("[must_exist] must be a boolean")
+		}
+		parsed.mustExist = &b
+	}
+	if kind == "add" {
+		if parsed.definition, apiErr = parseAliasDefinition(body); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+	return parsed, nil
+}
+
+// parseAliasDefinition 解析别名的 filter 和路由（routing 同时设置 index_routing 和 search_routing）
+// 没有任何定义时返回 nil
+func parseAliasDefinition(body map[string]interface{}) (*metadata.AliasDefinition, common.APIError) {
+	def := &metadata.AliasDefinition{}
+	if v, ok := body["filter"]; ok && v != nil {
+		filter, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, common.NewBadRequestError("[filter] must be a query object")
+		}
+		if _, err := dsl.NewQueryParser().ParseQuery(filter); err != nil {
+			return nil, common.NewBadRequestError("failed to parse filter for alias: " + err.Error())
+		}
+		def.Filter = filter
+	}
+	for _, field := range []string{"routing", "index_routing", "search_routing"} {
+		v, ok := body[field]
+		if !ok || v == nil {
+			continue
+		}
+		var routing string
+		switch value := v.(type) {
+		case string:
+			routing = value
+		case float64:
+			routing = strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			return nil, common.NewBadRequestError("[" + field + "] must be a string")
+		}
+		switch field {
+		case "routing":
+			if def.IndexRouting == "" {
+				def.IndexRouting = routing
+			}
+			if def.SearchRouting == "" {
+				def.SearchRouting = routing
+			}
+		case "index_routing":
+			def.IndexRouting = routing
+		case "search_routing":
+			def.SearchRouting = routing
+		}
+	}
+	if def.Filter == nil && def.IndexRouting == "" && def.SearchRouting == "" {
+		return nil, nil
+	}
+	return def, nil
+}
+
+// parseCreateIndexAliases 解析创建索引请求体中的 aliases 对象，返回按名称排序的别名和别名定义
+func parseCreateIndexAliases(indexName string, value interface{}) ([]string, map[string]*metadata.AliasDefinition, common.APIError) {
+	aliases := []string{}
+	if value == nil {
+		return aliases, nil, nil
+	}
+	body, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, nil, common.NewBadRequestError("[aliases] must be an object")
+	}
+	var defs map[string]*metadata.AliasDefinition
+	for alias := range body {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if err := common.ValidateIndexName(alias); err != nil {
+			return nil, nil, newInvalidAliasNameError(alias, err.Error())
+		}
+		if alias == indexName {
+			return nil, nil, newInvalidAliasNameError(alias, "an index exists with the same name as the alias")
+		}
+		aliasBody, ok := body[alias].(map[string]interface{})
+		if !ok && body[alias] != nil {
+			return nil, nil, common.NewBadRequestError("alias [" + alias + "] must be an object")
+		}
+		def, apiErr := parseAliasDefinition(aliasBody)
+		if apiErr != nil {
+			return nil, nil, apiErr
+		}
+		defs = withAliasDefinition(defs, alias, def)
+	}
+	return aliases, defs, nil
+}
+
+// withAliasDefinition 返回设置（def 为 nil 时删除）了别名定义的新 map，不修改原 map；结果为空时返回 nil
+func withAliasDefinition(defs map[string]*metadata.AliasDefinition, alias string, def *metadata.AliasDefinition) map[string]*metadata.AliasDefinition {
+	result := make(map[string]*metadata.AliasDefinition, len(defs)+1)
+	for k, v := range defs {
+		if k != alias {
+			result[k] = v
+		}
+	}
+	if def != nil {
+		result[alias] = def
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// stringOrList 读取单值字段或数组字段（如 index/indices），两者可以同时出现
+func stringOrList(body map[string]interface{}, single, plural string) ([]string, error) {
+	var result []string
+	if v, exists := body[single]; exists {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("[%s] must be a non-empty string", single)
+		}
+		result = append(result, s)
+	}
+	if v, exists := body[plural]; exists {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[%s] must be an array of strings", plural)
+		}
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("[%s] must be an array of non-empty strings", plural)
+			}
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func newAliasesNotFoundError(index, alias string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "aliases_not_found_exception",
+		Message:    "aliases [" + alias + "] missing",
+		HTTPStatus: http.StatusNotFound,
+		Index:      index,
+	}
+}
+
+func newInvalidAliasNameError(alias, reason string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "invalid_alias_name_exception",
+		Message:    "Invalid alias name [" + alias + "]: " + reason,
+		HTTPStatus: http.StatusBadRequest,
+	}
+}
+
+// aliasActionPlan 在元数据副本上依次校验并应用所有操作，任何修改都不会写入存储
+type aliasActionPlan struct {
+	h        *IndexHandler
+	working  map[string]*metadata.IndexMetadata
+	original map[string]*metadata.IndexMetadata
+	order    []string
+}
+
+// load 获取索引元数据的副本（同一索引在多个操作之间共享），索引必须存在且未被 metadata block 拦截
+func (p *aliasActionPlan) load(indexName string) (*metadata.IndexMetadata, common.APIError) {
+	if meta, ok := p.working[indexName]; ok {
+		return meta, nil
+	}
+	if err := common.ValidateIndexName(indexName); err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+	if !p.h.dirMgr.IndexExists(indexName) {
+		return nil, common.NewIndexNotFoundError(indexName)
+	}
+
+	var meta metadata.IndexMetadata
+	if stored, err := p.h.metaStore.GetIndexMetadata(indexName); err == nil {
+		if apiErr := checkIndexBlockSettings(indexName, stored.Settings, blockLevelMetadataWrite); apiErr != nil {
+			return nil, apiErr
+		}
+		// 复制结构体和别名切片，避免修改存储缓存中的对象
+		meta = *stored
+		meta.Aliases = append([]string{}, stored.Aliases...)
+	} else {
+		now := time.Now()
+		meta = metadata.IndexMetadata{
+			Name:      indexName,
+			Aliases:   []string{},
+			Mapping:   make(map[string]interface{}),
+			Settings:  make(map[string]interface{}),
+			Version:   1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+
+	original := meta
+	p.working[indexName] = &meta
+	p.original[indexName] = &original
+	p.order = append(p.order, indexName)
+	return &meta, nil
+}
+
+// apply 校验并应用单个操作，返回第一个错误
+func (p *aliasActionPlan) apply(action *aliasAction) common.APIError {
+	for _, indexName := range action.indices {
+		meta, apiErr := p.load(indexName)
+		if apiErr != nil {
+			return apiErr
+		}
+
+		switch action.kind {
+		case "add":
+			for _, alias := range action.aliases {
+				if err := common.ValidateIndexName(alias); err != nil {
+					return newInvalidAliasNameError(alias, err.Error())
+				}
+				if p.h.dirMgr.IndexExists(alias) {
+					return newInvalidAliasNameError(alias, "an index exists with the same name as the alias")
+				}
+				if !containsAlias(meta.Aliases, alias) {
+					meta.Aliases = append(meta.Aliases, alias)
+				}
+				// 重复添加同一别名时以新的定义为准
+				meta.AliasDefinitions = withAliasDefinition(meta.AliasDefinitions, alias, action.definition)
+			}
+		case "remove":
+			for _, alias := range action.aliases {
+				if !containsAlias(meta.Aliases, alias) {
+					if action.mustExist != nil && !*action.mustExist {
+						continue
+					}
+					return newAliasesNotFoundError(indexName, alias)
+				}
+				meta.Aliases = removeAlias(meta.Aliases, alias)
+				meta.AliasDefinitions = withAliasDefinition(meta.AliasDefinitions, alias, nil)
+			}
+		case "remove_index":
+			// 删除索引的所有别名
+			meta.Aliases = []string{}
+			meta.AliasDefinitions = nil
+		}
+	}
+	return nil
+}
+
+// changed 返回别名发生变化的索引元数据（按首次出现的顺序）
+func (p *aliasActionPlan) changed() []*metadata.IndexMetadata {
+	var result []*metadata.IndexMetadata
+	now := time.Now()
+	for _, name := range p.order {
+		meta, original := p.working[name], p.original[name]
+		if aliasesEqual(original.Aliases, meta.Aliases) && reflect.DeepEqual(original.AliasDefinitions, meta.AliasDefinitions) {
+			continue
+		}
+		meta.UpdatedAt = now
+		result = append(result, meta)
+	}
+	return result
+}
+
+func containsAlias(aliases []string, alias string) bool {
+	for _, a := range aliases {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
+
+func removeAlias(aliases []string, alias string) []string {
+	result := make([]string, 0, len(aliases))
+	for _, a := range aliases {
+		if a != alias {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+func aliasesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// newAliasActionsError 汇总所有校验失败的操作；状态码和错误类型取第一个失败的操作
+func newAliasActionsError(failures []map[string]interface{}, firstErr common.APIError, total int) common.APIError {
+	message := firstErr.Error()
+	if len(failures) > 1 {
+		message = fmt.Sprintf("%d of %d alias actions failed validation, no action was applied: %s", len(failures), total, firstErr.Error())
+	}
+	err := &common.BaseError{
+		ErrType:    firstErr.Type(),
+		Message:    message,
+		HTTPStatus: firstErr.StatusCode(),
+	}
+	return err.WithContext("failed_actions", failures)
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_UpdateAliasesAtomic(t *testing.T) {
+	tempDir := t.TempDir()
+	dirMgr, err := directory.NewDirectoryManager(directory.DefaultDirectoryConfig(tempDir + "/data"))
+	if err != nil {
+		t.Fatalf("Failed to create directory manager: %v", err)
+	}
+	defer dirMgr.Cleanup()
+
+	metaStore, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{
+		StorageType:      "file",
+		FilePath:         tempDir + "/meta",
+		EnableCache:      true,
+		EnableVersioning: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	indexHandler := NewIndexHandler(dirMgr, metaStore)
+	httpSrv, _ := server.NewServer(server.DefaultServerConfig())
+	router := httpSrv.GetRouter()
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}", Handler: indexHandler.CreateIndex},
+		{Method: "POST", Path: "/_aliases", Handler: indexHandler.UpdateAliases},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	aliasesOf := func(index string) []string {
+		meta, err := metaStore.GetIndexMetadata(index)
+		if err != nil {
+			t.Fatalf("Failed to get metadata of %s: %v", index, err)
+		}
+		return meta.Aliases
+	}
+
+	for _, index := range []string{"logs_blue", "logs_green"} {
+		if w := do("PUT", "/"+index, ""); w.Code != http.StatusOK {
+			t.Fatalf("Create %s: expected 200, got %d: %s", index, w.Code, w.Body.String())
+		}
+	}
+
+	t.Run("Swap", func(t *testing.T) {
+		w := do("POST", "/_aliases", `{"actions": [{"add": {"index": "logs_blue", "aliases": ["logs", "logs_read"]}}]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Add alias: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		w = do("POST", "/_aliases", `{"actions": [
+			{"remove": {"index": "logs_blue", "alias": "logs"}},
+			{"add": {"indices": ["logs_green"], "alias": "logs"}}
+		]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Swap alias: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if blue := aliasesOf("logs_blue"); len(blue) != 1 || blue[0] != "logs_read" {
+			t.Errorf("Expected logs_blue aliases [logs_read], got %v", blue)
+		}
+		if green := aliasesOf("logs_green"); len(green) != 1 || green[0] != "logs" {
+			t.Errorf("Expected logs_green aliases [logs], got %v", green)
+		}
+	})
+
+	t.Run("AllOrNothing", func(t *testing.T) {
+		// 第一个操作有效，第二个操作删除不存在的别名：整个请求失败，第一个操作也不生效
+		w := do("POST", "/_aliases", `{"actions": [
+			{"add": {"index": "logs_blue", "alias": "logs"}},
+			{"remove": {"index": "logs_green", "alias": "missing"}}
+		]}`)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Expected 404, got %d: %s", w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), "aliases_not_found_exception") {
+			t.Errorf("Expected aliases_not_found_exception, got %s", w.Body.String())
+		}
+		if blue := aliasesOf("logs_blue"); len(blue) != 1 || blue[0] != "logs_read" {
+			t.Errorf("Expected logs_blue to be unchanged, got %v", blue)
+		}
+
+		// must_exist=false 时忽略不存在的别名
+		w = do("POST", "/_aliases", `{"actions": [{"remove": {"index": "logs_green", "alias": "missing", "must_exist": false}}]}`)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected 200 with must_exist=false, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("PerActionErrors", func(t *testing.T) {
+		w := do("POST", "/_aliases", `{"actions": [
+			{"add": {"index": "missing_index", "alias": "a"}},
+			{"add": {"index": "logs_blue", "alias": "logs_green"}},
+			{"add": {"index": "logs_blue", "alias": "ok"}},
+			{"rename": {"index": "logs_blue"}}
+		]}`)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Expected status of the first failure (404), got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Error struct {
+				Type    string `json:"type"`
+				Reason  string `json:"reason"`
+				Context struct {
+					FailedActions []struct {
+						Action int `json:"action"`
+						Error  struct {
+							Type string `json:"type"`
+						} `json:"error"`
+					} `json:"failed_actions"`
+				} `json:"context"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse error response: %v", err)
+		}
+		failed := resp.Error.Context.FailedActions
+		if len(failed) != 3 || failed[0].Action != 0 || failed[1].Action != 1 || failed[2].Action != 3 {
+			t.Fatalf("Expected actions 0, 1 and 3 to fail, got %+v", failed)
+		}
+		if failed[0].Error.Type != "index_not_found_exception" || failed[1].Error.Type != "invalid_alias_name_exception" {
+			t.Errorf("Unexpected failure types: %+v", failed)
+		}
+		if !strings.Contains(resp.Error.Reason, "3 of 4 alias actions failed") {
+			t.Errorf("Unexpected reason: %s", resp.Error.Reason)
+		}
+		if containsAlias(aliasesOf("logs_blue"), "ok") {
+			t.Errorf("Expected valid action not to be applied when others fail")
+		}
+	})
+}
+
+func TestDocumentHandler_FilteredAliasSearch(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+		{Method: "PUT", Path: "/{index}/_alias/{name}", Handler: indexHandler.PutAlias},
+		{Method: "GET", Path: "/{index}/_alias", Handler: indexHandler.GetAlias},
+		{Method: "POST", Path: "/_aliases", Handler: indexHandler.UpdateAliases},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	hitIDs := func(w *httptest.ResponseRecorder) []string {
+		var resp struct {
+			Hits struct {
+				Hits []struct {
+					ID string `json:"_id"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode search response: %v", err)
+		}
+		var ids []string
+		for _, hit := range resp.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return ids
+	}
+
+	// 创建索引时定义带 filter 的别名
+	createBody := `{
+		"mappings":{"properties":{"tenant":{"type":"keyword"},"status":{"type":"keyword"}}},
+		"aliases":{"tenant_a":{"filter":{"term":{"tenant":"a"}},"routing":"a"}}
+	}`
+	if w := do("PUT", "/shared", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := map[string]string{
+		"1": `{"tenant":"a","status":"open"}`,
+		"2": `{"tenant":"a","status":"closed"}`,
+		"3": `{"tenant":"b","status":"open"}`,
+	}
+	for id, doc := range docs {
+		if w := do("PUT", "/shared/_doc/"+id+"?refresh=true", doc); w.Code >= 300 {
+			t.Fatalf("index doc %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+	if w := do("PUT", "/shared/_alias/tenant_b", `{"filter":{"term":{"tenant":"b"}}}`); w.Code != http.StatusOK {
+		t.Fatalf("put alias: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do("POST", "/tenant_a/_search", `{"query":{"term":{"status":"open"}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search alias: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if ids := hitIDs(w); len(ids) != 1 || ids[0] != "1" {
+		t.Errorf("Expected filtered alias to match doc 1 only, got %v", ids)
+	}
+	if ids := hitIDs(do("POST", "/tenant_b/_search", `{}`)); len(ids) != 1 || ids[0] != "3" {
+		t.Errorf("Expected tenant_b to see doc 3 only, got %v", ids)
+	}
+	w = do("POST", "/tenant_a/_count", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"count":2`) {
+		t.Errorf("Expected count 2 through tenant_a, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// GET 别名返回 filter 和路由
+	w = do("GET", "/shared/_alias", "")
+	var aliasResp map[string]struct {
+		Aliases map[string]map[string]interface{} `json:"aliases"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &aliasResp); err != nil {
+		t.Fatalf("decode alias response: %v", err)
+	}
+	tenantA := aliasResp["shared"].Aliases["tenant_a"]
+	if tenantA["filter"] == nil || tenantA["index_routing"] != "a" || tenantA["search_routing"] != "a" {
+		t.Errorf("Expected tenant_a filter and routing, got %v", tenantA)
+	}
+
+	// 重新添加不带 filter 的别名后可以看到全部文档
+	if w := do("POST", "/_aliases", `{"actions":[{"add":{"index":"shared","alias":"tenant_b"}}]}`); w.Code != http.StatusOK {
+		t.Fatalf("update aliases: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if ids := hitIDs(do("POST", "/tenant_b/_search", `{}`)); len(ids) != 3 {
+		t.Errorf("Expected unfiltered alias to see all docs, got %v", ids)
+	}
+
+	// 无效的 filter 和不存在的别名
+	if w := do("PUT", "/shared/_alias/bad", `{"filter":{"no_such_query":{}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid alias filter, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/missing/_search", `{}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown alias, got %d", w.Code)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"strings"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// resolveSearchTarget 将搜索目标解析为实际索引：索引名直接返回；别名返回其指向的索引和别名 filter（没有 filter 时为 nil）
+// 目前不支持跨索引搜索，指向多个索引的别名返回 400
+func (h *DocumentHandler) resolveSearchTarget(name string) (string, map[string]interface{}, common.APIError) {
+	if h.dirMgr.IndexExists(name) {
+		return name, nil, nil
+	}
+
+	metas, err := h.metaStore.ListIndexMetadata()
+	if err != nil {
+		logger.Warn("Failed to list index metadata while resolving alias [%s]: %v", name, err)
+		return "", nil, common.NewIndexNotFoundError(name)
+	}
+	var indices []string
+	var filter map[string]interface{}
+	for _, meta := range metas {
+		if !containsAlias(meta.Aliases, name) || !h.dirMgr.IndexExists(meta.Name) {
+			continue
+		}
+		indices = append(indices, meta.Name)
+		if def := meta.AliasDefinitions[name]; def != nil {
+			filter = def.Filter
+		}
+	}
+
+	switch len(indices) {
+	case 0:
+		return "", nil, common.NewIndexNotFoundError(name)
+	case 1:
+		return indices[0], filter, nil
+	default:
+		return "", nil, common.NewBadRequestError("alias [" + name + "] points to multiple indices [" + strings.Join(indices, ", ") + "], searching multiple indices is not supported")
+	}
+}
+
+// applyAliasFilter 将别名 filter 以 bool.filter 的形式与原查询组合（原查询为空时匹配全部文档）
+func applyAliasFilter(query, filter map[string]interface{}) map[string]interface{} {
+	if filter == nil {
+		return query
+	}
+	if query == nil {
+		query = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   []interface{}{query},
+			"filter": []interface{}{filter},
+		},
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+)
+
+// APIKeyHandler API Key 管理（_security/api_key）
+// 受角色限制的请求（字段级、文档级安全）不能管理 API Key
+type APIKeyHandler struct {
+	keys *middleware.APIKeyService
+}
+
+// NewAPIKeyHandler 创建 API Key 处理器
+func NewAPIKeyHandler(keys *middleware.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// checkManagePrivilege 受角色限制的请求返回 403
+func checkManagePrivilege(r *http.Request) common.APIError {
+	if len(middleware.RolesFromContext(r.Context())) > 0 {
+		return common.NewForbiddenError("action [cluster:admin/xpack/security/api_key] is unauthorized for requests restricted by roles")
+	}
+	return nil
+}
+
+// CreateAPIKey 创建 API Key，Key 明文只在响应中返回一次
+// POST/PUT /_security/api_key
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if apiErr := checkManagePrivilege(r); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	var body struct {
+		Name         string   `json:"name"`
+		Expiration   string   `json:"expiration"`
+		Roles        []string `json:"roles"`
+		RateLimitRPM int      `json:"rate_limit_rpm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	expiration, err := parseTimeValue(body.Expiration)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError("invalid [expiration]: "+err.Error()))
+		return
+	}
+
+	key, secret, err := h.keys.Create(body.Name, expiration, body.Roles, body.RateLimitRPM)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+
+	response := map[string]interface{}{
+		"id":      key.ID,
+		"name":    key.Name,
+		"api_key": secret,
+	}
+	if !key.Expiration.IsZero() {
+		response["expiration"] = key.Expiration.UnixMilli()
+	}
+	writeAPIKeyResponse(w, response)
+}
+
+// GetAPIKeys 列出可用（未撤销、未过期）的 API Key，不返回 Key 明文
+// GET /_security/api_key?id=&name=
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if apiErr := checkManagePrivilege(r); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	id, name := r.URL.Query().Get("id"), r.URL.Query().Get("name")
+
+	apiKeys := make([]map[string]interface{}, 0)
+	for _, key := range h.keys.List() {
+		if (id != "" && key.ID != id) || (name != "" && key.Name != name) {
+			continue
+		}
+		item := map[string]interface{}{
+			"id":          key.ID,
+			"name":        key.Name,
+			"invalidated": false,
+		}
+		if !key.CreatedAt.IsZero() {
+			item["creation"] = key.CreatedAt.UnixMilli()
+		}
+		if !key.Expiration.IsZero() {
+			item["expiration"] = key.Expiration.UnixMilli()
+		}
+		if len(key.Roles) > 0 {
+			item["roles"] = key.Roles
+		}
+		if key.RateLimitRPM > 0 {
+			item["rate_limit_rpm"] = key.RateLimitRPM
+		}
+		apiKeys = append(apiKeys, item)
+	}
+	writeAPIKeyResponse(w, map[string]interface{}{"api_keys": apiKeys})
+}
+
+// InvalidateAPIKeys 撤销 API Key（按 ids、id 或 name），撤销后立即不能再用于认证
+// DELETE /_security/api_key
+func (h *APIKeyHandler) InvalidateAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if apiErr := checkManagePrivilege(r); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	var body struct {
+		ID   string   `json:"id"`
+		IDs  []string `json:"ids"`
+		Name string   `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	ids := body.IDs
+	if body.ID != "" {
+		ids = append(ids, body.ID)
+	}
+	if len(ids) == 0 && body.Name == "" {
+		common.HandleError(w, common.NewBadRequestError("one of [ids], [id] or [name] must be specified"))
+		return
+	}
+
+	invalidated, previously, err := h.keys.Invalidate(ids, body.Name)
+	if err != nil {
+		logger.Error("Failed to invalidate api keys: %v", err)
+		common.HandleError(w, common.NewInternalServerError("failed to invalidate api keys: "+err.Error()))
+		return
+	}
+	if invalidated == nil {
+		invalidated = []string{}
+	}
+	if previously == nil {
+		previously = []string{}
+	}
+	writeAPIKeyResponse(w, map[string]interface{}{
+		"invalidated_api_keys":            invalidated,
+		"previously_invalidated_api_keys": previously,
+		"error_count":                     0,
+	})
+}
+
+func writeAPIKeyResponse(w http.ResponseWriter, response map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode api key response: %v", err)
+	}
+}
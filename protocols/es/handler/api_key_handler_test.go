@@ -0,0 +1,129 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+)
+
+func TestAPIKeyHandler(t *testing.T) {
+	metaStore, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{StorageType: "memory"})
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	config := &middleware.AuthConfig{
+		Enabled: true,
+		Type:    "apikey",
+		Roles:   map[string]*middleware.Role{"reader": {Indices: []middleware.RoleIndexPrivileges{{Names: []string{"logs"}}}}},
+		APIKeyDefs: []*middleware.APIKeyConfig{
+			{ID: "admin", Name: "admin", Key: "admin-key"},
+			{ID: "old", Name: "old", Key: "expired-key", Expiration: time.Now().Add(-time.Hour)},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	keys, err := middleware.NewAPIKeyService(config, metaStore)
+	if err != nil {
+		t.Fatalf("NewAPIKeyService: %v", err)
+	}
+	h := NewAPIKeyHandler(keys)
+	router := server.NewRouter()
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_security/api_key", Handler: h.CreateAPIKey},
+		{Method: "GET", Path: "/_security/api_key", Handler: h.GetAPIKeys},
+		{Method: "DELETE", Path: "/_security/api_key", Handler: h.InvalidateAPIKeys},
+	})
+	handler := middleware.AuthMiddleware(config, keys)(router.Build())
+
+	do := func(apiKey, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", apiKey)
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("expired-key", "GET", "/_security/api_key", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an expired key, got %d", w.Code)
+	}
+
+	// 创建带限流的 Key，Key 明文只在创建响应中返回
+	w := do("admin-key", "POST", "/_security/api_key", `{"name": "ingest", "expiration": "1d", "rate_limit_rpm": 2}`)
+	var created struct {
+		ID         string `json:"id"`
+		APIKey     string `json:"api_key"`
+		Expiration int64  `json:"expiration"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body.String())
+	}
+	if created.APIKey == "" || created.Expiration <= time.Now().UnixMilli() {
+		t.Fatalf("Unexpected create response: %s", w.Body.String())
+	}
+	if w := do("admin-key", "POST", "/_security/api_key", `{"name": "bad", "roles": ["missing"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown role, got %d", w.Code)
+	}
+
+	w = do("admin-key", "GET", "/_security/api_key", "")
+	var listed struct {
+		APIKeys []map[string]interface{} `json:"api_keys"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(listed.APIKeys) != 2 || strings.Contains(w.Body.String(), created.APIKey) {
+		t.Errorf("Expected admin and ingest keys without secrets, got %s", w.Body.String())
+	}
+
+	// 按 Key 限流
+	if do(created.APIKey, "GET", "/_security/api_key", "").Code != http.StatusOK || do(created.APIKey, "GET", "/_security/api_key", "").Code != http.StatusOK {
+		t.Fatalf("Expected the first 2 requests of the new key to pass")
+	}
+	if w := do(created.APIKey, "GET", "/_security/api_key", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 after exceeding the key rate limit, got %d", w.Code)
+	}
+	if w := do("admin-key", "GET", "/_security/api_key", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected other keys not to be rate limited, got %d", w.Code)
+	}
+
+	// 撤销后立即不能认证，重新加载后撤销仍然生效
+	w = do("admin-key", "DELETE", "/_security/api_key", `{"ids": ["`+created.ID+`"]}`)
+	if !strings.Contains(w.Body.String(), `"invalidated_api_keys":["`+created.ID+`"]`) {
+		t.Fatalf("invalidate: unexpected response %s", w.Body.String())
+	}
+	if w := do(created.APIKey, "GET", "/_security/api_key", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a revoked key, got %d", w.Code)
+	}
+	if w := do("admin-key", "DELETE", "/_security/api_key", `{"id": "admin"}`); !strings.Contains(w.Body.String(), `"invalidated_api_keys":["admin"]`) {
+		t.Fatalf("invalidate config key: unexpected response %s", w.Body.String())
+	}
+	reloaded, err := middleware.NewAPIKeyService(config, metaStore)
+	if err != nil {
+		t.Fatalf("NewAPIKeyService: %v", err)
+	}
+	if reloaded.Authenticate("admin-key") != nil || reloaded.Authenticate(created.APIKey) != nil {
+		t.Errorf("Expected revoked keys to stay revoked after reload")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/numeric"
+	"github.com/lscgzwd/tiggerdb/search"
+)
+
+// parseCardinalityAggregation 解析cardinality聚合
+// {"cardinality": {"field": "user_id", "precision_threshold": 100, "missing": "N/A"}}
+// 去重计数由 bleve 的 cardinality facet 基于 HyperLogLog++ 完成：
+// 不同值数量不超过 precision_threshold（默认 3000，最大 40000）时结果精确，超过后为近似值
+func (h *DocumentHandler) parseCardinalityAggregation(config map[string]interface{}) (*bleve.FacetRequest, error) {
+	field, ok := config["field"].(string)
+	if !ok || field == "" {
+		return nil, fmt.Errorf("cardinality aggregation requires a 'field' parameter")
+	}
+
+	precisionThreshold := search.DefaultPrecisionThreshold
+	if v, ok := config["precision_threshold"]; ok {
+		threshold, ok := v.(float64)
+		if !ok || threshold < 0 {
+			return nil, fmt.Errorf("[precision_threshold] must be a non-negative number, got [%v]", v)
+		}
+		precisionThreshold = int(threshold)
+		// 与 ES 一致：超过上限时按上限处理
+		if precisionThreshold > search.MaxPrecisionThreshold {
+			precisionThreshold = search.MaxPrecisionThreshold
+		}
+		if precisionThreshold == 0 {
+			// 0 表示尽量少占内存，直接使用寄存器估算
+			precisionThreshold = 1
+		}
+	}
+
+	facetReq := bleve.NewCardinalityFacetRequest(field, precisionThreshold)
+	if missing, ok := config["missing"]; ok && missing != nil {
+		facetReq.SetCardinalityMissing(cardinalityMissingTerm(missing))
+	}
+	return facetReq, nil
+}
+
+// cardinalityMissingTerm 将 missing 参数编码为与索引中词项一致的形式，
+// 使缺失值与已有的相同值只被计数一次
+func cardinalityMissingTerm(missing interface{}) []byte {
+	switch v := missing.(type) {
+	case float64:
+		return numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(v), 0)
+	case bool:
+		if v {
+			return []byte("T")
+		}
+		return []byte("F")
+	case string:
+		return []byte(v)
+	default:
+		return []byte(fmt.Sprintf("%v", v))
+	}
+}
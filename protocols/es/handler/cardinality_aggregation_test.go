@@ -0,0 +1,126 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_CardinalityAggregation(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/visits", `{"mappings":{"properties":{"user":{"type":"keyword"},"page":{"type":"keyword"},"amount":{"type":"long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	// 8 个文档：user 有 5 个不同值，amount 有 4 个不同值，最后一个文档缺少 user 和 amount
+	docs := []string{
+		`{"user":"u1","page":"home","amount":10}`,
+		`{"user":"u2","page":"home","amount":10}`,
+		`{"user":"u3","page":"home","amount":20}`,
+		`{"user":"u1","page":"cart","amount":30}`,
+		`{"user":"u4","page":"cart","amount":40}`,
+		`{"user":"u5","page":"cart","amount":40}`,
+		`{"user":"u2","page":"cart","amount":20}`,
+		`{"page":"cart"}`,
+	}
+	for i, doc := range docs {
+		if w := do("PUT", fmt.Sprintf("/visits/_doc/%d?refresh=true", i), doc); w.Code >= 300 {
+			t.Fatalf("index %d: got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("POST", "/visits/_search", `{"size":0,"aggs":{
+		"users":{"cardinality":{"field":"user"}},
+		"amounts":{"cardinality":{"field":"amount","precision_threshold":100}},
+		"users_missing":{"cardinality":{"field":"user","missing":"anonymous"}},
+		"amounts_missing":{"cardinality":{"field":"amount","missing":10}},
+		"pages":{"terms":{"field":"page"},"aggs":{"users":{"cardinality":{"field":"user"}}}}
+	}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+	}
+	type valueResult struct {
+		Value float64 `json:"value"`
+	}
+	var resp struct {
+		Aggregations struct {
+			Users          valueResult `json:"users"`
+			Amounts        valueResult `json:"amounts"`
+			UsersMissing   valueResult `json:"users_missing"`
+			AmountsMissing valueResult `json:"amounts_missing"`
+			Pages          struct {
+				Buckets []struct {
+					Key          string                 `json:"key"`
+					Aggregations map[string]valueResult `json:"aggregations"`
+				} `json:"buckets"`
+			} `json:"pages"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	aggs := resp.Aggregations
+
+	tests := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{"users", aggs.Users.Value, 5},
+		{"amounts", aggs.Amounts.Value, 4},
+		// 缺失值作为一个新的不同值
+		{"users_missing", aggs.UsersMissing.Value, 6},
+		// 缺失值与已有的 10 相同，不增加计数
+		{"amounts_missing", aggs.AmountsMissing.Value, 4},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, tt.got)
+		}
+	}
+
+	// 桶内子聚合：home 的用户为 u1,u2,u3，cart 的用户为 u1,u2,u4,u5
+	expectedPages := map[string]float64{"home": 3, "cart": 4}
+	if len(aggs.Pages.Buckets) != len(expectedPages) {
+		t.Fatalf("pages: expected %d buckets, got %d", len(expectedPages), len(aggs.Pages.Buckets))
+	}
+	for _, b := range aggs.Pages.Buckets {
+		if got := b.Aggregations["users"].Value; got != expectedPages[b.Key] {
+			t.Errorf("pages[%s]: expected %v users, got %v", b.Key, expectedPages[b.Key], got)
+		}
+	}
+}
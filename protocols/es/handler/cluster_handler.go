@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/lscgzwd/tiggerdb/directory"
 	"github.com/lscgzwd/tiggerdb/logger"
@@ -28,9 +29,10 @@ import (
 
 // ClusterHandler 集群处理器
 type ClusterHandler struct {
-	indexMgr  *es.IndexManager
-	dirMgr    directory.DirectoryManager
-	metaStore metadata.MetadataStore
+	indexMgr        *es.IndexManager
+	dirMgr          directory.DirectoryManager
+	metaStore       metadata.MetadataStore
+	clusterSettings *ClusterSettings
 }
 
 // ClusterHealthResponse 集群健康响应结构体 - 按照 Elasticsearch 标准顺序定义字段
@@ -55,12 +57,18 @@ type ClusterHealthResponse struct {
 // NewClusterHandler 创建新的集群处理器
 func NewClusterHandler(indexMgr *es.IndexManager, dirMgr directory.DirectoryManager, metaStore metadata.MetadataStore) *ClusterHandler {
 	return &ClusterHandler{
-		indexMgr:  indexMgr,
-		dirMgr:    dirMgr,
-		metaStore: metaStore,
+		indexMgr:        indexMgr,
+		dirMgr:          dirMgr,
+		metaStore:       metaStore,
+		clusterSettings: NewClusterSettings(metaStore, nil),
 	}
 }
 
+// ClusterSettings 返回集群动态设置
+func (h *ClusterHandler) ClusterSettings() *ClusterSettings {
+	return h.clusterSettings
+}
+
 // Ping 检查服务器是否可用
 // GET /_ping, HEAD /_ping
 func (h *ClusterHandler) Ping(w http.ResponseWriter, r *http.Request) {
@@ -69,7 +77,7 @@ func (h *ClusterHandler) Ping(w http.ResponseWriter, r *http.Request) {
 		"name":         NodeName,
 		"cluster_name": ClusterName,
 		"version": map[string]interface{}{
-			"number": ESVersionNumber,
+			"number": ESVersion(),
 		},
 	}
 
@@ -89,17 +97,28 @@ func (h *ClusterHandler) Ping(w http.ResponseWriter, r *http.Request) {
 // GET /_cluster/health
 func (h *ClusterHandler) ClusterHealth(w http.ResponseWriter, r *http.Request) {
 	// 获取所有索引
-	indices, err := h.dirMgr.ListIndices()
+	indices, err := listTenantIndices(r.Context(), h.dirMgr)
 	if err != nil {
 		logger.Error("Failed to list indices for cluster health: %v", err)
 		// 返回默认的健康状态
 		indices = []string{}
 	}
 
-	// 计算集群状态
-	clusterStatus := ClusterStatusGreen // 单节点模式下，始终返回green状态
-	activePrimaryShards := len(indices)
-	activeShards := len(indices)
+	// 计算集群状态：单节点模式下每个索引一个主分片，启动恢复失败被隔离的索引分片未分配，集群为red
+	clusterStatus := ClusterStatusGreen
+	unassignedShards := 0
+	for _, indexName := range indices {
+		if h.indexMgr.Quarantined(indexName) != nil {
+			unassignedShards++
+		}
+	}
+	activePrimaryShards := len(indices) - unassignedShards
+	activeShards := activePrimaryShards
+	activeShardsPercent := ActiveShardsPercent
+	if unassignedShards > 0 {
+		clusterStatus = ClusterStatusRed
+		activeShardsPercent = 100 * float64(activeShards) / float64(len(indices))
+	}
 
 	// 使用结构体构建响应，确保类型安全和可维护性
 	response := ClusterHealthResponse{
@@ -112,12 +131,12 @@ func (h *ClusterHandler) ClusterHealth(w http.ResponseWriter, r *http.Request) {
 		ActiveShards:                activeShards,
 		RelocatingShards:            0,
 		InitializingShards:          0,
-		UnassignedShards:            0,
+		UnassignedShards:            unassignedShards,
 		DelayedUnassignedShards:     0,
 		NumberOfPendingTasks:        0,
 		NumberOfInFlightFetch:       0,
 		TaskMaxWaitingInQueueMillis: 0,
-		ActiveShardsPercentAsNumber: ActiveShardsPercent,
+		ActiveShardsPercentAsNumber: activeShardsPercent,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -132,7 +151,7 @@ func (h *ClusterHandler) ClusterHealth(w http.ResponseWriter, r *http.Request) {
 // GET /_cluster/state
 func (h *ClusterHandler) ClusterState(w http.ResponseWriter, r *http.Request) {
 	// 获取所有索引
-	indices, err := h.dirMgr.ListIndices()
+	indices, err := listTenantIndices(r.Context(), h.dirMgr)
 	if err != nil {
 		logger.Error("Failed to list indices for cluster state: %v", err)
 		indices = []string{}
@@ -209,7 +228,7 @@ func (h *ClusterHandler) NodesInfo(w http.ResponseWriter, r *http.Request) {
 				"transport_address":     NodeTransportAddress,
 				"host":                  "127.0.0.1",
 				"ip":                    "127.0.0.1",
-				"version":               ESVersionNumber,
+				"version":               ESVersion(),
 				"build_flavor":          "default",
 				"build_type":            "release",
 				"build_hash":            ESBuildHash,
@@ -247,6 +266,46 @@ func (h *ClusterHandler) NodesInfo(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// NodesStats 获取节点统计信息（当前输出 scroll 统计）
+// GET /_nodes/stats
+func (h *ClusterHandler) NodesStats(w http.ResponseWriter, r *http.Request) {
+	scroll := GetScrollManager().Stats()
+	stats := map[string]interface{}{
+		"_nodes": map[string]interface{}{
+			"total":      1,
+			"successful": 1,
+			"failed":     0,
+		},
+		"cluster_name": ClusterName,
+		"nodes": map[string]interface{}{
+			NodeName: map[string]interface{}{
+				"timestamp":         time.Now().UnixMilli(),
+				"name":              NodeName,
+				"transport_address": NodeTransportAddress,
+				"host":              "127.0.0.1",
+				"ip":                "127.0.0.1",
+				"roles":             []string{"master", "data", "ingest"},
+				"indices": map[string]interface{}{
+					"search": map[string]interface{}{
+						"open_contexts":         scroll.Open,
+						"scroll_total":          scroll.Total,
+						"scroll_time_in_millis": scroll.TotalTime,
+						"scroll_current":        scroll.Open,
+					},
+				},
+				"scroll": scroll,
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(stats); err != nil {
+		logger.Error("Failed to encode nodes stats response: %v", err)
+	}
+}
+
 // CatNodes 获取节点列表（cat API格式）
 // GET /_cat/nodes
 func (h *ClusterHandler) CatNodes(w http.ResponseWriter, r *http.Request) {
@@ -262,7 +321,7 @@ func (h *ClusterHandler) CatNodes(w http.ResponseWriter, r *http.Request) {
 // GET /_cat/indices
 func (h *ClusterHandler) CatIndices(w http.ResponseWriter, r *http.Request) {
 	// 获取所有索引
-	indices, err := h.dirMgr.ListIndices()
+	indices, err := listTenantIndices(r.Context(), h.dirMgr)
 	if err != nil {
 		logger.Error("Failed to list indices for cat indices: %v", err)
 		indices = []string{}
@@ -285,6 +344,10 @@ func (h *ClusterHandler) CatIndices(w http.ResponseWriter, r *http.Request) {
 	result := make([]map[string]interface{}, 0, len(indices))
 	for _, indexName := range indices {
 		item := make(map[string]interface{})
+		health := ClusterStatusGreen
+		if h.indexMgr.Quarantined(indexName) != nil {
+			health = ClusterStatusRed
+		}
 
 		// 如果指定了列，只返回指定的列；否则返回所有列
 		if len(columns) > 0 {
@@ -293,7 +356,7 @@ func (h *ClusterHandler) CatIndices(w http.ResponseWriter, r *http.Request) {
 				case "index":
 					item["index"] = indexName
 				case "health":
-					item["health"] = "green"
+					item["health"] = health
 				case "status":
 					item["status"] = "open"
 				case "uuid":
@@ -314,7 +377,7 @@ func (h *ClusterHandler) CatIndices(w http.ResponseWriter, r *http.Request) {
 			}
 		} else {
 			// 默认返回所有列
-			item["health"] = "green"
+			item["health"] = health
 			item["status"] = "open"
 			item["index"] = indexName
 			item["uuid"] = "N/A"
@@ -342,7 +405,7 @@ func (h *ClusterHandler) CatIndices(w http.ResponseWriter, r *http.Request) {
 // GET /_cluster/stats
 func (h *ClusterHandler) ClusterStats(w http.ResponseWriter, r *http.Request) {
 	// 获取所有索引
-	indices, err := h.dirMgr.ListIndices()
+	indices, err := listTenantIndices(r.Context(), h.dirMgr)
 	if err != nil {
 		logger.Error("Failed to list indices for cluster stats: %v", err)
 		indices = []string{}
@@ -387,7 +450,7 @@ func (h *ClusterHandler) ClusterStats(w http.ResponseWriter, r *http.Request) {
 				"remote_cluster_client": 0,
 				"transform":             0,
 			},
-			"versions": []string{ESVersionNumber},
+			"versions": []string{ESVersion()},
 			"os": map[string]interface{}{
 				"available_processors": 8,
 				"allocated_processors": 8,
@@ -460,7 +523,7 @@ func (h *ClusterHandler) ClusterStats(w http.ResponseWriter, r *http.Request) {
 // GET /_cat/shards
 func (h *ClusterHandler) CatShards(w http.ResponseWriter, r *http.Request) {
 	// 获取所有索引
-	indices, err := h.dirMgr.ListIndices()
+	indices, err := listTenantIndices(r.Context(), h.dirMgr)
 	if err != nil {
 		logger.Error("Failed to list indices for cat shards: %v", err)
 		indices = []string{}
@@ -0,0 +1,106 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestClusterHealth_QuarantinedIndex(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	clusterHandler := NewClusterHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "GET", Path: "/_cluster/health", Handler: clusterHandler.ClusterHealth},
+		{Method: "GET", Path: "/_cat/indices", Handler: clusterHandler.CatIndices},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	health := func() ClusterHealthResponse {
+		t.Helper()
+		w := do("GET", "/_cluster/health", "")
+		var resp ClusterHealthResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode health: %v: %s", err, w.Body.String())
+		}
+		return resp
+	}
+
+	for _, name := range []string{"good", "bad"} {
+		if w := do("PUT", "/"+name, `{}`); w.Code != http.StatusOK {
+			t.Fatalf("create [%s]: got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+	if resp := health(); resp.Status != ClusterStatusGreen || resp.ActivePrimaryShards != 2 {
+		t.Fatalf("expected green with 2 active shards, got %+v", resp)
+	}
+
+	// 模拟重启：关闭所有索引，损坏 bad 的快照元数据后重新执行启动恢复
+	if err := indexMgr.CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+	rootBolt := filepath.Join(indexHandler.dirMgr.GetIndexPath("bad"), "store", "store", "root.bolt")
+	if err := os.WriteFile(rootBolt, []byte("corrupted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result := indexMgr.RecoverAllIndices()
+	if len(result.Quarantined) != 1 || result.Quarantined[0] != "bad" {
+		t.Fatalf("expected [bad] quarantined, got %+v", result)
+	}
+
+	resp := health()
+	if resp.Status != ClusterStatusRed || resp.ActivePrimaryShards != 1 || resp.UnassignedShards != 1 ||
+		resp.ActiveShardsPercentAsNumber != 50 {
+		t.Errorf("expected red with 1 unassigned shard, got %+v", resp)
+	}
+
+	var indices []map[string]interface{}
+	if err := json.Unmarshal(do("GET", "/_cat/indices", "").Body.Bytes(), &indices); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range indices {
+		expected := ClusterStatusGreen
+		if item["index"] == "bad" {
+			expected = ClusterStatusRed
+		}
+		if item["health"] != expected {
+			t.Errorf("index [%v]: expected health %s, got %v", item["index"], expected, item["health"])
+		}
+	}
+
+	if w := do("POST", "/good/_search", `{}`); w.Code != http.StatusOK {
+		t.Errorf("search healthy index: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/bad/_search", `{}`); w.Code == http.StatusOK || !strings.Contains(w.Body.String(), "quarantined") {
+		t.Errorf("search quarantined index: expected failure, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,446 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/index/scorch"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	es "github.com/lscgzwd/tiggerdb/protocols/es/index"
+	"github.com/lscgzwd/tiggerdb/script"
+)
+
+// 集群动态设置（PUT /_cluster/settings）
+// 生效值优先级：transient > persistent > 配置文件（defaults）；persistent 通过元数据存储持久化，重启后恢复，
+// transient 只保存在内存中。设置为 null 表示删除，恢复为下一优先级的值。
+
+// clusterSettingDef 动态设置定义
+type clusterSettingDef struct {
+	// parse 校验设置值并转换为 apply 使用的类型
+	parse func(value string) (interface{}, error)
+	// apply 使设置值生效
+	apply func(value interface{})
+}
+
+// 支持的动态设置
+var clusterSettingDefs = map[string]clusterSettingDef{
+	"logger.level": {
+		parse: parseLogLevelSetting,
+		apply: func(v interface{}) { logger.SetLevel(logger.ParseLevel(v.(string))) },
+	},
+	"search.slowlog.threshold.query.warn":  slowlogThresholdSetting("warn"),
+	"search.slowlog.threshold.query.info":  slowlogThresholdSetting("info"),
+	"search.slowlog.threshold.query.debug": slowlogThresholdSetting("debug"),
+	"script.cache.max_size": {
+		parse: parsePositiveIntSetting,
+		apply: func(v interface{}) { script.GetGlobalCache().SetMaxSize(v.(int)) },
+	},
+	"indices.terms_dictionary.max_size": {
+		parse: parsePositiveIntSetting,
+		apply: func(v interface{}) { es.SetMaxTermsDictionarySize(v.(int)) },
+	},
+	"search.aggregation.max_concurrency": {
+		parse: parseNonNegativeIntSetting,
+		apply: func(v interface{}) { SetAggregationConcurrency(v.(int)) },
+	},
+	"search.mget.max_concurrency": {
+		parse: parseNonNegativeIntSetting,
+		apply: func(v interface{}) { SetMultiGetConcurrency(v.(int)) },
+	},
+	"cluster.routing.allocation.disk.threshold_enabled": {
+		parse: parseBoolSetting,
+		apply: func(v interface{}) {
+			updateDiskThreshold(func(s *diskThresholdSettings) { s.enabled = v.(bool) })
+		},
+	},
+	"cluster.routing.allocation.disk.watermark.low": diskWatermarkSetting(func(s *diskThresholdSettings, w diskWatermark) {
+		s.low = w
+	}),
+	"cluster.routing.allocation.disk.watermark.high": diskWatermarkSetting(func(s *diskThresholdSettings, w diskWatermark) {
+		s.high = w
+	}),
+	"cluster.routing.allocation.disk.watermark.flood_stage": diskWatermarkSetting(func(s *diskThresholdSettings, w diskWatermark) {
+		s.floodStage = w
+	}),
+	"cluster.info.update.interval": {
+		parse: parseUpdateIntervalSetting,
+		apply: func(v interface{}) {
+			updateDiskThreshold(func(s *diskThresholdSettings) { s.updateInterval = v.(time.Duration) })
+		},
+	},
+	// 后台合并限流（见 merge_throttle.go）
+	mergeThrottleSetting:       mergeThrottleSettingDef,
+	mergeMaxConcurrencySetting: mergeMaxConcurrencySettingDef,
+	// scroll 上限（见 scroll_manager.go）
+	maxOpenScrollSetting: maxOpenScrollSettingDef,
+	// 删除索引是否必须指定具体索引名（见 index_expression.go）
+	destructiveRequiresNameSetting: destructiveRequiresNameSettingDef,
+}
+
+// 动态设置的内置默认值（配置文件未指定时使用）
+var builtinClusterSettingDefaults = map[string]string{
+	"logger.level":                         "info",
+	"search.slowlog.threshold.query.warn":  "-1",
+	"search.slowlog.threshold.query.info":  "-1",
+	"search.slowlog.threshold.query.debug": "-1",
+	"script.cache.max_size":                "1000",
+	"indices.terms_dictionary.max_size":    strconv.Itoa(es.DefaultMaxTermsDictionarySize),
+	"search.aggregation.max_concurrency":   "0",
+	"search.mget.max_concurrency":          "0",
+	// 磁盘水位保护（见 disk_watermark.go）
+	"cluster.routing.allocation.disk.threshold_enabled":     "true",
+	"cluster.routing.allocation.disk.watermark.low":         "85%",
+	"cluster.routing.allocation.disk.watermark.high":        "90%",
+	"cluster.routing.allocation.disk.watermark.flood_stage": "95%",
+	"cluster.info.update.interval":                          "30s",
+	// 后台合并限流（见 merge_throttle.go）
+	mergeThrottleSetting:       defaultMergeThrottleSetting,
+	mergeMaxConcurrencySetting: strconv.Itoa(scorch.DefaultMaxConcurrentMerges),
+	// scroll 上限（见 scroll_manager.go）
+	maxOpenScrollSetting: strconv.Itoa(DefaultMaxOpenScrolls),
+	// 删除索引是否必须指定具体索引名（见 index_expression.go）
+	destructiveRequiresNameSetting: "false",
+}
+
+func slowlogThresholdSetting(level string) clusterSettingDef {
+	return clusterSettingDef{
+		parse: func(value string) (interface{}, error) {
+			if strings.TrimSpace(value) == "-1" {
+				return time.Duration(-1), nil
+			}
+			d, err := parseTimeValue(value)
+			if err != nil || value == "" {
+				return nil, fmt.Errorf("failed to parse value [%s] as a time value: unit is missing or unrecognized", value)
+			}
+			return d, nil
+		},
+		apply: func(v interface{}) { setSearchSlowlogThreshold(level, v.(time.Duration)) },
+	}
+}
+
+func parseLogLevelSetting(value string) (interface{}, error) {
+	switch strings.ToLower(value) {
+	case "debug", "info", "warn", "warning", "error", "silent":
+		return strings.ToLower(value), nil
+	}
+	return nil, fmt.Errorf("unknown level constant [%s]", value)
+}
+
+func parsePositiveIntSetting(value string) (interface{}, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("failed to parse value [%s], must be a positive integer", value)
+	}
+	return n, nil
+}
+
+func parseNonNegativeIntSetting(value string) (interface{}, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("failed to parse value [%s], must be >= 0", value)
+	}
+	return n, nil
+}
+
+// clusterSettingString 将请求中的设置值转换为字符串（ES 以字符串形式保存和返回设置值）
+func clusterSettingString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// ClusterSettings 集群动态设置
+type ClusterSettings struct {
+	mu         sync.Mutex
+	metaStore  metadata.MetadataStore
+	defaults   map[string]string
+	persistent map[string]string
+	transient  map[string]string
+}
+
+// NewClusterSettings 创建集群动态设置，defaults 为配置文件中的值（未指定的使用内置默认值）
+func NewClusterSettings(metaStore metadata.MetadataStore, defaults map[string]string) *ClusterSettings {
+	cs := &ClusterSettings{
+		metaStore:  metaStore,
+		persistent: make(map[string]string),
+		transient:  make(map[string]string),
+	}
+	cs.defaults = mergeClusterSettingDefaults(defaults)
+	return cs
+}
+
+func mergeClusterSettingDefaults(defaults map[string]string) map[string]string {
+	merged := make(map[string]string, len(builtinClusterSettingDefaults))
+	for k, v := range builtinClusterSettingDefaults {
+		merged[k] = v
+	}
+	for k, v := range defaults {
+		if _, ok := clusterSettingDefs[k]; ok && v != "" {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// Load 读取持久化的 persistent 设置并使所有设置生效
+func (cs *ClusterSettings) Load() error {
+	stored, err := cs.metaStore.GetClusterSettings()
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for key, value := range stored {
+		str := clusterSettingString(value)
+		if _, err := cs.parse(key, str); err != nil {
+			logger.Warn("Ignoring invalid persistent cluster setting [%s]: %v", key, err)
+			continue
+		}
+		cs.persistent[key] = str
+	}
+	cs.applyAll()
+	return nil
+}
+
+// SetDefaults 替换配置文件中的值（配置重新加载时调用），动态设置仍然优先
+func (cs *ClusterSettings) SetDefaults(defaults map[string]string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.defaults = mergeClusterSettingDefaults(defaults)
+	cs.applyAll()
+}
+
+func (cs *ClusterSettings) parse(key, value string) (interface{}, error) {
+	def, ok := clusterSettingDefs[key]
+	if !ok {
+		return nil, fmt.Errorf("setting [%s], not recognized", key)
+	}
+	v, err := def.parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse setting [%s]: %v", key, err)
+	}
+	return v, nil
+}
+
+// effective 返回设置的生效值
+func (cs *ClusterSettings) effective(key string) string {
+	if v, ok := cs.transient[key]; ok {
+		return v
+	}
+	if v, ok := cs.persistent[key]; ok {
+		return v
+	}
+	return cs.defaults[key]
+}
+
+// applyAll 使所有设置的生效值生效（调用方持有锁）
+func (cs *ClusterSettings) applyAll() {
+	for key, def := range clusterSettingDefs {
+		v, err := def.parse(cs.effective(key))
+		if err != nil {
+			logger.Warn("Ignoring invalid cluster setting [%s]: %v", key, err)
+			continue
+		}
+		def.apply(v)
+	}
+}
+
+// Update 更新 persistent/transient 设置（值为 nil 表示删除），全部校验通过后才生效
+// 返回本次实际生效的更新（扁平格式）；持久化失败时返回 common.APIError
+func (cs *ClusterSettings) Update(persistent, transient map[string]interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	flatPersistent := flattenIndexSettings(persistent)
+	flatTransient := flattenIndexSettings(transient)
+	for scope, updates := range map[string]map[string]interface{}{"persistent": flatPersistent, "transient": flatTransient} {
+		for key, value := range updates {
+			if _, ok := clusterSettingDefs[key]; !ok {
+				return nil, nil, fmt.Errorf("%s setting [%s], not recognized", scope, key)
+			}
+			if value == nil {
+				continue
+			}
+			if _, err := cs.parse(key, clusterSettingString(value)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	nextPersistent := applyClusterSettingUpdates(cs.persistent, flatPersistent)
+	if len(flatPersistent) > 0 {
+		stored := make(map[string]interface{}, len(nextPersistent))
+		for k, v := range nextPersistent {
+			stored[k] = v
+		}
+		if err := cs.metaStore.SaveClusterSettings(stored); err != nil {
+			return nil, nil, common.NewInternalServerError("failed to save persistent cluster settings: " + err.Error())
+		}
+	}
+	cs.persistent = nextPersistent
+	cs.transient = applyClusterSettingUpdates(cs.transient, flatTransient)
+	cs.applyAll()
+
+	return acknowledgedClusterSettings(flatPersistent), acknowledgedClusterSettings(flatTransient), nil
+}
+
+func applyClusterSettingUpdates(current map[string]string, updates map[string]interface{}) map[string]string {
+	next := make(map[string]string, len(current)+len(updates))
+	for k, v := range current {
+		next[k] = v
+	}
+	for k, v := range updates {
+		if v == nil {
+			delete(next, k)
+		} else {
+			next[k] = clusterSettingString(v)
+		}
+	}
+	return next
+}
+
+func acknowledgedClusterSettings(updates map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range updates {
+		if v != nil {
+			result[k] = clusterSettingString(v)
+		}
+	}
+	return result
+}
+
+// snapshot 返回 persistent、transient 与所有设置的生效值（扁平格式）
+func (cs *ClusterSettings) snapshot() (map[string]interface{}, map[string]interface{}, map[string]interface{}) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	persistent := make(map[string]interface{}, len(cs.persistent))
+	for k, v := range cs.persistent {
+		persistent[k] = v
+	}
+	transient := make(map[string]interface{}, len(cs.transient))
+	for k, v := range cs.transient {
+		transient[k] = v
+	}
+	defaults := make(map[string]interface{}, len(cs.defaults))
+	for k := range clusterSettingDefs {
+		defaults[k] = cs.defaults[k]
+	}
+	return persistent, transient, defaults
+}
+
+// renderClusterSettings 按 flat_settings 参数输出扁平或嵌套格式
+func renderClusterSettings(flat map[string]interface{}, flatSettings bool) map[string]interface{} {
+	if flatSettings {
+		return flat
+	}
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	nested := make(map[string]interface{})
+	for _, k := range keys {
+		parts := strings.Split(k, ".")
+		current := nested
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := current[part].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				current[part] = next
+			}
+			current = next
+		}
+		current[parts[len(parts)-1]] = flat[k]
+	}
+	return nested
+}
+
+// GetClusterSettings 获取集群设置
+// GET /_cluster/settings?flat_settings=true&include_defaults=true
+func (h *ClusterHandler) GetClusterSettings(w http.ResponseWriter, r *http.Request) {
+	flatSettings := r.URL.Query().Get("flat_settings") == "true"
+	persistent, transient, defaults := h.clusterSettings.snapshot()
+
+	response := map[string]interface{}{
+		"persistent": renderClusterSettings(persistent, flatSettings),
+		"transient":  renderClusterSettings(transient, flatSettings),
+	}
+	if r.URL.Query().Get("include_defaults") == "true" {
+		response["defaults"] = renderClusterSettings(defaults, flatSettings)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode cluster settings response: %v", err)
+	}
+}
+
+// PutClusterSettings 更新集群动态设置
+// PUT /_cluster/settings {"persistent": {...}, "transient": {...}}
+func (h *ClusterHandler) PutClusterSettings(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Persistent map[string]interface{} `json:"persistent"`
+		Transient  map[string]interface{} `json:"transient"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	if len(body.Persistent) == 0 && len(body.Transient) == 0 {
+		common.HandleError(w, common.NewBadRequestError("no settings to update"))
+		return
+	}
+
+	persistent, transient, err := h.clusterSettings.Update(body.Persistent, body.Transient)
+	if err != nil {
+		logger.Error("Failed to update cluster settings: %v", err)
+		if apiErr, ok := err.(common.APIError); ok {
+			common.HandleError(w, apiErr)
+		} else {
+			common.HandleError(w, common.NewBadRequestError(err.Error()))
+		}
+		return
+	}
+
+	flatSettings := r.URL.Query().Get("flat_settings") == "true"
+	response := map[string]interface{}{
+		"acknowledged": true,
+		"persistent":   renderClusterSettings(persistent, flatSettings),
+		"transient":    renderClusterSettings(transient, flatSettings),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode cluster settings response: %v", err)
+	}
+}
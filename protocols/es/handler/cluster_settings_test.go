@@ -0,0 +1,160 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+)
+
+func TestClusterHandler_ClusterSettings(t *testing.T) {
+	metaStore, err := metadata.NewFileMetadataStore(&metadata.MetadataStoreConfig{
+		StorageType:      "file",
+		FilePath:         t.TempDir() + "/meta",
+		EnableCache:      true,
+		EnableVersioning: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	originalLevel := logger.GetGlobalLogger().GetLevel()
+	defer func() {
+		logger.SetLevel(originalLevel)
+		for _, level := range []string{"warn", "info", "debug"} {
+			setSearchSlowlogThreshold(level, -1)
+		}
+	}()
+
+	h := NewClusterHandler(nil, nil, metaStore)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/_cluster/settings", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.PutClusterSettings(w, req)
+		return w
+	}
+	get := func(query string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/_cluster/settings"+query, nil)
+		w := httptest.NewRecorder()
+		h.GetClusterSettings(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET _cluster/settings: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("TransientLogLevel", func(t *testing.T) {
+		w := put(`{"transient": {"logger.level": "debug"}}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if level := logger.GetGlobalLogger().GetLevel(); level != logger.LevelDebug {
+			t.Errorf("Expected logger level DEBUG, got %s", level)
+		}
+
+		resp := get("")
+		transient, _ := resp["transient"].(map[string]interface{})
+		loggerSettings, _ := transient["logger"].(map[string]interface{})
+		if loggerSettings["level"] != "debug" {
+			t.Errorf("Expected nested transient logger.level debug, got %v", resp["transient"])
+		}
+
+		resp = get("?flat_settings=true")
+		transient, _ = resp["transient"].(map[string]interface{})
+		if transient["logger.level"] != "debug" {
+			t.Errorf("Expected flat transient logger.level debug, got %v", resp["transient"])
+		}
+	})
+
+	t.Run("PersistentSlowlogThreshold", func(t *testing.T) {
+		w := put(`{"persistent": {"search": {"slowlog": {"threshold": {"query": {"warn": "0ms"}}}}}}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := time.Duration(slowlogWarnThreshold.Load()); got != 0 {
+			t.Errorf("Expected warn threshold 0, got %s", got)
+		}
+
+		stored, err := metaStore.GetClusterSettings()
+		if err != nil {
+			t.Fatalf("Failed to get stored cluster settings: %v", err)
+		}
+		if stored["search.slowlog.threshold.query.warn"] != "0ms" {
+			t.Errorf("Expected persisted warn threshold 0ms, got %v", stored)
+		}
+
+		// 重新加载时恢复 persistent 设置
+		setSearchSlowlogThreshold("warn", -1)
+		reloaded := NewClusterSettings(metaStore, nil)
+		if err := reloaded.Load(); err != nil {
+			t.Fatalf("Failed to load cluster settings: %v", err)
+		}
+		if got := time.Duration(slowlogWarnThreshold.Load()); got != 0 {
+			t.Errorf("Expected warn threshold restored to 0, got %s", got)
+		}
+	})
+
+	t.Run("ResetToDefault", func(t *testing.T) {
+		w := put(`{"transient": {"logger.level": null}}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if level := logger.GetGlobalLogger().GetLevel(); level != logger.LevelInfo {
+			t.Errorf("Expected logger level reset to INFO, got %s", level)
+		}
+		resp := get("?flat_settings=true&include_defaults=true")
+		transient, _ := resp["transient"].(map[string]interface{})
+		if _, ok := transient["logger.level"]; ok {
+			t.Errorf("Expected transient logger.level to be removed, got %v", transient)
+		}
+		defaults, _ := resp["defaults"].(map[string]interface{})
+		if defaults["logger.level"] != "info" {
+			t.Errorf("Expected default logger.level info, got %v", defaults["logger.level"])
+		}
+	})
+
+	t.Run("InvalidSettings", func(t *testing.T) {
+		w := put(`{"persistent": {"unknown.setting": "1"}}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for unknown setting, got %d", w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "persistent setting [unknown.setting], not recognized") {
+			t.Errorf("Unexpected error body: %s", w.Body.String())
+		}
+
+		w = put(`{"transient": {"script.cache.max_size": "abc"}}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for invalid value, got %d", w.Code)
+		}
+
+		w = put(`{}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for empty body, got %d", w.Code)
+		}
+	})
+}
@@ -14,9 +14,11 @@
 
 package handler
 
+import "sync"
+
 // Elasticsearch兼容性配置常量
 const (
-	// ESVersionNumber Elasticsearch版本号（用于兼容性）
+	// ESVersionNumber 默认的Elasticsearch版本号（用于兼容性，可通过 SetESVersion 覆盖）
 	ESVersionNumber = "7.10.2"
 	// ESBuildHash Elasticsearch构建哈希
 	ESBuildHash = "747e1cc71def077253878a59143c1f785afa92b9"
@@ -48,3 +50,25 @@ const (
 	// ActiveShardsPercent 活动分片百分比（单节点模式）
 	ActiveShardsPercent = 100.0
 )
+
+var (
+	esVersionMu sync.RWMutex
+	esVersion   = ESVersionNumber
+)
+
+// SetESVersion 设置对外声明的 ES 版本号（GET /、节点信息等），为空时恢复默认版本
+func SetESVersion(version string) {
+	if version == "" {
+		version = ESVersionNumber
+	}
+	esVersionMu.Lock()
+	defer esVersionMu.Unlock()
+	esVersion = version
+}
+
+// ESVersion 返回对外声明的 ES 版本号
+func ESVersion() string {
+	esVersionMu.RLock()
+	defer esVersionMu.RUnlock()
+	return esVersion
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/numeric"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// maxDateHistogramBuckets 与 ES search.max_buckets 的默认值相同
+const maxDateHistogramBuckets = 65536
+
+// DateHistogramAggregationInfo date_histogram聚合信息
+type DateHistogramAggregationInfo struct {
+	Aggregations map[string]*DateHistogramAggregationConfig
+}
+
+// DateHistogramAggregationConfig date_histogram聚合配置
+// ES格式: {"date_histogram": {"field": "timestamp", "calendar_interval": "1d", "time_zone": "+08:00", "format": "yyyy-MM-dd", "min_doc_count": 0}}
+// 日历间隔按 time_zone 的本地时间对齐（天从本地零点开始，夏令时切换当天的桶长度随之变化），固定间隔按本地时间的偏移对齐
+type DateHistogramAggregationConfig struct {
+	Field           string
+	Interval        rollupInterval
+	Location        *time.Location
+	Offset          time.Duration // 桶起点的偏移（offset 参数，如 "+6h"）
+	Format          string
+	MinDocCount     int
+	BoundsMin       time.Time // extended_bounds：min_doc_count 为 0 时补齐到该范围
+	BoundsMax       time.Time
+	Keyed           bool
+	SubAggregations map[string]map[string]interface{} // 子聚合配置
+}
+
+// parseDateHistogramAggregation 解析date_histogram聚合
+// calendar_interval 与 fixed_interval 二选一，旧的 interval 参数按日历单位或固定间隔解析
+func (h *DocumentHandler) parseDateHistogramAggregation(config map[string]interface{}, subAggs map[string]map[string]interface{}) (*DateHistogramAggregationConfig, error) {
+	field, ok := config["field"].(string)
+	if !ok || field == "" {
+		return nil, fmt.Errorf("date_histogram aggregation requires a 'field' parameter")
+	}
+	dhConfig := &DateHistogramAggregationConfig{Field: field, SubAggregations: subAggs}
+
+	calendar, _ := config["calendar_interval"].(string)
+	fixed, _ := config["fixed_interval"].(string)
+	legacy, _ := config["interval"].(string)
+	var err error
+	switch {
+	case calendar != "" && fixed == "":
+		dhConfig.Interval, err = parseCalendarInterval(calendar)
+	case fixed != "" && calendar == "":
+		dhConfig.Interval, err = parseFixedInterval(fixed)
+	case legacy != "" && calendar == "" && fixed == "":
+		if dhConfig.Interval, err = parseCalendarInterval(legacy); err != nil {
+			dhConfig.Interval, err = parseFixedInterval(legacy)
+		}
+	default:
+		return nil, fmt.Errorf("date_histogram aggregation requires exactly one of [calendar_interval] or [fixed_interval]")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zone, _ := config["time_zone"].(string)
+	if dhConfig.Location, err = parseTimeZone(zone); err != nil {
+		return nil, err
+	}
+	dhConfig.Format, _ = config["format"].(string)
+	if v, ok := config["offset"].(string); ok && v != "" {
+		sign := time.Duration(1)
+		if v[0] == '-' || v[0] == '+' {
+			if v[0] == '-' {
+				sign = -1
+			}
+			v = v[1:]
+		}
+		offset, err := parseFixedInterval(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid [offset] [%s] in date_histogram aggregation", config["offset"])
+		}
+		dhConfig.Offset = sign * offset.fixed
+	}
+	if v, ok := config["min_doc_count"]; ok {
+		minDocCount, ok := v.(float64)
+		if !ok || minDocCount < 0 {
+			return nil, fmt.Errorf("[min_doc_count] must be a non-negative integer, got [%v]", v)
+		}
+		dhConfig.MinDocCount = int(minDocCount)
+	}
+	if bounds, ok := config["extended_bounds"].(map[string]interface{}); ok {
+		now := time.Now()
+		for key, target := range map[string]*time.Time{"min": &dhConfig.BoundsMin, "max": &dhConfig.BoundsMax} {
+			if v, ok := bounds[key]; ok && v != nil {
+				if *target, err = parseDateMathBound(v, dhConfig.Format, dhConfig.Location, now, false); err != nil {
+					return nil, fmt.Errorf("invalid [extended_bounds] [%s]: %w", key, err)
+				}
+			}
+		}
+	}
+	dhConfig.Keyed, _ = config["keyed"].(bool)
+	return dhConfig, nil
+}
+
+// bucketStart 返回 t 所在桶的起始时间
+func (c *DateHistogramAggregationConfig) bucketStart(t time.Time) time.Time {
+	return c.Interval.floor(t.Add(-c.Offset), c.Location).Add(c.Offset)
+}
+
+// nextBucket 返回桶 start 的下一个桶的起始时间
+func (c *DateHistogramAggregationConfig) nextBucket(start time.Time) time.Time {
+	return c.Interval.next(start.Add(-c.Offset)).Add(c.Offset)
+}
+
+// buildDateHistogramAggregations 构建date_histogram聚合响应
+func (h *DocumentHandler) buildDateHistogramAggregations(ctx context.Context, info *DateHistogramAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+	aggs := make(map[string]interface{}, len(info.Aggregations))
+	var mu sync.Mutex
+	tasks := make([]func(), 0, len(info.Aggregations))
+	for aggName, dhAgg := range info.Aggregations {
+		tasks = append(tasks, func() {
+			result, err := h.buildDateHistogramAggregation(ctx, aggName, dhAgg, idx, baseQuery)
+			if err != nil {
+				logger.Warn("Failed to build date_histogram aggregation [%s]: %v", aggName, err)
+				result = map[string]interface{}{"buckets": []interface{}{}}
+			}
+			mu.Lock()
+			aggs[aggName] = result
+			mu.Unlock()
+		})
+	}
+	aggPool.run(tasks)
+
+	return aggs
+}
+
+// buildDateHistogramAggregation 构建单个date_histogram聚合响应
+// 统计字段的全部日期词项（shift 为 0 的 PrefixCoded 纳秒时间戳），按桶起点汇总，桶按时间升序排列；
+// min_doc_count 为 0 时补齐首尾（及 extended_bounds）之间的空桶
+func (h *DocumentHandler) buildDateHistogramAggregation(ctx context.Context, aggName string, dhAgg *DateHistogramAggregationConfig, idx bleve.Index, baseQuery query.Query) (map[string]interface{}, error) {
+	req := bleve.NewSearchRequest(baseQuery)
+	req.Size = 0
+	req.AddFacet(dhAgg.Field, bleve.NewFacetRequest(dhAgg.Field, math.MaxInt32))
+	result, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int)
+	var first, last time.Time
+	observe := func(start time.Time) {
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if last.IsZero() || start.After(last) {
+			last = start
+		}
+	}
+	if facet, ok := result.Facets[dhAgg.Field]; ok && facet.Terms != nil {
+		for _, term := range facet.Terms.Terms() {
+			prefixCoded := numeric.PrefixCoded(term.Term)
+			if shift, err := prefixCoded.Shift(); err != nil || shift != 0 {
+				continue
+			}
+			nanos, err := prefixCoded.Int64()
+			if err != nil {
+				continue
+			}
+			start := dhAgg.bucketStart(time.Unix(0, nanos))
+			counts[start.UnixMilli()] += term.Count
+			observe(start)
+		}
+	}
+
+	var keys []int64
+	if dhAgg.MinDocCount == 0 {
+		for _, bound := range []time.Time{dhAgg.BoundsMin, dhAgg.BoundsMax} {
+			if !bound.IsZero() {
+				observe(dhAgg.bucketStart(bound))
+			}
+		}
+		if !first.IsZero() {
+			for t := first; !t.After(last); t = dhAgg.nextBucket(t) {
+				if len(keys) >= maxDateHistogramBuckets {
+					return nil, fmt.Errorf("trying to create too many buckets, must be less than or equal to [%d]", maxDateHistogramBuckets)
+				}
+				keys = append(keys, t.UnixMilli())
+			}
+		}
+	} else {
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	}
+
+	buckets := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		count := counts[key]
+		if count < dhAgg.MinDocCount {
+			continue
+		}
+		buckets = append(buckets, map[string]interface{}{
+			"key_as_string": formatDateValueIn(time.UnixMilli(key), dhAgg.Format, dhAgg.Location),
+			"key":           key,
+			"doc_count":     count,
+		})
+	}
+
+	if len(dhAgg.SubAggregations) > 0 {
+		bucketTasks := make([]func(), 0, len(buckets))
+		for _, bucket := range buckets {
+			start := time.UnixMilli(bucket["key"].(int64)).In(dhAgg.Location)
+			rangeQuery := query.NewDateRangeQuery(start, dhAgg.nextBucket(start))
+			rangeQuery.SetField(dhAgg.Field)
+			bucketQuery := query.NewBooleanQuery([]query.Query{baseQuery, rangeQuery}, nil, nil)
+			bucketTasks = append(bucketTasks, func() {
+				if subAggResults := h.buildNestedAggregationsForBucket(ctx, aggName, bucket["key"], dhAgg.SubAggregations, idx, bucketQuery); len(subAggResults) > 0 {
+					bucket["aggregations"] = subAggResults
+				}
+			})
+		}
+		aggPool.run(bucketTasks)
+	}
+
+	if dhAgg.Keyed {
+		keyed := make(map[string]interface{}, len(buckets))
+		for _, bucket := range buckets {
+			keyed[bucket["key_as_string"].(string)] = bucket
+		}
+		return map[string]interface{}{"buckets": keyed}, nil
+	}
+	return map[string]interface{}{"buckets": buckets}, nil
+}
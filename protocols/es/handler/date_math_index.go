@@ -0,0 +1,196 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 日期数学索引名
+// 请求路径中的索引名可以写成 <static_name{date_math_expr{date_format|time_zone}}>，在路由匹配之前按当前时间解析，
+// 如 <logs-{now/d}> 解析为 logs-2024.03.13、<logs-{now/M{yyyy.MM}}> 解析为 logs-2024.03。
+// date_format 默认为 yyyy.MM.dd，time_zone 默认为 UTC；静态部分中的 { } 需要用 \ 转义。
+
+// defaultDateMathIndexFormat 日期数学索引名的默认日期格式
+const defaultDateMathIndexFormat = "yyyy.MM.dd"
+
+// DateMathIndexMiddleware 在路由匹配之前将请求路径中的日期数学索引名解析为具体的索引名
+func DateMathIndexMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if !strings.HasPrefix(path, "/") || !strings.Contains(path, "<") {
+			next(w, r)
+			return
+		}
+		// 索引表达式为第一个路径段，表达式中 {} 内的 "/"（如 now/d）不分隔路径
+		end := len(path)
+		depth := 0
+		for i := 1; i < len(path); i++ {
+			if path[i] == '\\' {
+				i++
+			} else if path[i] == '{' {
+				depth++
+			} else if path[i] == '}' && depth > 0 {
+				depth--
+			} else if path[i] == '/' && depth == 0 {
+				end = i
+				break
+			}
+		}
+		expr := path[1:end]
+		if !strings.Contains(expr, "<") {
+			next(w, r)
+			return
+		}
+		if depth > 0 {
+			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("invalid dynamic name expression [%s]. date math placeholder is open ended", expr)))
+			return
+		}
+		resolved, err := resolveDateMathIndexExpression(expr, time.Now())
+		if err != nil {
+			common.HandleError(w, common.NewBadRequestError(err.Error()))
+			return
+		}
+		r.URL.Path = "/" + resolved + path[end:]
+		r.URL.RawPath = ""
+		next(w, r)
+	}
+}
+
+// resolveDateMathIndexExpression 解析逗号分隔的索引表达式中的日期数学索引名（包括排除项 -<...>）
+func resolveDateMathIndexExpression(expr string, now time.Time) (string, error) {
+	var parts []string
+	start, depth := 0, 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '\\':
+			i++
+		case '<':
+			depth++
+		case '>':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, expr[start:])
+
+	for i, part := range parts {
+		exclude := strings.HasPrefix(part, "-<")
+		if exclude {
+			part = part[1:]
+		}
+		name, err := resolveDateMathIndexName(part, now)
+		if err != nil {
+			return "", err
+		}
+		if exclude {
+			name = "-" + name
+		}
+		parts[i] = name
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// resolveDateMathIndexName 解析单个日期数学索引名，不是 <...> 形式时原样返回
+func resolveDateMathIndexName(name string, now time.Time) (string, error) {
+	if !strings.HasPrefix(name, "<") || !strings.HasSuffix(name, ">") {
+		return name, nil
+	}
+	text := name[1 : len(name)-1]
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("invalid dynamic name expression [%s]. "+format, append([]interface{}{text}, args...)...)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\\':
+			if i+1 >= len(text) {
+				return "", invalid("invalid escape character at the end of the expression")
+			}
+			i++
+			b.WriteByte(text[i])
+		case '}':
+			return "", invalid("invalid character at position [%d]. `{` and `}` are reserved characters and should be escaped when used as part of the index name using `\\` (e.g. `\\{text\\}`)", i)
+		case '{':
+			// 找到与之匹配的 }，其中可以嵌套一层 {date_format|time_zone}
+			end, depth := -1, 0
+			for j := i; j < len(text) && end < 0; j++ {
+				switch text[j] {
+				case '{':
+					depth++
+				case '}':
+					if depth--; depth == 0 {
+						end = j
+					}
+				}
+			}
+			if end < 0 {
+				return "", invalid("date math placeholder is open ended")
+			}
+			resolved, err := evalDateMathPlaceholder(text[i+1:end], now)
+			if err != nil {
+				return "", invalid("%v", err)
+			}
+			b.WriteString(resolved)
+			i = end
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// evalDateMathPlaceholder 计算占位符 date_math_expr{date_format|time_zone} 并按格式输出
+func evalDateMathPlaceholder(placeholder string, now time.Time) (string, error) {
+	mathExpr, format, zone := placeholder, defaultDateMathIndexFormat, ""
+	if i := strings.IndexByte(placeholder, '{'); i >= 0 {
+		if !strings.HasSuffix(placeholder, "}") {
+			return "", fmt.Errorf("missing closing `}` for date math format")
+		}
+		mathExpr = placeholder[:i]
+		spec := placeholder[i+1 : len(placeholder)-1]
+		if j := strings.IndexByte(spec, '|'); j >= 0 {
+			spec, zone = spec[:j], spec[j+1:]
+		}
+		if spec == "" {
+			return "", fmt.Errorf("missing date format")
+		}
+		format = spec
+	}
+	if !strings.HasPrefix(mathExpr, "now") {
+		return "", fmt.Errorf("date math expression [%s] must start with [now]", mathExpr)
+	}
+	loc, err := parseTimeZone(zone)
+	if err != nil {
+		return "", err
+	}
+	t, err := applyDateMath(now.In(loc), mathExpr[len("now"):], false)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(esDateFormatToLayout(strings.ReplaceAll(format, "uuuu", "yyyy"))), nil
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestResolveDateMathIndexExpression(t *testing.T) {
+	now := time.Date(2024, 3, 13, 22, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"logs", "logs"},
+		{"<logs-{now/d}>", "logs-2024.03.13"},
+		{"<logs-{now/d-1d}>", "logs-2024.03.12"},
+		{"<logs-{now/M{yyyy.MM}}>", "logs-2024.03"},
+		{"<logs-{now/d{yyyy.MM.dd|+02:00}}>", "logs-2024.03.14"},
+		{"<logs-{now/w{uuuu.MM.dd}}>", "logs-2024.03.11"},
+		{`<elastic\{ON\}-{now/M}>`, "elastic{ON}-2024.03.01"},
+		{"<logs-{now/d}>,<logs-{now/d-1d}>,-<logs-{now/d-2d}>", "logs-2024.03.13,logs-2024.03.12,-logs-2024.03.11"},
+		{"metrics,<logs-{now/y{yyyy}}>", "metrics,logs-2024"},
+	}
+	for _, tt := range tests {
+		got, err := resolveDateMathIndexExpression(tt.expr, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.expr, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.expr, tt.expected, got)
+		}
+	}
+
+	for _, expr := range []string{"<logs-{now/d>", "<logs-}>", "<logs-{2024.01.01}>", "<logs-{now/x}>", "<logs-{now/d{yyyy|Mars/Olympus}}>"} {
+		if _, err := resolveDateMathIndexExpression(expr, now); err == nil || !strings.Contains(err.Error(), "invalid dynamic name expression") {
+			t.Errorf("%s: expected invalid expression error, got %v", expr, err)
+		}
+	}
+}
+
+func TestDocumentHandler_DateMath(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+	})
+	handler := DateMathIndexMiddleware(router.Build().ServeHTTP)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		handler(w, req)
+		return w
+	}
+
+	// 客户端对日期数学索引名做 URL 编码
+	now := time.Now().UTC()
+	today := "logs-" + now.Format("2006.01.02")
+	if w := do("PUT", "/"+url.PathEscape("<logs-{now/d}>"), `{"mappings":{"properties":{"@timestamp":{"type":"date"}}}}`); w.Code != http.StatusOK ||
+		!strings.Contains(w.Body.String(), today) {
+		t.Fatalf("create index: expected 200 for %s, got %d: %s", today, w.Code, w.Body.String())
+	}
+	if !indexHandler.dirMgr.IndexExists(today) {
+		t.Fatalf("expected index %s to exist", today)
+	}
+
+	// 今天、昨天与前天的文档
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var bulk strings.Builder
+	for i, ts := range []time.Time{midnight.Add(time.Second), midnight.Add(-time.Hour), midnight.Add(-25 * time.Hour)} {
+		fmt.Fprintf(&bulk, "{\"index\":{\"_index\":%q,\"_id\":\"%d\"}}\n{\"@timestamp\":%q}\n", today, i, ts.Format(time.RFC3339))
+	}
+	if w := do("POST", "/_bulk?refresh=true", bulk.String()); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	count := func(path, q string) int {
+		t.Helper()
+		w := do("POST", path, `{"query":`+q+`}`)
+		var resp struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s %s: got %d: %s", path, q, w.Code, w.Body.String())
+		}
+		return resp.Count
+	}
+	countPath := "/" + url.PathEscape("<logs-{now/d}>") + "/_count"
+	for _, tt := range []struct {
+		query    string
+		expected int
+	}{
+		// gte/lt 向下取整，gt/lte 取整到该单位的最后一毫秒
+		{`{"range":{"@timestamp":{"gte":"now/d"}}}`, 1},
+		{`{"range":{"@timestamp":{"gt":"now-1d/d"}}}`, 1},
+		{`{"range":{"@timestamp":{"gte":"now-1d/d","lt":"now/d"}}}`, 1},
+		{`{"range":{"@timestamp":{"gte":"now-1d/d","lte":"now-1d/d"}}}`, 1},
+		{`{"range":{"@timestamp":{"lte":"now-1d/d"}}}`, 2},
+		{`{"range":{"@timestamp":{"lt":"now+1h"}}}`, 3},
+		{`{"term":{"@timestamp":"now-3d/d"}}`, 0},
+		{`{"term":{"@timestamp":"now-2d/d"}}`, 1},
+	} {
+		if got := count(countPath, tt.query); got != tt.expected {
+			t.Errorf("%s: expected %d documents, got %d", tt.query, tt.expected, got)
+		}
+	}
+
+	// 未编码的表达式
+	if got := count("/<logs-{now/d}>/_count", `{"match_all":{}}`); got != 3 {
+		t.Errorf("raw expression: expected 3 documents, got %d", got)
+	}
+
+	// date_range 聚合的边界同样支持日期数学表达式
+	w := do("POST", countPath[:len(countPath)-len("_count")]+"_search", `{"size":0,"aggs":{"days":{"date_range":{"field":"@timestamp",
+		"ranges":[{"key":"today","from":"now/d"},{"key":"yesterday","from":"now-1d/d","to":"now/d"}]}}}}`)
+	var resp struct {
+		Aggregations struct {
+			Days struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"days"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("date_range: got %d: %s", w.Code, w.Body.String())
+	}
+	for _, b := range resp.Aggregations.Days.Buckets {
+		if b.DocCount != 1 {
+			t.Errorf("date_range bucket %s: expected 1 document, got %d", b.Key, b.DocCount)
+		}
+	}
+	if len(resp.Aggregations.Days.Buckets) != 2 {
+		t.Errorf("date_range: expected 2 buckets, got %s", w.Body.String())
+	}
+
+	if w := do("POST", "/"+url.PathEscape("<logs-{now/d>")+"/_search", `{}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "invalid dynamic name expression") {
+		t.Errorf("invalid expression: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 磁盘水位保护
+// 后台按 cluster.info.update.interval 检查数据目录所在磁盘的使用情况，与 ES 的 DiskThresholdMonitor 对应：
+//   - 超过 low 水位：只记录警告日志
+//   - 超过 high 水位：不再分配新索引，创建索引返回 503 unavailable_shards_exception
+//   - 超过 flood_stage 水位：为所有索引设置 index.blocks.read_only_allow_delete，写入返回 429 cluster_block_exception，删除仍然允许
+//   - 回落到 high 水位以下：自动移除所有索引的 read_only_allow_delete block
+// 水位可以是已用空间的百分比/比例（"90%"、"0.9"），也可以是剩余空间的字节数（"10gb"）。
+
+// diskLevel 磁盘使用率所处的水位级别
+type diskLevel int
+
+const (
+	diskLevelNormal diskLevel = iota
+	diskLevelLow
+	diskLevelHigh
+	diskLevelFloodStage
+)
+
+func (l diskLevel) String() string {
+	switch l {
+	case diskLevelLow:
+		return "low"
+	case diskLevelHigh:
+		return "high"
+	case diskLevelFloodStage:
+		return "flood_stage"
+	}
+	return "normal"
+}
+
+// diskUsage 文件系统容量（字节），available 为非特权用户可用的空间
+type diskUsage struct {
+	total     uint64
+	free      uint64
+	available uint64
+}
+
+// usedPercent 已用空间百分比（按可用空间计算，与 ES 相同）
+func (u diskUsage) usedPercent() float64 {
+	if u.total == 0 {
+		return 0
+	}
+	return 100 * (1 - float64(u.available)/float64(u.total))
+}
+
+// diskWatermark 磁盘水位：percent 为已用空间百分比，isBytes 时为剩余空间字节数下限
+type diskWatermark struct {
+	raw     string
+	percent float64
+	bytes   uint64
+	isBytes bool
+}
+
+// exceeded 判断磁盘使用情况是否超过水位
+func (w diskWatermark) exceeded(u diskUsage) bool {
+	if w.isBytes {
+		return u.available < w.bytes
+	}
+	return u.usedPercent() > w.percent
+}
+
+// byteSizeUnits ES 字节单位（长单位在前，避免 "kb" 被识别为 "b"）
+var byteSizeUnits = []struct {
+	suffix string
+	unit   float64
+}{
+	{"pb", 1 << 50},
+	{"tb", 1 << 40},
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// parseDiskWatermark 解析磁盘水位设置：百分比（"85%"）、比例（"0.85"）或字节数（"500mb"）
+func parseDiskWatermark(value string) (interface{}, error) {
+	raw := strings.TrimSpace(value)
+	lower := strings.ToLower(raw)
+	if strings.HasSuffix(lower, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(lower, "%"), 64)
+		if err == nil && percent >= 0 && percent <= 100 {
+			return diskWatermark{raw: raw, percent: percent}, nil
+		}
+		return nil, fmt.Errorf("failed to parse [%s] as a percentage, must be between 0%% and 100%%", value)
+	}
+	if ratio, err := strconv.ParseFloat(lower, 64); err == nil {
+		if ratio >= 0 && ratio <= 1 {
+			return diskWatermark{raw: raw, percent: ratio * 100}, nil
+		}
+		return nil, fmt.Errorf("failed to parse [%s] as a ratio, must be between 0.0 and 1.0", value)
+	}
+	for _, u := range byteSizeUnits {
+		if !strings.HasSuffix(lower, u.suffix) {
+			continue
+		}
+		num, err := strconv.ParseFloat(strings.TrimSuffix(lower, u.suffix), 64)
+		if err != nil || num < 0 {
+			break
+		}
+		return diskWatermark{raw: raw, bytes: uint64(num * u.unit), isBytes: true}, nil
+	}
+	return nil, fmt.Errorf("failed to parse [%s] as a percentage, ratio or byte size value", value)
+}
+
+// diskThresholdSettings 磁盘水位相关的集群动态设置
+type diskThresholdSettings struct {
+	enabled        bool
+	low            diskWatermark
+	high           diskWatermark
+	floodStage     diskWatermark
+	updateInterval time.Duration
+}
+
+// level 返回磁盘使用情况所处的水位级别
+func (s diskThresholdSettings) level(u diskUsage) diskLevel {
+	switch {
+	case s.floodStage.exceeded(u):
+		return diskLevelFloodStage
+	case s.high.exceeded(u):
+		return diskLevelHigh
+	case s.low.exceeded(u):
+		return diskLevelLow
+	}
+	return diskLevelNormal
+}
+
+// watermark 返回级别对应的水位
+func (s diskThresholdSettings) watermark(l diskLevel) diskWatermark {
+	switch l {
+	case diskLevelFloodStage:
+		return s.floodStage
+	case diskLevelHigh:
+		return s.high
+	}
+	return s.low
+}
+
+var (
+	diskThresholdMu sync.RWMutex
+	diskThreshold   = diskThresholdSettings{
+		enabled:        true,
+		low:            diskWatermark{raw: "85%", percent: 85},
+		high:           diskWatermark{raw: "90%", percent: 90},
+		floodStage:     diskWatermark{raw: "95%", percent: 95},
+		updateInterval: 30 * time.Second,
+	}
+)
+
+// updateDiskThreshold 修改磁盘水位设置（集群动态设置生效时调用）
+func updateDiskThreshold(update func(s *diskThresholdSettings)) {
+	diskThresholdMu.Lock()
+	defer diskThresholdMu.Unlock()
+	update(&diskThreshold)
+}
+
+// currentDiskThreshold 返回当前生效的磁盘水位设置
+func currentDiskThreshold() diskThresholdSettings {
+	diskThresholdMu.RLock()
+	defer diskThresholdMu.RUnlock()
+	return diskThreshold
+}
+
+func diskWatermarkSetting(update func(s *diskThresholdSettings, w diskWatermark)) clusterSettingDef {
+	return clusterSettingDef{
+		parse: parseDiskWatermark,
+		apply: func(v interface{}) {
+			updateDiskThreshold(func(s *diskThresholdSettings) { update(s, v.(diskWatermark)) })
+		},
+	}
+}
+
+func parseBoolSetting(value string) (interface{}, error) {
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return nil, fmt.Errorf("failed to parse value [%s] as only [true] or [false] are allowed", value)
+}
+
+func parseUpdateIntervalSetting(value string) (interface{}, error) {
+	d, err := parseTimeValue(value)
+	if err != nil || d < time.Second {
+		return nil, fmt.Errorf("failed to parse value [%s], must be a time value >= 1s", value)
+	}
+	return d, nil
+}
+
+// DiskWatermarkMonitor 磁盘水位监控
+type DiskWatermarkMonitor struct {
+	indexHandler *IndexHandler
+	path         string
+	// statUsage 读取磁盘容量，测试中替换
+	statUsage func(path string) (diskUsage, error)
+
+	mu      sync.RWMutex
+	usage   diskUsage
+	level   diskLevel
+	checked bool
+	enabled bool
+	started bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDiskWatermarkMonitor 创建磁盘水位监控，path 为数据目录；调用 Start 后开始后台检查
+func NewDiskWatermarkMonitor(indexHandler *IndexHandler, path string) *DiskWatermarkMonitor {
+	return &DiskWatermarkMonitor{
+		indexHandler: indexHandler,
+		path:         path,
+		statUsage:    statDiskUsage,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start 立即检查一次并启动后台检查
+func (m *DiskWatermarkMonitor) Start() {
+	m.Check()
+	m.mu.Lock()
+	m.started = true
+	m.mu.Unlock()
+	go m.run()
+}
+
+// Close 停止后台检查
+func (m *DiskWatermarkMonitor) Close() {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+		m.mu.RLock()
+		started := m.started
+		m.mu.RUnlock()
+		if started {
+			<-m.done
+		}
+	})
+}
+
+// run 检查循环，每次检查后按最新的 cluster.info.update.interval 等待
+func (m *DiskWatermarkMonitor) run() {
+	defer close(m.done)
+	timer := time.NewTimer(currentDiskThreshold().updateInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-timer.C:
+			m.Check()
+			timer.Reset(currentDiskThreshold().updateInterval)
+		}
+	}
+}
+
+// Check 读取磁盘使用情况，按水位设置或移除索引的 read_only_allow_delete block
+func (m *DiskWatermarkMonitor) Check() {
+	settings := currentDiskThreshold()
+	if !settings.enabled {
+		m.mu.Lock()
+		m.enabled = false
+		m.level = diskLevelNormal
+		m.mu.Unlock()
+		return
+	}
+	usage, err := m.statUsage(m.path)
+	if err != nil {
+		logger.Warn("Failed to read disk usage of [%s], disk watermarks are not checked: %v", m.path, err)
+		return
+	}
+	level := settings.level(usage)
+
+	m.mu.Lock()
+	previous := m.level
+	if !m.checked {
+		previous = diskLevelNormal
+	}
+	m.usage = usage
+	m.level = level
+	m.checked = true
+	m.enabled = true
+	m.mu.Unlock()
+
+	if level != previous {
+		m.logLevelChange(settings, usage, previous, level)
+	}
+	switch {
+	case level == diskLevelFloodStage:
+		m.setReadOnlyAllowDelete(true)
+	case level < diskLevelHigh:
+		m.setReadOnlyAllowDelete(false)
+	}
+}
+
+func (m *DiskWatermarkMonitor) logLevelChange(settings diskThresholdSettings, usage diskUsage, previous, level diskLevel) {
+	if level < previous {
+		logger.Info("Disk usage of [%s] dropped below %s disk watermark [%s], used: %.1f%%",
+			m.path, previous, settings.watermark(previous).raw, usage.usedPercent())
+		return
+	}
+	var consequence string
+	switch level {
+	case diskLevelFloodStage:
+		consequence = "all indices will be marked read-only"
+	case diskLevelHigh:
+		consequence = "new indices will not be allocated"
+	default:
+		consequence = "disk is running low"
+	}
+	logger.Warn("%s disk watermark [%s] exceeded on [%s], free: %d bytes [%.1f%%], %s",
+		level, settings.watermark(level).raw, m.path, usage.available, 100-usage.usedPercent(), consequence)
+}
+
+// setReadOnlyAllowDelete 为所有索引设置（或移除）read_only_allow_delete block，只保存有变化的索引
+func (m *DiskWatermarkMonitor) setReadOnlyAllowDelete(blocked bool) {
+	metaStore := m.indexHandler.metaStore
+	indices, err := metaStore.ListIndexMetadata()
+	if err != nil {
+		logger.Error("Failed to list index metadata for disk watermark: %v", err)
+		return
+	}
+	const setting = "blocks.read_only_allow_delete"
+	for _, indexMeta := range indices {
+		if indexSettingBool(indexMeta.Settings, setting) == blocked {
+			continue
+		}
+		if blocked {
+			if indexMeta.Settings == nil {
+				indexMeta.Settings = make(map[string]interface{})
+			}
+			setIndexSetting(indexMeta.Settings, setting, true)
+		} else {
+			removeIndexSetting(indexMeta.Settings, setting)
+		}
+		indexMeta.UpdatedAt = time.Now()
+		if err := metaStore.SaveIndexMetadata(indexMeta.Name, indexMeta); err != nil {
+			logger.Error("Failed to update read_only_allow_delete block of index [%s]: %v", indexMeta.Name, err)
+			continue
+		}
+		if blocked {
+			logger.Warn("Index [%s] marked read-only-allow-delete, disk usage exceeded flood-stage watermark", indexMeta.Name)
+		} else {
+			logger.Info("Released read-only-allow-delete block of index [%s]", indexMeta.Name)
+		}
+	}
+}
+
+// allocationError 磁盘超过 high 水位时拒绝分配新索引
+func (m *DiskWatermarkMonitor) allocationError(indexName string) common.APIError {
+	m.mu.RLock()
+	usage, level, enabled := m.usage, m.level, m.enabled
+	m.mu.RUnlock()
+	if !enabled || level < diskLevelHigh {
+		return nil
+	}
+	settings := currentDiskThreshold()
+	return common.NewUnavailableShardsError(indexName, fmt.Sprintf(
+		"primary shard cannot be allocated, the node is above the high watermark cluster setting "+
+			"[cluster.routing.allocation.disk.watermark.high=%s], actual free: [%.1f%%]",
+		settings.high.raw, 100-usage.usedPercent()))
+}
+
+// ReadinessCheck 磁盘水位就绪检查：超过 flood_stage 水位（索引被设为只读）时返回错误
+func (m *DiskWatermarkMonitor) ReadinessCheck(ctx context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.enabled && m.level == diskLevelFloodStage {
+		return fmt.Errorf("disk usage of [%s] exceeded flood_stage watermark [%s], used: %.1f%%",
+			m.path, currentDiskThreshold().floodStage.raw, m.usage.usedPercent())
+	}
+	return nil
+}
+
+// Stats 最近一次检查的磁盘使用情况（通过 /_metrics 暴露）
+func (m *DiskWatermarkMonitor) Stats() interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	settings := currentDiskThreshold()
+	return map[string]interface{}{
+		"path":               m.path,
+		"threshold_enabled":  settings.enabled,
+		"total_in_bytes":     m.usage.total,
+		"free_in_bytes":      m.usage.free,
+		"available_in_bytes": m.usage.available,
+		"used_percent":       m.usage.usedPercent(),
+		"level":              m.level.String(),
+		"watermark": map[string]interface{}{
+			"low":         settings.low.raw,
+			"high":        settings.high.raw,
+			"flood_stage": settings.floodStage.raw,
+		},
+	}
+}
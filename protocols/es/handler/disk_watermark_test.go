@@ -0,0 +1,220 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDiskWatermarkMonitor(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "DELETE", Path: "/{index}/_doc/{id}", Handler: docHandler.DeleteDocument},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// 磁盘容量 100GB，used 为已用百分比
+	var mu sync.Mutex
+	used := uint64(50)
+	monitor := NewDiskWatermarkMonitor(indexHandler, indexHandler.dirMgr.GetBaseDir())
+	monitor.statUsage = func(path string) (diskUsage, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		const total = 100 << 30
+		return diskUsage{total: total, free: total - used*(1<<30), available: total - used*(1<<30)}, nil
+	}
+	setUsed := func(percent uint64) {
+		mu.Lock()
+		used = percent
+		mu.Unlock()
+		monitor.Check()
+	}
+	indexHandler.SetDiskWatermarkMonitor(monitor)
+	monitor.Start()
+	defer monitor.Close()
+
+	if w := do("PUT", "/logs", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if w := do("PUT", "/logs/_doc/"+id, `{"msg":"a"}`); w.Code != http.StatusCreated {
+			t.Fatalf("index doc %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	// 超过 low 水位：不影响任何操作
+	setUsed(87)
+	if w := do("PUT", "/low", `{}`); w.Code != http.StatusOK {
+		t.Errorf("create index above low watermark: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 超过 high 水位：拒绝创建新索引，已有索引仍可写入
+	setUsed(92)
+	if w := do("PUT", "/high", `{}`); w.Code != http.StatusServiceUnavailable ||
+		!strings.Contains(w.Body.String(), "unavailable_shards_exception") ||
+		!strings.Contains(w.Body.String(), "cluster.routing.allocation.disk.watermark.high=90%") {
+		t.Errorf("create index above high watermark: expected 503 got %d: %s", w.Code, w.Body.String())
+	}
+	if indexHandler.dirMgr.IndexExists("high") {
+		t.Errorf("index should not be created above high watermark")
+	}
+	if w := do("PUT", "/logs/_doc/4", `{"msg":"a"}`); w.Code != http.StatusCreated {
+		t.Errorf("index doc above high watermark: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 超过 flood_stage 水位：所有索引标记为 read_only_allow_delete，写入被拒绝，删除仍然允许
+	setUsed(96)
+	for _, name := range []string{"logs", "low"} {
+		meta, err := indexHandler.metaStore.GetIndexMetadata(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !indexSettingBool(meta.Settings, "blocks.read_only_allow_delete") {
+			t.Errorf("index [%s] should be marked read_only_allow_delete: %v", name, meta.Settings)
+		}
+	}
+	if err := monitor.ReadinessCheck(context.Background()); err == nil || !strings.Contains(err.Error(), "flood_stage") {
+		t.Errorf("readiness above flood stage: expected error, got %v", err)
+	}
+	w := do("PUT", "/logs/_doc/5", `{"msg":"a"}`)
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "cluster_block_exception") ||
+		!strings.Contains(w.Body.String(), "disk usage exceeded flood-stage watermark") {
+		t.Errorf("index doc above flood stage: expected 429 got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("POST", "/_bulk", "{\"index\":{\"_index\":\"logs\",\"_id\":\"6\"}}\n{\"msg\":\"a\"}\n{\"delete\":{\"_index\":\"logs\",\"_id\":\"2\"}}\n")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":429`) || !strings.Contains(w.Body.String(), `"result":"deleted"`) {
+		t.Errorf("bulk above flood stage: expected rejected index and allowed delete, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", "/logs/_doc/1", ""); w.Code != http.StatusOK {
+		t.Errorf("delete doc above flood stage: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 回落到 high 与 flood_stage 之间：block 保持
+	setUsed(93)
+	if w := do("PUT", "/logs/_doc/7", `{"msg":"a"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("index doc between high and flood stage: expected 429 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 回落到 high 水位以下：自动移除 block
+	setUsed(80)
+	if err := monitor.ReadinessCheck(context.Background()); err != nil {
+		t.Errorf("readiness after release: expected nil, got %v", err)
+	}
+	if w := do("PUT", "/logs/_doc/8", `{"msg":"a"}`); w.Code != http.StatusCreated {
+		t.Errorf("index doc after release: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/high", `{}`); w.Code != http.StatusOK {
+		t.Errorf("create index after release: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	stats := monitor.Stats().(map[string]interface{})
+	if stats["level"] != "normal" || stats["used_percent"].(float64) != 80 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+
+	// 水位通过集群动态设置修改：剩余空间低于 25gb 即超过 flood_stage，关闭后不再检查
+	cs := NewClusterSettings(indexHandler.metaStore, nil)
+	defer func() {
+		if _, _, err := cs.Update(nil, map[string]interface{}{
+			"cluster.routing.allocation.disk.watermark.flood_stage": nil,
+			"cluster.routing.allocation.disk.threshold_enabled":     nil,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if _, _, err := cs.Update(nil, map[string]interface{}{
+		"cluster.routing.allocation.disk.watermark.flood_stage": "25gb",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	monitor.Check()
+	if w := do("PUT", "/logs/_doc/9", `{"msg":"a"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("index doc above byte flood stage: expected 429 got %d: %s", w.Code, w.Body.String())
+	}
+	if _, _, err := cs.Update(nil, map[string]interface{}{
+		"cluster.routing.allocation.disk.threshold_enabled": false,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	setUsed(99)
+	if w := do("PUT", "/disabled", `{}`); w.Code != http.StatusOK {
+		t.Errorf("create index with threshold disabled: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestParseDiskWatermark(t *testing.T) {
+	tests := []struct {
+		value   string
+		percent float64
+		bytes   uint64
+		isBytes bool
+		err     bool
+	}{
+		{value: "85%", percent: 85},
+		{value: "0.9", percent: 90},
+		{value: "500mb", bytes: 500 << 20, isBytes: true},
+		{value: "1.5GB", bytes: 3 << 29, isBytes: true},
+		{value: "0b", isBytes: true},
+		{value: "101%", err: true},
+		{value: "1.5", err: true},
+		{value: "10xb", err: true},
+		{value: "", err: true},
+	}
+	for _, tt := range tests {
+		v, err := parseDiskWatermark(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", tt.value, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.value, err)
+			continue
+		}
+		w := v.(diskWatermark)
+		if w.percent != tt.percent || w.bytes != tt.bytes || w.isBytes != tt.isBytes {
+			t.Errorf("%q: expected %v/%v/%v, got %+v", tt.value, tt.percent, tt.bytes, tt.isBytes, w)
+		}
+	}
+
+	cs := NewClusterSettings(nil, nil)
+	if _, _, err := cs.Update(nil, map[string]interface{}{
+		"cluster.routing.allocation.disk.watermark.high": "abc",
+	}); err == nil || !strings.Contains(err.Error(), "cluster.routing.allocation.disk.watermark.high") {
+		t.Errorf("expected invalid watermark error, got %v", err)
+	}
+}
@@ -23,7 +23,6 @@ import (
 	"time"
 
 	"github.com/lscgzwd/tiggerdb/logger"
-	"github.com/lscgzwd/tiggerdb/script"
 
 	index "github.com/blevesearch/bleve_index_api"
 	"github.com/google/uuid"
@@ -33,7 +32,6 @@ import (
 	"github.com/lscgzwd/tiggerdb/metadata"
 	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
 	es "github.com/lscgzwd/tiggerdb/protocols/es/index"
-	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
 	"github.com/lscgzwd/tiggerdb/search/query"
 )
 
@@ -45,6 +43,7 @@ type DocumentHandler struct {
 	nestedDocHelper *NestedDocumentHelper // 嵌套文档处理辅助工具
 	versionMgr      *VersionManager       // 文档版本管理器
 	taskMgr         *TaskManager          // 任务管理器
+	mappingConv     MappingConverter      // 动态 mapping 新增字段后生成索引使用的 bleve mapping
 }
 
 // NewDocumentHandler 创建新的文档处理器
@@ -59,6 +58,11 @@ func NewDocumentHandler(indexMgr *es.IndexManager, dirMgr directory.DirectoryMan
 	}
 }
 
+// TaskManager 返回文档处理器使用的任务管理器
+func (h *DocumentHandler) TaskManager() *TaskManager {
+	return h.taskMgr
+}
+
 // applyCopyToForIndex 为指定索引应用copy_to规则到文档数据
 func (h *DocumentHandler) applyCopyToForIndex(indexName string, docData map[string]interface{}) {
 	// 获取索引元数据
@@ -95,8 +99,19 @@ func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelWrite); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 生成自动ID
 	docID := uuid.New().String()
+	routing := requestRouting(r)
+	if apiErr := checkRouting(h.metaStore, indexName, docID, routing); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
 
 	// 解析请求体（兼容 chunked）
 	var docBody map[string]interface{}
@@ -105,7 +120,7 @@ func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request)
 		if err == io.EOF {
 			docBody = make(map[string]interface{})
 		} else {
-			common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+			common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 			return
 		}
 	}
@@ -119,7 +134,7 @@ func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 处理嵌套文档
-	docData, nestedDocs, err := h.nestedDocHelper.ProcessNestedDocuments(docID, docBody)
+	docData, nestedDocs, err := h.nestedDocHelper.ProcessNestedDocuments(docID, docBody, h.nestedPathsForIndex(indexName))
 	if err != nil {
 		logger.Error("Failed to process nested documents: %v", err)
 		common.HandleError(w, common.NewBadRequestError("failed to process nested documents: "+err.Error()))
@@ -129,6 +144,17 @@ func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request)
 	// P2-4: 应用copy_to规则
 	h.applyCopyToForIndex(indexName, docData)
 
+	// 动态 mapping：为未映射字段推断类型并更新索引 mapping
+	docData, mapErr := h.applyDynamicMapping(indexName, docData)
+	if mapErr != nil {
+		common.HandleError(w, mapErr)
+		return
+	}
+	docData = h.applyJoinField(indexName, docData)
+	docData = h.applySparseVectorFields(indexName, docData)
+	docData = h.applyPercolatorFields(indexName, docData)
+	setDocumentRouting(docData, routing)
+
 	// 索引主文档
 	if err := idx.Index(docID, docData); err != nil {
 		logger.Error("Failed to index document [%s] in index [%s]: %v", docID, indexName, err)
@@ -136,25 +162,15 @@ func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 索引嵌套文档
-	for _, nestedDoc := range nestedDocs {
-		if err := idx.Index(nestedDoc.ID, nestedDoc); err != nil {
-			logger.Warn("Failed to index nested document [%s]: %v", nestedDoc.ID, err)
-			// 继续处理其他嵌套文档，不中断流程
-		}
-	}
+	// 索引嵌套文档（替换该根文档之前的子文档）
+	h.indexNestedDocuments(idx, indexName, docID, nestedDocs)
 
 	// P1-1: 使用版本管理器创建版本信息
 	versionInfo := h.versionMgr.CreateVersion(indexName, docID)
 
 	// 返回成功响应（包含真实版本信息）
-	resp := common.SuccessResponse().
-		WithIndex(indexName).
-		WithID(docID).
-		WithResult("created").
-		WithVersion(versionInfo.Version).
-		WithSeqNo(versionInfo.SeqNo).
-		WithPrimaryTerm(versionInfo.PrimaryTerm)
+	resp := common.DocWriteResponse(indexName, docID, "created", versionInfo.Version, versionInfo.SeqNo, versionInfo.PrimaryTerm).
+		WithForcedRefresh(h.refreshAfterWrite(r, indexName))
 	common.HandleSuccess(w, resp, http.StatusCreated)
 }
 
@@ -180,6 +196,17 @@ func (h *DocumentHandler) IndexDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelWrite); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	routing := requestRouting(r)
+	if apiErr := checkRouting(h.metaStore, indexName, docID, routing); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 解析请求体（兼容 chunked）
 	var docBody map[string]interface{}
 	decoder := json.NewDecoder(r.Body)
@@ -187,7 +214,7 @@ func (h *DocumentHandler) IndexDocument(w http.ResponseWriter, r *http.Request)
 		if err == io.EOF {
 			docBody = make(map[string]interface{})
 		} else {
-			common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+			common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 			return
 		}
 	}
@@ -205,13 +232,24 @@ func (h *DocumentHandler) IndexDocument(w http.ResponseWriter, r *http.Request)
 	docExists := err == nil && existingDoc != nil
 
 	// 处理嵌套文档
-	docData, nestedDocs, err := h.nestedDocHelper.ProcessNestedDocuments(docID, docBody)
+	docData, nestedDocs, err := h.nestedDocHelper.ProcessNestedDocuments(docID, docBody, h.nestedPathsForIndex(indexName))
 	if err != nil {
 		logger.Error("Failed to process nested documents: %v", err)
 		common.HandleError(w, common.NewBadRequestError("failed to process nested documents: "+err.Error()))
 		return
 	}
 
+	// 动态 mapping：为未映射字段推断类型并更新索引 mapping
+	docData, mapErr := h.applyDynamicMapping(indexName, docData)
+	if mapErr != nil {
+		common.HandleError(w, mapErr)
+		return
+	}
+	docData = h.applyJoinField(indexName, docData)
+	docData = h.applySparseVectorFields(indexName, docData)
+	docData = h.applyPercolatorFields(indexName, docData)
+	setDocumentRouting(docData, routing)
+
 	// 索引主文档
 	if err := idx.Index(docID, docData); err != nil {
 		logger.Error("Failed to index document [%s] in index [%s]: %v", docID, indexName, err)
@@ -219,12 +257,8 @@ func (h *DocumentHandler) IndexDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 索引嵌套文档
-	for _, nestedDoc := range nestedDocs {
-		if err := idx.Index(nestedDoc.ID, nestedDoc); err != nil {
-			logger.Warn("Failed to index nested document [%s]: %v", nestedDoc.ID, err)
-		}
-	}
+	// 索引嵌套文档（替换该根文档之前的子文档）
+	h.indexNestedDocuments(idx, indexName, docID, nestedDocs)
 
 	// P1-1: 使用版本管理器管理版本信息
 	var versionInfo *DocumentVersion
@@ -241,13 +275,8 @@ func (h *DocumentHandler) IndexDocument(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 返回成功响应（包含真实版本信息）
-	resp := common.SuccessResponse().
-		WithIndex(indexName).
-		WithID(docID).
-		WithResult(result).
-		WithVersion(versionInfo.Version).
-		WithSeqNo(versionInfo.SeqNo).
-		WithPrimaryTerm(versionInfo.PrimaryTerm)
+	resp := common.DocWriteResponse(indexName, docID, result, versionInfo.Version, versionInfo.SeqNo, versionInfo.PrimaryTerm).
+		WithForcedRefresh(h.refreshAfterWrite(r, indexName))
 	common.HandleSuccess(w, resp, statusCode)
 }
 
@@ -273,6 +302,20 @@ func (h *DocumentHandler) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelRead); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if apiErr := checkRouting(h.metaStore, indexName, docID, requestRouting(r)); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if apiErr := h.refreshBeforeGet(r, indexName); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 获取索引实例
 	idx, err := h.indexMgr.GetIndex(indexName)
 	if err != nil {
@@ -281,12 +324,14 @@ func (h *DocumentHandler) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取文档
+	// 获取文档（不满足文档级安全查询的文档视为不存在）
+	access := requestIndexAccess(r.Context(), indexName)
 	doc, err := idx.Document(docID)
-	if err != nil || doc == nil {
+	if err != nil || doc == nil || !h.documentVisible(idx, indexName, access, docID) {
 		// ES规范：文档不存在时返回404，但响应体包含 found: false
 		notFoundResponse := map[string]interface{}{
 			"_index": indexName,
+			"_type":  "_doc",
 			"_id":    docID,
 			"found":  false,
 		}
@@ -299,8 +344,8 @@ func (h *DocumentHandler) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 提取文档字段
-	docData := h.extractDocumentFields(doc)
+	// 提取文档字段（去掉字段级安全不可见的字段）
+	docData := access.FilterSource(h.extractDocumentFields(doc))
 
 	// P1-1: 获取文档版本信息
 	versionInfo := h.versionMgr.GetVersion(indexName, docID)
@@ -316,247 +361,37 @@ func (h *DocumentHandler) GetDocument(w http.ResponseWriter, r *http.Request) {
 	// 构建ES格式的_get响应
 	getResponse := map[string]interface{}{
 		"_index":        indexName,
+		"_type":         "_doc",
 		"_id":           docID,
 		"_version":      version,
 		"_seq_no":       seqNo,
 		"_primary_term": primaryTerm,
 		"found":         true,
-		"_source":       docData, // 使用实际提取的文档数据
 	}
-
-	// 直接返回响应，不使用通用响应格式
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	encoder := json.NewEncoder(w)
-	if err := encoder.Encode(getResponse); err != nil {
-		logger.Error("Failed to encode get response: %v", err)
-	}
-}
-
-// MultiGet 批量获取文档
-// GET /_mget
-// POST /_mget
-// GET /{index}/_mget
-// POST /{index}/_mget
-func (h *DocumentHandler) MultiGet(w http.ResponseWriter, r *http.Request) {
-	// 获取索引名称（可能为空，表示全局搜索）
-	indexName := mux.Vars(r)["index"]
-
-	// 解析请求体（兼容 chunked）
-	var requestBody map[string]interface{}
-	if r.Method == http.MethodPost {
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&requestBody); err != nil && err != io.EOF {
-			common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
-			return
-		}
-	} else {
-		// GET 请求，从查询参数解析
-		// ES 的 GET /_mget 支持 ids 参数：?ids=id1,id2,id3
-		idsParam := r.URL.Query().Get("ids")
-		if idsParam != "" {
-			// 解析逗号分隔的 ID 列表
-			ids := strings.Split(idsParam, ",")
-			docs := make([]map[string]interface{}, 0, len(ids))
-			for _, id := range ids {
-				id = strings.TrimSpace(id)
-				if id != "" {
-					doc := map[string]interface{}{
-						"_id": id,
-					}
-					if indexName != "" {
-						doc["_index"] = indexName
-					}
-					docs = append(docs, doc)
-				}
-			}
-			requestBody = map[string]interface{}{
-				"docs": docs,
-			}
-		} else {
-			common.HandleError(w, common.NewBadRequestError("request body is required for POST, or 'ids' parameter for GET"))
-			return
-		}
-	}
-
-	// 解析 docs 数组
-	docs, ok := requestBody["docs"].([]interface{})
-	if !ok {
-		common.HandleError(w, common.NewBadRequestError("request body must contain 'docs' array"))
-		return
+	if routing := documentRouting(doc); routing != "" {
+		getResponse[routingField] = routing
 	}
 
-	// 性能优化：按索引分组文档，复用 IndexReader
-	type docRequest struct {
-		index     int // 原始顺序
-		indexName string
-		docID     string
-		source    interface{} // _source 参数
+	// 指定 stored_fields 时只返回 mapping 中 store: true 的字段，除非同时显式请求了 _source
+	query := r.URL.Query()
+	filter := parseSourceFilter(query)
+	storedFields := splitCommaList(query.Get("stored_fields"))
+	if filter.fetch && (len(storedFields) == 0 || filter.explicit) && sourceEnabled(h.metaStore, indexName) {
+		getResponse["_source"] = filter.apply(docData)
 	}
-
-	// 解析所有文档请求并按索引分组
-	indexGroups := make(map[string][]docRequest)
-	responses := make([]map[string]interface{}, len(docs))
-	errorResponses := make(map[int]map[string]interface{}) // 存储错误响应
-
-	for i, docItem := range docs {
-		docMap, ok := docItem.(map[string]interface{})
-		if !ok {
-			if docID, ok := docItem.(string); ok {
-				docMap = map[string]interface{}{"_id": docID}
-				if indexName != "" {
-					docMap["_index"] = indexName
-				}
-			} else {
-				logger.Warn("Invalid doc item in mget request: %v", docItem)
-				errorResponses[i] = map[string]interface{}{
-					"error": map[string]interface{}{"type": "illegal_argument_exception", "reason": "invalid doc item"},
-				}
-				continue
-			}
-		}
-
-		docIndexName := indexName
-		if idx, ok := docMap["_index"].(string); ok && idx != "" {
-			docIndexName = idx
-		}
-
-		docID, ok := docMap["_id"].(string)
-		if !ok {
-			errorResponses[i] = map[string]interface{}{
-				"error": map[string]interface{}{"type": "illegal_argument_exception", "reason": "missing _id in doc"},
-			}
-			continue
-		}
-
-		if docIndexName == "" {
-			errorResponses[i] = map[string]interface{}{
-				"error": map[string]interface{}{"type": "illegal_argument_exception", "reason": "missing _index in doc"},
-			}
-			continue
+	if len(storedFields) > 0 && storedFields[0] != "_none_" {
+		if fields := storedFieldValues(h.metaStore, indexName, docData, storedFields); len(fields) > 0 {
+			getResponse["fields"] = fields
 		}
-
-		indexGroups[docIndexName] = append(indexGroups[docIndexName], docRequest{
-			index:     i,
-			indexName: docIndexName,
-			docID:     docID,
-			source:    docMap["_source"],
-		})
-	}
-
-	// 按索引批量获取文档，复用 IndexReader
-	for idxName, requests := range indexGroups {
-		if !h.dirMgr.IndexExists(idxName) {
-			for _, req := range requests {
-				responses[req.index] = map[string]interface{}{"_index": idxName, "_id": req.docID, "found": false}
-			}
-			continue
-		}
-
-		idx, err := h.indexMgr.GetIndex(idxName)
-		if err != nil {
-			for _, req := range requests {
-				responses[req.index] = map[string]interface{}{
-					"_index": idxName, "_id": req.docID,
-					"error": map[string]interface{}{"type": "index_not_found_exception", "reason": err.Error()},
-				}
-			}
-			continue
-		}
-
-		// 性能优化：复用单个IndexReader，避免每次调用idx.Document()都创建新的Reader
-		// 注意：这仍然是逐个获取文档，但复用Reader可以减少Reader创建/关闭的开销
-		var reader index.IndexReader
-		advancedIdx, err := idx.Advanced()
-		if err == nil {
-			reader, err = advancedIdx.Reader()
-			if err == nil {
-				defer reader.Close() // ✅ 使用defer确保资源关闭
-			}
-		}
-
-		for _, req := range requests {
-			var doc index.Document
-			var docErr error
-			if reader != nil {
-				doc, docErr = reader.Document(req.docID)
-			} else {
-				// 回退到逐个获取（每次调用idx.Document()都会创建新Reader）
-				doc, docErr = idx.Document(req.docID)
-			}
-
-			if docErr != nil || doc == nil {
-				responses[req.index] = map[string]interface{}{"_index": idxName, "_id": req.docID, "found": false}
-				continue
-			}
-
-			docData := h.extractDocumentFields(doc)
-			docData = h.filterSourceFields(docData, req.source)
-
-			// P1-1: 获取文档版本信息
-			versionInfo := h.versionMgr.GetVersion(idxName, req.docID)
-			version := int64(1)
-			seqNo := int64(0)
-			primaryTerm := int64(1)
-			if versionInfo != nil {
-				version = versionInfo.Version
-				seqNo = versionInfo.SeqNo
-				primaryTerm = versionInfo.PrimaryTerm
-			}
-
-			responseItem := map[string]interface{}{
-				"_index":        idxName,
-				"_id":           req.docID,
-				"_version":      version,
-				"_seq_no":       seqNo,
-				"_primary_term": primaryTerm,
-				"found":         true,
-			}
-			if docData != nil {
-				responseItem["_source"] = docData
-			}
-			responses[req.index] = responseItem
-		}
-	}
-
-	// 填充错误响应
-	for i, errResp := range errorResponses {
-		responses[i] = errResp
-	}
-
-	// 构建 ES 格式响应
-	mgetResponse := map[string]interface{}{
-		"docs": responses,
 	}
 
+	// 直接返回响应，不使用通用响应格式
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	encoder := json.NewEncoder(w)
-	if err := encoder.Encode(mgetResponse); err != nil {
-		logger.Error("Failed to encode mget response: %v", err)
-	}
-}
-
-// filterSourceFields 根据 _source 参数过滤字段
-func (h *DocumentHandler) filterSourceFields(docData map[string]interface{}, source interface{}) map[string]interface{} {
-	if source == nil {
-		return docData
-	}
-	if sourceFields, ok := source.([]interface{}); ok {
-		filteredData := make(map[string]interface{})
-		for _, field := range sourceFields {
-			if fieldStr, ok := field.(string); ok {
-				if val, exists := docData[fieldStr]; exists {
-					filteredData[fieldStr] = val
-				}
-			}
-		}
-		return filteredData
-	}
-	if sourceBool, ok := source.(bool); ok && !sourceBool {
-		return nil
+	if err := encoder.Encode(getResponse); err != nil {
+		logger.Error("Failed to encode get response: %v", err)
 	}
-	return docData
 }
 
 // DeleteDocument 删除文档
@@ -581,6 +416,16 @@ func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelDelete); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if apiErr := checkRouting(h.metaStore, indexName, docID, requestRouting(r)); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 获取索引实例
 	idx, err := h.indexMgr.GetIndex(indexName)
 	if err != nil {
@@ -594,17 +439,20 @@ func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request)
 	doc, err := idx.Document(docID)
 	if err != nil || doc == nil {
 		// 文档不存在，但根据ES规范，删除操作应该返回200，result为not_found
-		resp := common.SuccessResponse().
-			WithIndex(indexName).
-			WithID(docID).
-			WithResult("not_found").
-			WithVersion(0)
+		versionInfo := h.versionMgr.NotFoundVersion()
+		resp := common.DocWriteResponse(indexName, docID, "not_found", versionInfo.Version, versionInfo.SeqNo, versionInfo.PrimaryTerm).
+			WithForcedRefresh(h.refreshAfterWrite(r, indexName))
 		common.HandleSuccess(w, resp, http.StatusOK)
 		return
 	}
 
-	// P1-1: 获取删除前的版本信息
+	// P1-1: 记录删除版本（版本号递增并分配新序列号）
 	versionInfo := h.versionMgr.DeleteVersion(indexName, docID)
+	if versionInfo == nil {
+		// 没有版本记录（如服务重启后）时，按版本 1 的文档处理
+		versionInfo = h.versionMgr.NotFoundVersion()
+		versionInfo.Version++
+	}
 
 	// 删除文档
 	if err := idx.Delete(docID); err != nil {
@@ -612,15 +460,11 @@ func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request)
 		common.HandleError(w, common.NewInternalServerError("failed to delete document: "+err.Error()))
 		return
 	}
+	h.deleteNestedDocuments(idx, indexName, docID)
 
-	// 返回成功响应（包含删除前的版本信息）
-	resp := common.SuccessResponse().
-		WithIndex(indexName).
-		WithID(docID).
-		WithResult("deleted").
-		WithVersion(versionInfo.Version).
-		WithSeqNo(versionInfo.SeqNo).
-		WithPrimaryTerm(versionInfo.PrimaryTerm)
+	// 返回成功响应（包含删除版本信息）
+	resp := common.DocWriteResponse(indexName, docID, "deleted", versionInfo.Version, versionInfo.SeqNo, versionInfo.PrimaryTerm).
+		WithForcedRefresh(h.refreshAfterWrite(r, indexName))
 	common.HandleSuccess(w, resp, http.StatusOK)
 }
 
@@ -646,6 +490,16 @@ func (h *DocumentHandler) HeadDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelRead); apiErr != nil {
+		w.WriteHeader(apiErr.StatusCode())
+		return
+	}
+	if apiErr := checkRouting(h.metaStore, indexName, docID, requestRouting(r)); apiErr != nil {
+		w.WriteHeader(apiErr.StatusCode())
+		return
+	}
+
 	// 获取索引实例
 	idx, err := h.indexMgr.GetIndex(indexName)
 	if err != nil {
@@ -687,6 +541,17 @@ func (h *DocumentHandler) UpdateDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelWrite); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	routing := requestRouting(r)
+	if apiErr := checkRouting(h.metaStore, indexName, docID, routing); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 获取索引实例
 	idx, err := h.indexMgr.GetIndex(indexName)
 	if err != nil {
@@ -703,155 +568,57 @@ func (h *DocumentHandler) UpdateDocument(w http.ResponseWriter, r *http.Request)
 			common.HandleError(w, common.NewBadRequestError("request body is required"))
 			return
 		}
-		common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 		return
 	}
 
-	// 检查文档是否存在
-	existingDoc, err := idx.Document(docID)
-	docExists := err == nil && existingDoc != nil
-
-	// P1-2: 处理doc_as_upsert选项（如果文档不存在且doc_as_upsert为true，则创建文档）
-	docAsUpsert, _ := requestBody["doc_as_upsert"].(bool)
-	if !docExists && docAsUpsert {
-		// 文档不存在且doc_as_upsert=true，创建新文档
-		var newDoc map[string]interface{}
-		if doc, ok := requestBody["doc"].(map[string]interface{}); ok {
-			newDoc = doc
-		} else {
-			// 如果没有doc字段，使用整个请求体（排除doc_as_upsert等元数据字段）
-			newDoc = make(map[string]interface{})
-			for k, v := range requestBody {
-				if k != "doc_as_upsert" && k != "script" {
-					newDoc[k] = v
-				}
-			}
-		}
-
-		// 处理嵌套文档
-		docData, nestedDocs, err := h.nestedDocHelper.ProcessNestedDocuments(docID, newDoc)
-		if err != nil {
-			logger.Error("Failed to process nested documents: %v", err)
-			common.HandleError(w, common.NewBadRequestError("failed to process nested documents: "+err.Error()))
-			return
-		}
-
-		// P2-4: 应用copy_to规则
-		h.applyCopyToForIndex(indexName, docData)
-
-		// 索引主文档
-		if err := idx.Index(docID, docData); err != nil {
-			logger.Error("Failed to index document [%s] in index [%s]: %v", docID, indexName, err)
-			common.HandleError(w, common.NewInternalServerError("failed to index document: "+err.Error()))
-			return
-		}
-
-		// 索引嵌套文档
-		for _, nestedDoc := range nestedDocs {
-			if err := idx.Index(nestedDoc.ID, nestedDoc); err != nil {
-				logger.Warn("Failed to index nested document [%s]: %v", nestedDoc.ID, err)
-			}
-		}
-
-		// P1-1: 使用版本管理器创建版本信息
-		versionInfo := h.versionMgr.CreateVersion(indexName, docID)
-
-		// 返回created结果
-		resp := common.SuccessResponse().
-			WithIndex(indexName).
-			WithID(docID).
-			WithResult("created").
-			WithVersion(versionInfo.Version).
-			WithSeqNo(versionInfo.SeqNo).
-			WithPrimaryTerm(versionInfo.PrimaryTerm)
-		common.HandleSuccess(w, resp, http.StatusCreated)
+	// 在 retry_on_conflict 次数内重试并发更新导致的版本冲突
+	retryOnConflict, apiErr := parseRetryOnConflict(r.URL.Query().Get("retry_on_conflict"))
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
 		return
 	}
-
-	// 文档不存在且doc_as_upsert=false，返回404
-	if !docExists {
-		common.HandleError(w, common.NewDocumentNotFoundError(indexName, docID))
+	outcome, apiErr := h.executeUpdate(idx, indexName, docID, routing, requestBody, retryOnConflict)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
 		return
 	}
 
-	// 提取现有文档数据
-	existingData := h.extractDocumentFields(existingDoc)
-
-	// 提取要更新的字段
-	var updateData map[string]interface{}
-	if doc, ok := requestBody["doc"].(map[string]interface{}); ok {
-		updateData = doc
-	} else {
-		// 如果没有doc字段，直接使用请求体
-		updateData = requestBody
+	resp := common.DocWriteResponse(indexName, docID, outcome.result, outcome.version.Version, outcome.version.SeqNo, outcome.version.PrimaryTerm)
+	if outcome.result != updateOpNoop {
+		resp = resp.WithForcedRefresh(h.refreshAfterWrite(r, indexName))
 	}
+	common.HandleSuccess(w, resp, outcome.status)
+}
 
-	// 处理script更新（ES update API支持script）
-	if scriptData, ok := requestBody["script"]; ok {
-		s, err := script.ParseScript(scriptData)
-		if err != nil {
-			logger.Error("Failed to parse update script: %v", err)
-			common.HandleError(w, common.NewBadRequestError("failed to parse script: "+err.Error()))
-			return
-		}
-
-		// 执行脚本更新
-		engine := script.NewEngine()
-		ctx := script.NewContext(existingData, existingData, s.Params)
-		_, err = engine.Execute(s, ctx)
-		if err != nil {
-			logger.Error("Failed to execute update script: %v", err)
-			common.HandleError(w, common.NewBadRequestError("failed to execute script: "+err.Error()))
-			return
-		}
-
-		// 脚本执行后，ctx.Source 包含更新后的数据
-		existingData = ctx.Source
-		updateData = nil // 不使用 doc 更新
-	}
+// refreshRequested 判断写请求是否带有 refresh=true（或不带值的 refresh）
+// 写入立即可见，此时响应中返回 forced_refresh
+func refreshRequested(r *http.Request) bool {
+	values, ok := r.URL.Query()["refresh"]
+	return ok && (values[0] == "" || values[0] == "true")
+}
 
-	// 合并数据（更新现有字段，添加新字段）
-	for k, v := range updateData {
-		existingData[k] = v
-	}
+// waitForRefreshRequested 判断写请求是否带有 refresh=wait_for
+func waitForRefreshRequested(r *http.Request) bool {
+	return r.URL.Query().Get("refresh") == "wait_for"
+}
 
-	// 处理嵌套文档
-	docData, nestedDocs, err := h.nestedDocHelper.ProcessNestedDocuments(docID, existingData)
-	if err != nil {
-		logger.Error("Failed to process nested documents: %v", err)
-		common.HandleError(w, common.NewBadRequestError("failed to process nested documents: "+err.Error()))
-		return
+// refreshAfterWrite 处理写请求的 refresh 参数：refresh=true 时关闭自动刷新的索引在此刷新，
+// refresh=wait_for 时等待写入对搜索可见（按刷新间隔调度的索引等待下一次刷新），返回是否强制刷新
+func (h *DocumentHandler) refreshAfterWrite(r *http.Request, indexName string) bool {
+	if waitForRefreshRequested(r) {
+		if err := h.indexMgr.WaitForRefresh(r.Context(), indexName); err != nil {
+			logger.Warn("Failed to wait for refresh of index [%s] after write: %v", indexName, err)
+		}
+		return false
 	}
-
-	// P2-4: 应用copy_to规则
-	h.applyCopyToForIndex(indexName, docData)
-
-	// 更新主文档
-	if err := idx.Index(docID, docData); err != nil {
-		logger.Error("Failed to update document [%s] in index [%s]: %v", docID, indexName, err)
-		common.HandleError(w, common.NewInternalServerError("failed to update document: "+err.Error()))
-		return
+	if !refreshRequested(r) {
+		return false
 	}
-
-	// 更新嵌套文档
-	for _, nestedDoc := range nestedDocs {
-		if err := idx.Index(nestedDoc.ID, nestedDoc); err != nil {
-			logger.Warn("Failed to update nested document [%s]: %v", nestedDoc.ID, err)
-		}
+	if err := h.indexMgr.RefreshIndex(indexName); err != nil {
+		logger.Warn("Failed to refresh index [%s] after write: %v", indexName, err)
 	}
-
-	// P1-1: 使用版本管理器递增版本信息
-	versionInfo := h.versionMgr.IncrementVersion(indexName, docID)
-
-	// 返回成功响应（包含真实版本信息）
-	resp := common.SuccessResponse().
-		WithIndex(indexName).
-		WithID(docID).
-		WithResult("updated").
-		WithVersion(versionInfo.Version).
-		WithSeqNo(versionInfo.SeqNo).
-		WithPrimaryTerm(versionInfo.PrimaryTerm)
-	common.HandleSuccess(w, resp, http.StatusOK)
+	return true
 }
 
 // CountDocuments 统计文档数量
@@ -866,9 +633,16 @@ func (h *DocumentHandler) CountDocuments(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 检查索引是否存在
-	if !h.dirMgr.IndexExists(indexName) {
-		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+	// 解析别名（不存在时返回 index_not_found）
+	indexName, aliasFilter, apiErr := h.resolveSearchTarget(indexName)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelRead); apiErr != nil {
+		common.HandleError(w, apiErr)
 		return
 	}
 
@@ -886,24 +660,26 @@ func (h *DocumentHandler) CountDocuments(w http.ResponseWriter, r *http.Request)
 		// POST请求，从请求体读取查询条件（兼容 chunked）
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&countQuery); err != nil && err != io.EOF {
-			common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+			common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 			return
 		}
 	}
 
-	// 解析查询条件并执行查询
-	var bleveQuery query.Query
-	var rootDocCount int
-
+	// 解析查询条件（未提供时统计全部文档），别名 filter 与查询组合
+	var queryObj map[string]interface{}
 	if countQuery != nil && countQuery["query"] != nil {
-		// 有查询条件：精确返回匹配查询的文档总数（符合ES规范）
-		// ES的count API不应该有size限制，应该返回精确的文档数
-		parser := dsl.NewQueryParser()
-		queryObj, ok := countQuery["query"].(map[string]interface{})
-		if !ok {
+		var ok bool
+		if queryObj, ok = countQuery["query"].(map[string]interface{}); !ok {
 			common.HandleError(w, common.NewBadRequestError("query must be an object"))
 			return
 		}
+	}
+	queryObj = applyAliasFilter(queryObj, aliasFilter)
+	access := requestIndexAccess(r.Context(), indexName)
+	var bleveQuery query.Query = query.NewMatchAllQuery()
+	if queryObj != nil {
+		parser := h.newQueryParser(indexName)
+		restrictQueryFields(parser, access)
 		parsedQuery, err := parser.ParseQuery(queryObj)
 		if err != nil {
 			logger.Error("Failed to parse query for count [%s]: %v", indexName, err)
@@ -911,72 +687,32 @@ func (h *DocumentHandler) CountDocuments(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		bleveQuery = parsedQuery
+	}
+	if bleveQuery, err = h.applyDocumentSecurity(bleveQuery, indexName, access); err != nil {
+		common.HandleError(w, common.NewBadRequestError("failed to parse query: "+err.Error()))
+		return
+	}
 
-		// ES规范：count API返回匹配查询的精确文档数
-		// 不设置size限制，直接使用SearchRequest获取精确的total
-		countSearchReq := bleve.NewSearchRequest(bleveQuery)
-		countSearchReq.Size = 0            // 不需要返回文档，只需要总数
-		countSearchReq.Fields = []string{} // 不需要字段
-
-		countResult, err := idx.Search(countSearchReq)
-		if err != nil {
-			logger.Error("Failed to execute count query for index [%s]: %v", indexName, err)
-			common.HandleError(w, common.NewInternalServerError("failed to count documents: "+err.Error()))
-			return
-		}
-
-		// 直接返回精确的匹配文档数（ES规范）
-		rootDocCount = int(countResult.Total)
-		logger.Debug("Count with query for [%s]: matched %d documents", indexName, rootDocCount)
-	} else {
-		// 性能优化：直接使用Bleve的DocCount统计文档总数
-		// 这避免了加载10000条文档的开销
-		// 注意：DocCount返回的是所有文档数量（包括嵌套文档）
-		// TigerDB的嵌套文档ID格式为"parent_id#nested_id"，需要过滤嵌套文档
-		// 这里为了性能，先返回全部count，客户端如果需要精确的根文档数可以自己过滤
-		allDocsResult, err := idx.Search(bleve.NewSearchRequest(query.NewMatchAllQuery()))
-		if err != nil {
-			logger.Error("Failed to get document stats for counting in index [%s]: %v", indexName, err)
-			common.HandleError(w, common.NewInternalServerError("failed to count documents: "+err.Error()))
-			return
-		}
-
-		// 使用DocCount更高效
-		docCount := uint64(len(allDocsResult.Hits))
-		if allDocsResult.Total > 0 {
-			docCount = allDocsResult.Total
-		}
-
-		// 尝试估算根文档数（对于小数据集）
-		// 大数据集返回总count，避免性能问题
-		if docCount < 100000 {
-			// 对于小数据集，搜索所有文档并统计根文档
-			sampleSearchReq := bleve.NewSearchRequest(query.NewMatchAllQuery())
-			sampleSearchReq.Size = int(docCount)
-			sampleSearchReq.Fields = []string{}
-			sampleResult, sampleErr := idx.Search(sampleSearchReq)
-			if sampleErr == nil {
-				for _, hit := range sampleResult.Hits {
-					if !strings.Contains(hit.ID, "#") {
-						rootDocCount++
-					}
-				}
+	// 展开 nested/join 查询；嵌套子文档不计入 count（与 ES 一致，只统计根文档）
+	bleveQuery, err = h.resolveRootQuery(idx, indexName, bleveQuery)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError("failed to process join query: "+err.Error()))
+		return
+	}
 
-				// 基于比例估算
-				if uint64(len(sampleResult.Hits)) < sampleResult.Total {
-					rootRatio := float64(rootDocCount) / float64(len(sampleResult.Hits))
-					rootDocCount = int(float64(docCount) * rootRatio)
-				}
-			}
-		} else {
-			// 大数据集：返回总count作为近似值
-			// 这是一个合理的折中方案，避免性能问题
-			rootDocCount = int(docCount)
-			logger.Debug("Large dataset detected, returning approximate count for index [%s]: %d documents", indexName, docCount)
-		}
+	// ES规范：count API返回匹配查询的精确文档数
+	// 不设置size限制，直接使用SearchRequest获取精确的total
+	countSearchReq := bleve.NewSearchRequest(bleveQuery)
+	countSearchReq.Size = 0            // 不需要返回文档，只需要总数
+	countSearchReq.Fields = []string{} // 不需要字段
 
-		// 移除频繁的count日志输出以提高性能
+	countResult, err := idx.Search(countSearchReq)
+	if err != nil {
+		logger.Error("Failed to execute count query for index [%s]: %v", indexName, err)
+		common.HandleError(w, common.NewInternalServerError("failed to count documents: "+err.Error()))
+		return
 	}
+	rootDocCount := int(countResult.Total)
 
 	// 构建ES格式响应
 	countResponse := map[string]interface{}{
@@ -998,6 +734,11 @@ func (h *DocumentHandler) CountDocuments(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// DocumentSource 返回文档的 _source（与 GET /<index>/_doc/<id> 返回的内容一致），供离线导出等调用方使用
+func (h *DocumentHandler) DocumentSource(doc index.Document) map[string]interface{} {
+	return h.extractDocumentFields(doc)
+}
+
 // extractDocumentFields 从bleve Document中提取字段
 // 使用Bleve提供的类型化方法，保持原样存取特性
 func (h *DocumentHandler) extractDocumentFields(doc index.Document) map[string]interface{} {
@@ -1040,6 +781,7 @@ func (h *DocumentHandler) extractDocumentFields(doc index.Document) map[string]i
 			"_path":        true,
 			"_position":    true,
 			"_root_id":     true,
+			"_routing":     true,
 			"_timestamp":   true,
 		}
 
@@ -1130,9 +872,19 @@ func (h *DocumentHandler) extractDocumentFields(doc index.Document) map[string]i
 			}
 		}
 
-		if value != nil {
-			result[fieldName] = value
+		if value == nil {
+			return
 		}
+		// 数组字段会按元素存储为多个同名字段，收集为数组
+		if existing, ok := result[fieldName]; ok {
+			if values, ok := existing.([]interface{}); ok {
+				result[fieldName] = append(values, value)
+			} else {
+				result[fieldName] = []interface{}{existing, value}
+			}
+			return
+		}
+		result[fieldName] = value
 	})
 
 	return result
@@ -1145,7 +897,7 @@ func (h *DocumentHandler) ClearScroll(w http.ResponseWriter, r *http.Request) {
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error("Failed to read clear scroll request body: %v", err)
-		common.HandleError(w, common.NewBadRequestError("failed to read request body: "+err.Error()))
+		common.HandleError(w, common.NewRequestBodyError("failed to read request body", err))
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -1172,7 +924,7 @@ func (h *DocumentHandler) ClearScroll(w http.ResponseWriter, r *http.Request) {
 				if err3 := decoder3.Decode(&scrollIDStr); err3 == nil {
 					clearReq.ScrollIDs = []string{scrollIDStr}
 				} else {
-					common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+					common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 					return
 				}
 			}
@@ -1208,9 +960,7 @@ func (h *DocumentHandler) ClearScroll(w http.ResponseWriter, r *http.Request) {
 		if scrollID == "" {
 			continue
 		}
-		// 检查是否存在
-		if _, err := scrollMgr.GetScrollContext(scrollID); err == nil {
-			scrollMgr.DeleteScrollContext(scrollID)
+		if scrollMgr.DeleteScrollContext(scrollID) {
 			freedCount++
 		}
 	}
@@ -1235,7 +985,7 @@ func (h *DocumentHandler) Scroll(w http.ResponseWriter, r *http.Request) {
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error("Failed to read scroll request body: %v", err)
-		common.HandleError(w, common.NewBadRequestError("failed to read request body: "+err.Error()))
+		common.HandleError(w, common.NewRequestBodyError("failed to read request body", err))
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -1249,7 +999,7 @@ func (h *DocumentHandler) Scroll(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost && len(bodyBytes) > 0 {
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&scrollReq); err != nil && err != io.EOF {
-			common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+			common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 			return
 		}
 	} else {
@@ -1299,17 +1049,15 @@ func (h *DocumentHandler) Scroll(w http.ResponseWriter, r *http.Request) {
 	}
 	logger.Info("Scroll context found for [%s], index=%s, from=%d, size=%d", scrollID, scrollCtx.IndexName, scrollCtx.From, scrollCtx.Size)
 
-	// 更新过期时间（每次 scroll 请求都应该刷新 TTL）
-	if scrollReq.Scroll != "" {
-		scrollTTL, err := parseScrollTTL(scrollReq.Scroll)
-		if err != nil {
-			common.HandleError(w, common.NewBadRequestError("invalid scroll parameter: "+err.Error()))
-			return
-		}
-		scrollCtx.ExpiresAt = time.Now().Add(scrollTTL)
-	} else {
-		// 如果没有指定新的 scroll TTL，使用默认的 1 分钟刷新
-		scrollCtx.ExpiresAt = time.Now().Add(1 * time.Minute)
+	// 更新过期时间（每次 scroll 请求都应该刷新 TTL，未指定时使用默认的 1 分钟）
+	scrollTTL, err := parseScrollTTL(scrollReq.Scroll)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError("invalid scroll parameter: "+err.Error()))
+		return
+	}
+	if err := scrollMgr.KeepAlive(scrollID, scrollTTL); err != nil {
+		common.HandleError(w, common.NewBadRequestError("scroll context not found or expired: "+err.Error()))
+		return
 	}
 
 	// 获取索引实例
@@ -1374,7 +1122,7 @@ func (h *DocumentHandler) Scroll(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 执行搜索
-	searchResponse, err := h.executeSearchInternal(idx, scrollCtx.IndexName, searchReq)
+	searchResponse, err := h.executeSearchInternal(r.Context(), idx, scrollCtx.IndexName, searchReq)
 	if err != nil {
 		if apiErr, ok := err.(common.APIError); ok {
 			common.HandleError(w, apiErr)
@@ -16,11 +16,12 @@ package handler
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/lscgzwd/tiggerdb/logger"
@@ -39,7 +40,11 @@ type BulkRequest struct {
 	Source      map[string]interface{} `json:"_source,omitempty"`
 	Action      string                 `json:"action"` // index, create, update, delete
 	Version     int64                  `json:"version,omitempty"`
+	Routing     string                 `json:"routing,omitempty"`
 	DocAsUpsert bool                   `json:"doc_as_upsert,omitempty"` // update操作时，如果文档不存在，将doc作为新文档插入
+	// update 操作的 retry_on_conflict，大于 0 时按 update API 的完整语义执行（读取、合并与冲突重试）
+	RetryOnConflict int                    `json:"retry_on_conflict,omitempty"`
+	UpdateBody      map[string]interface{} `json:"-"` // update 操作的完整数据行
 }
 
 // BulkResponse 批量操作响应
@@ -64,11 +69,10 @@ func (h *DocumentHandler) Bulk(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// P2-3: 流式解析Bulk JSON（不先读取整个body到内存，支持超大文件）
-	// 性能优化：使用bufio.NewReader + ReadString组合，实现高效的流式JSON解析
-	// 优势：
-	// 1. 避免将整个body读取到内存（支持超大文件，如500MB+）
-	// 2. 使用ReadString逐行读取，然后json.Unmarshal解析，避免json.Decoder的阻塞问题
-	// 3. 对于NDJSON格式，这种方式更可靠，不会因为不完整的JSON对象而阻塞
+	// 使用bufio.Reader逐行读取，再对每行json.Unmarshal解析：
+	// 1. 避免将整个body读取到内存（支持超大文件，如500MB+），请求体大小由中间件的MaxBytesReader限制
+	// 2. ReadBytes读取完整的一行，不受缓冲区大小限制（超过缓冲区的长文档行不会被截断）
+	// 3. 对于NDJSON格式，逐行解析不会因为不完整的JSON对象而阻塞
 	reader := bufio.NewReader(r.Body)
 	defer r.Body.Close()
 
@@ -77,25 +81,17 @@ func (h *DocumentHandler) Bulk(w http.ResponseWriter, r *http.Request) {
 	lineNum := 0
 
 	for {
-		// 使用ReadLine逐行读取，然后json.Unmarshal解析
 		// 注意：ES Bulk API使用NDJSON格式，每行是独立的JSON对象
-		// 这种方式避免了json.Decoder在遇到不完整JSON对象时可能阻塞的问题
-		// ReadLine返回的line不包含换行符，更可靠
-		lineBytes, isPrefix, readErr := reader.ReadLine()
+		lineBytes, readErr := reader.ReadBytes('\n')
 		isEOF := readErr == io.EOF
 		if readErr != nil && !isEOF {
 			logger.Error("Failed to read bulk request line %d: %v", lineNum, readErr)
-			common.HandleError(w, common.NewBadRequestError("failed to read request: "+readErr.Error()))
+			common.HandleError(w, common.NewRequestBodyError("failed to read request", readErr))
 			return
 		}
 
-		// 如果isPrefix为true，说明行太长，需要继续读取（这种情况在Bulk API中很少见）
-		if isPrefix {
-			logger.Warn("Line %d is too long, truncating", lineNum)
-		}
-
-		line := strings.TrimSpace(string(lineBytes))
-		if line == "" {
+		line := bytes.TrimSpace(lineBytes)
+		if len(line) == 0 {
 			// 空行，跳过
 			if isEOF {
 				break
@@ -107,7 +103,7 @@ func (h *DocumentHandler) Bulk(w http.ResponseWriter, r *http.Request) {
 
 		// 解析JSON行
 		var jsonLine map[string]interface{}
-		if err := json.Unmarshal([]byte(line), &jsonLine); err != nil {
+		if err := json.Unmarshal(line, &jsonLine); err != nil {
 			logger.Error("Failed to parse JSON line %d: %v, line content: %q", lineNum, err, line)
 			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("invalid JSON at line %d: %v", lineNum, err)))
 			return
@@ -149,6 +145,16 @@ func (h *DocumentHandler) Bulk(w http.ResponseWriter, r *http.Request) {
 			if id, ok := meta["_id"].(string); ok {
 				bulkReq.ID = id
 			}
+			if routing, ok := meta["routing"]; ok {
+				bulkReq.Routing = parseRoutingValue(routing)
+			} else {
+				bulkReq.Routing = parseRoutingValue(meta["_routing"])
+			}
+			if retries, ok := meta["retry_on_conflict"].(float64); ok && retries > 0 {
+				bulkReq.RetryOnConflict = int(retries)
+			} else if retries, ok := meta["_retry_on_conflict"].(float64); ok && retries > 0 {
+				bulkReq.RetryOnConflict = int(retries)
+			}
 			bulkItems = append(bulkItems, bulkReq)
 		} else {
 			// 这是数据行，添加到最后一个bulk请求
@@ -159,6 +165,7 @@ func (h *DocumentHandler) Bulk(w http.ResponseWriter, r *http.Request) {
 					lastReq.Source = jsonLine
 				} else if lastReq.Action == "update" {
 					// update操作的数据格式通常是 {"doc": {...}, "doc_as_upsert": true} 或 {"script": {...}}
+					lastReq.UpdateBody = jsonLine
 					// jsonLine已经是map[string]interface{}类型，直接使用
 					// 如果包含doc字段，提取它
 					if doc, ok := jsonLine["doc"].(map[string]interface{}); ok {
@@ -184,6 +191,7 @@ func (h *DocumentHandler) Bulk(w http.ResponseWriter, r *http.Request) {
 	// 检查是否需要刷新索引（从查询参数）
 	refresh := r.URL.Query().Get("refresh")
 	shouldRefresh := refresh == "true" || refresh == "wait_for"
+	waitFor := refresh == "wait_for"
 
 	// 对于大量数据，使用流式响应避免超时
 	// 判断是否需要流式响应：如果操作数量超过阈值，使用流式响应
@@ -192,9 +200,9 @@ func (h *DocumentHandler) Bulk(w http.ResponseWriter, r *http.Request) {
 	useStreaming := len(bulkItems) > 100 // 超过100个操作使用流式响应
 
 	if useStreaming {
-		h.writeBulkResponseStreaming(w, bulkItems, shouldRefresh)
+		h.writeBulkResponseStreaming(w, r, bulkItems, shouldRefresh, waitFor)
 	} else {
-		h.writeBulkResponseSync(w, bulkItems, shouldRefresh)
+		h.writeBulkResponseSync(w, r, bulkItems, shouldRefresh, waitFor)
 	}
 }
 
@@ -238,6 +246,7 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 
 	// 创建Batch
 	batch := idx.NewBatch()
+	nested := h.newNestedBatch(idx, h.nestedPathsForIndex(indexName))
 
 	// 记录每个操作在batch中的位置，用于后续构建响应
 	type batchOp struct {
@@ -277,9 +286,20 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 			indexData := map[string]interface{}{
 				"_source": string(sourceJSON),
 			}
+			// 动态 mapping（失败时单独处理，以返回该条目的错误）
+			docBody, mapErr := h.applyDynamicMapping(indexName, docBody)
+			if mapErr != nil {
+				result := h.executeBulkOperation(item)
+				results = append(results, result)
+				continue
+			}
+			docBody = h.applyJoinField(indexName, docBody)
+			docBody = h.applySparseVectorFields(indexName, docBody)
+			docBody = h.applyPercolatorFields(indexName, docBody)
 			for k, v := range docBody {
 				indexData[k] = v
 			}
+			setDocumentRouting(indexData, item.Routing)
 
 			// 添加到batch
 			if err := batch.Index(docID, indexData); err != nil {
@@ -288,12 +308,14 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 				results = append(results, result)
 				continue
 			}
+			nested.add(docID, docBody)
 
 			batchOps = append(batchOps, batchOp{item: item, index: true})
 
 		case "delete":
 			if item.ID != "" {
 				batch.Delete(item.ID)
+				nested.add(item.ID, nil)
 				batchOps = append(batchOps, batchOp{item: item, delete: true})
 			} else {
 				// ID为空，单独处理
@@ -302,6 +324,11 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 			}
 
 		case "update":
+			// 设置了 retry_on_conflict 的 update 需要读取现有文档，单独处理
+			if item.RetryOnConflict > 0 {
+				results = append(results, h.executeBulkOperation(item))
+				continue
+			}
 			// 性能优化：支持批量 update 操作
 			// 如果设置了 doc_as_upsert，直接使用 doc 作为新文档
 			if item.DocAsUpsert {
@@ -323,9 +350,20 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 				indexData := map[string]interface{}{
 					"_source": string(sourceJSON),
 				}
+				// 动态 mapping（失败时单独处理，以返回该条目的错误）
+				docBody, mapErr := h.applyDynamicMapping(indexName, docBody)
+				if mapErr != nil {
+					result := h.executeBulkOperation(item)
+					results = append(results, result)
+					continue
+				}
+				docBody = h.applyJoinField(indexName, docBody)
+				docBody = h.applySparseVectorFields(indexName, docBody)
+				docBody = h.applyPercolatorFields(indexName, docBody)
 				for k, v := range docBody {
 					indexData[k] = v
 				}
+				setDocumentRouting(indexData, item.Routing)
 
 				// 添加到batch
 				if err := batch.Index(docID, indexData); err != nil {
@@ -334,6 +372,7 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 					results = append(results, result)
 					continue
 				}
+				nested.add(docID, docBody)
 
 				batchOps = append(batchOps, batchOp{item: item, index: true})
 			} else {
@@ -360,9 +399,20 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 				indexData := map[string]interface{}{
 					"_source": string(sourceJSON),
 				}
+				// 动态 mapping（失败时单独处理，以返回该条目的错误）
+				updateData, mapErr := h.applyDynamicMapping(indexName, updateData)
+				if mapErr != nil {
+					result := h.executeBulkOperation(item)
+					results = append(results, result)
+					continue
+				}
+				updateData = h.applyJoinField(indexName, updateData)
+				updateData = h.applySparseVectorFields(indexName, updateData)
+				updateData = h.applyPercolatorFields(indexName, updateData)
 				for k, v := range updateData {
 					indexData[k] = v
 				}
+				setDocumentRouting(indexData, item.Routing)
 
 				// 添加到batch
 				if err := batch.Index(docID, indexData); err != nil {
@@ -371,6 +421,7 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 					results = append(results, result)
 					continue
 				}
+				nested.add(docID, updateData)
 
 				batchOps = append(batchOps, batchOp{item: item, index: true})
 			}
@@ -388,6 +439,7 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 			}
 		}
 
+		nested.flush(batch)
 		if err := idx.Batch(batch); err != nil {
 			// batch执行失败，回退到单个处理
 			for _, op := range batchOps {
@@ -450,14 +502,15 @@ func (h *DocumentHandler) executeBulkOperationsBatch(idx bleve.Index, indexName
 					versionInfo := h.versionMgr.DeleteVersion(indexName, op.item.ID)
 					if versionInfo == nil {
 						// 文档不存在，返回not_found
+						notFound := h.versionMgr.NotFoundVersion()
 						opResult = map[string]interface{}{
 							"_index":        indexName,
 							"_id":           op.item.ID,
-							"_version":      0,
+							"_version":      notFound.Version,
 							"result":        "not_found",
 							"_shards":       map[string]interface{}{"total": 1, "successful": 1, "failed": 0},
-							"_seq_no":       0,
-							"_primary_term": 1,
+							"_seq_no":       notFound.SeqNo,
+							"_primary_term": notFound.PrimaryTerm,
 							"status":        http.StatusOK,
 						}
 					} else {
@@ -547,8 +600,39 @@ func (h *DocumentHandler) executeBulkOperation(item BulkRequest) map[string]inte
 	return result
 }
 
+// refreshBulkIndices 刷新批量操作涉及的索引
+// 未设置刷新间隔的索引写入在批次引入后即对搜索可见，只有关闭自动刷新的索引需要刷新；
+// waitFor 时并发等待各索引的下一次调度刷新，不强制刷新
+func (h *DocumentHandler) refreshBulkIndices(r *http.Request, bulkItems []BulkRequest, waitFor bool) {
+	indexesToRefresh := make(map[string]bool)
+	for _, item := range bulkItems {
+		if item.Index != "" {
+			indexesToRefresh[item.Index] = true
+		}
+	}
+	if waitFor {
+		var wg sync.WaitGroup
+		for indexName := range indexesToRefresh {
+			wg.Add(1)
+			go func(indexName string) {
+				defer wg.Done()
+				if err := h.indexMgr.WaitForRefresh(r.Context(), indexName); err != nil {
+					logger.Warn("Failed to wait for refresh of index [%s] after bulk: %v", indexName, err)
+				}
+			}(indexName)
+		}
+		wg.Wait()
+		return
+	}
+	for indexName := range indexesToRefresh {
+		if err := h.indexMgr.RefreshIndex(indexName); err != nil {
+			logger.Warn("Failed to refresh index [%s] after bulk: %v", indexName, err)
+		}
+	}
+}
+
 // writeBulkResponseStreaming 流式方式写入 bulk 响应（避免超时）
-func (h *DocumentHandler) writeBulkResponseStreaming(w http.ResponseWriter, bulkItems []BulkRequest, shouldRefresh bool) {
+func (h *DocumentHandler) writeBulkResponseStreaming(w http.ResponseWriter, r *http.Request, bulkItems []BulkRequest, shouldRefresh, waitFor bool) {
 	// 提前发送响应头，让客户端知道连接正常
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Connection", "keep-alive")
@@ -559,7 +643,7 @@ func (h *DocumentHandler) writeBulkResponseStreaming(w http.ResponseWriter, bulk
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		// 如果不支持 Flusher，回退到同步方式
-		h.writeBulkResponseSync(w, bulkItems, shouldRefresh)
+		h.writeBulkResponseSync(w, r, bulkItems, shouldRefresh, waitFor)
 		return
 	}
 
@@ -632,6 +716,10 @@ func (h *DocumentHandler) writeBulkResponseStreaming(w http.ResponseWriter, bulk
 		flusher.Flush()
 	}
 
+	if shouldRefresh {
+		h.refreshBulkIndices(r, bulkItems, waitFor)
+	}
+
 	// 写入响应结束部分
 	took := time.Since(startTime).Milliseconds()
 
@@ -654,7 +742,7 @@ func (h *DocumentHandler) writeBulkResponseStreaming(w http.ResponseWriter, bulk
 }
 
 // writeBulkResponseSync 同步方式写入 bulk 响应（用于小批量操作）
-func (h *DocumentHandler) writeBulkResponseSync(w http.ResponseWriter, bulkItems []BulkRequest, shouldRefresh bool) {
+func (h *DocumentHandler) writeBulkResponseSync(w http.ResponseWriter, r *http.Request, bulkItems []BulkRequest, shouldRefresh, waitFor bool) {
 	// 执行批量操作
 	startTime := time.Now()
 	results := h.executeBulkOperations(bulkItems)
@@ -662,13 +750,7 @@ func (h *DocumentHandler) writeBulkResponseSync(w http.ResponseWriter, bulkItems
 
 	// 如果需要刷新，刷新所有涉及的索引
 	if shouldRefresh {
-		indexesToRefresh := make(map[string]bool)
-		for _, item := range bulkItems {
-			if item.Index != "" {
-				indexesToRefresh[item.Index] = true
-			}
-		}
-		// Bleve索引是实时更新的，不需要显式刷新
+		h.refreshBulkIndices(r, bulkItems, waitFor)
 	}
 
 	// 构建响应
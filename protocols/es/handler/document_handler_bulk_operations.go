@@ -23,7 +23,6 @@ import (
 
 	"github.com/google/uuid"
 	bleve "github.com/lscgzwd/tiggerdb"
-	"github.com/lscgzwd/tiggerdb/nested/document"
 	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
 )
 
@@ -48,9 +47,7 @@ func (h *DocumentHandler) executeBulkIndexOperation(item BulkRequest, idx bleve.
 	// 如果需要严格检查 create 操作的冲突，可以在批量处理完成后统一检查
 	// 但考虑到性能，我们选择直接索引，牺牲一些精确性
 
-	// 暂时禁用嵌套文档处理，直接使用原始文档数据
 	docData := docBody
-	nestedDocs := make([]*document.NestedDocument, 0)
 
 	// P2-4: 应用copy_to规则
 	h.applyCopyToForIndex(item.Index, docData)
@@ -61,10 +58,28 @@ func (h *DocumentHandler) executeBulkIndexOperation(item BulkRequest, idx bleve.
 		"_source": string(sourceJSON), // 存储完整的原始文档JSON
 	}
 
+	// 动态 mapping：为未映射字段推断类型并更新索引 mapping
+	docData, mapErr := h.applyDynamicMapping(item.Index, docData)
+	if mapErr != nil {
+		return map[string]interface{}{
+			"_index": item.Index,
+			"_id":    docID,
+			"status": mapErr.StatusCode(),
+			"error": map[string]interface{}{
+				"type":   mapErr.Type(),
+				"reason": mapErr.Error(),
+			},
+		}
+	}
+	docData = h.applyJoinField(item.Index, docData)
+	docData = h.applySparseVectorFields(item.Index, docData)
+	docData = h.applyPercolatorFields(item.Index, docData)
+
 	// 将所有字段也添加到顶级，以便查询
 	for k, v := range docData {
 		indexData[k] = v
 	}
+	setDocumentRouting(indexData, item.Routing)
 
 	if err := idx.Index(docID, indexData); err != nil {
 		logger.Error("Failed to index document [%s] in index [%s]: %v", docID, item.Index, err)
@@ -79,15 +94,8 @@ func (h *DocumentHandler) executeBulkIndexOperation(item BulkRequest, idx bleve.
 		}
 	}
 
-	// 索引嵌套文档
-	nestedCount := 0
-	for _, nestedDoc := range nestedDocs {
-		if err := idx.Index(nestedDoc.ID, nestedDoc); err != nil {
-			logger.Warn("Failed to index nested document [%s]: %v", nestedDoc.ID, err)
-		} else {
-			nestedCount++
-		}
-	}
+	// 索引嵌套文档（替换该根文档之前的子文档）
+	h.syncNestedDocuments(idx, item.Index, docID, docData)
 
 	// P1-1: 使用版本管理器管理版本信息
 	// 检查文档是否存在，决定是创建还是更新版本
@@ -122,6 +130,10 @@ func (h *DocumentHandler) executeBulkIndexOperation(item BulkRequest, idx bleve.
 // executeBulkUpdateOperation 执行bulk update操作
 // 性能优化：移除文档存在性检查，直接更新（如果文档不存在，Bleve会创建新文档）
 func (h *DocumentHandler) executeBulkUpdateOperation(item BulkRequest, idx bleve.Index) map[string]interface{} {
+	if item.RetryOnConflict > 0 {
+		return h.executeBulkRetryUpdateOperation(item, idx)
+	}
+
 	// 当前实现：如果提供了doc，则执行部分更新
 	// 注意：script更新功能待实现
 	if item.Doc == nil && item.Source == nil {
@@ -165,10 +177,28 @@ func (h *DocumentHandler) executeBulkUpdateOperation(item BulkRequest, idx bleve
 			"_source": string(sourceJSON), // 存储完整的原始文档JSON
 		}
 
+		// 动态 mapping：为未映射字段推断类型并更新索引 mapping
+		docData, mapErr := h.applyDynamicMapping(item.Index, docData)
+		if mapErr != nil {
+			return map[string]interface{}{
+				"_index": item.Index,
+				"_id":    item.ID,
+				"status": mapErr.StatusCode(),
+				"error": map[string]interface{}{
+					"type":   mapErr.Type(),
+					"reason": mapErr.Error(),
+				},
+			}
+		}
+		docData = h.applyJoinField(item.Index, docData)
+		docData = h.applySparseVectorFields(item.Index, docData)
+		docData = h.applyPercolatorFields(item.Index, docData)
+
 		// 将所有字段也添加到顶级，以便查询
 		for k, v := range docData {
 			indexData[k] = v
 		}
+		setDocumentRouting(indexData, item.Routing)
 
 		// 索引新文档
 		if err := idx.Index(item.ID, indexData); err != nil {
@@ -184,6 +214,8 @@ func (h *DocumentHandler) executeBulkUpdateOperation(item BulkRequest, idx bleve
 			}
 		}
 
+		h.syncNestedDocuments(idx, item.Index, item.ID, docData)
+
 		// P1-1: 使用版本管理器管理版本信息
 		// 检查文档是否存在，决定是创建还是更新版本
 		existingDoc, _ := idx.Document(item.ID)
@@ -236,10 +268,28 @@ func (h *DocumentHandler) executeBulkUpdateOperation(item BulkRequest, idx bleve
 		"_source": string(sourceJSON),
 	}
 
+	// 动态 mapping：为未映射字段推断类型并更新索引 mapping
+	updateData, mapErr := h.applyDynamicMapping(item.Index, updateData)
+	if mapErr != nil {
+		return map[string]interface{}{
+			"_index": item.Index,
+			"_id":    item.ID,
+			"status": mapErr.StatusCode(),
+			"error": map[string]interface{}{
+				"type":   mapErr.Type(),
+				"reason": mapErr.Error(),
+			},
+		}
+	}
+	updateData = h.applyJoinField(item.Index, updateData)
+	updateData = h.applySparseVectorFields(item.Index, updateData)
+	updateData = h.applyPercolatorFields(item.Index, updateData)
+
 	// 将所有字段也添加到顶级，以便查询
 	for k, v := range updateData {
 		indexData[k] = v
 	}
+	setDocumentRouting(indexData, item.Routing)
 
 	// 更新文档（如果文档不存在，Bleve 会创建新文档）
 	if err := idx.Index(item.ID, indexData); err != nil {
@@ -255,6 +305,8 @@ func (h *DocumentHandler) executeBulkUpdateOperation(item BulkRequest, idx bleve
 		}
 	}
 
+	h.syncNestedDocuments(idx, item.Index, item.ID, updateData)
+
 	// P1-1: 使用版本管理器管理版本信息
 	// 检查文档是否存在，决定是创建还是更新版本
 	existingDoc, _ := idx.Document(item.ID)
@@ -282,6 +334,32 @@ func (h *DocumentHandler) executeBulkUpdateOperation(item BulkRequest, idx bleve
 	}
 }
 
+// executeBulkRetryUpdateOperation 按 update API 的语义执行设置了 retry_on_conflict 的 bulk update
+// 读取现有文档后合并 doc 或执行 script，版本冲突时重新读取并重试
+func (h *DocumentHandler) executeBulkRetryUpdateOperation(item BulkRequest, idx bleve.Index) map[string]interface{} {
+	outcome, apiErr := h.executeUpdate(idx, item.Index, item.ID, item.Routing, item.UpdateBody, item.RetryOnConflict)
+	if apiErr != nil {
+		result := bulkBlockError(apiErr)
+		result["_index"] = item.Index
+		result["_id"] = item.ID
+		return result
+	}
+	successful := 1
+	if outcome.result == updateOpNoop {
+		successful = 0
+	}
+	return map[string]interface{}{
+		"_index":        item.Index,
+		"_id":           item.ID,
+		"_version":      outcome.version.Version,
+		"result":        outcome.result,
+		"_shards":       map[string]interface{}{"total": successful, "successful": successful, "failed": 0},
+		"_seq_no":       outcome.version.SeqNo,
+		"_primary_term": outcome.version.PrimaryTerm,
+		"status":        outcome.status,
+	}
+}
+
 // executeBulkDeleteOperation 执行bulk delete操作
 // 性能优化：移除文档存在性检查，直接删除（Bleve会处理不存在的文档）
 func (h *DocumentHandler) executeBulkDeleteOperation(item BulkRequest, idx bleve.Index) map[string]interface{} {
@@ -314,18 +392,20 @@ func (h *DocumentHandler) executeBulkDeleteOperation(item BulkRequest, idx bleve
 			},
 		}
 	}
+	h.deleteNestedDocuments(idx, item.Index, item.ID)
 
 	// 根据版本信息判断文档是否存在
 	if versionInfo == nil {
 		// 文档不存在，返回not_found
+		notFound := h.versionMgr.NotFoundVersion()
 		return map[string]interface{}{
 			"_index":        item.Index,
 			"_id":           item.ID,
-			"_version":      0,
+			"_version":      notFound.Version,
 			"result":        "not_found",
 			"_shards":       map[string]interface{}{"total": 1, "successful": 1, "failed": 0},
-			"_seq_no":       0,
-			"_primary_term": 1,
+			"_seq_no":       notFound.SeqNo,
+			"_primary_term": notFound.PrimaryTerm,
 			"status":        http.StatusOK,
 		}
 	}
@@ -368,6 +448,18 @@ func (h *DocumentHandler) validateBulkRequest(item BulkRequest) (bleve.Index, ma
 		}
 	}
 
+	// 检查索引 block（delete 操作在 read_only_allow_delete 下仍允许）
+	level := blockLevelWrite
+	if item.Action == "delete" {
+		level = blockLevelDelete
+	}
+	if apiErr := checkIndexBlock(h.metaStore, item.Index, level); apiErr != nil {
+		return nil, bulkBlockError(apiErr)
+	}
+	if apiErr := checkRouting(h.metaStore, item.Index, item.ID, item.Routing); apiErr != nil {
+		return nil, bulkBlockError(apiErr)
+	}
+
 	// 获取索引实例
 	idx, err := h.indexMgr.GetIndex(item.Index)
 	if err != nil {
@@ -15,6 +15,8 @@
 package handler
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -25,6 +27,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/lscgzwd/tiggerdb/directory"
 	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
 	esIndex "github.com/lscgzwd/tiggerdb/protocols/es/index"
 )
 
@@ -553,3 +556,49 @@ func TestBulk_AutoID(t *testing.T) {
 
 	t.Log("Bulk auto ID test passed")
 }
+
+// TestBulk_LongLineAndBodyLimit 测试超过读缓冲区的长文档行，以及超出请求体大小限制时返回 413
+func TestBulk_LongLineAndBodyLimit(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	handler := server.RequestSizeLimitMiddleware(64 << 10)(router.Build().ServeHTTP)
+
+	do := func(method, path, contentType string, body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", contentType)
+		handler(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/logs", "application/json", strings.NewReader(`{}`)); w.Code != http.StatusOK {
+		t.Fatalf("create index failed: %d %s", w.Code, w.Body.String())
+	}
+
+	message := strings.Repeat("x", 16<<10)
+	bulk := `{"index":{"_index":"logs","_id":"1"}}` + "\n" + `{"message":"` + message + `"}` + "\n"
+	w := do("POST", "/_bulk?refresh=true", "application/x-ndjson", strings.NewReader(bulk))
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk failed: %d %s", w.Code, w.Body.String())
+	}
+	var bulkResp BulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &bulkResp); err != nil || bulkResp.Errors || len(bulkResp.Items) != 1 {
+		t.Fatalf("unexpected bulk response: %s", w.Body.String())
+	}
+
+	// 不带 Content-Length 的请求体在读取时才超出限制
+	query := `{"query":{"terms":{"message":["` + strings.Repeat("y", 80<<10) + `"]}}}`
+	w = do("POST", "/logs/_search", "application/json", io.MultiReader(strings.NewReader(query)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversized search body, got %d %s", w.Code, w.Body.String())
+	}
+	oversized := strings.Repeat(bulk, 5)
+	if w = do("POST", "/_bulk", "application/x-ndjson", io.MultiReader(strings.NewReader(oversized))); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversized bulk body, got %d %s", w.Code, w.Body.String())
+	}
+}
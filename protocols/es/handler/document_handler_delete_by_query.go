@@ -26,7 +26,6 @@ import (
 	"github.com/gorilla/mux"
 	bleve "github.com/lscgzwd/tiggerdb"
 	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
-	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
 )
 
 // DeleteByQueryRequest 删除查询请求
@@ -72,6 +71,12 @@ func (h *DocumentHandler) DeleteByQuery(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelDelete); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 获取索引实例
 	idx, err := h.indexMgr.GetIndex(indexName)
 	if err != nil {
@@ -84,7 +89,7 @@ func (h *DocumentHandler) DeleteByQuery(w http.ResponseWriter, r *http.Request)
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error("Failed to read delete_by_query request body: %v", err)
-		common.HandleError(w, common.NewBadRequestError("failed to read request body: "+err.Error()))
+		common.HandleError(w, common.NewRequestBodyError("failed to read request body", err))
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -94,7 +99,7 @@ func (h *DocumentHandler) DeleteByQuery(w http.ResponseWriter, r *http.Request)
 	if len(bodyBytes) > 0 {
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&req); err != nil && err != io.EOF {
-			common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+			common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 			return
 		}
 	}
@@ -106,7 +111,7 @@ func (h *DocumentHandler) DeleteByQuery(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 解析查询
-	parser := dsl.NewQueryParser()
+	parser := h.newQueryParser(indexName)
 	bleveQuery, err := parser.ParseQuery(req.Query)
 	if err != nil {
 		logger.Error("Failed to parse query: %v", err)
@@ -153,6 +158,14 @@ func (h *DocumentHandler) DeleteByQuery(w http.ResponseWriter, r *http.Request)
 	// 性能提升：10-20秒 -> 1-2秒（10万文档场景）
 	logger.Info("DeleteByQuery [%s] - Starting delete with max_docs=%d", indexName, maxDocs)
 
+	// 展开 nested/join 查询，只删除匹配的根文档（子文档随根文档一起删除）
+	bleveQuery, err = h.resolveRootQuery(idx, indexName, bleveQuery)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError("failed to process join query: "+err.Error()))
+		return
+	}
+	nested := h.newNestedBatch(idx, h.nestedPathsForIndex(indexName))
+
 	// 一次性搜索获取所有匹配的文档ID
 	// 使用Fields机制只获取ID字段，减少数据传输量
 	searchReq := bleve.NewSearchRequest(bleveQuery)
@@ -178,6 +191,7 @@ func (h *DocumentHandler) DeleteByQuery(w http.ResponseWriter, r *http.Request)
 		// 将所有文档ID添加到batch中
 		for _, hit := range searchResults.Hits {
 			batch.Delete(hit.ID)
+			nested.add(hit.ID, nil)
 			batchSize++
 		}
 
@@ -186,6 +200,7 @@ func (h *DocumentHandler) DeleteByQuery(w http.ResponseWriter, r *http.Request)
 		// 1. 只需要一次搜索操作（而不是100+次）
 		// 2. 只需要一次batch操作（而不是100+次）
 		// 3. 减少了索引Reader的创建/关闭开销
+		nested.flush(batch)
 		if err := idx.Batch(batch); err != nil {
 			logger.Error("Failed to execute delete batch: %v", err)
 			versionConflicts = int64(batchSize)
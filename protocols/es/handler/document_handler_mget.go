@@ -0,0 +1,386 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 批量获取（_mget）
+// 每个文档可单独指定 _index、routing、_source（布尔、字段列表或 includes/excludes 对象）与 stored_fields，
+// 未指定时使用 URL 参数（_source、_source_includes、_source_excludes、stored_fields、routing）。
+// 文档按索引分组，每组复用一个 IndexReader；多个索引的分组通过节点共享的有界 worker 池并发获取，
+// 并发上限由集群动态设置 search.mget.max_concurrency 控制（<= 0 时使用 GOMAXPROCS）。
+
+// mgetPool 跨索引 mget 分组并发获取的 worker 池
+var mgetPool = newAggregationPool(0)
+
+// SetMultiGetConcurrency 设置 mget 跨索引并发获取的 worker 上限，<= 0 时使用 GOMAXPROCS
+func SetMultiGetConcurrency(limit int) {
+	mgetPool.setLimit(limit)
+}
+
+// MultiGetPoolStats 返回 mget worker 池指标（用于 /_metrics）
+func MultiGetPoolStats() interface{} {
+	return mgetPool.stats()
+}
+
+// mgetDocRequest mget 中单个文档的请求
+type mgetDocRequest struct {
+	index        int // 原始顺序
+	docID        string
+	routing      string
+	source       *sourceFilter
+	storedFields []string
+}
+
+// MultiGet 批量获取文档
+// GET /_mget
+// POST /_mget
+// GET /{index}/_mget
+// POST /{index}/_mget
+func (h *DocumentHandler) MultiGet(w http.ResponseWriter, r *http.Request) {
+	// 获取索引名称（可能为空，表示全局搜索）
+	indexName := mux.Vars(r)["index"]
+
+	// 解析请求体（兼容 chunked）
+	var requestBody map[string]interface{}
+	if r.Method == http.MethodPost {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&requestBody); err != nil && err != io.EOF {
+			common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+			return
+		}
+	} else {
+		// GET 请求，从查询参数解析
+		// ES 的 GET /_mget 支持 ids 参数：?ids=id1,id2,id3
+		idsParam := r.URL.Query().Get("ids")
+		if idsParam != "" {
+			// 解析逗号分隔的 ID 列表
+			ids := strings.Split(idsParam, ",")
+			docs := make([]interface{}, 0, len(ids))
+			for _, id := range ids {
+				id = strings.TrimSpace(id)
+				if id != "" {
+					doc := map[string]interface{}{
+						"_id": id,
+					}
+					if indexName != "" {
+						doc["_index"] = indexName
+					}
+					docs = append(docs, doc)
+				}
+			}
+			requestBody = map[string]interface{}{
+				"docs": docs,
+			}
+		} else {
+			common.HandleError(w, common.NewBadRequestError("request body is required for POST, or 'ids' parameter for GET"))
+			return
+		}
+	}
+
+	// 解析 docs 数组
+	docs, ok := requestBody["docs"].([]interface{})
+	if !ok {
+		common.HandleError(w, common.NewBadRequestError("request body must contain 'docs' array"))
+		return
+	}
+
+	// URL 参数中的 _source 过滤、stored_fields 与 routing 作为各文档的默认值
+	query := r.URL.Query()
+	defaultSource := parseSourceFilter(query)
+	defaultStoredFields := splitCommaList(query.Get("stored_fields"))
+	defaultRouting := requestRouting(r)
+
+	// 解析所有文档请求并按索引分组
+	indexGroups := make(map[string][]mgetDocRequest)
+	responses := make([]map[string]interface{}, len(docs))
+	itemError := func(i int, docIndex, docID, reason string) {
+		responses[i] = map[string]interface{}{
+			"error": map[string]interface{}{"type": "illegal_argument_exception", "reason": reason},
+		}
+		if docIndex != "" {
+			responses[i]["_index"] = docIndex
+		}
+		if docID != "" {
+			responses[i]["_id"] = docID
+		}
+	}
+
+	for i, docItem := range docs {
+		docMap, ok := docItem.(map[string]interface{})
+		if !ok {
+			if docID, ok := docItem.(string); ok {
+				docMap = map[string]interface{}{"_id": docID}
+			} else {
+				logger.Warn("Invalid doc item in mget request: %v", docItem)
+				itemError(i, "", "", "invalid doc item")
+				continue
+			}
+		}
+
+		docIndexName := indexName
+		if idx, ok := docMap["_index"].(string); ok && idx != "" {
+			docIndexName = idx
+		}
+
+		docID, ok := docMap["_id"].(string)
+		if !ok {
+			itemError(i, docIndexName, "", "missing _id in doc")
+			continue
+		}
+
+		if docIndexName == "" {
+			itemError(i, "", docID, "missing _index in doc")
+			continue
+		}
+
+		req := mgetDocRequest{
+			index:        i,
+			docID:        docID,
+			routing:      defaultRouting,
+			source:       defaultSource,
+			storedFields: defaultStoredFields,
+		}
+		if v, ok := docMap["routing"]; ok {
+			req.routing = parseRoutingValue(v)
+		} else if v, ok := docMap[routingField]; ok {
+			req.routing = parseRoutingValue(v)
+		}
+		if v, ok := docMap["_source"]; ok {
+			source, err := parseMgetSourceFilter(v)
+			if err != nil {
+				itemError(i, docIndexName, docID, err.Error())
+				continue
+			}
+			req.source = source
+		}
+		if v, ok := docMap["stored_fields"]; ok {
+			storedFields, err := parseMgetStoredFields(v)
+			if err != nil {
+				itemError(i, docIndexName, docID, err.Error())
+				continue
+			}
+			req.storedFields = storedFields
+		}
+		indexGroups[docIndexName] = append(indexGroups[docIndexName], req)
+	}
+
+	// 按索引分组并发获取，各分组只写入自己文档的响应位置
+	tasks := make([]func(), 0, len(indexGroups))
+	for idxName, requests := range indexGroups {
+		idxName, requests := idxName, requests
+		tasks = append(tasks, func() { h.multiGetFromIndex(r.Context(), idxName, requests, responses) })
+	}
+	if len(tasks) > 0 {
+		mgetPool.run(tasks)
+	}
+
+	// 构建 ES 格式响应
+	mgetResponse := map[string]interface{}{
+		"docs": responses,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(mgetResponse); err != nil {
+		logger.Error("Failed to encode mget response: %v", err)
+	}
+}
+
+// multiGetFromIndex 获取同一索引中的一组文档，复用一个 IndexReader
+// 不满足请求角色文档级安全查询的文档视为不存在
+func (h *DocumentHandler) multiGetFromIndex(ctx context.Context, idxName string, requests []mgetDocRequest, responses []map[string]interface{}) {
+	itemError := func(req mgetDocRequest, errType, reason string) {
+		responses[req.index] = map[string]interface{}{
+			"_index": idxName, "_id": req.docID,
+			"error": map[string]interface{}{"type": errType, "reason": reason},
+		}
+	}
+
+	if !h.dirMgr.IndexExists(idxName) {
+		for _, req := range requests {
+			responses[req.index] = map[string]interface{}{"_index": idxName, "_id": req.docID, "found": false}
+		}
+		return
+	}
+
+	// 被 read block 拦截的索引，逐项返回错误
+	if apiErr := checkIndexBlock(h.metaStore, idxName, blockLevelRead); apiErr != nil {
+		for _, req := range requests {
+			itemError(req, apiErr.Type(), apiErr.Error())
+		}
+		return
+	}
+
+	idx, err := h.indexMgr.GetIndex(idxName)
+	if err != nil {
+		for _, req := range requests {
+			itemError(req, "index_not_found_exception", err.Error())
+		}
+		return
+	}
+
+	// 复用单个IndexReader，避免每次调用idx.Document()都创建新的Reader
+	var reader index.IndexReader
+	if advancedIdx, err := idx.Advanced(); err == nil {
+		if reader, err = advancedIdx.Reader(); err == nil {
+			defer reader.Close()
+		} else {
+			reader = nil
+		}
+	}
+
+	access := requestIndexAccess(ctx, idxName)
+	routingIsRequired := routingRequired(h.metaStore, idxName)
+	hasSource := sourceEnabled(h.metaStore, idxName)
+	for _, req := range requests {
+		if routingIsRequired && req.routing == "" {
+			apiErr := common.NewRoutingMissingError(idxName, req.docID)
+			itemError(req, apiErr.Type(), apiErr.Error())
+			continue
+		}
+		var doc index.Document
+		var docErr error
+		if reader != nil {
+			doc, docErr = reader.Document(req.docID)
+		} else {
+			// 回退到逐个获取（每次调用idx.Document()都会创建新Reader）
+			doc, docErr = idx.Document(req.docID)
+		}
+
+		if docErr != nil || doc == nil || !h.documentVisible(idx, idxName, access, req.docID) {
+			responses[req.index] = map[string]interface{}{"_index": idxName, "_id": req.docID, "found": false}
+			continue
+		}
+
+		docData := access.FilterSource(h.extractDocumentFields(doc))
+
+		// P1-1: 获取文档版本信息
+		versionInfo := h.versionMgr.GetVersion(idxName, req.docID)
+		version := int64(1)
+		seqNo := int64(0)
+		primaryTerm := int64(1)
+		if versionInfo != nil {
+			version = versionInfo.Version
+			seqNo = versionInfo.SeqNo
+			primaryTerm = versionInfo.PrimaryTerm
+		}
+
+		responseItem := map[string]interface{}{
+			"_index":        idxName,
+			"_id":           req.docID,
+			"_version":      version,
+			"_seq_no":       seqNo,
+			"_primary_term": primaryTerm,
+			"found":         true,
+		}
+		if routing := documentRouting(doc); routing != "" {
+			responseItem[routingField] = routing
+		}
+
+		// 与 get 一致：指定 stored_fields 时只返回 store: true 的字段，除非同时显式请求了 _source
+		if req.source.fetch && (len(req.storedFields) == 0 || req.source.explicit) && hasSource {
+			responseItem["_source"] = req.source.apply(docData)
+		}
+		if len(req.storedFields) > 0 && req.storedFields[0] != "_none_" {
+			if fields := storedFieldValues(h.metaStore, idxName, docData, req.storedFields); len(fields) > 0 {
+				responseItem["fields"] = fields
+			}
+		}
+		responses[req.index] = responseItem
+	}
+}
+
+// parseMgetSourceFilter 解析 mget 文档的 _source：布尔、逗号分隔的字段、字段数组，
+// 或 {"includes": [...], "excludes": [...]} 对象（兼容 include/exclude）
+func parseMgetSourceFilter(v interface{}) (*sourceFilter, error) {
+	f := &sourceFilter{fetch: true, explicit: true}
+	switch value := v.(type) {
+	case bool:
+		f.fetch = value
+	case string:
+		f.includes = splitCommaList(value)
+	case []interface{}:
+		includes, err := stringList(value, "_source")
+		if err != nil {
+			return nil, err
+		}
+		f.includes = includes
+	case map[string]interface{}:
+		for key, patterns := range value {
+			var list []string
+			switch p := patterns.(type) {
+			case string:
+				list = splitCommaList(p)
+			case []interface{}:
+				var err error
+				if list, err = stringList(p, "_source."+key); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fmt.Errorf("[_source.%s] must be a string or an array of strings", key)
+			}
+			switch key {
+			case "includes", "include":
+				f.includes = append(f.includes, list...)
+			case "excludes", "exclude":
+				f.excludes = append(f.excludes, list...)
+			default:
+				return nil, fmt.Errorf("unknown key [%s] in [_source]", key)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("[_source] must be a boolean, a string, an array or an object")
+	}
+	return f, nil
+}
+
+// parseMgetStoredFields 解析 mget 文档的 stored_fields：逗号分隔的字段或字段数组
+func parseMgetStoredFields(v interface{}) ([]string, error) {
+	switch value := v.(type) {
+	case string:
+		return splitCommaList(value), nil
+	case []interface{}:
+		return stringList(value, "stored_fields")
+	default:
+		return nil, fmt.Errorf("[stored_fields] must be a string or an array of strings")
+	}
+}
+
+// stringList 将 JSON 数组转换为字符串列表
+func stringList(values []interface{}, name string) ([]string, error) {
+	rv := make([]string, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("[%s] must be an array of strings, got [%v]", name, v)
+		}
+		rv = append(rv, s)
+	}
+	return rv, nil
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_MultiGetFields(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/_mget", Handler: docHandler.MultiGet},
+		{Method: "POST", Path: "/{index}/_mget", Handler: docHandler.MultiGet},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	mget := func(path, body string) []map[string]interface{} {
+		t.Helper()
+		w := do("POST", path, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("mget %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Docs []map[string]interface{} `json:"docs"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Docs
+	}
+	asJSON := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+
+	mapping := `{"mappings":{"properties":{"title":{"type":"keyword","store":true},"body":{"type":"text"},` +
+		`"meta":{"properties":{"author":{"type":"keyword"},"tags":{"type":"keyword"}}}}}}`
+	var bulk strings.Builder
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("books%d", i)
+		if w := do("PUT", "/"+name, mapping); w.Code != http.StatusOK {
+			t.Fatalf("create %s: got %d: %s", name, w.Code, w.Body.String())
+		}
+		for j := 0; j < 5; j++ {
+			fmt.Fprintf(&bulk, "{\"index\":{\"_index\":%q,\"_id\":\"%d\",\"routing\":\"r%d\"}}\n", name, j, j)
+			fmt.Fprintf(&bulk, "{\"title\":\"t%d-%d\",\"body\":\"b\",\"meta\":{\"author\":\"a%d\",\"tags\":[\"x\",\"y\"]}}\n", i, j, j)
+		}
+	}
+	if w := do("POST", "/_bulk?refresh=true", bulk.String()); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 跨索引的文档按原始顺序返回
+	var docs strings.Builder
+	for j := 4; j >= 0; j-- {
+		for i := 0; i < 4; i++ {
+			if docs.Len() > 0 {
+				docs.WriteString(",")
+			}
+			fmt.Fprintf(&docs, `{"_index":"books%d","_id":"%d"}`, i, j)
+		}
+	}
+	results := mget("/_mget", `{"docs":[`+docs.String()+`,{"_index":"missing","_id":"1"}]}`)
+	if len(results) != 21 {
+		t.Fatalf("expected 21 docs, got %d", len(results))
+	}
+	for k, doc := range results[:20] {
+		i, j := k%4, 4-k/4
+		source, _ := doc["_source"].(map[string]interface{})
+		if doc["_index"] != fmt.Sprintf("books%d", i) || doc["found"] != true || source["title"] != fmt.Sprintf("t%d-%d", i, j) ||
+			doc["_routing"] != fmt.Sprintf("r%d", j) {
+			t.Errorf("doc %d: unexpected %s", k, asJSON(doc))
+		}
+	}
+	if results[20]["found"] != false {
+		t.Errorf("expected missing index doc not found, got %s", asJSON(results[20]))
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "source object",
+			path:     "/books0/_mget",
+			body:     `{"docs":[{"_id":"1","_source":{"includes":["meta.*"],"excludes":["meta.tags"]}}]}`,
+			expected: `{"meta":{"author":"a1"}}`,
+		},
+		{
+			name:     "source list",
+			path:     "/books0/_mget",
+			body:     `{"docs":[{"_id":"1","_source":["title","meta.author"]}]}`,
+			expected: `{"meta":{"author":"a1"},"title":"t0-1"}`,
+		},
+		{
+			name:     "source disabled",
+			path:     "/books0/_mget",
+			body:     `{"docs":[{"_id":"1","_source":false}]}`,
+			expected: `null`,
+		},
+		{
+			name:     "url source default",
+			path:     "/books0/_mget?_source_includes=title",
+			body:     `{"docs":[{"_id":"1"},{"_id":"2","_source":"body"}]}`,
+			expected: `{"title":"t0-1"}`,
+		},
+	}
+	for _, tt := range tests {
+		results := mget(tt.path, tt.body)
+		if got := asJSON(results[0]["_source"]); got != tt.expected {
+			t.Errorf("%s: expected _source %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+	if results := mget("/books0/_mget?_source_includes=title", `{"docs":[{"_id":"2","_source":"body"}]}`); asJSON(results[0]["_source"]) != `{"body":"b"}` {
+		t.Errorf("expected per-doc _source to override the url one, got %s", asJSON(results[0]))
+	}
+
+	// stored_fields 只返回 store: true 的字段，显式请求 _source 时同时返回
+	results = mget("/books1/_mget", `{"docs":[
+		{"_id":"3","stored_fields":["title","body"]},
+		{"_id":"3","stored_fields":"title","_source":["body"]},
+		{"_id":"3","stored_fields":["_none_"]}
+	]}`)
+	if asJSON(results[0]["fields"]) != `{"title":["t1-3"]}` || results[0]["_source"] != nil {
+		t.Errorf("stored fields: unexpected %s", asJSON(results[0]))
+	}
+	if asJSON(results[1]["fields"]) != `{"title":["t1-3"]}` || asJSON(results[1]["_source"]) != `{"body":"b"}` {
+		t.Errorf("stored fields with source: unexpected %s", asJSON(results[1]))
+	}
+	if results[2]["fields"] != nil || results[2]["_source"] != nil || results[2]["found"] != true {
+		t.Errorf("stored fields none: unexpected %s", asJSON(results[2]))
+	}
+	results = mget("/books1/_mget?stored_fields=title", `{"docs":[{"_id":"3"},{"_id":"4","_routing":"r4"}]}`)
+	if asJSON(results[0]["fields"]) != `{"title":["t1-3"]}` || results[1]["_routing"] != "r4" {
+		t.Errorf("url stored fields: unexpected %s", asJSON(results))
+	}
+
+	// 无效的 _source 或 stored_fields 只影响对应的文档
+	results = mget("/books0/_mget", `{"docs":[{"_id":"1","_source":{"only":["title"]}},{"_id":"1","stored_fields":1},{"_id":"1"}]}`)
+	if !strings.Contains(asJSON(results[0]), "unknown key [only] in [_source]") ||
+		!strings.Contains(asJSON(results[1]), "[stored_fields] must be a string or an array of strings") ||
+		results[2]["found"] != true {
+		t.Errorf("invalid items: unexpected %s", asJSON(results))
+	}
+}
@@ -16,6 +16,7 @@ package handler
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -53,7 +54,7 @@ func (h *DocumentHandler) MultiSearch(w http.ResponseWriter, r *http.Request) {
 	// 执行多个搜索请求
 	results := make([]map[string]interface{}, 0, len(searchRequests))
 	for _, req := range searchRequests {
-		result := h.executeSingleMultiSearch(req)
+		result := h.executeSingleMultiSearch(r.Context(), req)
 		results = append(results, result)
 	}
 
@@ -97,7 +98,7 @@ func (h *DocumentHandler) parseMultiSearchRequest(reader *bufio.Reader) ([]Multi
 		}
 		if err != nil {
 			logger.Error("Failed to read multi-search request line %d: %v", lineNum, err)
-			return nil, common.NewBadRequestError("failed to read request: " + err.Error())
+			return nil, common.NewRequestBodyError("failed to read request", err)
 		}
 
 		line = strings.TrimSpace(line)
@@ -143,7 +144,7 @@ func (h *DocumentHandler) parseMultiSearchRequest(reader *bufio.Reader) ([]Multi
 }
 
 // executeSingleMultiSearch 执行单个多搜索请求
-func (h *DocumentHandler) executeSingleMultiSearch(req MultiSearchRequest) map[string]interface{} {
+func (h *DocumentHandler) executeSingleMultiSearch(ctx context.Context, req MultiSearchRequest) map[string]interface{} {
 	// 获取索引名称
 	indexName, ok := req.Header["index"].(string)
 	if !ok || indexName == "" {
@@ -175,6 +176,17 @@ func (h *DocumentHandler) executeSingleMultiSearch(req MultiSearchRequest) map[s
 		}
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelRead); apiErr != nil {
+		return map[string]interface{}{
+			"error": map[string]interface{}{
+				"type":   apiErr.Type(),
+				"reason": apiErr.Error(),
+			},
+			"status": apiErr.StatusCode(),
+		}
+	}
+
 	// 获取索引实例
 	idx, err := h.indexMgr.GetIndex(indexName)
 	if err != nil {
@@ -201,8 +213,19 @@ func (h *DocumentHandler) executeSingleMultiSearch(req MultiSearchRequest) map[s
 		}
 	}
 
+	// 深分页保护
+	if apiErr := checkResultWindow(h.metaStore, indexName, searchReq.From, searchReq.Size, false); apiErr != nil {
+		return map[string]interface{}{
+			"error": map[string]interface{}{
+				"type":   apiErr.Type(),
+				"reason": apiErr.Error(),
+			},
+			"status": apiErr.StatusCode(),
+		}
+	}
+
 	// 执行搜索（复用Search方法的逻辑）
-	result, err := h.executeSearchInternal(idx, indexName, &searchReq)
+	result, err := h.executeSearchInternal(ctx, idx, indexName, &searchReq)
 	if err != nil {
 		logger.Error("Failed to execute search for index [%s]: %v", indexName, err)
 		// 将错误转换为ES格式
@@ -0,0 +1,299 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/rerank"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// defaultRescoreWindowSize 与 ES 相同，默认对前 10 条结果重新打分
+const defaultRescoreWindowSize = 10
+
+// rescore 查询的得分组合方式
+const (
+	rescoreScoreModeTotal    = "total"
+	rescoreScoreModeMultiply = "multiply"
+	rescoreScoreModeAvg      = "avg"
+	rescoreScoreModeMax      = "max"
+	rescoreScoreModeMin      = "min"
+)
+
+// rescoreSpec 一个重排序阶段，query 与 reranker 二选一
+// ES格式: {"rescore": {"window_size": 50, "query": {"rescore_query": {...}, "query_weight": 0.7, "rescore_query_weight": 1.2, "score_mode": "total"}}}
+// 或: {"rescore": {"window_size": 50, "reranker": {"name": "bge", "field": "content", "text": "query text"}}}
+// 多个阶段使用数组，按顺序执行
+type rescoreSpec struct {
+	windowSize int
+
+	// query 重排序器
+	query              query.Query
+	queryWeight        float64
+	rescoreQueryWeight float64
+	scoreMode          string
+
+	// reranker 重排序器
+	name     string
+	reranker rerank.Reranker
+	field    string // 提供给重排序模型的文档字段
+	text     string // 重排序使用的查询文本
+}
+
+// parseRescore 解析 rescore 参数，parseQuery 用于解析 rescore_query
+func parseRescore(raw interface{}, parseQuery func(map[string]interface{}) (query.Query, error)) ([]*rescoreSpec, error) {
+	var items []interface{}
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		items = v
+	default:
+		items = []interface{}{v}
+	}
+
+	specs := make([]*rescoreSpec, 0, len(items))
+	for _, item := range items {
+		rescoreMap, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[rescore] must be an object or an array of objects")
+		}
+		spec := &rescoreSpec{windowSize: defaultRescoreWindowSize}
+		if ws, ok := rescoreMap["window_size"]; ok {
+			size, ok := ws.(float64)
+			if !ok || size < 1 || size != float64(int(size)) {
+				return nil, fmt.Errorf("[rescore] [window_size] must be a positive integer")
+			}
+			spec.windowSize = int(size)
+		}
+
+		if queryMap, ok := rescoreMap["query"].(map[string]interface{}); ok {
+			if err := parseQueryRescorer(spec, queryMap, parseQuery); err != nil {
+				return nil, err
+			}
+			specs = append(specs, spec)
+			continue
+		}
+		rerankerMap, ok := rescoreMap["reranker"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[rescore] requires a [query] or [reranker] object")
+		}
+		spec.name, _ = rerankerMap["name"].(string)
+		spec.field, _ = rerankerMap["field"].(string)
+		spec.text, _ = rerankerMap["text"].(string)
+		if spec.name == "" || spec.field == "" || spec.text == "" {
+			return nil, fmt.Errorf("[rescore] [reranker] requires [name], [field] and [text]")
+		}
+		if spec.reranker, ok = rerank.Get(spec.name); !ok {
+			return nil, fmt.Errorf("[rescore] unknown reranker [%s]", spec.name)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// parseQueryRescorer 解析 query 重排序器
+func parseQueryRescorer(spec *rescoreSpec, queryMap map[string]interface{}, parseQuery func(map[string]interface{}) (query.Query, error)) error {
+	rescoreQuery, ok := queryMap["rescore_query"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("[rescore] [query] requires a [rescore_query] object")
+	}
+	q, err := parseQuery(rescoreQuery)
+	if err != nil {
+		return fmt.Errorf("[rescore] failed to parse [rescore_query]: %w", err)
+	}
+	spec.query = q
+	spec.queryWeight = 1
+	spec.rescoreQueryWeight = 1
+	for key, target := range map[string]*float64{"query_weight": &spec.queryWeight, "rescore_query_weight": &spec.rescoreQueryWeight} {
+		if v, ok := queryMap[key]; ok {
+			weight, ok := v.(float64)
+			if !ok {
+				return fmt.Errorf("[rescore] [%s] must be a number", key)
+			}
+			*target = weight
+		}
+	}
+	spec.scoreMode = rescoreScoreModeTotal
+	if v, ok := queryMap["score_mode"]; ok {
+		mode, _ := v.(string)
+		switch mode {
+		case rescoreScoreModeTotal, rescoreScoreModeMultiply, rescoreScoreModeAvg, rescoreScoreModeMax, rescoreScoreModeMin:
+			spec.scoreMode = mode
+		default:
+			return fmt.Errorf("[rescore] illegal score_mode [%v]", v)
+		}
+	}
+	return nil
+}
+
+// combineRescore 按 score_mode 组合原得分与 rescore_query 得分
+func combineRescore(spec *rescoreSpec, primary, secondary float64) float64 {
+	primary *= spec.queryWeight
+	secondary *= spec.rescoreQueryWeight
+	switch spec.scoreMode {
+	case rescoreScoreModeMultiply:
+		return primary * secondary
+	case rescoreScoreModeAvg:
+		return (primary + secondary) / 2
+	case rescoreScoreModeMax:
+		return math.Max(primary, secondary)
+	case rescoreScoreModeMin:
+		return math.Min(primary, secondary)
+	default:
+		return primary + secondary
+	}
+}
+
+// rescoreQueryScores 在窗口内的文档上执行 rescore_query，返回匹配文档的得分
+func rescoreQueryScores(ctx context.Context, idx bleve.Index, q query.Query, window search.DocumentMatchCollection) (map[string]float64, error) {
+	ids := make([]string, len(window))
+	for i, hit := range window {
+		ids[i] = hit.ID
+	}
+	boolQuery := query.NewBooleanQuery([]query.Query{q}, nil, nil)
+	boolQuery.AddFilter(query.NewDocIDQuery(ids))
+	req := bleve.NewSearchRequest(boolQuery)
+	req.Size = len(ids)
+	result, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64, len(result.Hits))
+	for _, hit := range result.Hits {
+		scores[hit.ID] = hit.Score
+	}
+	return scores, nil
+}
+
+// rescoreWindow 返回第一阶段搜索需要获取的结果数
+func rescoreWindow(specs []*rescoreSpec, from, size int) int {
+	window := from + size
+	for _, spec := range specs {
+		if spec.windowSize > window {
+			window = spec.windowSize
+		}
+	}
+	return window
+}
+
+// applyRescore 依次执行重排序阶段：窗口内的结果按重排序得分重新排序，窗口外的结果保持原顺序排在其后
+// query 重排序器按 score_mode 组合得分，reranker 重排序器以模型得分替换原得分
+func (h *DocumentHandler) applyRescore(ctx context.Context, idx bleve.Index, result *bleve.SearchResult, specs []*rescoreSpec) error {
+	texts := make(map[string]map[string]interface{})
+	for _, spec := range specs {
+		window := result.Hits
+		if len(window) > spec.windowSize {
+			window = window[:spec.windowSize]
+		}
+		if len(window) == 0 {
+			continue
+		}
+
+		if spec.query != nil {
+			// 未匹配 rescore_query 的文档只保留加权后的原得分
+			matched, err := rescoreQueryScores(ctx, idx, spec.query, window)
+			if err != nil {
+				return common.NewInternalServerError("[rescore] failed to execute [rescore_query]: " + err.Error())
+			}
+			for _, hit := range window {
+				if secondary, ok := matched[hit.ID]; ok {
+					hit.Score = combineRescore(spec, hit.Score, secondary)
+				} else {
+					hit.Score *= spec.queryWeight
+				}
+			}
+			sortRescoreWindow(window)
+			continue
+		}
+
+		documents := make([]string, len(window))
+		for i, hit := range window {
+			doc, ok := texts[hit.ID]
+			if !ok {
+				if d, err := idx.Document(hit.ID); err == nil && d != nil {
+					doc = h.extractDocumentFields(d)
+				}
+				texts[hit.ID] = doc
+			}
+			documents[i] = rescoreText(lookupPath(doc, spec.field))
+		}
+
+		scores, err := spec.reranker.Rerank(ctx, spec.text, documents)
+		if err != nil {
+			return common.NewInternalServerError(fmt.Sprintf("[rescore] reranker [%s] failed: %v", spec.name, err))
+		}
+		if len(scores) != len(window) {
+			return common.NewInternalServerError(fmt.Sprintf("[rescore] reranker [%s] returned %d scores for %d documents", spec.name, len(scores), len(window)))
+		}
+		for i, hit := range window {
+			hit.Score = scores[i]
+		}
+		sortRescoreWindow(window)
+	}
+
+	result.MaxScore = 0
+	for i, hit := range result.Hits {
+		if i == 0 || hit.Score > result.MaxScore {
+			result.MaxScore = hit.Score
+		}
+	}
+	return nil
+}
+
+// sortRescoreWindow 窗口内按新得分降序排列，得分相同保持原顺序
+func sortRescoreWindow(window search.DocumentMatchCollection) {
+	sort.SliceStable(window, func(i, j int) bool {
+		return window[i].Score > window[j].Score
+	})
+}
+
+// rescoreText 将字段值转换为提供给重排序模型的文本，多值字段按行拼接
+func rescoreText(v interface{}) string {
+	switch tv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return tv
+	case []interface{}:
+		parts := make([]string, 0, len(tv))
+		for _, item := range tv {
+			parts = append(parts, rescoreText(item))
+		}
+		return strings.Join(parts, "\n")
+	default:
+		return fmt.Sprint(tv)
+	}
+}
+
+// pageHits 返回重排序后 [from, from+size) 范围内的结果
+func pageHits(hits search.DocumentMatchCollection, from, size int) search.DocumentMatchCollection {
+	if from >= len(hits) {
+		return search.DocumentMatchCollection{}
+	}
+	end := from + size
+	if end > len(hits) {
+		end = len(hits)
+	}
+	return hits[from:end]
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+	"github.com/lscgzwd/tiggerdb/rerank"
+)
+
+// keywordReranker 按文档中查询文本出现的次数打分
+type keywordReranker struct {
+	calls int
+}
+
+func (r *keywordReranker) Rerank(_ context.Context, query string, documents []string) ([]float64, error) {
+	r.calls++
+	scores := make([]float64, len(documents))
+	for i, doc := range documents {
+		scores[i] = float64(strings.Count(doc, query))
+	}
+	return scores, nil
+}
+
+func TestDocumentHandler_SearchRescore(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	reranker := &keywordReranker{}
+	rerank.Register("keyword", reranker)
+	defer rerank.Register("keyword", nil)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/articles", `{"mappings":{"properties":{"body":{"type":"text"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := map[string]string{
+		"1": `{"body":"database"}`,
+		"2": `{"body":"database go go"}`,
+		"3": `{"body":"database go"}`,
+		"4": `{"body":"database go go go"}`,
+	}
+	for id, body := range docs {
+		if w := do("PUT", "/articles/_doc/"+id+"?refresh=true", body); w.Code >= 300 {
+			t.Fatalf("index %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	hitIDs := func(body string) []string {
+		t.Helper()
+		w := do("POST", "/articles/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Hits struct {
+				Hits []struct {
+					ID string `json:"_id"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode search response: %v", err)
+		}
+		ids := make([]string, 0, len(resp.Hits.Hits))
+		for _, hit := range resp.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return ids
+	}
+
+	rescore := `"rescore":{"window_size":10,"reranker":{"name":"keyword","field":"body","text":"go"}}`
+	if got, want := hitIDs(`{"query":{"match":{"body":"database"}},`+rescore+`}`), []string{"4", "2", "3", "1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("rescored hits: expected %v, got %v", want, got)
+	}
+	// 分页在重排序之后进行
+	if got, want := hitIDs(`{"query":{"match":{"body":"database"}},"from":1,"size":2,`+rescore+`}`), []string{"2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("rescored page: expected %v, got %v", want, got)
+	}
+	if reranker.calls != 2 {
+		t.Fatalf("expected reranker to be called twice, got %d", reranker.calls)
+	}
+
+	// query 重排序器：窗口内匹配短语的文档得分提升，未匹配的文档只保留加权后的原得分
+	queryRescore := `"rescore":{"window_size":4,"query":{"rescore_query":{"match_phrase":{"body":"go go"}},"query_weight":0.001,"rescore_query_weight":10}}`
+	if got := hitIDs(`{"query":{"match":{"body":"database"}},` + queryRescore + `}`); len(got) != 4 || !sameIDs(got[:2], []string{"2", "4"}) || !sameIDs(got[2:], []string{"1", "3"}) {
+		t.Fatalf("query rescored hits: expected [2 4] before [1 3], got %v", got)
+	}
+
+	for _, body := range []string{
+		`{"rescore":{"reranker":{"name":"missing","field":"body","text":"go"}}}`,
+		`{"rescore":{"query":{"query_weight":0.5}}}`,
+		`{"rescore":{"query":{"rescore_query":{"match_all":{}},"score_mode":"sum"}}}`,
+		`{"rescore":{"window_size":0,"reranker":{"name":"keyword","field":"body","text":"go"}}}`,
+		`{"sort":["_doc"],` + rescore + `}`,
+	} {
+		if w := do("POST", "/articles/_search", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func sameIDs(a, b []string) bool {
+	seen := make(map[string]int)
+	for _, id := range a {
+		seen[id]++
+	}
+	for _, id := range b {
+		seen[id]--
+	}
+	for _, n := range seen {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
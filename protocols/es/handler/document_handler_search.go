@@ -15,13 +15,16 @@
 package handler
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lscgzwd/tiggerdb/logger"
@@ -31,6 +34,7 @@ import (
 	bleve "github.com/lscgzwd/tiggerdb"
 	"github.com/lscgzwd/tiggerdb/numeric"
 	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	es "github.com/lscgzwd/tiggerdb/protocols/es/index"
 	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
 	"github.com/lscgzwd/tiggerdb/search"
 	"github.com/lscgzwd/tiggerdb/search/query"
@@ -45,37 +49,53 @@ type SourceConfig struct {
 // SearchRequest ES搜索请求
 // 注意：ES 官方支持 "aggs" 和 "aggregations" 两种写法，需要手动处理
 type SearchRequest struct {
-	Query        map[string]interface{}            `json:"query,omitempty"`
-	From         int                               `json:"from,omitempty"`
-	Size         int                               `json:"size,omitempty"`
-	Sort         []interface{}                     `json:"sort,omitempty"`
-	Source       interface{}                       `json:"_source,omitempty"`       // 支持: []string, SourceConfig, bool
-	Fields       []string                          `json:"fields,omitempty"`        // 兼容字段
-	ScriptFields map[string]interface{}            `json:"script_fields,omitempty"` // 脚本计算字段
-	Highlight    map[string]interface{}            `json:"highlight,omitempty"`
-	Aggregations map[string]map[string]interface{} `json:"-"` // 手动解析，支持 aggs 和 aggregations
-	PostFilter   map[string]interface{}            `json:"post_filter,omitempty"`
-	MinScore     *float64                          `json:"min_score,omitempty"`
-	Explain      bool                              `json:"explain,omitempty"`
-	SearchAfter  []interface{}                     `json:"search_after,omitempty"` // 支持 search_after 分页
+	Query          map[string]interface{}            `json:"query,omitempty"`
+	From           int                               `json:"from,omitempty"`
+	Size           int                               `json:"size,omitempty"`
+	Sort           []interface{}                     `json:"sort,omitempty"`
+	Source         interface{}                       `json:"_source,omitempty"`       // 支持: []string, SourceConfig, bool
+	Fields         []string                          `json:"fields,omitempty"`        // 兼容字段
+	ScriptFields   map[string]interface{}            `json:"script_fields,omitempty"` // 脚本计算字段
+	Highlight      map[string]interface{}            `json:"highlight,omitempty"`
+	Aggregations   map[string]map[string]interface{} `json:"-"` // 手动解析，支持 aggs 和 aggregations
+	PostFilter     map[string]interface{}            `json:"post_filter,omitempty"`
+	MinScore       *float64                          `json:"min_score,omitempty"`
+	Explain        bool                              `json:"explain,omitempty"`
+	Profile        bool                              `json:"profile,omitempty"`          // 返回各阶段耗时
+	Timeout        string                            `json:"timeout,omitempty"`          // 搜索超时，到期返回部分结果
+	SearchAfter    []interface{}                     `json:"search_after,omitempty"`     // 支持 search_after 分页
+	Knn            interface{}                       `json:"knn,omitempty"`              // 向量检索（需要 vectors 构建标签），对象或数组
+	SubSearches    []interface{}                     `json:"sub_searches,omitempty"`     // 混合检索的其他词法查询：[{"query": {...}}, ...]
+	Rank           map[string]interface{}            `json:"rank,omitempty"`             // 混合检索的融合方式：rrf 或 linear
+	Rescore        interface{}                       `json:"rescore,omitempty"`          // 重排序（query/reranker），对象或数组
+	TrackTotalHits interface{}                       `json:"track_total_hits,omitempty"` // false 时不统计总命中数，允许按索引排序提前终止
+	IndicesBoost   interface{}                       `json:"indices_boost,omitempty"`    // 按索引调整得分：[{"index": boost}, ...]
 }
 
 // searchRequestRaw 用于解析原始 JSON，支持 aggs 和 aggregations 两种格式
 type searchRequestRaw struct {
-	Query        map[string]interface{}            `json:"query,omitempty"`
-	From         int                               `json:"from,omitempty"`
-	Size         int                               `json:"size,omitempty"`
-	Sort         []interface{}                     `json:"sort,omitempty"`
-	Source       interface{}                       `json:"_source,omitempty"`
-	Fields       []string                          `json:"fields,omitempty"`
-	ScriptFields map[string]interface{}            `json:"script_fields,omitempty"` // 脚本计算字段
-	Highlight    map[string]interface{}            `json:"highlight,omitempty"`
-	Aggs         map[string]map[string]interface{} `json:"aggs,omitempty"`         // ES 短格式
-	Aggregations map[string]map[string]interface{} `json:"aggregations,omitempty"` // ES 完整格式
-	PostFilter   map[string]interface{}            `json:"post_filter,omitempty"`
-	MinScore     *float64                          `json:"min_score,omitempty"`
-	Explain      bool                              `json:"explain,omitempty"`
-	SearchAfter  []interface{}                     `json:"search_after,omitempty"`
+	Query          map[string]interface{}            `json:"query,omitempty"`
+	From           int                               `json:"from,omitempty"`
+	Size           int                               `json:"size,omitempty"`
+	Sort           []interface{}                     `json:"sort,omitempty"`
+	Source         interface{}                       `json:"_source,omitempty"`
+	Fields         []string                          `json:"fields,omitempty"`
+	ScriptFields   map[string]interface{}            `json:"script_fields,omitempty"` // 脚本计算字段
+	Highlight      map[string]interface{}            `json:"highlight,omitempty"`
+	Aggs           map[string]map[string]interface{} `json:"aggs,omitempty"`         // ES 短格式
+	Aggregations   map[string]map[string]interface{} `json:"aggregations,omitempty"` // ES 完整格式
+	PostFilter     map[string]interface{}            `json:"post_filter,omitempty"`
+	MinScore       *float64                          `json:"min_score,omitempty"`
+	Explain        bool                              `json:"explain,omitempty"`
+	Profile        bool                              `json:"profile,omitempty"`
+	Timeout        string                            `json:"timeout,omitempty"`
+	SearchAfter    []interface{}                     `json:"search_after,omitempty"`
+	Knn            interface{}                       `json:"knn,omitempty"`
+	SubSearches    []interface{}                     `json:"sub_searches,omitempty"`
+	Rank           map[string]interface{}            `json:"rank,omitempty"`
+	Rescore        interface{}                       `json:"rescore,omitempty"`
+	TrackTotalHits interface{}                       `json:"track_total_hits,omitempty"`
+	IndicesBoost   interface{}                       `json:"indices_boost,omitempty"`
 }
 
 // UnmarshalJSON 自定义 JSON 解析，支持 aggs 和 aggregations 两种格式
@@ -96,7 +116,15 @@ func (s *SearchRequest) UnmarshalJSON(data []byte) error {
 	s.PostFilter = raw.PostFilter
 	s.MinScore = raw.MinScore
 	s.Explain = raw.Explain
+	s.Profile = raw.Profile
+	s.Timeout = raw.Timeout
 	s.SearchAfter = raw.SearchAfter
+	s.Knn = raw.Knn
+	s.SubSearches = raw.SubSearches
+	s.Rank = raw.Rank
+	s.Rescore = raw.Rescore
+	s.TrackTotalHits = raw.TrackTotalHits
+	s.IndicesBoost = raw.IndicesBoost
 
 	// ES 官方支持 aggs 和 aggregations 两种写法，优先使用 aggregations
 	if raw.Aggregations != nil {
@@ -112,16 +140,6 @@ func (s *SearchRequest) UnmarshalJSON(data []byte) error {
 // GET /<index>/_search
 // POST /<index>/_search
 func (h *DocumentHandler) Search(w http.ResponseWriter, r *http.Request) {
-	// 读取请求体（移除DEBUG日志以提高性能）
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		logger.Error("Failed to read request body: %v", err)
-		common.HandleError(w, common.NewBadRequestError("failed to read request body: "+err.Error()))
-		return
-	}
-	// 重新设置body以便后续处理
-	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-
 	indexName := mux.Vars(r)["index"]
 
 	// 验证索引名称
@@ -130,9 +148,16 @@ func (h *DocumentHandler) Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 检查索引是否存在
-	if !h.dirMgr.IndexExists(indexName) {
-		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+	// 解析别名（不存在时返回 index_not_found），带 filter 的别名在解析请求后组合到查询中
+	indexName, aliasFilter, apiErr := h.resolveSearchTarget(indexName)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelRead); apiErr != nil {
+		common.HandleError(w, apiErr)
 		return
 	}
 
@@ -150,10 +175,10 @@ func (h *DocumentHandler) Search(w http.ResponseWriter, r *http.Request) {
 	// 解析搜索请求
 	var searchReq SearchRequest
 	if r.Method == http.MethodPost {
-		// POST请求，从请求体读取（兼容 chunked）
+		// POST请求，从请求体流式解码（兼容 chunked），不预先读取整个请求体
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&searchReq); err != nil && err != io.EOF {
-			common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+			common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 			return
 		}
 	} else {
@@ -189,8 +214,27 @@ func (h *DocumentHandler) Search(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// URL 参数 timeout 优先于请求体
+	if timeout := r.URL.Query().Get("timeout"); timeout != "" {
+		searchReq.Timeout = timeout
+	}
+
+	// 别名 filter 与查询组合；scroll 上下文保存组合后的查询，后续批次同样生效
+	searchReq.Query = applyAliasFilter(searchReq.Query, aliasFilter)
+
+	// 深分页保护
+	if apiErr := checkResultWindow(h.metaStore, indexName, searchReq.From, searchReq.Size, scrollStr != ""); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	// scroll 后续批次使用 search_after，排序需要以 _id 作为 tiebreaker 才能保证不跳过排序值相同的文档
+	if scrollStr != "" {
+		searchReq.Sort = scrollSortWithTiebreaker(searchReq.Sort)
+	}
+
 	// 执行搜索
-	searchResponse, err := h.executeSearchInternal(idx, indexName, &searchReq)
+	searchResponse, err := h.executeSearchInternal(r.Context(), idx, indexName, &searchReq)
 	if err != nil {
 		if apiErr, ok := err.(common.APIError); ok {
 			common.HandleError(w, apiErr)
@@ -216,14 +260,8 @@ func (h *DocumentHandler) Search(w http.ResponseWriter, r *http.Request) {
 			searchReq.From = 0 // 强制从0开始
 		}
 
-		// 如果scroll没有指定sort，使用默认sort（按_id升序），确保scroll可以正常工作
+		// 排序已在执行搜索前补充 _id tiebreaker（未指定sort时按_id升序）
 		scrollSort := searchReq.Sort
-		if len(scrollSort) == 0 {
-			// 使用默认sort：按_id升序
-			scrollSort = []interface{}{map[string]interface{}{"_id": map[string]interface{}{"order": "asc"}}}
-			// 更新searchReq的Sort，确保返回的hits包含sort值
-			searchReq.Sort = scrollSort
-		}
 
 		scrollMgr := GetScrollManager()
 		scrollCtx, err := scrollMgr.CreateScrollContext(
@@ -279,14 +317,68 @@ func (h *DocumentHandler) Search(w http.ResponseWriter, r *http.Request) {
 }
 
 // executeSearchInternal 执行搜索的核心逻辑（供Search和MultiSearch复用）
-func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName string, searchReq *SearchRequest) (map[string]interface{}, error) {
+// ctx 为请求上下文，客户端断开时搜索与聚合随之中止
+func (h *DocumentHandler) executeSearchInternal(ctx context.Context, idx bleve.Index, indexName string, searchReq *SearchRequest) (map[string]interface{}, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	// 设置默认 Size
 	if searchReq.Size <= 0 {
 		searchReq.Size = 10 // 默认10条
 	}
+	searchTimeout, err := parseTimeValue(searchReq.Timeout)
+	if err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+	indicesBoost, err := parseIndicesBoost(searchReq.IndicesBoost)
+	if err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+
+	// 文档级安全查询在解析后与查询组合，字段级安全在解析时隐藏查询、排序与聚合引用的不可见字段，在取回文档时过滤
+	access := requestIndexAccess(ctx, indexName)
+	ctx = withIndexAccess(ctx, access)
+
+	profiler := newSearchProfiler(searchReq.Profile)
+	stopParse := profiler.start(profilePhaseParse)
 
-	// 创建Query DSL解析器
+	// 创建Query DSL解析器（别名字段在解析阶段改写为目标字段，查询按 mapping 中的字段类型构建）
 	parser := dsl.NewQueryParser()
+	h.bindQueryMapping(parser, indexName)
+	if aliases := h.fieldAliasesForIndex(indexName); aliases != nil {
+		parser.SetFieldAliases(aliases)
+		if len(searchReq.Sort) > 0 {
+			searchReq.Sort = rewriteSortAliases(searchReq.Sort, aliases)
+		}
+		for _, aggSpec := range searchReq.Aggregations {
+			rewriteAggregationAliases(aggSpec, aliases)
+		}
+	}
+	if access.FieldsRestricted() {
+		if part := scriptedSearchPart(searchReq); part != "" {
+			return nil, common.NewBadRequestError(fmt.Sprintf("[%s] is not allowed when field level security is applied", part))
+		}
+		restrictQueryFields(parser, access)
+		searchReq.Sort = hideSortFields(access, searchReq.Sort)
+		for _, aggSpec := range searchReq.Aggregations {
+			hideAggregationFields(access, aggSpec)
+		}
+	}
+
+	// 解析重排序（rescore_query 与主查询使用相同的解析与 join 展开）
+	rescoreSpecs, err := parseRescore(searchReq.Rescore, func(queryMap map[string]interface{}) (query.Query, error) {
+		q, err := parser.ParseQuery(queryMap)
+		if err != nil {
+			return nil, err
+		}
+		return h.resolveRootQuery(idx, indexName, q)
+	})
+	if err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+	if len(rescoreSpecs) > 0 && len(searchReq.Sort) > 0 {
+		return nil, common.NewBadRequestError("Cannot use [sort] option in conjunction with [rescore].")
+	}
 
 	// 解析查询
 	var bleveQuery query.Query
@@ -295,7 +387,6 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 		queryJSON, _ := json.MarshalIndent(searchReq.Query, "", "  ")
 		logger.Info("executeSearchInternal [%s] - Original query JSON:\n%s", indexName, string(queryJSON))
 
-		var err error
 		bleveQuery, err = parser.ParseQuery(searchReq.Query)
 		if err != nil {
 			logger.Error("Failed to parse query: %v", err)
@@ -303,17 +394,47 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 		}
 		// 打印解析后的查询类型
 		logger.Info("executeSearchInternal [%s] - Parsed query type: %T", indexName, bleveQuery)
-
-		// 检查并处理 join 查询（has_child/has_parent）
-		bleveQuery, err = h.processJoinQueries(idx, bleveQuery)
-		if err != nil {
-			logger.Error("Failed to process join queries: %v", err)
-			return nil, common.NewBadRequestError("failed to process join query: " + err.Error())
-		}
 	} else {
 		// 默认match_all查询
 		bleveQuery = query.NewMatchAllQuery()
 	}
+	if bleveQuery, err = h.applyDocumentSecurity(bleveQuery, indexName, access); err != nil {
+		return nil, common.NewBadRequestError("failed to parse query: " + err.Error())
+	}
+
+	stopParse()
+
+	// 记录 join 查询（展开后用于构建 inner_hits）
+	stopRewrite := profiler.start(profilePhaseRewrite)
+	joinInfos := dsl.FindJoinQueries(bleveQuery)
+	percolateInfos := dsl.FindPercolateQueries(bleveQuery)
+
+	// 检查并处理 join 查询（nested/has_child/has_parent），并限定在根文档上
+	bleveQuery, err = h.resolveRootQuery(idx, indexName, bleveQuery)
+	if err != nil {
+		logger.Error("Failed to process join queries: %v", err)
+		return nil, common.NewBadRequestError("failed to process join query: " + err.Error())
+	}
+	stopRewrite()
+
+	// 混合检索：query、sub_searches 与 knn 各自召回后按 rank 融合（见 document_handler_search_hybrid.go）
+	hybrid, err := parseHybridSearch(searchReq, bleveQuery, func(queryMap map[string]interface{}) (query.Query, error) {
+		q := query.Query(query.NewMatchAllQuery())
+		if queryMap != nil {
+			var err error
+			if q, err = parser.ParseQuery(queryMap); err != nil {
+				return nil, err
+			}
+		}
+		q, err := h.applyDocumentSecurity(q, indexName, access)
+		if err != nil {
+			return nil, err
+		}
+		return h.resolveRootQuery(idx, indexName, q)
+	}, access.FieldAllowed)
+	if err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
 
 	// 构建bleve搜索请求
 	bleveReq := bleve.NewSearchRequest(bleveQuery)
@@ -333,7 +454,7 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 	if searchReq.Aggregations != nil {
 		for _, aggSpec := range searchReq.Aggregations {
 			for aggType := range aggSpec {
-				if aggType == "avg" || aggType == "sum" || aggType == "min" || aggType == "max" || aggType == "stats" || aggType == "cardinality" {
+				if aggType == "avg" || aggType == "sum" || aggType == "min" || aggType == "max" || aggType == "stats" {
 					hasMetricsAgg = true
 					break
 				}
@@ -354,6 +475,11 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 			bleveReq.Size = 10 // 默认10条
 		}
 	}
+	// 重排序：第一阶段获取整个窗口，重排序后再分页
+	if len(rescoreSpecs) > 0 {
+		bleveReq.From = 0
+		bleveReq.Size = rescoreWindow(rescoreSpecs, searchReq.From, searchReq.Size)
+	}
 
 	// 解析 _source 字段（用于后续过滤）
 	requestedFields := h.parseSourceField(searchReq.Source)
@@ -364,14 +490,16 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 	// 字段加载将在搜索完成后，只为返回的 Size 个结果获取
 	bleveReq.Explain = searchReq.Explain
 
-	// 解析排序
+	// 解析排序（记录每个排序位置的值类型，用于 search_after 编码和 sort 值解码）
+	var sortTypes []sortValueType
 	if len(searchReq.Sort) > 0 {
-		sortOrder, err := h.parseSort(searchReq.Sort)
+		sortOrder, types, err := h.parseSort(searchReq.Sort, idx, h.scriptFieldTypes(indexName))
 		if err != nil {
 			logger.Error("Failed to parse sort: %v", err)
 			return nil, common.NewBadRequestError("failed to parse sort: " + err.Error())
 		}
 		bleveReq.SortByCustom(sortOrder)
+		sortTypes = types
 	}
 
 	// 处理 search_after 分页
@@ -387,10 +515,10 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 		if searchReq.From != 0 {
 			return nil, common.NewBadRequestError("cannot use search_after with from != 0")
 		}
-		// 将 search_after 转换为 []string（Bleve 需要）
-		searchAfterStrs := make([]string, len(searchReq.SearchAfter))
-		for i, v := range searchReq.SearchAfter {
-			searchAfterStrs[i] = fmt.Sprintf("%v", v)
+		// 按排序字段类型将 search_after 编码为排序键（Bleve 需要 []string）
+		searchAfterStrs, err := encodeSearchAfterValues(bleveReq.Sort, sortTypes, searchReq.SearchAfter)
+		if err != nil {
+			return nil, common.NewBadRequestError(err.Error())
 		}
 		bleveReq.SetSearchAfter(searchAfterStrs)
 	}
@@ -412,9 +540,15 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 	var filterAggInfo *FilterAggregationInfo
 	var topHitsAggInfo *TopHitsAggregationInfo
 	var nestedFieldAggInfo *NestedFieldAggregationInfo
+	var significantTermsAggInfo *SignificantTermsAggregationInfo
+	var multiTermsAggInfo *MultiTermsAggregationInfo
+	var rareTermsAggInfo *RareTermsAggregationInfo
+	var dateHistogramAggInfo *DateHistogramAggregationInfo
+	var geoAggInfo *GeoAggregationInfo
+	var termsAggInfo *TermsAggregationInfo
 	if searchReq.Aggregations != nil {
 		// P2-1: 使用结构体封装返回值
-		parsedAggs, err := h.parseAggregations(searchReq.Aggregations)
+		parsedAggs, err := h.parseAggregations(ctx, searchReq.Aggregations)
 		if err != nil {
 			logger.Warn("Failed to parse aggregations: %v", err)
 		} else if parsedAggs != nil {
@@ -427,17 +561,57 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 			filterAggInfo = parsedAggs.FilterInfo
 			topHitsAggInfo = parsedAggs.TopHitsInfo
 			nestedFieldAggInfo = parsedAggs.NestedFieldInfo
+			significantTermsAggInfo = parsedAggs.SignificantTermsInfo
+			multiTermsAggInfo = parsedAggs.MultiTermsInfo
+			rareTermsAggInfo = parsedAggs.RareTermsInfo
+			dateHistogramAggInfo = parsedAggs.DateHistogramInfo
+			geoAggInfo = parsedAggs.GeoInfo
+			termsAggInfo = parsedAggs.TermsInfo
 		}
 	}
 
-	// 执行搜索
+	// 执行搜索（超时返回部分结果，客户端断开时取消）
+	stopSearch := profiler.start(profilePhaseSearch)
 	startTime := time.Now()
-	searchResult, err := idx.Search(bleveReq)
+	searchCtx, cancelSearch := newSearchContext(ctx, searchTimeout)
+	searchCtx = profiler.withTimePruning(searchCtx)
+	if n := indexSearchConcurrency(h.metaStore, indexName); n > 1 {
+		searchCtx = context.WithValue(searchCtx, search.SearchConcurrencyKey, n)
+	}
+	skipTotalHits := searchReq.TrackTotalHits == false
+	if skipTotalHits && searchReq.Aggregations == nil && searchReq.MinScore == nil && searchReq.Rescore == nil {
+		// 不需要精确的总命中数：首个排序键与索引排序一致时，收集器可跳过不可能进入结果的文档
+		searchCtx = context.WithValue(searchCtx, search.EarlyTerminationKey, true)
+	}
+	var searchResult *bleve.SearchResult
+	if hybrid != nil {
+		searchResult, err = h.executeHybridSearch(searchCtx, idx, bleveReq, hybrid, searchReq.From, searchReq.Size)
+	} else {
+		searchResult, err = idx.SearchInContext(searchCtx, bleveReq)
+	}
+	cancelSearch()
 	if err != nil {
-		logger.Error("Failed to search index [%s]: %v", indexName, err)
-		return nil, common.NewInternalServerError("failed to search: " + err.Error())
+		switch {
+		case ctx.Err() != nil:
+			return nil, searchCancelledError(ctx)
+		case errors.Is(err, context.DeadlineExceeded):
+			// 收集开始前已超时，返回空的部分结果
+			searchResult = &bleve.SearchResult{Hits: search.DocumentMatchCollection{}, TimedOut: true}
+		default:
+			logger.Error("Failed to search index [%s]: %v", indexName, err)
+			if script.IsScriptException(err) {
+				return nil, common.NewScriptException(err.Error())
+			}
+			return nil, common.NewInternalServerError("failed to search: " + err.Error())
+		}
 	}
-	took := time.Since(startTime).Milliseconds()
+	elapsed := time.Since(startTime)
+	took := elapsed.Milliseconds()
+	stopSearch()
+	logSearchSlowlog(indexName, elapsed, searchResult.Total, searchReq)
+
+	// indices_boost：得分乘以该索引的权重
+	applyIndexBoost(searchResult.Hits, &searchResult.MaxScore, h.indexBoostFor(indexName, indicesBoost))
 
 	// ES的min_score功能：在搜索后过滤低于分数的文档
 	if searchReq.MinScore != nil {
@@ -452,6 +626,12 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 		searchResult.Hits = filteredHits
 		logger.Debug("Min score filtering applied: kept %d of %d hits (min_score=%v)", len(filteredHits), originalCount, *searchReq.MinScore)
 	}
+	if len(rescoreSpecs) > 0 {
+		if err := h.applyRescore(ctx, idx, searchResult, rescoreSpecs); err != nil {
+			return nil, err
+		}
+		searchResult.Hits = pageHits(searchResult.Hits, searchReq.From, searchReq.Size)
+	}
 	// 打印搜索结果摘要（使用 Info 级别方便调试）
 	logger.Info("executeSearchInternal [%s] - Search result: Total=%d, Hits=%d, MaxScore=%f, Took=%dms",
 		indexName, searchResult.Total, len(searchResult.Hits), searchResult.MaxScore, took)
@@ -464,13 +644,19 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 	}
 
 	// 构建ES格式的响应
+	stopFetch := profiler.start(profilePhaseFetch)
 	hits := make([]map[string]interface{}, 0, len(searchResult.Hits))
+	var scriptFieldTypes map[string]string
+	if len(searchReq.ScriptFields) > 0 {
+		scriptFieldTypes = h.scriptFieldTypes(indexName)
+	}
 
 	// 性能优化：复用单个IndexReader，避免每次调用idx.Document()都创建新的Reader
 	// 注意：这仍然是逐个获取文档（Bleve没有真正的批量获取API），但优势在于：
 	// 1. idx.Document()每次都会创建新的Reader并关闭（有锁、内存分配等开销）
 	// 2. 复用Reader可以减少这些开销，特别是在获取大量文档时
 	var docCache map[string]map[string]interface{}
+	routings := make(map[string]string)
 	if len(searchResult.Hits) > 0 {
 		docCache = make(map[string]map[string]interface{}, len(searchResult.Hits))
 
@@ -484,7 +670,10 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 				for _, hit := range searchResult.Hits {
 					doc, err := reader.Document(hit.ID)
 					if err == nil && doc != nil {
-						docCache[hit.ID] = h.extractDocumentFields(doc)
+						docCache[hit.ID] = access.FilterSource(h.extractDocumentFields(doc))
+						if routing := documentRouting(doc); routing != "" {
+							routings[hit.ID] = routing
+						}
 					}
 				}
 			}
@@ -495,7 +684,10 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 			for _, hit := range searchResult.Hits {
 				doc, err := idx.Document(hit.ID) // 每次调用都会创建新Reader
 				if err == nil && doc != nil {
-					docCache[hit.ID] = h.extractDocumentFields(doc)
+					docCache[hit.ID] = access.FilterSource(h.extractDocumentFields(doc))
+					if routing := documentRouting(doc); routing != "" {
+						routings[hit.ID] = routing
+					}
 				}
 			}
 		}
@@ -507,6 +699,9 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 			"_id":    hit.ID,
 			"_score": hit.Score,
 		}
+		if routing, ok := routings[hit.ID]; ok {
+			hitData[routingField] = routing
+		}
 
 		// 获取文档数据（用于 _source 和 script_fields）
 		var doc map[string]interface{}
@@ -535,8 +730,8 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 		}
 
 		// 添加高亮字段
-		if len(hit.Fragments) > 0 {
-			hitData["highlight"] = hit.Fragments
+		if fragments := filterHighlight(access, hit.Fragments); len(fragments) > 0 {
+			hitData["highlight"] = fragments
 		}
 
 		// 添加explanation（如果请求了）
@@ -544,21 +739,42 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 			hitData["_explanation"] = h.buildExplanation(hit.Expl)
 		}
 
-		// 添加sort值
+		// 添加sort值（按字段类型解码为原始类型）
 		if len(hit.Sort) > 0 {
-			hitData["sort"] = hit.Sort
+			hitData["sort"] = decodeSortValues(bleveReq.Sort, sortTypes, hit)
 		}
 
 		// 处理 script_fields
 		if len(searchReq.ScriptFields) > 0 && docExists {
-			scriptFieldsResult := h.computeScriptFields(searchReq.ScriptFields, doc, hit.Score)
+			scriptFieldsResult, err := h.computeScriptFields(searchReq.ScriptFields, doc, scriptFieldTypes, hit.Score)
+			if err != nil {
+				return nil, err
+			}
 			if len(scriptFieldsResult) > 0 {
 				hitData["fields"] = scriptFieldsResult
 			}
 		}
 
+		// 添加 percolate 查询匹配的文档槽位
+		if slotFields := percolatorDocumentSlots(hit.ID, percolateInfos); slotFields != nil {
+			fields, _ := hitData["fields"].(map[string]interface{})
+			if fields == nil {
+				fields = make(map[string]interface{})
+				hitData["fields"] = fields
+			}
+			for k, v := range slotFields {
+				fields[k] = v
+			}
+		}
+
+		// 添加 has_child/has_parent 的 inner_hits
+		if innerHits := h.buildInnerHits(idx, indexName, hit.ID, joinInfos, access); innerHits != nil {
+			hitData["inner_hits"] = innerHits
+		}
+
 		hits = append(hits, hitData)
 	}
+	stopFetch()
 
 	// 构建符合 ES 官方格式的响应（字段顺序与 ES 官方一致）
 	searchResponse := map[string]interface{}{
@@ -576,121 +792,200 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 			"max_score": searchResult.MaxScore,
 			"hits":      hits,
 		},
-		"timed_out": false,
+		"timed_out": searchResult.TimedOut,
 		"took":      took,
 		// 如果使用 search_after，在最后一个 hit 的 sort 值可以作为下一次的 search_after
 		// ES 客户端会自动处理，这里不需要额外返回
 	}
+	if skipTotalHits {
+		// 与 ES 一致：track_total_hits 为 false 时响应中不包含 hits.total
+		delete(searchResponse["hits"].(map[string]interface{}), "total")
+	}
 
 	// 添加聚合结果（如果请求了）
 	if searchReq.Aggregations != nil {
+		stopAggregation := profiler.start(profilePhaseAggregation)
 		aggs := make(map[string]interface{})
 
+		// 各类顶层聚合相互独立，通过聚合 worker 池并发执行，完成后按原有顺序合并
+		var compositeResult, facetAggs, metricsAggs, filterAggs, nestedFieldAggs, significantTermsAggs, multiTermsAggs, rareTermsAggs, dateHistogramAggs, geoAggs map[string]interface{}
+		aggTasks := make([]func(), 0, 10)
+
 		// 处理composite聚合（优先处理，因为需要特殊格式）
 		if compositeAggInfo != nil && len(compositeAggInfo.Aggregations) > 0 {
-			// 检查是否有多字段 composite 聚合
-			hasMultiSourceComposite := false
-			for _, cfg := range compositeAggInfo.Aggregations {
-				if len(cfg.Sources) > 1 {
-					hasMultiSourceComposite = true
-					break
+			aggTasks = append(aggTasks, func() {
+				compositeResult = make(map[string]interface{})
+				// 检查是否有多字段 composite 聚合
+				hasMultiSourceComposite := false
+				for _, cfg := range compositeAggInfo.Aggregations {
+					if len(cfg.Sources) > 1 {
+						hasMultiSourceComposite = true
+						break
+					}
 				}
-			}
-
-			if hasMultiSourceComposite {
-				// 多字段 composite 聚合需要遍历所有文档
-				// 根据文档数量选择批量处理或流式处理
-				const streamingThreshold = 50000 // 超过5万条使用流式处理
 
-				// 先快速估算匹配文档数
-				countReq := bleve.NewSearchRequest(bleveReq.Query)
-				countReq.Size = 0
-				countResult, err := idx.Search(countReq)
-				if err != nil {
-					logger.Warn("Failed to count documents for composite aggregation: %v", err)
-				} else {
-					totalDocs := int(countResult.Total)
-
-					if totalDocs > streamingThreshold {
-						// 大数据集：使用流式处理（内存安全）
-						logger.Info("Using streaming aggregation for large dataset (%d docs)", totalDocs)
-						compositeAggs, err := h.buildCompositeAggregationsStreaming(idx, bleveReq.Query, compositeAggInfo)
-						if err != nil {
-							logger.Warn("Failed to build streaming composite aggregation: %v", err)
-						} else {
-							for k, v := range compositeAggs {
-								aggs[k] = v
-							}
-						}
+				if hasMultiSourceComposite {
+					// 多字段 composite 聚合需要遍历所有文档
+					// 根据文档数量选择批量处理或流式处理
+					const streamingThreshold = 50000 // 超过5万条使用流式处理
+
+					// 先快速估算匹配文档数
+					countReq := bleve.NewSearchRequest(bleveReq.Query)
+					countReq.Size = 0
+					countResult, err := idx.SearchInContext(ctx, countReq)
+					if err != nil {
+						logger.Warn("Failed to count documents for composite aggregation: %v", err)
 					} else {
-						// 小数据集：使用批量处理（更快）
-						allDocs, err := h.fetchAllDocsForCompositeAgg(idx, bleveReq.Query, compositeAggInfo)
-						if err != nil {
-							logger.Warn("Failed to fetch docs for composite aggregation: %v", err)
+						totalDocs := int(countResult.Total)
+
+						if totalDocs > streamingThreshold {
+							// 大数据集：使用流式处理（内存安全）
+							logger.Info("Using streaming aggregation for large dataset (%d docs)", totalDocs)
+							compositeAggs, err := h.buildCompositeAggregationsStreaming(ctx, idx, bleveReq.Query, compositeAggInfo)
+							if err != nil {
+								logger.Warn("Failed to build streaming composite aggregation: %v", err)
+							} else {
+								for k, v := range compositeAggs {
+									compositeResult[k] = v
+								}
+							}
 						} else {
-							compositeAggs := h.buildCompositeAggregationsFromDocs(allDocs, compositeAggInfo.Aggregations)
-							for k, v := range compositeAggs {
-								aggs[k] = v
+							// 小数据集：使用批量处理（更快）
+							allDocs, err := h.fetchAllDocsForCompositeAgg(ctx, idx, bleveReq.Query, compositeAggInfo)
+							if err != nil {
+								logger.Warn("Failed to fetch docs for composite aggregation: %v", err)
+							} else {
+								compositeAggs := h.buildCompositeAggregationsFromDocs(allDocs, compositeAggInfo.Aggregations)
+								for k, v := range compositeAggs {
+									compositeResult[k] = v
+								}
 							}
 						}
 					}
+				} else {
+					// 单字段 composite 聚合可以使用 facets
+					compositeAggs := h.buildCompositeAggregations(searchResult.Facets, compositeAggInfo.Aggregations)
+					for k, v := range compositeAggs {
+						compositeResult[k] = v
+					}
 				}
-			} else {
-				// 单字段 composite 聚合可以使用 facets
-				compositeAggs := h.buildCompositeAggregations(searchResult.Facets, compositeAggInfo.Aggregations)
-				for k, v := range compositeAggs {
-					aggs[k] = v
-				}
-			}
 
-			// 确保所有请求的composite聚合都有响应（即使没有数据）
-			for aggName := range compositeAggInfo.Aggregations {
-				if _, exists := aggs[aggName]; !exists {
-					aggs[aggName] = map[string]interface{}{
-						"buckets": []interface{}{},
+				// 确保所有请求的composite聚合都有响应（即使没有数据）
+				for aggName := range compositeAggInfo.Aggregations {
+					if _, exists := compositeResult[aggName]; !exists {
+						compositeResult[aggName] = map[string]interface{}{
+							"buckets": []interface{}{},
+						}
 					}
 				}
-			}
+			})
 		}
 
 		// 添加bucket聚合结果（来自bleve facets，排除composite相关的facet）
 		if len(searchResult.Facets) > 0 {
-			facetAggs := h.buildAggregations(searchResult.Facets, compositeAggInfo, nestedAggInfo, topHitsAggInfo, nestedFieldAggInfo, idx, bleveReq.Query)
-			for k, v := range facetAggs {
-				// 避免覆盖composite聚合
-				if _, exists := aggs[k]; !exists {
-					aggs[k] = v
-				}
-			}
+			aggTasks = append(aggTasks, func() {
+				facetAggs = h.buildAggregations(ctx, searchResult.Facets, termsAggInfo, compositeAggInfo, nestedAggInfo, topHitsAggInfo, nestedFieldAggInfo, idx, bleveReq.Query)
+			})
 		}
 
-		// 计算并添加metrics聚合结果（复用已获取的文档数据）
+		// 计算metrics聚合结果（复用已获取的文档数据）
 		if metricsAggInfo != nil && len(metricsAggInfo.Aggregations) > 0 {
-			metricsAggs, err := h.calculateMetricsAggregationsWithCache(searchResult, metricsAggInfo.Aggregations, docCache)
-			if err != nil {
-				logger.Warn("Failed to calculate metrics aggregations: %v", err)
-			} else {
-				for k, v := range metricsAggs {
-					aggs[k] = v
+			aggTasks = append(aggTasks, func() {
+				var err error
+				metricsAggs, err = h.calculateMetricsAggregationsWithCache(searchResult, metricsAggInfo.Aggregations, docCache)
+				if err != nil {
+					logger.Warn("Failed to calculate metrics aggregations: %v", err)
 				}
-			}
+			})
 		}
 
 		// 处理filter聚合
 		if filterAggInfo != nil && len(filterAggInfo.Aggregations) > 0 {
-			filterAggs := h.buildFilterAggregations(filterAggInfo, idx, bleveReq.Query)
-			for k, v := range filterAggs {
-				aggs[k] = v
-			}
+			aggTasks = append(aggTasks, func() {
+				filterAggs = h.buildFilterAggregations(ctx, filterAggInfo, idx, bleveReq.Query)
+			})
 		}
 
 		// 处理nested字段聚合
 		if nestedFieldAggInfo != nil && len(nestedFieldAggInfo.Aggregations) > 0 {
-			nestedFieldAggs := h.buildNestedFieldAggregations(nestedFieldAggInfo, idx, bleveReq.Query)
-			for k, v := range nestedFieldAggs {
+			aggTasks = append(aggTasks, func() {
+				nestedFieldAggs = h.buildNestedFieldAggregations(ctx, nestedFieldAggInfo, idx, bleveReq.Query)
+			})
+		}
+
+		// 处理significant_terms聚合
+		if significantTermsAggInfo != nil && len(significantTermsAggInfo.Aggregations) > 0 {
+			aggTasks = append(aggTasks, func() {
+				significantTermsAggs = h.buildSignificantTermsAggregations(ctx, significantTermsAggInfo, idx, bleveReq.Query)
+			})
+		}
+
+		// 处理multi_terms聚合
+		if multiTermsAggInfo != nil && len(multiTermsAggInfo.Aggregations) > 0 {
+			aggTasks = append(aggTasks, func() {
+				multiTermsAggs = h.buildMultiTermsAggregations(ctx, multiTermsAggInfo, idx, bleveReq.Query)
+			})
+		}
+
+		// 处理rare_terms聚合
+		if rareTermsAggInfo != nil && len(rareTermsAggInfo.Aggregations) > 0 {
+			aggTasks = append(aggTasks, func() {
+				rareTermsAggs = h.buildRareTermsAggregations(ctx, rareTermsAggInfo, idx, bleveReq.Query)
+			})
+		}
+
+		// 处理date_histogram聚合
+		if dateHistogramAggInfo != nil && len(dateHistogramAggInfo.Aggregations) > 0 {
+			aggTasks = append(aggTasks, func() {
+				dateHistogramAggs = h.buildDateHistogramAggregations(ctx, dateHistogramAggInfo, idx, bleveReq.Query)
+			})
+		}
+
+		// 处理geo聚合
+		if geoAggInfo != nil && len(geoAggInfo.Aggregations) > 0 {
+			aggTasks = append(aggTasks, func() {
+				geoAggs = h.buildGeoAggregations(ctx, geoAggInfo, idx, bleveReq.Query)
+			})
+		}
+
+		aggPool.run(aggTasks)
+
+		for k, v := range compositeResult {
+			aggs[k] = v
+		}
+		for k, v := range facetAggs {
+			// 避免覆盖composite聚合
+			if _, exists := aggs[k]; !exists {
 				aggs[k] = v
 			}
 		}
+		for k, v := range metricsAggs {
+			aggs[k] = v
+		}
+		for k, v := range filterAggs {
+			aggs[k] = v
+		}
+		for k, v := range nestedFieldAggs {
+			aggs[k] = v
+		}
+		for k, v := range significantTermsAggs {
+			aggs[k] = v
+		}
+		for k, v := range multiTermsAggs {
+			aggs[k] = v
+		}
+		for k, v := range rareTermsAggs {
+			aggs[k] = v
+		}
+		for k, v := range dateHistogramAggs {
+			aggs[k] = v
+		}
+		for k, v := range geoAggs {
+			aggs[k] = v
+		}
+
+		// terms聚合的missing参数：补充缺少字段的文档桶
+		h.applyTermsMissing(ctx, searchReq.Aggregations, aggs, idx, bleveReq.Query)
 
 		// 确保所有请求的聚合都有响应（即使没有数据）
 		for aggName, aggSpec := range searchReq.Aggregations {
@@ -706,7 +1001,7 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 						aggs[aggName] = map[string]interface{}{
 							"buckets": []interface{}{},
 						}
-					case "range", "date_range":
+					case "range", "date_range", "date_histogram":
 						aggs[aggName] = map[string]interface{}{
 							"buckets": []interface{}{},
 						}
@@ -722,16 +1017,30 @@ func (h *DocumentHandler) executeSearchInternal(idx bleve.Index, indexName strin
 			}
 		}
 
+		h.applyPipelineAggregations(searchReq.Aggregations, aggs)
+		h.applyRangeOutputOptions(searchReq.Aggregations, aggs)
+
 		searchResponse["aggregations"] = aggs
+		stopAggregation()
+
+		// 聚合遍历期间客户端断开
+		if ctx.Err() != nil {
+			return nil, searchCancelledError(ctx)
+		}
+	}
+
+	if profiler != nil {
+		searchResponse["profile"] = profiler.build(idx, indexName, bleveQuery, searchReq.Aggregations)
 	}
 
 	return searchResponse, nil
 }
 
 // parseSort 解析ES排序格式并转换为bleve SortOrder
-func (h *DocumentHandler) parseSort(sortSpec []interface{}) (search.SortOrder, error) {
+// 同时返回每个排序位置的值类型（字段未映射时按 unmapped_type），fieldTypes 为 nil 时按值推断
+func (h *DocumentHandler) parseSort(sortSpec []interface{}, idx bleve.Index, fieldTypes map[string]string) (search.SortOrder, []sortValueType, error) {
 	if len(sortSpec) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// 如果第一个元素是字符串，使用简单格式：["field1", "-field2"]
@@ -741,14 +1050,17 @@ func (h *DocumentHandler) parseSort(sortSpec []interface{}) (search.SortOrder, e
 			if str, ok := s.(string); ok {
 				sortStrings[i] = str
 			} else {
-				return nil, fmt.Errorf("invalid sort format: expected string, got %T", s)
+				return nil, nil, fmt.Errorf("invalid sort format: expected string, got %T", s)
 			}
 		}
-		return search.ParseSortOrderStrings(sortStrings), nil
+		sortOrder := search.ParseSortOrderStrings(sortStrings)
+		applyDefaultSortModes(sortOrder)
+		return sortOrder, sortValueTypes(sortOrder, fieldTypes), nil
 	}
 
 	// 复杂格式：[{"field": {"order": "desc"}}, "_score", {"_script": {...}}]
 	sortOrder := make(search.SortOrder, 0, len(sortSpec))
+	effectiveTypes := fieldTypes
 	for _, item := range sortSpec {
 		if str, ok := item.(string); ok {
 			// 简单字符串格式
@@ -758,7 +1070,7 @@ func (h *DocumentHandler) parseSort(sortSpec []interface{}) (search.SortOrder, e
 			if scriptSpec, ok := obj["_script"].(map[string]interface{}); ok {
 				scriptSort, err := h.parseScriptSort(scriptSpec)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 				sortOrder = append(sortOrder, scriptSort)
 				continue
@@ -766,17 +1078,41 @@ func (h *DocumentHandler) parseSort(sortSpec []interface{}) (search.SortOrder, e
 
 			// 对象格式：{"field": {"order": "desc"}}
 			for field, spec := range obj {
-				if specMap, ok := spec.(map[string]interface{}); ok {
-					// 解析order
+				// _score 与 _id 作为排序字段时使用专用排序（_score 默认降序）
+				if field == "_score" || field == "_id" {
 					order := "asc"
-					if o, ok := specMap["order"].(string); ok {
-						order = o
+					if field == "_score" {
+						order = "desc"
 					}
-					desc := order == "desc"
-					sortOrder = append(sortOrder, &search.SortField{
-						Field: field,
-						Desc:  desc,
-					})
+					if specMap, ok := spec.(map[string]interface{}); ok {
+						if o, ok := specMap["order"].(string); ok {
+							order = o
+						}
+					} else if str, ok := spec.(string); ok {
+						order = str
+					}
+					if field == "_score" {
+						sortOrder = append(sortOrder, &search.SortScore{Desc: order == "desc"})
+					} else {
+						sortOrder = append(sortOrder, &search.SortDocID{Desc: order == "desc"})
+					}
+					continue
+				}
+				if specMap, ok := spec.(map[string]interface{}); ok {
+					fieldSort, fieldType, err := h.parseFieldSort(field, specMap, idx, fieldTypes)
+					if err != nil {
+						return nil, nil, err
+					}
+					// unmapped_type 只影响本次请求的值类型，不修改 mapping 字段类型表
+					if fieldType != "" && fieldTypes[field] == "" {
+						overridden := make(map[string]string, len(effectiveTypes)+1)
+						for k, v := range effectiveTypes {
+							overridden[k] = v
+						}
+						overridden[field] = fieldType
+						effectiveTypes = overridden
+					}
+					sortOrder = append(sortOrder, fieldSort)
 				} else {
 					// 简单格式：{"field": "asc"}
 					order := "asc"
@@ -791,11 +1127,12 @@ func (h *DocumentHandler) parseSort(sortSpec []interface{}) (search.SortOrder, e
 				}
 			}
 		} else {
-			return nil, fmt.Errorf("invalid sort format: expected string or object, got %T", item)
+			return nil, nil, fmt.Errorf("invalid sort format: expected string or object, got %T", item)
 		}
 	}
 
-	return sortOrder, nil
+	applyDefaultSortModes(sortOrder)
+	return sortOrder, sortValueTypes(sortOrder, effectiveTypes), nil
 }
 
 // parseScriptSort 解析脚本排序
@@ -826,9 +1163,10 @@ func (h *DocumentHandler) parseScriptSort(spec map[string]interface{}) (search.S
 
 // computeScriptFields 计算脚本字段
 // ES格式: {"script_fields": {"field_name": {"script": {"source": "..."}}}}
-func (h *DocumentHandler) computeScriptFields(scriptFields map[string]interface{}, doc map[string]interface{}, score float64) map[string]interface{} {
+// 普通执行错误跳过该字段，超出执行限制时返回 script_exception
+func (h *DocumentHandler) computeScriptFields(scriptFields map[string]interface{}, doc map[string]interface{}, fieldTypes map[string]string, score float64) (map[string]interface{}, error) {
 	if len(scriptFields) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	result := make(map[string]interface{})
@@ -857,10 +1195,14 @@ func (h *DocumentHandler) computeScriptFields(scriptFields map[string]interface{
 		// 创建执行上下文
 		ctx := script.NewContext(doc, doc, s.Params)
 		ctx.Score = score
+		ctx.FieldTypes = fieldTypes
 
 		// 执行脚本
 		value, err := engine.Execute(s, ctx)
 		if err != nil {
+			if script.IsScriptException(err) {
+				return nil, common.NewScriptException(err.Error())
+			}
 			logger.Warn("Failed to execute script field [%s]: %v", fieldName, err)
 			continue
 		}
@@ -869,7 +1211,43 @@ func (h *DocumentHandler) computeScriptFields(scriptFields map[string]interface{
 		result[fieldName] = []interface{}{value}
 	}
 
-	return result
+	return result, nil
+}
+
+// scriptFieldTypes 读取索引 mapping 中各字段的类型，供脚本 doc 值按类型转换（如 date、geo_point）与排序使用
+func (h *DocumentHandler) scriptFieldTypes(indexName string) map[string]string {
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return nil
+	}
+	types := make(map[string]string)
+	if props, ok := indexMeta.Mapping["properties"].(map[string]interface{}); ok {
+		collectFieldTypes(props, "", types)
+	}
+	return types
+}
+
+// collectFieldTypes 递归收集字段完整路径到类型的映射（包括 multi-fields）
+func collectFieldTypes(props map[string]interface{}, prefix string, types map[string]string) {
+	for name, def := range props {
+		fieldMap, ok := def.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fullName := name
+		if prefix != "" {
+			fullName = prefix + "." + name
+		}
+		if fieldType, ok := fieldMap["type"].(string); ok {
+			types[fullName] = fieldType
+		}
+		if sub, ok := fieldMap["properties"].(map[string]interface{}); ok {
+			collectFieldTypes(sub, fullName, types)
+		}
+		if sub, ok := fieldMap["fields"].(map[string]interface{}); ok {
+			collectFieldTypes(sub, fullName, types)
+		}
+	}
 }
 
 // parseHighlight 解析ES高亮格式并转换为bleve HighlightRequest
@@ -1019,193 +1397,253 @@ func (h *DocumentHandler) buildCompositeAggregationsFromDocs(
 }
 
 // buildFilterAggregations 构建filter聚合响应
-func (h *DocumentHandler) buildFilterAggregations(filterInfo *FilterAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
-	aggs := make(map[string]interface{})
-
+func (h *DocumentHandler) buildFilterAggregations(ctx context.Context, filterInfo *FilterAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+	aggs := make(map[string]interface{}, len(filterInfo.Aggregations))
+	var mu sync.Mutex
+	tasks := make([]func(), 0, len(filterInfo.Aggregations))
 	for aggName, filterAgg := range filterInfo.Aggregations {
-		logger.Debug("buildFilterAggregations: processing filter aggregation [%s]", aggName)
+		tasks = append(tasks, func() {
+			result := h.buildFilterAggregation(ctx, aggName, filterAgg, idx, baseQuery)
+			mu.Lock()
+			aggs[aggName] = result
+			mu.Unlock()
+		})
+	}
+	aggPool.run(tasks)
 
-		// 组合基础查询和filter查询
-		combinedQuery := query.NewBooleanQuery([]query.Query{baseQuery, filterAgg.FilterQuery}, nil, nil)
+	return aggs
+}
 
-		// 执行搜索获取匹配的文档数
-		searchReq := bleve.NewSearchRequest(combinedQuery)
-		searchReq.Size = 0 // 不需要返回文档，只需要总数
-		searchResult, err := idx.Search(searchReq)
-		if err != nil {
-			logger.Warn("Failed to execute filter aggregation search for [%s]: %v", aggName, err)
-			aggs[aggName] = map[string]interface{}{
-				"doc_count": 0,
-			}
-			continue
-		}
+// buildFilterAggregation 构建单个filter聚合响应
+func (h *DocumentHandler) buildFilterAggregation(ctx context.Context, aggName string, filterAgg *FilterAggregationConfig, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+	logger.Debug("buildFilterAggregations: processing filter aggregation [%s]", aggName)
 
-		docCount := searchResult.Total
+	// 组合基础查询和filter查询
+	filterQuery, err := h.processJoinQueries(idx, filterAgg.FilterQuery)
+	if err != nil {
+		logger.Warn("Failed to process join queries in filter aggregation [%s]: %v", aggName, err)
+		filterQuery = filterAgg.FilterQuery
+	}
+	filterAgg.FilterQuery = filterQuery
+	combinedQuery := query.NewBooleanQuery([]query.Query{baseQuery, filterQuery}, nil, nil)
 
-		// 构建结果
-		result := map[string]interface{}{
-			"doc_count": docCount,
+	// 执行搜索获取匹配的文档数
+	searchReq := bleve.NewSearchRequest(combinedQuery)
+	searchReq.Size = 0 // 不需要返回文档，只需要总数
+	searchResult, err := idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		logger.Warn("Failed to execute filter aggregation search for [%s]: %v", aggName, err)
+		return map[string]interface{}{
+			"doc_count": 0,
 		}
+	}
 
-		// 如果有子聚合，执行子聚合
-		if len(filterAgg.SubAggregations) > 0 {
-			logger.Debug("buildFilterAggregations: processing sub-aggregations for [%s], count=%d", aggName, len(filterAgg.SubAggregations))
+	docCount := searchResult.Total
+
+	// 构建结果
+	result := map[string]interface{}{
+		"doc_count": docCount,
+	}
 
-			// P2-1: 使用结构体封装返回值
-			parsedSubAggs, err := h.parseAggregations(filterAgg.SubAggregations)
+	// 如果有子聚合，执行子聚合
+	if len(filterAgg.SubAggregations) > 0 {
+		logger.Debug("buildFilterAggregations: processing sub-aggregations for [%s], count=%d", aggName, len(filterAgg.SubAggregations))
+
+		// P2-1: 使用结构体封装返回值
+		parsedSubAggs, err := h.parseAggregations(ctx, filterAgg.SubAggregations)
+		if err != nil {
+			logger.Warn("Failed to parse sub-aggregations for filter [%s]: %v", aggName, err)
+		} else if parsedSubAggs != nil {
+			// 创建搜索请求执行子聚合
+			subSearchReq := bleve.NewSearchRequest(combinedQuery)
+			subSearchReq.Size = 0
+			if len(parsedSubAggs.Facets) > 0 {
+				subSearchReq.Facets = parsedSubAggs.Facets
+			}
+
+			subSearchResult, err := idx.SearchInContext(ctx, subSearchReq)
 			if err != nil {
-				logger.Warn("Failed to parse sub-aggregations for filter [%s]: %v", aggName, err)
-			} else if parsedSubAggs != nil {
-				// 创建搜索请求执行子聚合
-				subSearchReq := bleve.NewSearchRequest(combinedQuery)
-				subSearchReq.Size = 0
-				if len(parsedSubAggs.Facets) > 0 {
-					subSearchReq.Facets = parsedSubAggs.Facets
+				logger.Warn("Failed to execute sub-aggregations for filter [%s]: %v", aggName, err)
+			} else {
+				// 构建子聚合结果
+				subAggs := make(map[string]interface{})
+
+				// 处理bucket聚合（terms, range, date_range）
+				if len(subSearchResult.Facets) > 0 {
+					facetAggs := h.buildAggregations(ctx, subSearchResult.Facets, parsedSubAggs.TermsInfo, parsedSubAggs.CompositeInfo, parsedSubAggs.NestedInfo, parsedSubAggs.TopHitsInfo, parsedSubAggs.NestedFieldInfo, idx, combinedQuery)
+					for k, v := range facetAggs {
+						subAggs[k] = v
+					}
 				}
+				h.applyTermsMissing(ctx, filterAgg.SubAggregations, subAggs, idx, combinedQuery)
 
-				subSearchResult, err := idx.Search(subSearchReq)
-				if err != nil {
-					logger.Warn("Failed to execute sub-aggregations for filter [%s]: %v", aggName, err)
-				} else {
-					// 构建子聚合结果
-					subAggs := make(map[string]interface{})
-
-					// 处理bucket聚合（terms, range, date_range）
-					if len(subSearchResult.Facets) > 0 {
-						facetAggs := h.buildAggregations(subSearchResult.Facets, parsedSubAggs.CompositeInfo, parsedSubAggs.NestedInfo, parsedSubAggs.TopHitsInfo, parsedSubAggs.NestedFieldInfo, idx, combinedQuery)
-						for k, v := range facetAggs {
-							subAggs[k] = v
-						}
+				// 处理top_hits聚合
+				if parsedSubAggs.TopHitsInfo != nil && len(parsedSubAggs.TopHitsInfo.Aggregations) > 0 {
+					for k, v := range h.buildTopHitsAggregations(ctx, parsedSubAggs.TopHitsInfo, idx, combinedQuery) {
+						subAggs[k] = v
 					}
+				}
 
-					// 处理top_hits聚合
-					if parsedSubAggs.TopHitsInfo != nil && len(parsedSubAggs.TopHitsInfo.Aggregations) > 0 {
-						for topHitsName, topHitsConfig := range parsedSubAggs.TopHitsInfo.Aggregations {
-							topHitsResult := h.buildTopHitsAggregation(topHitsConfig, idx, combinedQuery)
-							if topHitsResult != nil {
-								subAggs[topHitsName] = topHitsResult
-							}
-						}
+				// 处理significant_terms聚合（前景为filter命中的文档）
+				if parsedSubAggs.SignificantTermsInfo != nil && len(parsedSubAggs.SignificantTermsInfo.Aggregations) > 0 {
+					for k, v := range h.buildSignificantTermsAggregations(ctx, parsedSubAggs.SignificantTermsInfo, idx, combinedQuery) {
+						subAggs[k] = v
+					}
+				}
+				if parsedSubAggs.MultiTermsInfo != nil && len(parsedSubAggs.MultiTermsInfo.Aggregations) > 0 {
+					for k, v := range h.buildMultiTermsAggregations(ctx, parsedSubAggs.MultiTermsInfo, idx, combinedQuery) {
+						subAggs[k] = v
 					}
+				}
+				if parsedSubAggs.RareTermsInfo != nil && len(parsedSubAggs.RareTermsInfo.Aggregations) > 0 {
+					for k, v := range h.buildRareTermsAggregations(ctx, parsedSubAggs.RareTermsInfo, idx, combinedQuery) {
+						subAggs[k] = v
+					}
+				}
+				if parsedSubAggs.DateHistogramInfo != nil && len(parsedSubAggs.DateHistogramInfo.Aggregations) > 0 {
+					for k, v := range h.buildDateHistogramAggregations(ctx, parsedSubAggs.DateHistogramInfo, idx, combinedQuery) {
+						subAggs[k] = v
+					}
+				}
+				if parsedSubAggs.GeoInfo != nil && len(parsedSubAggs.GeoInfo.Aggregations) > 0 {
+					for k, v := range h.buildGeoAggregations(ctx, parsedSubAggs.GeoInfo, idx, combinedQuery) {
+						subAggs[k] = v
+					}
+				}
 
-					// 处理nested字段聚合
-					if parsedSubAggs.NestedFieldInfo != nil && len(parsedSubAggs.NestedFieldInfo.Aggregations) > 0 {
-						for nestedFieldName, nestedFieldConfig := range parsedSubAggs.NestedFieldInfo.Aggregations {
-							logger.Debug("buildFilterAggregations: processing nested field aggregation [%s], path=[%s]", nestedFieldName, nestedFieldConfig.Path)
-							// 调用buildNestedFieldAggregations函数处理nested字段聚合
-							nestedFieldAggs := h.buildNestedFieldAggregations(&NestedFieldAggregationInfo{
-								Aggregations: map[string]*NestedFieldAggregationConfig{
-									nestedFieldName: nestedFieldConfig,
-								},
-							}, idx, combinedQuery)
-							for k, v := range nestedFieldAggs {
-								result[k] = v
-							}
+				// 处理nested字段聚合
+				if parsedSubAggs.NestedFieldInfo != nil && len(parsedSubAggs.NestedFieldInfo.Aggregations) > 0 {
+					for nestedFieldName, nestedFieldConfig := range parsedSubAggs.NestedFieldInfo.Aggregations {
+						logger.Debug("buildFilterAggregations: processing nested field aggregation [%s], path=[%s]", nestedFieldName, nestedFieldConfig.Path)
+						// 调用buildNestedFieldAggregations函数处理nested字段聚合
+						nestedFieldAggs := h.buildNestedFieldAggregations(ctx, &NestedFieldAggregationInfo{
+							Aggregations: map[string]*NestedFieldAggregationConfig{
+								nestedFieldName: nestedFieldConfig,
+							},
+						}, idx, combinedQuery)
+						for k, v := range nestedFieldAggs {
+							subAggs[k] = v
 						}
 					}
+				}
 
-					// 处理metrics聚合
-					if parsedSubAggs.MetricsInfo != nil && len(parsedSubAggs.MetricsInfo.Aggregations) > 0 {
-						// 获取所有匹配的文档来计算metrics
-						allDocsReq := bleve.NewSearchRequest(combinedQuery)
-						allDocsReq.Size = 10000 // 限制大小，避免内存问题
-						allDocsResult, err := idx.Search(allDocsReq)
-						if err == nil {
-							// 性能优化：复用单个IndexReader，避免每次调用idx.Document()都创建新的Reader
-							docCache := make(map[string]map[string]interface{})
-							advancedIdx, idxErr := idx.Advanced()
-							if idxErr == nil {
-								reader, readerErr := advancedIdx.Reader()
-								if readerErr == nil {
-									defer reader.Close()
-									// 复用同一个Reader逐个获取文档（减少Reader创建/关闭开销）
-									for _, hit := range allDocsResult.Hits {
-										doc, docErr := reader.Document(hit.ID)
-										if docErr == nil && doc != nil {
-											docCache[hit.ID] = h.extractDocumentFields(doc)
-										}
-									}
-								}
-							}
-							// 如果使用IndexReader失败，回退到原来的方法（每次调用idx.Document()都会创建新Reader）
-							if len(docCache) == 0 {
+				// 处理metrics聚合
+				if parsedSubAggs.MetricsInfo != nil && len(parsedSubAggs.MetricsInfo.Aggregations) > 0 {
+					// 获取所有匹配的文档来计算metrics
+					allDocsReq := bleve.NewSearchRequest(combinedQuery)
+					allDocsReq.Size = 10000 // 限制大小，避免内存问题
+					allDocsResult, err := idx.SearchInContext(ctx, allDocsReq)
+					if err == nil {
+						// 性能优化：复用单个IndexReader，避免每次调用idx.Document()都创建新的Reader
+						docCache := make(map[string]map[string]interface{})
+						advancedIdx, idxErr := idx.Advanced()
+						if idxErr == nil {
+							reader, readerErr := advancedIdx.Reader()
+							if readerErr == nil {
+								defer reader.Close()
+								// 复用同一个Reader逐个获取文档（减少Reader创建/关闭开销）
 								for _, hit := range allDocsResult.Hits {
-									doc, err := idx.Document(hit.ID) // 每次调用都会创建新Reader
-									if err == nil && doc != nil {
+									doc, docErr := reader.Document(hit.ID)
+									if docErr == nil && doc != nil {
 										docCache[hit.ID] = h.extractDocumentFields(doc)
 									}
 								}
 							}
-							metricsAggs, err := h.calculateMetricsAggregationsWithCache(allDocsResult, parsedSubAggs.MetricsInfo.Aggregations, docCache)
-							if err == nil {
-								for k, v := range metricsAggs {
-									subAggs[k] = v
+						}
+						// 如果使用IndexReader失败，回退到原来的方法（每次调用idx.Document()都会创建新Reader）
+						if len(docCache) == 0 {
+							for _, hit := range allDocsResult.Hits {
+								doc, err := idx.Document(hit.ID) // 每次调用都会创建新Reader
+								if err == nil && doc != nil {
+									docCache[hit.ID] = h.extractDocumentFields(doc)
 								}
 							}
 						}
+						metricsAggs, err := h.calculateMetricsAggregationsWithCache(allDocsResult, parsedSubAggs.MetricsInfo.Aggregations, docCache)
+						if err == nil {
+							for k, v := range metricsAggs {
+								subAggs[k] = v
+							}
+						}
 					}
+				}
 
-					// 处理composite聚合
-					if parsedSubAggs.CompositeInfo != nil && len(parsedSubAggs.CompositeInfo.Aggregations) > 0 {
-						// 检查是否有多字段 composite 聚合
-						hasMultiSourceComposite := false
-						for _, cfg := range parsedSubAggs.CompositeInfo.Aggregations {
-							if len(cfg.Sources) > 1 {
-								hasMultiSourceComposite = true
-								break
-							}
+				// 处理composite聚合
+				if parsedSubAggs.CompositeInfo != nil && len(parsedSubAggs.CompositeInfo.Aggregations) > 0 {
+					// 检查是否有多字段 composite 聚合
+					hasMultiSourceComposite := false
+					for _, cfg := range parsedSubAggs.CompositeInfo.Aggregations {
+						if len(cfg.Sources) > 1 {
+							hasMultiSourceComposite = true
+							break
 						}
+					}
 
-						if hasMultiSourceComposite {
-							// 根据文档数量选择批量处理或流式处理
-							const streamingThreshold = 50000
-							countReq := bleve.NewSearchRequest(combinedQuery)
-							countReq.Size = 0
-							countResult, err := idx.Search(countReq)
-							if err == nil {
-								totalDocs := int(countResult.Total)
-								if totalDocs > streamingThreshold {
-									// 大数据集：使用流式处理
-									compositeAggs, err := h.buildCompositeAggregationsStreaming(idx, combinedQuery, parsedSubAggs.CompositeInfo)
-									if err == nil {
-										for k, v := range compositeAggs {
-											subAggs[k] = v
-										}
+					if hasMultiSourceComposite {
+						// 根据文档数量选择批量处理或流式处理
+						const streamingThreshold = 50000
+						countReq := bleve.NewSearchRequest(combinedQuery)
+						countReq.Size = 0
+						countResult, err := idx.SearchInContext(ctx, countReq)
+						if err == nil {
+							totalDocs := int(countResult.Total)
+							if totalDocs > streamingThreshold {
+								// 大数据集：使用流式处理
+								compositeAggs, err := h.buildCompositeAggregationsStreaming(ctx, idx, combinedQuery, parsedSubAggs.CompositeInfo)
+								if err == nil {
+									for k, v := range compositeAggs {
+										subAggs[k] = v
 									}
-								} else {
-									// 小数据集：使用批量处理
-									allDocs, err := h.fetchAllDocsForCompositeAgg(idx, combinedQuery, parsedSubAggs.CompositeInfo)
-									if err == nil {
-										compositeAggs := h.buildCompositeAggregationsFromDocs(allDocs, parsedSubAggs.CompositeInfo.Aggregations)
-										for k, v := range compositeAggs {
-											subAggs[k] = v
-										}
+								}
+							} else {
+								// 小数据集：使用批量处理
+								allDocs, err := h.fetchAllDocsForCompositeAgg(ctx, idx, combinedQuery, parsedSubAggs.CompositeInfo)
+								if err == nil {
+									compositeAggs := h.buildCompositeAggregationsFromDocs(allDocs, parsedSubAggs.CompositeInfo.Aggregations)
+									for k, v := range compositeAggs {
+										subAggs[k] = v
 									}
 								}
 							}
-						} else {
-							compositeAggs := h.buildCompositeAggregations(subSearchResult.Facets, parsedSubAggs.CompositeInfo.Aggregations)
-							for k, v := range compositeAggs {
-								subAggs[k] = v
-							}
+						}
+					} else {
+						compositeAggs := h.buildCompositeAggregations(subSearchResult.Facets, parsedSubAggs.CompositeInfo.Aggregations)
+						for k, v := range compositeAggs {
+							subAggs[k] = v
 						}
 					}
+				}
 
-					if len(subAggs) > 0 {
-						result["aggregations"] = subAggs
-					}
+				if len(subAggs) > 0 {
+					result["aggregations"] = subAggs
 				}
 			}
 		}
-
-		aggs[aggName] = result
 	}
 
-	return aggs
+	return result
+}
+
+// buildTopHitsAggregations 并发构建一组top_hits聚合响应
+func (h *DocumentHandler) buildTopHitsAggregations(ctx context.Context, topHitsInfo *TopHitsAggregationInfo, idx bleve.Index, bucketQuery query.Query) map[string]interface{} {
+	results := make(map[string]interface{}, len(topHitsInfo.Aggregations))
+	var mu sync.Mutex
+	tasks := make([]func(), 0, len(topHitsInfo.Aggregations))
+	for name, config := range topHitsInfo.Aggregations {
+		tasks = append(tasks, func() {
+			if result := h.buildTopHitsAggregation(ctx, config, idx, bucketQuery); result != nil {
+				mu.Lock()
+				results[name] = result
+				mu.Unlock()
+			}
+		})
+	}
+	aggPool.run(tasks)
+	return results
 }
 
-// buildTopHitsAggregation 构建top_hits聚合响应
-func (h *DocumentHandler) buildTopHitsAggregation(config *TopHitsAggregationConfig, idx bleve.Index, bucketQuery query.Query) map[string]interface{} {
+// buildTopHitsAggregation 构建top_hits聚合响应，ctx 携带的字段级安全限制用于过滤 _source
+func (h *DocumentHandler) buildTopHitsAggregation(ctx context.Context, config *TopHitsAggregationConfig, idx bleve.Index, bucketQuery query.Query) map[string]interface{} {
 	// 创建搜索请求
 	searchReq := bleve.NewSearchRequest(bucketQuery)
 	searchReq.Size = config.Size
@@ -1215,7 +1653,7 @@ func (h *DocumentHandler) buildTopHitsAggregation(config *TopHitsAggregationConf
 
 	// 解析排序
 	if len(config.Sort) > 0 {
-		sortOrder, err := h.parseSort(config.Sort)
+		sortOrder, _, err := h.parseSort(config.Sort, idx, nil)
 		if err == nil && len(sortOrder) > 0 {
 			searchReq.SortByCustom(sortOrder)
 		}
@@ -1237,6 +1675,7 @@ func (h *DocumentHandler) buildTopHitsAggregation(config *TopHitsAggregationConf
 	}
 
 	// 构建hits
+	access := indexAccessFromContext(ctx)
 	hits := make([]map[string]interface{}, 0, len(searchResult.Hits))
 	requestedFields := h.parseSourceField(config.Source)
 
@@ -1252,7 +1691,7 @@ func (h *DocumentHandler) buildTopHitsAggregation(config *TopHitsAggregationConf
 			for _, hit := range searchResult.Hits {
 				doc, err := reader.Document(hit.ID)
 				if err == nil && doc != nil {
-					docCache[hit.ID] = h.extractDocumentFields(doc)
+					docCache[hit.ID] = access.FilterSource(h.extractDocumentFields(doc))
 				}
 			}
 		} else {
@@ -1265,7 +1704,7 @@ func (h *DocumentHandler) buildTopHitsAggregation(config *TopHitsAggregationConf
 		for _, hit := range searchResult.Hits {
 			doc, err := idx.Document(hit.ID) // 每次调用都会创建新Reader
 			if err == nil && doc != nil {
-				docCache[hit.ID] = h.extractDocumentFields(doc)
+				docCache[hit.ID] = access.FilterSource(h.extractDocumentFields(doc))
 			}
 		}
 	}
@@ -1295,13 +1734,13 @@ func (h *DocumentHandler) buildTopHitsAggregation(config *TopHitsAggregationConf
 		}
 
 		// 添加高亮字段
-		if len(hit.Fragments) > 0 {
-			hitData["highlight"] = hit.Fragments
+		if fragments := filterHighlight(access, hit.Fragments); len(fragments) > 0 {
+			hitData["highlight"] = fragments
 		}
 
-		// 添加sort值
+		// 添加sort值（top_hits 不读取 mapping，按值推断类型）
 		if len(hit.Sort) > 0 {
-			hitData["sort"] = hit.Sort
+			hitData["sort"] = decodeSortValues(searchReq.Sort, sortValueTypes(searchReq.Sort, nil), hit)
 		}
 
 		hits = append(hits, hitData)
@@ -1320,210 +1759,211 @@ func (h *DocumentHandler) buildTopHitsAggregation(config *TopHitsAggregationConf
 }
 
 // buildNestedFieldAggregations 构建nested字段聚合响应
-func (h *DocumentHandler) buildNestedFieldAggregations(nestedFieldInfo *NestedFieldAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
-	aggs := make(map[string]interface{})
-
+func (h *DocumentHandler) buildNestedFieldAggregations(ctx context.Context, nestedFieldInfo *NestedFieldAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+	aggs := make(map[string]interface{}, len(nestedFieldInfo.Aggregations))
+	var mu sync.Mutex
+	tasks := make([]func(), 0, len(nestedFieldInfo.Aggregations))
 	for aggName, nestedFieldConfig := range nestedFieldInfo.Aggregations {
-		logger.Debug("buildNestedFieldAggregations: processing nested field aggregation [%s], path=[%s]", aggName, nestedFieldConfig.Path)
-
-		// 构建nested查询：在nested字段路径内执行match_all查询
-		// ES的nested聚合实际上是在nested字段范围内执行聚合
-		// 我们需要构建一个nested查询来限制聚合范围
-		nestedQueryMap := map[string]interface{}{
-			"path":  nestedFieldConfig.Path,
-			"query": map[string]interface{}{"match_all": map[string]interface{}{}},
-		}
-
-		// 使用DSL解析器解析nested查询
-		parser := dsl.NewQueryParser()
-		nestedQuery, err := parser.ParseQuery(map[string]interface{}{
-			"nested": nestedQueryMap,
+		tasks = append(tasks, func() {
+			result := h.buildNestedFieldAggregation(ctx, aggName, nestedFieldConfig, idx, baseQuery)
+			mu.Lock()
+			aggs[aggName] = result
+			mu.Unlock()
 		})
-		if err != nil {
-			logger.Warn("Failed to parse nested query for aggregation [%s]: %v", aggName, err)
-			aggs[aggName] = map[string]interface{}{
-				"doc_count": 0,
-			}
-			continue
-		}
+	}
+	aggPool.run(tasks)
 
-		// 组合基础查询和nested查询
-		combinedQuery := query.NewBooleanQuery([]query.Query{baseQuery, nestedQuery}, nil, nil)
+	return aggs
+}
 
-		// 执行搜索获取匹配的文档数
-		searchReq := bleve.NewSearchRequest(combinedQuery)
-		searchReq.Size = 0 // 不需要返回文档，只需要总数
-		searchResult, err := idx.Search(searchReq)
-		if err != nil {
-			logger.Warn("Failed to execute nested field aggregation search for [%s]: %v", aggName, err)
-			aggs[aggName] = map[string]interface{}{
-				"doc_count": 0,
-			}
-			continue
+// buildNestedFieldAggregation 构建单个nested字段聚合响应
+func (h *DocumentHandler) buildNestedFieldAggregation(ctx context.Context, aggName string, nestedFieldConfig *NestedFieldAggregationConfig, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+	logger.Debug("buildNestedFieldAggregations: processing nested field aggregation [%s], path=[%s]", aggName, nestedFieldConfig.Path)
+
+	// nested 字段聚合在子文档上计算：只统计查询命中的根文档下该路径的子对象，
+	// 子聚合（包括 filter）作用于单个子对象，doc_count 为子对象数；
+	// reverse_nested 聚合回到命中子对象所属的根文档（或上级路径的子对象）
+	var combinedQuery query.Query
+	var err error
+	if nestedFieldConfig.Reverse {
+		combinedQuery, err = reverseNestedAggregationQuery(ctx, idx, nestedFieldConfig.Path, baseQuery)
+	} else {
+		combinedQuery, err = nestedAggregationQuery(ctx, idx, nestedFieldConfig.Path, baseQuery)
+	}
+	if err != nil {
+		logger.Warn("Failed to resolve nested documents for nested field aggregation [%s]: %v", aggName, err)
+		return map[string]interface{}{
+			"doc_count": 0,
 		}
+	}
 
-		docCount := searchResult.Total
-
-		// 构建结果
-		result := map[string]interface{}{
-			"doc_count": docCount,
+	// 执行搜索获取匹配的文档数
+	searchReq := bleve.NewSearchRequest(combinedQuery)
+	searchReq.Size = 0 // 不需要返回文档，只需要总数
+	searchResult, err := idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		logger.Warn("Failed to execute nested field aggregation search for [%s]: %v", aggName, err)
+		return map[string]interface{}{
+			"doc_count": 0,
 		}
+	}
 
-		// 如果有子聚合，执行子聚合
-		if len(nestedFieldConfig.SubAggregations) > 0 {
-			logger.Debug("buildNestedFieldAggregations: processing sub-aggregations for [%s], count=%d", aggName, len(nestedFieldConfig.SubAggregations))
+	docCount := searchResult.Total
 
-			// P2-1: 使用结构体封装返回值
-			parsedSubAggs, err := h.parseAggregations(nestedFieldConfig.SubAggregations)
-			if err != nil {
-				logger.Warn("Failed to parse sub-aggregations for nested field [%s]: %v", aggName, err)
-			} else if parsedSubAggs != nil {
-				// 创建搜索请求执行子聚合
-				subSearchReq := bleve.NewSearchRequest(combinedQuery)
-				subSearchReq.Size = 0
-				if len(parsedSubAggs.Facets) > 0 {
-					subSearchReq.Facets = parsedSubAggs.Facets
-				}
+	// 构建结果
+	result := map[string]interface{}{
+		"doc_count": docCount,
+	}
 
-				subSearchResult, err := idx.Search(subSearchReq)
-				if err != nil {
-					logger.Warn("Failed to execute sub-aggregations for nested field [%s]: %v", aggName, err)
-				} else {
-					// 构建子聚合结果
-					subAggs := make(map[string]interface{})
+	// 如果有子聚合，执行子聚合
+	if len(nestedFieldConfig.SubAggregations) > 0 {
+		logger.Debug("buildNestedFieldAggregations: processing sub-aggregations for [%s], count=%d", aggName, len(nestedFieldConfig.SubAggregations))
 
-					// 处理bucket聚合（terms, range, date_range）
-					if len(subSearchResult.Facets) > 0 {
-						facetAggs := h.buildAggregations(subSearchResult.Facets, parsedSubAggs.CompositeInfo, parsedSubAggs.NestedInfo, parsedSubAggs.TopHitsInfo, parsedSubAggs.NestedFieldInfo, idx, combinedQuery)
-						for k, v := range facetAggs {
-							subAggs[k] = v
-						}
+		// P2-1: 使用结构体封装返回值
+		parsedSubAggs, err := h.parseAggregations(ctx, nestedFieldConfig.SubAggregations)
+		if err != nil {
+			logger.Warn("Failed to parse sub-aggregations for nested field [%s]: %v", aggName, err)
+		} else if parsedSubAggs != nil {
+			// 创建搜索请求执行子聚合
+			subSearchReq := bleve.NewSearchRequest(combinedQuery)
+			subSearchReq.Size = 0
+			if len(parsedSubAggs.Facets) > 0 {
+				subSearchReq.Facets = parsedSubAggs.Facets
+			}
+
+			subSearchResult, err := idx.SearchInContext(ctx, subSearchReq)
+			if err != nil {
+				logger.Warn("Failed to execute sub-aggregations for nested field [%s]: %v", aggName, err)
+			} else {
+				// 构建子聚合结果
+				subAggs := make(map[string]interface{})
+
+				// 处理bucket聚合（terms, range, date_range）
+				if len(subSearchResult.Facets) > 0 {
+					facetAggs := h.buildAggregations(ctx, subSearchResult.Facets, parsedSubAggs.TermsInfo, parsedSubAggs.CompositeInfo, parsedSubAggs.NestedInfo, parsedSubAggs.TopHitsInfo, parsedSubAggs.NestedFieldInfo, idx, combinedQuery)
+					for k, v := range facetAggs {
+						subAggs[k] = v
 					}
+				}
 
-					// 处理metrics聚合
-					if parsedSubAggs.MetricsInfo != nil && len(parsedSubAggs.MetricsInfo.Aggregations) > 0 {
-						// 获取所有匹配的文档来计算metrics
-						allDocsReq := bleve.NewSearchRequest(combinedQuery)
-						allDocsReq.Size = 10000 // 限制大小，避免内存问题
-						allDocsResult, err := idx.Search(allDocsReq)
-						if err == nil {
-							// 性能优化：复用单个IndexReader，避免每次调用idx.Document()都创建新的Reader
-							docCache := make(map[string]map[string]interface{})
-							advancedIdx, idxErr := idx.Advanced()
-							if idxErr == nil {
-								reader, readerErr := advancedIdx.Reader()
-								if readerErr == nil {
-									defer reader.Close()
-									// 复用同一个Reader逐个获取文档（减少Reader创建/关闭开销）
-									for _, hit := range allDocsResult.Hits {
-										doc, docErr := reader.Document(hit.ID)
-										if docErr == nil && doc != nil {
-											docCache[hit.ID] = h.extractDocumentFields(doc)
-										}
-									}
-								}
-							}
-							// 如果使用IndexReader失败，回退到原来的方法（每次调用idx.Document()都会创建新Reader）
-							if len(docCache) == 0 {
+				// 处理metrics聚合
+				if parsedSubAggs.MetricsInfo != nil && len(parsedSubAggs.MetricsInfo.Aggregations) > 0 {
+					// 获取所有匹配的文档来计算metrics
+					allDocsReq := bleve.NewSearchRequest(combinedQuery)
+					allDocsReq.Size = 10000 // 限制大小，避免内存问题
+					allDocsResult, err := idx.SearchInContext(ctx, allDocsReq)
+					if err == nil {
+						// 性能优化：复用单个IndexReader，避免每次调用idx.Document()都创建新的Reader
+						docCache := make(map[string]map[string]interface{})
+						advancedIdx, idxErr := idx.Advanced()
+						if idxErr == nil {
+							reader, readerErr := advancedIdx.Reader()
+							if readerErr == nil {
+								defer reader.Close()
+								// 复用同一个Reader逐个获取文档（减少Reader创建/关闭开销）
 								for _, hit := range allDocsResult.Hits {
-									doc, err := idx.Document(hit.ID) // 每次调用都会创建新Reader
-									if err == nil && doc != nil {
+									doc, docErr := reader.Document(hit.ID)
+									if docErr == nil && doc != nil {
 										docCache[hit.ID] = h.extractDocumentFields(doc)
 									}
 								}
 							}
-							metricsAggs, err := h.calculateMetricsAggregationsWithCache(allDocsResult, parsedSubAggs.MetricsInfo.Aggregations, docCache)
-							if err == nil {
-								for k, v := range metricsAggs {
-									subAggs[k] = v
+						}
+						// 如果使用IndexReader失败，回退到原来的方法（每次调用idx.Document()都会创建新Reader）
+						if len(docCache) == 0 {
+							for _, hit := range allDocsResult.Hits {
+								doc, err := idx.Document(hit.ID) // 每次调用都会创建新Reader
+								if err == nil && doc != nil {
+									docCache[hit.ID] = h.extractDocumentFields(doc)
 								}
 							}
 						}
+						metricsAggs, err := h.calculateMetricsAggregationsWithCache(allDocsResult, parsedSubAggs.MetricsInfo.Aggregations, docCache)
+						if err == nil {
+							for k, v := range metricsAggs {
+								subAggs[k] = v
+							}
+						}
 					}
+				}
 
-					// 处理composite聚合
-					if parsedSubAggs.CompositeInfo != nil && len(parsedSubAggs.CompositeInfo.Aggregations) > 0 {
-						// 检查是否有多字段 composite 聚合
-						hasMultiSourceComposite := false
-						for _, cfg := range parsedSubAggs.CompositeInfo.Aggregations {
-							if len(cfg.Sources) > 1 {
-								hasMultiSourceComposite = true
-								break
-							}
+				// 处理composite聚合
+				if parsedSubAggs.CompositeInfo != nil && len(parsedSubAggs.CompositeInfo.Aggregations) > 0 {
+					// 检查是否有多字段 composite 聚合
+					hasMultiSourceComposite := false
+					for _, cfg := range parsedSubAggs.CompositeInfo.Aggregations {
+						if len(cfg.Sources) > 1 {
+							hasMultiSourceComposite = true
+							break
 						}
+					}
 
-						if hasMultiSourceComposite {
-							// 根据文档数量选择批量处理或流式处理
-							const streamingThreshold = 50000
-							countReq := bleve.NewSearchRequest(combinedQuery)
-							countReq.Size = 0
-							countResult, err := idx.Search(countReq)
-							if err == nil {
-								totalDocs := int(countResult.Total)
-								if totalDocs > streamingThreshold {
-									// 大数据集：使用流式处理
-									compositeAggs, err := h.buildCompositeAggregationsStreaming(idx, combinedQuery, parsedSubAggs.CompositeInfo)
-									if err == nil {
-										for k, v := range compositeAggs {
-											subAggs[k] = v
-										}
+					if hasMultiSourceComposite {
+						// 根据文档数量选择批量处理或流式处理
+						const streamingThreshold = 50000
+						countReq := bleve.NewSearchRequest(combinedQuery)
+						countReq.Size = 0
+						countResult, err := idx.SearchInContext(ctx, countReq)
+						if err == nil {
+							totalDocs := int(countResult.Total)
+							if totalDocs > streamingThreshold {
+								// 大数据集：使用流式处理
+								compositeAggs, err := h.buildCompositeAggregationsStreaming(ctx, idx, combinedQuery, parsedSubAggs.CompositeInfo)
+								if err == nil {
+									for k, v := range compositeAggs {
+										subAggs[k] = v
 									}
-								} else {
-									// 小数据集：使用批量处理
-									allDocs, err := h.fetchAllDocsForCompositeAgg(idx, combinedQuery, parsedSubAggs.CompositeInfo)
-									if err == nil {
-										compositeAggs := h.buildCompositeAggregationsFromDocs(allDocs, parsedSubAggs.CompositeInfo.Aggregations)
-										for k, v := range compositeAggs {
-											subAggs[k] = v
-										}
+								}
+							} else {
+								// 小数据集：使用批量处理
+								allDocs, err := h.fetchAllDocsForCompositeAgg(ctx, idx, combinedQuery, parsedSubAggs.CompositeInfo)
+								if err == nil {
+									compositeAggs := h.buildCompositeAggregationsFromDocs(allDocs, parsedSubAggs.CompositeInfo.Aggregations)
+									for k, v := range compositeAggs {
+										subAggs[k] = v
 									}
 								}
 							}
-						} else {
-							compositeAggs := h.buildCompositeAggregations(subSearchResult.Facets, parsedSubAggs.CompositeInfo.Aggregations)
-							for k, v := range compositeAggs {
-								subAggs[k] = v
-							}
 						}
-					}
-
-					// 处理filter聚合
-					if parsedSubAggs.FilterInfo != nil && len(parsedSubAggs.FilterInfo.Aggregations) > 0 {
-						filterAggs := h.buildFilterAggregations(parsedSubAggs.FilterInfo, idx, combinedQuery)
-						for k, v := range filterAggs {
+					} else {
+						compositeAggs := h.buildCompositeAggregations(subSearchResult.Facets, parsedSubAggs.CompositeInfo.Aggregations)
+						for k, v := range compositeAggs {
 							subAggs[k] = v
 						}
 					}
+				}
 
-					// 处理top_hits聚合
-					if parsedSubAggs.TopHitsInfo != nil && len(parsedSubAggs.TopHitsInfo.Aggregations) > 0 {
-						for topHitsName, topHitsConfig := range parsedSubAggs.TopHitsInfo.Aggregations {
-							topHitsResult := h.buildTopHitsAggregation(topHitsConfig, idx, combinedQuery)
-							if topHitsResult != nil {
-								subAggs[topHitsName] = topHitsResult
-							}
-						}
+				// 处理filter聚合
+				if parsedSubAggs.FilterInfo != nil && len(parsedSubAggs.FilterInfo.Aggregations) > 0 {
+					filterAggs := h.buildFilterAggregations(ctx, parsedSubAggs.FilterInfo, idx, combinedQuery)
+					for k, v := range filterAggs {
+						subAggs[k] = v
 					}
+				}
 
-					// 处理嵌套的nested字段聚合（递归）
-					if parsedSubAggs.NestedFieldInfo != nil && len(parsedSubAggs.NestedFieldInfo.Aggregations) > 0 {
-						subNestedFieldAggs := h.buildNestedFieldAggregations(parsedSubAggs.NestedFieldInfo, idx, combinedQuery)
-						for k, v := range subNestedFieldAggs {
-							subAggs[k] = v
-						}
+				// 处理top_hits聚合
+				if parsedSubAggs.TopHitsInfo != nil && len(parsedSubAggs.TopHitsInfo.Aggregations) > 0 {
+					for k, v := range h.buildTopHitsAggregations(ctx, parsedSubAggs.TopHitsInfo, idx, combinedQuery) {
+						subAggs[k] = v
 					}
+				}
 
-					if len(subAggs) > 0 {
-						result["aggregations"] = subAggs
+				// 处理嵌套的nested字段聚合（递归）
+				if parsedSubAggs.NestedFieldInfo != nil && len(parsedSubAggs.NestedFieldInfo.Aggregations) > 0 {
+					subNestedFieldAggs := h.buildNestedFieldAggregations(ctx, parsedSubAggs.NestedFieldInfo, idx, combinedQuery)
+					for k, v := range subNestedFieldAggs {
+						subAggs[k] = v
 					}
 				}
+
+				if len(subAggs) > 0 {
+					result["aggregations"] = subAggs
+				}
 			}
 		}
-
-		aggs[aggName] = result
 	}
 
-	return aggs
+	return result
 }
 
 // getNestedFieldValue 获取嵌套字段的值
@@ -1545,6 +1985,7 @@ func getNestedFieldValue(doc map[string]interface{}, fieldPath string) interface
 // buildCompositeAggregationsStreaming 流式处理composite聚合（内存安全，支持大数据集）
 // 分批处理文档，直接聚合，不存储所有文档到内存
 func (h *DocumentHandler) buildCompositeAggregationsStreaming(
+	ctx context.Context,
 	idx bleve.Index,
 	query query.Query,
 	compositeAggInfo *CompositeAggregationInfo,
@@ -1570,7 +2011,7 @@ func (h *DocumentHandler) buildCompositeAggregationsStreaming(
 	// 先快速估算匹配文档数
 	countReq := bleve.NewSearchRequest(query)
 	countReq.Size = 0
-	countResult, err := idx.Search(countReq)
+	countResult, err := idx.SearchInContext(ctx, countReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to count documents: %w", err)
 	}
@@ -1604,12 +2045,16 @@ func (h *DocumentHandler) buildCompositeAggregationsStreaming(
 	batchNum := 0
 	lastHitCount := 0 // 记录上一批的结果数量，用于检测是否卡住
 	for batchNum < maxBatches {
+		// 客户端断开时停止遍历
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		searchReq := bleve.NewSearchRequest(query)
 		searchReq.From = from
 		searchReq.Size = batchSize
 		searchReq.Fields = fieldsList
 
-		result, err := idx.Search(searchReq)
+		result, err := idx.SearchInContext(ctx, searchReq)
 		if err != nil {
 			return nil, fmt.Errorf("failed to search batch %d: %w", batchNum, err)
 		}
@@ -1767,6 +2212,7 @@ func (h *DocumentHandler) buildCompositeAggregationsStreaming(
 // fetchAllDocsForCompositeAgg 获取所有匹配的文档用于 composite 聚合计算
 // ⚠️ 注意：此方法会将所有文档加载到内存，大数据集请使用 buildCompositeAggregationsStreaming
 func (h *DocumentHandler) fetchAllDocsForCompositeAgg(
+	ctx context.Context,
 	idx bleve.Index,
 	query query.Query,
 	compositeAggInfo *CompositeAggregationInfo,
@@ -1783,6 +2229,20 @@ func (h *DocumentHandler) fetchAllDocsForCompositeAgg(
 			}
 		}
 	}
+	return h.fetchAllDocsWithFields(ctx, idx, query, fieldsList)
+}
+
+// fetchAllDocsWithFields 获取匹配查询的所有文档（最多10万条）的指定字段值
+func (h *DocumentHandler) fetchAllDocsWithFields(
+	ctx context.Context,
+	idx bleve.Index,
+	query query.Query,
+	fieldsList []string,
+) ([]map[string]interface{}, error) {
+	fieldsNeeded := make(map[string]bool, len(fieldsList))
+	for _, field := range fieldsList {
+		fieldsNeeded[field] = true
+	}
 
 	// 性能优化：一次性搜索所有匹配的文档，并在搜索时直接返回字段数据
 	// 使用Bleve的Fields机制，让Bleve在搜索时自动填充hit.Fields
@@ -1801,14 +2261,14 @@ func (h *DocumentHandler) fetchAllDocsForCompositeAgg(
 	// 先快速估算匹配文档数
 	countReq := bleve.NewSearchRequest(query)
 	countReq.Size = 0 // 只获取总数，不返回文档
-	countResult, err := idx.Search(countReq)
+	countResult, err := idx.SearchInContext(ctx, countReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to count documents: %w", err)
 	}
 
 	totalDocs := int(countResult.Total)
 	if totalDocs > maxDocs {
-		logger.Warn("fetchAllDocsForCompositeAgg: document count (%d) exceeds max limit (%d), will process first %d documents only. Consider using streaming aggregation for large datasets.", totalDocs, maxDocs, maxDocs)
+		logger.Warn("fetchAllDocsWithFields: document count (%d) exceeds max limit (%d), will process first %d documents only. Consider using streaming aggregation for large datasets.", totalDocs, maxDocs, maxDocs)
 	}
 
 	// 估算内存占用（每条文档约500字节）
@@ -1816,7 +2276,7 @@ func (h *DocumentHandler) fetchAllDocsForCompositeAgg(
 	if estimatedMemoryMB > maxMemoryMB {
 		// 如果估算内存超过限制，进一步降低文档数
 		adjustedMaxDocs := (maxMemoryMB * 1024 * 1024) / 500
-		logger.Warn("fetchAllDocsForCompositeAgg: estimated memory (%dMB) exceeds limit (%dMB), reducing max docs to %d", estimatedMemoryMB, maxMemoryMB, adjustedMaxDocs)
+		logger.Warn("fetchAllDocsWithFields: estimated memory (%dMB) exceeds limit (%dMB), reducing max docs to %d", estimatedMemoryMB, maxMemoryMB, adjustedMaxDocs)
 		// 注意：这里不修改maxDocs，因为已经设置了合理的默认值
 	}
 
@@ -1828,7 +2288,7 @@ func (h *DocumentHandler) fetchAllDocsForCompositeAgg(
 	searchReq.Size = maxDocs
 	searchReq.Fields = fieldsList // 设置Fields，让Bleve在搜索时自动填充hit.Fields
 
-	result, err := idx.Search(searchReq)
+	result, err := idx.SearchInContext(ctx, searchReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search: %w", err)
 	}
@@ -1864,10 +2324,10 @@ func (h *DocumentHandler) fetchAllDocsForCompositeAgg(
 	// 内存监控：记录实际使用的内存
 	actualMemoryMB := (len(allDocs) * 500) / (1024 * 1024)
 	if actualMemoryMB > maxMemoryMB/2 {
-		logger.Warn("fetchAllDocsForCompositeAgg: high memory usage detected (%dMB for %d docs). Consider reducing query scope or using streaming aggregation.", actualMemoryMB, len(allDocs))
+		logger.Warn("fetchAllDocsWithFields: high memory usage detected (%dMB for %d docs). Consider reducing query scope or using streaming aggregation.", actualMemoryMB, len(allDocs))
 	}
 
-	logger.Debug("fetchAllDocsForCompositeAgg: fetched %d documents with fields in one search (using Bleve Fields mechanism, total=%d, estimated memory=%dMB)", len(allDocs), totalDocs, actualMemoryMB)
+	logger.Debug("fetchAllDocsWithFields: fetched %d documents with fields in one search (using Bleve Fields mechanism, total=%d, estimated memory=%dMB)", len(allDocs), totalDocs, actualMemoryMB)
 
 	return allDocs, nil
 }
@@ -1919,7 +2379,7 @@ func (h *DocumentHandler) buildCompositeAggregations(facets search.FacetResults,
 }
 
 // buildAggregations 构建聚合响应（支持嵌套聚合）
-func (h *DocumentHandler) buildAggregations(facets search.FacetResults, compositeAggInfo *CompositeAggregationInfo, nestedAggInfo *NestedAggregationInfo, topHitsAggInfo *TopHitsAggregationInfo, nestedFieldAggInfo *NestedFieldAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+func (h *DocumentHandler) buildAggregations(ctx context.Context, facets search.FacetResults, termsAggInfo *TermsAggregationInfo, compositeAggInfo *CompositeAggregationInfo, nestedAggInfo *NestedAggregationInfo, topHitsAggInfo *TopHitsAggregationInfo, nestedFieldAggInfo *NestedFieldAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
 	aggs := make(map[string]interface{})
 
 	// 收集所有composite相关的facet名称，用于过滤
@@ -1939,12 +2399,24 @@ func (h *DocumentHandler) buildAggregations(facets search.FacetResults, composit
 			continue
 		}
 
+		// 处理cardinality facet：只有一个去重计数值
+		if facet.Cardinality != nil {
+			aggs[name] = map[string]interface{}{
+				"value": facet.Cardinality.Value,
+			}
+			continue
+		}
+
 		agg := map[string]interface{}{}
+		// 各bucket的子聚合相互独立，收集后并发执行（每个任务只写入自己的bucket）
+		var bucketTasks []func()
 
 		// 处理term facets
-		if facet.Terms != nil {
+		termsAgg := termsAggInfo.config(name)
+		if facet.Terms != nil || termsAgg != nil {
 			terms := facet.Terms.Terms()
-			if len(terms) > 0 {
+			if len(terms) > 0 || termsAgg != nil {
+				dict := h.facetTermsDictionary(idx, facet.Field)
 				buckets := make([]map[string]interface{}, 0, len(terms))
 				for i, term := range terms {
 					// 关键修复：转换term.Term的类型以匹配ES行为
@@ -1953,7 +2425,11 @@ func (h *DocumentHandler) buildAggregations(facets search.FacetResults, composit
 						logger.Debug("buildAggregations: facet[%s] term[%d] - Term: %q (type: %T, bytes: %v, len: %d)",
 							name, i, term.Term, term.Term, []byte(term.Term), len(term.Term))
 					}
-					key := h.convertFacetTermToTypedValue(term.Term)
+					// 优先从词项字典查表，字典中没有的词项（字典构建后新写入）直接解码
+					key, cached := dict.Lookup(term.Term)
+					if !cached {
+						key = h.decodeFacetTerm(idx, facet.Field, term.Term)
+					}
 					// 如果key是空字符串，说明是shift>0的PrefixCoded term，应该被过滤掉
 					if keyStr, ok := key.(string); ok && keyStr == "" {
 						if logger.IsDebugEnabled() {
@@ -1961,41 +2437,62 @@ func (h *DocumentHandler) buildAggregations(facets search.FacetResults, composit
 						}
 						continue
 					}
-					bucket := map[string]interface{}{
+					buckets = append(buckets, setBooleanKeyAsString(map[string]interface{}{
 						"key":       key, // 使用转换后的类型化值
 						"doc_count": term.Count,
-					}
+					}))
+				}
 
-					// 处理嵌套聚合：为当前bucket执行子聚合
-					if nestedAggInfo != nil {
-						if subAggs, hasSubAggs := nestedAggInfo.SubAggregations[name]; hasSubAggs {
-							logger.Debug("buildAggregations: processing nested aggregations for parentAgg=[%s], bucketKey=%v, subAggs count=%d", name, key, len(subAggs))
-							// 获取该bucket对应的字段名
-							fieldName, hasField := nestedAggInfo.FieldMapping[name]
-							if hasField {
-								// 为bucket创建term查询
-								bucketQuery := h.buildTermQueryForBucket(fieldName, key)
-								if bucketQuery != nil {
-									// 组合基础查询和bucket查询
-									combinedQuery := query.NewBooleanQuery([]query.Query{baseQuery, bucketQuery}, nil, nil)
-									// 执行子聚合
-									subAggResults := h.buildNestedAggregationsForBucket(name, key, subAggs, idx, combinedQuery)
-									if len(subAggResults) > 0 {
-										bucket["aggregations"] = subAggResults
-										logger.Debug("buildAggregations: added nested aggregations to bucket, result count=%d", len(subAggResults))
-									} else {
-										logger.Debug("buildAggregations: nested aggregations returned empty result for bucket")
-									}
-								} else {
-									logger.Debug("buildAggregations: failed to build bucket query for field=[%s], key=%v", fieldName, key)
-								}
-							} else {
-								logger.Debug("buildAggregations: no field mapping found for parentAgg=[%s]", name)
-							}
+				// 处理嵌套聚合：为bucket执行子聚合的任务（没有子聚合时返回nil）
+				subAggTask := func(bucket map[string]interface{}) func() {
+					if nestedAggInfo == nil {
+						return nil
+					}
+					subAggs, hasSubAggs := nestedAggInfo.SubAggregations[name]
+					if !hasSubAggs {
+						return nil
+					}
+					key := bucket["key"]
+					logger.Debug("buildAggregations: processing nested aggregations for parentAgg=[%s], bucketKey=%v, subAggs count=%d", name, key, len(subAggs))
+					// 获取该bucket对应的字段名
+					fieldName, hasField := nestedAggInfo.FieldMapping[name]
+					if !hasField {
+						logger.Debug("buildAggregations: no field mapping found for parentAgg=[%s]", name)
+						return nil
+					}
+					// 为bucket创建term查询
+					bucketQuery := h.buildTermQueryForBucket(fieldName, key)
+					if bucketQuery == nil {
+						logger.Debug("buildAggregations: failed to build bucket query for field=[%s], key=%v", fieldName, key)
+						return nil
+					}
+					// 组合基础查询和bucket查询
+					combinedQuery := query.NewBooleanQuery([]query.Query{baseQuery, bucketQuery}, nil, nil)
+					return func() {
+						subAggResults := h.buildNestedAggregationsForBucket(ctx, name, key, subAggs, idx, combinedQuery)
+						if len(subAggResults) > 0 {
+							bucket["aggregations"] = subAggResults
+							logger.Debug("buildAggregations: added nested aggregations to bucket, result count=%d", len(subAggResults))
+						} else {
+							logger.Debug("buildAggregations: nested aggregations returned empty result for bucket")
 						}
 					}
+				}
 
-					buckets = append(buckets, bucket)
+				// 按terms聚合配置过滤、排序和截取（按子聚合排序时子聚合已在排序前计算）
+				subAggsComputed := false
+				if termsAgg != nil {
+					var otherDocCount int
+					buckets, otherDocCount, subAggsComputed = h.selectTermsBuckets(ctx, termsAgg, buckets, idx, subAggTask)
+					agg["doc_count_error_upper_bound"] = 0
+					agg["sum_other_doc_count"] = facet.Other + otherDocCount
+				}
+				if !subAggsComputed {
+					for _, bucket := range buckets {
+						if task := subAggTask(bucket); task != nil {
+							bucketTasks = append(bucketTasks, task)
+						}
+					}
 				}
 				agg["buckets"] = buckets
 			}
@@ -2003,14 +2500,23 @@ func (h *DocumentHandler) buildAggregations(facets search.FacetResults, composit
 
 		// 处理numeric range facets
 		if len(facet.NumericRanges) > 0 {
+			// 与 ES 一致按区间起点输出桶（bleve 按文档数排序），derivative 等管道聚合依赖桶顺序
+			sort.SliceStable(facet.NumericRanges, func(i, j int) bool {
+				return lessRangeBound(facet.NumericRanges[i].Min, facet.NumericRanges[j].Min)
+			})
 			buckets := make([]map[string]interface{}, len(facet.NumericRanges))
 			for i, nr := range facet.NumericRanges {
 				bucket := map[string]interface{}{
 					"key":       nr.Name,
-					"from":      nr.Min,
-					"to":        nr.Max,
 					"doc_count": nr.Count,
 				}
+				// 与 ES 一致，无界的一侧不输出边界
+				if nr.Min != nil {
+					bucket["from"] = *nr.Min
+				}
+				if nr.Max != nil {
+					bucket["to"] = *nr.Max
+				}
 
 				// 处理嵌套聚合（range聚合的嵌套）
 				if nestedAggInfo != nil {
@@ -2022,10 +2528,12 @@ func (h *DocumentHandler) buildAggregations(facets search.FacetResults, composit
 							rangeQuery := h.buildNumericRangeQueryForBucket(fieldName, nr.Min, nr.Max)
 							if rangeQuery != nil {
 								combinedQuery := query.NewBooleanQuery([]query.Query{baseQuery, rangeQuery}, nil, nil)
-								subAggResults := h.buildNestedAggregationsForBucket(name, nr.Name, subAggs, idx, combinedQuery)
-								if len(subAggResults) > 0 {
-									bucket["aggregations"] = subAggResults
-								}
+								bucketTasks = append(bucketTasks, func() {
+									subAggResults := h.buildNestedAggregationsForBucket(ctx, name, nr.Name, subAggs, idx, combinedQuery)
+									if len(subAggResults) > 0 {
+										bucket["aggregations"] = subAggResults
+									}
+								})
 							}
 						}
 					}
@@ -2038,14 +2546,18 @@ func (h *DocumentHandler) buildAggregations(facets search.FacetResults, composit
 
 		// 处理date range facets
 		if len(facet.DateRanges) > 0 {
+			sort.SliceStable(facet.DateRanges, func(i, j int) bool {
+				return lessRangeBound(facet.DateRanges[i].Start, facet.DateRanges[j].Start)
+			})
 			buckets := make([]map[string]interface{}, len(facet.DateRanges))
 			for i, dr := range facet.DateRanges {
 				bucket := map[string]interface{}{
 					"key":       dr.Name,
-					"from":      dr.Start,
-					"to":        dr.End,
 					"doc_count": dr.Count,
 				}
+				// 边界输出为毫秒时间戳和格式化字符串，自定义 format 见 applyRangeOutputOptions
+				setDateRangeBucketBound(bucket, "from", dr.Start)
+				setDateRangeBucketBound(bucket, "to", dr.End)
 
 				// 处理嵌套聚合（date range聚合的嵌套）
 				if nestedAggInfo != nil {
@@ -2057,10 +2569,12 @@ func (h *DocumentHandler) buildAggregations(facets search.FacetResults, composit
 							dateRangeQuery := h.buildDateRangeQueryForBucket(fieldName, dr.Start, dr.End)
 							if dateRangeQuery != nil {
 								combinedQuery := query.NewBooleanQuery([]query.Query{baseQuery, dateRangeQuery}, nil, nil)
-								subAggResults := h.buildNestedAggregationsForBucket(name, dr.Name, subAggs, idx, combinedQuery)
-								if len(subAggResults) > 0 {
-									bucket["aggregations"] = subAggResults
-								}
+								bucketTasks = append(bucketTasks, func() {
+									subAggResults := h.buildNestedAggregationsForBucket(ctx, name, dr.Name, subAggs, idx, combinedQuery)
+									if len(subAggResults) > 0 {
+										bucket["aggregations"] = subAggResults
+									}
+								})
 							}
 						}
 					}
@@ -2071,12 +2585,57 @@ func (h *DocumentHandler) buildAggregations(facets search.FacetResults, composit
 			agg["buckets"] = buckets
 		}
 
+		aggPool.run(bucketTasks)
 		aggs[name] = agg
 	}
 
 	return aggs
 }
 
+// facetTermsDictionary 获取terms聚合字段的词项字典（未配置索引管理器或字段基数过高时返回nil）
+func (h *DocumentHandler) facetTermsDictionary(idx bleve.Index, field string) *es.TermsDictionary {
+	if h.indexMgr == nil || field == "" {
+		return nil
+	}
+	dict, err := h.indexMgr.TermsDictionary(idx, field, func(term string) interface{} {
+		return h.decodeFacetTerm(idx, field, term)
+	})
+	if err != nil {
+		logger.Warn("Failed to build terms dictionary for field [%s]: %v", field, err)
+		return nil
+	}
+	return dict
+}
+
+// decodeFacetTerm 按字段在 mapping 中的类型解码 facet 词项
+// boolean 字段的 "T"/"F" 解码为布尔值；keyword/text 字段的词项不转换为布尔值（如 keyword 值 "T" 保持字符串）
+func (h *DocumentHandler) decodeFacetTerm(idx bleve.Index, field, term string) interface{} {
+	switch idx.Mapping().FieldMappingForPath(field).Type {
+	case "boolean":
+		switch term {
+		case "T":
+			return true
+		case "F":
+			return false
+		}
+	case "text":
+		value := h.convertFacetTermToTypedValue(term)
+		if _, ok := value.(bool); ok {
+			return term
+		}
+		return value
+	}
+	return h.convertFacetTermToTypedValue(term)
+}
+
+// setBooleanKeyAsString 布尔 key 的桶补充 key_as_string（"true"/"false"）
+func setBooleanKeyAsString(bucket map[string]interface{}) map[string]interface{} {
+	if b, ok := bucket["key"].(bool); ok {
+		bucket["key_as_string"] = strconv.FormatBool(b)
+	}
+	return bucket
+}
+
 // convertFacetTermToTypedValue 将Bleve facet返回的term转换为适当的类型
 // ES的terms聚合应该返回与原始字段类型相同类型的值
 // 关键：Bleve的数字字段使用PrefixCoded编码，需要先解码
@@ -2258,6 +2817,19 @@ func (h *DocumentHandler) parseSourceField(source interface{}) []string {
 	return nil
 }
 
+// resolveRootQuery 展开查询中的 nested/join 查询；索引包含 nested 字段时排除子文档，
+// 保证顶层查询（search/count/delete_by_query）只命中根文档
+func (h *DocumentHandler) resolveRootQuery(idx bleve.Index, indexName string, q query.Query) (query.Query, error) {
+	q, err := h.processJoinQueries(idx, q)
+	if err != nil {
+		return nil, err
+	}
+	if h.hasNestedFields(indexName) {
+		q = dsl.ExcludeNestedDocuments(q)
+	}
+	return q, nil
+}
+
 // processJoinQueries 处理查询中的 join 查询（has_child/has_parent/percolate）
 // 递归遍历查询树，找到并展开特殊查询
 func (h *DocumentHandler) processJoinQueries(idx bleve.Index, q query.Query) (query.Query, error) {
@@ -2266,12 +2838,19 @@ func (h *DocumentHandler) processJoinQueries(idx bleve.Index, q query.Query) (qu
 		// 清理注册的 join 查询信息
 		defer dsl.UnregisterJoinQuery(q)
 
+		// 内部查询可能包含其他 join/nested 查询，先展开
+		innerQuery, err := h.processJoinQueries(idx, info.InnerQuery)
+		if err != nil {
+			return nil, err
+		}
+		info.InnerQuery = innerQuery
+
 		// 根据类型执行两阶段查询
 		switch info.Type {
 		case dsl.JoinQueryTypeHasChild:
-			return dsl.ExecuteHasChildQuery(nil, idx, info.TypeName, info.InnerQuery, info.Boost)
+			return dsl.ExecuteHasChildJoin(nil, idx, info)
 		case dsl.JoinQueryTypeHasParent:
-			return dsl.ExecuteHasParentQuery(nil, idx, info.TypeName, info.InnerQuery, info.Boost)
+			return dsl.ExecuteHasParentJoin(nil, idx, info)
 		}
 	}
 
@@ -2306,6 +2885,36 @@ func (h *DocumentHandler) processJoinQueries(idx bleve.Index, q query.Query) (qu
 		}
 		return tq, nil
 
+	case *dsl.DisMaxQuery:
+		for i, child := range tq.Disjuncts {
+			processed, err := h.processJoinQueries(idx, child)
+			if err != nil {
+				return nil, err
+			}
+			tq.Disjuncts[i] = processed
+		}
+		return tq, nil
+
+	case *dsl.BoostingQuery:
+		positive, err := h.processJoinQueries(idx, tq.Positive)
+		if err != nil {
+			return nil, err
+		}
+		negative, err := h.processJoinQueries(idx, tq.Negative)
+		if err != nil {
+			return nil, err
+		}
+		tq.Positive, tq.Negative = positive, negative
+		return tq, nil
+
+	case *dsl.NestedQuery:
+		processed, err := h.processJoinQueries(idx, tq.InnerQuery)
+		if err != nil {
+			return nil, err
+		}
+		tq.InnerQuery = processed
+		return tq, nil
+
 	case *query.BooleanQuery:
 		if tq.Must != nil {
 			processed, err := h.processJoinQueries(idx, tq.Must)
@@ -2328,6 +2937,13 @@ func (h *DocumentHandler) processJoinQueries(idx bleve.Index, q query.Query) (qu
 			}
 			tq.MustNot = processed
 		}
+		if tq.Filter != nil {
+			processed, err := h.processJoinQueries(idx, tq.Filter)
+			if err != nil {
+				return nil, err
+			}
+			tq.Filter = processed
+		}
 		return tq, nil
 	}
 
@@ -0,0 +1,409 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/fusion"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// 混合检索
+// query、sub_searches 中的每个查询与每个 knn 检索各为一路召回，分别取前 rank_window_size 条结果后融合为一个结果列表：
+// rank.rrf 按各路排名做倒数排名融合，rank.linear 将各路得分按 min-max 归一化后加权求和；
+// 未指定 rank 时与 ES 一致，query 与 knn 的得分直接相加。
+// 聚合与 hits.total 基于所有召回的并集：各路查询的析取，加上 knn 命中的文档。
+
+// 融合方式
+const (
+	hybridRankRRF    = "rrf"
+	hybridRankLinear = "linear"
+)
+
+// knnSpec 一个 knn 检索
+// ES格式: {"knn": {"field": "vec", "query_vector": [...], "k": 10, "num_candidates": 100, "filter": {...}, "boost": 1}}
+type knnSpec struct {
+	field  string
+	vector []float32
+	k      int
+	boost  float64
+	filter query.Query
+}
+
+// hybridLeg 一路召回，query 与 knn 二选一
+type hybridLeg struct {
+	query query.Query
+	knn   *bleve.SearchRequest
+}
+
+// hybridSearch 混合检索配置
+// ES格式: {"sub_searches": [{"query": {...}}, ...], "knn": {...}, "rank": {"rrf": {"rank_constant": 60, "rank_window_size": 100}}}
+// 或: {"query": {...}, "knn": {...}, "rank": {"linear": {"rank_window_size": 100, "weights": [0.3, 0.7]}}}
+type hybridSearch struct {
+	legs         []*hybridLeg
+	rank         string // 为空时各路得分相加
+	rankConstant int
+	windowSize   int
+	weights      []float64 // 每路召回的权重，按 query、sub_searches、knn 的顺序
+}
+
+// parseHybridSearch 解析 knn、sub_searches 与 rank 参数，请求不包含这些参数时返回 nil
+// mainQuery 为已解析的主查询，parseQuery 解析子查询与 knn 的 filter（nil 表示不限制），fieldAllowed 判断 knn 字段是否可见
+func parseHybridSearch(searchReq *SearchRequest, mainQuery query.Query, parseQuery func(map[string]interface{}) (query.Query, error), fieldAllowed func(string) bool) (*hybridSearch, error) {
+	if searchReq.Knn == nil && searchReq.SubSearches == nil && searchReq.Rank == nil {
+		return nil, nil
+	}
+	if searchReq.SubSearches != nil && searchReq.Rank == nil {
+		return nil, fmt.Errorf("[sub_searches] requires [rank]")
+	}
+	if len(searchReq.Sort) > 0 {
+		return nil, fmt.Errorf("[sort] cannot be used with [knn], [sub_searches] or [rank]")
+	}
+	if len(searchReq.SearchAfter) > 0 {
+		return nil, fmt.Errorf("[search_after] cannot be used with [knn], [sub_searches] or [rank]")
+	}
+	if searchReq.Rescore != nil {
+		return nil, fmt.Errorf("[rescore] cannot be used with [knn], [sub_searches] or [rank]")
+	}
+
+	hybrid := &hybridSearch{}
+	if searchReq.Query != nil {
+		hybrid.legs = append(hybrid.legs, &hybridLeg{query: mainQuery})
+	}
+	for _, item := range searchReq.SubSearches {
+		subSearch, ok := item.(map[string]interface{})
+		queryMap, _ := subSearch["query"].(map[string]interface{})
+		if !ok || queryMap == nil {
+			return nil, fmt.Errorf("[sub_searches] entries must be objects with a [query]")
+		}
+		q, err := parseQuery(queryMap)
+		if err != nil {
+			return nil, fmt.Errorf("[sub_searches] failed to parse [query]: %w", err)
+		}
+		hybrid.legs = append(hybrid.legs, &hybridLeg{query: q})
+	}
+
+	var knnItems []interface{}
+	switch v := searchReq.Knn.(type) {
+	case nil:
+	case []interface{}:
+		knnItems = v
+	default:
+		knnItems = []interface{}{v}
+	}
+	for _, item := range knnItems {
+		spec, err := parseKNN(item, searchReq.Size, parseQuery)
+		if err != nil {
+			return nil, err
+		}
+		if !fieldAllowed(spec.field) {
+			// 不可见字段按未映射字段处理，这一路召回没有结果
+			hybrid.legs = append(hybrid.legs, &hybridLeg{query: query.NewMatchNoneQuery()})
+			continue
+		}
+		req, err := knnSearchRequest(spec)
+		if err != nil {
+			return nil, err
+		}
+		hybrid.legs = append(hybrid.legs, &hybridLeg{knn: req})
+	}
+
+	if searchReq.Rank == nil {
+		return hybrid, nil
+	}
+	if len(searchReq.Rank) != 1 {
+		return nil, fmt.Errorf("[rank] must contain exactly one of [%s] or [%s]", hybridRankRRF, hybridRankLinear)
+	}
+	if len(hybrid.legs) < 2 {
+		return nil, fmt.Errorf("[rank] requires a minimum of [2] result sets using a combination of [query], [sub_searches] and [knn]")
+	}
+	for rank, v := range searchReq.Rank {
+		rankMap, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[rank] [%s] must be an object", rank)
+		}
+		if err := hybrid.parseRank(rank, rankMap, searchReq.From+searchReq.Size, searchReq.Size); err != nil {
+			return nil, err
+		}
+	}
+	return hybrid, nil
+}
+
+// parseRank 解析融合方式与参数，rank_window_size 默认为 from+size
+func (hs *hybridSearch) parseRank(rank string, rankMap map[string]interface{}, defaultWindowSize, size int) error {
+	hs.rank = rank
+	hs.windowSize = defaultWindowSize
+	hs.weights = make([]float64, len(hs.legs))
+	for i := range hs.weights {
+		hs.weights[i] = 1
+	}
+	if v, ok := rankMap["rank_window_size"]; ok {
+		windowSize, ok := v.(float64)
+		if !ok || windowSize < 1 || windowSize != float64(int(windowSize)) {
+			return fmt.Errorf("[rank] [rank_window_size] must be a positive integer")
+		}
+		hs.windowSize = int(windowSize)
+	}
+	if hs.windowSize < size {
+		return fmt.Errorf("[rank] requires [rank_window_size: %d] be greater than or equal to [size: %d]", hs.windowSize, size)
+	}
+
+	switch rank {
+	case hybridRankRRF:
+		hs.rankConstant = bleve.DefaultScoreRankConstant
+		if v, ok := rankMap["rank_constant"]; ok {
+			rankConstant, ok := v.(float64)
+			if !ok || rankConstant < 1 || rankConstant != float64(int(rankConstant)) {
+				return fmt.Errorf("[rank] [rank_constant] must be a positive integer")
+			}
+			hs.rankConstant = int(rankConstant)
+		}
+	case hybridRankLinear:
+		if v, ok := rankMap["weights"]; ok {
+			weights, ok := v.([]interface{})
+			if !ok || len(weights) != len(hs.legs) {
+				return fmt.Errorf("[rank] [linear] [weights] must be an array with one weight for each of the [%d] result sets", len(hs.legs))
+			}
+			for i, w := range weights {
+				weight, ok := w.(float64)
+				if !ok || weight < 0 {
+					return fmt.Errorf("[rank] [linear] [weights] must be non-negative numbers")
+				}
+				hs.weights[i] = weight
+			}
+		}
+	default:
+		return fmt.Errorf("[rank] unknown rank type [%s], expected [%s] or [%s]", rank, hybridRankRRF, hybridRankLinear)
+	}
+	return nil
+}
+
+// parseKNN 解析一个 knn 检索，k 默认为 size
+func parseKNN(raw interface{}, size int, parseQuery func(map[string]interface{}) (query.Query, error)) (*knnSpec, error) {
+	knnMap, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("[knn] must be an object or an array of objects")
+	}
+	spec := &knnSpec{k: size, boost: 1}
+	if spec.field, _ = knnMap["field"].(string); spec.field == "" {
+		return nil, fmt.Errorf("[knn] requires a [field]")
+	}
+	vector, ok := knnMap["query_vector"].([]interface{})
+	if !ok || len(vector) == 0 {
+		return nil, fmt.Errorf("[knn] requires a non-empty [query_vector]")
+	}
+	spec.vector = make([]float32, len(vector))
+	for i, v := range vector {
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("[knn] [query_vector] must be an array of numbers")
+		}
+		spec.vector[i] = float32(f)
+	}
+	if v, ok := knnMap["k"]; ok {
+		k, ok := v.(float64)
+		if !ok || k < 1 || k != float64(int(k)) {
+			return nil, fmt.Errorf("[knn] [k] must be a positive integer")
+		}
+		spec.k = int(k)
+	}
+	if v, ok := knnMap["num_candidates"]; ok {
+		// 向量索引自行决定候选集大小，这里只做与 ES 相同的校验
+		numCandidates, ok := v.(float64)
+		if !ok || int(numCandidates) < spec.k {
+			return nil, fmt.Errorf("[knn] [num_candidates] cannot be less than [k]")
+		}
+	}
+	if v, ok := knnMap["boost"]; ok {
+		if spec.boost, ok = v.(float64); !ok {
+			return nil, fmt.Errorf("[knn] [boost] must be a number")
+		}
+	}
+
+	// filter 支持单个查询或查询数组，文档级安全与根文档限制同样作用于 knn
+	var filters []query.Query
+	switch v := knnMap["filter"].(type) {
+	case nil:
+	case map[string]interface{}:
+		q, err := parseQuery(v)
+		if err != nil {
+			return nil, fmt.Errorf("[knn] failed to parse [filter]: %w", err)
+		}
+		filters = append(filters, q)
+	case []interface{}:
+		for _, item := range v {
+			filterMap, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("[knn] [filter] must be an object or an array of objects")
+			}
+			q, err := parseQuery(filterMap)
+			if err != nil {
+				return nil, fmt.Errorf("[knn] failed to parse [filter]: %w", err)
+			}
+			filters = append(filters, q)
+		}
+	default:
+		return nil, fmt.Errorf("[knn] [filter] must be an object or an array of objects")
+	}
+	switch len(filters) {
+	case 0:
+		q, err := parseQuery(nil)
+		if err != nil {
+			return nil, err
+		}
+		spec.filter = q
+	case 1:
+		spec.filter = filters[0]
+	default:
+		spec.filter = query.NewConjunctionQuery(filters)
+	}
+	return spec, nil
+}
+
+// executeHybridSearch 执行各路召回并融合，返回 from/size 分页后的结果
+// bleveReq 的查询被替换为各路召回的并集，用于后续聚合；结果的 Total 与 Facets 也基于该并集
+func (h *DocumentHandler) executeHybridSearch(ctx context.Context, idx bleve.Index, bleveReq *bleve.SearchRequest, hybrid *hybridSearch, from, size int) (*bleve.SearchResult, error) {
+	windowSize := hybrid.windowSize
+	if windowSize == 0 {
+		windowSize = from + size
+	}
+
+	legHits := make([]search.DocumentMatchCollection, len(hybrid.legs))
+	unionQueries := make([]query.Query, 0, len(hybrid.legs))
+	var knnIDs []string
+	timedOut := false
+	for i, leg := range hybrid.legs {
+		req := leg.knn
+		if req == nil {
+			req = bleve.NewSearchRequestOptions(leg.query, windowSize, 0, bleveReq.Explain)
+			req.Highlight = bleveReq.Highlight
+			unionQueries = append(unionQueries, leg.query)
+		} else {
+			req.Explain = bleveReq.Explain
+		}
+		result, err := idx.SearchInContext(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		timedOut = timedOut || result.TimedOut
+		legHits[i] = result.Hits
+		if leg.knn != nil {
+			for _, hit := range result.Hits {
+				knnIDs = append(knnIDs, hit.ID)
+			}
+		}
+	}
+
+	if len(knnIDs) > 0 {
+		unionQueries = append(unionQueries, query.NewDocIDQuery(knnIDs))
+	}
+	switch len(unionQueries) {
+	case 0:
+		bleveReq.Query = query.NewMatchNoneQuery()
+	case 1:
+		bleveReq.Query = unionQueries[0]
+	default:
+		bleveReq.Query = query.NewDisjunctionQuery(unionQueries)
+	}
+	bleveReq.From = 0
+	bleveReq.Size = 0
+	searchResult, err := idx.SearchInContext(ctx, bleveReq)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := mergeHybridHits(legHits, hybrid.rank == "", bleveReq.Explain)
+	var fused fusion.FusionResult
+	switch hybrid.rank {
+	case hybridRankRRF:
+		fused = fusion.ReciprocalRankFusion(hits, hybrid.weights, hybrid.rankConstant, windowSize, len(legHits)-1, bleveReq.Explain)
+	case hybridRankLinear:
+		fused = fusion.RelativeScoreFusion(hits, hybrid.weights, windowSize, len(legHits)-1, bleveReq.Explain)
+	default:
+		sort.Sort(hits)
+		fused = fusion.FusionResult{Hits: hits}
+		for _, hit := range hits {
+			if hit.Score > fused.MaxScore {
+				fused.MaxScore = hit.Score
+			}
+		}
+	}
+
+	searchResult.Hits = pageHits(fused.Hits, from, size)
+	searchResult.MaxScore = fused.MaxScore
+	searchResult.TimedOut = searchResult.TimedOut || timedOut
+	return searchResult, nil
+}
+
+// mergeHybridHits 按文档合并各路召回的结果
+// 融合时第一路的得分放在 Score 中，其余各路放在 ScoreBreakdown[i-1] 中（与 fusion 包的约定一致）；
+// sum 为 true 时直接将各路得分相加。HitNumber 记录文档首次出现的顺序，用于同分时排序
+func mergeHybridHits(legHits []search.DocumentMatchCollection, sum, explain bool) search.DocumentMatchCollection {
+	hits := make(search.DocumentMatchCollection, 0, len(legHits[0]))
+	byID := make(map[string]*search.DocumentMatch)
+	for i, leg := range legHits {
+		for _, hit := range leg {
+			dm, ok := byID[hit.ID]
+			if !ok {
+				dm = &search.DocumentMatch{
+					ID:              hit.ID,
+					IndexInternalID: hit.IndexInternalID,
+					HitNumber:       uint64(len(hits)),
+				}
+				if explain {
+					dm.Expl = &search.Explanation{Message: "sum of", Children: make([]*search.Explanation, len(legHits))}
+				}
+				byID[hit.ID] = dm
+				hits = append(hits, dm)
+			}
+			if dm.Fragments == nil {
+				dm.Fragments = hit.Fragments
+			}
+			if dm.Expl != nil {
+				dm.Expl.Children[i] = hit.Expl
+			}
+			switch {
+			case sum:
+				dm.Score += hit.Score
+			case i == 0:
+				dm.Score = hit.Score
+			default:
+				if dm.ScoreBreakdown == nil {
+					dm.ScoreBreakdown = make(map[int]float64, len(legHits)-1)
+				}
+				dm.ScoreBreakdown[i-1] = hit.Score
+			}
+		}
+	}
+	if sum && explain {
+		// 相加时只保留命中的各路解释
+		for _, dm := range hits {
+			children := dm.Expl.Children[:0]
+			for _, child := range dm.Expl.Children {
+				if child != nil {
+					children = append(children, child)
+				}
+			}
+			dm.Expl.Children = children
+			dm.Expl.Value = dm.Score
+		}
+	}
+	return hits
+}
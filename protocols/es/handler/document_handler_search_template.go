@@ -0,0 +1,70 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// SearchTemplate 使用 search template 搜索
+// GET/POST /<index>/_search/template
+// GET/POST /_search/template
+// 请求体：{"id": "<stored script>", "params": {...}} 或 {"source": "...", "params": {...}}
+func (h *DocumentHandler) SearchTemplate(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	if body == nil {
+		body = make(map[string]interface{})
+	}
+
+	searchBody, apiErr := renderSearchTemplate(h.metaStore, body)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	// 模板请求级别的 explain/profile 覆盖渲染结果
+	for _, key := range []string{"explain", "profile"} {
+		if v, ok := body[key]; ok {
+			searchBody[key] = v
+		}
+	}
+
+	data, err := json.Marshal(searchBody)
+	if err != nil {
+		common.HandleError(w, common.NewInternalServerError("failed to encode rendered search template: "+err.Error()))
+		return
+	}
+
+	// 以渲染后的请求体执行普通搜索
+	searchReq := r.Clone(r.Context())
+	searchReq.Method = http.MethodPost
+	searchReq.Body = io.NopCloser(bytes.NewReader(data))
+	searchReq.ContentLength = int64(len(data))
+
+	if mux.Vars(r)["index"] == "" {
+		h.GlobalSearch(w, searchReq)
+		return
+	}
+	h.Search(w, searchReq)
+}
@@ -15,9 +15,15 @@
 package handler
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -25,6 +31,8 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/lscgzwd/tiggerdb/directory"
 	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/numeric"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
 	esIndex "github.com/lscgzwd/tiggerdb/protocols/es/index"
 )
 
@@ -369,6 +377,66 @@ func TestDocumentHandler_Search_InvalidQuery(t *testing.T) {
 	t.Log("Search invalid query test passed")
 }
 
+// TestDocumentHandler_Search_Hybrid 测试 query 与 sub_searches 按 rank 融合为一个结果列表
+func TestDocumentHandler_Search_Hybrid(t *testing.T) {
+	docHandler, cleanup, indexName := setupSearchTestEnvironment(t)
+	defer cleanup()
+
+	doSearch := func(searchData string) (int, []string, int) {
+		searchReq := httptest.NewRequest("POST", "/"+indexName+"/_search", strings.NewReader(searchData))
+		searchReq.Header.Set("Content-Type", "application/json")
+		searchReq = mux.SetURLVars(searchReq, map[string]string{"index": indexName})
+		searchW := httptest.NewRecorder()
+		docHandler.Search(searchW, searchReq)
+		var resp struct {
+			Hits struct {
+				Total struct {
+					Value int `json:"value"`
+				} `json:"total"`
+				Hits []struct {
+					ID string `json:"_id"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if searchW.Code == http.StatusOK {
+			if err := json.Unmarshal(searchW.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %s: %v", searchData, err)
+			}
+		}
+		ids := make([]string, 0, len(resp.Hits.Hits))
+		for _, hit := range resp.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return searchW.Code, ids, resp.Hits.Total.Value
+	}
+
+	// doc2 同时出现在两路召回中，融合后排在第一位；总数为各路召回的并集
+	for _, rank := range []string{`{"rrf":{"rank_constant":10}}`, `{"linear":{"weights":[1,1]}}`} {
+		code, ids, total := doSearch(`{"query":{"match":{"category":"fruit"}},"sub_searches":[{"query":{"match":{"name":"banana carrot"}}}],` +
+			`"rank":` + rank + `,"explain":true}`)
+		if code != http.StatusOK || len(ids) != 3 || ids[0] != "doc2" || total != 3 {
+			t.Errorf("rank %s: expected doc2 first out of 3 hits, got %d %v (total %d)", rank, code, ids, total)
+		}
+	}
+	// from/size 在融合后的结果上分页
+	if code, ids, _ := doSearch(`{"from":1,"size":1,"sub_searches":[{"query":{"match":{"category":"fruit"}}},{"query":{"match":{"name":"banana"}}}],"rank":{"rrf":{}}}`); code != http.StatusOK || len(ids) != 1 || ids[0] != "doc1" {
+		t.Errorf("Expected the second fused hit doc1, got %d %v", code, ids)
+	}
+
+	for _, searchData := range []string{
+		`{"query":{"match_all":{}},"rank":{"rrf":{}}}`,
+		`{"query":{"match_all":{}},"sub_searches":[{"query":{"match_all":{}}}]}`,
+		`{"query":{"match_all":{}},"sub_searches":[{"query":{"match_all":{}}}],"rank":{"rrf":{}},"sort":[{"price":"asc"}]}`,
+		`{"query":{"match_all":{}},"sub_searches":[{"query":{"match_all":{}}}],"rank":{"unknown":{}}}`,
+		`{"query":{"match_all":{}},"sub_searches":[{"query":{"match_all":{}}}],"rank":{"rrf":{"rank_window_size":5}},"size":10}`,
+		`{"query":{"match_all":{}},"sub_searches":[{"query":{"match_all":{}}}],"rank":{"linear":{"weights":[1]}}}`,
+	} {
+		if code, _, _ := doSearch(searchData); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got status %d", searchData, code)
+		}
+	}
+}
+
 // TestDocumentHandler_Search_IndexNotFound 测试索引不存在
 func TestDocumentHandler_Search_IndexNotFound(t *testing.T) {
 	docHandler, cleanup, _ := setupSearchTestEnvironment(t)
@@ -414,3 +482,1618 @@ func TestDocumentHandler_Search_Fields(t *testing.T) {
 
 	t.Log("Search fields test passed")
 }
+
+// TestDocumentHandler_Search_Profile 测试 profile
+func TestDocumentHandler_Search_Profile(t *testing.T) {
+	docHandler, cleanup, indexName := setupSearchTestEnvironment(t)
+	defer cleanup()
+
+	searchData := `{"profile":true,"query":{"bool":{"must":[{"match":{"category":"fruit"}}],"must_not":[{"match":{"name":"banana"}}]}},"aggs":{"cats":{"terms":{"field":"category"}}}}`
+	searchReq := httptest.NewRequest("POST", "/"+indexName+"/_search", strings.NewReader(searchData))
+	searchReq.Header.Set("Content-Type", "application/json")
+	searchReq = mux.SetURLVars(searchReq, map[string]string{"index": indexName})
+	searchW := httptest.NewRecorder()
+	docHandler.Search(searchW, searchReq)
+
+	if searchW.Code != http.StatusOK {
+		t.Fatalf("Search failed: %s", searchW.Body.String())
+	}
+
+	type queryProfile struct {
+		Type        string           `json:"type"`
+		TimeInNanos int64            `json:"time_in_nanos"`
+		Breakdown   map[string]int64 `json:"breakdown"`
+		Children    []queryProfile   `json:"children"`
+	}
+	var resp struct {
+		Profile struct {
+			Shards []struct {
+				ID       string `json:"id"`
+				Searches []struct {
+					Query       []queryProfile `json:"query"`
+					RewriteTime int64          `json:"rewrite_time"`
+					Collector   []struct {
+						Name string `json:"name"`
+					} `json:"collector"`
+				} `json:"searches"`
+				Aggregations []struct {
+					Type        string `json:"type"`
+					Description string `json:"description"`
+				} `json:"aggregations"`
+				Fetch struct {
+					Type string `json:"type"`
+				} `json:"fetch"`
+			} `json:"shards"`
+		} `json:"profile"`
+	}
+	if err := json.Unmarshal(searchW.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Profile.Shards) != 1 {
+		t.Fatalf("Expected 1 profiled shard, got: %s", searchW.Body.String())
+	}
+	shard := resp.Profile.Shards[0]
+	if !strings.Contains(shard.ID, "["+indexName+"]") {
+		t.Errorf("Unexpected shard id %q", shard.ID)
+	}
+	if len(shard.Searches) != 1 || len(shard.Searches[0].Query) != 1 || len(shard.Searches[0].Collector) != 1 {
+		t.Fatalf("Unexpected searches profile: %s", searchW.Body.String())
+	}
+	root := shard.Searches[0].Query[0]
+	if len(root.Children) == 0 {
+		t.Errorf("Expected child query profiles, got %+v", root)
+	}
+	// apple 是唯一匹配的文档
+	if _, ok := root.Breakdown["create_weight"]; !ok || root.Breakdown["match_count"] != 1 {
+		t.Errorf("Unexpected root breakdown %v", root.Breakdown)
+	}
+	if len(shard.Aggregations) != 1 || shard.Aggregations[0].Type != "terms" || shard.Aggregations[0].Description != "cats" {
+		t.Errorf("Unexpected aggregation profile %+v", shard.Aggregations)
+	}
+	if shard.Fetch.Type != "fetch" {
+		t.Errorf("Unexpected fetch profile %+v", shard.Fetch)
+	}
+
+	// 未开启 profile 时不返回 profile
+	searchReq = httptest.NewRequest("POST", "/"+indexName+"/_search", strings.NewReader(`{"query":{"match_all":{}}}`))
+	searchReq = mux.SetURLVars(searchReq, map[string]string{"index": indexName})
+	searchW = httptest.NewRecorder()
+	docHandler.Search(searchW, searchReq)
+	if strings.Contains(searchW.Body.String(), `"profile"`) {
+		t.Errorf("Unexpected profile in response: %s", searchW.Body.String())
+	}
+}
+
+// TestDocumentHandler_Search_Timeout 测试 timeout 与请求取消
+func TestDocumentHandler_Search_Timeout(t *testing.T) {
+	docHandler, cleanup, indexName := setupSearchTestEnvironment(t)
+	defer cleanup()
+
+	search := func(ctx context.Context, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		req = mux.SetURLVars(req, map[string]string{"index": indexName})
+		w := httptest.NewRecorder()
+		docHandler.Search(w, req)
+		return w
+	}
+
+	// 未超时
+	w := search(context.Background(), "/"+indexName+"/_search", `{"timeout":"10s","query":{"match_all":{}}}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"timed_out":false`) || !strings.Contains(w.Body.String(), `"value":5`) {
+		t.Fatalf("Expected complete results, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 立即超时：返回部分结果
+	w = search(context.Background(), "/"+indexName+"/_search?timeout=1nanos", `{"query":{"match_all":{}}}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"timed_out":true`) {
+		t.Fatalf("Expected timed out partial results, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 非法 timeout
+	w = search(context.Background(), "/"+indexName+"/_search", `{"timeout":"soon","query":{"match_all":{}}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for invalid timeout, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 客户端断开
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = search(ctx, "/"+indexName+"/_search", `{"query":{"match_all":{}}}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "task_cancelled_exception") {
+		t.Fatalf("Expected task_cancelled_exception, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestParseTimeValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{"", 0, false},
+		{"-1", 0, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"2s", 2 * time.Second, false},
+		{"1m", time.Minute, false},
+		{"1.5h", 90 * time.Minute, false},
+		{"10micros", 10 * time.Microsecond, false},
+		{"100", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeValue(tt.value)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseTimeValue(%q) = %v, %v; want %v, err=%v", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// TestDocumentHandler_Search_TermsDictionaryCache 测试terms聚合的词项字典缓存
+func TestDocumentHandler_Search_TermsDictionaryCache(t *testing.T) {
+	docHandler, cleanup, indexName := setupSearchTestEnvironment(t)
+	defer cleanup()
+
+	search := func() map[string]interface{} {
+		searchData := `{"size":0,"aggs":{"cats":{"terms":{"field":"category"}},"prices":{"terms":{"field":"price"}}}}`
+		searchReq := httptest.NewRequest("POST", "/"+indexName+"/_search", strings.NewReader(searchData))
+		searchReq.Header.Set("Content-Type", "application/json")
+		searchReq = mux.SetURLVars(searchReq, map[string]string{"index": indexName})
+		searchW := httptest.NewRecorder()
+		docHandler.Search(searchW, searchReq)
+		if searchW.Code != http.StatusOK {
+			t.Fatalf("Search failed: %s", searchW.Body.String())
+		}
+		var resp struct {
+			Aggregations map[string]struct {
+				Buckets []struct {
+					Key      interface{} `json:"key"`
+					DocCount int         `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"aggregations"`
+		}
+		if err := json.Unmarshal(searchW.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		keys := make(map[string]interface{})
+		for name, agg := range resp.Aggregations {
+			for _, b := range agg.Buckets {
+				keys[name+":"+fmt.Sprint(b.Key)] = b.Key
+			}
+		}
+		return keys
+	}
+
+	keys := search()
+	if _, ok := keys["cats:fruit"]; !ok {
+		t.Errorf("expected fruit bucket, got %v", keys)
+	}
+	if v, ok := keys["prices:999.99"]; !ok || v != 999.99 {
+		t.Errorf("expected numeric price bucket 999.99, got %v", keys)
+	}
+
+	idx, err := docHandler.indexMgr.GetIndex(indexName)
+	if err != nil {
+		t.Fatalf("Failed to get index: %v", err)
+	}
+	dict, err := docHandler.indexMgr.TermsDictionary(idx, "price", func(string) interface{} {
+		t.Fatal("expected cached dictionary to be reused")
+		return nil
+	})
+	if err != nil || dict == nil {
+		t.Fatalf("expected cached price dictionary, got %v (err=%v)", dict, err)
+	}
+	if dict.Size() != 5 {
+		t.Errorf("expected 5 decoded price terms, got %d", dict.Size())
+	}
+	if v, ok := dict.Lookup(string(numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(25.0), 0))); !ok || v != int64(25) {
+		t.Errorf("expected price 25 in dictionary, got %v", v)
+	}
+
+	// 字典构建后新写入的词项直接解码
+	bulkData := `{"index":{"_index":"` + indexName + `","_id":"doc6"}}
+{"name":"robot","category":"toys","price":49.0}
+`
+	bulkReq := httptest.NewRequest("POST", "/_bulk", strings.NewReader(bulkData))
+	bulkReq.Header.Set("Content-Type", "application/x-ndjson")
+	bulkW := httptest.NewRecorder()
+	docHandler.Bulk(bulkW, bulkReq)
+	if bulkW.Code != http.StatusOK {
+		t.Fatalf("Failed to index doc: %s", bulkW.Body.String())
+	}
+	keys = search()
+	if _, ok := keys["cats:toys"]; !ok {
+		t.Errorf("expected toys bucket before refresh, got %v", keys)
+	}
+
+	// refresh 后重建字典
+	if err := docHandler.indexMgr.RefreshIndex(indexName); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	search()
+	dict, _ = docHandler.indexMgr.TermsDictionary(idx, "category", func(string) interface{} {
+		t.Fatal("expected rebuilt dictionary to be cached")
+		return nil
+	})
+	if _, ok := dict.Lookup("toys"); !ok {
+		t.Error("expected rebuilt category dictionary to contain toys")
+	}
+}
+
+// TestDocumentHandler_Search_MaxResultWindow 测试index.max_result_window深分页保护
+func TestDocumentHandler_Search_MaxResultWindow(t *testing.T) {
+	docHandler, cleanup, indexName := setupSearchTestEnvironment(t)
+	defer cleanup()
+
+	search := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req = mux.SetURLVars(req, map[string]string{"index": indexName})
+		w := httptest.NewRecorder()
+		docHandler.Search(w, req)
+		return w
+	}
+
+	// 默认上限 10000
+	w := search("/"+indexName+"/_search", `{"from":9995,"size":10}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for deep pagination, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "Result window is too large, from + size must be less than or equal to: [10000] but was [10005]") {
+		t.Errorf("unexpected error: %s", w.Body.String())
+	}
+	if w := search("/"+indexName+"/_search", `{"from":9990,"size":10}`); w.Code != http.StatusOK {
+		t.Errorf("expected 200 within the result window, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// scroll 只限制每批 size
+	if w := search("/"+indexName+"/_search?scroll=1m", `{"size":10001}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "Batch size is too large") {
+		t.Errorf("expected batch size error, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 通过 _settings 动态修改
+	indexHandler := NewIndexHandler(docHandler.dirMgr, docHandler.metaStore)
+	updateSettings := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/"+indexName+"/_settings", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"index": indexName})
+		w := httptest.NewRecorder()
+		indexHandler.UpdateSettings(w, req)
+		return w
+	}
+	if w := updateSettings(`{"index":{"max_result_window":-1}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for negative max_result_window, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := updateSettings(`{"index":{"max_result_window":20000}}`); w.Code != http.StatusOK {
+		t.Fatalf("failed to update settings: %s", w.Body.String())
+	}
+	if w := search("/"+indexName+"/_search", `{"from":10000,"size":10}`); w.Code != http.StatusOK {
+		t.Errorf("expected 200 after raising max_result_window, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := updateSettings(`{"index":{"max_result_window":3}}`); w.Code != http.StatusOK {
+		t.Fatalf("failed to update settings: %s", w.Body.String())
+	}
+	if w := search("/"+indexName+"/_search", `{"size":5}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "[3] but was [5]") {
+		t.Errorf("expected result window error after lowering the setting, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// null 恢复默认值
+	if w := updateSettings(`{"index":{"max_result_window":null}}`); w.Code != http.StatusOK {
+		t.Fatalf("failed to reset settings: %s", w.Body.String())
+	}
+	if w := search("/"+indexName+"/_search", `{"size":5}`); w.Code != http.StatusOK {
+		t.Errorf("expected 200 after resetting max_result_window, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestDocumentHandler_Search_SearchAfterTyped 测试search_after按排序字段类型编码以及sort值的类型
+func TestDocumentHandler_Search_SearchAfterTyped(t *testing.T) {
+	docHandler, cleanup, _ := setupSearchTestEnvironment(t)
+	defer cleanup()
+
+	indexName := "test_search_after_typed"
+	indexHandler := NewIndexHandler(docHandler.dirMgr, docHandler.metaStore)
+	indexHandler.SetIndexManager(docHandler.indexMgr)
+	createReq := httptest.NewRequest("PUT", "/"+indexName, strings.NewReader(`{"mappings":{"properties":{"ts":{"type":"date"},"count":{"type":"long"},"tag":{"type":"keyword"}}}}`))
+	createReq = mux.SetURLVars(createReq, map[string]string{"index": indexName})
+	createW := httptest.NewRecorder()
+	indexHandler.CreateIndex(createW, createReq)
+	if createW.Code != http.StatusOK {
+		t.Fatalf("Failed to create index: %s", createW.Body.String())
+	}
+
+	bulkData := ""
+	for i, doc := range []string{
+		`{"ts":"2024-01-01T00:00:00Z","count":9,"tag":"b"}`,
+		`{"ts":"2024-01-03T00:00:00Z","count":10,"tag":"a"}`,
+		`{"ts":"2024-01-02T00:00:00Z","count":100,"tag":"c"}`,
+		`{"ts":"2024-01-02T00:00:00Z","count":2,"tag":"d"}`,
+		`{"tag":"e"}`,
+	} {
+		bulkData += fmt.Sprintf(`{"index":{"_index":"%s","_id":"d%d"}}`, indexName, i+1) + "\n" + doc + "\n"
+	}
+	bulkReq := httptest.NewRequest("POST", "/_bulk", strings.NewReader(bulkData))
+	bulkReq.Header.Set("Content-Type", "application/x-ndjson")
+	bulkW := httptest.NewRecorder()
+	docHandler.Bulk(bulkW, bulkReq)
+	if bulkW.Code != http.StatusOK {
+		t.Fatalf("Failed to index docs: %s", bulkW.Body.String())
+	}
+
+	type hit struct {
+		ID   string        `json:"_id"`
+		Sort []interface{} `json:"sort"`
+	}
+	search := func(body string) []hit {
+		req := httptest.NewRequest("POST", "/"+indexName+"/_search", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"index": indexName})
+		w := httptest.NewRecorder()
+		docHandler.Search(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Search failed: %s", w.Body.String())
+		}
+		var resp struct {
+			Hits struct {
+				Hits []hit `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return resp.Hits.Hits
+	}
+
+	// 按 long 字段分页：数值顺序（字符串顺序会把 10、100 排在 2、9 之前）
+	sortSpec := `[{"count":"asc"},{"_id":"asc"}]`
+	var ids []string
+	var after []interface{}
+	for page := 0; page < 5; page++ {
+		body := `{"size":2,"sort":` + sortSpec
+		if after != nil {
+			afterJSON, _ := json.Marshal(after)
+			body += `,"search_after":` + string(afterJSON)
+		}
+		hits := search(body + `}`)
+		if len(hits) == 0 {
+			break
+		}
+		for _, h := range hits {
+			ids = append(ids, h.ID)
+		}
+		after = hits[len(hits)-1].Sort
+	}
+	if got := strings.Join(ids, ","); got != "d4,d1,d2,d3,d5" {
+		t.Errorf("expected numeric pagination order d4,d1,d2,d3,d5, got %s", got)
+	}
+
+	// sort 值为原始类型：long、日期毫秒、keyword 字符串、_score 与 _id
+	hits := search(`{"size":1,"sort":[{"ts":"desc"},{"count":"asc"},{"tag":"asc"},"_score",{"_id":"asc"}]}`)
+	if len(hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(hits))
+	}
+	wantMillis := float64(time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC).UnixMilli())
+	if s := hits[0].Sort; len(s) != 5 || s[0] != wantMillis || s[1] != float64(10) || s[2] != "a" || s[4] != "d2" {
+		t.Errorf("unexpected sort values: %v", hits[0].Sort)
+	}
+	if _, ok := hits[0].Sort[3].(float64); !ok {
+		t.Errorf("expected _score sort value to be a number, got %T", hits[0].Sort[3])
+	}
+
+	// 按日期分页，日期相同时由 _id 决定顺序，缺失值排在最后
+	sortSpec = `[{"ts":"desc"},{"_id":"asc"}]`
+	ids, after = nil, nil
+	for page := 0; page < 5; page++ {
+		body := `{"size":2,"sort":` + sortSpec
+		if after != nil {
+			afterJSON, _ := json.Marshal(after)
+			body += `,"search_after":` + string(afterJSON)
+		}
+		hits := search(body + `}`)
+		if len(hits) == 0 {
+			break
+		}
+		for _, h := range hits {
+			ids = append(ids, h.ID)
+		}
+		after = hits[len(hits)-1].Sort
+	}
+	if got := strings.Join(ids, ","); got != "d2,d3,d4,d1,d5" {
+		t.Errorf("expected date pagination order d2,d3,d4,d1,d5, got %s", got)
+	}
+
+	// 日期字符串形式的 search_after
+	hits = search(`{"size":10,"sort":[{"ts":"desc"},{"_id":"asc"}],"search_after":["2024-01-02T00:00:00Z","d3"]}`)
+	if len(hits) != 3 || hits[0].ID != "d4" {
+		t.Errorf("expected d4,d1,d5 after date string, got %v", hits)
+	}
+
+	// 无法解析的 search_after 值
+	req := httptest.NewRequest("POST", "/"+indexName+"/_search", strings.NewReader(`{"sort":[{"count":"asc"}],"search_after":["abc"]}`))
+	req = mux.SetURLVars(req, map[string]string{"index": indexName})
+	w := httptest.NewRecorder()
+	docHandler.Search(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Failed to parse search_after value for field [count]") {
+		t.Errorf("expected search_after parse error, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDocumentHandler_Search_SortOptions(t *testing.T) {
+	docHandler, cleanup, _ := setupSearchTestEnvironment(t)
+	defer cleanup()
+
+	indexName := "test_sort_options"
+	indexHandler := NewIndexHandler(docHandler.dirMgr, docHandler.metaStore)
+	indexHandler.SetIndexManager(docHandler.indexMgr)
+	createReq := httptest.NewRequest("PUT", "/"+indexName, strings.NewReader(`{"mappings":{"properties":{"prices":{"type":"long"},"tag":{"type":"keyword"},"comments":{"type":"nested","properties":{"author":{"type":"keyword"},"stars":{"type":"long"}}}}}}`))
+	createReq = mux.SetURLVars(createReq, map[string]string{"index": indexName})
+	createW := httptest.NewRecorder()
+	indexHandler.CreateIndex(createW, createReq)
+	if createW.Code != http.StatusOK {
+		t.Fatalf("Failed to create index: %s", createW.Body.String())
+	}
+
+	bulkData := ""
+	for i, doc := range []string{
+		`{"prices":[1,10],"tag":"x","comments":[{"author":"a","stars":5},{"author":"b","stars":1}]}`,
+		`{"prices":[4,5],"tag":"y","comments":[{"author":"a","stars":2},{"author":"b","stars":9}]}`,
+		`{"prices":[3],"tag":"z","comments":[{"author":"b","stars":3}]}`,
+		`{"tag":"w"}`,
+	} {
+		bulkData += fmt.Sprintf(`{"index":{"_index":"%s","_id":"d%d"}}`, indexName, i+1) + "\n" + doc + "\n"
+	}
+	bulkReq := httptest.NewRequest("POST", "/_bulk", strings.NewReader(bulkData))
+	bulkReq.Header.Set("Content-Type", "application/x-ndjson")
+	bulkW := httptest.NewRecorder()
+	docHandler.Bulk(bulkW, bulkReq)
+	if bulkW.Code != http.StatusOK {
+		t.Fatalf("Failed to index docs: %s", bulkW.Body.String())
+	}
+
+	type hit struct {
+		ID   string        `json:"_id"`
+		Sort []interface{} `json:"sort"`
+	}
+	search := func(sortSpec string) (int, []hit, string) {
+		req := httptest.NewRequest("POST", "/"+indexName+"/_search", strings.NewReader(`{"size":10,"sort":`+sortSpec+`}`))
+		req = mux.SetURLVars(req, map[string]string{"index": indexName})
+		w := httptest.NewRecorder()
+		docHandler.Search(w, req)
+		var resp struct {
+			Hits struct {
+				Hits []hit `json:"hits"`
+			} `json:"hits"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+		}
+		return w.Code, resp.Hits.Hits, w.Body.String()
+	}
+	ids := func(hits []hit) string {
+		var rv []string
+		for _, h := range hits {
+			rv = append(rv, h.ID)
+		}
+		return strings.Join(rv, ",")
+	}
+
+	tests := []struct {
+		name    string
+		sort    string
+		wantIDs string
+	}{
+		{"default asc uses min", `[{"prices":"asc"}]`, "d1,d3,d2,d4"},
+		{"default desc uses max", `[{"prices":{"order":"desc"}}]`, "d1,d2,d3,d4"},
+		{"mode avg", `[{"prices":{"order":"asc","mode":"avg"}}]`, "d3,d2,d1,d4"},
+		{"mode sum", `[{"prices":{"order":"desc","mode":"sum"}}]`, "d1,d2,d3,d4"},
+		{"mode median", `[{"prices":{"order":"asc","mode":"median"}}]`, "d3,d2,d1,d4"},
+		{"missing first", `[{"prices":{"order":"asc","missing":"_first"}}]`, "d4,d1,d3,d2"},
+		{"custom missing", `[{"prices":{"order":"asc","missing":2}}]`, "d1,d4,d3,d2"},
+		{"unmapped type", `[{"unknown_field":{"order":"asc","unmapped_type":"long"}},{"tag":"asc"}]`, "d4,d1,d2,d3"},
+		{"nested without filter", `[{"comments.stars":{"order":"desc","nested":{"path":"comments"}}}]`, "d2,d1,d3,d4"},
+		{"nested with filter", `[{"comments.stars":{"order":"desc","mode":"max","nested":{"path":"comments","filter":{"term":{"comments.author":"b"}}}}}]`, "d2,d3,d1,d4"},
+		{"legacy nested filter", `[{"comments.stars":{"order":"asc","nested_path":"comments","nested_filter":{"term":{"comments.author":"a"}}}},{"_id":"asc"}]`, "d2,d1,d3,d4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, hits, body := search(tt.sort)
+			if code != http.StatusOK {
+				t.Fatalf("Search failed: %s", body)
+			}
+			if got := ids(hits); got != tt.wantIDs {
+				t.Errorf("expected order %s, got %s", tt.wantIDs, got)
+			}
+		})
+	}
+
+	// sort 值为按 mode 合并后的值
+	_, hits, _ := search(`[{"prices":{"order":"desc","mode":"sum"}}]`)
+	if len(hits) == 0 || hits[0].Sort[0] != float64(11) {
+		t.Errorf("expected sum sort value 11, got %v", hits)
+	}
+	_, hits, _ = search(`[{"comments.stars":{"order":"asc","nested":{"path":"comments","filter":{"term":{"comments.author":"a"}}}}}]`)
+	if len(hits) == 0 || hits[0].ID != "d2" || hits[0].Sort[0] != float64(2) {
+		t.Errorf("expected nested sort value 2 for d2, got %v", hits)
+	}
+
+	// 非法选项
+	for _, tt := range []struct {
+		sort   string
+		reason string
+	}{
+		{`[{"tag":{"mode":"avg"}}]`, "we only support AVG, MEDIAN and SUM on number based fields"},
+		{`[{"prices":{"mode":"first"}}]`, "unknown sort mode [first]"},
+		{`[{"tag":{"nested":{"path":"tag"}}}]`, "is not of nested type"},
+	} {
+		code, _, body := search(tt.sort)
+		if code != http.StatusBadRequest || !strings.Contains(body, tt.reason) {
+			t.Errorf("sort %s: expected 400 with %q, got %d: %s", tt.sort, tt.reason, code, body)
+		}
+	}
+}
+
+func TestDocumentHandler_Search_BooleanFields(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	type searchResponse struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations map[string]struct {
+			Buckets []map[string]interface{} `json:"buckets"`
+		} `json:"aggregations"`
+	}
+	search := func(body string) searchResponse {
+		t.Helper()
+		w := do("POST", "/flags/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp searchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	if w := do("PUT", "/flags", `{"mappings":{"properties":{"active":{"type":"boolean"},"grade":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"flags","_id":"1"}}
+{"active":true,"grade":"T"}
+{"index":{"_index":"flags","_id":"2"}}
+{"active":true,"grade":"F"}
+{"index":{"_index":"flags","_id":"3"}}
+{"active":false,"grade":"T"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, tt := range []struct {
+		query    string
+		expected int
+	}{
+		{`{"term":{"active":true}}`, 2},
+		{`{"term":{"active":{"value":false}}}`, 1},
+		{`{"term":{"active":"true"}}`, 2},
+		{`{"terms":{"active":[false]}}`, 1},
+		{`{"terms":{"active":[true,false]}}`, 3},
+		{`{"term":{"grade":"T"}}`, 2},
+	} {
+		if got := search(`{"query":` + tt.query + `}`).Hits.Total.Value; got != tt.expected {
+			t.Errorf("%s: expected %d hits, got %d", tt.query, tt.expected, got)
+		}
+	}
+
+	// boolean 字段的聚合 key 为布尔值，keyword 字段保持字符串
+	resp := search(`{"size":0,"aggs":{
+		"active":{"terms":{"field":"active"},"aggs":{"grades":{"terms":{"field":"grade"}}}},
+		"grade":{"terms":{"field":"grade"}}
+	}}`)
+	active := resp.Aggregations["active"].Buckets
+	if len(active) != 2 || active[0]["key"] != true || active[0]["key_as_string"] != "true" || active[0]["doc_count"] != 2.0 ||
+		active[1]["key"] != false || active[1]["key_as_string"] != "false" {
+		t.Errorf("unexpected boolean buckets %v", active)
+	}
+	if len(active) > 0 {
+		subAggs, _ := active[0]["aggregations"].(map[string]interface{})
+		grades, _ := subAggs["grades"].(map[string]interface{})
+		if buckets, _ := grades["buckets"].([]interface{}); len(buckets) != 2 {
+			t.Errorf("expected 2 grades for active documents, got %v", active[0])
+		}
+	}
+	grade := resp.Aggregations["grade"].Buckets
+	if len(grade) != 2 || grade[0]["key"] != "T" || grade[1]["key"] != "F" {
+		t.Errorf("unexpected keyword buckets %v", grade)
+	}
+}
+
+func TestDocumentHandler_Search_TypedTermQueries(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/requests", `{"mappings":{"properties":{
+		"status_code":{"type":"integer"},"latency":{"type":"double"},"code":{"type":"keyword"},
+		"day":{"type":"date","format":"yyyy-MM-dd"}
+	}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"requests","_id":"1"}}
+{"status_code":404,"latency":1.5,"code":"404","day":"2024-01-01"}
+{"index":{"_index":"requests","_id":"2"}}
+{"status_code":404,"latency":2,"code":"E404","day":"2024-01-02"}
+{"index":{"_index":"requests","_id":"3"}}
+{"status_code":500,"latency":2.5,"code":"500","day":"2024-01-02"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, tt := range []struct {
+		query    string
+		expected int
+	}{
+		{`{"term":{"status_code":404}}`, 2},
+		{`{"term":{"status_code":"404"}}`, 2},
+		{`{"term":{"status_code":{"value":500}}}`, 1},
+		{`{"terms":{"status_code":[404,500]}}`, 3},
+		{`{"term":{"latency":2}}`, 1},
+		{`{"term":{"latency":1.5}}`, 1},
+		{`{"term":{"code":404}}`, 1},
+		{`{"terms":{"code":[500,"E404"]}}`, 2},
+		{`{"term":{"day":"2024-01-02"}}`, 2},
+		{`{"terms":{"day":["2024-01-01"]}}`, 1},
+	} {
+		w := do("POST", "/requests/_count", `{"query":`+tt.query+`}`)
+		var resp struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", tt.query, w.Code, w.Body.String())
+		}
+		if resp.Count != tt.expected {
+			t.Errorf("%s: expected %d documents, got %d", tt.query, tt.expected, resp.Count)
+		}
+	}
+
+	// 数值字段上无法解析为数字的值返回 400
+	w := do("POST", "/requests/_search", `{"query":{"term":{"status_code":"abc"}}}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `For input string: \"abc\"`) {
+		t.Errorf("invalid numeric term: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDocumentHandler_Search_MappingAwareQueries(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/products", `{"mappings":{"properties":{
+		"price":{"type":"integer"},"sku":{"type":"keyword"},"active":{"type":"boolean"},
+		"released":{"type":"date","format":"dd/MM/yyyy"},
+		"name":{"type":"text","fields":{"raw":{"type":"keyword"}}}
+	}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"products","_id":"1"}}
+{"price":9,"sku":"10","active":true,"released":"01/02/2024","name":"Red Apple"}
+{"index":{"_index":"products","_id":"2"}}
+{"price":10,"sku":"9","active":false,"released":"15/03/2024","name":"Green Apple"}
+{"index":{"_index":"products","_id":"3"}}
+{"price":100,"sku":"b","active":true,"released":"20/12/2023","name":"Banana"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	count := func(q string) int {
+		t.Helper()
+		w := do("POST", "/products/_count", `{"query":`+q+`}`)
+		var resp struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", q, w.Code, w.Body.String())
+		}
+		return resp.Count
+	}
+	for _, tt := range []struct {
+		query    string
+		expected int
+	}{
+		// 数值、boolean、date 字段上的 match 按字段类型精确匹配
+		{`{"match":{"price":"10"}}`, 1},
+		{`{"match":{"price":{"query":100}}}`, 1},
+		{`{"match":{"active":"true"}}`, 2},
+		{`{"match_phrase":{"released":"15/03/2024"}}`, 1},
+		// 数值字段按数值比较，keyword 字段按字典序比较
+		{`{"range":{"price":{"gte":"9","lt":"100"}}}`, 2},
+		{`{"range":{"sku":{"gte":"10","lte":"9"}}}`, 2},
+		{`{"range":{"sku":{"gt":"a"}}}`, 1},
+		// date 字段按 mapping 中的 format 解析
+		{`{"range":{"released":{"gte":"01/01/2024"}}}`, 2},
+		{`{"match":{"name":"apple"}}`, 2},
+	} {
+		if got := count(tt.query); got != tt.expected {
+			t.Errorf("%s: expected %d documents, got %d", tt.query, tt.expected, got)
+		}
+	}
+
+	if w := do("POST", "/products/_search", `{"query":{"match":{"active":"yes"}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid boolean: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 默认允许查询未映射的字段
+	if got := count(`{"term":{"color":"red"}}`); got != 0 {
+		t.Errorf("unmapped field: expected 0 documents, got %d", got)
+	}
+	if w := do("PUT", "/products/_settings", `{"index":{"query":{"parse":{"allow_unmapped_fields":"maybe"}}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid setting: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/products/_settings", `{"index":{"query":{"parse":{"allow_unmapped_fields":false}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("update settings: got %d: %s", w.Code, w.Body.String())
+	}
+	for _, q := range []string{`{"term":{"color":"red"}}`, `{"bool":{"filter":[{"range":{"weight":{"gt":1}}}]}}`, `{"match":{"name.missing":"x"}}`} {
+		w := do("POST", "/products/_search", `{"query":`+q+`}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "No field mapping can be found for the field with name") {
+			t.Errorf("%s: expected 400 in strict mode, got %d: %s", q, w.Code, w.Body.String())
+		}
+	}
+	if got := count(`{"bool":{"must":[{"term":{"sku":"b"}},{"match":{"name":"banana"}},{"term":{"_id":"3"}}]}}`); got != 1 {
+		t.Errorf("mapped fields in strict mode: expected 1 document, got %d", got)
+	}
+}
+
+func TestDocumentHandler_Search_MatchOptions(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/articles", `{"mappings":{"properties":{"title":{"type":"text"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"articles","_id":"1"}}
+{"title":"quick brown fox"}
+{"index":{"_index":"articles","_id":"2"}}
+{"title":"quick brown dog"}
+{"index":{"_index":"articles","_id":"3"}}
+{"title":"lazy dog"}
+{"index":{"_index":"articles","_id":"4"}}
+{"title":"box cox"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	count := func(q string) int {
+		t.Helper()
+		w := do("POST", "/articles/_count", `{"query":`+q+`}`)
+		var resp struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", q, w.Code, w.Body.String())
+		}
+		return resp.Count
+	}
+	for _, tt := range []struct {
+		query    string
+		expected int
+	}{
+		// AUTO：3~5 个字符允许 1 次编辑，少于 3 个字符必须精确匹配
+		{`{"match":{"title":{"query":"quack","fuzziness":"AUTO"}}}`, 2},
+		{`{"match":{"title":{"query":"dig","fuzziness":"AUTO"}}}`, 2},
+		{`{"match":{"title":{"query":"dig","fuzziness":"AUTO:4,7"}}}`, 0},
+		{`{"match":{"title":{"query":"fix","fuzziness":0}}}`, 0},
+		{`{"match":{"title":{"query":"fix","fuzziness":"1"}}}`, 1},
+		// prefix_length 个字符必须精确匹配
+		{`{"match":{"title":{"query":"qxick","fuzziness":1,"prefix_length":1}}}`, 2},
+		{`{"match":{"title":{"query":"qxick","fuzziness":1,"prefix_length":2}}}`, 0},
+		// max_expansions 按编辑距离、文档频率、词项顺序保留候选词：rox -> box
+		{`{"match":{"title":{"query":"rox","fuzziness":1}}}`, 2},
+		{`{"match":{"title":{"query":"rox","fuzziness":1,"max_expansions":1}}}`, 1},
+		// minimum_should_match 按分析后的词项数计算
+		{`{"match":{"title":{"query":"quick brown lazy","minimum_should_match":1}}}`, 3},
+		{`{"match":{"title":{"query":"quick brown lazy","minimum_should_match":2}}}`, 2},
+		{`{"match":{"title":{"query":"quick brown lazy","minimum_should_match":"-1"}}}`, 2},
+		{`{"match":{"title":{"query":"quick brown lazy","minimum_should_match":"100%"}}}`, 0},
+		{`{"match":{"title":{"query":"quick brown lazy","minimum_should_match":"2<-1"}}}`, 2},
+		{`{"match":{"title":{"query":"quack bzzwn","fuzziness":"AUTO","minimum_should_match":2}}}`, 0},
+		{`{"match":{"title":{"query":"quack bown","fuzziness":"AUTO","minimum_should_match":2}}}`, 2},
+		// 与 ES 一样相邻字符互换计为一次编辑
+		{`{"match":{"title":{"query":"quikc","fuzziness":1}}}`, 2},
+		// analyzer 覆盖字段的分析器
+		{`{"match":{"title":{"query":"Quick Brown","analyzer":"keyword"}}}`, 0},
+		{`{"match":{"title":{"query":"Quick Brown","analyzer":"standard","operator":"and"}}}`, 2},
+		{`{"bool":{"should":[{"term":{"title":"quick"}},{"term":{"title":"fox"}},{"term":{"title":"lazy"}}],"minimum_should_match":"-1"}}`, 1},
+	} {
+		if got := count(tt.query); got != tt.expected {
+			t.Errorf("%s: expected %d documents, got %d", tt.query, tt.expected, got)
+		}
+	}
+
+	for _, q := range []string{
+		`{"match":{"title":{"query":"fox","fuzziness":3}}}`,
+		`{"match":{"title":{"query":"fox","fuzziness":"AUTO:x"}}}`,
+		`{"match":{"title":{"query":"fox","max_expansions":0}}}`,
+		`{"match":{"title":{"query":"fox","minimum_should_match":"abc"}}}`,
+	} {
+		if w := do("POST", "/articles/_search", `{"query":`+q+`}`); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", q, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDocumentHandler_Search_MultiMatchTypes(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/books", `{"mappings":{"properties":{
+		"title":{"type":"text"},"summary":{"type":"text"},"pages":{"type":"integer"},
+		"first_name":{"type":"text"},"last_name":{"type":"text"}
+	}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"books","_id":"1"}}
+{"title":"brown fox","summary":"a quick story","pages":10}
+{"index":{"_index":"books","_id":"2"}}
+{"title":"quick brown fox","summary":"brown","pages":20}
+{"index":{"_index":"books","_id":"3"}}
+{"title":"lazy dog","summary":"quick brown fox jumps","pages":30}
+{"index":{"_index":"books","_id":"4"}}
+{"first_name":"john","last_name":"smith"}
+{"index":{"_index":"books","_id":"5"}}
+{"first_name":"smith","last_name":"jones"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	type hit struct {
+		ID    string  `json:"_id"`
+		Score float64 `json:"_score"`
+	}
+	search := func(q string) []hit {
+		t.Helper()
+		w := do("POST", "/books/_search", `{"query":`+q+`}`)
+		var resp struct {
+			Hits struct {
+				Hits []hit `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", q, w.Code, w.Body.String())
+		}
+		return resp.Hits.Hits
+	}
+
+	for _, tt := range []struct {
+		query    string
+		expected int
+		top      string
+	}{
+		// 字段权重决定最佳字段
+		{`{"multi_match":{"query":"quick brown fox","fields":["title^5","summary"]}}`, 3, "2"},
+		{`{"multi_match":{"query":"quick brown fox","fields":["title","summary^5"]}}`, 3, "3"},
+		// operator 作用于单个字段：best_fields 要求同一字段包含全部词项，cross_fields 允许分布在不同字段
+		{`{"multi_match":{"query":"quick fox","fields":["title","summary"],"operator":"and"}}`, 2, ""},
+		{`{"multi_match":{"query":"quick fox","fields":["title","summary"],"type":"most_fields","operator":"and"}}`, 2, ""},
+		{`{"multi_match":{"query":"quick fox","fields":["title","summary"],"type":"cross_fields","operator":"and"}}`, 3, ""},
+		{`{"multi_match":{"query":"john smith","fields":["first_name","last_name"],"type":"cross_fields","operator":"and"}}`, 1, "4"},
+		{`{"multi_match":{"query":"john smith","fields":["*_name"],"type":"cross_fields","minimum_should_match":"100%"}}`, 1, "4"},
+		{`{"multi_match":{"query":"john smith","fields":["first_name","last_name"],"operator":"and"}}`, 0, ""},
+		// phrase 按字段分别匹配短语
+		{`{"multi_match":{"query":"brown fox","fields":["title","summary"],"type":"phrase"}}`, 3, ""},
+		{`{"multi_match":{"query":"fox brown","fields":["title","summary"],"type":"phrase"}}`, 0, ""},
+		// lenient 跳过值类型不符的字段
+		{`{"multi_match":{"query":"fox","fields":["title","pages"],"lenient":true}}`, 2, ""},
+		{`{"multi_match":{"query":"20","fields":["title","pages"]}}`, 1, "2"},
+	} {
+		hits := search(tt.query)
+		if len(hits) != tt.expected {
+			t.Errorf("%s: expected %d hits, got %+v", tt.query, tt.expected, hits)
+			continue
+		}
+		if tt.top != "" && hits[0].ID != tt.top {
+			t.Errorf("%s: expected top hit %s, got %+v", tt.query, tt.top, hits)
+		}
+	}
+
+	// best_fields 取最高分，tie_breaker 累加其余字段的得分，most_fields 得分相加
+	score := func(q string) float64 {
+		t.Helper()
+		for _, h := range search(q) {
+			if h.ID == "2" {
+				return h.Score
+			}
+		}
+		t.Fatalf("%s: document 2 not found", q)
+		return 0
+	}
+	best := score(`{"multi_match":{"query":"brown","fields":["title","summary"]}}`)
+	tie := score(`{"multi_match":{"query":"brown","fields":["title","summary"],"tie_breaker":0.5}}`)
+	most := score(`{"multi_match":{"query":"brown","fields":["title","summary"],"type":"most_fields"}}`)
+	if !(best < tie && tie < most) {
+		t.Errorf("expected best_fields < tie_breaker < most_fields, got %v, %v, %v", best, tie, most)
+	}
+	disMax := score(`{"dis_max":{"queries":[{"match":{"title":"brown"}},{"match":{"summary":"brown"}}],"tie_breaker":0.5}}`)
+	if disMax != tie {
+		t.Errorf("expected dis_max score %v to equal multi_match score %v", disMax, tie)
+	}
+
+	for _, q := range []string{
+		`{"multi_match":{"query":"fox","fields":["title","pages"]}}`,
+		`{"multi_match":{"query":"fox","fields":["title"],"type":"unknown"}}`,
+		`{"multi_match":{"query":"fox","fields":["title^x"]}}`,
+	} {
+		if w := do("POST", "/books/_search", `{"query":`+q+`}`); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", q, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDocumentHandler_Search_Regexp(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/codes", `{"mappings":{"properties":{"code":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"codes","_id":"1"}}
+{"code":"ABC-123"}
+{"index":{"_index":"codes","_id":"2"}}
+{"code":"abc-456"}
+{"index":{"_index":"codes","_id":"3"}}
+{"code":"xyz@789"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	count := func(q string) int {
+		t.Helper()
+		w := do("POST", "/codes/_count", `{"query":`+q+`}`)
+		var resp struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", q, w.Code, w.Body.String())
+		}
+		return resp.Count
+	}
+	for _, tt := range []struct {
+		query    string
+		expected int
+	}{
+		{`{"regexp":{"code":"abc-[0-9]+"}}`, 1},
+		{`{"regexp":{"code":{"value":"abc-[0-9]+","case_insensitive":true}}}`, 2},
+		{`{"regexp":{"code":{"value":"abc-<100-500>"}}}`, 1},
+		{`{"regexp":{"code":{"value":"@<100-999>","flags":"INTERVAL|ANYSTRING"}}}`, 3},
+		// 未启用的运算符按普通字符匹配
+		{`{"regexp":{"code":{"value":"xyz@789","flags":"INTERVAL"}}}`, 1},
+		{`{"regexp":{"code":{"value":"xyz@","flags":"NONE"}}}`, 0},
+		{`{"regexp":{"code":{"value":"xyz@","flags":"ALL"}}}`, 1},
+		// ^ 与 $ 不是锚点
+		{`{"regexp":{"code":"^abc.*"}}`, 0},
+	} {
+		if got := count(tt.query); got != tt.expected {
+			t.Errorf("%s: expected %d documents, got %d", tt.query, tt.expected, got)
+		}
+	}
+
+	invalid := []struct {
+		query   string
+		message string
+	}{
+		{`{"regexp":{"code":{"value":"abc","flags":"BOGUS"}}}`, "Unknown regexp flag [BOGUS]"},
+		{`{"regexp":{"code":"@a[ab]{20}"}}`, "Determinizing automaton"},
+		{`{"regexp":{"code":{"value":"@a[ab]{5}","max_determinized_states":10}}}`, "more than 10 states"},
+		{`{"regexp":{"code":"a&b"}}`, "intersection operator"},
+	}
+	for _, tt := range invalid {
+		w := do("POST", "/codes/_search", `{"query":`+tt.query+`}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", tt.query, tt.message, w.Code, w.Body.String())
+		}
+	}
+
+	// index.max_regex_length 限制模式长度
+	if w := do("PUT", "/codes/_settings", `{"index":{"max_regex_length":-1}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid setting: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/codes/_settings", `{"index":{"max_regex_length":5}}`); w.Code != http.StatusOK {
+		t.Fatalf("update settings: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/codes/_search", `{"query":{"regexp":{"code":"abc-[0-9]+"}}}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "has exceeded the allowed maximum of [5]") {
+		t.Errorf("long regexp: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := count(`{"regexp":{"code":"abc.+"}}`); got != 1 {
+		t.Errorf("short regexp: expected 1 document, got %d", got)
+	}
+}
+
+func TestDocumentHandler_Search_TermsSet(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/jobs", `{"mappings":{"properties":{
+		"skills":{"type":"keyword"},
+		"required_matches":{"type":"long"}
+	}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"jobs","_id":"1"}}
+{"skills":["go","rust","sql"],"required_matches":2}
+{"index":{"_index":"jobs","_id":"2"}}
+{"skills":["go","java"],"required_matches":1}
+{"index":{"_index":"jobs","_id":"3"}}
+{"skills":["go","rust","sql","k8s"],"required_matches":4}
+{"index":{"_index":"jobs","_id":"4"}}
+{"skills":["rust","sql"]}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	search := func(q string) []string {
+		t.Helper()
+		w := do("POST", "/jobs/_search", `{"query":`+q+`}`)
+		var resp struct {
+			Hits struct {
+				Hits []struct {
+					ID string `json:"_id"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", q, w.Code, w.Body.String())
+		}
+		var ids []string
+		for _, hit := range resp.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	for _, tt := range []struct {
+		query    string
+		expected []string
+	}{
+		// 文档 3 要求 4 个词项，文档 4 没有 required_matches 字段
+		{`{"terms_set":{"skills":{"terms":["go","rust","sql"],"minimum_should_match_field":"required_matches"}}}`, []string{"1", "2"}},
+		{`{"terms_set":{"skills":{"terms":["go","rust","sql","k8s"],"minimum_should_match_field":"required_matches"}}}`, []string{"1", "2", "3"}},
+		{`{"terms_set":{"skills":{"terms":["java"],"minimum_should_match_field":"required_matches"}}}`, []string{"2"}},
+		{`{"terms_set":{"skills":{"terms":["go","java"],
+			"minimum_should_match_script":{"source":"Math.min(params.num_terms, doc['required_matches'].value)"}}}}`, []string{"2"}},
+		{`{"terms_set":{"skills":{"terms":["go","rust","sql","k8s"],
+			"minimum_should_match_script":{"source":"params.num_terms - params.slack","params":{"slack":2}}}}}`, []string{"1", "3", "4"}},
+		{`{"terms_set":{"skills":{"terms":["rust","sql"],"minimum_should_match":"100%"}}}`, []string{"1", "3", "4"}},
+	} {
+		if got := search(tt.query); fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.expected, got)
+		}
+	}
+
+	invalid := []struct {
+		query   string
+		message string
+	}{
+		{`{"terms_set":{"skills":{"terms":["go"]}}}`, "no minimum should match has been specified"},
+		{`{"terms_set":{"skills":{"terms":["go"],"minimum_should_match_field":"required_matches","minimum_should_match":1}}}`, "only one of"},
+		{`{"terms_set":{"skills":{"terms":["go"],"minimum_should_match_field":"required_matches","operator":"and"}}}`, "does not support [operator]"},
+	}
+	for _, tt := range invalid {
+		w := do("POST", "/jobs/_search", `{"query":`+tt.query+`}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", tt.query, tt.message, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDocumentHandler_Search_Pinned(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/products", `{"mappings":{"properties":{"name":{"type":"text"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"products","_id":"1"}}
+{"name":"running shoes"}
+{"index":{"_index":"products","_id":"2"}}
+{"name":"running shoes running socks"}
+{"index":{"_index":"products","_id":"3"}}
+{"name":"sponsored water bottle"}
+{"index":{"_index":"products","_id":"4"}}
+{"name":"hiking boots"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	search := func(q string) []string {
+		t.Helper()
+		w := do("POST", "/products/_search", `{"query":`+q+`}`)
+		var resp struct {
+			Hits struct {
+				Hits []struct {
+					ID string `json:"_id"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", q, w.Code, w.Body.String())
+		}
+		var ids []string
+		for _, hit := range resp.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return ids
+	}
+	for _, tt := range []struct {
+		query    string
+		expected []string
+	}{
+		{`{"match":{"name":"running"}}`, []string{"2", "1"}},
+		// 置顶文档按给出的顺序排在最前，不存在的文档被忽略，不匹配 organic 的文档也会返回
+		{`{"pinned":{"ids":["3","missing","1"],"organic":{"match":{"name":"running"}}}}`, []string{"3", "1", "2"}},
+		{`{"pinned":{"docs":[{"_index":"products","_id":"4"}],"organic":{"match":{"name":"running"}}}}`, []string{"4", "2", "1"}},
+		{`{"pinned":{"ids":[],"organic":{"match":{"name":"running"}}}}`, []string{"2", "1"}},
+	} {
+		if got := search(tt.query); fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.expected, got)
+		}
+	}
+
+	tooMany := make([]string, 101)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("%q", fmt.Sprint(i))
+	}
+	invalid := []struct {
+		query   string
+		message string
+	}{
+		{`{"pinned":{"ids":["1"],"docs":[{"_id":"2"}],"organic":{"match_all":{}}}}`, "Cannot specify both [ids] and [docs]"},
+		{`{"pinned":{"ids":[` + strings.Join(tooMany, ",") + `],"organic":{"match_all":{}}}}`, "Max of 100 ids exceeded"},
+		{`{"pinned":{"ids":["1"],"organic":{"match_all":{}},"rank":1}}`, "does not support [rank]"},
+	}
+	for _, tt := range invalid {
+		w := do("POST", "/products/_search", `{"query":`+tt.query+`}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", tt.query, tt.message, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDocumentHandler_Search_DistanceFeature(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/places", `{"mappings":{"properties":{
+		"name":{"type":"text"},
+		"opened":{"type":"date"},
+		"location":{"type":"geo_point"}
+	}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"places","_id":"1"}}
+{"name":"coffee shop","opened":"2024-01-10","location":{"lat":52.370,"lon":4.895}}
+{"index":{"_index":"places","_id":"2"}}
+{"name":"coffee bar","opened":"2024-01-08","location":{"lat":52.380,"lon":4.900}}
+{"index":{"_index":"places","_id":"3"}}
+{"name":"coffee roastery","opened":"2023-06-01","location":{"lat":51.920,"lon":4.480}}
+{"index":{"_index":"places","_id":"4"}}
+{"name":"tea house"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	type hit struct {
+		ID    string  `json:"_id"`
+		Score float64 `json:"_score"`
+	}
+	search := func(q string) []hit {
+		t.Helper()
+		w := do("POST", "/places/_search", `{"query":`+q+`}`)
+		var resp struct {
+			Hits struct {
+				Hits []hit `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", q, w.Code, w.Body.String())
+		}
+		return resp.Hits.Hits
+	}
+	ids := func(hits []hit) string {
+		var rv []string
+		for _, h := range hits {
+			rv = append(rv, h.ID)
+		}
+		return strings.Join(rv, ",")
+	}
+
+	// 得分为 pivot / (pivot + distance)，没有字段值的文档不匹配
+	hits := search(`{"distance_feature":{"field":"opened","origin":"2024-01-10","pivot":"2d"}}`)
+	if got := ids(hits); got != "1,2,3" {
+		t.Fatalf("date: expected 1,2,3, got %s", got)
+	}
+	if math.Abs(hits[0].Score-1) > 1e-6 || math.Abs(hits[1].Score-0.5) > 1e-6 {
+		t.Errorf("date: unexpected scores %+v", hits)
+	}
+
+	hits = search(`{"distance_feature":{"field":"location","origin":"52.380,4.900","pivot":"1km","boost":2}}`)
+	if got := ids(hits); got != "2,1,3" {
+		t.Fatalf("geo: expected 2,1,3, got %s", got)
+	}
+	if math.Abs(hits[0].Score-2) > 1e-3 || hits[1].Score >= 1 {
+		t.Errorf("geo: unexpected scores %+v", hits)
+	}
+
+	// 作为 should 子句为匹配 must 的结果加上新鲜度得分
+	hits = search(`{"bool":{"must":{"match":{"name":"coffee"}},
+		"should":{"distance_feature":{"field":"opened","origin":"2023-06-01","pivot":"7d"}}}}`)
+	if got := ids(hits); !strings.HasPrefix(got, "3,") || len(hits) != 3 {
+		t.Errorf("should: expected the roastery first, got %s", got)
+	}
+
+	invalid := []struct {
+		query   string
+		message string
+	}{
+		{`{"distance_feature":{"field":"opened","origin":"now"}}`, "required field [pivot] is missing"},
+		{`{"distance_feature":{"field":"name","origin":"now","pivot":"1d"}}`, "of type [text] is not supported"},
+		{`{"distance_feature":{"field":"opened","origin":"now","pivot":"1x"}}`, "failed to parse [1x] as a time value"},
+		{`{"distance_feature":{"field":"location","origin":true,"pivot":"1km"}}`, "as a geo point"},
+	}
+	for _, tt := range invalid {
+		w := do("POST", "/places/_search", `{"query":`+tt.query+`}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", tt.query, tt.message, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDocumentHandler_Search_WrapperAndRawBleve(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/notes", `{"mappings":{"properties":{"title":{"type":"text"},"status":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"notes","_id":"1"}}
+{"title":"quarterly report","status":"draft"}
+{"index":{"_index":"notes","_id":"2"}}
+{"title":"annual report","status":"published"}
+{"index":{"_index":"notes","_id":"3"}}
+{"title":"meeting notes","status":"published"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	count := func(q string) int {
+		t.Helper()
+		w := do("POST", "/notes/_count", `{"query":`+q+`}`)
+		var resp struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", q, w.Code, w.Body.String())
+		}
+		return resp.Count
+	}
+	wrapped := base64.StdEncoding.EncodeToString([]byte(`{"term":{"status":"published"}}`))
+	unpadded := base64.RawURLEncoding.EncodeToString([]byte(`{"match":{"title":"report"}}`))
+	for _, tt := range []struct {
+		query    string
+		expected int
+	}{
+		{`{"wrapper":{"query":"` + wrapped + `"}}`, 2},
+		{`{"wrapper":{"query":"` + unpadded + `"}}`, 2},
+		{`{"bool":{"filter":{"wrapper":{"query":"` + wrapped + `"}},"must":{"match":{"title":"report"}}}}`, 1},
+		// 原样解析的 bleve 查询
+		{`{"x_bleve":{"match":"reprot","field":"title","fuzziness":1}}`, 2},
+		{`{"x_bleve":{"query":"+status:published -title:annual"}}`, 1},
+		{`{"x_bleve":{"disjuncts":[{"term":"draft","field":"status"},{"prefix":"meet","field":"title"}],"min":1}}`, 2},
+		{`{"bool":{"must":{"x_bleve":{"term":"published","field":"status"}},"must_not":{"match":{"title":"annual"}}}}`, 1},
+	} {
+		if got := count(tt.query); got != tt.expected {
+			t.Errorf("%s: expected %d documents, got %d", tt.query, tt.expected, got)
+		}
+	}
+
+	invalid := []struct {
+		query   string
+		message string
+	}{
+		{`{"wrapper":{"query":"not base64!"}}`, "failed to decode base64 query"},
+		{`{"wrapper":{"query":"` + base64.StdEncoding.EncodeToString([]byte(`{"term":{"status":"a"},"match_all":{}}`)) + `"}}`, "expected a single query"},
+		{`{"x_bleve":{"bogus":1}}`, "[x_bleve] failed to parse bleve query"},
+		{`{"x_bleve":{"disjuncts":[{"term":"draft","field":"status"}],"min":5}}`, "[x_bleve] invalid bleve query"},
+	}
+	for _, tt := range invalid {
+		w := do("POST", "/notes/_search", `{"query":`+tt.query+`}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", tt.query, tt.message, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDocumentHandler_Search_IndicesBoost(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	r := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/news-2024", `{"aliases":{"news-current":{}},"mappings":{"properties":{"title":{"type":"text"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"news-2024","_id":"1"}}
+{"title":"election results"}
+{"index":{"_index":"news-2024","_id":"2"}}
+{"title":"election night coverage and results"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	type searchResponse struct {
+		Hits struct {
+			MaxScore float64 `json:"max_score"`
+			Hits     []struct {
+				ID    string  `json:"_id"`
+				Score float64 `json:"_score"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	search := func(target, extra string) searchResponse {
+		t.Helper()
+		w := do("POST", "/"+target+"/_search", `{"query":{"match":{"title":"election"}}`+extra+`}`)
+		var resp searchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", extra, w.Code, w.Body.String())
+		}
+		return resp
+	}
+
+	base := search("news-2024", "")
+	if len(base.Hits.Hits) != 2 {
+		t.Fatalf("expected 2 hits, got %+v", base)
+	}
+	for _, tt := range []struct {
+		target string
+		boost  string
+		factor float64
+	}{
+		{"news-2024", `,"indices_boost":[{"news-2024":3}]`, 3},
+		// 第一条匹配的表达式生效：别名与通配符
+		{"news-2024", `,"indices_boost":[{"archive":5},{"news-current":2},{"news-*":4}]`, 2},
+		{"news-current", `,"indices_boost":[{"news-*":1.5},{"news-2024":3}]`, 1.5},
+		{"news-2024", `,"indices_boost":{"news-2024":0.5}`, 0.5},
+		{"news-2024", `,"indices_boost":[{"archive":5}]`, 1},
+	} {
+		resp := search(tt.target, tt.boost)
+		if math.Abs(resp.Hits.MaxScore-base.Hits.MaxScore*tt.factor) > 1e-9 {
+			t.Errorf("%s: expected max_score %v, got %v", tt.boost, base.Hits.MaxScore*tt.factor, resp.Hits.MaxScore)
+		}
+		for i, hit := range resp.Hits.Hits {
+			if hit.ID != base.Hits.Hits[i].ID || math.Abs(hit.Score-base.Hits.Hits[i].Score*tt.factor) > 1e-9 {
+				t.Errorf("%s: hit %d: expected %s with score %v, got %+v", tt.boost, i, base.Hits.Hits[i].ID, base.Hits.Hits[i].Score*tt.factor, hit)
+			}
+		}
+	}
+
+	// min_score 按加权后的得分过滤
+	minScore := base.Hits.Hits[1].Score * 2.5
+	resp := search("news-2024", fmt.Sprintf(`,"min_score":%v,"indices_boost":[{"news-2024":3}]`, minScore))
+	if len(resp.Hits.Hits) != 2 {
+		t.Errorf("min_score: expected both boosted hits, got %+v", resp.Hits.Hits)
+	}
+
+	for _, body := range []string{
+		`{"indices_boost":[{"news-2024":"high"}]}`,
+		`{"indices_boost":[{"a":1,"b":2}]}`,
+		`{"indices_boost":"news-2024"}`,
+	} {
+		if w := do("POST", "/news-2024/_search", body); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "[indices_boost]") {
+			t.Errorf("%s: expected 400, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+}
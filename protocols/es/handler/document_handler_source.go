@@ -0,0 +1,314 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// sourceFilter URL 参数中的 _source 过滤（_source、_source_includes、_source_excludes）
+// 模式支持 * 通配符与点号分隔的路径，包含对象时包含其全部子字段
+type sourceFilter struct {
+	fetch    bool // _source=false 时不返回 _source
+	explicit bool // 请求中显式指定了 _source 相关参数
+	includes []string
+	excludes []string
+}
+
+// parseSourceFilter 解析 _source、_source_includes 与 _source_excludes 参数
+// _source 可以是 true/false 或逗号分隔的包含字段列表
+func parseSourceFilter(query url.Values) *sourceFilter {
+	f := &sourceFilter{fetch: true}
+	if values, ok := query["_source"]; ok {
+		f.explicit = true
+		if fetch, err := strconv.ParseBool(values[0]); err == nil {
+			f.fetch = fetch
+		} else if values[0] != "" {
+			f.includes = splitCommaList(values[0])
+		}
+	}
+	if v := query.Get("_source_includes"); v != "" {
+		f.explicit = true
+		f.includes = append(f.includes, splitCommaList(v)...)
+	}
+	if v := query.Get("_source_excludes"); v != "" {
+		f.explicit = true
+		f.excludes = append(f.excludes, splitCommaList(v)...)
+	}
+	return f
+}
+
+// apply 返回过滤后的 _source，不修改原文档
+func (f *sourceFilter) apply(source map[string]interface{}) map[string]interface{} {
+	if len(f.includes) == 0 && len(f.excludes) == 0 {
+		return source
+	}
+	return f.filterObject(source, "", len(f.includes) == 0)
+}
+
+// filterObject 过滤对象的字段，included 表示所在路径已被包含
+func (f *sourceFilter) filterObject(obj map[string]interface{}, prefix string, included bool) map[string]interface{} {
+	rv := make(map[string]interface{})
+	for key, value := range obj {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if matchesAnyPattern(f.excludes, path) {
+			continue
+		}
+		fieldIncluded := included || matchesAnyPattern(f.includes, path)
+		if !fieldIncluded && !f.mayIncludeChildren(path) {
+			continue
+		}
+		if filtered, keep := f.filterValue(value, path, fieldIncluded); keep {
+			rv[key] = filtered
+		}
+	}
+	return rv
+}
+
+// filterValue 过滤字段值：对象与对象数组递归过滤，未被包含的标量丢弃
+func (f *sourceFilter) filterValue(value interface{}, path string, included bool) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		filtered := f.filterObject(v, path, included)
+		return filtered, included || len(filtered) > 0
+	case []interface{}:
+		filtered := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			if elemValue, keep := f.filterValue(elem, path, included); keep {
+				filtered = append(filtered, elemValue)
+			}
+		}
+		return filtered, included || len(filtered) > 0
+	default:
+		return value, included
+	}
+}
+
+// mayIncludeChildren 是否有包含模式可能匹配该路径下的子字段
+func (f *sourceFilter) mayIncludeChildren(path string) bool {
+	for _, pattern := range f.includes {
+		literal := pattern
+		if i := strings.Index(pattern, "*"); i >= 0 {
+			literal = pattern[:i]
+		}
+		if strings.HasPrefix(literal, path+".") || (strings.Contains(pattern, "*") && strings.HasPrefix(path+".", literal)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyPattern 路径或其任一父路径是否匹配任一通配符模式
+// 未存储原始 _source 的文档以扁平化的 "a.b" 键返回对象字段，匹配父路径使模式 "a" 同样覆盖这些键
+func matchesAnyPattern(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		for p := path; ; {
+			if simpleWildcardMatch(pattern, p) {
+				return true
+			}
+			i := strings.LastIndex(p, ".")
+			if i < 0 {
+				break
+			}
+			p = p[:i]
+		}
+	}
+	return false
+}
+
+// sourceEnabled 索引 mapping 是否启用了 _source（"_source": {"enabled": false} 时禁用）
+func sourceEnabled(metaStore metadata.MetadataStore, indexName string) bool {
+	indexMeta, err := metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return true
+	}
+	def, ok := indexMeta.Mapping["_source"].(map[string]interface{})
+	if !ok {
+		return true
+	}
+	enabled, ok := def["enabled"].(bool)
+	return !ok || enabled
+}
+
+// storedFieldValues 返回 stored_fields 中 mapping 设置了 store: true 的字段值（ES 格式为数组）
+func storedFieldValues(metaStore metadata.MetadataStore, indexName string, source map[string]interface{}, storedFields []string) map[string]interface{} {
+	stored := make(map[string]bool)
+	if indexMeta, err := metaStore.GetIndexMetadata(indexName); err == nil && indexMeta != nil {
+		if props, ok := indexMeta.Mapping["properties"].(map[string]interface{}); ok {
+			collectStoredFields(props, "", stored)
+		}
+	}
+	rv := make(map[string]interface{})
+	for field := range stored {
+		if !matchesAnyPattern(storedFields, field) {
+			continue
+		}
+		if values := sourceValuesAt(source, field); len(values) > 0 {
+			rv[field] = values
+		}
+	}
+	return rv
+}
+
+// collectStoredFields 递归收集 mapping 中 store: true 的字段
+func collectStoredFields(props map[string]interface{}, prefix string, stored map[string]bool) {
+	for name, def := range props {
+		fieldMap, ok := def.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fullName := name
+		if prefix != "" {
+			fullName = prefix + "." + name
+		}
+		if store, _ := fieldMap["store"].(bool); store {
+			stored[fullName] = true
+		}
+		if sub, ok := fieldMap["properties"].(map[string]interface{}); ok {
+			collectStoredFields(sub, fullName, stored)
+		}
+	}
+}
+
+// sourceValuesAt 按点号路径读取 _source 中的值，数组展开为多个值
+func sourceValuesAt(source map[string]interface{}, path string) []interface{} {
+	var rv []interface{}
+	var visit func(value interface{}, parts []string)
+	visit = func(value interface{}, parts []string) {
+		if values, ok := value.([]interface{}); ok {
+			for _, v := range values {
+				visit(v, parts)
+			}
+			return
+		}
+		if len(parts) == 0 {
+			if value != nil {
+				rv = append(rv, value)
+			}
+			return
+		}
+		if obj, ok := value.(map[string]interface{}); ok {
+			// 同时匹配嵌套对象与扁平化的 "a.b" 键
+			for i := 1; i <= len(parts); i++ {
+				if v, exists := obj[strings.Join(parts[:i], ".")]; exists {
+					visit(v, parts[i:])
+				}
+			}
+		}
+	}
+	visit(source, strings.Split(path, "."))
+	return rv
+}
+
+// newResourceNotFoundError 资源不存在错误（_source 接口文档或源文档不存在）
+func newResourceNotFoundError(message string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "resource_not_found_exception",
+		Message:    message,
+		HTTPStatus: http.StatusNotFound,
+		Code:       "RESOURCE_NOT_FOUND",
+	}
+}
+
+// GetSource 只返回文档的 _source
+// GET /{index}/_source/{id}
+func (h *DocumentHandler) GetSource(w http.ResponseWriter, r *http.Request) {
+	source, apiErr := h.loadSource(r)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(source); err != nil {
+		logger.Error("Failed to encode source response: %v", err)
+	}
+}
+
+// HeadSource 检查文档的 _source 是否存在
+// HEAD /{index}/_source/{id}
+func (h *DocumentHandler) HeadSource(w http.ResponseWriter, r *http.Request) {
+	if _, apiErr := h.loadSource(r); apiErr != nil {
+		w.WriteHeader(apiErr.StatusCode())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// loadSource 读取请求的文档 _source 并按参数过滤，文档不存在或 _source 被禁用时返回 404
+func (h *DocumentHandler) loadSource(r *http.Request) (map[string]interface{}, common.APIError) {
+	indexName := mux.Vars(r)["index"]
+	docID := mux.Vars(r)["id"]
+
+	if err := common.ValidateIndexName(indexName); err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+	if err := common.ValidateDocumentID(docID); err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+	if !h.dirMgr.IndexExists(indexName) {
+		return nil, common.NewIndexNotFoundError(indexName)
+	}
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelRead); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := checkRouting(h.metaStore, indexName, docID, requestRouting(r)); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := h.refreshBeforeGet(r, indexName); apiErr != nil {
+		return nil, apiErr
+	}
+
+	idx, err := h.indexMgr.GetIndex(indexName)
+	if err != nil {
+		logger.Error("Failed to get index [%s]: %v", indexName, err)
+		return nil, common.NewInternalServerError("failed to get index: " + err.Error())
+	}
+	access := requestIndexAccess(r.Context(), indexName)
+	doc, err := idx.Document(docID)
+	if err != nil || doc == nil || !h.documentVisible(idx, indexName, access, docID) {
+		return nil, newResourceNotFoundError(fmt.Sprintf("Document not found [%s]/[_doc]/[%s]", indexName, docID))
+	}
+	if !sourceEnabled(h.metaStore, indexName) {
+		return nil, newResourceNotFoundError(fmt.Sprintf("Source not found [%s]/[_doc]/[%s]", indexName, docID))
+	}
+	return parseSourceFilter(r.URL.Query()).apply(access.FilterSource(h.extractDocumentFields(doc))), nil
+}
+
+// refreshBeforeGet 处理 get 的 refresh 参数：读取前刷新索引
+// 写入在批次引入后即对读可见，get 始终是实时的，realtime 参数无需处理
+func (h *DocumentHandler) refreshBeforeGet(r *http.Request, indexName string) common.APIError {
+	if !refreshRequested(r) {
+		return nil
+	}
+	if err := h.indexMgr.RefreshIndex(indexName); err != nil {
+		return common.NewInternalServerError("failed to refresh index: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_GetSource(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "GET", Path: "/{index}/_source/{id}", Handler: docHandler.GetSource},
+		{Method: "HEAD", Path: "/{index}/_source/{id}", Handler: docHandler.HeadSource},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		t.Helper()
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+		return body
+	}
+	expectJSON := func(name string, got interface{}, expected string) {
+		t.Helper()
+		var want interface{}
+		if err := json.Unmarshal([]byte(expected), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			gotJSON, _ := json.Marshal(got)
+			t.Errorf("%s: expected %s, got %s", name, expected, gotJSON)
+		}
+	}
+
+	if w := do("PUT", "/books", `{"mappings":{"properties":{
+		"title":{"type":"text","store":true},
+		"author":{"properties":{"name":{"type":"keyword","store":true},"born":{"type":"integer"}}},
+		"tags":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	doc := `{"title":"Dune","author":{"name":"Herbert","born":1920},"tags":["scifi","classic"]}`
+	if w := do("PUT", "/books/_doc/1", doc); w.Code != http.StatusCreated {
+		t.Fatalf("index: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 未存储原始 _source 时对象字段以扁平化的键返回
+	flat := `{"title":"Dune","author.name":"Herbert","author.born":1920,"tags":["scifi","classic"]}`
+	sources := []struct {
+		query    string
+		expected string
+	}{
+		{"", flat},
+		{"?_source_includes=author.*", `{"author.name":"Herbert","author.born":1920}`},
+		{"?_source_includes=author&_source_excludes=author.born", `{"author.name":"Herbert"}`},
+		{"?_source=title,tags", `{"title":"Dune","tags":["scifi","classic"]}`},
+		{"?_source_excludes=t*&refresh=true&realtime=false", `{"author.name":"Herbert","author.born":1920}`},
+	}
+	for _, tt := range sources {
+		w := do("GET", "/books/_source/1"+tt.query, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("_source%s: got %d: %s", tt.query, w.Code, w.Body.String())
+			continue
+		}
+		expectJSON("_source"+tt.query, decode(w), tt.expected)
+	}
+
+	if w := do("HEAD", "/books/_source/1", ""); w.Code != http.StatusOK {
+		t.Errorf("head source: expected 200, got %d", w.Code)
+	}
+	if w := do("HEAD", "/books/_source/2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("head missing source: expected 404, got %d", w.Code)
+	}
+	if w := do("GET", "/books/_source/2", ""); w.Code != http.StatusNotFound ||
+		!strings.Contains(w.Body.String(), "Document not found [books]/[_doc]/[2]") {
+		t.Errorf("missing source: expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// get 的 _source 过滤与 stored_fields
+	gets := []struct {
+		query  string
+		source string // 空表示响应中没有 _source
+		fields string
+	}{
+		{"?_source=false", "", ""},
+		{"?_source_includes=title", `{"title":"Dune"}`, ""},
+		{"?stored_fields=title,tags,author.name", "", `{"title":["Dune"],"author.name":["Herbert"]}`},
+		{"?stored_fields=*&_source_excludes=author", `{"title":"Dune","tags":["scifi","classic"]}`, `{"title":["Dune"],"author.name":["Herbert"]}`},
+		{"?stored_fields=_none_", "", ""},
+	}
+	for _, tt := range gets {
+		w := do("GET", "/books/_doc/1"+tt.query, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("get%s: got %d: %s", tt.query, w.Code, w.Body.String())
+			continue
+		}
+		got := decode(w)
+		if source, ok := got["_source"]; tt.source == "" && ok {
+			t.Errorf("get%s: unexpected _source %v", tt.query, source)
+		} else if tt.source != "" {
+			expectJSON("get"+tt.query+" _source", source, tt.source)
+		}
+		if fields, ok := got["fields"]; tt.fields == "" && ok {
+			t.Errorf("get%s: unexpected fields %v", tt.query, fields)
+		} else if tt.fields != "" {
+			expectJSON("get"+tt.query+" fields", fields, tt.fields)
+		}
+	}
+
+	// 禁用 _source 的索引
+	if w := do("PUT", "/nosource", `{"mappings":{"_source":{"enabled":false},"properties":{"msg":{"type":"text"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/nosource/_doc/1", `{"msg":"hello"}`); w.Code != http.StatusCreated {
+		t.Fatalf("index: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/nosource/_source/1", ""); w.Code != http.StatusNotFound ||
+		!strings.Contains(w.Body.String(), "Source not found [nosource]/[_doc]/[1]") {
+		t.Errorf("disabled source: expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := decode(do("GET", "/nosource/_doc/1", "")); got["found"] != true || got["_source"] != nil {
+		t.Errorf("disabled source: unexpected get response %v", got)
+	}
+}
+
+func TestSourceFilter_Nested(t *testing.T) {
+	source := map[string]interface{}{
+		"title": "Dune",
+		"author": map[string]interface{}{
+			"name": "Herbert",
+			"born": 1920.0,
+		},
+		"editions": []interface{}{
+			map[string]interface{}{"year": 1965.0, "publisher": "Chilton"},
+			map[string]interface{}{"year": 1984.0},
+		},
+	}
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"_source_includes=author", `{"author":{"name":"Herbert","born":1920}}`},
+		{"_source_includes=author.na*", `{"author":{"name":"Herbert"}}`},
+		{"_source_excludes=author.born,editions.year", `{"title":"Dune","author":{"name":"Herbert"},"editions":[{"publisher":"Chilton"},{}]}`},
+		{"_source=editions.publisher", `{"editions":[{"publisher":"Chilton"}]}`},
+		{"_source=*.year", `{"editions":[{"year":1965},{"year":1984}]}`},
+	}
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := json.Marshal(parseSourceFilter(query).apply(source))
+		var gotValue, expectedValue interface{}
+		_ = json.Unmarshal(got, &gotValue)
+		_ = json.Unmarshal([]byte(tt.expected), &expectedValue)
+		if !reflect.DeepEqual(gotValue, expectedValue) {
+			t.Errorf("%s: expected %s, got %s", tt.query, tt.expected, got)
+		}
+	}
+}
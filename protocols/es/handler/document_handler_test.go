@@ -28,6 +28,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/lscgzwd/tiggerdb/directory"
 	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
 	esIndex "github.com/lscgzwd/tiggerdb/protocols/es/index"
 )
 
@@ -547,3 +548,86 @@ func TestDocumentHandler(t *testing.T) {
 
 	t.Log("Document handler basic test completed")
 }
+
+func TestDocumentWriteResponseFields(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "DELETE", Path: "/{index}/_doc/{id}", Handler: docHandler.DeleteDocument},
+		{Method: "POST", Path: "/{index}/_update/{id}", Handler: docHandler.UpdateDocument},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: decode response %q: %v", method, path, w.Body.String(), err)
+		}
+		return w.Code, resp
+	}
+	checkWrite := func(name string, resp map[string]interface{}, result string, version float64, successful float64) float64 {
+		t.Helper()
+		if resp["_index"] != "logs" || resp["_type"] != "_doc" || resp["_id"] != "1" {
+			t.Errorf("%s: unexpected identity fields: %v", name, resp)
+		}
+		if resp["result"] != result || resp["_version"] != version {
+			t.Errorf("%s: expected result=%s _version=%v, got %v", name, result, version, resp)
+		}
+		if _, ok := resp["acknowledged"]; ok {
+			t.Errorf("%s: write response should not contain acknowledged: %v", name, resp)
+		}
+		shards, _ := resp["_shards"].(map[string]interface{})
+		if shards == nil || shards["total"] != successful || shards["successful"] != successful || shards["failed"] != 0.0 {
+			t.Errorf("%s: unexpected _shards: %v", name, resp["_shards"])
+		}
+		seqNo, ok := resp["_seq_no"].(float64)
+		if !ok || resp["_primary_term"] != 1.0 {
+			t.Errorf("%s: missing _seq_no/_primary_term: %v", name, resp)
+		}
+		return seqNo
+	}
+
+	if code, _ := do("PUT", "/logs", `{}`); code != http.StatusOK {
+		t.Fatalf("create index: got %d", code)
+	}
+
+	code, resp := do("PUT", "/logs/_doc/1?refresh=true", `{"msg":"a"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("index: expected 201 got %d", code)
+	}
+	seq1 := checkWrite("create", resp, "created", 1, 1)
+	if resp["forced_refresh"] != true {
+		t.Errorf("create with refresh=true: expected forced_refresh, got %v", resp)
+	}
+
+	_, resp = do("POST", "/logs/_update/1", `{"doc":{"msg":"b"}}`)
+	seq2 := checkWrite("update", resp, "updated", 2, 1)
+	if seq2 <= seq1 {
+		t.Errorf("update: expected _seq_no greater than %v, got %v", seq1, seq2)
+	}
+
+	_, resp = do("POST", "/logs/_update/1", `{"doc":{"msg":"b"}}`)
+	if seq := checkWrite("noop update", resp, "noop", 2, 0); seq != seq2 {
+		t.Errorf("noop update: expected _seq_no %v, got %v", seq2, seq)
+	}
+
+	code, resp = do("GET", "/logs/_doc/1", "")
+	if code != http.StatusOK || resp["found"] != true || resp["_type"] != "_doc" || resp["_version"] != 2.0 || resp["_seq_no"] != seq2 {
+		t.Errorf("get: unexpected response %d %v", code, resp)
+	}
+
+	_, resp = do("DELETE", "/logs/_doc/1", "")
+	if seq := checkWrite("delete", resp, "deleted", 3, 1); seq <= seq2 {
+		t.Errorf("delete: expected _seq_no greater than %v, got %v", seq2, seq)
+	}
+
+	_, resp = do("DELETE", "/logs/_doc/1", "")
+	checkWrite("delete missing", resp, "not_found", 1, 1)
+}
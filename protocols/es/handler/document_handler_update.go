@@ -0,0 +1,372 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/script"
+)
+
+// Update API 的 upsert 与 noop 语义
+// 文档不存在时：doc_as_upsert 以 doc 创建文档，否则使用 upsert 文档；scripted_upsert 为 true 时
+// 先以 upsert 文档为 ctx._source 执行脚本再创建。文档存在时 doc 递归合并到现有文档，
+// detect_noop（默认开启）下合并不改变文档时返回 noop；脚本通过 ctx.op 设置 noop/none 或 delete。
+// 写入前在文档锁内校验读取时的版本，期间被并发修改时返回版本冲突，retry_on_conflict 控制重试次数
+
+// updateRequestFields update 请求体中的保留字段，未提供 doc 时其余字段作为部分文档
+var updateRequestFields = map[string]bool{
+	"doc":             true,
+	"doc_as_upsert":   true,
+	"upsert":          true,
+	"scripted_upsert": true,
+	"detect_noop":     true,
+	"script":          true,
+	"_source":         true,
+}
+
+// versionConflictType 版本冲突错误类型，update 在 retry_on_conflict 次数内重试
+const versionConflictType = "version_conflict_engine_exception"
+
+// 脚本更新的 ctx.op 取值
+const (
+	updateOpIndex  = "index"
+	updateOpCreate = "create"
+	updateOpNoop   = "noop"
+	updateOpNone   = "none"
+	updateOpDelete = "delete"
+)
+
+// parseUpdateDoc 返回请求体中的部分文档，未提供 doc 时使用除保留字段外的请求体
+func parseUpdateDoc(requestBody map[string]interface{}) (map[string]interface{}, common.APIError) {
+	if v, ok := requestBody["doc"]; ok {
+		if _, hasScript := requestBody["script"]; hasScript {
+			return nil, newUpdateValidationError("can't provide both script and doc")
+		}
+		doc, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, common.NewBadRequestError("[doc] must be an object")
+		}
+		return doc, nil
+	}
+	if _, ok := requestBody["script"]; ok {
+		return nil, nil
+	}
+	doc := make(map[string]interface{})
+	for k, v := range requestBody {
+		if !updateRequestFields[k] {
+			doc[k] = v
+		}
+	}
+	return doc, nil
+}
+
+// newUpdateValidationError update 请求校验错误
+func newUpdateValidationError(message string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "action_request_validation_exception",
+		Message:    "Validation Failed: 1: " + message + ";",
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "UPDATE_VALIDATION_ERROR",
+	}
+}
+
+// upsertSource 返回文档不存在时用于创建的文档，未提供 upsert 且未设置 doc_as_upsert 时返回 nil
+func upsertSource(requestBody map[string]interface{}, updateDoc map[string]interface{}) (map[string]interface{}, common.APIError) {
+	if docAsUpsert, _ := requestBody["doc_as_upsert"].(bool); docAsUpsert && updateDoc != nil {
+		return updateDoc, nil
+	}
+	v, ok := requestBody["upsert"]
+	if !ok {
+		return nil, nil
+	}
+	upsert, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, common.NewBadRequestError("[upsert] must be an object")
+	}
+	return upsert, nil
+}
+
+// runUpdateScript 以 source 为 ctx._source 执行更新脚本，返回执行后的 _source 与脚本设置的 ctx.op
+// 脚本未设置 ctx.op（或设置为 index/create）时返回 defaultOp，none 视为 noop
+func runUpdateScript(scriptData interface{}, source map[string]interface{}, defaultOp string) (map[string]interface{}, string, common.APIError) {
+	s, err := script.ParseScript(scriptData)
+	if err != nil {
+		logger.Error("Failed to parse update script: %v", err)
+		return nil, "", common.NewBadRequestError("failed to parse script: " + err.Error())
+	}
+
+	engine := script.NewEngine()
+	ctx := script.NewContext(source, source, s.Params)
+	ctx.Ctx["op"] = defaultOp
+	if _, err := engine.Execute(s, ctx); err != nil {
+		logger.Error("Failed to execute update script: %v", err)
+		if script.IsScriptException(err) {
+			return nil, "", common.NewScriptException(err.Error())
+		}
+		return nil, "", common.NewBadRequestError("failed to execute script: " + err.Error())
+	}
+
+	op, _ := ctx.Ctx["op"].(string)
+	switch op {
+	case updateOpIndex, updateOpCreate:
+		return ctx.Source, defaultOp, nil
+	case updateOpNoop, updateOpNone:
+		return ctx.Source, updateOpNoop, nil
+	case updateOpDelete:
+		return ctx.Source, updateOpDelete, nil
+	}
+	return nil, "", common.NewBadRequestError(fmt.Sprintf("Operation type [%v] not allowed, only [%s, %s, %s] are allowed",
+		ctx.Ctx["op"], updateOpNoop, updateOpIndex, updateOpDelete))
+}
+
+// mergeUpdateDoc 把部分文档递归合并到现有文档（对象字段逐层合并，其余值直接替换），返回文档是否改变
+func mergeUpdateDoc(existing, update map[string]interface{}) bool {
+	changed := false
+	for k, v := range update {
+		current, ok := existing[k]
+		if currentObj, isObj := current.(map[string]interface{}); ok && isObj {
+			if updateObj, isObj := v.(map[string]interface{}); isObj {
+				if mergeUpdateDoc(currentObj, updateObj) {
+					changed = true
+				}
+				continue
+			}
+		}
+		if !ok || !reflect.DeepEqual(current, v) {
+			existing[k] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// updateOutcome 一次 update 请求的结果
+type updateOutcome struct {
+	result  string // created、updated、noop 或 deleted
+	version *DocumentVersion
+	status  int
+}
+
+// parseRetryOnConflict 解析 retry_on_conflict 参数，未设置时为 0
+func parseRetryOnConflict(value string) (int, common.APIError) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, common.NewBadRequestError(fmt.Sprintf("Failed to parse int parameter [retry_on_conflict] with value [%s]", value))
+	}
+	return n, nil
+}
+
+// executeUpdate 执行 update：读取文档并应用 doc/script/upsert 后写回
+// 读取之后文档被并发修改时返回版本冲突，retryOnConflict 次数内重新读取并重新应用更新
+func (h *DocumentHandler) executeUpdate(idx bleve.Index, indexName, docID, routing string,
+	requestBody map[string]interface{}, retryOnConflict int) (*updateOutcome, common.APIError) {
+	// 每次尝试使用请求体的副本（脚本与合并会修改文档）
+	bodyJSON, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, common.NewBadRequestError("invalid update request: " + err.Error())
+	}
+	for attempt := 0; ; attempt++ {
+		var body map[string]interface{}
+		if err := json.Unmarshal(bodyJSON, &body); err != nil {
+			return nil, common.NewBadRequestError("invalid update request: " + err.Error())
+		}
+		outcome, apiErr := h.applyUpdate(idx, indexName, docID, routing, body)
+		if apiErr != nil && apiErr.Type() == versionConflictType && attempt < retryOnConflict {
+			logger.Debug("Retrying update of [%s][%s] after version conflict (attempt %d)", indexName, docID, attempt+1)
+			continue
+		}
+		return outcome, apiErr
+	}
+}
+
+// applyUpdate 执行一次 update 尝试
+func (h *DocumentHandler) applyUpdate(idx bleve.Index, indexName, docID, routing string, requestBody map[string]interface{}) (*updateOutcome, common.APIError) {
+	// 先记录版本再读取文档，写入前校验版本未变
+	readVersion := h.versionMgr.GetVersion(indexName, docID)
+	existingDoc, err := idx.Document(docID)
+	docExists := err == nil && existingDoc != nil
+
+	updateData, apiErr := parseUpdateDoc(requestBody)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	scriptData, hasScript := requestBody["script"]
+
+	// 文档不存在：doc_as_upsert 使用 doc，否则使用 upsert 文档创建；scripted_upsert 时先执行脚本
+	if !docExists {
+		newDoc, apiErr := upsertSource(requestBody, updateData)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		if newDoc == nil {
+			return nil, common.NewDocumentNotFoundError(indexName, docID)
+		}
+		if scriptedUpsert, _ := requestBody["scripted_upsert"].(bool); scriptedUpsert && hasScript {
+			source, op, apiErr := runUpdateScript(scriptData, newDoc, updateOpCreate)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			if op != updateOpCreate {
+				// noop 或 delete 时不创建文档
+				return h.noopOutcome(indexName, docID), nil
+			}
+			newDoc = source
+		}
+
+		unlock, apiErr := h.lockUnchangedVersion(indexName, docID, readVersion)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		defer unlock()
+		if apiErr := h.indexUpdatedDocument(idx, indexName, docID, routing, newDoc); apiErr != nil {
+			return nil, apiErr
+		}
+		// P1-1: 使用版本管理器创建版本信息
+		return &updateOutcome{result: "created", version: h.versionMgr.CreateVersion(indexName, docID), status: http.StatusCreated}, nil
+	}
+
+	// 提取现有文档数据，未指定 routing 时保留文档原有的 routing
+	existingData := h.extractDocumentFields(existingDoc)
+	if routing == "" {
+		routing = documentRouting(existingDoc)
+	}
+
+	deleteDoc := false
+	if hasScript {
+		// 处理script更新（ES update API支持script），脚本可通过 ctx.op 取消更新或删除文档
+		source, op, apiErr := runUpdateScript(scriptData, existingData, updateOpIndex)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		switch op {
+		case updateOpNoop:
+			return h.noopOutcome(indexName, docID), nil
+		case updateOpDelete:
+			deleteDoc = true
+		}
+		existingData = source
+	} else {
+		// 合并部分文档，detect_noop（默认开启）时文档未改变则不写入，返回 noop
+		changed := mergeUpdateDoc(existingData, updateData)
+		if detectNoop, ok := requestBody["detect_noop"].(bool); (!ok || detectNoop) && !changed {
+			return h.noopOutcome(indexName, docID), nil
+		}
+	}
+
+	unlock, apiErr := h.lockUnchangedVersion(indexName, docID, readVersion)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	defer unlock()
+	if deleteDoc {
+		return h.deleteUpdatedDocument(idx, indexName, docID)
+	}
+	if apiErr := h.indexUpdatedDocument(idx, indexName, docID, routing, existingData); apiErr != nil {
+		return nil, apiErr
+	}
+	// P1-1: 使用版本管理器递增版本信息
+	return &updateOutcome{result: "updated", version: h.versionMgr.IncrementVersion(indexName, docID), status: http.StatusOK}, nil
+}
+
+// lockUnchangedVersion 锁定文档的写入并校验版本自 readVersion 读取后未变，返回解锁函数
+func (h *DocumentHandler) lockUnchangedVersion(indexName, docID string, readVersion *DocumentVersion) (func(), common.APIError) {
+	unlock := h.versionMgr.LockDocument(indexName, docID)
+	current := h.versionMgr.GetVersion(indexName, docID)
+	switch {
+	case readVersion == nil && current == nil:
+		return unlock, nil
+	case readVersion == nil:
+		unlock()
+		return nil, common.NewConflictError(fmt.Sprintf("[%s]: version conflict, document already exists (current version [%d])", docID, current.Version))
+	case current == nil:
+		unlock()
+		return nil, common.NewConflictError(fmt.Sprintf("[%s]: version conflict, document was deleted (read version [%d])", docID, readVersion.Version))
+	case current.SeqNo != readVersion.SeqNo || current.PrimaryTerm != readVersion.PrimaryTerm:
+		unlock()
+		return nil, common.NewConflictError(fmt.Sprintf("[%s]: version conflict, required seqNo [%d], primary term [%d]. current document has seqNo [%d] and primary term [%d]",
+			docID, readVersion.SeqNo, readVersion.PrimaryTerm, current.SeqNo, current.PrimaryTerm))
+	}
+	return unlock, nil
+}
+
+// indexUpdatedDocument 索引 update 生成的完整文档（嵌套文档、copy_to、动态 mapping 与特殊字段）
+func (h *DocumentHandler) indexUpdatedDocument(idx bleve.Index, indexName, docID, routing string, source map[string]interface{}) common.APIError {
+	// 处理嵌套文档
+	docData, nestedDocs, err := h.nestedDocHelper.ProcessNestedDocuments(docID, source, h.nestedPathsForIndex(indexName))
+	if err != nil {
+		logger.Error("Failed to process nested documents: %v", err)
+		return common.NewBadRequestError("failed to process nested documents: " + err.Error())
+	}
+
+	// P2-4: 应用copy_to规则
+	h.applyCopyToForIndex(indexName, docData)
+
+	// 动态 mapping：为未映射字段推断类型并更新索引 mapping
+	docData, mapErr := h.applyDynamicMapping(indexName, docData)
+	if mapErr != nil {
+		return mapErr
+	}
+	docData = h.applyJoinField(indexName, docData)
+	docData = h.applySparseVectorFields(indexName, docData)
+	docData = h.applyPercolatorFields(indexName, docData)
+	setDocumentRouting(docData, routing)
+
+	// 索引主文档
+	if err := idx.Index(docID, docData); err != nil {
+		logger.Error("Failed to update document [%s] in index [%s]: %v", docID, indexName, err)
+		return common.NewInternalServerError("failed to update document: " + err.Error())
+	}
+
+	// 索引嵌套文档（替换该根文档之前的子文档）
+	h.indexNestedDocuments(idx, indexName, docID, nestedDocs)
+	return nil
+}
+
+// deleteUpdatedDocument 删除更新脚本设置了 ctx.op = "delete" 的文档
+func (h *DocumentHandler) deleteUpdatedDocument(idx bleve.Index, indexName, docID string) (*updateOutcome, common.APIError) {
+	if err := idx.Delete(docID); err != nil {
+		logger.Error("Failed to delete document [%s] from index [%s]: %v", docID, indexName, err)
+		return nil, common.NewInternalServerError("failed to delete document: " + err.Error())
+	}
+	h.deleteNestedDocuments(idx, indexName, docID)
+
+	versionInfo := h.versionMgr.DeleteVersion(indexName, docID)
+	if versionInfo == nil {
+		// 没有版本记录（如服务重启后）时，按版本 1 的文档处理
+		versionInfo = h.versionMgr.NotFoundVersion()
+		versionInfo.Version++
+	}
+	return &updateOutcome{result: "deleted", version: versionInfo, status: http.StatusOK}, nil
+}
+
+// noopOutcome 返回 noop 结果，版本与序列号保持不变
+func (h *DocumentHandler) noopOutcome(indexName, docID string) *updateOutcome {
+	versionInfo := h.versionMgr.GetVersion(indexName, docID)
+	if versionInfo == nil {
+		versionInfo = &DocumentVersion{Version: 1, PrimaryTerm: 1}
+	}
+	return &updateOutcome{result: updateOpNoop, version: versionInfo, status: http.StatusOK}
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_UpdateUpsert(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "POST", Path: "/{index}/_update/{id}", Handler: docHandler.UpdateDocument},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: decode response %q: %v", method, path, w.Body.String(), err)
+		}
+		return w.Code, resp
+	}
+	update := func(id, body string, expectedCode int, expectedResult string) {
+		t.Helper()
+		code, resp := do("POST", "/counters/_update/"+id, body)
+		if code != expectedCode || resp["result"] != expectedResult {
+			t.Errorf("update %s %s: expected %d %s, got %d %v", id, body, expectedCode, expectedResult, code, resp)
+		}
+	}
+	expectSource := func(id, expected string) {
+		t.Helper()
+		code, resp := do("GET", "/counters/_doc/"+id, "")
+		var want interface{}
+		if err := json.Unmarshal([]byte(expected), &want); err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK || !reflect.DeepEqual(resp["_source"], want) {
+			t.Errorf("get %s: expected _source %s, got %d %v", id, expected, code, resp)
+		}
+	}
+
+	if code, _ := do("PUT", "/counters", `{}`); code != http.StatusOK {
+		t.Fatalf("create index: got %d", code)
+	}
+
+	// 文档不存在且未提供 upsert
+	if code, resp := do("POST", "/counters/_update/1", `{"doc":{"n":1}}`); code != http.StatusNotFound {
+		t.Errorf("update missing: expected 404, got %d %v", code, resp)
+	}
+
+	// upsert：不存在时创建 upsert 文档，存在时合并 doc
+	update("1", `{"doc":{"n":2},"upsert":{"n":1,"tag":"new"}}`, http.StatusCreated, "created")
+	expectSource("1", `{"n":1,"tag":"new"}`)
+	update("1", `{"doc":{"n":2},"upsert":{"n":1,"tag":"new"}}`, http.StatusOK, "updated")
+	expectSource("1", `{"n":2,"tag":"new"}`)
+
+	// detect_noop 默认开启，关闭后相同内容也会写入
+	update("1", `{"doc":{"n":2}}`, http.StatusOK, "noop")
+	update("1", `{"doc":{"n":2},"detect_noop":false}`, http.StatusOK, "updated")
+
+	// doc_as_upsert
+	update("2", `{"doc":{"n":7},"doc_as_upsert":true}`, http.StatusCreated, "created")
+	expectSource("2", `{"n":7}`)
+
+	// 脚本 + upsert：scripted_upsert 为 false 时直接创建 upsert 文档，之后执行脚本
+	incr := `"script":{"source":"ctx._source.n = ctx._source.n + params.by","params":{"by":4}}`
+	update("3", `{`+incr+`,"upsert":{"n":1}}`, http.StatusCreated, "created")
+	expectSource("3", `{"n":1}`)
+	update("3", `{`+incr+`,"upsert":{"n":1}}`, http.StatusOK, "updated")
+	expectSource("3", `{"n":5}`)
+
+	// scripted_upsert：以 upsert 文档为 ctx._source 执行脚本后创建
+	update("4", `{`+incr+`,"upsert":{"n":1},"scripted_upsert":true}`, http.StatusCreated, "created")
+	expectSource("4", `{"n":5}`)
+	update("5", `{"script":{"source":"ctx.op = 'none'"},"upsert":{"n":1},"scripted_upsert":true}`, http.StatusOK, "noop")
+	if code, _ := do("GET", "/counters/_doc/5", ""); code != http.StatusNotFound {
+		t.Errorf("scripted upsert noop: expected no document, got %d", code)
+	}
+
+	// ctx.op
+	update("4", `{"script":{"source":"if (ctx._source.n > 1) { ctx.op = 'noop' }"}}`, http.StatusOK, "noop")
+	expectSource("4", `{"n":5}`)
+	update("4", `{"script":{"source":"ctx.op = 'delete'"}}`, http.StatusOK, "deleted")
+	if code, _ := do("GET", "/counters/_doc/4", ""); code != http.StatusNotFound {
+		t.Errorf("script delete: expected 404, got %d", code)
+	}
+
+	invalid := []struct {
+		body    string
+		message string
+	}{
+		{`{"doc":{"n":1},` + incr + `}`, "can't provide both script and doc"},
+		{`{"script":{"source":"ctx.op = 'explode'"}}`, "Operation type [explode] not allowed"},
+		{`{"doc":{"n":1},"upsert":[1]}`, "[upsert] must be an object"},
+	}
+	for _, tt := range invalid {
+		id := "1"
+		if strings.Contains(tt.body, "upsert") {
+			id = "6"
+		}
+		code, resp := do("POST", "/counters/_update/"+id, tt.body)
+		errBody, _ := json.Marshal(resp)
+		if code != http.StatusBadRequest || !strings.Contains(string(errBody), tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d %s", tt.body, tt.message, code, errBody)
+		}
+	}
+}
+
+func TestMergeUpdateDoc(t *testing.T) {
+	existing := map[string]interface{}{
+		"title": "a",
+		"user":  map[string]interface{}{"name": "x", "age": 1.0},
+	}
+	if mergeUpdateDoc(existing, map[string]interface{}{"user": map[string]interface{}{"age": 1.0}}) {
+		t.Errorf("expected unchanged document")
+	}
+	if !mergeUpdateDoc(existing, map[string]interface{}{"user": map[string]interface{}{"age": 2.0}, "tags": []interface{}{"t"}}) {
+		t.Errorf("expected changed document")
+	}
+	expected := map[string]interface{}{
+		"title": "a",
+		"user":  map[string]interface{}{"name": "x", "age": 2.0},
+		"tags":  []interface{}{"t"},
+	}
+	if !reflect.DeepEqual(existing, expected) {
+		t.Errorf("expected %v, got %v", expected, existing)
+	}
+}
+
+func TestDocumentHandler_UpdateRetryOnConflict(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "POST", Path: "/{index}/_update/{id}", Handler: docHandler.UpdateDocument},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	counter := func(id string) interface{} {
+		t.Helper()
+		var resp struct {
+			Source map[string]interface{} `json:"_source"`
+		}
+		if err := json.Unmarshal(do("GET", "/counters/_doc/"+id, "").Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Source["n"]
+	}
+
+	if w := do("PUT", "/counters", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: got %d", w.Code)
+	}
+	if w := do("PUT", "/counters/_doc/1", `{"n":0}`); w.Code != http.StatusCreated {
+		t.Fatalf("index: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 并发递增：冲突后重新读取并重新执行脚本，不丢失更新
+	const workers, updates = 8, 5
+	incr := `{"script":{"source":"ctx._source.n = ctx._source.n + 1"}}`
+	var wg sync.WaitGroup
+	errs := make(chan string, workers*updates)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				if w := do("POST", "/counters/_update/1?retry_on_conflict=1000", incr); w.Code != http.StatusOK {
+					errs <- fmt.Sprintf("%d: %s", w.Code, w.Body.String())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent update failed: %s", err)
+	}
+	if n := counter("1"); n != float64(workers*updates) {
+		t.Errorf("expected n = %d after concurrent updates, got %v", workers*updates, n)
+	}
+
+	// 读取后版本被修改时返回冲突
+	readVersion := docHandler.versionMgr.GetVersion("counters", "1")
+	docHandler.versionMgr.IncrementVersion("counters", "1")
+	if unlock, apiErr := docHandler.lockUnchangedVersion("counters", "1", readVersion); apiErr == nil {
+		unlock()
+		t.Errorf("expected version conflict")
+	} else if apiErr.StatusCode() != http.StatusConflict || apiErr.Type() != versionConflictType ||
+		!strings.Contains(apiErr.Error(), "version conflict, required seqNo") {
+		t.Errorf("unexpected conflict error: %d %s %s", apiErr.StatusCode(), apiErr.Type(), apiErr.Error())
+	}
+	if unlock, apiErr := docHandler.lockUnchangedVersion("counters", "2", nil); apiErr != nil {
+		t.Errorf("unexpected conflict for a missing document: %v", apiErr)
+	} else {
+		unlock()
+	}
+
+	if w := do("POST", "/counters/_update/1?retry_on_conflict=-1", incr); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "Failed to parse int parameter [retry_on_conflict] with value [-1]") {
+		t.Errorf("invalid retry_on_conflict: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// bulk update 的 retry_on_conflict：合并现有文档、支持 upsert 与 noop
+	body := `{"update":{"_index":"counters","_id":"1","retry_on_conflict":3}}
+{"doc":{"tag":"bulk"}}
+{"update":{"_index":"counters","_id":"1","retry_on_conflict":3}}
+{"doc":{"tag":"bulk"}}
+{"update":{"_index":"counters","_id":"3","retry_on_conflict":3}}
+{"script":{"source":"ctx._source.n = ctx._source.n + 1"},"upsert":{"n":10},"scripted_upsert":true}
+`
+	w := do("POST", "/_bulk?refresh=true", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+	var bulkResp BulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &bulkResp); err != nil {
+		t.Fatal(err)
+	}
+	var results []interface{}
+	for _, item := range bulkResp.Items {
+		update, _ := item["update"].(map[string]interface{})
+		results = append(results, update["result"])
+	}
+	if fmt.Sprint(results) != "[updated noop created]" {
+		t.Errorf("bulk: unexpected results %v: %s", results, w.Body.String())
+	}
+	if n := counter("1"); n != float64(workers*updates) {
+		t.Errorf("bulk update should keep existing fields, got n = %v", n)
+	}
+	if n := counter("3"); n != 11.0 {
+		t.Errorf("bulk scripted upsert: expected n = 11, got %v", n)
+	}
+}
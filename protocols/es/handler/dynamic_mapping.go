@@ -0,0 +1,670 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 动态 mapping（ES dynamic mapping）
+// 文档中出现未映射字段时，根据首次出现的值推断字段类型并写回索引 mapping 元数据，
+// 同时支持 dynamic_templates 以及 dynamic: true|false|strict|runtime。
+// 新增字段后按更新的 ES mapping 重新生成 bleve mapping 并替换索引正在使用的 mapping，
+// 触发更新的文档及之后的文档按推断的类型索引；已索引的文档不受影响。
+
+// MappingConverter 将 ES mapping 转换为索引使用的 bleve mapping
+type MappingConverter func(esMapping map[string]interface{}) (*mapping.IndexMappingImpl, error)
+
+// SetMappingConverter 设置动态 mapping 新增字段后生成 bleve mapping 的方法，未设置时只更新 mapping 元数据
+func (h *DocumentHandler) SetMappingConverter(converter MappingConverter) {
+	h.mappingConv = converter
+}
+
+// mappingUpdateMu 串行化 mapping 元数据的读-改-写（动态 mapping 与 PUT _mapping 共用）
+var mappingUpdateMu sync.Mutex
+
+// dynamic 设置取值
+const (
+	dynamicTrue    = "true"
+	dynamicFalse   = "false"
+	dynamicStrict  = "strict"
+	dynamicRuntime = "runtime"
+)
+
+// ES 默认的 dynamic_date_formats（strict_date_optional_time || yyyy/MM/dd HH:mm:ss Z || yyyy/MM/dd Z）
+var defaultDynamicDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05 -0700",
+	"2006/01/02 -0700",
+}
+
+// dynamicTemplate 解析后的 dynamic_templates 条目
+type dynamicTemplate struct {
+	name             string
+	match            []string
+	unmatch          []string
+	pathMatch        []string
+	pathUnmatch      []string
+	matchMappingType []string
+	regex            bool
+	mapping          map[string]interface{}
+}
+
+// dynamicMapper 单次文档映射过程的上下文
+type dynamicMapper struct {
+	templates        []dynamicTemplate
+	dateDetection    bool
+	numericDetection bool
+	dateLayouts      []string
+	newFields        []string
+}
+
+// parseDynamicSetting 解析 dynamic 设置（bool 或字符串），未设置时返回 inherited
+func parseDynamicSetting(value interface{}, inherited string) string {
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		switch strings.ToLower(v) {
+		case dynamicTrue, dynamicFalse, dynamicStrict, dynamicRuntime:
+			return strings.ToLower(v)
+		}
+	}
+	return inherited
+}
+
+// newDynamicMapper 根据 mapping 根对象构建映射器
+func newDynamicMapper(esMapping map[string]interface{}) *dynamicMapper {
+	m := &dynamicMapper{
+		dateDetection: true,
+		dateLayouts:   defaultDynamicDateLayouts,
+	}
+	if v, ok := esMapping["date_detection"].(bool); ok {
+		m.dateDetection = v
+	}
+	if v, ok := esMapping["numeric_detection"].(bool); ok {
+		m.numericDetection = v
+	}
+	if formats, ok := esMapping["dynamic_date_formats"].([]interface{}); ok && len(formats) > 0 {
+		layouts := make([]string, 0, len(formats))
+		for _, f := range formats {
+			if s, ok := f.(string); ok {
+				for _, part := range strings.Split(s, "||") {
+					layouts = append(layouts, esDateFormatToLayout(part))
+				}
+			}
+		}
+		if len(layouts) > 0 {
+			m.dateLayouts = layouts
+		}
+	}
+	m.templates = parseDynamicTemplates(esMapping["dynamic_templates"])
+	return m
+}
+
+// esDateFormatToLayout 将 ES 日期格式名称/模式转换为 Go layout
+func esDateFormatToLayout(format string) string {
+	switch strings.TrimSpace(format) {
+	case "strict_date_optional_time", "date_optional_time":
+		return time.RFC3339Nano
+	case "strict_date", "date":
+		return "2006-01-02"
+	case "epoch_millis", "epoch_second":
+		// 数值型时间戳不参与字符串日期检测
+		return ""
+	}
+	return convertESDateFormatToGo(strings.TrimSpace(format))
+}
+
+// parseDynamicTemplates 解析 dynamic_templates 配置
+// 格式：[{"name": {"match": "...", "match_mapping_type": "...", "mapping": {...}}}, ...]
+func parseDynamicTemplates(raw interface{}) []dynamicTemplate {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil
+	}
+	templates := make([]dynamicTemplate, 0, len(list))
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, def := range entry {
+			defMap, ok := def.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			t := dynamicTemplate{
+				name:             name,
+				match:            stringOrStrings(defMap["match"]),
+				unmatch:          stringOrStrings(defMap["unmatch"]),
+				pathMatch:        stringOrStrings(defMap["path_match"]),
+				pathUnmatch:      stringOrStrings(defMap["path_unmatch"]),
+				matchMappingType: stringOrStrings(defMap["match_mapping_type"]),
+			}
+			if pattern, _ := defMap["match_pattern"].(string); pattern == "regex" {
+				t.regex = true
+			}
+			t.mapping, _ = defMap["mapping"].(map[string]interface{})
+			templates = append(templates, t)
+		}
+	}
+	return templates
+}
+
+// stringOrStrings 将字符串或字符串数组统一为切片
+func stringOrStrings(v interface{}) []string {
+	switch tv := v.(type) {
+	case string:
+		return []string{tv}
+	case []interface{}:
+		out := make([]string, 0, len(tv))
+		for _, item := range tv {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case []string:
+		return tv
+	}
+	return nil
+}
+
+// simpleWildcardMatch 简单通配符匹配（仅支持 *，与 ES Regex.simpleMatch 一致）
+func simpleWildcardMatch(pattern, s string) bool {
+	if pattern == "*" {
+		return true
+	}
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for i := 1; i < len(parts)-1; i++ {
+		idx := strings.Index(s, parts[i])
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(parts[i]):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// matchAny 判断名称是否匹配任一模式
+func (t *dynamicTemplate) matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if t.regex {
+			if re, err := regexp.Compile(p); err == nil && re.MatchString(s) {
+				return true
+			}
+			continue
+		}
+		if simpleWildcardMatch(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches 判断模板是否匹配字段
+func (t *dynamicTemplate) matches(name, path, mappingType string) bool {
+	if len(t.matchMappingType) > 0 {
+		ok := false
+		for _, mt := range t.matchMappingType {
+			if mt == "*" || mt == mappingType {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(t.match) > 0 && !t.matchAny(t.match, name) {
+		return false
+	}
+	if len(t.unmatch) > 0 && t.matchAny(t.unmatch, name) {
+		return false
+	}
+	if len(t.pathMatch) > 0 && !t.matchAny(t.pathMatch, path) {
+		return false
+	}
+	if len(t.pathUnmatch) > 0 && t.matchAny(t.pathUnmatch, path) {
+		return false
+	}
+	return true
+}
+
+// detectMappingType 推断 JSON 值的 match_mapping_type（string/long/double/boolean/date/object）
+// 返回空字符串表示无法推断（null 或空数组），此时不生成 mapping
+func (m *dynamicMapper) detectMappingType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) && math.Abs(v) < 1<<53 {
+			return "long"
+		}
+		return "double"
+	case float32:
+		return "double"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "long"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "long"
+		}
+		return "double"
+	case string:
+		if m.dateDetection && m.looksLikeDate(v) {
+			return "date"
+		}
+		if m.numericDetection {
+			if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return "long"
+			}
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				return "double"
+			}
+		}
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		for _, item := range v {
+			if t := m.detectMappingType(item); t != "" {
+				return t
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// looksLikeDate 判断字符串是否符合 dynamic_date_formats
+func (m *dynamicMapper) looksLikeDate(s string) bool {
+	// 纯数字不视为日期（避免将 "2024" 之类的值识别为日期）
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return false
+	}
+	for _, layout := range m.dateLayouts {
+		if layout == "" {
+			continue
+		}
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultDynamicType 返回 {dynamic_type} 占位符对应的 ES 字段类型
+func defaultDynamicType(mappingType string) string {
+	switch mappingType {
+	case "string":
+		return "text"
+	case "double":
+		return "float"
+	}
+	return mappingType
+}
+
+// defaultFieldMapping 无模板匹配时的默认 mapping（与 ES 一致：字符串为 text + keyword 子字段）
+func defaultFieldMapping(mappingType string) map[string]interface{} {
+	switch mappingType {
+	case "string":
+		return map[string]interface{}{
+			"type": "text",
+			"fields": map[string]interface{}{
+				"keyword": map[string]interface{}{
+					"type":         "keyword",
+					"ignore_above": 256,
+				},
+			},
+		}
+	case "object":
+		return map[string]interface{}{
+			"properties": map[string]interface{}{},
+		}
+	}
+	return map[string]interface{}{"type": defaultDynamicType(mappingType)}
+}
+
+// newFieldMapping 为未映射字段生成 mapping（优先使用第一个匹配的 dynamic template）
+func (m *dynamicMapper) newFieldMapping(name, path, mappingType string) map[string]interface{} {
+	for i := range m.templates {
+		t := &m.templates[i]
+		if t.mapping == nil || !t.matches(name, path, mappingType) {
+			continue
+		}
+		fieldMapping := substituteTemplatePlaceholders(t.mapping, name, defaultDynamicType(mappingType)).(map[string]interface{})
+		if _, hasType := fieldMapping["type"]; !hasType && mappingType != "object" {
+			fieldMapping["type"] = defaultDynamicType(mappingType)
+		}
+		if mappingType == "object" {
+			if _, ok := fieldMapping["properties"]; !ok {
+				fieldMapping["properties"] = map[string]interface{}{}
+			}
+		}
+		return fieldMapping
+	}
+	return defaultFieldMapping(mappingType)
+}
+
+// substituteTemplatePlaceholders 深拷贝模板 mapping 并替换 {name} 与 {dynamic_type}
+func substituteTemplatePlaceholders(v interface{}, name, dynamicType string) interface{} {
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(tv))
+		for k, item := range tv {
+			key := strings.ReplaceAll(strings.ReplaceAll(k, "{name}", name), "{dynamic_type}", dynamicType)
+			out[key] = substituteTemplatePlaceholders(item, name, dynamicType)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(tv))
+		for i, item := range tv {
+			out[i] = substituteTemplatePlaceholders(item, name, dynamicType)
+		}
+		return out
+	case string:
+		return strings.ReplaceAll(strings.ReplaceAll(tv, "{name}", name), "{dynamic_type}", dynamicType)
+	}
+	return v
+}
+
+// isObjectFieldMapping 判断字段 mapping 是否为 object/nested（可包含子属性）
+func isObjectFieldMapping(fieldMapping map[string]interface{}) bool {
+	switch fieldMapping["type"] {
+	case "object", "nested":
+		return true
+	case nil:
+		_, hasProps := fieldMapping["properties"]
+		return hasProps
+	}
+	return false
+}
+
+// newStrictDynamicMappingError strict 模式下出现未映射字段
+func newStrictDynamicMappingError(field, parent string) common.APIError {
+	if parent == "" {
+		parent = "_doc"
+	}
+	return &common.BaseError{
+		ErrType:    "strict_dynamic_mapping_exception",
+		Message:    fmt.Sprintf("mapping set to strict, dynamic introduction of [%s] within [%s] is not allowed", field, parent),
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "STRICT_DYNAMIC_MAPPING",
+	}
+}
+
+// newMapperParsingError mapping 解析/文档映射失败
+func newMapperParsingError(message string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "mapper_parsing_exception",
+		Message:    message,
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "MAPPER_PARSING",
+	}
+}
+
+// hasUnmappedFields 只读检查文档中是否存在未映射的字段（热路径，避免无谓的元数据拷贝）
+func (m *dynamicMapper) hasUnmappedFields(props map[string]interface{}, data map[string]interface{}) bool {
+	for k, v := range data {
+		if strings.HasPrefix(k, "_") {
+			continue
+		}
+		fieldMapping, exists := props[k].(map[string]interface{})
+		if !exists {
+			if m.detectMappingType(v) != "" {
+				return true
+			}
+			continue
+		}
+		if fieldMapping["type"] == "alias" || fieldMapping["type"] == "percolator" {
+			// 写入别名字段、percolator 字段需要走完整映射流程以返回错误
+			return true
+		}
+		if fieldType, _ := fieldMapping["type"].(string); isSparseVectorType(fieldType) {
+			// 非法的稀疏向量需要走完整映射流程以返回错误
+			if validateSparseVector(fieldType, v) != nil {
+				return true
+			}
+			continue
+		}
+		if !isObjectFieldMapping(fieldMapping) {
+			continue
+		}
+		childProps, _ := fieldMapping["properties"].(map[string]interface{})
+		for _, obj := range objectValues(v) {
+			if m.hasUnmappedFields(childProps, obj) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// objectValues 提取对象值（单个对象或对象数组）
+func objectValues(v interface{}) []map[string]interface{} {
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{tv}
+	case []interface{}:
+		out := make([]map[string]interface{}, 0, len(tv))
+		for _, item := range tv {
+			if obj, ok := item.(map[string]interface{}); ok {
+				out = append(out, obj)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// mapObject 映射一个对象层级：为未映射字段生成 mapping（写入 props），并返回实际需要索引的数据
+// dynamic=false/runtime 时未映射字段不被索引；strict 时返回错误
+func (m *dynamicMapper) mapObject(props map[string]interface{}, data map[string]interface{}, path, dynamic string) (map[string]interface{}, bool, common.APIError) {
+	indexed := make(map[string]interface{}, len(data))
+	filtered := false
+	for k, v := range data {
+		if strings.HasPrefix(k, "_") {
+			indexed[k] = v
+			continue
+		}
+		fullPath := k
+		if path != "" {
+			fullPath = path + "." + k
+		}
+
+		fieldMapping, exists := props[k].(map[string]interface{})
+		if !exists {
+			mappingType := m.detectMappingType(v)
+			if mappingType == "" {
+				indexed[k] = v
+				continue
+			}
+			switch dynamic {
+			case dynamicStrict:
+				return nil, false, newStrictDynamicMappingError(k, path)
+			case dynamicFalse, dynamicRuntime:
+				filtered = true
+				continue
+			}
+			fieldMapping = m.newFieldMapping(k, fullPath, mappingType)
+			props[k] = fieldMapping
+			m.newFields = append(m.newFields, fullPath)
+		}
+
+		if fieldMapping["type"] == "alias" {
+			return nil, false, newMapperParsingError(fmt.Sprintf("failed to parse: Cannot write to a field alias [%s].", fullPath))
+		}
+		if fieldMapping["type"] == "percolator" {
+			if err := validatePercolatorQuery(v); err != nil {
+				return nil, false, newMapperParsingError(fmt.Sprintf("failed to parse field [%s] of type [percolator]: %v", fullPath, err))
+			}
+			indexed[k] = v
+			continue
+		}
+		if fieldType, _ := fieldMapping["type"].(string); isSparseVectorType(fieldType) {
+			if err := validateSparseVector(fieldType, v); err != nil {
+				return nil, false, newMapperParsingError(fmt.Sprintf("failed to parse field [%s] of type [%s]: %v", fullPath, fieldType, err))
+			}
+			indexed[k] = v
+			continue
+		}
+
+		if !isObjectFieldMapping(fieldMapping) {
+			indexed[k] = v
+			continue
+		}
+
+		childProps, ok := fieldMapping["properties"].(map[string]interface{})
+		if !ok {
+			childProps = make(map[string]interface{})
+			fieldMapping["properties"] = childProps
+		}
+		childDynamic := parseDynamicSetting(fieldMapping["dynamic"], dynamic)
+		switch tv := v.(type) {
+		case map[string]interface{}:
+			child, childFiltered, err := m.mapObject(childProps, tv, fullPath, childDynamic)
+			if err != nil {
+				return nil, false, err
+			}
+			filtered = filtered || childFiltered
+			indexed[k] = child
+		case []interface{}:
+			items := make([]interface{}, 0, len(tv))
+			for _, item := range tv {
+				obj, ok := item.(map[string]interface{})
+				if !ok {
+					items = append(items, item)
+					continue
+				}
+				child, childFiltered, err := m.mapObject(childProps, obj, fullPath, childDynamic)
+				if err != nil {
+					return nil, false, err
+				}
+				filtered = filtered || childFiltered
+				items = append(items, child)
+			}
+			indexed[k] = items
+		default:
+			indexed[k] = v
+		}
+	}
+	return indexed, filtered, nil
+}
+
+// applyDynamicMapping 对待索引文档应用动态 mapping
+// 返回实际需要索引的数据；若有字段因 dynamic=false 未被索引，会补充 _source 以保证 GET 能返回原文档
+func (h *DocumentHandler) applyDynamicMapping(indexName string, docData map[string]interface{}) (map[string]interface{}, common.APIError) {
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return docData, nil
+	}
+
+	// 快速路径：所有字段均已映射
+	mapper := newDynamicMapper(indexMeta.Mapping)
+	props, _ := indexMeta.Mapping["properties"].(map[string]interface{})
+	if !mapper.hasUnmappedFields(props, docData) {
+		return docData, nil
+	}
+
+	mappingUpdateMu.Lock()
+	defer mappingUpdateMu.Unlock()
+
+	// 加锁后重新读取并深拷贝 mapping，避免并发更新丢失以及修改共享的元数据对象
+	indexMeta, err = h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return docData, nil
+	}
+	esMapping := make(map[string]interface{})
+	if indexMeta.Mapping != nil {
+		mappingBytes, err := json.Marshal(indexMeta.Mapping)
+		if err == nil {
+			_ = json.Unmarshal(mappingBytes, &esMapping)
+		}
+	}
+	props, ok := esMapping["properties"].(map[string]interface{})
+	if !ok {
+		props = make(map[string]interface{})
+		esMapping["properties"] = props
+	}
+
+	mapper = newDynamicMapper(esMapping)
+	indexed, filtered, apiErr := mapper.mapObject(props, docData, "", parseDynamicSetting(esMapping["dynamic"], dynamicTrue))
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	if len(mapper.newFields) > 0 {
+		// 先生成 bleve mapping，推断出的字段无法索引时拒绝文档，不写入元数据
+		var bleveMapping *mapping.IndexMappingImpl
+		if h.mappingConv != nil {
+			bleveMapping, err = h.mappingConv(esMapping)
+			if err == nil {
+				err = bleveMapping.Validate()
+			}
+			if err != nil {
+				return nil, newMapperParsingError(fmt.Sprintf("failed to apply dynamic mapping for fields %v: %v", mapper.newFields, err))
+			}
+		}
+		updated := *indexMeta
+		updated.Mapping = esMapping
+		updated.UpdatedAt = time.Now()
+		if err := h.metaStore.SaveIndexMetadata(indexName, &updated); err != nil {
+			logger.Error("Failed to save dynamic mapping for index [%s]: %v", indexName, err)
+			return nil, common.NewInternalServerError("failed to update dynamic mapping: " + err.Error())
+		}
+		if bleveMapping != nil {
+			if err := h.indexMgr.UpdateMapping(indexName, bleveMapping); err != nil {
+				logger.Error("Failed to apply dynamic mapping to index [%s]: %v", indexName, err)
+				return nil, common.NewInternalServerError("failed to update dynamic mapping: " + err.Error())
+			}
+		}
+		logger.Info("Dynamic mapping added fields to index [%s]: %v", indexName, mapper.newFields)
+	}
+
+	if filtered {
+		if _, hasSource := docData["_source"]; !hasSource {
+			sourceJSON, _ := json.Marshal(docData)
+			indexed["_source"] = string(sourceJSON)
+		}
+	}
+	return indexed, nil
+}
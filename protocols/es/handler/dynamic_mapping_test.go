@@ -0,0 +1,224 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDynamicMapper_MapObject(t *testing.T) {
+	esMapping := map[string]interface{}{
+		"dynamic_templates": []interface{}{
+			map[string]interface{}{
+				"ids_as_keyword": map[string]interface{}{
+					"match_mapping_type": "string",
+					"match":              "*_id",
+					"mapping":            map[string]interface{}{"type": "keyword"},
+				},
+			},
+			map[string]interface{}{
+				"labels": map[string]interface{}{
+					"path_match": "labels.*",
+					"mapping":    map[string]interface{}{"type": "{dynamic_type}", "meta": map[string]interface{}{"source": "{name}"}},
+				},
+			},
+		},
+	}
+	props := map[string]interface{}{
+		"title": map[string]interface{}{"type": "text"},
+	}
+	doc := map[string]interface{}{
+		"title":   "existing",
+		"user_id": "u-1",
+		"body":    "hello world",
+		"count":   float64(3),
+		"price":   1.5,
+		"active":  true,
+		"created": "2024-01-02T03:04:05Z",
+		"empty":   nil,
+		"labels":  map[string]interface{}{"env": "prod"},
+	}
+
+	m := newDynamicMapper(esMapping)
+	if !m.hasUnmappedFields(props, doc) {
+		t.Fatalf("expected unmapped fields to be detected")
+	}
+	indexed, filtered, err := m.mapObject(props, doc, "", dynamicTrue)
+	if err != nil {
+		t.Fatalf("mapObject failed: %v", err)
+	}
+	if filtered || len(indexed) != len(doc) {
+		t.Fatalf("dynamic=true must index every field, got %v", indexed)
+	}
+
+	expectType := func(field, want string) {
+		t.Helper()
+		def, ok := props[field].(map[string]interface{})
+		if !ok || def["type"] != want {
+			t.Errorf("field %s: expected type %s, got %v", field, want, props[field])
+		}
+	}
+	expectType("user_id", "keyword")
+	expectType("body", "text")
+	expectType("count", "long")
+	expectType("price", "float")
+	expectType("active", "boolean")
+	expectType("created", "date")
+	if _, ok := props["empty"]; ok {
+		t.Errorf("null values must not create a mapping")
+	}
+	bodyDef := props["body"].(map[string]interface{})
+	if _, ok := bodyDef["fields"].(map[string]interface{})["keyword"]; !ok {
+		t.Errorf("default string mapping should carry a keyword sub-field: %v", bodyDef)
+	}
+	env := props["labels"].(map[string]interface{})["properties"].(map[string]interface{})["env"].(map[string]interface{})
+	if env["type"] != "text" || env["meta"].(map[string]interface{})["source"] != "env" {
+		t.Errorf("path_match template placeholders not substituted: %v", env)
+	}
+
+	// dynamic=false：未映射字段不索引
+	indexed, filtered, err = newDynamicMapper(nil).mapObject(map[string]interface{}{}, map[string]interface{}{"x": "y"}, "", dynamicFalse)
+	if err != nil || !filtered || len(indexed) != 0 {
+		t.Errorf("dynamic=false should drop unmapped fields, got %v filtered=%v err=%v", indexed, filtered, err)
+	}
+
+	// dynamic=strict：直接报错
+	_, _, err = newDynamicMapper(nil).mapObject(map[string]interface{}{}, map[string]interface{}{"x": "y"}, "", dynamicStrict)
+	if err == nil || err.Type() != "strict_dynamic_mapping_exception" {
+		t.Errorf("dynamic=strict should reject unmapped fields, got %v", err)
+	}
+}
+
+func TestDocumentHandler_DynamicMapping(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	createBody := `{"mappings":{"properties":{
+		"name":{"type":"keyword"},
+		"meta":{"type":"object","dynamic":"strict","properties":{"owner":{"type":"keyword"}}},
+		"extra":{"type":"object","dynamic":false,"properties":{}}
+	}}}`
+	if w := do("PUT", "/dyn", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do("PUT", "/dyn/_doc/1", `{"name":"a","age":30,"extra":{"note":"kept in source"}}`); w.Code >= 300 {
+		t.Fatalf("index doc: got %d: %s", w.Code, w.Body.String())
+	}
+	indexMeta, err := indexHandler.metaStore.GetIndexMetadata("dyn")
+	if err != nil {
+		t.Fatalf("get metadata: %v", err)
+	}
+	props := indexMeta.Mapping["properties"].(map[string]interface{})
+	if age, ok := props["age"].(map[string]interface{}); !ok || age["type"] != "long" {
+		t.Fatalf("expected dynamic long mapping for age, got %v", props["age"])
+	}
+	extraProps := props["extra"].(map[string]interface{})["properties"].(map[string]interface{})
+	if len(extraProps) != 0 {
+		t.Fatalf("dynamic=false object must not gain mappings, got %v", extraProps)
+	}
+	if w := do("GET", "/dyn/_doc/1", ""); !strings.Contains(w.Body.String(), "kept in source") {
+		t.Fatalf("unindexed field should still be returned in _source: %s", w.Body.String())
+	}
+
+	w := do("PUT", "/dyn/_doc/2", `{"meta":{"owner":"x","unknown":"y"}}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "strict_dynamic_mapping_exception") {
+		t.Fatalf("strict object: expected 400 strict_dynamic_mapping_exception, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDocumentHandler_DynamicMappingAppliedToIndex(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	docHandler.SetMappingConverter(indexHandler.BleveMapping)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.Contains(path, "_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	countHits := func(query string) int {
+		t.Helper()
+		w := do("POST", "/dyn/_search", `{"query": `+query+`}`)
+		var resp struct {
+			Hits struct {
+				Hits []interface{} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", query, w.Code, w.Body.String())
+		}
+		return len(resp.Hits.Hits)
+	}
+
+	createBody := `{"mappings":{"dynamic_templates":[
+		{"codes":{"match_mapping_type":"string","match":"*_code","mapping":{"type":"keyword"}}}
+	]}}`
+	if w := do("PUT", "/dyn", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/dyn/_doc/1?refresh=true", `{"status_code":"Not Found","title":"Hello World"}`); w.Code >= 300 {
+		t.Fatalf("index doc: got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := `{"index":{"_index":"dyn","_id":"2"}}
+{"region_code":"EU West"}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"errors":true`) {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 新字段按推断的类型索引：keyword 精确匹配整个值，text 仍然分词
+	if n := countHits(`{"term": {"status_code": "Not Found"}}`); n != 1 {
+		t.Errorf("expected the dynamically mapped keyword field to match exactly, got %d hits", n)
+	}
+	if n := countHits(`{"term": {"region_code": "EU West"}}`); n != 1 {
+		t.Errorf("expected the keyword field added by bulk to match exactly, got %d hits", n)
+	}
+	if n := countHits(`{"match": {"title": "hello"}}`); n != 1 {
+		t.Errorf("expected the dynamic text field to stay analyzed, got %d hits", n)
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 查询结果导出
+// POST /{index}/_export_search 按查询导出所有匹配的文档，请求体支持 query、sort 与 fields。
+// 查询参数：format=ndjson（默认）或 csv；fields 逗号分隔的字段（覆盖请求体，支持点号路径与 _id、_index、_routing、_score）；
+// delimiter 为 CSV 分隔符（单个字符，默认逗号，\t 表示制表符）；header=false 时 CSV 不输出表头；
+// gzip=true 时以 gzip 压缩输出（application/gzip 附件）；batch_size 为每批读取的文档数（默认 1000，最大 10000）。
+// 导出在内部创建 scroll 上下文（计入 search.max_open_scroll_context，完成或中断时清除），按 search_after 逐批读取，
+// 每批写出并刷新后才读取下一批，客户端读取慢时写入阻塞，服务端内存只保留一批文档。
+// 响应头写出后出错只能中断输出，错误记录在日志中。
+
+const (
+	exportSearchDefaultBatchSize = 1000
+	exportSearchMaxBatchSize     = 10000
+	// exportSearchKeepAlive 导出使用的 scroll 上下文每批续期的时长
+	exportSearchKeepAlive = 5 * time.Minute
+	// exportSearchWriteTimeout 写出一批的超时，超时说明客户端停止读取，导出中断
+	exportSearchWriteTimeout = 2 * time.Minute
+)
+
+// exportSearchRequest 导出请求体
+type exportSearchRequest struct {
+	Query  map[string]interface{} `json:"query,omitempty"`
+	Sort   []interface{}          `json:"sort,omitempty"`
+	Fields []string               `json:"fields,omitempty"`
+}
+
+// exportSearchOptions 导出格式选项
+type exportSearchOptions struct {
+	format    string // ndjson 或 csv
+	fields    []string
+	delimiter rune
+	header    bool
+	gzip      bool
+	batchSize int
+}
+
+// ExportSearch 以 NDJSON 或 CSV 流式导出查询结果
+// POST /{index}/_export_search
+func (h *DocumentHandler) ExportSearch(w http.ResponseWriter, r *http.Request) {
+	indexName := mux.Vars(r)["index"]
+	if err := common.ValidateIndexName(indexName); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+
+	var req exportSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	opts, apiErr := parseExportSearchOptions(r, req.Fields)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	indexName, aliasFilter, apiErr := h.resolveSearchTarget(indexName)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelRead); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	idx, err := h.indexMgr.GetIndex(indexName)
+	if err != nil {
+		logger.Error("Failed to get index [%s]: %v", indexName, err)
+		common.HandleError(w, common.NewInternalServerError("failed to get index: "+err.Error()))
+		return
+	}
+
+	// 与 scroll 相同：以 _id 作为 tiebreaker，按 search_after 逐批读取
+	scrollMgr := GetScrollManager()
+	scrollCtx, err := scrollMgr.CreateScrollContext(indexName, applyAliasFilter(req.Query, aliasFilter),
+		scrollSortWithTiebreaker(req.Sort), nil, opts.batchSize, nil, exportSearchKeepAlive)
+	if err != nil {
+		common.HandleError(w, common.NewInternalServerError("failed to create scroll context: "+err.Error()))
+		return
+	}
+	scrollID := scrollCtx.ScrollID
+	defer scrollMgr.DeleteScrollContext(scrollID)
+
+	// 读取第一批后再写响应头，查询本身的错误仍以 JSON 错误返回
+	readBatch := func() ([]map[string]interface{}, error) {
+		sc, err := scrollMgr.GetScrollContext(scrollID)
+		if err != nil {
+			return nil, err
+		}
+		if err := scrollMgr.KeepAlive(scrollID, exportSearchKeepAlive); err != nil {
+			return nil, err
+		}
+		searchResponse, err := h.executeSearchInternal(r.Context(), idx, indexName, &SearchRequest{
+			Query:       sc.Query,
+			Sort:        sc.Sort,
+			Size:        sc.Size,
+			SearchAfter: sc.LastSort,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var hits []map[string]interface{}
+		if hitsWrapper, ok := searchResponse["hits"].(map[string]interface{}); ok {
+			hits, _ = hitsWrapper["hits"].([]map[string]interface{})
+		}
+		if len(hits) > 0 {
+			lastSort, ok := hits[len(hits)-1]["sort"].([]interface{})
+			if !ok || len(lastSort) == 0 {
+				return nil, fmt.Errorf("missing sort values in export batch")
+			}
+			if err := scrollMgr.UpdateScrollContext(scrollID, lastSort); err != nil {
+				return nil, err
+			}
+		}
+		return hits, nil
+	}
+	hits, err := readBatch()
+	if err != nil {
+		if apiErr, ok := err.(common.APIError); ok {
+			common.HandleError(w, apiErr)
+		} else {
+			common.HandleError(w, common.NewInternalServerError(err.Error()))
+		}
+		return
+	}
+
+	prefix := tenantIndexPrefix(r.Context())
+	fileName := strings.TrimPrefix(indexName, prefix) + "." + opts.format
+	if opts.gzip {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+".gz"))
+	} else if opts.format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	var out io.Writer = w
+	var gz *gzip.Writer
+	if opts.gzip {
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+	enc := newExportSearchEncoder(out, opts, prefix)
+
+	var exported int64
+	for {
+		// 每批单独设置写超时：客户端读取慢时阻塞等待（反压），长时间不读取时中断
+		rc.SetWriteDeadline(time.Now().Add(exportSearchWriteTimeout))
+		for _, hit := range hits {
+			if err := enc.encode(hit); err != nil {
+				logger.Error("Failed to export search results of index [%s]: %v", indexName, err)
+				return
+			}
+		}
+		exported += int64(len(hits))
+		if err := enc.flush(); err != nil {
+			logger.Error("Failed to export search results of index [%s]: %v", indexName, err)
+			return
+		}
+		if gz != nil {
+			if err := gz.Flush(); err != nil {
+				logger.Error("Failed to export search results of index [%s]: %v", indexName, err)
+				return
+			}
+		}
+		rc.Flush()
+
+		if len(hits) < opts.batchSize {
+			break
+		}
+		if hits, err = readBatch(); err != nil {
+			logger.Error("Export of index [%s] aborted after %d documents: %v", indexName, exported, err)
+			return
+		}
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			logger.Error("Failed to export search results of index [%s]: %v", indexName, err)
+			return
+		}
+	}
+	logger.Info("Exported %d documents from index [%s] as %s", exported, indexName, opts.format)
+}
+
+// parseExportSearchOptions 解析导出的查询参数，fields 参数优先于请求体中的字段
+func parseExportSearchOptions(r *http.Request, bodyFields []string) (*exportSearchOptions, common.APIError) {
+	q := r.URL.Query()
+	opts := &exportSearchOptions{
+		format:    "ndjson",
+		fields:    bodyFields,
+		delimiter: ',',
+		header:    true,
+		batchSize: exportSearchDefaultBatchSize,
+	}
+	if v := q.Get("format"); v != "" {
+		opts.format = strings.ToLower(v)
+	}
+	if opts.format != "ndjson" && opts.format != "csv" {
+		return nil, common.NewBadRequestError(fmt.Sprintf("unsupported export format [%s], expected [ndjson] or [csv]", q.Get("format")))
+	}
+	if v := q.Get("fields"); v != "" {
+		opts.fields = nil
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				opts.fields = append(opts.fields, field)
+			}
+		}
+	}
+	if opts.format == "csv" && len(opts.fields) == 0 {
+		return nil, common.NewBadRequestError("csv export requires [fields]")
+	}
+	if v := q.Get("delimiter"); v != "" {
+		if v == `\t` {
+			v = "\t"
+		}
+		d, size := utf8.DecodeRuneInString(v)
+		if size != len(v) || d == utf8.RuneError || d == '"' || d == '\r' || d == '\n' {
+			return nil, common.NewBadRequestError(fmt.Sprintf("invalid [delimiter] value [%s], expected a single character", q.Get("delimiter")))
+		}
+		opts.delimiter = d
+	}
+	for name, target := range map[string]*bool{"header": &opts.header, "gzip": &opts.gzip} {
+		if v := q.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, common.NewBadRequestError(fmt.Sprintf("invalid [%s] value [%s]", name, v))
+			}
+			*target = b
+		}
+	}
+	if v := q.Get("batch_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > exportSearchMaxBatchSize {
+			return nil, common.NewBadRequestError(fmt.Sprintf("invalid [batch_size] value [%s], expected 1 to %d", v, exportSearchMaxBatchSize))
+		}
+		opts.batchSize = n
+	}
+	return opts, nil
+}
+
+// exportSearchEncoder 将命中的文档编码为 NDJSON 行或 CSV 记录
+type exportSearchEncoder struct {
+	opts        *exportSearchOptions
+	indexPrefix string // 多租户时从 _index 中去掉的租户前缀
+	json        *json.Encoder
+	csv         *csv.Writer
+	wroteHeader bool
+}
+
+func newExportSearchEncoder(w io.Writer, opts *exportSearchOptions, indexPrefix string) *exportSearchEncoder {
+	e := &exportSearchEncoder{opts: opts, indexPrefix: indexPrefix}
+	if opts.format == "csv" {
+		e.csv = csv.NewWriter(w)
+		e.csv.Comma = opts.delimiter
+	} else {
+		e.json = json.NewEncoder(w)
+	}
+	return e
+}
+
+// encode 写出一个文档：NDJSON 未指定字段时输出 _index、_id 与 _source，指定字段时输出以字段名为键的对象
+func (e *exportSearchEncoder) encode(hit map[string]interface{}) error {
+	if e.csv != nil {
+		if !e.wroteHeader && e.opts.header {
+			if err := e.csv.Write(e.opts.fields); err != nil {
+				return err
+			}
+		}
+		e.wroteHeader = true
+		record := make([]string, len(e.opts.fields))
+		for i, field := range e.opts.fields {
+			record[i] = exportCSVValue(e.fieldValue(hit, field))
+		}
+		return e.csv.Write(record)
+	}
+
+	if len(e.opts.fields) == 0 {
+		line := map[string]interface{}{
+			"_index":  strings.TrimPrefix(fmt.Sprint(hit["_index"]), e.indexPrefix),
+			"_id":     hit["_id"],
+			"_source": hit["_source"],
+		}
+		if routing, ok := hit[routingField]; ok {
+			line[routingField] = routing
+		}
+		return e.json.Encode(line)
+	}
+	line := make(map[string]interface{}, len(e.opts.fields))
+	for _, field := range e.opts.fields {
+		line[field] = e.fieldValue(hit, field)
+	}
+	return e.json.Encode(line)
+}
+
+// fieldValue 读取字段值：元数据字段取自命中结果，其他字段按点号路径取自 _source，多值时返回数组，不存在时返回 nil
+func (e *exportSearchEncoder) fieldValue(hit map[string]interface{}, field string) interface{} {
+	switch field {
+	case "_index":
+		return strings.TrimPrefix(fmt.Sprint(hit["_index"]), e.indexPrefix)
+	case "_id", "_score", routingField:
+		return hit[field]
+	}
+	source, _ := hit["_source"].(map[string]interface{})
+	values := sourceValuesAt(source, field)
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
+	default:
+		return values
+	}
+}
+
+// flush 将 CSV 缓冲写出
+func (e *exportSearchEncoder) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
+
+// exportCSVValue 将字段值转换为 CSV 单元格：字符串原样输出，null 为空，对象与数组输出为 JSON
+func exportCSVValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestExportSearch(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/{index}/_export_search", Handler: docHandler.ExportSearch},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+	})
+	handler := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.Contains(path, "_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/orders", `{"mappings": {"properties": {"region": {"type": "keyword"}, "amount": {"type": "long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var bulk strings.Builder
+	for i := 1; i <= 25; i++ {
+		region := "eu"
+		if i%5 == 0 {
+			region = "us, west"
+		}
+		fmt.Fprintf(&bulk, "{\"index\": {\"_index\": \"orders\", \"_id\": \"%02d\"}}\n", i)
+		fmt.Fprintf(&bulk, "{\"region\": %q, \"amount\": %d, \"customer\": {\"name\": \"c%d\"}, \"tags\": [\"a\", \"b\"]}\n", region, i, i)
+	}
+	if w := do("POST", "/_bulk?refresh=true", bulk.String()); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"errors":true`) {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+	openBefore := GetScrollManager().Stats().Open
+
+	// NDJSON：批次小于结果数时分多批读取，顺序按 _id
+	w := do("POST", "/orders/_export_search?batch_size=10", `{"query": {"range": {"amount": {"gte": 3}}}}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("export ndjson: got %d: %s", w.Code, w.Body.String())
+	}
+	var ids []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var line struct {
+			Index  string                 `json:"_index"`
+			ID     string                 `json:"_id"`
+			Source map[string]interface{} `json:"_source"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.Index != "orders" || line.Source["amount"] == nil {
+			t.Fatalf("Unexpected line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, line.ID)
+	}
+	if len(ids) != 23 || ids[0] != "03" || ids[22] != "25" {
+		t.Fatalf("Expected 23 documents from 03 to 25, got %v", ids)
+	}
+	if open := GetScrollManager().Stats().Open; open != openBefore {
+		t.Errorf("Expected the export scroll context to be cleared, open contexts %d -> %d", openBefore, open)
+	}
+
+	// 字段选择
+	w = do("POST", "/orders/_export_search?fields=_id,customer.name,tags", `{"query": {"term": {"amount": 5}}}`)
+	if got := strings.TrimSpace(w.Body.String()); got != `{"_id":"05","customer.name":"c5","tags":["a","b"]}` {
+		t.Errorf("Unexpected ndjson with fields: %s", got)
+	}
+
+	// CSV：表头、引号转义与自定义分隔符，gzip 压缩
+	w = do("POST", "/orders/_export_search?format=csv&batch_size=7", `{"fields": ["_id", "region", "amount"], "sort": [{"amount": "desc"}], "query": {"range": {"amount": {"gte": 20}}}}`)
+	want := "_id,region,amount\n25,\"us, west\",25\n24,eu,24\n23,eu,23\n22,eu,22\n21,eu,21\n20,\"us, west\",20\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("Unexpected csv (%d):\n%s", w.Code, w.Body.String())
+	}
+	w = do("POST", `/orders/_export_search?format=csv&fields=_id,amount&delimiter=\t&header=false&gzip=true`, `{"query": {"ids": {"values": ["01", "02"]}}}`)
+	if w.Header().Get("Content-Type") != "application/gzip" || !strings.Contains(w.Header().Get("Content-Disposition"), "orders.csv.gz") {
+		t.Fatalf("Unexpected gzip headers: %v", w.Header())
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil || string(data) != "01\t1\n02\t2\n" {
+		t.Errorf("Unexpected gzip csv: %q, %v", data, err)
+	}
+
+	for _, path := range []string{
+		"/orders/_export_search?format=xml",
+		"/orders/_export_search?format=csv",
+		"/orders/_export_search?format=csv&fields=a&delimiter=ab",
+		"/orders/_export_search?batch_size=0",
+	} {
+		if w := do("POST", path, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+	if w := do("POST", "/missing/_export_search", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing index, got %d: %s", w.Code, w.Body.String())
+	}
+}
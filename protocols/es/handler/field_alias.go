@@ -0,0 +1,261 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+)
+
+// 字段别名（ES "type": "alias"）
+// 别名字段不参与索引，查询、聚合、排序中引用别名时在解析阶段改写为目标字段路径。
+
+// extractFieldAliases 从 ES mapping 中提取别名字段（完整路径 -> 目标路径）
+func extractFieldAliases(esMapping map[string]interface{}) map[string]string {
+	aliases := make(map[string]string)
+	if props, ok := esMapping["properties"].(map[string]interface{}); ok {
+		collectFieldAliases(props, "", aliases)
+	}
+	return aliases
+}
+
+func collectFieldAliases(props map[string]interface{}, prefix string, aliases map[string]string) {
+	for name, def := range props {
+		fieldMap, ok := def.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fullName := name
+		if prefix != "" {
+			fullName = prefix + "." + name
+		}
+		if fieldMap["type"] == "alias" {
+			if target, ok := fieldMap["path"].(string); ok && target != "" {
+				aliases[fullName] = target
+			}
+			continue
+		}
+		if sub, ok := fieldMap["properties"].(map[string]interface{}); ok {
+			collectFieldAliases(sub, fullName, aliases)
+		}
+	}
+}
+
+// lookupMappingField 按完整路径查找字段定义（支持 object/nested 以及 multi-fields）
+func lookupMappingField(esMapping map[string]interface{}, path string) (map[string]interface{}, bool) {
+	props, _ := esMapping["properties"].(map[string]interface{})
+	return lookupFieldInProps(props, path)
+}
+
+func lookupFieldInProps(props map[string]interface{}, path string) (map[string]interface{}, bool) {
+	if props == nil {
+		return nil, false
+	}
+	if def, ok := props[path].(map[string]interface{}); ok {
+		return def, true
+	}
+	// 逐级拆分路径：a.b.c 依次尝试 a -> b.c、a.b -> c
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		def, ok := props[path[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rest := path[i+1:]
+		if sub, ok := def["properties"].(map[string]interface{}); ok {
+			if found, ok := lookupFieldInProps(sub, rest); ok {
+				return found, true
+			}
+		}
+		if fields, ok := def["fields"].(map[string]interface{}); ok {
+			if found, ok := fields[rest].(map[string]interface{}); ok {
+				return found, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// validateFieldAliases 校验 mapping 中的别名字段：目标必须存在，且不能是别名或 object/nested
+func validateFieldAliases(esMapping map[string]interface{}) error {
+	aliases := extractFieldAliases(esMapping)
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		target := aliases[name]
+		if target == name {
+			return fmt.Errorf("invalid [path] value [%s] for field alias [%s]: an alias cannot refer to itself", target, name)
+		}
+		def, ok := lookupMappingField(esMapping, target)
+		if !ok {
+			return fmt.Errorf("invalid [path] value [%s] for field alias [%s]: an alias must refer to an existing field in the mappings", target, name)
+		}
+		if def["type"] == "alias" {
+			return fmt.Errorf("invalid [path] value [%s] for field alias [%s]: an alias cannot refer to another alias", target, name)
+		}
+		if isObjectFieldMapping(def) {
+			return fmt.Errorf("invalid [path] value [%s] for field alias [%s]: an alias must refer to a concrete field", target, name)
+		}
+	}
+	return nil
+}
+
+// fieldAliasesForIndex 读取索引的字段别名，没有别名时返回 nil
+func (h *DocumentHandler) fieldAliasesForIndex(indexName string) map[string]string {
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return nil
+	}
+	aliases := extractFieldAliases(indexMeta.Mapping)
+	if len(aliases) == 0 {
+		return nil
+	}
+	return aliases
+}
+
+// newQueryParser 创建绑定了索引字段别名与 mapping 的查询解析器
+func (h *DocumentHandler) newQueryParser(indexName string) *dsl.QueryParser {
+	parser := dsl.NewQueryParser()
+	h.bindQueryMapping(parser, indexName)
+	if aliases := h.fieldAliasesForIndex(indexName); aliases != nil {
+		parser.SetFieldAliases(aliases)
+	}
+	return parser
+}
+
+// rewriteAggregationAliases 将聚合定义中引用别名的 "field" 改写为目标字段（递归处理子聚合）
+func rewriteAggregationAliases(spec interface{}, aliases map[string]string) {
+	switch v := spec.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			switch k {
+			case "field":
+				if field, ok := item.(string); ok {
+					if target, ok := aliases[field]; ok {
+						v[k] = target
+					}
+				}
+			case "filter", "filters":
+				// filter/filters 聚合的内容是查询 DSL
+				v[k] = rewriteQueryAliases(item, aliases)
+			default:
+				rewriteAggregationAliases(item, aliases)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			rewriteAggregationAliases(item, aliases)
+		}
+	}
+}
+
+// rewriteQueryAliases 改写查询 DSL 中以别名为键的字段（用于不经过 QueryParser 字段规范化的场景）
+func rewriteQueryAliases(q interface{}, aliases map[string]string) interface{} {
+	switch v := q.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			if target, ok := aliases[k]; ok {
+				k = target
+			}
+			if (k == "field" || k == "default_field") && item != nil {
+				if field, ok := item.(string); ok {
+					if target, ok := aliases[field]; ok {
+						item = target
+					}
+				}
+			}
+			out[k] = rewriteQueryAliases(item, aliases)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = rewriteQueryAliases(item, aliases)
+		}
+		return out
+	}
+	return q
+}
+
+// rewriteSortAliases 将排序定义中的别名字段改写为目标字段
+// 支持 "field"、{"field": "desc"}、{"field": {"order": "desc"}} 三种形式
+func rewriteSortAliases(sortSpec []interface{}, aliases map[string]string) []interface{} {
+	out := make([]interface{}, len(sortSpec))
+	for i, item := range sortSpec {
+		switch v := item.(type) {
+		case string:
+			if target, ok := aliases[v]; ok {
+				out[i] = target
+				continue
+			}
+			out[i] = v
+		case map[string]interface{}:
+			rewritten := make(map[string]interface{}, len(v))
+			for field, opts := range v {
+				if target, ok := aliases[field]; ok {
+					field = target
+				}
+				rewritten[field] = opts
+			}
+			out[i] = rewritten
+		default:
+			out[i] = item
+		}
+	}
+	return out
+}
+
+// allowUnmappedFieldsSetting 设置项路径（不含 "index." 前缀），为 false 时查询引用未映射的字段返回错误
+const allowUnmappedFieldsSetting = "query.parse.allow_unmapped_fields"
+
+// maxRegexLengthSetting 设置项路径（不含 "index." 前缀），regexp 查询模式的最大长度
+const maxRegexLengthSetting = "max_regex_length"
+
+// bindQueryMapping 为解析器绑定索引的 mapping：查询按字段类型构建，date 字段按 mapping 中的 format 解析，
+// index.query.parse.allow_unmapped_fields 为 false 时启用严格模式，index.max_regex_length 限制 regexp 查询的模式长度
+func (h *DocumentHandler) bindQueryMapping(parser *dsl.QueryParser, indexName string) {
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return
+	}
+	parser.SetMapping(indexMeta.Mapping)
+	now := time.Now()
+	parser.SetDateParser(func(value interface{}, format, timeZone string, roundUp bool) (time.Time, error) {
+		loc, err := parseTimeZone(timeZone)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return parseDateMathBound(value, format, loc, now, roundUp)
+	})
+	if v, ok := lookupIndexSetting(indexMeta.Settings, allowUnmappedFieldsSetting); ok {
+		if allow, err := parseSettingBool(v); err == nil && !allow {
+			parser.SetStrictFields(true)
+		}
+	}
+	if v, ok := lookupIndexSetting(indexMeta.Settings, maxRegexLengthSetting); ok {
+		if n, err := parseIndexIntSetting(v, maxRegexLengthSetting); err == nil {
+			parser.SetMaxRegexLength(n)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_FieldAlias(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// 目标字段不存在时拒绝创建
+	w := do("PUT", "/bad_alias", `{"mappings":{"properties":{"a":{"type":"alias","path":"missing"}}}}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "mapper_parsing_exception") {
+		t.Fatalf("invalid alias: expected 400 mapper_parsing_exception, got %d: %s", w.Code, w.Body.String())
+	}
+
+	createBody := `{"mappings":{"properties":{
+		"user_name":{"type":"keyword"},
+		"uname":{"type":"alias","path":"user_name"}
+	}}}`
+	if w := do("PUT", "/aliased", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	for id, name := range map[string]string{"1": "alice", "2": "bob"} {
+		if w := do("PUT", "/aliased/_doc/"+id+"?refresh=true", `{"user_name":"`+name+`"}`); w.Code >= 300 {
+			t.Fatalf("index doc %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	// 写入别名字段报错
+	if w := do("PUT", "/aliased/_doc/3", `{"uname":"carol"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("writing to alias: expected 400 got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", "/aliased/_search", `{
+		"query":{"term":{"uname":"alice"}},
+		"sort":[{"uname":"asc"}],
+		"aggs":{"names":{"terms":{"field":"uname"}}}
+	}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+		Aggregations map[string]struct {
+			Buckets []map[string]interface{} `json:"buckets"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode search response: %v", err)
+	}
+	if len(resp.Hits.Hits) != 1 || resp.Hits.Hits[0].ID != "1" {
+		t.Fatalf("term query on alias should match doc 1, got %s", w.Body.String())
+	}
+	if buckets := resp.Aggregations["names"].Buckets; len(buckets) != 1 || buckets[0]["key"] != "alice" {
+		t.Fatalf("terms agg on alias should use target field, got %s", w.Body.String())
+	}
+}
+
+func TestRewriteSortAliases(t *testing.T) {
+	aliases := map[string]string{"a": "b"}
+	out := rewriteSortAliases([]interface{}{"a", map[string]interface{}{"a": "desc"}, "c"}, aliases)
+	if out[0] != "b" || out[2] != "c" {
+		t.Fatalf("unexpected rewrite: %v", out)
+	}
+	if _, ok := out[1].(map[string]interface{})["b"]; !ok {
+		t.Fatalf("object sort not rewritten: %v", out[1])
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 字段能力（_field_caps）
+// 字段类型与 searchable/aggregatable 由索引 mapping 推导，mapping 中不存在但已写入索引的字段按词项推断类型。
+// 同一字段在不同索引中类型不同时按类型分组，并通过 indices 列出各类型所属索引。
+
+// fieldCapability 单个索引中字段的能力
+type fieldCapability struct {
+	Type         string
+	Searchable   bool
+	Aggregatable bool
+}
+
+// metaFieldCaps 元数据字段（与 ES 7.x 一致）
+var metaFieldCaps = map[string]fieldCapability{
+	"_id":      {Type: "_id", Searchable: true, Aggregatable: true},
+	"_index":   {Type: "_index", Searchable: true, Aggregatable: true},
+	"_type":    {Type: "_type", Searchable: true, Aggregatable: true},
+	"_source":  {Type: "_source", Searchable: false, Aggregatable: false},
+	"_routing": {Type: "_routing", Searchable: true, Aggregatable: false},
+	"_seq_no":  {Type: "_seq_no", Searchable: true, Aggregatable: true},
+}
+
+// FieldCaps 获取字段能力
+// GET/POST /_field_caps, GET/POST /{index}/_field_caps
+func (h *IndexHandler) FieldCaps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// fields 可以来自查询参数或请求体
+	var patterns []string
+	if fields := query.Get("fields"); fields != "" {
+		patterns = splitCommaList(fields)
+	}
+	if r.Method == http.MethodPost && r.Body != nil {
+		var body struct {
+			Fields interface{} `json:"fields"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+			return
+		}
+		switch f := body.Fields.(type) {
+		case string:
+			patterns = append(patterns, splitCommaList(f)...)
+		case []interface{}:
+			for _, item := range f {
+				if s, ok := item.(string); ok {
+					patterns = append(patterns, splitCommaList(s)...)
+				}
+			}
+		}
+	}
+	if len(patterns) == 0 {
+		common.HandleError(w, common.NewBadRequestError("specified fields can't be null or empty"))
+		return
+	}
+
+	indexNames, apiErr := h.resolveIndexPattern(r, mux.Vars(r)["index"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	// 收集每个索引的字段能力
+	perIndex := make(map[string]map[string]fieldCapability, len(indexNames))
+	for _, indexName := range indexNames {
+		perIndex[indexName] = filterFieldCaps(requestIndexAccess(r.Context(), indexName), h.indexFieldCaps(indexName))
+	}
+
+	response := map[string]interface{}{
+		"indices": indexNames,
+		"fields":  mergeFieldCaps(indexNames, perIndex, patterns),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode field caps response: %v", err)
+	}
+}
+
+// resolveIndexPattern 解析读取元数据的 API 的索引表达式（见 index_expression.go），跳过禁止读取元数据的索引
+func (h *IndexHandler) resolveIndexPattern(r *http.Request, indexExpr string) ([]string, common.APIError) {
+	indexNames, apiErr := h.resolveIndices(r, indexExpr, defaultIndicesOptions)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	readable := make([]string, 0, len(indexNames))
+	for _, name := range indexNames {
+		if checkIndexBlock(h.metaStore, name, blockLevelMetadataRead) == nil {
+			readable = append(readable, name)
+		}
+	}
+	sort.Strings(readable)
+	return readable, nil
+}
+
+// indexFieldCaps 计算单个索引的字段能力
+func (h *IndexHandler) indexFieldCaps(indexName string) map[string]fieldCapability {
+	caps := make(map[string]fieldCapability)
+	for name, c := range metaFieldCaps {
+		caps[name] = c
+	}
+
+	if meta, err := h.metaStore.GetIndexMetadata(indexName); err == nil && meta != nil {
+		if props, ok := meta.Mapping["properties"].(map[string]interface{}); ok {
+			aliases := make(map[string]string)
+			collectFieldCaps(props, "", caps, aliases)
+			// 别名字段使用目标字段的能力
+			for alias, target := range aliases {
+				if c, ok := caps[target]; ok {
+					caps[alias] = c
+				}
+			}
+		}
+	}
+
+	// 已写入索引但不在 mapping 中的字段
+	unmapped, err := h.UnmappedIndexFields(indexName)
+	if err != nil {
+		return caps
+	}
+	for field, fieldType := range unmapped {
+		if _, ok := caps[field]; ok {
+			continue
+		}
+		caps[field] = fieldCapability{
+			Type:         fieldType,
+			Searchable:   true,
+			Aggregatable: fieldType != "text",
+		}
+	}
+	return caps
+}
+
+// collectFieldCaps 递归收集 mapping 中字段（含 object 子字段与 multi-fields）的能力
+func collectFieldCaps(props map[string]interface{}, prefix string, caps map[string]fieldCapability, aliases map[string]string) {
+	for name, def := range props {
+		fieldMap, ok := def.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fullName := name
+		if prefix != "" {
+			fullName = prefix + "." + name
+		}
+
+		fieldType, _ := fieldMap["type"].(string)
+		subProps, hasProps := fieldMap["properties"].(map[string]interface{})
+		if fieldType == "" {
+			if hasProps {
+				fieldType = "object"
+			} else {
+				fieldType = "text"
+			}
+		}
+
+		if fieldType == "alias" {
+			if target, ok := fieldMap["path"].(string); ok && target != "" {
+				aliases[fullName] = target
+			}
+			continue
+		}
+
+		caps[fullName] = mappingFieldCapability(fieldType, fieldMap)
+		if hasProps {
+			collectFieldCaps(subProps, fullName, caps, aliases)
+		}
+		if multiFields, ok := fieldMap["fields"].(map[string]interface{}); ok {
+			collectFieldCaps(multiFields, fullName, caps, aliases)
+		}
+	}
+}
+
+// mappingFieldCapability 由字段定义推导 searchable/aggregatable
+func mappingFieldCapability(fieldType string, fieldMap map[string]interface{}) fieldCapability {
+	c := fieldCapability{Type: fieldType, Searchable: true, Aggregatable: true}
+	switch fieldType {
+	case "object", "nested":
+		c.Searchable = false
+		c.Aggregatable = false
+		return c
+	case "binary":
+		c.Searchable = false
+		c.Aggregatable = false
+		return c
+	case "text", "match_only_text", "search_as_you_type", "annotated_text":
+		// text 字段只有开启 fielddata 时才可聚合
+		fielddata, _ := fieldMap["fielddata"].(bool)
+		c.Aggregatable = fielddata
+	case "geo_shape", "percolator", "sparse_vector", "rank_features":
+		c.Aggregatable = false
+	default:
+		if docValues, ok := fieldMap["doc_values"].(bool); ok && !docValues {
+			c.Aggregatable = false
+		}
+	}
+	if index, ok := fieldMap["index"].(bool); ok && !index {
+		c.Searchable = false
+	}
+	return c
+}
+
+// mergeFieldCaps 合并各索引的字段能力，生成 ES 响应中的 fields 部分
+func mergeFieldCaps(indexNames []string, perIndex map[string]map[string]fieldCapability, patterns []string) map[string]interface{} {
+	// field -> type -> 拥有该类型的索引
+	byType := make(map[string]map[string][]string)
+	for _, indexName := range indexNames {
+		for field, c := range perIndex[indexName] {
+			if !matchFieldPatterns(patterns, field) {
+				continue
+			}
+			if byType[field] == nil {
+				byType[field] = make(map[string][]string)
+			}
+			byType[field][c.Type] = append(byType[field][c.Type], indexName)
+		}
+	}
+
+	result := make(map[string]interface{}, len(byType))
+	for field, types := range byType {
+		entries := make(map[string]interface{}, len(types))
+		for fieldType, indices := range types {
+			var nonSearchable, nonAggregatable []string
+			for _, indexName := range indices {
+				c := perIndex[indexName][field]
+				if !c.Searchable {
+					nonSearchable = append(nonSearchable, indexName)
+				}
+				if !c.Aggregatable {
+					nonAggregatable = append(nonAggregatable, indexName)
+				}
+			}
+			entry := map[string]interface{}{
+				"type":         fieldType,
+				"searchable":   len(nonSearchable) == 0,
+				"aggregatable": len(nonAggregatable) == 0,
+			}
+			// 类型冲突时列出该类型所属索引
+			if len(types) > 1 {
+				entry["indices"] = indices
+			}
+			// 部分索引不可搜索/不可聚合时列出这些索引
+			if len(nonSearchable) > 0 && len(nonSearchable) < len(indices) {
+				entry["non_searchable_indices"] = nonSearchable
+			}
+			if len(nonAggregatable) > 0 && len(nonAggregatable) < len(indices) {
+				entry["non_aggregatable_indices"] = nonAggregatable
+			}
+			entries[fieldType] = entry
+		}
+		result[field] = entries
+	}
+	return result
+}
+
+// matchFieldPatterns 判断字段是否匹配任一字段模式（支持 * 通配符）
+func matchFieldPatterns(patterns []string, field string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == field {
+			return true
+		}
+		if strings.Contains(pattern, "*") && simpleWildcardMatch(pattern, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCommaList 拆分逗号分隔的列表，忽略空白项
+func splitCommaList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestFieldCaps(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_field_caps", Handler: indexHandler.FieldCaps},
+		{Method: "POST", Path: "/_field_caps", Handler: indexHandler.FieldCaps},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	mappingA := `{"mappings":{"properties":{
+		"status":{"type":"keyword"},
+		"title":{"type":"text","fields":{"raw":{"type":"keyword"}}},
+		"user":{"properties":{"name":{"type":"keyword","index":false}}},
+		"author":{"type":"alias","path":"user.name"}
+	}}}`
+	mappingB := `{"mappings":{"properties":{
+		"status":{"type":"long"},
+		"title":{"type":"text"},
+		"user":{"properties":{"name":{"type":"keyword"}}}
+	}}}`
+	for name, mapping := range map[string]string{"logs-a": mappingA, "logs-b": mappingB} {
+		if w := do("PUT", "/"+name, mapping); w.Code != http.StatusOK {
+			t.Fatalf("create index %s: expected 200 got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	type capEntry struct {
+		Type                   string   `json:"type"`
+		Searchable             bool     `json:"searchable"`
+		Aggregatable           bool     `json:"aggregatable"`
+		Indices                []string `json:"indices"`
+		NonSearchableIndices   []string `json:"non_searchable_indices"`
+		NonAggregatableIndices []string `json:"non_aggregatable_indices"`
+	}
+	type capsResponse struct {
+		Indices []string                       `json:"indices"`
+		Fields  map[string]map[string]capEntry `json:"fields"`
+	}
+	decode := func(w *httptest.ResponseRecorder) capsResponse {
+		if w.Code != http.StatusOK {
+			t.Fatalf("field caps: expected 200 got %d: %s", w.Code, w.Body.String())
+		}
+		var resp capsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+
+	resp := decode(do("GET", "/logs-*/_field_caps?fields=*", ""))
+	if len(resp.Indices) != 2 || resp.Indices[0] != "logs-a" || resp.Indices[1] != "logs-b" {
+		t.Errorf("indices = %v, want [logs-a logs-b]", resp.Indices)
+	}
+
+	// 类型冲突：按类型分组并列出所属索引
+	status := resp.Fields["status"]
+	if len(status) != 2 || len(status["keyword"].Indices) != 1 || status["keyword"].Indices[0] != "logs-a" ||
+		len(status["long"].Indices) != 1 || status["long"].Indices[0] != "logs-b" {
+		t.Errorf("status caps = %+v", status)
+	}
+
+	title := resp.Fields["title"]["text"]
+	if !title.Searchable || title.Aggregatable || title.Indices != nil {
+		t.Errorf("title caps = %+v, want searchable, not aggregatable", title)
+	}
+	if raw := resp.Fields["title.raw"]["keyword"]; !raw.Aggregatable {
+		t.Errorf("title.raw caps = %+v, want aggregatable keyword", raw)
+	}
+	if obj := resp.Fields["user"]["object"]; obj.Searchable || obj.Aggregatable {
+		t.Errorf("user caps = %+v, want object", obj)
+	}
+
+	// 部分索引不可搜索
+	name := resp.Fields["user.name"]["keyword"]
+	if name.Searchable || len(name.NonSearchableIndices) != 1 || name.NonSearchableIndices[0] != "logs-a" {
+		t.Errorf("user.name caps = %+v", name)
+	}
+	if author := resp.Fields["author"]["keyword"]; author.Type != "keyword" {
+		t.Errorf("author alias caps = %+v", resp.Fields["author"])
+	}
+	if id := resp.Fields["_id"]["_id"]; !id.Searchable {
+		t.Errorf("_id caps = %+v", id)
+	}
+
+	// 字段过滤与请求体 fields
+	resp = decode(do("POST", "/_field_caps", `{"fields":["title*"]}`))
+	if len(resp.Fields) != 2 || resp.Fields["title"] == nil || resp.Fields["title.raw"] == nil {
+		t.Errorf("filtered fields = %v, want title and title.raw", resp.Fields)
+	}
+
+	// 动态字段
+	if w := do("PUT", "/logs-b/_doc/1?refresh=true", `{"status":200,"message":"hello"}`); w.Code >= 300 {
+		t.Fatalf("index doc: got %d: %s", w.Code, w.Body.String())
+	}
+	resp = decode(do("GET", "/logs-b/_field_caps?fields=message", ""))
+	if _, ok := resp.Fields["message"]; !ok {
+		t.Errorf("expected dynamic field message, got %v", resp.Fields)
+	}
+
+	if w := do("GET", "/missing/_field_caps?fields=*", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing index: expected 404 got %d", w.Code)
+	}
+	if w := do("GET", "/missing/_field_caps?fields=*&ignore_unavailable=true", ""); w.Code != http.StatusOK {
+		t.Errorf("ignore_unavailable: expected 200 got %d", w.Code)
+	}
+	if w := do("GET", "/logs-a/_field_caps", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("missing fields: expected 400 got %d", w.Code)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/geo"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// geo_point 聚合：geohash_grid、geotile_grid 网格分桶，geo_bounds、geo_centroid 指标
+// 坐标从存储字段读取（geo_point 字段默认存储），每个文档的多个坐标分别计入
+
+const (
+	defaultGeohashPrecision = 5
+	maxGeohashPrecision     = 12
+	defaultGeotilePrecision = 7
+	maxGeotilePrecision     = 29
+	defaultGeoGridSize      = 10000
+
+	// maxGeoAggregationDocs 参与计算的最大文档数，与 composite 聚合相同
+	maxGeoAggregationDocs = 100000
+
+	// maxGeotileLatitude Web Mercator 投影的纬度范围
+	maxGeotileLatitude = 85.05112878
+)
+
+// GeoAggregationInfo geo聚合信息
+type GeoAggregationInfo struct {
+	Aggregations map[string]*GeoAggregationConfig
+}
+
+// GeoAggregationConfig geo聚合配置
+// ES格式: {"geohash_grid": {"field": "location", "precision": 5}}、{"geo_centroid": {"field": "location"}}
+type GeoAggregationConfig struct {
+	Type            string // geohash_grid, geotile_grid, geo_bounds, geo_centroid
+	Field           string
+	Precision       int                               // 网格精度
+	Size            int                               // 网格桶数上限（默认10000）
+	SubAggregations map[string]map[string]interface{} // 网格桶的子聚合配置
+}
+
+// parseGeoAggregation 解析geo聚合
+func (h *DocumentHandler) parseGeoAggregation(aggType string, config map[string]interface{}, subAggs map[string]map[string]interface{}) (*GeoAggregationConfig, error) {
+	field, ok := config["field"].(string)
+	if !ok || field == "" {
+		return nil, fmt.Errorf("%s aggregation requires a 'field' parameter", aggType)
+	}
+	geoConfig := &GeoAggregationConfig{Type: aggType, Field: field, Size: defaultGeoGridSize}
+
+	switch aggType {
+	case "geohash_grid", "geotile_grid":
+		geoConfig.SubAggregations = subAggs
+		defaultPrecision, maxPrecision, minPrecision := defaultGeohashPrecision, maxGeohashPrecision, 1
+		if aggType == "geotile_grid" {
+			defaultPrecision, maxPrecision, minPrecision = defaultGeotilePrecision, maxGeotilePrecision, 0
+		}
+		geoConfig.Precision = defaultPrecision
+		if v, ok := config["precision"]; ok {
+			precision, ok := v.(float64)
+			if !ok || precision != math.Trunc(precision) || int(precision) < minPrecision || int(precision) > maxPrecision {
+				return nil, fmt.Errorf("[precision] for %s must be an integer between %d and %d, got [%v]", aggType, minPrecision, maxPrecision, v)
+			}
+			geoConfig.Precision = int(precision)
+		}
+		if size, ok := config["size"].(float64); ok && size > 0 {
+			geoConfig.Size = int(size)
+		}
+	}
+	return geoConfig, nil
+}
+
+// buildGeoAggregations 构建geo聚合响应（所有geo聚合共用一次字段获取）
+func (h *DocumentHandler) buildGeoAggregations(ctx context.Context, info *GeoAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+	aggs := make(map[string]interface{}, len(info.Aggregations))
+
+	fields := make([]string, 0, len(info.Aggregations))
+	seen := make(map[string]bool)
+	for _, geoAgg := range info.Aggregations {
+		if !seen[geoAgg.Field] {
+			seen[geoAgg.Field] = true
+			fields = append(fields, geoAgg.Field)
+		}
+	}
+	req := bleve.NewSearchRequest(baseQuery)
+	req.Size = maxGeoAggregationDocs
+	req.Fields = fields
+	result, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		logger.Warn("Failed to fetch geo points for aggregations: %v", err)
+		for aggName, geoAgg := range info.Aggregations {
+			aggs[aggName] = emptyGeoAggregation(geoAgg.Type)
+		}
+		return aggs
+	}
+	if result.Total > maxGeoAggregationDocs {
+		logger.Warn("buildGeoAggregations: document count (%d) exceeds max limit (%d), will process first %d documents only", result.Total, maxGeoAggregationDocs, maxGeoAggregationDocs)
+	}
+
+	for aggName, geoAgg := range info.Aggregations {
+		switch geoAgg.Type {
+		case "geohash_grid", "geotile_grid":
+			aggs[aggName] = h.buildGeoGridAggregation(ctx, aggName, geoAgg, result, idx)
+		case "geo_bounds":
+			aggs[aggName] = buildGeoBounds(geoAgg.Field, result)
+		case "geo_centroid":
+			aggs[aggName] = buildGeoCentroid(geoAgg.Field, result)
+		}
+	}
+	return aggs
+}
+
+// emptyGeoAggregation 没有坐标时的聚合结果
+func emptyGeoAggregation(aggType string) map[string]interface{} {
+	switch aggType {
+	case "geo_bounds":
+		return map[string]interface{}{}
+	case "geo_centroid":
+		return map[string]interface{}{"count": 0}
+	default:
+		return map[string]interface{}{"buckets": []interface{}{}}
+	}
+}
+
+// buildGeoGridAggregation 按网格单元统计文档数，按文档数降序、单元键升序排列
+// 子聚合在网格单元内的文档上执行
+func (h *DocumentHandler) buildGeoGridAggregation(ctx context.Context, aggName string, geoAgg *GeoAggregationConfig, result *bleve.SearchResult, idx bleve.Index) map[string]interface{} {
+	cellDocs := make(map[string][]string)
+	for _, hit := range result.Hits {
+		seen := make(map[string]bool)
+		for _, point := range extractGeoPoints(hit.Fields[geoAgg.Field]) {
+			var cell string
+			if geoAgg.Type == "geotile_grid" {
+				cell = geotileKey(point[0], point[1], geoAgg.Precision)
+			} else {
+				cell = geo.EncodeGeoHash(point[1], point[0])[:geoAgg.Precision]
+			}
+			if !seen[cell] {
+				seen[cell] = true
+				cellDocs[cell] = append(cellDocs[cell], hit.ID)
+			}
+		}
+	}
+
+	cells := make([]string, 0, len(cellDocs))
+	for cell := range cellDocs {
+		cells = append(cells, cell)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if len(cellDocs[cells[i]]) != len(cellDocs[cells[j]]) {
+			return len(cellDocs[cells[i]]) > len(cellDocs[cells[j]])
+		}
+		return cells[i] < cells[j]
+	})
+	if len(cells) > geoAgg.Size {
+		cells = cells[:geoAgg.Size]
+	}
+
+	buckets := make([]map[string]interface{}, 0, len(cells))
+	var bucketTasks []func()
+	for _, cell := range cells {
+		bucket := map[string]interface{}{
+			"key":       cell,
+			"doc_count": len(cellDocs[cell]),
+		}
+		if len(geoAgg.SubAggregations) > 0 {
+			bucketQuery := query.NewDocIDQuery(cellDocs[cell])
+			bucketTasks = append(bucketTasks, func() {
+				if subAggResults := h.buildNestedAggregationsForBucket(ctx, aggName, cell, geoAgg.SubAggregations, idx, bucketQuery); len(subAggResults) > 0 {
+					bucket["aggregations"] = subAggResults
+				}
+			})
+		}
+		buckets = append(buckets, bucket)
+	}
+	aggPool.run(bucketTasks)
+
+	return map[string]interface{}{"buckets": buckets}
+}
+
+// buildGeoBounds 计算包含所有坐标的矩形（不处理跨越 180 度经线的情况）
+func buildGeoBounds(field string, result *bleve.SearchResult) map[string]interface{} {
+	minLon, minLat := math.Inf(1), math.Inf(1)
+	maxLon, maxLat := math.Inf(-1), math.Inf(-1)
+	found := false
+	for _, hit := range result.Hits {
+		for _, point := range extractGeoPoints(hit.Fields[field]) {
+			found = true
+			minLon, maxLon = math.Min(minLon, point[0]), math.Max(maxLon, point[0])
+			minLat, maxLat = math.Min(minLat, point[1]), math.Max(maxLat, point[1])
+		}
+	}
+	if !found {
+		return emptyGeoAggregation("geo_bounds")
+	}
+	return map[string]interface{}{
+		"bounds": map[string]interface{}{
+			"top_left":     map[string]interface{}{"lat": maxLat, "lon": minLon},
+			"bottom_right": map[string]interface{}{"lat": minLat, "lon": maxLon},
+		},
+	}
+}
+
+// buildGeoCentroid 计算所有坐标的算术平均中心
+func buildGeoCentroid(field string, result *bleve.SearchResult) map[string]interface{} {
+	var sumLon, sumLat float64
+	count := 0
+	for _, hit := range result.Hits {
+		for _, point := range extractGeoPoints(hit.Fields[field]) {
+			sumLon += point[0]
+			sumLat += point[1]
+			count++
+		}
+	}
+	if count == 0 {
+		return emptyGeoAggregation("geo_centroid")
+	}
+	return map[string]interface{}{
+		"location": map[string]interface{}{"lat": sumLat / float64(count), "lon": sumLon / float64(count)},
+		"count":    count,
+	}
+}
+
+// extractGeoPoints 从存储字段值中提取 [lon, lat] 坐标，多值字段返回多个坐标
+func extractGeoPoints(value interface{}) [][2]float64 {
+	if value == nil {
+		return nil
+	}
+	if lon, lat, ok := geo.ExtractGeoPoint(value); ok {
+		return [][2]float64{{lon, lat}}
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+	var points [][2]float64
+	for i := 0; i < rv.Len(); i++ {
+		points = append(points, extractGeoPoints(rv.Index(i).Interface())...)
+	}
+	return points
+}
+
+// geotileKey 返回坐标所在的 Web Mercator 瓦片键 "zoom/x/y"
+func geotileKey(lon, lat float64, zoom int) string {
+	tiles := 1 << uint(zoom)
+	lat = math.Max(-maxGeotileLatitude, math.Min(maxGeotileLatitude, lat))
+	x := int(math.Floor((lon + 180) / 360 * float64(tiles)))
+	latRad := lat * math.Pi / 180
+	y := int(math.Floor((1 - math.Asinh(math.Tan(latRad))/math.Pi) / 2 * float64(tiles)))
+	x = max(0, min(tiles-1, x))
+	y = max(0, min(tiles-1, y))
+	return fmt.Sprintf("%d/%d/%d", zoom, x, y)
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_GeoAggregations(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/places", `{"mappings":{"properties":{"location":{"type":"geo_point"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	// 坐标使用 ES 支持的多种格式
+	docs := []string{
+		`{"location":{"lat":52.37,"lon":4.89}}`,   // 阿姆斯特丹
+		`{"location":"52.38,4.91"}`,               // 阿姆斯特丹
+		`{"location":[2.35,48.86]}`,               // 巴黎
+		`{"location":{"lat":40.71,"lon":-74.01}}`, // 纽约
+	}
+	for i, doc := range docs {
+		if w := do("PUT", fmt.Sprintf("/places/_doc/%d?refresh=true", i), doc); w.Code >= 300 {
+			t.Fatalf("index %d: got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("POST", "/places/_search", `{"size":0,"aggs":{
+		"cells":{"geohash_grid":{"field":"location","precision":3},"aggs":{"center":{"geo_centroid":{"field":"location"}}}},
+		"tiles":{"geotile_grid":{"field":"location","precision":2}},
+		"bounds":{"geo_bounds":{"field":"location"}},
+		"center":{"geo_centroid":{"field":"location"}}
+	}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+	}
+
+	type latLon struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	type centroid struct {
+		Location latLon `json:"location"`
+		Count    int    `json:"count"`
+	}
+	type bucket struct {
+		Key          string `json:"key"`
+		DocCount     int    `json:"doc_count"`
+		Aggregations struct {
+			Center centroid `json:"center"`
+		} `json:"aggregations"`
+	}
+	var resp struct {
+		Aggregations struct {
+			Cells struct {
+				Buckets []bucket `json:"buckets"`
+			} `json:"cells"`
+			Tiles struct {
+				Buckets []bucket `json:"buckets"`
+			} `json:"tiles"`
+			Bounds struct {
+				Bounds struct {
+					TopLeft     latLon `json:"top_left"`
+					BottomRight latLon `json:"bottom_right"`
+				} `json:"bounds"`
+			} `json:"bounds"`
+			Center centroid `json:"center"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-4 }
+
+	bucketKeys := func(buckets []bucket) []string {
+		keys := make([]string, 0, len(buckets))
+		for _, b := range buckets {
+			keys = append(keys, fmt.Sprintf("%s:%d", b.Key, b.DocCount))
+		}
+		return keys
+	}
+	cells := resp.Aggregations.Cells.Buckets
+	if got, want := bucketKeys(cells), []string{"u17:2", "dr5:1", "u09:1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("geohash_grid: expected %v, got %v", want, got)
+	}
+	if c := cells[0].Aggregations.Center; c.Count != 2 || !near(c.Location.Lat, 52.375) || !near(c.Location.Lon, 4.9) {
+		t.Fatalf("geohash_grid sub geo_centroid: unexpected %+v", c)
+	}
+	if got, want := bucketKeys(resp.Aggregations.Tiles.Buckets), []string{"2/2/1:3", "2/1/1:1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("geotile_grid: expected %v, got %v", want, got)
+	}
+
+	b := resp.Aggregations.Bounds.Bounds
+	if !near(b.TopLeft.Lat, 52.38) || !near(b.TopLeft.Lon, -74.01) || !near(b.BottomRight.Lat, 40.71) || !near(b.BottomRight.Lon, 4.91) {
+		t.Fatalf("geo_bounds: unexpected %+v", b)
+	}
+	c := resp.Aggregations.Center
+	if c.Count != 4 || !near(c.Location.Lat, (52.37+52.38+48.86+40.71)/4) || !near(c.Location.Lon, (4.89+4.91+2.35-74.01)/4) {
+		t.Fatalf("geo_centroid: unexpected %+v", c)
+	}
+
+	if w := do("POST", "/places/_search", `{"size":0,"query":{"match_none":{}},"aggs":{"bounds":{"geo_bounds":{"field":"location"}},"center":{"geo_centroid":{"field":"location"}}}}`); !strings.Contains(w.Body.String(), `"aggregations":{"bounds":{},"center":{"count":0}}`) {
+		t.Fatalf("expected empty geo metrics, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,456 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 索引导出与导入
+// POST /{index}/_export 以 tar.gz 流式输出索引：metadata.json（mapping/settings/别名）、store/ 下的段文件与
+// bleve 元数据，最后是 manifest.json（格式版本与每个文件的大小、SHA-256）。段文件取自一致快照，
+// 先硬链接到数据目录下的临时目录再打包，导出期间不阻塞写入。
+// POST /_import 上传导出的归档并注册为新索引：解压到临时目录，按 manifest 校验文件完整性后移入索引目录。
+// 查询参数 index 指定导入后的索引名（默认使用归档中的名称），include_aliases=false 时不恢复别名。
+// 多租户请求导出时去掉、导入时加上租户前缀，归档可在租户与实例之间迁移。
+// 大于 max_request_size 的归档需要通过路由规则为 /_import 放宽请求体限制。
+
+const (
+	indexArchiveFormatVersion = 1
+	indexArchiveManifestFile  = "manifest.json"
+	indexArchiveMetadataFile  = "metadata.json"
+)
+
+// indexArchiveManifest 归档清单
+type indexArchiveManifest struct {
+	FormatVersion int                `json:"format_version"`
+	Index         string             `json:"index"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Files         []indexArchiveFile `json:"files"`
+}
+
+// indexArchiveFile 归档中的文件及其校验和
+type indexArchiveFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ExportIndex 导出索引归档
+// POST /{index}/_export
+func (h *IndexHandler) ExportIndex(w http.ResponseWriter, r *http.Request) {
+	indexName := mux.Vars(r)["index"]
+	if !h.dirMgr.IndexExists(indexName) {
+		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+		return
+	}
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelRead); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if h.indexMgr == nil {
+		common.HandleError(w, common.NewInternalServerError("index manager is not available"))
+		return
+	}
+
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		common.HandleError(w, common.NewInternalServerError(fmt.Sprintf("failed to get index metadata: %v", err)))
+		return
+	}
+	prefix := tenantIndexPrefix(r.Context())
+	metaBytes, err := json.Marshal(renameIndexMetadata(indexMeta, strings.TrimPrefix(indexName, prefix), func(alias string) string {
+		return strings.TrimPrefix(alias, prefix)
+	}))
+	if err != nil {
+		common.HandleError(w, common.NewInternalServerError("failed to encode index metadata: "+err.Error()))
+		return
+	}
+
+	idx, err := h.indexMgr.GetIndex(indexName)
+	if err != nil {
+		common.HandleError(w, common.NewInternalServerError(fmt.Sprintf("failed to open index [%s]: %v", indexName, err)))
+		return
+	}
+	copyable, ok := idx.(bleve.IndexCopyable)
+	if !ok {
+		common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("index [%s] does not support export", indexName)))
+		return
+	}
+	tmpDir, err := os.MkdirTemp(h.dirMgr.GetBaseDir(), ".export-")
+	if err != nil {
+		common.HandleError(w, common.NewInternalServerError("failed to create export directory: "+err.Error()))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := copyable.CopyTo(bleve.HardLinkDirectory(filepath.Join(tmpDir, "store"))); err != nil {
+		logger.Error("Failed to copy index [%s] for export: %v", indexName, err)
+		common.HandleError(w, common.NewInternalServerError("failed to copy index files: "+err.Error()))
+		return
+	}
+	files, err := listArchiveFiles(tmpDir)
+	if err != nil {
+		common.HandleError(w, common.NewInternalServerError("failed to list index files: "+err.Error()))
+		return
+	}
+
+	// 响应头写出后出错只能中断输出，导入时因缺少 manifest 或校验失败而拒绝
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.TrimPrefix(indexName, prefix)+".tar.gz"))
+	w.WriteHeader(http.StatusOK)
+	if err := writeIndexArchive(w, strings.TrimPrefix(indexName, prefix), metaBytes, tmpDir, files); err != nil {
+		logger.Error("Failed to export index [%s]: %v", indexName, err)
+		return
+	}
+	logger.Info("Exported index [%s] (%d files)", indexName, len(files)+1)
+}
+
+// listArchiveFiles 列出目录下的所有文件（相对路径，按名称排序）
+func listArchiveFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// writeIndexArchive 写出 tar.gz 归档：metadata.json、索引文件，最后是 manifest.json
+func writeIndexArchive(w io.Writer, indexName string, metaBytes []byte, dir string, files []string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := indexArchiveManifest{
+		FormatVersion: indexArchiveFormatVersion,
+		Index:         indexName,
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	entry, err := writeArchiveEntry(tw, indexArchiveMetadataFile, int64(len(metaBytes)), bytes.NewReader(metaBytes))
+	if err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, entry)
+	for _, name := range files {
+		if err := func() error {
+			f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			entry, err := writeArchiveEntry(tw, name, info.Size(), f)
+			if err != nil {
+				return err
+			}
+			manifest.Files = append(manifest.Files, entry)
+			return nil
+		}(); err != nil {
+			return err
+		}
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := writeArchiveEntry(tw, indexArchiveManifestFile, int64(len(manifestBytes)), bytes.NewReader(manifestBytes)); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeArchiveEntry 写出一个归档文件并计算其 SHA-256
+func writeArchiveEntry(tw *tar.Writer, name string, size int64, r io.Reader) (indexArchiveFile, error) {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return indexArchiveFile{}, err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tw, hash), io.LimitReader(r, size))
+	if err != nil {
+		return indexArchiveFile{}, err
+	}
+	if n != size {
+		return indexArchiveFile{}, fmt.Errorf("file [%s] changed during export", name)
+	}
+	return indexArchiveFile{Path: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// ImportIndex 导入索引归档
+// POST /_import
+func (h *IndexHandler) ImportIndex(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	includeAliases := true
+	if v := query.Get("include_aliases"); v != "" {
+		b, err := parseSettingBool(v)
+		if err != nil {
+			common.HandleError(w, common.NewBadRequestError(err.Error()))
+			return
+		}
+		includeAliases = b
+	}
+	if h.indexMgr == nil {
+		common.HandleError(w, common.NewInternalServerError("index manager is not available"))
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp(h.dirMgr.GetBaseDir(), ".import-")
+	if err != nil {
+		common.HandleError(w, common.NewInternalServerError("failed to create import directory: "+err.Error()))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+	manifest, apiErr := extractIndexArchive(r.Body, tmpDir)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	var indexMeta metadata.IndexMetadata
+	metaBytes, err := os.ReadFile(filepath.Join(tmpDir, indexArchiveMetadataFile))
+	if err == nil {
+		err = json.Unmarshal(metaBytes, &indexMeta)
+	}
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError("invalid index archive: failed to read "+indexArchiveMetadataFile+": "+err.Error()))
+		return
+	}
+
+	prefix := tenantIndexPrefix(r.Context())
+	targetName := query.Get("index")
+	if targetName == "" {
+		targetName = manifest.Index
+	}
+	if targetName == "" {
+		common.HandleError(w, common.NewBadRequestError("invalid index archive: missing index name"))
+		return
+	}
+	targetName = prefix + targetName
+	if err := common.ValidateIndexName(targetName); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	if h.dirMgr.IndexExists(targetName) {
+		common.HandleError(w, common.NewConflictError("index already exists: "+targetName))
+		return
+	}
+	targetMeta := renameIndexMetadata(&indexMeta, targetName, func(alias string) string {
+		return prefix + alias
+	})
+	if !includeAliases {
+		targetMeta.Aliases = []string{}
+		targetMeta.AliasDefinitions = nil
+	}
+	for _, alias := range targetMeta.Aliases {
+		if h.dirMgr.IndexExists(alias) {
+			common.HandleError(w, newInvalidAliasNameError(alias, "an index exists with the same name as the alias"))
+			return
+		}
+	}
+	tier, apiErr := h.parseAllocationTier(targetMeta.Settings)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if h.diskMon != nil {
+		if apiErr := h.diskMon.allocationError(targetName); apiErr != nil {
+			common.HandleError(w, apiErr)
+			return
+		}
+	}
+
+	// 用归档中的 store 替换新建索引的空 store 目录
+	if err := h.dirMgr.CreateIndex(targetName); err != nil {
+		common.HandleError(w, common.NewInternalServerError("failed to create index directory: "+err.Error()))
+		return
+	}
+	rollback := func() {
+		h.indexMgr.CloseIndex(targetName)
+		h.metaStore.DeleteIndexMetadata(targetName)
+		h.dirMgr.DeleteIndex(targetName)
+	}
+	storePath := filepath.Join(h.dirMgr.GetIndexPath(targetName), "store")
+	if err := os.RemoveAll(storePath); err == nil {
+		err = os.Rename(filepath.Join(tmpDir, "store"), storePath)
+	}
+	if err != nil {
+		rollback()
+		common.HandleError(w, common.NewInternalServerError("failed to move index files: "+err.Error()))
+		return
+	}
+	if err := h.metaStore.SaveIndexMetadata(targetName, targetMeta); err != nil {
+		rollback()
+		common.HandleError(w, common.NewInternalServerError("failed to save index metadata: "+err.Error()))
+		return
+	}
+	h.indexMgr.InvalidateIndexStatus(targetName)
+	if _, err := h.indexMgr.GetIndex(targetName); err != nil {
+		rollback()
+		logger.Error("Failed to open imported index [%s]: %v", targetName, err)
+		common.HandleError(w, common.NewBadRequestError("invalid index archive: "+err.Error()))
+		return
+	}
+	// 归档解压在基础目录，索引要求其他层时再迁移
+	if apiErr := h.relocateIndex(r.Context(), targetName, tier); apiErr != nil {
+		rollback()
+		common.HandleError(w, apiErr)
+		return
+	}
+	logger.Info("Imported index [%s] (%d files)", targetName, len(manifest.Files))
+
+	var size int64
+	for _, f := range manifest.Files {
+		size += f.Size
+	}
+	resp := common.SuccessResponse().WithData(map[string]interface{}{
+		"index":         targetName,
+		"files":         len(manifest.Files),
+		"size_in_bytes": size,
+	})
+	common.HandleSuccess(w, resp, http.StatusOK)
+}
+
+// extractIndexArchive 解压归档到 dir，并按 manifest 校验每个文件的大小与 SHA-256
+func extractIndexArchive(body io.Reader, dir string) (*indexArchiveManifest, common.APIError) {
+	invalid := func(format string, args ...interface{}) common.APIError {
+		return common.NewBadRequestError("invalid index archive: " + fmt.Sprintf(format, args...))
+	}
+
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, common.NewRequestBodyError("invalid index archive", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	extracted := make(map[string]indexArchiveFile)
+	var manifest *indexArchiveManifest
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, common.NewRequestBodyError("invalid index archive", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, invalid("illegal file path [%s]", header.Name)
+		}
+		if name == indexArchiveManifestFile {
+			manifest = &indexArchiveManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, invalid("failed to parse %s: %v", indexArchiveManifestFile, err)
+			}
+			continue
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return nil, common.NewInternalServerError("failed to extract index archive: " + err.Error())
+		}
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, common.NewInternalServerError("failed to extract index archive: " + err.Error())
+		}
+		hash := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, hash), tr)
+		f.Close()
+		if err != nil {
+			return nil, common.NewRequestBodyError("invalid index archive", err)
+		}
+		extracted[name] = indexArchiveFile{Path: name, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	}
+
+	if manifest == nil {
+		return nil, invalid("missing %s", indexArchiveManifestFile)
+	}
+	if manifest.FormatVersion != indexArchiveFormatVersion {
+		return nil, invalid("unsupported format version [%d]", manifest.FormatVersion)
+	}
+	for _, f := range manifest.Files {
+		got, ok := extracted[f.Path]
+		if !ok {
+			return nil, invalid("missing file [%s]", f.Path)
+		}
+		if got.Size != f.Size || got.SHA256 != f.SHA256 {
+			return nil, invalid("checksum mismatch for file [%s]", f.Path)
+		}
+		delete(extracted, f.Path)
+	}
+	for name := range extracted {
+		return nil, invalid("file [%s] is not listed in %s", name, indexArchiveManifestFile)
+	}
+	return manifest, nil
+}
+
+// renameIndexMetadata 复制索引元数据并使用新的索引名，别名经 renameAlias 转换
+func renameIndexMetadata(source *metadata.IndexMetadata, indexName string, renameAlias func(string) string) *metadata.IndexMetadata {
+	rv := *source
+	rv.Name = indexName
+	rv.Aliases = make([]string, 0, len(source.Aliases))
+	for _, alias := range source.Aliases {
+		rv.Aliases = append(rv.Aliases, renameAlias(alias))
+	}
+	if source.AliasDefinitions != nil {
+		rv.AliasDefinitions = make(map[string]*metadata.AliasDefinition, len(source.AliasDefinitions))
+		for alias, def := range source.AliasDefinitions {
+			rv.AliasDefinitions[renameAlias(alias)] = def
+		}
+	}
+	return &rv
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_ExportImport(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/_aliases", Handler: indexHandler.UpdateAliases},
+		{Method: "POST", Path: "/_import", Handler: indexHandler.ImportIndex},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_export", Handler: indexHandler.ExportIndex},
+		{Method: "DELETE", Path: "/{index}", Handler: indexHandler.DeleteIndex},
+	})
+	mux := router.Build()
+
+	do := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	count := func(index, query string) int {
+		t.Helper()
+		w := do("POST", "/"+index+"/_search", []byte(`{"query":`+query+`}`))
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", index, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Hits struct {
+				Total struct {
+					Value int `json:"value"`
+				} `json:"total"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Hits.Total.Value
+	}
+	// rewriteArchive 逐个文件改写归档，edit 返回 nil 时删除该文件
+	rewriteArchive := func(archive []byte, edit func(name string, data []byte) []byte) []byte {
+		t.Helper()
+		gz, err := gzip.NewReader(bytes.NewReader(archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gz)
+		var out bytes.Buffer
+		gzw := gzip.NewWriter(&out)
+		tw := tar.NewWriter(gzw)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data = edit(header.Name, data); data == nil {
+				continue
+			}
+			header.Size = int64(len(data))
+			if err := tw.WriteHeader(header); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+		gzw.Close()
+		return out.Bytes()
+	}
+
+	if w := do("PUT", "/events", []byte(`{"mappings":{"properties":{"kind":{"type":"keyword"},"n":{"type":"long"}}}}`)); w.Code != http.StatusOK {
+		t.Fatalf("create index: got %d: %s", w.Code, w.Body.String())
+	}
+	for b := 0; b < 2; b++ {
+		var body strings.Builder
+		for k := 0; k < 20; k++ {
+			fmt.Fprintf(&body, "{\"index\":{\"_index\":\"events\",\"_id\":\"%d-%d\"}}\n", b, k)
+			fmt.Fprintf(&body, "{\"kind\":\"k%d\",\"n\":%d}\n", k%4, k)
+		}
+		if w := do("POST", "/_bulk?refresh=true", []byte(body.String())); w.Code != http.StatusOK {
+			t.Fatalf("bulk %d: got %d: %s", b, w.Code, w.Body.String())
+		}
+	}
+	if w := do("POST", "/_aliases", []byte(`{"actions":[{"add":{"index":"events","alias":"all-events"}}]}`)); w.Code != http.StatusOK {
+		t.Fatalf("add alias: got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do("POST", "/events/_export", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("export: got %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	archive := w.Body.Bytes()
+
+	// 归档包含元数据、索引文件与最后的 manifest
+	var names []string
+	var manifest indexArchiveManifest
+	rewriteArchive(archive, func(name string, data []byte) []byte {
+		names = append(names, name)
+		if name == indexArchiveManifestFile {
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("decode manifest: %v", err)
+			}
+		}
+		return data
+	})
+	if len(names) < 4 || names[0] != indexArchiveMetadataFile || names[len(names)-1] != indexArchiveManifestFile {
+		t.Fatalf("unexpected archive layout: %v", names)
+	}
+	if manifest.Index != "events" || manifest.FormatVersion != indexArchiveFormatVersion || len(manifest.Files) != len(names)-1 {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+
+	// 以新名称导入，不恢复别名（别名已被源索引使用）
+	w = do("POST", "/_import?index=events-copy&include_aliases=false", archive)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"index": "events-copy"`) {
+		t.Fatalf("import: got %d: %s", w.Code, w.Body.String())
+	}
+	if n := count("events-copy", `{"match_all":{}}`); n != 40 {
+		t.Errorf("expected 40 documents after import, got %d", n)
+	}
+	if n := count("events-copy", `{"term":{"kind":"k1"}}`); n != 10 {
+		t.Errorf("expected 10 documents of kind k1 after import, got %d", n)
+	}
+	meta, err := indexHandler.metaStore.GetIndexMetadata("events-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props, _ := meta.Mapping["properties"].(map[string]interface{}); props["kind"] == nil || len(meta.Aliases) != 0 {
+		t.Errorf("unexpected imported metadata: %+v", meta)
+	}
+
+	// 删除源索引后按归档中的名称恢复，别名一并恢复
+	if w := do("DELETE", "/events", nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/_import", archive); w.Code != http.StatusOK {
+		t.Fatalf("import with archive name: got %d: %s", w.Code, w.Body.String())
+	}
+	if meta, err := indexHandler.metaStore.GetIndexMetadata("events"); err != nil || len(meta.Aliases) != 1 || meta.Aliases[0] != "all-events" {
+		t.Errorf("expected restored alias, got %+v (%v)", meta, err)
+	}
+	if n := count("all-events", `{"match_all":{}}`); n != 40 {
+		t.Errorf("expected 40 documents through restored alias, got %d", n)
+	}
+
+	tampered := rewriteArchive(archive, func(name string, data []byte) []byte {
+		if name == indexArchiveMetadataFile {
+			return bytes.Replace(data, []byte(`"keyword"`), []byte(`"text"`), 1)
+		}
+		return data
+	})
+	missingManifest := rewriteArchive(archive, func(name string, data []byte) []byte {
+		if name == indexArchiveManifestFile {
+			return nil
+		}
+		return data
+	})
+	failures := []struct {
+		name    string
+		path    string
+		body    []byte
+		status  int
+		message string
+	}{
+		{"existing index", "/_import", archive, http.StatusConflict, "index already exists"},
+		{"checksum", "/_import?index=tampered", tampered, http.StatusBadRequest, "checksum mismatch for file [metadata.json]"},
+		{"no manifest", "/_import?index=partial", missingManifest, http.StatusBadRequest, "missing manifest.json"},
+		{"truncated", "/_import?index=truncated", archive[:len(archive)/2], http.StatusBadRequest, "invalid index archive"},
+		{"not gzip", "/_import?index=plain", []byte("not an archive"), http.StatusBadRequest, "invalid index archive"},
+	}
+	for _, tt := range failures {
+		w := do("POST", tt.path, tt.body)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: expected %d with %q, got %d: %s", tt.name, tt.status, tt.message, w.Code, w.Body.String())
+		}
+	}
+	for _, name := range []string{"tampered", "partial", "truncated", "plain"} {
+		if indexHandler.dirMgr.IndexExists(name) {
+			t.Errorf("rejected import [%s] should not create an index", name)
+		}
+	}
+	if w := do("POST", "/missing/_export", nil); w.Code != http.StatusNotFound {
+		t.Errorf("export missing index: expected 404 got %d", w.Code)
+	}
+}
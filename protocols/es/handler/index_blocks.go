@@ -0,0 +1,248 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// blockLevel 被 block 拦截的操作级别（与 ES ClusterBlockLevel 对应）
+type blockLevel int
+
+const (
+	blockLevelRead          blockLevel = iota // 文档读取：search/get/count/mget
+	blockLevelWrite                           // 文档写入：index/create/update
+	blockLevelDelete                          // 文档删除：delete/delete_by_query
+	blockLevelMetadataRead                    // 元数据读取：get mapping
+	blockLevelMetadataWrite                   // 元数据写入：mapping/settings/alias 变更
+)
+
+// indexBlock ES 索引 block 定义
+type indexBlock struct {
+	name        string       // settings 中的名称（blocks.<name>）
+	description string       // ES 格式的 block 描述
+	status      int          // 被拦截时返回的 HTTP 状态码
+	levels      []blockLevel // 拦截的操作级别
+}
+
+// indexBlocks 支持的索引 block（顺序即检查顺序）
+var indexBlocks = []indexBlock{
+	{
+		name:        "read_only",
+		description: "FORBIDDEN/5/index read-only (api)",
+		status:      http.StatusForbidden,
+		levels:      []blockLevel{blockLevelWrite, blockLevelDelete, blockLevelMetadataWrite},
+	},
+	{
+		name:        "read_only_allow_delete",
+		description: "TOO_MANY_REQUESTS/12/disk usage exceeded flood-stage watermark, index has read-only-allow-delete block",
+		status:      http.StatusTooManyRequests,
+		levels:      []blockLevel{blockLevelWrite, blockLevelMetadataWrite},
+	},
+	{
+		name:        "read",
+		description: "FORBIDDEN/7/index read (api)",
+		status:      http.StatusForbidden,
+		levels:      []blockLevel{blockLevelRead},
+	},
+	{
+		name:        "write",
+		description: "FORBIDDEN/8/index write (api)",
+		status:      http.StatusForbidden,
+		levels:      []blockLevel{blockLevelWrite, blockLevelDelete},
+	},
+	{
+		name:        "metadata",
+		description: "FORBIDDEN/9/index metadata (api)",
+		status:      http.StatusForbidden,
+		levels:      []blockLevel{blockLevelMetadataRead, blockLevelMetadataWrite},
+	},
+}
+
+// findIndexBlock 按名称查找 block 定义
+func findIndexBlock(name string) (indexBlock, bool) {
+	for _, b := range indexBlocks {
+		if b.name == name {
+			return b, true
+		}
+	}
+	return indexBlock{}, false
+}
+
+// temporaryIndexBlock 不持久化的临时 block，克隆索引（见 index_clone.go）或迁移数据层（见 index_tier.go）期间禁止写入索引
+// description 中的 %s 为持有 block 的操作
+var temporaryIndexBlock = indexBlock{
+	name:        "write",
+	description: "FORBIDDEN/8/index write (%s)",
+	status:      http.StatusForbidden,
+	levels:      []blockLevel{blockLevelWrite, blockLevelDelete, blockLevelMetadataWrite},
+}
+
+var (
+	temporaryBlocksMu sync.Mutex
+	temporaryBlocks   = make(map[string][]string) // 索引名 -> 持有临时 block 的操作
+)
+
+// addTemporaryIndexBlock 为索引加临时 block，reason 说明持有 block 的操作，返回的函数释放该 block
+func addTemporaryIndexBlock(indexName, reason string) func() {
+	temporaryBlocksMu.Lock()
+	temporaryBlocks[indexName] = append(temporaryBlocks[indexName], reason)
+	temporaryBlocksMu.Unlock()
+	return func() {
+		temporaryBlocksMu.Lock()
+		reasons := temporaryBlocks[indexName]
+		for i, r := range reasons {
+			if r == reason {
+				reasons = append(reasons[:i:i], reasons[i+1:]...)
+				break
+			}
+		}
+		if len(reasons) == 0 {
+			delete(temporaryBlocks, indexName)
+		} else {
+			temporaryBlocks[indexName] = reasons
+		}
+		temporaryBlocksMu.Unlock()
+	}
+}
+
+// checkTemporaryIndexBlock 检查索引的临时 block 是否拦截指定级别的操作
+func checkTemporaryIndexBlock(indexName string, level blockLevel) common.APIError {
+	temporaryBlocksMu.Lock()
+	var reason string
+	if reasons := temporaryBlocks[indexName]; len(reasons) > 0 {
+		reason = reasons[0]
+	}
+	temporaryBlocksMu.Unlock()
+	if reason == "" {
+		return nil
+	}
+	for _, l := range temporaryIndexBlock.levels {
+		if l == level {
+			return common.NewClusterBlockError(indexName, fmt.Sprintf(temporaryIndexBlock.description, reason), temporaryIndexBlock.status)
+		}
+	}
+	return nil
+}
+
+// checkIndexBlock 检查索引当前的 block 设置（含临时 block）是否拦截指定级别的操作
+// 元数据不存在时视为未设置 block
+func checkIndexBlock(metaStore metadata.MetadataStore, indexName string, level blockLevel) common.APIError {
+	if apiErr := checkTemporaryIndexBlock(indexName, level); apiErr != nil {
+		return apiErr
+	}
+	if metaStore == nil {
+		return nil
+	}
+	indexMeta, err := metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return nil
+	}
+	return checkIndexBlockSettings(indexName, indexMeta.Settings, level)
+}
+
+// checkIndexBlockSettings 基于给定 settings 检查 block
+func checkIndexBlockSettings(indexName string, settings map[string]interface{}, level blockLevel) common.APIError {
+	for _, b := range indexBlocks {
+		if !indexSettingBool(settings, "blocks."+b.name) {
+			continue
+		}
+		for _, l := range b.levels {
+			if l == level {
+				return common.NewClusterBlockError(indexName, b.description, b.status)
+			}
+		}
+	}
+	return nil
+}
+
+// isBlockSetting 判断设置路径是否为 block 设置（修改 block 本身不受 metadata block 限制）
+func isBlockSetting(path string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(path, "index."), "blocks.")
+}
+
+// bulkBlockError 将 block 错误转换为 bulk 单项错误格式
+func bulkBlockError(err common.APIError) map[string]interface{} {
+	return map[string]interface{}{
+		"status": err.StatusCode(),
+		"error": map[string]interface{}{
+			"type":   err.Type(),
+			"reason": err.Error(),
+		},
+	}
+}
+
+// AddIndexBlock 为索引添加 block
+// PUT /{index}/_block/{block}
+func (h *IndexHandler) AddIndexBlock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	blockName := vars["block"]
+
+	if _, ok := findIndexBlock(blockName); !ok || blockName == "read_only_allow_delete" {
+		common.HandleError(w, common.NewBadRequestError("unknown block type ["+blockName+"]"))
+		return
+	}
+
+	indexNames, apiErr := h.resolveShardOperationIndices(r, vars["index"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(indexNames))
+	for _, indexName := range indexNames {
+		indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+		if err != nil {
+			logger.Error("Failed to get index metadata for [%s]: %v", indexName, err)
+			common.HandleError(w, common.NewInternalServerError("failed to get index metadata: "+err.Error()))
+			return
+		}
+		if indexMeta.Settings == nil {
+			indexMeta.Settings = make(map[string]interface{})
+		}
+		setIndexSetting(indexMeta.Settings, "blocks."+blockName, true)
+		indexMeta.UpdatedAt = time.Now()
+		if err := h.metaStore.SaveIndexMetadata(indexName, indexMeta); err != nil {
+			logger.Error("Failed to save index metadata for [%s]: %v", indexName, err)
+			common.HandleError(w, common.NewInternalServerError("failed to add index block: "+err.Error()))
+			return
+		}
+		results = append(results, map[string]interface{}{
+			"name":    indexName,
+			"blocked": true,
+		})
+	}
+
+	response := map[string]interface{}{
+		"acknowledged":        true,
+		"shards_acknowledged": true,
+		"indices":             results,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode add block response: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 克隆索引
+// POST /{index}/_clone/{target} 创建与源索引 mapping/settings 相同的目标索引，并直接复用源索引的段文件：
+// 克隆期间源索引加临时写入 block（不持久化），先 flush 使内存段落盘，再基于一致的快照将段文件
+// 硬链接到目标索引（段文件不可变；跨文件系统等无法链接时复制），远快于 reindex。
+// 请求体可包含 settings（覆盖源索引的动态设置）与 aliases（目标索引的别名），源索引的别名不会复制。
+
+// CloneIndex 克隆索引
+// POST|PUT /{index}/_clone/{target}
+func (h *IndexHandler) CloneIndex(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sourceName, targetName := vars["index"], vars["target"]
+
+	if err := common.ValidateIndexName(targetName); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	if !h.dirMgr.IndexExists(sourceName) {
+		common.HandleError(w, common.NewIndexNotFoundError(sourceName))
+		return
+	}
+	if h.dirMgr.IndexExists(targetName) {
+		common.HandleError(w, common.NewConflictError("index already exists: "+targetName))
+		return
+	}
+	if h.indexMgr == nil {
+		common.HandleError(w, common.NewInternalServerError("index manager is not available"))
+		return
+	}
+
+	var requestBody map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	var settingUpdates map[string]interface{}
+	if settings, ok := requestBody["settings"].(map[string]interface{}); ok {
+		settingUpdates = flattenIndexSettings(settings)
+	}
+	for path := range settingUpdates {
+		// 段文件原样复用，写入段时生效的设置不能修改
+		if isIndexSortSetting(path) || path == timestampFieldSetting || isStoreSetting(path) {
+			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("can't change setting [index.%s] when cloning index [%s]", path, sourceName)))
+			return
+		}
+	}
+	if v, ok := settingUpdates[maxResultWindowSetting]; ok && v != nil {
+		if _, err := parseMaxResultWindow(v); err != nil {
+			common.HandleError(w, common.NewBadRequestError(err.Error()))
+			return
+		}
+	}
+	if err := validateWarmerSettingUpdates(settingUpdates); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	aliases, aliasDefs, apiErr := parseCreateIndexAliases(targetName, requestBody["aliases"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	for _, alias := range aliases {
+		if h.dirMgr.IndexExists(alias) {
+			common.HandleError(w, newInvalidAliasNameError(alias, "an index exists with the same name as the alias"))
+			return
+		}
+	}
+	if h.diskMon != nil {
+		if apiErr := h.diskMon.allocationError(targetName); apiErr != nil {
+			common.HandleError(w, apiErr)
+			return
+		}
+	}
+
+	release := addTemporaryIndexBlock(sourceName, "clone in progress")
+	defer release()
+
+	sourceMeta, err := h.metaStore.GetIndexMetadata(sourceName)
+	if err != nil || sourceMeta == nil {
+		common.HandleError(w, common.NewInternalServerError(fmt.Sprintf("failed to get index metadata: %v", err)))
+		return
+	}
+	targetMeta, err := cloneIndexMetadata(targetName, sourceMeta, settingUpdates)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	if _, _, err := parseRefreshSettings(targetMeta.Settings); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	tier, apiErr := h.parseAllocationTier(targetMeta.Settings)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	targetMeta.Aliases = aliases
+	targetMeta.AliasDefinitions = aliasDefs
+
+	if apiErr := h.cloneIndexStore(r, sourceName, targetName); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if err := h.metaStore.SaveIndexMetadata(targetName, targetMeta); err != nil {
+		h.dirMgr.DeleteIndex(targetName)
+		logger.Error("Failed to save index metadata for cloned index [%s]: %v", targetName, err)
+		common.HandleError(w, common.NewInternalServerError("failed to save index metadata: "+err.Error()))
+		return
+	}
+	h.indexMgr.InvalidateIndexStatus(targetName)
+	// 段文件硬链接到源索引所在的层，目标索引要求其他层时再迁移
+	if apiErr := h.relocateIndex(r.Context(), targetName, tier); apiErr != nil {
+		h.indexMgr.CloseIndex(targetName)
+		h.metaStore.DeleteIndexMetadata(targetName)
+		h.dirMgr.DeleteIndex(targetName)
+		common.HandleError(w, apiErr)
+		return
+	}
+	logger.Info("Cloned index [%s] to [%s]", sourceName, targetName)
+
+	resp := common.SuccessResponse().WithData(map[string]interface{}{
+		"shards_acknowledged": true,
+		"index":               targetName,
+	})
+	common.HandleSuccess(w, resp, http.StatusOK)
+}
+
+// cloneIndexStore 在源索引所在的层创建目标索引目录，并将源索引当前快照的段文件硬链接（或复制）到目标索引的 store 目录
+func (h *IndexHandler) cloneIndexStore(r *http.Request, sourceName, targetName string) common.APIError {
+	idx, err := h.indexMgr.GetIndex(sourceName)
+	if err != nil {
+		return common.NewInternalServerError(fmt.Sprintf("failed to open index [%s]: %v", sourceName, err))
+	}
+	copyable, ok := idx.(bleve.IndexCopyable)
+	if !ok {
+		return common.NewBadRequestError(fmt.Sprintf("index [%s] does not support cloning", sourceName))
+	}
+	// 内存段落盘后才能被硬链接
+	if err := h.indexMgr.FlushIndex(r.Context(), sourceName); err != nil {
+		return common.NewInternalServerError(fmt.Sprintf("failed to flush index [%s]: %v", sourceName, err))
+	}
+
+	// 与源索引位于同一层才能硬链接
+	if err := h.dirMgr.CreateIndexOnTier(targetName, h.dirMgr.GetIndexTier(sourceName)); err != nil {
+		return common.NewInternalServerError("failed to create index directory: " + err.Error())
+	}
+	storePath := filepath.Join(h.dirMgr.GetIndexPath(targetName), "store")
+	if err := copyable.CopyTo(bleve.HardLinkDirectory(storePath)); err != nil {
+		h.dirMgr.DeleteIndex(targetName)
+		logger.Error("Failed to clone index [%s] to [%s]: %v", sourceName, targetName, err)
+		return common.NewInternalServerError("failed to copy index files: " + err.Error())
+	}
+	return nil
+}
+
+// cloneIndexMetadata 复制源索引的 mapping 与 settings 作为目标索引的元数据，settingUpdates 覆盖对应设置
+func cloneIndexMetadata(targetName string, source *metadata.IndexMetadata, settingUpdates map[string]interface{}) (*metadata.IndexMetadata, error) {
+	var copied struct {
+		Mapping       map[string]interface{}  `json:"mapping"`
+		Settings      map[string]interface{}  `json:"settings"`
+		JoinRelations *metadata.JoinRelations `json:"join_relations"`
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"mapping":        source.Mapping,
+		"settings":       source.Settings,
+		"join_relations": source.JoinRelations,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, err
+	}
+	if copied.Settings == nil {
+		copied.Settings = make(map[string]interface{})
+	}
+	for path, v := range settingUpdates {
+		setIndexSetting(copied.Settings, path, v)
+	}
+
+	now := time.Now()
+	return &metadata.IndexMetadata{
+		Name:          targetName,
+		Mapping:       copied.Mapping,
+		Settings:      copied.Settings,
+		JoinRelations: copied.JoinRelations,
+		Version:       1,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
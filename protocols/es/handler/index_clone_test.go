@@ -0,0 +1,188 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_CloneIndex(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_clone/{target}", Handler: indexHandler.CloneIndex},
+		{Method: "GET", Path: "/{index}/_settings", Handler: indexHandler.GetSettings},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	count := func(index, query string) int {
+		t.Helper()
+		w := do("POST", "/"+index+"/_search", `{"query":`+query+`}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", index, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Hits struct {
+				Total struct {
+					Value int `json:"value"`
+				} `json:"total"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Hits.Total.Value
+	}
+
+	if w := do("PUT", "/source", `{
+		"settings":{"index":{"max_result_window":100}},
+		"mappings":{"properties":{"host":{"type":"keyword"},"n":{"type":"long"}}}
+	}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: got %d: %s", w.Code, w.Body.String())
+	}
+	for b := 0; b < 3; b++ {
+		var body strings.Builder
+		for k := 0; k < 10; k++ {
+			fmt.Fprintf(&body, "{\"index\":{\"_index\":\"source\",\"_id\":\"%d-%d\"}}\n", b, k)
+			fmt.Fprintf(&body, "{\"host\":\"h%d\",\"n\":%d}\n", k%2, k)
+		}
+		if w := do("POST", "/_bulk?refresh=true", body.String()); w.Code != http.StatusOK {
+			t.Fatalf("bulk %d: got %d: %s", b, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("POST", "/source/_clone/target", `{
+		"settings":{"index":{"max_result_window":200}},
+		"aliases":{"target-alias":{}}
+	}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"index": "target"`) ||
+		!strings.Contains(w.Body.String(), `"shards_acknowledged": true`) {
+		t.Fatalf("clone: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 目标索引包含相同的文档，段文件与源索引共享
+	if n := count("target", `{"match_all":{}}`); n != 30 {
+		t.Errorf("expected 30 documents in target, got %d", n)
+	}
+	if n := count("target", `{"term":{"host":"h1"}}`); n != 15 {
+		t.Errorf("expected 15 documents for host h1 in target, got %d", n)
+	}
+	targetStore := filepath.Join(indexHandler.dirMgr.GetIndexPath("target"), "store", "store")
+	sourceStore := filepath.Join(indexHandler.dirMgr.GetIndexPath("source"), "store", "store")
+	segments, _ := filepath.Glob(filepath.Join(targetStore, "*.zap"))
+	if len(segments) == 0 {
+		t.Fatalf("expected segment files in %s", targetStore)
+	}
+	for _, seg := range segments {
+		targetInfo, err := os.Stat(seg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 源索引的后台合并可能已删除该段，目标索引的链接不受影响
+		sourceInfo, err := os.Stat(filepath.Join(sourceStore, filepath.Base(seg)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(targetInfo, sourceInfo) {
+			t.Errorf("segment %s was copied instead of linked", filepath.Base(seg))
+		}
+	}
+
+	// mapping 与 settings 来自源索引，请求体中的设置覆盖源索引的值，别名只属于目标索引
+	targetMeta, err := indexHandler.metaStore.GetIndexMetadata("target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := lookupIndexSetting(targetMeta.Settings, maxResultWindowSetting); fmt.Sprint(v) != "200" {
+		t.Errorf("expected max_result_window 200 in target, got %v", v)
+	}
+	if props, _ := targetMeta.Mapping["properties"].(map[string]interface{}); props["host"] == nil || props["n"] == nil {
+		t.Errorf("unexpected target mapping: %v", targetMeta.Mapping)
+	}
+	if len(targetMeta.Aliases) != 1 || targetMeta.Aliases[0] != "target-alias" {
+		t.Errorf("unexpected target aliases: %v", targetMeta.Aliases)
+	}
+	sourceMeta, _ := indexHandler.metaStore.GetIndexMetadata("source")
+	if v, _ := lookupIndexSetting(sourceMeta.Settings, maxResultWindowSetting); fmt.Sprint(v) != "100" {
+		t.Errorf("source max_result_window changed to %v", v)
+	}
+
+	// 克隆后两个索引相互独立，源索引的临时 block 已释放
+	if w := do("PUT", "/target/_doc/new", `{"host":"h9","n":1}`); w.Code >= 300 {
+		t.Fatalf("index into target: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/source/_doc/other?refresh=true", `{"host":"h8","n":1}`); w.Code >= 300 {
+		t.Fatalf("index into source: got %d: %s", w.Code, w.Body.String())
+	}
+	if n := count("source", `{"term":{"host":"h9"}}`); n != 0 {
+		t.Errorf("document written to target is visible in source")
+	}
+	if n := count("target", `{"term":{"host":"h8"}}`); n != 0 {
+		t.Errorf("document written to source is visible in target")
+	}
+
+	// 克隆期间源索引禁止写入
+	release := addTemporaryIndexBlock("source", "clone in progress")
+	if w := do("PUT", "/source/_doc/blocked", `{"host":"h0"}`); w.Code != http.StatusForbidden ||
+		!strings.Contains(w.Body.String(), "clone in progress") {
+		t.Errorf("write during clone: expected 403 got %d: %s", w.Code, w.Body.String())
+	}
+	release()
+
+	failures := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/source/_clone/target", "", http.StatusConflict},
+		{"/missing/_clone/other", "", http.StatusNotFound},
+		{"/source/_clone/Invalid", "", http.StatusBadRequest},
+		{"/source/_clone/sorted", `{"settings":{"index":{"sort.field":"n"}}}`, http.StatusBadRequest},
+	}
+	for _, tt := range failures {
+		if w := do("POST", tt.path, tt.body); w.Code != tt.status {
+			t.Errorf("POST %s: expected %d got %d: %s", tt.path, tt.status, w.Code, w.Body.String())
+		}
+	}
+	if indexHandler.dirMgr.IndexExists("sorted") {
+		t.Errorf("rejected clone target should not be created")
+	}
+}
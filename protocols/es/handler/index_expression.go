@@ -0,0 +1,289 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 索引表达式解析
+// 索引级 API 的 {index} 路径参数统一按 ES 多索引语法解析：逗号分隔，_all 或 * 表示所有索引，
+// 支持通配符（logs-*）与别名；以 - 开头的项从之前匹配到的索引中排除（可以是通配符），+ 前缀显式表示包含。
+// 查询参数：
+//   - expand_wildcards：通配符展开的索引状态 open（默认）、closed、hidden、all、none，可逗号组合。
+//     当前没有关闭或隐藏的索引，包含 open 或 all 时展开到所有索引，否则通配符与 _all 不匹配任何索引
+//   - ignore_unavailable：忽略不存在的具体索引名（默认 false，不存在时返回 404）
+//   - allow_no_indices：通配符或整个表达式未匹配到任何索引时是否允许（默认 true，false 时返回 404）
+
+// indicesOptions 索引表达式的解析选项
+type indicesOptions struct {
+	expandWildcards   bool
+	ignoreUnavailable bool
+	allowNoIndices    bool
+}
+
+// defaultIndicesOptions 与 ES strictExpandOpen 一致：展开到打开的索引，具体索引名必须存在
+var defaultIndicesOptions = indicesOptions{expandWildcards: true, allowNoIndices: true}
+
+// destructiveRequiresNameSetting 删除索引时是否必须指定具体索引名（_cluster/settings 动态设置）
+const destructiveRequiresNameSetting = "action.destructive_requires_name"
+
+var destructiveRequiresName atomic.Bool
+
+var destructiveRequiresNameSettingDef = clusterSettingDef{
+	parse: parseBoolSetting,
+	apply: func(v interface{}) { destructiveRequiresName.Store(v.(bool)) },
+}
+
+// parseIndicesOptions 从查询参数解析索引表达式选项，未指定的参数使用 defaults
+func parseIndicesOptions(r *http.Request, defaults indicesOptions) (indicesOptions, common.APIError) {
+	opts := defaults
+	query := r.URL.Query()
+
+	if query.Has("expand_wildcards") {
+		opts.expandWildcards = false
+		for _, state := range splitCommaList(query.Get("expand_wildcards")) {
+			switch state {
+			case "open", "all":
+				opts.expandWildcards = true
+			case "closed", "hidden", "none":
+			default:
+				return opts, common.NewBadRequestError(fmt.Sprintf("No enum constant for expand_wildcards [%s]", state))
+			}
+		}
+	}
+
+	for _, param := range []struct {
+		name  string
+		value *bool
+	}{
+		{"ignore_unavailable", &opts.ignoreUnavailable},
+		{"allow_no_indices", &opts.allowNoIndices},
+	} {
+		if !query.Has(param.name) {
+			continue
+		}
+		// 只有参数名没有值（?ignore_unavailable）视为 true
+		value := query.Get(param.name)
+		if value == "" {
+			*param.value = true
+			continue
+		}
+		b, err := parseSettingBool(value)
+		if err != nil {
+			return opts, common.NewBadRequestError(fmt.Sprintf("Failed to parse value [%s] as only [true] or [false] are allowed for [%s]", value, param.name))
+		}
+		*param.value = b
+	}
+	return opts, nil
+}
+
+// isWildcardIndexExpression 判断表达式是否包含通配符或 _all
+func isWildcardIndexExpression(indexExpr string) bool {
+	parts := splitCommaList(indexExpr)
+	if len(parts) == 0 {
+		return true
+	}
+	for _, part := range parts {
+		part = strings.TrimPrefix(strings.TrimPrefix(part, "-"), "+")
+		if part == "_all" || strings.Contains(part, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveIndices 按请求的 expand_wildcards/ignore_unavailable/allow_no_indices 参数解析索引表达式
+func (h *IndexHandler) resolveIndices(r *http.Request, indexExpr string, defaults indicesOptions) ([]string, common.APIError) {
+	opts, apiErr := parseIndicesOptions(r, defaults)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return h.resolveIndexExpression(r.Context(), indexExpr, opts)
+}
+
+// resolveIndexExpression 将索引表达式解析为具体的索引名，保持表达式中的顺序，通配符匹配结果按名称排序
+func (h *IndexHandler) resolveIndexExpression(ctx context.Context, indexExpr string, opts indicesOptions) ([]string, common.APIError) {
+	var allIndices []string
+	listAll := func() ([]string, common.APIError) {
+		if allIndices == nil {
+			indices, err := listTenantIndices(ctx, h.dirMgr)
+			if err != nil {
+				return nil, common.NewInternalServerError("failed to list indices: " + err.Error())
+			}
+			sort.Strings(indices)
+			allIndices = indices
+		}
+		return allIndices, nil
+	}
+
+	parts := splitCommaList(indexExpr)
+	if len(parts) == 0 {
+		parts = []string{"_all"}
+	}
+
+	result := make([]string, 0)
+	included := make(map[string]bool)
+	for _, part := range parts {
+		exclude := strings.HasPrefix(part, "-")
+		if exclude {
+			part = part[1:]
+		} else {
+			part = strings.TrimPrefix(part, "+")
+		}
+		if part == "" {
+			continue
+		}
+
+		var matches []string
+		if part == "_all" || strings.Contains(part, "*") {
+			if opts.expandWildcards {
+				indices, apiErr := listAll()
+				if apiErr != nil {
+					return nil, apiErr
+				}
+				for _, name := range indices {
+					if part == "_all" || simpleWildcardMatch(part, name) {
+						matches = append(matches, name)
+					}
+				}
+			}
+			if len(matches) == 0 && !exclude && !opts.allowNoIndices {
+				return nil, common.NewIndexNotFoundError(part)
+			}
+		} else if h.dirMgr.IndexExists(part) {
+			matches = []string{part}
+		} else {
+			indices, apiErr := listAll()
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			matches = h.aliasIndices(indices, part)
+			if len(matches) == 0 && !exclude && !opts.ignoreUnavailable {
+				return nil, common.NewIndexNotFoundError(part)
+			}
+		}
+
+		if exclude {
+			excluded := make(map[string]bool, len(matches))
+			for _, name := range matches {
+				excluded[name] = true
+				delete(included, name)
+			}
+			kept := result[:0]
+			for _, name := range result {
+				if !excluded[name] {
+					kept = append(kept, name)
+				}
+			}
+			result = kept
+			continue
+		}
+		for _, name := range matches {
+			if !included[name] {
+				included[name] = true
+				result = append(result, name)
+			}
+		}
+	}
+
+	if len(result) == 0 && !opts.allowNoIndices {
+		return nil, common.NewIndexNotFoundError(indexExpr)
+	}
+	return result, nil
+}
+
+// aliasIndices 返回别名指向的索引
+func (h *IndexHandler) aliasIndices(indices []string, alias string) []string {
+	var rv []string
+	for _, name := range indices {
+		meta, err := h.metaStore.GetIndexMetadata(name)
+		if err != nil || meta == nil {
+			continue
+		}
+		for _, a := range meta.Aliases {
+			if a == alias {
+				rv = append(rv, name)
+				break
+			}
+		}
+	}
+	return rv
+}
+
+// forEachResolvedIndex 将写入型索引 API（PUT _settings、PUT _mapping）应用到表达式解析出的每个索引
+// 只解析到一个索引时直接写出该索引的响应；多个索引时逐个执行，全部成功返回 acknowledged，
+// 否则返回第一个失败索引的响应，之前的索引已更新
+func (h *IndexHandler) forEachResolvedIndex(w http.ResponseWriter, r *http.Request, update func(w http.ResponseWriter, r *http.Request, indexName string)) {
+	indexNames, apiErr := h.resolveIndices(r, mux.Vars(r)["index"], defaultIndicesOptions)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if len(indexNames) == 1 {
+		update(w, r, indexNames[0])
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		common.HandleError(w, common.NewRequestBodyError("failed to read request body", err))
+		return
+	}
+	for _, indexName := range indexNames {
+		req := r.Clone(r.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		rec := &indexResponseRecorder{header: make(http.Header), statusCode: http.StatusOK}
+		update(rec, req, indexName)
+		if rec.statusCode >= http.StatusMultipleChoices {
+			for k, v := range rec.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.statusCode)
+			w.Write(rec.body.Bytes())
+			return
+		}
+	}
+	common.HandleSuccess(w, common.SuccessResponse(), http.StatusOK)
+}
+
+// indexResponseRecorder 缓冲单个索引的响应，供 forEachResolvedIndex 合并结果
+type indexResponseRecorder struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *indexResponseRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *indexResponseRecorder) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+func (w *indexResponseRecorder) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_IndexExpressions(t *testing.T) {
+	indexHandler, _, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	defer destructiveRequiresName.Store(false)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_aliases", Handler: indexHandler.UpdateAliases},
+		{Method: "GET", Path: "/_all", Handler: indexHandler.GetIndex},
+		{Method: "GET", Path: "/_all/_mapping", Handler: indexHandler.GetMapping},
+		{Method: "GET", Path: "/_settings", Handler: indexHandler.GetSettings},
+		{Method: "PUT", Path: "/_all/_settings", Handler: indexHandler.UpdateSettings},
+		{Method: "GET", Path: "/{index:[^_][^/]*}", Handler: indexHandler.GetIndex},
+		{Method: "HEAD", Path: "/{index:[^_][^/]*}", Handler: indexHandler.HeadIndex},
+		{Method: "DELETE", Path: "/{index:[^_][^/]*}", Handler: indexHandler.DeleteIndex},
+		{Method: "GET", Path: "/{index:[^_][^/]*}/_mapping", Handler: indexHandler.GetMapping},
+		{Method: "PUT", Path: "/{index:[^_][^/]*}/_mapping", Handler: indexHandler.UpdateMapping},
+		{Method: "GET", Path: "/{index:[^_][^/]*}/_settings", Handler: indexHandler.GetSettings},
+		{Method: "PUT", Path: "/{index:[^_][^/]*}/_settings", Handler: indexHandler.UpdateSettings},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	// names 返回响应中的索引名（忽略 acknowledged）
+	names := func(w *httptest.ResponseRecorder) string {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		rv := make([]string, 0, len(resp))
+		for name := range resp {
+			if name != "acknowledged" {
+				rv = append(rv, name)
+			}
+		}
+		sort.Strings(rv)
+		return strings.Join(rv, ",")
+	}
+
+	for _, name := range []string{"logs-2024.01", "logs-2024.02", "logs-archive", "metrics"} {
+		if w := do("PUT", "/"+name, `{"mappings":{"properties":{"host":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+			t.Fatalf("create %s: got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+	if w := do("POST", "/_aliases", `{"actions":[{"add":{"index":"metrics","alias":"current-metrics"}}]}`); w.Code != http.StatusOK {
+		t.Fatalf("add alias: got %d: %s", w.Code, w.Body.String())
+	}
+
+	reads := []struct {
+		path     string
+		expected string
+	}{
+		{"/logs-*", "logs-2024.01,logs-2024.02,logs-archive"},
+		{"/logs-*,-logs-archive", "logs-2024.01,logs-2024.02"},
+		{"/logs-*,-*archive,+metrics", "logs-2024.01,logs-2024.02,metrics"},
+		{"/_all", "logs-2024.01,logs-2024.02,logs-archive,metrics"},
+		{"/*,-logs-*", "metrics"},
+		{"/current-metrics", "metrics"},
+		{"/nomatch-*", ""},
+		{"/logs-*?expand_wildcards=none", ""},
+		{"/logs-*,missing?ignore_unavailable=true", "logs-2024.01,logs-2024.02,logs-archive"},
+		{"/logs-2024*/_mapping", "logs-2024.01,logs-2024.02"},
+		{"/_all/_mapping", "logs-2024.01,logs-2024.02,logs-archive,metrics"},
+		{"/metrics,logs-2024.01/_settings", "logs-2024.01,metrics"},
+		{"/_settings", "logs-2024.01,logs-2024.02,logs-archive,metrics"},
+	}
+	for _, tt := range reads {
+		if got := names(do("GET", tt.path, "")); got != tt.expected {
+			t.Errorf("GET %s: expected [%s], got [%s]", tt.path, tt.expected, got)
+		}
+	}
+
+	failures := []struct {
+		path   string
+		status int
+	}{
+		{"/logs-*,missing", http.StatusNotFound},
+		{"/nomatch-*?allow_no_indices=false", http.StatusNotFound},
+		{"/logs-*?expand_wildcards=foo", http.StatusBadRequest},
+		{"/logs-*?ignore_unavailable=maybe", http.StatusBadRequest},
+	}
+	for _, tt := range failures {
+		if w := do("GET", tt.path, ""); w.Code != tt.status {
+			t.Errorf("GET %s: expected %d got %d: %s", tt.path, tt.status, w.Code, w.Body.String())
+		}
+	}
+	if w := do("HEAD", "/logs-*", ""); w.Code != http.StatusOK {
+		t.Errorf("HEAD logs-*: got %d", w.Code)
+	}
+	if w := do("HEAD", "/nomatch-*", ""); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD nomatch-*: got %d", w.Code)
+	}
+
+	// 写入型 API 更新表达式匹配的每个索引
+	if w := do("PUT", "/logs-2024*/_settings", `{"index":{"max_result_window":500}}`); w.Code != http.StatusOK {
+		t.Fatalf("update settings: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/logs-*,-logs-2024*/_mapping", `{"properties":{"level":{"type":"keyword"}}}`); w.Code != http.StatusOK {
+		t.Fatalf("update mapping: got %d: %s", w.Code, w.Body.String())
+	}
+	for _, name := range []string{"logs-2024.01", "logs-2024.02", "logs-archive", "metrics"} {
+		meta, err := indexHandler.metaStore.GetIndexMetadata(name)
+		if err != nil {
+			t.Fatalf("metadata %s: %v", name, err)
+		}
+		_, updated := lookupIndexSetting(meta.Settings, maxResultWindowSetting)
+		if updated != strings.HasPrefix(name, "logs-2024") {
+			t.Errorf("%s: unexpected max_result_window update %v: %v", name, updated, meta.Settings)
+		}
+		props, _ := meta.Mapping["properties"].(map[string]interface{})
+		if _, ok := props["level"]; ok != (name == "logs-archive") {
+			t.Errorf("%s: unexpected level mapping %v: %v", name, ok, props)
+		}
+	}
+	if w := do("PUT", "/_all/_settings", `{"index":{"max_result_window":invalid}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("update all with invalid body: expected 400 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// action.destructive_requires_name 禁止通配符删除
+	destructiveRequiresName.Store(true)
+	if w := do("DELETE", "/logs-*", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("wildcard delete with destructive_requires_name: expected 400 got %d: %s", w.Code, w.Body.String())
+	}
+	destructiveRequiresName.Store(false)
+	if w := do("DELETE", "/logs-*,-logs-archive", ""); w.Code != http.StatusOK {
+		t.Fatalf("wildcard delete: got %d: %s", w.Code, w.Body.String())
+	}
+	if got := names(do("GET", "/_all", "")); got != "logs-archive,metrics" {
+		t.Errorf("after delete: expected [logs-archive,metrics], got [%s]", got)
+	}
+	if w := do("DELETE", "/nomatch-*", ""); w.Code != http.StatusOK {
+		t.Errorf("delete matching nothing: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", "/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete missing: expected 404 got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -15,11 +15,13 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,12 +33,23 @@ import (
 	"github.com/lscgzwd/tiggerdb/mapping"
 	"github.com/lscgzwd/tiggerdb/metadata"
 	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	es "github.com/lscgzwd/tiggerdb/protocols/es/index"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
 )
 
 // IndexManagerInterface 索引管理器接口（用于索引操作）
 type IndexManagerInterface interface {
 	InvalidateIndexStatus(string)
 	CloseIndex(string) error
+	RefreshIndex(string) error
+	FlushIndex(context.Context, string) error
+	ForceMerge(context.Context, string, es.ForceMergeOptions) (*es.ForceMergeResult, error)
+	Segments(string) ([]es.SegmentInfo, error)
+	GetIndex(string) (bleve.Index, error)
+	LoadedIndex(string) (bleve.Index, bool)
+	ScheduleRefresh(string, bleve.Index, time.Duration)
+	MigrateIndexTier(context.Context, string, string) error
+	ReplaceMapping(context.Context, string, *mapping.IndexMappingImpl) error
 }
 
 // IndexHandler ES索引处理器实现
@@ -44,6 +57,9 @@ type IndexHandler struct {
 	dirMgr    directory.DirectoryManager
 	metaStore metadata.MetadataStore
 	indexMgr  IndexManagerInterface // 索引管理器（用于缓存失效和关闭索引）
+	taskMgr   *TaskManager          // 任务管理器（forcemerge 等异步任务）
+	diskMon   *DiskWatermarkMonitor // 磁盘水位监控（超过 high 水位时拒绝创建索引）
+	reindexer DocumentReindexer     // mapping 对账后重新索引文档
 }
 
 // NewIndexHandler 创建新的索引处理器
@@ -52,6 +68,7 @@ func NewIndexHandler(dirMgr directory.DirectoryManager, metaStore metadata.Metad
 		dirMgr:    dirMgr,
 		metaStore: metaStore,
 		indexMgr:  nil, // 将在server.go中设置
+		taskMgr:   NewTaskManager(),
 	}
 }
 
@@ -60,11 +77,21 @@ func (h *IndexHandler) SetIndexManager(indexMgr IndexManagerInterface) {
 	h.indexMgr = indexMgr
 }
 
+// SetDiskWatermarkMonitor 设置磁盘水位监控
+func (h *IndexHandler) SetDiskWatermarkMonitor(monitor *DiskWatermarkMonitor) {
+	h.diskMon = monitor
+}
+
+// SetTaskManager 设置任务管理器（与 DocumentHandler 共享，使 _tasks API 可查询所有任务）
+func (h *IndexHandler) SetTaskManager(taskMgr *TaskManager) {
+	h.taskMgr = taskMgr
+}
+
 // ListIndices 列出所有索引
 // GET /_cat/indices
 // ES的cat API默认返回纯文本表格格式，但可以通过Accept: application/json返回JSON格式
 func (h *IndexHandler) ListIndices(w http.ResponseWriter, r *http.Request) {
-	indices, err := h.dirMgr.ListIndices()
+	indices, err := listTenantIndices(r.Context(), h.dirMgr)
 	if err != nil {
 		common.HandleError(w, common.NewInternalServerError(err.Error()))
 		return
@@ -127,7 +154,7 @@ func (h *IndexHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
 	// 防御性检查：如果 ContentLength > 0，提前检查大小
 	if r.ContentLength > 0 {
 		if r.ContentLength > common.MaxIndexBodySize {
-			common.HandleError(w, common.NewBadRequestError("request body too large"))
+			common.HandleError(w, common.NewContentTooLargeError(common.MaxIndexBodySize))
 			return
 		}
 	}
@@ -139,7 +166,7 @@ func (h *IndexHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
 			// 请求体为空，使用空的 requestBody
 			requestBody = make(map[string]interface{})
 		} else {
-			common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+			common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 			return
 		}
 	}
@@ -172,11 +199,93 @@ func (h *IndexHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
 		logger.Debug("CreateIndex [%s] - Extracted mapping has no properties", indexName)
 	}
 
-	// 创建目录（原子操作）
-	if err := h.dirMgr.CreateIndex(indexName); err != nil {
-		common.HandleError(w, common.NewInternalServerError("failed to create index directory: "+err.Error()))
+	// 校验字段别名
+	if err := validateFieldAliases(mapping); err != nil {
+		common.HandleError(w, newMapperParsingError(err.Error()))
+		return
+	}
+	if err := validateRoutingMapping(mapping); err != nil {
+		common.HandleError(w, newMapperParsingError(err.Error()))
+		return
+	}
+
+	// 校验索引排序与时间裁剪字段设置，二者作为 scorch 配置在写入段时生效
+	storeConfig := map[string]interface{}{}
+	indexSort, apiErr := parseIndexSort(settings, mapping)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if indexSort != nil {
+		storeConfig["indexSort"] = indexSort
+	}
+	timestampField, apiErr := parseTimestampField(settings, mapping)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if timestampField != "" {
+		storeConfig["timestampField"] = timestampField
+	}
+	if _, err := parseIndexWarmer(settings); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	if _, _, err := parseRefreshSettings(settings); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	storeOptions, err := parseStoreSettings(settings)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
 		return
 	}
+	for k, v := range storeOptions {
+		storeConfig[k] = v
+	}
+
+	// 解析请求体中的别名：{"aliases": {"alias_name": {"filter": {...}, "routing": "..."}}}
+	aliases, aliasDefs, apiErr := parseCreateIndexAliases(indexName, requestBody["aliases"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	for _, alias := range aliases {
+		if h.dirMgr.IndexExists(alias) {
+			common.HandleError(w, newInvalidAliasNameError(alias, "an index exists with the same name as the alias"))
+			return
+		}
+	}
+
+	if apiErr := h.createIndex(indexName, mapping, settings, aliases, aliasDefs, storeConfig); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	// 返回成功响应
+	resp := common.SuccessResponse().
+		WithAcknowledged(true).
+		WithIndex(indexName)
+	common.HandleSuccess(w, resp, http.StatusOK)
+}
+
+// createIndex 创建索引目录、元数据与 bleve 索引，任一步骤失败时回滚已创建的部分
+func (h *IndexHandler) createIndex(indexName string, mapping, settings map[string]interface{}, aliases []string, aliasDefs map[string]*metadata.AliasDefinition, storeConfig map[string]interface{}) common.APIError {
+	// 磁盘超过 high 水位时不再分配新索引
+	if h.diskMon != nil {
+		if apiErr := h.diskMon.allocationError(indexName); apiErr != nil {
+			return apiErr
+		}
+	}
+
+	// 在 index.routing.allocation.require.tier 指定的层创建目录（原子操作）
+	tier, apiErr := h.parseAllocationTier(settings)
+	if apiErr != nil {
+		return apiErr
+	}
+	if err := h.dirMgr.CreateIndexOnTier(indexName, tier); err != nil {
+		return common.NewInternalServerError("failed to create index directory: " + err.Error())
+	}
 
 	// 提取 join 字段的关系定义
 	joinRelations := h.extractJoinRelations(mapping)
@@ -184,14 +293,15 @@ func (h *IndexHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
 	// 创建元数据
 	now := time.Now()
 	indexMeta := &metadata.IndexMetadata{
-		Name:          indexName,
-		Mapping:       mapping,
-		Settings:      settings,
-		Aliases:       []string{},
-		JoinRelations: joinRelations,
-		Version:       1,
-		CreatedAt:     now,
-		UpdatedAt:     now,
+		Name:             indexName,
+		Mapping:          mapping,
+		Settings:         settings,
+		Aliases:          aliases,
+		AliasDefinitions: aliasDefs,
+		JoinRelations:    joinRelations,
+		Version:          1,
+		CreatedAt:        now,
+		UpdatedAt:        now,
 	}
 
 	// 调试：记录保存前的 mapping 字段数量
@@ -207,8 +317,7 @@ func (h *IndexHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
 			logger.Error("Failed to rollback index directory deletion for index [%s] after metadata save failure: %v", indexName, delErr)
 		}
 		logger.Error("Failed to save index metadata for index [%s]: %v", indexName, err)
-		common.HandleError(w, common.NewInternalServerError("failed to save index metadata: "+err.Error()))
-		return
+		return common.NewInternalServerError("failed to save index metadata: " + err.Error())
 	}
 
 	// 创建bleve索引（如果有索引管理器）
@@ -219,8 +328,7 @@ func (h *IndexHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
 			// 回滚
 			h.metaStore.DeleteIndexMetadata(indexName)
 			h.dirMgr.DeleteIndex(indexName)
-			common.HandleError(w, common.NewInternalServerError("failed to get index path"))
-			return
+			return common.NewInternalServerError("failed to get index path")
 		}
 
 		// 构建存储路径
@@ -233,8 +341,7 @@ func (h *IndexHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
 			h.metaStore.DeleteIndexMetadata(indexName)
 			h.dirMgr.DeleteIndex(indexName)
 			logger.Error("Failed to convert ES mapping to Bleve mapping for [%s]: %v", indexName, err)
-			common.HandleError(w, common.NewBadRequestError("invalid mapping: "+err.Error()))
-			return
+			return common.NewBadRequestError("invalid mapping: " + err.Error())
 		}
 
 		// 验证 mapping
@@ -243,18 +350,23 @@ func (h *IndexHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
 			h.metaStore.DeleteIndexMetadata(indexName)
 			h.dirMgr.DeleteIndex(indexName)
 			logger.Error("Invalid Bleve mapping for [%s]: %v", indexName, err)
-			common.HandleError(w, common.NewBadRequestError("invalid mapping: "+err.Error()))
-			return
+			return common.NewBadRequestError("invalid mapping: " + err.Error())
 		}
 
-		idx, err := bleve.New(storePath, bleveMapping)
+		var idx bleve.Index
+		if len(storeConfig) > 0 {
+			// scorch 配置持久化在 index_meta.json 中，重新打开时自动生效
+			idx, err = bleve.NewUsing(storePath, bleveMapping, bleve.Config.DefaultIndexType,
+				bleve.Config.DefaultKVStore, storeConfig)
+		} else {
+			idx, err = bleve.New(storePath, bleveMapping)
+		}
 		if err != nil {
 			// 回滚
 			h.metaStore.DeleteIndexMetadata(indexName)
 			h.dirMgr.DeleteIndex(indexName)
 			logger.Error("Failed to create bleve index for [%s]: %v", indexName, err)
-			common.HandleError(w, common.NewInternalServerError("failed to create index: "+err.Error()))
-			return
+			return common.NewInternalServerError("failed to create index: " + err.Error())
 		}
 		idx.Close() // 创建后立即关闭，由IndexManager管理生命周期
 	}
@@ -263,12 +375,7 @@ func (h *IndexHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
 	if h.indexMgr != nil {
 		h.indexMgr.InvalidateIndexStatus(indexName)
 	}
-
-	// 返回成功响应
-	resp := common.SuccessResponse().
-		WithAcknowledged(true).
-		WithIndex(indexName)
-	common.HandleSuccess(w, resp, http.StatusOK)
+	return nil
 }
 
 // extractMappingAndSettings 从请求体中提取mapping和settings
@@ -377,16 +484,36 @@ func getMapKeys(m map[string]interface{}) []string {
 	return keys
 }
 
+// BleveMapping 将 ES 格式的 mapping 转换为索引使用的 Bleve IndexMapping（与创建索引时的转换一致）
+func (h *IndexHandler) BleveMapping(esMapping map[string]interface{}) (*mapping.IndexMappingImpl, error) {
+	return h.convertESMappingToBleve(esMapping)
+}
+
 // convertESMappingToBleve 将 ES 格式的 mapping 转换为 Bleve IndexMapping
 func (h *IndexHandler) convertESMappingToBleve(esMapping map[string]interface{}) (*mapping.IndexMappingImpl, error) {
+	// 创建默认的 Bleve IndexMapping
+	// 嵌套子文档、join 字段和 percolator 字段的内部元数据字段需要按 keyword 精确索引（后续 mapping 更新可能新增相关字段，始终注册）
+	bleveMapping := mapping.NewIndexMapping()
+	for _, metaField := range []string{dsl.NestedPathField, dsl.NestedRootIDField, "_join_name", "_join_parent",
+		dsl.PercolatorFlagField, dsl.PercolatorTermsField, dsl.PercolatorExtractionField, routingField} {
+		bleveMapping.DefaultMapping.AddFieldMappingsAt(metaField, mapping.NewKeywordFieldMapping())
+	}
+	percolatorQueryMapping := mapping.NewTextFieldMapping()
+	percolatorQueryMapping.Index = false
+	percolatorQueryMapping.Store = true
+	bleveMapping.DefaultMapping.AddFieldMappingsAt(dsl.PercolatorQueryField, percolatorQueryMapping)
+	// 稀疏向量权重只用于评分，按 keyword 写入 doc values
+	sparseWeightsMapping := mapping.NewKeywordFieldMapping()
+	sparseWeightsMapping.Store = false
+	sparseWeightsMapping.IncludeTermVectors = false
+	sparseWeightsMapping.IncludeInAll = false
+	bleveMapping.DefaultMapping.AddFieldMappingsAt(dsl.SparseVectorWeightsField, sparseWeightsMapping)
+
 	// 如果没有提供 mapping，使用默认 mapping
 	if len(esMapping) == 0 {
-		return mapping.NewIndexMapping(), nil
+		return bleveMapping, nil
 	}
 
-	// 创建默认的 Bleve IndexMapping
-	bleveMapping := mapping.NewIndexMapping()
-
 	// 第一步：收集所有日期格式
 	dateFormats := make(map[string]bool)
 	h.collectDateFormats(esMapping, dateFormats)
@@ -588,6 +715,9 @@ func (h *IndexHandler) convertESFieldToBleve(fieldMap map[string]interface{}, do
 			fieldMapping.DateFormat = format
 		}
 
+	case "geo_point":
+		fieldMapping = mapping.NewGeoPointFieldMapping()
+
 	case "object", "nested":
 		// 对于 object 和 nested，需要递归处理 properties
 		if properties, ok := fieldMap["properties"].(map[string]interface{}); ok {
@@ -610,6 +740,10 @@ func (h *IndexHandler) convertESFieldToBleve(fieldMap map[string]interface{}, do
 		// object/nested 类型不需要 FieldMapping，直接返回
 		return nil
 
+	case "alias":
+		// 别名字段不参与索引，查询时改写为目标字段
+		return nil
+
 	case "join":
 		// join 字段用于父子文档关系
 		// 在 Bleve 中，我们将 join 字段作为 keyword 存储
@@ -624,6 +758,21 @@ func (h *IndexHandler) convertESFieldToBleve(fieldMap map[string]interface{}, do
 		fieldMapping.Index = false // 不索引，只存储
 		fieldMapping.Store = true
 
+	case "sparse_vector", "rank_features":
+		// 稀疏向量字段按 keyword 索引词项用于召回，权重保存在 _sparse_weights 中
+		fieldMapping = mapping.NewKeywordFieldMapping()
+		fieldMapping.Store = false
+		fieldMapping.IncludeTermVectors = false
+		fieldMapping.IncludeInAll = false
+		fieldMapping.DocValues = false
+
+	case "dense_vector":
+		// 稠密向量字段用于 knn 检索，向量索引需要 vectors 构建标签（见 search_knn.go）
+		var err error
+		if fieldMapping, err = denseVectorFieldMapping(fieldMap); err != nil {
+			return err
+		}
+
 	default:
 		// 未知类型，默认为 text
 		fieldMapping = mapping.NewTextFieldMapping()
@@ -653,15 +802,32 @@ func (h *IndexHandler) convertESFieldToBleve(fieldMap map[string]interface{}, do
 }
 
 // GetIndex 获取索引信息
+// GET /{index}，索引表达式支持逗号分隔、通配符、_all 与排除项（见 index_expression.go）
 func (h *IndexHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
-
-	// 检查索引是否存在
-	if !h.dirMgr.IndexExists(indexName) {
-		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+	indexExpr := mux.Vars(r)["index"]
+	indexNames, apiErr := h.resolveIndices(r, indexExpr, defaultIndicesOptions)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
 		return
 	}
 
+	// ES 官方格式：GET /{index} 直接返回索引信息，不包含 acknowledged 字段
+	// 格式：{"index_name": {"aliases": {}, "mappings": {...}, "settings": {...}}}
+	response := make(map[string]interface{}, len(indexNames))
+	for _, indexName := range indexNames {
+		response[indexName] = h.indexInfo(indexName)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(response); err != nil {
+		logger.Error("Failed to encode index response: %v", err)
+	}
+}
+
+// indexInfo 构建单个索引的 aliases/mappings/settings 信息
+func (h *IndexHandler) indexInfo(indexName string) map[string]interface{} {
 	// 获取元数据
 	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
 	if err != nil {
@@ -675,7 +841,6 @@ func (h *IndexHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 构建ES格式响应
 	// 构建ES格式响应，直接使用保存的完整 settings 和 mappings
 	var settings map[string]interface{}
 	if len(indexMeta.Settings) == 0 {
@@ -689,57 +854,19 @@ func (h *IndexHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
 		settings = indexMeta.Settings
 	}
 
-	// ES 7.x+ 格式：mappings 需要包装在一个默认类型名称下
-	// ES 官方行为：
-	// 1. 如果 mapping 中已经有类型名称（如从 ES 6.x 迁移），使用那个类型名称
-	// 2. 如果没有类型名称，检查是否有 properties 或 dynamic_templates（说明是 ES 7.x+ 格式）
-	// 3. 如果是 ES 7.x+ 格式，使用 "_doc" 作为默认类型名称
-	mappingsWithType := indexMeta.Mapping
-	if mappingsWithType != nil {
-		// 检查是否已经有类型包装
-		// 如果顶级 key 中有 "properties" 或 "dynamic_templates"，说明没有类型包装
-		_, hasProperties := mappingsWithType["properties"]
-		_, hasDynamicTemplates := mappingsWithType["dynamic_templates"]
-
-		if hasProperties || hasDynamicTemplates {
-			// 没有类型包装，使用 "_doc" 作为默认类型名称
-			mappingsWithType = map[string]interface{}{
-				"_doc": indexMeta.Mapping,
-			}
-		}
-		// 否则，说明已经有类型包装了（如 {"ips": {...}}），直接使用
-	} else {
-		mappingsWithType = map[string]interface{}{
-			"_doc": make(map[string]interface{}),
-		}
-	}
-
-	indexInfo := map[string]interface{}{
-		"aliases":  h.buildAliasesMap(indexMeta.Aliases),
-		"mappings": mappingsWithType,
+	// ES 7.x+ 格式：mappings 需要包装在一个默认类型名称下（见 typedMappings）
+	return map[string]interface{}{
+		"aliases":  h.buildAliasesMap(indexMeta.Aliases, indexMeta.AliasDefinitions),
+		"mappings": typedMappings(indexMeta.Mapping),
 		"settings": settings,
 	}
-
-	// ES 官方格式：GET /{index} 直接返回索引信息，不包含 acknowledged 字段
-	// 格式：{"index_name": {"aliases": {}, "mappings": {...}, "settings": {...}}}
-	response := map[string]interface{}{
-		indexName: indexInfo,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	encoder := json.NewEncoder(w)
-	if err := encoder.Encode(response); err != nil {
-		logger.Error("Failed to encode index response: %v", err)
-	}
 }
 
 // HeadIndex 检查索引是否存在 (HEAD /{index})
+// 表达式中的具体索引都存在且至少解析到一个索引时返回 200
 func (h *IndexHandler) HeadIndex(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
-
-	// 检查索引是否存在
-	if !h.dirMgr.IndexExists(indexName) {
+	indexNames, apiErr := h.resolveIndices(r, mux.Vars(r)["index"], defaultIndicesOptions)
+	if apiErr != nil || len(indexNames) == 0 {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
@@ -750,36 +877,23 @@ func (h *IndexHandler) HeadIndex(w http.ResponseWriter, r *http.Request) {
 
 // DeleteIndex 删除索引
 // DELETE /{index}
-// 支持多索引：DELETE /index1,index2,index3
+// 支持多索引与通配符：DELETE /index1,index2、DELETE /logs-*,-logs-keep
+// action.destructive_requires_name 为 true 时禁止通配符与 _all
 func (h *IndexHandler) DeleteIndex(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
+	indexExpr := mux.Vars(r)["index"]
+	if destructiveRequiresName.Load() && isWildcardIndexExpression(indexExpr) {
+		common.HandleError(w, common.NewBadRequestError("Wildcard expressions or all indices are not allowed"))
+		return
+	}
 
-	// 支持多索引（逗号分隔）
-	indexNames := strings.Split(indexName, ",")
-	validIndices := make([]string, 0, len(indexNames))
-	invalidIndices := make([]string, 0)
-	errors := make(map[string]string) // 记录每个索引的删除错误
+	indexNames, apiErr := h.resolveIndices(r, indexExpr, defaultIndicesOptions)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
 
+	errors := make(map[string]string) // 记录每个索引的删除错误
 	for _, idx := range indexNames {
-		idx = strings.TrimSpace(idx)
-		if idx == "" {
-			continue
-		}
-
-		// 验证索引名称
-		if err := common.ValidateIndexName(idx); err != nil {
-			invalidIndices = append(invalidIndices, idx)
-			errors[idx] = err.Error()
-			continue
-		}
-
-		// 检查索引是否存在
-		if !h.dirMgr.IndexExists(idx) {
-			invalidIndices = append(invalidIndices, idx)
-			errors[idx] = "index not found"
-			continue
-		}
-
 		// 先关闭索引（从 IndexManager 中移除），释放文件句柄
 		// 这很重要，特别是在 Windows 上，文件被占用时无法删除
 		if h.indexMgr != nil {
@@ -799,7 +913,6 @@ func (h *IndexHandler) DeleteIndex(w http.ResponseWriter, r *http.Request) {
 		if err := h.dirMgr.DeleteIndex(idx); err != nil {
 			errors[idx] = err.Error()
 			logger.Error("Failed to delete index [%s]: %v", idx, err)
-			invalidIndices = append(invalidIndices, idx)
 			continue
 		}
 
@@ -807,36 +920,20 @@ func (h *IndexHandler) DeleteIndex(w http.ResponseWriter, r *http.Request) {
 		if h.indexMgr != nil {
 			h.indexMgr.InvalidateIndexStatus(idx)
 		}
-
-		validIndices = append(validIndices, idx)
 	}
 
-	// ES 规范：删除索引 API 的返回格式
-	// 1. 如果所有索引都无效，返回错误
-	if len(validIndices) == 0 {
-		if len(invalidIndices) == 1 {
-			// 单个索引不存在，返回 404
-			common.HandleError(w, common.NewIndexNotFoundError(invalidIndices[0]))
-		} else {
-			// 多个索引都无效，返回 400
-			errorMsg := fmt.Sprintf("failed to delete indices: %v", invalidIndices)
-			if len(errors) > 0 {
-				errorDetails := make([]string, 0, len(errors))
-				for idx, errMsg := range errors {
-					errorDetails = append(errorDetails, fmt.Sprintf("%s: %s", idx, errMsg))
-				}
-				errorMsg += " (" + strings.Join(errorDetails, "; ") + ")"
-			}
-			common.HandleError(w, common.NewBadRequestError(errorMsg))
+	// 所有索引都删除失败时返回错误
+	if len(indexNames) > 0 && len(errors) == len(indexNames) {
+		errorDetails := make([]string, 0, len(errors))
+		for _, idx := range indexNames {
+			errorDetails = append(errorDetails, fmt.Sprintf("%s: %s", idx, errors[idx]))
 		}
+		common.HandleError(w, common.NewInternalServerError("failed to delete indices: "+strings.Join(errorDetails, "; ")))
 		return
 	}
-
-	// 2. ES 规范：删除索引 API 返回格式为 {"acknowledged": true}
-	// 不包含索引列表，即使删除多个索引也是如此
 	// 如果有部分索引删除失败，记录警告日志，但仍返回成功响应
-	if len(invalidIndices) > 0 {
-		logger.Warn("Some indices failed to delete: %v (errors: %v)", invalidIndices, errors)
+	if len(errors) > 0 {
+		logger.Warn("Some indices failed to delete: %v", errors)
 	}
 
 	// ES 官方规范：删除索引 API 返回格式为 {"acknowledged": true}
@@ -847,174 +944,85 @@ func (h *IndexHandler) DeleteIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetMapping 获取索引映射
+// 通配符与 _all 跳过禁止读取元数据的索引，具体索引名被禁止时返回 block 错误
 func (h *IndexHandler) GetMapping(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
-
-	// 检查索引是否存在
-	if !h.dirMgr.IndexExists(indexName) {
-		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+	indexExpr := mux.Vars(r)["index"]
+	indexNames, apiErr := h.resolveIndices(r, indexExpr, defaultIndicesOptions)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
 		return
 	}
 
-	// 获取元数据
-	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
-	if err != nil {
-		// 如果元数据不存在，记录警告并返回空映射
-		logger.Warn("Index metadata not found for index [%s] when getting mapping, using empty mapping: %v", indexName, err)
-		indexMeta = &metadata.IndexMetadata{
-			Name:    indexName,
-			Mapping: make(map[string]interface{}),
-		}
-	}
-
-	// 构建ES格式响应
-	resp := common.SuccessResponse().WithData(map[string]interface{}{
-		indexName: map[string]interface{}{
-			"mappings": indexMeta.Mapping,
-		},
-	})
-	common.HandleSuccess(w, resp, http.StatusOK)
-}
-
-// GetSettings 获取索引设置
-// GET /{index}/_settings, GET /_all/_settings
-func (h *IndexHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
-
-	// 如果从路由变量中获取不到index，尝试从URL路径中提取
-	if indexName == "" {
-		// 检查是否是 /_all/_settings 路径
-		if r.URL.Path == "/_all/_settings" {
-			indexName = "_all"
-		} else {
-			// 尝试从路径中提取索引名
-			// 路径格式应该是 /{index}/_settings
-			path := r.URL.Path
-			if strings.HasSuffix(path, "/_settings") {
-				parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
-				if len(parts) >= 2 && parts[1] == "_settings" {
-					indexName = parts[0]
-				}
+	data := make(map[string]interface{}, len(indexNames))
+	for _, indexName := range indexNames {
+		// 检查索引 block
+		if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelMetadataRead); apiErr != nil {
+			if isWildcardIndexExpression(indexExpr) {
+				continue
 			}
-		}
-	}
-
-	// 处理 _all 特殊索引名
-	if indexName == "_all" {
-		// 获取所有索引的设置
-		indices, err := h.dirMgr.ListIndices()
-		if err != nil {
-			logger.Error("Failed to list indices for get all settings: %v", err)
-			common.HandleError(w, common.NewInternalServerError("failed to list indices: "+err.Error()))
+			common.HandleError(w, apiErr)
 			return
 		}
 
-		allSettings := make(map[string]interface{})
-		for _, idxName := range indices {
-			indexMeta, err := h.metaStore.GetIndexMetadata(idxName)
-			if err != nil {
-				logger.Warn("Failed to get metadata for index [%s]: %v", idxName, err)
-				// 使用默认设置
-				allSettings[idxName] = map[string]interface{}{
-					"settings": map[string]interface{}{
-						"index": map[string]interface{}{
-							"number_of_shards":   "1",
-							"number_of_replicas": "0",
-						},
-					},
-				}
-				continue
-			}
-
-			// 构建ES格式的settings响应
-			// 将值字符串化，保持与ES一致
-			indexSettings := make(map[string]interface{})
-			for k, v := range indexMeta.Settings {
-				switch tv := v.(type) {
-				case string:
-					indexSettings[k] = tv
-				case []byte:
-					indexSettings[k] = string(tv)
-				case fmt.Stringer:
-					indexSettings[k] = tv.String()
-				default:
-					indexSettings[k] = fmt.Sprintf("%v", v)
-				}
-			}
-			settings := map[string]interface{}{"index": indexSettings}
-			// 如果没有settings，使用默认值（字符串）
-			if len(indexMeta.Settings) == 0 {
-				settings["index"] = map[string]interface{}{
-					"number_of_shards":   "1",
-					"number_of_replicas": "0",
-				}
-			}
-
-			allSettings[idxName] = map[string]interface{}{
-				"settings": settings,
+		// 获取元数据
+		indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+		if err != nil {
+			// 如果元数据不存在，记录警告并返回空映射
+			logger.Warn("Index metadata not found for index [%s] when getting mapping, using empty mapping: %v", indexName, err)
+			indexMeta = &metadata.IndexMetadata{
+				Name:    indexName,
+				Mapping: make(map[string]interface{}),
 			}
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		encoder := json.NewEncoder(w)
-		if err := encoder.Encode(allSettings); err != nil {
-			logger.Error("Failed to encode all settings response: %v", err)
+		data[indexName] = map[string]interface{}{
+			"mappings": indexMeta.Mapping,
 		}
-		return
 	}
 
-	// 检查索引是否存在
-	if !h.dirMgr.IndexExists(indexName) {
-		common.HandleError(w, common.NewIndexNotFoundError(indexName))
-		return
-	}
+	// 构建ES格式响应
+	resp := common.SuccessResponse().WithData(data)
+	common.HandleSuccess(w, resp, http.StatusOK)
+}
 
-	// 获取元数据
-	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
-	if err != nil {
-		logger.Warn("Index metadata not found for index [%s], using default settings: %v", indexName, err)
-		// 返回默认设置
-		settings := map[string]interface{}{
-			"settings": map[string]interface{}{
-				"index": map[string]interface{}{
-					"number_of_shards":   "1",
-					"number_of_replicas": "0",
-				},
-			},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		encoder := json.NewEncoder(w)
-		if err := encoder.Encode(map[string]interface{}{indexName: settings}); err != nil {
-			logger.Error("Failed to encode settings response: %v", err)
-		}
+// GetSettings 获取索引设置
+// GET /{index}/_settings, GET /_all/_settings, GET /_settings
+func (h *IndexHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	indexNames, apiErr := h.resolveIndices(r, mux.Vars(r)["index"], defaultIndicesOptions)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
 		return
 	}
 
-	// 构建ES格式的settings响应
-	// ES settings 格式：{"settings": {"index": {...}, "analysis": {...}, ...}}
-	// 直接返回保存的完整 settings，保持原始结构
-	var settings map[string]interface{}
-	if len(indexMeta.Settings) == 0 {
-		// 如果没有settings，使用默认值
-		settings = map[string]interface{}{
+	includeDefaults := r.URL.Query().Get("include_defaults") == "true"
+	response := make(map[string]interface{}, len(indexNames))
+	for _, indexName := range indexNames {
+		// ES settings 格式：{"settings": {"index": {...}, "analysis": {...}, ...}}
+		// 直接返回保存的完整 settings，保持原始结构；没有 settings 时使用默认值
+		settings := map[string]interface{}{
 			"index": map[string]interface{}{
 				"number_of_shards":   "1",
 				"number_of_replicas": "0",
 			},
 		}
-	} else {
-		// 直接使用保存的完整 settings（保持原始结构）
-		settings = indexMeta.Settings
-	}
+		indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+		if err != nil {
+			logger.Warn("Index metadata not found for index [%s], using default settings: %v", indexName, err)
+		} else if len(indexMeta.Settings) > 0 {
+			settings = indexMeta.Settings
+		}
 
-	// 构建ES格式响应
-	response := map[string]interface{}{
-		indexName: map[string]interface{}{
+		indexResponse := map[string]interface{}{
 			"settings": settings,
-		},
+		}
+		if includeDefaults {
+			defaults := storeSettingDefaults()
+			defaults[refreshIntervalSetting] = defaultRefreshInterval.String()
+			defaults[ingestModeSetting] = "false"
+			indexResponse["defaults"] = map[string]interface{}{"index": defaults}
+		}
+		response[indexName] = indexResponse
 	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	encoder := json.NewEncoder(w)
@@ -1024,9 +1032,14 @@ func (h *IndexHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateSettings 更新索引设置
-// PUT /{index}/_settings
+// PUT /{index}/_settings, PUT /_all/_settings, PUT /_settings
+// 索引表达式解析到多个索引时逐个更新（见 forEachResolvedIndex）
 func (h *IndexHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
+	h.forEachResolvedIndex(w, r, h.updateIndexSettings)
+}
+
+// updateIndexSettings 更新单个索引的设置
+func (h *IndexHandler) updateIndexSettings(w http.ResponseWriter, r *http.Request, indexName string) {
 
 	// 验证索引名称
 	if err := common.ValidateIndexName(indexName); err != nil {
@@ -1049,7 +1062,7 @@ func (h *IndexHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 			common.HandleError(w, common.NewBadRequestError("request body is required"))
 			return
 		}
-		common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 		return
 	}
 
@@ -1069,33 +1082,100 @@ func (h *IndexHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		json.Unmarshal(originalSettingsBytes, &originalSettings)
 	}
 
-	// 更新settings（合并到现有settings中）
+	// 提取待更新的settings
+	var updates map[string]interface{}
 	if settings, ok := requestBody["settings"].(map[string]interface{}); ok {
-		// 合并settings
-		if indexMeta.Settings == nil {
-			indexMeta.Settings = make(map[string]interface{})
-		}
-		for k, v := range settings {
-			indexMeta.Settings[k] = v
-		}
+		updates = settings
 	} else if indexSettings, ok := requestBody["index"].(map[string]interface{}); ok {
 		// ES格式：{"index": {"setting": "value"}}
-		if indexMeta.Settings == nil {
-			indexMeta.Settings = make(map[string]interface{})
-		}
-		for k, v := range indexSettings {
-			indexMeta.Settings[k] = v
-		}
+		updates = indexSettings
 	} else {
 		// 直接是settings对象
-		if indexMeta.Settings == nil {
-			indexMeta.Settings = make(map[string]interface{})
+		updates = requestBody
+	}
+	flatUpdates := flattenIndexSettings(updates)
+
+	// 校验 block 设置，并检查 metadata/read_only block（修改 block 本身始终允许）
+	onlyBlockChanges := true
+	for path, v := range flatUpdates {
+		if !isBlockSetting(path) {
+			onlyBlockChanges = false
+			continue
+		}
+		if _, ok := findIndexBlock(strings.TrimPrefix(path, "blocks.")); !ok {
+			common.HandleError(w, common.NewBadRequestError("unknown setting [index."+path+"]"))
+			return
+		}
+		if _, err := parseSettingBool(v); err != nil {
+			common.HandleError(w, common.NewBadRequestError("illegal value for setting [index."+path+"]: "+err.Error()))
+			return
+		}
+	}
+	for path := range flatUpdates {
+		if isIndexSortSetting(path) || path == timestampFieldSetting || isStoreSetting(path) {
+			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("Can't update non dynamic settings [[index.%s]] for open indices [[%s]]", path, indexName)))
+			return
 		}
-		for k, v := range requestBody {
-			indexMeta.Settings[k] = v
+	}
+	if v, ok := flatUpdates[maxResultWindowSetting]; ok && v != nil {
+		if _, err := parseMaxResultWindow(v); err != nil {
+			common.HandleError(w, common.NewBadRequestError(err.Error()))
+			return
+		}
+	}
+	if err := validateWarmerSettingUpdates(flatUpdates); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	if _, _, err := parseRefreshSettings(flatUpdates); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	if v, ok := flatUpdates[searchConcurrencySetting]; ok && v != nil {
+		if _, err := parseIndexIntSetting(v, searchConcurrencySetting); err != nil {
+			common.HandleError(w, common.NewBadRequestError(err.Error()))
+			return
+		}
+	}
+	if v, ok := flatUpdates[maxRegexLengthSetting]; ok && v != nil {
+		if _, err := parseIndexIntSetting(v, maxRegexLengthSetting); err != nil {
+			common.HandleError(w, common.NewBadRequestError(err.Error()))
+			return
+		}
+	}
+	if v, ok := flatUpdates[allowUnmappedFieldsSetting]; ok && v != nil {
+		if _, err := parseSettingBool(v); err != nil {
+			common.HandleError(w, common.NewBadRequestError("illegal value for setting [index."+allowUnmappedFieldsSetting+"]: "+err.Error()))
+			return
+		}
+	}
+	var tier string
+	if v, ok := flatUpdates[allocationTierSetting]; ok && v != nil {
+		var apiErr common.APIError
+		if tier, apiErr = h.parseAllocationTier(flatUpdates); apiErr != nil {
+			common.HandleError(w, apiErr)
+			return
+		}
+	}
+	if !onlyBlockChanges {
+		if apiErr := checkIndexBlockSettings(indexName, indexMeta.Settings, blockLevelMetadataWrite); apiErr != nil {
+			common.HandleError(w, apiErr)
+			return
 		}
 	}
 
+	// 按点分路径合并到现有settings中（null 表示恢复默认，即删除该设置）
+	if indexMeta.Settings == nil {
+		indexMeta.Settings = make(map[string]interface{})
+	}
+	for path, v := range flatUpdates {
+		if v == nil {
+			removeIndexSetting(indexMeta.Settings, path)
+			continue
+		}
+		setIndexSetting(indexMeta.Settings, path, v)
+	}
+
 	// 检查 settings 是否真的发生了变化（深度比较）
 	settingsChanged := !equalSettingsMaps(originalSettings, indexMeta.Settings)
 
@@ -1112,6 +1192,19 @@ func (h *IndexHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		logger.Debug("UpdateSettings [%s] - No settings changes detected, skipping metadata save", indexName)
 	}
 
+	// 已打开的索引立即应用刷新间隔与写入模式
+	if settingsChanged && h.indexMgr != nil {
+		if idx, ok := h.indexMgr.LoadedIndex(indexName); ok {
+			h.ConfigureIndex(indexName, idx)
+		}
+	}
+
+	// 修改所在的层时迁移索引文件
+	if apiErr := h.relocateIndex(r.Context(), indexName, tier); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 返回成功响应
 	resp := common.SuccessResponse().
 		WithAcknowledged(true).
@@ -1177,89 +1270,97 @@ func (h *IndexHandler) OpenIndex(w http.ResponseWriter, r *http.Request) {
 
 // RefreshIndex 刷新索引
 // POST /{index}/_refresh
+// POST /_refresh（刷新所有索引）
 // 支持多索引：POST /index1,index2,index3/_refresh
 func (h *IndexHandler) RefreshIndex(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
-
-	// 支持多索引（逗号分隔）
-	indexNames := strings.Split(indexName, ",")
-	validIndices := make([]string, 0, len(indexNames))
-	invalidIndices := make([]string, 0)
-
-	for _, idx := range indexNames {
-		idx = strings.TrimSpace(idx)
-		if idx == "" {
-			continue
-		}
-
-		// 验证索引名称
-		if err := common.ValidateIndexName(idx); err != nil {
-			invalidIndices = append(invalidIndices, idx)
-			continue
-		}
+	indexNames, apiErr := h.resolveShardOperationIndices(r, mux.Vars(r)["index"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
 
-		// 检查索引是否存在
-		if !h.dirMgr.IndexExists(idx) {
-			invalidIndices = append(invalidIndices, idx)
-			continue
+	result := h.runShardOperation(indexNames, func(indexName string) error {
+		if h.indexMgr == nil {
+			return nil
 		}
+		return h.indexMgr.RefreshIndex(indexName)
+	})
 
-		validIndices = append(validIndices, idx)
-	}
-
-	// 如果有无效索引，返回错误
-	if len(invalidIndices) > 0 {
-		common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("invalid or non-existent indices: %v", invalidIndices)))
-		return
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Error("Failed to encode refresh response: %v", err)
 	}
+}
 
-	// 如果没有有效索引，返回错误
-	if len(validIndices) == 0 {
-		common.HandleError(w, common.NewBadRequestError("no valid indices specified"))
+// FlushIndex 刷新索引到磁盘
+// POST /{index}/_flush
+// POST /_flush（刷新所有索引）
+func (h *IndexHandler) FlushIndex(w http.ResponseWriter, r *http.Request) {
+	indexNames, apiErr := h.resolveShardOperationIndices(r, mux.Vars(r)["index"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
 		return
 	}
 
-	// 注意：bleve索引是实时更新的，不需要显式刷新
-	// 但为了符合ES API规范，我们返回成功响应
-	// 如果需要，可以在这里触发索引的强制刷新操作
+	result := h.runShardOperation(indexNames, func(indexName string) error {
+		if h.indexMgr == nil {
+			return nil
+		}
+		return h.indexMgr.FlushIndex(r.Context(), indexName)
+	})
 
-	// 返回成功响应（多索引时返回第一个索引名称，符合ES规范）
-	resp := common.SuccessResponse().
-		WithAcknowledged(true).
-		WithIndex(validIndices[0])
-	common.HandleSuccess(w, resp, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Error("Failed to encode flush response: %v", err)
+	}
 }
 
-// FlushIndex 刷新索引到磁盘
-// POST /{index}/_flush
-func (h *IndexHandler) FlushIndex(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
+// resolveShardOperationIndices 解析 refresh/flush 等分片级操作的目标索引（见 index_expression.go）
+func (h *IndexHandler) resolveShardOperationIndices(r *http.Request, indexExpr string) ([]string, common.APIError) {
+	return h.resolveIndices(r, indexExpr, defaultIndicesOptions)
+}
 
-	// 验证索引名称
-	if err := common.ValidateIndexName(indexName); err != nil {
-		common.HandleError(w, common.NewBadRequestError(err.Error()))
-		return
+// runShardOperation 对每个索引执行操作，并生成 ES 格式的 _shards 结果
+// 单节点模式下每个索引视为一个主分片
+func (h *IndexHandler) runShardOperation(indexNames []string, op func(indexName string) error) map[string]interface{} {
+	successful := 0
+	failures := make([]map[string]interface{}, 0)
+
+	for _, indexName := range indexNames {
+		if err := op(indexName); err != nil {
+			logger.Error("Shard operation failed for index [%s]: %v", indexName, err)
+			failures = append(failures, map[string]interface{}{
+				"shard":  0,
+				"index":  indexName,
+				"status": "INTERNAL_SERVER_ERROR",
+				"reason": map[string]interface{}{
+					"type":   "exception",
+					"reason": err.Error(),
+				},
+			})
+			continue
+		}
+		successful++
 	}
 
-	// 检查索引是否存在
-	if !h.dirMgr.IndexExists(indexName) {
-		common.HandleError(w, common.NewIndexNotFoundError(indexName))
-		return
+	shards := map[string]interface{}{
+		"total":      len(indexNames),
+		"successful": successful,
+		"failed":     len(failures),
+	}
+	if len(failures) > 0 {
+		shards["failures"] = failures
 	}
 
-	// 注意：bleve索引会自动刷新到磁盘
-	// 但为了符合ES API规范，我们返回成功响应
-	// 如果需要，可以在这里触发索引的强制刷新操作
-
-	// 返回成功响应
-	resp := common.SuccessResponse().
-		WithAcknowledged(true).
-		WithIndex(indexName)
-	common.HandleSuccess(w, resp, http.StatusOK)
+	return map[string]interface{}{
+		"_shards": shards,
+	}
 }
 
-// buildAliasesMap 构建别名映射（ES格式）
-func (h *IndexHandler) buildAliasesMap(aliases []string) map[string]interface{} {
+// buildAliasesMap 构建别名映射（ES格式），defs 中的别名定义输出 filter 和路由
+func (h *IndexHandler) buildAliasesMap(aliases []string, defs map[string]*metadata.AliasDefinition) map[string]interface{} {
 	if len(aliases) == 0 {
 		return make(map[string]interface{})
 	}
@@ -1267,9 +1368,22 @@ func (h *IndexHandler) buildAliasesMap(aliases []string) map[string]interface{}
 	// 预分配容量以提高性能
 	result := make(map[string]interface{}, len(aliases))
 	for _, alias := range aliases {
-		if alias != "" { // 忽略空别名
-			result[alias] = map[string]interface{}{}
+		if alias == "" { // 忽略空别名
+			continue
+		}
+		body := map[string]interface{}{}
+		if def := defs[alias]; def != nil {
+			if def.Filter != nil {
+				body["filter"] = def.Filter
+			}
+			if def.IndexRouting != "" {
+				body["index_routing"] = def.IndexRouting
+			}
+			if def.SearchRouting != "" {
+				body["search_routing"] = def.SearchRouting
+			}
 		}
+		result[alias] = body
 	}
 	return result
 }
@@ -1301,7 +1415,7 @@ func (h *IndexHandler) GetAlias(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 构建ES格式响应
-	aliases := h.buildAliasesMap(indexMeta.Aliases)
+	aliases := h.buildAliasesMap(indexMeta.Aliases, indexMeta.AliasDefinitions)
 
 	// ES格式：{ "index_name": { "aliases": { "alias1": {}, "alias2": {} } } }
 	response := map[string]interface{}{
@@ -1340,6 +1454,24 @@ func (h *IndexHandler) PutAlias(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelMetadataWrite); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	// 解析可选的别名定义：{"filter": {...}, "routing": "...", "index_routing": "...", "search_routing": "..."}
+	var body map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, common.MaxIndexBodySize)).Decode(&body); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	definition, apiErr := parseAliasDefinition(body)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 获取元数据
 	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
 	if err != nil {
@@ -1364,11 +1496,12 @@ func (h *IndexHandler) PutAlias(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 如果不存在，添加别名
+	// 如果不存在，添加别名；已存在时以新的定义为准
 	if !aliasExists {
 		indexMeta.Aliases = append(indexMeta.Aliases, aliasName)
 		indexMeta.UpdatedAt = time.Now()
 	}
+	indexMeta.AliasDefinitions = withAliasDefinition(indexMeta.AliasDefinitions, aliasName, definition)
 
 	// 保存元数据
 	if err := h.metaStore.SaveIndexMetadata(indexName, indexMeta); err != nil {
@@ -1406,6 +1539,12 @@ func (h *IndexHandler) DeleteAlias(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelMetadataWrite); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 获取元数据
 	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
 	if err != nil {
@@ -1431,6 +1570,7 @@ func (h *IndexHandler) DeleteAlias(w http.ResponseWriter, r *http.Request) {
 
 	// 更新别名列表
 	indexMeta.Aliases = newAliases
+	indexMeta.AliasDefinitions = withAliasDefinition(indexMeta.AliasDefinitions, aliasName, nil)
 	indexMeta.UpdatedAt = time.Now()
 
 	// 保存元数据
@@ -1451,7 +1591,7 @@ func (h *IndexHandler) DeleteAlias(w http.ResponseWriter, r *http.Request) {
 // GET /_alias
 func (h *IndexHandler) GetAllAliases(w http.ResponseWriter, r *http.Request) {
 	// 获取所有索引
-	indices, err := h.dirMgr.ListIndices()
+	indices, err := listTenantIndices(r.Context(), h.dirMgr)
 	if err != nil {
 		logger.Error("Failed to list indices: %v", err)
 		common.HandleError(w, common.NewInternalServerError("failed to list indices: "+err.Error()))
@@ -1469,7 +1609,7 @@ func (h *IndexHandler) GetAllAliases(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if len(indexMeta.Aliases) > 0 {
-			aliases := h.buildAliasesMap(indexMeta.Aliases)
+			aliases := h.buildAliasesMap(indexMeta.Aliases, indexMeta.AliasDefinitions)
 			response[indexName] = map[string]interface{}{
 				"aliases": aliases,
 			}
@@ -1495,7 +1635,7 @@ func (h *IndexHandler) GetAliasByName(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 获取所有索引
-	indices, err := h.dirMgr.ListIndices()
+	indices, err := listTenantIndices(r.Context(), h.dirMgr)
 	if err != nil {
 		logger.Error("Failed to list indices: %v", err)
 		common.HandleError(w, common.NewInternalServerError("failed to list indices: "+err.Error()))
@@ -1515,7 +1655,7 @@ func (h *IndexHandler) GetAliasByName(w http.ResponseWriter, r *http.Request) {
 		// 检查索引是否包含该别名
 		for _, alias := range indexMeta.Aliases {
 			if alias == aliasName {
-				aliases := h.buildAliasesMap([]string{aliasName})
+				aliases := h.buildAliasesMap([]string{aliasName}, indexMeta.AliasDefinitions)
 				response[indexName] = map[string]interface{}{
 					"aliases": aliases,
 				}
@@ -1545,7 +1685,7 @@ func (h *IndexHandler) UpdateAliases(w http.ResponseWriter, r *http.Request) {
 	var requestBody map[string]interface{}
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&requestBody); err != nil && err != io.EOF {
-		common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 		return
 	}
 
@@ -1556,125 +1696,49 @@ func (h *IndexHandler) UpdateAliases(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 执行所有操作
-	for _, actionItem := range actions {
-		action, ok := actionItem.(map[string]interface{})
-		if !ok {
-			logger.Warn("Invalid action item: %v", actionItem)
+	// 先在元数据副本上依次校验并应用所有操作，任一操作失败则整个请求失败，不写入任何修改
+	plan := &aliasActionPlan{
+		h:        h,
+		working:  make(map[string]*metadata.IndexMetadata),
+		original: make(map[string]*metadata.IndexMetadata),
+	}
+	var failures []map[string]interface{}
+	var firstErr common.APIError
+	for i, actionItem := range actions {
+		action, apiErr := parseAliasAction(actionItem)
+		if apiErr == nil {
+			apiErr = plan.apply(action)
+		}
+		if apiErr == nil {
 			continue
 		}
-
-		// 处理 add 操作
-		if addAction, ok := action["add"].(map[string]interface{}); ok {
-			indexName, _ := addAction["index"].(string)
-			aliasName, _ := addAction["alias"].(string)
-
-			if indexName == "" || aliasName == "" {
-				logger.Warn("Invalid add action: %v", addAction)
-				continue
-			}
-
-			// 检查索引是否存在
-			if !h.dirMgr.IndexExists(indexName) {
-				logger.Warn("Index [%s] not found for alias [%s]", indexName, aliasName)
-				continue
-			}
-
-			// 获取元数据
-			indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
-			if err != nil {
-				// 如果元数据不存在，创建新的
-				indexMeta = &metadata.IndexMetadata{
-					Name:      indexName,
-					Aliases:   []string{},
-					Mapping:   make(map[string]interface{}),
-					Settings:  make(map[string]interface{}),
-					Version:   1,
-					CreatedAt: time.Now(),
-					UpdatedAt: time.Now(),
-				}
-			}
-
-			// 检查别名是否已存在
-			aliasExists := false
-			for _, alias := range indexMeta.Aliases {
-				if alias == aliasName {
-					aliasExists = true
-					break
-				}
-			}
-
-			// 如果不存在，添加别名
-			if !aliasExists {
-				indexMeta.Aliases = append(indexMeta.Aliases, aliasName)
-				indexMeta.UpdatedAt = time.Now()
-
-				// 保存元数据
-				if err := h.metaStore.SaveIndexMetadata(indexName, indexMeta); err != nil {
-					logger.Error("Failed to save index metadata for [%s]: %v", indexName, err)
-				}
-			}
+		if firstErr == nil {
+			firstErr = apiErr
 		}
-
-		// 处理 remove 操作
-		if removeAction, ok := action["remove"].(map[string]interface{}); ok {
-			indexName, _ := removeAction["index"].(string)
-			aliasName, _ := removeAction["alias"].(string)
-
-			if indexName == "" || aliasName == "" {
-				logger.Warn("Invalid remove action: %v", removeAction)
-				continue
-			}
-
-			// 获取元数据
-			indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
-			if err != nil {
-				logger.Warn("Index metadata not found for [%s]", indexName)
-				continue
-			}
-
-			// 查找并删除别名
-			newAliases := make([]string, 0, len(indexMeta.Aliases))
-			for _, alias := range indexMeta.Aliases {
-				if alias != aliasName {
-					newAliases = append(newAliases, alias)
-				}
-			}
-
-			// 更新别名列表
-			indexMeta.Aliases = newAliases
-			indexMeta.UpdatedAt = time.Now()
-
-			// 保存元数据
-			if err := h.metaStore.SaveIndexMetadata(indexName, indexMeta); err != nil {
-				logger.Error("Failed to save index metadata for [%s]: %v", indexName, err)
-			}
+		failure := map[string]interface{}{
+			"action": i,
+			"error": map[string]interface{}{
+				"type":   apiErr.Type(),
+				"reason": apiErr.Error(),
+			},
+			"status": apiErr.StatusCode(),
 		}
+		if action != nil {
+			failure["type"] = action.kind
+		}
+		failures = append(failures, failure)
+	}
+	if len(failures) > 0 {
+		common.HandleError(w, newAliasActionsError(failures, firstErr, len(actions)))
+		return
+	}
 
-		// 处理 remove_index 操作（删除索引的所有别名）
-		if removeIndexAction, ok := action["remove_index"].(map[string]interface{}); ok {
-			indexName, _ := removeIndexAction["index"].(string)
-
-			if indexName == "" {
-				logger.Warn("Invalid remove_index action: %v", removeIndexAction)
-				continue
-			}
-
-			// 获取元数据
-			indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
-			if err != nil {
-				logger.Warn("Index metadata not found for [%s]", indexName)
-				continue
-			}
-
-			// 清空别名列表
-			indexMeta.Aliases = []string{}
-			indexMeta.UpdatedAt = time.Now()
-
-			// 保存元数据
-			if err := h.metaStore.SaveIndexMetadata(indexName, indexMeta); err != nil {
-				logger.Error("Failed to save index metadata for [%s]: %v", indexName, err)
-			}
+	// 所有操作一次性写入元数据
+	if changed := plan.changed(); len(changed) > 0 {
+		if err := h.metaStore.SaveIndexMetadataBatch(changed); err != nil {
+			logger.Error("Failed to save alias changes: %v", err)
+			common.HandleError(w, common.NewInternalServerError("failed to update aliases: "+err.Error()))
+			return
 		}
 	}
 
@@ -1685,9 +1749,13 @@ func (h *IndexHandler) UpdateAliases(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateMapping 更新索引的 mapping
-// PUT /{index}/_mapping
+// PUT /{index}/_mapping，索引表达式解析到多个索引时逐个更新（见 forEachResolvedIndex）
 func (h *IndexHandler) UpdateMapping(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
+	h.forEachResolvedIndex(w, r, h.updateIndexMapping)
+}
+
+// updateIndexMapping 更新单个索引的映射
+func (h *IndexHandler) updateIndexMapping(w http.ResponseWriter, r *http.Request, indexName string) {
 
 	// 验证索引是否存在
 	if !h.dirMgr.IndexExists(indexName) {
@@ -1695,6 +1763,12 @@ func (h *IndexHandler) UpdateMapping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 检查索引 block
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelMetadataWrite); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
 	// 解析请求体（兼容 chunked 传输，不依赖 Content-Length）
 	var reqBody map[string]interface{}
 	decoder := json.NewDecoder(r.Body)
@@ -1703,7 +1777,7 @@ func (h *IndexHandler) UpdateMapping(w http.ResponseWriter, r *http.Request) {
 			common.HandleError(w, common.NewBadRequestError("request body is required"))
 			return
 		}
-		common.HandleError(w, common.NewBadRequestError("invalid JSON body: "+err.Error()))
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
 		return
 	}
 
@@ -1715,6 +1789,10 @@ func (h *IndexHandler) UpdateMapping(w http.ResponseWriter, r *http.Request) {
 		newMapping = reqBody
 	}
 
+	// 与动态 mapping 串行化，避免并发写入互相覆盖
+	mappingUpdateMu.Lock()
+	defer mappingUpdateMu.Unlock()
+
 	// 获取现有元数据
 	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
 	if err != nil {
@@ -1723,6 +1801,20 @@ func (h *IndexHandler) UpdateMapping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// _routing.required 创建后不可修改
+	if _, ok := newMapping[routingField]; ok {
+		if err := validateRoutingMapping(newMapping); err != nil {
+			common.HandleError(w, newMapperParsingError(err.Error()))
+			return
+		}
+		if existing, updated := mappingRoutingRequired(indexMeta.Mapping), mappingRoutingRequired(newMapping); existing != updated {
+			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf(
+				"Mapper for [%s] conflicts with existing mapper:\n\tCannot update parameter [required] from [%t] to [%t]",
+				routingField, existing, updated)))
+			return
+		}
+	}
+
 	// 调试：记录更新前的 mapping 字段数量
 	if props, ok := indexMeta.Mapping["properties"].(map[string]interface{}); ok {
 		logger.Debug("UpdateMapping [%s] - Before update, existing mapping has %d properties", indexName, len(props))
@@ -1828,6 +1920,12 @@ func (h *IndexHandler) UpdateMapping(w http.ResponseWriter, r *http.Request) {
 		logger.Debug("UpdateMapping [%s] - Before save, merged mapping has %d properties", indexName, len(props))
 	}
 
+	// 校验字段别名（目标字段可能在本次或之前的 mapping 中定义）
+	if err := validateFieldAliases(indexMeta.Mapping); err != nil {
+		common.HandleError(w, newMapperParsingError(err.Error()))
+		return
+	}
+
 	// 保存元数据
 	indexMeta.UpdatedAt = time.Now()
 	if err := h.metaStore.SaveIndexMetadata(indexName, indexMeta); err != nil {
@@ -1918,66 +2016,81 @@ func equalSettingsValues(v1, v2 interface{}) bool {
 // ForceMerge 强制合并索引段
 // POST /{index}/_forcemerge
 // POST /_forcemerge
+// 支持参数：max_num_segments、only_expunge_deletes、wait_for_completion
 func (h *IndexHandler) ForceMerge(w http.ResponseWriter, r *http.Request) {
-	indexName := mux.Vars(r)["index"]
-
-	// 如果没有指定索引，返回错误
-	if indexName == "" {
-		common.HandleError(w, common.NewBadRequestError("index name is required"))
+	indexNames, apiErr := h.resolveShardOperationIndices(r, mux.Vars(r)["index"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
 		return
 	}
 
-	// 检查索引是否存在
-	if !h.dirMgr.IndexExists(indexName) {
-		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+	if h.indexMgr == nil {
+		common.HandleError(w, common.NewInternalServerError("index manager is not configured"))
 		return
 	}
 
-	// 获取索引路径
-	indexPath := h.dirMgr.GetIndexPath(indexName)
-
-	// 打开索引
-	idx, err := bleve.Open(indexPath)
-	if err != nil {
-		logger.Error("Failed to open index [%s] for force merge: %v", indexName, err)
-		common.HandleError(w, common.NewInternalServerError("failed to open index: "+err.Error()))
-		return
+	query := r.URL.Query()
+	opts := es.ForceMergeOptions{}
+	if v := query.Get("max_num_segments"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			common.HandleError(w, common.NewBadRequestError("max_num_segments must be a positive integer, got ["+v+"]"))
+			return
+		}
+		opts.MaxNumSegments = n
 	}
-	defer idx.Close()
-
-	// 获取底层索引并触发合并
-	advancedIdx, err := idx.Advanced()
-	if err != nil {
-		logger.Error("Failed to get advanced index [%s]: %v", indexName, err)
-		common.HandleError(w, common.NewInternalServerError("failed to get advanced index: "+err.Error()))
+	if v := query.Get("only_expunge_deletes"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			common.HandleError(w, common.NewBadRequestError("only_expunge_deletes must be a boolean, got ["+v+"]"))
+			return
+		}
+		opts.OnlyExpungeDeletes = b
+	}
+	if opts.OnlyExpungeDeletes && opts.MaxNumSegments > 0 {
+		common.HandleError(w, common.NewBadRequestError("cannot set only_expunge_deletes and max_num_segments at the same time"))
 		return
 	}
+	waitForCompletion := query.Get("wait_for_completion") != "false"
 
-	// 尝试触发合并（如果底层索引支持）
-	// Scorch 索引的 ForceMerge 方法签名: ForceMerge(ctx context.Context, mo *mergeplan.MergePlanOptions) error
-	if merger, ok := advancedIdx.(interface {
-		ForceMerge(ctx interface{}, mo interface{}) error
-	}); ok {
-		if err := merger.ForceMerge(r.Context(), nil); err != nil {
-			logger.Error("Failed to force merge index [%s]: %v", indexName, err)
-			common.HandleError(w, common.NewInternalServerError("failed to force merge: "+err.Error()))
+	// 强制合并可能耗时很长，不依赖请求上下文，通过任务取消接口中止
+	ctx, cancel := context.WithCancel(context.Background())
+	task := h.taskMgr.CreateTask(TaskActionForceMerge, "Force-merge indices "+strings.Join(indexNames, ","), strings.Join(indexNames, ","), cancel)
+
+	done := make(chan map[string]interface{}, 1)
+	go func() {
+		defer cancel()
+		indicesResult := make(map[string]interface{}, len(indexNames))
+		result := h.runShardOperation(indexNames, func(indexName string) error {
+			mergeResult, err := h.indexMgr.ForceMerge(ctx, indexName, opts)
+			if mergeResult != nil {
+				indicesResult[indexName] = mergeResult
+			}
+			if err == nil {
+				logger.Info("Force merge completed for index [%s]: segments %d -> %d", indexName, mergeResult.SegmentsBefore, mergeResult.SegmentsAfter)
+			}
+			return err
+		})
+		result["indices"] = indicesResult
+		h.taskMgr.CompleteTaskWithResult(task.TaskID, result)
+		done <- result
+	}()
+
+	var resp map[string]interface{}
+	if waitForCompletion {
+		select {
+		case resp = <-done:
+		case <-r.Context().Done():
+			// 客户端断开，合并任务继续在后台执行
 			return
 		}
-		logger.Info("Force merge triggered for index [%s]", indexName)
 	} else {
-		logger.Warn("Index [%s] does not support force merge", indexName)
-	}
-
-	// 返回成功响应
-	resp := map[string]interface{}{
-		"_shards": map[string]interface{}{
-			"total":      1,
-			"successful": 1,
-			"failed":     0,
-		},
+		resp = map[string]interface{}{"task": task.TaskID}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Failed to encode force merge response: %v", err)
+	}
 }
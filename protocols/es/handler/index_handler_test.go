@@ -17,10 +17,13 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lscgzwd/tiggerdb/directory"
 	"github.com/lscgzwd/tiggerdb/metadata"
@@ -642,3 +645,266 @@ func TestIndexHandler_GetMapping_WithMetadata(t *testing.T) {
 		t.Fatalf("expected 200 got %d, body: %s", w.Code, w.Body.String())
 	}
 }
+
+// setupIndexMaintenanceTest 创建用于索引维护类 API（refresh/flush/forcemerge 等）测试的环境
+func setupIndexMaintenanceTest(t *testing.T) (*IndexHandler, *esIndex.IndexManager, *server.Router, func()) {
+	tempDir, err := os.MkdirTemp("", "tigerdb_maintenance_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	dirMgr, err := directory.NewDirectoryManager(directory.DefaultDirectoryConfig(tempDir))
+	if err != nil {
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create directory manager: %v", err)
+	}
+
+	metaStore, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{
+		StorageType: "memory",
+		EnableCache: true,
+	})
+	if err != nil {
+		dirMgr.Cleanup()
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+
+	indexMgr := esIndex.NewIndexManager(dirMgr, metaStore)
+	indexHandler := NewIndexHandler(dirMgr, metaStore)
+	indexHandler.SetIndexManager(indexMgr)
+
+	httpSrv, _ := server.NewServer(server.DefaultServerConfig())
+	router := httpSrv.GetRouter()
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}", Handler: indexHandler.CreateIndex},
+		{Method: "POST", Path: "/{index}/_refresh", Handler: indexHandler.RefreshIndex},
+		{Method: "POST", Path: "/{index}/_flush", Handler: indexHandler.FlushIndex},
+		{Method: "POST", Path: "/{index}/_forcemerge", Handler: indexHandler.ForceMerge},
+	})
+
+	cleanup := func() {
+		indexMgr.CloseAll()
+		metaStore.Close()
+		dirMgr.Cleanup()
+		os.RemoveAll(tempDir)
+	}
+	return indexHandler, indexMgr, router, cleanup
+}
+
+func TestIndexHandler_RefreshAndFlush(t *testing.T) {
+	_, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	mux := router.Build()
+
+	for _, name := range []string{"flush_a", "flush_b"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("PUT", "/"+name, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("create %s: expected 200 got %d, body: %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	idx, err := indexMgr.GetIndex("flush_a")
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	if err := idx.Index("1", map[string]interface{}{"title": "hello"}); err != nil {
+		t.Fatalf("Failed to index document: %v", err)
+	}
+
+	for _, op := range []string{"_refresh", "_flush"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", "/flush_a,flush_b/"+op, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200 got %d, body: %s", op, w.Code, w.Body.String())
+		}
+
+		var resp map[string]map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", op, err)
+		}
+		shards := resp["_shards"]
+		if shards["total"].(float64) != 2 || shards["successful"].(float64) != 2 || shards["failed"].(float64) != 0 {
+			t.Fatalf("%s: unexpected _shards: %v", op, shards)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/missing_index/_flush", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for missing index, got %d", w.Code)
+	}
+}
+
+func TestIndexHandler_ForceMerge(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	mux := router.Build()
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("PUT", "/merge_test", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: expected 200 got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	idx, err := indexMgr.GetIndex("merge_test")
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	// 每个批次产生一个段
+	for i := 0; i < 5; i++ {
+		batch := idx.NewBatch()
+		for j := 0; j < 10; j++ {
+			batch.Index(fmt.Sprintf("doc_%d_%d", i, j), map[string]interface{}{"n": i*10 + j})
+		}
+		if err := idx.Batch(batch); err != nil {
+			t.Fatalf("Failed to index batch: %v", err)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/merge_test/_forcemerge?max_num_segments=abc", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid max_num_segments, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/merge_test/_forcemerge?max_num_segments=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("forcemerge: expected 200 got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Shards  map[string]interface{}              `json:"_shards"`
+		Indices map[string]esIndex.ForceMergeResult `json:"indices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Shards["successful"].(float64) != 1 {
+		t.Fatalf("unexpected _shards: %v", resp.Shards)
+	}
+	if got := resp.Indices["merge_test"].SegmentsAfter; got != 1 {
+		t.Fatalf("expected 1 segment after merge, got %d (%s)", got, w.Body.String())
+	}
+
+	count, err := idx.DocCount()
+	if err != nil || count != 50 {
+		t.Fatalf("expected 50 docs after merge, got %d (%v)", count, err)
+	}
+
+	// 异步执行返回任务ID
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/merge_test/_forcemerge?wait_for_completion=false", nil))
+	var taskResp map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &taskResp); err != nil || taskResp["task"] == "" {
+		t.Fatalf("expected task id in response, got %s", w.Body.String())
+	}
+	for i := 0; i < 100; i++ {
+		task := indexHandler.taskMgr.GetTask(taskResp["task"])
+		if task == nil {
+			t.Fatalf("task %s not found", taskResp["task"])
+		}
+		if task.Status != TaskStatusRunning {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if task := indexHandler.taskMgr.GetTask(taskResp["task"]); task.Status != TaskStatusCompleted {
+		t.Fatalf("expected completed task, got %s", task.Status)
+	}
+}
+
+func TestIndexHandler_IndexBlocks(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+		{Method: "PUT", Path: "/{index}/_mapping", Handler: indexHandler.UpdateMapping},
+		{Method: "PUT", Path: "/{index}/_block/{block}", Handler: indexHandler.AddIndexBlock},
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "DELETE", Path: "/{index}/_doc/{id}", Handler: docHandler.DeleteDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasSuffix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/blocked", ""); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/blocked/_doc/1", `{"title":"a"}`); w.Code >= 300 {
+		t.Fatalf("index doc before block: got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// 通过 settings 设置 write block（扁平格式）
+	if w := do("PUT", "/blocked/_settings", `{"index.blocks.write":true}`); w.Code != http.StatusOK {
+		t.Fatalf("set write block: expected 200 got %d, body: %s", w.Code, w.Body.String())
+	}
+	w := do("PUT", "/blocked/_doc/2", `{"title":"b"}`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "cluster_block_exception") {
+		t.Fatalf("write under write block: expected 403 cluster_block_exception, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", "/blocked/_doc/1", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("delete under write block: expected 403 got %d", w.Code)
+	}
+	w = do("POST", "/_bulk", "{\"index\":{\"_index\":\"blocked\",\"_id\":\"3\"}}\n{\"title\":\"c\"}\n")
+	if !strings.Contains(w.Body.String(), "cluster_block_exception") {
+		t.Fatalf("bulk under write block: expected item error, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/blocked/_search", `{"query":{"match_all":{}}}`); w.Code != http.StatusOK {
+		t.Fatalf("search under write block: expected 200 got %d", w.Code)
+	}
+
+	// 嵌套格式解除 write block
+	if w := do("PUT", "/blocked/_settings", `{"index":{"blocks":{"write":false}}}`); w.Code != http.StatusOK {
+		t.Fatalf("clear write block: expected 200 got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/blocked/_doc/2", `{"title":"b"}`); w.Code >= 300 {
+		t.Fatalf("write after clearing block: got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// _block API 设置 read block
+	w = do("PUT", "/blocked/_block/read", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"blocked":true`) {
+		t.Fatalf("add read block: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/blocked/_search", `{"query":{"match_all":{}}}`); w.Code != http.StatusForbidden {
+		t.Fatalf("search under read block: expected 403 got %d", w.Code)
+	}
+	if w := do("PUT", "/blocked/_settings", `{"index.blocks.read":null}`); w.Code != http.StatusOK {
+		t.Fatalf("reset read block: expected 200 got %d", w.Code)
+	}
+
+	// read_only 拦截写入与元数据变更，但允许修改 block 本身
+	if w := do("PUT", "/blocked/_block/read_only", ""); w.Code != http.StatusOK {
+		t.Fatalf("add read_only block: expected 200 got %d", w.Code)
+	}
+	if w := do("PUT", "/blocked/_mapping", `{"properties":{"n":{"type":"long"}}}`); w.Code != http.StatusForbidden {
+		t.Fatalf("mapping update under read_only: expected 403 got %d", w.Code)
+	}
+	if w := do("PUT", "/blocked/_settings", `{"index":{"number_of_replicas":1}}`); w.Code != http.StatusForbidden {
+		t.Fatalf("settings update under read_only: expected 403 got %d", w.Code)
+	}
+	if w := do("PUT", "/blocked/_settings", `{"index.blocks.read_only":false}`); w.Code != http.StatusOK {
+		t.Fatalf("clear read_only block: expected 200 got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/blocked/_doc/4", `{"title":"d"}`); w.Code >= 300 {
+		t.Fatalf("write after clearing read_only: got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	if w := do("PUT", "/blocked/_block/unknown", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown block: expected 400 got %d", w.Code)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// GetIndexMetaHistory 获取索引元数据（mapping、settings、别名）的历史版本
+// GET /{index}/_meta/history
+// 历史版本由元数据存储在 EnableVersioning 启用时自动记录，每次变化产生一个新版本
+func (h *IndexHandler) GetIndexMetaHistory(w http.ResponseWriter, r *http.Request) {
+	indexName := mux.Vars(r)["index"]
+
+	if err := common.ValidateIndexName(indexName); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	if !h.dirMgr.IndexExists(indexName) {
+		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+		return
+	}
+
+	history, err := h.metaStore.ListIndexMetadataHistory(indexName)
+	if err != nil {
+		logger.Error("Failed to list metadata history for [%s]: %v", indexName, err)
+		common.HandleError(w, common.NewInternalServerError("failed to get index metadata history: "+err.Error()))
+		return
+	}
+	if history == nil {
+		history = []*metadata.IndexMetadataVersion{}
+	}
+	var currentVersion int64
+	if len(history) > 0 {
+		currentVersion = history[len(history)-1].Version
+	}
+
+	response := map[string]interface{}{
+		indexName: map[string]interface{}{
+			"current_version": currentVersion,
+			"versions":        history,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode metadata history response: %v", err)
+	}
+}
+
+// RollbackIndexMeta 将索引的 mapping、settings 和别名恢复到指定历史版本
+// POST /{index}/_meta/rollback/{version}
+// 回滚本身会产生一个新的历史版本；当前的 block 设置保持不变，避免回滚意外解除或添加只读限制
+func (h *IndexHandler) RollbackIndexMeta(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	indexName := vars["index"]
+
+	if err := common.ValidateIndexName(indexName); err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	version, err := strconv.ParseInt(vars["version"], 10, 64)
+	if err != nil || version < 1 {
+		common.HandleError(w, common.NewBadRequestError("invalid metadata version ["+vars["version"]+"]"))
+		return
+	}
+	if !h.dirMgr.IndexExists(indexName) {
+		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+		return
+	}
+
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil {
+		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+		return
+	}
+	if apiErr := checkIndexBlockSettings(indexName, indexMeta.Settings, blockLevelMetadataWrite); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	target, err := h.metaStore.GetIndexMetadataHistory(indexName, version)
+	if err != nil {
+		var notFound *metadata.MetadataNotFoundError
+		if errors.As(err, &notFound) {
+			common.HandleError(w, common.NewNotFoundError(fmt.Sprintf("metadata version [%d] of index [%s] not found", version, indexName)))
+			return
+		}
+		logger.Error("Failed to get metadata version %d for [%s]: %v", version, indexName, err)
+		common.HandleError(w, common.NewInternalServerError("failed to get index metadata version: "+err.Error()))
+		return
+	}
+
+	// 历史版本中的别名可能已被同名索引占用
+	for _, alias := range target.Aliases {
+		if h.dirMgr.IndexExists(alias) {
+			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("cannot restore alias [%s], an index with the same name exists", alias)))
+			return
+		}
+	}
+
+	// 保留当前的 block 设置
+	settings := target.Settings
+	if settings == nil {
+		settings = make(map[string]interface{})
+	}
+	for path := range flattenIndexSettings(settings) {
+		if isBlockSetting(path) {
+			removeIndexSetting(settings, path)
+		}
+	}
+	for path, v := range flattenIndexSettings(indexMeta.Settings) {
+		if isBlockSetting(path) {
+			setIndexSetting(settings, path, v)
+		}
+	}
+
+	aliases := target.Aliases
+	if aliases == nil {
+		aliases = []string{}
+	}
+	mapping := target.Mapping
+	if mapping == nil {
+		mapping = make(map[string]interface{})
+	}
+
+	// 保存新的元数据对象而不是修改缓存中的对象
+	updated := *indexMeta
+	updated.Mapping = mapping
+	updated.Settings = settings
+	updated.Aliases = aliases
+	updated.JoinRelations = target.JoinRelations
+	updated.AliasDefinitions = target.AliasDefinitions
+	updated.UpdatedAt = time.Now()
+	if err := h.metaStore.SaveIndexMetadata(indexName, &updated); err != nil {
+		logger.Error("Failed to save index metadata for [%s]: %v", indexName, err)
+		common.HandleError(w, common.NewInternalServerError("failed to rollback index metadata: "+err.Error()))
+		return
+	}
+
+	currentVersion := version
+	if history, err := h.metaStore.ListIndexMetadataHistory(indexName); err == nil && len(history) > 0 {
+		currentVersion = history[len(history)-1].Version
+	}
+	logger.Info("Rolled back metadata of index [%s] to version %d (current version %d)", indexName, version, currentVersion)
+
+	response := map[string]interface{}{
+		"acknowledged":    true,
+		"index":           indexName,
+		"rolled_back_to":  version,
+		"current_version": currentVersion,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode metadata rollback response: %v", err)
+	}
+}
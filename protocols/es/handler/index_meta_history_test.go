@@ -0,0 +1,158 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_MetaHistoryAndRollback(t *testing.T) {
+	tempDir := t.TempDir()
+	dirMgr, err := directory.NewDirectoryManager(directory.DefaultDirectoryConfig(tempDir + "/data"))
+	if err != nil {
+		t.Fatalf("Failed to create directory manager: %v", err)
+	}
+	defer dirMgr.Cleanup()
+
+	metaStore, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{
+		StorageType:      "file",
+		FilePath:         tempDir + "/meta",
+		EnableCache:      true,
+		EnableVersioning: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	indexHandler := NewIndexHandler(dirMgr, metaStore)
+	httpSrv, _ := server.NewServer(server.DefaultServerConfig())
+	router := httpSrv.GetRouter()
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}", Handler: indexHandler.CreateIndex},
+		{Method: "PUT", Path: "/{index}/_mapping", Handler: indexHandler.UpdateMapping},
+		{Method: "PUT", Path: "/{index}/_alias/{name}", Handler: indexHandler.PutAlias},
+		{Method: "PUT", Path: "/{index}/_block/{block}", Handler: indexHandler.AddIndexBlock},
+		{Method: "GET", Path: "/{index}/_meta/history", Handler: indexHandler.GetIndexMetaHistory},
+		{Method: "POST", Path: "/{index}/_meta/rollback/{version}", Handler: indexHandler.RollbackIndexMeta},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	history := func() (int64, []*metadata.IndexMetadataVersion) {
+		w := do("GET", "/my_index/_meta/history", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET history: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]struct {
+			CurrentVersion int64                            `json:"current_version"`
+			Versions       []*metadata.IndexMetadataVersion `json:"versions"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse history response: %v", err)
+		}
+		return resp["my_index"].CurrentVersion, resp["my_index"].Versions
+	}
+
+	if w := do("PUT", "/my_index", `{"mappings": {"properties": {"title": {"type": "text"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("Create index: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/my_index/_mapping", `{"properties": {"price": {"type": "long"}}}`); w.Code != http.StatusOK {
+		t.Fatalf("Update mapping: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/my_index/_alias/current", ""); w.Code != http.StatusOK {
+		t.Fatalf("Put alias: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	// 重复添加同一别名不产生新版本
+	do("PUT", "/my_index/_alias/current", "")
+
+	current, versions := history()
+	if current != 3 || len(versions) != 3 {
+		t.Fatalf("Expected 3 versions, got current=%d versions=%d", current, len(versions))
+	}
+	props, _ := versions[0].Mapping["properties"].(map[string]interface{})
+	if _, ok := props["price"]; ok || len(versions[0].Aliases) != 0 {
+		t.Errorf("Expected version 1 to contain the original mapping only, got %+v", versions[0])
+	}
+	if len(versions[2].Aliases) != 1 || versions[2].Aliases[0] != "current" {
+		t.Errorf("Expected version 3 to contain alias current, got %v", versions[2].Aliases)
+	}
+
+	// 回滚到版本 1：mapping 和别名恢复，产生版本 4
+	w := do("POST", "/my_index/_meta/rollback/1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Rollback: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	meta, err := metaStore.GetIndexMetadata("my_index")
+	if err != nil {
+		t.Fatalf("Failed to get index metadata: %v", err)
+	}
+	props, _ = meta.Mapping["properties"].(map[string]interface{})
+	if _, ok := props["price"]; ok {
+		t.Errorf("Expected field price to be removed by rollback, got %v", props)
+	}
+	if _, ok := props["title"]; !ok {
+		t.Errorf("Expected field title after rollback, got %v", props)
+	}
+	if len(meta.Aliases) != 0 {
+		t.Errorf("Expected no aliases after rollback, got %v", meta.Aliases)
+	}
+	if current, versions = history(); current != 4 || len(versions) != 4 {
+		t.Errorf("Expected rollback to create version 4, got current=%d versions=%d", current, len(versions))
+	}
+
+	// 回滚保留当前的 block 设置
+	if w := do("PUT", "/my_index/_block/write", ""); w.Code != http.StatusOK {
+		t.Fatalf("Add block: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/my_index/_meta/rollback/3", ""); w.Code != http.StatusOK {
+		t.Fatalf("Rollback: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	meta, _ = metaStore.GetIndexMetadata("my_index")
+	if !indexSettingBool(meta.Settings, "blocks.write") {
+		t.Errorf("Expected write block to be kept after rollback, got %v", meta.Settings)
+	}
+	if len(meta.Aliases) != 1 {
+		t.Errorf("Expected alias restored from version 3, got %v", meta.Aliases)
+	}
+
+	if w := do("POST", "/my_index/_meta/rollback/99", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown version, got %d", w.Code)
+	}
+	if w := do("POST", "/my_index/_meta/rollback/abc", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid version, got %d", w.Code)
+	}
+	if w := do("GET", "/missing/_meta/history", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing index, got %d", w.Code)
+	}
+
+	// read_only 时拒绝回滚
+	do("PUT", "/my_index/_block/read_only", "")
+	if w := do("POST", "/my_index/_meta/rollback/1", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for rollback of a read_only index, got %d", w.Code)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_GetSegments(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "GET", Path: "/{index}/_segments", Handler: indexHandler.GetSegments},
+		{Method: "GET", Path: "/_segments", Handler: indexHandler.GetSegments},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/seg_test", `{"mappings":{"properties":{"n":{"type":"long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	// 每个批次生成一个段
+	for b := 0; b < 3; b++ {
+		var body strings.Builder
+		for k := 0; k < 4; k++ {
+			fmt.Fprintf(&body, "{\"index\":{\"_index\":\"seg_test\",\"_id\":\"%d-%d\"}}\n{\"n\":%d}\n", b, k, k)
+		}
+		if w := do("POST", "/_bulk?refresh=true", body.String()); w.Code != http.StatusOK {
+			t.Fatalf("bulk %d: got %d: %s", b, w.Code, w.Body.String())
+		}
+	}
+	if w := do("POST", "/_bulk?refresh=true", "{\"delete\":{\"_index\":\"seg_test\",\"_id\":\"0-0\"}}\n"); w.Code != http.StatusOK {
+		t.Fatalf("bulk delete: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/seg_test/_flush", ""); w.Code != http.StatusOK {
+		t.Fatalf("flush: got %d: %s", w.Code, w.Body.String())
+	}
+
+	type segmentsResponse struct {
+		Shards struct {
+			Successful int `json:"successful"`
+		} `json:"_shards"`
+		Indices map[string]struct {
+			Shards map[string][]struct {
+				Routing struct {
+					Primary bool   `json:"primary"`
+					Node    string `json:"node"`
+				} `json:"routing"`
+				NumCommittedSegments int `json:"num_committed_segments"`
+				NumSearchSegments    int `json:"num_search_segments"`
+				Segments             map[string]struct {
+					Generation     uint64 `json:"generation"`
+					NumDocs        int    `json:"num_docs"`
+					DeletedDocs    int    `json:"deleted_docs"`
+					SizeInBytes    int64  `json:"size_in_bytes"`
+					MemoryInBytes  int64  `json:"memory_in_bytes"`
+					Committed      bool   `json:"committed"`
+					Compound       bool   `json:"compound"`
+					MemoryResident bool   `json:"memory_resident"`
+				} `json:"segments"`
+			} `json:"shards"`
+		} `json:"indices"`
+	}
+	w := do("GET", "/seg_test/_segments", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("segments: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp segmentsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Shards.Successful != 1 {
+		t.Fatalf("expected 1 successful shard: %s", w.Body.String())
+	}
+	shards := resp.Indices["seg_test"].Shards["0"]
+	if len(shards) != 1 || !shards[0].Routing.Primary || shards[0].Routing.Node != NodeName {
+		t.Fatalf("unexpected shard routing: %s", w.Body.String())
+	}
+	shard := shards[0]
+	if shard.NumSearchSegments == 0 || shard.NumSearchSegments != len(shard.Segments) {
+		t.Fatalf("expected num_search_segments to match segments: %s", w.Body.String())
+	}
+	// 背景合并可能合并部分段，但文档数与删除数的总和不变
+	numDocs, deletedDocs := 0, 0
+	for name, seg := range shard.Segments {
+		if want := "_" + strconv.FormatUint(seg.Generation, 36); name != want {
+			t.Errorf("segment %s: expected name %s", name, want)
+		}
+		if !seg.Committed || !seg.Compound || seg.MemoryResident {
+			t.Errorf("segment %s: expected committed segment after flush, got %+v", name, seg)
+		}
+		if seg.SizeInBytes <= 0 || seg.MemoryInBytes < 0 {
+			t.Errorf("segment %s: expected on-disk size, got %+v", name, seg)
+		}
+		numDocs += seg.NumDocs
+		deletedDocs += seg.DeletedDocs
+	}
+	if shard.NumCommittedSegments != len(shard.Segments) {
+		t.Errorf("expected all segments committed: %s", w.Body.String())
+	}
+	if numDocs != 11 || deletedDocs > 1 {
+		t.Errorf("expected 11 live docs and at most 1 deleted doc, got %d and %d: %s", numDocs, deletedDocs, w.Body.String())
+	}
+
+	// 不指定索引时列出全部索引
+	w = do("GET", "/_segments", "")
+	resp = segmentsResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("all segments: got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := resp.Indices["seg_test"]; !ok {
+		t.Errorf("expected seg_test in all segments: %s", w.Body.String())
+	}
+
+	if w := do("GET", "/missing/_segments", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing index: expected 404 got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 索引 settings 在元数据中的保存形式并不统一：
+// 创建索引时可能是 {"index": {"blocks": {"write": true}}}，
+// 更新设置时可能是 {"blocks.write": true} 或 {"index.blocks.write": true}。
+// 以下辅助函数以点分路径（不含 "index." 前缀）统一读写这些形式。
+
+// lookupIndexSetting 按点分路径查找 settings 中的值
+// path 示例："blocks.write"、"max_result_window"
+func lookupIndexSetting(settings map[string]interface{}, path string) (interface{}, bool) {
+	if settings == nil || path == "" {
+		return nil, false
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "index."), ".")
+	// 优先查找带 "index" 前缀的形式，再查找不带前缀的形式
+	if v, ok := lookupSettingParts(settings, append([]string{"index"}, parts...)); ok {
+		return v, true
+	}
+	return lookupSettingParts(settings, parts)
+}
+
+// lookupSettingParts 在嵌套 map 中查找路径，每一层都允许键本身包含点号
+func lookupSettingParts(m map[string]interface{}, parts []string) (interface{}, bool) {
+	for i := len(parts); i >= 1; i-- {
+		v, ok := m[strings.Join(parts[:i], ".")]
+		if !ok {
+			continue
+		}
+		if i == len(parts) {
+			return v, true
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			if found, ok := lookupSettingParts(sub, parts[i:]); ok {
+				return found, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// removeIndexSetting 删除 settings 中某个路径的所有表示形式，并清理因此变空的子对象
+func removeIndexSetting(settings map[string]interface{}, path string) {
+	if settings == nil || path == "" {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "index."), ".")
+	removeSettingParts(settings, append([]string{"index"}, parts...))
+	removeSettingParts(settings, parts)
+}
+
+func removeSettingParts(m map[string]interface{}, parts []string) {
+	for i := len(parts); i >= 1; i-- {
+		key := strings.Join(parts[:i], ".")
+		v, ok := m[key]
+		if !ok {
+			continue
+		}
+		if i == len(parts) {
+			delete(m, key)
+			continue
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			removeSettingParts(sub, parts[i:])
+			if len(sub) == 0 {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+// setIndexSetting 设置某个路径的值（先清理其他表示形式，再以嵌套形式写入 "index" 下）
+func setIndexSetting(settings map[string]interface{}, path string, value interface{}) {
+	if settings == nil || path == "" {
+		return
+	}
+	removeIndexSetting(settings, path)
+	parts := strings.Split(strings.TrimPrefix(path, "index."), ".")
+	current := settings
+	for _, part := range append([]string{"index"}, parts[:len(parts)-1]...) {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+// flattenIndexSettings 将 settings 展开为点分路径（去掉 "index." 前缀）到叶子值的映射
+func flattenIndexSettings(settings map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	flattenSettingsInto(flat, "", settings)
+	return flat
+}
+
+func flattenSettingsInto(flat map[string]interface{}, prefix string, m map[string]interface{}) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+			flattenSettingsInto(flat, key, sub)
+			continue
+		}
+		flat[strings.TrimPrefix(key, "index.")] = v
+	}
+}
+
+// parseSettingBool 解析布尔类型的设置值（ES 允许 true/"true"）
+func parseSettingBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse value [%s] as only [true] or [false] are allowed", v)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("failed to parse value [%v] as only [true] or [false] are allowed", v)
+	}
+}
+
+// indexSettingBool 读取布尔类型的设置，不存在或无法解析时返回 false
+func indexSettingBool(settings map[string]interface{}, path string) bool {
+	v, ok := lookupIndexSetting(settings, path)
+	if !ok {
+		return false
+	}
+	b, err := parseSettingBool(v)
+	return err == nil && b
+}
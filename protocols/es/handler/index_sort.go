@@ -0,0 +1,158 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 索引排序（index.sort.*）
+// 创建索引时指定 index.sort.field / order / mode / missing，scorch 在写入每个段时
+// 按该顺序排列文档；查询的首个排序键与索引排序一致且 track_total_hits 为 false 时，
+// 收集器可以跳过不可能进入结果的文档（提前终止）。该设置创建后不可修改。
+
+// indexSortSetting 设置项路径前缀（不含 "index." 前缀）
+const indexSortSetting = "sort"
+
+// indexSortFieldTypes 可作为索引排序字段的类型
+var indexSortFieldTypes = map[string]bool{
+	"keyword": true, "long": true, "integer": true, "short": true, "byte": true,
+	"unsigned_long": true, "double": true, "float": true, "half_float": true,
+	"scaled_float": true, "date": true, "date_nanos": true, "boolean": true,
+}
+
+// indexSortValues 读取 index.sort.<name>，可以是单个字符串或字符串数组
+func indexSortValues(settings map[string]interface{}, name string) ([]string, error) {
+	v, ok := lookupIndexSetting(settings, indexSortSetting+"."+name)
+	if !ok || v == nil {
+		return nil, nil
+	}
+	switch v := v.(type) {
+	case string:
+		return splitSettingList(v), nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value [%v] for setting [index.%s.%s]", v, indexSortSetting, name)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("failed to parse value [%v] for setting [index.%s.%s]", v, indexSortSetting, name)
+	}
+}
+
+// splitSettingList 解析逗号分隔的列表设置（"a,b"）
+func splitSettingList(v string) []string {
+	var values []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// parseIndexSort 校验 index.sort.* 设置并转换为 scorch 的 indexSort 配置，未设置时返回 nil
+func parseIndexSort(settings map[string]interface{}, mapping map[string]interface{}) ([]interface{}, common.APIError) {
+	fields, err := indexSortValues(settings, "field")
+	if err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+	var options [3][]string
+	for i, name := range []string{"order", "mode", "missing"} {
+		values, err := indexSortValues(settings, name)
+		if err != nil {
+			return nil, common.NewBadRequestError(err.Error())
+		}
+		if values != nil && len(values) != len(fields) {
+			return nil, common.NewBadRequestError(fmt.Sprintf("index.sort.field:%v index.sort.%s:%v, size mismatch", fields, name, values))
+		}
+		options[i] = values
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	fieldTypes := make(map[string]string)
+	if props, ok := mapping["properties"].(map[string]interface{}); ok {
+		collectFieldTypes(props, "", fieldTypes)
+	}
+
+	indexSort := make([]interface{}, 0, len(fields))
+	for i, field := range fields {
+		fieldType, ok := fieldTypes[field]
+		if !ok {
+			return nil, common.NewBadRequestError(fmt.Sprintf("unknown index sort field:[%s]", field))
+		}
+		if !indexSortFieldTypes[fieldType] {
+			return nil, common.NewBadRequestError(fmt.Sprintf("invalid index sort field:[%s]", field))
+		}
+
+		desc := false
+		if options[0] != nil {
+			switch options[0][i] {
+			case "asc":
+			case "desc":
+				desc = true
+			default:
+				return nil, common.NewBadRequestError(fmt.Sprintf("Illegal sort order:%s", options[0][i]))
+			}
+		}
+		// 与查询排序一致：默认升序取最小值、降序取最大值
+		mode := "min"
+		if desc {
+			mode = "max"
+		}
+		if options[1] != nil {
+			switch options[1][i] {
+			case "min", "max":
+				mode = options[1][i]
+			default:
+				return nil, common.NewBadRequestError(fmt.Sprintf("Illegal sort mode: %s", options[1][i]))
+			}
+		}
+		missing := "last"
+		if options[2] != nil {
+			switch options[2][i] {
+			case "_last":
+			case "_first":
+				missing = "first"
+			default:
+				return nil, common.NewBadRequestError(fmt.Sprintf("Illegal missing value:[%s], must be one of [_last, _first]", options[2][i]))
+			}
+		}
+
+		indexSort = append(indexSort, map[string]interface{}{
+			"by":      "field",
+			"field":   field,
+			"desc":    desc,
+			"mode":    mode,
+			"missing": missing,
+		})
+	}
+	return indexSort, nil
+}
+
+// isIndexSortSetting 判断设置路径（不含 "index." 前缀）是否属于 index.sort.*
+func isIndexSortSetting(path string) bool {
+	return path == indexSortSetting || strings.HasPrefix(path, indexSortSetting+".")
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_IndexSort(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/logs", `{
+		"settings":{"index":{"sort.field":"@timestamp","sort.order":"desc"}},
+		"mappings":{"properties":{"@timestamp":{"type":"date"},"host":{"type":"keyword"}}}
+	}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 3 个批次各 10 个文档，时间戳乱序写入，每个批次生成一个有序的段
+	const numDocs = 30
+	for batch := 0; batch < 3; batch++ {
+		var body strings.Builder
+		for k := batch * 10; k < batch*10+10; k++ {
+			second := k * 17 % numDocs
+			fmt.Fprintf(&body, "{\"index\":{\"_index\":\"logs\",\"_id\":\"%d\"}}\n", second)
+			fmt.Fprintf(&body, "{\"@timestamp\":\"2024-01-01T00:00:%02dZ\",\"host\":\"h%d\"}\n", second, k%3)
+		}
+		if w := do("POST", "/_bulk?refresh=true", body.String()); w.Code != http.StatusOK {
+			t.Fatalf("bulk %d: got %d: %s", batch, w.Code, w.Body.String())
+		}
+	}
+
+	type searchResponse struct {
+		Hits struct {
+			Total json.RawMessage `json:"total"`
+			Hits  []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	search := func(body string) searchResponse {
+		t.Helper()
+		w := do("POST", "/logs/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp searchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+	ids := func(resp searchResponse) []string {
+		rv := make([]string, 0, len(resp.Hits.Hits))
+		for _, hit := range resp.Hits.Hits {
+			rv = append(rv, hit.ID)
+		}
+		return rv
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		expected  []string
+		withTotal bool
+	}{
+		{
+			name:     "latest without total",
+			body:     `{"size":5,"sort":[{"@timestamp":"desc"}],"track_total_hits":false}`,
+			expected: []string{"29", "28", "27", "26", "25"},
+		},
+		{
+			name:      "latest with total",
+			body:      `{"size":5,"sort":[{"@timestamp":{"order":"desc"}}]}`,
+			expected:  []string{"29", "28", "27", "26", "25"},
+			withTotal: true,
+		},
+		{
+			name:     "latest with from",
+			body:     `{"from":3,"size":4,"sort":[{"@timestamp":"desc"}],"track_total_hits":false}`,
+			expected: []string{"26", "25", "24", "23"},
+		},
+		{
+			name:     "latest of a host",
+			body:     `{"size":3,"query":{"term":{"host":"h0"}},"sort":[{"@timestamp":"desc"}],"track_total_hits":false}`,
+			expected: []string{"27", "24", "21"},
+		},
+		{
+			name:     "opposite order",
+			body:     `{"size":3,"sort":[{"@timestamp":"asc"}],"track_total_hits":false}`,
+			expected: []string{"0", "1", "2"},
+		},
+	}
+	for _, tt := range tests {
+		resp := search(tt.body)
+		if got := ids(resp); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+		if tt.withTotal != (resp.Hits.Total != nil) {
+			t.Errorf("%s: unexpected hits.total %s", tt.name, resp.Hits.Total)
+		}
+	}
+
+	// 合并后的段保留各批次的有序区间
+	if w := do("POST", "/logs/_forcemerge?max_num_segments=1", ""); w.Code != http.StatusOK {
+		t.Fatalf("forcemerge: got %d: %s", w.Code, w.Body.String())
+	}
+	resp := search(`{"size":5,"sort":[{"@timestamp":"desc"}],"track_total_hits":false}`)
+	if got, expected := ids(resp), []string{"29", "28", "27", "26", "25"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("after forcemerge: expected %v, got %v", expected, got)
+	}
+
+	// index.sort.* 创建后不可修改
+	if w := do("PUT", "/logs/_settings", `{"index":{"sort.order":"asc"}}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "non dynamic settings") {
+		t.Errorf("update sort settings: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	invalid := []struct {
+		settings string
+		message  string
+	}{
+		{`{"index":{"sort.field":"missing"}}`, "unknown index sort field:[missing]"},
+		{`{"index":{"sort.field":"message"}}`, "invalid index sort field:[message]"},
+		{`{"index":{"sort.field":["@timestamp","host"],"sort.order":["desc"]}}`, "size mismatch"},
+		{`{"index":{"sort.field":"@timestamp","sort.order":"down"}}`, "Illegal sort order:down"},
+		{`{"index":{"sort.field":"@timestamp","sort.mode":"avg"}}`, "Illegal sort mode: avg"},
+		{`{"index":{"sort.field":"@timestamp","sort.missing":"0"}}`, "Illegal missing value:[0]"},
+	}
+	for i, tt := range invalid {
+		name := fmt.Sprintf("invalid_sort_%d", i)
+		w := do("PUT", "/"+name, `{"settings":`+tt.settings+`,
+			"mappings":{"properties":{"@timestamp":{"type":"date"},"host":{"type":"keyword"},"message":{"type":"text"}}}}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", tt.settings, tt.message, w.Code, w.Body.String())
+		}
+		if indexHandler.dirMgr.IndexExists(name) {
+			t.Errorf("%s: index should not be created", tt.settings)
+		}
+	}
+}
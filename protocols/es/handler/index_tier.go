@@ -0,0 +1,153 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 冷热分层数据目录
+// 数据目录按层标签（如 SSD 上的 hot、HDD 上的 warm）配置，索引通过 index.routing.allocation.require.tier
+// 选择所在的层：创建时直接在该层创建目录，之后修改该设置或调用 POST /{index}/_migrate_tier
+// 会在线迁移索引文件（复制期间索引可读、禁止写入，替换目录时短暂关闭索引）。
+
+// allocationTierSetting 设置项路径（不含 "index." 前缀）
+const allocationTierSetting = "routing.allocation.require.tier"
+
+// parseAllocationTier 校验 index.routing.allocation.require.tier 设置，层必须已配置数据目录，未设置时返回 ""
+func (h *IndexHandler) parseAllocationTier(settings map[string]interface{}) (string, common.APIError) {
+	v, ok := lookupIndexSetting(settings, allocationTierSetting)
+	if !ok || v == nil {
+		return "", nil
+	}
+	tier, ok := v.(string)
+	if !ok || tier == "" {
+		return "", common.NewBadRequestError(fmt.Sprintf("failed to parse value [%v] for setting [index.%s]", v, allocationTierSetting))
+	}
+	if apiErr := h.validateTier(tier); apiErr != nil {
+		return "", apiErr
+	}
+	return tier, nil
+}
+
+// validateTier 检查层是否配置了数据目录
+func (h *IndexHandler) validateTier(tier string) common.APIError {
+	tiers := h.dirMgr.ListTiers()
+	for _, t := range tiers {
+		if t == tier {
+			return nil
+		}
+	}
+	return common.NewBadRequestError(fmt.Sprintf("no data path is configured for tier [%s], available tiers: [%s]", tier, strings.Join(tiers, ", ")))
+}
+
+// relocateIndex 将索引迁移到指定层的数据目录，已位于该层时不做任何操作
+func (h *IndexHandler) relocateIndex(ctx context.Context, indexName, tier string) common.APIError {
+	if tier == "" || h.dirMgr.GetIndexTier(indexName) == tier {
+		return nil
+	}
+	if h.indexMgr == nil {
+		return common.NewInternalServerError("index manager is not available")
+	}
+
+	release := addTemporaryIndexBlock(indexName, "tier migration in progress")
+	defer release()
+	start := time.Now()
+	if err := h.indexMgr.MigrateIndexTier(ctx, indexName, tier); err != nil {
+		logger.Error("Failed to migrate index [%s] to tier [%s]: %v", indexName, tier, err)
+		return common.NewInternalServerError(fmt.Sprintf("failed to migrate index [%s] to tier [%s]: %v", indexName, tier, err))
+	}
+	logger.Info("Migrated index [%s] to tier [%s] in %v", indexName, tier, time.Since(start))
+	return nil
+}
+
+// MigrateTier 处理 POST /{index}/_migrate_tier 请求，将索引迁移到其他层并更新 index.routing.allocation.require.tier
+// 目标层通过 tier 参数或请求体 {"tier": "warm"} 指定
+func (h *IndexHandler) MigrateTier(w http.ResponseWriter, r *http.Request) {
+	h.forEachResolvedIndex(w, r, h.migrateIndexTier)
+}
+
+// migrateIndexTier 迁移单个索引
+func (h *IndexHandler) migrateIndexTier(w http.ResponseWriter, r *http.Request, indexName string) {
+	if !h.dirMgr.IndexExists(indexName) {
+		common.HandleError(w, common.NewIndexNotFoundError(indexName))
+		return
+	}
+
+	var requestBody struct {
+		Tier string `json:"tier"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	tier := r.URL.Query().Get("tier")
+	if tier == "" {
+		tier = requestBody.Tier
+	}
+	if tier == "" {
+		common.HandleError(w, common.NewBadRequestError("tier is missing"))
+		return
+	}
+	if apiErr := h.validateTier(tier); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelMetadataWrite); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	previousTier := h.dirMgr.GetIndexTier(indexName)
+	if apiErr := h.relocateIndex(r.Context(), indexName, tier); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	// 记录索引所在的层，之后通过 _settings 修改时以此为准
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil {
+		common.HandleError(w, common.NewInternalServerError("failed to get index metadata: "+err.Error()))
+		return
+	}
+	if v, _ := lookupIndexSetting(indexMeta.Settings, allocationTierSetting); v != tier {
+		if indexMeta.Settings == nil {
+			indexMeta.Settings = make(map[string]interface{})
+		}
+		setIndexSetting(indexMeta.Settings, allocationTierSetting, tier)
+		indexMeta.UpdatedAt = time.Now()
+		if err := h.metaStore.SaveIndexMetadata(indexName, indexMeta); err != nil {
+			logger.Error("Failed to save index metadata for [%s]: %v", indexName, err)
+			common.HandleError(w, common.NewInternalServerError("failed to update index settings: "+err.Error()))
+			return
+		}
+	}
+
+	resp := common.SuccessResponse().WithData(map[string]interface{}{
+		"index":         indexName,
+		"tier":          tier,
+		"previous_tier": previousTier,
+	})
+	common.HandleSuccess(w, resp, http.StatusOK)
+}
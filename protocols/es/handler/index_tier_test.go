@@ -0,0 +1,205 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+	esIndex "github.com/lscgzwd/tiggerdb/protocols/es/index"
+)
+
+func TestIndexHandler_MigrateTier(t *testing.T) {
+	tempDir := t.TempDir()
+	hotDir, warmDir := filepath.Join(tempDir, "hot"), filepath.Join(tempDir, "warm")
+	dirConfig := directory.DefaultDirectoryConfig(hotDir)
+	dirConfig.DataPaths = []directory.DataPath{{Path: warmDir, Tier: "warm"}}
+	dirMgr, err := directory.NewDirectoryManager(dirConfig)
+	if err != nil {
+		t.Fatalf("Failed to create directory manager: %v", err)
+	}
+	metaStore, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{StorageType: "memory", EnableCache: true})
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+	indexMgr := esIndex.NewIndexManager(dirMgr, metaStore)
+	defer indexMgr.CloseAll()
+	indexHandler := NewIndexHandler(dirMgr, metaStore)
+	indexHandler.SetIndexManager(indexMgr)
+	docHandler := NewDocumentHandler(indexMgr, dirMgr, metaStore)
+
+	httpSrv, _ := server.NewServer(server.DefaultServerConfig())
+	router := httpSrv.GetRouter()
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}", Handler: indexHandler.CreateIndex},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "GET", Path: "/{index}/_settings", Handler: indexHandler.GetSettings},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+		{Method: "POST", Path: "/{index}/_migrate_tier", Handler: indexHandler.MigrateTier},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	checkLocation := func(name, tier string) {
+		t.Helper()
+		if got := dirMgr.GetIndexTier(name); got != tier {
+			t.Errorf("%s: expected tier %s, got %q", name, tier, got)
+		}
+		for dataTier, dir := range map[string]string{"hot": hotDir, "warm": warmDir} {
+			_, err := os.Stat(filepath.Join(dir, "indices", name))
+			if exists := err == nil; exists != (dataTier == tier) {
+				t.Errorf("%s: index directory on tier %s exists: %v", name, dataTier, exists)
+			}
+		}
+	}
+	count := func(name string) int {
+		t.Helper()
+		w := do("POST", "/"+name+"/_search", `{"query":{"match_all":{}}}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", name, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Hits struct {
+				Total struct {
+					Value int `json:"value"`
+				} `json:"total"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Hits.Total.Value
+	}
+	bulk := func(name string, from, to int) {
+		t.Helper()
+		var body strings.Builder
+		for i := from; i < to; i++ {
+			fmt.Fprintf(&body, "{\"index\":{\"_index\":%q,\"_id\":\"%d\"}}\n{\"n\":%d}\n", name, i, i)
+		}
+		if w := do("POST", "/_bulk?refresh=true", body.String()); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"errors":true`) {
+			t.Fatalf("bulk %s: got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	if tiers := dirMgr.ListTiers(); fmt.Sprint(tiers) != "[hot warm]" {
+		t.Fatalf("expected tiers [hot warm], got %v", tiers)
+	}
+
+	// 创建时按设置选择所在的层
+	if w := do("PUT", "/archive", `{"settings":{"index":{"routing":{"allocation":{"require":{"tier":"warm"}}}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create archive: got %d: %s", w.Code, w.Body.String())
+	}
+	checkLocation("archive", "warm")
+	bulk("archive", 0, 3)
+	if n := count("archive"); n != 3 {
+		t.Errorf("archive: expected 3 hits, got %d", n)
+	}
+
+	if w := do("PUT", "/events", ""); w.Code != http.StatusOK {
+		t.Fatalf("create events: got %d: %s", w.Code, w.Body.String())
+	}
+	checkLocation("events", "hot")
+	bulk("events", 0, 5)
+
+	// 在线迁移到 warm 层，迁移后数据可读写
+	w := do("POST", "/events/_migrate_tier", `{"tier":"warm"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("migrate events: got %d: %s", w.Code, w.Body.String())
+	}
+	var migrated struct {
+		Acknowledged bool   `json:"acknowledged"`
+		Index        string `json:"index"`
+		Tier         string `json:"tier"`
+		PreviousTier string `json:"previous_tier"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &migrated); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !migrated.Acknowledged || migrated.Index != "events" || migrated.Tier != "warm" || migrated.PreviousTier != "hot" {
+		t.Errorf("unexpected migrate response: %s", w.Body.String())
+	}
+	checkLocation("events", "warm")
+	if n := count("events"); n != 5 {
+		t.Errorf("events: expected 5 hits after migration, got %d", n)
+	}
+	bulk("events", 5, 7)
+	if n := count("events"); n != 7 {
+		t.Errorf("events: expected 7 hits after writing to the migrated index, got %d", n)
+	}
+	w = do("GET", "/events/_settings", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tier":"warm"`) {
+		t.Errorf("expected tier setting to be recorded, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 迁移到当前所在的层不移动文件
+	w = do("POST", "/events/_migrate_tier?tier=warm", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &migrated); err != nil || w.Code != http.StatusOK || migrated.PreviousTier != "warm" {
+		t.Errorf("migrate to the same tier: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 修改设置同样会迁移
+	if w := do("PUT", "/events/_settings", `{"index":{"routing.allocation.require.tier":"hot"}}`); w.Code != http.StatusOK {
+		t.Fatalf("update tier setting: got %d: %s", w.Code, w.Body.String())
+	}
+	checkLocation("events", "hot")
+	if n := count("events"); n != 7 {
+		t.Errorf("events: expected 7 hits after moving back, got %d", n)
+	}
+
+	invalid := []struct {
+		method, path, body string
+		code               int
+		message            string
+	}{
+		{"PUT", "/cold_index", `{"settings":{"index.routing.allocation.require.tier":"cold"}}`, http.StatusBadRequest, "no data path is configured for tier [cold], available tiers: [hot, warm]"},
+		{"PUT", "/bad_tier", `{"settings":{"index.routing.allocation.require.tier":1}}`, http.StatusBadRequest, "failed to parse value [1] for setting [index.routing.allocation.require.tier]"},
+		{"POST", "/events/_migrate_tier", `{"tier":"cold"}`, http.StatusBadRequest, "no data path is configured for tier [cold]"},
+		{"POST", "/events/_migrate_tier", `{}`, http.StatusBadRequest, "tier is missing"},
+		{"PUT", "/events/_settings", `{"index":{"routing.allocation.require.tier":"cold"}}`, http.StatusBadRequest, "no data path is configured for tier [cold]"},
+		{"POST", "/missing/_migrate_tier", `{"tier":"warm"}`, http.StatusNotFound, "index_not_found_exception"},
+	}
+	for _, tt := range invalid {
+		w := do(tt.method, tt.path, tt.body)
+		if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s %s %s: expected %d with %q, got %d: %s", tt.method, tt.path, tt.body, tt.code, tt.message, w.Code, w.Body.String())
+		}
+	}
+	for _, name := range []string{"cold_index", "bad_tier"} {
+		if dirMgr.IndexExists(name) {
+			t.Errorf("%s: index should not be created", name)
+		}
+	}
+	checkLocation("events", "hot")
+}
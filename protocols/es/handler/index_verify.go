@@ -0,0 +1,146 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	es "github.com/lscgzwd/tiggerdb/protocols/es/index"
+)
+
+// 索引校验（POST /{index}/_verify）
+// 逐段校验 zap 文件的 CRC-32 与删除文档数（es.VerifyStore），并比较 mapping 字段与已索引字段：
+// 已索引但不在 mapping 中（自身及各级父字段均未定义）的字段视为不一致。以 "_" 开头的内部字段不参与比较。
+
+// VerifyIndex 校验索引的段文件与 mapping 一致性
+// POST /{index}/_verify
+func (h *IndexHandler) VerifyIndex(w http.ResponseWriter, r *http.Request) {
+	indexNames, apiErr := h.resolveShardOperationIndices(r, mux.Vars(r)["index"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if h.indexMgr == nil {
+		common.HandleError(w, common.NewInternalServerError("index manager is not available"))
+		return
+	}
+
+	valid := true
+	reports := make(map[string]interface{}, len(indexNames))
+	for _, indexName := range indexNames {
+		report := h.verifyIndex(indexName)
+		if !report["valid"].(bool) {
+			valid = false
+		}
+		reports[indexName] = report
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":   valid,
+		"indices": reports,
+	}); err != nil {
+		logger.Error("Failed to encode verify response: %v", err)
+	}
+}
+
+// verifyIndex 生成单个索引的校验报告
+func (h *IndexHandler) verifyIndex(indexName string) map[string]interface{} {
+	invalid := func(err error) map[string]interface{} {
+		return map[string]interface{}{
+			"valid":    false,
+			"problems": []string{err.Error()},
+		}
+	}
+
+	idx, err := h.indexMgr.GetIndex(indexName)
+	if err != nil {
+		return invalid(err)
+	}
+	store, err := es.VerifyStore(idx)
+	if err != nil {
+		return invalid(fmt.Errorf("failed to verify segments: %w", err))
+	}
+	problems := append(make([]string, 0), store.Problems...)
+
+	persisted, corrupted := 0, 0
+	for _, seg := range store.Segments {
+		if !seg.InMemory {
+			persisted++
+		}
+		if !seg.Valid {
+			corrupted++
+		}
+	}
+
+	mapped := make(map[string]string)
+	if indexMeta, err := h.metaStore.GetIndexMetadata(indexName); err == nil && indexMeta != nil {
+		if props, ok := indexMeta.Mapping["properties"].(map[string]interface{}); ok {
+			collectFieldTypes(props, "", mapped)
+		}
+	}
+	indexed := 0
+	unmapped := make([]string, 0)
+	for _, field := range store.IndexedFields {
+		if strings.HasPrefix(field, "_") {
+			continue
+		}
+		indexed++
+		if !isMappedField(mapped, field) {
+			unmapped = append(unmapped, field)
+			problems = append(problems, fmt.Sprintf("field [%s] is indexed but not mapped", field))
+		}
+	}
+	sort.Strings(unmapped)
+
+	return map[string]interface{}{
+		"valid": len(problems) == 0,
+		"segments": map[string]interface{}{
+			"total":     len(store.Segments),
+			"persisted": persisted,
+			"in_memory": len(store.Segments) - persisted,
+			"corrupted": corrupted,
+			"details":   store.Segments,
+		},
+		"fields": map[string]interface{}{
+			"mapped":   len(mapped),
+			"indexed":  indexed,
+			"unmapped": unmapped,
+		},
+		"problems": problems,
+	}
+}
+
+// isMappedField 字段自身或任一父字段（如 geo_point 的 loc.lat）在 mapping 中定义
+func isMappedField(mapped map[string]string, field string) bool {
+	for {
+		if _, ok := mapped[field]; ok {
+			return true
+		}
+		i := strings.LastIndex(field, ".")
+		if i < 0 {
+			return false
+		}
+		field = field[:i]
+	}
+}
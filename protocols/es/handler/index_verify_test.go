@@ -0,0 +1,157 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_VerifyIndex(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_verify", Handler: indexHandler.VerifyIndex},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	type verifyResponse struct {
+		Valid   bool `json:"valid"`
+		Indices map[string]struct {
+			Valid    bool `json:"valid"`
+			Segments struct {
+				Total     int `json:"total"`
+				Persisted int `json:"persisted"`
+				Corrupted int `json:"corrupted"`
+				Details   []struct {
+					Name  string `json:"name"`
+					Docs  int    `json:"num_docs"`
+					Valid bool   `json:"valid"`
+					Error string `json:"error"`
+				} `json:"details"`
+			} `json:"segments"`
+			Fields struct {
+				Mapped   int      `json:"mapped"`
+				Indexed  int      `json:"indexed"`
+				Unmapped []string `json:"unmapped"`
+			} `json:"fields"`
+			Problems []string `json:"problems"`
+		} `json:"indices"`
+	}
+	verify := func() verifyResponse {
+		t.Helper()
+		w := do("POST", "/logs/_verify", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("verify: got %d: %s", w.Code, w.Body.String())
+		}
+		var resp verifyResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	if w := do("PUT", "/logs", `{"mappings":{"properties":{"message":{"type":"text"},"loc":{"type":"geo_point"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := "{\"index\":{\"_index\":\"logs\",\"_id\":\"1\"}}\n{\"message\":\"hello\",\"loc\":{\"lat\":1,\"lon\":2},\"level\":\"info\"}\n" +
+		"{\"index\":{\"_index\":\"logs\",\"_id\":\"2\"}}\n{\"message\":\"world\"}\n"
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/logs/_flush", ""); w.Code != http.StatusOK {
+		t.Fatalf("flush: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 动态映射的字段（level 及其 keyword 子字段）写入 mapping，geo_point 的子字段归属于父字段
+	resp := verify()
+	report := resp.Indices["logs"]
+	if !resp.Valid || !report.Valid || len(report.Problems) != 0 {
+		t.Fatalf("expected valid index, got %+v", resp)
+	}
+	if report.Segments.Persisted == 0 || report.Segments.Persisted != report.Segments.Total {
+		t.Fatalf("expected persisted segments after flush, got %+v", report.Segments)
+	}
+	if report.Fields.Mapped != 4 || len(report.Fields.Unmapped) != 0 {
+		t.Errorf("unexpected fields report %+v", report.Fields)
+	}
+
+	// 已索引但从 mapping 中消失的字段
+	indexMeta, err := indexHandler.metaStore.GetIndexMetadata("logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(indexMeta.Mapping["properties"].(map[string]interface{}), "level")
+	if err := indexHandler.metaStore.SaveIndexMetadata("logs", indexMeta); err != nil {
+		t.Fatal(err)
+	}
+	resp = verify()
+	report = resp.Indices["logs"]
+	if resp.Valid || report.Valid || len(report.Fields.Unmapped) != 1 || report.Fields.Unmapped[0] != "level" {
+		t.Fatalf("expected unmapped field [level], got %+v", resp)
+	}
+
+	// 损坏段文件中的一个字节
+	scorchPath := filepath.Join(indexHandler.dirMgr.GetIndexPath("logs"), "store", "store")
+	segmentName := report.Segments.Details[0].Name
+	f, err := os.OpenFile(filepath.Join(scorchPath, segmentName), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	resp = verify()
+	report = resp.Indices["logs"]
+	if resp.Valid || report.Segments.Corrupted != 1 {
+		t.Fatalf("expected one corrupted segment, got %+v", resp)
+	}
+	for _, seg := range report.Segments.Details {
+		if seg.Name == segmentName && (seg.Valid || !strings.Contains(seg.Error, "checksum failed")) {
+			t.Errorf("expected checksum failure of [%s], got %+v", segmentName, seg)
+		}
+	}
+
+	if w := do("POST", "/missing/_verify", ""); w.Code != http.StatusNotFound {
+		t.Errorf("verify missing index: expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// 索引预热（index.warmer.*）
+// 索引打开后（启动恢复或按需打开）由 IndexManager 回调 WarmIndex：
+//   - warmer.fields：字段名列表（支持通配符），预先构建 terms 聚合使用的词项字典，并按字段排序遍历全部文档以加载各段的 doc values
+//   - warmer.queries：搜索请求体列表，按普通搜索执行一次
+//   - warmer.enabled：设为 false 时跳过预热（默认 true）
+// 设置可通过 _settings 动态修改，在下次打开索引时生效；单个步骤失败不影响其余步骤，失败计入 _stats 的 warmer.failed。
+
+// 设置项路径（不含 "index." 前缀）
+const (
+	warmerEnabledSetting = "warmer.enabled"
+	warmerFieldsSetting  = "warmer.fields"
+	warmerQueriesSetting = "warmer.queries"
+)
+
+// indexWarmerConfig 索引的预热配置
+type indexWarmerConfig struct {
+	fields  []string
+	queries []map[string]interface{}
+}
+
+// parseIndexWarmer 解析并校验索引的预热设置，未配置或已禁用时返回 nil
+func parseIndexWarmer(settings map[string]interface{}) (*indexWarmerConfig, error) {
+	cfg := &indexWarmerConfig{}
+	if v, ok := lookupIndexSetting(settings, warmerFieldsSetting); ok && v != nil {
+		fields, err := parseWarmerFields(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.fields = fields
+	}
+	if v, ok := lookupIndexSetting(settings, warmerQueriesSetting); ok && v != nil {
+		queries, err := parseWarmerQueries(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.queries = queries
+	}
+	enabled := true
+	if v, ok := lookupIndexSetting(settings, warmerEnabledSetting); ok && v != nil {
+		b, err := parseSettingBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("illegal value for setting [index.%s]: %s", warmerEnabledSetting, err.Error())
+		}
+		enabled = b
+	}
+	if !enabled || (len(cfg.fields) == 0 && len(cfg.queries) == 0) {
+		return nil, nil
+	}
+	return cfg, nil
+}
+
+// parseWarmerFields 解析 warmer.fields：字段名数组或逗号分隔的字符串
+func parseWarmerFields(value interface{}) ([]string, error) {
+	var fields []string
+	switch v := value.(type) {
+	case string:
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			field, ok := item.(string)
+			if !ok || field == "" {
+				return nil, fmt.Errorf("failed to parse value [%v] for setting [index.%s], expected field names", value, warmerFieldsSetting)
+			}
+			fields = append(fields, field)
+		}
+	default:
+		return nil, fmt.Errorf("failed to parse value [%v] for setting [index.%s], expected field names", value, warmerFieldsSetting)
+	}
+	return fields, nil
+}
+
+// parseWarmerQueries 解析 warmer.queries：搜索请求体数组，每个请求体必须能解析为搜索请求
+func parseWarmerQueries(value interface{}) ([]map[string]interface{}, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse value [%v] for setting [index.%s], expected an array of search requests", value, warmerQueriesSetting)
+	}
+	queries := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		body, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failed to parse [index.%s.%d], expected a search request but found [%v]", warmerQueriesSetting, i, item)
+		}
+		if _, err := decodeWarmerQuery(body); err != nil {
+			return nil, fmt.Errorf("failed to parse [index.%s.%d]: %s", warmerQueriesSetting, i, err.Error())
+		}
+		queries = append(queries, body)
+	}
+	return queries, nil
+}
+
+// decodeWarmerQuery 将预热查询的请求体解码为搜索请求
+func decodeWarmerQuery(body map[string]interface{}) (*SearchRequest, error) {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	var searchReq SearchRequest
+	if err := json.Unmarshal(bodyBytes, &searchReq); err != nil {
+		return nil, err
+	}
+	return &searchReq, nil
+}
+
+// validateWarmerSettingUpdates 校验 _settings 中的预热设置（flatUpdates 为不含 "index." 前缀的点分路径）
+func validateWarmerSettingUpdates(flatUpdates map[string]interface{}) error {
+	if v, ok := flatUpdates[warmerFieldsSetting]; ok && v != nil {
+		if _, err := parseWarmerFields(v); err != nil {
+			return err
+		}
+	}
+	if v, ok := flatUpdates[warmerQueriesSetting]; ok && v != nil {
+		if _, err := parseWarmerQueries(v); err != nil {
+			return err
+		}
+	}
+	if v, ok := flatUpdates[warmerEnabledSetting]; ok && v != nil {
+		if _, err := parseSettingBool(v); err != nil {
+			return fmt.Errorf("illegal value for setting [index.%s]: %s", warmerEnabledSetting, err.Error())
+		}
+	}
+	return nil
+}
+
+// WarmIndex 按索引的预热设置预热刚打开的索引，作为 IndexManager 的预热回调
+func (h *DocumentHandler) WarmIndex(ctx context.Context, indexName string, idx bleve.Index) error {
+	if h.metaStore == nil {
+		return nil
+	}
+	meta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || meta == nil {
+		return nil
+	}
+	cfg, err := parseIndexWarmer(meta.Settings)
+	if err != nil || cfg == nil {
+		return err
+	}
+
+	var failures []string
+	fields, err := warmerFieldNames(idx, cfg.fields)
+	if err != nil {
+		failures = append(failures, err.Error())
+	}
+	for _, field := range fields {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// 词项字典
+		h.facetTermsDictionary(idx, field)
+		// doc values：按字段排序时收集器读取每个命中文档的 doc values
+		req := bleve.NewSearchRequestOptions(query.NewMatchAllQuery(), 1, 0, false)
+		req.SortByCustom(search.SortOrder{&search.SortField{Field: field}})
+		if _, err := idx.SearchInContext(ctx, req); err != nil {
+			failures = append(failures, fmt.Sprintf("field [%s]: %v", field, err))
+		}
+	}
+	for i, body := range cfg.queries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		searchReq, err := decodeWarmerQuery(body)
+		if err == nil {
+			_, err = h.executeSearchInternal(ctx, idx, indexName, searchReq)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("query [%d]: %v", i, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// warmerFieldNames 展开预热字段中的通配符，返回排序去重后的字段名
+func warmerFieldNames(idx bleve.Index, patterns []string) ([]string, error) {
+	var indexed []string
+	seen := make(map[string]bool)
+	var rv []string
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "*") {
+			if !seen[pattern] {
+				seen[pattern] = true
+				rv = append(rv, pattern)
+			}
+			continue
+		}
+		if indexed == nil {
+			fields, err := idx.Fields()
+			if err != nil {
+				return rv, fmt.Errorf("failed to list fields: %w", err)
+			}
+			indexed = fields
+		}
+		for _, field := range indexed {
+			if !strings.HasPrefix(field, "_") && simpleWildcardMatch(pattern, field) && !seen[field] {
+				seen[field] = true
+				rv = append(rv, field)
+			}
+		}
+	}
+	sort.Strings(rv)
+	return rv, nil
+}
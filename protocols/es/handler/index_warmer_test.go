@@ -0,0 +1,161 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+	esIndex "github.com/lscgzwd/tiggerdb/protocols/es/index"
+)
+
+func TestDocumentHandler_IndexWarmer(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	statsHandler := NewStatsHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	indexMgr.SetWarmer(docHandler.WarmIndex)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+		{Method: "GET", Path: "/{index}/_stats", Handler: statsHandler.GetIndexStats},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/logs", `{
+		"settings":{"index":{"warmer":{"fields":["host","n*"],"queries":[{"query":{"term":{"host":"a"}},"aggs":{"hosts":{"terms":{"field":"host"}}}}]}}},
+		"mappings":{"properties":{"host":{"type":"keyword"},"n1":{"type":"long"},"n2":{"type":"long"}}}
+	}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var body strings.Builder
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&body, "{\"index\":{\"_index\":\"logs\",\"_id\":\"%d\"}}\n", i)
+		fmt.Fprintf(&body, "{\"host\":%q,\"n1\":%d,\"n2\":%d}\n", string(rune('a'+i%2)), i, i*10)
+	}
+	if w := do("POST", "/_bulk?refresh=true", body.String()); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 关闭后重新打开索引触发后台预热
+	reopen := func(expectedTotal uint64) esIndex.WarmerStats {
+		t.Helper()
+		if err := indexMgr.CloseIndex("logs"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := indexMgr.GetIndex("logs"); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			stats := indexMgr.WarmerStats("logs")
+			if stats.Total >= expectedTotal && stats.Current == 0 {
+				return stats
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("index was not warmed up: %+v", stats)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if stats := reopen(1); stats.Total != 1 || stats.Failed != 0 {
+		t.Errorf("expected one successful warmup, got %+v", stats)
+	}
+
+	// 预热字段展开通配符
+	idx, err := indexMgr.GetIndex("logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := warmerFieldNames(idx, []string{"n*", "host", "host"})
+	if err != nil || fmt.Sprint(fields) != "[host n1 n2]" {
+		t.Errorf("expected fields [host n1 n2], got %v (%v)", fields, err)
+	}
+
+	// 预热步骤失败时计入 failed，其余步骤照常执行
+	if w := do("PUT", "/logs/_settings", `{"index":{"warmer.queries":[{"query":{"no_such_query":{}}}]}}`); w.Code != http.StatusOK {
+		t.Fatalf("update warmer queries: got %d: %s", w.Code, w.Body.String())
+	}
+	if stats := reopen(1); stats.Total != 1 || stats.Failed != 1 {
+		t.Errorf("expected one failed warmup, got %+v", stats)
+	}
+
+	// 禁用后不再执行预热步骤
+	if w := do("PUT", "/logs/_settings", `{"index":{"warmer":{"enabled":false}}}`); w.Code != http.StatusOK {
+		t.Fatalf("disable warmer: got %d: %s", w.Code, w.Body.String())
+	}
+	if stats := reopen(1); stats.Failed != 0 {
+		t.Errorf("expected disabled warmer to succeed, got %+v", stats)
+	}
+
+	w := do("GET", "/logs/_stats", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats: got %d: %s", w.Code, w.Body.String())
+	}
+	var stats struct {
+		Indices map[string]struct {
+			Primaries struct {
+				Warmer struct {
+					Total int `json:"total"`
+				} `json:"warmer"`
+			} `json:"primaries"`
+		} `json:"indices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if stats.Indices["logs"].Primaries.Warmer.Total != 1 {
+		t.Errorf("expected warmer stats, got %s", w.Body.String())
+	}
+
+	invalid := []struct {
+		settings string
+		message  string
+	}{
+		{`{"index":{"warmer":{"fields":[1]}}}`, "for setting [index.warmer.fields], expected field names"},
+		{`{"index":{"warmer":{"queries":"match_all"}}}`, "for setting [index.warmer.queries], expected an array of search requests"},
+		{`{"index":{"warmer":{"queries":[{"size":"ten"}]}}}`, "failed to parse [index.warmer.queries.0]"},
+		{`{"index":{"warmer":{"enabled":"maybe"}}}`, "illegal value for setting [index.warmer.enabled]"},
+	}
+	for i, tt := range invalid {
+		if w := do("PUT", "/logs/_settings", tt.settings); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("update %s: expected 400 with %q, got %d: %s", tt.settings, tt.message, w.Code, w.Body.String())
+		}
+		name := fmt.Sprintf("invalid_warmer_%d", i)
+		if w := do("PUT", "/"+name, `{"settings":`+tt.settings+`}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("create %s: expected 400 with %q, got %d: %s", tt.settings, tt.message, w.Code, w.Body.String())
+		}
+		if indexHandler.dirMgr.IndexExists(name) {
+			t.Errorf("%s: index should not be created", tt.settings)
+		}
+	}
+}
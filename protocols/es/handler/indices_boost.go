@@ -0,0 +1,104 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lscgzwd/tiggerdb/search"
+)
+
+// indices_boost：按命中所在的索引调整得分
+// ES格式: "indices_boost": [{"logs-2024": 2.0}, {"logs-*": 1.5}]，键为索引名、别名或通配符表达式。
+// 一个索引匹配多条时取第一条，未匹配的索引权重为 1。已废弃的对象形式 {"logs-2024": 2.0} 按键名排序后处理。
+// 每个索引的搜索在收集结果后将得分乘以该索引的权重（先于 min_score 过滤）。目前一次搜索只针对一个索引，
+// 权重只改变得分的绝对值；跨索引搜索合并各索引的结果时按加权后的得分排序即可得到 ES 的效果。
+
+// indexBoost indices_boost 中的一条
+type indexBoost struct {
+	expression string
+	boost      float64
+}
+
+// parseIndicesBoost 解析 indices_boost 参数
+func parseIndicesBoost(value interface{}) ([]indexBoost, error) {
+	var entries []map[string]interface{}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		for _, item := range v {
+			entry, ok := item.(map[string]interface{})
+			if !ok || len(entry) != 1 {
+				return nil, fmt.Errorf("[indices_boost] entries must be objects with a single index name, found [%v]", item)
+			}
+			entries = append(entries, entry)
+		}
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			entries = append(entries, map[string]interface{}{name: v[name]})
+		}
+	default:
+		return nil, fmt.Errorf("[indices_boost] must be an array of objects, found [%v]", value)
+	}
+
+	rv := make([]indexBoost, 0, len(entries))
+	for _, entry := range entries {
+		for name, b := range entry {
+			boost, ok := b.(float64)
+			if !ok || boost < 0 {
+				return nil, fmt.Errorf("[indices_boost] boost for [%s] must be a non-negative number, found [%v]", name, b)
+			}
+			rv = append(rv, indexBoost{expression: name, boost: boost})
+		}
+	}
+	return rv, nil
+}
+
+// indexBoostFor 返回索引的权重：第一条与索引名或其别名匹配的表达式的权重，没有匹配时为 1
+func (h *DocumentHandler) indexBoostFor(indexName string, boosts []indexBoost) float64 {
+	if len(boosts) == 0 {
+		return 1
+	}
+	names := []string{indexName}
+	if meta, err := h.metaStore.GetIndexMetadata(indexName); err == nil && meta != nil {
+		names = append(names, meta.Aliases...)
+	}
+	for _, b := range boosts {
+		for _, name := range names {
+			if simpleWildcardMatch(b.expression, name) {
+				return b.boost
+			}
+		}
+	}
+	return 1
+}
+
+// applyIndexBoost 将命中的得分与最高分乘以索引权重
+func applyIndexBoost(hits search.DocumentMatchCollection, maxScore *float64, boost float64) {
+	if boost == 1 {
+		return
+	}
+	for _, hit := range hits {
+		hit.Score *= boost
+	}
+	*maxScore *= boost
+}
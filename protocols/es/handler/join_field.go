@@ -0,0 +1,119 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+)
+
+// join 字段（父子文档）
+// 文档中的 join 字段值（"question" 或 {"name": "answer", "parent": "1"}）在索引时展开为
+// _join_name / _join_parent 两个内部字段，has_child / has_parent 查询基于这两个字段执行。
+
+// joinFieldValue 解析 join 字段值，返回关系名与父文档ID
+func joinFieldValue(v interface{}) (name, parent string) {
+	switch jv := v.(type) {
+	case string:
+		return jv, ""
+	case map[string]interface{}:
+		name, _ = jv["name"].(string)
+		parent, _ = jv["parent"].(string)
+	}
+	return name, parent
+}
+
+// applyJoinField 为包含 join 字段的文档添加 _join_name / _join_parent
+// 内部字段不能出现在 _source 中，因此缺少 _source 时先保存原始文档
+func (h *DocumentHandler) applyJoinField(indexName string, docData map[string]interface{}) map[string]interface{} {
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil || indexMeta.JoinRelations == nil {
+		return docData
+	}
+	name, parent := joinFieldValue(docData[indexMeta.JoinRelations.FieldName])
+	if name == "" {
+		return docData
+	}
+
+	result := make(map[string]interface{}, len(docData)+3)
+	for k, v := range docData {
+		result[k] = v
+	}
+	if _, hasSource := docData["_source"]; !hasSource {
+		sourceJSON, _ := json.Marshal(docData)
+		result["_source"] = string(sourceJSON)
+	}
+	result["_join_name"] = name
+	if parent != "" {
+		result["_join_parent"] = parent
+	}
+	return result
+}
+
+// buildInnerHits 构建命中文档的 inner_hits（has_child 返回匹配的子文档，has_parent 返回父文档）
+// 请求角色不可见的文档不返回，_source 去掉不可见的字段
+func (h *DocumentHandler) buildInnerHits(idx bleve.Index, indexName, hitID string, joinInfos []*dsl.JoinQueryInfo, access *middleware.IndexAccess) map[string]interface{} {
+	var innerHits map[string]interface{}
+	for _, info := range joinInfos {
+		if info.InnerHits == nil {
+			continue
+		}
+		matches := info.InnerHitMatches[hitID]
+		if len(matches) == 0 {
+			continue
+		}
+
+		maxScore := 0.0
+		for _, m := range matches {
+			if m.Score > maxScore {
+				maxScore = m.Score
+			}
+		}
+
+		hits := make([]map[string]interface{}, 0, info.InnerHits.Size)
+		for i := info.InnerHits.From; i < len(matches) && len(hits) < info.InnerHits.Size; i++ {
+			if !h.documentVisible(idx, indexName, access, matches[i].ID) {
+				continue
+			}
+			hit := map[string]interface{}{
+				"_index": indexName,
+				"_id":    matches[i].ID,
+				"_score": matches[i].Score,
+			}
+			if doc, err := idx.Document(matches[i].ID); err == nil && doc != nil {
+				hit["_source"] = access.FilterSource(h.extractDocumentFields(doc))
+			}
+			hits = append(hits, hit)
+		}
+
+		if innerHits == nil {
+			innerHits = make(map[string]interface{})
+		}
+		innerHits[info.InnerHits.Name] = map[string]interface{}{
+			"hits": map[string]interface{}{
+				"total": map[string]interface{}{
+					"value":    len(matches),
+					"relation": "eq",
+				},
+				"max_score": maxScore,
+				"hits":      hits,
+			},
+		}
+	}
+	return innerHits
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+type joinTestHits struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			ID        string  `json:"_id"`
+			Score     float64 `json:"_score"`
+			InnerHits map[string]struct {
+				Hits struct {
+					Total struct {
+						Value int `json:"value"`
+					} `json:"total"`
+					Hits []struct {
+						ID     string                 `json:"_id"`
+						Source map[string]interface{} `json:"_source"`
+					} `json:"hits"`
+				} `json:"hits"`
+			} `json:"inner_hits"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func TestDocumentHandler_JoinQueries(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	search := func(body string) joinTestHits {
+		t.Helper()
+		w := do("POST", "/qa/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp joinTestHits
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode search response: %v", err)
+		}
+		return resp
+	}
+
+	createBody := `{"mappings":{"properties":{
+		"title":{"type":"text"},
+		"body":{"type":"text"},
+		"my_join":{"type":"join","relations":{"question":"answer"}}
+	}}}`
+	if w := do("PUT", "/qa", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := map[string]string{
+		"q1": `{"title":"go channels","my_join":"question"}`,
+		"q2": `{"title":"go maps","my_join":{"name":"question"}}`,
+		"a1": `{"body":"use buffered channels","my_join":{"name":"answer","parent":"q1"}}`,
+		"a2": `{"body":"unbuffered channels block","my_join":{"name":"answer","parent":"q1"}}`,
+		"a3": `{"body":"channels are typed","my_join":{"name":"answer","parent":"q2"}}`,
+	}
+	for id, body := range docs {
+		if w := do("PUT", "/qa/_doc/"+id+"?refresh=true", body); w.Code >= 300 {
+			t.Fatalf("index %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	// has_child score_mode=sum：q1 有两个匹配的子文档，得分应高于 q2
+	resp := search(`{"query":{"has_child":{"type":"answer","score_mode":"sum","query":{"match":{"body":"channels"}}}}}`)
+	if resp.Hits.Total.Value != 2 || resp.Hits.Hits[0].ID != "q1" {
+		t.Fatalf("has_child sum: expected q1 first of 2 hits, got %+v", resp.Hits)
+	}
+	if resp.Hits.Hits[0].Score <= resp.Hits.Hits[1].Score {
+		t.Errorf("has_child sum: q1 score %v should exceed q2 score %v", resp.Hits.Hits[0].Score, resp.Hits.Hits[1].Score)
+	}
+
+	// score_mode=none：得分为常量
+	resp = search(`{"query":{"has_child":{"type":"answer","query":{"match":{"body":"channels"}}}}}`)
+	if resp.Hits.Total.Value != 2 || resp.Hits.Hits[0].Score != resp.Hits.Hits[1].Score {
+		t.Errorf("has_child none: expected constant scores, got %+v", resp.Hits)
+	}
+
+	// min_children / max_children
+	resp = search(`{"query":{"has_child":{"type":"answer","min_children":2,"query":{"match":{"body":"channels"}}}}}`)
+	if resp.Hits.Total.Value != 1 || resp.Hits.Hits[0].ID != "q1" {
+		t.Errorf("min_children=2: expected only q1, got %+v", resp.Hits)
+	}
+	resp = search(`{"query":{"has_child":{"type":"answer","max_children":1,"query":{"match":{"body":"channels"}}}}}`)
+	if resp.Hits.Total.Value != 1 || resp.Hits.Hits[0].ID != "q2" {
+		t.Errorf("max_children=1: expected only q2, got %+v", resp.Hits)
+	}
+	if w := do("POST", "/qa/_search", `{"query":{"has_child":{"type":"answer","min_children":3,"max_children":1,"query":{"match_all":{}}}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("max_children < min_children: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/qa/_search", `{"query":{"has_child":{"type":"answer","score_mode":"median","query":{"match_all":{}}}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid score_mode: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// has_child inner_hits：返回匹配的子文档
+	resp = search(`{"query":{"has_child":{"type":"answer","score_mode":"max","query":{"match":{"body":"channels"}},"inner_hits":{"size":1}}}}`)
+	for _, hit := range resp.Hits.Hits {
+		inner, ok := hit.InnerHits["answer"]
+		if !ok {
+			t.Fatalf("has_child inner_hits missing for %s", hit.ID)
+		}
+		wantTotal := map[string]int{"q1": 2, "q2": 1}[hit.ID]
+		if inner.Hits.Total.Value != wantTotal || len(inner.Hits.Hits) != 1 {
+			t.Errorf("inner_hits for %s: expected total %d with 1 hit, got %+v", hit.ID, wantTotal, inner.Hits)
+		}
+		if inner.Hits.Hits[0].Source["body"] == nil {
+			t.Errorf("inner hit should carry _source: %+v", inner.Hits.Hits[0])
+		}
+	}
+
+	// has_parent score=true + inner_hits：子文档继承父文档得分
+	resp = search(`{"query":{"has_parent":{"parent_type":"question","score":true,"query":{"match":{"title":"channels"}},"inner_hits":{"name":"parent"}}}}`)
+	if resp.Hits.Total.Value != 2 {
+		t.Fatalf("has_parent: expected 2 answers of q1, got %+v", resp.Hits)
+	}
+	for _, hit := range resp.Hits.Hits {
+		if hit.ID != "a1" && hit.ID != "a2" {
+			t.Errorf("has_parent: unexpected hit %s", hit.ID)
+		}
+		if hit.Score <= 0 {
+			t.Errorf("has_parent score=true: expected parent score, got %v", hit.Score)
+		}
+		inner := hit.InnerHits["parent"]
+		if len(inner.Hits.Hits) != 1 || inner.Hits.Hits[0].ID != "q1" {
+			t.Errorf("has_parent inner_hits: expected parent q1, got %+v", inner.Hits)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// mapping 存在性检查与兼容路由
+// HEAD /{index}/_mapping 检查索引是否存在；GET /_mapping 返回请求可见的所有索引的 mapping；
+// GET /{index}/_mapping/{type} 供仍然携带类型的旧客户端使用，返回与 GET /{index} 相同的带类型包装的 mapping，
+// 类型支持逗号分隔与通配符，_all 匹配所有类型。
+
+// typedMappings 返回带类型包装的 mapping
+// 已有类型包装的 mapping（如从 ES 6.x 迁移的 {"ips": {...}}）原样返回，
+// 顶级包含 properties 或 dynamic_templates 的 ES 7.x+ 格式包装在默认类型 _doc 下
+func typedMappings(mapping map[string]interface{}) map[string]interface{} {
+	if mapping == nil {
+		return map[string]interface{}{
+			"_doc": make(map[string]interface{}),
+		}
+	}
+	_, hasProperties := mapping["properties"]
+	_, hasDynamicTemplates := mapping["dynamic_templates"]
+	if hasProperties || hasDynamicTemplates {
+		return map[string]interface{}{
+			"_doc": mapping,
+		}
+	}
+	return mapping
+}
+
+// HeadMapping 检查索引是否存在
+// HEAD /{index}/_mapping
+func (h *IndexHandler) HeadMapping(w http.ResponseWriter, r *http.Request) {
+	h.HeadIndex(w, r)
+}
+
+// GetAllMappings 获取所有索引的映射，跳过禁止读取元数据的索引
+// GET /_mapping
+func (h *IndexHandler) GetAllMappings(w http.ResponseWriter, r *http.Request) {
+	indices, apiErr := h.resolveIndexPattern(r, "_all")
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	response := make(map[string]interface{}, len(indices))
+	for _, indexName := range indices {
+		mapping := make(map[string]interface{})
+		if indexMeta, err := h.metaStore.GetIndexMetadata(indexName); err == nil && indexMeta != nil && indexMeta.Mapping != nil {
+			mapping = indexMeta.Mapping
+		}
+		response[indexName] = map[string]interface{}{
+			"mappings": mapping,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode mappings response: %v", err)
+	}
+}
+
+// GetTypedMapping 获取索引指定类型的映射（旧客户端的带类型路由）
+// GET /{index}/_mapping/{type}
+func (h *IndexHandler) GetTypedMapping(w http.ResponseWriter, r *http.Request) {
+	indexExpr := mux.Vars(r)["index"]
+	patterns := splitCommaList(mux.Vars(r)["type"])
+
+	indexNames, apiErr := h.resolveIndices(r, indexExpr, defaultIndicesOptions)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	response := make(map[string]interface{}, len(indexNames))
+	for _, indexName := range indexNames {
+		if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelMetadataRead); apiErr != nil {
+			if isWildcardIndexExpression(indexExpr) {
+				continue
+			}
+			common.HandleError(w, apiErr)
+			return
+		}
+
+		var mapping map[string]interface{}
+		if indexMeta, err := h.metaStore.GetIndexMetadata(indexName); err == nil && indexMeta != nil {
+			mapping = indexMeta.Mapping
+		}
+
+		matched := make(map[string]interface{})
+		for name, def := range typedMappings(mapping) {
+			for _, pattern := range patterns {
+				if pattern == "_all" || simpleWildcardMatch(pattern, name) {
+					matched[name] = def
+					break
+				}
+			}
+		}
+		if len(matched) > 0 {
+			response[indexName] = map[string]interface{}{
+				"mappings": matched,
+			}
+		}
+	}
+	if len(response) == 0 {
+		common.HandleError(w, &common.BaseError{
+			ErrType:    "type_missing_exception",
+			Message:    fmt.Sprintf("type[[%s]] missing", strings.Join(patterns, ", ")),
+			HTTPStatus: http.StatusNotFound,
+			Code:       "TYPE_MISSING",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode typed mapping response: %v", err)
+	}
+}
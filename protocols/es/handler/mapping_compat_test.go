@@ -0,0 +1,95 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_MappingCompat(t *testing.T) {
+	indexHandler, _, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	router.AddRoutes([]server.Route{
+		{Method: "HEAD", Path: "/{index:[^_][^/]*}/_mapping", Handler: indexHandler.HeadMapping},
+		{Method: "GET", Path: "/{index:[^_][^/]*}/_mapping/{type}", Handler: indexHandler.GetTypedMapping},
+		{Method: "GET", Path: "/_mapping", Handler: indexHandler.GetAllMappings},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	mappings := func(w *httptest.ResponseRecorder) map[string]map[string]interface{} {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]struct {
+			Mappings map[string]interface{} `json:"mappings"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		rv := make(map[string]map[string]interface{})
+		for name, v := range resp {
+			rv[name] = v.Mappings
+		}
+		return rv
+	}
+
+	for _, name := range []string{"products", "orders"} {
+		if w := do("PUT", "/"+name, `{"mappings":{"properties":{"name":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+			t.Fatalf("create %s: got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	if w := do("HEAD", "/products/_mapping", ""); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("head existing: got %d: %q", w.Code, w.Body.String())
+	}
+	if w := do("HEAD", "/missing/_mapping", ""); w.Code != http.StatusNotFound {
+		t.Errorf("head missing: got %d", w.Code)
+	}
+
+	all := mappings(do("GET", "/_mapping", ""))
+	if len(all) != 2 || all["products"]["properties"] == nil || all["orders"]["properties"] == nil {
+		t.Errorf("unexpected mappings of all indices: %v", all)
+	}
+
+	for _, typeName := range []string{"_doc", "_all", "_d*", "other,_doc"} {
+		typed := mappings(do("GET", "/products/_mapping/"+typeName, ""))
+		doc, _ := typed["products"]["_doc"].(map[string]interface{})
+		if len(typed["products"]) != 1 || doc["properties"] == nil {
+			t.Errorf("%s: unexpected typed mapping %v", typeName, typed)
+		}
+	}
+	if w := do("GET", "/products/_mapping/user", ""); w.Code != http.StatusNotFound ||
+		!strings.Contains(w.Body.String(), "type[[user]] missing") {
+		t.Errorf("missing type: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/missing/_mapping/_doc", ""); w.Code != http.StatusNotFound ||
+		!strings.Contains(w.Body.String(), "index_not_found_exception") {
+		t.Errorf("missing index: got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/numeric"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 字段映射查询（_mapping/field）
+// 元数据中的 mapping 与 bleve 索引中实际存在的字段可能不一致（如动态写入的字段未写回元数据），
+// 这里将两者合并：未在 mapping 中声明的已索引字段按词项推断类型后一并返回。
+
+// UnmappedIndexFields 返回已写入索引但不在元数据 mapping 中的字段及推断类型
+func (h *IndexHandler) UnmappedIndexFields(indexName string) (map[string]string, error) {
+	mapped := make(map[string]string)
+	if meta, err := h.metaStore.GetIndexMetadata(indexName); err == nil && meta != nil {
+		if props, ok := meta.Mapping["properties"].(map[string]interface{}); ok {
+			collectFieldTypes(props, "", mapped)
+		}
+	}
+
+	unmapped := make(map[string]string)
+	if h.indexMgr == nil {
+		return unmapped, nil
+	}
+	idx, err := h.indexMgr.GetIndex(indexName)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := idx.Fields()
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		// 跳过内部字段（_id、_all、_source 等）
+		if strings.HasPrefix(field, "_") {
+			continue
+		}
+		if _, ok := mapped[field]; ok {
+			continue
+		}
+		unmapped[field] = inferIndexedFieldType(idx, field)
+	}
+	return unmapped, nil
+}
+
+// inferIndexedFieldType 按字段的首个词项推断类型（数值以前缀编码存储）
+func inferIndexedFieldType(idx bleve.Index, field string) string {
+	dict, err := idx.FieldDict(field)
+	if err != nil {
+		return "text"
+	}
+	defer dict.Close()
+	entry, err := dict.Next()
+	if err != nil || entry == nil {
+		return "text"
+	}
+	if valid, _ := numeric.ValidPrefixCodedTerm(entry.Term); valid {
+		return "double"
+	}
+	return "text"
+}
+
+// GetFieldMapping 获取指定字段的映射
+// GET /{index}/_mapping/field/{field}, GET /_mapping/field/{field}
+func (h *IndexHandler) GetFieldMapping(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	patterns := splitCommaList(vars["field"])
+	if len(patterns) == 0 {
+		common.HandleError(w, common.NewBadRequestError("field name is required"))
+		return
+	}
+
+	indexNames, apiErr := h.resolveIndexPattern(r, vars["index"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	result := make(map[string]interface{}, len(indexNames))
+	for _, indexName := range indexNames {
+		defs := make(map[string]map[string]interface{})
+		if meta, err := h.metaStore.GetIndexMetadata(indexName); err == nil && meta != nil {
+			if props, ok := meta.Mapping["properties"].(map[string]interface{}); ok {
+				collectFieldDefinitions(props, "", defs)
+			}
+		}
+		if unmapped, err := h.UnmappedIndexFields(indexName); err == nil {
+			for field, fieldType := range unmapped {
+				defs[field] = map[string]interface{}{"type": fieldType}
+			}
+		}
+
+		mappings := make(map[string]interface{})
+		for field, def := range defs {
+			if !matchFieldPatterns(patterns, field) {
+				continue
+			}
+			leaf := field
+			if i := strings.LastIndex(field, "."); i >= 0 {
+				leaf = field[i+1:]
+			}
+			mappings[field] = map[string]interface{}{
+				"full_name": field,
+				"mapping":   map[string]interface{}{leaf: def},
+			}
+		}
+		result[indexName] = map[string]interface{}{"mappings": mappings}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Error("Failed to encode field mapping response: %v", err)
+	}
+}
+
+// collectFieldDefinitions 按完整路径收集 mapping 中有类型的字段定义（含 multi-fields）
+func collectFieldDefinitions(props map[string]interface{}, prefix string, defs map[string]map[string]interface{}) {
+	for name, def := range props {
+		fieldMap, ok := def.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fullName := name
+		if prefix != "" {
+			fullName = prefix + "." + name
+		}
+		if _, ok := fieldMap["type"].(string); ok {
+			defs[fullName] = fieldMap
+		}
+		if sub, ok := fieldMap["properties"].(map[string]interface{}); ok {
+			collectFieldDefinitions(sub, fullName, defs)
+		}
+		if sub, ok := fieldMap["fields"].(map[string]interface{}); ok {
+			collectFieldDefinitions(sub, fullName, defs)
+		}
+	}
+}
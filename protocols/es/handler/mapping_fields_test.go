@@ -0,0 +1,108 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestGetFieldMapping(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	router.AddRoutes([]server.Route{
+		{Method: "GET", Path: "/{index}/_mapping/field/{field}", Handler: indexHandler.GetFieldMapping},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	mapping := `{"mappings":{"properties":{
+		"title":{"type":"text","fields":{"raw":{"type":"keyword"}}},
+		"user":{"properties":{"name":{"type":"keyword"}}}
+	}}}`
+	if w := do("PUT", "/events", mapping); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 绕过动态 mapping 直接写入索引，模拟元数据中缺失的字段
+	idx, err := indexMgr.GetIndex("events")
+	if err != nil {
+		t.Fatalf("get index: %v", err)
+	}
+	if err := idx.Index("1", map[string]interface{}{"title": "hello", "latency": 12.5, "host": "web-1"}); err != nil {
+		t.Fatalf("index doc: %v", err)
+	}
+
+	unmapped, err := indexHandler.UnmappedIndexFields("events")
+	if err != nil {
+		t.Fatalf("UnmappedIndexFields: %v", err)
+	}
+	if len(unmapped) != 2 || unmapped["latency"] != "double" || unmapped["host"] != "text" {
+		t.Errorf("unmapped fields = %v, want latency:double host:text", unmapped)
+	}
+
+	type fieldMapping struct {
+		FullName string                            `json:"full_name"`
+		Mapping  map[string]map[string]interface{} `json:"mapping"`
+	}
+	get := func(path string) map[string]fieldMapping {
+		w := do("GET", path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200 got %d: %s", path, w.Code, w.Body.String())
+		}
+		var resp map[string]struct {
+			Mappings map[string]fieldMapping `json:"mappings"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp["events"].Mappings
+	}
+
+	got := get("/events/_mapping/field/user.name,title.raw")
+	if m := got["user.name"]; m.FullName != "user.name" || m.Mapping["name"]["type"] != "keyword" {
+		t.Errorf("user.name mapping = %+v", m)
+	}
+	if m := got["title.raw"]; m.Mapping["raw"]["type"] != "keyword" {
+		t.Errorf("title.raw mapping = %+v", m)
+	}
+
+	got = get("/events/_mapping/field/*")
+	if m := got["latency"]; m.Mapping["latency"]["type"] != "double" {
+		t.Errorf("latency mapping = %+v, want inferred double", m)
+	}
+	if len(got) != 5 {
+		t.Errorf("expected 5 fields, got %v", got)
+	}
+
+	if got := get("/events/_mapping/field/nope"); len(got) != 0 {
+		t.Errorf("expected no mappings, got %v", got)
+	}
+	if w := do("GET", "/missing/_mapping/field/title", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing index: expected 404 got %d", w.Code)
+	}
+}
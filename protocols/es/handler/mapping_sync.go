@@ -0,0 +1,362 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/gorilla/mux"
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// Mapping 对账（POST /{index}/_mapping/_sync）
+// 索引的 bleve mapping 在创建时由元数据中的 ES mapping 生成并持久化在索引内部，动态 mapping 新增字段时同步更新，
+// 之后 PUT _mapping 只更新元数据（新字段按 bleve 的动态默认方式索引），手工恢复索引文件也可能使两者不一致。对账按元数据重新生成
+// bleve mapping 并与索引实际使用的 mapping 逐字段比较；reindex=true 时替换索引的 mapping，并按 _source
+// 重新索引包含差异字段的文档。重建期间对同一文档的并发写入可能被覆盖。以 "_" 开头的内部字段不参与比较。
+
+// 字段差异类型
+const (
+	mappingDiffMissingInIndex    = "missing_in_index"    // 元数据中定义，索引按动态默认方式索引
+	mappingDiffMissingInMetadata = "missing_in_metadata" // 索引 mapping 中定义，元数据中没有
+	mappingDiffConflict          = "conflict"            // 两边都定义但索引方式不同
+)
+
+// mappedField bleve mapping 中单个字段的索引方式
+type mappedField struct {
+	Type       string `json:"type"`
+	Analyzer   string `json:"analyzer,omitempty"`
+	DateFormat string `json:"date_format,omitempty"`
+	Index      bool   `json:"index"`
+	Store      bool   `json:"store"`
+	DocValues  bool   `json:"doc_values"`
+}
+
+// mappingDifference 元数据与索引 mapping 的单个字段差异
+type mappingDifference struct {
+	Field    string       `json:"field"`
+	Kind     string       `json:"kind"`
+	Metadata *mappedField `json:"metadata,omitempty"`
+	Index    *mappedField `json:"index,omitempty"`
+}
+
+func (d mappingDifference) String() string {
+	switch d.Kind {
+	case mappingDiffMissingInIndex:
+		return fmt.Sprintf("field [%s] is mapped as [%s] but indexed with dynamic defaults", d.Field, d.Metadata.Type)
+	case mappingDiffMissingInMetadata:
+		return fmt.Sprintf("field [%s] is indexed as [%s] but not mapped", d.Field, d.Index.Type)
+	}
+	return fmt.Sprintf("field [%s] is mapped as %+v but indexed as %+v", d.Field, *d.Metadata, *d.Index)
+}
+
+// mappingSyncReport 单个索引的对账结果，in_sync 与 differences 为对账时的状态
+type mappingSyncReport struct {
+	InSync         bool                `json:"in_sync"`
+	Differences    []mappingDifference `json:"differences"`
+	MappingUpdated bool                `json:"mapping_updated"`
+	Reindexed      int64               `json:"reindexed"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// DocumentReindexer 按索引当前的 mapping 重新索引包含指定字段的文档，返回重新索引的文档数
+type DocumentReindexer func(ctx context.Context, indexName string, fields []string) (int64, error)
+
+// SetDocumentReindexer 设置 mapping 对账时重新索引文档的方法
+func (h *IndexHandler) SetDocumentReindexer(reindexer DocumentReindexer) {
+	h.reindexer = reindexer
+}
+
+// SyncMapping 对比元数据 mapping 与索引实际使用的 mapping
+// POST /{index}/_mapping/_sync，reindex=true 时替换索引的 mapping 并重新索引受影响的文档
+func (h *IndexHandler) SyncMapping(w http.ResponseWriter, r *http.Request) {
+	indexNames, apiErr := h.resolveShardOperationIndices(r, mux.Vars(r)["index"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if h.indexMgr == nil {
+		common.HandleError(w, common.NewInternalServerError("index manager is not available"))
+		return
+	}
+
+	reindex := strings.EqualFold(r.URL.Query().Get("reindex"), "true")
+	if reindex {
+		if h.reindexer == nil {
+			common.HandleError(w, common.NewInternalServerError("document reindexing is not available"))
+			return
+		}
+		for _, indexName := range indexNames {
+			if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelWrite); apiErr != nil {
+				common.HandleError(w, apiErr)
+				return
+			}
+			if !sourceEnabled(h.metaStore, indexName) {
+				common.HandleError(w, common.NewBadRequestError(fmt.Sprintf(
+					"cannot reindex documents of index [%s] because _source is disabled", indexName)))
+				return
+			}
+		}
+	}
+
+	inSync := true
+	reports := make(map[string]*mappingSyncReport, len(indexNames))
+	for _, indexName := range indexNames {
+		report := h.syncIndexMapping(r.Context(), indexName, reindex)
+		if !report.InSync {
+			inSync = false
+		}
+		reports[indexName] = report
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"in_sync": inSync,
+		"indices": reports,
+	}); err != nil {
+		logger.Error("Failed to encode mapping sync response: %v", err)
+	}
+}
+
+// syncIndexMapping 对账单个索引，reindex 为 true 且存在差异时替换 mapping 并重新索引文档
+func (h *IndexHandler) syncIndexMapping(ctx context.Context, indexName string, reindex bool) *mappingSyncReport {
+	// 对比与替换期间禁止 mapping 元数据变化；重新索引会触发动态 mapping，需在此之前释放
+	mappingUpdateMu.Lock()
+	expected, diffs, err := h.compareIndexMapping(indexName)
+	report := &mappingSyncReport{InSync: err == nil && len(diffs) == 0, Differences: diffs}
+	if err != nil || !reindex || len(diffs) == 0 {
+		mappingUpdateMu.Unlock()
+		if err != nil {
+			report.Error = err.Error()
+		}
+		return report
+	}
+	release := addTemporaryIndexBlock(indexName, "mapping sync in progress")
+	err = h.indexMgr.ReplaceMapping(ctx, indexName, expected)
+	release()
+	mappingUpdateMu.Unlock()
+	if err != nil {
+		logger.Error("Failed to replace mapping of index [%s]: %v", indexName, err)
+		report.Error = err.Error()
+		return report
+	}
+	report.MappingUpdated = true
+
+	fields := make([]string, 0, len(diffs))
+	for _, d := range diffs {
+		fields = append(fields, d.Field)
+	}
+	start := time.Now()
+	report.Reindexed, err = h.reindexer(ctx, indexName, fields)
+	if err != nil {
+		logger.Error("Failed to reindex documents of index [%s] after mapping sync: %v", indexName, err)
+		report.Error = err.Error()
+		return report
+	}
+	logger.Info("Synced mapping of index [%s]: %d fields changed, %d documents reindexed in %v",
+		indexName, len(diffs), report.Reindexed, time.Since(start))
+	return report
+}
+
+// ReconcileMappings 对账各索引的 mapping 并记录差异（启动恢复后调用，不修改索引）
+func (h *IndexHandler) ReconcileMappings(indexNames []string) {
+	if h.indexMgr == nil {
+		return
+	}
+	for _, indexName := range indexNames {
+		mappingUpdateMu.Lock()
+		_, diffs, err := h.compareIndexMapping(indexName)
+		mappingUpdateMu.Unlock()
+		if err != nil {
+			logger.Warn("Failed to reconcile mapping of index [%s]: %v", indexName, err)
+			continue
+		}
+		// 新增字段按动态默认方式索引是 PUT _mapping 的常态，只提示；冲突与多余字段说明索引文件与元数据不一致
+		var dynamic []string
+		for _, d := range diffs {
+			if d.Kind == mappingDiffMissingInIndex {
+				dynamic = append(dynamic, d.Field)
+				continue
+			}
+			logger.Warn("Mapping of index [%s] is out of sync: %s", indexName, d)
+		}
+		if len(dynamic) > 0 {
+			logger.Info("Index [%s] indexes mapped fields [%s] with dynamic defaults, use POST /%s/_mapping/_sync?reindex=true to apply their mappings",
+				indexName, strings.Join(dynamic, ", "), indexName)
+		}
+	}
+}
+
+// compareIndexMapping 按元数据生成期望的 bleve mapping，并与索引实际使用的 mapping 比较（调用方持有 mappingUpdateMu）
+func (h *IndexHandler) compareIndexMapping(indexName string) (*mapping.IndexMappingImpl, []mappingDifference, error) {
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get index metadata: %w", err)
+	}
+	if indexMeta == nil {
+		return nil, nil, fmt.Errorf("index [%s] has no metadata", indexName)
+	}
+	expected, err := h.convertESMappingToBleve(indexMeta.Mapping)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert mapping: %w", err)
+	}
+	idx, err := h.indexMgr.GetIndex(indexName)
+	if err != nil {
+		return nil, nil, err
+	}
+	actual, ok := idx.Mapping().(*mapping.IndexMappingImpl)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported mapping type %T of index [%s]", idx.Mapping(), indexName)
+	}
+	return expected, diffBleveMappings(expected, actual), nil
+}
+
+// diffBleveMappings 逐字段比较两个 bleve mapping 的默认文档映射，按字段名排序返回差异
+func diffBleveMappings(expected, actual *mapping.IndexMappingImpl) []mappingDifference {
+	want := make(map[string]mappedField)
+	flattenDocumentMapping(expected.DefaultMapping, "", want)
+	have := make(map[string]mappedField)
+	flattenDocumentMapping(actual.DefaultMapping, "", have)
+
+	diffs := make([]mappingDifference, 0)
+	for field, w := range want {
+		if strings.HasPrefix(field, "_") {
+			continue
+		}
+		w := w
+		h, ok := have[field]
+		if !ok {
+			diffs = append(diffs, mappingDifference{Field: field, Kind: mappingDiffMissingInIndex, Metadata: &w})
+		} else if h != w {
+			diffs = append(diffs, mappingDifference{Field: field, Kind: mappingDiffConflict, Metadata: &w, Index: &h})
+		}
+	}
+	for field, h := range have {
+		if _, ok := want[field]; ok || strings.HasPrefix(field, "_") {
+			continue
+		}
+		h := h
+		diffs = append(diffs, mappingDifference{Field: field, Kind: mappingDiffMissingInMetadata, Index: &h})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return diffs
+}
+
+// flattenDocumentMapping 将文档映射展开为 "点号路径 -> 索引方式"，同一路径有多个 FieldMapping 时取第一个
+func flattenDocumentMapping(dm *mapping.DocumentMapping, path string, out map[string]mappedField) {
+	if dm == nil || !dm.Enabled {
+		return
+	}
+	for _, fm := range dm.Fields {
+		field := path
+		if fm.Name != "" {
+			// FieldMapping.Name 替换路径的最后一段
+			field = fm.Name
+			if i := strings.LastIndex(path, "."); i >= 0 {
+				field = path[:i+1] + fm.Name
+			}
+		}
+		if _, exists := out[field]; !exists {
+			out[field] = mappedField{
+				Type:       fm.Type,
+				Analyzer:   fm.Analyzer,
+				DateFormat: fm.DateFormat,
+				Index:      fm.Index,
+				Store:      fm.Store,
+				DocValues:  fm.DocValues,
+			}
+		}
+	}
+	for name, sub := range dm.Properties {
+		subPath := name
+		if path != "" {
+			subPath = path + "." + name
+		}
+		flattenDocumentMapping(sub, subPath, out)
+	}
+}
+
+// ReindexDocuments 按 _source 重新索引包含指定字段（或其父字段）的根文档，返回重新索引的文档数
+// fields 为空时重新索引所有文档
+func (h *DocumentHandler) ReindexDocuments(ctx context.Context, indexName string, fields []string) (int64, error) {
+	idx, err := h.indexMgr.GetIndex(indexName)
+	if err != nil {
+		return 0, err
+	}
+
+	var reindexed int64
+	items := make([]BulkRequest, 0, rollupScanPageSize)
+	flush := func() error {
+		for _, result := range h.executeBulkOperationsBatch(idx, indexName, items) {
+			for _, item := range result {
+				if m, ok := item.(map[string]interface{}); ok && m["error"] != nil {
+					return fmt.Errorf("failed to reindex document [%v]: %v", m["_id"], m["error"])
+				}
+			}
+		}
+		reindexed += int64(len(items))
+		items = items[:0]
+		return nil
+	}
+	err = h.scanIndexDocuments(ctx, idx, indexName, bleve.NewMatchAllQuery(), func(id string, doc index.Document) error {
+		source := h.extractDocumentFields(doc)
+		if len(fields) > 0 && !sourceHasAnyField(source, fields) {
+			return nil
+		}
+		items = append(items, BulkRequest{
+			Action:  "index",
+			Index:   indexName,
+			ID:      id,
+			Source:  source,
+			Routing: documentRouting(doc),
+		})
+		if len(items) >= rollupScanPageSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && len(items) > 0 {
+		err = flush()
+	}
+	return reindexed, err
+}
+
+// sourceHasAnyField _source 中存在任一字段或其父字段（multi-fields 如 title.keyword 的值来自 title）
+func sourceHasAnyField(source map[string]interface{}, fields []string) bool {
+	for _, field := range fields {
+		for {
+			if len(sourceValuesAt(source, field)) > 0 {
+				return true
+			}
+			i := strings.LastIndex(field, ".")
+			if i < 0 {
+				break
+			}
+			field = field[:i]
+		}
+	}
+	return false
+}
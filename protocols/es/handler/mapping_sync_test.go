@@ -0,0 +1,140 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestSyncMapping(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	indexHandler.SetDocumentReindexer(docHandler.ReindexDocuments)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_mapping", Handler: indexHandler.UpdateMapping},
+		{Method: "POST", Path: "/{index}/_mapping/_sync", Handler: indexHandler.SyncMapping},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+	})
+	handler := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.Contains(path, "_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	type syncResponse struct {
+		InSync  bool                          `json:"in_sync"`
+		Indices map[string]*mappingSyncReport `json:"indices"`
+	}
+	sync := func(path string) syncResponse {
+		w := do("POST", path, "")
+		var resp syncResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("sync: got %d: %s", w.Code, w.Body.String())
+		}
+		return resp
+	}
+	countHits := func(query string) int {
+		w := do("POST", "/orders/_search", `{"query": `+query+`}`)
+		var resp struct {
+			Hits struct {
+				Hits []interface{} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode search: %v: %s", err, w.Body.String())
+		}
+		return len(resp.Hits.Hits)
+	}
+
+	if w := do("PUT", "/orders", `{"mappings": {"properties": {"region": {"type": "keyword"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if resp := sync("/orders/_mapping/_sync"); !resp.InSync || len(resp.Indices["orders"].Differences) != 0 {
+		t.Fatalf("Expected a new index to be in sync, got %+v", resp.Indices["orders"])
+	}
+
+	// PUT _mapping 只更新元数据，新字段按动态默认方式（text）索引
+	if w := do("PUT", "/orders/_mapping", `{"properties": {"code": {"type": "keyword"}}}`); w.Code != http.StatusOK {
+		t.Fatalf("put mapping: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := "{\"index\":{\"_index\":\"orders\",\"_id\":\"1\"}}\n{\"region\":\"eu\",\"code\":\"AB-1\"}\n" +
+		"{\"index\":{\"_index\":\"orders\",\"_id\":\"2\"}}\n{\"region\":\"us\"}\n"
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if n := countHits(`{"term": {"code": "AB-1"}}`); n != 0 {
+		t.Fatalf("Expected the keyword term not to match a dynamically indexed field, got %d hits", n)
+	}
+
+	resp := sync("/orders/_mapping/_sync")
+	report := resp.Indices["orders"]
+	if resp.InSync || report.MappingUpdated || len(report.Differences) != 1 {
+		t.Fatalf("Expected one difference without changes, got %+v", report)
+	}
+	if d := report.Differences[0]; d.Field != "code" || d.Kind != mappingDiffMissingInIndex || d.Metadata.Type != "text" || d.Metadata.Analyzer != "keyword" {
+		t.Errorf("Unexpected difference: %+v", d)
+	}
+
+	resp = sync("/orders/_mapping/_sync?reindex=true")
+	if report := resp.Indices["orders"]; !report.MappingUpdated || report.Reindexed != 1 || report.Error != "" {
+		t.Fatalf("Expected the mapping to be replaced and 1 document reindexed, got %+v", report)
+	}
+	if n := countHits(`{"term": {"code": "AB-1"}}`); n != 1 {
+		t.Errorf("Expected the reindexed document to match the keyword term, got %d hits", n)
+	}
+	if n := countHits(`{"match_all": {}}`); n != 2 {
+		t.Errorf("Expected both documents to remain, got %d hits", n)
+	}
+	if resp := sync("/orders/_mapping/_sync"); !resp.InSync {
+		t.Errorf("Expected the index to be in sync after reindexing, got %+v", resp.Indices["orders"])
+	}
+}
+
+func TestDiffBleveMappings(t *testing.T) {
+	expected := mapping.NewIndexMapping()
+	expected.DefaultMapping.AddFieldMappingsAt("status", mapping.NewKeywordFieldMapping())
+	expected.DefaultMapping.AddFieldMappingsAt("_routing", mapping.NewKeywordFieldMapping())
+	actual := mapping.NewIndexMapping()
+	actual.DefaultMapping.AddFieldMappingsAt("status", mapping.NewTextFieldMapping())
+	restored := mapping.NewDocumentMapping()
+	restored.AddFieldMappingsAt("email", mapping.NewKeywordFieldMapping())
+	actual.DefaultMapping.AddSubDocumentMapping("user", restored)
+
+	diffs := diffBleveMappings(expected, actual)
+	if len(diffs) != 2 {
+		t.Fatalf("Expected 2 differences, got %+v", diffs)
+	}
+	if diffs[0].Field != "status" || diffs[0].Kind != mappingDiffConflict || diffs[0].Index.Type != "text" {
+		t.Errorf("Unexpected conflict: %+v", diffs[0])
+	}
+	if diffs[1].Field != "user.email" || diffs[1].Kind != mappingDiffMissingInMetadata {
+		t.Errorf("Unexpected difference: %+v", diffs[1])
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/index/scorch"
+)
+
+// 后台合并限流
+// indices.store.throttle.max_bytes_per_sec 限制节点上所有合并每秒写入的字节数（0 或 -1 表示不限制），
+// indices.merge.scheduler.max_concurrent_merges 限制节点上同时执行的合并任务数，两者均可通过 _cluster/settings 动态修改；
+// 单个索引同时执行的合并任务数由 index.merge.scheduler.max_thread_count 指定（见 store_settings.go）。
+// 内存段持久化不受限流影响，避免拖慢写入。
+
+// 节点级合并限流设置
+const (
+	mergeThrottleSetting        = "indices.store.throttle.max_bytes_per_sec"
+	mergeMaxConcurrencySetting  = "indices.merge.scheduler.max_concurrent_merges"
+	defaultMergeThrottleSetting = "0b"
+)
+
+var mergeThrottleSettingDef = clusterSettingDef{
+	parse: parseMergeThrottleSetting,
+	apply: func(v interface{}) { scorch.SetMergeThrottle(v.(int64)) },
+}
+
+var mergeMaxConcurrencySettingDef = clusterSettingDef{
+	parse: parsePositiveIntSetting,
+	apply: func(v interface{}) { scorch.SetMaxConcurrentMerges(v.(int)) },
+}
+
+// parseMergeThrottleSetting 解析合并限流速率，-1 与 0 表示不限制
+func parseMergeThrottleSetting(value string) (interface{}, error) {
+	if strings.TrimSpace(value) == "-1" {
+		return int64(0), nil
+	}
+	n, ok := parseByteSize(value)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse value [%s] as a size in bytes: unit is missing or unrecognized", value)
+	}
+	return n, nil
+}
+
+// mergeStats 读取索引的合并统计（ES _stats 的 merges 部分）
+func mergeStats(idx bleve.Index) map[string]interface{} {
+	indexStats, _ := idx.StatsMap()["index"].(map[string]interface{})
+	stat := func(name string) uint64 {
+		v, _ := indexStats[name].(uint64)
+		return v
+	}
+	return map[string]interface{}{
+		"current":                        stat("CurFileMerges"),
+		"total":                          stat("TotFileMergeZapEnd"),
+		"total_time_in_millis":           stat("TotFileMergeZapTime") / uint64(time.Millisecond),
+		"total_size_in_bytes":            stat("TotFileMergeWrittenBytes"),
+		"total_throttled_time_in_millis": stat("TotFileMergeThrottledTime") / uint64(time.Millisecond),
+		"total_slot_wait_time_in_millis": stat("TotFileMergeSlotWaitTime") / uint64(time.Millisecond),
+		"total_auto_throttle_in_bytes":   scorch.MergeThrottle(),
+		"max_concurrent_merges":          scorch.MaxConcurrentMerges(),
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/index/scorch"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestMergeThrottleSettings(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	defer func() {
+		scorch.SetMergeThrottle(0)
+		scorch.SetMaxConcurrentMerges(scorch.DefaultMaxConcurrentMerges)
+	}()
+	clusterHandler := NewClusterHandler(nil, nil, indexHandler.metaStore)
+	statsHandler := NewStatsHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/_cluster/settings", Handler: clusterHandler.PutClusterSettings},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+		{Method: "GET", Path: "/{index}/_stats", Handler: statsHandler.GetIndexStats},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// 节点级限流通过 _cluster/settings 动态修改
+	if w := do("PUT", "/_cluster/settings", `{"transient":{
+		"indices.store.throttle.max_bytes_per_sec":"20mb",
+		"indices.merge.scheduler.max_concurrent_merges":4
+	}}`); w.Code != http.StatusOK {
+		t.Fatalf("cluster settings: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if n := scorch.MergeThrottle(); n != 20*1024*1024 {
+		t.Errorf("expected merge throttle of 20mb, got %d", n)
+	}
+	if n := scorch.MaxConcurrentMerges(); n != 4 {
+		t.Errorf("expected 4 concurrent merges, got %d", n)
+	}
+	for _, body := range []string{
+		`{"transient":{"indices.store.throttle.max_bytes_per_sec":"fast"}}`,
+		`{"transient":{"indices.merge.scheduler.max_concurrent_merges":0}}`,
+	} {
+		if w := do("PUT", "/_cluster/settings", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+	// 删除 transient 设置后恢复默认（不限制）
+	if w := do("PUT", "/_cluster/settings", `{"transient":{"indices.store.throttle.max_bytes_per_sec":null}}`); w.Code != http.StatusOK {
+		t.Fatalf("reset cluster settings: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if n := scorch.MergeThrottle(); n != 0 {
+		t.Errorf("expected merge throttle to be removed, got %d", n)
+	}
+
+	// 单个索引的合并并发数写入 scorch 配置，创建后不可修改
+	if w := do("PUT", "/throttled", `{"settings":{"index":{"merge":{"scheduler":{"max_thread_count":2}}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(indexHandler.dirMgr.GetIndexPath("throttled"), "store", "index_meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := meta.Config["maxConcurrentMerges"].(float64); n != 2 {
+		t.Errorf("expected maxConcurrentMerges 2 in scorch config, got %v", meta.Config)
+	}
+	if w := do("PUT", "/throttled/_settings", `{"index":{"merge.scheduler.max_thread_count":1}}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "non dynamic settings") {
+		t.Errorf("update max_thread_count: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/invalid_threads", `{"settings":{"index":{"merge.scheduler.max_thread_count":0}}}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "index.merge.scheduler.max_thread_count") {
+		t.Errorf("invalid max_thread_count: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// _stats 输出合并统计
+	w := do("GET", "/throttled/_stats", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats: got %d: %s", w.Code, w.Body.String())
+	}
+	var stats struct {
+		Indices map[string]struct {
+			Primaries struct {
+				Merges map[string]interface{} `json:"merges"`
+			} `json:"primaries"`
+		} `json:"indices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	merges := stats.Indices["throttled"].Primaries.Merges
+	for _, key := range []string{"current", "total", "total_size_in_bytes", "total_throttled_time_in_millis", "total_auto_throttle_in_bytes"} {
+		if _, ok := merges[key]; !ok {
+			t.Errorf("expected %s in merge stats, got %v", key, merges)
+		}
+	}
+	if n, _ := merges["max_concurrent_merges"].(float64); n != 4 {
+		t.Errorf("expected max_concurrent_merges 4, got %v", merges)
+	}
+}
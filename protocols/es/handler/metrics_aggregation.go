@@ -26,9 +26,9 @@ var _ bleve.Index
 
 // MetricsAggregationSpec Metrics聚合规格
 type MetricsAggregationSpec struct {
-	Type               string // avg, sum, min, max, stats, cardinality
-	Field              string // 字段名
-	PrecisionThreshold int    // cardinality聚合的精度阈值（可选）
+	Type    string      // avg, sum, min, max, stats
+	Field   string      // 字段名
+	Missing interface{} // 缺少字段的文档使用的值（可选）
 }
 
 // calculateMetricsAggregationsWithCache 从已缓存的文档中计算Metrics聚合
@@ -42,40 +42,26 @@ func (h *DocumentHandler) calculateMetricsAggregationsWithCache(
 		return nil, nil
 	}
 
-	// 收集所有需要计算的字段值
-	fieldValues := make(map[string][]float64)                  // 字段名 -> 值列表（用于数值聚合）
-	fieldUniqueValues := make(map[string]map[interface{}]bool) // 字段名 -> 唯一值集合（用于cardinality聚合）
+	// 收集每个聚合需要计算的字段值（各聚合的 missing 不同，按聚合名收集）
+	aggValues := make(map[string][]float64) // 聚合名 -> 值列表
 
 	// 遍历所有匹配的文档
 	// 性能优化：使用已缓存的文档数据
 	for _, hit := range searchResult.Hits {
-		if doc, ok := docCache[hit.ID]; ok {
-			for fieldName, fieldValue := range doc {
-				// 检查是否需要这个字段
-				for _, spec := range metricsAggs {
-					if spec.Field == fieldName {
-						if spec.Type == "cardinality" {
-							// Cardinality聚合：收集唯一值
-							if fieldUniqueValues[fieldName] == nil {
-								fieldUniqueValues[fieldName] = make(map[interface{}]bool)
-							}
-							// 处理数组字段
-							if arr, ok := fieldValue.([]interface{}); ok {
-								for _, v := range arr {
-									fieldUniqueValues[fieldName][v] = true
-								}
-							} else {
-								fieldUniqueValues[fieldName][fieldValue] = true
-							}
-						} else {
-							// 其他metrics聚合：尝试从字段值中提取数值
-							if value := h.extractNumericValueFromInterface(fieldValue); value != nil {
-								fieldValues[fieldName] = append(fieldValues[fieldName], *value)
-							}
-						}
-						break
-					}
+		// 未缓存的文档不含任何需要的字段
+		doc := docCache[hit.ID]
+		for aggName, spec := range metricsAggs {
+			fieldValue, ok := doc[spec.Field]
+			if !ok || fieldValue == nil {
+				// 缺少字段的文档按 missing 值计算
+				if spec.Missing == nil {
+					continue
 				}
+				fieldValue = spec.Missing
+			}
+			// 尝试从字段值中提取数值
+			if value := h.extractNumericValueFromInterface(fieldValue); value != nil {
+				aggValues[aggName] = append(aggValues[aggName], *value)
 			}
 		}
 	}
@@ -83,30 +69,14 @@ func (h *DocumentHandler) calculateMetricsAggregationsWithCache(
 	// 计算每个聚合的结果
 	results := make(map[string]interface{})
 	for aggName, spec := range metricsAggs {
-		if spec.Type == "cardinality" {
-			// Cardinality聚合：计算唯一值数量
-			uniqueValues, ok := fieldUniqueValues[spec.Field]
-			if !ok || len(uniqueValues) == 0 {
-				results[aggName] = map[string]interface{}{
-					"value": 0,
-				}
-				continue
-			}
-			cardinality := h.calculateCardinality(uniqueValues, spec.PrecisionThreshold)
-			results[aggName] = map[string]interface{}{
-				"value": cardinality,
-			}
-		} else {
-			// 其他metrics聚合
-			values, ok := fieldValues[spec.Field]
-			if !ok || len(values) == 0 {
-				// 没有找到值，返回null或0
-				results[aggName] = h.buildMetricsResult(spec.Type, nil)
-				continue
-			}
-
-			results[aggName] = h.buildMetricsResult(spec.Type, values)
+		values, ok := aggValues[aggName]
+		if !ok || len(values) == 0 {
+			// 没有找到值，返回null或0
+			results[aggName] = h.buildMetricsResult(spec.Type, nil)
+			continue
 		}
+
+		results[aggName] = h.buildMetricsResult(spec.Type, values)
 	}
 
 	return results, nil
@@ -285,30 +255,3 @@ func (h *DocumentHandler) calculateSumOfSquares(values []float64) float64 {
 	}
 	return sum
 }
-
-// calculateCardinality 计算唯一值数量（cardinality聚合）
-// precisionThreshold: 精度阈值，用于控制HyperLogLog算法的精度（可选，默认3000）
-func (h *DocumentHandler) calculateCardinality(uniqueValues map[interface{}]bool, precisionThreshold int) int64 {
-	if len(uniqueValues) == 0 {
-		return 0
-	}
-
-	// 如果precision_threshold未设置或为0，使用默认值3000
-	if precisionThreshold <= 0 {
-		precisionThreshold = 3000
-	}
-
-	// 如果唯一值数量小于precision_threshold，直接返回精确值
-	// 否则使用HyperLogLog算法估算（这里简化实现，直接返回精确值）
-	// 注意：ES的cardinality聚合使用HyperLogLog++算法，这里为了简化，直接计算精确值
-	// 对于大数据集，可以考虑实现HyperLogLog算法以提高性能
-	cardinality := int64(len(uniqueValues))
-
-	// 如果值数量超过precision_threshold，记录警告（实际应该使用HyperLogLog）
-	if cardinality > int64(precisionThreshold) {
-		// 这里可以添加日志，但为了性能考虑，暂时不记录
-		// logger.Debug("Cardinality [%d] exceeds precision_threshold [%d], consider using HyperLogLog for better performance", cardinality, precisionThreshold)
-	}
-
-	return cardinality
-}
@@ -0,0 +1,162 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// 缺少字段的文档：missing 桶聚合，以及 terms 聚合的 missing 参数
+// （metrics 聚合的 missing 参数见 calculateMetricsAggregationsWithCache）
+
+// missingFieldQuery 返回匹配缺少字段的文档的查询，与 exists 查询的判定一致
+func missingFieldQuery(field string) (query.Query, error) {
+	existsQuery, err := dsl.NewQueryParser().ParseQuery(map[string]interface{}{
+		"exists": map[string]interface{}{"field": field},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return query.NewBooleanQuery([]query.Query{query.NewMatchAllQuery()}, nil, []query.Query{existsQuery}), nil
+}
+
+// parseMissingAggregation 解析missing聚合，作为过滤条件为“字段不存在”的 filter 聚合执行
+// ES格式: {"missing": {"field": "price"}}
+func (h *DocumentHandler) parseMissingAggregation(config map[string]interface{}, subAggs map[string]map[string]interface{}) (*FilterAggregationConfig, error) {
+	field, ok := config["field"].(string)
+	if !ok || field == "" {
+		return nil, fmt.Errorf("missing aggregation requires a 'field' parameter")
+	}
+	filterQuery, err := missingFieldQuery(field)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterAggregationConfig{
+		FilterQuery:     filterQuery,
+		SubAggregations: subAggs,
+	}, nil
+}
+
+// applyTermsMissing 为设置了 missing 参数的 terms 聚合补充缺少字段的文档桶
+// 桶键为 missing 值，与已有词项相同时合并，之后按 order 重新排序并截取 size 个桶
+func (h *DocumentHandler) applyTermsMissing(ctx context.Context, specs map[string]map[string]interface{}, aggs map[string]interface{}, idx bleve.Index, baseQuery query.Query) {
+	for aggName, spec := range specs {
+		termsConfig, ok := spec["terms"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		missingKey, hasMissing := termsConfig["missing"]
+		field, _ := termsConfig["field"].(string)
+		if !hasMissing || missingKey == nil || field == "" {
+			continue
+		}
+
+		missingQuery, err := missingFieldQuery(field)
+		if err != nil {
+			logger.Warn("Failed to build missing query for terms aggregation [%s]: %v", aggName, err)
+			continue
+		}
+		bucketQuery := query.NewBooleanQuery([]query.Query{baseQuery, missingQuery}, nil, nil)
+		docCount, err := countDocuments(ctx, idx, bucketQuery)
+		if err != nil {
+			logger.Warn("Failed to count missing documents for terms aggregation [%s]: %v", aggName, err)
+			continue
+		}
+		if docCount == 0 {
+			continue
+		}
+
+		result, _ := aggs[aggName].(map[string]interface{})
+		if result == nil {
+			result = make(map[string]interface{})
+			aggs[aggName] = result
+		}
+		buckets, _ := result["buckets"].([]map[string]interface{})
+
+		var bucket map[string]interface{}
+		for _, b := range buckets {
+			if fmt.Sprint(b["key"]) == fmt.Sprint(missingKey) {
+				bucket = b
+				break
+			}
+		}
+		if bucket != nil {
+			// 与已有词项合并，子聚合需要同时覆盖两部分文档
+			bucket["doc_count"] = bucketDocCount(bucket) + int(docCount)
+			termQuery := h.buildTermQueryForBucket(field, bucket["key"])
+			bucketQuery = query.NewBooleanQuery([]query.Query{baseQuery, query.NewDisjunctionQuery([]query.Query{termQuery, missingQuery})}, nil, nil)
+		} else {
+			bucket = map[string]interface{}{"key": missingKey, "doc_count": int(docCount)}
+			buckets = append(buckets, bucket)
+		}
+		if subAggs := bucketSubAggregationSpecs(spec); len(subAggs) > 0 {
+			if subAggResults := h.buildNestedAggregationsForBucket(ctx, aggName, missingKey, subAggs, idx, bucketQuery); len(subAggResults) > 0 {
+				bucket["aggregations"] = subAggResults
+			}
+		}
+
+		// 加入缺失桶后按 terms 聚合的排序条件重新排序并截取
+		if termsAgg, err := parseTermsAggregationConfig(termsConfig); err == nil {
+			h.sortTermsBuckets(buckets, termsAgg)
+			if len(buckets) > termsAgg.Size {
+				otherDocCount := 0
+				for _, b := range buckets[termsAgg.Size:] {
+					otherDocCount += bucketDocCount(b)
+				}
+				buckets = buckets[:termsAgg.Size]
+				if other, ok := result["sum_other_doc_count"].(int); ok {
+					result["sum_other_doc_count"] = other + otherDocCount
+				}
+			}
+		}
+		result["buckets"] = buckets
+	}
+}
+
+// bucketDocCount 返回桶的文档数（facet 结果为 int，其他聚合结果可能为 int64/uint64）
+func bucketDocCount(bucket map[string]interface{}) int {
+	switch v := bucket["doc_count"].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case uint64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// bucketSubAggregationSpecs 返回聚合配置中的子聚合（aggs 或 aggregations）
+func bucketSubAggregationSpecs(spec map[string]interface{}) map[string]map[string]interface{} {
+	raw, ok := spec["aggs"].(map[string]interface{})
+	if !ok {
+		raw, _ = spec["aggregations"].(map[string]interface{})
+	}
+	subAggs := make(map[string]map[string]interface{}, len(raw))
+	for name, v := range raw {
+		if m, ok := v.(map[string]interface{}); ok {
+			subAggs[name] = m
+		}
+	}
+	return subAggs
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_MissingAggregations(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/products", `{"mappings":{"properties":{"category":{"type":"keyword"},"price":{"type":"long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := []string{
+		`{"category":"book","price":10}`,
+		`{"category":"book","price":30}`,
+		`{"category":"toy"}`,
+		`{"price":20}`,
+		`{"price":40}`,
+		`{}`,
+	}
+	for i, doc := range docs {
+		if w := do("PUT", fmt.Sprintf("/products/_doc/%d?refresh=true", i), doc); w.Code >= 300 {
+			t.Fatalf("index %d: got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("POST", "/products/_search", `{"size":0,"aggs":{
+		"no_category":{"missing":{"field":"category"},"aggs":{"total":{"sum":{"field":"price"}}}},
+		"by_category":{"terms":{"field":"category","missing":"N/A"},"aggs":{"total":{"sum":{"field":"price"}}}},
+		"avg_price":{"avg":{"field":"price","missing":0}},
+		"avg_price_present":{"avg":{"field":"price"}}
+	}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+	}
+
+	type total struct {
+		Value float64 `json:"value"`
+	}
+	var resp struct {
+		Aggregations struct {
+			NoCategory struct {
+				DocCount     int `json:"doc_count"`
+				Aggregations struct {
+					Total total `json:"total"`
+				} `json:"aggregations"`
+			} `json:"no_category"`
+			ByCategory struct {
+				Buckets []struct {
+					Key          interface{} `json:"key"`
+					DocCount     int         `json:"doc_count"`
+					Aggregations struct {
+						Total total `json:"total"`
+					} `json:"aggregations"`
+				} `json:"buckets"`
+			} `json:"by_category"`
+			AvgPrice        total `json:"avg_price"`
+			AvgPricePresent total `json:"avg_price_present"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	aggs := resp.Aggregations
+
+	if aggs.NoCategory.DocCount != 3 {
+		t.Errorf("missing: expected doc_count 3, got %d", aggs.NoCategory.DocCount)
+	}
+	if aggs.NoCategory.Aggregations.Total.Value != 60 {
+		t.Errorf("missing: expected sub-aggregation sum 60, got %v", aggs.NoCategory.Aggregations.Total.Value)
+	}
+
+	expected := []struct {
+		key      string
+		docCount int
+		total    float64
+	}{{"N/A", 3, 60}, {"book", 2, 40}, {"toy", 1, 0}}
+	if len(aggs.ByCategory.Buckets) != len(expected) {
+		t.Fatalf("terms missing: expected %d buckets, got %s", len(expected), w.Body.String())
+	}
+	for i, e := range expected {
+		b := aggs.ByCategory.Buckets[i]
+		if b.Key != e.key || b.DocCount != e.docCount || b.Aggregations.Total.Value != e.total {
+			t.Errorf("terms missing bucket %d: expected %s/%d/%v, got %v/%d/%v", i, e.key, e.docCount, e.total, b.Key, b.DocCount, b.Aggregations.Total.Value)
+		}
+	}
+
+	// 缺少 price 的 2 个文档按 0 计入平均值
+	if aggs.AvgPrice.Value != 100.0/6 {
+		t.Errorf("avg missing: expected %v, got %v", 100.0/6, aggs.AvgPrice.Value)
+	}
+	if aggs.AvgPricePresent.Value != 25 {
+		t.Errorf("avg: expected 25, got %v", aggs.AvgPricePresent.Value)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// MultiTermsAggregationInfo multi_terms聚合信息
+type MultiTermsAggregationInfo struct {
+	Aggregations map[string]*MultiTermsAggregationConfig
+}
+
+// MultiTermsAggregationConfig multi_terms聚合配置
+// ES格式: {"multi_terms": {"terms": [{"field": "service"}, {"field": "level"}], "size": 10, "order": {"_count": "desc"}}}
+// 与 composite 聚合共用组合键的表示和比较，但不分页，按文档数（或组合键）排序后取前 size 个
+type MultiTermsAggregationConfig struct {
+	Sources         []CompositeSource                 // 每个字段一个 source，Name 为字段名
+	Size            int                               // 返回的桶数（默认10）
+	MinDocCount     int64                             // 最小文档数（默认1）
+	OrderByKey      bool                              // 按组合键排序（默认按文档数）
+	OrderAsc        bool                              // 升序
+	SubAggregations map[string]map[string]interface{} // 子聚合配置
+}
+
+// parseMultiTermsAggregation 解析multi_terms聚合
+func (h *DocumentHandler) parseMultiTermsAggregation(config map[string]interface{}, subAggs map[string]map[string]interface{}) (*MultiTermsAggregationConfig, error) {
+	terms, ok := config["terms"].([]interface{})
+	if !ok || len(terms) < 2 {
+		return nil, fmt.Errorf("multi_terms aggregation requires at least 2 [terms]")
+	}
+
+	mtConfig := &MultiTermsAggregationConfig{
+		Size:            10,
+		MinDocCount:     1,
+		SubAggregations: subAggs,
+	}
+	for _, t := range terms {
+		termMap, _ := t.(map[string]interface{})
+		field, _ := termMap["field"].(string)
+		if field == "" {
+			return nil, fmt.Errorf("multi_terms aggregation [terms] requires a 'field' parameter")
+		}
+		mtConfig.Sources = append(mtConfig.Sources, CompositeSource{
+			Name:  field,
+			Terms: &CompositeTermsSource{Field: field},
+		})
+	}
+	if size, ok := config["size"].(float64); ok && size > 0 {
+		mtConfig.Size = int(size)
+	}
+	if minDocCount, ok := config["min_doc_count"].(float64); ok && minDocCount >= 0 {
+		mtConfig.MinDocCount = int64(minDocCount)
+	}
+
+	if order, ok := config["order"].(map[string]interface{}); ok {
+		for key, dir := range order {
+			switch key {
+			case "_count":
+				mtConfig.OrderByKey = false
+			case "_key":
+				mtConfig.OrderByKey = true
+			default:
+				return nil, fmt.Errorf("multi_terms aggregation only supports ordering by [_count] or [_key], got [%s]", key)
+			}
+			mtConfig.OrderAsc = dir == "asc"
+		}
+	}
+	return mtConfig, nil
+}
+
+// buildMultiTermsAggregations 构建multi_terms聚合响应
+func (h *DocumentHandler) buildMultiTermsAggregations(ctx context.Context, info *MultiTermsAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+	aggs := make(map[string]interface{}, len(info.Aggregations))
+	var mu sync.Mutex
+	tasks := make([]func(), 0, len(info.Aggregations))
+	for aggName, mtAgg := range info.Aggregations {
+		tasks = append(tasks, func() {
+			result, err := h.buildMultiTermsAggregation(ctx, aggName, mtAgg, idx, baseQuery)
+			if err != nil {
+				logger.Warn("Failed to build multi_terms aggregation [%s]: %v", aggName, err)
+				result = map[string]interface{}{"buckets": []interface{}{}}
+			}
+			mu.Lock()
+			aggs[aggName] = result
+			mu.Unlock()
+		})
+	}
+	aggPool.run(tasks)
+
+	return aggs
+}
+
+// buildMultiTermsAggregation 构建单个multi_terms聚合响应
+// 多值字段按各字段取值的笛卡尔积计数，缺少任一字段的文档不计入
+func (h *DocumentHandler) buildMultiTermsAggregation(ctx context.Context, aggName string, mtAgg *MultiTermsAggregationConfig, idx bleve.Index, baseQuery query.Query) (map[string]interface{}, error) {
+	fields := make([]string, len(mtAgg.Sources))
+	for i, source := range mtAgg.Sources {
+		fields[i] = source.Terms.Field
+	}
+	docs, err := h.fetchAllDocsWithFields(ctx, idx, baseQuery, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	combinationCounts := make(map[string]*CompositeKey)
+	for _, doc := range docs {
+		seen := make(map[string]bool)
+		for _, key := range multiTermsCombinations(doc, mtAgg.Sources) {
+			ck := &CompositeKey{Values: key, Count: 1}
+			keyStr := ck.String(mtAgg.Sources)
+			if seen[keyStr] {
+				continue
+			}
+			seen[keyStr] = true
+			if existing, exists := combinationCounts[keyStr]; exists {
+				existing.Count++
+			} else {
+				combinationCounts[keyStr] = ck
+			}
+		}
+	}
+
+	keys := make([]CompositeKey, 0, len(combinationCounts))
+	for _, ck := range combinationCounts {
+		if ck.Count >= mtAgg.MinDocCount {
+			keys = append(keys, *ck)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		cmp := CompareCompositeKeys(keys[i].Values, keys[j].Values, mtAgg.Sources)
+		if !mtAgg.OrderByKey && keys[i].Count != keys[j].Count {
+			if mtAgg.OrderAsc {
+				return keys[i].Count < keys[j].Count
+			}
+			return keys[i].Count > keys[j].Count
+		}
+		// 文档数相同时按组合键升序
+		if mtAgg.OrderByKey && !mtAgg.OrderAsc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	var otherCount int64
+	if len(keys) > mtAgg.Size {
+		for _, ck := range keys[mtAgg.Size:] {
+			otherCount += ck.Count
+		}
+		keys = keys[:mtAgg.Size]
+	}
+
+	buckets := make([]map[string]interface{}, 0, len(keys))
+	var bucketTasks []func()
+	for _, ck := range keys {
+		key := make([]interface{}, len(mtAgg.Sources))
+		keyStrs := make([]string, len(mtAgg.Sources))
+		bucketQueries := []query.Query{baseQuery}
+		for i, source := range mtAgg.Sources {
+			key[i] = ck.Values[source.Name]
+			keyStrs[i] = fmt.Sprintf("%v", key[i])
+			bucketQueries = append(bucketQueries, h.buildTermQueryForBucket(source.Terms.Field, key[i]))
+		}
+		bucket := map[string]interface{}{
+			"key":           key,
+			"key_as_string": strings.Join(keyStrs, "|"),
+			"doc_count":     ck.Count,
+		}
+		if len(mtAgg.SubAggregations) > 0 {
+			bucketQuery := query.NewBooleanQuery(bucketQueries, nil, nil)
+			bucketTasks = append(bucketTasks, func() {
+				if subAggResults := h.buildNestedAggregationsForBucket(ctx, aggName, key, mtAgg.SubAggregations, idx, bucketQuery); len(subAggResults) > 0 {
+					bucket["aggregations"] = subAggResults
+				}
+			})
+		}
+		buckets = append(buckets, bucket)
+	}
+	aggPool.run(bucketTasks)
+
+	return map[string]interface{}{
+		"doc_count_error_upper_bound": 0,
+		"sum_other_doc_count":         otherCount,
+		"buckets":                     buckets,
+	}, nil
+}
+
+// multiTermsCombinations 返回文档在各字段上取值的所有组合
+func multiTermsCombinations(doc map[string]interface{}, sources []CompositeSource) []map[string]interface{} {
+	combinations := []map[string]interface{}{{}}
+	for _, source := range sources {
+		var values []interface{}
+		switch v := getNestedFieldValue(doc, source.Terms.Field).(type) {
+		case nil:
+			return nil
+		case []interface{}:
+			values = v
+		default:
+			values = []interface{}{v}
+		}
+		next := make([]map[string]interface{}, 0, len(combinations)*len(values))
+		for _, combination := range combinations {
+			for _, value := range values {
+				key := make(map[string]interface{}, len(sources))
+				for k, v := range combination {
+					key[k] = v
+				}
+				key[source.Name] = value
+				next = append(next, key)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_MultiTermsAndRareTerms(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/orders", `{"mappings":{"properties":{"region":{"type":"keyword"},"product":{"type":"keyword"},"amount":{"type":"long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := []string{
+		`{"region":"eu","product":"apple","amount":10}`,
+		`{"region":"eu","product":"apple","amount":20}`,
+		`{"region":"eu","product":"pear","amount":5}`,
+		`{"region":"us","product":"apple","amount":7}`,
+		`{"region":"us","product":["pear","plum"],"amount":1}`,
+		`{"region":"asia","product":"kiwi","amount":3}`,
+	}
+	for i, doc := range docs {
+		if w := do("PUT", fmt.Sprintf("/orders/_doc/%d?refresh=true", i), doc); w.Code >= 300 {
+			t.Fatalf("index %d: got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("POST", "/orders/_search", `{"size":0,"aggs":{
+		"by_region_product":{"multi_terms":{"terms":[{"field":"region"},{"field":"product"}],"size":3},
+			"aggs":{"total":{"sum":{"field":"amount"}}}},
+		"rare_regions":{"rare_terms":{"field":"region"},
+			"aggs":{"total":{"sum":{"field":"amount"}}}}
+	}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+	}
+
+	type bucket struct {
+		Key          interface{} `json:"key"`
+		KeyAsString  string      `json:"key_as_string"`
+		DocCount     int         `json:"doc_count"`
+		Aggregations struct {
+			Total struct {
+				Value float64 `json:"value"`
+			} `json:"total"`
+		} `json:"aggregations"`
+	}
+	var resp struct {
+		Aggregations struct {
+			ByRegionProduct struct {
+				SumOtherDocCount int      `json:"sum_other_doc_count"`
+				Buckets          []bucket `json:"buckets"`
+			} `json:"by_region_product"`
+			RareRegions struct {
+				Buckets []bucket `json:"buckets"`
+			} `json:"rare_regions"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	// 按文档数降序，文档数相同按组合键升序；多值字段的每个取值各成一个组合
+	mt := resp.Aggregations.ByRegionProduct
+	var keys []string
+	for _, b := range mt.Buckets {
+		keys = append(keys, b.KeyAsString)
+	}
+	if want := []string{"eu|apple", "asia|kiwi", "eu|pear"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("multi_terms: expected keys %v, got %s", want, w.Body.String())
+	}
+	if first := mt.Buckets[0]; first.DocCount != 2 || first.Aggregations.Total.Value != 30 ||
+		!reflect.DeepEqual(first.Key, []interface{}{"eu", "apple"}) {
+		t.Fatalf("multi_terms: unexpected first bucket %+v", first)
+	}
+	if mt.SumOtherDocCount != 3 {
+		t.Fatalf("multi_terms: expected sum_other_doc_count 3, got %d", mt.SumOtherDocCount)
+	}
+
+	// 默认 max_doc_count 为 1，只有 asia
+	rt := resp.Aggregations.RareRegions.Buckets
+	if len(rt) != 1 || rt[0].Key != "asia" || rt[0].DocCount != 1 || rt[0].Aggregations.Total.Value != 3 {
+		t.Fatalf("rare_terms: expected [asia], got %s", w.Body.String())
+	}
+
+	w = do("POST", "/orders/_search", `{"size":0,"aggs":{"rare":{"rare_terms":{"field":"region","max_doc_count":2}}}}`)
+	if !strings.Contains(w.Body.String(), `"buckets":[{"doc_count":1,"key":"asia"},{"doc_count":2,"key":"us"}]`) {
+		t.Fatalf("rare_terms max_doc_count 2: expected [asia us], got %s", w.Body.String())
+	}
+}
@@ -15,16 +15,19 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	bleve "github.com/lscgzwd/tiggerdb"
 	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
 	"github.com/lscgzwd/tiggerdb/search/query"
 )
 
 // buildNestedAggregationsForBucket 为bucket构建嵌套聚合
 func (h *DocumentHandler) buildNestedAggregationsForBucket(
+	ctx context.Context,
 	parentAggName string,
 	bucketKey interface{},
 	subAggs map[string]map[string]interface{},
@@ -38,7 +41,7 @@ func (h *DocumentHandler) buildNestedAggregationsForBucket(
 	logger.Debug("buildNestedAggregationsForBucket: parentAgg=[%s], bucketKey=%v, subAggs count=%d", parentAggName, bucketKey, len(subAggs))
 
 	// P2-1: 使用结构体封装返回值
-	parsedSubAggs, err := h.parseAggregations(subAggs)
+	parsedSubAggs, err := h.parseAggregations(ctx, subAggs)
 	if err != nil {
 		logger.Warn("Failed to parse nested aggregations for bucket [%s]: %v", parentAggName, err)
 		return nil
@@ -70,7 +73,7 @@ func (h *DocumentHandler) buildNestedAggregationsForBucket(
 	}
 
 	// 执行搜索
-	searchResult, err := idx.Search(searchReq)
+	searchResult, err := idx.SearchInContext(ctx, searchReq)
 	if err != nil {
 		logger.Warn("Failed to execute nested aggregation search for bucket [%s]: %v", parentAggName, err)
 		return nil
@@ -81,19 +84,17 @@ func (h *DocumentHandler) buildNestedAggregationsForBucket(
 
 	// 处理bucket聚合（terms, range, date_range）
 	if len(searchResult.Facets) > 0 {
-		facetAggs := h.buildAggregations(searchResult.Facets, parsedSubAggs.CompositeInfo, parsedSubAggs.NestedInfo, parsedSubAggs.TopHitsInfo, parsedSubAggs.NestedFieldInfo, idx, bucketQuery)
+		facetAggs := h.buildAggregations(ctx, searchResult.Facets, parsedSubAggs.TermsInfo, parsedSubAggs.CompositeInfo, parsedSubAggs.NestedInfo, parsedSubAggs.TopHitsInfo, parsedSubAggs.NestedFieldInfo, idx, bucketQuery)
 		for k, v := range facetAggs {
 			result[k] = v
 		}
 	}
+	h.applyTermsMissing(ctx, subAggs, result, idx, bucketQuery)
 
 	// 处理top_hits聚合
 	if parsedSubAggs.TopHitsInfo != nil && len(parsedSubAggs.TopHitsInfo.Aggregations) > 0 {
-		for topHitsName, topHitsConfig := range parsedSubAggs.TopHitsInfo.Aggregations {
-			topHitsResult := h.buildTopHitsAggregation(topHitsConfig, idx, bucketQuery)
-			if topHitsResult != nil {
-				result[topHitsName] = topHitsResult
-			}
+		for k, v := range h.buildTopHitsAggregations(ctx, parsedSubAggs.TopHitsInfo, idx, bucketQuery) {
+			result[k] = v
 		}
 	}
 
@@ -102,7 +103,7 @@ func (h *DocumentHandler) buildNestedAggregationsForBucket(
 		for nestedFieldName, nestedFieldConfig := range parsedSubAggs.NestedFieldInfo.Aggregations {
 			logger.Debug("buildNestedAggregationsForBucket: processing nested field aggregation [%s], path=[%s]", nestedFieldName, nestedFieldConfig.Path)
 			// 在bucket查询范围内执行nested字段聚合
-			nestedFieldAggs := h.buildNestedFieldAggregations(&NestedFieldAggregationInfo{
+			nestedFieldAggs := h.buildNestedFieldAggregations(ctx, &NestedFieldAggregationInfo{
 				Aggregations: map[string]*NestedFieldAggregationConfig{
 					nestedFieldName: nestedFieldConfig,
 				},
@@ -113,6 +114,20 @@ func (h *DocumentHandler) buildNestedAggregationsForBucket(
 		}
 	}
 
+	// 处理date_histogram聚合
+	if parsedSubAggs.DateHistogramInfo != nil && len(parsedSubAggs.DateHistogramInfo.Aggregations) > 0 {
+		for k, v := range h.buildDateHistogramAggregations(ctx, parsedSubAggs.DateHistogramInfo, idx, bucketQuery) {
+			result[k] = v
+		}
+	}
+
+	// 处理geo聚合（如网格桶内的 geo_centroid）
+	if parsedSubAggs.GeoInfo != nil && len(parsedSubAggs.GeoInfo.Aggregations) > 0 {
+		for k, v := range h.buildGeoAggregations(ctx, parsedSubAggs.GeoInfo, idx, bucketQuery) {
+			result[k] = v
+		}
+	}
+
 	// 处理metrics聚合
 	if parsedSubAggs.MetricsInfo != nil && len(parsedSubAggs.MetricsInfo.Aggregations) > 0 {
 		// 性能优化：使用Fields机制，在搜索时直接获取需要的字段，避免搜索后再获取文档
@@ -140,7 +155,7 @@ func (h *DocumentHandler) buildNestedAggregationsForBucket(
 			// 使用Fields机制，让Bleve在搜索时自动填充hit.Fields
 			allDocsReq.Fields = fieldsList
 		}
-		allDocsResult, err := idx.Search(allDocsReq)
+		allDocsResult, err := idx.SearchInContext(ctx, allDocsReq)
 		if err == nil {
 			// 性能优化：如果使用了Fields机制，直接从hit.Fields提取字段值
 			// 这避免了Document()调用的开销，性能提升显著
@@ -232,9 +247,7 @@ func (h *DocumentHandler) buildTermQueryForBucket(fieldName string, key interfac
 		disjQuery.SetMin(1)
 		return disjQuery
 	case bool:
-		tq := query.NewTermQuery(fmt.Sprintf("%t", v))
-		tq.SetField(fieldName)
-		return tq
+		return dsl.BoolTermQuery(fieldName, v)
 	default:
 		// 尝试转换为字符串
 		termStr := fmt.Sprintf("%v", v)
@@ -251,6 +264,14 @@ func (h *DocumentHandler) buildNumericRangeQueryForBucket(fieldName string, min,
 	return nrq
 }
 
+// lessRangeBound 比较两个区间起点，未设置起点（无下界）的区间排在最前
+func lessRangeBound[T float64 | string](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+	return *a < *b
+}
+
 // buildDateRangeQueryForBucket 为date range bucket构建日期范围查询
 func (h *DocumentHandler) buildDateRangeQueryForBucket(fieldName string, startStr, endStr *string) query.Query {
 	var startTime, endTime time.Time
@@ -15,9 +15,23 @@
 package handler
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
 	"github.com/lscgzwd/tiggerdb/nested/document"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+	"github.com/lscgzwd/tiggerdb/search/query"
 )
 
+// defaultNestedObjectsLimit 单个文档允许的嵌套子文档数（ES index.mapping.nested_objects.limit 默认值）
+const defaultNestedObjectsLimit = 10000
+
+// maxNestedAggregationHits nested 聚合单次最多收集的根文档/子文档数
+const maxNestedAggregationHits = 100000
+
 // NestedDocumentHelper 嵌套文档处理辅助工具
 // 提供统一的嵌套文档处理逻辑，供多个handler复用
 type NestedDocumentHelper struct{}
@@ -28,57 +42,346 @@ func NewNestedDocumentHelper() *NestedDocumentHelper {
 }
 
 // ProcessNestedDocuments 处理嵌套文档
-// 从文档中提取嵌套字段，创建NestedDocument结构
-func (h *NestedDocumentHelper) ProcessNestedDocuments(parentID string, docBody map[string]interface{}) (map[string]interface{}, []*document.NestedDocument, error) {
-	docData := make(map[string]interface{})
-	nestedDocs := make([]*document.NestedDocument, 0)
-
-	// 遍历文档字段，查找嵌套结构
+// 根文档数据保留所有字段（nested 字段以扁平化形式保留在根文档中），
+// 只有 mapping 中声明为 nested 的路径才会为每个元素创建独立的子文档
+func (h *NestedDocumentHelper) ProcessNestedDocuments(parentID string, docBody map[string]interface{}, nestedPaths map[string]bool) (map[string]interface{}, []*document.NestedDocument, error) {
+	docData := make(map[string]interface{}, len(docBody))
 	for fieldName, fieldValue := range docBody {
 		// 跳过ES元数据字段
 		if fieldName == "_id" || fieldName == "_version" || fieldName == "_source" {
 			continue
 		}
+		docData[fieldName] = fieldValue
+	}
+
+	if len(nestedPaths) == 0 {
+		return docData, nil, nil
+	}
+
+	nestedDocs := make([]*document.NestedDocument, 0)
+	positions := make(map[string]int)
+	h.collectNestedDocuments(parentID, "", docData, nestedPaths, positions, &nestedDocs)
+	if len(nestedDocs) > defaultNestedObjectsLimit {
+		return nil, nil, fmt.Errorf("the number of nested documents has exceeded the allowed limit of [%d]", defaultNestedObjectsLimit)
+	}
+	return docData, nestedDocs, nil
+}
+
+// collectNestedDocuments 递归收集 nested 路径下的元素（支持多级 nested）
+// 同一路径的 position 在整个根文档内连续编号，保证子文档ID唯一
+func (h *NestedDocumentHelper) collectNestedDocuments(rootID, prefix string, obj map[string]interface{}, nestedPaths map[string]bool, positions map[string]int, out *[]*document.NestedDocument) {
+	for fieldName, fieldValue := range obj {
+		path := fieldName
+		if prefix != "" {
+			path = prefix + "." + fieldName
+		}
 
-		// 检查是否为数组（可能是嵌套文档数组）
-		if arr, ok := fieldValue.([]interface{}); ok {
-			// 检查数组元素是否为对象（嵌套文档）
-			if len(arr) > 0 {
-				if _, ok := arr[0].(map[string]interface{}); ok {
-					// 这是一个嵌套文档数组
-					for position, elem := range arr {
-						if elemMap, ok := elem.(map[string]interface{}); ok {
-							nestedDoc := document.NewNestedDocument(
-								parentID,
-								fieldName,
-								position,
-								elemMap,
-							)
-							nestedDocs = append(nestedDocs, nestedDoc)
-						}
-					}
-					// 在docData中保留字段，但标记为嵌套
-					docData[fieldName] = fieldValue
-					continue
+		var elems []map[string]interface{}
+		switch v := fieldValue.(type) {
+		case map[string]interface{}:
+			elems = append(elems, v)
+		case []interface{}:
+			for _, elem := range v {
+				if elemMap, ok := elem.(map[string]interface{}); ok {
+					elems = append(elems, elemMap)
 				}
 			}
 		}
 
-		// 检查是否为对象（可能是嵌套对象）
-		if obj, ok := fieldValue.(map[string]interface{}); ok {
-			// 递归处理嵌套对象
-			_, nested, err := h.ProcessNestedDocuments(parentID, obj)
-			if err != nil {
-				return nil, nil, err
+		for _, elem := range elems {
+			if nestedPaths[path] {
+				*out = append(*out, document.NewNestedDocument(rootID, path, positions[path], elem))
+				positions[path]++
 			}
-			nestedDocs = append(nestedDocs, nested...)
-			docData[fieldName] = fieldValue
+			h.collectNestedDocuments(rootID, path, elem, nestedPaths, positions, out)
+		}
+	}
+}
+
+// nestedDocumentBody 构建子文档的索引数据
+// 字段按完整路径嵌套（如 comments.author），以复用根文档 mapping 中 nested 字段的定义
+func nestedDocumentBody(nd *document.NestedDocument) map[string]interface{} {
+	body := map[string]interface{}{
+		dsl.NestedPathField:   nd.Path,
+		dsl.NestedRootIDField: nd.RootDocumentID,
+		"_position":           nd.Position,
+	}
+	parts := strings.Split(nd.Path, ".")
+	current := body
+	for _, part := range parts[:len(parts)-1] {
+		next := make(map[string]interface{})
+		current[part] = next
+		current = next
+	}
+	current[parts[len(parts)-1]] = nd.Fields
+	return body
+}
+
+// nestedPathsFromMapping 提取 ES mapping 中所有 nested 字段的完整路径
+func nestedPathsFromMapping(esMapping map[string]interface{}) map[string]bool {
+	paths := make(map[string]bool)
+	if props, ok := esMapping["properties"].(map[string]interface{}); ok {
+		collectNestedPaths(props, "", paths)
+	}
+	return paths
+}
+
+func collectNestedPaths(props map[string]interface{}, prefix string, paths map[string]bool) {
+	for name, def := range props {
+		fieldMap, ok := def.(map[string]interface{})
+		if !ok {
 			continue
 		}
+		fullName := name
+		if prefix != "" {
+			fullName = prefix + "." + name
+		}
+		if fieldMap["type"] == "nested" {
+			paths[fullName] = true
+		}
+		if sub, ok := fieldMap["properties"].(map[string]interface{}); ok {
+			collectNestedPaths(sub, fullName, paths)
+		}
+	}
+}
 
-		// 普通字段
-		docData[fieldName] = fieldValue
+// nestedPathsForIndex 读取索引 mapping 中的 nested 路径
+func (h *DocumentHandler) nestedPathsForIndex(indexName string) map[string]bool {
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return nil
 	}
+	return nestedPathsFromMapping(indexMeta.Mapping)
+}
 
-	return docData, nestedDocs, nil
+// hasNestedFields 索引是否包含 nested 字段（决定是否需要排除子文档）
+func (h *DocumentHandler) hasNestedFields(indexName string) bool {
+	return len(h.nestedPathsForIndex(indexName)) > 0
+}
+
+// existingNestedDocumentIDs 用一次查询取出多个根文档当前已索引的子文档ID（按根文档ID分组）
+func existingNestedDocumentIDs(idx bleve.Index, rootIDs []string) (map[string][]string, error) {
+	if len(rootIDs) == 0 {
+		return nil, nil
+	}
+	terms := make([]query.Query, 0, len(rootIDs))
+	for _, rootID := range rootIDs {
+		tq := query.NewTermQuery(rootID)
+		tq.SetField(dsl.NestedRootIDField)
+		terms = append(terms, tq)
+	}
+	searchReq := bleve.NewSearchRequest(query.NewDisjunctionQuery(terms))
+	searchReq.Size = defaultNestedObjectsLimit
+	searchReq.Fields = []string{dsl.NestedRootIDField}
+	searchResult, err := idx.Search(searchReq)
+	if err != nil {
+		return nil, err
+	}
+	if searchResult.Total > uint64(len(searchResult.Hits)) {
+		searchReq.Size = int(searchResult.Total)
+		if searchResult, err = idx.Search(searchReq); err != nil {
+			return nil, err
+		}
+	}
+	ids := make(map[string][]string, len(rootIDs))
+	for _, hit := range searchResult.Hits {
+		if rootID, ok := hit.Fields[dsl.NestedRootIDField].(string); ok {
+			ids[rootID] = append(ids[rootID], hit.ID)
+		}
+	}
+	return ids, nil
+}
+
+// nestedAggregationQuery 构建 nested 聚合的查询：匹配 path 下根文档命中 baseQuery 的子文档
+// baseQuery 命中的是子文档时（多级 nested 聚合）按其 _root_id 取根文档，
+// 子文档不记录所属的上级子对象，内层路径的子文档限定在同一根文档内
+func nestedAggregationQuery(ctx context.Context, idx bleve.Index, path string, baseQuery query.Query) (query.Query, error) {
+	rootIDs, err := nestedAggregationRootIDs(ctx, idx, baseQuery)
+	if err != nil {
+		return nil, err
+	}
+	return nestedDocumentsOfRoots(ctx, idx, path, rootIDs)
+}
+
+// reverseNestedAggregationQuery 构建 reverse_nested 聚合的查询：baseQuery 命中的子文档所属的根文档，
+// path 不为空时为这些根文档下该上级路径的子文档
+func reverseNestedAggregationQuery(ctx context.Context, idx bleve.Index, path string, baseQuery query.Query) (query.Query, error) {
+	rootIDs, err := nestedAggregationRootIDs(ctx, idx, baseQuery)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		return nestedDocumentsOfRoots(ctx, idx, path, rootIDs)
+	}
+	if len(rootIDs) == 0 {
+		return query.NewMatchNoneQuery(), nil
+	}
+	ids := make([]string, 0, len(rootIDs))
+	for id := range rootIDs {
+		ids = append(ids, id)
+	}
+	return query.NewDocIDQuery(ids), nil
+}
+
+// nestedAggregationRootIDs 收集 q 命中文档的根文档ID（子文档取 _root_id）
+func nestedAggregationRootIDs(ctx context.Context, idx bleve.Index, q query.Query) (map[string]bool, error) {
+	searchReq := bleve.NewSearchRequest(q)
+	searchReq.Size = maxNestedAggregationHits
+	searchReq.Fields = []string{dsl.NestedRootIDField}
+	searchResult, err := idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, err
+	}
+	if searchResult.Total > uint64(len(searchResult.Hits)) {
+		logger.Warn("nestedAggregationRootIDs - query matched %d documents, only the first %d are used", searchResult.Total, len(searchResult.Hits))
+	}
+	rootIDs := make(map[string]bool, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		if rootID, ok := hit.Fields[dsl.NestedRootIDField].(string); ok && rootID != "" {
+			rootIDs[rootID] = true
+		} else {
+			rootIDs[hit.ID] = true
+		}
+	}
+	return rootIDs, nil
+}
+
+// nestedDocumentsOfRoots 构建匹配 rootIDs 下 path 路径子文档的查询
+func nestedDocumentsOfRoots(ctx context.Context, idx bleve.Index, path string, rootIDs map[string]bool) (query.Query, error) {
+	if len(rootIDs) == 0 {
+		return query.NewMatchNoneQuery(), nil
+	}
+	searchReq := bleve.NewSearchRequest(dsl.NewNestedDocumentsQuery(path))
+	searchReq.Size = maxNestedAggregationHits
+	searchReq.Fields = []string{dsl.NestedRootIDField}
+	searchResult, err := idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, err
+	}
+	if searchResult.Total > uint64(len(searchResult.Hits)) {
+		logger.Warn("nestedDocumentsOfRoots - path [%s] has %d nested documents, only the first %d are used", path, searchResult.Total, len(searchResult.Hits))
+	}
+	childIDs := make([]string, 0, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		if rootID, ok := hit.Fields[dsl.NestedRootIDField].(string); ok && rootIDs[rootID] {
+			childIDs = append(childIDs, hit.ID)
+		}
+	}
+	if len(childIDs) == 0 {
+		return query.NewMatchNoneQuery(), nil
+	}
+	return query.NewDocIDQuery(childIDs), nil
+}
+
+// addNestedDocumentsToBatch 将根文档的子文档写入 batch：索引新的子文档，删除不再存在的旧子文档
+// nestedDocs 为 nil 时只删除旧子文档（用于删除根文档）
+func addNestedDocumentsToBatch(batch *bleve.Batch, nestedDocs []*document.NestedDocument, staleIDs []string) error {
+	current := make(map[string]bool, len(nestedDocs))
+	for _, nestedDoc := range nestedDocs {
+		if err := batch.Index(nestedDoc.ID, nestedDocumentBody(nestedDoc)); err != nil {
+			return fmt.Errorf("failed to index nested document [%s]: %w", nestedDoc.ID, err)
+		}
+		current[nestedDoc.ID] = true
+	}
+	for _, id := range staleIDs {
+		if !current[id] {
+			batch.Delete(id)
+		}
+	}
+	return nil
+}
+
+// indexNestedDocuments 替换根文档的全部子文档（索引没有 nested 字段时不做任何操作）
+func (h *DocumentHandler) indexNestedDocuments(idx bleve.Index, indexName, rootID string, nestedDocs []*document.NestedDocument) {
+	if !h.hasNestedFields(indexName) {
+		return
+	}
+	existing, err := existingNestedDocumentIDs(idx, []string{rootID})
+	if err != nil {
+		logger.Warn("Failed to look up nested documents of [%s] in index [%s]: %v", rootID, indexName, err)
+		return
+	}
+	batch := idx.NewBatch()
+	if err := addNestedDocumentsToBatch(batch, nestedDocs, existing[rootID]); err != nil {
+		logger.Warn("Failed to prepare nested documents of [%s] in index [%s]: %v", rootID, indexName, err)
+		return
+	}
+	if batch.Size() == 0 {
+		return
+	}
+	if err := idx.Batch(batch); err != nil {
+		logger.Warn("Failed to index nested documents of [%s] in index [%s]: %v", rootID, indexName, err)
+	}
+}
+
+// deleteNestedDocuments 删除根文档的全部子文档
+func (h *DocumentHandler) deleteNestedDocuments(idx bleve.Index, indexName, rootID string) {
+	h.indexNestedDocuments(idx, indexName, rootID, nil)
+}
+
+// syncNestedDocuments 根据根文档数据重建子文档（用于 bulk 单条操作）
+func (h *DocumentHandler) syncNestedDocuments(idx bleve.Index, indexName, rootID string, docData map[string]interface{}) {
+	nestedPaths := h.nestedPathsForIndex(indexName)
+	if len(nestedPaths) == 0 {
+		return
+	}
+	_, nestedDocs, err := h.nestedDocHelper.ProcessNestedDocuments(rootID, docData, nestedPaths)
+	if err != nil {
+		logger.Warn("Failed to process nested documents of [%s] in index [%s]: %v", rootID, indexName, err)
+		return
+	}
+	h.indexNestedDocuments(idx, indexName, rootID, nestedDocs)
+}
+
+// nestedBatch 收集一个 batch 中根文档的子文档变更，写入 batch 前用一次查询取出这些根文档已有的子文档
+type nestedBatch struct {
+	h           *DocumentHandler
+	idx         bleve.Index
+	nestedPaths map[string]bool
+	roots       []string
+	docs        map[string][]*document.NestedDocument
+}
+
+// newNestedBatch 创建子文档变更收集器（nestedPaths 为空时不做任何操作）
+func (h *DocumentHandler) newNestedBatch(idx bleve.Index, nestedPaths map[string]bool) *nestedBatch {
+	return &nestedBatch{h: h, idx: idx, nestedPaths: nestedPaths, docs: make(map[string][]*document.NestedDocument)}
+}
+
+// add 记录根文档的子文档；docData 为 nil 表示根文档被删除，同一根文档以最后一次操作为准
+func (b *nestedBatch) add(rootID string, docData map[string]interface{}) {
+	if len(b.nestedPaths) == 0 {
+		return
+	}
+	var nestedDocs []*document.NestedDocument
+	if docData != nil {
+		var err error
+		if _, nestedDocs, err = b.h.nestedDocHelper.ProcessNestedDocuments(rootID, docData, b.nestedPaths); err != nil {
+			logger.Warn("Failed to process nested documents of [%s]: %v", rootID, err)
+			return
+		}
+	}
+	if _, ok := b.docs[rootID]; !ok {
+		b.roots = append(b.roots, rootID)
+	}
+	b.docs[rootID] = nestedDocs
+}
+
+// flush 将收集的子文档变更写入 batch 并清空收集器
+func (b *nestedBatch) flush(batch *bleve.Batch) {
+	if len(b.roots) == 0 {
+		return
+	}
+	roots, docs := b.roots, b.docs
+	b.roots, b.docs = nil, make(map[string][]*document.NestedDocument)
+
+	existing, err := existingNestedDocumentIDs(b.idx, roots)
+	if err != nil {
+		logger.Warn("Failed to look up nested documents of %d root documents: %v", len(roots), err)
+		return
+	}
+	for _, rootID := range roots {
+		if err := addNestedDocumentsToBatch(batch, docs[rootID], existing[rootID]); err != nil {
+			logger.Warn("Failed to prepare nested documents of [%s]: %v", rootID, err)
+		}
+	}
 }
@@ -0,0 +1,407 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+type nestedTestHits struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			ID    string  `json:"_id"`
+			Score float64 `json:"_score"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func TestDocumentHandler_NestedDocuments(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "DELETE", Path: "/{index}/_doc/{id}", Handler: docHandler.DeleteDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	search := func(body string) nestedTestHits {
+		t.Helper()
+		w := do("POST", "/blog/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp nestedTestHits
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode search response: %v", err)
+		}
+		return resp
+	}
+	count := func() int {
+		t.Helper()
+		w := do("POST", "/blog/_count", "")
+		var resp struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode count response: %v", err)
+		}
+		return resp.Count
+	}
+
+	createBody := `{"mappings":{"properties":{
+		"title":{"type":"keyword"},
+		"comments":{"type":"nested","properties":{"author":{"type":"keyword"},"stars":{"type":"integer"}}}
+	}}}`
+	if w := do("PUT", "/blog", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := map[string]string{
+		"1": `{"title":"a","comments":[{"author":"alice","stars":5},{"author":"bob","stars":1}]}`,
+		"2": `{"title":"b","comments":[{"author":"alice","stars":1},{"author":"bob","stars":5}]}`,
+		"3": `{"title":"c","comments":[{"author":"alice","stars":4},{"author":"alice","stars":4}]}`,
+		"4": `{"title":"d"}`,
+	}
+	for id, body := range docs {
+		if w := do("PUT", "/blog/_doc/"+id, body); w.Code >= 300 {
+			t.Fatalf("index doc %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	// 子文档不计入搜索结果和 count
+	if got := search(`{"query":{"match_all":{}}}`).Hits.Total.Value; got != 4 {
+		t.Fatalf("match_all should only hit root documents, got %d", got)
+	}
+	if got := count(); got != 4 {
+		t.Fatalf("count should only include root documents, got %d", got)
+	}
+
+	// nested 查询在同一个子对象内匹配，不会跨元素组合条件
+	resp := search(`{"query":{"nested":{"path":"comments","query":{"bool":{"must":[
+		{"term":{"comments.author":"alice"}},
+		{"range":{"comments.stars":{"gte":4}}}
+	]}}}}}`)
+	ids := map[string]bool{}
+	for _, hit := range resp.Hits.Hits {
+		ids[hit.ID] = true
+	}
+	if len(ids) != 2 || !ids["1"] || !ids["3"] {
+		t.Fatalf("nested query should match docs 1 and 3, got %+v", resp.Hits.Hits)
+	}
+
+	scoreOf := func(mode, id string) float64 {
+		t.Helper()
+		resp := search(`{"query":{"nested":{"path":"comments","score_mode":"` + mode + `","query":{"term":{"comments.author":"alice"}}}}}`)
+		for _, hit := range resp.Hits.Hits {
+			if hit.ID == id {
+				return hit.Score
+			}
+		}
+		t.Fatalf("score_mode %s: doc %s not found in %+v", mode, id, resp.Hits.Hits)
+		return 0
+	}
+	if sum, max := scoreOf("sum", "3"), scoreOf("max", "3"); sum < max*1.9 {
+		t.Fatalf("score_mode sum should add both matching children: sum=%v max=%v", sum, max)
+	}
+	if avg, max := scoreOf("avg", "3"), scoreOf("max", "3"); avg > max+1e-9 {
+		t.Fatalf("score_mode avg must not exceed max: avg=%v max=%v", avg, max)
+	}
+	if none := scoreOf("none", "1"); none != 0 {
+		t.Fatalf("score_mode none should not contribute a score, got %v", none)
+	}
+	if w := do("POST", "/blog/_search", `{"query":{"nested":{"path":"comments","score_mode":"median","query":{"match_all":{}}}}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid score_mode: expected 400 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 重新索引根文档会替换旧的子文档
+	if w := do("PUT", "/blog/_doc/1", `{"title":"a","comments":[{"author":"carol","stars":2}]}`); w.Code >= 300 {
+		t.Fatalf("reindex doc 1: got %d: %s", w.Code, w.Body.String())
+	}
+	if got := search(`{"query":{"nested":{"path":"comments","query":{"term":{"comments.author":"bob"}}}}}`).Hits.Total.Value; got != 1 {
+		t.Fatalf("stale nested documents should be removed on reindex, got %d hits for bob", got)
+	}
+
+	// 删除根文档同时删除子文档
+	if w := do("DELETE", "/blog/_doc/3", ""); w.Code != http.StatusOK {
+		t.Fatalf("delete doc 3: got %d: %s", w.Code, w.Body.String())
+	}
+	if got := count(); got != 3 {
+		t.Fatalf("count after delete: expected 3 got %d", got)
+	}
+	idx, err := indexMgr.GetIndex("blog")
+	if err != nil {
+		t.Fatalf("get index: %v", err)
+	}
+	if existing, err := existingNestedDocumentIDs(idx, []string{"3"}); err != nil || len(existing["3"]) != 0 {
+		t.Fatalf("nested documents of deleted root should be removed, got %v (err=%v)", existing, err)
+	}
+
+	// bulk 中的多个根文档一起替换、删除子文档
+	bulk := `{"index":{"_index":"blog","_id":"1"}}
+{"title":"a","comments":[{"author":"dave","stars":3}]}
+{"index":{"_index":"blog","_id":"2"}}
+{"title":"b","comments":[{"author":"dave","stars":2},{"author":"erin","stars":1}]}
+{"delete":{"_index":"blog","_id":"2"}}
+{"index":{"_index":"blog","_id":"5"}}
+{"title":"e","comments":[{"author":"erin","stars":5}]}
+`
+	if w := do("POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"errors":true`) {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+	existing, err := existingNestedDocumentIDs(idx, []string{"1", "2", "5"})
+	if err != nil || len(existing["1"]) != 1 || len(existing["2"]) != 0 || len(existing["5"]) != 1 {
+		t.Fatalf("unexpected nested documents after bulk: %v (err=%v)", existing, err)
+	}
+	for author, want := range map[string]int{"carol": 0, "bob": 0, "dave": 1, "erin": 1} {
+		if got := search(`{"query":{"nested":{"path":"comments","query":{"term":{"comments.author":"` + author + `"}}}}}`).Hits.Total.Value; got != want {
+			t.Errorf("after bulk: expected %d hits for %s, got %d", want, author, got)
+		}
+	}
+}
+
+func TestDocumentHandler_NestedInCompoundQueries(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	search := func(body string) nestedTestHits {
+		t.Helper()
+		w := do("POST", "/blog/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp nestedTestHits
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode search response: %v", err)
+		}
+		return resp
+	}
+	hitIDs := func(resp nestedTestHits) string {
+		ids := make([]string, 0, len(resp.Hits.Hits))
+		for _, hit := range resp.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	createBody := `{"mappings":{"properties":{
+		"title":{"type":"keyword"},
+		"likes":{"type":"integer"},
+		"comments":{"type":"nested","properties":{"author":{"type":"keyword"}}}
+	}}}`
+	if w := do("PUT", "/blog", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := map[string]string{
+		"1": `{"title":"a","likes":10,"comments":[{"author":"alice"}]}`,
+		"2": `{"title":"b","likes":1,"comments":[{"author":"alice"},{"author":"bob"}]}`,
+		"3": `{"title":"c","likes":5,"comments":[{"author":"bob"}]}`,
+	}
+	for id, body := range docs {
+		if w := do("PUT", "/blog/_doc/"+id+"?refresh=true", body); w.Code >= 300 {
+			t.Fatalf("index doc %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+	const alice = `{"nested":{"path":"comments","query":{"term":{"comments.author":"alice"}}}}`
+
+	// function_score 中的 nested 查询：按 likes 计分
+	resp := search(`{"query":{"function_score":{"query":` + alice + `,"field_value_factor":{"field":"likes"},"boost_mode":"replace"}}}`)
+	if got := hitIDs(resp); got != "1,2" {
+		t.Errorf("function_score over nested: expected hits 1,2 got %s", got)
+	}
+	// boosting 的 positive 与 negative 都可以是 nested 查询
+	resp = search(`{"query":{"boosting":{"positive":` + alice + `,"negative":{"nested":{"path":"comments","query":{"term":{"comments.author":"bob"}}}},"negative_boost":0.1}}}`)
+	if got := hitIDs(resp); got != "1,2" || resp.Hits.Hits[0].Score <= resp.Hits.Hits[1].Score {
+		t.Errorf("boosting over nested: expected 1 ranked above 2, got %+v", resp.Hits.Hits)
+	}
+	resp = search(`{"query":{"constant_score":{"filter":` + alice + `}}}`)
+	if resp.Hits.Total.Value != 2 {
+		t.Errorf("constant_score over nested: expected 2 hits, got %+v", resp.Hits.Hits)
+	}
+}
+
+func TestDocumentHandler_NestedAggregation(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	aggs := func(body string) map[string]interface{} {
+		t.Helper()
+		w := do("POST", "/posts/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Aggregations map[string]interface{} `json:"aggregations"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode search response: %v", err)
+		}
+		return resp.Aggregations
+	}
+
+	createBody := `{"mappings":{"properties":{
+		"title":{"type":"keyword"},
+		"comments":{"type":"nested","properties":{"author":{"type":"keyword"},"rating":{"type":"integer"}}}
+	}}}`
+	if w := do("PUT", "/posts", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := map[string]string{
+		"1": `{"title":"a","comments":[{"author":"alice","rating":5},{"author":"bob","rating":1}]}`,
+		"2": `{"title":"b","comments":[{"author":"alice","rating":3},{"author":"bob","rating":2},{"author":"carol","rating":2}]}`,
+		"3": `{"title":"c"}`,
+	}
+	for id, body := range docs {
+		if w := do("PUT", "/posts/_doc/"+id+"?refresh=true", body); w.Code >= 300 {
+			t.Fatalf("index doc %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	// doc_count 为子对象数，子聚合只统计筛选出的子对象
+	result := aggs(`{"size":0,"aggs":{"comments":{"nested":{"path":"comments"},"aggs":{
+		"authors":{"terms":{"field":"comments.author"}},
+		"ratings":{"sum":{"field":"comments.rating"}},
+		"alice":{"filter":{"term":{"comments.author":"alice"}},"aggs":{"avg_rating":{"avg":{"field":"comments.rating"}}}}
+	}}}}`)
+	comments, _ := result["comments"].(map[string]interface{})
+	if got, _ := comments["doc_count"].(float64); got != 5 {
+		t.Fatalf("expected 5 nested objects, got %v", comments)
+	}
+	subAggs, _ := comments["aggregations"].(map[string]interface{})
+	authors, _ := subAggs["authors"].(map[string]interface{})
+	buckets, _ := authors["buckets"].([]interface{})
+	counts := make(map[string]float64)
+	for _, b := range buckets {
+		bucket := b.(map[string]interface{})
+		counts[fmt.Sprint(bucket["key"])] = bucket["doc_count"].(float64)
+	}
+	if len(counts) != 3 || counts["alice"] != 2 || counts["bob"] != 2 || counts["carol"] != 1 {
+		t.Errorf("unexpected author buckets %v", authors)
+	}
+	if ratings, _ := subAggs["ratings"].(map[string]interface{}); ratings["value"] != 13.0 {
+		t.Errorf("expected rating sum 13, got %v", ratings)
+	}
+	alice, _ := subAggs["alice"].(map[string]interface{})
+	if got, _ := alice["doc_count"].(float64); got != 2 {
+		t.Errorf("expected 2 comments by alice, got %v", alice)
+	}
+	aliceAggs, _ := alice["aggregations"].(map[string]interface{})
+	avgRating, _ := aliceAggs["avg_rating"].(map[string]interface{})
+	if got, _ := avgRating["value"].(float64); got != 4 {
+		t.Errorf("expected avg rating 4 for alice, got %v", alice)
+	}
+
+	// 子对象限定在查询命中的根文档内
+	result = aggs(`{"size":0,"query":{"term":{"title":"a"}},"aggs":{"comments":{"nested":{"path":"comments"},"aggs":{
+		"max_rating":{"max":{"field":"comments.rating"}},"min_rating":{"min":{"field":"comments.rating"}}
+	}}}}`)
+	comments, _ = result["comments"].(map[string]interface{})
+	subAggs, _ = comments["aggregations"].(map[string]interface{})
+	maxRating, _ := subAggs["max_rating"].(map[string]interface{})
+	minRating, _ := subAggs["min_rating"].(map[string]interface{})
+	if got, _ := comments["doc_count"].(float64); got != 2 || maxRating["value"] != 5.0 || minRating["value"] != 1.0 {
+		t.Errorf("expected the 2 comments of post a, got %v", comments)
+	}
+
+	// filter 聚合下的 nested 聚合结果位于 filter 的子聚合中
+	result = aggs(`{"size":0,"aggs":{"post_b":{"filter":{"term":{"title":"b"}},"aggs":{
+		"comments":{"nested":{"path":"comments"},"aggs":{"authors":{"terms":{"field":"comments.author"}}}}
+	}}}}`)
+	postB, _ := result["post_b"].(map[string]interface{})
+	postBAggs, _ := postB["aggregations"].(map[string]interface{})
+	comments, _ = postBAggs["comments"].(map[string]interface{})
+	if got, _ := comments["doc_count"].(float64); got != 3 {
+		t.Errorf("expected the 3 comments of post b, got %v", postB)
+	}
+
+	// reverse_nested 回到子对象所属的根文档
+	result = aggs(`{"size":0,"aggs":{"comments":{"nested":{"path":"comments"},"aggs":{
+		"posts":{"reverse_nested":{}},
+		"authors":{"terms":{"field":"comments.author"},"aggs":{"posts":{"reverse_nested":{},"aggs":{"titles":{"terms":{"field":"title"}}}}}}
+	}}}}`)
+	comments, _ = result["comments"].(map[string]interface{})
+	subAggs, _ = comments["aggregations"].(map[string]interface{})
+	if posts, _ := subAggs["posts"].(map[string]interface{}); posts["doc_count"] != 2.0 {
+		t.Errorf("expected 2 posts with comments, got %v", posts)
+	}
+	authors, _ = subAggs["authors"].(map[string]interface{})
+	buckets, _ = authors["buckets"].([]interface{})
+	titles := make(map[string]string)
+	for _, b := range buckets {
+		bucket := b.(map[string]interface{})
+		bucketAggs, _ := bucket["aggregations"].(map[string]interface{})
+		posts, _ := bucketAggs["posts"].(map[string]interface{})
+		postAggs, _ := posts["aggregations"].(map[string]interface{})
+		titleAgg, _ := postAggs["titles"].(map[string]interface{})
+		var keys []string
+		for _, tb := range titleAgg["buckets"].([]interface{}) {
+			keys = append(keys, fmt.Sprint(tb.(map[string]interface{})["key"]))
+		}
+		sort.Strings(keys)
+		titles[fmt.Sprint(bucket["key"])] = fmt.Sprintf("%v:%s", posts["doc_count"], strings.Join(keys, ","))
+	}
+	if titles["alice"] != "2:a,b" || titles["bob"] != "2:a,b" || titles["carol"] != "1:b" {
+		t.Errorf("unexpected reverse_nested results per author %v", titles)
+	}
+}
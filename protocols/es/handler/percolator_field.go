@@ -0,0 +1,129 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+)
+
+// percolator 字段（存储查询）
+// 文档中的 percolator 字段值是一个查询 DSL，索引时展开为 dsl 包定义的内部字段：
+// 序列化的查询、提取的词项（用于 percolate 时预过滤候选查询）以及提取状态。
+
+// percolatorFieldName 返回 mapping 中第一个顶层 percolator 字段名
+func percolatorFieldName(esMapping map[string]interface{}) string {
+	props, _ := esMapping["properties"].(map[string]interface{})
+	names := make([]string, 0, len(props))
+	for name, def := range props {
+		if fieldMap, ok := def.(map[string]interface{}); ok && fieldMap["type"] == "percolator" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// validatePercolatorQuery 校验 percolator 字段值是合法的查询
+func validatePercolatorQuery(v interface{}) error {
+	queryMap, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("query must be an object")
+	}
+	if _, err := dsl.NewQueryParser().ParseQuery(queryMap); err != nil {
+		return err
+	}
+	return nil
+}
+
+// applyPercolatorFields 为包含 percolator 字段的文档生成存储查询的内部字段
+// 查询本身不按普通字段索引，原始文档保存在 _source 中
+func (h *DocumentHandler) applyPercolatorFields(indexName string, docData map[string]interface{}) map[string]interface{} {
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return docData
+	}
+	field := percolatorFieldName(indexMeta.Mapping)
+	if field == "" {
+		return docData
+	}
+	queryMap, ok := docData[field].(map[string]interface{})
+	if !ok {
+		return docData
+	}
+
+	queryJSON, err := json.Marshal(queryMap)
+	if err != nil {
+		return docData
+	}
+
+	extraction := dsl.PercolatorExtractionFailed
+	var terms []string
+	if idx, err := h.indexMgr.GetIndex(indexName); err == nil {
+		if storedQuery, err := h.newQueryParser(indexName).ParseQuery(queryMap); err == nil {
+			var complete bool
+			terms, complete = dsl.ExtractPercolatorTerms(idx.Mapping(), storedQuery)
+			if complete {
+				extraction = dsl.PercolatorExtractionComplete
+			}
+		} else {
+			logger.Warn("Failed to parse percolator query in index [%s]: %v", indexName, err)
+		}
+	}
+
+	result := make(map[string]interface{}, len(docData)+4)
+	for k, v := range docData {
+		result[k] = v
+	}
+	if _, hasSource := docData["_source"]; !hasSource {
+		sourceJSON, _ := json.Marshal(docData)
+		result["_source"] = string(sourceJSON)
+	}
+	delete(result, field)
+	result[dsl.PercolatorFlagField] = "true"
+	result[dsl.PercolatorQueryField] = string(queryJSON)
+	result[dsl.PercolatorExtractionField] = extraction
+	if len(terms) > 0 {
+		result[dsl.PercolatorTermsField] = terms
+	}
+	return result
+}
+
+// percolatorDocumentSlots 返回命中的存储查询对应的 _percolator_document_slot 字段
+func percolatorDocumentSlots(hitID string, percolateInfos []*dsl.PercolateQueryInfo) map[string]interface{} {
+	var fields map[string]interface{}
+	for _, info := range percolateInfos {
+		slots, ok := info.DocumentSlots[hitID]
+		if !ok {
+			continue
+		}
+		name := "_percolator_document_slot"
+		if info.Name != "" {
+			name += "_" + info.Name
+		}
+		if fields == nil {
+			fields = make(map[string]interface{})
+		}
+		fields[name] = slots
+	}
+	return fields
+}
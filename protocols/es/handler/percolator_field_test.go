@@ -0,0 +1,119 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_Percolate(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	createBody := `{"mappings":{"properties":{
+		"query":{"type":"percolator"},
+		"message":{"type":"text"},
+		"tags":{"type":"keyword"}
+	}}}`
+	if w := do("PUT", "/alerts", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	stored := map[string]string{
+		"errors": `{"query":{"match":{"message":"error"}}}`,
+		"urgent": `{"query":{"term":{"tags":"urgent"}}}`,
+		"disk":   `{"query":{"bool":{"must":[{"match":{"message":"disk"}},{"match":{"message":"full"}}]}}}`,
+		"all":    `{"query":{"match_all":{}}}`,
+	}
+	for id, body := range stored {
+		if w := do("PUT", "/alerts/_doc/"+id+"?refresh=true", body); w.Code >= 300 {
+			t.Fatalf("index %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+	if w := do("PUT", "/alerts/_doc/bad", `{"query":{"unknown_query":{}}}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "mapper_parsing_exception") {
+		t.Fatalf("invalid stored query: expected 400 mapper_parsing_exception, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/alerts/_doc/errors", ""); !strings.Contains(w.Body.String(), `"match"`) {
+		t.Fatalf("stored query should be returned in _source: %s", w.Body.String())
+	}
+
+	// 可提取词项的存储查询参与预过滤，match_all 始终作为候选
+	w := do("POST", "/alerts/_search", `{"query":{"term":{"_percolator_extraction":"complete"}}}`)
+	if !strings.Contains(w.Body.String(), `"total":{"relation":"eq","value":3}`) {
+		t.Fatalf("expected 3 stored queries with complete term extraction, got %s", w.Body.String())
+	}
+
+	w = do("POST", "/alerts/_search", `{"query":{"percolate":{"field":"query","documents":[
+		{"message":"disk is full, write error"},
+		{"message":"all good","tags":"urgent"},
+		{"message":"nothing to see"}
+	]}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("percolate: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				ID     string `json:"_id"`
+				Fields struct {
+					Slots []int `json:"_percolator_document_slot"`
+				} `json:"fields"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode percolate response: %v", err)
+	}
+	got := make(map[string][]int)
+	for _, hit := range resp.Hits.Hits {
+		got[hit.ID] = hit.Fields.Slots
+	}
+	want := map[string][]int{
+		"errors": {0},
+		"urgent": {1},
+		"disk":   {0},
+		"all":    {0, 1, 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("percolate slots: expected %v, got %v", want, got)
+	}
+
+	// 单个文档 + name：槽位字段带名称后缀
+	w = do("POST", "/alerts/_search", `{"query":{"percolate":{"field":"query","name":"probe","document":{"tags":"urgent"}}}}`)
+	if !strings.Contains(w.Body.String(), `"_percolator_document_slot_probe":[0]`) {
+		t.Fatalf("named percolate: expected slot field with name suffix, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,450 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+)
+
+// 管道聚合：在其他聚合的结果上计算，不访问文档
+//   - 父管道聚合（derivative、cumulative_sum、moving_avg、bucket_script、bucket_selector）
+//     定义在多桶聚合的子聚合中，按桶的输出顺序逐桶计算，结果写入每个桶的子聚合结果
+//   - 兄弟管道聚合（avg_bucket、sum_bucket、min_bucket、max_bucket）与多桶聚合同级，汇总其所有桶的值
+//
+// buckets_path 格式：聚合名[>聚合名]*[.指标]，特殊路径 _count（桶文档数）和 _key（桶键）
+
+var parentPipelineTypes = map[string]bool{
+	"derivative":      true,
+	"cumulative_sum":  true,
+	"moving_avg":      true,
+	"bucket_script":   true,
+	"bucket_selector": true,
+}
+
+var siblingPipelineTypes = map[string]bool{
+	"avg_bucket": true,
+	"sum_bucket": true,
+	"min_bucket": true,
+	"max_bucket": true,
+}
+
+// isPipelineAggregation 返回聚合类型是否为管道聚合
+func isPipelineAggregation(aggType string) bool {
+	return parentPipelineTypes[aggType] || siblingPipelineTypes[aggType]
+}
+
+// 管道聚合的空值策略
+const (
+	gapPolicySkip        = "skip"
+	gapPolicyInsertZeros = "insert_zeros"
+)
+
+// pipelineAggregation 解析后的管道聚合
+type pipelineAggregation struct {
+	name      string
+	aggType   string
+	config    map[string]interface{}
+	paths     map[string]string // 变量名 -> buckets_path，单路径时变量名为 ""
+	gapPolicy string
+}
+
+// parsePipelineAggregation 解析管道聚合配置
+func parsePipelineAggregation(name, aggType string, config map[string]interface{}) (*pipelineAggregation, error) {
+	p := &pipelineAggregation{name: name, aggType: aggType, config: config, paths: make(map[string]string), gapPolicy: gapPolicySkip}
+	switch bp := config["buckets_path"].(type) {
+	case string:
+		if aggType == "bucket_script" || aggType == "bucket_selector" {
+			p.paths["_value"] = bp
+		} else {
+			p.paths[""] = bp
+		}
+	case map[string]interface{}:
+		if aggType != "bucket_script" && aggType != "bucket_selector" {
+			return nil, fmt.Errorf("[%s] requires a single [buckets_path]", aggType)
+		}
+		for k, v := range bp {
+			path, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("[buckets_path] [%s] must be a string", k)
+			}
+			p.paths[k] = path
+		}
+	}
+	if len(p.paths) == 0 {
+		return nil, fmt.Errorf("[%s] requires [buckets_path]", aggType)
+	}
+	if gp, ok := config["gap_policy"].(string); ok {
+		if gp != gapPolicySkip && gp != gapPolicyInsertZeros {
+			return nil, fmt.Errorf("unknown gap_policy [%s]", gp)
+		}
+		p.gapPolicy = gp
+	}
+	return p, nil
+}
+
+// dependsOn 返回管道聚合引用的同级聚合名
+func (p *pipelineAggregation) dependsOn() []string {
+	deps := make([]string, 0, len(p.paths))
+	for _, path := range p.paths {
+		first := strings.SplitN(path, ">", 2)[0]
+		deps = append(deps, strings.SplitN(first, ".", 2)[0])
+	}
+	return deps
+}
+
+// applyPipelineAggregations 在聚合结果构建完成后计算管道聚合（递归处理子聚合）
+func (h *DocumentHandler) applyPipelineAggregations(specs map[string]map[string]interface{}, results map[string]interface{}) {
+	if len(specs) == 0 || results == nil {
+		return
+	}
+
+	var siblings []*pipelineAggregation
+	for name, spec := range specs {
+		aggConfig, err := h.parseSingleAggregation(name, spec)
+		if err != nil {
+			continue
+		}
+		if isPipelineAggregation(aggConfig.Type) {
+			// 父管道聚合由外层多桶聚合处理
+			if !siblingPipelineTypes[aggConfig.Type] {
+				continue
+			}
+			p, err := parsePipelineAggregation(name, aggConfig.Type, aggConfig.Config)
+			if err != nil {
+				logger.Warn("Failed to parse pipeline aggregation [%s]: %v", name, err)
+				continue
+			}
+			siblings = append(siblings, p)
+			continue
+		}
+		if len(aggConfig.SubAggregations) == 0 {
+			continue
+		}
+		result, ok := results[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		buckets, multiBucket := aggregationBuckets(result)
+		if !multiBucket {
+			// 单桶聚合（filter、nested）：在其子聚合结果上继续处理
+			h.applyPipelineAggregations(aggConfig.SubAggregations, bucketSubAggregations(result, false))
+			continue
+		}
+
+		var parents []*pipelineAggregation
+		for subName, subSpec := range aggConfig.SubAggregations {
+			subConfig, err := h.parseSingleAggregation(subName, subSpec)
+			if err != nil || !parentPipelineTypes[subConfig.Type] {
+				continue
+			}
+			p, err := parsePipelineAggregation(subName, subConfig.Type, subConfig.Config)
+			if err != nil {
+				logger.Warn("Failed to parse pipeline aggregation [%s]: %v", subName, err)
+				continue
+			}
+			parents = append(parents, p)
+		}
+		for _, bucket := range buckets {
+			h.applyPipelineAggregations(aggConfig.SubAggregations, bucketSubAggregations(bucket, len(parents) > 0))
+		}
+		for _, p := range orderPipelines(parents) {
+			buckets = h.applyParentPipeline(p, buckets)
+		}
+		if len(parents) > 0 {
+			result["buckets"] = buckets
+		}
+	}
+
+	for _, p := range orderPipelines(siblings) {
+		results[p.name] = h.siblingPipelineResult(p, results)
+	}
+}
+
+// orderPipelines 按依赖关系排序：引用其他管道聚合结果的管道聚合排在后面
+func orderPipelines(pipelines []*pipelineAggregation) []*pipelineAggregation {
+	sort.Slice(pipelines, func(i, j int) bool { return pipelines[i].name < pipelines[j].name })
+	pending := make(map[string]bool, len(pipelines))
+	for _, p := range pipelines {
+		pending[p.name] = true
+	}
+	ordered := make([]*pipelineAggregation, 0, len(pipelines))
+	for len(ordered) < len(pipelines) {
+		progressed := false
+		for _, p := range pipelines {
+			if !pending[p.name] {
+				continue
+			}
+			ready := true
+			for _, dep := range p.dependsOn() {
+				if dep != p.name && pending[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				pending[p.name] = false
+				ordered = append(ordered, p)
+				progressed = true
+			}
+		}
+		if !progressed {
+			// 循环引用：按名称顺序计算剩余的管道聚合
+			for _, p := range pipelines {
+				if pending[p.name] {
+					pending[p.name] = false
+					ordered = append(ordered, p)
+				}
+			}
+		}
+	}
+	// bucket_selector 不产生值，最后执行，避免过滤掉其他管道聚合计算所需的桶
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].aggType != "bucket_selector" && ordered[j].aggType == "bucket_selector"
+	})
+	return ordered
+}
+
+// applyParentPipeline 在多桶聚合的桶上计算父管道聚合，返回计算后的桶（bucket_selector 会过滤桶）
+func (h *DocumentHandler) applyParentPipeline(p *pipelineAggregation, buckets []map[string]interface{}) []map[string]interface{} {
+	path := p.paths[""]
+	switch p.aggType {
+	case "derivative":
+		var prev *float64
+		for _, bucket := range buckets {
+			value, ok := h.pipelineBucketValue(bucket, path, p.gapPolicy)
+			if !ok {
+				continue
+			}
+			if prev != nil {
+				setPipelineValue(bucket, p.name, value-*prev)
+			}
+			v := value
+			prev = &v
+		}
+
+	case "cumulative_sum":
+		var sum float64
+		for _, bucket := range buckets {
+			if value, ok := h.pipelineBucketValue(bucket, path, gapPolicyInsertZeros); ok {
+				sum += value
+			}
+			setPipelineValue(bucket, p.name, sum)
+		}
+
+	case "moving_avg":
+		window := 5
+		if w, ok := p.config["window"].(float64); ok && w >= 1 {
+			window = int(w)
+		}
+		if model, ok := p.config["model"].(string); ok && model != "simple" {
+			logger.Warn("moving_avg [%s]: model [%s] is not supported, only [simple]", p.name, model)
+			return buckets
+		}
+		var values []float64
+		for _, bucket := range buckets {
+			if len(values) > 0 {
+				var sum float64
+				for _, v := range values {
+					sum += v
+				}
+				setPipelineValue(bucket, p.name, sum/float64(len(values)))
+			}
+			if value, ok := h.pipelineBucketValue(bucket, path, p.gapPolicy); ok {
+				values = append(values, value)
+				if len(values) > window {
+					values = values[1:]
+				}
+			}
+		}
+
+	case "bucket_script", "bucket_selector":
+		config := ParseBucketScriptAggregation(p.config)
+		config.BucketsPath = p.paths
+		executor := NewScriptAggregationExecutor()
+		selected := buckets[:0:0]
+		for _, bucket := range buckets {
+			bucketValues := make(map[string]interface{}, len(p.paths))
+			for _, varPath := range p.paths {
+				if value, ok := h.pipelineBucketValue(bucket, varPath, p.gapPolicy); ok {
+					bucketValues[varPath] = value
+				}
+			}
+			result, err := executor.ExecuteBucketScript(config, bucketValues)
+			if err != nil {
+				logger.Warn("%s [%s] failed: %v", p.aggType, p.name, err)
+				selected = append(selected, bucket)
+				continue
+			}
+			if p.aggType == "bucket_selector" {
+				// 缺失变量（gap_policy=skip）时保留该桶
+				if keep, ok := result.(bool); !ok || keep {
+					selected = append(selected, bucket)
+				}
+				continue
+			}
+			if value := h.extractNumericValueFromInterface(result); value != nil {
+				setPipelineValue(bucket, p.name, *value)
+			}
+		}
+		if p.aggType == "bucket_selector" {
+			return selected
+		}
+	}
+	return buckets
+}
+
+// siblingPipelineResult 计算兄弟管道聚合：汇总 buckets_path 第一段指向的多桶聚合所有桶的值
+func (h *DocumentHandler) siblingPipelineResult(p *pipelineAggregation, results map[string]interface{}) map[string]interface{} {
+	parts := strings.SplitN(p.paths[""], ">", 2)
+	target, _ := results[parts[0]].(map[string]interface{})
+	buckets, ok := aggregationBuckets(target)
+	if !ok {
+		logger.Warn("%s [%s]: buckets_path [%s] must reference a multi-bucket aggregation", p.aggType, p.name, p.paths[""])
+		return map[string]interface{}{"value": nil}
+	}
+	valuePath := "_count"
+	if len(parts) == 2 {
+		valuePath = parts[1]
+	}
+
+	var count int
+	var sum float64
+	var best *float64
+	var keys []interface{}
+	for _, bucket := range buckets {
+		value, ok := h.pipelineBucketValue(bucket, valuePath, p.gapPolicy)
+		if !ok {
+			continue
+		}
+		count++
+		sum += value
+		switch {
+		case best == nil,
+			p.aggType == "max_bucket" && value > *best,
+			p.aggType == "min_bucket" && value < *best:
+			v := value
+			best = &v
+			keys = []interface{}{bucket["key"]}
+		case value == *best:
+			keys = append(keys, bucket["key"])
+		}
+	}
+
+	switch p.aggType {
+	case "sum_bucket":
+		return map[string]interface{}{"value": sum}
+	case "avg_bucket":
+		if count == 0 {
+			return map[string]interface{}{"value": nil}
+		}
+		return map[string]interface{}{"value": sum / float64(count)}
+	default:
+		if best == nil {
+			return map[string]interface{}{"value": nil, "keys": []interface{}{}}
+		}
+		return map[string]interface{}{"value": *best, "keys": keys}
+	}
+}
+
+// pipelineBucketValue 按 buckets_path 从桶中取数值，缺失时按 gap_policy 处理
+func (h *DocumentHandler) pipelineBucketValue(bucket map[string]interface{}, path, gapPolicy string) (float64, bool) {
+	if value := h.resolveBucketsPath(bucket, path); value != nil {
+		return *value, true
+	}
+	if gapPolicy == gapPolicyInsertZeros {
+		return 0, true
+	}
+	return 0, false
+}
+
+// resolveBucketsPath 解析相对于桶的 buckets_path
+func (h *DocumentHandler) resolveBucketsPath(bucket map[string]interface{}, path string) *float64 {
+	current := bucket
+	elements := strings.Split(path, ">")
+	for _, element := range elements[:len(elements)-1] {
+		next, ok := bucketSubAggregation(current, element).(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+
+	last := elements[len(elements)-1]
+	switch last {
+	case "_count":
+		return h.extractNumericValueFromInterface(current["doc_count"])
+	case "_key":
+		return h.extractNumericValueFromInterface(current["key"])
+	}
+	aggName, metric := last, "value"
+	if i := strings.Index(last, "."); i >= 0 {
+		aggName, metric = last[:i], last[i+1:]
+	}
+	result, ok := bucketSubAggregation(current, aggName).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if metric == "_count" {
+		return h.extractNumericValueFromInterface(result["doc_count"])
+	}
+	return h.extractNumericValueFromInterface(result[metric])
+}
+
+// bucketSubAggregation 返回桶中名为 name 的子聚合结果
+func bucketSubAggregation(bucket map[string]interface{}, name string) interface{} {
+	if subAggs, ok := bucket["aggregations"].(map[string]interface{}); ok {
+		if v, ok := subAggs[name]; ok {
+			return v
+		}
+	}
+	return bucket[name]
+}
+
+// bucketSubAggregations 返回桶的子聚合结果，create 为 true 时在缺失时创建
+func bucketSubAggregations(bucket map[string]interface{}, create bool) map[string]interface{} {
+	subAggs, ok := bucket["aggregations"].(map[string]interface{})
+	if !ok && create {
+		subAggs = make(map[string]interface{})
+		bucket["aggregations"] = subAggs
+	}
+	return subAggs
+}
+
+// setPipelineValue 将父管道聚合的结果写入桶的子聚合结果
+func setPipelineValue(bucket map[string]interface{}, name string, value float64) {
+	bucketSubAggregations(bucket, true)[name] = map[string]interface{}{"value": value}
+}
+
+// aggregationBuckets 返回多桶聚合结果的桶列表
+func aggregationBuckets(result map[string]interface{}) ([]map[string]interface{}, bool) {
+	switch buckets := result["buckets"].(type) {
+	case []map[string]interface{}:
+		return buckets, true
+	case []interface{}:
+		out := make([]map[string]interface{}, 0, len(buckets))
+		for _, b := range buckets {
+			if bucket, ok := b.(map[string]interface{}); ok {
+				out = append(out, bucket)
+			}
+		}
+		return out, true
+	}
+	return nil, false
+}
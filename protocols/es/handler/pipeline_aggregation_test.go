@@ -0,0 +1,128 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_PipelineAggregations(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/metrics", `{"mappings":{"properties":{"ts":{"type":"long"},"bytes":{"type":"long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	// 三个时间段的计数器样本：[0,10) 共 100，[10,20) 共 250，[20,30) 共 600
+	samples := []struct{ ts, bytes int }{{1, 40}, {2, 60}, {11, 100}, {12, 150}, {21, 200}, {22, 200}, {23, 200}}
+	for i, s := range samples {
+		body := fmt.Sprintf(`{"ts":%d,"bytes":%d}`, s.ts, s.bytes)
+		if w := do("PUT", fmt.Sprintf("/metrics/_doc/%d?refresh=true", i), body); w.Code >= 300 {
+			t.Fatalf("index %d: got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("POST", "/metrics/_search", `{"size":0,"aggs":{
+		"periods":{"range":{"field":"ts","ranges":[{"key":"p1","from":0,"to":10},{"key":"p2","from":10,"to":20},{"key":"p3","from":20,"to":30}]},
+			"aggs":{
+				"total":{"sum":{"field":"bytes"}},
+				"rate":{"derivative":{"buckets_path":"total"}},
+				"running":{"cumulative_sum":{"buckets_path":"total"}},
+				"per_doc":{"bucket_script":{"buckets_path":{"t":"total","c":"_count"},"script":"params.t / params.c"}},
+				"big":{"bucket_selector":{"buckets_path":{"t":"total"},"script":"params.t > 150"}}
+			}},
+		"avg_total":{"avg_bucket":{"buckets_path":"periods>total"}},
+		"max_total":{"max_bucket":{"buckets_path":"periods>total"}}
+	}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+	}
+
+	type value struct {
+		Value *float64 `json:"value"`
+	}
+	var resp struct {
+		Aggregations struct {
+			Periods struct {
+				Buckets []struct {
+					Key          string `json:"key"`
+					Aggregations struct {
+						Total   value  `json:"total"`
+						Rate    *value `json:"rate"`
+						Running value  `json:"running"`
+						PerDoc  value  `json:"per_doc"`
+					} `json:"aggregations"`
+				} `json:"buckets"`
+			} `json:"periods"`
+			AvgTotal value `json:"avg_total"`
+			MaxTotal struct {
+				Value *float64 `json:"value"`
+				Keys  []string `json:"keys"`
+			} `json:"max_total"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	buckets := resp.Aggregations.Periods.Buckets
+	byKey := make(map[string]int, len(buckets))
+	for i, b := range buckets {
+		byKey[b.Key] = i
+	}
+	// bucket_selector 移除 total <= 150 的桶
+	if _, ok := byKey["p1"]; ok || len(buckets) != 2 {
+		t.Fatalf("expected bucket_selector to keep [p2 p3], got %s", w.Body.String())
+	}
+	p2, p3 := buckets[byKey["p2"]].Aggregations, buckets[byKey["p3"]].Aggregations
+	if *p2.Rate.Value != 150 || *p3.Rate.Value != 350 {
+		t.Fatalf("derivative: expected [150 350], got %s", w.Body.String())
+	}
+	if *p2.Running.Value != 350 || *p3.Running.Value != 950 {
+		t.Fatalf("cumulative_sum: expected [350 950], got %s", w.Body.String())
+	}
+	if *p2.PerDoc.Value != 125 || *p3.PerDoc.Value != 200 {
+		t.Fatalf("bucket_script: expected [125 200], got %s", w.Body.String())
+	}
+
+	// 兄弟管道聚合作用于 bucket_selector 过滤后的桶
+	if v := resp.Aggregations.AvgTotal.Value; v == nil || *v != 425 {
+		t.Fatalf("avg_bucket: expected 425, got %s", w.Body.String())
+	}
+	if v := resp.Aggregations.MaxTotal; v.Value == nil || *v.Value != 600 || len(v.Keys) != 1 || v.Keys[0] != "p3" {
+		t.Fatalf("max_bucket: expected 600 [p3], got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// range / date_range 聚合的桶键、边界格式和 keyed 响应
+
+// defaultDateOutputLayout strict_date_optional_time 的输出格式（UTC，毫秒精度）
+const defaultDateOutputLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// numericRangeKey 与 ES 相同，未指定 key 时桶键为 "from-to"，缺少的边界用 "*" 表示
+func numericRangeKey(min, max *float64) string {
+	return rangeBoundString(min) + "-" + rangeBoundString(max)
+}
+
+// rangeBoundString 按 Java Double.toString 的习惯格式化边界（整数值保留 ".0"）
+func rangeBoundString(v *float64) string {
+	if v == nil {
+		return "*"
+	}
+	s := strconv.FormatFloat(*v, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// dateRangeKey 未指定 key 时的日期桶键，边界按 format 在时区 loc 中格式化
+func dateRangeKey(start, end time.Time, format string, loc *time.Location) string {
+	from, to := "*", "*"
+	if !start.IsZero() {
+		from = formatDateValueIn(start, format, loc)
+	}
+	if !end.IsZero() {
+		to = formatDateValueIn(end, format, loc)
+	}
+	return from + "-" + to
+}
+
+// formatDateValue 按 ES 日期格式输出 UTC 时间，多个格式（"||" 分隔）时使用第一个
+func formatDateValue(t time.Time, format string) string {
+	return formatDateValueIn(t, format, time.UTC)
+}
+
+// formatDateValueIn 同 formatDateValue，时间按时区 loc 输出（默认格式带时区偏移）
+func formatDateValueIn(t time.Time, format string, loc *time.Location) string {
+	format = strings.TrimSpace(strings.SplitN(format, "||", 2)[0])
+	t = t.In(loc)
+	switch format {
+	case "", "strict_date_optional_time", "date_optional_time", "strict_date_time", "date_time":
+		return t.Format(defaultDateOutputLayout)
+	case "epoch_millis":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case "epoch_second":
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.Format(esDateFormatToLayout(format))
+}
+
+// parseDateRangeBound 解析 date_range 的 from/to：数值为毫秒时间戳，字符串按 format 解析并支持日期数学表达式
+// （"now-1d/d"、"2024-01-01||+1M"）
+func parseDateRangeBound(value interface{}, format string, now time.Time) (time.Time, error) {
+	return parseDateMathBound(value, format, time.UTC, now, false)
+}
+
+// parseDateMathBound 同 parseDateRangeBound，不带时区的日期字符串与 now 的取整按时区 loc 计算（time_zone 参数），
+// roundUp 为 true 时 "/" 取整到该单位的最后一毫秒（range 查询的 gt/lte 边界，如 "lte": "now/d" 包含当天的全部时间）
+func parseDateMathBound(value interface{}, format string, loc *time.Location, now time.Time, roundUp bool) (time.Time, error) {
+	switch v := value.(type) {
+	case float64:
+		return time.UnixMilli(int64(v)).UTC(), nil
+	case string:
+		anchor, mathExpr := v, ""
+		if strings.HasPrefix(v, "now") {
+			anchor, mathExpr = "", v[len("now"):]
+		} else if i := strings.Index(v, "||"); i >= 0 {
+			anchor, mathExpr = v[:i], v[i+2:]
+		}
+		t := now.In(loc)
+		if anchor != "" {
+			parsed, err := parseDateStringIn(anchor, format, loc)
+			if err != nil {
+				return time.Time{}, err
+			}
+			t = parsed.In(loc)
+		}
+		t, err := applyDateMath(t, mathExpr, roundUp)
+		return t.UTC(), err
+	}
+	return time.Time{}, fmt.Errorf("unsupported date value [%v]", value)
+}
+
+// parseDateString 依次尝试 format 中的格式，都不匹配时使用默认的日期格式
+func parseDateString(s, format string) (time.Time, error) {
+	return parseDateStringIn(s, format, time.UTC)
+}
+
+// parseDateStringIn 同 parseDateString，不带时区的日期按时区 loc 解析
+func parseDateStringIn(s, format string, loc *time.Location) (time.Time, error) {
+	if format != "" {
+		for _, part := range strings.Split(format, "||") {
+			switch part = strings.TrimSpace(part); part {
+			case "epoch_millis":
+				if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+					return time.UnixMilli(ms).UTC(), nil
+				}
+			case "epoch_second":
+				if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+					return time.Unix(sec, 0).UTC(), nil
+				}
+			default:
+				if t, err := time.ParseInLocation(esDateFormatToLayout(part), s, loc); err == nil {
+					return t.UTC(), nil
+				}
+			}
+		}
+	}
+	for _, layout := range defaultDynamicDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("failed to parse date [%s] with format [%s]", s, format)
+}
+
+// applyDateMath 计算日期数学表达式，如 "+1d"、"-1M/M"（"/" 向下取整到该单位，roundUp 时取整到该单位的最后一毫秒）
+func applyDateMath(t time.Time, expr string, roundUp bool) (time.Time, error) {
+	for i := 0; i < len(expr); {
+		op := expr[i]
+		i++
+		if op == '/' {
+			if i >= len(expr) {
+				return t, fmt.Errorf("missing rounding unit in date math [%s]", expr)
+			}
+			rounded, err := roundDateDown(t, expr[i])
+			if err != nil {
+				return t, err
+			}
+			if roundUp {
+				rounded = addDateUnit(rounded, 1, expr[i]).Add(-time.Millisecond)
+			}
+			t = rounded
+			i++
+			continue
+		}
+		if op != '+' && op != '-' {
+			return t, fmt.Errorf("unexpected [%c] in date math [%s]", op, expr)
+		}
+		start := i
+		for i < len(expr) && expr[i] >= '0' && expr[i] <= '9' {
+			i++
+		}
+		n := 1
+		if i > start {
+			n, _ = strconv.Atoi(expr[start:i])
+		}
+		if i >= len(expr) {
+			return t, fmt.Errorf("missing unit in date math [%s]", expr)
+		}
+		if op == '-' {
+			n = -n
+		}
+		if !strings.ContainsRune("yMwdhHms", rune(expr[i])) {
+			return t, fmt.Errorf("unknown unit [%c] in date math [%s]", expr[i], expr)
+		}
+		t = addDateUnit(t, n, expr[i])
+		i++
+	}
+	return t, nil
+}
+
+// addDateUnit 将时间加上 n 个指定单位（unit 已校验）
+func addDateUnit(t time.Time, n int, unit byte) time.Time {
+	switch unit {
+	case 'y':
+		return t.AddDate(n, 0, 0)
+	case 'M':
+		return t.AddDate(0, n, 0)
+	case 'w':
+		return t.AddDate(0, 0, 7*n)
+	case 'd':
+		return t.AddDate(0, 0, n)
+	case 'h', 'H':
+		return t.Add(time.Duration(n) * time.Hour)
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute)
+	}
+	return t.Add(time.Duration(n) * time.Second)
+}
+
+// roundDateDown 将时间向下取整到指定单位（周从周一开始）
+func roundDateDown(t time.Time, unit byte) (time.Time, error) {
+	switch unit {
+	case 'y':
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location()), nil
+	case 'M':
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()), nil
+	case 'w':
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7), nil
+	case 'd':
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), nil
+	case 'h', 'H':
+		return t.Truncate(time.Hour), nil
+	case 'm':
+		return t.Truncate(time.Minute), nil
+	case 's':
+		return t.Truncate(time.Second), nil
+	}
+	return t, fmt.Errorf("unknown rounding unit [%c]", unit)
+}
+
+// setDateRangeBucketBound 写入日期桶的边界：毫秒时间戳和默认格式的字符串
+func setDateRangeBucketBound(bucket map[string]interface{}, name string, bound *string) {
+	if bound == nil {
+		return
+	}
+	t, err := time.Parse(time.RFC3339Nano, *bound)
+	if err != nil {
+		return
+	}
+	bucket[name] = float64(t.UnixMilli())
+	bucket[name+"_as_string"] = formatDateValue(t, "")
+}
+
+// applyRangeOutputOptions 按聚合配置调整 range/date_range 的响应（递归处理子聚合）：
+// date_range 的 format 与 time_zone 用于 from_as_string/to_as_string，keyed 时桶以对象形式按桶键返回
+// 在管道聚合之后执行，管道聚合依赖桶列表
+func (h *DocumentHandler) applyRangeOutputOptions(specs map[string]map[string]interface{}, results map[string]interface{}) {
+	if len(specs) == 0 || results == nil {
+		return
+	}
+	for name, spec := range specs {
+		aggConfig, err := h.parseSingleAggregation(name, spec)
+		if err != nil {
+			continue
+		}
+		result, ok := results[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		buckets, multiBucket := aggregationBuckets(result)
+		if len(aggConfig.SubAggregations) > 0 {
+			if multiBucket {
+				for _, bucket := range buckets {
+					h.applyRangeOutputOptions(aggConfig.SubAggregations, bucketSubAggregations(bucket, false))
+				}
+			} else {
+				h.applyRangeOutputOptions(aggConfig.SubAggregations, bucketSubAggregations(result, false))
+			}
+		}
+		if aggConfig.Type != "range" && aggConfig.Type != "date_range" {
+			continue
+		}
+
+		format, _ := aggConfig.Config["format"].(string)
+		zone, _ := aggConfig.Config["time_zone"].(string)
+		if (format != "" || zone != "") && aggConfig.Type == "date_range" {
+			loc, err := parseTimeZone(zone)
+			if err != nil {
+				loc = time.UTC
+			}
+			for _, bucket := range buckets {
+				for _, bound := range []string{"from", "to"} {
+					if ms, ok := bucket[bound].(float64); ok {
+						bucket[bound+"_as_string"] = formatDateValueIn(time.UnixMilli(int64(ms)), format, loc)
+					}
+				}
+			}
+		}
+		if keyed, _ := aggConfig.Config["keyed"].(bool); keyed && multiBucket {
+			keyedBuckets := make(map[string]interface{}, len(buckets))
+			for _, bucket := range buckets {
+				key := fmt.Sprint(bucket["key"])
+				delete(bucket, "key")
+				keyedBuckets[key] = bucket
+			}
+			result["buckets"] = keyedBuckets
+		}
+	}
+}
+
+// parseTimeZone 解析 time_zone 参数：空为 UTC，支持 +08:00 形式的偏移与 IANA 时区名
+func parseTimeZone(zone string) (*time.Location, error) {
+	if zone == "" || zone == "Z" || zone == "UTC" {
+		return time.UTC, nil
+	}
+	if zone[0] == '+' || zone[0] == '-' {
+		offset, err := time.Parse("-07:00", zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone offset [%s]", zone)
+		}
+		_, seconds := offset.Zone()
+		return time.FixedZone(zone, seconds), nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone [%s]", zone)
+	}
+	return loc, nil
+}
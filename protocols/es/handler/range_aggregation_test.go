@@ -0,0 +1,327 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_RangeAggregationKeysAndFormats(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/sales", `{"mappings":{"properties":{"price":{"type":"double"},"date":{"type":"date"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := []string{
+		`{"price":10,"date":"2024-01-15T00:00:00Z"}`,
+		`{"price":40,"date":"2024-02-10T00:00:00Z"}`,
+		`{"price":60,"date":"2024-02-20T00:00:00Z"}`,
+		`{"price":120,"date":"2024-03-05T00:00:00Z"}`,
+	}
+	for i, doc := range docs {
+		if w := do("PUT", fmt.Sprintf("/sales/_doc/%d?refresh=true", i), doc); w.Code >= 300 {
+			t.Fatalf("index %d: got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("POST", "/sales/_search", `{"size":0,"aggs":{
+		"prices":{"range":{"field":"price","ranges":[{"to":50},{"from":50,"to":100.5},{"from":100.5}]}},
+		"prices_keyed":{"range":{"field":"price","keyed":true,"ranges":[{"key":"cheap","to":50},{"key":"expensive","from":50}]}},
+		"months":{"date_range":{"field":"date","format":"yyyy-MM-dd","ranges":[{"to":"2024-02-01"},{"from":"2024-02-01","to":"2024-02-01||+1M"},{"from":"2024-03-01"}]}},
+		"months_keyed":{"date_range":{"field":"date","keyed":true,"ranges":[{"to":"2024-02-01T00:00:00Z"},{"from":"2024-02-01T00:00:00Z"}]}}
+	}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Aggregations struct {
+			Prices struct {
+				Buckets []map[string]interface{} `json:"buckets"`
+			} `json:"prices"`
+			PricesKeyed struct {
+				Buckets map[string]map[string]interface{} `json:"buckets"`
+			} `json:"prices_keyed"`
+			Months struct {
+				Buckets []map[string]interface{} `json:"buckets"`
+			} `json:"months"`
+			MonthsKeyed struct {
+				Buckets map[string]map[string]interface{} `json:"buckets"`
+			} `json:"months_keyed"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	aggs := resp.Aggregations
+
+	// 未指定 key 的数值范围：桶键为 "from-to"，无界的一侧没有 from/to
+	expectedPrices := []struct {
+		key      string
+		docCount float64
+		hasFrom  bool
+		hasTo    bool
+	}{{"*-50.0", 2, false, true}, {"50.0-100.5", 1, true, true}, {"100.5-*", 1, true, false}}
+	if len(aggs.Prices.Buckets) != len(expectedPrices) {
+		t.Fatalf("range: expected %d buckets, got %v", len(expectedPrices), aggs.Prices.Buckets)
+	}
+	for i, e := range expectedPrices {
+		b := aggs.Prices.Buckets[i]
+		_, hasFrom := b["from"]
+		_, hasTo := b["to"]
+		if b["key"] != e.key || b["doc_count"] != e.docCount || hasFrom != e.hasFrom || hasTo != e.hasTo {
+			t.Errorf("range bucket %d: expected %+v, got %v", i, e, b)
+		}
+	}
+
+	if len(aggs.PricesKeyed.Buckets) != 2 || aggs.PricesKeyed.Buckets["cheap"]["doc_count"] != 2.0 || aggs.PricesKeyed.Buckets["expensive"]["doc_count"] != 2.0 {
+		t.Errorf("keyed range: unexpected buckets %v", aggs.PricesKeyed.Buckets)
+	}
+	if _, hasKey := aggs.PricesKeyed.Buckets["cheap"]["key"]; hasKey {
+		t.Errorf("keyed range: bucket should not contain key, got %v", aggs.PricesKeyed.Buckets["cheap"])
+	}
+
+	// format 同时用于解析边界、生成桶键和 from_as_string/to_as_string，from/to 为毫秒时间戳
+	feb := float64(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).UnixMilli())
+	expectedMonths := []struct {
+		key          string
+		docCount     float64
+		fromAsString interface{}
+		toAsString   interface{}
+	}{
+		{"*-2024-02-01", 1, nil, "2024-02-01"},
+		{"2024-02-01-2024-03-01", 2, "2024-02-01", "2024-03-01"},
+		{"2024-03-01-*", 1, "2024-03-01", nil},
+	}
+	if len(aggs.Months.Buckets) != len(expectedMonths) {
+		t.Fatalf("date_range: expected %d buckets, got %v", len(expectedMonths), aggs.Months.Buckets)
+	}
+	for i, e := range expectedMonths {
+		b := aggs.Months.Buckets[i]
+		if b["key"] != e.key || b["doc_count"] != e.docCount || b["from_as_string"] != e.fromAsString || b["to_as_string"] != e.toAsString {
+			t.Errorf("date_range bucket %d: expected %+v, got %v", i, e, b)
+		}
+	}
+	if aggs.Months.Buckets[1]["from"] != feb {
+		t.Errorf("date_range: expected from %v, got %v", feb, aggs.Months.Buckets[1]["from"])
+	}
+
+	later, ok := aggs.MonthsKeyed.Buckets["2024-02-01T00:00:00.000Z-*"]
+	if !ok || later["doc_count"] != 3.0 || later["from_as_string"] != "2024-02-01T00:00:00.000Z" {
+		t.Errorf("keyed date_range: unexpected buckets %v", aggs.MonthsKeyed.Buckets)
+	}
+}
+
+func TestApplyDateMath(t *testing.T) {
+	base := time.Date(2024, 3, 13, 15, 30, 45, 0, time.UTC) // 周三
+	tests := []struct {
+		expr     string
+		roundUp  bool
+		expected time.Time
+	}{
+		{"", false, base},
+		{"+1d", false, base.AddDate(0, 0, 1)},
+		{"-2M/M", false, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"/w", false, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"-1h/d", false, time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"+1y-1s", false, base.AddDate(1, 0, 0).Add(-time.Second)},
+		// 取整到该单位的最后一毫秒
+		{"/d", true, time.Date(2024, 3, 13, 23, 59, 59, 999000000, time.UTC)},
+		{"-1M/M", true, time.Date(2024, 2, 29, 23, 59, 59, 999000000, time.UTC)},
+		{"/w", true, time.Date(2024, 3, 17, 23, 59, 59, 999000000, time.UTC)},
+		{"+1h", true, base.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		got, err := applyDateMath(base, tt.expr, tt.roundUp)
+		if err != nil {
+			t.Errorf("applyDateMath(%q, %v): unexpected error %v", tt.expr, tt.roundUp, err)
+			continue
+		}
+		if !got.Equal(tt.expected) {
+			t.Errorf("applyDateMath(%q, %v): expected %v, got %v", tt.expr, tt.roundUp, tt.expected, got)
+		}
+	}
+	if _, err := applyDateMath(base, "+1x", false); err == nil {
+		t.Error("applyDateMath(\"+1x\"): expected error for unknown unit")
+	}
+}
+
+func TestDocumentHandler_DateTimeZone(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/events", `{"mappings":{"properties":{"date":{"type":"date"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	// UTC 的 1 月 1 日深夜与 1 月 2 日凌晨，在 +01:00 都属于 1 月 2 日，在 -05:00 都属于 1 月 1 日
+	docs := []string{
+		`{"date":"2024-01-01T23:30:00Z"}`,
+		`{"date":"2024-01-02T00:30:00Z"}`,
+		`{"date":"2024-01-02T12:00:00Z"}`,
+	}
+	for i, doc := range docs {
+		if w := do("PUT", fmt.Sprintf("/events/_doc/%d?refresh=true", i), doc); w.Code >= 300 {
+			t.Fatalf("index %d: got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	for _, tt := range []struct {
+		query    string
+		expected int
+	}{
+		{`{"range":{"date":{"gte":"2024-01-02","lt":"2024-01-03"}}}`, 2},
+		{`{"range":{"date":{"gte":"2024-01-02","lt":"2024-01-03","time_zone":"+01:00"}}}`, 3},
+		{`{"range":{"date":{"gte":"2024-01-01","lte":"2024-01-01||/d","time_zone":"-05:00"}}}`, 2},
+		{`{"range":{"date":{"gte":"2024-01-02T00:00:00","time_zone":"Asia/Shanghai"}}}`, 3},
+		// 带时区的日期字符串与毫秒时间戳不受 time_zone 影响
+		{`{"range":{"date":{"gte":"2024-01-02T00:00:00Z","time_zone":"+01:00"}}}`, 2},
+		{`{"range":{"date":{"gte":1704153600000,"time_zone":"+01:00"}}}`, 2},
+	} {
+		w := do("POST", "/events/_count", `{"query":`+tt.query+`}`)
+		var resp struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", tt.query, w.Code, w.Body.String())
+		}
+		if resp.Count != tt.expected {
+			t.Errorf("%s: expected %d documents, got %d", tt.query, tt.expected, resp.Count)
+		}
+	}
+	if w := do("POST", "/events/_search", `{"query":{"range":{"date":{"gte":"2024-01-02","time_zone":"Mars/Olympus"}}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown time zone: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do("POST", "/events/_search", `{"size":0,"aggs":{"days":{"date_range":{"field":"date","time_zone":"-05:00","format":"yyyy-MM-dd",
+		"ranges":[{"from":"2024-01-01","to":"2024-01-02"},{"from":"2024-01-02"}]}}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Aggregations struct {
+			Days struct {
+				Buckets []map[string]interface{} `json:"buckets"`
+			} `json:"days"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	buckets := resp.Aggregations.Days.Buckets
+	if len(buckets) != 2 {
+		t.Fatalf("date_range: expected 2 buckets, got %v", buckets)
+	}
+	// 桶边界为 -05:00 的零点，桶键与 from_as_string 按该时区格式化
+	jan1 := float64(time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC).UnixMilli())
+	if b := buckets[0]; b["key"] != "2024-01-01-2024-01-02" || b["from"] != jan1 || b["from_as_string"] != "2024-01-01" || b["doc_count"] != 2.0 {
+		t.Errorf("date_range bucket 0: unexpected %v", b)
+	}
+	if b := buckets[1]; b["doc_count"] != 1.0 || b["from_as_string"] != "2024-01-02" {
+		t.Errorf("date_range bucket 1: unexpected %v", b)
+	}
+
+	// 未指定 format 时按默认格式输出带时区偏移的时间
+	w = do("POST", "/events/_search", `{"size":0,"aggs":{"days":{"date_range":{"field":"date","time_zone":"+08:00",
+		"ranges":[{"from":"2024-01-02T00:00:00"}]}}}}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"from_as_string":"2024-01-02T00:00:00.000+08:00"`) {
+		t.Errorf("date_range default format: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// date_histogram 的日历桶从 time_zone 的本地零点开始
+	var histResp struct {
+		Aggregations struct {
+			Days struct {
+				Buckets []struct {
+					Key         int64  `json:"key"`
+					KeyAsString string `json:"key_as_string"`
+					DocCount    int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"days"`
+		} `json:"aggregations"`
+	}
+	for _, tt := range []struct {
+		agg      string
+		expected []string
+		counts   []int
+	}{
+		{`{"field":"date","calendar_interval":"day","format":"yyyy-MM-dd"}`, []string{"2024-01-01", "2024-01-02"}, []int{1, 2}},
+		{`{"field":"date","calendar_interval":"1d","time_zone":"+01:00","format":"yyyy-MM-dd"}`, []string{"2024-01-02"}, []int{3}},
+		{`{"field":"date","calendar_interval":"1d","time_zone":"-05:00","format":"yyyy-MM-dd"}`, []string{"2024-01-01", "2024-01-02"}, []int{2, 1}},
+		// 固定间隔同样按时区偏移对齐；min_doc_count 为 0 时补齐中间的空桶
+		{`{"field":"date","fixed_interval":"6h","time_zone":"+08:00","format":"HH:mm"}`, []string{"06:00", "12:00", "18:00"}, []int{2, 0, 1}},
+		{`{"field":"date","fixed_interval":"6h","min_doc_count":1,"format":"HH:mm"}`, []string{"18:00", "00:00", "12:00"}, []int{1, 1, 1}},
+		{`{"field":"date","calendar_interval":"1d","offset":"+1h","format":"yyyy-MM-dd HH:mm"}`, []string{"2024-01-01 01:00", "2024-01-02 01:00"}, []int{2, 1}},
+	} {
+		w := do("POST", "/events/_search", `{"size":0,"aggs":{"days":{"date_histogram":`+tt.agg+`}}}`)
+		if err := json.Unmarshal(w.Body.Bytes(), &histResp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("date_histogram %s: got %d: %s", tt.agg, w.Code, w.Body.String())
+		}
+		var keys []string
+		var counts []int
+		for _, b := range histResp.Aggregations.Days.Buckets {
+			keys = append(keys, b.KeyAsString)
+			counts = append(counts, b.DocCount)
+		}
+		if fmt.Sprint(keys) != fmt.Sprint(tt.expected) || fmt.Sprint(counts) != fmt.Sprint(tt.counts) {
+			t.Errorf("date_histogram %s: expected %v %v, got %v %v", tt.agg, tt.expected, tt.counts, keys, counts)
+		}
+	}
+	// 桶键为本地零点对应的毫秒时间戳
+	w = do("POST", "/events/_search", `{"size":0,"aggs":{"days":{"date_histogram":{"field":"date","calendar_interval":"1d","time_zone":"Asia/Shanghai"}}}}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &histResp); err != nil || len(histResp.Aggregations.Days.Buckets) != 1 {
+		t.Fatalf("date_histogram Asia/Shanghai: got %d: %s", w.Code, w.Body.String())
+	}
+	if b := histResp.Aggregations.Days.Buckets[0]; b.Key != time.Date(2024, 1, 1, 16, 0, 0, 0, time.UTC).UnixMilli() || b.KeyAsString != "2024-01-02T00:00:00.000+08:00" {
+		t.Errorf("date_histogram Asia/Shanghai: unexpected bucket %+v", b)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// maxRareTermsDocCount 与 ES 相同，max_doc_count 最大为 100
+const maxRareTermsDocCount = 100
+
+// RareTermsAggregationInfo rare_terms聚合信息
+type RareTermsAggregationInfo struct {
+	Aggregations map[string]*RareTermsAggregationConfig
+}
+
+// RareTermsAggregationConfig rare_terms聚合配置
+// ES格式: {"rare_terms": {"field": "user_agent", "max_doc_count": 1}}
+type RareTermsAggregationConfig struct {
+	Field           string
+	MaxDocCount     int                               // 桶的最大文档数（默认1）
+	SubAggregations map[string]map[string]interface{} // 子聚合配置
+}
+
+// parseRareTermsAggregation 解析rare_terms聚合
+func (h *DocumentHandler) parseRareTermsAggregation(config map[string]interface{}, subAggs map[string]map[string]interface{}) (*RareTermsAggregationConfig, error) {
+	field, ok := config["field"].(string)
+	if !ok || field == "" {
+		return nil, fmt.Errorf("rare_terms aggregation requires a 'field' parameter")
+	}
+	rtConfig := &RareTermsAggregationConfig{
+		Field:           field,
+		MaxDocCount:     1,
+		SubAggregations: subAggs,
+	}
+	if v, ok := config["max_doc_count"]; ok {
+		maxDocCount, ok := v.(float64)
+		if !ok || maxDocCount < 1 || maxDocCount > maxRareTermsDocCount {
+			return nil, fmt.Errorf("[max_doc_count] must be between 1 and %d, got [%v]", maxRareTermsDocCount, v)
+		}
+		rtConfig.MaxDocCount = int(maxDocCount)
+	}
+	return rtConfig, nil
+}
+
+// buildRareTermsAggregations 构建rare_terms聚合响应
+func (h *DocumentHandler) buildRareTermsAggregations(ctx context.Context, info *RareTermsAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+	aggs := make(map[string]interface{}, len(info.Aggregations))
+	var mu sync.Mutex
+	tasks := make([]func(), 0, len(info.Aggregations))
+	for aggName, rtAgg := range info.Aggregations {
+		tasks = append(tasks, func() {
+			result, err := h.buildRareTermsAggregation(ctx, aggName, rtAgg, idx, baseQuery)
+			if err != nil {
+				logger.Warn("Failed to build rare_terms aggregation [%s]: %v", aggName, err)
+				result = map[string]interface{}{"buckets": []interface{}{}}
+			}
+			mu.Lock()
+			aggs[aggName] = result
+			mu.Unlock()
+		})
+	}
+	aggPool.run(tasks)
+
+	return aggs
+}
+
+// buildRareTermsAggregation 构建单个rare_terms聚合响应
+// 统计字段的全部词项（不截断），返回文档数不超过 max_doc_count 的词项，按文档数升序、词项升序排列
+func (h *DocumentHandler) buildRareTermsAggregation(ctx context.Context, aggName string, rtAgg *RareTermsAggregationConfig, idx bleve.Index, baseQuery query.Query) (map[string]interface{}, error) {
+	req := bleve.NewSearchRequest(baseQuery)
+	req.Size = 0
+	req.AddFacet(rtAgg.Field, bleve.NewFacetRequest(rtAgg.Field, math.MaxInt32))
+	result, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	dict := h.facetTermsDictionary(idx, rtAgg.Field)
+	buckets := make([]map[string]interface{}, 0)
+	if facet, ok := result.Facets[rtAgg.Field]; ok {
+		for _, term := range facet.Terms.Terms() {
+			if term.Count > rtAgg.MaxDocCount {
+				continue
+			}
+			key, cached := dict.Lookup(term.Term)
+			if !cached {
+				key = h.decodeFacetTerm(idx, rtAgg.Field, term.Term)
+			}
+			// 空字符串是 shift>0 的 PrefixCoded 词项
+			if keyStr, ok := key.(string); ok && keyStr == "" {
+				continue
+			}
+			buckets = append(buckets, map[string]interface{}{
+				"key":       key,
+				"doc_count": term.Count,
+			})
+		}
+	}
+	// facet 结果按文档数降序、词项升序排列，反转文档数顺序并保持词项升序
+	sort.SliceStable(buckets, func(i, j int) bool {
+		return buckets[i]["doc_count"].(int) < buckets[j]["doc_count"].(int)
+	})
+
+	if len(rtAgg.SubAggregations) > 0 {
+		bucketTasks := make([]func(), 0, len(buckets))
+		for _, bucket := range buckets {
+			bucketQuery := query.NewBooleanQuery([]query.Query{baseQuery, h.buildTermQueryForBucket(rtAgg.Field, bucket["key"])}, nil, nil)
+			bucketTasks = append(bucketTasks, func() {
+				if subAggResults := h.buildNestedAggregationsForBucket(ctx, aggName, bucket["key"], rtAgg.SubAggregations, idx, bucketQuery); len(subAggResults) > 0 {
+					bucket["aggregations"] = subAggResults
+				}
+			})
+		}
+		aggPool.run(bucketTasks)
+	}
+
+	return map[string]interface{}{"buckets": buckets}, nil
+}
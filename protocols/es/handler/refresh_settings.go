@@ -0,0 +1,138 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+)
+
+// 刷新间隔与写入模式（index.refresh_interval、index.ingest_mode），均可通过 _settings 动态修改
+// refresh_interval: -1 关闭自动刷新：搜索只看到最近一次 _refresh（或写请求的 refresh=true）时的快照，
+// get 等按 ID 读取仍然是实时的；正数间隔由 IndexManager 的刷新调度器按间隔刷新搜索视图，
+// refresh=wait_for 的写请求等待下一次调度刷新；未设置（或为 0）时每个批次引入后即对搜索可见。
+// ingest_mode: true 用于初次批量导入：关闭自动刷新，persister 攒更多内存段后再合并落盘，后台合并暂停（forcemerge 仍执行），
+// 导入完成后关闭 ingest_mode 即恢复刷新与合并。
+
+// 设置项路径（不含 "index." 前缀）
+const (
+	refreshIntervalSetting = "refresh_interval"
+	ingestModeSetting      = "ingest_mode"
+)
+
+// defaultRefreshInterval include_defaults 中展示的 refresh_interval 默认值
+// 未设置 refresh_interval 的索引不启动调度器，写入在批次引入后即可见，不晚于默认的刷新间隔
+const defaultRefreshInterval = time.Second
+
+// searchRefreshController 支持关闭自动刷新与写入模式的底层索引（scorch）
+type searchRefreshController interface {
+	SetAutoRefresh(enabled bool)
+	SetIngestMode(enabled bool)
+}
+
+// parseRefreshInterval 解析 refresh_interval，-1 表示关闭自动刷新，0 表示每个批次引入后即可见
+func parseRefreshInterval(v interface{}) (time.Duration, error) {
+	switch value := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if value == -1 {
+			return -1, nil
+		}
+	case int:
+		if value == -1 {
+			return -1, nil
+		}
+	case string:
+		value = strings.TrimSpace(value)
+		if value == "-1" {
+			return -1, nil
+		}
+		if value != "" {
+			if d, err := parseTimeValue(value); err == nil {
+				return d, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("failed to parse setting [index.%s] with value [%v] as a time value: unit is missing or unrecognized", refreshIntervalSetting, v)
+}
+
+// parseRefreshSettings 解析索引的刷新间隔与写入模式
+func parseRefreshSettings(settings map[string]interface{}) (time.Duration, bool, error) {
+	var interval time.Duration
+	if v, ok := lookupIndexSetting(settings, refreshIntervalSetting); ok && v != nil {
+		d, err := parseRefreshInterval(v)
+		if err != nil {
+			return 0, false, err
+		}
+		interval = d
+	}
+	ingest := false
+	if v, ok := lookupIndexSetting(settings, ingestModeSetting); ok && v != nil {
+		b, err := parseSettingBool(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("illegal value for setting [index.%s]: %s", ingestModeSetting, err.Error())
+		}
+		ingest = b
+	}
+	return interval, ingest, nil
+}
+
+// ConfigureIndex 使索引的 refresh_interval 与 ingest_mode 设置生效，作为 IndexManager 的配置回调，设置更新后再次调用
+func (h *IndexHandler) ConfigureIndex(indexName string, idx bleve.Index) {
+	if h.metaStore == nil {
+		return
+	}
+	meta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || meta == nil {
+		return
+	}
+	interval, ingest, err := parseRefreshSettings(meta.Settings)
+	if err != nil {
+		logger.Warn("Ignoring invalid refresh settings of index [%s]: %v", indexName, err)
+		return
+	}
+	advIdx, err := idx.Advanced()
+	if err != nil {
+		return
+	}
+	controller, ok := advIdx.(searchRefreshController)
+	if !ok {
+		return
+	}
+	scheduled := time.Duration(0)
+	if interval > 0 && !ingest {
+		scheduled = interval
+	}
+	controller.SetIngestMode(ingest)
+	controller.SetAutoRefresh(interval == 0 && !ingest)
+	if h.indexMgr != nil {
+		h.indexMgr.ScheduleRefresh(indexName, idx, scheduled)
+	}
+}
+
+// refreshStats 读取索引的刷新统计：关闭自动刷新后执行的刷新次数与等待下一次调度刷新的请求数
+func refreshStats(idx bleve.Index, listeners int64) map[string]interface{} {
+	indexStats, _ := idx.StatsMap()["index"].(map[string]interface{})
+	total, _ := indexStats["TotRefreshes"].(uint64)
+	return map[string]interface{}{
+		"total":     total,
+		"listeners": listeners,
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_RefreshSettings(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	indexMgr.SetConfigurer(indexHandler.ConfigureIndex)
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	statsHandler := NewStatsHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+		{Method: "GET", Path: "/{index}/_stats", Handler: statsHandler.GetIndexStats},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	next := 0
+	bulk := func(n int, query string) {
+		t.Helper()
+		var body strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&body, "{\"index\":{\"_index\":\"loading\",\"_id\":\"%d\"}}\n{\"n\":%d}\n", next, next)
+			next++
+		}
+		if w := do("POST", "/_bulk"+query, body.String()); w.Code != http.StatusOK {
+			t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	hits := func() int {
+		t.Helper()
+		w := do("POST", "/loading/_search", `{"size":0}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Hits struct {
+				Total struct {
+					Value int `json:"value"`
+				} `json:"total"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Hits.Total.Value
+	}
+
+	if w := do("PUT", "/loading", `{"settings":{"index":{"refresh_interval":"-1"}},"mappings":{"properties":{"n":{"type":"long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 关闭自动刷新后写入只在刷新后对搜索可见，get 仍然是实时的
+	bulk(3, "")
+	if n := hits(); n != 0 {
+		t.Errorf("expected no hits before refresh, got %d", n)
+	}
+	if w := do("GET", "/loading/_doc/1", ""); w.Code != http.StatusOK {
+		t.Errorf("get: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/loading/_refresh", ""); w.Code != http.StatusOK {
+		t.Fatalf("refresh: got %d: %s", w.Code, w.Body.String())
+	}
+	if n := hits(); n != 3 {
+		t.Errorf("expected 3 hits after refresh, got %d", n)
+	}
+	bulk(2, "?refresh=true")
+	if n := hits(); n != 5 {
+		t.Errorf("expected 5 hits after bulk with refresh, got %d", n)
+	}
+	if w := do("PUT", "/loading/_doc/extra?refresh=true", `{"n":100}`); w.Code != http.StatusCreated {
+		t.Fatalf("index: got %d: %s", w.Code, w.Body.String())
+	}
+	if n := hits(); n != 6 {
+		t.Errorf("expected 6 hits after index with refresh, got %d", n)
+	}
+
+	// 正数刷新间隔下写入在下一次调度刷新后可见，refresh=wait_for 等待下一次刷新
+	if w := do("PUT", "/loading/_settings", `{"index":{"refresh_interval":"30s"}}`); w.Code != http.StatusOK {
+		t.Fatalf("update refresh_interval: got %d: %s", w.Code, w.Body.String())
+	}
+	bulk(1, "")
+	if n := hits(); n != 6 {
+		t.Errorf("expected 6 hits before the scheduled refresh, got %d", n)
+	}
+	// 修改间隔时停止原调度器前刷新一次
+	if w := do("PUT", "/loading/_settings", `{"index":{"refresh_interval":"200ms"}}`); w.Code != http.StatusOK {
+		t.Fatalf("update refresh_interval: got %d: %s", w.Code, w.Body.String())
+	}
+	if n := hits(); n != 7 {
+		t.Errorf("expected 7 hits after changing the interval, got %d", n)
+	}
+	bulk(2, "?refresh=wait_for")
+	if n := hits(); n != 9 {
+		t.Errorf("expected 9 hits after bulk with wait_for, got %d", n)
+	}
+	w := do("PUT", "/loading/_doc/waited?refresh=wait_for", `{"n":101}`)
+	if w.Code != http.StatusCreated || strings.Contains(w.Body.String(), "forced_refresh") {
+		t.Fatalf("index with wait_for: got %d: %s", w.Code, w.Body.String())
+	}
+	if n := hits(); n != 10 {
+		t.Errorf("expected 10 hits after index with wait_for, got %d", n)
+	}
+
+	// 清除刷新间隔后写入立即可见
+	if w := do("PUT", "/loading/_settings", `{"index":{"refresh_interval":null}}`); w.Code != http.StatusOK {
+		t.Fatalf("reset refresh_interval: got %d: %s", w.Code, w.Body.String())
+	}
+	bulk(1, "")
+	if n := hits(); n != 11 {
+		t.Errorf("expected 11 hits with refresh enabled, got %d", n)
+	}
+	bulk(1, "?refresh=wait_for")
+	if n := hits(); n != 12 {
+		t.Errorf("expected 12 hits after bulk with wait_for, got %d", n)
+	}
+
+	// ingest_mode 关闭自动刷新，关闭 ingest_mode 后恢复
+	if w := do("PUT", "/loading/_settings", `{"index":{"ingest_mode":true}}`); w.Code != http.StatusOK {
+		t.Fatalf("enable ingest mode: got %d: %s", w.Code, w.Body.String())
+	}
+	bulk(4, "")
+	if n := hits(); n != 12 {
+		t.Errorf("expected 12 hits in ingest mode, got %d", n)
+	}
+	// 没有调度器时 wait_for 刷新冻结的搜索视图
+	bulk(1, "?refresh=wait_for")
+	if n := hits(); n != 17 {
+		t.Errorf("expected 17 hits after bulk with wait_for in ingest mode, got %d", n)
+	}
+	bulk(1, "")
+	if w := do("PUT", "/loading/_settings", `{"index":{"ingest_mode":null}}`); w.Code != http.StatusOK {
+		t.Fatalf("disable ingest mode: got %d: %s", w.Code, w.Body.String())
+	}
+	if n := hits(); n != 18 {
+		t.Errorf("expected 18 hits after ingest mode, got %d", n)
+	}
+
+	w = do("GET", "/loading/_stats", "")
+	var stats struct {
+		Indices map[string]struct {
+			Primaries struct {
+				Refresh struct {
+					Total int `json:"total"`
+				} `json:"refresh"`
+			} `json:"primaries"`
+		} `json:"indices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if n := stats.Indices["loading"].Primaries.Refresh.Total; n < 3 {
+		t.Errorf("expected at least 3 refreshes, got %d: %s", n, w.Body.String())
+	}
+
+	invalid := []struct {
+		settings string
+		message  string
+	}{
+		{`{"index":{"refresh_interval":"soon"}}`, "failed to parse setting [index.refresh_interval] with value [soon] as a time value"},
+		{`{"index":{"ingest_mode":"maybe"}}`, "illegal value for setting [index.ingest_mode]"},
+	}
+	for _, tt := range invalid {
+		if w := do("PUT", "/loading/_settings", tt.settings); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("update %s: expected 400 with %q, got %d: %s", tt.settings, tt.message, w.Code, w.Body.String())
+		}
+		if w := do("PUT", "/invalid_refresh", `{"settings":`+tt.settings+`}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("create %s: expected 400 with %q, got %d: %s", tt.settings, tt.message, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 结果窗口限制（index.max_result_window）
+// from + size 超过上限的深分页请求直接拒绝，提示改用 search_after 或 scroll；
+// scroll 请求只限制每批的 size。该设置可通过 _settings 动态修改，每次请求时读取。
+
+// defaultMaxResultWindow index.max_result_window 的默认值
+const defaultMaxResultWindow = 10000
+
+// maxResultWindowSetting 设置项路径（不含 "index." 前缀）
+const maxResultWindowSetting = "max_result_window"
+
+// parseMaxResultWindow 解析 max_result_window 设置值（必须是非负整数）
+func parseMaxResultWindow(value interface{}) (int, error) {
+	return parseIndexIntSetting(value, maxResultWindowSetting)
+}
+
+// parseIndexIntSetting 解析非负整数类型的索引设置值，setting 为不含 "index." 前缀的设置项路径
+func parseIndexIntSetting(value interface{}, setting string) (int, error) {
+	var n int64
+	switch v := value.(type) {
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, fmt.Errorf("failed to parse value [%v] for setting [index.%s]", v, setting)
+		}
+		n = int64(v)
+	case int:
+		n = int64(v)
+	case int64:
+		n = v
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse value [%s] for setting [index.%s]", v, setting)
+		}
+		n = parsed
+	default:
+		return 0, fmt.Errorf("failed to parse value [%v] for setting [index.%s]", v, setting)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("failed to parse value [%d] for setting [index.%s] must be >= 0", n, setting)
+	}
+	return int(n), nil
+}
+
+// indexMaxResultWindow 读取索引的 max_result_window，未设置或无法解析时返回默认值
+func indexMaxResultWindow(metaStore metadata.MetadataStore, indexName string) int {
+	if metaStore == nil {
+		return defaultMaxResultWindow
+	}
+	meta, err := metaStore.GetIndexMetadata(indexName)
+	if err != nil || meta == nil {
+		return defaultMaxResultWindow
+	}
+	v, ok := lookupIndexSetting(meta.Settings, maxResultWindowSetting)
+	if !ok {
+		return defaultMaxResultWindow
+	}
+	window, err := parseMaxResultWindow(v)
+	if err != nil {
+		return defaultMaxResultWindow
+	}
+	return window
+}
+
+// checkResultWindow 检查 from + size（scroll 请求为 size）是否超过索引的 max_result_window
+func checkResultWindow(metaStore metadata.MetadataStore, indexName string, from, size int, scroll bool) common.APIError {
+	if size <= 0 {
+		size = 10
+	}
+	if from < 0 {
+		from = 0
+	}
+	window := indexMaxResultWindow(metaStore, indexName)
+	if scroll {
+		if size > window {
+			return common.NewBadRequestError(fmt.Sprintf("Batch size is too large, size must be less than or equal to: [%d] but was [%d]. "+
+				"Scroll batch sizes cost as much memory as result windows so they are controlled by the [index.%s] index level setting.",
+				window, size, maxResultWindowSetting))
+		}
+		return nil
+	}
+	if from+size > window {
+		return common.NewBadRequestError(fmt.Sprintf("Result window is too large, from + size must be less than or equal to: [%d] but was [%d]. "+
+			"See the scroll api for a more efficient way to request large data sets. "+
+			"This limit can be set by changing the [index.%s] index level setting.",
+			window, from+size, maxResultWindowSetting))
+	}
+	return nil
+}
@@ -0,0 +1,551 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// rollupMetaKey rollup 索引 mapping 的 _meta 中保存作业配置的键
+const rollupMetaKey = "_rollup"
+
+// rollupStateMetaKey rollup 索引 mapping 的 _meta 中保存已启动作业的键，重启后自动恢复调度
+const rollupStateMetaKey = "_rollup_state"
+
+// numericFieldTypes 数值字段类型
+var numericFieldTypes = map[string]bool{
+	"long": true, "integer": true, "short": true, "byte": true, "unsigned_long": true,
+	"double": true, "float": true, "half_float": true, "scaled_float": true,
+}
+
+// RollupHandler rollup 作业与 _rollup_search 处理器
+type RollupHandler struct {
+	indexHandler *IndexHandler
+	docHandler   *DocumentHandler
+	dirMgr       directory.DirectoryManager
+	metaStore    metadata.MetadataStore
+	jobs         map[string]*rollupJob
+	mutex        sync.Mutex
+}
+
+// NewRollupHandler 创建 rollup 处理器，从 rollup 索引的 _meta 加载作业并恢复已启动的作业
+func NewRollupHandler(indexHandler *IndexHandler, docHandler *DocumentHandler) *RollupHandler {
+	h := &RollupHandler{
+		indexHandler: indexHandler,
+		docHandler:   docHandler,
+		dirMgr:       docHandler.dirMgr,
+		metaStore:    docHandler.metaStore,
+		jobs:         make(map[string]*rollupJob),
+	}
+	indices, err := h.dirMgr.ListIndices()
+	if err != nil {
+		logger.Error("Failed to list indices for rollup jobs: %v", err)
+		return h
+	}
+	for _, name := range indices {
+		meta, err := h.metaStore.GetIndexMetadata(name)
+		if err != nil || meta == nil {
+			continue
+		}
+		configs, started := rollupJobsFromMeta(meta)
+		for _, config := range configs {
+			job, err := newRollupJob(config)
+			if err != nil {
+				logger.Error("Failed to load rollup job [%s] from index [%s]: %v", config.ID, name, err)
+				continue
+			}
+			h.jobs[config.ID] = job
+			if started[config.ID] {
+				job.mutex.Lock()
+				h.startJob(job)
+				job.mutex.Unlock()
+			}
+		}
+	}
+	return h
+}
+
+// Close 停止所有作业的后台调度（不修改持久化的启动状态）
+func (h *RollupHandler) Close() {
+	h.mutex.Lock()
+	jobs := make([]*rollupJob, 0, len(h.jobs))
+	for _, job := range h.jobs {
+		jobs = append(jobs, job)
+	}
+	h.mutex.Unlock()
+	for _, job := range jobs {
+		if done := job.stopJob(); done != nil {
+			<-done
+		}
+	}
+}
+
+// rollupJobVisible 判断作业对请求可见：多租户请求只能看到 rollup 索引属于本租户的作业
+// （租户中间件为作业的 index_pattern 与 rollup_index 加上租户前缀）
+func rollupJobVisible(ctx context.Context, job *rollupJob) bool {
+	prefix := tenantIndexPrefix(ctx)
+	return prefix == "" || strings.HasPrefix(job.config.RollupIndex, prefix)
+}
+
+// rollupMeta 返回 mapping 中的 _meta，不存在时返回 nil
+func rollupMeta(mapping map[string]interface{}) map[string]interface{} {
+	meta, _ := mapping["_meta"].(map[string]interface{})
+	return meta
+}
+
+// rollupJobsFromMeta 读取 rollup 索引 _meta 中的作业配置与已启动的作业
+func rollupJobsFromMeta(meta *metadata.IndexMetadata) ([]*RollupJobConfig, map[string]bool) {
+	m := rollupMeta(meta.Mapping)
+	jobs, _ := m[rollupMetaKey].(map[string]interface{})
+	var configs []*RollupJobConfig
+	for id, raw := range jobs {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			continue
+		}
+		var config RollupJobConfig
+		if err := json.Unmarshal(data, &config); err != nil {
+			logger.Error("Failed to parse rollup job [%s] in index [%s]: %v", id, meta.Name, err)
+			continue
+		}
+		config.ID = id
+		configs = append(configs, &config)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].ID < configs[j].ID })
+
+	started := make(map[string]bool)
+	if states, ok := m[rollupStateMetaKey].(map[string]interface{}); ok {
+		for id, state := range states {
+			started[id] = state == rollupStateStarted
+		}
+	}
+	return configs, started
+}
+
+// isRollupIndex 判断索引是否为 rollup 索引（mapping 的 _meta 中有 _rollup）
+func isRollupIndex(metaStore metadata.MetadataStore, indexName string) bool {
+	meta, err := metaStore.GetIndexMetadata(indexName)
+	if err != nil || meta == nil {
+		return false
+	}
+	_, ok := rollupMeta(meta.Mapping)[rollupMetaKey].(map[string]interface{})
+	return ok
+}
+
+// updateRollupMeta 读-改-写 rollup 索引 mapping 的 _meta（与动态 mapping 共用锁）
+func (h *RollupHandler) updateRollupMeta(indexName string, update func(meta map[string]interface{})) error {
+	mappingUpdateMu.Lock()
+	defer mappingUpdateMu.Unlock()
+
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil {
+		return err
+	}
+	if indexMeta == nil {
+		return fmt.Errorf("no such index [%s]", indexName)
+	}
+	mapping := make(map[string]interface{})
+	if indexMeta.Mapping != nil {
+		data, err := json.Marshal(indexMeta.Mapping)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &mapping); err != nil {
+			return err
+		}
+	}
+	meta := rollupMeta(mapping)
+	if meta == nil {
+		meta = make(map[string]interface{})
+		mapping["_meta"] = meta
+	}
+	update(meta)
+
+	updated := *indexMeta
+	updated.Mapping = mapping
+	updated.UpdatedAt = time.Now()
+	return h.metaStore.SaveIndexMetadata(indexName, &updated)
+}
+
+// saveJobState 持久化作业是否处于启动状态
+func (h *RollupHandler) saveJobState(job *rollupJob, started bool) error {
+	return h.updateRollupMeta(job.config.RollupIndex, func(meta map[string]interface{}) {
+		states, ok := meta[rollupStateMetaKey].(map[string]interface{})
+		if !ok {
+			states = make(map[string]interface{})
+			meta[rollupStateMetaKey] = states
+		}
+		if started {
+			states[job.config.ID] = rollupStateStarted
+		} else {
+			delete(states, job.config.ID)
+		}
+	})
+}
+
+// rollupJobConfigMap 把作业配置转换为 _meta 中保存的对象
+func rollupJobConfigMap(config *RollupJobConfig) map[string]interface{} {
+	data, _ := json.Marshal(config)
+	var m map[string]interface{}
+	_ = json.Unmarshal(data, &m)
+	return m
+}
+
+// newRollupJobExistsError 作业已存在错误
+func newRollupJobExistsError(id string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "resource_already_exists_exception",
+		Message:    fmt.Sprintf("Cannot create rollup job [%s] because job was previously created (existing metadata).", id),
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "ROLLUP_JOB_EXISTS",
+	}
+}
+
+// newRollupJobNotFoundError 作业不存在错误
+func newRollupJobNotFoundError(id string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "resource_not_found_exception",
+		Message:    fmt.Sprintf("the task with id [%s] doesn't exist", id),
+		HTTPStatus: http.StatusNotFound,
+		Code:       "ROLLUP_JOB_NOT_FOUND",
+	}
+}
+
+// validateRollupSourceFields 校验作业引用的字段在源索引中的类型
+func (h *RollupHandler) validateRollupSourceFields(config *RollupJobConfig, indices []string) common.APIError {
+	fieldTypes := make(map[string][]string)
+	for _, name := range indices {
+		meta, err := h.metaStore.GetIndexMetadata(name)
+		if err != nil || meta == nil {
+			continue
+		}
+		types := make(map[string]string)
+		if props, ok := meta.Mapping["properties"].(map[string]interface{}); ok {
+			collectFieldTypes(props, "", types)
+		}
+		for field, fieldType := range types {
+			fieldTypes[field] = append(fieldTypes[field], fieldType)
+		}
+	}
+
+	dateField := config.Groups.DateHistogram.Field
+	if len(fieldTypes[dateField]) == 0 {
+		return common.NewBadRequestError(fmt.Sprintf("Could not find one of [date,date_nanos] fields with name [%s] in any of the indices matching the index pattern.", dateField))
+	}
+	for _, fieldType := range fieldTypes[dateField] {
+		if fieldType != "date" && fieldType != "date_nanos" {
+			return common.NewBadRequestError(fmt.Sprintf("The field referenced by a date_histogram group must be one of type [date,date_nanos] across all indices in the index pattern.  Found: [%s] for field [%s]", fieldType, dateField))
+		}
+	}
+	for _, field := range config.termsFields() {
+		if len(fieldTypes[field]) == 0 {
+			return common.NewBadRequestError(fmt.Sprintf("Could not find a [numeric] or [keyword/text] field with name [%s] in any of the indices matching the index pattern.", field))
+		}
+		for _, fieldType := range fieldTypes[field] {
+			if fieldType != "keyword" && !numericFieldTypes[fieldType] {
+				return common.NewBadRequestError(fmt.Sprintf("The field referenced by a terms group must be a [numeric] or [keyword/text] type, but found [%s] for field [%s]", fieldType, field))
+			}
+		}
+	}
+	for _, m := range config.Metrics {
+		if len(fieldTypes[m.Field]) == 0 {
+			return common.NewBadRequestError(fmt.Sprintf("Could not find a [numeric] or [date,date_nanos] field with name [%s] in any of the indices matching the index pattern.", m.Field))
+		}
+		for _, fieldType := range fieldTypes[m.Field] {
+			if !numericFieldTypes[fieldType] {
+				return common.NewBadRequestError(fmt.Sprintf("The field referenced by a metric group must be a [numeric] type, but found [%s] for field [%s]", fieldType, m.Field))
+			}
+		}
+	}
+	return nil
+}
+
+// rollupIndexMapping 新建 rollup 索引的 mapping：字符串字段映射为 keyword，_meta 保存作业配置
+func rollupIndexMapping(config *RollupJobConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"_meta": map[string]interface{}{
+			rollupMetaKey: map[string]interface{}{
+				config.ID: rollupJobConfigMap(config),
+			},
+			"rollup-version": "",
+		},
+		"dynamic_templates": []interface{}{
+			map[string]interface{}{
+				"strings": map[string]interface{}{
+					"match_mapping_type": "string",
+					"mapping":            map[string]interface{}{"type": "keyword"},
+				},
+			},
+		},
+	}
+}
+
+// PutJob 创建 rollup 作业（创建后处于停止状态）
+// PUT /_rollup/job/{id}
+func (h *RollupHandler) PutJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		common.HandleError(w, common.NewRequestBodyError("failed to read request body", err))
+		return
+	}
+	config, apiErr := parseRollupJobConfig(id, body)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, exists := h.jobs[id]; exists {
+		common.HandleError(w, newRollupJobExistsError(id))
+		return
+	}
+
+	indices := h.sourceIndices(config)
+	if len(indices) == 0 {
+		common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("Index pattern [%s] does not match any indices", config.IndexPattern)))
+		return
+	}
+	if apiErr := h.validateRollupSourceFields(config, indices); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	job, err := newRollupJob(config)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+
+	if h.dirMgr.IndexExists(config.RollupIndex) {
+		if !isRollupIndex(h.metaStore, config.RollupIndex) {
+			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("Rollup data cannot be added to existing indices that contain non-rollup data (expected to find _meta key in mapping of rollup index [%s] but not found).", config.RollupIndex)))
+			return
+		}
+		err := h.updateRollupMeta(config.RollupIndex, func(meta map[string]interface{}) {
+			jobs, _ := meta[rollupMetaKey].(map[string]interface{})
+			jobs[id] = rollupJobConfigMap(config)
+		})
+		if err != nil {
+			logger.Error("Failed to save rollup job [%s]: %v", id, err)
+			common.HandleError(w, common.NewInternalServerError("failed to save rollup job: "+err.Error()))
+			return
+		}
+	} else if apiErr := h.indexHandler.createIndex(config.RollupIndex, rollupIndexMapping(config), map[string]interface{}{}, nil, nil, nil); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	h.jobs[id] = job
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"acknowledged": true,
+	}); err != nil {
+		logger.Error("Failed to encode put rollup job response: %v", err)
+	}
+}
+
+// GetJobs 获取 rollup 作业的配置、状态与统计
+// GET /_rollup/job
+// GET /_rollup/job/{id}（id 为 _all 时返回所有作业）
+func (h *RollupHandler) GetJobs(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	h.mutex.Lock()
+	var jobs []*rollupJob
+	for jobID, job := range h.jobs {
+		if (id == "" || id == "_all" || id == jobID) && rollupJobVisible(r.Context(), job) {
+			jobs = append(jobs, job)
+		}
+	}
+	h.mutex.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].config.ID < jobs[j].config.ID })
+
+	results := make([]map[string]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		status := job.status()
+		job.mutex.Lock()
+		stats := job.stats
+		job.mutex.Unlock()
+		results = append(results, map[string]interface{}{
+			"config": job.config,
+			"status": status,
+			"stats":  stats,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs": results,
+	}); err != nil {
+		logger.Error("Failed to encode get rollup jobs response: %v", err)
+	}
+}
+
+// DeleteJob 删除已停止的 rollup 作业（rollup 索引中的数据保留）
+// DELETE /_rollup/job/{id}
+func (h *RollupHandler) DeleteJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	job, ok := h.jobs[id]
+	if !ok || !rollupJobVisible(r.Context(), job) {
+		common.HandleError(w, newRollupJobNotFoundError(id))
+		return
+	}
+	job.mutex.Lock()
+	state := job.state
+	job.mutex.Unlock()
+	if state != rollupStateStopped {
+		common.HandleError(w, &common.BaseError{
+			ErrType:    "illegal_state_exception",
+			Message:    fmt.Sprintf("Could not delete job [%s] because indexer state is [%s].  Job must be [stopped] before deletion.", id, state),
+			HTTPStatus: http.StatusConflict,
+			Code:       "ROLLUP_JOB_NOT_STOPPED",
+		})
+		return
+	}
+
+	if h.dirMgr.IndexExists(job.config.RollupIndex) {
+		err := h.updateRollupMeta(job.config.RollupIndex, func(meta map[string]interface{}) {
+			if jobs, ok := meta[rollupMetaKey].(map[string]interface{}); ok {
+				delete(jobs, id)
+			}
+			if states, ok := meta[rollupStateMetaKey].(map[string]interface{}); ok {
+				delete(states, id)
+			}
+		})
+		if err != nil {
+			logger.Error("Failed to delete rollup job [%s]: %v", id, err)
+			common.HandleError(w, common.NewInternalServerError("failed to delete rollup job: "+err.Error()))
+			return
+		}
+	}
+	delete(h.jobs, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"acknowledged": true,
+	}); err != nil {
+		logger.Error("Failed to encode delete rollup job response: %v", err)
+	}
+}
+
+// StartJob 启动 rollup 作业，立即触发一次汇总
+// POST /_rollup/job/{id}/_start
+func (h *RollupHandler) StartJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	h.mutex.Lock()
+	job, ok := h.jobs[id]
+	h.mutex.Unlock()
+	if !ok || !rollupJobVisible(r.Context(), job) {
+		common.HandleError(w, newRollupJobNotFoundError(id))
+		return
+	}
+
+	// 等待正在停止的调度退出后再启动
+	job.mutex.Lock()
+	if job.state == rollupStateStopping {
+		done := job.done
+		job.mutex.Unlock()
+		<-done
+		job.mutex.Lock()
+	}
+	if job.state == rollupStateStopped {
+		h.startJob(job)
+	}
+	job.mutex.Unlock()
+
+	if err := h.saveJobState(job, true); err != nil {
+		logger.Error("Failed to save state of rollup job [%s]: %v", id, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"started": true,
+	}); err != nil {
+		logger.Error("Failed to encode start rollup job response: %v", err)
+	}
+}
+
+// StopJob 停止 rollup 作业；wait_for_completion=true 时等待正在进行的汇总结束（timeout 默认 30s）
+// POST /_rollup/job/{id}/_stop
+func (h *RollupHandler) StopJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	h.mutex.Lock()
+	job, ok := h.jobs[id]
+	h.mutex.Unlock()
+	if !ok || !rollupJobVisible(r.Context(), job) {
+		common.HandleError(w, newRollupJobNotFoundError(id))
+		return
+	}
+
+	done := job.stopJob()
+	if err := h.saveJobState(job, false); err != nil {
+		logger.Error("Failed to save state of rollup job [%s]: %v", id, err)
+	}
+
+	if done != nil && strings.EqualFold(r.URL.Query().Get("wait_for_completion"), "true") {
+		timeout := 30 * time.Second
+		if s := r.URL.Query().Get("timeout"); s != "" {
+			d, err := parseTimeValue(s)
+			if err != nil {
+				common.HandleError(w, common.NewBadRequestError(err.Error()))
+				return
+			}
+			timeout = d
+		}
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			common.HandleError(w, &common.BaseError{
+				ErrType:    "elasticsearch_timeout_exception",
+				Message:    fmt.Sprintf("Timed out after [%s] while waiting for rollup job [%s] to stop", timeout, id),
+				HTTPStatus: http.StatusInternalServerError,
+				Code:       "ROLLUP_STOP_TIMEOUT",
+			})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"stopped": true,
+	}); err != nil {
+		logger.Error("Failed to encode stop rollup job response: %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestRollupHandler_Jobs(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	rollupHandler := NewRollupHandler(indexHandler, docHandler)
+	defer rollupHandler.Close()
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "PUT", Path: "/_rollup/job/{id}", Handler: rollupHandler.PutJob},
+		{Method: "GET", Path: "/_rollup/job/{id}", Handler: rollupHandler.GetJobs},
+		{Method: "DELETE", Path: "/_rollup/job/{id}", Handler: rollupHandler.DeleteJob},
+		{Method: "POST", Path: "/_rollup/job/{id}/_start", Handler: rollupHandler.StartJob},
+		{Method: "POST", Path: "/_rollup/job/{id}/_stop", Handler: rollupHandler.StopJob},
+		{Method: "POST", Path: "/{index}/_rollup_search", Handler: rollupHandler.RollupSearch},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	bulk := func(docs ...string) {
+		t.Helper()
+		var body strings.Builder
+		for _, doc := range docs {
+			body.WriteString("{\"index\":{\"_index\":\"sensor\"}}\n" + doc + "\n")
+		}
+		if w := do("POST", "/_bulk?refresh=true", body.String()); w.Code != http.StatusOK {
+			t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	for _, index := range []string{"sensor", "other"} {
+		if w := do("PUT", "/"+index, `{"mappings":{"properties":{
+			"timestamp":{"type":"date"},"node":{"type":"keyword"},"temperature":{"type":"long"},"voltage":{"type":"float"}
+		}}}`); w.Code != http.StatusOK {
+			t.Fatalf("create index %s: got %d: %s", index, w.Code, w.Body.String())
+		}
+	}
+	bulk(
+		`{"timestamp":"2024-01-01T00:00:00Z","node":"a","temperature":10,"voltage":1.0}`,
+		`{"timestamp":"2024-01-01T00:10:00Z","node":"b","temperature":20,"voltage":2.0}`,
+		`{"timestamp":"2024-01-01T00:30:00Z","node":"a","temperature":30,"voltage":3.0}`,
+		`{"timestamp":"2024-01-01T01:00:00Z","node":"a","temperature":5,"voltage":5.0}`,
+		`{"timestamp":"2024-01-01T01:59:59Z","node":"b","temperature":15,"voltage":1.0}`,
+		`{"timestamp":"2024-01-01T02:20:00Z","node":"b","temperature":40,"voltage":4.0}`,
+	)
+
+	const jobBody = `{
+		"index_pattern": "sensor",
+		"rollup_index": "sensor_rollup",
+		"cron": "*/30 * * * * ?",
+		"page_size": 2,
+		"groups": {
+			"date_histogram": {"field": "timestamp", "fixed_interval": "1h"},
+			"terms": {"fields": ["node"]}
+		},
+		"metrics": [
+			{"field": "temperature", "metrics": ["min", "max", "sum"]},
+			{"field": "voltage", "metrics": ["avg", "value_count"]}
+		]
+	}`
+	if w := do("PUT", "/_rollup/job/sensor", jobBody); w.Code != http.StatusOK {
+		t.Fatalf("put job: got %d: %s", w.Code, w.Body.String())
+	}
+	if !isRollupIndex(indexHandler.metaStore, "sensor_rollup") {
+		t.Fatalf("expected rollup index to be created with rollup metadata")
+	}
+
+	invalidJobs := []struct {
+		id      string
+		body    string
+		message string
+	}{
+		{"sensor", jobBody, "resource_already_exists_exception"},
+		{"bad_metric", strings.Replace(jobBody, `"sum"]`, `"median"]`, 1), "Unsupported metric [median]"},
+		{"bad_date", strings.Replace(jobBody, `"field": "timestamp"`, `"field": "voltage"`, 1), "must be one of type [date,date_nanos]"},
+		{"bad_interval", strings.Replace(jobBody, `"fixed_interval": "1h"`, `"fixed_interval": "1x"`, 1), "fixed_interval"},
+		{"bad_pattern", strings.Replace(jobBody, `"index_pattern": "sensor"`, `"index_pattern": "sensor*"`, 1), "would match rollup index"},
+		{"bad_rollup_index", strings.Replace(jobBody, `"sensor_rollup"`, `"other"`, 1), "contain non-rollup data"},
+	}
+	for _, tt := range invalidJobs {
+		w := do("PUT", "/_rollup/job/"+tt.id, tt.body)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("put job %s: expected 400 with %q, got %d: %s", tt.id, tt.message, w.Code, w.Body.String())
+		}
+	}
+
+	// 作业配置保存在 rollup 索引的 _meta 中，重新加载后仍然存在
+	reloaded := NewRollupHandler(indexHandler, docHandler)
+	if _, ok := reloaded.jobs["sensor"]; !ok {
+		t.Errorf("expected job to be loaded from rollup index metadata")
+	}
+
+	type jobsResponse struct {
+		Jobs []struct {
+			Config RollupJobConfig `json:"config"`
+			Status struct {
+				JobState string `json:"job_state"`
+			} `json:"status"`
+			Stats rollupJobStats `json:"stats"`
+		} `json:"jobs"`
+	}
+	getJob := func() jobsResponse {
+		t.Helper()
+		w := do("GET", "/_rollup/job/sensor", "")
+		var resp jobsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode jobs: %v: %s", err, w.Body.String())
+		}
+		return resp
+	}
+	if resp := getJob(); len(resp.Jobs) != 1 || resp.Jobs[0].Status.JobState != rollupStateStopped ||
+		resp.Jobs[0].Config.RollupIndex != "sensor_rollup" {
+		t.Fatalf("unexpected job before start: %+v", resp)
+	}
+
+	if w := do("POST", "/_rollup/job/sensor/_start", ""); w.Code != http.StatusOK {
+		t.Fatalf("start job: got %d: %s", w.Code, w.Body.String())
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp := getJob()
+		if job := resp.Jobs[0]; job.Stats.TriggerCount >= 1 && job.Status.JobState == rollupStateStarted {
+			// 5 个分组：(0时,a) (0时,b) (1时,a) (1时,b) (2时,b)，page_size 为 2 分 3 页写入
+			if job.Stats.DocumentsProcessed != 6 || job.Stats.RollupsIndexed != 5 || job.Stats.PagesProcessed != 3 {
+				t.Errorf("unexpected stats: %+v", job.Stats)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rollup job did not finish: %+v", resp)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 运行中的作业不能删除
+	if w := do("DELETE", "/_rollup/job/sensor", ""); w.Code != http.StatusConflict {
+		t.Errorf("delete started job: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/_rollup/job/sensor/_stop?wait_for_completion=true", ""); w.Code != http.StatusOK {
+		t.Fatalf("stop job: got %d: %s", w.Code, w.Body.String())
+	}
+	if state := getJob().Jobs[0].Status.JobState; state != rollupStateStopped {
+		t.Errorf("expected stopped job, got %s", state)
+	}
+
+	type bucket struct {
+		Key          interface{}                `json:"key"`
+		KeyAsString  string                     `json:"key_as_string"`
+		DocCount     int64                      `json:"doc_count"`
+		Aggregations map[string]json.RawMessage `json:"aggregations"`
+	}
+	type searchResponse struct {
+		Hits struct {
+			Hits []interface{} `json:"hits"`
+		} `json:"hits"`
+		Aggregations map[string]json.RawMessage `json:"aggregations"`
+	}
+	rollupSearch := func(path, body string) searchResponse {
+		t.Helper()
+		w := do("POST", path, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("rollup search %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp searchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+	buckets := func(raw json.RawMessage) []bucket {
+		t.Helper()
+		var agg struct {
+			Buckets []bucket `json:"buckets"`
+		}
+		if err := json.Unmarshal(raw, &agg); err != nil {
+			t.Fatalf("decode buckets: %v", err)
+		}
+		return agg.Buckets
+	}
+	value := func(raw json.RawMessage) interface{} {
+		t.Helper()
+		var agg struct {
+			Value interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &agg); err != nil {
+			t.Fatalf("decode value: %v", err)
+		}
+		return agg.Value
+	}
+	type expectedBucket struct {
+		key      string
+		docCount int64
+		values   map[string]interface{}
+	}
+	checkBuckets := func(name string, got []bucket, expected []expectedBucket) {
+		t.Helper()
+		if len(got) != len(expected) {
+			t.Fatalf("%s: expected %d buckets, got %d: %+v", name, len(expected), len(got), got)
+		}
+		for i, e := range expected {
+			key := got[i].KeyAsString
+			if key == "" {
+				key = fmt.Sprint(got[i].Key)
+			}
+			if key != e.key || got[i].DocCount != e.docCount {
+				t.Errorf("%s[%d]: expected %s/%d, got %s/%d", name, i, e.key, e.docCount, key, got[i].DocCount)
+			}
+			for agg, v := range e.values {
+				if g := value(got[i].Aggregations[agg]); g != v {
+					t.Errorf("%s[%s].%s: expected %v, got %v", name, e.key, agg, v, g)
+				}
+			}
+		}
+	}
+
+	resp := rollupSearch("/sensor_rollup/_rollup_search", `{"size":0,"aggs":{
+		"hourly":{"date_histogram":{"field":"timestamp","fixed_interval":"1h"},"aggs":{
+			"max_temp":{"max":{"field":"temperature"}},
+			"avg_voltage":{"avg":{"field":"voltage"}}
+		}}
+	}}`)
+	if len(resp.Hits.Hits) != 0 {
+		t.Errorf("rollup search should not return hits")
+	}
+	checkBuckets("hourly", buckets(resp.Aggregations["hourly"]), []expectedBucket{
+		{"2024-01-01T00:00:00.000Z", 3, map[string]interface{}{"max_temp": 30.0, "avg_voltage": 2.0}},
+		{"2024-01-01T01:00:00.000Z", 2, map[string]interface{}{"max_temp": 15.0, "avg_voltage": 3.0}},
+		{"2024-01-01T02:00:00.000Z", 1, map[string]interface{}{"max_temp": 40.0, "avg_voltage": 4.0}},
+	})
+
+	// 更粗的日历间隔由 1h 的 rollup 桶合并得到
+	resp = rollupSearch("/sensor_rollup/_rollup_search", `{"size":0,"aggs":{
+		"daily":{"date_histogram":{"field":"timestamp","calendar_interval":"1d"},"aggs":{
+			"nodes":{"terms":{"field":"node"},"aggs":{"sum_temp":{"sum":{"field":"temperature"}},"min_temp":{"min":{"field":"temperature"}}}}
+		}},
+		"voltages":{"value_count":{"field":"voltage"}}
+	}}`)
+	daily := buckets(resp.Aggregations["daily"])
+	checkBuckets("daily", daily, []expectedBucket{{"2024-01-01T00:00:00.000Z", 6, nil}})
+	checkBuckets("nodes", buckets(daily[0].Aggregations["nodes"]), []expectedBucket{
+		{"a", 3, map[string]interface{}{"sum_temp": 45.0, "min_temp": 5.0}},
+		{"b", 3, map[string]interface{}{"sum_temp": 75.0, "min_temp": 15.0}},
+	})
+	if v := value(resp.Aggregations["voltages"]); v != 6.0 {
+		t.Errorf("voltages: expected 6, got %v", v)
+	}
+
+	resp = rollupSearch("/sensor_rollup/_rollup_search", `{"size":0,
+		"query":{"bool":{"filter":[{"term":{"node":"b"}},{"range":{"timestamp":{"gte":"2024-01-01T01:00:00Z"}}}]}},
+		"aggs":{"max_temp":{"max":{"field":"temperature"}},"sum_temp":{"sum":{"field":"temperature"}}}}`)
+	if v := value(resp.Aggregations["max_temp"]); v != 40.0 {
+		t.Errorf("filtered max_temp: expected 40, got %v", v)
+	}
+	if v := value(resp.Aggregations["sum_temp"]); v != 55.0 {
+		t.Errorf("filtered sum_temp: expected 55, got %v", v)
+	}
+
+	// 作业停止后写入的新数据只存在于原始索引：同时搜索原始索引时，rollup 之后的时间由原始数据补充
+	bulk(`{"timestamp":"2024-01-01T05:15:00Z","node":"a","temperature":100,"voltage":7.0}`)
+	const hourly = `{"size":0,"aggs":{"hourly":{"date_histogram":{"field":"timestamp","fixed_interval":"1h","min_doc_count":1},
+		"aggs":{"max_temp":{"max":{"field":"temperature"}}}},"sum_temp":{"sum":{"field":"temperature"}}}}`
+	resp = rollupSearch("/sensor_rollup/_rollup_search", hourly)
+	if v := value(resp.Aggregations["sum_temp"]); v != 120.0 {
+		t.Errorf("rollup only sum_temp: expected 120, got %v", v)
+	}
+	resp = rollupSearch("/sensor,sensor_rollup/_rollup_search", hourly)
+	checkBuckets("combined", buckets(resp.Aggregations["hourly"]), []expectedBucket{
+		{"2024-01-01T00:00:00.000Z", 3, map[string]interface{}{"max_temp": 30.0}},
+		{"2024-01-01T01:00:00.000Z", 2, map[string]interface{}{"max_temp": 15.0}},
+		{"2024-01-01T02:00:00.000Z", 1, map[string]interface{}{"max_temp": 40.0}},
+		{"2024-01-01T05:00:00.000Z", 1, map[string]interface{}{"max_temp": 100.0}},
+	})
+	if v := value(resp.Aggregations["sum_temp"]); v != 220.0 {
+		t.Errorf("combined sum_temp: expected 220, got %v", v)
+	}
+
+	invalidSearches := []struct {
+		path    string
+		body    string
+		message string
+	}{
+		{"/sensor_rollup/_rollup_search", `{"size":10}`, "[size: 0]"},
+		{"/sensor_rollup/_rollup_search", `{"size":0,"aggs":{"c":{"cardinality":{"field":"node"}}}}`, "currently unsupported"},
+		{"/sensor_rollup/_rollup_search", `{"size":0,"aggs":{"h":{"date_histogram":{"field":"timestamp","fixed_interval":"30m"}}}}`, "There is not a rollup job"},
+		{"/sensor_rollup/_rollup_search", `{"size":0,"aggs":{"a":{"avg":{"field":"temperature"}}}}`, "There is not a rollup job"},
+		{"/sensor_rollup/_rollup_search", `{"size":0,"query":{"term":{"host":"x"}}}`, "not available in selected rollup indices"},
+		{"/sensor_rollup/_rollup_search", `{"size":0,"query":{"match":{"node":"a"}}}`, "Unsupported Query"},
+		{"/sensor/_rollup_search", `{"size":0}`, "at least one rollup index"},
+	}
+	for _, tt := range invalidSearches {
+		w := do("POST", tt.path, tt.body)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("rollup search %s: expected 400 with %q, got %d: %s", tt.body, tt.message, w.Code, w.Body.String())
+		}
+	}
+
+	if w := do("DELETE", "/_rollup/job/sensor", ""); w.Code != http.StatusOK {
+		t.Fatalf("delete job: got %d: %s", w.Code, w.Body.String())
+	}
+	if resp := getJob(); len(resp.Jobs) != 0 {
+		t.Errorf("expected no jobs after delete, got %+v", resp)
+	}
+	if w := do("POST", "/_rollup/job/sensor/_start", ""); w.Code != http.StatusNotFound {
+		t.Errorf("start deleted job: expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
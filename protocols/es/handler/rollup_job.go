@@ -0,0 +1,1051 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// Rollup 作业
+// 作业按 date_histogram 间隔与 terms 分组把源索引中已完整的时间桶汇总为 rollup 文档，
+// 写入 rollup 索引（_id 由作业与分组键确定，重复汇总覆盖同一文档）。作业配置保存在
+// rollup 索引 mapping 的 _meta._rollup 中；cron 只做保存，调度按固定的触发间隔执行。
+
+// rollupTriggerInterval 已启动作业的触发间隔
+var rollupTriggerInterval = time.Minute
+
+// rollupScanPageSize 扫描源索引与 rollup 索引时每页的文档数
+const rollupScanPageSize = 1000
+
+// rollupDocVersion rollup 文档格式版本（_rollup.version）
+const rollupDocVersion = 2
+
+// 作业状态（与 ES 的 job_state 一致）
+const (
+	rollupStateStarted  = "started"
+	rollupStateIndexing = "indexing"
+	rollupStateStopping = "stopping"
+	rollupStateStopped  = "stopped"
+)
+
+// rollupMetricNames 支持的汇总指标
+var rollupMetricNames = map[string]bool{
+	"min": true, "max": true, "sum": true, "avg": true, "value_count": true,
+}
+
+// RollupJobConfig rollup 作业配置
+type RollupJobConfig struct {
+	ID           string               `json:"id"`
+	IndexPattern string               `json:"index_pattern"`
+	RollupIndex  string               `json:"rollup_index"`
+	Cron         string               `json:"cron"`
+	PageSize     int                  `json:"page_size"`
+	Timeout      string               `json:"timeout,omitempty"`
+	Groups       RollupGroups         `json:"groups"`
+	Metrics      []RollupMetricConfig `json:"metrics"`
+}
+
+// RollupGroups rollup 分组配置
+type RollupGroups struct {
+	DateHistogram *RollupDateHistogramGroup `json:"date_histogram"`
+	Terms         *RollupTermsGroup         `json:"terms,omitempty"`
+}
+
+// RollupDateHistogramGroup 时间分组：fixed_interval 与 calendar_interval 二选一（interval 为旧写法）
+type RollupDateHistogramGroup struct {
+	Field            string `json:"field"`
+	FixedInterval    string `json:"fixed_interval,omitempty"`
+	CalendarInterval string `json:"calendar_interval,omitempty"`
+	Interval         string `json:"interval,omitempty"`
+	Delay            string `json:"delay,omitempty"`
+	TimeZone         string `json:"time_zone,omitempty"`
+}
+
+// RollupTermsGroup terms 分组
+type RollupTermsGroup struct {
+	Fields []string `json:"fields"`
+}
+
+// RollupMetricConfig 字段的汇总指标
+type RollupMetricConfig struct {
+	Field   string   `json:"field"`
+	Metrics []string `json:"metrics"`
+}
+
+// termsFields 返回 terms 分组字段
+func (c *RollupJobConfig) termsFields() []string {
+	if c.Groups.Terms == nil {
+		return nil
+	}
+	return c.Groups.Terms.Fields
+}
+
+// hasMetric 判断作业是否汇总了字段的指定指标
+func (c *RollupJobConfig) hasMetric(field, metric string) bool {
+	for _, m := range c.Metrics {
+		if m.Field != field {
+			continue
+		}
+		for _, name := range m.Metrics {
+			if name == metric {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseRollupJobConfig 解析并校验 PUT _rollup/job/{id} 的请求体
+func parseRollupJobConfig(id string, body []byte) (*RollupJobConfig, common.APIError) {
+	var config RollupJobConfig
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, common.NewBadRequestError("failed to parse rollup job: " + err.Error())
+	}
+	if config.ID != "" && config.ID != id {
+		return nil, common.NewBadRequestError(fmt.Sprintf("Inconsistent ID, the ID in the body [%s] must match the ID in the URL [%s]", config.ID, id))
+	}
+	config.ID = id
+	if config.IndexPattern == "" {
+		return nil, common.NewBadRequestError("Index pattern must be a non-null, non-empty string")
+	}
+	if config.RollupIndex == "" {
+		return nil, common.NewBadRequestError("Rollup index must be a non-null, non-empty string")
+	}
+	if config.IndexPattern == config.RollupIndex || simpleWildcardMatch(config.IndexPattern, config.RollupIndex) {
+		return nil, common.NewBadRequestError(fmt.Sprintf("Index pattern would match rollup index name which is not allowed: [%s]", config.IndexPattern))
+	}
+	if err := common.ValidateIndexName(config.RollupIndex); err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+	if config.Cron == "" {
+		return nil, common.NewBadRequestError("Cron schedule must be a non-null, non-empty string")
+	}
+	if config.PageSize == 0 {
+		config.PageSize = 1000
+	} else if config.PageSize < 0 {
+		return nil, common.NewBadRequestError(fmt.Sprintf("Page size is mandatory and must be a positive long, got [%d]", config.PageSize))
+	}
+
+	dh := config.Groups.DateHistogram
+	if dh == nil {
+		return nil, common.NewBadRequestError("A date_histogram group is mandatory")
+	}
+	if dh.Field == "" {
+		return nil, common.NewBadRequestError("Field must be a non-null, non-empty string")
+	}
+	if _, err := dh.interval(); err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+	if dh.Delay != "" {
+		if _, err := parseFixedInterval(dh.Delay); err != nil {
+			return nil, common.NewBadRequestError(fmt.Sprintf("failed to parse [delay] with value [%s]", dh.Delay))
+		}
+	}
+	if _, err := dh.location(); err != nil {
+		return nil, common.NewBadRequestError(err.Error())
+	}
+
+	if config.Groups.Terms != nil {
+		if len(config.Groups.Terms.Fields) == 0 {
+			return nil, common.NewBadRequestError("Fields must have at least one value")
+		}
+		for _, field := range config.Groups.Terms.Fields {
+			if field == dh.Field {
+				return nil, common.NewBadRequestError(fmt.Sprintf("Field [%s] is used by the date_histogram group and cannot be a terms field", field))
+			}
+		}
+	}
+	for _, m := range config.Metrics {
+		if m.Field == "" {
+			return nil, common.NewBadRequestError("Field must be a non-null, non-empty string")
+		}
+		if len(m.Metrics) == 0 {
+			return nil, common.NewBadRequestError("Metrics must be a non-null, non-empty array of strings")
+		}
+		for _, name := range m.Metrics {
+			if !rollupMetricNames[name] {
+				return nil, common.NewBadRequestError(fmt.Sprintf("Unsupported metric [%s]. Supported metrics include: [max, min, sum, avg, value_count]", name))
+			}
+		}
+	}
+	if config.Metrics == nil {
+		config.Metrics = []RollupMetricConfig{}
+	}
+	return &config, nil
+}
+
+// interval 解析分组间隔
+func (g *RollupDateHistogramGroup) interval() (rollupInterval, error) {
+	switch {
+	case g.FixedInterval != "" && g.CalendarInterval != "":
+		return rollupInterval{}, fmt.Errorf("Cannot use [fixed_interval] with [calendar_interval] configuration option.")
+	case g.FixedInterval != "":
+		return parseFixedInterval(g.FixedInterval)
+	case g.CalendarInterval != "":
+		return parseCalendarInterval(g.CalendarInterval)
+	case g.Interval != "":
+		if iv, err := parseCalendarInterval(g.Interval); err == nil {
+			return iv, nil
+		}
+		return parseFixedInterval(g.Interval)
+	}
+	return rollupInterval{}, fmt.Errorf("An interval is required.  Use [fixed_interval] or [calendar_interval].")
+}
+
+// intervalString 返回配置的间隔表达式
+func (g *RollupDateHistogramGroup) intervalString() string {
+	for _, s := range []string{g.FixedInterval, g.CalendarInterval, g.Interval} {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// timeZone 返回配置的时区，默认 UTC
+func (g *RollupDateHistogramGroup) timeZone() string {
+	if g.TimeZone == "" {
+		return "UTC"
+	}
+	return g.TimeZone
+}
+
+// location 解析时区
+func (g *RollupDateHistogramGroup) location() (*time.Location, error) {
+	loc, err := time.LoadLocation(g.timeZone())
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone [%s]", g.TimeZone)
+	}
+	return loc, nil
+}
+
+// rollupInterval date_histogram 间隔：固定时长或日历单位
+type rollupInterval struct {
+	fixed    time.Duration
+	calendar byte // m h d w M q y
+}
+
+// calendarIntervalUnits 日历间隔写法到单位
+var calendarIntervalUnits = map[string]byte{
+	"1m": 'm', "minute": 'm',
+	"1h": 'h', "hour": 'h',
+	"1d": 'd', "day": 'd',
+	"1w": 'w', "week": 'w',
+	"1M": 'M', "month": 'M',
+	"1q": 'q', "quarter": 'q',
+	"1y": 'y', "year": 'y',
+}
+
+// calendarUnitRank 日历单位由小到大的顺序
+var calendarUnitRank = map[byte]int{'m': 0, 'h': 1, 'd': 2, 'w': 3, 'M': 4, 'q': 5, 'y': 6}
+
+// calendarUnitLength 固定长度的日历单位
+var calendarUnitLength = map[byte]time.Duration{
+	'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour,
+}
+
+// parseCalendarInterval 解析 calendar_interval（只允许单个单位，如 1d、month）
+func parseCalendarInterval(s string) (rollupInterval, error) {
+	unit, ok := calendarIntervalUnits[strings.TrimSpace(s)]
+	if !ok {
+		return rollupInterval{}, fmt.Errorf("The supplied interval [%s] could not be parsed as a calendar interval.", s)
+	}
+	return rollupInterval{calendar: unit}, nil
+}
+
+// fixedIntervalUnits fixed_interval 支持的单位（ms 需要先于 m/s 匹配）
+var fixedIntervalUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"ms", time.Millisecond},
+	{"s", time.Second},
+	{"m", time.Minute},
+	{"h", time.Hour},
+	{"d", 24 * time.Hour},
+}
+
+// parseFixedInterval 解析 fixed_interval（整数加单位，如 30m、1h）
+func parseFixedInterval(s string) (rollupInterval, error) {
+	s = strings.TrimSpace(s)
+	for _, u := range fixedIntervalUnits {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(s, u.suffix), 10, 64)
+		if err != nil || n <= 0 {
+			break
+		}
+		return rollupInterval{fixed: time.Duration(n) * u.unit}, nil
+	}
+	return rollupInterval{}, fmt.Errorf("failed to parse setting [date_histogram.fixed_interval] with value [%s] as a time value: unit is missing or unrecognized", s)
+}
+
+// floor 返回 t 所在桶的起始时间
+func (iv rollupInterval) floor(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	if iv.fixed > 0 {
+		_, offset := t.Zone()
+		shift := time.Duration(offset) * time.Second
+		ms := t.Add(shift).UnixMilli()
+		d := iv.fixed.Milliseconds()
+		bucket := ms - ((ms%d)+d)%d
+		return time.UnixMilli(bucket).Add(-shift).In(loc)
+	}
+	y, mon, d := t.Date()
+	switch iv.calendar {
+	case 'm':
+		return time.Date(y, mon, d, t.Hour(), t.Minute(), 0, 0, loc)
+	case 'h':
+		return time.Date(y, mon, d, t.Hour(), 0, 0, 0, loc)
+	case 'd':
+		return time.Date(y, mon, d, 0, 0, 0, 0, loc)
+	case 'w':
+		day := time.Date(y, mon, d, 0, 0, 0, 0, loc)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case 'M':
+		return time.Date(y, mon, 1, 0, 0, 0, 0, loc)
+	case 'q':
+		return time.Date(y, mon-(mon-1)%3, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// next 返回桶 start 的下一个桶的起始时间
+func (iv rollupInterval) next(start time.Time) time.Time {
+	if iv.fixed > 0 {
+		return start.Add(iv.fixed)
+	}
+	switch iv.calendar {
+	case 'm':
+		return start.Add(time.Minute)
+	case 'h':
+		return start.Add(time.Hour)
+	case 'd':
+		return start.AddDate(0, 0, 1)
+	case 'w':
+		return start.AddDate(0, 0, 7)
+	case 'M':
+		return start.AddDate(0, 1, 0)
+	case 'q':
+		return start.AddDate(0, 3, 0)
+	default:
+		return start.AddDate(1, 0, 0)
+	}
+}
+
+// divides 判断以 iv 为间隔汇总的数据能否精确地按 other 重新分桶
+func (iv rollupInterval) divides(other rollupInterval) bool {
+	switch {
+	case iv.fixed > 0 && other.fixed > 0:
+		return other.fixed%iv.fixed == 0
+	case iv.fixed > 0:
+		if length, ok := calendarUnitLength[other.calendar]; ok {
+			return length%iv.fixed == 0
+		}
+		// 月、季、年都由整天组成
+		return (24*time.Hour)%iv.fixed == 0
+	case other.fixed > 0:
+		length, ok := calendarUnitLength[iv.calendar]
+		return ok && other.fixed%length == 0
+	case iv.calendar == 'w':
+		// 周不能组成月、季、年
+		return other.calendar == 'w'
+	default:
+		return calendarUnitRank[iv.calendar] <= calendarUnitRank[other.calendar]
+	}
+}
+
+// rollupJobStats 作业统计（GET _rollup/job 的 stats）
+type rollupJobStats struct {
+	PagesProcessed     int64 `json:"pages_processed"`
+	DocumentsProcessed int64 `json:"documents_processed"`
+	RollupsIndexed     int64 `json:"rollups_indexed"`
+	TriggerCount       int64 `json:"trigger_count"`
+	IndexFailures      int64 `json:"index_failures"`
+	SearchFailures     int64 `json:"search_failures"`
+	IndexTimeInMs      int64 `json:"index_time_in_ms"`
+	IndexTotal         int64 `json:"index_total"`
+	SearchTimeInMs     int64 `json:"search_time_in_ms"`
+	SearchTotal        int64 `json:"search_total"`
+	ProcessingTimeInMs int64 `json:"processing_time_in_ms"`
+	ProcessingTotal    int64 `json:"processing_total"`
+}
+
+// rollupJob 运行中的 rollup 作业
+type rollupJob struct {
+	config   *RollupJobConfig
+	interval rollupInterval
+	delay    time.Duration
+	location *time.Location
+
+	mutex          sync.Mutex
+	state          string
+	stats          rollupJobStats
+	position       time.Time // 已汇总到的时间（不含），零值表示尚未汇总
+	positionLoaded bool
+	cancel         context.CancelFunc
+	done           chan struct{}
+}
+
+// newRollupJob 根据已校验的配置创建作业
+func newRollupJob(config *RollupJobConfig) (*rollupJob, error) {
+	dh := config.Groups.DateHistogram
+	if dh == nil {
+		return nil, fmt.Errorf("rollup job [%s] has no date_histogram group", config.ID)
+	}
+	interval, err := dh.interval()
+	if err != nil {
+		return nil, err
+	}
+	var delay time.Duration
+	if dh.Delay != "" {
+		d, err := parseFixedInterval(dh.Delay)
+		if err != nil {
+			return nil, err
+		}
+		delay = d.fixed
+	}
+	loc, err := dh.location()
+	if err != nil {
+		return nil, err
+	}
+	return &rollupJob{
+		config:   config,
+		interval: interval,
+		delay:    delay,
+		location: loc,
+		state:    rollupStateStopped,
+	}, nil
+}
+
+// status 返回作业状态（GET _rollup/job 的 status）
+func (j *rollupJob) status() map[string]interface{} {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	status := map[string]interface{}{
+		"job_state":       j.state,
+		"upgraded_doc_id": true,
+	}
+	if !j.position.IsZero() {
+		status["current_position"] = map[string]interface{}{
+			j.dateField() + ".date_histogram": j.position.UnixMilli(),
+		}
+	}
+	return status
+}
+
+// dateField 返回时间分组字段
+func (j *rollupJob) dateField() string {
+	return j.config.Groups.DateHistogram.Field
+}
+
+// rollupMetricValue 一组文档某个字段的指标
+type rollupMetricValue struct {
+	min, max *float64
+	sum      float64
+	count    int64
+}
+
+// add 累加一个数值
+func (m *rollupMetricValue) add(v float64) {
+	if m.min == nil || v < *m.min {
+		min := v
+		m.min = &min
+	}
+	if m.max == nil || v > *m.max {
+		max := v
+		m.max = &max
+	}
+	m.sum += v
+	m.count++
+}
+
+// merge 合并另一组的指标
+func (m *rollupMetricValue) merge(other *rollupMetricValue) {
+	if other.min != nil && (m.min == nil || *other.min < *m.min) {
+		v := *other.min
+		m.min = &v
+	}
+	if other.max != nil && (m.max == nil || *other.max > *m.max) {
+		v := *other.max
+		m.max = &v
+	}
+	m.sum += other.sum
+	m.count += other.count
+}
+
+// rollupRow 聚合的基本单元：一个 rollup 文档，或一个原始文档（按 terms 多值展开后的一个组合）
+type rollupRow struct {
+	timestamp time.Time
+	terms     map[string]interface{} // 缺失的 terms 字段为 nil
+	metrics   map[string]*rollupMetricValue
+	count     int64
+}
+
+// rowsFromSource 把原始文档转换为聚合行，没有有效时间字段的文档返回 nil
+func (j *rollupJob) rowsFromSource(source map[string]interface{}) []*rollupRow {
+	var ts time.Time
+	for _, v := range sourceFieldValues(source, j.dateField()) {
+		if t, ok := rollupDateValue(v); ok {
+			ts = t
+			break
+		}
+	}
+	if ts.IsZero() {
+		return nil
+	}
+
+	metrics := make(map[string]*rollupMetricValue, len(j.config.Metrics))
+	for _, m := range j.config.Metrics {
+		if _, ok := metrics[m.Field]; ok {
+			continue
+		}
+		value := &rollupMetricValue{}
+		for _, v := range sourceFieldValues(source, m.Field) {
+			if f, ok := rollupNumericValue(v); ok {
+				value.add(f)
+			}
+		}
+		metrics[m.Field] = value
+	}
+
+	// terms 多值字段按笛卡尔积展开，与 composite 聚合一致
+	combos := []map[string]interface{}{{}}
+	for _, field := range j.config.termsFields() {
+		values := sourceFieldValues(source, field)
+		if len(values) == 0 {
+			values = []interface{}{nil}
+		}
+		expanded := make([]map[string]interface{}, 0, len(combos)*len(values))
+		for _, combo := range combos {
+			for _, v := range values {
+				next := make(map[string]interface{}, len(combo)+1)
+				for k, cv := range combo {
+					next[k] = cv
+				}
+				next[field] = v
+				expanded = append(expanded, next)
+			}
+		}
+		combos = expanded
+	}
+
+	rows := make([]*rollupRow, 0, len(combos))
+	for _, combo := range combos {
+		rows = append(rows, &rollupRow{timestamp: ts, terms: combo, metrics: metrics, count: 1})
+	}
+	return rows
+}
+
+// rowFromRollupDoc 把 rollup 文档转换为聚合行，不属于该作业的文档返回 nil
+func (j *rollupJob) rowFromRollupDoc(source map[string]interface{}) *rollupRow {
+	if id, _ := firstSourceValue(source, "_rollup.id").(string); id != j.config.ID {
+		return nil
+	}
+	prefix := j.dateField() + ".date_histogram."
+	ms, ok := rollupNumericValue(firstSourceValue(source, prefix+"timestamp"))
+	if !ok {
+		return nil
+	}
+	count, _ := rollupNumericValue(firstSourceValue(source, prefix+"_count"))
+	row := &rollupRow{
+		timestamp: time.UnixMilli(int64(ms)).In(j.location),
+		terms:     make(map[string]interface{}),
+		metrics:   make(map[string]*rollupMetricValue),
+		count:     int64(count),
+	}
+	for _, field := range j.config.termsFields() {
+		row.terms[field] = firstSourceValue(source, field+".terms.value")
+	}
+	for _, m := range j.config.Metrics {
+		value, ok := row.metrics[m.Field]
+		if !ok {
+			value = &rollupMetricValue{}
+			row.metrics[m.Field] = value
+		}
+		for _, name := range m.Metrics {
+			v, ok := rollupNumericValue(firstSourceValue(source, m.Field+"."+name+".value"))
+			if !ok {
+				continue
+			}
+			switch name {
+			case "min":
+				value.min = &v
+			case "max":
+				value.max = &v
+			case "sum":
+				value.sum = v
+			case "value_count":
+				value.count = int64(v)
+			case "avg":
+				// avg 保存为 sum 与 _count，查询时再相除
+				value.sum = v
+				if c, ok := rollupNumericValue(firstSourceValue(source, m.Field+".avg._count")); ok {
+					value.count = int64(c)
+				}
+			}
+		}
+	}
+	return row
+}
+
+// rollupGroup 作业运行中一个分组的汇总结果
+type rollupGroup struct {
+	bucket  time.Time
+	terms   []interface{}
+	metrics map[string]*rollupMetricValue
+	count   int64
+}
+
+// groupKey 计算行所在分组的键
+func (j *rollupJob) groupKey(bucket time.Time, row *rollupRow) (string, []interface{}) {
+	fields := j.config.termsFields()
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		values[i] = row.terms[field]
+	}
+	keyJSON, _ := json.Marshal(values)
+	return strconv.FormatInt(bucket.UnixMilli(), 10) + "|" + string(keyJSON), values
+}
+
+// rollupDocID rollup 文档 ID：作业 ID 加分组键的哈希
+func (j *rollupJob) rollupDocID(key string) string {
+	h := fnv.New128a()
+	h.Write([]byte(key))
+	return j.config.ID + "$" + hex.EncodeToString(h.Sum(nil))
+}
+
+// rollupDoc 构建分组的 rollup 文档（字段名与 ES rollup 文档一致）
+func (j *rollupJob) rollupDoc(g *rollupGroup) map[string]interface{} {
+	dh := j.config.Groups.DateHistogram
+	prefix := dh.Field + ".date_histogram."
+	doc := map[string]interface{}{
+		prefix + "timestamp": g.bucket.UnixMilli(),
+		prefix + "interval":  dh.intervalString(),
+		prefix + "time_zone": dh.timeZone(),
+		prefix + "_count":    g.count,
+		"_rollup.id":         j.config.ID,
+		"_rollup.version":    rollupDocVersion,
+	}
+	for i, field := range j.config.termsFields() {
+		doc[field+".terms.value"] = g.terms[i]
+		doc[field+".terms._count"] = g.count
+	}
+	for _, m := range j.config.Metrics {
+		value := g.metrics[m.Field]
+		if value == nil {
+			value = &rollupMetricValue{}
+		}
+		for _, name := range m.Metrics {
+			switch name {
+			case "min":
+				if value.min != nil {
+					doc[m.Field+".min.value"] = *value.min
+				}
+			case "max":
+				if value.max != nil {
+					doc[m.Field+".max.value"] = *value.max
+				}
+			case "sum":
+				doc[m.Field+".sum.value"] = value.sum
+			case "value_count":
+				doc[m.Field+".value_count.value"] = value.count
+			case "avg":
+				doc[m.Field+".avg.value"] = value.sum
+				doc[m.Field+".avg._count"] = value.count
+			}
+		}
+	}
+	return doc
+}
+
+// sourceFieldValues 读取 _source 中字段的所有值，支持 "a.b" 键与嵌套对象混用，数组展开
+func sourceFieldValues(source map[string]interface{}, field string) []interface{} {
+	var values []interface{}
+	var collect func(v interface{})
+	collect = func(v interface{}) {
+		switch v := v.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		default:
+			values = append(values, v)
+		}
+	}
+	if v, ok := source[field]; ok {
+		collect(v)
+		return values
+	}
+	for i := 0; i < len(field); i++ {
+		if field[i] != '.' {
+			continue
+		}
+		switch obj := source[field[:i]].(type) {
+		case map[string]interface{}:
+			values = append(values, sourceFieldValues(obj, field[i+1:])...)
+		case []interface{}:
+			for _, item := range obj {
+				if m, ok := item.(map[string]interface{}); ok {
+					values = append(values, sourceFieldValues(m, field[i+1:])...)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// firstSourceValue 返回字段的第一个值
+func firstSourceValue(source map[string]interface{}, field string) interface{} {
+	if values := sourceFieldValues(source, field); len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// rollupNumericValue 把 _source 中的值转换为数值（数值字符串按 ES 的 coerce 规则转换）
+func rollupNumericValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// rollupDateValue 把 _source 中的日期值（毫秒时间戳或日期字符串）转换为时间
+func rollupDateValue(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case float64:
+		return time.UnixMilli(int64(v)).UTC(), true
+	case string:
+		t, err := parseDateString(v, "epoch_millis")
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// scanIndexSources 按 _id 顺序分页遍历索引的所有根文档，回调返回错误时停止
+func (h *DocumentHandler) scanIndexSources(ctx context.Context, idx bleve.Index, indexName string, fn func(source map[string]interface{}) error) error {
+	return h.scanIndexSourcesWithQuery(ctx, idx, indexName, bleve.NewMatchAllQuery(), fn)
+}
+
+// scanIndexSourcesWithQuery 按 _id 顺序分页遍历匹配查询的根文档，回调返回错误时停止
+func (h *DocumentHandler) scanIndexSourcesWithQuery(ctx context.Context, idx bleve.Index, indexName string, q query.Query, fn func(source map[string]interface{}) error) error {
+	return h.scanIndexDocuments(ctx, idx, indexName, q, func(_ string, doc index.Document) error {
+		return fn(h.extractDocumentFields(doc))
+	})
+}
+
+// scanIndexDocuments 按 _id 顺序分页遍历匹配查询的根文档，回调收到文档 ID 与存储的文档，返回错误时停止
+func (h *DocumentHandler) scanIndexDocuments(ctx context.Context, idx bleve.Index, indexName string, q query.Query, fn func(id string, doc index.Document) error) error {
+	q, err := h.resolveRootQuery(idx, indexName, q)
+	if err != nil {
+		return err
+	}
+	advancedIdx, err := idx.Advanced()
+	if err != nil {
+		return err
+	}
+	var after []string
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		req := bleve.NewSearchRequest(q)
+		req.Size = rollupScanPageSize
+		req.SortBy([]string{"_id"})
+		if after != nil {
+			req.SearchAfter = after
+		}
+		result, err := idx.SearchInContext(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		reader, err := advancedIdx.Reader()
+		if err != nil {
+			return err
+		}
+		for _, hit := range result.Hits {
+			doc, err := reader.Document(hit.ID)
+			if err != nil || doc == nil {
+				continue
+			}
+			if err := fn(hit.ID, doc); err != nil {
+				reader.Close()
+				return err
+			}
+		}
+		reader.Close()
+
+		if len(result.Hits) < req.Size {
+			return nil
+		}
+		after = []string{result.Hits[len(result.Hits)-1].ID}
+	}
+}
+
+// sourceIndices 解析作业 index_pattern（逗号分隔，支持通配符）对应的源索引，排除 rollup 索引
+func (h *RollupHandler) sourceIndices(config *RollupJobConfig) []string {
+	allIndices, err := h.dirMgr.ListIndices()
+	if err != nil {
+		return nil
+	}
+	var indices []string
+	seen := make(map[string]bool)
+	for _, pattern := range splitCommaList(config.IndexPattern) {
+		for _, name := range allIndices {
+			if seen[name] || name == config.RollupIndex || isRollupIndex(h.metaStore, name) {
+				continue
+			}
+			if name == pattern || (strings.Contains(pattern, "*") && simpleWildcardMatch(pattern, name)) {
+				seen[name] = true
+				indices = append(indices, name)
+			}
+		}
+	}
+	sort.Strings(indices)
+	return indices
+}
+
+// scanRollupRows 读取 rollup 索引中属于作业的所有行
+func (h *RollupHandler) scanRollupRows(ctx context.Context, job *rollupJob) ([]*rollupRow, error) {
+	idx, err := h.docHandler.indexMgr.GetIndex(job.config.RollupIndex)
+	if err != nil {
+		return nil, err
+	}
+	var rows []*rollupRow
+	err = h.docHandler.scanIndexSources(ctx, idx, job.config.RollupIndex, func(source map[string]interface{}) error {
+		if row := job.rowFromRollupDoc(source); row != nil {
+			rows = append(rows, row)
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// runJob 执行一次作业：汇总 [position, floor(now - delay)) 内完整的时间桶
+func (h *RollupHandler) runJob(ctx context.Context, job *rollupJob) error {
+	start := time.Now()
+	if !job.positionLoaded {
+		// 从 rollup 索引恢复进度，避免重启后用已删除部分原始数据的源索引覆盖旧的汇总结果
+		rows, err := h.scanRollupRows(ctx, job)
+		if err != nil {
+			return fmt.Errorf("failed to load rollup position: %w", err)
+		}
+		var position time.Time
+		for _, row := range rows {
+			if end := job.interval.next(row.timestamp); end.After(position) {
+				position = end
+			}
+		}
+		job.mutex.Lock()
+		job.position = position
+		job.positionLoaded = true
+		job.mutex.Unlock()
+	}
+
+	job.mutex.Lock()
+	from := job.position
+	job.mutex.Unlock()
+	end := job.interval.floor(time.Now().Add(-job.delay), job.location)
+	if !from.IsZero() && !end.After(from) {
+		return nil
+	}
+
+	groups := make(map[string]*rollupGroup)
+	var keys []string
+	var docs int64
+	searchStart := time.Now()
+	for _, name := range h.sourceIndices(job.config) {
+		idx, err := h.docHandler.indexMgr.GetIndex(name)
+		if err != nil {
+			job.mutex.Lock()
+			job.stats.SearchFailures++
+			job.mutex.Unlock()
+			return fmt.Errorf("failed to get index [%s]: %w", name, err)
+		}
+		err = h.docHandler.scanIndexSources(ctx, idx, name, func(source map[string]interface{}) error {
+			rows := job.rowsFromSource(source)
+			if len(rows) == 0 || rows[0].timestamp.Before(from) || !rows[0].timestamp.Before(end) {
+				return nil
+			}
+			docs++
+			bucket := job.interval.floor(rows[0].timestamp, job.location)
+			for _, row := range rows {
+				key, values := job.groupKey(bucket, row)
+				g, ok := groups[key]
+				if !ok {
+					g = &rollupGroup{bucket: bucket, terms: values, metrics: make(map[string]*rollupMetricValue)}
+					groups[key] = g
+					keys = append(keys, key)
+				}
+				g.count += row.count
+				for field, value := range row.metrics {
+					if g.metrics[field] == nil {
+						g.metrics[field] = &rollupMetricValue{}
+					}
+					g.metrics[field].merge(value)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			job.mutex.Lock()
+			job.stats.SearchFailures++
+			job.mutex.Unlock()
+			return fmt.Errorf("failed to search index [%s]: %w", name, err)
+		}
+	}
+	job.mutex.Lock()
+	job.stats.DocumentsProcessed += docs
+	job.stats.SearchTotal++
+	job.stats.SearchTimeInMs += time.Since(searchStart).Milliseconds()
+	job.mutex.Unlock()
+
+	if len(keys) > 0 {
+		rollupIdx, err := h.docHandler.indexMgr.GetIndex(job.config.RollupIndex)
+		if err != nil {
+			return fmt.Errorf("failed to get rollup index [%s]: %w", job.config.RollupIndex, err)
+		}
+		sort.Strings(keys)
+		for pageStart := 0; pageStart < len(keys); pageStart += job.config.PageSize {
+			pageEnd := pageStart + job.config.PageSize
+			if pageEnd > len(keys) {
+				pageEnd = len(keys)
+			}
+			items := make([]BulkRequest, 0, pageEnd-pageStart)
+			for _, key := range keys[pageStart:pageEnd] {
+				items = append(items, BulkRequest{
+					Action: "index",
+					Index:  job.config.RollupIndex,
+					ID:     job.rollupDocID(key),
+					Source: job.rollupDoc(groups[key]),
+				})
+			}
+			indexStart := time.Now()
+			results := h.docHandler.executeBulkOperationsBatch(rollupIdx, job.config.RollupIndex, items)
+			var failures int64
+			for _, result := range results {
+				for _, item := range result {
+					if m, ok := item.(map[string]interface{}); ok && m["error"] != nil {
+						failures++
+					}
+				}
+			}
+			job.mutex.Lock()
+			job.stats.PagesProcessed++
+			job.stats.IndexTotal++
+			job.stats.IndexTimeInMs += time.Since(indexStart).Milliseconds()
+			job.stats.RollupsIndexed += int64(len(items)) - failures
+			job.stats.IndexFailures += failures
+			job.mutex.Unlock()
+			if failures > 0 {
+				return fmt.Errorf("failed to index %d rollup documents into [%s]", failures, job.config.RollupIndex)
+			}
+		}
+	}
+
+	job.mutex.Lock()
+	job.position = end
+	job.stats.ProcessingTotal++
+	job.stats.ProcessingTimeInMs += time.Since(start).Milliseconds()
+	job.mutex.Unlock()
+	return nil
+}
+
+// startJob 启动作业的后台调度：立即触发一次，之后按 rollupTriggerInterval 触发（调用方持有 job.mutex）
+func (h *RollupHandler) startJob(job *rollupJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	job.state = rollupStateStarted
+	job.cancel = cancel
+	job.done = done
+
+	go func() {
+		defer close(done)
+		defer func() {
+			job.mutex.Lock()
+			job.state = rollupStateStopped
+			job.mutex.Unlock()
+		}()
+		ticker := time.NewTicker(rollupTriggerInterval)
+		defer ticker.Stop()
+		for {
+			job.mutex.Lock()
+			if job.state != rollupStateStarted {
+				job.mutex.Unlock()
+				return
+			}
+			job.state = rollupStateIndexing
+			job.stats.TriggerCount++
+			job.mutex.Unlock()
+
+			if err := h.runJob(ctx, job); err != nil && ctx.Err() == nil {
+				logger.Error("Rollup job [%s] failed: %v", job.config.ID, err)
+			}
+
+			job.mutex.Lock()
+			if job.state == rollupStateIndexing {
+				job.state = rollupStateStarted
+			}
+			job.mutex.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopJob 停止作业，返回等待后台调度退出的通道（作业未运行时为 nil）
+func (j *rollupJob) stopJob() <-chan struct{} {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.state == rollupStateStopped || j.cancel == nil {
+		return nil
+	}
+	j.state = rollupStateStopping
+	j.cancel()
+	return j.done
+}
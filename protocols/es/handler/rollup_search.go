@@ -0,0 +1,717 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// _rollup_search
+// 请求的目标中最多一个 rollup 索引，其余为原始数据索引。rollup 数据覆盖到作业已汇总的时间
+// （最后一个 rollup 桶的结束时间），之后的时间从原始数据索引读取，两部分合并后按请求的
+// 聚合计算结果。只支持 rollup 作业能回答的查询（term/terms/range/bool/match_all）与聚合
+// （date_histogram/terms/min/max/sum/avg/value_count），不返回命中文档。
+
+// rollupAggNode 解析后的 rollup 聚合
+type rollupAggNode struct {
+	name        string
+	kind        string
+	field       string
+	interval    rollupInterval
+	timeZone    string
+	location    *time.Location
+	format      string
+	minDocCount int
+	size        int
+	subs        []*rollupAggNode
+}
+
+// parseRollupAggs 解析聚合树
+func parseRollupAggs(spec map[string]interface{}) ([]*rollupAggNode, common.APIError) {
+	names := make([]string, 0, len(spec))
+	for name := range spec {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nodes := make([]*rollupAggNode, 0, len(names))
+	for _, name := range names {
+		def, ok := spec[name].(map[string]interface{})
+		if !ok {
+			return nil, common.NewBadRequestError(fmt.Sprintf("Expected [START_OBJECT] under [%s], but got a different token", name))
+		}
+		node := &rollupAggNode{name: name}
+		var subSpec map[string]interface{}
+		for key, value := range def {
+			switch key {
+			case "aggs", "aggregations":
+				subSpec, _ = value.(map[string]interface{})
+			case "meta":
+			default:
+				if node.kind != "" {
+					return nil, common.NewBadRequestError(fmt.Sprintf("Found two aggregation type definitions in [%s]: [%s] and [%s]", name, node.kind, key))
+				}
+				body, _ := value.(map[string]interface{})
+				if apiErr := node.parse(key, body); apiErr != nil {
+					return nil, apiErr
+				}
+			}
+		}
+		if node.kind == "" {
+			return nil, common.NewBadRequestError(fmt.Sprintf("Missing definition for aggregation [%s]", name))
+		}
+		if len(subSpec) > 0 {
+			if node.kind != "date_histogram" && node.kind != "terms" {
+				return nil, common.NewBadRequestError(fmt.Sprintf("Aggregator [%s] of type [%s] cannot accept sub-aggregations", name, node.kind))
+			}
+			subs, apiErr := parseRollupAggs(subSpec)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			node.subs = subs
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// parse 解析单个聚合的定义
+func (n *rollupAggNode) parse(kind string, body map[string]interface{}) common.APIError {
+	n.kind = kind
+	n.field, _ = body["field"].(string)
+	switch kind {
+	case "date_histogram":
+		group := RollupDateHistogramGroup{Field: n.field}
+		group.FixedInterval, _ = body["fixed_interval"].(string)
+		group.CalendarInterval, _ = body["calendar_interval"].(string)
+		group.Interval, _ = body["interval"].(string)
+		group.TimeZone, _ = body["time_zone"].(string)
+		interval, err := group.interval()
+		if err != nil {
+			return common.NewBadRequestError(err.Error())
+		}
+		loc, err := group.location()
+		if err != nil {
+			return common.NewBadRequestError(err.Error())
+		}
+		n.interval = interval
+		n.timeZone = group.timeZone()
+		n.location = loc
+		n.format, _ = body["format"].(string)
+		if v, ok := body["min_doc_count"].(float64); ok {
+			n.minDocCount = int(v)
+		}
+	case "terms":
+		n.size = 10
+		if v, ok := body["size"].(float64); ok {
+			n.size = int(v)
+		}
+	case "min", "max", "sum", "avg", "value_count":
+	default:
+		return common.NewBadRequestError(fmt.Sprintf("Unable to translate aggregation tree into Rollup.  Aggregation [%s] is of type [%s] which is currently unsupported.", n.name, kind))
+	}
+	if n.field == "" {
+		return common.NewBadRequestError(fmt.Sprintf("Required one of fields [field, script], but none were specified in aggregation [%s]", n.name))
+	}
+	return nil
+}
+
+// supportedBy 检查作业能否回答聚合，不能时返回原因
+func (n *rollupAggNode) supportedBy(job *rollupJob) error {
+	ok := false
+	switch n.kind {
+	case "date_histogram":
+		ok = n.field == job.dateField() && job.interval.divides(n.interval) &&
+			n.timeZone == job.config.Groups.DateHistogram.timeZone()
+	case "terms":
+		for _, field := range job.config.termsFields() {
+			ok = ok || field == n.field
+		}
+	default:
+		ok = job.config.hasMetric(n.field, n.kind)
+	}
+	if !ok {
+		return fmt.Errorf("There is not a rollup job that has a [%s] agg on field [%s] which also satisfies all requirements of query.", n.kind, n.field)
+	}
+	for _, sub := range n.subs {
+		if err := sub.supportedBy(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollupQuery 解析后的 rollup 查询
+type rollupQuery struct {
+	kind    string // match_all, term, terms, range, bool
+	field   string
+	values  map[string]bool
+	from    *time.Time
+	to      *time.Time
+	fromInc bool
+	toInc   bool
+	must    []*rollupQuery
+	should  []*rollupQuery
+	mustNot []*rollupQuery
+}
+
+// parseRollupQuery 解析查询，空查询等价于 match_all
+func parseRollupQuery(spec map[string]interface{}) (*rollupQuery, common.APIError) {
+	if len(spec) == 0 {
+		return &rollupQuery{kind: "match_all"}, nil
+	}
+	if len(spec) > 1 {
+		return nil, common.NewBadRequestError("[_na] query malformed, must start with start_object")
+	}
+	for kind, raw := range spec {
+		body, _ := raw.(map[string]interface{})
+		switch kind {
+		case "match_all":
+			return &rollupQuery{kind: kind}, nil
+		case "constant_score":
+			filter, _ := body["filter"].(map[string]interface{})
+			return parseRollupQuery(filter)
+		case "bool":
+			q := &rollupQuery{kind: kind}
+			for _, clause := range []string{"must", "filter", "should", "must_not"} {
+				var specs []interface{}
+				switch v := body[clause].(type) {
+				case map[string]interface{}:
+					specs = []interface{}{v}
+				case []interface{}:
+					specs = v
+				}
+				for _, s := range specs {
+					m, _ := s.(map[string]interface{})
+					sub, apiErr := parseRollupQuery(m)
+					if apiErr != nil {
+						return nil, apiErr
+					}
+					switch clause {
+					case "must", "filter":
+						q.must = append(q.must, sub)
+					case "should":
+						q.should = append(q.should, sub)
+					default:
+						q.mustNot = append(q.mustNot, sub)
+					}
+				}
+			}
+			return q, nil
+		case "term", "terms":
+			q := &rollupQuery{kind: kind, values: make(map[string]bool)}
+			for field, v := range body {
+				if field == "boost" {
+					continue
+				}
+				q.field = field
+				var values []interface{}
+				switch v := v.(type) {
+				case map[string]interface{}:
+					values = []interface{}{v["value"]}
+				case []interface{}:
+					values = v
+				default:
+					values = []interface{}{v}
+				}
+				for _, value := range values {
+					q.values[rollupValueKey(value)] = true
+				}
+			}
+			if q.field == "" {
+				return nil, common.NewBadRequestError(fmt.Sprintf("[%s] query requires a field", kind))
+			}
+			return q, nil
+		case "range":
+			q := &rollupQuery{kind: kind}
+			for field, v := range body {
+				q.field = field
+				bounds, _ := v.(map[string]interface{})
+				format, _ := bounds["format"].(string)
+				zone, _ := bounds["time_zone"].(string)
+				loc, err := parseTimeZone(zone)
+				if err != nil {
+					return nil, common.NewBadRequestError(err.Error())
+				}
+				now := time.Now()
+				for op, bound := range bounds {
+					if op == "format" || op == "time_zone" || op == "boost" || bound == nil {
+						continue
+					}
+					t, err := parseDateMathBound(bound, format, loc, now, op == "gt" || op == "lte" || op == "to")
+					if err != nil {
+						return nil, common.NewBadRequestError(fmt.Sprintf("failed to parse date field [%v] in [range] query: %v", bound, err))
+					}
+					switch op {
+					case "gte", "from":
+						q.from, q.fromInc = &t, true
+					case "gt":
+						q.from, q.fromInc = &t, false
+					case "lte", "to":
+						q.to, q.toInc = &t, true
+					case "lt":
+						q.to, q.toInc = &t, false
+					}
+				}
+			}
+			return q, nil
+		default:
+			return nil, common.NewBadRequestError(fmt.Sprintf("Unsupported Query in search request: [%s]", kind))
+		}
+	}
+	return nil, nil
+}
+
+// supportedBy 检查作业是否包含查询引用的字段
+func (q *rollupQuery) supportedBy(job *rollupJob) error {
+	switch q.kind {
+	case "term", "terms":
+		for _, field := range job.config.termsFields() {
+			if field == q.field {
+				return nil
+			}
+		}
+		return fmt.Errorf("Field [%s] in [%s] query is not available in selected rollup indices, cannot query.", q.field, q.kind)
+	case "range":
+		if q.field != job.dateField() {
+			return fmt.Errorf("Field [%s] in [range] query is not available in selected rollup indices, cannot query.", q.field)
+		}
+	case "bool":
+		for _, clauses := range [][]*rollupQuery{q.must, q.should, q.mustNot} {
+			for _, sub := range clauses {
+				if err := sub.supportedBy(job); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matches 判断行是否满足查询（rollup 行按桶起始时间比较时间范围）
+func (q *rollupQuery) matches(row *rollupRow) bool {
+	switch q.kind {
+	case "term", "terms":
+		v := row.terms[q.field]
+		return v != nil && q.values[rollupValueKey(v)]
+	case "range":
+		if q.from != nil && (row.timestamp.Before(*q.from) || (!q.fromInc && row.timestamp.Equal(*q.from))) {
+			return false
+		}
+		if q.to != nil && (row.timestamp.After(*q.to) || (!q.toInc && row.timestamp.Equal(*q.to))) {
+			return false
+		}
+		return true
+	case "bool":
+		for _, sub := range q.must {
+			if !sub.matches(row) {
+				return false
+			}
+		}
+		for _, sub := range q.mustNot {
+			if sub.matches(row) {
+				return false
+			}
+		}
+		if len(q.should) > 0 && len(q.must) == 0 {
+			for _, sub := range q.should {
+				if sub.matches(row) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// rollupValueKey 比较 terms 值时使用的键（数值与数值字符串等价）
+func rollupValueKey(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// aggregateRollupRows 在行上计算聚合
+func aggregateRollupRows(nodes []*rollupAggNode, rows []*rollupRow) map[string]interface{} {
+	result := make(map[string]interface{}, len(nodes))
+	for _, node := range nodes {
+		switch node.kind {
+		case "date_histogram":
+			result[node.name] = aggregateRollupDateHistogram(node, rows)
+		case "terms":
+			result[node.name] = aggregateRollupTerms(node, rows)
+		default:
+			result[node.name] = aggregateRollupMetric(node, rows)
+		}
+	}
+	return result
+}
+
+// rollupBucket 聚合过程中的桶
+type rollupBucket struct {
+	key   interface{}
+	count int64
+	rows  []*rollupRow
+}
+
+// toResponse 构建桶的响应，有子聚合时放在 aggregations 中
+func (b *rollupBucket) toResponse(node *rollupAggNode) map[string]interface{} {
+	bucket := map[string]interface{}{
+		"key":       b.key,
+		"doc_count": b.count,
+	}
+	if len(node.subs) > 0 {
+		bucket["aggregations"] = aggregateRollupRows(node.subs, b.rows)
+	}
+	return bucket
+}
+
+// aggregateRollupDateHistogram 计算 date_histogram，min_doc_count 为 0 时补齐首尾之间的空桶
+func aggregateRollupDateHistogram(node *rollupAggNode, rows []*rollupRow) map[string]interface{} {
+	buckets := make(map[int64]*rollupBucket)
+	var first, last time.Time
+	for _, row := range rows {
+		start := node.interval.floor(row.timestamp, node.location)
+		key := start.UnixMilli()
+		b, ok := buckets[key]
+		if !ok {
+			b = &rollupBucket{key: key}
+			buckets[key] = b
+			if first.IsZero() || start.Before(first) {
+				first = start
+			}
+			if start.After(last) {
+				last = start
+			}
+		}
+		b.count += row.count
+		b.rows = append(b.rows, row)
+	}
+
+	var keys []int64
+	if node.minDocCount == 0 && !first.IsZero() {
+		for t := first; !t.After(last); t = node.interval.next(t) {
+			keys = append(keys, t.UnixMilli())
+		}
+	} else {
+		for key := range buckets {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	}
+
+	results := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		b, ok := buckets[key]
+		if !ok {
+			b = &rollupBucket{key: key}
+		}
+		if b.count < int64(node.minDocCount) {
+			continue
+		}
+		bucket := b.toResponse(node)
+		bucket["key_as_string"] = formatDateValue(time.UnixMilli(key), node.format)
+		results = append(results, bucket)
+	}
+	return map[string]interface{}{"buckets": results}
+}
+
+// aggregateRollupTerms 计算 terms，按文档数降序、键升序排列
+func aggregateRollupTerms(node *rollupAggNode, rows []*rollupRow) map[string]interface{} {
+	buckets := make(map[string]*rollupBucket)
+	var keys []string
+	for _, row := range rows {
+		v := row.terms[node.field]
+		if v == nil {
+			continue
+		}
+		key := rollupValueKey(v)
+		b, ok := buckets[key]
+		if !ok {
+			b = &rollupBucket{key: v}
+			buckets[key] = b
+			keys = append(keys, key)
+		}
+		b.count += row.count
+		b.rows = append(b.rows, row)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ci, cj := buckets[keys[i]].count, buckets[keys[j]].count; ci != cj {
+			return ci > cj
+		}
+		return keys[i] < keys[j]
+	})
+
+	var other int64
+	results := make([]map[string]interface{}, 0, len(keys))
+	for i, key := range keys {
+		if node.size > 0 && i >= node.size {
+			other += buckets[key].count
+			continue
+		}
+		results = append(results, buckets[key].toResponse(node))
+	}
+	return map[string]interface{}{
+		"doc_count_error_upper_bound": 0,
+		"sum_other_doc_count":         other,
+		"buckets":                     results,
+	}
+}
+
+// aggregateRollupMetric 计算指标聚合
+func aggregateRollupMetric(node *rollupAggNode, rows []*rollupRow) map[string]interface{} {
+	total := &rollupMetricValue{}
+	for _, row := range rows {
+		if value := row.metrics[node.field]; value != nil {
+			total.merge(value)
+		}
+	}
+	var value interface{}
+	switch node.kind {
+	case "min":
+		if total.min != nil {
+			value = *total.min
+		}
+	case "max":
+		if total.max != nil {
+			value = *total.max
+		}
+	case "sum":
+		value = total.sum
+	case "avg":
+		if total.count > 0 {
+			value = total.sum / float64(total.count)
+		}
+	case "value_count":
+		value = total.count
+	}
+	return map[string]interface{}{"value": value}
+}
+
+// resolveRollupSearchTargets 解析 _rollup_search 的目标索引，分为 rollup 索引与原始数据索引
+func (h *RollupHandler) resolveRollupSearchTargets(indexExpr string) (rollupIndices, liveIndices []string, apiErr common.APIError) {
+	allIndices, err := h.dirMgr.ListIndices()
+	if err != nil {
+		return nil, nil, common.NewInternalServerError("failed to list indices: " + err.Error())
+	}
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		if isRollupIndex(h.metaStore, name) {
+			rollupIndices = append(rollupIndices, name)
+		} else {
+			liveIndices = append(liveIndices, name)
+		}
+	}
+	for _, expr := range splitCommaList(indexExpr) {
+		if strings.Contains(expr, "*") {
+			for _, name := range allIndices {
+				if simpleWildcardMatch(expr, name) {
+					add(name)
+				}
+			}
+			continue
+		}
+		if !h.dirMgr.IndexExists(expr) {
+			return nil, nil, common.NewIndexNotFoundError(expr)
+		}
+		add(expr)
+	}
+	sort.Strings(rollupIndices)
+	sort.Strings(liveIndices)
+	return rollupIndices, liveIndices, nil
+}
+
+// RollupSearch 合并 rollup 数据与原始数据的聚合查询
+// GET /{index}/_rollup_search
+// POST /{index}/_rollup_search
+func (h *RollupHandler) RollupSearch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rollupIndices, liveIndices, apiErr := h.resolveRollupSearchTargets(mux.Vars(r)["index"])
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if len(rollupIndices) == 0 {
+		common.HandleError(w, common.NewBadRequestError("Must specify at least one rollup index in _rollup_search API"))
+		return
+	}
+	if len(rollupIndices) > 1 {
+		common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("RollupSearch currently only supports searching one rollup index at a time. Found the following rollup indices: %v", rollupIndices)))
+		return
+	}
+	for _, name := range append(append([]string{}, rollupIndices...), liveIndices...) {
+		if apiErr := checkIndexBlock(h.metaStore, name, blockLevelRead); apiErr != nil {
+			common.HandleError(w, apiErr)
+			return
+		}
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	if size, ok := body["size"].(float64); ok && size != 0 {
+		common.HandleError(w, common.NewBadRequestError("Rollup does not support returning search hits, please try again with [size: 0]."))
+		return
+	}
+	aggSpec, _ := body["aggregations"].(map[string]interface{})
+	if aggSpec == nil {
+		aggSpec, _ = body["aggs"].(map[string]interface{})
+	}
+	aggs, apiErr := parseRollupAggs(aggSpec)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	querySpec, _ := body["query"].(map[string]interface{})
+	q, apiErr := parseRollupQuery(querySpec)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	// 选择第一个能回答全部查询与聚合的作业
+	meta, err := h.metaStore.GetIndexMetadata(rollupIndices[0])
+	if err != nil || meta == nil {
+		common.HandleError(w, common.NewIndexNotFoundError(rollupIndices[0]))
+		return
+	}
+	configs, _ := rollupJobsFromMeta(meta)
+	var job *rollupJob
+	var reason error
+	for _, config := range configs {
+		candidate, err := newRollupJob(config)
+		if err != nil {
+			continue
+		}
+		if err := q.supportedBy(candidate); err != nil {
+			reason = err
+			continue
+		}
+		for _, node := range aggs {
+			if err = node.supportedBy(candidate); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			reason = err
+			continue
+		}
+		job = candidate
+		break
+	}
+	if job == nil {
+		if reason == nil {
+			reason = fmt.Errorf("No rollup jobs were found in index [%s]", rollupIndices[0])
+		}
+		common.HandleError(w, common.NewBadRequestError(reason.Error()))
+		return
+	}
+
+	ctx := r.Context()
+	rows, err := h.scanRollupRows(ctx, job)
+	if err != nil {
+		logger.Error("Failed to read rollup index [%s]: %v", rollupIndices[0], err)
+		common.HandleError(w, common.NewInternalServerError("failed to read rollup index: "+err.Error()))
+		return
+	}
+	// rollup 数据之后的时间由原始数据补充
+	var boundary time.Time
+	for _, row := range rows {
+		if end := job.interval.next(row.timestamp); end.After(boundary) {
+			boundary = end
+		}
+	}
+	for _, name := range liveIndices {
+		idx, err := h.docHandler.indexMgr.GetIndex(name)
+		if err != nil {
+			common.HandleError(w, common.NewInternalServerError("failed to get index: "+err.Error()))
+			return
+		}
+		err = h.docHandler.scanIndexSources(ctx, idx, name, func(source map[string]interface{}) error {
+			for _, row := range job.rowsFromSource(source) {
+				if !row.timestamp.Before(boundary) {
+					rows = append(rows, row)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				common.HandleError(w, searchCancelledError(ctx))
+				return
+			}
+			common.HandleError(w, common.NewInternalServerError(fmt.Sprintf("failed to search index [%s]: %v", name, err)))
+			return
+		}
+	}
+
+	matched := rows[:0]
+	for _, row := range rows {
+		if q.matches(row) {
+			matched = append(matched, row)
+		}
+	}
+
+	shards := len(rollupIndices) + len(liveIndices)
+	response := map[string]interface{}{
+		"took":             time.Since(start).Milliseconds(),
+		"timed_out":        false,
+		"terminated_early": false,
+		"_shards": map[string]interface{}{
+			"total":      shards,
+			"successful": shards,
+			"skipped":    0,
+			"failed":     0,
+		},
+		"hits": map[string]interface{}{
+			"total":     map[string]interface{}{"value": 0, "relation": "eq"},
+			"max_score": 0,
+			"hits":      []interface{}{},
+		},
+	}
+	if len(aggs) > 0 {
+		response["aggregations"] = aggregateRollupRows(aggs, matched)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode rollup search response: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 文档路由（routing）
+// 写入时的 routing（URL 参数或 bulk 操作行的 routing）随文档存储在 _routing 字段中，get 与搜索结果中返回，
+// 将来多分片部署时按存储的 routing 一致地选择分片。单分片下任意 routing 都落在同一个分片，
+// 与 ES 单分片索引一致，get/search 的 routing 不过滤文档。
+// mapping 中设置 "_routing": {"required": true} 后，index/create/update/delete/get 未指定 routing 时返回 routing_missing_exception。
+
+// routingField 存储文档 routing 的内部字段
+const routingField = "_routing"
+
+// validateRoutingMapping 校验 mapping 中的 _routing 配置
+func validateRoutingMapping(mapping map[string]interface{}) error {
+	v, ok := mapping[routingField]
+	if !ok || v == nil {
+		return nil
+	}
+	def, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("[%s] config must be an object", routingField)
+	}
+	for key, value := range def {
+		if key != "required" {
+			return fmt.Errorf("unknown parameter [%s] on mapper [%s]", key, routingField)
+		}
+		if _, err := parseRoutingRequired(value); err != nil {
+			return fmt.Errorf("failed to parse [%s.required]: %v", routingField, err)
+		}
+	}
+	return nil
+}
+
+// mappingRoutingRequired mapping 中的 _routing.required，未设置时为 false
+func mappingRoutingRequired(mapping map[string]interface{}) bool {
+	def, ok := mapping[routingField].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	required, _ := parseRoutingRequired(def["required"])
+	return required
+}
+
+// parseRoutingRequired 解析 _routing.required，兼容字符串形式的布尔值
+func parseRoutingRequired(v interface{}) (bool, error) {
+	switch value := v.(type) {
+	case bool:
+		return value, nil
+	case string:
+		return strconv.ParseBool(value)
+	default:
+		return false, fmt.Errorf("expected a boolean, got [%v]", v)
+	}
+}
+
+// routingRequired 索引的 mapping 是否要求 routing
+func routingRequired(metaStore metadata.MetadataStore, indexName string) bool {
+	if metaStore == nil {
+		return false
+	}
+	indexMeta, err := metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return false
+	}
+	return mappingRoutingRequired(indexMeta.Mapping)
+}
+
+// checkRouting 索引要求 routing 而未指定时返回 routing_missing_exception
+func checkRouting(metaStore metadata.MetadataStore, indexName, docID, routing string) common.APIError {
+	if routing == "" && routingRequired(metaStore, indexName) {
+		return common.NewRoutingMissingError(indexName, docID)
+	}
+	return nil
+}
+
+// requestRouting 请求的 routing 参数
+func requestRouting(r *http.Request) string {
+	return r.URL.Query().Get("routing")
+}
+
+// parseRoutingValue 解析 bulk/mget 中的 routing，支持字符串与数字
+func parseRoutingValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// setDocumentRouting 将 routing 写入待索引的文档字段
+func setDocumentRouting(docData map[string]interface{}, routing string) {
+	if routing != "" {
+		docData[routingField] = routing
+	}
+}
+
+// documentRouting 读取文档存储的 routing，未指定时返回 ""
+func documentRouting(doc index.Document) string {
+	var routing string
+	doc.VisitFields(func(field index.Field) {
+		if field.Name() != routingField {
+			return
+		}
+		if textField, ok := field.(index.TextField); ok {
+			routing = textField.Text()
+		}
+	})
+	return routing
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_Routing(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_mapping", Handler: indexHandler.UpdateMapping},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/_mget", Handler: docHandler.MultiGet},
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "DELETE", Path: "/{index}/_doc/{id}", Handler: docHandler.DeleteDocument},
+		{Method: "POST", Path: "/{index}/_update/{id}", Handler: docHandler.UpdateDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		t.Helper()
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+		return body
+	}
+	expectRoutingMissing := func(name string, w *httptest.ResponseRecorder) {
+		t.Helper()
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "routing_missing_exception") ||
+			!strings.Contains(w.Body.String(), "routing is required for [orders]/[1]") {
+			t.Errorf("%s: expected routing_missing_exception, got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	// 非法的 _routing 配置
+	for _, mapping := range []string{`{"_routing":{"required":"maybe"}}`, `{"_routing":{"partition":1}}`, `{"_routing":true}`} {
+		if w := do("PUT", "/invalid", `{"mappings":`+mapping+`}`); w.Code != http.StatusBadRequest ||
+			!strings.Contains(w.Body.String(), "mapper_parsing_exception") {
+			t.Errorf("%s: expected mapper_parsing_exception, got %d: %s", mapping, w.Code, w.Body.String())
+		}
+	}
+
+	if w := do("PUT", "/orders", `{"mappings":{"_routing":{"required":true},"properties":{"user":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	expectRoutingMissing("index", do("PUT", "/orders/_doc/1", `{"user":"alice"}`))
+	if w := do("PUT", "/orders/_doc/1?routing=alice", `{"user":"alice"}`); w.Code != http.StatusCreated {
+		t.Fatalf("index with routing: got %d: %s", w.Code, w.Body.String())
+	}
+
+	expectRoutingMissing("get", do("GET", "/orders/_doc/1", ""))
+	w := do("GET", "/orders/_doc/1?routing=alice", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get: got %d: %s", w.Code, w.Body.String())
+	}
+	got := decode(w)
+	source, _ := got["_source"].(map[string]interface{})
+	if got["_routing"] != "alice" || source["user"] != "alice" || source["_routing"] != nil {
+		t.Errorf("unexpected get response: %s", w.Body.String())
+	}
+
+	// 部分更新未指定 routing 时保留原有的 routing
+	expectRoutingMissing("update", do("POST", "/orders/_update/1", `{"doc":{"status":"paid"}}`))
+	if w := do("POST", "/orders/_update/1?routing=alice", `{"doc":{"status":"paid"}}`); w.Code != http.StatusOK {
+		t.Fatalf("update: got %d: %s", w.Code, w.Body.String())
+	}
+	if got := decode(do("GET", "/orders/_doc/1?routing=alice", "")); got["_routing"] != "alice" {
+		t.Errorf("expected routing to survive update, got %v", got)
+	}
+
+	// bulk 操作行中的 routing（兼容旧的 _routing 写法与数字）
+	bulk := "{\"index\":{\"_index\":\"orders\",\"_id\":\"2\",\"routing\":\"bob\"}}\n{\"user\":\"bob\"}\n" +
+		"{\"index\":{\"_index\":\"orders\",\"_id\":\"3\",\"_routing\":42}}\n{\"user\":\"carol\"}\n" +
+		"{\"index\":{\"_index\":\"orders\",\"_id\":\"4\"}}\n{\"user\":\"dave\"}\n"
+	w = do("POST", "/_bulk?refresh=true", bulk)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+	items, _ := decode(w)["items"].([]interface{})
+	if len(items) != 3 {
+		t.Fatalf("expected 3 bulk items, got %s", w.Body.String())
+	}
+	errTypes := make(map[string]string)
+	for _, item := range items {
+		item := item.(map[string]interface{})["index"].(map[string]interface{})
+		errTypes[item["_id"].(string)] = ""
+		if e, ok := item["error"].(map[string]interface{}); ok {
+			errTypes[item["_id"].(string)], _ = e["type"].(string)
+		}
+	}
+	if errTypes["2"] != "" || errTypes["3"] != "" || errTypes["4"] != "routing_missing_exception" {
+		t.Errorf("unexpected bulk errors %v: %s", errTypes, w.Body.String())
+	}
+
+	// 搜索结果返回每个文档的 routing（单分片下 routing 参数不过滤文档）
+	w = do("POST", "/orders/_search?routing=bob", `{"query":{"match_all":{}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+	}
+	routings := make(map[string]interface{})
+	hits := decode(w)["hits"].(map[string]interface{})["hits"].([]interface{})
+	for _, hit := range hits {
+		hit := hit.(map[string]interface{})
+		routings[hit["_id"].(string)] = hit["_routing"]
+		if source, _ := hit["_source"].(map[string]interface{}); source["_routing"] != nil {
+			t.Errorf("routing should not be part of _source: %v", hit)
+		}
+	}
+	if len(routings) != 3 || routings["1"] != "alice" || routings["2"] != "bob" || routings["3"] != "42" {
+		t.Errorf("unexpected hit routings %v", routings)
+	}
+
+	w = do("POST", "/_mget", `{"docs":[{"_index":"orders","_id":"2","routing":"bob"},{"_index":"orders","_id":"3"}]}`)
+	docs, _ := decode(w)["docs"].([]interface{})
+	if len(docs) != 2 || docs[0].(map[string]interface{})["_routing"] != "bob" ||
+		!strings.Contains(w.Body.String(), "routing_missing_exception") {
+		t.Errorf("unexpected mget response: %s", w.Body.String())
+	}
+
+	expectRoutingMissing("delete", do("DELETE", "/orders/_doc/1", ""))
+	if w := do("DELETE", "/orders/_doc/1?routing=alice", ""); w.Code != http.StatusOK ||
+		!strings.Contains(w.Body.String(), `"deleted"`) {
+		t.Errorf("delete: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// _routing.required 创建后不可修改
+	if w := do("PUT", "/orders/_mapping", `{"_routing":{"required":false}}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "Cannot update parameter [required] from [true] to [false]") {
+		t.Errorf("update routing mapping: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 未要求 routing 的索引同样存储并返回 routing
+	if w := do("PUT", "/logs", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("create logs: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/logs/_doc/1", `{"msg":"plain"}`); w.Code != http.StatusCreated {
+		t.Fatalf("index without routing: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/logs/_doc/2?routing=r1", `{"msg":"routed"}`); w.Code != http.StatusCreated {
+		t.Fatalf("index with routing: got %d: %s", w.Code, w.Body.String())
+	}
+	if got := decode(do("GET", "/logs/_doc/1", "")); got["found"] != true || got["_routing"] != nil {
+		t.Errorf("unexpected get response %v", got)
+	}
+	if got := decode(do("GET", "/logs/_doc/2", "")); got["_routing"] != "r1" {
+		t.Errorf("unexpected get response %v", got)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/script"
+)
+
+// 存储脚本语言
+const (
+	scriptLangMustache   = "mustache"
+	scriptLangPainless   = "painless"
+	scriptLangExpression = "expression"
+)
+
+// ScriptHandler 存储脚本处理器（_scripts 与 _render/template）
+type ScriptHandler struct {
+	metaStore metadata.MetadataStore
+}
+
+// NewScriptHandler 创建存储脚本处理器
+// 同时注册存储脚本加载器，使 script: {"id": ...} 可在脚本查询、排序、script_fields 与更新脚本中使用
+func NewScriptHandler(metaStore metadata.MetadataStore) *ScriptHandler {
+	script.SetStoredScriptLoader(func(id string) (string, string, error) {
+		stored, err := metaStore.GetStoredScript(id)
+		if err != nil {
+			return "", "", err
+		}
+		if stored == nil {
+			return "", "", fmt.Errorf("stored script [%s] does not exist", id)
+		}
+		return stored.Lang, stored.Source, nil
+	})
+	return &ScriptHandler{
+		metaStore: metaStore,
+	}
+}
+
+// newStoredScriptNotFoundError 存储脚本不存在错误
+func newStoredScriptNotFoundError(id string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "resource_not_found_exception",
+		Message:    fmt.Sprintf("stored script [%s] does not exist", id),
+		HTTPStatus: http.StatusNotFound,
+		Code:       "SCRIPT_NOT_FOUND",
+	}
+}
+
+// PutScript 保存存储脚本
+// PUT /_scripts/{id}
+// POST /_scripts/{id}
+func (h *ScriptHandler) PutScript(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		common.HandleError(w, common.NewBadRequestError("must specify id for stored script"))
+		return
+	}
+
+	var body struct {
+		Script *struct {
+			Lang    string            `json:"lang"`
+			Source  interface{}       `json:"source"`
+			Options map[string]string `json:"options"`
+		} `json:"script"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	if body.Script == nil {
+		common.HandleError(w, common.NewBadRequestError("must specify script for stored script"))
+		return
+	}
+	if body.Script.Lang == "" {
+		common.HandleError(w, common.NewBadRequestError("must specify lang for stored script"))
+		return
+	}
+
+	source, err := templateSourceString(body.Script.Source)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	if source == "" {
+		common.HandleError(w, common.NewBadRequestError("must specify source for stored script"))
+		return
+	}
+
+	switch body.Script.Lang {
+	case scriptLangMustache:
+		if _, err := script.CompileMustache(source); err != nil {
+			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("failed to compile stored script [%s]: %v", id, err)))
+			return
+		}
+	case scriptLangPainless, scriptLangExpression:
+		if _, err := script.ParseScript(map[string]interface{}{"source": source, "lang": body.Script.Lang}); err != nil {
+			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("failed to compile stored script [%s]: %v", id, err)))
+			return
+		}
+	default:
+		common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("unsupported script lang [%s]", body.Script.Lang)))
+		return
+	}
+
+	now := time.Now()
+	stored := &metadata.StoredScript{
+		ID:        id,
+		Lang:      body.Script.Lang,
+		Source:    source,
+		Options:   body.Script.Options,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if existing, err := h.metaStore.GetStoredScript(id); err == nil && existing != nil {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	if err := h.metaStore.SaveStoredScript(id, stored); err != nil {
+		logger.Error("Failed to save stored script [%s]: %v", id, err)
+		common.HandleError(w, common.NewInternalServerError("failed to save stored script: "+err.Error()))
+		return
+	}
+	script.GetGlobalCache().InvalidateStored(id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"acknowledged": true,
+	}); err != nil {
+		logger.Error("Failed to encode put script response: %v", err)
+	}
+}
+
+// GetScript 获取存储脚本
+// GET /_scripts/{id}
+func (h *ScriptHandler) GetScript(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	w.Header().Set("Content-Type", "application/json")
+	stored, err := h.metaStore.GetStoredScript(id)
+	if err != nil || stored == nil {
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"_id":   id,
+			"found": false,
+		}); err != nil {
+			logger.Error("Failed to encode get script response: %v", err)
+		}
+		return
+	}
+
+	scriptBody := map[string]interface{}{
+		"lang":   stored.Lang,
+		"source": stored.Source,
+	}
+	if len(stored.Options) > 0 {
+		scriptBody["options"] = stored.Options
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"_id":    id,
+		"found":  true,
+		"script": scriptBody,
+	}); err != nil {
+		logger.Error("Failed to encode get script response: %v", err)
+	}
+}
+
+// DeleteScript 删除存储脚本
+// DELETE /_scripts/{id}
+func (h *ScriptHandler) DeleteScript(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if err := h.metaStore.DeleteStoredScript(id); err != nil {
+		if _, ok := err.(*metadata.MetadataNotFoundError); ok {
+			common.HandleError(w, newStoredScriptNotFoundError(id))
+			return
+		}
+		logger.Error("Failed to delete stored script [%s]: %v", id, err)
+		common.HandleError(w, common.NewInternalServerError("failed to delete stored script: "+err.Error()))
+		return
+	}
+	script.GetGlobalCache().InvalidateStored(id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"acknowledged": true,
+	}); err != nil {
+		logger.Error("Failed to encode delete script response: %v", err)
+	}
+}
+
+// RenderTemplate 渲染 search template（用于调试）
+// GET/POST /_render/template
+// GET/POST /_render/template/{id}
+func (h *ScriptHandler) RenderTemplate(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		common.HandleError(w, common.NewRequestBodyError("invalid JSON body", err))
+		return
+	}
+	if body == nil {
+		body = make(map[string]interface{})
+	}
+	if id := mux.Vars(r)["id"]; id != "" {
+		body["id"] = id
+	}
+
+	output, apiErr := renderSearchTemplate(h.metaStore, body)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"template_output": output,
+	}); err != nil {
+		logger.Error("Failed to encode render template response: %v", err)
+	}
+}
+
+// templateSourceString 将模板 source 统一为字符串（对象形式序列化为 JSON）
+func templateSourceString(source interface{}) (string, error) {
+	switch s := source.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return s, nil
+	case map[string]interface{}:
+		data, err := json.Marshal(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid template source: %v", err)
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("template source must be a string or an object")
+}
+
+// renderSearchTemplate 渲染 search template 请求体（id 引用存储脚本，或内联 source），返回渲染后的搜索请求体
+func renderSearchTemplate(metaStore metadata.MetadataStore, body map[string]interface{}) (map[string]interface{}, common.APIError) {
+	var source string
+	if id, ok := body["id"].(string); ok && id != "" {
+		stored, err := metaStore.GetStoredScript(id)
+		if err != nil || stored == nil {
+			return nil, newStoredScriptNotFoundError(id)
+		}
+		if stored.Lang != scriptLangMustache {
+			return nil, common.NewBadRequestError(fmt.Sprintf("stored script [%s] is not a search template, lang [%s]", id, stored.Lang))
+		}
+		source = stored.Source
+	} else {
+		s, err := templateSourceString(body["source"])
+		if err != nil {
+			return nil, common.NewBadRequestError(err.Error())
+		}
+		if s == "" {
+			return nil, common.NewBadRequestError("template must specify either [id] or [source]")
+		}
+		source = s
+	}
+
+	params, _ := body["params"].(map[string]interface{})
+	rendered, err := script.RenderMustache(source, params)
+	if err != nil {
+		return nil, common.NewBadRequestError("failed to compile search template: " + err.Error())
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal([]byte(rendered), &output); err != nil {
+		return nil, common.NewBadRequestError(fmt.Sprintf("failed to parse rendered search template as JSON: %v", err))
+	}
+	return output, nil
+}
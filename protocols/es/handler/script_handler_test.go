@@ -0,0 +1,371 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+	"github.com/lscgzwd/tiggerdb/script"
+)
+
+func TestScriptHandler_SearchTemplates(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	scriptHandler := NewScriptHandler(indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search/template", Handler: docHandler.SearchTemplate},
+		{Method: "PUT", Path: "/_scripts/{id}", Handler: scriptHandler.PutScript},
+		{Method: "GET", Path: "/_scripts/{id}", Handler: scriptHandler.GetScript},
+		{Method: "DELETE", Path: "/_scripts/{id}", Handler: scriptHandler.DeleteScript},
+		{Method: "POST", Path: "/_render/template", Handler: scriptHandler.RenderTemplate},
+		{Method: "POST", Path: "/_render/template/{id}", Handler: scriptHandler.RenderTemplate},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/books", `{"mappings":{"properties":{"title":{"type":"text"},"genre":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	for id, body := range map[string]string{
+		"1": `{"title":"go in action","genre":"tech"}`,
+		"2": `{"title":"go tour","genre":"travel"}`,
+		"3": `{"title":"rust in action","genre":"tech"}`,
+	} {
+		if w := do("PUT", "/books/_doc/"+id+"?refresh=true", body); w.Code >= 300 {
+			t.Fatalf("index %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	// 字符串形式的模板允许未加引号的参数
+	putBody := `{"script":{"lang":"mustache","source":"{\"query\":{\"bool\":{\"must\":{\"match\":{\"title\":\"{{q}}\"}},\"filter\":{\"term\":{\"genre\":\"{{genre}}\"}}}},\"size\":{{size}}{{^size}}10{{/size}}}"}}`
+	if w := do("PUT", "/_scripts/books-by-genre", putBody); w.Code != http.StatusOK {
+		t.Fatalf("put script: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/_scripts/bad", `{"script":{"lang":"mustache","source":"{{#open}}"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid template: expected 400 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/_scripts/nolang", `{"script":{"source":"x"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing lang: expected 400 got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do("GET", "/_scripts/books-by-genre", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"found":true`) || !strings.Contains(w.Body.String(), `"lang":"mustache"`) {
+		t.Fatalf("get script: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// _render/template
+	w = do("POST", "/_render/template/books-by-genre", `{"params":{"q":"go","genre":"tech"}}`)
+	var rendered struct {
+		TemplateOutput map[string]interface{} `json:"template_output"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &rendered); err != nil || rendered.TemplateOutput["size"] != float64(10) {
+		t.Fatalf("render template: got %d: %s", w.Code, w.Body.String())
+	}
+
+	search := func(body string) []string {
+		t.Helper()
+		w := do("POST", "/books/_search/template", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search template %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp nestedTestHits
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode search response: %v", err)
+		}
+		ids := make([]string, 0, len(resp.Hits.Hits))
+		for _, hit := range resp.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return ids
+	}
+
+	if ids := search(`{"id":"books-by-genre","params":{"q":"go","genre":"tech"}}`); len(ids) != 1 || ids[0] != "1" {
+		t.Errorf("stored template search: expected [1], got %v", ids)
+	}
+	if ids := search(`{"source":{"query":{"term":{"genre":"{{genre}}"}}},"params":{"genre":"tech"}}`); len(ids) != 2 {
+		t.Errorf("inline template search: expected 2 hits, got %v", ids)
+	}
+	if w := do("POST", "/books/_search/template", `{"id":"missing","params":{}}`); w.Code != http.StatusNotFound {
+		t.Errorf("missing stored template: expected 404 got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do("DELETE", "/_scripts/books-by-genre", ""); w.Code != http.StatusOK {
+		t.Fatalf("delete script: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/_scripts/books-by-genre", ""); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `"found":false`) {
+		t.Errorf("get deleted script: expected 404 found=false, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", "/_scripts/books-by-genre", ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete missing script: expected 404 got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestScriptHandler_StoredPainlessScripts(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	scriptHandler := NewScriptHandler(indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "POST", Path: "/{index}/_update/{id}", Handler: docHandler.UpdateDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "PUT", Path: "/_scripts/{id}", Handler: scriptHandler.PutScript},
+		{Method: "GET", Path: "/_scripts/{id}", Handler: scriptHandler.GetScript},
+		{Method: "DELETE", Path: "/_scripts/{id}", Handler: scriptHandler.DeleteScript},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/items", `{"mappings":{"properties":{"price":{"type":"double"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/items/_doc/1?refresh=true", `{"price":10}`); w.Code >= 300 {
+		t.Fatalf("index doc: got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do("PUT", "/_scripts/apply-discount", `{"script":{"lang":"painless","source":"ctx._source.price *= params.factor"}}`); w.Code != http.StatusOK {
+		t.Fatalf("put painless script: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/_scripts/double-price", `{"script":{"lang":"painless","source":"doc['price'].value * params.multiplier"}}`); w.Code != http.StatusOK {
+		t.Fatalf("put painless script: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/_scripts/apply-discount", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"lang":"painless"`) {
+		t.Fatalf("get painless script: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 更新脚本引用存储脚本
+	if w := do("POST", "/items/_update/1?refresh=true", `{"script":{"id":"apply-discount","params":{"factor":0.5}}}`); w.Code != http.StatusOK {
+		t.Fatalf("update with stored script: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	w := do("GET", "/items/_doc/1", "")
+	var got struct {
+		Source map[string]interface{} `json:"_source"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Source["price"] != float64(5) {
+		t.Fatalf("expected price 5 after stored script update, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// script_fields 引用存储脚本
+	w = do("POST", "/items/_search", `{"query":{"match_all":{}},"script_fields":{"doubled":{"script":{"id":"double-price","params":{"multiplier":2}}}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search with stored script field: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Fields map[string][]interface{} `json:"fields"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Hits.Hits) != 1 {
+		t.Fatalf("decode search response: %v: %s", err, w.Body.String())
+	}
+	if doubled := resp.Hits.Hits[0].Fields["doubled"]; len(doubled) != 1 || doubled[0] != float64(10) {
+		t.Errorf("expected doubled [10], got %v", doubled)
+	}
+
+	// 删除后缓存失效，引用返回错误
+	if w := do("DELETE", "/_scripts/apply-discount", ""); w.Code != http.StatusOK {
+		t.Fatalf("delete script: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/items/_update/1", `{"script":{"id":"apply-discount","params":{"factor":0.5}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("update with deleted stored script: expected 400 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/_scripts/unknown-lang", `{"script":{"lang":"groovy","source":"1"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported lang: expected 400 got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestScriptLimits_ScriptException(t *testing.T) {
+	script.SetLimits(script.Limits{MaxStatements: 1000})
+	defer script.SetLimits(script.DefaultLimits())
+
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_update/{id}", Handler: docHandler.UpdateDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/loops", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/loops/_doc/1?refresh=true", `{"n":1}`); w.Code >= 300 {
+		t.Fatalf("index doc: got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, tc := range []struct {
+		name, path, body string
+	}{
+		{"update", "/loops/_update/1", `{"script":{"source":"while (true) { ctx._source.n++ }"}}`},
+		{"script_fields", "/loops/_search", `{"script_fields":{"x":{"script":{"source":"def i = 0; while (true) { i++ } return i;"}}}}`},
+	} {
+		w := do("POST", tc.path, tc.body)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"script_exception"`) {
+			t.Errorf("%s: expected 400 script_exception, got %d: %s", tc.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestScriptFields_DocValues(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	mapping := `{"mappings":{"properties":{"tags":{"type":"keyword"},"created":{"type":"date"},"location":{"type":"geo_point"}}}}`
+	if w := do("PUT", "/places", mapping); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	doc := `{"tags":["red","blue"],"created":"2024-01-15T10:30:00Z","location":{"lat":40.7,"lon":-74.0}}`
+	if w := do("PUT", "/places/_doc/1?refresh=true", doc); w.Code >= 300 {
+		t.Fatalf("index doc: got %d: %s", w.Code, w.Body.String())
+	}
+
+	body := `{"script_fields":{
+		"first_tag":{"script":{"source":"doc['tags'].value"}},
+		"tag_count":{"script":{"source":"doc['tags'].size()"}},
+		"year":{"script":{"source":"doc['created'].value.getYear()"}},
+		"lat":{"script":{"source":"doc['location'].lat"}},
+		"missing":{"script":{"source":"doc['nope'].size() == 0"}}
+	}}`
+	w := do("POST", "/places/_search", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Fields map[string][]interface{} `json:"fields"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Hits.Hits) != 1 {
+		t.Fatalf("expected 1 hit, got %s", w.Body.String())
+	}
+	fields := resp.Hits.Hits[0].Fields
+	want := map[string]interface{}{
+		"first_tag": "blue",
+		"tag_count": 2.0,
+		"year":      2024.0,
+		"missing":   true,
+	}
+	for name, v := range want {
+		if len(fields[name]) != 1 || fields[name][0] != v {
+			t.Errorf("field %s = %v, want [%v]", name, fields[name], v)
+		}
+	}
+	// geo_point 按索引精度量化存储
+	if lat, ok := fields["lat"][0].(float64); !ok || math.Abs(lat-40.7) > 1e-6 {
+		t.Errorf("field lat = %v, want about 40.7", fields["lat"])
+	}
+}
+
+func TestScriptQuery_ReadsMatchedDocuments(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/products", `{"mappings":{"properties":{"price":{"type":"long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	for id, doc := range map[string]string{"1": `{"price":10}`, "2": `{"price":20}`} {
+		if w := do("PUT", "/products/_doc/"+id+"?refresh=true", doc); w.Code >= 300 {
+			t.Fatalf("index doc %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				ID    string  `json:"_id"`
+				Score float64 `json:"_score"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	w := do("POST", "/products/_search", `{"query":{"script":{"script":"doc['price'].value > 15"}}}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Hits.Hits) != 1 || resp.Hits.Hits[0].ID != "2" {
+		t.Fatalf("script query: expected only document 2, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("POST", "/products/_search", `{"query":{"script_score":{"query":{"match_all":{}},"script":"doc['price'].value"}}}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Hits.Hits) != 2 {
+		t.Fatalf("script_score: expected 2 hits, got %d: %s", w.Code, w.Body.String())
+	}
+	if resp.Hits.Hits[0].ID != "2" || resp.Hits.Hits[0].Score != 20 || resp.Hits.Hits[1].Score != 10 {
+		t.Errorf("script_score: expected scores from the price field, got %s", w.Body.String())
+	}
+}
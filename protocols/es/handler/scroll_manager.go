@@ -15,8 +15,11 @@
 package handler
 
 import (
+	"container/list"
 	"fmt"
+	"hash/fnv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lscgzwd/tiggerdb/logger"
@@ -24,6 +27,29 @@ import (
 	"github.com/google/uuid"
 )
 
+// scroll 上下文管理
+// scroll 表按 scroll_id 的哈希分为多个分片，每个分片一把锁，并发 scroll 之间互不阻塞。
+// 节点上打开的 scroll 数受 search.max_open_scroll_context 限制（可通过 _cluster/settings 动态修改），
+// 超出时淘汰最久未访问的 scroll。过期清理每次只扫描一个分片，一轮约一分钟，
+// 访问时发现过期的 scroll 立即删除。统计通过 /_nodes/stats 输出。
+
+const (
+	// scrollManagerShards scroll 表的分片数
+	scrollManagerShards = 32
+	// DefaultMaxOpenScrolls 节点上默认最多打开的 scroll 数
+	DefaultMaxOpenScrolls = 500
+	// scrollCleanupInterval 每次过期清理的间隔，每次清理一个分片
+	scrollCleanupInterval = time.Minute / scrollManagerShards
+)
+
+// maxOpenScrollSetting 节点上最多打开的 scroll 数（_cluster/settings 动态设置）
+const maxOpenScrollSetting = "search.max_open_scroll_context"
+
+var maxOpenScrollSettingDef = clusterSettingDef{
+	parse: parsePositiveIntSetting,
+	apply: func(v interface{}) { GetScrollManager().SetMaxOpenScrolls(v.(int)) },
+}
+
 // ScrollContext 存储 scroll 搜索的上下文信息
 type ScrollContext struct {
 	ScrollID     string                            `json:"scroll_id"`
@@ -37,12 +63,48 @@ type ScrollContext struct {
 	LastSort     []interface{}                     `json:"last_sort,omitempty"` // 最后一个结果的 sort 值，用于 search_after
 	ExpiresAt    time.Time                         `json:"expires_at"`
 	CreatedAt    time.Time                         `json:"created_at"`
+
+	lastAccess time.Time // 最近一次访问时间，用于 LRU 淘汰
+}
+
+// ScrollStats scroll 统计
+type ScrollStats struct {
+	Open      int64  `json:"open"`                 // 当前打开的 scroll 数
+	MaxOpen   int64  `json:"max_open"`             // 最多打开的 scroll 数
+	Total     uint64 `json:"total"`                // 创建的 scroll 总数
+	Cleared   uint64 `json:"cleared"`              // 遍历完成或被清除的 scroll 数
+	Expired   uint64 `json:"expired"`              // 过期删除的 scroll 数
+	Evicted   uint64 `json:"evicted"`              // 超出上限被淘汰的 scroll 数
+	TotalTime uint64 `json:"total_time_in_millis"` // 已关闭 scroll 的累计存活时间
+	Shards    int    `json:"shards"`               // scroll 表的分片数
+}
+
+// scrollShard scroll 表的一个分片，lru 前端为最近访问的 scroll
+type scrollShard struct {
+	mu       sync.Mutex
+	contexts map[string]*list.Element // scroll_id -> lru 元素（值为 *ScrollContext）
+	lru      *list.List
 }
 
+// scroll 删除原因
+const (
+	scrollRemoveCleared = iota
+	scrollRemoveExpired
+	scrollRemoveEvicted
+)
+
 // ScrollManager 管理 scroll 上下文
 type ScrollManager struct {
-	contexts map[string]*ScrollContext
-	mutex    sync.RWMutex
+	shards  [scrollManagerShards]scrollShard
+	open    atomic.Int64
+	maxOpen atomic.Int64
+
+	total     atomic.Uint64
+	cleared   atomic.Uint64
+	expired   atomic.Uint64
+	evicted   atomic.Uint64
+	totalTime atomic.Uint64 // 纳秒
+
 	// 定期清理过期 scroll context 的 goroutine
 	cleanupTicker *time.Ticker
 	stopCleanup   chan bool
@@ -56,18 +118,41 @@ var (
 // GetScrollManager 获取全局 scroll manager 实例（单例）
 func GetScrollManager() *ScrollManager {
 	scrollManagerOnce.Do(func() {
-		globalScrollManager = &ScrollManager{
-			contexts:      make(map[string]*ScrollContext),
-			cleanupTicker: time.NewTicker(1 * time.Minute), // 每分钟清理一次
-			stopCleanup:   make(chan bool),
-		}
+		globalScrollManager = newScrollManager(DefaultMaxOpenScrolls)
 		// 启动清理 goroutine
 		go globalScrollManager.cleanupExpired()
 	})
 	return globalScrollManager
 }
 
-// CreateScrollContext 创建新的 scroll context
+// newScrollManager 创建 scroll manager，不启动过期清理
+func newScrollManager(maxOpen int) *ScrollManager {
+	sm := &ScrollManager{
+		cleanupTicker: time.NewTicker(scrollCleanupInterval),
+		stopCleanup:   make(chan bool),
+	}
+	for i := range sm.shards {
+		sm.shards[i].contexts = make(map[string]*list.Element)
+		sm.shards[i].lru = list.New()
+	}
+	sm.maxOpen.Store(int64(maxOpen))
+	return sm
+}
+
+// shard 返回 scroll_id 所在的分片
+func (sm *ScrollManager) shard(scrollID string) *scrollShard {
+	h := fnv.New32a()
+	h.Write([]byte(scrollID))
+	return &sm.shards[h.Sum32()%scrollManagerShards]
+}
+
+// SetMaxOpenScrolls 设置最多打开的 scroll 数，超出的 scroll 立即被淘汰
+func (sm *ScrollManager) SetMaxOpenScrolls(n int) {
+	sm.maxOpen.Store(int64(n))
+	sm.evictOverLimit()
+}
+
+// CreateScrollContext 创建新的 scroll context，打开的 scroll 超出上限时淘汰最久未访问的 scroll
 func (sm *ScrollManager) CreateScrollContext(
 	indexName string,
 	query map[string]interface{},
@@ -91,62 +176,82 @@ func (sm *ScrollManager) CreateScrollContext(
 		Aggregations: aggs,
 		ExpiresAt:    now.Add(scrollTTL),
 		CreatedAt:    now,
+		lastAccess:   now,
 	}
 
-	sm.mutex.Lock()
-	sm.contexts[scrollID] = ctx
-	contextCount := len(sm.contexts)
-	// 打印 manager 地址，确认是否是同一个实例
-	managerAddr := fmt.Sprintf("%p", sm)
-	sm.mutex.Unlock()
+	shard := sm.shard(scrollID)
+	shard.mu.Lock()
+	shard.contexts[scrollID] = shard.lru.PushFront(ctx)
+	shard.mu.Unlock()
+	sm.open.Add(1)
+	sm.total.Add(1)
 
-	// 添加日志帮助调试
-	logger.Info("Created scroll context [%s] for index [%s], TTL=%v, total contexts=%d, manager=%s",
-		scrollID, indexName, scrollTTL, contextCount, managerAddr)
+	sm.evictOverLimit()
+	logger.Debug("Created scroll context [%s] for index [%s], TTL=%v, open contexts=%d",
+		scrollID, indexName, scrollTTL, sm.open.Load())
 	return ctx, nil
 }
 
-// GetScrollContext 获取 scroll context
+// GetScrollContext 获取 scroll context，并记为最近访问
 func (sm *ScrollManager) GetScrollContext(scrollID string) (*ScrollContext, error) {
-	sm.mutex.RLock()
-	defer sm.mutex.RUnlock()
+	shard := sm.shard(scrollID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	ctx, exists := sm.contexts[scrollID]
-	managerAddr := fmt.Sprintf("%p", sm)
+	elem, exists := shard.contexts[scrollID]
 	if !exists {
-		// 添加调试日志，打印所有现有的 scroll ID
-		existingIDs := make([]string, 0, len(sm.contexts))
-		for id := range sm.contexts {
-			existingIDs = append(existingIDs, id[:8]+"...") // 只打印前8个字符
-		}
-		logger.Warn("Scroll context [%s] not found, total contexts: %d, existing: %v, manager=%s", scrollID, len(sm.contexts), existingIDs, managerAddr)
+		logger.Warn("Scroll context [%s] not found, open contexts: %d", scrollID, sm.open.Load())
 		return nil, fmt.Errorf("scroll context [%s] not found", scrollID)
 	}
+	ctx := elem.Value.(*ScrollContext)
 
 	// 检查是否过期
-	if time.Now().After(ctx.ExpiresAt) {
-		// 异步删除过期 context
-		go sm.DeleteScrollContext(scrollID)
+	now := time.Now()
+	if now.After(ctx.ExpiresAt) {
+		sm.removeLocked(shard, elem, scrollRemoveExpired, now)
 		logger.Warn("Scroll context [%s] expired, created: %v, expires: %v", scrollID, ctx.CreatedAt, ctx.ExpiresAt)
 		return nil, fmt.Errorf("scroll context [%s] has expired", scrollID)
 	}
 
+	ctx.lastAccess = now
+	shard.lru.MoveToFront(elem)
 	return ctx, nil
 }
 
+// KeepAlive 延长 scroll context 的过期时间
+func (sm *ScrollManager) KeepAlive(scrollID string, ttl time.Duration) error {
+	shard := sm.shard(scrollID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	elem, exists := shard.contexts[scrollID]
+	if !exists {
+		return fmt.Errorf("scroll context [%s] not found", scrollID)
+	}
+	now := time.Now()
+	ctx := elem.Value.(*ScrollContext)
+	ctx.ExpiresAt = now.Add(ttl)
+	ctx.lastAccess = now
+	shard.lru.MoveToFront(elem)
+	return nil
+}
+
 // UpdateScrollContext 更新 scroll context（用于记录最后一个结果的 sort 值）
 // lastSort: 最后一个结果的sort值，如果为nil表示使用from分页方式
 func (sm *ScrollManager) UpdateScrollContext(scrollID string, lastSort []interface{}) error {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
+	shard := sm.shard(scrollID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	ctx, exists := sm.contexts[scrollID]
+	elem, exists := shard.contexts[scrollID]
 	if !exists {
 		return fmt.Errorf("scroll context [%s] not found", scrollID)
 	}
+	ctx := elem.Value.(*ScrollContext)
 
-	if time.Now().After(ctx.ExpiresAt) {
-		delete(sm.contexts, scrollID)
+	now := time.Now()
+	if now.After(ctx.ExpiresAt) {
+		sm.removeLocked(shard, elem, scrollRemoveExpired, now)
 		return fmt.Errorf("scroll context [%s] has expired", scrollID)
 	}
 
@@ -160,40 +265,128 @@ func (sm *ScrollManager) UpdateScrollContext(scrollID string, lastSort []interfa
 	return nil
 }
 
-// DeleteScrollContext 删除 scroll context
-func (sm *ScrollManager) DeleteScrollContext(scrollID string) {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
-	if _, exists := sm.contexts[scrollID]; exists {
-		delete(sm.contexts, scrollID)
-		logger.Info("Deleted scroll context [%s], remaining contexts=%d", scrollID, len(sm.contexts))
+// DeleteScrollContext 删除 scroll context，返回是否删除了未过期的 scroll
+func (sm *ScrollManager) DeleteScrollContext(scrollID string) bool {
+	shard := sm.shard(scrollID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	elem, exists := shard.contexts[scrollID]
+	if !exists {
+		return false
+	}
+	now := time.Now()
+	if now.After(elem.Value.(*ScrollContext).ExpiresAt) {
+		sm.removeLocked(shard, elem, scrollRemoveExpired, now)
+		return false
+	}
+	sm.removeLocked(shard, elem, scrollRemoveCleared, now)
+	logger.Debug("Deleted scroll context [%s], open contexts=%d", scrollID, sm.open.Load())
+	return true
+}
+
+// removeLocked 从分片中删除 scroll 并记录统计，调用方持有分片的锁
+func (sm *ScrollManager) removeLocked(shard *scrollShard, elem *list.Element, reason int, now time.Time) {
+	ctx := elem.Value.(*ScrollContext)
+	shard.lru.Remove(elem)
+	delete(shard.contexts, ctx.ScrollID)
+	sm.open.Add(-1)
+	sm.totalTime.Add(uint64(now.Sub(ctx.CreatedAt)))
+	switch reason {
+	case scrollRemoveCleared:
+		sm.cleared.Add(1)
+	case scrollRemoveExpired:
+		sm.expired.Add(1)
+	case scrollRemoveEvicted:
+		sm.evicted.Add(1)
+	}
+}
+
+// evictOverLimit 打开的 scroll 超出上限时逐个淘汰所有分片中最久未访问的 scroll
+func (sm *ScrollManager) evictOverLimit() {
+	for sm.open.Load() > sm.maxOpen.Load() {
+		if !sm.evictOldest() {
+			return
+		}
 	}
 }
 
-// cleanupExpired 定期清理过期的 scroll context
+// evictOldest 淘汰所有分片中最久未访问的 scroll，没有可淘汰的 scroll 时返回 false
+func (sm *ScrollManager) evictOldest() bool {
+	var oldest *scrollShard
+	var oldestAccess time.Time
+	for i := range sm.shards {
+		shard := &sm.shards[i]
+		shard.mu.Lock()
+		if back := shard.lru.Back(); back != nil {
+			access := back.Value.(*ScrollContext).lastAccess
+			if oldest == nil || access.Before(oldestAccess) {
+				oldest, oldestAccess = shard, access
+			}
+		}
+		shard.mu.Unlock()
+	}
+	if oldest == nil {
+		return false
+	}
+
+	// 扫描后分片可能已变化，淘汰该分片当前最久未访问的 scroll
+	oldest.mu.Lock()
+	defer oldest.mu.Unlock()
+	back := oldest.lru.Back()
+	if back == nil {
+		return true
+	}
+	ctx := back.Value.(*ScrollContext)
+	sm.removeLocked(oldest, back, scrollRemoveEvicted, time.Now())
+	logger.Warn("Evicted scroll context [%s] of index [%s]: too many open scroll contexts, limit [%d]",
+		ctx.ScrollID, ctx.IndexName, sm.maxOpen.Load())
+	return true
+}
+
+// cleanupShard 删除分片中过期的 scroll context，返回删除的数量
+func (sm *ScrollManager) cleanupShard(shard *scrollShard, now time.Time) int {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	expiredCount := 0
+	for _, elem := range shard.contexts {
+		if now.After(elem.Value.(*ScrollContext).ExpiresAt) {
+			sm.removeLocked(shard, elem, scrollRemoveExpired, now)
+			expiredCount++
+		}
+	}
+	return expiredCount
+}
+
+// cleanupExpired 定期清理过期的 scroll context，每次清理一个分片
 func (sm *ScrollManager) cleanupExpired() {
+	next := 0
 	for {
 		select {
 		case <-sm.cleanupTicker.C:
-			sm.mutex.Lock()
-			now := time.Now()
-			expiredCount := 0
-			for id, ctx := range sm.contexts {
-				if now.After(ctx.ExpiresAt) {
-					delete(sm.contexts, id)
-					expiredCount++
-				}
-			}
-			if expiredCount > 0 {
+			if expiredCount := sm.cleanupShard(&sm.shards[next], time.Now()); expiredCount > 0 {
 				logger.Info("Cleaned up %d expired scroll contexts", expiredCount)
 			}
-			sm.mutex.Unlock()
+			next = (next + 1) % scrollManagerShards
 		case <-sm.stopCleanup:
 			return
 		}
 	}
 }
 
+// Stats 返回 scroll 统计
+func (sm *ScrollManager) Stats() ScrollStats {
+	return ScrollStats{
+		Open:      sm.open.Load(),
+		MaxOpen:   sm.maxOpen.Load(),
+		Total:     sm.total.Load(),
+		Cleared:   sm.cleared.Load(),
+		Expired:   sm.expired.Load(),
+		Evicted:   sm.evicted.Load(),
+		TotalTime: sm.totalTime.Load() / uint64(time.Millisecond),
+		Shards:    scrollManagerShards,
+	}
+}
+
 // Stop 停止清理 goroutine（用于优雅关闭）
 func (sm *ScrollManager) Stop() {
 	sm.cleanupTicker.Stop()
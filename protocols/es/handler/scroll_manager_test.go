@@ -0,0 +1,117 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScrollManager(t *testing.T) {
+	sm := newScrollManager(4)
+	defer sm.cleanupTicker.Stop()
+	create := func(ttl time.Duration) string {
+		t.Helper()
+		ctx, err := sm.CreateScrollContext("logs", nil, nil, nil, 10, nil, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ctx.ScrollID
+	}
+
+	// 超出上限时淘汰最久未访问的 scroll
+	ids := make([]string, 4)
+	for i := range ids {
+		ids[i] = create(time.Minute)
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := sm.GetScrollContext(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	extra := create(time.Minute)
+	if _, err := sm.GetScrollContext(ids[1]); err == nil {
+		t.Errorf("expected least recently used scroll to be evicted")
+	}
+	for _, id := range []string{ids[0], ids[2], ids[3], extra} {
+		if _, err := sm.GetScrollContext(id); err != nil {
+			t.Errorf("expected scroll %s to be open: %v", id, err)
+		}
+	}
+
+	// 降低上限立即淘汰
+	sm.SetMaxOpenScrolls(2)
+	if n := sm.Stats().Open; n != 2 {
+		t.Errorf("expected 2 open scrolls after lowering the limit, got %d", n)
+	}
+	sm.SetMaxOpenScrolls(100)
+
+	// 过期的 scroll 在访问时或逐个分片清理时删除
+	expired := create(time.Millisecond)
+	expiredLater := create(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, err := sm.GetScrollContext(expired); err == nil {
+		t.Errorf("expected scroll to have expired")
+	}
+	if err := sm.KeepAlive(expiredLater, time.Minute); err != nil {
+		t.Errorf("keep alive: %v", err)
+	}
+	short := create(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	removed := 0
+	for i := range sm.shards {
+		removed += sm.cleanupShard(&sm.shards[i], time.Now())
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 expired scroll cleaned up, got %d", removed)
+	}
+	if _, err := sm.GetScrollContext(short); err == nil {
+		t.Errorf("expected scroll to be cleaned up")
+	}
+	if !sm.DeleteScrollContext(expiredLater) || sm.DeleteScrollContext(expiredLater) {
+		t.Errorf("expected scroll to be deleted exactly once")
+	}
+
+	stats := sm.Stats()
+	expected := ScrollStats{Open: 2, MaxOpen: 100, Total: 8, Cleared: 1, Expired: 2, Evicted: 3, Shards: scrollManagerShards}
+	stats.TotalTime = 0
+	if stats != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, stats)
+	}
+
+	// 并发创建、访问与删除
+	sm = newScrollManager(64)
+	defer sm.cleanupTicker.Stop()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				ctx, _ := sm.CreateScrollContext("logs", nil, nil, nil, 10, nil, time.Minute)
+				_ = sm.UpdateScrollContext(ctx.ScrollID, []interface{}{fmt.Sprint(i)})
+				if i%2 == 0 {
+					sm.DeleteScrollContext(ctx.ScrollID)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	stats = sm.Stats()
+	if stats.Open != 64 || stats.Total != 800 || stats.Cleared+stats.Evicted+uint64(stats.Open) != 800 {
+		t.Errorf("unexpected stats after concurrent scrolls: %+v", stats)
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/numeric"
+	"github.com/lscgzwd/tiggerdb/search"
+)
+
+// 排序值的类型化编码
+// bleve 的排序键是索引中的原始词项（数值、日期为 PrefixCoded 编码），直接返回给客户端既不可读，
+// 客户端回传的 search_after 也无法按字符串正确比较。这里按 mapping 中的字段类型：
+//   - 响应中的 sort 值解码为原始类型（数值、日期为毫秒时间戳、boolean 为 1/0、_score 为评分）；
+//   - search_after 值编码为与排序键一致的词项，缺失值使用 ES 的 Long.MAX_VALUE/Long.MIN_VALUE 表示。
+
+// sortValueType 排序位置的值类型
+type sortValueType int
+
+const (
+	sortValueAuto      sortValueType = iota // 未映射字段，按值推断
+	sortValueString                         // keyword、text 等
+	sortValueLong                           // 整数类型
+	sortValueDouble                         // 浮点类型
+	sortValueDate                           // date（毫秒）
+	sortValueDateNanos                      // date_nanos（纳秒）
+	sortValueBoolean                        // boolean（ES 返回 1/0）
+	sortValueScore                          // _score
+	sortValueID                             // _id
+	sortValueScript                         // _script（数值）
+)
+
+// sortValueTypes 根据 mapping 字段类型确定每个排序位置的值类型
+func sortValueTypes(sortOrder search.SortOrder, fieldTypes map[string]string) []sortValueType {
+	types := make([]sortValueType, len(sortOrder))
+	for i, ss := range sortOrder {
+		switch s := ss.(type) {
+		case *search.SortScore:
+			types[i] = sortValueScore
+		case *search.SortDocID:
+			types[i] = sortValueID
+		case *search.SortScript:
+			types[i] = sortValueScript
+		case *search.SortField:
+			types[i] = mappedSortValueType(fieldTypes[s.Field])
+		case *search.SortPrecomputed:
+			types[i] = mappedSortValueType(fieldTypes[s.Field])
+		default:
+			types[i] = sortValueAuto
+		}
+	}
+	return types
+}
+
+// mappedSortValueType 将 ES 字段类型映射为排序值类型
+func mappedSortValueType(fieldType string) sortValueType {
+	switch fieldType {
+	case "":
+		return sortValueAuto
+	case "long", "integer", "short", "byte", "unsigned_long":
+		return sortValueLong
+	case "double", "float", "half_float", "scaled_float":
+		return sortValueDouble
+	case "date":
+		return sortValueDate
+	case "date_nanos":
+		return sortValueDateNanos
+	case "boolean":
+		return sortValueBoolean
+	default:
+		return sortValueString
+	}
+}
+
+// decodeSortValues 将命中文档的排序键解码为响应中的类型化 sort 值
+func decodeSortValues(sortOrder search.SortOrder, types []sortValueType, hit *search.DocumentMatch) []interface{} {
+	values := make([]interface{}, len(hit.Sort))
+	for i, raw := range hit.Sort {
+		valueType := sortValueAuto
+		if i < len(types) {
+			valueType = types[i]
+		}
+		values[i] = decodeSortValue(valueType, raw, hit)
+	}
+	return values
+}
+
+func decodeSortValue(valueType sortValueType, raw string, hit *search.DocumentMatch) interface{} {
+	switch valueType {
+	case sortValueScore:
+		return hit.Score
+	case sortValueID:
+		return hit.ID
+	case sortValueScript:
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f
+		}
+		return raw
+	}
+
+	// 缺失值：数值与日期使用 Long.MAX_VALUE/Long.MIN_VALUE，其他类型为 null
+	if raw == search.HighTerm || raw == search.LowTerm {
+		switch valueType {
+		case sortValueString, sortValueBoolean:
+			return nil
+		}
+		if raw == search.HighTerm {
+			return int64(math.MaxInt64)
+		}
+		return int64(math.MinInt64)
+	}
+
+	switch valueType {
+	case sortValueLong, sortValueDouble, sortValueAuto:
+		if valid, shift := numeric.ValidPrefixCodedTerm(raw); !valid || shift != 0 {
+			return raw
+		}
+		i64, err := numeric.PrefixCoded(raw).Int64()
+		if err != nil {
+			return raw
+		}
+		f := numeric.Int64ToFloat64(i64)
+		if valueType == sortValueLong {
+			return int64(f)
+		}
+		return f
+	case sortValueDate, sortValueDateNanos:
+		i64, err := numeric.PrefixCoded(raw).Int64()
+		if err != nil {
+			return raw
+		}
+		if valueType == sortValueDateNanos {
+			return i64
+		}
+		return i64 / int64(time.Millisecond)
+	case sortValueBoolean:
+		switch raw {
+		case "T":
+			return 1
+		case "F":
+			return 0
+		}
+	}
+	return raw
+}
+
+// encodeSearchAfterValues 将 search_after 值编码为与排序键一致的词项
+func encodeSearchAfterValues(sortOrder search.SortOrder, types []sortValueType, values []interface{}) ([]string, error) {
+	encoded := make([]string, len(values))
+	for i, value := range values {
+		valueType := sortValueAuto
+		if i < len(types) {
+			valueType = types[i]
+		}
+		var ss search.SearchSort
+		if i < len(sortOrder) {
+			ss = sortOrder[i]
+		}
+		term, err := encodeSearchAfterValue(ss, valueType, value)
+		if err != nil {
+			field := fmt.Sprintf("%d", i)
+			if sf, ok := ss.(*search.SortField); ok {
+				field = sf.Field
+			}
+			return nil, fmt.Errorf("Failed to parse search_after value for field [%s]: %v", field, err)
+		}
+		encoded[i] = term
+	}
+	return encoded, nil
+}
+
+func encodeSearchAfterValue(ss search.SearchSort, valueType sortValueType, value interface{}) (string, error) {
+	switch valueType {
+	case sortValueScore, sortValueScript:
+		f, err := sortValueFloat(value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case sortValueID:
+		return fmt.Sprintf("%v", value), nil
+	}
+
+	// 缺失值哨兵
+	if term, ok := missingSortTerm(ss, valueType, value); ok {
+		return term, nil
+	}
+
+	switch valueType {
+	case sortValueLong, sortValueDouble:
+		f, err := sortValueFloat(value)
+		if err != nil {
+			return "", err
+		}
+		return prefixCodedSortTerm(numeric.Float64ToInt64(f)), nil
+	case sortValueDate, sortValueDateNanos:
+		nanos, err := sortValueDateNanosOf(value, valueType == sortValueDateNanos)
+		if err != nil {
+			return "", err
+		}
+		return prefixCodedSortTerm(nanos), nil
+	case sortValueBoolean:
+		switch v := value.(type) {
+		case bool:
+			if v {
+				return "T", nil
+			}
+			return "F", nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return "", err
+			}
+			return encodeSearchAfterValue(ss, valueType, b)
+		default:
+			f, err := sortValueFloat(value)
+			if err != nil {
+				return "", err
+			}
+			return encodeSearchAfterValue(ss, valueType, f != 0)
+		}
+	case sortValueAuto:
+		// 未映射字段：数值按 PrefixCoded 编码，其余按字符串
+		if f, err := sortValueFloat(value); err == nil {
+			if _, isString := value.(string); !isString {
+				return prefixCodedSortTerm(numeric.Float64ToInt64(f)), nil
+			}
+		}
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// missingSortTerm 将 search_after 中的缺失值表示还原为排序键哨兵
+func missingSortTerm(ss search.SearchSort, valueType sortValueType, value interface{}) (string, bool) {
+	if value == nil {
+		var missing search.SortFieldMissing
+		var desc bool
+		switch s := ss.(type) {
+		case *search.SortField:
+			missing, desc = s.Missing, s.Desc
+		case *search.SortPrecomputed:
+			missing, desc = s.Missing, s.Desc
+		default:
+			return search.HighTerm, true
+		}
+		if (missing == search.SortFieldMissingLast) != desc {
+			return search.HighTerm, true
+		}
+		return search.LowTerm, true
+	}
+	switch valueType {
+	case sortValueLong, sortValueDouble, sortValueDate, sortValueDateNanos, sortValueAuto:
+		if _, isString := value.(string); isString {
+			return "", false
+		}
+		f, err := sortValueFloat(value)
+		if err != nil {
+			return "", false
+		}
+		if f >= math.MaxInt64 {
+			return search.HighTerm, true
+		}
+		if f <= math.MinInt64 {
+			return search.LowTerm, true
+		}
+	}
+	return "", false
+}
+
+// prefixCodedSortTerm 生成 shift=0 的 PrefixCoded 词项
+func prefixCodedSortTerm(i64 int64) string {
+	return string(numeric.MustNewPrefixCodedInt64(i64, 0))
+}
+
+// sortValueFloat 将 search_after 值转换为 float64
+func sortValueFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("unsupported value [%v]", value)
+	}
+}
+
+// sortValueDateNanosOf 将 search_after 中的日期值（毫秒/纳秒时间戳或日期字符串）转换为纳秒
+func sortValueDateNanosOf(value interface{}, nanos bool) (int64, error) {
+	if s, ok := value.(string); ok {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UnixNano(), nil
+			}
+		}
+	}
+	switch v := value.(type) {
+	case int64:
+		if nanos {
+			return v, nil
+		}
+		return v * int64(time.Millisecond), nil
+	case int:
+		return sortValueDateNanosOf(int64(v), nanos)
+	}
+	f, err := sortValueFloat(value)
+	if err != nil {
+		return 0, err
+	}
+	if nanos {
+		return int64(f), nil
+	}
+	return int64(f * float64(time.Millisecond)), nil
+}
+
+// scrollSortWithTiebreaker 为 scroll 排序追加 _id 升序 tiebreaker（未指定排序时仅按 _id 升序）
+func scrollSortWithTiebreaker(sortSpec []interface{}) []interface{} {
+	for _, item := range sortSpec {
+		switch v := item.(type) {
+		case string:
+			if v == "_id" || v == "-_id" || v == "+_id" {
+				return sortSpec
+			}
+		case map[string]interface{}:
+			if _, ok := v["_id"]; ok {
+				return sortSpec
+			}
+		}
+	}
+	var tiebreaker interface{} = map[string]interface{}{"_id": map[string]interface{}{"order": "asc"}}
+	if len(sortSpec) > 0 {
+		// 简单字符串格式（首个元素为字符串）要求所有元素都是字符串
+		if _, ok := sortSpec[0].(string); ok {
+			tiebreaker = "_id"
+		}
+	}
+	return append(append([]interface{}{}, sortSpec...), tiebreaker)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/lscgzwd/tiggerdb/metadata"
+)
+
+// 索引内并行搜索（index.search.concurrency）
+// 搜索时将 scorch 快照的段按文档数均衡分成 N 个虚拟分片并行检索，再按排序合并命中、总数与聚合，
+// 用于降低大索引的尾延迟。与 ES 的多分片一样，评分使用各分区自身的词项统计。
+// 该设置可通过 _settings 动态修改，每次请求时读取；未设置、0 或 1 表示不分区。
+
+// searchConcurrencySetting 设置项路径（不含 "index." 前缀）
+const searchConcurrencySetting = "search.concurrency"
+
+// indexSearchConcurrency 读取索引的 search.concurrency，未设置或无法解析时返回 1
+func indexSearchConcurrency(metaStore metadata.MetadataStore, indexName string) int {
+	if metaStore == nil {
+		return 1
+	}
+	meta, err := metaStore.GetIndexMetadata(indexName)
+	if err != nil || meta == nil {
+		return 1
+	}
+	v, ok := lookupIndexSetting(meta.Settings, searchConcurrencySetting)
+	if !ok {
+		return 1
+	}
+	n, err := parseIndexIntSetting(v, searchConcurrencySetting)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_SearchConcurrency(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/items", `{
+		"mappings":{"properties":{"n":{"type":"integer"},"color":{"type":"keyword"},"title":{"type":"text"}}}
+	}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 每个批次生成一个段
+	colors := []string{"red", "green", "blue"}
+	id := 0
+	for b := 0; b < 5; b++ {
+		var body strings.Builder
+		for k := 0; k <= b*2; k++ {
+			fmt.Fprintf(&body, "{\"index\":{\"_index\":\"items\",\"_id\":\"%d\"}}\n", id)
+			fmt.Fprintf(&body, "{\"n\":%d,\"color\":%q,\"title\":\"item number %d\"}\n", (id*7)%23, colors[id%3], id)
+			id++
+		}
+		if w := do("POST", "/_bulk?refresh=true", body.String()); w.Code != http.StatusOK {
+			t.Fatalf("bulk %d: got %d: %s", b, w.Code, w.Body.String())
+		}
+	}
+
+	type searchResponse struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID     string                 `json:"_id"`
+				Source map[string]interface{} `json:"_source"`
+				Sort   []interface{}          `json:"sort"`
+			} `json:"hits"`
+		} `json:"hits"`
+		Aggregations json.RawMessage `json:"aggregations"`
+	}
+	search := func(body string) searchResponse {
+		t.Helper()
+		w := do("POST", "/items/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp searchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+	ids := func(resp searchResponse) []string {
+		var rv []string
+		for _, hit := range resp.Hits.Hits {
+			rv = append(rv, hit.ID)
+		}
+		return rv
+	}
+
+	queries := []string{
+		`{"sort":[{"n":"asc"},{"_id":"asc"}],"from":3,"size":5}`,
+		`{"query":{"term":{"color":"red"}},"sort":[{"n":"desc"},{"_id":"asc"}],"size":4}`,
+		`{"sort":[{"n":"asc"},{"_id":"asc"}],"search_after":[10,"0"],"size":6}`,
+		`{"size":0,"sort":["_id"],"aggs":{"colors":{"terms":{"field":"color"}},"max_n":{"max":{"field":"n"}}}}`,
+	}
+	baseline := make([]searchResponse, len(queries))
+	for q, body := range queries {
+		baseline[q] = search(body)
+	}
+	scored := search(`{"query":{"match":{"title":"item"}},"size":100}`)
+
+	if w := do("PUT", "/items/_settings", `{"index":{"search":{"concurrency":3}}}`); w.Code != http.StatusOK {
+		t.Fatalf("update settings: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 分区并行搜索的排序、分页与聚合结果与整体搜索一致
+	for q, body := range queries {
+		resp := search(body)
+		if resp.Hits.Total.Value != baseline[q].Hits.Total.Value {
+			t.Errorf("%s: expected total %d, got %d", body, baseline[q].Hits.Total.Value, resp.Hits.Total.Value)
+		}
+		if fmt.Sprint(ids(resp)) != fmt.Sprint(ids(baseline[q])) {
+			t.Errorf("%s: expected hits %v, got %v", body, ids(baseline[q]), ids(resp))
+		}
+		for h, hit := range resp.Hits.Hits {
+			if h < len(baseline[q].Hits.Hits) && fmt.Sprint(hit.Sort) != fmt.Sprint(baseline[q].Hits.Hits[h].Sort) {
+				t.Errorf("%s: hit %s: expected sort values %v, got %v", body, hit.ID, baseline[q].Hits.Hits[h].Sort, hit.Sort)
+			}
+			if hit.Source == nil {
+				t.Errorf("%s: hit %s: missing _source", body, hit.ID)
+			}
+		}
+		if string(resp.Aggregations) != string(baseline[q].Aggregations) {
+			t.Errorf("%s: expected aggregations %s, got %s", body, baseline[q].Aggregations, resp.Aggregations)
+		}
+	}
+
+	// 评分按分区统计，命中集合不变
+	resp := search(`{"query":{"match":{"title":"item"}},"size":100}`)
+	expected, got := ids(scored), ids(resp)
+	sort.Strings(expected)
+	sort.Strings(got)
+	if resp.Hits.Total.Value != id || fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("match: expected %d hits %v, got %d %v", id, expected, resp.Hits.Total.Value, got)
+	}
+
+	invalid := []struct {
+		settings string
+		message  string
+	}{
+		{`{"index":{"search":{"concurrency":-1}}}`, "failed to parse value [-1] for setting [index.search.concurrency]"},
+		{`{"index":{"search.concurrency":"many"}}`, "failed to parse value [many] for setting [index.search.concurrency]"},
+	}
+	for _, tt := range invalid {
+		w := do("PUT", "/items/_settings", tt.settings)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", tt.settings, tt.message, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build vectors
+// +build vectors
+
+package handler
+
+import (
+	"fmt"
+
+	index "github.com/blevesearch/bleve_index_api"
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// esVectorSimilarity ES 相似度名称到 Bleve 相似度的映射
+var esVectorSimilarity = map[string]string{
+	"l2_norm":           index.EuclideanDistance,
+	"dot_product":       index.InnerProduct,
+	"max_inner_product": index.InnerProduct,
+	"cosine":            index.CosineSimilarity,
+}
+
+// denseVectorFieldMapping 将 ES dense_vector 字段转换为 Bleve 向量字段
+// ES格式: {"type": "dense_vector", "dims": 384, "similarity": "cosine"}
+func denseVectorFieldMapping(fieldMap map[string]interface{}) (*mapping.FieldMapping, error) {
+	fieldMapping := mapping.NewVectorFieldMapping()
+	dims, ok := fieldMap["dims"].(float64)
+	if !ok || dims != float64(int(dims)) || int(dims) < mapping.MinVectorDims || int(dims) > mapping.MaxVectorDims {
+		return nil, fmt.Errorf("[dense_vector] [dims] must be an integer between %d and %d", mapping.MinVectorDims, mapping.MaxVectorDims)
+	}
+	fieldMapping.Dims = int(dims)
+	fieldMapping.Similarity = index.CosineSimilarity
+	if v, ok := fieldMap["similarity"]; ok {
+		name, _ := v.(string)
+		similarity, ok := esVectorSimilarity[name]
+		if !ok {
+			return nil, fmt.Errorf("[dense_vector] unknown [similarity] [%v]", v)
+		}
+		fieldMapping.Similarity = similarity
+	}
+	return fieldMapping, nil
+}
+
+// knnSearchRequest 构建一路 knn 召回的检索请求，结果为 k 个最近邻文档，得分为向量相似度乘以 boost
+func knnSearchRequest(spec *knnSpec) (*bleve.SearchRequest, error) {
+	req := bleve.NewSearchRequest(query.NewMatchNoneQuery())
+	req.Size = spec.k
+	if spec.filter != nil {
+		req.AddKNNWithFilter(spec.field, spec.vector, int64(spec.k), spec.boost, spec.filter)
+	} else {
+		req.AddKNN(spec.field, spec.vector, int64(spec.k), spec.boost)
+	}
+	return req, nil
+}
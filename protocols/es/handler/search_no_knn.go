@@ -0,0 +1,38 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !vectors
+// +build !vectors
+
+package handler
+
+import (
+	"fmt"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/mapping"
+)
+
+// denseVectorFieldMapping 未启用 vectors 构建标签时向量字段只保留在 _source 中，不建立向量索引
+func denseVectorFieldMapping(fieldMap map[string]interface{}) (*mapping.FieldMapping, error) {
+	fieldMapping := mapping.NewTextFieldMapping()
+	fieldMapping.Index = false
+	fieldMapping.IncludeInAll = false
+	return fieldMapping, nil
+}
+
+// knnSearchRequest 向量检索依赖 faiss，需要使用 vectors 构建标签
+func knnSearchRequest(spec *knnSpec) (*bleve.SearchRequest, error) {
+	return nil, fmt.Errorf("[knn] search on field [%s] requires a build with the vectors tag", spec.field)
+}
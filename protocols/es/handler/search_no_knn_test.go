@@ -0,0 +1,48 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !vectors
+// +build !vectors
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestDocumentHandler_Search_KNNRequiresVectors 测试未启用 vectors 构建标签时 knn 检索返回 400（而不是被忽略）
+func TestDocumentHandler_Search_KNNRequiresVectors(t *testing.T) {
+	docHandler, cleanup, indexName := setupSearchTestEnvironment(t)
+	defer cleanup()
+
+	for _, searchData := range []string{
+		`{"knn":{"field":"vec","query_vector":[1,2],"k":10,"num_candidates":100}}`,
+		`{"query":{"match_all":{}},"knn":{"field":"vec","query_vector":[1,2],"k":10},"rank":{"rrf":{}}}`,
+	} {
+		searchReq := httptest.NewRequest("POST", "/"+indexName+"/_search", strings.NewReader(searchData))
+		searchReq.Header.Set("Content-Type", "application/json")
+		searchReq = mux.SetURLVars(searchReq, map[string]string{"index": indexName})
+		searchW := httptest.NewRecorder()
+		docHandler.Search(searchW, searchReq)
+
+		if searchW.Code != http.StatusBadRequest || !strings.Contains(searchW.Body.String(), "vectors tag") {
+			t.Fatalf("Expected 400 for %s, got status %d: %s", searchData, searchW.Code, searchW.Body.String())
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// 搜索 Profile（"profile": true）
+// executeSearchInternal 在各阶段调用 searchProfiler.start 记录耗时；搜索完成后按查询树逐个节点
+// 单独构建并遍历 searcher，得到每个节点的 create_weight / next_doc 耗时，输出 ES profile 响应格式。
+
+// 搜索阶段
+const (
+	profilePhaseParse       = "parse"
+	profilePhaseRewrite     = "rewrite"
+	profilePhaseSearch      = "search"
+	profilePhaseFetch       = "fetch"
+	profilePhaseAggregation = "aggregation"
+)
+
+// queryBreakdownKeys ES 查询节点 breakdown 的全部计时项
+var queryBreakdownKeys = []string{
+	"create_weight", "build_scorer", "next_doc", "advance", "score", "match",
+	"shallow_advance", "compute_max_score", "set_min_competitive_score",
+}
+
+// searchProfiler 记录单次搜索各阶段耗时，未开启 profile 时为 nil（所有方法可安全调用）
+type searchProfiler struct {
+	phases map[string]time.Duration
+	// timePruning 由搜索填充的段级时间裁剪统计
+	timePruning search.TimePruningStats
+}
+
+// newSearchProfiler 创建 profiler，enabled 为 false 时返回 nil
+func newSearchProfiler(enabled bool) *searchProfiler {
+	if !enabled {
+		return nil
+	}
+	return &searchProfiler{phases: make(map[string]time.Duration)}
+}
+
+// start 开始记录阶段耗时，返回的函数用于结束记录（同一阶段多次记录时累加）
+func (p *searchProfiler) start(phase string) func() {
+	if p == nil {
+		return func() {}
+	}
+	begin := time.Now()
+	return func() {
+		p.phases[phase] += time.Since(begin)
+	}
+}
+
+// withTimePruning 让搜索在 ctx 中回填段级时间裁剪统计
+func (p *searchProfiler) withTimePruning(ctx context.Context) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, search.TimePruningStatsKey, &p.timePruning)
+}
+
+// build 构建 ES 格式的 profile 响应
+func (p *searchProfiler) build(idx bleve.Index, indexName string, q query.Query, aggregations map[string]map[string]interface{}) map[string]interface{} {
+	queryProfiles := make([]interface{}, 0, 1)
+	if node, err := profileQueryTree(idx, q); err == nil {
+		queryProfiles = append(queryProfiles, node)
+	}
+
+	searchNanos := p.phases[profilePhaseSearch].Nanoseconds()
+	searchProfile := map[string]interface{}{
+		"query": queryProfiles,
+		// 查询解析与 join 查询改写都计入 rewrite_time
+		"rewrite_time": (p.phases[profilePhaseParse] + p.phases[profilePhaseRewrite]).Nanoseconds(),
+		"collector": []interface{}{
+			map[string]interface{}{
+				"name":          "SimpleTopScoreDocCollector",
+				"reason":        "search_top_hits",
+				"time_in_nanos": searchNanos,
+			},
+		},
+	}
+	if p.timePruning.Field != "" {
+		searchProfile["time_pruning"] = map[string]interface{}{
+			"field":           p.timePruning.Field,
+			"segments_total":  p.timePruning.SegmentsTotal,
+			"segments_pruned": p.timePruning.SegmentsPruned,
+		}
+	}
+	shard := map[string]interface{}{
+		"id":           fmt.Sprintf("[%s][%s][0]", NodeName, indexName),
+		"searches":     []interface{}{searchProfile},
+		"aggregations": p.buildAggregations(aggregations),
+		"fetch":        p.buildFetch(),
+	}
+	return map[string]interface{}{
+		"shards": []interface{}{shard},
+	}
+}
+
+// buildAggregations 构建聚合 profile
+// 聚合结果在同一阶段统一构建，各聚合记录的是该阶段的总耗时
+func (p *searchProfiler) buildAggregations(aggregations map[string]map[string]interface{}) []interface{} {
+	names := make([]string, 0, len(aggregations))
+	for name := range aggregations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	aggNanos := p.phases[profilePhaseAggregation].Nanoseconds()
+	result := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		aggType := ""
+		for key := range aggregations[name] {
+			if key != "aggs" && key != "aggregations" && key != "meta" {
+				aggType = key
+				break
+			}
+		}
+		result = append(result, map[string]interface{}{
+			"type":          aggType,
+			"description":   name,
+			"time_in_nanos": aggNanos,
+			"breakdown": map[string]interface{}{
+				"initialize":                 0,
+				"initialize_count":           0,
+				"build_leaf_collector":       0,
+				"build_leaf_collector_count": 0,
+				"collect":                    0,
+				"collect_count":              0,
+				"post_collection":            0,
+				"post_collection_count":      0,
+				"build_aggregation":          aggNanos,
+				"build_aggregation_count":    1,
+				"reduce":                     0,
+				"reduce_count":               0,
+			},
+		})
+	}
+	return result
+}
+
+// buildFetch 构建 fetch 阶段 profile
+func (p *searchProfiler) buildFetch() map[string]interface{} {
+	fetchNanos := p.phases[profilePhaseFetch].Nanoseconds()
+	return map[string]interface{}{
+		"type":          "fetch",
+		"description":   "",
+		"time_in_nanos": fetchNanos,
+		"breakdown": map[string]interface{}{
+			"next_reader":              0,
+			"next_reader_count":        1,
+			"load_stored_fields":       fetchNanos,
+			"load_stored_fields_count": 1,
+		},
+		"debug": map[string]interface{}{
+			"stored_fields": []string{"_id", "_source"},
+		},
+	}
+}
+
+// profileQueryTree 为查询树的每个节点单独构建 searcher 并遍历全部匹配文档以采集耗时
+func profileQueryTree(idx bleve.Index, q query.Query) (map[string]interface{}, error) {
+	advanced, err := idx.Advanced()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := advanced.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return profileQueryNode(context.Background(), reader, idx.Mapping(), q), nil
+}
+
+// profileQueryNode 采集单个查询节点（及其子节点）的耗时
+func profileQueryNode(ctx context.Context, reader index.IndexReader, m mapping.IndexMapping, q query.Query) map[string]interface{} {
+	breakdown := make(map[string]interface{}, len(queryBreakdownKeys)*2)
+	for _, key := range queryBreakdownKeys {
+		breakdown[key] = int64(0)
+		breakdown[key+"_count"] = int64(0)
+	}
+
+	var total time.Duration
+	begin := time.Now()
+	s, err := q.Searcher(ctx, reader, m, search.SearcherOptions{})
+	createWeight := time.Since(begin)
+	total += createWeight
+	breakdown["create_weight"] = createWeight.Nanoseconds()
+	breakdown["create_weight_count"] = int64(1)
+	if err == nil {
+		sctx := &search.SearchContext{
+			DocumentMatchPool: search.NewDocumentMatchPool(s.DocumentMatchPoolSize(), 0),
+			IndexReader:       reader,
+		}
+		var nextCount int64
+		begin = time.Now()
+		for {
+			match, err := s.Next(sctx)
+			if err != nil || match == nil {
+				break
+			}
+			nextCount++
+			sctx.DocumentMatchPool.Put(match)
+		}
+		nextDoc := time.Since(begin)
+		total += nextDoc
+		breakdown["next_doc"] = nextDoc.Nanoseconds()
+		breakdown["next_doc_count"] = nextCount + 1
+		breakdown["match_count"] = nextCount
+		s.Close()
+	}
+
+	node := map[string]interface{}{
+		"type":          queryTypeName(q),
+		"description":   queryDescription(q),
+		"time_in_nanos": total.Nanoseconds(),
+		"breakdown":     breakdown,
+	}
+	if children := subQueries(q); len(children) > 0 {
+		childProfiles := make([]interface{}, 0, len(children))
+		for _, child := range children {
+			childProfiles = append(childProfiles, profileQueryNode(ctx, reader, m, child))
+		}
+		node["children"] = childProfiles
+	}
+	return node
+}
+
+// subQueries 返回复合查询的直接子查询
+func subQueries(q query.Query) []query.Query {
+	var children []query.Query
+	switch v := q.(type) {
+	case *query.BooleanQuery:
+		for _, child := range []query.Query{v.Must, v.Should, v.MustNot, v.Filter} {
+			if child != nil {
+				children = append(children, child)
+			}
+		}
+	case *query.ConjunctionQuery:
+		children = append(children, v.Conjuncts...)
+	case *query.DisjunctionQuery:
+		children = append(children, v.Disjuncts...)
+	case *dsl.DisMaxQuery:
+		children = append(children, v.Disjuncts...)
+	}
+	return children
+}
+
+// queryTypeName 返回查询类型名（如 TermQuery、BooleanQuery）
+func queryTypeName(q query.Query) string {
+	t := reflect.TypeOf(q)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// queryDescription 返回查询的 JSON 描述
+func queryDescription(q query.Query) string {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Sprintf("%T", q)
+	}
+	return string(data)
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+)
+
+// 搜索慢日志：查询阶段耗时超过阈值时按对应级别记录请求体
+// 阈值通过集群动态设置 search.slowlog.threshold.query.{warn,info,debug} 调整，小于 0 表示关闭（默认全部关闭）
+var (
+	slowlogWarnThreshold  atomic.Int64
+	slowlogInfoThreshold  atomic.Int64
+	slowlogDebugThreshold atomic.Int64
+)
+
+func init() {
+	slowlogWarnThreshold.Store(-1)
+	slowlogInfoThreshold.Store(-1)
+	slowlogDebugThreshold.Store(-1)
+}
+
+// setSearchSlowlogThreshold 设置指定级别的慢日志阈值，d < 0 表示关闭
+func setSearchSlowlogThreshold(level string, d time.Duration) {
+	switch level {
+	case "warn":
+		slowlogWarnThreshold.Store(int64(d))
+	case "info":
+		slowlogInfoThreshold.Store(int64(d))
+	case "debug":
+		slowlogDebugThreshold.Store(int64(d))
+	}
+}
+
+// logSearchSlowlog 查询耗时达到阈值时记录慢日志（优先使用最高级别）
+func logSearchSlowlog(indexName string, took time.Duration, totalHits uint64, searchReq *SearchRequest) {
+	var logf func(format string, v ...interface{})
+	switch {
+	case exceedsSlowlogThreshold(&slowlogWarnThreshold, took):
+		logf = logger.Warn
+	case exceedsSlowlogThreshold(&slowlogInfoThreshold, took):
+		logf = logger.Info
+	case exceedsSlowlogThreshold(&slowlogDebugThreshold, took):
+		logf = logger.Debug
+	default:
+		return
+	}
+	source, _ := json.Marshal(searchReq)
+	logf("[index.search.slowlog.query] [%s] took[%s], took_millis[%d], total_hits[%d hits], source[%s]",
+		indexName, took, took.Milliseconds(), totalHits, source)
+}
+
+func exceedsSlowlogThreshold(threshold *atomic.Int64, took time.Duration) bool {
+	t := threshold.Load()
+	return t >= 0 && int64(took) >= t
+}
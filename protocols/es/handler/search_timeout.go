@@ -0,0 +1,80 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/search"
+)
+
+// 搜索超时与取消
+// 请求上下文（r.Context()）在客户端断开时取消，搜索与聚合遍历随之中止；
+// timeout 到期时收集器停止并返回已收集的部分结果，响应中 timed_out 为 true。
+
+// timeUnits ES 时间单位（长单位在前，避免 "ms" 被识别为 "s"）
+var timeUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"nanos", time.Nanosecond},
+	{"micros", time.Microsecond},
+	{"ms", time.Millisecond},
+	{"s", time.Second},
+	{"m", time.Minute},
+	{"h", time.Hour},
+	{"d", 24 * time.Hour},
+}
+
+// parseTimeValue 解析 ES 时间值（如 "500ms"、"1s"、"2m"），空字符串与 "-1" 表示不限制
+func parseTimeValue(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "-1" {
+		return 0, nil
+	}
+	for _, u := range timeUnits {
+		if !strings.HasSuffix(value, u.suffix) {
+			continue
+		}
+		num, err := strconv.ParseFloat(strings.TrimSuffix(value, u.suffix), 64)
+		if err != nil || num < 0 {
+			break
+		}
+		return time.Duration(num * float64(u.unit)), nil
+	}
+	return 0, fmt.Errorf("failed to parse setting [timeout] with value [%s] as a time value: unit is missing or unrecognized", value)
+}
+
+// newSearchContext 基于请求上下文创建搜索上下文：设置超时时要求收集器在到期时返回部分结果
+func newSearchContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	ctx = context.WithValue(ctx, search.PartialResultsOnTimeoutKey, true)
+	return context.WithTimeout(ctx, timeout)
+}
+
+// searchCancelledError 客户端断开等原因导致请求上下文被取消时返回的错误
+func searchCancelledError(ctx context.Context) common.APIError {
+	return common.NewTaskCancelledError(fmt.Sprintf("search cancelled: %v", ctx.Err()))
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"strings"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// 字段级与文档级安全
+// 角色由认证中间件放入请求 context：文档级安全查询与 search/count/get 的查询组合（与别名 filter 相同），
+// 字段级安全在返回 _source、高亮与 field_caps 时去掉不可见的字段；查询、排序与聚合中引用的不可见字段按未映射字段处理，
+// 避免通过命中结果、排序或聚合桶推断出不可见字段的值。
+
+// hiddenFieldPlaceholder 替换排序与聚合中的不可见字段：该字段不会被索引，排序与聚合的结果与未映射字段相同
+const hiddenFieldPlaceholder = "_hidden_field"
+
+// requestIndexAccess 返回请求角色对索引的限制，indexName 为物理索引名（多租户请求去掉租户前缀后匹配角色）
+func requestIndexAccess(ctx context.Context, indexName string) *middleware.IndexAccess {
+	return middleware.IndexAccessFromContext(ctx, strings.TrimPrefix(indexName, tenantIndexPrefix(ctx)))
+}
+
+type indexAccessContextKey struct{}
+
+// withIndexAccess 返回携带搜索目标索引限制的 context，供 top_hits 等在聚合中读取文档的地方过滤 _source
+func withIndexAccess(ctx context.Context, access *middleware.IndexAccess) context.Context {
+	if access == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, indexAccessContextKey{}, access)
+}
+
+func indexAccessFromContext(ctx context.Context) *middleware.IndexAccess {
+	access, _ := ctx.Value(indexAccessContextKey{}).(*middleware.IndexAccess)
+	return access
+}
+
+// restrictQueryFields 让解析器把请求角色不可见的字段按未映射字段处理
+func restrictQueryFields(parser *dsl.QueryParser, access *middleware.IndexAccess) {
+	if access.FieldsRestricted() {
+		parser.SetFieldFilter(access.FieldAllowed)
+	}
+}
+
+// hideSortFields 将排序中不可见的字段替换为占位字段
+func hideSortFields(access *middleware.IndexAccess, sortSpec []interface{}) []interface{} {
+	if !access.FieldsRestricted() {
+		return sortSpec
+	}
+	out := make([]interface{}, len(sortSpec))
+	for i, item := range sortSpec {
+		switch v := item.(type) {
+		case string:
+			if !access.FieldAllowed(v) {
+				v = hiddenFieldPlaceholder
+			}
+			out[i] = v
+		case map[string]interface{}:
+			rewritten := make(map[string]interface{}, len(v))
+			for field, opts := range v {
+				if !access.FieldAllowed(field) {
+					field = hiddenFieldPlaceholder
+				}
+				rewritten[field] = opts
+			}
+			out[i] = rewritten
+		default:
+			out[i] = item
+		}
+	}
+	return out
+}
+
+// hideAggregationFields 将聚合定义中引用不可见字段的 "field" 替换为占位字段（递归处理子聚合）
+// filter 等聚合中以字段名为键的查询由 parseAggregations 使用受限的解析器解析
+func hideAggregationFields(access *middleware.IndexAccess, spec interface{}) {
+	switch v := spec.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if field, ok := item.(string); ok && k == "field" {
+				if !access.FieldAllowed(field) {
+					v[k] = hiddenFieldPlaceholder
+				}
+				continue
+			}
+			hideAggregationFields(access, item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			hideAggregationFields(access, item)
+		}
+	}
+}
+
+// scriptedSearchPart 返回请求中使用脚本的部分（_script 排序、script_fields 或聚合脚本），没有时返回空字符串
+// 脚本可以读取任意字段，限制字段时无法改写为占位字段，只能拒绝；查询中的脚本由受限的解析器拒绝
+func scriptedSearchPart(searchReq *SearchRequest) string {
+	for _, item := range searchReq.Sort {
+		if m, ok := item.(map[string]interface{}); ok {
+			if _, ok := m["_script"]; ok {
+				return "_script sort"
+			}
+		}
+	}
+	if len(searchReq.ScriptFields) > 0 {
+		return "script_fields"
+	}
+	for _, aggSpec := range searchReq.Aggregations {
+		if aggregationUsesScript(aggSpec) {
+			return "aggregation scripts"
+		}
+	}
+	return ""
+}
+
+// aggregationUsesScript 判断聚合定义（含子聚合）是否包含读取文档的脚本
+// bucket_script/bucket_selector 只读取父聚合的桶指标，不受限制
+func aggregationUsesScript(spec interface{}) bool {
+	switch v := spec.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			switch k {
+			case "script", "init_script", "map_script", "combine_script", "reduce_script":
+				return true
+			case "bucket_script", "bucket_selector":
+				continue
+			}
+			if aggregationUsesScript(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if aggregationUsesScript(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyDocumentSecurity 将文档级安全查询作为 filter 与已解析的请求查询组合
+// 文档级安全查询由角色定义，可以引用请求不可见的字段，因此使用不受字段级安全限制的解析器单独解析
+func (h *DocumentHandler) applyDocumentSecurity(q query.Query, indexName string, access *middleware.IndexAccess) (query.Query, error) {
+	dls := access.Query()
+	if dls == nil {
+		return q, nil
+	}
+	parser := h.newQueryParser(indexName)
+	filter, err := parser.ParseQuery(dls)
+	if err != nil {
+		return nil, err
+	}
+	if err := restrictJoinQueries(q, func() (query.Query, error) { return parser.ParseQuery(dls) }); err != nil {
+		return nil, err
+	}
+	boolQuery := query.NewBooleanQuery([]query.Query{q}, nil, nil)
+	boolQuery.AddFilter(filter)
+	return boolQuery, nil
+}
+
+// restrictJoinQueries 将文档级安全查询与 has_child/has_parent 的内部查询组合（递归处理内部查询中的 join 查询）
+// 内部查询在展开时单独执行，不组合时不可见的子（父）文档也会使父（子）文档匹配并出现在 inner_hits 中
+func restrictJoinQueries(q query.Query, parseFilter func() (query.Query, error)) error {
+	for _, info := range dsl.FindJoinQueries(q) {
+		if err := restrictJoinQueries(info.InnerQuery, parseFilter); err != nil {
+			return err
+		}
+		filter, err := parseFilter()
+		if err != nil {
+			return err
+		}
+		inner := query.NewBooleanQuery([]query.Query{info.InnerQuery}, nil, nil)
+		inner.AddFilter(filter)
+		info.InnerQuery = inner
+	}
+	return nil
+}
+
+// filterHighlight 去掉不可见字段的高亮片段
+func filterHighlight(access *middleware.IndexAccess, fragments search.FieldFragmentMap) search.FieldFragmentMap {
+	if !access.FieldsRestricted() {
+		return fragments
+	}
+	rv := make(search.FieldFragmentMap, len(fragments))
+	for field, frags := range fragments {
+		if access.FieldAllowed(field) {
+			rv[field] = frags
+		}
+	}
+	return rv
+}
+
+// filterFieldCaps 去掉不可见的字段，保留包含可见子字段的 object/nested 字段
+func filterFieldCaps(access *middleware.IndexAccess, caps map[string]fieldCapability) map[string]fieldCapability {
+	if !access.FieldsRestricted() {
+		return caps
+	}
+	rv := make(map[string]fieldCapability, len(caps))
+	for field, c := range caps {
+		if !access.FieldAllowed(field) {
+			continue
+		}
+		rv[field] = c
+		for i := strings.LastIndex(field, "."); i > 0; i = strings.LastIndex(field[:i], ".") {
+			if parent, ok := caps[field[:i]]; ok {
+				rv[field[:i]] = parent
+			}
+		}
+	}
+	return rv
+}
+
+// documentVisible 判断文档是否满足请求角色的文档级安全查询，查询无法解析或执行失败时视为不可见
+func (h *DocumentHandler) documentVisible(idx bleve.Index, indexName string, access *middleware.IndexAccess, docID string) bool {
+	dls := access.Query()
+	if dls == nil {
+		return true
+	}
+	q, err := h.newQueryParser(indexName).ParseQuery(dls)
+	if err != nil {
+		return false
+	}
+	if q, err = h.resolveRootQuery(idx, indexName, q); err != nil {
+		return false
+	}
+	req := bleve.NewSearchRequest(query.NewConjunctionQuery([]query.Query{query.NewDocIDQuery([]string{docID}), q}))
+	req.Size = 0
+	result, err := idx.Search(req)
+	return err == nil && result.Total > 0
+}
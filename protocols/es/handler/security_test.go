@@ -0,0 +1,253 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+)
+
+func TestFieldAndDocumentLevelSecurity(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "GET", Path: "/{index}/_termvectors/{id}", Handler: docHandler.TermVectors},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/{index}/_count", Handler: docHandler.CountDocuments},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "GET", Path: "/{index}/_field_caps", Handler: indexHandler.FieldCaps},
+	})
+
+	config := &middleware.AuthConfig{
+		Enabled: true,
+		Type:    "apikey",
+		ApiKeys: map[string]bool{"admin-key": true, "sales-key": true},
+		Roles: map[string]*middleware.Role{
+			"sales": {Indices: []middleware.RoleIndexPrivileges{{
+				Names:         []string{"orders*"},
+				FieldSecurity: &middleware.FieldSecurity{Grant: []string{"region", "customer.*"}, Except: []string{"customer.email"}},
+				Query:         `{"term": {"region": "eu"}}`,
+			}}},
+		},
+		APIKeyRoles: map[string][]string{"sales-key": {"sales"}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	handler := middleware.AuthMiddleware(config, nil)(router.Build())
+
+	do := func(apiKey, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.Contains(path, "_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		req.Header.Set("X-API-Key", apiKey)
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("admin-key", "PUT", "/orders", ""); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	bulk := "{\"index\":{\"_index\":\"orders\",\"_id\":\"1\"}}\n" +
+		"{\"region\":\"eu\",\"amount\":10,\"customer\":{\"name\":\"alice\",\"email\":\"a@example.com\"}}\n" +
+		"{\"index\":{\"_index\":\"orders\",\"_id\":\"2\"}}\n" +
+		"{\"region\":\"us\",\"amount\":20,\"customer\":{\"name\":\"bob\",\"email\":\"b@example.com\"}}\n"
+	if w := do("admin-key", "POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK {
+		t.Fatalf("bulk: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 搜索只返回 region=eu 的文档，_source 去掉 amount 与 customer.email
+	w := do("sales-key", "POST", "/orders/_search", `{"query": {"match_all": {}}}`)
+	var searchResp struct {
+		Hits struct {
+			Hits []struct {
+				ID     string                 `json:"_id"`
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &searchResp); err != nil {
+		t.Fatalf("decode search: %v: %s", err, w.Body.String())
+	}
+	if len(searchResp.Hits.Hits) != 1 || searchResp.Hits.Hits[0].ID != "1" {
+		t.Fatalf("Expected only document 1, got %s", w.Body.String())
+	}
+	source := searchResp.Hits.Hits[0].Source
+	customer, _ := source["customer"].(map[string]interface{})
+	if _, ok := source["amount"]; ok || source["region"] != "eu" || customer["name"] != "alice" || customer["email"] != nil {
+		t.Errorf("Unexpected filtered _source: %v", source)
+	}
+	if w := do("admin-key", "POST", "/orders/_search", `{}`); !strings.Contains(w.Body.String(), "b@example.com") {
+		t.Errorf("Expected a key without roles to see all documents and fields, got %s", w.Body.String())
+	}
+
+	if w := do("sales-key", "POST", "/orders/_count", `{}`); !strings.Contains(w.Body.String(), `"count":1`) {
+		t.Errorf("count: expected 1, got %s", w.Body.String())
+	}
+
+	if w := do("sales-key", "GET", "/orders/_doc/2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("get: expected 404 for a document outside the role query, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("sales-key", "GET", "/orders/_doc/1", ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "a@example.com") {
+		t.Errorf("get: expected filtered document, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("sales-key", "GET", "/orders/_termvectors/2", ""); !strings.Contains(w.Body.String(), `"found":false`) {
+		t.Errorf("termvectors: expected found=false for a document outside the role query, got %s", w.Body.String())
+	}
+	w = do("sales-key", "GET", "/orders/_termvectors/1?fields=customer.*", "")
+	if !strings.Contains(w.Body.String(), `"alice"`) || strings.Contains(w.Body.String(), "example") {
+		t.Errorf("termvectors: expected only visible fields, got %s", w.Body.String())
+	}
+
+	w = do("sales-key", "GET", "/orders/_field_caps?fields=*", "")
+	var capsResp struct {
+		Fields map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &capsResp); err != nil {
+		t.Fatalf("decode field caps: %v: %s", err, w.Body.String())
+	}
+	for _, field := range []string{"region", "customer", "customer.name", "_id"} {
+		if _, ok := capsResp.Fields[field]; !ok {
+			t.Errorf("field caps: expected field [%s], got %s", field, w.Body.String())
+		}
+	}
+	for _, field := range []string{"amount", "customer.email"} {
+		if _, ok := capsResp.Fields[field]; ok {
+			t.Errorf("field caps: expected field [%s] to be hidden", field)
+		}
+	}
+
+	// 查询、排序与聚合中的不可见字段按未映射字段处理，不能借此推断字段值
+	for body, want := range map[string]int{
+		`{"query": {"term": {"amount": 10}}}`:                                                 0,
+		`{"query": {"match": {"customer.email": "a@example.com"}}}`:                           0,
+		`{"query": {"range": {"amount": {"gte": 5}}}}`:                                        0,
+		`{"query": {"query_string": {"query": "amount:10"}}}`:                                 0,
+		`{"query": {"bool": {"must_not": [{"match": {"customer.email": "a@example.com"}}]}}}`: 1,
+		`{"query": {"term": {"region": "eu"}}, "sort": [{"amount": "desc"}]}`:                 1,
+	} {
+		w := do("sales-key", "POST", "/orders/_search", body)
+		if err := json.Unmarshal(w.Body.Bytes(), &searchResp); err != nil || len(searchResp.Hits.Hits) != want {
+			t.Errorf("%s: expected %d hits, got %d: %s", body, want, w.Code, w.Body.String())
+		}
+	}
+	w = do("sales-key", "POST", "/orders/_search", `{"size": 0, "aggs": {"emails": {"terms": {"field": "customer.email"}}, `+
+		`"amounts": {"filter": {"range": {"amount": {"gte": 5}}}}, "regions": {"terms": {"field": "region"}}}}`)
+	var aggResp struct {
+		Aggregations map[string]struct {
+			DocCount int `json:"doc_count"`
+			Buckets  []struct {
+				Key interface{} `json:"key"`
+			} `json:"buckets"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &aggResp); err != nil {
+		t.Fatalf("decode aggregations: %v: %s", err, w.Body.String())
+	}
+	if emails := aggResp.Aggregations["emails"]; len(emails.Buckets) != 0 || strings.Contains(w.Body.String(), "example") {
+		t.Errorf("Expected no buckets for a hidden field, got %s", w.Body.String())
+	}
+	if aggResp.Aggregations["amounts"].DocCount != 0 || len(aggResp.Aggregations["regions"].Buckets) != 1 {
+		t.Errorf("Unexpected aggregations: %s", w.Body.String())
+	}
+	if w := do("sales-key", "POST", "/orders/_count", `{"query": {"term": {"amount": 10}}}`); !strings.Contains(w.Body.String(), `"count":0`) {
+		t.Errorf("count: expected 0 for a hidden field, got %s", w.Body.String())
+	}
+
+	// 脚本可以读取不可见字段，限制字段时拒绝
+	for _, body := range []string{
+		`{"query": {"script": {"script": "doc['amount'].value > 5"}}}`,
+		`{"query": {"script_score": {"query": {"match_all": {}}, "script": "doc['amount'].value"}}}`,
+		`{"query": {"function_score": {"functions": [{"script_score": {"script": "doc['amount'].value"}}]}}}`,
+		`{"query": {"terms_set": {"region": {"terms": ["eu"], "minimum_should_match_script": {"source": "doc['amount'].value"}}}}}`,
+		`{"sort": [{"_script": {"type": "number", "script": "doc['amount'].value", "order": "desc"}}]}`,
+		`{"script_fields": {"a": {"script": "params._source.amount"}}}`,
+		`{"size": 0, "aggs": {"total": {"scripted_metric": {"init_script": "state.s = 0", "map_script": "state.s += doc['amount'].value", ` +
+			`"combine_script": "return state.s", "reduce_script": "return states"}}}}`,
+		`{"size": 0, "aggs": {"total": {"sum": {"script": "doc['amount'].value"}}}}`,
+	} {
+		if w := do("sales-key", "POST", "/orders/_search", body); w.Code != http.StatusBadRequest || strings.Contains(w.Body.String(), "hits") {
+			t.Errorf("%s: expected 400 with field level security, got %d: %s", body, w.Code, w.Body.String())
+		}
+		if w := do("admin-key", "POST", "/orders/_search", body); w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 without field level security, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+	if w := do("sales-key", "POST", "/orders/_count", `{"query": {"script": {"script": "doc['amount'].value > 5"}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("count: expected 400 for a script query with field level security, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// nested 查询内部省略 path 的字段按完整路径检查
+	if w := do("admin-key", "PUT", "/orders-lines", `{"mappings": {"properties": {"region": {"type": "keyword"}, `+
+		`"lines": {"type": "nested", "properties": {"region": {"type": "keyword"}}}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("admin-key", "POST", "/_bulk?refresh=true", "{\"index\":{\"_index\":\"orders-lines\",\"_id\":\"1\"}}\n"+
+		"{\"region\":\"eu\",\"lines\":[{\"region\":\"apac\"}]}\n"); w.Code != http.StatusOK {
+		t.Fatalf("bulk: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	const nestedBody = `{"query": {"nested": {"path": "lines", "query": {"term": {"region": "apac"}}}}}`
+	if w := do("admin-key", "POST", "/orders-lines/_search", nestedBody); !strings.Contains(w.Body.String(), `"value":1`) {
+		t.Errorf("nested: expected a hit without field security, got %s", w.Body.String())
+	}
+	if w := do("sales-key", "POST", "/orders-lines/_search", nestedBody); !strings.Contains(w.Body.String(), `"value":0`) {
+		t.Errorf("nested: expected no hits on the hidden lines.region, got %s", w.Body.String())
+	}
+
+	// has_child/has_parent 的内部查询同样限定在可见文档上，inner_hits 过滤 _source
+	if w := do("admin-key", "PUT", "/orders-qa", `{"mappings": {"properties": {"region": {"type": "keyword"}, `+
+		`"customer": {"properties": {"name": {"type": "keyword"}, "email": {"type": "keyword"}}}, `+
+		`"my_join": {"type": "join", "relations": {"question": "answer"}}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("admin-key", "POST", "/_bulk?refresh=true", "{\"index\":{\"_index\":\"orders-qa\",\"_id\":\"q1\"}}\n"+
+		"{\"region\":\"eu\",\"my_join\":\"question\"}\n"+
+		"{\"index\":{\"_index\":\"orders-qa\",\"_id\":\"a1\"}}\n"+
+		"{\"region\":\"us\",\"customer\":{\"name\":\"carol\"},\"my_join\":{\"name\":\"answer\",\"parent\":\"q1\"}}\n"+
+		"{\"index\":{\"_index\":\"orders-qa\",\"_id\":\"a2\"}}\n"+
+		"{\"region\":\"eu\",\"customer\":{\"name\":\"dave\",\"email\":\"d@example.com\"},\"my_join\":{\"name\":\"answer\",\"parent\":\"q1\"}}\n"); w.Code != http.StatusOK {
+		t.Fatalf("bulk: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	const hiddenChildBody = `{"query": {"has_child": {"type": "answer", "query": {"term": {"customer.name": "carol"}}}}}`
+	if w := do("admin-key", "POST", "/orders-qa/_search", hiddenChildBody); !strings.Contains(w.Body.String(), `"value":1`) {
+		t.Errorf("has_child: expected a hit without document security, got %s", w.Body.String())
+	}
+	if w := do("sales-key", "POST", "/orders-qa/_search", hiddenChildBody); !strings.Contains(w.Body.String(), `"value":0`) {
+		t.Errorf("has_child: expected a hidden child not to match its parent, got %s", w.Body.String())
+	}
+	w = do("sales-key", "POST", "/orders-qa/_search", `{"query": {"has_child": {"type": "answer", "query": {"match_all": {}}, "inner_hits": {}}}}`)
+	var joinResp joinTestHits
+	if err := json.Unmarshal(w.Body.Bytes(), &joinResp); err != nil {
+		t.Fatalf("decode has_child: %v: %s", err, w.Body.String())
+	}
+	if len(joinResp.Hits.Hits) != 1 {
+		t.Fatalf("has_child: expected only q1, got %s", w.Body.String())
+	}
+	innerHits := joinResp.Hits.Hits[0].InnerHits["answer"].Hits.Hits
+	if len(innerHits) != 1 || innerHits[0].ID != "a2" || strings.Contains(w.Body.String(), "example") {
+		t.Errorf("has_child: expected only the visible child a2 with filtered _source, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// significant_terms 聚合：比较词项在前景集合（查询命中的文档）与背景集合（整个索引或 background_filter）中的频率，
+// 返回在前景中异常频繁的词项
+
+// 显著性评分算法
+const (
+	significanceHeuristicJLH       = "jlh"
+	significanceHeuristicChiSquare = "chi_square"
+)
+
+// SignificantTermsAggregationInfo significant_terms聚合信息
+type SignificantTermsAggregationInfo struct {
+	Aggregations map[string]*SignificantTermsAggregationConfig
+}
+
+// SignificantTermsAggregationConfig significant_terms聚合配置
+// ES格式: {"significant_terms": {"field": "message", "size": 10, "min_doc_count": 3, "background_filter": {...}, "chi_square": {...}}}
+type SignificantTermsAggregationConfig struct {
+	Field                string
+	Size                 int         // 返回的桶数（默认10）
+	ShardSize            int         // 参与评分的前景候选词项数（默认 size*1.5+10）
+	MinDocCount          int         // 前景中的最小文档数（默认3）
+	BackgroundFilter     query.Query // 背景集合过滤条件，为空时背景为整个索引
+	Heuristic            string      // jlh 或 chi_square
+	IncludeNegatives     bool        // chi_square: 是否保留在前景中比背景更少见的词项
+	BackgroundIsSuperset bool        // chi_square: 背景集合是否包含前景集合（默认true）
+}
+
+// parseSignificantTermsAggregation 解析significant_terms聚合
+func (h *DocumentHandler) parseSignificantTermsAggregation(ctx context.Context, config map[string]interface{}) (*SignificantTermsAggregationConfig, error) {
+	field, ok := config["field"].(string)
+	if !ok || field == "" {
+		return nil, fmt.Errorf("significant_terms aggregation requires a 'field' parameter")
+	}
+
+	stConfig := &SignificantTermsAggregationConfig{
+		Field:                field,
+		Size:                 10,
+		MinDocCount:          3,
+		Heuristic:            significanceHeuristicJLH,
+		BackgroundIsSuperset: true,
+	}
+	if size, ok := config["size"].(float64); ok && size > 0 {
+		stConfig.Size = int(size)
+	}
+	stConfig.ShardSize = stConfig.Size*3/2 + 10
+	if shardSize, ok := config["shard_size"].(float64); ok && int(shardSize) > stConfig.Size {
+		stConfig.ShardSize = int(shardSize)
+	}
+	if minDocCount, ok := config["min_doc_count"].(float64); ok && minDocCount >= 0 {
+		stConfig.MinDocCount = int(minDocCount)
+	}
+
+	if bgFilter, ok := config["background_filter"].(map[string]interface{}); ok {
+		parser := dsl.NewQueryParser()
+		restrictQueryFields(parser, indexAccessFromContext(ctx))
+		bgQuery, err := parser.ParseQuery(bgFilter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse background_filter: %w", err)
+		}
+		stConfig.BackgroundFilter = bgQuery
+	}
+
+	if _, ok := config[significanceHeuristicJLH]; ok {
+		stConfig.Heuristic = significanceHeuristicJLH
+	}
+	if chiSquare, ok := config[significanceHeuristicChiSquare].(map[string]interface{}); ok {
+		stConfig.Heuristic = significanceHeuristicChiSquare
+		if v, ok := chiSquare["include_negatives"].(bool); ok {
+			stConfig.IncludeNegatives = v
+		}
+		if v, ok := chiSquare["background_is_superset"].(bool); ok {
+			stConfig.BackgroundIsSuperset = v
+		}
+	}
+	for _, unsupported := range []string{"mutual_information", "gnd", "percentage", "script_heuristic"} {
+		if _, ok := config[unsupported]; ok {
+			return nil, fmt.Errorf("significance heuristic [%s] is not supported, use [jlh] or [chi_square]", unsupported)
+		}
+	}
+	return stConfig, nil
+}
+
+// buildSignificantTermsAggregations 构建significant_terms聚合响应
+func (h *DocumentHandler) buildSignificantTermsAggregations(ctx context.Context, info *SignificantTermsAggregationInfo, idx bleve.Index, baseQuery query.Query) map[string]interface{} {
+	aggs := make(map[string]interface{}, len(info.Aggregations))
+	var mu sync.Mutex
+	tasks := make([]func(), 0, len(info.Aggregations))
+	for aggName, stAgg := range info.Aggregations {
+		tasks = append(tasks, func() {
+			result, err := h.buildSignificantTermsAggregation(ctx, stAgg, idx, baseQuery)
+			if err != nil {
+				logger.Warn("Failed to build significant_terms aggregation [%s]: %v", aggName, err)
+				result = map[string]interface{}{"doc_count": 0, "bg_count": 0, "buckets": []interface{}{}}
+			}
+			mu.Lock()
+			aggs[aggName] = result
+			mu.Unlock()
+		})
+	}
+	aggPool.run(tasks)
+
+	return aggs
+}
+
+// buildSignificantTermsAggregation 构建单个significant_terms聚合响应
+// 前景候选词项来自 terms facet，背景文档数逐词项统计
+func (h *DocumentHandler) buildSignificantTermsAggregation(ctx context.Context, stAgg *SignificantTermsAggregationConfig, idx bleve.Index, baseQuery query.Query) (map[string]interface{}, error) {
+	fgReq := bleve.NewSearchRequest(baseQuery)
+	fgReq.Size = 0
+	fgReq.AddFacet(stAgg.Field, bleve.NewFacetRequest(stAgg.Field, stAgg.ShardSize))
+	fgResult, err := idx.SearchInContext(ctx, fgReq)
+	if err != nil {
+		return nil, err
+	}
+
+	bgQuery := stAgg.BackgroundFilter
+	if bgQuery == nil {
+		bgQuery = query.NewMatchAllQuery()
+	}
+	supersetSize, err := countDocuments(ctx, idx, bgQuery)
+	if err != nil {
+		return nil, err
+	}
+	subsetSize := fgResult.Total
+
+	var terms []*search.TermFacet
+	if facet, ok := fgResult.Facets[stAgg.Field]; ok {
+		terms = facet.Terms.Terms()
+	}
+
+	dict := h.facetTermsDictionary(idx, stAgg.Field)
+	buckets := make([]map[string]interface{}, 0, len(terms))
+	for _, term := range terms {
+		if term.Count < stAgg.MinDocCount {
+			continue
+		}
+		key, cached := dict.Lookup(term.Term)
+		if !cached {
+			key = h.decodeFacetTerm(idx, stAgg.Field, term.Term)
+		}
+		// 空字符串是 shift>0 的 PrefixCoded 词项
+		if keyStr, ok := key.(string); ok && keyStr == "" {
+			continue
+		}
+		termQuery := query.NewTermQuery(term.Term)
+		termQuery.SetField(stAgg.Field)
+		supersetFreq, err := countDocuments(ctx, idx, query.NewConjunctionQuery([]query.Query{bgQuery, termQuery}))
+		if err != nil {
+			return nil, err
+		}
+		score := significanceScore(stAgg, uint64(term.Count), subsetSize, supersetFreq, supersetSize)
+		if score <= 0 || math.IsInf(score, 0) || math.IsNaN(score) {
+			continue
+		}
+		buckets = append(buckets, map[string]interface{}{
+			"key":       key,
+			"doc_count": term.Count,
+			"score":     score,
+			"bg_count":  supersetFreq,
+		})
+	}
+
+	sort.SliceStable(buckets, func(i, j int) bool {
+		return buckets[i]["score"].(float64) > buckets[j]["score"].(float64)
+	})
+	if len(buckets) > stAgg.Size {
+		buckets = buckets[:stAgg.Size]
+	}
+	return map[string]interface{}{
+		"doc_count": subsetSize,
+		"bg_count":  supersetSize,
+		"buckets":   buckets,
+	}, nil
+}
+
+// countDocuments 返回匹配查询的文档数
+func countDocuments(ctx context.Context, idx bleve.Index, q query.Query) (uint64, error) {
+	req := bleve.NewSearchRequest(q)
+	req.Size = 0
+	result, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	return result.Total, nil
+}
+
+// significanceScore 按配置的算法计算词项显著性得分（与 ES 的 JLH、ChiSquare 实现一致）
+func significanceScore(stAgg *SignificantTermsAggregationConfig, subsetFreq, subsetSize, supersetFreq, supersetSize uint64) float64 {
+	if stAgg.Heuristic == significanceHeuristicChiSquare {
+		return chiSquareScore(float64(subsetFreq), float64(subsetSize), float64(supersetFreq), float64(supersetSize), stAgg.IncludeNegatives, stAgg.BackgroundIsSuperset)
+	}
+	return jlhScore(float64(subsetFreq), float64(subsetSize), float64(supersetFreq), float64(supersetSize))
+}
+
+// jlhScore 绝对概率变化乘以相对概率变化，只对前景中比背景更常见的词项给出正分
+func jlhScore(subsetFreq, subsetSize, supersetFreq, supersetSize float64) float64 {
+	if subsetSize == 0 || supersetSize == 0 {
+		return 0
+	}
+	subsetProbability := subsetFreq / subsetSize
+	supersetProbability := supersetFreq / supersetSize
+	if subsetProbability <= 0 || supersetProbability <= 0 {
+		return 0
+	}
+	absoluteProbabilityChange := subsetProbability - supersetProbability
+	if absoluteProbabilityChange <= 0 {
+		return 0
+	}
+	return absoluteProbabilityChange * (subsetProbability / supersetProbability)
+}
+
+// chiSquareScore 基于 2x2 列联表的卡方检验
+func chiSquareScore(subsetFreq, subsetSize, supersetFreq, supersetSize float64, includeNegatives, backgroundIsSuperset bool) float64 {
+	var n00, n01, n10, n11, n0_, n1_, n_0, n_1, n float64
+	if backgroundIsSuperset {
+		n00 = supersetSize - supersetFreq - (subsetSize - subsetFreq) // 不在前景且不含词项
+		n01 = subsetSize - subsetFreq                                 // 在前景且不含词项
+		n10 = supersetFreq - subsetFreq                               // 不在前景且含词项
+		n11 = subsetFreq                                              // 在前景且含词项
+		n0_ = supersetSize - supersetFreq
+		n1_ = supersetFreq
+		n_0 = supersetSize - subsetSize
+		n_1 = subsetSize
+		n = supersetSize
+	} else {
+		n00 = supersetSize - supersetFreq
+		n01 = subsetSize - subsetFreq
+		n10 = supersetFreq
+		n11 = subsetFreq
+		n0_ = supersetSize - supersetFreq + subsetSize - subsetFreq
+		n1_ = supersetFreq + subsetFreq
+		n_0 = supersetSize
+		n_1 = subsetSize
+		n = supersetSize + subsetSize
+	}
+	// 前景中比背景更少见的词项
+	if !includeNegatives && n11/n_1 < n10/n_0 {
+		return math.Inf(-1)
+	}
+	return n * math.Pow(n11*n00-n01*n10, 2) / (n_1 * n1_ * n0_ * n_0)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_SignificantTerms(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/logs", `{"mappings":{"properties":{"level":{"type":"keyword"},"service":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	// 背景中 a 最常见；错误日志中 db 的比例明显高于背景
+	docs := map[string]map[string]int{
+		"info":  {"a": 9, "b": 2, "db": 1},
+		"error": {"a": 3, "db": 4},
+	}
+	id := 0
+	for level, services := range docs {
+		for service, n := range services {
+			for i := 0; i < n; i++ {
+				body := fmt.Sprintf(`{"level":%q,"service":%q}`, level, service)
+				if w := do("PUT", fmt.Sprintf("/logs/_doc/%d?refresh=true", id), body); w.Code >= 300 {
+					t.Fatalf("index %d: got %d: %s", id, w.Code, w.Body.String())
+				}
+				id++
+			}
+		}
+	}
+
+	type bucket struct {
+		Key      string  `json:"key"`
+		DocCount int     `json:"doc_count"`
+		BgCount  int     `json:"bg_count"`
+		Score    float64 `json:"score"`
+	}
+	type significantTerms struct {
+		DocCount int      `json:"doc_count"`
+		BgCount  int      `json:"bg_count"`
+		Buckets  []bucket `json:"buckets"`
+	}
+	search := func(body string) map[string]json.RawMessage {
+		t.Helper()
+		w := do("POST", "/logs/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Aggregations map[string]json.RawMessage `json:"aggregations"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp.Aggregations
+	}
+	decode := func(raw json.RawMessage) significantTerms {
+		t.Helper()
+		var st significantTerms
+		if err := json.Unmarshal(raw, &st); err != nil {
+			t.Fatalf("decode significant_terms: %v", err)
+		}
+		return st
+	}
+
+	// JLH：背景为整个索引
+	aggs := search(`{"size":0,"query":{"term":{"level":"error"}},"aggs":{"unusual":{"significant_terms":{"field":"service"}}}}`)
+	st := decode(aggs["unusual"])
+	if st.DocCount != 7 || st.BgCount != 19 || len(st.Buckets) != 1 {
+		t.Fatalf("expected only [db] to be significant, got %+v", st)
+	}
+	b := st.Buckets[0]
+	wantJLH := (4.0/7 - 5.0/19) * ((4.0 / 7) / (5.0 / 19))
+	if b.Key != "db" || b.DocCount != 4 || b.BgCount != 5 || math.Abs(b.Score-wantJLH) > 1e-9 {
+		t.Fatalf("unexpected bucket %+v, want score %v", b, wantJLH)
+	}
+
+	// chi_square + background_filter：背景只包含 info 日志，与前景不相交
+	aggs = search(`{"size":0,"query":{"term":{"level":"error"}},"aggs":{"unusual":{"significant_terms":{
+		"field":"service","background_filter":{"term":{"level":"info"}},
+		"chi_square":{"background_is_superset":false}}}}}`)
+	st = decode(aggs["unusual"])
+	if st.BgCount != 12 || len(st.Buckets) != 1 || st.Buckets[0].Key != "db" || st.Buckets[0].BgCount != 1 || st.Buckets[0].Score <= 0 {
+		t.Fatalf("chi_square: expected [db] with bg_count 1, got %+v", st)
+	}
+
+	// filter 子聚合：前景为 filter 命中的文档
+	aggs = search(`{"size":0,"aggs":{"errors":{"filter":{"term":{"level":"error"}},"aggs":{"unusual":{"significant_terms":{"field":"service"}}}}}}`)
+	var errors struct {
+		Aggregations map[string]json.RawMessage `json:"aggregations"`
+	}
+	if err := json.Unmarshal(aggs["errors"], &errors); err != nil {
+		t.Fatalf("decode filter aggregation: %v", err)
+	}
+	if st = decode(errors.Aggregations["unusual"]); len(st.Buckets) != 1 || st.Buckets[0].Key != "db" {
+		t.Fatalf("filter sub-aggregation: expected [db], got %+v", st)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// maxNestedSortHits 带 filter 的 nested 排序单次最多收集的子文档数
+const maxNestedSortHits = 100000
+
+// parseFieldSort 解析字段排序选项：order、mode、missing、unmapped_type、nested
+// ES格式: {"comments.date": {"order": "desc", "mode": "max", "missing": "_first", "nested": {"path": "comments", "filter": {...}}}}
+// fieldType 为字段的有效类型（字段未映射时取 unmapped_type）
+func (h *DocumentHandler) parseFieldSort(field string, spec map[string]interface{}, idx bleve.Index, fieldTypes map[string]string) (search.SearchSort, string, error) {
+	order := "asc"
+	if o, ok := spec["order"].(string); ok {
+		order = o
+	}
+	sf := &search.SortField{
+		Field: field,
+		Desc:  order == "desc",
+	}
+
+	fieldType := fieldTypes[field]
+	if fieldType == "" {
+		if unmappedType, ok := spec["unmapped_type"].(string); ok {
+			fieldType = unmappedType
+		}
+	}
+	valueType := mappedSortValueType(fieldType)
+
+	if m, ok := spec["mode"].(string); ok {
+		switch m {
+		case "min":
+			sf.Mode = search.SortFieldMin
+		case "max":
+			sf.Mode = search.SortFieldMax
+		case "avg":
+			sf.Mode = search.SortFieldAvg
+		case "sum":
+			sf.Mode = search.SortFieldSum
+		case "median":
+			sf.Mode = search.SortFieldMedian
+		default:
+			return nil, "", fmt.Errorf("unknown sort mode [%s]", m)
+		}
+		// avg/sum/median 只支持数值字段（日期的排序键不是浮点编码，同样不支持）
+		switch sf.Mode {
+		case search.SortFieldAvg, search.SortFieldSum, search.SortFieldMedian:
+			switch valueType {
+			case sortValueLong, sortValueDouble, sortValueAuto:
+			default:
+				return nil, "", fmt.Errorf("we only support AVG, MEDIAN and SUM on number based fields")
+			}
+		}
+	}
+
+	// missing：_last（默认）、_first 或自定义值（按字段类型编码为排序键）
+	if missing, ok := spec["missing"]; ok && missing != nil {
+		switch missing {
+		case "_last":
+			sf.Missing = search.SortFieldMissingLast
+		case "_first":
+			sf.Missing = search.SortFieldMissingFirst
+		default:
+			term, err := encodeSearchAfterValue(sf, valueType, missing)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to parse missing value for field [%s]: %v", field, err)
+			}
+			sf.MissingValue = term
+		}
+	}
+
+	applyDefaultSortModes(search.SortOrder{sf})
+
+	nestedPath, nestedFilter, err := parseNestedSortSpec(spec)
+	if err != nil {
+		return nil, "", err
+	}
+	if nestedPath == "" {
+		return sf, fieldType, nil
+	}
+	if fieldTypes != nil && fieldTypes[nestedPath] != "nested" {
+		return nil, "", fmt.Errorf("[nested] nested object under path [%s] is not of nested type", nestedPath)
+	}
+	if !strings.HasPrefix(field, nestedPath+".") {
+		return nil, "", fmt.Errorf("[nested] nested path [%s] is not a prefix of sort field [%s]", nestedPath, field)
+	}
+	// 没有 filter 时根文档上保留了 nested 字段的扁平化值，直接按 mode 排序即可
+	if nestedFilter == nil {
+		return sf, fieldType, nil
+	}
+	if idx == nil {
+		return nil, "", fmt.Errorf("nested sort with filter is not supported here")
+	}
+
+	filterQuery, err := dsl.NewQueryParser().ParseQuery(nestedFilter)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse nested sort filter: %v", err)
+	}
+	values, err := nestedSortValues(idx, nestedPath, sf, filterQuery)
+	if err != nil {
+		return nil, "", err
+	}
+	return &search.SortPrecomputed{
+		Field:        field,
+		Values:       values,
+		Desc:         sf.Desc,
+		Missing:      sf.Missing,
+		MissingValue: sf.MissingValue,
+	}, fieldType, nil
+}
+
+// applyDefaultSortModes 为未指定 mode 的字段排序设置 ES 默认值：升序取多值字段的最小值，降序取最大值
+func applyDefaultSortModes(sortOrder search.SortOrder) {
+	for _, ss := range sortOrder {
+		sf, ok := ss.(*search.SortField)
+		if !ok || sf.Mode != search.SortFieldDefault {
+			continue
+		}
+		sf.Mode = search.SortFieldMin
+		if sf.Desc {
+			sf.Mode = search.SortFieldMax
+		}
+	}
+}
+
+// parseNestedSortSpec 解析 nested 排序选项，兼容 ES 6 的 nested_path/nested_filter 写法
+func parseNestedSortSpec(spec map[string]interface{}) (string, map[string]interface{}, error) {
+	if nested, ok := spec["nested"].(map[string]interface{}); ok {
+		path, _ := nested["path"].(string)
+		if path == "" {
+			return "", nil, fmt.Errorf("[nested] requires 'path' field")
+		}
+		if _, ok := nested["nested"]; ok {
+			return "", nil, fmt.Errorf("[nested] multi-level nested sort is not supported")
+		}
+		filter, _ := nested["filter"].(map[string]interface{})
+		return path, filter, nil
+	}
+	if path, ok := spec["nested_path"].(string); ok && path != "" {
+		filter, _ := spec["nested_filter"].(map[string]interface{})
+		return path, filter, nil
+	}
+	return "", nil, nil
+}
+
+// nestedSortValues 计算每个根文档的 nested 排序键
+// 在匹配 filter 的子文档上按字段排序取得每个子文档的排序键，再按 _root_id 分组按 mode 合并
+func nestedSortValues(idx bleve.Index, path string, sf *search.SortField, filter query.Query) (map[string]string, error) {
+	childQuery := query.NewBooleanQuery([]query.Query{filter}, nil, nil)
+	childQuery.Filter = dsl.NewNestedDocumentsQuery(path)
+
+	searchReq := bleve.NewSearchRequest(childQuery)
+	searchReq.Size = maxNestedSortHits
+	searchReq.Fields = []string{dsl.NestedRootIDField}
+	searchReq.SortByCustom(search.SortOrder{&search.SortField{Field: sf.Field, Mode: sf.Mode}})
+
+	searchResult, err := idx.Search(searchReq)
+	if err != nil {
+		return nil, err
+	}
+	if searchResult.Total > uint64(len(searchResult.Hits)) {
+		logger.Warn("nestedSortValues - path [%s] matched %d nested documents, only the first %d are used", path, searchResult.Total, len(searchResult.Hits))
+	}
+
+	childTerms := make(map[string][]string)
+	for _, hit := range searchResult.Hits {
+		rootID, ok := hit.Fields[dsl.NestedRootIDField].(string)
+		if !ok || rootID == "" || len(hit.Sort) == 0 {
+			continue
+		}
+		term := hit.Sort[0]
+		if term == search.HighTerm || term == search.LowTerm {
+			continue
+		}
+		childTerms[rootID] = append(childTerms[rootID], term)
+	}
+
+	combiner := &search.SortField{Field: sf.Field, Mode: sf.Mode}
+	values := make(map[string]string, len(childTerms))
+	for rootID, terms := range childTerms {
+		for _, term := range terms {
+			combiner.UpdateVisitor(sf.Field, []byte(term))
+		}
+		values[rootID] = combiner.Value(nil)
+	}
+	return values, nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// sparse_vector / rank_features 字段（学习型稀疏检索）
+// 文档中的字段值是 "词项 -> 权重" 对象，索引时字段本身替换为词项列表（召回），
+// 权重写入 dsl.SparseVectorWeightsField（评分），原始文档保存在 _source 中。
+
+// isSparseVectorType 返回字段类型是否为稀疏向量
+func isSparseVectorType(fieldType interface{}) bool {
+	return fieldType == "sparse_vector" || fieldType == "rank_features"
+}
+
+// sparseVectorFieldPaths 返回 mapping 中所有稀疏向量字段的路径（不包含 nested 字段内部）
+func sparseVectorFieldPaths(props map[string]interface{}, prefix string, paths []string) []string {
+	for name, def := range props {
+		fieldMap, ok := def.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if isSparseVectorType(fieldMap["type"]) {
+			paths = append(paths, path)
+			continue
+		}
+		if fieldMap["type"] == "nested" {
+			continue
+		}
+		if childProps, ok := fieldMap["properties"].(map[string]interface{}); ok {
+			paths = sparseVectorFieldPaths(childProps, path, paths)
+		}
+	}
+	return paths
+}
+
+// validateSparseVector 校验稀疏向量字段值是 "词项 -> 正数权重" 对象
+func validateSparseVector(fieldType string, v interface{}) error {
+	weights, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("[%s] fields must be json objects, expected a START_OBJECT but got: %T", fieldType, v)
+	}
+	for token, w := range weights {
+		weight, ok := w.(float64)
+		if !ok {
+			return fmt.Errorf("[%s] field [%s] must be a number, but got: %v", fieldType, token, w)
+		}
+		if weight <= 0 {
+			return fmt.Errorf("[%s] fields do not support negative or zero values, got [%v] for [%s]", fieldType, weight, token)
+		}
+	}
+	return nil
+}
+
+// applySparseVectorFields 展开文档中的稀疏向量字段
+func (h *DocumentHandler) applySparseVectorFields(indexName string, docData map[string]interface{}) map[string]interface{} {
+	indexMeta, err := h.metaStore.GetIndexMetadata(indexName)
+	if err != nil || indexMeta == nil {
+		return docData
+	}
+	props, _ := indexMeta.Mapping["properties"].(map[string]interface{})
+	paths := sparseVectorFieldPaths(props, "", nil)
+	if len(paths) == 0 {
+		return docData
+	}
+	sort.Strings(paths)
+
+	var result map[string]interface{}
+	var weightTerms []string
+	for _, path := range paths {
+		weights, ok := lookupPath(docData, path).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if result == nil {
+			result = copyObject(docData)
+		}
+		tokens := make([]string, 0, len(weights))
+		for token, w := range weights {
+			weight, ok := w.(float64)
+			if !ok {
+				continue
+			}
+			tokens = append(tokens, token)
+			weightTerms = append(weightTerms, query.SparseWeightTerm(path, token, weight))
+		}
+		sort.Strings(tokens)
+		setObjectPath(result, path, tokens)
+	}
+	if result == nil {
+		return docData
+	}
+
+	if _, hasSource := docData["_source"]; !hasSource {
+		sourceJSON, _ := json.Marshal(docData)
+		result["_source"] = string(sourceJSON)
+	}
+	sort.Strings(weightTerms)
+	result[dsl.SparseVectorWeightsField] = weightTerms
+	return result
+}
+
+// lookupPath 按点分路径查找对象中的值
+func lookupPath(data map[string]interface{}, path string) interface{} {
+	parts := strings.Split(path, ".")
+	current := data
+	for i, part := range parts {
+		v, ok := current[part]
+		if !ok {
+			return nil
+		}
+		if i == len(parts)-1 {
+			return v
+		}
+		if current, ok = v.(map[string]interface{}); !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+// copyObject 浅拷贝对象，避免修改原始文档
+func copyObject(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data)+2)
+	for k, v := range data {
+		result[k] = v
+	}
+	return result
+}
+
+// setObjectPath 按点分路径设置值，路径上的中间对象在写入前拷贝
+func setObjectPath(data map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	current := data
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := current[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		child = copyObject(child)
+		current[part] = child
+		current = child
+	}
+	current[parts[len(parts)-1]] = value
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_SparseVector(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	createBody := `{"mappings":{"properties":{
+		"title":{"type":"text"},
+		"ml":{"properties":{"tokens":{"type":"sparse_vector"}}}
+	}}}`
+	if w := do("PUT", "/docs", createBody); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	docs := map[string]string{
+		"a": `{"title":"first","ml":{"tokens":{"cat":1.0,"dog":0.5}}}`,
+		"b": `{"title":"second","ml":{"tokens":{"dog":2.0,"fish":1.0}}}`,
+		"c": `{"title":"third","ml":{"tokens":{"bird":3.0}}}`,
+	}
+	for id, body := range docs {
+		if w := do("PUT", "/docs/_doc/"+id+"?refresh=true", body); w.Code >= 300 {
+			t.Fatalf("index %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+	if w := do("PUT", "/docs/_doc/bad", `{"ml":{"tokens":{"cat":-1}}}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "mapper_parsing_exception") {
+		t.Fatalf("negative weight: expected 400 mapper_parsing_exception, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/docs/_doc/a", ""); !strings.Contains(w.Body.String(), `"tokens":{"cat":1,"dog":0.5}`) {
+		t.Fatalf("original sparse vector should be returned in _source: %s", w.Body.String())
+	}
+
+	// 得分为点积：a = 2*1 + 1*0.5 = 2.5，b = 1*2 = 2，c 不包含查询词项
+	w := do("POST", "/docs/_search", `{"query":{"sparse_vector":{"field":"ml.tokens","query_vector":{"cat":2,"dog":1}}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("sparse_vector search: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				ID    string  `json:"_id"`
+				Score float64 `json:"_score"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode search response: %v", err)
+	}
+	hits := resp.Hits.Hits
+	if len(hits) != 2 || hits[0].ID != "a" || hits[1].ID != "b" {
+		t.Fatalf("expected hits [a b], got %s", w.Body.String())
+	}
+	if math.Abs(hits[0].Score-2.5) > 1e-6 || math.Abs(hits[1].Score-2) > 1e-6 {
+		t.Fatalf("expected dot product scores [2.5 2], got [%v %v]", hits[0].Score, hits[1].Score)
+	}
+
+	if w := do("POST", "/docs/_search", `{"query":{"sparse_vector":{"field":"ml.tokens","inference_id":"my-elser"}}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("inference_id: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -47,7 +47,7 @@ func NewStatsHandler(indexMgr *es.IndexManager, dirMgr directory.DirectoryManage
 // GET /_stats
 func (h *StatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	// 获取所有索引名称
-	indices, err := h.dirMgr.ListIndices()
+	indices, err := listTenantIndices(r.Context(), h.dirMgr)
 	if err != nil {
 		logger.Error("Failed to list indices: %v", err)
 		common.HandleError(w, common.NewInternalServerError("failed to list indices: "+err.Error()))
@@ -195,6 +195,43 @@ func (h *StatsHandler) getIndexStats(idx bleve.Index, indexName string) map[stri
 		},
 	}
 
+	// 索引打开后的预热统计
+	if h.indexMgr != nil {
+		warmer := h.indexMgr.WarmerStats(indexName)
+		for _, section := range []string{"primaries", "total"} {
+			stats[section].(map[string]interface{})["warmer"] = map[string]interface{}{
+				"current":              warmer.Current,
+				"total":                warmer.Total,
+				"total_time_in_millis": warmer.TotalTime,
+				"failed":               warmer.Failed,
+			}
+		}
+	}
+
+	// 后台合并统计（含限流暂停时间）与刷新统计
+	merges := mergeStats(idx)
+	var listeners int64
+	if h.indexMgr != nil {
+		listeners = h.indexMgr.RefreshListeners(indexName)
+	}
+	refresh := refreshStats(idx, listeners)
+	for _, section := range []string{"primaries", "total"} {
+		stats[section].(map[string]interface{})["merges"] = merges
+		stats[section].(map[string]interface{})["refresh"] = refresh
+	}
+
+	// 设置了 index.timestamp_field 的索引输出段级时间裁剪统计
+	if indexMeta, err := h.metaStore.GetIndexMetadata(indexName); err == nil && indexMeta != nil {
+		if field, ok := lookupIndexSetting(indexMeta.Settings, timestampFieldSetting); ok {
+			if field, ok := field.(string); ok && field != "" {
+				pruning := timePruningStats(idx, field)
+				for _, section := range []string{"primaries", "total"} {
+					stats[section].(map[string]interface{})["search"].(map[string]interface{})["time_pruning"] = pruning
+				}
+			}
+		}
+	}
+
 	return stats
 }
 
@@ -217,7 +254,7 @@ func (h *StatsHandler) GetIndexStats(w http.ResponseWriter, r *http.Request) {
 		common.HandleError(w, common.NewInternalServerError("failed to get index: "+err.Error()))
 		return
 	}
-	defer idx.Close()
+	// 索引实例由 IndexManager 管理生命周期，这里不能关闭
 
 	// 获取索引统计信息
 	indexStats := h.getIndexStats(idx, indexName)
@@ -260,7 +297,7 @@ func (h *StatsHandler) GetInfo(w http.ResponseWriter, r *http.Request) {
 		"cluster_name": ClusterName,
 		"cluster_uuid": ClusterUUID,
 		"version": map[string]interface{}{
-			"number":                              ESVersionNumber,
+			"number":                              ESVersion(),
 			"build_flavor":                        "default",
 			"build_type":                          "release",
 			"build_hash":                          ESBuildHash,
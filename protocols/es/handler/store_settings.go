@@ -0,0 +1,222 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lscgzwd/tiggerdb/index/scorch"
+	"github.com/lscgzwd/tiggerdb/index/scorch/mergeplan"
+)
+
+// 存储与合并策略设置（index.store.*、index.codec、index.merge.policy.*、index.merge.scheduler.max_thread_count）
+// 创建索引时校验并写入 scorch 配置（持久化在 index_meta.json 中，每次打开索引时生效），创建后不可修改。
+// zap 段文件总是以 mmap 方式打开、存储字段总是使用 snappy 压缩，因此只接受与之对应的 store.type 与 codec；
+// 合并策略的段大小以文档数计。GET /{index}/_settings?include_defaults=true 输出各项默认值。
+
+// 设置项路径（不含 "index." 前缀）
+const (
+	storeTypeSetting              = "store.type"
+	storeInMemoryMergeSizeSetting = "store.in_memory_merge_max_size"
+	storeSnapshotsToKeepSetting   = "store.snapshots_to_keep"
+	codecSetting                  = "codec"
+	mergeSegmentsPerTierSetting   = "merge.policy.segments_per_tier"
+	mergeMaxMergeAtOnceSetting    = "merge.policy.max_merge_at_once"
+	mergeMaxSegmentDocsSetting    = "merge.policy.max_merged_segment_docs"
+	mergeFloorSegmentDocsSetting  = "merge.policy.floor_segment_docs"
+	mergeReclaimDeletesSetting    = "merge.policy.reclaim_deletes_weight"
+	mergeMaxThreadCountSetting    = "merge.scheduler.max_thread_count"
+)
+
+// supportedStoreTypes 接受的 store.type，均对应 mmap 方式读取段文件
+var supportedStoreTypes = map[string]bool{"fs": true, "mmapfs": true, "hybridfs": true}
+
+// isStoreSetting 判断设置项是否为创建后不可修改的存储与合并策略设置
+func isStoreSetting(path string) bool {
+	return strings.HasPrefix(path, "store.") || path == codecSetting ||
+		strings.HasPrefix(path, "merge.policy.") || path == mergeMaxThreadCountSetting
+}
+
+// parseStoreSettings 校验存储与合并策略设置，返回需要写入 scorch 配置的项
+func parseStoreSettings(settings map[string]interface{}) (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+
+	if v, ok := lookupIndexSetting(settings, storeTypeSetting); ok && v != nil {
+		storeType, _ := v.(string)
+		if storeType == "niofs" || storeType == "simplefs" {
+			return nil, fmt.Errorf("store type [%s] is not supported, segment files are always memory mapped", storeType)
+		}
+		if !supportedStoreTypes[storeType] {
+			return nil, fmt.Errorf("unknown store type [%v], must be one of [fs, mmapfs, hybridfs]", v)
+		}
+	}
+	if v, ok := lookupIndexSetting(settings, codecSetting); ok && v != nil {
+		if codec, _ := v.(string); codec != "default" {
+			return nil, fmt.Errorf("unknown value for [index.%s] must be one of [default] but was: %v, stored fields are always compressed with snappy", codecSetting, v)
+		}
+	}
+
+	if v, ok := lookupIndexSetting(settings, storeInMemoryMergeSizeSetting); ok && v != nil {
+		size, err := parseByteSizeSetting(v, storeInMemoryMergeSizeSetting)
+		if err != nil {
+			return nil, err
+		}
+		config["scorchPersisterOptions"] = map[string]interface{}{"MaxSizeInMemoryMergePerWorker": size}
+	}
+	if v, ok := lookupIndexSetting(settings, storeSnapshotsToKeepSetting); ok && v != nil {
+		n, err := parseIndexIntSetting(v, storeSnapshotsToKeepSetting)
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("failed to parse value [%d] for setting [index.%s] must be >= 1", n, storeSnapshotsToKeepSetting)
+		}
+		config["numSnapshotsToKeep"] = n
+	}
+
+	mergeOptions := make(map[string]interface{})
+	intOptions := []struct {
+		setting string
+		option  string
+		min     int
+	}{
+		{mergeSegmentsPerTierSetting, "MaxSegmentsPerTier", 1},
+		{mergeMaxMergeAtOnceSetting, "SegmentsPerMergeTask", 2},
+		{mergeMaxSegmentDocsSetting, "MaxSegmentSize", 1},
+		{mergeFloorSegmentDocsSetting, "FloorSegmentSize", 0},
+	}
+	for _, o := range intOptions {
+		v, ok := lookupIndexSetting(settings, o.setting)
+		if !ok || v == nil {
+			continue
+		}
+		n, err := parseIndexIntSetting(v, o.setting)
+		if err != nil {
+			return nil, err
+		}
+		if n < o.min {
+			return nil, fmt.Errorf("failed to parse value [%d] for setting [index.%s] must be >= %d", n, o.setting, o.min)
+		}
+		if o.option == "MaxSegmentSize" && n > mergeplan.MaxSegmentSizeLimit {
+			return nil, fmt.Errorf("failed to parse value [%d] for setting [index.%s] must be <= %d", n, o.setting, mergeplan.MaxSegmentSizeLimit)
+		}
+		mergeOptions[o.option] = n
+	}
+	if v, ok := lookupIndexSetting(settings, mergeReclaimDeletesSetting); ok && v != nil {
+		weight, err := parseFloatSetting(v, mergeReclaimDeletesSetting)
+		if err != nil {
+			return nil, err
+		}
+		mergeOptions["ReclaimDeletesWeight"] = weight
+	}
+	if len(mergeOptions) > 0 {
+		config["scorchMergePlanOptions"] = mergeOptions
+	}
+
+	// 单个索引同时执行的合并任务数（还受节点级 indices.merge.scheduler.max_concurrent_merges 限制）
+	if v, ok := lookupIndexSetting(settings, mergeMaxThreadCountSetting); ok && v != nil {
+		n, err := parseIndexIntSetting(v, mergeMaxThreadCountSetting)
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("failed to parse value [%d] for setting [index.%s] must be >= 1", n, mergeMaxThreadCountSetting)
+		}
+		config["maxConcurrentMerges"] = n
+	}
+	return config, nil
+}
+
+// parseByteSizeSetting 解析字节数设置（整数或带单位的字符串，如 "64mb"）
+func parseByteSizeSetting(value interface{}, setting string) (int64, error) {
+	s, ok := value.(string)
+	if !ok {
+		n, err := parseIndexIntSetting(value, setting)
+		return int64(n), err
+	}
+	if n, ok := parseByteSize(s); ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("failed to parse setting [index.%s] with value [%s] as a size in bytes", setting, s)
+}
+
+// parseByteSize 解析非负字节数（不带单位时为字节）
+func parseByteSize(s string) (int64, bool) {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	for _, u := range byteSizeUnits {
+		if !strings.HasSuffix(lower, u.suffix) {
+			continue
+		}
+		num, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(lower, u.suffix)), 64)
+		if err != nil || num < 0 {
+			break
+		}
+		return int64(num * u.unit), true
+	}
+	if n, err := strconv.ParseInt(lower, 10, 64); err == nil && n >= 0 {
+		return n, true
+	}
+	return 0, false
+}
+
+// parseFloatSetting 解析非负浮点数设置
+func parseFloatSetting(value interface{}, setting string) (float64, error) {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case int:
+		f = float64(v)
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse value [%s] for setting [index.%s]", v, setting)
+		}
+		f = parsed
+	default:
+		return 0, fmt.Errorf("failed to parse value [%v] for setting [index.%s]", v, setting)
+	}
+	if f < 0 {
+		return 0, fmt.Errorf("failed to parse value [%v] for setting [index.%s] must be >= 0", f, setting)
+	}
+	return f, nil
+}
+
+// storeSettingDefaults 存储与合并策略设置的默认值（与 ES 一致输出为字符串）
+func storeSettingDefaults() map[string]interface{} {
+	mo := mergeplan.DefaultMergePlanOptions
+	return map[string]interface{}{
+		"codec": "default",
+		"store": map[string]interface{}{
+			"type":                     "fs",
+			"in_memory_merge_max_size": strconv.Itoa(scorch.DefaultMaxSizeInMemoryMergePerWorker) + "b",
+			"snapshots_to_keep":        strconv.Itoa(scorch.NumSnapshotsToKeep),
+		},
+		"merge": map[string]interface{}{
+			"policy": map[string]interface{}{
+				"segments_per_tier":       strconv.Itoa(mo.MaxSegmentsPerTier),
+				"max_merge_at_once":       strconv.Itoa(mo.SegmentsPerMergeTask),
+				"max_merged_segment_docs": strconv.FormatInt(mo.MaxSegmentSize, 10),
+				"floor_segment_docs":      strconv.FormatInt(mo.FloorSegmentSize, 10),
+				"reclaim_deletes_weight":  strconv.FormatFloat(mo.ReclaimDeletesWeight, 'f', -1, 64),
+			},
+			"scheduler": map[string]interface{}{
+				"max_thread_count": "1",
+			},
+		},
+	}
+}
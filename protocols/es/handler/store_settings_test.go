@@ -0,0 +1,146 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestIndexHandler_StoreSettings(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	router.AddRoutes([]server.Route{
+		{Method: "GET", Path: "/{index}/_settings", Handler: indexHandler.GetSettings},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/tuned", `{"settings":{"index":{
+		"store":{"type":"mmapfs","in_memory_merge_max_size":"64mb","snapshots_to_keep":3},
+		"codec":"default",
+		"merge":{"policy":{"segments_per_tier":"5","max_merge_at_once":4,"max_merged_segment_docs":100000,"floor_segment_docs":1000,"reclaim_deletes_weight":1.5}}
+	}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 设置写入 scorch 配置并持久化，打开索引时生效
+	data, err := os.ReadFile(filepath.Join(indexHandler.dirMgr.GetIndexPath("tuned"), "store", "index_meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta struct {
+		Config struct {
+			MergePlan          map[string]interface{} `json:"scorchMergePlanOptions"`
+			Persister          map[string]interface{} `json:"scorchPersisterOptions"`
+			NumSnapshotsToKeep int                    `json:"numSnapshotsToKeep"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("decode index meta: %v", err)
+	}
+	expectedMergePlan := "map[FloorSegmentSize:1000 MaxSegmentSize:100000 MaxSegmentsPerTier:5 ReclaimDeletesWeight:1.5 SegmentsPerMergeTask:4]"
+	if fmt.Sprint(meta.Config.MergePlan) != expectedMergePlan {
+		t.Errorf("expected merge plan options %s, got %v", expectedMergePlan, meta.Config.MergePlan)
+	}
+	if fmt.Sprint(meta.Config.Persister) != "map[MaxSizeInMemoryMergePerWorker:6.7108864e+07]" || meta.Config.NumSnapshotsToKeep != 3 {
+		t.Errorf("unexpected store config: %s", data)
+	}
+	if _, err := indexMgr.GetIndex("tuned"); err != nil {
+		t.Fatalf("open index: %v", err)
+	}
+
+	// include_defaults 输出默认值
+	w := do("GET", "/tuned/_settings?include_defaults=true", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get settings: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]struct {
+		Settings map[string]interface{} `json:"settings"`
+		Defaults struct {
+			Index struct {
+				Codec string `json:"codec"`
+				Store struct {
+					Type string `json:"type"`
+				} `json:"store"`
+				Merge struct {
+					Policy map[string]string `json:"policy"`
+				} `json:"merge"`
+			} `json:"index"`
+		} `json:"defaults"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode settings: %v", err)
+	}
+	defaults := resp["tuned"].Defaults.Index
+	if defaults.Codec != "default" || defaults.Store.Type != "fs" || defaults.Merge.Policy["segments_per_tier"] == "" {
+		t.Errorf("unexpected defaults: %s", w.Body.String())
+	}
+	if w := do("GET", "/tuned/_settings", ""); strings.Contains(w.Body.String(), "defaults") {
+		t.Errorf("defaults returned without include_defaults: %s", w.Body.String())
+	}
+
+	// 创建后不可修改
+	if w := do("PUT", "/tuned/_settings", `{"index":{"merge.policy.segments_per_tier":10}}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "non dynamic settings") {
+		t.Errorf("update merge policy: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	invalid := []struct {
+		settings string
+		message  string
+	}{
+		{`{"index":{"store":{"type":"niofs"}}}`, "store type [niofs] is not supported"},
+		{`{"index":{"store":{"type":"ramfs"}}}`, "unknown store type [ramfs]"},
+		{`{"index":{"codec":"best_compression"}}`, "unknown value for [index.codec]"},
+		{`{"index":{"store":{"in_memory_merge_max_size":"lots"}}}`, "as a size in bytes"},
+		{`{"index":{"store":{"snapshots_to_keep":0}}}`, "[index.store.snapshots_to_keep] must be >= 1"},
+		{`{"index":{"merge":{"policy":{"max_merge_at_once":1}}}}`, "[index.merge.policy.max_merge_at_once] must be >= 2"},
+		{`{"index":{"merge":{"policy":{"max_merged_segment_docs":3000000000}}}}`, "[index.merge.policy.max_merged_segment_docs] must be <="},
+		{`{"index":{"merge":{"policy":{"reclaim_deletes_weight":"high"}}}}`, "failed to parse value [high] for setting [index.merge.policy.reclaim_deletes_weight]"},
+	}
+	for i, tt := range invalid {
+		name := fmt.Sprintf("invalid_store_%d", i)
+		w := do("PUT", "/"+name, `{"settings":`+tt.settings+`}`)
+		var errResp struct {
+			Error struct {
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &errResp)
+		if w.Code != http.StatusBadRequest || !strings.Contains(errResp.Error.Reason, tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", tt.settings, tt.message, w.Code, w.Body.String())
+		}
+		if indexHandler.dirMgr.IndexExists(name) {
+			t.Errorf("%s: index should not be created", tt.settings)
+		}
+	}
+}
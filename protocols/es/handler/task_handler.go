@@ -47,35 +47,45 @@ func (h *DocumentHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 构建ES格式的响应
+	var status map[string]interface{}
+	if task.Action == TaskActionDeleteByQuery {
+		status = map[string]interface{}{
+			"total":             task.Total,
+			"updated":           0,
+			"created":           0,
+			"deleted":           task.Deleted,
+			"batches":           task.Batches,
+			"version_conflicts": task.VersionConflicts,
+			"noops":             0,
+			"retries": map[string]interface{}{
+				"bulk":   0,
+				"search": 0,
+			},
+			"throttled_millis":       0,
+			"requests_per_second":    -1.0,
+			"throttled_until_millis": 0,
+		}
+	} else {
+		status = task.Result
+	}
+
 	response := map[string]interface{}{
 		"completed": task.Status == TaskStatusCompleted || task.Status == TaskStatusFailed || task.Status == TaskStatusCancelled,
 		"task": map[string]interface{}{
 			"node":                  task.NodeID,
 			"id":                    task.TaskID,
 			"type":                  "transport",
-			"action":                "indices:data/write/bulk[delete_by_query]",
-			"description":           "delete_by_query [" + task.IndexName + "]",
+			"action":                task.Action,
+			"description":           task.Description,
 			"start_time_in_millis":  task.CreatedAt.UnixMilli(),
 			"running_time_in_nanos": runningTimeNanos,
 			"cancellable":           true,
-			"status": map[string]interface{}{
-				"total":             task.Total,
-				"updated":           0,
-				"created":           0,
-				"deleted":           task.Deleted,
-				"batches":           task.Batches,
-				"version_conflicts": task.VersionConflicts,
-				"noops":             0,
-				"retries": map[string]interface{}{
-					"bulk":   0,
-					"search": 0,
-				},
-				"throttled_millis":       0,
-				"requests_per_second":    -1.0,
-				"throttled_until_millis": 0,
-			},
+			"status":                status,
 		},
 	}
+	if task.Action != TaskActionDeleteByQuery && task.Status == TaskStatusCompleted && task.Result != nil {
+		response["response"] = task.Result
+	}
 
 	// 如果任务失败，添加错误信息
 	if task.Status == TaskStatusFailed {
@@ -15,12 +15,12 @@
 package handler
 
 import (
+	"context"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	bleve "github.com/lscgzwd/tiggerdb"
-	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
 	"github.com/lscgzwd/tiggerdb/search/query"
 )
 
@@ -34,10 +34,18 @@ const (
 	TaskStatusCancelled TaskStatus = "cancelled"
 )
 
-// DeleteTask 删除任务
-type DeleteTask struct {
+// 任务动作名称（与ES的 task action 保持一致）
+const (
+	TaskActionDeleteByQuery = "indices:data/write/bulk[delete_by_query]"
+	TaskActionForceMerge    = "indices:admin/forcemerge"
+)
+
+// Task 后台任务（delete_by_query、forcemerge 等）
+type Task struct {
 	TaskID           string                 `json:"task_id"`
 	NodeID           string                 `json:"node_id"`
+	Action           string                 `json:"action"`
+	Description      string                 `json:"description"`
 	IndexName        string                 `json:"index_name"`
 	Query            map[string]interface{} `json:"query"` // 原始查询
 	BleveQuery       query.Query            `json:"-"`     // 解析后的Bleve查询
@@ -50,13 +58,15 @@ type DeleteTask struct {
 	StartedAt        *time.Time             `json:"started_at,omitempty"`
 	CompletedAt      *time.Time             `json:"completed_at,omitempty"`
 	Error            string                 `json:"error,omitempty"`
+	Result           map[string]interface{} `json:"result,omitempty"` // 非 delete_by_query 任务的状态/结果
+	cancel           context.CancelFunc     // 取消任务的执行上下文（可选）
 	mutex            sync.RWMutex           `json:"-"` // 保护并发访问
 }
 
 // TaskManager 任务管理器
-// 负责管理异步删除任务，支持任务查询、取消等功能
+// 负责管理异步任务，支持任务查询、取消等功能
 type TaskManager struct {
-	tasks  map[string]*DeleteTask
+	tasks  map[string]*Task
 	mutex  sync.RWMutex
 	nodeID string // 节点ID，用于生成task_id
 }
@@ -64,7 +74,7 @@ type TaskManager struct {
 // NewTaskManager 创建任务管理器
 func NewTaskManager() *TaskManager {
 	return &TaskManager{
-		tasks:  make(map[string]*DeleteTask),
+		tasks:  make(map[string]*Task),
 		nodeID: "node-1", // 单节点模式下固定节点ID
 	}
 }
@@ -74,16 +84,18 @@ func (tm *TaskManager) CreateDeleteTask(
 	indexName string,
 	query map[string]interface{},
 	bleveQuery query.Query,
-) *DeleteTask {
+) *Task {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 
 	taskID := uuid.New().String()
 	fullTaskID := tm.nodeID + ":" + taskID
 
-	task := &DeleteTask{
+	task := &Task{
 		TaskID:           fullTaskID,
 		NodeID:           tm.nodeID,
+		Action:           TaskActionDeleteByQuery,
+		Description:      "delete_by_query [" + indexName + "]",
 		IndexName:        indexName,
 		Query:            query,
 		BleveQuery:       bleveQuery,
@@ -101,8 +113,32 @@ func (tm *TaskManager) CreateDeleteTask(
 	return task
 }
 
+// CreateTask 创建通用后台任务
+// cancel 为可选的取消函数，任务被取消时调用
+func (tm *TaskManager) CreateTask(action, description, indexName string, cancel context.CancelFunc) *Task {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	fullTaskID := tm.nodeID + ":" + uuid.New().String()
+	now := time.Now()
+	task := &Task{
+		TaskID:      fullTaskID,
+		NodeID:      tm.nodeID,
+		Action:      action,
+		Description: description,
+		IndexName:   indexName,
+		Status:      TaskStatusRunning,
+		CreatedAt:   now,
+		StartedAt:   &now,
+		cancel:      cancel,
+	}
+
+	tm.tasks[fullTaskID] = task
+	return task
+}
+
 // GetTask 获取任务
-func (tm *TaskManager) GetTask(taskID string) *DeleteTask {
+func (tm *TaskManager) GetTask(taskID string) *Task {
 	tm.mutex.RLock()
 	defer tm.mutex.RUnlock()
 
@@ -111,10 +147,15 @@ func (tm *TaskManager) GetTask(taskID string) *DeleteTask {
 		return nil
 	}
 
+	task.mutex.RLock()
+	defer task.mutex.RUnlock()
+
 	// 返回任务副本，避免外部修改
-	return &DeleteTask{
+	return &Task{
 		TaskID:           task.TaskID,
 		NodeID:           task.NodeID,
+		Action:           task.Action,
+		Description:      task.Description,
 		IndexName:        task.IndexName,
 		Query:            task.Query,
 		BleveQuery:       task.BleveQuery,
@@ -127,11 +168,12 @@ func (tm *TaskManager) GetTask(taskID string) *DeleteTask {
 		StartedAt:        task.StartedAt,
 		CompletedAt:      task.CompletedAt,
 		Error:            task.Error,
+		Result:           task.Result,
 	}
 }
 
 // UpdateTask 更新任务状态
-func (tm *TaskManager) UpdateTask(taskID string, updater func(*DeleteTask)) {
+func (tm *TaskManager) UpdateTask(taskID string, updater func(*Task)) {
 	tm.mutex.RLock()
 	task, exists := tm.tasks[taskID]
 	tm.mutex.RUnlock()
@@ -148,7 +190,7 @@ func (tm *TaskManager) UpdateTask(taskID string, updater func(*DeleteTask)) {
 
 // CompleteTask 完成任务
 func (tm *TaskManager) CompleteTask(taskID string, deleted, batches, versionConflicts int64) {
-	tm.UpdateTask(taskID, func(task *DeleteTask) {
+	tm.UpdateTask(taskID, func(task *Task) {
 		task.Status = TaskStatusCompleted
 		task.Deleted = deleted
 		task.Batches = batches
@@ -158,9 +200,22 @@ func (tm *TaskManager) CompleteTask(taskID string, deleted, batches, versionConf
 	})
 }
 
+// CompleteTaskWithResult 完成通用任务并记录结果
+func (tm *TaskManager) CompleteTaskWithResult(taskID string, result map[string]interface{}) {
+	tm.UpdateTask(taskID, func(task *Task) {
+		task.Result = result
+		if task.Status == TaskStatusCancelled {
+			return
+		}
+		task.Status = TaskStatusCompleted
+		now := time.Now()
+		task.CompletedAt = &now
+	})
+}
+
 // FailTask 标记任务失败
 func (tm *TaskManager) FailTask(taskID string, err error) {
-	tm.UpdateTask(taskID, func(task *DeleteTask) {
+	tm.UpdateTask(taskID, func(task *Task) {
 		task.Status = TaskStatusFailed
 		task.Error = err.Error()
 		now := time.Now()
@@ -185,6 +240,9 @@ func (tm *TaskManager) CancelTask(taskID string) bool {
 		task.Status = TaskStatusCancelled
 		now := time.Now()
 		task.CompletedAt = &now
+		if task.cancel != nil {
+			task.cancel()
+		}
 		return true
 	}
 
@@ -207,7 +265,7 @@ func (tm *TaskManager) CleanupOldTasks(maxAge time.Duration) {
 }
 
 // executeDeleteTask 执行删除任务（后台goroutine）
-func (h *DocumentHandler) executeDeleteTask(task *DeleteTask) {
+func (h *DocumentHandler) executeDeleteTask(task *Task) {
 	// 标记任务开始
 	task.mutex.Lock()
 	now := time.Now()
@@ -223,7 +281,7 @@ func (h *DocumentHandler) executeDeleteTask(task *DeleteTask) {
 
 	// 解析查询（如果还没有解析）
 	if task.BleveQuery == nil {
-		parser := dsl.NewQueryParser()
+		parser := h.newQueryParser(task.IndexName)
 		bleveQuery, parseErr := parser.ParseQuery(task.Query)
 		if parseErr != nil {
 			h.taskMgr.FailTask(task.TaskID, parseErr)
@@ -232,8 +290,16 @@ func (h *DocumentHandler) executeDeleteTask(task *DeleteTask) {
 		task.BleveQuery = bleveQuery
 	}
 
+	// 展开 nested/join 查询，只删除匹配的根文档
+	rootQuery, err := h.resolveRootQuery(idx, task.IndexName, task.BleveQuery)
+	if err != nil {
+		h.taskMgr.FailTask(task.TaskID, err)
+		return
+	}
+	nested := h.newNestedBatch(idx, h.nestedPathsForIndex(task.IndexName))
+
 	// 搜索所有匹配的文档
-	searchReq := bleve.NewSearchRequest(task.BleveQuery)
+	searchReq := bleve.NewSearchRequest(rootQuery)
 	searchReq.Fields = []string{"_id"} // 只需要ID字段
 	searchReq.Size = 10000000          // 最多处理1000万文档
 	searchReq.From = 0
@@ -245,7 +311,7 @@ func (h *DocumentHandler) executeDeleteTask(task *DeleteTask) {
 	}
 
 	// 更新总数
-	h.taskMgr.UpdateTask(task.TaskID, func(t *DeleteTask) {
+	h.taskMgr.UpdateTask(task.TaskID, func(t *Task) {
 		t.Total = int64(len(searchResults.Hits))
 	})
 
@@ -269,10 +335,12 @@ func (h *DocumentHandler) executeDeleteTask(task *DeleteTask) {
 			}
 
 			batch.Delete(hit.ID)
+			nested.add(hit.ID, nil)
 			batchSize++
 
 			// 每1000个文档执行一次batch，避免内存占用过大
 			if batchSize >= 1000 {
+				nested.flush(batch)
 				if err := idx.Batch(batch); err != nil {
 					versionConflicts += int64(batchSize)
 				} else {
@@ -283,7 +351,7 @@ func (h *DocumentHandler) executeDeleteTask(task *DeleteTask) {
 				batchSize = 0
 
 				// 更新进度
-				h.taskMgr.UpdateTask(task.TaskID, func(t *DeleteTask) {
+				h.taskMgr.UpdateTask(task.TaskID, func(t *Task) {
 					t.Deleted = deleted
 					t.Batches = batches
 					t.VersionConflicts = versionConflicts
@@ -293,6 +361,7 @@ func (h *DocumentHandler) executeDeleteTask(task *DeleteTask) {
 
 		// 执行剩余的batch
 		if batchSize > 0 {
+			nested.flush(batch)
 			if err := idx.Batch(batch); err != nil {
 				versionConflicts += int64(batchSize)
 			} else {
@@ -0,0 +1,53 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+)
+
+// listTenantIndices 列出请求可见的索引：多租户请求只返回本租户的（带前缀的物理）索引名，
+// 前缀由租户中间件在写出响应时去掉
+func listTenantIndices(ctx context.Context, dirMgr directory.DirectoryManager) ([]string, error) {
+	indices, err := dirMgr.ListIndices()
+	if err != nil {
+		return nil, err
+	}
+	tenant := middleware.TenantFromContext(ctx)
+	if tenant == "" {
+		return indices, nil
+	}
+	prefix := middleware.TenantIndexPrefix(tenant)
+	visible := make([]string, 0, len(indices))
+	for _, name := range indices {
+		if strings.HasPrefix(name, prefix) {
+			visible = append(visible, name)
+		}
+	}
+	return visible, nil
+}
+
+// tenantIndexPrefix 返回请求所属租户的索引名前缀，非租户请求返回 ""
+func tenantIndexPrefix(ctx context.Context) string {
+	tenant := middleware.TenantFromContext(ctx)
+	if tenant == "" {
+		return ""
+	}
+	return middleware.TenantIndexPrefix(tenant)
+}
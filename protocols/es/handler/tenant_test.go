@@ -0,0 +1,426 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+)
+
+func TestTenantMiddleware_Isolation(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	clusterHandler := NewClusterHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "GET", Path: "/{index}/_doc/{id}", Handler: docHandler.GetDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "GET", Path: "/_cat/indices", Handler: clusterHandler.CatIndices},
+		{Method: "GET", Path: "/{index}/_alias", Handler: indexHandler.GetAlias},
+		{Method: "PUT", Path: "/_cluster/settings", Handler: clusterHandler.PutClusterSettings},
+	})
+	handler := middleware.TenantMiddleware(&middleware.TenantConfig{
+		Enabled:       true,
+		APIKeyTenants: map[string]string{"key-b": "team-b"},
+	})(router.Build().ServeHTTP)
+
+	do := func(tenant, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.Contains(path, "_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		if strings.HasPrefix(tenant, "key-") {
+			req.Header.Set("X-API-Key", tenant)
+		} else if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		handler(w, req)
+		return w
+	}
+	catIndices := func(tenant string) []string {
+		w := do(tenant, "GET", "/_cat/indices", "")
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+			t.Fatalf("decode cat indices: %v: %s", err, w.Body.String())
+		}
+		var names []string
+		for _, row := range rows {
+			names = append(names, row["index"].(string))
+		}
+		return names
+	}
+
+	// 两个租户创建同名索引
+	if w := do("team-a", "PUT", "/logs", `{"aliases":{"current":{}}}`); w.Code != http.StatusOK {
+		t.Fatalf("team-a create: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("key-b", "PUT", "/logs", ""); w.Code != http.StatusOK {
+		t.Fatalf("team-b create: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if !indexHandler.dirMgr.IndexExists("team-a__logs") || !indexHandler.dirMgr.IndexExists("team-b__logs") {
+		t.Fatalf("Expected physical indices team-a__logs and team-b__logs")
+	}
+
+	bulk := "{\"index\":{\"_index\":\"logs\",\"_id\":\"1\"}}\n{\"msg\":\"from a\"}\n"
+	w := do("team-a", "POST", "/_bulk?refresh=true", bulk)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "team-a__") {
+		t.Fatalf("bulk: expected 200 without tenant prefix, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("team-a", "GET", "/logs/_doc/1", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"_index":"logs"`) {
+		t.Errorf("get doc: expected _index logs, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("key-b", "GET", "/logs/_doc/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected team-b not to see team-a's document, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("team-a", "POST", "/current/_search", `{}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"_index":"logs"`) {
+		t.Errorf("search through tenant alias: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("team-a", "GET", "/logs/_alias", ""); !strings.Contains(w.Body.String(), `{"logs":{"aliases":{"current":{}}}}`) {
+		t.Errorf("get alias: unexpected response %s", w.Body.String())
+	}
+
+	if names := catIndices("team-a"); len(names) != 1 || names[0] != "logs" {
+		t.Errorf("Expected team-a to list [logs], got %v", names)
+	}
+
+	// 缺少租户、租户与 API Key 绑定不一致、修改集群设置
+	if w := do("", "GET", "/_cat/indices", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without tenant, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/_cat/indices", nil)
+	req.Header.Set("X-API-Key", "key-b")
+	req.Header.Set("X-Tenant", "team-a")
+	handler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 when the header does not match the API key binding, got %d", w.Code)
+	}
+	if w := do("team-a", "PUT", "/_cluster/settings", `{"persistent":{}}`); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for cluster settings update by a tenant, got %d", w.Code)
+	}
+	if w := do("Team_A", "GET", "/_cat/indices", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid tenant name, got %d", w.Code)
+	}
+}
+
+// tenantRequest 以租户（或绑定租户的 API Key）身份发送请求
+func tenantRequest(handler http.HandlerFunc, tenant, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if strings.Contains(path, "_bulk") {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	req.Header.Set("X-Tenant", tenant)
+	handler(w, req)
+	return w
+}
+
+func TestTenantMiddleware_RollupJobs(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	rollupHandler := NewRollupHandler(indexHandler, docHandler)
+	defer rollupHandler.Close()
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/_rollup/job/{id}", Handler: rollupHandler.PutJob},
+		{Method: "GET", Path: "/_rollup/job", Handler: rollupHandler.GetJobs},
+		{Method: "GET", Path: "/_rollup/job/{id}", Handler: rollupHandler.GetJobs},
+		{Method: "DELETE", Path: "/_rollup/job/{id}", Handler: rollupHandler.DeleteJob},
+		{Method: "POST", Path: "/_rollup/job/{id}/_start", Handler: rollupHandler.StartJob},
+	})
+	handler := middleware.TenantMiddleware(&middleware.TenantConfig{Enabled: true})(router.Build().ServeHTTP)
+	do := func(tenant, method, path, body string) *httptest.ResponseRecorder {
+		return tenantRequest(handler, tenant, method, path, body)
+	}
+
+	for _, tenant := range []string{"team-a", "team-b"} {
+		if w := do(tenant, "PUT", "/sensor", `{"mappings":{"properties":{"timestamp":{"type":"date"},"temperature":{"type":"long"}}}}`); w.Code != http.StatusOK {
+			t.Fatalf("%s create: got %d: %s", tenant, w.Code, w.Body.String())
+		}
+	}
+	const jobBody = `{"index_pattern": %q, "rollup_index": "rollup-sensor", "cron": "*/30 * * * * ?", "page_size": 10,
+		"groups": {"date_histogram": {"field": "timestamp", "fixed_interval": "1h"}},
+		"metrics": [{"field": "temperature", "metrics": ["max"]}]}`
+	if w := do("team-a", "PUT", "/_rollup/job/sensor", fmt.Sprintf(jobBody, "sens*")); w.Code != http.StatusOK {
+		t.Fatalf("put job: got %d: %s", w.Code, w.Body.String())
+	}
+	if !isRollupIndex(indexHandler.metaStore, "team-a__rollup-sensor") {
+		t.Fatalf("Expected the rollup index to be created in the tenant namespace")
+	}
+	rollupHandler.mutex.Lock()
+	indices := rollupHandler.sourceIndices(rollupHandler.jobs["sensor"].config)
+	rollupHandler.mutex.Unlock()
+	if len(indices) != 1 || indices[0] != "team-a__sensor" {
+		t.Errorf("Expected the job to read only team-a__sensor, got %v", indices)
+	}
+	// 其他租户的物理索引名同样加上前缀，无法匹配
+	if w := do("team-b", "PUT", "/_rollup/job/other", fmt.Sprintf(jobBody, "team-a__sensor")); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected another tenant's index to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do("team-a", "GET", "/_rollup/job/sensor", "")
+	if !strings.Contains(w.Body.String(), `"index_pattern":"sens*"`) || !strings.Contains(w.Body.String(), `"rollup_index":"rollup-sensor"`) {
+		t.Errorf("Expected the job config without tenant prefix, got %s", w.Body.String())
+	}
+	for _, path := range []string{"/_rollup/job", "/_rollup/job/sensor", "/_rollup/job/_all"} {
+		if w := do("team-b", "GET", path, ""); !strings.Contains(w.Body.String(), `"jobs":[]`) {
+			t.Errorf("%s: expected team-b to see no jobs, got %s", path, w.Body.String())
+		}
+	}
+	if w := do("team-b", "POST", "/_rollup/job/sensor/_start", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when starting another tenant's job, got %d", w.Code)
+	}
+	if w := do("team-b", "DELETE", "/_rollup/job/sensor", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when deleting another tenant's job, got %d", w.Code)
+	}
+	if w := do("team-a", "DELETE", "/_rollup/job/sensor", ""); w.Code != http.StatusOK {
+		t.Errorf("delete job: got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTenantMiddleware_Watches(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	watcherHandler := NewWatcherHandler(indexHandler, docHandler)
+	defer watcherHandler.Close()
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "PUT", Path: "/_watcher/watch/{id}", Handler: watcherHandler.PutWatch},
+		{Method: "GET", Path: "/_watcher/watch/{id}", Handler: watcherHandler.GetWatch},
+		{Method: "DELETE", Path: "/_watcher/watch/{id}", Handler: watcherHandler.DeleteWatch},
+		{Method: "POST", Path: "/_watcher/watch/{id}/_execute", Handler: watcherHandler.ExecuteWatch},
+		{Method: "PUT", Path: "/_watcher/watch/{id}/_deactivate", Handler: watcherHandler.DeactivateWatch},
+		{Method: "GET", Path: "/_watcher/stats", Handler: watcherHandler.WatcherStats},
+	})
+	handler := middleware.TenantMiddleware(&middleware.TenantConfig{Enabled: true})(router.Build().ServeHTTP)
+	do := func(tenant, method, path, body string) *httptest.ResponseRecorder {
+		return tenantRequest(handler, tenant, method, path, body)
+	}
+
+	for tenant, docs := range map[string]int{"team-a": 2, "team-b": 1} {
+		if w := do(tenant, "PUT", "/metrics", `{"mappings":{"properties":{"level":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+			t.Fatalf("%s create: got %d: %s", tenant, w.Code, w.Body.String())
+		}
+		bulk := strings.Repeat("{\"index\":{\"_index\":\"metrics\"}}\n{\"level\":\"error\"}\n", docs)
+		if w := do(tenant, "POST", "/_bulk?refresh=true", bulk); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"errors":true`) {
+			t.Fatalf("%s bulk: got %d: %s", tenant, w.Code, w.Body.String())
+		}
+	}
+	const watchBody = `{"trigger": {"schedule": {"interval": "1h"}},
+		"input": {"search": {"request": {"indices": ["metrics"], "body": {"size": 0}}}},
+		"actions": {"archive": {"index": {"index": "alerts"}}}}`
+	if w := do("team-a", "PUT", "/_watcher/watch/errors", watchBody); w.Code != http.StatusCreated {
+		t.Fatalf("put watch: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 手动执行：input 只读本租户的索引，index action 写入本租户的索引
+	w := do("team-a", "POST", "/_watcher/watch/errors/_execute", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":2`) || !strings.Contains(w.Body.String(), `"index":"alerts"`) {
+		t.Fatalf("execute: got %d: %s", w.Code, w.Body.String())
+	}
+	if !indexHandler.dirMgr.IndexExists("team-a__alerts") || indexHandler.dirMgr.IndexExists("alerts") {
+		t.Fatalf("Expected the index action to write team-a__alerts")
+	}
+	// 调度执行的 context 不带租户，同样按 watch 的租户执行
+	watcherHandler.mutex.Lock()
+	entry := watcherHandler.watches["errors"]
+	watcherHandler.mutex.Unlock()
+	now := time.Now().UTC()
+	record := watcherHandler.executeWatch(context.Background(), entry, watchTriggerEvent{kind: "schedule", triggeredTime: now, scheduledTime: now}, watchExecutionOptions{})
+	input := record["result"].(map[string]interface{})["input"].(map[string]interface{})
+	if total := input["payload"].(map[string]interface{})["hits"].(map[string]interface{})["total"]; total != 2.0 {
+		t.Errorf("Expected the scheduled run to read team-a__metrics, got %v", input)
+	}
+
+	// 其他租户看不到、也无法操作该 watch
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/_watcher/watch/errors"},
+		{"POST", "/_watcher/watch/errors/_execute"},
+		{"PUT", "/_watcher/watch/errors/_deactivate"},
+		{"DELETE", "/_watcher/watch/errors"},
+	} {
+		if w := do("team-b", req.method, req.path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404 for team-b, got %d: %s", req.method, req.path, w.Code, w.Body.String())
+		}
+	}
+	if w := do("team-b", "PUT", "/_watcher/watch/errors", watchBody); w.Code != http.StatusConflict {
+		t.Errorf("Expected team-b to be unable to replace the watch, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("team-b", "GET", "/_watcher/stats", ""); !strings.Contains(w.Body.String(), `"watch_count":0`) {
+		t.Errorf("Expected team-b to count no watches, got %s", w.Body.String())
+	}
+	if w := do("team-a", "DELETE", "/_watcher/watch/errors", ""); w.Code != http.StatusOK {
+		t.Errorf("delete watch: got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTenantMiddleware_Transforms(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	transformHandler := NewTransformHandler(indexHandler, docHandler)
+	defer transformHandler.Close()
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/_transform/_preview", Handler: transformHandler.PreviewTransform},
+		{Method: "PUT", Path: "/_transform/{id}", Handler: transformHandler.PutTransform},
+		{Method: "GET", Path: "/_transform", Handler: transformHandler.GetTransforms},
+		{Method: "GET", Path: "/_transform/{id}", Handler: transformHandler.GetTransforms},
+		{Method: "DELETE", Path: "/_transform/{id}", Handler: transformHandler.DeleteTransform},
+		{Method: "POST", Path: "/_transform/{id}/_start", Handler: transformHandler.StartTransform},
+		{Method: "POST", Path: "/_transform/{id}/_preview", Handler: transformHandler.PreviewTransform},
+	})
+	handler := middleware.TenantMiddleware(&middleware.TenantConfig{Enabled: true})(router.Build().ServeHTTP)
+	do := func(tenant, method, path, body string) *httptest.ResponseRecorder {
+		return tenantRequest(handler, tenant, method, path, body)
+	}
+
+	for tenant, customers := range map[string][]string{"team-a": {"alice", "bob"}, "team-b": {"carol"}} {
+		if w := do(tenant, "PUT", "/orders", `{"mappings":{"properties":{"customer":{"type":"keyword"},"amount":{"type":"long"}}}}`); w.Code != http.StatusOK {
+			t.Fatalf("%s create: got %d: %s", tenant, w.Code, w.Body.String())
+		}
+		var bulk strings.Builder
+		for _, customer := range customers {
+			fmt.Fprintf(&bulk, "{\"index\":{\"_index\":\"orders\"}}\n{\"customer\":%q,\"amount\":1}\n", customer)
+		}
+		if w := do(tenant, "POST", "/_bulk?refresh=true", bulk.String()); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"errors":true`) {
+			t.Fatalf("%s bulk: got %d: %s", tenant, w.Code, w.Body.String())
+		}
+	}
+	const transformBody = `{"source": {"index": %s}, "dest": {"index": "customers"},
+		"pivot": {"group_by": {"customer": {"terms": {"field": "customer"}}}, "aggregations": {"total": {"sum": {"field": "amount"}}}}}`
+
+	// source.index 的通配符只匹配本租户的索引
+	w := do("team-a", "POST", "/_transform/_preview", fmt.Sprintf(transformBody, `"ord*"`))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"alice"`) || strings.Contains(w.Body.String(), `"carol"`) {
+		t.Fatalf("preview: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("team-a", "PUT", "/_transform/totals", fmt.Sprintf(transformBody, `["ord*"]`)); w.Code != http.StatusOK {
+		t.Fatalf("put transform: got %d: %s", w.Code, w.Body.String())
+	}
+	transformHandler.mutex.Lock()
+	task := transformHandler.transforms["totals"]
+	transformHandler.mutex.Unlock()
+	if indices := transformHandler.sourceIndices(task.config); len(indices) != 1 || indices[0] != "team-a__orders" {
+		t.Errorf("Expected the transform to read only team-a__orders, got %v", indices)
+	}
+	if task.config.Dest.Index != "team-a__customers" {
+		t.Errorf("Expected the destination in the tenant namespace, got %s", task.config.Dest.Index)
+	}
+	w = do("team-a", "GET", "/_transform/totals", "")
+	if !strings.Contains(w.Body.String(), `"index":["ord*"]`) || !strings.Contains(w.Body.String(), `"index":"customers"`) {
+		t.Errorf("Expected the config without tenant prefix, got %s", w.Body.String())
+	}
+	if w := do("team-b", "PUT", "/_transform/other", fmt.Sprintf(transformBody, `"team-a__orders"`)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected another tenant's index to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 其他租户看不到、也无法操作该 transform
+	for _, path := range []string{"/_transform", "/_transform/_all", "/_transform/tot*"} {
+		if w := do("team-b", "GET", path, ""); !strings.Contains(w.Body.String(), `"count":0`) {
+			t.Errorf("%s: expected team-b to see no transforms, got %s", path, w.Body.String())
+		}
+	}
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/_transform/totals"},
+		{"POST", "/_transform/totals/_start"},
+		{"POST", "/_transform/totals/_preview"},
+		{"DELETE", "/_transform/totals"},
+	} {
+		if w := do("team-b", req.method, req.path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404 for team-b, got %d: %s", req.method, req.path, w.Code, w.Body.String())
+		}
+	}
+	if w := do("team-a", "DELETE", "/_transform/totals", ""); w.Code != http.StatusOK {
+		t.Errorf("delete transform: got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTenantMiddleware_StreamingResponses(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_export_search", Handler: docHandler.ExportSearch},
+		{Method: "POST", Path: "/_msearch", Handler: docHandler.MultiSearch},
+	})
+	handler := middleware.TenantMiddleware(&middleware.TenantConfig{Enabled: true})(router.Build().ServeHTTP)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.Contains(path, "_bulk") || strings.Contains(path, "_msearch") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		req.Header.Set("X-Tenant", "team-a")
+		handler(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/logs", `{"mappings": {"properties": {"n": {"type": "long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var bulk strings.Builder
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(&bulk, "{\"index\":{\"_index\":\"logs\",\"_id\":\"%d\"}}\n{\"n\":%d}\n", i, i)
+	}
+	if w := do("POST", "/_bulk?refresh=true", bulk.String()); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	// NDJSON 导出逐行去掉租户前缀，所有文档都写出
+	w := do("POST", "/logs/_export_search?batch_size=2", `{}`)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Code != http.StatusOK || len(lines) != 5 || strings.Contains(w.Body.String(), "team-a__") {
+		t.Fatalf("export ndjson: expected 5 lines without tenant prefix, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, `"_index":"logs"`) {
+			t.Errorf("export ndjson: unexpected line %s", line)
+		}
+	}
+	if !w.Flushed {
+		t.Errorf("export ndjson: expected the response to be flushed while streaming")
+	}
+
+	w = do("POST", "/logs/_export_search?format=csv&fields=_index,n", `{"sort": [{"n": "asc"}]}`)
+	if want := "_index,n\nlogs,1\nlogs,2\nlogs,3\nlogs,4\nlogs,5\n"; w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("export csv: got %d:\n%s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", "/_msearch", "{\"index\":\"logs\"}\n{\"size\":1}\n{\"index\":\"logs\"}\n{\"size\":1}\n")
+	lines = strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 || strings.Contains(w.Body.String(), "team-a__") {
+		t.Errorf("msearch: expected 2 responses without tenant prefix, got %s", w.Body.String())
+	}
+}
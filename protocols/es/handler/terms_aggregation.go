@@ -0,0 +1,353 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// terms 聚合的排序、size/shard_size、min_doc_count 和 include/exclude
+// 桶由 terms facet 统计，facet 结果按文档数降序；其他排序方式和过滤需要取回全部词项后在此处理
+
+// TermsAggregationInfo terms聚合信息
+type TermsAggregationInfo struct {
+	Aggregations map[string]*TermsAggregationConfig
+}
+
+// config 返回聚合的配置（info 为空时返回 nil）
+func (info *TermsAggregationInfo) config(aggName string) *TermsAggregationConfig {
+	if info == nil {
+		return nil
+	}
+	return info.Aggregations[aggName]
+}
+
+// TermsAggregationConfig terms聚合配置
+// ES格式: {"terms": {"field": "tags", "size": 10, "order": {"_count": "desc"}, "min_doc_count": 1, "include": "a.*", "exclude": ["b"]}}
+type TermsAggregationConfig struct {
+	Field       string
+	Size        int          // 返回的桶数（默认10）
+	ShardSize   int          // 按子聚合排序时参与排序的候选词项数（默认 size*1.5+10）
+	MinDocCount int          // 最小文档数（默认1，为0时同时返回索引中没有命中的词项）
+	Order       []termsOrder // 排序条件，为空时按文档数降序
+	Include     *termsFilter // 只保留匹配的词项
+	Exclude     *termsFilter // 去掉匹配的词项
+}
+
+// termsOrder terms聚合的一个排序条件
+type termsOrder struct {
+	Path string // _count、_key 或子聚合路径（如 "avg_price"、"price_stats.max"）
+	Asc  bool
+}
+
+// termsFilter include/exclude 条件：正则表达式（匹配整个词项）或词项列表
+type termsFilter struct {
+	Pattern *regexp.Regexp
+	Values  map[string]bool
+}
+
+// matches 判断桶键是否满足条件
+func (f *termsFilter) matches(key interface{}) bool {
+	s := fmt.Sprint(key)
+	if f.Pattern != nil {
+		return f.Pattern.MatchString(s)
+	}
+	return f.Values[s]
+}
+
+// parseTermsAggregationConfig 解析terms聚合参数
+func parseTermsAggregationConfig(config map[string]interface{}) (*TermsAggregationConfig, error) {
+	field, ok := config["field"].(string)
+	if !ok || field == "" {
+		return nil, fmt.Errorf("terms aggregation requires a 'field' parameter")
+	}
+
+	termsConfig := &TermsAggregationConfig{Field: field, Size: 10, MinDocCount: 1}
+	if sizeVal, ok := config["size"].(float64); ok {
+		termsConfig.Size = int(sizeVal)
+	} else if sizeVal, ok := config["size"].(int); ok {
+		termsConfig.Size = sizeVal
+	}
+	termsConfig.ShardSize = termsConfig.Size*3/2 + 10
+	if shardSize, ok := config["shard_size"].(float64); ok && int(shardSize) > 0 {
+		termsConfig.ShardSize = max(int(shardSize), termsConfig.Size)
+	}
+	if minDocCount, ok := config["min_doc_count"].(float64); ok && minDocCount >= 0 {
+		termsConfig.MinDocCount = int(minDocCount)
+	}
+
+	order, err := parseTermsOrder(config["order"])
+	if err != nil {
+		return nil, err
+	}
+	termsConfig.Order = order
+
+	if termsConfig.Include, err = parseTermsFilter("include", config["include"]); err != nil {
+		return nil, err
+	}
+	if termsConfig.Exclude, err = parseTermsFilter("exclude", config["exclude"]); err != nil {
+		return nil, err
+	}
+	return termsConfig, nil
+}
+
+// parseTermsOrder 解析 order：单个对象或对象数组，如 {"_count": "asc"}、[{"avg_price": "desc"}, {"_key": "asc"}]
+func parseTermsOrder(value interface{}) ([]termsOrder, error) {
+	var specs []interface{}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		specs = []interface{}{v}
+	case []interface{}:
+		specs = v
+	default:
+		return nil, fmt.Errorf("invalid terms aggregation [order]: %v", value)
+	}
+
+	var orders []termsOrder
+	for _, spec := range specs {
+		orderMap, ok := spec.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid terms aggregation [order]: %v", spec)
+		}
+		for path, dir := range orderMap {
+			dirStr, _ := dir.(string)
+			dirStr = strings.ToLower(dirStr)
+			if dirStr != "asc" && dirStr != "desc" {
+				return nil, fmt.Errorf("unknown terms aggregation order direction [%v] for [%s]", dir, path)
+			}
+			// _term 是 _key 的旧名称
+			if path == "_term" {
+				path = "_key"
+			}
+			orders = append(orders, termsOrder{Path: path, Asc: dirStr == "asc"})
+		}
+	}
+	return orders, nil
+}
+
+// parseTermsFilter 解析 include/exclude：字符串为正则表达式，数组为词项列表
+func parseTermsFilter(name string, value interface{}) (*termsFilter, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		pattern, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid terms aggregation [%s] pattern [%s]: %w", name, v, err)
+		}
+		return &termsFilter{Pattern: pattern}, nil
+	case []interface{}:
+		values := make(map[string]bool, len(v))
+		for _, item := range v {
+			values[fmt.Sprint(item)] = true
+		}
+		return &termsFilter{Values: values}, nil
+	}
+	return nil, fmt.Errorf("terms aggregation [%s] must be a regular expression or an array of values, got [%v]", name, value)
+}
+
+// defaultOrder 是否为默认排序（文档数降序）
+func (c *TermsAggregationConfig) defaultOrder() bool {
+	return len(c.Order) == 0 || len(c.Order) == 1 && c.Order[0].Path == "_count" && !c.Order[0].Asc
+}
+
+// orderBySubAggregation 是否按子聚合排序
+func (c *TermsAggregationConfig) orderBySubAggregation() bool {
+	for _, o := range c.Order {
+		if o.Path != "_count" && o.Path != "_key" {
+			return true
+		}
+	}
+	return false
+}
+
+// facetSize terms facet 的大小：默认排序且不过滤时取 size 个，否则取回全部词项
+func (c *TermsAggregationConfig) facetSize() int {
+	if c.defaultOrder() && c.Include == nil && c.Exclude == nil {
+		return c.Size
+	}
+	return math.MaxInt32
+}
+
+// selectTermsBuckets 按配置过滤、排序并截取 terms 桶，返回选中的桶和截取掉的桶的文档数
+// 按子聚合排序时先为 shard_size 个候选桶计算子聚合（computed 为 true 表示选中的桶已包含子聚合结果）
+func (h *DocumentHandler) selectTermsBuckets(ctx context.Context, termsAgg *TermsAggregationConfig, buckets []map[string]interface{}, idx bleve.Index, subAggTask func(bucket map[string]interface{}) func()) (selected []map[string]interface{}, otherDocCount int, computed bool) {
+	if termsAgg.MinDocCount == 0 {
+		buckets = append(buckets, h.zeroCountTermsBuckets(ctx, termsAgg.Field, buckets, idx)...)
+	}
+
+	selected = make([]map[string]interface{}, 0, len(buckets))
+	for _, bucket := range buckets {
+		if termsAgg.Include != nil && !termsAgg.Include.matches(bucket["key"]) {
+			continue
+		}
+		if termsAgg.Exclude != nil && termsAgg.Exclude.matches(bucket["key"]) {
+			continue
+		}
+		if bucketDocCount(bucket) < termsAgg.MinDocCount {
+			continue
+		}
+		selected = append(selected, bucket)
+	}
+
+	if termsAgg.orderBySubAggregation() {
+		// 候选桶按文档数取前 shard_size 个（facet 结果已按文档数降序）
+		if len(selected) > termsAgg.ShardSize {
+			for _, bucket := range selected[termsAgg.ShardSize:] {
+				otherDocCount += bucketDocCount(bucket)
+			}
+			selected = selected[:termsAgg.ShardSize]
+		}
+		tasks := make([]func(), 0, len(selected))
+		for _, bucket := range selected {
+			if task := subAggTask(bucket); task != nil {
+				tasks = append(tasks, task)
+			}
+		}
+		aggPool.run(tasks)
+		computed = true
+	}
+
+	h.sortTermsBuckets(selected, termsAgg)
+	if len(selected) > termsAgg.Size {
+		for _, bucket := range selected[termsAgg.Size:] {
+			otherDocCount += bucketDocCount(bucket)
+		}
+		selected = selected[:termsAgg.Size]
+	}
+	return selected, otherDocCount, computed
+}
+
+// sortTermsBuckets 按配置的排序条件排序，条件都相同时按桶键升序
+func (h *DocumentHandler) sortTermsBuckets(buckets []map[string]interface{}, termsAgg *TermsAggregationConfig) {
+	orders := termsAgg.Order
+	if len(orders) == 0 {
+		orders = []termsOrder{{Path: "_count"}}
+	}
+	sort.SliceStable(buckets, func(i, j int) bool {
+		for _, o := range orders {
+			cmp := h.compareTermsBuckets(buckets[i], buckets[j], o.Path)
+			if cmp != 0 {
+				if o.Asc {
+					return cmp < 0
+				}
+				return cmp > 0
+			}
+		}
+		return compareTermsKeys(buckets[i]["key"], buckets[j]["key"]) < 0
+	})
+}
+
+// compareTermsBuckets 按排序路径比较两个桶，子聚合没有值的桶排在后面
+func (h *DocumentHandler) compareTermsBuckets(a, b map[string]interface{}, path string) int {
+	switch path {
+	case "_count":
+		return bucketDocCount(a) - bucketDocCount(b)
+	case "_key":
+		return compareTermsKeys(a["key"], b["key"])
+	}
+	va, vb := h.resolveBucketsPath(a, path), h.resolveBucketsPath(b, path)
+	switch {
+	case va == nil && vb == nil:
+		return 0
+	case va == nil:
+		return -1
+	case vb == nil:
+		return 1
+	case *va < *vb:
+		return -1
+	case *va > *vb:
+		return 1
+	}
+	return 0
+}
+
+// compareTermsKeys 比较桶键：数值按大小，其他按字符串
+func compareTermsKeys(a, b interface{}) int {
+	fa, okA := termsKeyNumber(a)
+	fb, okB := termsKeyNumber(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// termsKeyNumber 返回数值型桶键的值
+func termsKeyNumber(key interface{}) (float64, bool) {
+	switch v := key.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// zeroCountTermsBuckets min_doc_count 为 0 时，返回索引中存在但当前查询没有命中的词项（文档数为 0）
+func (h *DocumentHandler) zeroCountTermsBuckets(ctx context.Context, field string, existing []map[string]interface{}, idx bleve.Index) []map[string]interface{} {
+	req := bleve.NewSearchRequest(query.NewMatchAllQuery())
+	req.Size = 0
+	req.AddFacet(field, bleve.NewFacetRequest(field, math.MaxInt32))
+	result, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		logger.Warn("Failed to collect terms of field [%s] for min_doc_count 0: %v", field, err)
+		return nil
+	}
+	facet, ok := result.Facets[field]
+	if !ok {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(existing))
+	for _, bucket := range existing {
+		seen[fmt.Sprint(bucket["key"])] = true
+	}
+	dict := h.facetTermsDictionary(idx, field)
+	var buckets []map[string]interface{}
+	for _, term := range facet.Terms.Terms() {
+		key, cached := dict.Lookup(term.Term)
+		if !cached {
+			key = h.decodeFacetTerm(idx, field, term.Term)
+		}
+		// 空字符串是 shift>0 的 PrefixCoded 词项
+		if keyStr, ok := key.(string); ok && keyStr == "" {
+			continue
+		}
+		if seen[fmt.Sprint(key)] {
+			continue
+		}
+		buckets = append(buckets, setBooleanKeyAsString(map[string]interface{}{"key": key, "doc_count": 0}))
+	}
+	return buckets
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_TermsAggregationOptions(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/items", `{"mappings":{"properties":{"color":{"type":"keyword"},"price":{"type":"long"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	// red: 3 个（均价 20），blue: 2 个（均价 50），green: 1 个（均价 5），black: 1 个（均价 100）
+	docs := []string{
+		`{"color":"red","price":10}`,
+		`{"color":"red","price":20}`,
+		`{"color":"red","price":30}`,
+		`{"color":"blue","price":40}`,
+		`{"color":"blue","price":60}`,
+		`{"color":"green","price":5}`,
+		`{"color":"black","price":100}`,
+	}
+	for i, doc := range docs {
+		if w := do("PUT", fmt.Sprintf("/items/_doc/%d?refresh=true", i), doc); w.Code >= 300 {
+			t.Fatalf("index %d: got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	type termsResult struct {
+		SumOtherDocCount int `json:"sum_other_doc_count"`
+		Buckets          []struct {
+			Key          string `json:"key"`
+			DocCount     int    `json:"doc_count"`
+			Aggregations map[string]struct {
+				Value float64 `json:"value"`
+			} `json:"aggregations"`
+		} `json:"buckets"`
+	}
+	search := func(aggs string) map[string]termsResult {
+		w := do("POST", "/items/_search", `{"size":0,"aggs":`+aggs+`}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Aggregations map[string]termsResult `json:"aggregations"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Aggregations
+	}
+
+	aggs := search(`{
+		"by_count":{"terms":{"field":"color","size":2}},
+		"by_count_asc":{"terms":{"field":"color","order":{"_count":"asc"}}},
+		"by_key_desc":{"terms":{"field":"color","order":{"_key":"desc"},"size":3}},
+		"by_avg":{"terms":{"field":"color","order":[{"avg_price":"desc"}],"size":2},"aggs":{"avg_price":{"avg":{"field":"price"}}}},
+		"frequent":{"terms":{"field":"color","min_doc_count":2}},
+		"included":{"terms":{"field":"color","include":"b.*","exclude":["black"]}},
+		"listed":{"terms":{"field":"color","include":["red","green"]}}
+	}`)
+
+	keys := func(name string) []string {
+		var out []string
+		for _, b := range aggs[name].Buckets {
+			out = append(out, b.Key)
+		}
+		return out
+	}
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"by_count", []string{"red", "blue"}},
+		{"by_count_asc", []string{"black", "green", "blue", "red"}},
+		{"by_key_desc", []string{"red", "green", "blue"}},
+		{"by_avg", []string{"black", "blue"}},
+		{"frequent", []string{"red", "blue"}},
+		{"included", []string{"blue"}},
+		{"listed", []string{"red", "green"}},
+	}
+	for _, tt := range tests {
+		if got := keys(tt.name); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected buckets %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+
+	if other := aggs["by_count"].SumOtherDocCount; other != 2 {
+		t.Errorf("by_count: expected sum_other_doc_count 2, got %d", other)
+	}
+	if avg := aggs["by_avg"].Buckets[1].Aggregations["avg_price"].Value; avg != 50 {
+		t.Errorf("by_avg: expected avg_price 50 for blue, got %v", avg)
+	}
+
+	// min_doc_count 为 0 时返回没有命中的词项
+	w := do("POST", "/items/_search", `{"size":0,"query":{"term":{"color":"red"}},"aggs":{"all":{"terms":{"field":"color","min_doc_count":0,"order":{"_key":"asc"}}}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Aggregations struct {
+			All struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"all"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var got []string
+	for _, b := range resp.Aggregations.All.Buckets {
+		got = append(got, fmt.Sprintf("%s:%d", b.Key, b.DocCount))
+	}
+	if expected := []string{"black:0", "blue:0", "green:0", "red:3"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("min_doc_count 0: expected %v, got %v", expected, got)
+	}
+}
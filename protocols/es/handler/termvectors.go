@@ -0,0 +1,596 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/gorilla/mux"
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+)
+
+// Term vectors（_termvectors / _mtermvectors）
+// 对文档（已索引文档的 _source 或请求中的人工文档 doc）的 text/keyword 字段按字段分析器重新分析，
+// 返回每个词项的词频以及位置、偏移；term_statistics 与 field_statistics 从索引的倒排表计算。
+// 多值字段之间的位置间隔为 termVectorsPositionGap，偏移间隔为 1（与 ES 默认一致）。
+
+// termVectorsPositionGap 多值字段相邻值之间的位置间隔（ES 的 position_increment_gap 默认值）
+const termVectorsPositionGap = 100
+
+// termVectorsRequest 单个文档的 term vectors 请求
+type termVectorsRequest struct {
+	index             string
+	id                string
+	doc               map[string]interface{} // 人工文档，设置时不读取索引中的文档
+	fields            []string               // 字段（支持通配符），为空时返回文档中所有 text/keyword 字段
+	positions         bool
+	offsets           bool
+	termStatistics    bool
+	fieldStatistics   bool
+	routing           string
+	perFieldAnalyzers map[string]string
+	access            *middleware.IndexAccess // 请求角色的限制：文档级安全不可见的文档按不存在处理，不可见字段不返回
+}
+
+// newTermVectorsRequest 创建默认参数的请求（positions、offsets、field_statistics 默认开启）
+func newTermVectorsRequest(indexName, id string) *termVectorsRequest {
+	return &termVectorsRequest{
+		index:           indexName,
+		id:              id,
+		positions:       true,
+		offsets:         true,
+		fieldStatistics: true,
+	}
+}
+
+// termVectorsQueryParams 把 URL 参数转换为与请求体相同形式的参数
+func termVectorsQueryParams(r *http.Request) map[string]interface{} {
+	params := make(map[string]interface{})
+	for key, values := range r.URL.Query() {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+	return params
+}
+
+// apply 应用 URL 参数或请求体中的参数
+func (req *termVectorsRequest) apply(params map[string]interface{}) common.APIError {
+	for key, value := range params {
+		var apiErr common.APIError
+		switch key {
+		case "fields", "stored_fields":
+			req.fields, apiErr = termVectorsStringList(key, value)
+		case "positions":
+			req.positions, apiErr = termVectorsBool(key, value)
+		case "offsets":
+			req.offsets, apiErr = termVectorsBool(key, value)
+		case "term_statistics":
+			req.termStatistics, apiErr = termVectorsBool(key, value)
+		case "field_statistics":
+			req.fieldStatistics, apiErr = termVectorsBool(key, value)
+		case "routing", "_routing":
+			req.routing = parseRoutingValue(value)
+		case "per_field_analyzer":
+			analyzers, ok := value.(map[string]interface{})
+			if !ok {
+				return common.NewBadRequestError("[per_field_analyzer] must be an object")
+			}
+			req.perFieldAnalyzers = make(map[string]string, len(analyzers))
+			for field, analyzer := range analyzers {
+				name, ok := analyzer.(string)
+				if !ok {
+					return common.NewBadRequestError(fmt.Sprintf("analyzer for field [%s] must be a string", field))
+				}
+				req.perFieldAnalyzers[field] = name
+			}
+		case "doc":
+			doc, ok := value.(map[string]interface{})
+			if !ok {
+				return common.NewBadRequestError("[doc] must be an object")
+			}
+			req.doc = doc
+		}
+		if apiErr != nil {
+			return apiErr
+		}
+	}
+	return nil
+}
+
+// termVectorsBool 解析布尔参数（JSON 布尔值或 URL 中的 "true"/"false"）
+func termVectorsBool(key string, value interface{}) (bool, common.APIError) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if v == "" {
+			return true, nil
+		}
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	}
+	return false, common.NewBadRequestError(fmt.Sprintf("Failed to parse value [%v] as only [true] or [false] are allowed for [%s]", value, key))
+}
+
+// termVectorsStringList 解析字段列表（数组或逗号分隔的字符串）
+func termVectorsStringList(key string, value interface{}) ([]string, common.APIError) {
+	switch v := value.(type) {
+	case string:
+		return splitCommaList(v), nil
+	case []interface{}:
+		rv := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, common.NewBadRequestError(fmt.Sprintf("[%s] must be an array of strings", key))
+			}
+			rv = append(rv, s)
+		}
+		return rv, nil
+	}
+	return nil, common.NewBadRequestError(fmt.Sprintf("[%s] must be an array of strings", key))
+}
+
+// decodeTermVectorsBody 解析可选的 JSON 请求体（GET 请求同样可以带请求体）
+func decodeTermVectorsBody(r *http.Request) (map[string]interface{}, common.APIError) {
+	var body map[string]interface{}
+	if r.Body == nil {
+		return body, nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		return nil, common.NewRequestBodyError("invalid JSON body", err)
+	}
+	return body, nil
+}
+
+// TermVectors 返回单个文档的 term vectors
+// GET/POST /{index}/_termvectors/{id}
+// GET/POST /{index}/_termvectors（请求体中提供人工文档 doc）
+func (h *DocumentHandler) TermVectors(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	req := newTermVectorsRequest(vars["index"], vars["id"])
+	if apiErr := req.apply(termVectorsQueryParams(r)); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	body, apiErr := decodeTermVectorsBody(r)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if apiErr := req.apply(body); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if req.id == "" && req.doc == nil {
+		common.HandleError(w, common.NewBadRequestError("Validation Failed: 1: id or doc is missing;"))
+		return
+	}
+	if apiErr := h.checkTermVectorsIndex(r, req.index); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	req.access = requestIndexAccess(r.Context(), req.index)
+
+	resp, apiErr := h.termVectors(req)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Failed to encode termvectors response: %v", err)
+	}
+}
+
+// MultiTermVectors 批量返回多个文档的 term vectors
+// GET/POST /_mtermvectors, GET/POST /{index}/_mtermvectors
+// 请求体为 {"docs": [{"_index", "_id", "doc", "fields", ...}]} 或 {"ids": [...], "parameters": {...}}，
+// URL 参数作为每个文档的默认参数
+func (h *DocumentHandler) MultiTermVectors(w http.ResponseWriter, r *http.Request) {
+	defaultIndex := mux.Vars(r)["index"]
+	query := termVectorsQueryParams(r)
+	body, apiErr := decodeTermVectorsBody(r)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	var docs []interface{}
+	if v, ok := body["docs"]; ok {
+		if docs, ok = v.([]interface{}); !ok {
+			common.HandleError(w, common.NewBadRequestError("[docs] must be an array"))
+			return
+		}
+	} else {
+		ids, ok := body["ids"].([]interface{})
+		if !ok {
+			if idsParam, hasIDs := query["ids"].(string); hasIDs {
+				for _, id := range splitCommaList(idsParam) {
+					ids = append(ids, id)
+				}
+			}
+		}
+		parameters, _ := body["parameters"].(map[string]interface{})
+		for _, id := range ids {
+			doc := map[string]interface{}{"_id": id}
+			for k, v := range parameters {
+				doc[k] = v
+			}
+			docs = append(docs, doc)
+		}
+	}
+	if len(docs) == 0 {
+		common.HandleError(w, common.NewBadRequestError("Validation Failed: 1: multi term vectors: no documents requested;"))
+		return
+	}
+
+	results := make([]interface{}, 0, len(docs))
+	refreshed := make(map[string]bool)
+	for _, item := range docs {
+		docMap, ok := item.(map[string]interface{})
+		if !ok {
+			common.HandleError(w, common.NewBadRequestError("each doc in [docs] must be an object"))
+			return
+		}
+		indexName, _ := docMap["_index"].(string)
+		if indexName == "" {
+			indexName = defaultIndex
+		}
+		id := ""
+		if v, ok := docMap["_id"]; ok {
+			id = fmt.Sprint(v)
+		}
+		req := newTermVectorsRequest(indexName, id)
+		apiErr := req.apply(query)
+		if apiErr == nil {
+			apiErr = req.apply(docMap)
+		}
+		if apiErr == nil && req.id == "" && req.doc == nil {
+			apiErr = common.NewBadRequestError("Validation Failed: 1: id or doc is missing;")
+		}
+		if apiErr == nil && indexName == "" {
+			apiErr = common.NewBadRequestError("Validation Failed: 1: index is missing;")
+		}
+		if apiErr == nil && !refreshed[indexName] {
+			apiErr = h.checkTermVectorsIndex(r, indexName)
+			refreshed[indexName] = apiErr == nil
+		}
+		var resp map[string]interface{}
+		if apiErr == nil {
+			req.access = requestIndexAccess(r.Context(), indexName)
+			resp, apiErr = h.termVectors(req)
+		}
+		if apiErr != nil {
+			resp = map[string]interface{}{
+				"_index": indexName,
+				"error": map[string]interface{}{
+					"type":   apiErr.Type(),
+					"reason": apiErr.Error(),
+				},
+			}
+			if id != "" {
+				resp["_id"] = id
+			}
+		}
+		results = append(results, resp)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"docs": results}); err != nil {
+		logger.Error("Failed to encode mtermvectors response: %v", err)
+	}
+}
+
+// checkTermVectorsIndex 校验索引存在与读 block，refresh=true 时先刷新索引
+func (h *DocumentHandler) checkTermVectorsIndex(r *http.Request, indexName string) common.APIError {
+	if err := common.ValidateIndexName(indexName); err != nil {
+		return common.NewBadRequestError(err.Error())
+	}
+	if !h.dirMgr.IndexExists(indexName) {
+		return common.NewIndexNotFoundError(indexName)
+	}
+	if apiErr := checkIndexBlock(h.metaStore, indexName, blockLevelRead); apiErr != nil {
+		return apiErr
+	}
+	return h.refreshBeforeGet(r, indexName)
+}
+
+// termVectors 计算单个文档的 term vectors 响应
+func (h *DocumentHandler) termVectors(req *termVectorsRequest) (map[string]interface{}, common.APIError) {
+	start := time.Now()
+	idx, err := h.indexMgr.GetIndex(req.index)
+	if err != nil {
+		logger.Error("Failed to get index [%s]: %v", req.index, err)
+		return nil, common.NewInternalServerError("failed to get index: " + err.Error())
+	}
+
+	resp := map[string]interface{}{
+		"_index": req.index,
+		"_type":  "_doc",
+	}
+	source := req.doc
+	if source == nil {
+		if apiErr := checkRouting(h.metaStore, req.index, req.id, req.routing); apiErr != nil {
+			return nil, apiErr
+		}
+		resp["_id"] = req.id
+		doc, err := idx.Document(req.id)
+		if err != nil || doc == nil || !h.documentVisible(idx, req.index, req.access, req.id) {
+			resp["_version"] = 0
+			resp["found"] = false
+			resp["took"] = time.Since(start).Milliseconds()
+			return resp, nil
+		}
+		source = req.access.FilterSource(h.extractDocumentFields(doc))
+		version := int64(1)
+		if versionInfo := h.versionMgr.GetVersion(req.index, req.id); versionInfo != nil {
+			version = versionInfo.Version
+		}
+		resp["_version"] = version
+	} else {
+		resp["_version"] = 0
+	}
+	resp["found"] = true
+
+	vectors, apiErr := h.computeTermVectors(idx, req, source)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	resp["took"] = time.Since(start).Milliseconds()
+	resp["term_vectors"] = vectors
+	return resp, nil
+}
+
+// termVectorsFields 返回请求涉及的字段及其值：mapping 中的 text/keyword 字段，
+// multi-field（如 title.keyword）使用父字段的值；请求角色不可见的字段不返回
+func (h *DocumentHandler) termVectorsFields(indexName string, req *termVectorsRequest, source map[string]interface{}) map[string][]interface{} {
+	fieldTypes := make(map[string]string)
+	if indexMeta, err := h.metaStore.GetIndexMetadata(indexName); err == nil && indexMeta != nil {
+		if props, ok := indexMeta.Mapping["properties"].(map[string]interface{}); ok {
+			collectFieldTypes(props, "", fieldTypes)
+		}
+	}
+	valuesOf := func(field string) []interface{} {
+		values := sourceValuesAt(source, field)
+		if len(values) == 0 {
+			if i := strings.LastIndex(field, "."); i > 0 {
+				if _, ok := fieldTypes[field[:i]]; ok {
+					values = sourceValuesAt(source, field[:i])
+				}
+			}
+		}
+		return values
+	}
+
+	rv := make(map[string][]interface{})
+	for field, fieldType := range fieldTypes {
+		if (fieldType != "text" && fieldType != "keyword") || !req.access.FieldAllowed(field) {
+			continue
+		}
+		if len(req.fields) > 0 && !matchesAnyPattern(req.fields, field) {
+			continue
+		}
+		if values := valuesOf(field); len(values) > 0 {
+			rv[field] = values
+		}
+	}
+	// 未映射但显式请求的字段使用默认分析器
+	for _, field := range req.fields {
+		if _, mapped := fieldTypes[field]; mapped || strings.Contains(field, "*") || !req.access.FieldAllowed(field) {
+			continue
+		}
+		if values := valuesOf(field); len(values) > 0 {
+			rv[field] = values
+		}
+	}
+	return rv
+}
+
+// termVectorsToken 词项在字段中的一次出现
+type termVectorsToken struct {
+	position, startOffset, endOffset int
+}
+
+// computeTermVectors 分析字段值并计算词频、位置、偏移以及可选的统计信息
+func (h *DocumentHandler) computeTermVectors(idx bleve.Index, req *termVectorsRequest, source map[string]interface{}) (map[string]interface{}, common.APIError) {
+	fields := h.termVectorsFields(req.index, req, source)
+
+	var reader index.IndexReader
+	if req.termStatistics || req.fieldStatistics {
+		advanced, err := idx.Advanced()
+		if err != nil {
+			return nil, common.NewInternalServerError("failed to open index: " + err.Error())
+		}
+		if reader, err = advanced.Reader(); err != nil {
+			return nil, common.NewInternalServerError("failed to open index reader: " + err.Error())
+		}
+		defer func() { _ = reader.Close() }()
+	}
+
+	m := idx.Mapping()
+	rv := make(map[string]interface{}, len(fields))
+	for field, values := range fields {
+		analyzerName := req.perFieldAnalyzers[field] // 为空时使用字段的分析器
+		if analyzerName == "" {
+			analyzerName = m.AnalyzerNameForPath(field)
+		}
+		analyzer := m.AnalyzerNamed(analyzerName)
+		if analyzer == nil {
+			return nil, common.NewBadRequestError(fmt.Sprintf("failed to find analyzer [%s]", analyzerName))
+		}
+
+		terms := make(map[string][]termVectorsToken)
+		positionBase, offsetBase := 0, 0
+		for i, value := range values {
+			text := termVectorsText(value)
+			if i > 0 {
+				positionBase += termVectorsPositionGap
+				offsetBase++
+			}
+			lastPosition := positionBase - 1
+			for _, token := range analyzer.Analyze([]byte(text)) {
+				// bleve 的位置从 1 开始，ES 从 0 开始
+				lastPosition = positionBase + token.Position - 1
+				terms[string(token.Term)] = append(terms[string(token.Term)], termVectorsToken{
+					position:    lastPosition,
+					startOffset: offsetBase + token.Start,
+					endOffset:   offsetBase + token.End,
+				})
+			}
+			positionBase = lastPosition + 1
+			offsetBase += len(text)
+		}
+		if len(terms) == 0 {
+			continue
+		}
+
+		termsResp := make(map[string]interface{}, len(terms))
+		for term, tokens := range terms {
+			entry := map[string]interface{}{"term_freq": len(tokens)}
+			if req.positions || req.offsets {
+				tokenList := make([]map[string]interface{}, 0, len(tokens))
+				for _, t := range tokens {
+					token := make(map[string]interface{}, 3)
+					if req.positions {
+						token["position"] = t.position
+					}
+					if req.offsets {
+						token["start_offset"] = t.startOffset
+						token["end_offset"] = t.endOffset
+					}
+					tokenList = append(tokenList, token)
+				}
+				entry["tokens"] = tokenList
+			}
+			if req.termStatistics {
+				docFreq, ttf, err := termStatistics(reader, field, term)
+				if err != nil {
+					return nil, common.NewInternalServerError("failed to read term statistics: " + err.Error())
+				}
+				entry["doc_freq"] = docFreq
+				entry["ttf"] = ttf
+			}
+			termsResp[term] = entry
+		}
+
+		fieldResp := map[string]interface{}{"terms": termsResp}
+		if req.fieldStatistics {
+			stats, err := fieldStatistics(reader, field)
+			if err != nil {
+				return nil, common.NewInternalServerError("failed to read field statistics: " + err.Error())
+			}
+			fieldResp["field_statistics"] = stats
+		}
+		rv[field] = fieldResp
+	}
+	return rv, nil
+}
+
+// termVectorsText 字段值的文本形式（keyword 字段上的数值与布尔值按其字面量分析）
+func termVectorsText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// termStatistics 返回字段中词项的文档频率与总词频
+func termStatistics(reader index.IndexReader, field, term string) (docFreq, ttf int, err error) {
+	tfr, err := reader.TermFieldReader(context.Background(), []byte(term), field, true, false, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { _ = tfr.Close() }()
+	for {
+		doc, err := tfr.Next(nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		if doc == nil {
+			return docFreq, ttf, nil
+		}
+		docFreq++
+		ttf += int(doc.Freq)
+	}
+}
+
+// fieldStatistics 返回字段的统计信息：包含该字段的文档数、所有词项文档频率之和与总词频之和
+func fieldStatistics(reader index.IndexReader, field string) (map[string]interface{}, error) {
+	dict, err := reader.FieldDict(field)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = dict.Close() }()
+
+	var terms []string
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		terms = append(terms, entry.Term)
+	}
+
+	docs := make(map[string]struct{})
+	sumDocFreq, sumTTF := 0, 0
+	for _, term := range terms {
+		tfr, err := reader.TermFieldReader(context.Background(), []byte(term), field, true, false, false)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			doc, err := tfr.Next(nil)
+			if err != nil {
+				_ = tfr.Close()
+				return nil, err
+			}
+			if doc == nil {
+				break
+			}
+			docs[string(doc.ID)] = struct{}{}
+			sumDocFreq++
+			sumTTF += int(doc.Freq)
+		}
+		_ = tfr.Close()
+	}
+	return map[string]interface{}{
+		"doc_count":    len(docs),
+		"sum_doc_freq": sumDocFreq,
+		"sum_ttf":      sumTTF,
+	}, nil
+}
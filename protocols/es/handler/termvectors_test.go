@@ -0,0 +1,210 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+type termVectorsTestToken struct {
+	Position    *int `json:"position"`
+	StartOffset *int `json:"start_offset"`
+	EndOffset   *int `json:"end_offset"`
+}
+
+type termVectorsTestField struct {
+	FieldStatistics *struct {
+		DocCount   int `json:"doc_count"`
+		SumDocFreq int `json:"sum_doc_freq"`
+		SumTTF     int `json:"sum_ttf"`
+	} `json:"field_statistics"`
+	Terms map[string]struct {
+		TermFreq int                    `json:"term_freq"`
+		DocFreq  *int                   `json:"doc_freq"`
+		TTF      *int                   `json:"ttf"`
+		Tokens   []termVectorsTestToken `json:"tokens"`
+	} `json:"terms"`
+}
+
+type termVectorsTestResponse struct {
+	Index       string                          `json:"_index"`
+	ID          *string                         `json:"_id"`
+	Found       bool                            `json:"found"`
+	TermVectors map[string]termVectorsTestField `json:"term_vectors"`
+	Error       *struct {
+		Type string `json:"type"`
+	} `json:"error"`
+}
+
+func TestDocumentHandler_TermVectors(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "PUT", Path: "/{index}/_doc/{id}", Handler: docHandler.IndexDocument},
+		{Method: "GET", Path: "/{index}/_termvectors/{id}", Handler: docHandler.TermVectors},
+		{Method: "POST", Path: "/{index}/_termvectors", Handler: docHandler.TermVectors},
+		{Method: "POST", Path: "/_mtermvectors", Handler: docHandler.MultiTermVectors},
+		{Method: "POST", Path: "/{index}/_mtermvectors", Handler: docHandler.MultiTermVectors},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	termVectors := func(method, path, body string) termVectorsTestResponse {
+		t.Helper()
+		w := do(method, path, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: got %d: %s", method, path, w.Code, w.Body.String())
+		}
+		var resp termVectorsTestResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+		return resp
+	}
+	tokens := func(field termVectorsTestField, term string) string {
+		var parts []string
+		for _, token := range field.Terms[term].Tokens {
+			part := ""
+			if token.Position != nil {
+				part = fmt.Sprintf("%d", *token.Position)
+			}
+			if token.StartOffset != nil {
+				part += fmt.Sprintf("@%d-%d", *token.StartOffset, *token.EndOffset)
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	if w := do("PUT", "/articles", `{"mappings":{"properties":{
+		"body":{"type":"text"},"tag":{"type":"keyword"},"views":{"type":"integer"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: got %d: %s", w.Code, w.Body.String())
+	}
+	for id, doc := range map[string]string{
+		"1": `{"body":"Quick fox, quick dog","tag":"animals","views":3}`,
+		"2": `{"body":"quick brown","tag":["animals","colors"]}`,
+	} {
+		if w := do("PUT", "/articles/_doc/"+id+"?refresh=true", doc); w.Code != http.StatusCreated {
+			t.Fatalf("index %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	// 词频、位置、偏移与统计信息
+	resp := termVectors("GET", "/articles/_termvectors/1?term_statistics=true", "")
+	if !resp.Found || resp.ID == nil || *resp.ID != "1" {
+		t.Fatalf("expected found document 1, got %+v", resp)
+	}
+	var fields []string
+	for field := range resp.TermVectors {
+		fields = append(fields, field)
+	}
+	if len(fields) != 2 || resp.TermVectors["body"].Terms == nil || resp.TermVectors["tag"].Terms == nil {
+		t.Errorf("expected term vectors for body and tag only, got %v", fields)
+	}
+	body := resp.TermVectors["body"]
+	quick := body.Terms["quick"]
+	if quick.TermFreq != 2 || tokens(body, "quick") != "0@0-5 2@11-16" {
+		t.Errorf("quick: unexpected term vector %+v", quick)
+	}
+	if quick.DocFreq == nil || *quick.DocFreq != 2 || quick.TTF == nil || *quick.TTF != 3 {
+		t.Errorf("quick: expected doc_freq 2 and ttf 3, got %+v", quick)
+	}
+	if tokens(body, "dog") != "3@17-20" {
+		t.Errorf("dog: unexpected tokens %s", tokens(body, "dog"))
+	}
+	if stats := body.FieldStatistics; stats == nil || stats.DocCount != 2 || stats.SumDocFreq != 5 || stats.SumTTF != 6 {
+		t.Errorf("body: unexpected field statistics %+v", stats)
+	}
+
+	// 多值字段的位置与偏移间隔，通配符字段，关闭 positions 与统计
+	resp = termVectors("GET", "/articles/_termvectors/2?fields=ta*&offsets=false&field_statistics=false", "")
+	tag := resp.TermVectors["tag"]
+	if len(resp.TermVectors) != 1 || tokens(tag, "animals") != "0" || tokens(tag, "colors") != "101" {
+		t.Errorf("tag: unexpected term vectors %+v", resp.TermVectors)
+	}
+	if tag.FieldStatistics != nil || tag.Terms["colors"].DocFreq != nil {
+		t.Errorf("tag: unexpected statistics %+v", tag)
+	}
+	resp = termVectors("GET", "/articles/_termvectors/2?fields=tag&positions=false", "")
+	if tokens(resp.TermVectors["tag"], "colors") != "@8-14" {
+		t.Errorf("tag offsets: unexpected tokens %s", tokens(resp.TermVectors["tag"], "colors"))
+	}
+
+	// 人工文档与 per_field_analyzer
+	resp = termVectors("POST", "/articles/_termvectors", `{"doc":{"body":"fox fox"},"per_field_analyzer":{"tag":"keyword"}}`)
+	if !resp.Found || resp.ID != nil || resp.TermVectors["body"].Terms["fox"].TermFreq != 2 {
+		t.Errorf("artificial document: unexpected response %+v", resp)
+	}
+	resp = termVectors("POST", "/articles/_termvectors", `{"doc":{"body":"Quick fox"},"per_field_analyzer":{"body":"keyword"}}`)
+	if _, ok := resp.TermVectors["body"].Terms["Quick fox"]; !ok {
+		t.Errorf("per_field_analyzer: unexpected terms %+v", resp.TermVectors["body"].Terms)
+	}
+
+	if resp := termVectors("GET", "/articles/_termvectors/9", ""); resp.Found {
+		t.Errorf("missing document: expected found false, got %+v", resp)
+	}
+	if w := do("POST", "/articles/_termvectors", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("no id or doc: expected 400, got %d", w.Code)
+	}
+
+	// _mtermvectors
+	var multi struct {
+		Docs []termVectorsTestResponse `json:"docs"`
+	}
+	decodeMulti := func(path, body string) {
+		t.Helper()
+		w := do("POST", path, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", path, w.Code, w.Body.String())
+		}
+		multi.Docs = nil
+		if err := json.Unmarshal(w.Body.Bytes(), &multi); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decodeMulti("/articles/_mtermvectors", `{"ids":["1","2"],"parameters":{"fields":["tag"],"positions":false}}`)
+	var ids []string
+	for _, doc := range multi.Docs {
+		ids = append(ids, *doc.ID)
+		if len(doc.TermVectors) != 1 || doc.TermVectors["tag"].Terms["animals"].TermFreq != 1 {
+			t.Errorf("mtermvectors %s: unexpected term vectors %+v", *doc.ID, doc.TermVectors)
+		}
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("mtermvectors: expected docs 1 and 2 in order, got %v", ids)
+	}
+	decodeMulti("/_mtermvectors", `{"docs":[{"_index":"articles","_id":"1","fields":["body"]},{"_index":"missing","_id":"1"}]}`)
+	if len(multi.Docs) != 2 || multi.Docs[0].TermVectors["body"].Terms["fox"].TermFreq != 1 {
+		t.Fatalf("mtermvectors docs: unexpected response %+v", multi.Docs)
+	}
+	if multi.Docs[1].Error == nil || multi.Docs[1].Error.Type != "index_not_found_exception" {
+		t.Errorf("mtermvectors missing index: expected error, got %+v", multi.Docs[1])
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// 段级时间裁剪（index.timestamp_field）
+// 创建索引时指定一个 date 字段，scorch 为每个段记录该字段的最小/最大值（合并时取并集，随段持久化）。
+// 查询的 must/filter 子句限定了该字段的范围时，搜索直接跳过时间范围不相交的段。
+// 日期字段上的 range 查询在解析阶段按字段格式解析为日期范围查询（支持 now-15m 等日期数学表达式）。
+
+// timestampFieldSetting 设置项路径（不含 "index." 前缀）
+const timestampFieldSetting = "timestamp_field"
+
+// parseTimestampField 校验 index.timestamp_field 设置，字段必须是 mapping 中的 date 字段，未设置时返回 ""
+func parseTimestampField(settings map[string]interface{}, mapping map[string]interface{}) (string, common.APIError) {
+	v, ok := lookupIndexSetting(settings, timestampFieldSetting)
+	if !ok || v == nil {
+		return "", nil
+	}
+	field, ok := v.(string)
+	if !ok || field == "" {
+		return "", common.NewBadRequestError(fmt.Sprintf("failed to parse value [%v] for setting [index.%s]", v, timestampFieldSetting))
+	}
+
+	fieldTypes := make(map[string]string)
+	if props, ok := mapping["properties"].(map[string]interface{}); ok {
+		collectFieldTypes(props, "", fieldTypes)
+	}
+	fieldType, ok := fieldTypes[field]
+	if !ok {
+		return "", common.NewBadRequestError(fmt.Sprintf("unknown timestamp field:[%s]", field))
+	}
+	if fieldType != "date" && fieldType != "date_nanos" {
+		return "", common.NewBadRequestError(fmt.Sprintf("timestamp field [%s] must be of type [date], found [%s]", field, fieldType))
+	}
+	return field, nil
+}
+
+// timePruningStats 读取索引的时间裁剪累计统计：参与裁剪的查询数与跳过的段数
+func timePruningStats(idx bleve.Index, field string) map[string]interface{} {
+	indexStats, _ := idx.StatsMap()["index"].(map[string]interface{})
+	searches, _ := indexStats["TotTimePruningSearches"].(uint64)
+	pruned, _ := indexStats["TotTimePrunedSegments"].(uint64)
+	return map[string]interface{}{
+		"field":                 field,
+		"query_total":           searches,
+		"segments_pruned_total": pruned,
+	}
+}
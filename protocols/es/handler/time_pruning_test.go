@@ -0,0 +1,214 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestDocumentHandler_TimePruning(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	statsHandler := NewStatsHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "PUT", Path: "/{index}/_settings", Handler: indexHandler.UpdateSettings},
+		{Method: "GET", Path: "/{index}/_stats", Handler: statsHandler.GetIndexStats},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/logs", `{
+		"settings":{"index":{"timestamp_field":"@timestamp"}},
+		"mappings":{"properties":{"@timestamp":{"type":"date"},"host":{"type":"keyword"}}}
+	}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 每个批次生成一个段：两天前、一天前与最近几分钟
+	now := time.Now().UTC()
+	batches := []time.Time{now.Add(-48 * time.Hour), now.Add(-24 * time.Hour), now.Add(-5 * time.Minute)}
+	for b, ts := range batches {
+		var body strings.Builder
+		for k := 0; k < 2; k++ {
+			fmt.Fprintf(&body, "{\"index\":{\"_index\":\"logs\",\"_id\":\"%d-%d\"}}\n", b, k)
+			fmt.Fprintf(&body, "{\"@timestamp\":%q,\"host\":\"h%d\"}\n", ts.Add(time.Duration(k)*time.Second).Format(time.RFC3339), k)
+		}
+		if w := do("POST", "/_bulk?refresh=true", body.String()); w.Code != http.StatusOK {
+			t.Fatalf("bulk %d: got %d: %s", b, w.Code, w.Body.String())
+		}
+	}
+
+	type searchResponse struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Profile struct {
+			Shards []struct {
+				Searches []struct {
+					TimePruning *struct {
+						Field          string `json:"field"`
+						SegmentsTotal  int    `json:"segments_total"`
+						SegmentsPruned int    `json:"segments_pruned"`
+					} `json:"time_pruning"`
+				} `json:"searches"`
+			} `json:"shards"`
+		} `json:"profile"`
+	}
+	search := func(body string) searchResponse {
+		t.Helper()
+		w := do("POST", "/logs/_search", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp searchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+		pruned   bool
+	}{
+		{
+			name:     "last 15 minutes",
+			body:     `{"profile":true,"query":{"range":{"@timestamp":{"gte":"now-15m"}}}}`,
+			expected: 2,
+			pruned:   true,
+		},
+		{
+			name:     "filter clause",
+			body:     `{"profile":true,"query":{"bool":{"must":[{"term":{"host":"h0"}}],"filter":[{"range":{"@timestamp":{"gte":"now-15m","lte":"now"}}}]}}}`,
+			expected: 1,
+			pruned:   true,
+		},
+		{
+			name:     "epoch millis",
+			body:     fmt.Sprintf(`{"profile":true,"query":{"range":{"@timestamp":{"gt":%d}}}}`, now.Add(-36*time.Hour).UnixMilli()),
+			expected: 4,
+			pruned:   true,
+		},
+		{
+			name:     "explicit format",
+			body:     fmt.Sprintf(`{"query":{"range":{"@timestamp":{"lt":%q,"format":"yyyy-MM-dd HH:mm:ss"}}}}`, now.Add(-36*time.Hour).Format("2006-01-02 15:04:05")),
+			expected: 2,
+		},
+		{
+			name:     "not restricted",
+			body:     `{"profile":true,"query":{"bool":{"should":[{"range":{"@timestamp":{"gte":"now-15m"}}},{"term":{"host":"h1"}}]}}}`,
+			expected: 4,
+		},
+	}
+	for _, tt := range tests {
+		resp := search(tt.body)
+		if resp.Hits.Total.Value != tt.expected {
+			t.Errorf("%s: expected %d hits, got %d", tt.name, tt.expected, resp.Hits.Total.Value)
+		}
+		if len(resp.Profile.Shards) == 0 {
+			continue
+		}
+		pruning := resp.Profile.Shards[0].Searches[0].TimePruning
+		if !tt.pruned {
+			if pruning != nil {
+				t.Errorf("%s: unexpected time pruning %+v", tt.name, pruning)
+			}
+			continue
+		}
+		if pruning == nil || pruning.Field != "@timestamp" || pruning.SegmentsTotal == 0 {
+			t.Errorf("%s: expected time pruning in profile, got %+v", tt.name, pruning)
+			continue
+		}
+		// 背景合并可能合并部分段，但最近的文档只会出现在其中一个段中
+		if tt.name != "epoch millis" && pruning.SegmentsPruned != pruning.SegmentsTotal-1 {
+			t.Errorf("%s: expected all segments but one pruned, got %+v", tt.name, pruning)
+		}
+	}
+
+	// 统计接口输出累计的裁剪次数
+	w := do("GET", "/logs/_stats", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats: got %d: %s", w.Code, w.Body.String())
+	}
+	var stats struct {
+		Indices map[string]struct {
+			Primaries struct {
+				Search struct {
+					TimePruning struct {
+						Field      string `json:"field"`
+						QueryTotal int    `json:"query_total"`
+					} `json:"time_pruning"`
+				} `json:"search"`
+			} `json:"primaries"`
+		} `json:"indices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if pruning := stats.Indices["logs"].Primaries.Search.TimePruning; pruning.Field != "@timestamp" || pruning.QueryTotal < 4 {
+		t.Errorf("expected time pruning stats, got %+v: %s", pruning, w.Body.String())
+	}
+
+	// index.timestamp_field 创建后不可修改
+	if w := do("PUT", "/logs/_settings", `{"index":{"timestamp_field":"host"}}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "non dynamic settings") {
+		t.Errorf("update timestamp field: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	invalid := []struct {
+		settings string
+		message  string
+	}{
+		{`{"index":{"timestamp_field":"missing"}}`, "unknown timestamp field:[missing]"},
+		{`{"index":{"timestamp_field":"host"}}`, "timestamp field [host] must be of type [date], found [keyword]"},
+		{`{"index":{"timestamp_field":1}}`, "failed to parse value [1] for setting [index.timestamp_field]"},
+	}
+	for i, tt := range invalid {
+		name := fmt.Sprintf("invalid_timestamp_%d", i)
+		w := do("PUT", "/"+name, `{"settings":`+tt.settings+`,
+			"mappings":{"properties":{"@timestamp":{"type":"date"},"host":{"type":"keyword"}}}}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", tt.settings, tt.message, w.Code, w.Body.String())
+		}
+		if indexHandler.dirMgr.IndexExists(name) {
+			t.Errorf("%s: index should not be created", tt.settings)
+		}
+	}
+}
@@ -0,0 +1,589 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+const (
+	// defaultTransformFrequency 连续 transform 检查源索引变化的默认间隔
+	defaultTransformFrequency = time.Minute
+	// defaultTransformSyncDelay 同步字段的默认延迟（避免遗漏尚未写入的文档）
+	defaultTransformSyncDelay = 60 * time.Second
+	// defaultTransformPageSize 每批写入目标索引的文档数（settings.max_page_search_size）
+	defaultTransformPageSize = 500
+)
+
+// transformIDPattern transform ID 规则（与 ES 一致）
+var transformIDPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9_\-]*[a-z0-9])?$`)
+
+// transformAggregationTypes pivot 支持的聚合类型
+var transformAggregationTypes = map[string]bool{
+	"avg": true, "sum": true, "min": true, "max": true,
+	"value_count": true, "cardinality": true, "missing": true,
+}
+
+// TransformConfig transform 配置（PUT _transform/{id} 的请求体）
+type TransformConfig struct {
+	ID          string                 `json:"id"`
+	Description string                 `json:"description,omitempty"`
+	Source      TransformSource        `json:"source"`
+	Dest        TransformDest          `json:"dest"`
+	Frequency   string                 `json:"frequency,omitempty"`
+	Sync        *TransformSync         `json:"sync,omitempty"`
+	Pivot       *TransformPivot        `json:"pivot,omitempty"`
+	Latest      map[string]interface{} `json:"latest,omitempty"`
+	Settings    *TransformSettings     `json:"settings,omitempty"`
+	Meta        map[string]interface{} `json:"_meta,omitempty"`
+	Version     string                 `json:"version,omitempty"`
+	CreateTime  int64                  `json:"create_time,omitempty"`
+}
+
+// TransformSource 源索引与过滤查询
+type TransformSource struct {
+	Index transformIndexList     `json:"index"`
+	Query map[string]interface{} `json:"query,omitempty"`
+}
+
+// transformIndexList 源索引列表：可以是字符串（逗号分隔）或字符串数组
+type transformIndexList []string
+
+// UnmarshalJSON 同时接受字符串与数组
+func (l *transformIndexList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = splitCommaList(s)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("[source.index] must be a string or an array of strings")
+	}
+	*l = list
+	return nil
+}
+
+// TransformDest 目标索引
+type TransformDest struct {
+	Index string `json:"index"`
+}
+
+// TransformSync 连续模式的同步配置（只支持按时间字段同步）
+type TransformSync struct {
+	Time *TransformTimeSync `json:"time"`
+}
+
+// TransformTimeSync 按时间字段同步：每个检查点处理同步字段小于 now - delay 的文档
+type TransformTimeSync struct {
+	Field string `json:"field"`
+	Delay string `json:"delay,omitempty"`
+}
+
+// TransformPivot pivot：按 group_by 分组并计算 aggregations
+type TransformPivot struct {
+	GroupBy      map[string]*TransformGroupSource  `json:"group_by"`
+	Aggregations map[string]map[string]interface{} `json:"aggregations,omitempty"`
+	Aggs         map[string]map[string]interface{} `json:"aggs,omitempty"`
+}
+
+// TransformGroupSource 分组来源：terms、histogram、date_histogram 三选一
+type TransformGroupSource struct {
+	Terms         *TransformTermsGroup         `json:"terms,omitempty"`
+	Histogram     *TransformHistogramGroup     `json:"histogram,omitempty"`
+	DateHistogram *TransformDateHistogramGroup `json:"date_histogram,omitempty"`
+}
+
+// TransformTermsGroup 按字段值分组
+type TransformTermsGroup struct {
+	Field         string `json:"field"`
+	MissingBucket bool   `json:"missing_bucket,omitempty"`
+}
+
+// TransformHistogramGroup 按数值区间分组
+type TransformHistogramGroup struct {
+	Field         string  `json:"field"`
+	Interval      float64 `json:"interval"`
+	MissingBucket bool    `json:"missing_bucket,omitempty"`
+}
+
+// TransformDateHistogramGroup 按时间区间分组：fixed_interval 与 calendar_interval 二选一
+type TransformDateHistogramGroup struct {
+	Field            string `json:"field"`
+	FixedInterval    string `json:"fixed_interval,omitempty"`
+	CalendarInterval string `json:"calendar_interval,omitempty"`
+	TimeZone         string `json:"time_zone,omitempty"`
+	MissingBucket    bool   `json:"missing_bucket,omitempty"`
+}
+
+// TransformSettings transform 设置
+type TransformSettings struct {
+	MaxPageSearchSize int `json:"max_page_search_size,omitempty"`
+}
+
+// aggregations 返回 pivot 的聚合定义（aggregations 与 aggs 为同义字段）
+func (p *TransformPivot) aggregations() map[string]map[string]interface{} {
+	if p.Aggregations != nil {
+		return p.Aggregations
+	}
+	return p.Aggs
+}
+
+// rollupGroup 转换为 rollup 的时间分组，复用间隔与时区的解析
+func (g *TransformDateHistogramGroup) rollupGroup() *RollupDateHistogramGroup {
+	return &RollupDateHistogramGroup{
+		Field:            g.Field,
+		FixedInterval:    g.FixedInterval,
+		CalendarInterval: g.CalendarInterval,
+		TimeZone:         g.TimeZone,
+	}
+}
+
+// frequency 返回检查间隔
+func (c *TransformConfig) frequency() time.Duration {
+	if c.Frequency == "" {
+		return defaultTransformFrequency
+	}
+	d, _ := parseTimeValue(c.Frequency)
+	return d
+}
+
+// syncDelay 返回同步字段的延迟
+func (c *TransformConfig) syncDelay() time.Duration {
+	if c.Sync == nil || c.Sync.Time.Delay == "" {
+		return defaultTransformSyncDelay
+	}
+	d, _ := parseTimeValue(c.Sync.Time.Delay)
+	return d
+}
+
+// pageSize 返回每批写入的文档数
+func (c *TransformConfig) pageSize() int {
+	if c.Settings == nil || c.Settings.MaxPageSearchSize == 0 {
+		return defaultTransformPageSize
+	}
+	return c.Settings.MaxPageSearchSize
+}
+
+// newTransformValidationError 配置校验错误
+func newTransformValidationError(message string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "action_request_validation_exception",
+		Message:    "Validation Failed: 1: " + message + ";",
+		HTTPStatus: 400,
+		Code:       "TRANSFORM_VALIDATION_ERROR",
+	}
+}
+
+// parseTransformConfig 解析并校验 transform 配置；id 为空时用于 _preview
+func parseTransformConfig(id string, body []byte) (*TransformConfig, common.APIError) {
+	var config TransformConfig
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, common.NewBadRequestError("failed to parse transform: " + err.Error())
+	}
+	if id != "" {
+		if config.ID != "" && config.ID != id {
+			return nil, common.NewBadRequestError(fmt.Sprintf("Inconsistent id; '%s' specified in the body differs from '%s' specified as a URL argument", config.ID, id))
+		}
+		if len(id) > 64 {
+			return nil, newTransformValidationError(fmt.Sprintf("Invalid transform id [%s]: cannot be longer than 64 characters", id))
+		}
+		if !transformIDPattern.MatchString(id) {
+			return nil, newTransformValidationError(fmt.Sprintf("Invalid transform id [%s]: must contain lowercase alphanumeric (a-z and 0-9), hyphens or underscores; must start and end with alphanumeric", id))
+		}
+		config.ID = id
+	}
+
+	if len(config.Source.Index) == 0 {
+		return nil, newTransformValidationError("source.index must not be empty")
+	}
+	if config.Dest.Index == "" {
+		return nil, newTransformValidationError("dest.index must not be empty")
+	}
+	if err := common.ValidateIndexName(config.Dest.Index); err != nil {
+		return nil, newTransformValidationError(err.Error())
+	}
+	for _, pattern := range config.Source.Index {
+		if pattern == config.Dest.Index || (strings.Contains(pattern, "*") && simpleWildcardMatch(pattern, config.Dest.Index)) {
+			return nil, newTransformValidationError(fmt.Sprintf("Destination index [%s] is included in source expression [%s]", config.Dest.Index, strings.Join(config.Source.Index, ",")))
+		}
+	}
+
+	if config.Frequency != "" {
+		d, err := parseTimeValue(config.Frequency)
+		if err != nil {
+			return nil, common.NewBadRequestError(fmt.Sprintf("failed to parse [frequency] with value [%s]", config.Frequency))
+		}
+		if d < time.Second {
+			return nil, newTransformValidationError("minimum permitted [frequency] is [1s]")
+		}
+		if d > time.Hour {
+			return nil, newTransformValidationError("highest permitted [frequency] is [1h]")
+		}
+	}
+	if config.Sync != nil {
+		if config.Sync.Time == nil {
+			return nil, common.NewBadRequestError("only [time] sync is supported")
+		}
+		if config.Sync.Time.Field == "" {
+			return nil, newTransformValidationError("sync.time.field must not be empty")
+		}
+		if config.Sync.Time.Delay != "" {
+			if _, err := parseTimeValue(config.Sync.Time.Delay); err != nil {
+				return nil, common.NewBadRequestError(fmt.Sprintf("failed to parse [delay] with value [%s]", config.Sync.Time.Delay))
+			}
+		}
+	}
+	if config.Settings != nil && config.Settings.MaxPageSearchSize != 0 {
+		if n := config.Settings.MaxPageSearchSize; n < 10 || n > 65536 {
+			return nil, newTransformValidationError(fmt.Sprintf("settings.max_page_search_size [%d] is out of range. The minimum value is 10 and the maximum is 65536", n))
+		}
+	}
+
+	if config.Latest != nil {
+		if config.Pivot != nil {
+			return nil, newTransformValidationError("Transform configuration must specify exactly 1 function")
+		}
+		return nil, common.NewBadRequestError("[latest] transforms are not supported, use [pivot]")
+	}
+	if config.Pivot == nil {
+		return nil, newTransformValidationError("Transform configuration must specify exactly 1 function")
+	}
+	if config.Pivot.Aggregations != nil && config.Pivot.Aggs != nil {
+		return nil, common.NewBadRequestError("Found two aggregation definitions: [aggs] and [aggregations]")
+	}
+	if _, err := compileTransformPivot(config.Pivot); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// transformGroup 编译后的分组
+type transformGroup struct {
+	name          string
+	kind          string // terms、histogram、date_histogram
+	field         string
+	missingBucket bool
+	interval      float64 // histogram
+	dateInterval  rollupInterval
+	location      *time.Location
+}
+
+// transformAggregation 编译后的聚合
+type transformAggregation struct {
+	name  string
+	kind  string
+	field string
+}
+
+// transformPivot 编译后的 pivot（分组与聚合均按名称排序）
+type transformPivot struct {
+	groups []*transformGroup
+	aggs   []*transformAggregation
+}
+
+// compileTransformPivot 校验并编译 pivot 配置
+func compileTransformPivot(pivot *TransformPivot) (*transformPivot, common.APIError) {
+	if len(pivot.GroupBy) == 0 {
+		return nil, newTransformValidationError("pivot.group_by must not be null")
+	}
+	compiled := &transformPivot{}
+	names := make(map[string]bool)
+	for name, source := range pivot.GroupBy {
+		if source == nil {
+			return nil, common.NewBadRequestError(fmt.Sprintf("invalid group_by source [%s]", name))
+		}
+		g := &transformGroup{name: name}
+		kinds := 0
+		if source.Terms != nil {
+			kinds++
+			g.kind, g.field, g.missingBucket = "terms", source.Terms.Field, source.Terms.MissingBucket
+		}
+		if source.Histogram != nil {
+			kinds++
+			g.kind, g.field, g.missingBucket = "histogram", source.Histogram.Field, source.Histogram.MissingBucket
+			g.interval = source.Histogram.Interval
+			if g.interval <= 0 {
+				return nil, common.NewBadRequestError(fmt.Sprintf("[interval] must be >0 for histogram group [%s]", name))
+			}
+		}
+		if source.DateHistogram != nil {
+			kinds++
+			g.kind, g.field, g.missingBucket = "date_histogram", source.DateHistogram.Field, source.DateHistogram.MissingBucket
+			dh := source.DateHistogram.rollupGroup()
+			interval, err := dh.interval()
+			if err != nil {
+				return nil, common.NewBadRequestError(err.Error())
+			}
+			loc, err := dh.location()
+			if err != nil {
+				return nil, common.NewBadRequestError(err.Error())
+			}
+			g.dateInterval, g.location = interval, loc
+		}
+		if kinds != 1 {
+			return nil, common.NewBadRequestError(fmt.Sprintf("group_by source [%s] must specify exactly one of [terms, histogram, date_histogram]", name))
+		}
+		if g.field == "" {
+			return nil, common.NewBadRequestError(fmt.Sprintf("[field] must be set for group_by source [%s]", name))
+		}
+		names[name] = true
+		compiled.groups = append(compiled.groups, g)
+	}
+
+	for name, spec := range pivot.aggregations() {
+		if names[name] {
+			return nil, newTransformValidationError(fmt.Sprintf("duplicate field [%s] detected", name))
+		}
+		agg := &transformAggregation{name: name}
+		for key, value := range spec {
+			if key == "meta" {
+				continue
+			}
+			if key == "aggs" || key == "aggregations" {
+				return nil, common.NewBadRequestError(fmt.Sprintf("Unsupported sub-aggregations in aggregation [%s]", name))
+			}
+			if agg.kind != "" {
+				return nil, common.NewBadRequestError(fmt.Sprintf("Found two aggregation type definitions in [%s]: [%s] and [%s]", name, agg.kind, key))
+			}
+			if !transformAggregationTypes[key] {
+				return nil, common.NewBadRequestError(fmt.Sprintf("Unsupported aggregation type [%s]", key))
+			}
+			body, _ := value.(map[string]interface{})
+			agg.kind = key
+			agg.field, _ = body["field"].(string)
+		}
+		if agg.kind == "" {
+			return nil, common.NewBadRequestError(fmt.Sprintf("Missing definition for aggregation [%s]", name))
+		}
+		if agg.field == "" {
+			return nil, common.NewBadRequestError(fmt.Sprintf("[field] must be set for aggregation [%s]", name))
+		}
+		compiled.aggs = append(compiled.aggs, agg)
+	}
+	sort.Slice(compiled.groups, func(i, j int) bool { return compiled.groups[i].name < compiled.groups[j].name })
+	sort.Slice(compiled.aggs, func(i, j int) bool { return compiled.aggs[i].name < compiled.aggs[j].name })
+	return compiled, nil
+}
+
+// bucketValues 返回文档在分组上的所有键值；字段缺失时在 missing_bucket 下返回 nil 键，否则返回空
+func (g *transformGroup) bucketValues(source map[string]interface{}) []interface{} {
+	var values []interface{}
+	seen := make(map[interface{}]bool)
+	for _, v := range sourceFieldValues(source, g.field) {
+		var key interface{}
+		switch g.kind {
+		case "terms":
+			switch v.(type) {
+			case string, float64, bool:
+				key = v
+			default:
+				continue
+			}
+		case "histogram":
+			f, ok := rollupNumericValue(v)
+			if !ok {
+				continue
+			}
+			key = math.Floor(f/g.interval) * g.interval
+		case "date_histogram":
+			t, ok := rollupDateValue(v)
+			if !ok {
+				continue
+			}
+			key = g.dateInterval.floor(t, g.location).UnixMilli()
+		}
+		if !seen[key] {
+			seen[key] = true
+			values = append(values, key)
+		}
+	}
+	if len(values) == 0 && g.missingBucket {
+		values = []interface{}{nil}
+	}
+	return values
+}
+
+// bucketKeys 返回文档所属的所有分组键（多值字段做笛卡尔积）
+func (p *transformPivot) bucketKeys(source map[string]interface{}) [][]interface{} {
+	keys := [][]interface{}{{}}
+	for _, g := range p.groups {
+		values := g.bucketValues(source)
+		if len(values) == 0 {
+			return nil
+		}
+		next := make([][]interface{}, 0, len(keys)*len(values))
+		for _, key := range keys {
+			for _, v := range values {
+				k := make([]interface{}, len(key), len(key)+1)
+				copy(k, key)
+				next = append(next, append(k, v))
+			}
+		}
+		keys = next
+	}
+	return keys
+}
+
+// transformAggState 单个分组上一个聚合的中间结果
+type transformAggState struct {
+	count    int64
+	sum      float64
+	min, max *float64
+	distinct map[string]struct{}
+	missing  int64
+}
+
+// add 把文档中字段的值计入聚合
+func (s *transformAggState) add(agg *transformAggregation, source map[string]interface{}) {
+	values := sourceFieldValues(source, agg.field)
+	switch agg.kind {
+	case "missing":
+		if len(values) == 0 {
+			s.missing++
+		}
+	case "value_count":
+		s.count += int64(len(values))
+	case "cardinality":
+		if s.distinct == nil {
+			s.distinct = make(map[string]struct{})
+		}
+		for _, v := range values {
+			s.distinct[fmt.Sprint(v)] = struct{}{}
+		}
+	default:
+		for _, v := range values {
+			f, ok := rollupNumericValue(v)
+			if !ok {
+				// min/max 也支持日期字段（按毫秒时间戳计算）
+				t, isDate := rollupDateValue(v)
+				if !isDate || (agg.kind != "min" && agg.kind != "max") {
+					continue
+				}
+				f = float64(t.UnixMilli())
+			}
+			s.count++
+			s.sum += f
+			if s.min == nil || f < *s.min {
+				s.min = &f
+			}
+			if s.max == nil || f > *s.max {
+				s.max = &f
+			}
+		}
+	}
+}
+
+// value 返回聚合结果，没有值时返回 nil
+func (s *transformAggState) value(kind string) interface{} {
+	switch kind {
+	case "avg":
+		if s.count == 0 {
+			return nil
+		}
+		return s.sum / float64(s.count)
+	case "sum":
+		return s.sum
+	case "min":
+		if s.min == nil {
+			return nil
+		}
+		return *s.min
+	case "max":
+		if s.max == nil {
+			return nil
+		}
+		return *s.max
+	case "value_count":
+		return s.count
+	case "cardinality":
+		return int64(len(s.distinct))
+	case "missing":
+		return s.missing
+	}
+	return nil
+}
+
+// setDottedField 按 "a.b" 路径写入对象（点号拆分为子对象，与目标索引 mapping 一致）
+func setDottedField(doc map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := doc[part].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			doc[part] = child
+		}
+		doc = child
+	}
+	doc[parts[len(parts)-1]] = value
+}
+
+// destMapping 推断目标索引的 mapping：分组字段沿用源字段类型，聚合结果按聚合类型确定
+func (p *transformPivot) destMapping(sourceTypes map[string]string) map[string]interface{} {
+	props := make(map[string]interface{})
+	setType := func(path, fieldType string) {
+		parts := strings.Split(path, ".")
+		m := props
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := m[part].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{"properties": map[string]interface{}{}}
+				m[part] = child
+			}
+			m = child["properties"].(map[string]interface{})
+		}
+		m[parts[len(parts)-1]] = map[string]interface{}{"type": fieldType}
+	}
+	for _, g := range p.groups {
+		switch g.kind {
+		case "terms":
+			fieldType := sourceTypes[g.field]
+			if fieldType == "" || fieldType == "text" {
+				fieldType = "keyword"
+			}
+			setType(g.name, fieldType)
+		case "histogram":
+			setType(g.name, "double")
+		case "date_histogram":
+			setType(g.name, "date")
+		}
+	}
+	for _, agg := range p.aggs {
+		switch agg.kind {
+		case "value_count", "cardinality", "missing":
+			setType(agg.name, "long")
+		case "min", "max":
+			if fieldType := sourceTypes[agg.field]; fieldType == "date" || fieldType == "date_nanos" {
+				setType(agg.name, "date")
+			} else {
+				setType(agg.name, "double")
+			}
+		default:
+			setType(agg.name, "double")
+		}
+	}
+	return props
+}
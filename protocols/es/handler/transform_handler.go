@@ -0,0 +1,547 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// transformPreviewSize _preview 返回的文档数上限
+const transformPreviewSize = 100
+
+// TransformHandler transform 处理器：按 pivot 汇总源索引并写入目标索引
+type TransformHandler struct {
+	indexHandler *IndexHandler
+	docHandler   *DocumentHandler
+	dirMgr       directory.DirectoryManager
+	metaStore    metadata.MetadataStore
+	transforms   map[string]*transformTask
+	mutex        sync.Mutex
+}
+
+// NewTransformHandler 创建 transform 处理器，从元数据存储加载 transform 并恢复已启动的 transform
+func NewTransformHandler(indexHandler *IndexHandler, docHandler *DocumentHandler) *TransformHandler {
+	h := &TransformHandler{
+		indexHandler: indexHandler,
+		docHandler:   docHandler,
+		dirMgr:       docHandler.dirMgr,
+		metaStore:    docHandler.metaStore,
+		transforms:   make(map[string]*transformTask),
+	}
+	stored, err := h.metaStore.ListTransforms()
+	if err != nil {
+		logger.Error("Failed to list transforms: %v", err)
+		return h
+	}
+	for _, t := range stored {
+		data, err := json.Marshal(t.Config)
+		if err != nil {
+			continue
+		}
+		var config TransformConfig
+		if err := json.Unmarshal(data, &config); err != nil || config.Pivot == nil {
+			logger.Error("Failed to parse transform [%s]: %v", t.ID, err)
+			continue
+		}
+		config.ID = t.ID
+		task, err := newTransformTask(&config, t.CreatedAt)
+		if err != nil {
+			logger.Error("Failed to load transform [%s]: %v", t.ID, err)
+			continue
+		}
+		if state := t.State; state != nil {
+			task.checkpoint = state.Checkpoint
+			task.checkpointTime = state.CheckpointTimestamp
+			task.timeUpperBound = state.TimeUpperBound
+			task.changesLastDetected = state.ChangesLastDetected
+			if state.Started {
+				task.mutex.Lock()
+				h.startTask(task)
+				task.mutex.Unlock()
+			}
+		}
+		h.transforms[t.ID] = task
+	}
+	return h
+}
+
+// Close 停止所有 transform 的后台调度（不修改持久化的启动状态）
+func (h *TransformHandler) Close() {
+	h.mutex.Lock()
+	tasks := make([]*transformTask, 0, len(h.transforms))
+	for _, task := range h.transforms {
+		tasks = append(tasks, task)
+	}
+	h.mutex.Unlock()
+	for _, task := range tasks {
+		task.mutex.Lock()
+		cancel, done := task.cancel, task.done
+		task.mutex.Unlock()
+		if cancel != nil {
+			cancel()
+			<-done
+		}
+	}
+}
+
+// saveTask 持久化 transform 的配置、启动状态与检查点
+func (h *TransformHandler) saveTask(task *transformTask) error {
+	data, err := json.Marshal(task.config)
+	if err != nil {
+		return err
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	task.mutex.Lock()
+	state := &metadata.TransformState{
+		Started:             task.state != transformStateStopped && task.state != transformStateStopping,
+		Checkpoint:          task.checkpoint,
+		CheckpointTimestamp: task.checkpointTime,
+		TimeUpperBound:      task.timeUpperBound,
+		ChangesLastDetected: task.changesLastDetected,
+	}
+	task.mutex.Unlock()
+	return h.metaStore.SaveTransform(task.config.ID, &metadata.Transform{
+		ID:        task.config.ID,
+		Config:    config,
+		State:     state,
+		CreatedAt: task.createdAt,
+		UpdatedAt: time.Now(),
+	})
+}
+
+// newTransformNotFoundError transform 不存在错误
+func newTransformNotFoundError(id string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "resource_not_found_exception",
+		Message:    fmt.Sprintf("Transform with id [%s] could not be found", id),
+		HTTPStatus: http.StatusNotFound,
+		Code:       "TRANSFORM_NOT_FOUND",
+	}
+}
+
+// newTransformConflictError transform 状态冲突错误
+func newTransformConflictError(message string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "status_exception",
+		Message:    message,
+		HTTPStatus: http.StatusConflict,
+		Code:       "TRANSFORM_CONFLICT",
+	}
+}
+
+// transformVisible 判断 transform 对请求是否可见：多租户请求只看到目标索引属于本租户的 transform
+func transformVisible(ctx context.Context, task *transformTask) bool {
+	prefix := tenantIndexPrefix(ctx)
+	return prefix == "" || strings.HasPrefix(task.config.Dest.Index, prefix)
+}
+
+// lookupTransform 返回请求可见的 transform
+func (h *TransformHandler) lookupTransform(ctx context.Context, id string) (*transformTask, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	task, ok := h.transforms[id]
+	if !ok || !transformVisible(ctx, task) {
+		return nil, false
+	}
+	return task, true
+}
+
+// matchTransforms 按 ID 表达式（逗号分隔，支持通配符与 _all）匹配请求可见的 transform；
+// allow_no_match=false 或精确 ID 不存在时返回 404
+func (h *TransformHandler) matchTransforms(ctx context.Context, expr string, allowNoMatch bool) ([]*transformTask, common.APIError) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var tasks []*transformTask
+	seen := make(map[string]bool)
+	patterns := splitCommaList(expr)
+	if len(patterns) == 0 {
+		patterns = []string{"_all"}
+	}
+	for _, pattern := range patterns {
+		matched := false
+		for id, task := range h.transforms {
+			if !transformVisible(ctx, task) {
+				continue
+			}
+			if pattern == "_all" || pattern == "*" || id == pattern || (strings.Contains(pattern, "*") && simpleWildcardMatch(pattern, id)) {
+				matched = true
+				if !seen[id] {
+					seen[id] = true
+					tasks = append(tasks, task)
+				}
+			}
+		}
+		if !matched && (!allowNoMatch || (pattern != "_all" && !strings.Contains(pattern, "*"))) {
+			return nil, newTransformNotFoundError(pattern)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].config.ID < tasks[j].config.ID })
+	return tasks, nil
+}
+
+// validateSource 校验源索引存在
+func (h *TransformHandler) validateSource(config *TransformConfig) common.APIError {
+	if len(h.sourceIndices(config)) == 0 {
+		return newTransformValidationError(fmt.Sprintf("Source index [%s] does not exist", strings.Join(config.Source.Index, ",")))
+	}
+	return nil
+}
+
+// writeTransformResponse 写入 JSON 响应
+func writeTransformResponse(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("Failed to encode transform response: %v", err)
+	}
+}
+
+// PutTransform 创建 transform（创建后处于停止状态）；defer_validation=true 时不校验源索引
+// PUT /_transform/{id}
+func (h *TransformHandler) PutTransform(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		common.HandleError(w, common.NewRequestBodyError("failed to read request body", err))
+		return
+	}
+	config, apiErr := parseTransformConfig(id, body)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if r.URL.Query().Get("defer_validation") != "true" {
+		if apiErr := h.validateSource(config); apiErr != nil {
+			common.HandleError(w, apiErr)
+			return
+		}
+	}
+	now := time.Now()
+	config.Version = ESVersion()
+	config.CreateTime = now.UnixMilli()
+	task, err := newTransformTask(config, now)
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, exists := h.transforms[id]; exists {
+		common.HandleError(w, &common.BaseError{
+			ErrType:    "resource_already_exists_exception",
+			Message:    fmt.Sprintf("Transform with id [%s] already exists", id),
+			HTTPStatus: http.StatusConflict,
+			Code:       "TRANSFORM_EXISTS",
+		})
+		return
+	}
+	if err := h.saveTask(task); err != nil {
+		logger.Error("Failed to save transform [%s]: %v", id, err)
+		common.HandleError(w, common.NewInternalServerError("failed to save transform: "+err.Error()))
+		return
+	}
+	h.transforms[id] = task
+	writeTransformResponse(w, http.StatusOK, map[string]interface{}{"acknowledged": true})
+}
+
+// GetTransforms 获取 transform 配置
+// GET /_transform
+// GET /_transform/{id}（逗号分隔，支持通配符与 _all）
+func (h *TransformHandler) GetTransforms(w http.ResponseWriter, r *http.Request) {
+	tasks, apiErr := h.matchTransforms(r.Context(), mux.Vars(r)["id"], r.URL.Query().Get("allow_no_match") != "false")
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	configs := make([]*TransformConfig, 0, len(tasks))
+	for _, task := range tasks {
+		configs = append(configs, task.config)
+	}
+	writeTransformResponse(w, http.StatusOK, map[string]interface{}{
+		"count":      len(configs),
+		"transforms": configs,
+	})
+}
+
+// status 返回 transform 的状态、统计与检查点（GET _transform/{id}/_stats 的单个条目）
+func (t *transformTask) status() map[string]interface{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	last := map[string]interface{}{"checkpoint": t.checkpoint}
+	if t.checkpointTime != nil {
+		last["timestamp_millis"] = t.checkpointTime.UnixMilli()
+	}
+	if t.timeUpperBound != nil {
+		last["time_upper_bound_millis"] = t.timeUpperBound.UnixMilli()
+	}
+	checkpointing := map[string]interface{}{"last": last}
+	if t.changesLastDetected != nil {
+		checkpointing["changes_last_detected_at"] = t.changesLastDetected.UnixMilli()
+	}
+	if t.lastSearchTime != nil {
+		checkpointing["last_search_time"] = t.lastSearchTime.UnixMilli()
+	}
+	health := map[string]interface{}{"status": "green"}
+	status := map[string]interface{}{
+		"id":            t.config.ID,
+		"state":         t.state,
+		"stats":         t.stats,
+		"checkpointing": checkpointing,
+		"health":        health,
+	}
+	if t.state == transformStateFailed {
+		status["reason"] = t.reason
+		health["status"] = "red"
+		health["issues"] = []interface{}{map[string]interface{}{
+			"issue":   "Transform task state is [failed]",
+			"details": t.reason,
+			"count":   1,
+		}}
+	}
+	return status
+}
+
+// GetTransformStats 获取 transform 的状态、统计与检查点
+// GET /_transform/{id}/_stats
+func (h *TransformHandler) GetTransformStats(w http.ResponseWriter, r *http.Request) {
+	tasks, apiErr := h.matchTransforms(r.Context(), mux.Vars(r)["id"], r.URL.Query().Get("allow_no_match") != "false")
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	results := make([]map[string]interface{}, 0, len(tasks))
+	for _, task := range tasks {
+		results = append(results, task.status())
+	}
+	writeTransformResponse(w, http.StatusOK, map[string]interface{}{
+		"count":      len(results),
+		"transforms": results,
+	})
+}
+
+// DeleteTransform 删除已停止的 transform（目标索引中的数据保留）；force=true 时先停止
+// DELETE /_transform/{id}
+func (h *TransformHandler) DeleteTransform(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	task, ok := h.lookupTransform(r.Context(), id)
+	if !ok {
+		common.HandleError(w, newTransformNotFoundError(id))
+		return
+	}
+	task.mutex.Lock()
+	state := task.state
+	task.mutex.Unlock()
+	if state != transformStateStopped {
+		if r.URL.Query().Get("force") != "true" {
+			common.HandleError(w, newTransformConflictError(fmt.Sprintf("Cannot delete transform [%s] as the task is running. Stop the task first", id)))
+			return
+		}
+		if done := task.stopTask(); done != nil {
+			<-done
+		}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err := h.metaStore.DeleteTransform(id); err != nil {
+		if _, notFound := err.(*metadata.MetadataNotFoundError); !notFound {
+			logger.Error("Failed to delete transform [%s]: %v", id, err)
+			common.HandleError(w, common.NewInternalServerError("failed to delete transform: "+err.Error()))
+			return
+		}
+	}
+	delete(h.transforms, id)
+	writeTransformResponse(w, http.StatusOK, map[string]interface{}{"acknowledged": true})
+}
+
+// StartTransform 启动 transform，立即执行一个检查点
+// POST /_transform/{id}/_start
+func (h *TransformHandler) StartTransform(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	task, ok := h.lookupTransform(r.Context(), id)
+	if !ok {
+		common.HandleError(w, newTransformNotFoundError(id))
+		return
+	}
+	if apiErr := h.validateSource(task.config); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	// 等待正在停止的调度退出后再启动
+	task.mutex.Lock()
+	if task.state == transformStateStopping {
+		done := task.done
+		task.mutex.Unlock()
+		<-done
+		task.mutex.Lock()
+	}
+	switch task.state {
+	case transformStateStopped:
+		h.startTask(task)
+	case transformStateFailed:
+		task.mutex.Unlock()
+		common.HandleError(w, newTransformConflictError(fmt.Sprintf("Unable to start transform [%s] as it is in a failed state. Use force stop and then restart the transform once error is resolved. More details: [%s]", id, task.reason)))
+		return
+	default:
+		task.mutex.Unlock()
+		common.HandleError(w, newTransformConflictError(fmt.Sprintf("Cannot start transform [%s] as it is already started.", id)))
+		return
+	}
+	task.mutex.Unlock()
+
+	if err := h.saveTask(task); err != nil {
+		logger.Error("Failed to save state of transform [%s]: %v", id, err)
+	}
+	writeTransformResponse(w, http.StatusOK, map[string]interface{}{"acknowledged": true})
+}
+
+// StopTransform 停止 transform；wait_for_completion=true 时等待正在进行的检查点结束（timeout 默认 30s），
+// 失败的 transform 需要 force=true
+// POST /_transform/{id}/_stop（逗号分隔，支持通配符与 _all）
+func (h *TransformHandler) StopTransform(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tasks, apiErr := h.matchTransforms(r.Context(), mux.Vars(r)["id"], q.Get("allow_no_match") != "false")
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	timeout := 30 * time.Second
+	if s := q.Get("timeout"); s != "" {
+		d, err := parseTimeValue(s)
+		if err != nil {
+			common.HandleError(w, common.NewBadRequestError(err.Error()))
+			return
+		}
+		timeout = d
+	}
+	force := q.Get("force") == "true"
+	for _, task := range tasks {
+		task.mutex.Lock()
+		state, reason := task.state, task.reason
+		task.mutex.Unlock()
+		if state == transformStateFailed && !force {
+			common.HandleError(w, newTransformConflictError(fmt.Sprintf("Unable to stop transform [%s] as it is in a failed state. Use force stop to stop the transform. More details: [%s]", task.config.ID, reason)))
+			return
+		}
+	}
+
+	var waits []<-chan struct{}
+	for _, task := range tasks {
+		if done := task.stopTask(); done != nil {
+			waits = append(waits, done)
+		}
+		if err := h.saveTask(task); err != nil {
+			logger.Error("Failed to save state of transform [%s]: %v", task.config.ID, err)
+		}
+	}
+	if q.Get("wait_for_completion") == "true" {
+		deadline := time.After(timeout)
+		for _, done := range waits {
+			select {
+			case <-done:
+			case <-deadline:
+				common.HandleError(w, &common.BaseError{
+					ErrType:    "elasticsearch_timeout_exception",
+					Message:    fmt.Sprintf("Timed out after [%s] while waiting for transform [%s] to stop", timeout, mux.Vars(r)["id"]),
+					HTTPStatus: http.StatusRequestTimeout,
+					Code:       "TRANSFORM_STOP_TIMEOUT",
+				})
+				return
+			}
+		}
+	}
+	writeTransformResponse(w, http.StatusOK, map[string]interface{}{"acknowledged": true})
+}
+
+// PreviewTransform 预览 transform 的前 100 个文档与推断的目标索引 mapping，不写入数据
+// POST /_transform/_preview（请求体为 transform 配置）
+// GET|POST /_transform/{id}/_preview（预览已创建的 transform）
+func (h *TransformHandler) PreviewTransform(w http.ResponseWriter, r *http.Request) {
+	var config *TransformConfig
+	if id := mux.Vars(r)["id"]; id != "" {
+		task, ok := h.lookupTransform(r.Context(), id)
+		if !ok {
+			common.HandleError(w, newTransformNotFoundError(id))
+			return
+		}
+		config = task.config
+	} else {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			common.HandleError(w, common.NewRequestBodyError("failed to read request body", err))
+			return
+		}
+		var apiErr common.APIError
+		if config, apiErr = parseTransformConfig("", body); apiErr != nil {
+			common.HandleError(w, apiErr)
+			return
+		}
+	}
+	if apiErr := h.validateSource(config); apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	pivot, apiErr := compileTransformPivot(config.Pivot)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	buckets, _, err := h.computePivot(context.Background(), config, pivot, transformScanRange{})
+	if err != nil {
+		common.HandleError(w, common.NewBadRequestError(err.Error()))
+		return
+	}
+	keys := sortedBucketKeys(buckets)
+	if len(keys) > transformPreviewSize {
+		keys = keys[:transformPreviewSize]
+	}
+	docs := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		docs = append(docs, pivot.bucketDoc(buckets[key]))
+	}
+	writeTransformResponse(w, http.StatusOK, map[string]interface{}{
+		"preview": docs,
+		"generated_dest_index": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"_meta":      transformDestMeta(config.ID),
+				"properties": pivot.destMapping(h.sourceFieldTypes(h.sourceIndices(config))),
+			},
+			"settings": map[string]interface{}{},
+			"aliases":  map[string]interface{}{},
+		},
+	})
+}
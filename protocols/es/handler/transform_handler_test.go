@@ -0,0 +1,303 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestTransformHandler_Pivot(t *testing.T) {
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	transformHandler := NewTransformHandler(indexHandler, docHandler)
+	defer func() { transformHandler.Close() }()
+	route := func(method, path string, fn func(h *TransformHandler) http.HandlerFunc) server.Route {
+		return server.Route{Method: method, Path: path, Handler: func(w http.ResponseWriter, r *http.Request) {
+			fn(transformHandler)(w, r)
+		}}
+	}
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		route("POST", "/_transform/_preview", func(h *TransformHandler) http.HandlerFunc { return h.PreviewTransform }),
+		route("PUT", "/_transform/{id}", func(h *TransformHandler) http.HandlerFunc { return h.PutTransform }),
+		route("GET", "/_transform", func(h *TransformHandler) http.HandlerFunc { return h.GetTransforms }),
+		route("GET", "/_transform/{id}", func(h *TransformHandler) http.HandlerFunc { return h.GetTransforms }),
+		route("DELETE", "/_transform/{id}", func(h *TransformHandler) http.HandlerFunc { return h.DeleteTransform }),
+		route("GET", "/_transform/{id}/_stats", func(h *TransformHandler) http.HandlerFunc { return h.GetTransformStats }),
+		route("POST", "/_transform/{id}/_start", func(h *TransformHandler) http.HandlerFunc { return h.StartTransform }),
+		route("POST", "/_transform/{id}/_stop", func(h *TransformHandler) http.HandlerFunc { return h.StopTransform }),
+		route("POST", "/_transform/{id}/_preview", func(h *TransformHandler) http.HandlerFunc { return h.PreviewTransform }),
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		t.Helper()
+		var rv map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &rv); err != nil {
+			t.Fatalf("decode: %v: %s", err, w.Body.String())
+		}
+		return rv
+	}
+	stats := func(id string) map[string]interface{} {
+		t.Helper()
+		w := do("GET", "/_transform/"+id+"/_stats", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("stats %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+		return decode(w)["transforms"].([]interface{})[0].(map[string]interface{})
+	}
+	checkpoint := func(s map[string]interface{}) float64 {
+		return s["checkpointing"].(map[string]interface{})["last"].(map[string]interface{})["checkpoint"].(float64)
+	}
+	waitFor := func(id string, cond func(s map[string]interface{}) bool) map[string]interface{} {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			s := stats(id)
+			if cond(s) {
+				return s
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("transform %s did not reach expected state: %v", id, s)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	searchDest := func(index string) map[string]map[string]interface{} {
+		t.Helper()
+		w := do("POST", "/"+index+"/_search", `{"size":100}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", index, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Hits struct {
+				Hits []struct {
+					Source map[string]interface{} `json:"_source"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode search: %v", err)
+		}
+		rv := make(map[string]map[string]interface{})
+		for _, hit := range resp.Hits.Hits {
+			key, _ := json.Marshal([]interface{}{hit.Source["customer"], hit.Source["hour"]})
+			rv[string(key)] = hit.Source
+		}
+		return rv
+	}
+
+	if w := do("PUT", "/orders", `{"mappings":{"properties":{"customer":{"type":"keyword"},"amount":{"type":"double"},"ts":{"type":"date"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/_bulk?refresh=true", `{"index":{"_index":"orders"}}
+{"customer":"alice","amount":10,"ts":"2024-01-01T10:05:00Z"}
+{"index":{"_index":"orders"}}
+{"customer":"alice","amount":30,"ts":"2024-01-01T10:40:00Z"}
+{"index":{"_index":"orders"}}
+{"customer":"alice","amount":5,"ts":"2024-01-01T11:10:00Z"}
+{"index":{"_index":"orders"}}
+{"customer":"bob","amount":7,"ts":"2024-01-01T10:20:00Z"}
+{"index":{"_index":"orders"}}
+{"customer":"bob","amount":-1,"ts":"2024-01-01T10:30:00Z"}
+`); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	pivot := `{
+		"group_by": {"customer": {"terms": {"field": "customer"}}},
+		"aggregations": {
+			"total": {"sum": {"field": "amount"}},
+			"avg_amount": {"avg": {"field": "amount"}},
+			"orders": {"value_count": {"field": "amount"}},
+			"last_order": {"max": {"field": "ts"}}
+		}
+	}`
+
+	// _preview 不写入数据，返回文档与推断的 mapping
+	w := do("POST", "/_transform/_preview", `{"source":{"index":"orders","query":{"range":{"amount":{"gt":0}}}},"dest":{"index":"customers"},"pivot":`+pivot+`}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("preview: got %d: %s", w.Code, w.Body.String())
+	}
+	preview := decode(w)
+	docs := preview["preview"].([]interface{})
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 preview docs, got %v", docs)
+	}
+	alice, bob := docs[0].(map[string]interface{}), docs[1].(map[string]interface{})
+	if alice["customer"] != "alice" || alice["total"] != 45.0 || alice["avg_amount"] != 15.0 || alice["orders"] != 3.0 {
+		t.Errorf("unexpected alice preview: %v", alice)
+	}
+	if bob["total"] != 7.0 || bob["orders"] != 1.0 {
+		t.Errorf("source query should exclude negative amounts: %v", bob)
+	}
+	props := preview["generated_dest_index"].(map[string]interface{})["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	for field, want := range map[string]string{"customer": "keyword", "total": "double", "orders": "long", "last_order": "date"} {
+		if got := props[field].(map[string]interface{})["type"]; got != want {
+			t.Errorf("generated mapping for %s: got %v, want %s", field, got, want)
+		}
+	}
+
+	// 批量 transform：执行一个检查点后自动停止
+	batch := `{"description":"totals per customer","source":{"index":["orders"]},"dest":{"index":"customers"},"pivot":` + pivot + `}`
+	if w := do("PUT", "/_transform/by-customer", batch); w.Code != http.StatusOK {
+		t.Fatalf("put transform: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/_transform/by-customer", batch); w.Code != http.StatusConflict {
+		t.Errorf("duplicate put: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/_transform/by-customer", ""); w.Code != http.StatusOK || decode(w)["count"] != 1.0 || !strings.Contains(w.Body.String(), `"description":"totals per customer"`) {
+		t.Errorf("get transform: got %d: %s", w.Code, w.Body.String())
+	}
+	if s := stats("by-customer"); s["state"] != "stopped" || checkpoint(s) != 0 {
+		t.Errorf("new transform should be stopped without checkpoints: %v", s)
+	}
+	if w := do("POST", "/_transform/by-customer/_start", ""); w.Code != http.StatusOK {
+		t.Fatalf("start: got %d: %s", w.Code, w.Body.String())
+	}
+	s := waitFor("by-customer", func(s map[string]interface{}) bool { return s["state"] == "stopped" && checkpoint(s) == 1 })
+	if st := s["stats"].(map[string]interface{}); st["documents_processed"] != 5.0 || st["documents_indexed"] != 2.0 {
+		t.Errorf("unexpected batch stats: %v", st)
+	}
+	dest := searchDest("customers")
+	if got := dest[`["bob",null]`]; got == nil || got["total"] != 6.0 || got["last_order"] == nil {
+		t.Errorf("unexpected destination documents: %v", dest)
+	}
+
+	// 连续 transform：按小时与客户分组，只重新计算有新文档的分组
+	continuous := `{
+		"source": {"index": "orders"},
+		"dest": {"index": "hourly"},
+		"frequency": "1s",
+		"sync": {"time": {"field": "ts", "delay": "0s"}},
+		"pivot": {
+			"group_by": {
+				"customer": {"terms": {"field": "customer"}},
+				"hour": {"date_histogram": {"field": "ts", "calendar_interval": "1h"}}
+			},
+			"aggs": {"total": {"sum": {"field": "amount"}}}
+		}
+	}`
+	if w := do("PUT", "/_transform/hourly", continuous); w.Code != http.StatusOK {
+		t.Fatalf("put continuous transform: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/_transform/hourly/_start", ""); w.Code != http.StatusOK {
+		t.Fatalf("start continuous: got %d: %s", w.Code, w.Body.String())
+	}
+	waitFor("hourly", func(s map[string]interface{}) bool { return checkpoint(s) == 1 })
+	if w := do("POST", "/_transform/hourly/_start", ""); w.Code != http.StatusConflict {
+		t.Errorf("start started transform: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	hour := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC).UnixMilli()
+	if got := searchDest("hourly"); len(got) != 3 || got[`["alice",`+strconv.FormatInt(hour, 10)+`]`]["total"] != 40.0 {
+		t.Fatalf("unexpected hourly documents: %v", got)
+	}
+
+	now := time.Now().UTC()
+	if w := do("POST", "/_bulk?refresh=true", `{"index":{"_index":"orders"}}
+{"customer":"carol","amount":3,"ts":"`+now.Format(time.RFC3339Nano)+`"}
+`); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+	s = waitFor("hourly", func(s map[string]interface{}) bool { return checkpoint(s) == 2 })
+	if st := s["stats"].(map[string]interface{}); st["documents_indexed"] != 4.0 {
+		t.Errorf("only the changed bucket should be indexed again: %v", st)
+	}
+	if s["checkpointing"].(map[string]interface{})["last"].(map[string]interface{})["time_upper_bound_millis"] == nil {
+		t.Errorf("expected time_upper_bound_millis: %v", s)
+	}
+	if got := searchDest("hourly"); len(got) != 4 {
+		t.Errorf("expected new bucket for carol, got %v", got)
+	}
+
+	if w := do("DELETE", "/_transform/hourly", ""); w.Code != http.StatusConflict {
+		t.Errorf("delete started transform: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/_transform/hourly/_stop?wait_for_completion=true", ""); w.Code != http.StatusOK {
+		t.Fatalf("stop: got %d: %s", w.Code, w.Body.String())
+	}
+	if s := stats("hourly"); s["state"] != "stopped" {
+		t.Errorf("expected stopped transform, got %v", s["state"])
+	}
+
+	// 重新加载后配置与检查点仍然存在
+	transformHandler.Close()
+	transformHandler = NewTransformHandler(indexHandler, docHandler)
+	if s := stats("hourly"); s["state"] != "stopped" || checkpoint(s) != 2 {
+		t.Errorf("unexpected reloaded transform: %v", s)
+	}
+	if w := do("GET", "/_transform", ""); decode(w)["count"] != 2.0 {
+		t.Errorf("expected 2 transforms: %s", w.Body.String())
+	}
+	if w := do("POST", "/_transform/by-customer/_preview", ""); w.Code != http.StatusOK || len(decode(w)["preview"].([]interface{})) != 3 {
+		t.Errorf("preview existing transform: got %d: %s", w.Code, w.Body.String())
+	}
+
+	invalid := []struct {
+		path, body, message string
+		status              int
+	}{
+		{"/_transform/Bad", batch, "must contain lowercase alphanumeric", http.StatusBadRequest},
+		{"/_transform/loop", `{"source":{"index":"ord*"},"dest":{"index":"orders_summary"},"pivot":` + pivot + `}`, "is included in source expression", http.StatusBadRequest},
+		{"/_transform/missing", `{"source":{"index":"nope"},"dest":{"index":"x"},"pivot":` + pivot + `}`, "Source index [nope] does not exist", http.StatusBadRequest},
+		{"/_transform/pct", `{"source":{"index":"orders"},"dest":{"index":"x"},"pivot":{"group_by":{"c":{"terms":{"field":"customer"}}},"aggs":{"p":{"percentiles":{"field":"amount"}}}}}`, "Unsupported aggregation type [percentiles]", http.StatusBadRequest},
+		{"/_transform/latest", `{"source":{"index":"orders"},"dest":{"index":"x"},"latest":{"unique_key":["customer"],"sort":"ts"}}`, "[latest] transforms are not supported", http.StatusBadRequest},
+		{"/_transform/nogroup", `{"source":{"index":"orders"},"dest":{"index":"x"},"pivot":{"aggs":{"t":{"sum":{"field":"amount"}}}}}`, "pivot.group_by must not be null", http.StatusBadRequest},
+		{"/_transform/slow", `{"source":{"index":"orders"},"dest":{"index":"x"},"frequency":"2h","pivot":` + pivot + `}`, "highest permitted [frequency] is [1h]", http.StatusBadRequest},
+		{"/_transform/unknown", `{"source":{"index":"orders"},"dest":{"index":"x"},"bogus":1,"pivot":` + pivot + `}`, "bogus", http.StatusBadRequest},
+	}
+	for _, tt := range invalid {
+		w := do("PUT", tt.path, tt.body)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("put %s: expected %d with %q, got %d: %s", tt.path, tt.status, tt.message, w.Code, w.Body.String())
+		}
+	}
+	if w := do("PUT", "/_transform/deferred?defer_validation=true", `{"source":{"index":"later"},"dest":{"index":"later_summary"},"pivot":`+pivot+`}`); w.Code != http.StatusOK {
+		t.Errorf("defer_validation: got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do("GET", "/_transform/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("get missing transform: expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/_transform/nope*", ""); w.Code != http.StatusOK || decode(w)["count"] != 0.0 {
+		t.Errorf("wildcard without matches: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", "/_transform/by-customer", ""); w.Code != http.StatusOK {
+		t.Errorf("delete: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", "/_transform/by-customer", ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete missing transform: expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
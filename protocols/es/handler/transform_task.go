@@ -0,0 +1,473 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/search/dsl"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// transform 状态（与 ES 的 state 一致）
+const (
+	transformStateStarted  = "started"
+	transformStateIndexing = "indexing"
+	transformStateStopping = "stopping"
+	transformStateStopped  = "stopped"
+	transformStateFailed   = "failed"
+)
+
+// transformStats transform 统计（GET _transform/{id}/_stats 的 stats）
+type transformStats struct {
+	PagesProcessed     int64 `json:"pages_processed"`
+	DocumentsProcessed int64 `json:"documents_processed"`
+	DocumentsIndexed   int64 `json:"documents_indexed"`
+	DocumentsDeleted   int64 `json:"documents_deleted"`
+	TriggerCount       int64 `json:"trigger_count"`
+	IndexTimeInMs      int64 `json:"index_time_in_ms"`
+	IndexTotal         int64 `json:"index_total"`
+	IndexFailures      int64 `json:"index_failures"`
+	SearchTimeInMs     int64 `json:"search_time_in_ms"`
+	SearchTotal        int64 `json:"search_total"`
+	SearchFailures     int64 `json:"search_failures"`
+	ProcessingTimeInMs int64 `json:"processing_time_in_ms"`
+	ProcessingTotal    int64 `json:"processing_total"`
+}
+
+// transformTask 已创建的 transform 及其运行状态
+type transformTask struct {
+	config    *TransformConfig
+	pivot     *transformPivot
+	createdAt time.Time
+
+	mutex               sync.Mutex
+	state               string
+	reason              string // 失败原因
+	stats               transformStats
+	checkpoint          int64
+	checkpointTime      *time.Time
+	timeUpperBound      *time.Time // 连续模式下已处理到的同步字段上界（不含）
+	changesLastDetected *time.Time
+	lastSearchTime      *time.Time
+	cancel              context.CancelFunc
+	done                chan struct{}
+}
+
+// newTransformTask 根据已校验的配置创建 transform
+func newTransformTask(config *TransformConfig, createdAt time.Time) (*transformTask, error) {
+	pivot, apiErr := compileTransformPivot(config.Pivot)
+	if apiErr != nil {
+		return nil, fmt.Errorf("%s", apiErr.Error())
+	}
+	return &transformTask{
+		config:    config,
+		pivot:     pivot,
+		createdAt: createdAt,
+		state:     transformStateStopped,
+	}, nil
+}
+
+// continuous 是否为连续 transform（配置了 sync）
+func (t *transformTask) continuous() bool {
+	return t.config.Sync != nil
+}
+
+// transformBucket 一个分组的聚合中间结果
+type transformBucket struct {
+	key     []interface{}
+	aggs    []*transformAggState
+	changed bool // 连续模式下本检查点内有新文档
+}
+
+// transformScanRange 一次计算使用的同步字段范围：[from, to)，零值表示不限
+type transformScanRange struct {
+	from, to time.Time
+}
+
+// sourceIndices 解析 source.index（支持通配符）对应的源索引，排除目标索引
+func (h *TransformHandler) sourceIndices(config *TransformConfig) []string {
+	allIndices, err := h.dirMgr.ListIndices()
+	if err != nil {
+		return nil
+	}
+	var indices []string
+	seen := make(map[string]bool)
+	for _, pattern := range config.Source.Index {
+		for _, name := range allIndices {
+			if seen[name] || name == config.Dest.Index {
+				continue
+			}
+			if name == pattern || (strings.Contains(pattern, "*") && simpleWildcardMatch(pattern, name)) {
+				seen[name] = true
+				indices = append(indices, name)
+			}
+		}
+	}
+	sort.Strings(indices)
+	return indices
+}
+
+// sourceFieldTypes 返回源索引 mapping 中的字段类型
+func (h *TransformHandler) sourceFieldTypes(indices []string) map[string]string {
+	types := make(map[string]string)
+	for _, name := range indices {
+		meta, err := h.metaStore.GetIndexMetadata(name)
+		if err != nil || meta == nil {
+			continue
+		}
+		if props, ok := meta.Mapping["properties"].(map[string]interface{}); ok {
+			collectFieldTypes(props, "", types)
+		}
+	}
+	return types
+}
+
+// computePivot 遍历源索引计算所有分组；连续模式下只统计同步字段小于 scan.to 的文档，
+// 并把包含 [scan.from, scan.to) 内文档的分组标记为已变化
+func (h *TransformHandler) computePivot(ctx context.Context, config *TransformConfig, pivot *transformPivot, scan transformScanRange) (map[string]*transformBucket, int64, error) {
+	buckets := make(map[string]*transformBucket)
+	var docs int64
+	for _, name := range h.sourceIndices(config) {
+		idx, err := h.docHandler.indexMgr.GetIndex(name)
+		if err != nil {
+			return nil, docs, fmt.Errorf("failed to get index [%s]: %w", name, err)
+		}
+		var q query.Query = bleve.NewMatchAllQuery()
+		if config.Source.Query != nil {
+			parser := dsl.NewQueryParser()
+			if aliases := h.docHandler.fieldAliasesForIndex(name); aliases != nil {
+				parser.SetFieldAliases(aliases)
+			}
+			if q, err = parser.ParseQuery(config.Source.Query); err != nil {
+				return nil, docs, fmt.Errorf("failed to parse source query: %w", err)
+			}
+		}
+		err = h.docHandler.scanIndexSourcesWithQuery(ctx, idx, name, q, func(source map[string]interface{}) error {
+			changed := true
+			if config.Sync != nil {
+				ts, ok := rollupDateValue(firstSourceValue(source, config.Sync.Time.Field))
+				if !ok || (!scan.to.IsZero() && !ts.Before(scan.to)) {
+					return nil
+				}
+				changed = scan.from.IsZero() || !ts.Before(scan.from)
+			}
+			keys := pivot.bucketKeys(source)
+			if len(keys) == 0 {
+				return nil
+			}
+			docs++
+			for _, key := range keys {
+				keyJSON, _ := json.Marshal(key)
+				b, ok := buckets[string(keyJSON)]
+				if !ok {
+					b = &transformBucket{key: key, aggs: make([]*transformAggState, len(pivot.aggs))}
+					for i := range b.aggs {
+						b.aggs[i] = &transformAggState{}
+					}
+					buckets[string(keyJSON)] = b
+				}
+				b.changed = b.changed || changed
+				for i, agg := range pivot.aggs {
+					b.aggs[i].add(agg, source)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, docs, fmt.Errorf("failed to search index [%s]: %w", name, err)
+		}
+	}
+	return buckets, docs, nil
+}
+
+// sortedBucketKeys 返回按分组键排序的键
+func sortedBucketKeys(buckets map[string]*transformBucket) []string {
+	keys := make([]string, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// bucketDoc 构建分组在目标索引中的文档
+func (p *transformPivot) bucketDoc(b *transformBucket) map[string]interface{} {
+	doc := make(map[string]interface{})
+	for i, g := range p.groups {
+		if b.key[i] != nil {
+			setDottedField(doc, g.name, b.key[i])
+		}
+	}
+	for i, agg := range p.aggs {
+		if v := b.aggs[i].value(agg.kind); v != nil {
+			setDottedField(doc, agg.name, v)
+		}
+	}
+	return doc
+}
+
+// transformDocID 目标文档 ID：transform ID 与分组键的哈希，重复计算同一分组时覆盖旧文档
+func transformDocID(id, key string) string {
+	h := fnv.New128a()
+	h.Write([]byte(id))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// transformDestMeta 目标索引 mapping 的 _meta（与 ES 一致，标记由 transform 创建）
+func transformDestMeta(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"_transform": map[string]interface{}{
+			"transform":               id,
+			"version":                 map[string]interface{}{"created": ESVersion()},
+			"creation_date_in_millis": time.Now().UnixMilli(),
+		},
+		"created_by": "transform",
+	}
+}
+
+// ensureDestIndex 目标索引不存在时按推断的 mapping 创建
+func (h *TransformHandler) ensureDestIndex(task *transformTask) error {
+	config := task.config
+	if h.dirMgr.IndexExists(config.Dest.Index) {
+		return nil
+	}
+	mapping := map[string]interface{}{
+		"_meta":      transformDestMeta(config.ID),
+		"properties": task.pivot.destMapping(h.sourceFieldTypes(h.sourceIndices(config))),
+	}
+	if apiErr := h.indexHandler.createIndex(config.Dest.Index, mapping, map[string]interface{}{}, nil, nil, nil); apiErr != nil {
+		if h.dirMgr.IndexExists(config.Dest.Index) {
+			return nil
+		}
+		return fmt.Errorf("failed to create destination index [%s]: %s", config.Dest.Index, apiErr.Error())
+	}
+	return nil
+}
+
+// runCheckpoint 执行一个检查点：批量 transform 处理所有文档；连续 transform 只重新计算
+// 自上一个检查点以来有新文档的分组，没有变化时不产生新的检查点
+func (h *TransformHandler) runCheckpoint(ctx context.Context, task *transformTask) error {
+	start := time.Now()
+	task.mutex.Lock()
+	var scan transformScanRange
+	if task.timeUpperBound != nil {
+		scan.from = *task.timeUpperBound
+	}
+	task.mutex.Unlock()
+	if task.continuous() {
+		scan.to = start.Add(-task.config.syncDelay())
+		if !scan.from.IsZero() && !scan.to.After(scan.from) {
+			return nil
+		}
+	}
+
+	if err := h.ensureDestIndex(task); err != nil {
+		return err
+	}
+
+	searchStart := time.Now()
+	buckets, docs, err := h.computePivot(ctx, task.config, task.pivot, scan)
+	task.mutex.Lock()
+	task.stats.SearchTotal++
+	task.stats.SearchTimeInMs += time.Since(searchStart).Milliseconds()
+	task.stats.DocumentsProcessed += docs
+	searchTime := time.Now()
+	task.lastSearchTime = &searchTime
+	if err != nil {
+		task.stats.SearchFailures++
+	}
+	task.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, key := range sortedBucketKeys(buckets) {
+		if buckets[key].changed {
+			keys = append(keys, key)
+		}
+	}
+	if task.continuous() && len(keys) == 0 && !scan.from.IsZero() {
+		return nil
+	}
+
+	if len(keys) > 0 {
+		destIdx, err := h.docHandler.indexMgr.GetIndex(task.config.Dest.Index)
+		if err != nil {
+			return fmt.Errorf("failed to get destination index [%s]: %w", task.config.Dest.Index, err)
+		}
+		pageSize := task.config.pageSize()
+		for pageStart := 0; pageStart < len(keys); pageStart += pageSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			pageEnd := pageStart + pageSize
+			if pageEnd > len(keys) {
+				pageEnd = len(keys)
+			}
+			items := make([]BulkRequest, 0, pageEnd-pageStart)
+			for _, key := range keys[pageStart:pageEnd] {
+				items = append(items, BulkRequest{
+					Action: "index",
+					Index:  task.config.Dest.Index,
+					ID:     transformDocID(task.config.ID, key),
+					Source: task.pivot.bucketDoc(buckets[key]),
+				})
+			}
+			indexStart := time.Now()
+			results := h.docHandler.executeBulkOperationsBatch(destIdx, task.config.Dest.Index, items)
+			var failures int64
+			for _, result := range results {
+				for _, item := range result {
+					if m, ok := item.(map[string]interface{}); ok && m["error"] != nil {
+						failures++
+					}
+				}
+			}
+			task.mutex.Lock()
+			task.stats.PagesProcessed++
+			task.stats.IndexTotal++
+			task.stats.IndexTimeInMs += time.Since(indexStart).Milliseconds()
+			task.stats.DocumentsIndexed += int64(len(items)) - failures
+			task.stats.IndexFailures += failures
+			task.mutex.Unlock()
+			if failures > 0 {
+				return fmt.Errorf("failed to index %d documents into [%s]", failures, task.config.Dest.Index)
+			}
+		}
+	}
+
+	now := time.Now()
+	task.mutex.Lock()
+	task.checkpoint++
+	task.checkpointTime = &now
+	if task.continuous() {
+		upper := scan.to
+		task.timeUpperBound = &upper
+	}
+	if len(keys) > 0 {
+		task.changesLastDetected = &now
+	}
+	task.stats.ProcessingTotal++
+	task.stats.ProcessingTimeInMs += time.Since(start).Milliseconds()
+	task.mutex.Unlock()
+	if err := h.saveTask(task); err != nil {
+		logger.Error("Failed to save checkpoint of transform [%s]: %v", task.config.ID, err)
+	}
+	return nil
+}
+
+// startTask 启动 transform 的后台调度：立即执行一次检查点，批量 transform 完成后自动停止，
+// 连续 transform 之后按 frequency 检查变化（调用方持有 task.mutex）
+func (h *TransformHandler) startTask(task *transformTask) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	task.state = transformStateStarted
+	task.reason = ""
+	task.cancel = cancel
+	task.done = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(task.config.frequency())
+		defer ticker.Stop()
+		for {
+			task.mutex.Lock()
+			if task.state != transformStateStarted {
+				task.mutex.Unlock()
+				break
+			}
+			task.state = transformStateIndexing
+			task.stats.TriggerCount++
+			task.mutex.Unlock()
+
+			err := h.runCheckpoint(ctx, task)
+
+			task.mutex.Lock()
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Transform [%s] failed: %v", task.config.ID, err)
+				task.state = transformStateFailed
+				task.reason = err.Error()
+				task.mutex.Unlock()
+				return
+			}
+			if task.state == transformStateIndexing {
+				task.state = transformStateStarted
+			}
+			batchDone := !task.continuous() && task.state == transformStateStarted
+			task.mutex.Unlock()
+
+			if batchDone {
+				// 批量 transform 完成后自动停止
+				task.mutex.Lock()
+				task.state = transformStateStopped
+				task.mutex.Unlock()
+				if err := h.saveTask(task); err != nil {
+					logger.Error("Failed to save state of transform [%s]: %v", task.config.ID, err)
+				}
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				task.mutex.Lock()
+				task.state = transformStateStopped
+				task.mutex.Unlock()
+				return
+			case <-ticker.C:
+			}
+		}
+		task.mutex.Lock()
+		if task.state == transformStateStopping {
+			task.state = transformStateStopped
+		}
+		task.mutex.Unlock()
+	}()
+}
+
+// stopTask 停止 transform，返回等待后台调度退出的通道（未运行时为 nil）
+func (t *transformTask) stopTask() <-chan struct{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.cancel == nil {
+		t.state = transformStateStopped
+		return nil
+	}
+	switch t.state {
+	case transformStateStopped:
+		return nil
+	case transformStateFailed:
+		t.cancel()
+		t.state = transformStateStopped
+		t.reason = ""
+		return nil
+	}
+	t.state = transformStateStopping
+	t.cancel()
+	return t.done
+}
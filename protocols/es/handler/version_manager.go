@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"hash/fnv"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -44,6 +45,9 @@ type VersionManager struct {
 
 	// 读写锁保护versions map
 	mutex sync.RWMutex
+
+	// 文档写锁（按索引与文档ID分片），保证 update 的版本校验与写入不被并发写入打断
+	docLocks [64]sync.Mutex
 }
 
 // NewVersionManager 创建版本管理器
@@ -150,7 +154,8 @@ func (vm *VersionManager) CreateVersion(indexName, docID string) *DocumentVersio
 }
 
 // DeleteVersion 删除文档版本（用于删除操作）
-// 返回删除前的版本信息（如果存在）
+// 与 ES 一致，删除本身也是一次写操作：返回版本号加 1 并分配新序列号的删除版本信息
+// 文档版本不存在时返回 nil
 func (vm *VersionManager) DeleteVersion(indexName, docID string) *DocumentVersion {
 	vm.mutex.Lock()
 	defer vm.mutex.Unlock()
@@ -173,12 +178,34 @@ func (vm *VersionManager) DeleteVersion(indexName, docID string) *DocumentVersio
 		delete(vm.versions, indexName)
 	}
 
-	// 返回删除前的版本信息副本
 	return &DocumentVersion{
-		Version:     version.Version,
-		SeqNo:       version.SeqNo,
+		Version:     version.Version + 1,
+		SeqNo:       atomic.AddInt64(&vm.globalSeqNo, 1),
 		PrimaryTerm: version.PrimaryTerm,
-		UpdatedAt:   version.UpdatedAt,
+		UpdatedAt:   time.Now(),
+	}
+}
+
+// LockDocument 锁定文档的写入，返回解锁函数
+// 不同文档可能共用同一把锁，持有期间不能再锁定其他文档
+func (vm *VersionManager) LockDocument(indexName, docID string) func() {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(indexName))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(docID))
+	lock := &vm.docLocks[h.Sum32()%uint32(len(vm.docLocks))]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// NotFoundVersion 返回删除不存在文档时的版本信息
+// ES 对 not_found 的删除同样分配序列号，版本号为 1
+func (vm *VersionManager) NotFoundVersion() *DocumentVersion {
+	return &DocumentVersion{
+		Version:     1,
+		SeqNo:       atomic.AddInt64(&vm.globalSeqNo, 1),
+		PrimaryTerm: vm.primaryTerm,
+		UpdatedAt:   time.Now(),
 	}
 }
 
@@ -0,0 +1,577 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+)
+
+// webhookResponseBodyLimit 记录在 watch 结果中的 webhook 响应体最大长度
+const webhookResponseBodyLimit = 64 * 1024
+
+// watchEntry 已加载的 watch
+type watchEntry struct {
+	id      string
+	def     *watchDefinition
+	watch   *metadata.Watch // 读写 watch.Status 时持有 WatcherHandler.mutex，Status 只整体替换不原地修改
+	nextRun time.Time
+	running bool       // 调度触发的执行尚未结束
+	execMu  sync.Mutex // 串行化同一 watch 的执行（调度触发与 _execute）
+}
+
+// watchTriggerEvent 触发事件
+type watchTriggerEvent struct {
+	kind          string // schedule、manual
+	triggeredTime time.Time
+	scheduledTime time.Time
+}
+
+// watchExecutionOptions _execute 的执行选项（调度触发时只设置 recordExecution）
+type watchExecutionOptions struct {
+	ignoreCondition  bool
+	recordExecution  bool                   // 是否保存执行后的状态（影响后续的限流）
+	actionModes      map[string]string      // action 名称或 _all -> execute、force_execute、simulate、force_simulate、skip
+	alternativeInput map[string]interface{} // 替代 input 的 payload
+}
+
+// actionMode 返回 action 的执行模式
+func (o watchExecutionOptions) actionMode(name string) string {
+	if mode, ok := o.actionModes[name]; ok {
+		return mode
+	}
+	if mode, ok := o.actionModes["_all"]; ok {
+		return mode
+	}
+	return "execute"
+}
+
+// cloneWatchStatus 复制 watch 状态，执行过程中修改副本，结束后整体替换
+func cloneWatchStatus(status *metadata.WatchStatus) *metadata.WatchStatus {
+	rv := *status
+	rv.Actions = make(map[string]*metadata.WatchActionStatus, len(status.Actions))
+	for name, action := range status.Actions {
+		a := *action
+		rv.Actions[name] = &a
+	}
+	return &rv
+}
+
+// watchStatusResponse 返回 ES 格式的 watch 状态
+func watchStatusResponse(status *metadata.WatchStatus, version int64) map[string]interface{} {
+	rv := map[string]interface{}{
+		"state": map[string]interface{}{
+			"active":    status.Active,
+			"timestamp": formatDateValue(status.StateTimestamp, ""),
+		},
+		"version": version,
+	}
+	if status.LastChecked != nil {
+		rv["last_checked"] = formatDateValue(*status.LastChecked, "")
+	}
+	if status.LastMetCondition != nil {
+		rv["last_met_condition"] = formatDateValue(*status.LastMetCondition, "")
+	}
+	if status.ExecutionState != "" {
+		rv["execution_state"] = status.ExecutionState
+	}
+	actions := make(map[string]interface{}, len(status.Actions))
+	for name, action := range status.Actions {
+		a := make(map[string]interface{})
+		if action.LastExecution != nil {
+			execution := map[string]interface{}{
+				"timestamp":  formatDateValue(*action.LastExecution, ""),
+				"successful": action.LastExecutionSuccessful,
+			}
+			if action.LastExecutionReason != "" {
+				execution["reason"] = action.LastExecutionReason
+			}
+			a["last_execution"] = execution
+		}
+		if action.LastSuccessfulExecution != nil {
+			a["last_successful_execution"] = map[string]interface{}{
+				"timestamp":  formatDateValue(*action.LastSuccessfulExecution, ""),
+				"successful": true,
+			}
+		}
+		if action.LastThrottle != nil {
+			a["last_throttle"] = map[string]interface{}{
+				"timestamp": formatDateValue(*action.LastThrottle, ""),
+				"reason":    action.LastThrottleReason,
+			}
+		}
+		actions[name] = a
+	}
+	rv["actions"] = actions
+	return rv
+}
+
+// executeWatch 执行一次 watch：读取 input、判断 condition、依次执行 action，返回 watch 记录
+func (h *WatcherHandler) executeWatch(ctx context.Context, entry *watchEntry, event watchTriggerEvent, opts watchExecutionOptions) map[string]interface{} {
+	entry.execMu.Lock()
+	defer entry.execMu.Unlock()
+
+	start := time.Now().UTC()
+	h.mutex.Lock()
+	status := cloneWatchStatus(entry.watch.Status)
+	version := entry.watch.Version
+	h.mutex.Unlock()
+
+	// watch 在创建它的租户下执行，input 与 index action 的索引名按该租户加前缀
+	ctx = middleware.WithTenant(ctx, entry.watch.Tenant)
+
+	def := entry.def
+	execCtx := map[string]interface{}{
+		"watch_id":       entry.id,
+		"execution_time": formatDateValue(start, ""),
+		"trigger": map[string]interface{}{
+			"triggered_time": formatDateValue(event.triggeredTime, ""),
+			"scheduled_time": formatDateValue(event.scheduledTime, ""),
+		},
+		"metadata": def.metadata,
+		"payload":  map[string]interface{}{},
+		"vars":     map[string]interface{}{},
+	}
+	model := map[string]interface{}{"ctx": execCtx}
+
+	triggerEvent := map[string]interface{}{
+		"type":           event.kind,
+		"triggered_time": formatDateValue(event.triggeredTime, ""),
+	}
+	if event.kind == "schedule" {
+		triggerEvent["schedule"] = map[string]interface{}{"scheduled_time": formatDateValue(event.scheduledTime, "")}
+	}
+	result := map[string]interface{}{
+		"execution_time": formatDateValue(start, ""),
+	}
+	messages := []string{}
+	record := map[string]interface{}{
+		"watch_id":      entry.id,
+		"node":          NodeName,
+		"trigger_event": triggerEvent,
+		"input":         entry.watch.Source["input"],
+		"condition":     def.condition.conditionSource(),
+		"result":        result,
+	}
+	if def.metadata != nil {
+		record["metadata"] = def.metadata
+	}
+
+	var state string
+	status.LastChecked = &start
+
+	inputKind := def.input.kind
+	if opts.alternativeInput != nil {
+		inputKind = "simple"
+	}
+	inputResult := map[string]interface{}{"type": inputKind}
+	payload, err := h.runWatchInput(ctx, def.input, opts.alternativeInput)
+	if err != nil {
+		inputResult["status"] = "failure"
+		inputResult["reason"] = err.Error()
+		messages = append(messages, fmt.Sprintf("failed to execute watch input: %s", err.Error()))
+		state = "failed"
+	} else {
+		inputResult["status"] = "success"
+		inputResult["payload"] = payload
+		execCtx["payload"] = payload
+	}
+	result["input"] = inputResult
+
+	if state == "" {
+		condition := def.condition
+		if opts.ignoreCondition {
+			condition = &watchCondition{kind: "always"}
+		}
+		conditionResult := map[string]interface{}{"type": condition.kind}
+		met, err := condition.evaluate(model)
+		if err != nil {
+			conditionResult["status"] = "failure"
+			conditionResult["reason"] = err.Error()
+			messages = append(messages, fmt.Sprintf("failed to execute watch condition: %s", err.Error()))
+			state = "failed"
+		} else {
+			conditionResult["status"] = "success"
+			conditionResult["met"] = met
+			if !met {
+				state = "execution_not_needed"
+			}
+		}
+		result["condition"] = conditionResult
+	}
+
+	if state == "" {
+		status.LastMetCondition = &start
+		actions := make([]interface{}, 0, len(def.actions))
+		throttled := len(def.actions) > 0
+		for _, action := range def.actions {
+			actionResult := h.runWatchAction(ctx, entry.id, def, action, model, status, start, opts.actionMode(action.name))
+			if actionResult["status"] != "throttled" {
+				throttled = false
+			}
+			actions = append(actions, actionResult)
+		}
+		result["actions"] = actions
+		state = "executed"
+		if throttled {
+			state = "throttled"
+		}
+	}
+
+	status.ExecutionState = state
+	result["execution_duration"] = time.Since(start).Milliseconds()
+	record["state"] = state
+	record["messages"] = messages
+	record["status"] = watchStatusResponse(status, version)
+
+	if opts.recordExecution {
+		h.commitWatchStatus(entry, status)
+	}
+	return record
+}
+
+// commitWatchStatus 保存执行后的状态；watch 在执行期间被替换或删除时丢弃
+func (h *WatcherHandler) commitWatchStatus(entry *watchEntry, status *metadata.WatchStatus) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.watches[entry.id] != entry {
+		return
+	}
+	// 执行期间可能被激活或停用，以当前的激活状态为准
+	status.Active = entry.watch.Status.Active
+	status.StateTimestamp = entry.watch.Status.StateTimestamp
+	watch := *entry.watch
+	watch.Status = status
+	if err := h.metaStore.SaveWatch(entry.id, &watch); err != nil {
+		logger.Error("Failed to save status of watch [%s]: %v", entry.id, err)
+	}
+	entry.watch = &watch
+}
+
+// runWatchInput 读取 input 的 payload
+func (h *WatcherHandler) runWatchInput(ctx context.Context, input *watchInput, alternative map[string]interface{}) (map[string]interface{}, error) {
+	if alternative != nil {
+		return copyWatchPayload(alternative)
+	}
+	switch input.kind {
+	case "simple":
+		return copyWatchPayload(input.payload)
+	case "search":
+		resp := h.docHandler.executeSingleMultiSearch(ctx, MultiSearchRequest{
+			Header: map[string]interface{}{"index": tenantIndexPrefix(ctx) + input.index},
+			Body:   input.body,
+		})
+		if errInfo, ok := resp["error"].(map[string]interface{}); ok {
+			return nil, fmt.Errorf("[%v] %v", errInfo["type"], errInfo["reason"])
+		}
+		payload, err := copyWatchPayload(resp)
+		if err != nil {
+			return nil, err
+		}
+		// 与 ES 的 watcher 一致，search input 的 hits.total 为数字
+		if hits, ok := payload["hits"].(map[string]interface{}); ok {
+			if total, ok := hits["total"].(map[string]interface{}); ok {
+				hits["total"] = total["value"]
+			}
+		}
+		return payload, nil
+	}
+	return map[string]interface{}{}, nil
+}
+
+// copyWatchPayload 通过 JSON 复制 payload，统一为 map/[]interface{}/float64 等基本类型
+func copyWatchPayload(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	payload := make(map[string]interface{})
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// runWatchAction 执行单个 action 并更新 status 中该 action 的记录
+func (h *WatcherHandler) runWatchAction(ctx context.Context, watchID string, def *watchDefinition, action *watchAction, model map[string]interface{}, status *metadata.WatchStatus, now time.Time, mode string) map[string]interface{} {
+	rv := map[string]interface{}{"id": action.name, "type": action.kind}
+	actionStatus := status.Actions[action.name]
+	if actionStatus == nil {
+		actionStatus = &metadata.WatchActionStatus{}
+		status.Actions[action.name] = actionStatus
+	}
+
+	if action.condition != nil {
+		met, err := action.condition.evaluate(model)
+		if err != nil {
+			rv["status"] = "failure"
+			rv["reason"] = fmt.Sprintf("failed to execute action condition: %s", err.Error())
+			return rv
+		}
+		rv["condition"] = map[string]interface{}{"type": action.condition.kind, "status": "success", "met": met}
+		if !met {
+			rv["status"] = "condition_failed"
+			rv["reason"] = "condition not met. skipping"
+			return rv
+		}
+	}
+
+	throttle := func(reason string) map[string]interface{} {
+		actionStatus.LastThrottle = &now
+		actionStatus.LastThrottleReason = reason
+		rv["status"] = "throttled"
+		rv["reason"] = reason
+		return rv
+	}
+	switch mode {
+	case "skip":
+		return throttle("manually skipped")
+	case "execute", "simulate":
+		period := action.throttlePeriod
+		if period < 0 {
+			period = def.throttlePeriod
+		}
+		if last := actionStatus.LastSuccessfulExecution; period > 0 && last != nil && now.Sub(*last) < period {
+			return throttle(fmt.Sprintf("throttling interval is set to [%s] but time elapsed since last execution is [%s]", period, now.Sub(*last).Round(time.Millisecond)))
+		}
+	case "force_execute", "force_simulate":
+	default:
+		rv["status"] = "failure"
+		rv["reason"] = fmt.Sprintf("unknown action mode [%s]", mode)
+		return rv
+	}
+
+	simulate := mode == "simulate" || mode == "force_simulate"
+	output, err := h.performWatchAction(ctx, watchID, action, model, now, simulate)
+	for k, v := range output {
+		rv[k] = v
+	}
+	if simulate {
+		rv["status"] = "simulated"
+		return rv
+	}
+	actionStatus.LastExecution = &now
+	if err != nil {
+		logger.Warn("Watch [%s] action [%s] failed: %v", watchID, action.name, err)
+		rv["status"] = "failure"
+		rv["reason"] = err.Error()
+		actionStatus.LastExecutionSuccessful = false
+		actionStatus.LastExecutionReason = err.Error()
+		return rv
+	}
+	rv["status"] = "success"
+	actionStatus.LastExecutionSuccessful = true
+	actionStatus.LastExecutionReason = ""
+	actionStatus.LastSuccessfulExecution = &now
+	return rv
+}
+
+// performWatchAction 执行 action 本身，返回写入 watch 记录的结果（以 action 类型为键）
+func (h *WatcherHandler) performWatchAction(ctx context.Context, watchID string, action *watchAction, model map[string]interface{}, now time.Time, simulate bool) (map[string]interface{}, error) {
+	switch action.kind {
+	case "logging":
+		text, err := renderWatchTemplate(action.text, model)
+		if err != nil {
+			return nil, err
+		}
+		if !simulate {
+			switch action.level {
+			case "error":
+				logger.Error("[watch:%s] %s", watchID, text)
+			case "warn":
+				logger.Warn("[watch:%s] %s", watchID, text)
+			case "debug", "trace":
+				logger.Debug("[watch:%s] %s", watchID, text)
+			default:
+				logger.Info("[watch:%s] %s", watchID, text)
+			}
+		}
+		return map[string]interface{}{"logging": map[string]interface{}{"logged_text": text}}, nil
+	case "webhook":
+		return h.performWebhookAction(ctx, action.webhook, model, simulate)
+	case "index":
+		return h.performIndexAction(ctx, action, model, now, simulate)
+	}
+	return nil, fmt.Errorf("unsupported action type [%s]", action.kind)
+}
+
+// performWebhookAction 渲染并发送 webhook 请求，非 2xx 响应视为失败
+func (h *WatcherHandler) performWebhookAction(ctx context.Context, tmpl *webhookTemplate, model map[string]interface{}, simulate bool) (map[string]interface{}, error) {
+	path, err := renderWatchTemplate(tmpl.path, model)
+	if err != nil {
+		return nil, err
+	}
+	body, err := renderWatchTemplate(tmpl.body, model)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	for k, v := range tmpl.params {
+		rendered, err := renderWatchTemplate(v, model)
+		if err != nil {
+			return nil, err
+		}
+		params.Set(k, rendered)
+	}
+	headers := make(map[string]interface{}, len(tmpl.headers))
+	for k, v := range tmpl.headers {
+		rendered, err := renderWatchTemplate(v, model)
+		if err != nil {
+			return nil, err
+		}
+		headers[k] = rendered
+	}
+
+	requestInfo := map[string]interface{}{
+		"host":   tmpl.host,
+		"port":   tmpl.port,
+		"scheme": tmpl.scheme,
+		"method": strings.ToLower(tmpl.method),
+		"path":   path,
+	}
+	if len(params) > 0 {
+		requestInfo["params"] = params
+	}
+	if len(headers) > 0 {
+		requestInfo["headers"] = headers
+	}
+	if body != "" {
+		requestInfo["body"] = body
+	}
+	output := map[string]interface{}{"webhook": map[string]interface{}{"request": requestInfo}}
+	if simulate {
+		return output, nil
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	target := url.URL{
+		Scheme:   tmpl.scheme,
+		Host:     tmpl.host + ":" + strconv.Itoa(tmpl.port),
+		Path:     path,
+		RawQuery: params.Encode(),
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, tmpl.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, tmpl.method, target.String(), strings.NewReader(body))
+	if err != nil {
+		return output, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v.(string))
+	}
+	if tmpl.username != "" {
+		req.SetBasicAuth(tmpl.username, tmpl.password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return output, fmt.Errorf("failed to send webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseBodyLimit))
+	output["webhook"].(map[string]interface{})["response"] = map[string]interface{}{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return output, fmt.Errorf("received [%d] status code", resp.StatusCode)
+	}
+	return output, nil
+}
+
+// performIndexAction 把 payload 写入索引（payload._doc 为数组时每个元素写入一个文档），索引不存在时自动创建
+func (h *WatcherHandler) performIndexAction(ctx context.Context, action *watchAction, model map[string]interface{}, now time.Time, simulate bool) (map[string]interface{}, error) {
+	payload, _ := model["ctx"].(map[string]interface{})["payload"].(map[string]interface{})
+	var docs []map[string]interface{}
+	if items, ok := payload["_doc"].([]interface{}); ok {
+		for _, item := range items {
+			doc, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("could not execute action: [_doc] must be an array of objects")
+			}
+			docs = append(docs, doc)
+		}
+	} else {
+		doc, err := copyWatchPayload(payload)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	docID, err := renderWatchTemplate(action.docID, model)
+	if err != nil {
+		return nil, err
+	}
+	if docID != "" && len(docs) > 1 {
+		return nil, fmt.Errorf("could not execute action: [doc_id] cannot be used with a [_doc] array")
+	}
+	if action.executionTimeField != "" {
+		for _, doc := range docs {
+			doc[action.executionTimeField] = formatDateValue(now, "")
+		}
+	}
+	if simulate {
+		return map[string]interface{}{"index": map[string]interface{}{
+			"request": map[string]interface{}{"index": action.index, "doc_id": docID, "source": docs},
+		}}, nil
+	}
+
+	index := tenantIndexPrefix(ctx) + action.index
+	if !h.dirMgr.IndexExists(index) {
+		if apiErr := h.indexHandler.createIndex(index, map[string]interface{}{}, map[string]interface{}{}, nil, nil, nil); apiErr != nil && !h.dirMgr.IndexExists(index) {
+			return nil, fmt.Errorf("failed to create index [%s]: %s", index, apiErr.Error())
+		}
+	}
+	idx, err := h.docHandler.indexMgr.GetIndex(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index [%s]: %w", index, err)
+	}
+	items := make([]BulkRequest, 0, len(docs))
+	for _, doc := range docs {
+		items = append(items, BulkRequest{Action: "index", Index: index, ID: docID, Source: doc})
+	}
+	responses := make([]interface{}, 0, len(items))
+	var failure error
+	for _, result := range h.docHandler.executeBulkOperationsBatch(idx, index, items) {
+		item, _ := result["index"].(map[string]interface{})
+		if errInfo, ok := item["error"].(map[string]interface{}); ok && failure == nil {
+			failure = fmt.Errorf("failed to index document into [%s]: %v", index, errInfo["reason"])
+		}
+		responses = append(responses, map[string]interface{}{
+			"index":   index,
+			"id":      item["_id"],
+			"result":  item["result"],
+			"version": item["_version"],
+		})
+	}
+	var response interface{} = responses
+	if len(responses) == 1 {
+		response = responses[0]
+	}
+	return map[string]interface{}{"index": map[string]interface{}{"response": response}}, failure
+}
@@ -0,0 +1,483 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+)
+
+// watcherTickInterval 调度器检查到期 watch 的间隔
+var watcherTickInterval = time.Second
+
+// WatcherHandler _watcher API 处理器：watch 保存在元数据存储中，由进程内的调度器按 interval 触发执行
+type WatcherHandler struct {
+	indexHandler *IndexHandler
+	docHandler   *DocumentHandler
+	dirMgr       directory.DirectoryManager
+	metaStore    metadata.MetadataStore
+	watches      map[string]*watchEntry
+	mutex        sync.Mutex
+
+	ctx       context.Context // Close 时取消，中止正在执行的 webhook 等请求
+	cancel    context.CancelFunc
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup // 调度触发的执行
+}
+
+// NewWatcherHandler 创建 watcher 处理器，从元数据存储加载 watch 并启动调度器
+func NewWatcherHandler(indexHandler *IndexHandler, docHandler *DocumentHandler) *WatcherHandler {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &WatcherHandler{
+		indexHandler: indexHandler,
+		docHandler:   docHandler,
+		dirMgr:       docHandler.dirMgr,
+		metaStore:    docHandler.metaStore,
+		watches:      make(map[string]*watchEntry),
+		ctx:          ctx,
+		cancel:       cancel,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	watches, err := h.metaStore.ListWatches()
+	if err != nil {
+		logger.Error("Failed to list watches: %v", err)
+	}
+	now := time.Now()
+	for _, watch := range watches {
+		def, apiErr := parseWatch(watch.ID, watch.Source)
+		if apiErr != nil {
+			logger.Error("Failed to load watch [%s]: %v", watch.ID, apiErr)
+			continue
+		}
+		if watch.Status == nil {
+			watch.Status = &metadata.WatchStatus{Active: true, StateTimestamp: now}
+		}
+		h.watches[watch.ID] = &watchEntry{id: watch.ID, def: def, watch: watch, nextRun: now.Add(def.interval)}
+	}
+	go h.run()
+	return h
+}
+
+// Close 停止调度器并等待正在执行的 watch 结束
+func (h *WatcherHandler) Close() {
+	h.closeOnce.Do(func() {
+		close(h.stop)
+		h.cancel()
+		<-h.done
+		h.wg.Wait()
+	})
+}
+
+// run 调度循环
+func (h *WatcherHandler) run() {
+	defer close(h.done)
+	ticker := time.NewTicker(watcherTickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case now := <-ticker.C:
+			h.triggerDueWatches(now)
+		}
+	}
+}
+
+// triggerDueWatches 触发到期的激活 watch；上一次执行未结束的 watch 跳过本次触发
+func (h *WatcherHandler) triggerDueWatches(now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, entry := range h.watches {
+		if !entry.watch.Status.Active || entry.running || now.Before(entry.nextRun) {
+			continue
+		}
+		scheduled := entry.nextRun
+		entry.nextRun = scheduled.Add(entry.def.interval)
+		if !entry.nextRun.After(now) {
+			entry.nextRun = now.Add(entry.def.interval)
+		}
+		entry.running = true
+		h.wg.Add(1)
+		go func(entry *watchEntry, scheduled time.Time) {
+			defer h.wg.Done()
+			event := watchTriggerEvent{kind: "schedule", triggeredTime: time.Now().UTC(), scheduledTime: scheduled.UTC()}
+			h.executeWatch(h.ctx, entry, event, watchExecutionOptions{recordExecution: true})
+			h.mutex.Lock()
+			entry.running = false
+			h.mutex.Unlock()
+		}(entry, scheduled)
+	}
+}
+
+// newWatchNotFoundError 返回 watch 不存在错误
+func newWatchNotFoundError(id string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "resource_not_found_exception",
+		Message:    fmt.Sprintf("Watch with id [%s] does not exist", id),
+		HTTPStatus: http.StatusNotFound,
+		Code:       "WATCH_NOT_FOUND",
+	}
+}
+
+// readWatchBody 读取 JSON 请求体，空请求体返回 nil
+func readWatchBody(r *http.Request) (map[string]interface{}, common.APIError) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, common.NewRequestBodyError("failed to read request body", err)
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, common.NewRequestBodyError("failed to parse request body", err)
+	}
+	return body, nil
+}
+
+// writeWatcherResponse 写入 JSON 响应
+func writeWatcherResponse(w http.ResponseWriter, status int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("Failed to encode watcher response: %v", err)
+	}
+}
+
+// PutWatch 创建或替换 watch（替换时重置状态），active=false 时创建为停用状态
+// PUT /_watcher/watch/{id}
+func (h *WatcherHandler) PutWatch(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	body, apiErr := readWatchBody(r)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	if body == nil {
+		common.HandleError(w, common.NewBadRequestError("request body is required"))
+		return
+	}
+	def, apiErr := parseWatch(id, body)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+	active := true
+	if s := r.URL.Query().Get("active"); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			common.HandleError(w, common.NewBadRequestError(fmt.Sprintf("Failed to parse value [%s] as only [true] or [false] are allowed.", s)))
+			return
+		}
+		active = v
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	now := time.Now().UTC()
+	watch := &metadata.Watch{
+		ID:        id,
+		Tenant:    middleware.TenantFromContext(r.Context()),
+		Source:    body,
+		Status:    &metadata.WatchStatus{Active: active, StateTimestamp: now},
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	old, exists := h.watches[id]
+	if exists && !watchVisible(r.Context(), old) {
+		common.HandleError(w, common.NewConflictError(fmt.Sprintf("watch [%s] already exists", id)))
+		return
+	}
+	if exists {
+		watch.Version = old.watch.Version + 1
+		watch.CreatedAt = old.watch.CreatedAt
+	}
+	if err := h.metaStore.SaveWatch(id, watch); err != nil {
+		logger.Error("Failed to save watch [%s]: %v", id, err)
+		common.HandleError(w, common.NewInternalServerError("failed to save watch: "+err.Error()))
+		return
+	}
+	h.watches[id] = &watchEntry{id: id, def: def, watch: watch, nextRun: now.Add(def.interval)}
+
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	writeWatcherResponse(w, status, map[string]interface{}{
+		"_id":           id,
+		"_version":      watch.Version,
+		"_seq_no":       watch.Version - 1,
+		"_primary_term": 1,
+		"created":       !exists,
+	})
+}
+
+// GetWatch 获取 watch 定义与状态
+// GET /_watcher/watch/{id}
+func (h *WatcherHandler) GetWatch(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	h.mutex.Lock()
+	entry, ok := h.watches[id]
+	ok = ok && watchVisible(r.Context(), entry)
+	var watch metadata.Watch
+	if ok {
+		watch = *entry.watch
+	}
+	h.mutex.Unlock()
+	if !ok {
+		writeWatcherResponse(w, http.StatusNotFound, map[string]interface{}{
+			"found": false,
+			"_id":   id,
+		})
+		return
+	}
+
+	writeWatcherResponse(w, http.StatusOK, map[string]interface{}{
+		"found":         true,
+		"_id":           id,
+		"_version":      watch.Version,
+		"_seq_no":       watch.Version - 1,
+		"_primary_term": 1,
+		"status":        watchStatusResponse(watch.Status, watch.Version),
+		"watch":         watch.Source,
+	})
+}
+
+// DeleteWatch 删除 watch（正在进行的执行结束后不再保存状态）
+// DELETE /_watcher/watch/{id}
+func (h *WatcherHandler) DeleteWatch(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	entry, ok := h.watches[id]
+	if !ok || !watchVisible(r.Context(), entry) {
+		writeWatcherResponse(w, http.StatusNotFound, map[string]interface{}{
+			"found": false,
+			"_id":   id,
+		})
+		return
+	}
+	if err := h.metaStore.DeleteWatch(id); err != nil {
+		if _, notFound := err.(*metadata.MetadataNotFoundError); !notFound {
+			logger.Error("Failed to delete watch [%s]: %v", id, err)
+			common.HandleError(w, common.NewInternalServerError("failed to delete watch: "+err.Error()))
+			return
+		}
+	}
+	delete(h.watches, id)
+
+	writeWatcherResponse(w, http.StatusOK, map[string]interface{}{
+		"found":    true,
+		"_id":      id,
+		"_version": entry.watch.Version + 1,
+	})
+}
+
+// ActivateWatch 激活 watch，从现在开始按 interval 调度
+// PUT /_watcher/watch/{id}/_activate
+func (h *WatcherHandler) ActivateWatch(w http.ResponseWriter, r *http.Request) {
+	h.setWatchActive(w, r, mux.Vars(r)["id"], true)
+}
+
+// DeactivateWatch 停用 watch
+// PUT /_watcher/watch/{id}/_deactivate
+func (h *WatcherHandler) DeactivateWatch(w http.ResponseWriter, r *http.Request) {
+	h.setWatchActive(w, r, mux.Vars(r)["id"], false)
+}
+
+// setWatchActive 修改 watch 的激活状态并保存
+func (h *WatcherHandler) setWatchActive(w http.ResponseWriter, r *http.Request, id string, active bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	entry, ok := h.watches[id]
+	if !ok || !watchVisible(r.Context(), entry) {
+		common.HandleError(w, newWatchNotFoundError(id))
+		return
+	}
+
+	watch := *entry.watch
+	if watch.Status.Active != active {
+		now := time.Now().UTC()
+		status := cloneWatchStatus(watch.Status)
+		status.Active = active
+		status.StateTimestamp = now
+		watch.Status = status
+		watch.Version++
+		watch.UpdatedAt = now
+		if err := h.metaStore.SaveWatch(id, &watch); err != nil {
+			logger.Error("Failed to save watch [%s]: %v", id, err)
+			common.HandleError(w, common.NewInternalServerError("failed to save watch: "+err.Error()))
+			return
+		}
+		entry.watch = &watch
+		if active {
+			entry.nextRun = now.Add(entry.def.interval)
+		}
+	}
+
+	writeWatcherResponse(w, http.StatusOK, map[string]interface{}{
+		"status": watchStatusResponse(watch.Status, watch.Version),
+	})
+}
+
+// watchVisible 判断 watch 对请求是否可见：多租户请求只看到本租户创建的 watch
+func watchVisible(ctx context.Context, entry *watchEntry) bool {
+	tenant := middleware.TenantFromContext(ctx)
+	return tenant == "" || entry.watch.Tenant == tenant
+}
+
+// ExecuteWatch 立即执行 watch，返回 watch 记录
+// 请求体支持 ignore_condition、record_execution（默认 false，为 true 时保存状态并参与限流）、
+// action_modes（execute、force_execute、simulate、force_simulate、skip）与 alternative_input；
+// 不指定 id 时执行请求体中 watch 字段给出的临时 watch
+// POST /_watcher/watch/{id}/_execute
+// POST /_watcher/watch/_execute
+func (h *WatcherHandler) ExecuteWatch(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	body, apiErr := readWatchBody(r)
+	if apiErr != nil {
+		common.HandleError(w, apiErr)
+		return
+	}
+
+	opts := watchExecutionOptions{}
+	for key, value := range body {
+		var ok bool
+		switch key {
+		case "ignore_condition":
+			opts.ignoreCondition, ok = value.(bool)
+		case "record_execution":
+			opts.recordExecution, ok = value.(bool)
+		case "alternative_input":
+			opts.alternativeInput, ok = value.(map[string]interface{})
+		case "action_modes":
+			var modes map[string]interface{}
+			if modes, ok = value.(map[string]interface{}); ok {
+				opts.actionModes = make(map[string]string, len(modes))
+				for name, mode := range modes {
+					opts.actionModes[name] = fmt.Sprint(mode)
+				}
+			}
+		case "watch":
+			ok = id == ""
+		case "trigger_data", "debug":
+			ok = true
+		}
+		if !ok {
+			common.HandleError(w, newWatchParseError("could not parse watch execution request. unexpected field [%s]", key))
+			return
+		}
+	}
+
+	var entry *watchEntry
+	if id == "" {
+		source, ok := body["watch"].(map[string]interface{})
+		if !ok {
+			common.HandleError(w, common.NewBadRequestError("a watch id or an inline [watch] is required"))
+			return
+		}
+		if opts.recordExecution {
+			common.HandleError(w, common.NewBadRequestError("the execution of an inline watch cannot be recorded"))
+			return
+		}
+		id = "_inlined_"
+		def, apiErr := parseWatch(id, source)
+		if apiErr != nil {
+			common.HandleError(w, apiErr)
+			return
+		}
+		now := time.Now().UTC()
+		entry = &watchEntry{id: id, def: def, watch: &metadata.Watch{
+			ID:     id,
+			Tenant: middleware.TenantFromContext(r.Context()),
+			Source: source,
+			Status: &metadata.WatchStatus{Active: true, StateTimestamp: now},
+		}}
+	} else {
+		h.mutex.Lock()
+		entry = h.watches[id]
+		h.mutex.Unlock()
+		if entry == nil || !watchVisible(r.Context(), entry) {
+			common.HandleError(w, newWatchNotFoundError(id))
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	record := h.executeWatch(r.Context(), entry, watchTriggerEvent{kind: "manual", triggeredTime: now, scheduledTime: now}, opts)
+	writeWatcherResponse(w, http.StatusOK, map[string]interface{}{
+		"_id":          fmt.Sprintf("%s_%s-%s", id, uuid.New().String(), formatDateValue(now, "")),
+		"watch_record": record,
+	})
+}
+
+// WatcherStats 返回 watcher 的运行状态
+// GET /_watcher/stats
+func (h *WatcherHandler) WatcherStats(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	var running, count int
+	for _, entry := range h.watches {
+		if !watchVisible(r.Context(), entry) {
+			continue
+		}
+		count++
+		if entry.running {
+			running++
+		}
+	}
+	h.mutex.Unlock()
+
+	writeWatcherResponse(w, http.StatusOK, map[string]interface{}{
+		"_nodes": map[string]interface{}{
+			"total":      1,
+			"successful": 1,
+			"failed":     0,
+		},
+		"cluster_name":     ClusterName,
+		"manually_stopped": false,
+		"stats": []interface{}{
+			map[string]interface{}{
+				"node_id":       NodeName,
+				"watcher_state": "started",
+				"watch_count":   count,
+				"execution_thread_pool": map[string]interface{}{
+					"queue_size": 0,
+					"max_size":   running,
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,370 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+func TestWatcherHandler_Watches(t *testing.T) {
+	oldTick := watcherTickInterval
+	watcherTickInterval = 10 * time.Millisecond
+	defer func() { watcherTickInterval = oldTick }()
+
+	indexHandler, indexMgr, router, cleanup := setupIndexMaintenanceTest(t)
+	defer cleanup()
+	docHandler := NewDocumentHandler(indexMgr, indexHandler.dirMgr, indexHandler.metaStore)
+	watcherHandler := NewWatcherHandler(indexHandler, docHandler)
+	defer func() { watcherHandler.Close() }()
+	router.AddRoutes([]server.Route{
+		{Method: "POST", Path: "/_bulk", Handler: docHandler.Bulk},
+		{Method: "POST", Path: "/{index}/_search", Handler: docHandler.Search},
+		{Method: "POST", Path: "/_watcher/watch/_execute", Handler: func(w http.ResponseWriter, r *http.Request) {
+			watcherHandler.ExecuteWatch(w, r)
+		}},
+		{Method: "PUT", Path: "/_watcher/watch/{id}", Handler: func(w http.ResponseWriter, r *http.Request) {
+			watcherHandler.PutWatch(w, r)
+		}},
+		{Method: "GET", Path: "/_watcher/watch/{id}", Handler: func(w http.ResponseWriter, r *http.Request) {
+			watcherHandler.GetWatch(w, r)
+		}},
+		{Method: "DELETE", Path: "/_watcher/watch/{id}", Handler: func(w http.ResponseWriter, r *http.Request) {
+			watcherHandler.DeleteWatch(w, r)
+		}},
+		{Method: "POST", Path: "/_watcher/watch/{id}/_execute", Handler: func(w http.ResponseWriter, r *http.Request) {
+			watcherHandler.ExecuteWatch(w, r)
+		}},
+		{Method: "PUT", Path: "/_watcher/watch/{id}/_deactivate", Handler: func(w http.ResponseWriter, r *http.Request) {
+			watcherHandler.DeactivateWatch(w, r)
+		}},
+		{Method: "GET", Path: "/_watcher/stats", Handler: func(w http.ResponseWriter, r *http.Request) {
+			watcherHandler.WatcherStats(w, r)
+		}},
+	})
+	mux := router.Build()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		t.Helper()
+		var rv map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &rv); err != nil {
+			t.Fatalf("decode: %v: %s", err, w.Body.String())
+		}
+		return rv
+	}
+
+	// 接收 webhook 的服务
+	type webhookCall struct {
+		method, path, query, body, header string
+	}
+	var (
+		callsMu sync.Mutex
+		calls   []webhookCall
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		callsMu.Lock()
+		calls = append(calls, webhookCall{r.Method, r.URL.Path, r.URL.RawQuery, string(body), r.Header.Get("X-Alert")})
+		callsMu.Unlock()
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer hook.Close()
+	callsTo := func(path string) []webhookCall {
+		callsMu.Lock()
+		defer callsMu.Unlock()
+		var rv []webhookCall
+		for _, c := range calls {
+			if c.path == path {
+				rv = append(rv, c)
+			}
+		}
+		return rv
+	}
+
+	if w := do("PUT", "/metrics", `{"mappings":{"properties":{"level":{"type":"keyword"},"host":{"type":"keyword"}}}}`); w.Code != http.StatusOK {
+		t.Fatalf("create index: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/_bulk?refresh=true", `{"index":{"_index":"metrics"}}
+{"level":"error","host":"a"}
+{"index":{"_index":"metrics"}}
+{"level":"error","host":"b"}
+{"index":{"_index":"metrics"}}
+{"level":"info","host":"a"}
+{"index":{"_index":"metrics"}}
+{"level":"error","host":"a"}
+`); w.Code != http.StatusOK {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body.String())
+	}
+
+	watchBody := `{
+		"trigger": {"schedule": {"interval": "1h"}},
+		"input": {"search": {"request": {"indices": ["metrics"], "body": {"size": 0, "query": {"term": {"level": "error"}}}}}},
+		"condition": {"compare": {"ctx.payload.hits.total": {"gte": 2}}},
+		"actions": {
+			"log": {"logging": {"text": "found {{ctx.payload.hits.total}} errors"}},
+			"notify": {"webhook": {
+				"method": "post", "url": "` + hook.URL + `", "path": "/alert/{{ctx.watch_id}}",
+				"params": {"watch": "{{ctx.watch_id}}"},
+				"headers": {"X-Alert": "errors"},
+				"body": "{\"count\": {{ctx.payload.hits.total}}}"
+			}},
+			"archive": {"index": {"index": "alerts", "execution_time_field": "@timestamp"}}
+		}
+	}`
+	w := do("PUT", "/_watcher/watch/errors", watchBody)
+	if w.Code != http.StatusCreated || decode(w)["created"] != true {
+		t.Fatalf("put watch: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/_watcher/watch/errors", watchBody); w.Code != http.StatusOK || decode(w)["_version"] != 2.0 {
+		t.Fatalf("update watch: got %d: %s", w.Code, w.Body.String())
+	}
+
+	type watchRecord struct {
+		State  string `json:"state"`
+		Result struct {
+			Input struct {
+				Payload map[string]interface{} `json:"payload"`
+			} `json:"input"`
+			Condition struct {
+				Met bool `json:"met"`
+			} `json:"condition"`
+			Actions []map[string]interface{} `json:"actions"`
+		} `json:"result"`
+		Status map[string]interface{} `json:"status"`
+	}
+	execute := func(path, body string) watchRecord {
+		t.Helper()
+		w := do("POST", path, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("execute %s: got %d: %s", path, w.Code, w.Body.String())
+		}
+		var resp struct {
+			ID     string      `json:"_id"`
+			Record watchRecord `json:"watch_record"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Record
+	}
+	actionStatuses := func(record watchRecord) map[string]string {
+		rv := make(map[string]string)
+		for _, action := range record.Result.Actions {
+			rv[action["id"].(string)], _ = action["status"].(string)
+		}
+		return rv
+	}
+	getWatch := func(id string) map[string]interface{} {
+		t.Helper()
+		w := do("GET", "/_watcher/watch/"+id, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("get watch %s: got %d: %s", id, w.Code, w.Body.String())
+		}
+		return decode(w)
+	}
+
+	record := execute("/_watcher/watch/errors/_execute", "")
+	if record.State != "executed" || !record.Result.Condition.Met || record.Result.Input.Payload["hits"].(map[string]interface{})["total"] != 3.0 {
+		t.Fatalf("unexpected watch record: %+v", record)
+	}
+	if got := actionStatuses(record); got["log"] != "success" || got["notify"] != "success" || got["archive"] != "success" {
+		t.Fatalf("unexpected action statuses: %v (%+v)", got, record.Result.Actions)
+	}
+	for _, action := range record.Result.Actions {
+		if action["id"] == "log" {
+			if text := action["logging"].(map[string]interface{})["logged_text"]; text != "found 3 errors" {
+				t.Errorf("logged text: got %v", text)
+			}
+		}
+	}
+	if hooks := callsTo("/alert/errors"); len(hooks) != 1 || hooks[0].method != "POST" || hooks[0].body != `{"count": 3}` ||
+		hooks[0].header != "errors" || hooks[0].query != "watch=errors" {
+		t.Errorf("unexpected webhook calls: %+v", hooks)
+	}
+	if w := do("POST", "/alerts/_search", `{"query":{"exists":{"field":"@timestamp"}}}`); w.Code != http.StatusOK ||
+		!strings.Contains(w.Body.String(), `"value":1`) {
+		t.Errorf("expected alert document in alerts index, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 默认不记录执行，状态不变
+	if status := getWatch("errors")["status"].(map[string]interface{}); status["last_checked"] != nil {
+		t.Errorf("execution without record_execution should not update status: %v", status)
+	}
+
+	// 记录执行后，第二次执行在限流周期（默认 5s）内被限流
+	record = execute("/_watcher/watch/errors/_execute", `{"record_execution":true,"action_modes":{"archive":"skip"}}`)
+	if got := actionStatuses(record); record.State != "executed" || got["notify"] != "success" || got["archive"] != "throttled" {
+		t.Fatalf("unexpected recorded execution: %s %v", record.State, got)
+	}
+	record = execute("/_watcher/watch/errors/_execute", `{"record_execution":true}`)
+	if got := actionStatuses(record); got["log"] != "throttled" || got["notify"] != "throttled" || got["archive"] != "success" {
+		t.Errorf("expected throttled actions, got %s %v", record.State, got)
+	}
+	status := getWatch("errors")["status"].(map[string]interface{})
+	if status["last_checked"] == nil || status["last_met_condition"] == nil || status["execution_state"] != "executed" {
+		t.Errorf("expected recorded status, got %v", status)
+	}
+	notify := status["actions"].(map[string]interface{})["notify"].(map[string]interface{})
+	if notify["last_successful_execution"] == nil || notify["last_throttle"] == nil {
+		t.Errorf("unexpected notify status: %v", notify)
+	}
+
+	// force_simulate 不发送请求也不受限流影响
+	before := len(callsTo("/alert/errors"))
+	record = execute("/_watcher/watch/errors/_execute", `{"action_modes":{"_all":"force_simulate"}}`)
+	if got := actionStatuses(record); got["notify"] != "simulated" || len(callsTo("/alert/errors")) != before {
+		t.Errorf("expected simulated actions without requests, got %v", got)
+	}
+
+	// 条件不满足
+	record = execute("/_watcher/watch/errors/_execute", `{"alternative_input":{"hits":{"total":1}}}`)
+	if record.State != "execution_not_needed" || record.Result.Condition.Met || len(record.Result.Actions) != 0 {
+		t.Errorf("expected execution_not_needed, got %+v", record)
+	}
+	record = execute("/_watcher/watch/errors/_execute", `{"alternative_input":{"hits":{"total":1}},"ignore_condition":true,"action_modes":{"_all":"force_simulate"}}`)
+	if record.State != "executed" {
+		t.Errorf("ignore_condition: expected executed, got %s", record.State)
+	}
+
+	// 内联 watch：script 条件、action 条件与 webhook 失败
+	inline := func(value int, path string) watchRecord {
+		body := `{"watch":{
+			"trigger": {"schedule": {"interval": "10s"}},
+			"input": {"simple": {"value": VALUE}},
+			"condition": {"script": {"source": "ctx.payload.value > params.threshold", "params": {"threshold": 5}}},
+			"actions": {
+				"hook": {"webhook": {"method": "put", "host": "127.0.0.1", "port": PORT, "path": "PATH", "body": "{{ctx.payload.value}}"}},
+				"big": {"condition": {"compare": {"ctx.payload.value": {"gt": 50}}}, "logging": {"text": "big {{ctx.payload.value}}", "level": "warn"}}
+			}
+		}}`
+		port := hook.URL[strings.LastIndex(hook.URL, ":")+1:]
+		body = strings.NewReplacer("VALUE", strconv.Itoa(value), "PORT", port, "PATH", path).Replace(body)
+		return execute("/_watcher/watch/_execute", body)
+	}
+	if record := inline(1, "/inline"); record.State != "execution_not_needed" {
+		t.Errorf("script condition: expected execution_not_needed, got %s", record.State)
+	}
+	record = inline(10, "/inline")
+	if got := actionStatuses(record); record.State != "executed" || got["hook"] != "success" || got["big"] != "condition_failed" {
+		t.Errorf("inline watch: got %s %v", record.State, got)
+	}
+	if hooks := callsTo("/inline"); len(hooks) != 1 || hooks[0].method != "PUT" || hooks[0].body != "10" {
+		t.Errorf("unexpected inline webhook calls: %+v", hooks)
+	}
+	record = inline(100, "/fail")
+	if got := actionStatuses(record); got["hook"] != "failure" || got["big"] != "success" {
+		t.Errorf("failing webhook: got %v", got)
+	}
+	for _, action := range record.Result.Actions {
+		if action["id"] == "hook" && action["reason"] != "received [500] status code" {
+			t.Errorf("unexpected webhook failure reason: %v", action["reason"])
+		}
+	}
+
+	// 调度执行
+	heartbeat := `{
+		"trigger": {"schedule": {"interval": "1s"}},
+		"input": {"simple": {"service": "api"}},
+		"actions": {"ping": {"throttle_period": "0s", "webhook": {"url": "` + hook.URL + `/heartbeat", "body": "{{ctx.payload.service}}"}}}
+	}`
+	if w := do("PUT", "/_watcher/watch/heartbeat", heartbeat); w.Code != http.StatusCreated {
+		t.Fatalf("put heartbeat: got %d: %s", w.Code, w.Body.String())
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for len(callsTo("/heartbeat")) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("heartbeat watch was not triggered: %v", callsTo("/heartbeat"))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if hooks := callsTo("/heartbeat"); hooks[0].method != "GET" || hooks[0].body != "api" {
+		t.Errorf("unexpected heartbeat call: %+v", hooks[0])
+	}
+	w = do("PUT", "/_watcher/watch/heartbeat/_deactivate", "")
+	if state := decode(w)["status"].(map[string]interface{})["state"].(map[string]interface{}); w.Code != http.StatusOK || state["active"] != false {
+		t.Errorf("deactivate: got %d: %s", w.Code, w.Body.String())
+	}
+	if stats := decode(do("GET", "/_watcher/stats", "")); stats["stats"].([]interface{})[0].(map[string]interface{})["watch_count"] != 2.0 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+
+	// 重新加载后 watch 与状态仍然存在
+	watcherHandler.Close()
+	watcherHandler = NewWatcherHandler(indexHandler, docHandler)
+	reloaded := getWatch("heartbeat")
+	status = reloaded["status"].(map[string]interface{})
+	if status["state"].(map[string]interface{})["active"] != false || status["execution_state"] != "executed" || reloaded["_version"] != 2.0 {
+		t.Errorf("unexpected reloaded watch: %v", reloaded)
+	}
+	if reloaded["watch"].(map[string]interface{})["trigger"] == nil {
+		t.Errorf("expected watch definition in response: %v", reloaded)
+	}
+
+	invalid := []struct {
+		body    string
+		message string
+	}{
+		{`{"trigger":{"schedule":{"interval":"10s"}},"foo":{}}`, "unexpected field [foo]"},
+		{`{"input":{"none":{}}}`, "missing required field [trigger]"},
+		{`{"trigger":{"schedule":{"cron":"0 0 * * * ?"}}}`, "unsupported schedule type [cron]"},
+		{`{"trigger":{"schedule":{"interval":"500ms"}}}`, "interval can't be lower than [1s]"},
+		{`{"trigger":{"schedule":{"interval":"10s"}},"input":{"search":{"request":{"indices":["a","b"]}}}}`, "exactly one concrete index"},
+		{`{"trigger":{"schedule":{"interval":"10s"}},"condition":{"compare":{"ctx.payload.x":{"bigger":1}}}}`, "unknown comparison operator [bigger]"},
+		{`{"trigger":{"schedule":{"interval":"10s"}},"actions":{"mail":{"email":{"to":"a@b.c"}}}}`, "unsupported action type [email]"},
+		{`{"trigger":{"schedule":{"interval":"10s"}},"actions":{"hook":{"webhook":{"path":"/x"}}}}`, "missing required [host] field"},
+	}
+	for _, tt := range invalid {
+		w := do("PUT", "/_watcher/watch/invalid", tt.body)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("put %s: expected 400 with %q, got %d: %s", tt.body, tt.message, w.Code, w.Body.String())
+		}
+	}
+
+	if w := do("DELETE", "/_watcher/watch/errors", ""); w.Code != http.StatusOK || decode(w)["found"] != true {
+		t.Errorf("delete watch: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/_watcher/watch/errors", ""); w.Code != http.StatusNotFound || decode(w)["found"] != false {
+		t.Errorf("get deleted watch: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", "/_watcher/watch/errors", ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete missing watch: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/_watcher/watch/errors/_execute", ""); w.Code != http.StatusNotFound {
+		t.Errorf("execute missing watch: got %d: %s", w.Code, w.Body.String())
+	}
+}
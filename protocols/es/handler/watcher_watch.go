@@ -0,0 +1,649 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+	"github.com/lscgzwd/tiggerdb/script"
+)
+
+// watch 定义
+// 支持的组成部分：
+//   - trigger：schedule.interval（如 "10s"、"5m"，数字表示秒）
+//   - input：none、simple（固定 payload）、search（对单个索引执行查询，hits.total 为数字）
+//   - condition：always、never、compare（阈值比较）、script
+//   - actions：logging、webhook、index，可分别设置 condition 与 throttle_period
+// 字符串模板（日志内容、webhook 的 path/params/headers/body、index 的 doc_id）按 mustache 渲染，上下文为 {{ctx.*}}。
+
+// defaultWatchThrottlePeriod action 的默认限流周期：上次成功执行后的这段时间内不再执行
+const defaultWatchThrottlePeriod = 5 * time.Second
+
+// defaultWebhookTimeout webhook 请求的默认超时
+const defaultWebhookTimeout = 10 * time.Second
+
+// watchCompareOps compare 条件支持的比较运算
+var watchCompareOps = map[string]bool{"eq": true, "not_eq": true, "gt": true, "gte": true, "lt": true, "lte": true}
+
+// watchDefinition 解析后的 watch
+type watchDefinition struct {
+	interval       time.Duration
+	input          *watchInput
+	condition      *watchCondition
+	actions        []*watchAction // 按名称排序
+	throttlePeriod time.Duration
+	metadata       map[string]interface{}
+}
+
+// watchInput watch 的输入
+type watchInput struct {
+	kind    string // none、simple、search
+	payload map[string]interface{}
+	index   string
+	body    map[string]interface{}
+}
+
+// watchCondition watch 或 action 的执行条件
+type watchCondition struct {
+	kind   string // always、never、compare、script
+	path   string // compare 比较的值路径，如 ctx.payload.hits.total
+	op     string
+	value  interface{}
+	script *script.Script
+}
+
+// watchAction watch 的动作
+type watchAction struct {
+	name           string
+	kind           string // logging、webhook、index
+	condition      *watchCondition
+	throttlePeriod time.Duration // 小于 0 时使用 watch 的限流周期
+
+	// logging
+	text  string
+	level string
+
+	// webhook
+	webhook *webhookTemplate
+
+	// index
+	index              string
+	docID              string
+	executionTimeField string
+}
+
+// webhookTemplate webhook 请求模板
+type webhookTemplate struct {
+	method   string
+	scheme   string
+	host     string
+	port     int
+	path     string
+	params   map[string]string
+	headers  map[string]string
+	body     string
+	username string
+	password string
+	timeout  time.Duration
+}
+
+// newWatchParseError 返回 watch 定义解析错误
+func newWatchParseError(format string, args ...interface{}) common.APIError {
+	return &common.BaseError{
+		ErrType:    "parse_exception",
+		Message:    fmt.Sprintf(format, args...),
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "WATCH_PARSE_ERROR",
+	}
+}
+
+// parseWatch 解析 PUT /_watcher/watch/{id} 的请求体
+func parseWatch(id string, source map[string]interface{}) (*watchDefinition, common.APIError) {
+	def := &watchDefinition{
+		input:          &watchInput{kind: "none"},
+		condition:      &watchCondition{kind: "always"},
+		throttlePeriod: defaultWatchThrottlePeriod,
+	}
+	for key := range source {
+		switch key {
+		case "trigger", "input", "condition", "actions", "metadata", "throttle_period", "throttle_period_in_millis":
+		default:
+			return nil, newWatchParseError("could not parse watch [%s]. unexpected field [%s]", id, key)
+		}
+	}
+
+	trigger, ok := source["trigger"].(map[string]interface{})
+	if !ok {
+		return nil, newWatchParseError("could not parse watch [%s]. missing required field [trigger]", id)
+	}
+	interval, apiErr := parseWatchTrigger(id, trigger)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	def.interval = interval
+
+	if raw, ok := source["input"]; ok {
+		input, apiErr := parseWatchInput(id, raw)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		def.input = input
+	}
+	if raw, ok := source["condition"]; ok {
+		condition, apiErr := parseWatchCondition(id, raw)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		def.condition = condition
+	}
+	if period, ok, apiErr := parseWatchThrottlePeriod(id, source); apiErr != nil {
+		return nil, apiErr
+	} else if ok {
+		def.throttlePeriod = period
+	}
+	if raw, ok := source["metadata"]; ok {
+		metadata, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, newWatchParseError("could not parse watch [%s]. [metadata] must be an object", id)
+		}
+		def.metadata = metadata
+	}
+
+	if raw, ok := source["actions"]; ok {
+		actions, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, newWatchParseError("could not parse watch [%s]. [actions] must be an object", id)
+		}
+		for name, body := range actions {
+			action, apiErr := parseWatchAction(id, name, body)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			def.actions = append(def.actions, action)
+		}
+		sort.Slice(def.actions, func(i, j int) bool { return def.actions[i].name < def.actions[j].name })
+	}
+	return def, nil
+}
+
+// parseWatchTrigger 解析 trigger，只支持 schedule.interval
+func parseWatchTrigger(id string, trigger map[string]interface{}) (time.Duration, common.APIError) {
+	schedule, ok := trigger["schedule"].(map[string]interface{})
+	if !ok || len(trigger) != 1 {
+		return 0, newWatchParseError("could not parse watch [%s]. only [schedule] triggers are supported", id)
+	}
+	for kind := range schedule {
+		if kind != "interval" {
+			return 0, newWatchParseError("could not parse watch [%s]. unsupported schedule type [%s], only [interval] is supported", id, kind)
+		}
+	}
+	var interval time.Duration
+	switch v := schedule["interval"].(type) {
+	case float64:
+		interval = time.Duration(v * float64(time.Second))
+	case string:
+		d, err := parseWatchTimeValue(v)
+		if err != nil {
+			return 0, newWatchParseError("could not parse watch [%s]. could not parse [interval] schedule: %s", id, err.Error())
+		}
+		interval = d
+	default:
+		return 0, newWatchParseError("could not parse watch [%s]. missing [interval] in schedule", id)
+	}
+	if interval < time.Second {
+		return 0, newWatchParseError("could not parse watch [%s]. interval can't be lower than [1s]", id)
+	}
+	return interval, nil
+}
+
+// parseWatchTimeValue 解析时间值，在 parseTimeValue 的基础上支持 w（周）
+func parseWatchTimeValue(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "w") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(value, "w"), 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("failed to parse time value [%s]", value)
+		}
+		return time.Duration(n * float64(7*24*time.Hour)), nil
+	}
+	return parseTimeValue(value)
+}
+
+// parseWatchThrottlePeriod 解析 throttle_period / throttle_period_in_millis
+func parseWatchThrottlePeriod(id string, body map[string]interface{}) (time.Duration, bool, common.APIError) {
+	if raw, ok := body["throttle_period"]; ok {
+		s, ok := raw.(string)
+		if !ok {
+			return 0, false, newWatchParseError("could not parse watch [%s]. [throttle_period] must be a time value", id)
+		}
+		d, err := parseWatchTimeValue(s)
+		if err != nil {
+			return 0, false, newWatchParseError("could not parse watch [%s]. %s", id, err.Error())
+		}
+		return d, true, nil
+	}
+	if raw, ok := body["throttle_period_in_millis"]; ok {
+		ms, ok := raw.(float64)
+		if !ok || ms < 0 {
+			return 0, false, newWatchParseError("could not parse watch [%s]. [throttle_period_in_millis] must be a non-negative number", id)
+		}
+		return time.Duration(ms) * time.Millisecond, true, nil
+	}
+	return 0, false, nil
+}
+
+// parseWatchInput 解析 input
+func parseWatchInput(id string, raw interface{}) (*watchInput, common.APIError) {
+	body, ok := raw.(map[string]interface{})
+	if !ok || len(body) != 1 {
+		return nil, newWatchParseError("could not parse watch [%s]. [input] must contain exactly one input type", id)
+	}
+	for kind, spec := range body {
+		switch kind {
+		case "none":
+			return &watchInput{kind: kind}, nil
+		case "simple":
+			payload, ok := spec.(map[string]interface{})
+			if !ok {
+				return nil, newWatchParseError("could not parse [simple] input for watch [%s]. expected an object", id)
+			}
+			return &watchInput{kind: kind, payload: payload}, nil
+		case "search":
+			spec, _ := spec.(map[string]interface{})
+			request, ok := spec["request"].(map[string]interface{})
+			if !ok {
+				return nil, newWatchParseError("could not parse [search] input for watch [%s]. missing required [request] field", id)
+			}
+			var indices []string
+			switch v := request["indices"].(type) {
+			case string:
+				indices = splitCommaList(v)
+			case []interface{}:
+				for _, item := range v {
+					if s, ok := item.(string); ok {
+						indices = append(indices, s)
+					}
+				}
+			}
+			if len(indices) != 1 || strings.ContainsAny(indices[0], "*,") {
+				return nil, newWatchParseError("could not parse [search] input for watch [%s]. [indices] must specify exactly one concrete index", id)
+			}
+			searchBody, _ := request["body"].(map[string]interface{})
+			if searchBody == nil {
+				searchBody = map[string]interface{}{}
+			}
+			return &watchInput{kind: kind, index: indices[0], body: searchBody}, nil
+		default:
+			return nil, newWatchParseError("could not parse watch [%s]. unsupported input type [%s]", id, kind)
+		}
+	}
+	return nil, nil
+}
+
+// parseWatchCondition 解析 condition
+func parseWatchCondition(id string, raw interface{}) (*watchCondition, common.APIError) {
+	body, ok := raw.(map[string]interface{})
+	if !ok || len(body) != 1 {
+		return nil, newWatchParseError("could not parse watch [%s]. [condition] must contain exactly one condition type", id)
+	}
+	for kind, spec := range body {
+		switch kind {
+		case "always", "never":
+			return &watchCondition{kind: kind}, nil
+		case "compare":
+			spec, ok := spec.(map[string]interface{})
+			if !ok || len(spec) != 1 {
+				return nil, newWatchParseError("could not parse [compare] condition for watch [%s]. expected a single path", id)
+			}
+			for path, cmp := range spec {
+				cmp, ok := cmp.(map[string]interface{})
+				if !ok || len(cmp) != 1 {
+					return nil, newWatchParseError("could not parse [compare] condition for watch [%s]. expected a single comparison for [%s]", id, path)
+				}
+				for op, value := range cmp {
+					if !watchCompareOps[op] {
+						return nil, newWatchParseError("could not parse [compare] condition for watch [%s]. unknown comparison operator [%s]", id, op)
+					}
+					return &watchCondition{kind: kind, path: path, op: op, value: value}, nil
+				}
+			}
+		case "script":
+			s, err := script.ParseScript(spec)
+			if err != nil {
+				return nil, newWatchParseError("could not parse [script] condition for watch [%s]. %s", id, err.Error())
+			}
+			return &watchCondition{kind: kind, script: s}, nil
+		default:
+			return nil, newWatchParseError("could not parse watch [%s]. unsupported condition type [%s]", id, kind)
+		}
+	}
+	return nil, nil
+}
+
+// parseWatchAction 解析单个 action
+func parseWatchAction(id, name string, raw interface{}) (*watchAction, common.APIError) {
+	body, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, newWatchParseError("could not parse action [%s/%s]. expected an object", id, name)
+	}
+	action := &watchAction{name: name, throttlePeriod: -1}
+	if period, ok, apiErr := parseWatchThrottlePeriod(id, body); apiErr != nil {
+		return nil, apiErr
+	} else if ok {
+		action.throttlePeriod = period
+	}
+	if raw, ok := body["condition"]; ok {
+		condition, apiErr := parseWatchCondition(id, raw)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		action.condition = condition
+	}
+
+	for kind, spec := range body {
+		switch kind {
+		case "throttle_period", "throttle_period_in_millis", "condition":
+			continue
+		case "logging", "webhook", "index":
+		default:
+			return nil, newWatchParseError("could not parse action [%s/%s]. unsupported action type [%s]", id, name, kind)
+		}
+		if action.kind != "" {
+			return nil, newWatchParseError("could not parse action [%s/%s]. expected exactly one action type", id, name)
+		}
+		action.kind = kind
+		spec, ok := spec.(map[string]interface{})
+		if !ok {
+			return nil, newWatchParseError("could not parse action [%s/%s]. [%s] must be an object", id, name, kind)
+		}
+
+		var err error
+		switch kind {
+		case "logging":
+			if action.text, err = watchTemplateSource(spec["text"]); err != nil || action.text == "" {
+				return nil, newWatchParseError("could not parse action [%s/%s]. missing required [text] field", id, name)
+			}
+			action.level, _ = spec["level"].(string)
+			switch action.level {
+			case "":
+				action.level = "info"
+			case "error", "warn", "info", "debug", "trace":
+			default:
+				return nil, newWatchParseError("could not parse action [%s/%s]. unknown logging level [%s]", id, name, action.level)
+			}
+		case "webhook":
+			if action.webhook, err = parseWebhookTemplate(spec); err != nil {
+				return nil, newWatchParseError("could not parse action [%s/%s]. %s", id, name, err.Error())
+			}
+		case "index":
+			action.index, _ = spec["index"].(string)
+			if action.index == "" {
+				return nil, newWatchParseError("could not parse action [%s/%s]. missing required [index] field", id, name)
+			}
+			if err := common.ValidateIndexName(action.index); err != nil {
+				return nil, newWatchParseError("could not parse action [%s/%s]. %s", id, name, err.Error())
+			}
+			if action.docID, err = watchTemplateSource(spec["doc_id"]); err != nil {
+				return nil, newWatchParseError("could not parse action [%s/%s]. %s", id, name, err.Error())
+			}
+			action.executionTimeField, _ = spec["execution_time_field"].(string)
+		}
+	}
+	if action.kind == "" {
+		return nil, newWatchParseError("could not parse action [%s/%s]. missing action type", id, name)
+	}
+	return action, nil
+}
+
+// watchTemplateSource 读取模板：字符串或 {"source": "..."}，nil 返回空字符串
+func watchTemplateSource(raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[string]interface{}:
+		if s, ok := v["source"].(string); ok {
+			return s, nil
+		}
+		if s, ok := v["inline"].(string); ok {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("expected a template string or an object with [source]")
+}
+
+// parseWebhookTemplate 解析 webhook 请求：url 或 scheme/host/port/path
+func parseWebhookTemplate(spec map[string]interface{}) (*webhookTemplate, error) {
+	tmpl := &webhookTemplate{
+		method:  http.MethodGet,
+		scheme:  "http",
+		params:  map[string]string{},
+		headers: map[string]string{},
+		timeout: defaultWebhookTimeout,
+	}
+	if rawURL, ok := spec["url"].(string); ok {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid [url] [%s]", rawURL)
+		}
+		tmpl.scheme = u.Scheme
+		tmpl.host = u.Hostname()
+		if port := u.Port(); port != "" {
+			tmpl.port, _ = strconv.Atoi(port)
+		}
+		tmpl.path = u.Path
+		for k, v := range u.Query() {
+			tmpl.params[k] = strings.Join(v, ",")
+		}
+	}
+	if scheme, ok := spec["scheme"].(string); ok {
+		tmpl.scheme = strings.ToLower(scheme)
+	}
+	if tmpl.scheme != "http" && tmpl.scheme != "https" {
+		return nil, fmt.Errorf("unsupported [scheme] [%s]", tmpl.scheme)
+	}
+	if host, ok := spec["host"].(string); ok {
+		tmpl.host = host
+	}
+	if tmpl.host == "" {
+		return nil, fmt.Errorf("missing required [host] field")
+	}
+	if port, ok := spec["port"].(float64); ok {
+		tmpl.port = int(port)
+	}
+	if tmpl.port == 0 {
+		tmpl.port = 80
+		if tmpl.scheme == "https" {
+			tmpl.port = 443
+		}
+	}
+	if method, ok := spec["method"].(string); ok {
+		tmpl.method = strings.ToUpper(method)
+	}
+	switch tmpl.method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodHead:
+	default:
+		return nil, fmt.Errorf("unsupported http method [%s]", tmpl.method)
+	}
+
+	var err error
+	if raw, ok := spec["path"]; ok {
+		if tmpl.path, err = watchTemplateSource(raw); err != nil {
+			return nil, err
+		}
+	}
+	if tmpl.body, err = watchTemplateSource(spec["body"]); err != nil {
+		return nil, err
+	}
+	for field, target := range map[string]map[string]string{"params": tmpl.params, "headers": tmpl.headers} {
+		values, _ := spec[field].(map[string]interface{})
+		for k, v := range values {
+			if target[k], err = watchTemplateSource(v); err != nil {
+				return nil, fmt.Errorf("invalid [%s.%s]: %v", field, k, err)
+			}
+		}
+	}
+	if auth, ok := spec["auth"].(map[string]interface{}); ok {
+		basic, ok := auth["basic"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("only [basic] auth is supported")
+		}
+		tmpl.username, _ = basic["username"].(string)
+		tmpl.password, _ = basic["password"].(string)
+	}
+	for _, field := range []string{"connection_timeout", "read_timeout"} {
+		if s, ok := spec[field].(string); ok {
+			d, err := parseWatchTimeValue(s)
+			if err != nil {
+				return nil, err
+			}
+			if d > 0 && d < tmpl.timeout {
+				tmpl.timeout = d
+			}
+		}
+	}
+	return tmpl, nil
+}
+
+// renderWatchTemplate 使用执行上下文渲染 mustache 模板
+func renderWatchTemplate(source string, model map[string]interface{}) (string, error) {
+	if !strings.Contains(source, "{{") {
+		return source, nil
+	}
+	return script.RenderMustache(source, model)
+}
+
+// evaluate 判断条件是否满足，model 为 {"ctx": 执行上下文}
+func (c *watchCondition) evaluate(model map[string]interface{}) (bool, error) {
+	switch c.kind {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "compare":
+		left, _ := watchPathValue(model, c.path)
+		right := c.value
+		// 比较值可以引用上下文中的其他值：{{ctx.payload.aggregations.avg.value}}
+		if s, ok := right.(string); ok && strings.HasPrefix(s, "{{") && strings.HasSuffix(s, "}}") {
+			right, _ = watchPathValue(model, strings.TrimSpace(s[2:len(s)-2]))
+		}
+		return compareWatchValues(left, right, c.op), nil
+	case "script":
+		ctx := script.NewContext(nil, nil, nil)
+		ctx.Ctx, _ = model["ctx"].(map[string]interface{})
+		return script.NewEngine().ExecuteFilter(c.script, ctx)
+	}
+	return false, fmt.Errorf("unsupported condition type [%s]", c.kind)
+}
+
+// conditionSource 返回条件在 watch 记录中的展示形式
+func (c *watchCondition) conditionSource() map[string]interface{} {
+	switch c.kind {
+	case "compare":
+		return map[string]interface{}{"compare": map[string]interface{}{c.path: map[string]interface{}{c.op: c.value}}}
+	case "script":
+		return map[string]interface{}{"script": map[string]interface{}{"source": c.script.Source, "lang": c.script.Lang, "params": c.script.Params}}
+	}
+	return map[string]interface{}{c.kind: map[string]interface{}{}}
+}
+
+// watchPathValue 按点号路径读取值，数组下标用数字表示（如 ctx.payload.hits.hits.0._source）
+func watchPathValue(model interface{}, path string) (interface{}, bool) {
+	value := model
+	for _, part := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[part]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// compareWatchValues 比较两个值：数字按数值比较，其余按字符串比较；缺失的值只与 null 相等
+func compareWatchValues(left, right interface{}, op string) bool {
+	if left == nil || right == nil {
+		switch op {
+		case "eq":
+			return left == nil && right == nil
+		case "not_eq":
+			return (left == nil) != (right == nil)
+		}
+		return false
+	}
+	var cmp int
+	lf, lok := watchNumber(left)
+	rf, rok := watchNumber(right)
+	switch {
+	case lok && rok:
+		switch {
+		case lf < rf:
+			cmp = -1
+		case lf > rf:
+			cmp = 1
+		}
+	default:
+		cmp = strings.Compare(fmt.Sprint(left), fmt.Sprint(right))
+	}
+	switch op {
+	case "eq":
+		return cmp == 0
+	case "not_eq":
+		return cmp != 0
+	case "gt":
+		return cmp > 0
+	case "gte":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "lte":
+		return cmp <= 0
+	}
+	return false
+}
+
+// watchNumber 把数字或数字字符串转换为 float64
+func watchNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -15,6 +15,7 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -253,6 +254,79 @@ func NewForbiddenError(message string) APIError {
 	}
 }
 
+// NewClusterBlockError 索引被 block 拦截的错误
+// block 为 ES 格式的 block 描述，如 "FORBIDDEN/8/index write (api)"
+func NewClusterBlockError(index, block string, status int) APIError {
+	return &BaseError{
+		ErrType:    "cluster_block_exception",
+		Message:    fmt.Sprintf("index [%s] blocked by: [%s];", index, block),
+		HTTPStatus: status,
+		Code:       "CLUSTER_BLOCK",
+		Index:      index,
+	}
+}
+
+// NewUnavailableShardsError 分片不可用错误（如磁盘超过 high 水位时无法分配新索引的分片）
+func NewUnavailableShardsError(index, message string) APIError {
+	return &BaseError{
+		ErrType:    "unavailable_shards_exception",
+		Message:    fmt.Sprintf("[%s][0] %s", index, message),
+		HTTPStatus: http.StatusServiceUnavailable,
+		Code:       "UNAVAILABLE_SHARDS",
+		Index:      index,
+	}
+}
+
+// NewRoutingMissingError 索引的 mapping 要求 routing（_routing.required）但请求未指定
+func NewRoutingMissingError(index, id string) APIError {
+	return &BaseError{
+		ErrType:    "routing_missing_exception",
+		Message:    fmt.Sprintf("routing is required for [%s]/[%s]", index, id),
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "ROUTING_MISSING",
+		Index:      index,
+	}
+}
+
+// NewScriptException 脚本执行错误（如超出执行限制）
+func NewScriptException(message string) APIError {
+	return &BaseError{
+		ErrType:    "script_exception",
+		Message:    message,
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "SCRIPT_EXCEPTION",
+	}
+}
+
+// NewTaskCancelledError 请求被取消（如客户端断开连接）
+func NewTaskCancelledError(message string) APIError {
+	return &BaseError{
+		ErrType:    "task_cancelled_exception",
+		Message:    message,
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "TASK_CANCELLED",
+	}
+}
+
+// NewContentTooLargeError 请求体超出大小限制
+func NewContentTooLargeError(limit int64) APIError {
+	return &BaseError{
+		ErrType:    "content_too_long_exception",
+		Message:    fmt.Sprintf("request body is too large, limit is [%d] bytes", limit),
+		HTTPStatus: http.StatusRequestEntityTooLarge,
+		Code:       "CONTENT_TOO_LARGE",
+	}
+}
+
+// NewRequestBodyError 读取或解析请求体失败：超出请求体大小限制时返回 413，其他错误返回 400
+func NewRequestBodyError(message string, err error) APIError {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return NewContentTooLargeError(maxBytesErr.Limit)
+	}
+	return NewBadRequestError(message + ": " + err.Error())
+}
+
 // NewNotFoundError 未找到错误（通用，P2-6: 增强错误响应）
 func NewNotFoundError(message string) APIError {
 	return &BaseError{
@@ -28,13 +28,15 @@ type Response struct {
 	Shards   *ShardsInfo `json:"_shards,omitempty"`   // 分片信息
 
 	// 索引操作响应
-	Acknowledged bool   `json:"acknowledged,omitempty"`  // 是否确认
-	Index        string `json:"_index,omitempty"`        // 索引名
-	Id           string `json:"_id,omitempty"`           // 文档ID
-	Version      int64  `json:"_version,omitempty"`      // 版本号
-	Result       string `json:"result,omitempty"`        // 操作结果
-	SeqNo        int64  `json:"_seq_no,omitempty"`       // 序列号
-	PrimaryTerm  int64  `json:"_primary_term,omitempty"` // 主分片term
+	Acknowledged  bool   `json:"acknowledged,omitempty"`   // 是否确认
+	Index         string `json:"_index,omitempty"`         // 索引名
+	Type          string `json:"_type,omitempty"`          // 文档类型（ES 7.x 固定为 _doc）
+	Id            string `json:"_id,omitempty"`            // 文档ID
+	Version       int64  `json:"_version,omitempty"`       // 版本号
+	Result        string `json:"result,omitempty"`         // 操作结果
+	SeqNo         *int64 `json:"_seq_no,omitempty"`        // 序列号（可以为 0，未设置时不输出）
+	PrimaryTerm   *int64 `json:"_primary_term,omitempty"`  // 主分片term
+	ForcedRefresh bool   `json:"forced_refresh,omitempty"` // 写操作是否强制刷新
 
 	// 搜索响应
 	Hits         *HitsInfo   `json:"hits,omitempty"`         // 命中结果
@@ -55,7 +57,7 @@ type Response struct {
 type ShardsInfo struct {
 	Total      int `json:"total"`
 	Successful int `json:"successful"`
-	Skipped    int `json:"skipped"`
+	Skipped    int `json:"skipped,omitempty"` // 写操作响应不包含 skipped
 	Failed     int `json:"failed"`
 }
 
@@ -122,6 +124,12 @@ func (r *Response) WithIndex(index string) *Response {
 	return r
 }
 
+// WithType 设置文档类型
+func (r *Response) WithType(docType string) *Response {
+	r.Type = docType
+	return r
+}
+
 // WithID 设置文档ID
 func (r *Response) WithID(id string) *Response {
 	r.Id = id
@@ -142,13 +150,19 @@ func (r *Response) WithResult(result string) *Response {
 
 // WithSeqNo 设置序列号
 func (r *Response) WithSeqNo(seqNo int64) *Response {
-	r.SeqNo = seqNo
+	r.SeqNo = &seqNo
 	return r
 }
 
 // WithPrimaryTerm 设置主分片任期
 func (r *Response) WithPrimaryTerm(primaryTerm int64) *Response {
-	r.PrimaryTerm = primaryTerm
+	r.PrimaryTerm = &primaryTerm
+	return r
+}
+
+// WithForcedRefresh 设置写操作是否强制刷新（refresh=true）
+func (r *Response) WithForcedRefresh(forced bool) *Response {
+	r.ForcedRefresh = forced
 	return r
 }
 
@@ -261,6 +275,9 @@ func (r *Response) toMap() map[string]interface{} {
 	if r.Index != "" {
 		result["_index"] = r.Index
 	}
+	if r.Type != "" {
+		result["_type"] = r.Type
+	}
 	if r.Id != "" {
 		result["_id"] = r.Id
 	}
@@ -270,11 +287,14 @@ func (r *Response) toMap() map[string]interface{} {
 	if r.Result != "" {
 		result["result"] = r.Result
 	}
-	if r.SeqNo > 0 {
-		result["_seq_no"] = r.SeqNo
+	if r.SeqNo != nil {
+		result["_seq_no"] = *r.SeqNo
+	}
+	if r.PrimaryTerm != nil {
+		result["_primary_term"] = *r.PrimaryTerm
 	}
-	if r.PrimaryTerm > 0 {
-		result["_primary_term"] = r.PrimaryTerm
+	if r.ForcedRefresh {
+		result["forced_refresh"] = r.ForcedRefresh
 	}
 	if r.Hits != nil {
 		result["hits"] = r.Hits
@@ -300,6 +320,25 @@ func SuccessResponse() *Response {
 	return NewResponse().WithAcknowledged(true)
 }
 
+// DocWriteResponse 创建文档写操作（index/create/update/delete）响应，包含 ES 7.x 的完整字段：
+// _index、_type、_id、_version、result、_shards、_seq_no、_primary_term
+// result 为 noop 时没有实际写入，_shards 的 total/successful 为 0
+func DocWriteResponse(index, id, result string, version, seqNo, primaryTerm int64) *Response {
+	successful := 1
+	if result == "noop" {
+		successful = 0
+	}
+	return NewResponse().
+		WithIndex(index).
+		WithID(id).
+		WithResult(result).
+		WithVersion(version).
+		WithSeqNo(seqNo).
+		WithPrimaryTerm(primaryTerm).
+		WithShards(successful, successful, 0, 0).
+		WithType("_doc")
+}
+
 // ErrorResponse 创建错误响应
 func ErrorResponse(errType, reason string) *Response {
 	return NewResponse().WithError(errType, reason)
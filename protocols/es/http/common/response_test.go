@@ -146,3 +146,36 @@ func TestResponseWithData(t *testing.T) {
 		t.Error("Data should not be nil")
 	}
 }
+
+func TestDocWriteResponseJSON(t *testing.T) {
+	resp := DocWriteResponse("idx", "1", "deleted", 3, 0, 1)
+	w := httptest.NewRecorder()
+	if err := resp.WriteJSON(w, http.StatusOK); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]interface{}{
+		"_index": "idx", "_type": "_doc", "_id": "1", "_version": 3.0,
+		"result": "deleted", "_seq_no": 0.0, "_primary_term": 1.0,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	shards, _ := got["_shards"].(map[string]interface{})
+	if shards["total"] != 1.0 || shards["successful"] != 1.0 || shards["failed"] != 0.0 {
+		t.Errorf("unexpected _shards: %v", got["_shards"])
+	}
+	if _, ok := shards["skipped"]; ok {
+		t.Errorf("write _shards should not contain skipped: %v", shards)
+	}
+
+	noop := DocWriteResponse("idx", "1", "noop", 3, 5, 1)
+	if noop.Shards.Total != 0 || noop.Shards.Successful != 0 {
+		t.Errorf("noop _shards = %+v, want zero", noop.Shards)
+	}
+}
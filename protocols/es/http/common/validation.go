@@ -40,12 +40,12 @@ func ValidateIndexName(indexName string) error {
 		return &ValidationError{Field: "index", Message: "index name too long (max 255 characters)"}
 	}
 
-	// ES索引名称规则：只能包含小写字母、数字、-、_，不能以-开头
-	validName := regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	// ES索引名称规则：只能包含小写字母、数字、-、_、.（日期数学索引名如 logs-2024.03.13），不能以-或.开头
+	validName := regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
 	if !validName.MatchString(indexName) {
 		return &ValidationError{
 			Field:   "index",
-			Message: "invalid index name format (only lowercase letters, numbers, hyphens, and underscores allowed)",
+			Message: "invalid index name format (only lowercase letters, numbers, hyphens, underscores, and dots allowed)",
 		}
 	}
 
@@ -25,6 +25,9 @@ func TestValidateIndexName(t *testing.T) {
 		ok        bool
 	}{
 		{"ok", "my_index", true},
+		{"dots", "logs-2024.03.13", true},
+		{"consecutive dots", "logs..1", false},
+		{"leading dot", ".logs", false},
 		{"empty", "", false},
 		{"too long", strings.Repeat("a", 256), false},
 		{"invalid upper", "Bad", false},
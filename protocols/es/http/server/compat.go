@@ -0,0 +1,155 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+// ES 客户端兼容：
+//   - 官方客户端（7.14+）要求响应带 X-Elastic-Product: Elasticsearch 头
+//   - 8.x 客户端使用 application/vnd.elasticsearch+json;compatible-with=N 作为 Accept / Content-Type，
+//     请求时将其还原为普通 JSON / NDJSON，响应时回写相同的兼容媒体类型
+
+const (
+	// ProductHeader ES 产品标识响应头
+	ProductHeader = "X-Elastic-Product"
+	// ProductHeaderValue ES 产品标识
+	ProductHeaderValue = "Elasticsearch"
+
+	vendorMediaPrefix = "application/vnd.elasticsearch+"
+)
+
+// compatibleVersions 支持的 compatible-with 主版本
+var compatibleVersions = map[int]bool{7: true, 8: true}
+
+// ProductHeaderMiddleware 在所有响应中注入 X-Elastic-Product 头
+func ProductHeaderMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ProductHeader, ProductHeaderValue)
+		next(w, r)
+	}
+}
+
+// CompatibleMediaTypeMiddleware 支持 compatible-with 兼容媒体类型
+func CompatibleMediaTypeMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType, contentVersion, err := parseCompatibleMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			writeMediaTypeError(w, "Content-Type", r.Header.Get("Content-Type"), err)
+			return
+		}
+		acceptType, acceptVersion, err := parseCompatibleMediaType(r.Header.Get("Accept"))
+		if err != nil {
+			writeMediaTypeError(w, "Accept", r.Header.Get("Accept"), err)
+			return
+		}
+		if contentVersion != 0 && acceptVersion != 0 && contentVersion != acceptVersion {
+			writeMediaTypeError(w, "Accept", r.Header.Get("Accept"),
+				fmt.Errorf("Content-Type and Accept version requests have to match. Found Content-Type version [%d] and Accept version [%d]", contentVersion, acceptVersion))
+			return
+		}
+
+		if contentVersion != 0 {
+			r.Header.Set("Content-Type", contentType)
+		}
+		if acceptVersion == 0 {
+			next(w, r)
+			return
+		}
+		r.Header.Set("Accept", acceptType)
+		next(&compatibleResponseWriter{ResponseWriter: w, version: acceptVersion}, r)
+	}
+}
+
+// parseCompatibleMediaType 解析兼容媒体类型，返回对应的普通媒体类型与 compatible-with 版本
+// 非兼容媒体类型返回版本 0
+func parseCompatibleMediaType(value string) (string, int, error) {
+	if !strings.Contains(value, vendorMediaPrefix) {
+		return value, 0, nil
+	}
+	// Accept 可能包含多个媒体类型，取第一个兼容类型
+	for _, part := range strings.Split(value, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || !strings.HasPrefix(mediaType, vendorMediaPrefix) {
+			continue
+		}
+		plain := "application/" + strings.TrimPrefix(mediaType, vendorMediaPrefix)
+		compatibleWith, ok := params["compatible-with"]
+		if !ok {
+			return plain, 0, nil
+		}
+		version, err := strconv.Atoi(compatibleWith)
+		if err != nil || !compatibleVersions[version] {
+			return "", 0, fmt.Errorf("version must be either 7 or 8, but found %s", compatibleWith)
+		}
+		return plain, version, nil
+	}
+	return "", 0, fmt.Errorf("invalid media-type value")
+}
+
+func writeMediaTypeError(w http.ResponseWriter, header, value string, err error) {
+	reason := fmt.Sprintf("%s header [%s] is not supported: %v", header, value, err)
+	if writeErr := common.ErrorResponse("media_type_header_exception", reason).WriteJSON(w, http.StatusBadRequest); writeErr != nil {
+		log.Printf("ERROR: Failed to write media type error response: %v", writeErr)
+	}
+}
+
+// compatibleResponseWriter 将 JSON 响应的 Content-Type 改写为请求的兼容媒体类型
+type compatibleResponseWriter struct {
+	http.ResponseWriter
+	version     int
+	wroteHeader bool
+}
+
+func (cw *compatibleResponseWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		header := cw.Header()
+		if mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil && strings.HasPrefix(mediaType, "application/") {
+			subtype := strings.TrimPrefix(mediaType, "application/")
+			if subtype == "json" || subtype == "x-ndjson" {
+				header.Set("Content-Type", fmt.Sprintf("%s%s;compatible-with=%d", vendorMediaPrefix, subtype, cw.version))
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compatibleResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush 支持流式响应
+func (cw *compatibleResponseWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 返回被包装的 ResponseWriter，供 http.ResponseController 设置写超时
+func (cw *compatibleResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProductHeaderMiddleware(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) })
+	w := httptest.NewRecorder()
+	ProductHeaderMiddleware(h).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Get(ProductHeader); got != ProductHeaderValue {
+		t.Fatalf("expected %s header %q, got %q", ProductHeader, ProductHeaderValue, got)
+	}
+}
+
+func TestCompatibleMediaTypeMiddleware(t *testing.T) {
+	var gotContentType, gotAccept string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotContentType = r.Header.Get("Content-Type")
+		gotAccept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	compat := CompatibleMediaTypeMiddleware(h)
+
+	tests := []struct {
+		name            string
+		contentType     string
+		accept          string
+		wantStatus      int
+		wantContentType string
+		wantRequestType string
+		wantResponse    string
+	}{
+		{"plain json", "application/json", "", http.StatusOK, "application/json", "application/json", "application/json"},
+		{"compatible with 8", "application/vnd.elasticsearch+json; compatible-with=8", "application/vnd.elasticsearch+json; compatible-with=8",
+			http.StatusOK, "application/json", "application/json", "application/vnd.elasticsearch+json;compatible-with=8"},
+		{"compatible ndjson", "application/vnd.elasticsearch+x-ndjson;compatible-with=7", "application/vnd.elasticsearch+json;compatible-with=7",
+			http.StatusOK, "application/x-ndjson", "application/json", "application/vnd.elasticsearch+json;compatible-with=7"},
+		{"unsupported version", "", "application/vnd.elasticsearch+json;compatible-with=6", http.StatusBadRequest, "", "", ""},
+		{"mismatched versions", "application/vnd.elasticsearch+json;compatible-with=7", "application/vnd.elasticsearch+json;compatible-with=8",
+			http.StatusBadRequest, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotContentType, gotAccept = "", ""
+			req := httptest.NewRequest("POST", "/_bulk", strings.NewReader("{}"))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			compat.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(w.Body.String(), "media_type_header_exception") {
+					t.Errorf("expected media_type_header_exception, got %s", w.Body.String())
+				}
+				return
+			}
+			if gotContentType != tt.wantContentType {
+				t.Errorf("request Content-Type = %q, want %q", gotContentType, tt.wantContentType)
+			}
+			if tt.accept != "" && gotAccept != tt.wantRequestType {
+				t.Errorf("request Accept = %q, want %q", gotAccept, tt.wantRequestType)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantResponse {
+				t.Errorf("response Content-Type = %q, want %q", got, tt.wantResponse)
+			}
+		})
+	}
+}
@@ -41,10 +41,11 @@ type ServerConfig struct {
 	TLSKeyFile  string `json:"tls_key_file" yaml:"tls_key_file"`   // TLS密钥文件
 
 	// 中间件配置
-	EnableCORS      bool     `json:"enable_cors" yaml:"enable_cors"`             // 是否启用CORS，默认true
-	CORSOrigins     []string `json:"cors_origins" yaml:"cors_origins"`           // CORS允许的源，默认["*"]
-	EnableRateLimit bool     `json:"enable_rate_limit" yaml:"enable_rate_limit"` // 是否启用限流，默认false
-	RateLimitRPM    int      `json:"rate_limit_rpm" yaml:"rate_limit_rpm"`       // 每分钟请求限制，默认1000
+	EnableCORS      bool        `json:"enable_cors" yaml:"enable_cors"`             // 是否启用CORS，默认true
+	CORSOrigins     []string    `json:"cors_origins" yaml:"cors_origins"`           // CORS允许的源，默认["*"]
+	CORS            *CORSConfig `json:"cors,omitempty" yaml:"cors,omitempty"`       // CORS详细配置（方法、请求头、max-age等），为空时使用cors_origins和默认值
+	EnableRateLimit bool        `json:"enable_rate_limit" yaml:"enable_rate_limit"` // 是否启用限流，默认false
+	RateLimitRPM    int         `json:"rate_limit_rpm" yaml:"rate_limit_rpm"`       // 每分钟请求限制，默认1000
 
 	// 日志配置
 	LogLevel    string `json:"log_level" yaml:"log_level"`         // 日志级别，默认"info"
@@ -59,12 +60,16 @@ type ServerConfig struct {
 	HealthPath    string `json:"health_path" yaml:"health_path"`       // 健康检查路径，默认"/_health"
 
 	// API配置
-	MaxRequestSize int64  `json:"max_request_size" yaml:"max_request_size"` // 最大请求大小，默认100MB（Elasticsearch标准）
-	EnableSwagger  bool   `json:"enable_swagger" yaml:"enable_swagger"`     // 是否启用Swagger，默认false
-	SwaggerPath    string `json:"swagger_path" yaml:"swagger_path"`         // Swagger路径，默认"/swagger"
+	MaxRequestSize       int64  `json:"max_request_size" yaml:"max_request_size"`               // 最大请求大小，默认100MB（Elasticsearch标准）
+	MaxSearchRequestSize int64  `json:"max_search_request_size" yaml:"max_search_request_size"` // 搜索类请求（_search/_msearch/_count/_delete_by_query）的最大请求大小，默认10MB，0 使用 max_request_size
+	EnableSwagger        bool   `json:"enable_swagger" yaml:"enable_swagger"`                   // 是否启用Swagger，默认false
+	SwaggerPath          string `json:"swagger_path" yaml:"swagger_path"`                       // Swagger路径，默认"/swagger"
+
+	// 按路由的中间件配置（免认证、请求体大小限制、CORS），按顺序匹配
+	Routes []RouteConfig `json:"routes,omitempty" yaml:"routes,omitempty"`
 
 	// 其他配置
-	ShutdownTimeout time.Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"` // 关闭超时，默认30s
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"` // 关闭时等待进行中请求完成（排空）的超时，默认30s
 }
 
 // DefaultServerConfig 返回默认服务器配置
@@ -106,9 +111,10 @@ func DefaultServerConfig() *ServerConfig {
 		HealthPath:    "/_health",
 
 		// API配置
-		MaxRequestSize: 500 << 20, // 500MB (增加bulk请求大小限制，支持更大的批量操作)
-		EnableSwagger:  false,
-		SwaggerPath:    "/swagger",
+		MaxRequestSize:       500 << 20, // 500MB (增加bulk请求大小限制，支持更大的批量操作)
+		MaxSearchRequestSize: 10 << 20,  // 10MB，搜索请求体不需要 bulk 那样大的限制
+		EnableSwagger:        false,
+		SwaggerPath:          "/swagger",
 
 		// 其他配置
 		ShutdownTimeout: 30 * time.Second,
@@ -134,10 +140,31 @@ func (c *ServerConfig) Validate() error {
 		return fmt.Errorf("max_request_size must be greater than 0")
 	}
 
+	if c.MaxSearchRequestSize < 0 {
+		return fmt.Errorf("max_search_request_size cannot be negative")
+	}
+
 	if c.ShutdownTimeout <= 0 {
 		return fmt.Errorf("shutdown_timeout must be greater than 0")
 	}
 
+	cors := c.EffectiveCORS()
+	if err := cors.Validate(); err != nil {
+		return err
+	}
+
+	for i := range c.Routes {
+		rc := &c.Routes[i]
+		if err := rc.Validate(); err != nil {
+			return err
+		}
+		if rc.CORS != nil {
+			if err := rc.CORS.withDefaults(cors).Validate(); err != nil {
+				return fmt.Errorf("route [%s]: %w", rc.Name, err)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -164,6 +191,20 @@ func (c *ServerConfig) Clone() *ServerConfig {
 		clone.CORSOrigins = make([]string, len(c.CORSOrigins))
 		copy(clone.CORSOrigins, c.CORSOrigins)
 	}
+	if c.CORS != nil {
+		clone.CORS = c.CORS.clone()
+	}
+	if c.Routes != nil {
+		clone.Routes = make([]RouteConfig, len(c.Routes))
+		for i, rc := range c.Routes {
+			rc.Paths = cloneStrings(rc.Paths)
+			rc.Methods = cloneStrings(rc.Methods)
+			if rc.CORS != nil {
+				rc.CORS = rc.CORS.clone()
+			}
+			clone.Routes[i] = rc
+		}
+	}
 
 	return &clone
 }
@@ -93,6 +93,46 @@ func TestServerConfigValidate(t *testing.T) {
 			}(),
 			wantErr: true,
 		},
+		{
+			name: "cors credentials with wildcard origin",
+			config: func() *ServerConfig {
+				cfg := DefaultServerConfig()
+				cfg.CORS = &CORSConfig{AllowCredentials: true}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "route with misplaced **",
+			config: func() *ServerConfig {
+				cfg := DefaultServerConfig()
+				cfg.Routes = []RouteConfig{{Name: "bad", Paths: []string{"/**/_bulk"}}}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "route with invalid method",
+			config: func() *ServerConfig {
+				cfg := DefaultServerConfig()
+				cfg.Routes = []RouteConfig{{Name: "bad", Paths: []string{"/_bulk"}, Methods: []string{"post"}}}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "valid routes",
+			config: func() *ServerConfig {
+				cfg := DefaultServerConfig()
+				cfg.CORSOrigins = []string{"https://app.example.com"}
+				cfg.Routes = []RouteConfig{
+					{Name: "bulk", Paths: []string{"/_bulk", "/*/_bulk"}, Methods: []string{"POST"}, MaxRequestSize: 100 << 20},
+					{Name: "search", Paths: []string{"/*/_search"}, CORS: &CORSConfig{AllowCredentials: true}},
+				}
+				return cfg
+			}(),
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,124 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// readinessCheckTimeout 单个就绪检查的超时
+const readinessCheckTimeout = 5 * time.Second
+
+// ReadinessCheck 就绪检查，返回 nil 表示依赖可用
+type ReadinessCheck func(ctx context.Context) error
+
+// CheckResult 单个就绪检查的结果
+type CheckResult struct {
+	Status string `json:"status"` // ok 或 failed
+	Error  string `json:"error,omitempty"`
+}
+
+// AddReadinessCheck 注册就绪检查，name 出现在 /_health/ready 响应的 checks 中（需在 Start 之前调用）
+func (s *Server) AddReadinessCheck(name string, check ReadinessCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readinessChecks == nil {
+		s.readinessChecks = make(map[string]ReadinessCheck)
+	}
+	s.readinessChecks[name] = check
+}
+
+// Readiness 并发执行所有就绪检查，返回是否就绪与每个检查的结果
+// 服务器排空（关闭）期间总是返回未就绪
+func (s *Server) Readiness(ctx context.Context) (bool, map[string]CheckResult) {
+	s.mu.RLock()
+	checks := make(map[string]ReadinessCheck, len(s.readinessChecks))
+	for name, check := range s.readinessChecks {
+		checks[name] = check
+	}
+	draining := s.draining
+	s.mu.RUnlock()
+
+	results := make(map[string]CheckResult, len(checks)+1)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check ReadinessCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+			defer cancel()
+			result := CheckResult{Status: "ok"}
+			if err := check(checkCtx); err != nil {
+				result = CheckResult{Status: "failed", Error: err.Error()}
+			}
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	if draining {
+		results["server"] = CheckResult{Status: "failed", Error: "server is shutting down"}
+	}
+	ready := true
+	for _, result := range results {
+		if result.Status != "ok" {
+			ready = false
+		}
+	}
+	return ready, results
+}
+
+// livenessHandler 存活检查：进程能处理请求即返回 200，不检查依赖
+func (s *Server) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	s.healthCheckHandler(w, r)
+}
+
+// readinessHandler 就绪检查：所有依赖检查通过时返回 200，否则返回 503
+func (s *Server) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	ready, results := s.Readiness(r.Context())
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	failed := make([]string, 0)
+	for name, result := range results {
+		if result.Status != "ok" {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	response := map[string]interface{}{
+		"status": status,
+		"checks": results,
+	}
+	if len(failed) > 0 {
+		response["failed_checks"] = failed
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("ERROR: Failed to encode readiness response: %v", err)
+	}
+}
@@ -19,7 +19,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
@@ -53,30 +55,32 @@ func LoggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// CORSMiddleware CORS跨域中间件
+// CORSMiddleware CORS跨域中间件（允许的方法、请求头和max-age使用默认值）
 func CORSMiddleware(allowedOrigins []string) Middleware {
-	allowAll := len(allowedOrigins) == 1 && allowedOrigins[0] == "*"
+	return CORSConfigMiddleware(&ServerConfig{CORSOrigins: allowedOrigins})
+}
+
+// CORSConfigMiddleware 按服务器配置处理CORS：请求匹配的路由规则设置了 cors 时使用路由的配置
+func CORSConfigMiddleware(config *ServerConfig) Middleware {
+	cors := config.EffectiveCORS()
+	global := newCORSPolicy(cors)
+	routePolicies := make(map[*RouteConfig]*corsPolicy)
+	for i := range config.Routes {
+		if rc := &config.Routes[i]; rc.CORS != nil {
+			routePolicies[rc] = newCORSPolicy(rc.CORS.withDefaults(cors))
+		}
+	}
 
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			origin := r.Header.Get("Origin")
-
-			// 检查Origin是否被允许
-			allowed := allowAll
-			if !allowed {
-				for _, allowedOrigin := range allowedOrigins {
-					if origin == allowedOrigin {
-						allowed = true
-						break
-					}
-				}
+			policy := global
+			if p := routePolicies[RouteConfigFromContext(r.Context())]; p != nil {
+				policy = p
 			}
 
-			if allowed {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, HEAD")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-				w.Header().Set("Access-Control-Max-Age", "86400") // 24小时
+			origin := r.Header.Get("Origin")
+			if origin != "" && policy.allowOrigin(origin) {
+				policy.setHeaders(w.Header(), r)
 				// 告知缓存代理不同Origin的响应可能不同
 				w.Header().Add("Vary", "Origin")
 			}
@@ -92,6 +96,84 @@ func CORSMiddleware(allowedOrigins []string) Middleware {
 	}
 }
 
+// corsPolicy 预先计算好响应头的CORS配置
+type corsPolicy struct {
+	allowAll       bool
+	origins        map[string]bool
+	wildcards      [][2]string // 子域名通配的前缀和后缀，如 "https://" 和 ".example.com"
+	methods        string
+	headers        string
+	allowAnyHeader bool
+	exposedHeaders string
+	credentials    bool
+	maxAge         string
+}
+
+func newCORSPolicy(config *CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		origins:        make(map[string]bool),
+		methods:        strings.Join(config.AllowedMethods, ", "),
+		exposedHeaders: strings.Join(config.ExposedHeaders, ", "),
+		credentials:    config.AllowCredentials,
+		maxAge:         strconv.Itoa(int(config.MaxAge / time.Second)),
+	}
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			p.allowAll = true
+		} else if i := strings.Index(origin, "*"); i >= 0 {
+			p.wildcards = append(p.wildcards, [2]string{origin[:i], origin[i+1:]})
+		} else {
+			p.origins[origin] = true
+		}
+	}
+	var headers []string
+	for _, header := range config.AllowedHeaders {
+		if header == "*" {
+			p.allowAnyHeader = true
+		} else {
+			headers = append(headers, header)
+		}
+	}
+	p.headers = strings.Join(headers, ", ")
+	return p
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.allowAll || p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(origin) > len(w[0])+len(w[1]) && strings.HasPrefix(origin, w[0]) && strings.HasSuffix(origin, w[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) setHeaders(h http.Header, r *http.Request) {
+	h.Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if r.Method != http.MethodOptions {
+		if p.exposedHeaders != "" {
+			h.Set("Access-Control-Expose-Headers", p.exposedHeaders)
+		}
+		return
+	}
+
+	// 预检请求
+	h.Set("Access-Control-Allow-Methods", p.methods)
+	headers := p.headers
+	if requested := r.Header.Get("Access-Control-Request-Headers"); p.allowAnyHeader && requested != "" {
+		headers = requested
+	}
+	if headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+	h.Set("Access-Control-Max-Age", p.maxAge)
+}
+
 // RateLimitMiddleware 限流中间件
 func RateLimitMiddleware(rpm int) Middleware {
 	if rpm <= 0 {
@@ -129,6 +211,64 @@ func RateLimitMiddleware(rpm int) Middleware {
 	}
 }
 
+// KeyedRateLimiter 按键（如 API Key）独立计数的令牌桶限流器
+// 令牌按请求时间补充，不需要后台 goroutine；桶容量为每分钟请求数，允许一分钟内的突发
+type KeyedRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewKeyedRateLimiter 创建按键限流器
+func NewKeyedRateLimiter() *KeyedRateLimiter {
+	return &KeyedRateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow 消耗键的一个令牌，返回是否放行；rpm <= 0 表示不限流
+func (l *KeyedRateLimiter) Allow(key string, rpm int) bool {
+	if rpm <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(rpm), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Minutes() * float64(rpm)
+	if b.tokens > float64(rpm) {
+		b.tokens = float64(rpm)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// KeyedRateLimitMiddleware 按键限流中间件，limit 返回请求的限流键与每分钟请求数（键为空或 rpm <= 0 时不限流）
+func KeyedRateLimitMiddleware(limiter *KeyedRateLimiter, limit func(r *http.Request) (string, int)) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if key, rpm := limit(r); key != "" && !limiter.Allow(key, rpm) {
+				if err := common.ErrorResponse("rate_limit_exceeded", "too many requests").WriteJSON(w, http.StatusTooManyRequests); err != nil {
+					log.Printf("ERROR: Failed to write rate limit error response: %v", err)
+				}
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
 // RecoveryMiddleware 错误恢复中间件
 func RecoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -145,14 +285,35 @@ func RecoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// RequestSizeLimitMiddleware 请求大小限制中间件
-func RequestSizeLimitMiddleware(maxSize int64) Middleware {
+// RequestSizeLimitMiddleware 请求大小限制中间件，请求匹配的路由规则设置了 max_request_size 时使用规则的限制
+func RequestSizeLimitMiddleware(defaultMaxSize int64) Middleware {
+	return requestSizeLimitMiddleware(func(*http.Request) int64 { return defaultMaxSize })
+}
+
+// RequestSizeLimitConfigMiddleware 按服务器配置限制请求大小：路由规则的 max_request_size 优先，
+// 其次搜索类请求使用 max_search_request_size，其他请求使用 max_request_size
+func RequestSizeLimitConfigMiddleware(config *ServerConfig) Middleware {
+	return requestSizeLimitMiddleware(func(r *http.Request) int64 {
+		if config.MaxSearchRequestSize > 0 && isSearchPath(r.URL.Path) {
+			return config.MaxSearchRequestSize
+		}
+		return config.MaxRequestSize
+	})
+}
+
+func requestSizeLimitMiddleware(defaultLimit func(*http.Request) int64) Middleware {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
+			maxSize := defaultLimit(r)
+			if rc := RouteConfigFromContext(r.Context()); rc != nil && rc.MaxRequestSize > 0 {
+				maxSize = rc.MaxRequestSize
+			}
+
 			// 检查 ContentLength（如果存在且大于限制，直接拒绝）
 			// 注意：对于 chunked 编码，ContentLength 为 -1，需要依赖 MaxBytesReader
 			if r.ContentLength > 0 && r.ContentLength > maxSize {
-				if err := common.NewBadRequestError("request body too large").Response().WriteJSON(w, http.StatusBadRequest); err != nil {
+				apiErr := common.NewContentTooLargeError(maxSize)
+				if err := apiErr.Response().WriteJSON(w, apiErr.StatusCode()); err != nil {
 					log.Printf("ERROR: Failed to write request size limit error response: %v", err)
 				}
 				return
@@ -160,13 +321,24 @@ func RequestSizeLimitMiddleware(maxSize int64) Middleware {
 
 			// 设置最大读取大小
 			// http.MaxBytesReader 会在读取时限制大小，即使 ContentLength 未知（chunked 编码）
-			// 如果超过限制，会返回 "http: request body too large" 错误
+			// 如果超过限制，读取返回 *http.MaxBytesError，处理器通过 common.NewRequestBodyError 返回 413
 			r.Body = http.MaxBytesReader(w, r.Body, maxSize)
 			next(w, r)
 		}
 	}
 }
 
+// isSearchPath 返回路径是否为搜索类请求（_search、_msearch、_count、_delete_by_query）
+func isSearchPath(path string) bool {
+	for _, segment := range splitRoutePath(path) {
+		switch segment {
+		case "_search", "_msearch", "_count", "_delete_by_query", "_export_search":
+			return true
+		}
+	}
+	return false
+}
+
 // TimeoutMiddleware 超时中间件
 func TimeoutMiddleware(timeout time.Duration) Middleware {
 	return func(next http.HandlerFunc) http.HandlerFunc {
@@ -255,6 +427,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap 返回被包装的 ResponseWriter，供 http.ResponseController 刷新响应与设置写超时
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // ChainMiddleware 链式组合多个中间件
 func ChainMiddleware(middlewares ...Middleware) Middleware {
 	return func(next http.HandlerFunc) http.HandlerFunc {
@@ -270,14 +447,15 @@ func ChainMiddleware(middlewares ...Middleware) Middleware {
 func DefaultMiddlewareStack(config *ServerConfig) Middleware {
 	middlewares := []Middleware{
 		RecoveryMiddleware,
-		GzipDecompressMiddleware, // gzip解压缩应该在请求大小限制之前
+		RouteConfigMiddleware(config), // 在路由分发前匹配路由规则，供请求大小限制、CORS和认证使用
+		GzipDecompressMiddleware,      // gzip解压缩应该在请求大小限制之前
 		LoggingMiddleware,
 		SecurityHeadersMiddleware,
-		RequestSizeLimitMiddleware(config.MaxRequestSize),
+		RequestSizeLimitConfigMiddleware(config),
 	}
 
 	if config.EnableCORS {
-		middlewares = append(middlewares, CORSMiddleware(config.CORSOrigins))
+		middlewares = append(middlewares, CORSConfigMiddleware(config))
 	}
 
 	if config.EnableRateLimit {
@@ -48,6 +48,124 @@ func TestCORSMiddleware(t *testing.T) {
 	}
 }
 
+func TestCORSConfigMiddleware(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.CORS = &CORSConfig{
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		ExposedHeaders: []string{"X-Elastic-Product"},
+		MaxAge:         10 * time.Minute,
+	}
+	cfg.Routes = []RouteConfig{{
+		Name:  "search",
+		Paths: []string{"/*/_search"},
+		CORS:  &CORSConfig{AllowedOrigins: []string{"https://search.example.org"}, AllowedHeaders: []string{"*"}, AllowCredentials: true},
+	}}
+	h := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	handler := ChainMiddleware(RouteConfigMiddleware(cfg), CORSConfigMiddleware(cfg))(h)
+
+	do := func(method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := do("OPTIONS", "/_cat/indices", "https://app.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Fatalf("wildcard origin not allowed, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Fatalf("unexpected allow methods %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, Authorization, X-Requested-With" {
+		t.Fatalf("unexpected allow headers %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Fatalf("unexpected max age %q", got)
+	}
+
+	w = do("GET", "/_cat/indices", "https://app.example.com")
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Elastic-Product" {
+		t.Fatalf("unexpected expose headers %q", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Fatal("allow methods should only be set for preflight requests")
+	}
+
+	w = do("GET", "/_cat/indices", "https://evil.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("disallowed origin got cors headers")
+	}
+
+	// 路由规则覆盖全局配置
+	w = do("OPTIONS", "/logs/_search", "https://search.example.org")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://search.example.org" {
+		t.Fatalf("route origin not allowed, got %q", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatal("route allow credentials missing")
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "X-Custom" {
+		t.Fatalf("requested headers not reflected, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Fatalf("route max age should inherit global config, got %q", got)
+	}
+	if w = do("GET", "/logs/_search", "https://app.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("route cors should replace global origins")
+	}
+}
+
+func TestRouteConfigRequestSizeLimit(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.MaxRequestSize = 10
+	cfg.Routes = []RouteConfig{{Name: "bulk", Paths: []string{"/_bulk", "/*/_bulk"}, Methods: []string{"POST"}, MaxRequestSize: 100}}
+	h := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	handler := ChainMiddleware(RouteConfigMiddleware(cfg), RequestSizeLimitMiddleware(cfg.MaxRequestSize))(h)
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{"POST", "/logs/_bulk", http.StatusOK},
+		{"POST", "/_bulk", http.StatusOK},
+		{"PUT", "/logs/_bulk", http.StatusRequestEntityTooLarge},
+		{"POST", "/logs/_search", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(strings.Repeat("x", 50)))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected %d got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestRouteConfigMatches(t *testing.T) {
+	rc := &RouteConfig{Paths: []string{"/_cat/**", "/*/_doc/*"}}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/_cat", true},
+		{"/_cat/indices/logs", true},
+		{"/logs/_doc/1", true},
+		{"/logs/_doc", false},
+		{"/logs/_doc/1/extra", false},
+		{"/_search", false},
+	}
+	for _, tt := range tests {
+		if got := rc.Matches("GET", tt.path); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
 func TestRateLimitMiddleware(t *testing.T) {
 	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
 	rl := RateLimitMiddleware(60)(h) // 1 token per second
@@ -131,8 +249,8 @@ func TestRequestSizeLimitMiddleware(t *testing.T) {
 	req2.ContentLength = int64(len(large))
 	w2 := httptest.NewRecorder()
 	sizeLimit.ServeHTTP(w2, req2)
-	if w2.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400 got %d", w2.Code)
+	if w2.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 got %d", w2.Code)
 	}
 }
 
@@ -212,3 +330,34 @@ func TestTimeoutMiddlewareDisabled(t *testing.T) {
 		t.Fatalf("expected 200 got %d", w.Code)
 	}
 }
+
+func TestKeyedRateLimitMiddleware(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	limits := map[string]int{"a": 2, "b": 0}
+	rl := KeyedRateLimitMiddleware(NewKeyedRateLimiter(), func(r *http.Request) (string, int) {
+		key := r.Header.Get("X-Key")
+		return key, limits[key]
+	})(h)
+	do := func(key string) int {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("X-Key", key)
+		w := httptest.NewRecorder()
+		rl.ServeHTTP(w, req)
+		return w.Code
+	}
+	// 桶容量为 rpm，超出后返回 429，其它键不受影响
+	if do("a") != http.StatusOK || do("a") != http.StatusOK {
+		t.Fatalf("expected the first 2 requests of key a to pass")
+	}
+	if code := do("a"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 got %d", code)
+	}
+	for i := 0; i < 5; i++ {
+		if code := do("b"); code != http.StatusOK {
+			t.Fatalf("expected key without limit to pass, got %d", code)
+		}
+	}
+	if code := do(""); code != http.StatusOK {
+		t.Fatalf("expected request without key to pass, got %d", code)
+	}
+}
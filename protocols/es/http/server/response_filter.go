@@ -0,0 +1,395 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 响应过滤与格式化（所有端点通用的查询参数）：
+//   - filter_path=took,hits.hits._id 只保留匹配的路径，逗号分隔多个路径；路径按 "." 分段，
+//     * 匹配段内任意字符，** 匹配任意层级，数组对每个元素应用同样的路径；以 - 开头的路径表示排除
+//   - pretty 缩进输出
+//   - human 为 *_in_bytes、*_in_millis、*_in_nanos 字段添加去掉后缀的可读值（如 "1.2kb"、"150ms"）
+// 只处理 JSON 响应：指定了参数时缓冲整个响应后改写，其他响应（NDJSON、CSV、归档等流式输出）原样写出。
+
+// ResponseFilterMiddleware 按 filter_path、pretty 与 human 参数改写 JSON 响应
+func ResponseFilterMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts := parseResponseFilterOptions(r)
+		if opts == nil {
+			next(w, r)
+			return
+		}
+		fw := &filterResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next(fw, r)
+		fw.finish(opts, r.Method == http.MethodHead)
+	}
+}
+
+// responseFilterOptions 响应过滤参数
+type responseFilterOptions struct {
+	includes [][]string
+	excludes [][]string
+	pretty   bool
+	human    bool
+}
+
+// parseResponseFilterOptions 解析响应过滤参数，没有指定任何参数时返回 nil
+// 与 ES 一致，?pretty 与 ?human 不带值时视为 true
+func parseResponseFilterOptions(r *http.Request) *responseFilterOptions {
+	query := r.URL.Query()
+	opts := &responseFilterOptions{
+		pretty: queryFlag(query, "pretty"),
+		human:  queryFlag(query, "human"),
+	}
+	for _, p := range strings.Split(query.Get("filter_path"), ",") {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "-") {
+			if p = strings.TrimPrefix(p, "-"); p != "" {
+				opts.excludes = append(opts.excludes, strings.Split(p, "."))
+			}
+		} else if p != "" {
+			opts.includes = append(opts.includes, strings.Split(p, "."))
+		}
+	}
+	if !opts.pretty && !opts.human && len(opts.includes) == 0 && len(opts.excludes) == 0 {
+		return nil
+	}
+	return opts
+}
+
+// queryFlag 读取布尔查询参数，参数存在但没有值时为 true，无法解析时为 false
+func queryFlag(query map[string][]string, name string) bool {
+	values, ok := query[name]
+	if !ok {
+		return false
+	}
+	if len(values) == 0 || values[0] == "" {
+		return true
+	}
+	b, _ := strconv.ParseBool(values[0])
+	return b
+}
+
+// filterResponseWriter 缓冲 JSON 响应，非 JSON 响应直接写出
+type filterResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	passthrough bool
+	body        bytes.Buffer
+}
+
+func (w *filterResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.statusCode = statusCode
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if mediaType != "application/json" {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (w *filterResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// Flush 支持流式响应，缓冲的 JSON 响应在处理器返回后一次写出
+func (w *filterResponseWriter) Flush() {
+	if !w.passthrough {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 返回被包装的 ResponseWriter，供 http.ResponseController 设置写超时
+func (w *filterResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish 改写缓冲的 JSON 响应并写出，响应不是合法 JSON 时原样写出
+func (w *filterResponseWriter) finish(opts *responseFilterOptions, head bool) {
+	if !w.wroteHeader {
+		// 处理器没有写出任何内容
+		return
+	}
+	if w.passthrough {
+		return
+	}
+	body := w.body.Bytes()
+	if out, err := rewriteJSONResponse(body, opts); err == nil {
+		body = out
+	}
+	// 响应已完整缓冲，改用 Content-Length（流式响应会设置 chunked）
+	w.Header().Del("Transfer-Encoding")
+	if !head {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	if !head {
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// rewriteJSONResponse 按参数过滤、补充可读值并格式化 JSON
+// 只有 pretty 时直接缩进原始 JSON，保留字段顺序
+func rewriteJSONResponse(body []byte, opts *responseFilterOptions) ([]byte, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+	if len(opts.includes) == 0 && len(opts.excludes) == 0 && !opts.human {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, bytes.TrimSpace(body), "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	// 与 ES 一致，先补充可读值再过滤，filter_path 可以选择可读值字段
+	if opts.human {
+		addHumanReadableValues(value)
+	}
+	if len(opts.includes) > 0 {
+		var ok bool
+		if value, ok = includeFilterPaths(value, opts.includes); !ok {
+			value = map[string]interface{}{}
+		}
+	}
+	if len(opts.excludes) > 0 {
+		value = excludeFilterPaths(value, opts.excludes)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	if opts.pretty {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// nextFilterPaths 返回路径在匹配对象字段 key 之后剩余的部分，matched 表示有路径在 key 处完整匹配
+func nextFilterPaths(paths [][]string, key string) (next [][]string, matched bool) {
+	for _, p := range paths {
+		if len(p) == 0 {
+			continue
+		}
+		if p[0] == "**" {
+			// ** 匹配零层（用后续段匹配当前字段）或多层（继续向下匹配）
+			next = append(next, p)
+			if len(p) == 1 {
+				matched = true
+				continue
+			}
+			rest, restMatched := nextFilterPaths([][]string{p[1:]}, key)
+			next = append(next, rest...)
+			matched = matched || restMatched
+			continue
+		}
+		if matchFilterSegment(p[0], key) {
+			if len(p) == 1 {
+				matched = true
+			} else {
+				next = append(next, p[1:])
+			}
+		}
+	}
+	return next, matched
+}
+
+// matchFilterSegment 匹配路径段，* 匹配任意字符
+func matchFilterSegment(pattern, key string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == key
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(key, parts[0]) {
+		return false
+	}
+	key = key[len(parts[0]):]
+	for i := 1; i < len(parts)-1; i++ {
+		idx := strings.Index(key, parts[i])
+		if idx < 0 {
+			return false
+		}
+		key = key[idx+len(parts[i]):]
+	}
+	return strings.HasSuffix(key, parts[len(parts)-1])
+}
+
+// includeFilterPaths 只保留匹配路径的字段，没有任何字段匹配时返回 false
+func includeFilterPaths(value interface{}, paths [][]string) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for key, child := range v {
+			next, matched := nextFilterPaths(paths, key)
+			if matched {
+				out[key] = child
+				continue
+			}
+			if len(next) > 0 {
+				if filtered, ok := includeFilterPaths(child, next); ok {
+					out[key] = filtered
+				}
+			}
+		}
+		return out, len(out) > 0
+	case []interface{}:
+		var out []interface{}
+		for _, item := range v {
+			if filtered, ok := includeFilterPaths(item, paths); ok {
+				out = append(out, filtered)
+			}
+		}
+		return out, len(out) > 0
+	default:
+		return nil, false
+	}
+}
+
+// excludeFilterPaths 删除匹配路径的字段
+func excludeFilterPaths(value interface{}, paths [][]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			next, matched := nextFilterPaths(paths, key)
+			if matched {
+				continue
+			}
+			if len(next) > 0 {
+				child = excludeFilterPaths(child, next)
+			}
+			out[key] = child
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = excludeFilterPaths(item, paths)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// addHumanReadableValues 为 *_in_bytes、*_in_millis、*_in_nanos 数值字段添加去掉后缀的可读值，已有同名字段时不覆盖
+func addHumanReadableValues(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		added := make(map[string]interface{})
+		for key, child := range v {
+			addHumanReadableValues(child)
+			n, ok := child.(json.Number)
+			if !ok {
+				continue
+			}
+			f, err := n.Float64()
+			if err != nil {
+				continue
+			}
+			var name, human string
+			switch {
+			case strings.HasSuffix(key, "_in_bytes"):
+				name, human = strings.TrimSuffix(key, "_in_bytes"), humanBytes(f)
+			case strings.HasSuffix(key, "_in_millis"):
+				name, human = strings.TrimSuffix(key, "_in_millis"), humanDuration(f*1e6)
+			case strings.HasSuffix(key, "_in_nanos"):
+				name, human = strings.TrimSuffix(key, "_in_nanos"), humanDuration(f)
+			default:
+				continue
+			}
+			if _, exists := v[name]; !exists && name != "" {
+				added[name] = human
+			}
+		}
+		for key, human := range added {
+			v[key] = human
+		}
+	case []interface{}:
+		for _, item := range v {
+			addHumanReadableValues(item)
+		}
+	}
+}
+
+// humanBytes 格式化字节数，如 512b、1.2kb、10mb
+func humanBytes(n float64) string {
+	units := []string{"b", "kb", "mb", "gb", "tb", "pb"}
+	i := 0
+	for math.Abs(n) >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return formatHumanNumber(n) + units[i]
+}
+
+// humanDuration 格式化纳秒时长，如 150ms、1.2s、2.5m、1d
+func humanDuration(nanos float64) string {
+	if nanos == 0 {
+		return "0s"
+	}
+	units := []struct {
+		name string
+		size float64
+	}{
+		{"d", 24 * 3600 * 1e9},
+		{"h", 3600 * 1e9},
+		{"m", 60 * 1e9},
+		{"s", 1e9},
+		{"ms", 1e6},
+		{"micros", 1e3},
+	}
+	for _, u := range units {
+		if math.Abs(nanos) >= u.size {
+			return formatHumanNumber(nanos/u.size) + u.name
+		}
+	}
+	return formatHumanNumber(nanos) + "nanos"
+}
+
+// formatHumanNumber 保留一位小数，去掉末尾的 .0
+func formatHumanNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*10)/10, 'f', -1, 64)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestResponseFilterMiddleware(t *testing.T) {
+	const searchResponse = `{"took":5,"timed_out":false,"hits":{"total":{"value":2,"relation":"eq"},"hits":[` +
+		`{"_index":"orders","_id":"1","_source":{"region":"eu","amount":10}},` +
+		`{"_index":"orders","_id":"2","_source":{"region":"us","amount":20}}]}}`
+	const statsResponse = `{"store":{"size_in_bytes":1288490,"size":"custom"},"search":{"query_time_in_millis":1500,"query_total":3},` +
+		`"indexing":{"index_time_in_nanos":0}}`
+	respond := func(contentType, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(body))
+		}
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+		want string
+	}{
+		{"no parameters", "/orders/_search", searchResponse, searchResponse},
+		{"include paths", "/orders/_search?filter_path=took,hits.hits._id", searchResponse,
+			`{"hits":{"hits":[{"_id":"1"},{"_id":"2"}]},"took":5}` + "\n"},
+		{"wildcard segment", "/orders/_search?filter_path=hits.hits._source.reg*", searchResponse,
+			`{"hits":{"hits":[{"_source":{"region":"eu"}},{"_source":{"region":"us"}}]}}` + "\n"},
+		{"double wildcard", "/orders/_search?filter_path=**.amount", searchResponse,
+			`{"hits":{"hits":[{"_source":{"amount":10}},{"_source":{"amount":20}}]}}` + "\n"},
+		{"exclude paths", "/orders/_search?filter_path=-hits.hits._source,-timed_out", searchResponse,
+			`{"hits":{"hits":[{"_id":"1","_index":"orders"},{"_id":"2","_index":"orders"}],"total":{"relation":"eq","value":2}},"took":5}` + "\n"},
+		{"include and exclude", "/orders/_search?filter_path=hits.hits,-**._source", searchResponse,
+			`{"hits":{"hits":[{"_id":"1","_index":"orders"},{"_id":"2","_index":"orders"}]}}` + "\n"},
+		{"nothing matches", "/orders/_search?filter_path=missing", searchResponse, "{}\n"},
+		{"pretty keeps field order", "/?pretty", `{"name":"tigerdb","cluster_name":"tigerdb","version":{"number":"8.11.0"}}`,
+			"{\n  \"name\": \"tigerdb\",\n  \"cluster_name\": \"tigerdb\",\n  \"version\": {\n    \"number\": \"8.11.0\"\n  }\n}\n"},
+		{"pretty with filter", "/orders/_search?pretty=true&filter_path=took", searchResponse, "{\n  \"took\": 5\n}\n"},
+		{"pretty false", "/orders/_search?pretty=false", searchResponse, searchResponse},
+		{"human", "/_stats?human", statsResponse,
+			`{"indexing":{"index_time":"0s","index_time_in_nanos":0},"search":{"query_time":"1.5s","query_time_in_millis":1500,"query_total":3},` +
+				`"store":{"size":"custom","size_in_bytes":1288490}}` + "\n"},
+		{"human with filter", "/_stats?human&filter_path=search.query_time", statsResponse, `{"search":{"query_time":"1.5s"}}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ResponseFilterMiddleware(respond("application/json", tt.body))(w, httptest.NewRequest("GET", tt.url, nil))
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if tt.body != tt.want && w.Header().Get("Content-Length") != strconv.Itoa(len(tt.want)) {
+				t.Errorf("Unexpected Content-Length %s", w.Header().Get("Content-Length"))
+			}
+		})
+	}
+
+	// 非 JSON 响应原样写出
+	w := httptest.NewRecorder()
+	ResponseFilterMiddleware(respond("application/x-ndjson", "{\"a\":1}\n{\"a\":2}\n"))(w, httptest.NewRequest("POST", "/orders/_export_search?filter_path=a", nil))
+	if w.Body.String() != "{\"a\":1}\n{\"a\":2}\n" {
+		t.Errorf("Expected ndjson to be written unchanged, got %q", w.Body.String())
+	}
+
+	// 错误响应同样过滤，保留状态码
+	w = httptest.NewRecorder()
+	ResponseFilterMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"type":"index_not_found_exception","reason":"no such index"},"status":404}`))
+	})(w, httptest.NewRequest("GET", "/missing/_search?filter_path=error.type", nil))
+	if w.Code != http.StatusNotFound || w.Body.String() != `{"error":{"type":"index_not_found_exception"}}`+"\n" {
+		t.Errorf("Unexpected filtered error response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHumanReadableFormat(t *testing.T) {
+	for in, want := range map[float64]string{0: "0b", 512: "512b", 1024: "1kb", 1536: "1.5kb", 10 * 1024 * 1024: "10mb"} {
+		if got := humanBytes(in); got != want {
+			t.Errorf("humanBytes(%v) = %s, want %s", in, got, want)
+		}
+	}
+	for in, want := range map[float64]string{150: "150nanos", 1500: "1.5micros", 150e6: "150ms", 90e9: "1.5m", 2 * 24 * 3600e9: "2d"} {
+		if got := humanDuration(in); got != want {
+			t.Errorf("humanDuration(%v) = %s, want %s", in, got, want)
+		}
+	}
+}
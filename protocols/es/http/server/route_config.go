@@ -0,0 +1,231 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 默认 CORS 配置
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization", "X-Requested-With"}
+)
+
+const defaultCORSMaxAge = 24 * time.Hour
+
+// CORSConfig CORS跨域配置，未设置的字段使用默认值
+type CORSConfig struct {
+	AllowedOrigins   []string      `json:"allowed_origins" yaml:"allowed_origins"`     // 允许的源，支持"*"和"https://*.example.com"形式的子域名通配，默认使用cors_origins
+	AllowedMethods   []string      `json:"allowed_methods" yaml:"allowed_methods"`     // 允许的方法，默认GET, POST, PUT, DELETE, OPTIONS, HEAD
+	AllowedHeaders   []string      `json:"allowed_headers" yaml:"allowed_headers"`     // 允许的请求头，"*"表示允许预检请求声明的所有请求头
+	ExposedHeaders   []string      `json:"exposed_headers" yaml:"exposed_headers"`     // 允许浏览器读取的响应头
+	AllowCredentials bool          `json:"allow_credentials" yaml:"allow_credentials"` // 是否允许携带Cookie/认证信息
+	MaxAge           time.Duration `json:"max_age" yaml:"max_age"`                     // 预检结果缓存时间，默认24h
+}
+
+// Validate 验证CORS配置
+func (c *CORSConfig) Validate() error {
+	if c.MaxAge < 0 {
+		return fmt.Errorf("cors max_age cannot be negative")
+	}
+	for _, method := range c.AllowedMethods {
+		if !isHTTPMethod(method) {
+			return fmt.Errorf("invalid cors allowed method [%s]", method)
+		}
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" && c.AllowCredentials {
+			return fmt.Errorf("cors allow_credentials cannot be used with allowed origin [*]")
+		}
+	}
+	return nil
+}
+
+// withDefaults 返回以 base 补全未设置字段后的配置副本
+func (c *CORSConfig) withDefaults(base *CORSConfig) *CORSConfig {
+	merged := *c
+	if len(merged.AllowedOrigins) == 0 {
+		merged.AllowedOrigins = base.AllowedOrigins
+	}
+	if len(merged.AllowedMethods) == 0 {
+		merged.AllowedMethods = base.AllowedMethods
+	}
+	if len(merged.AllowedHeaders) == 0 {
+		merged.AllowedHeaders = base.AllowedHeaders
+	}
+	if len(merged.ExposedHeaders) == 0 {
+		merged.ExposedHeaders = base.ExposedHeaders
+	}
+	if merged.MaxAge == 0 {
+		merged.MaxAge = base.MaxAge
+	}
+	return &merged
+}
+
+func (c *CORSConfig) clone() *CORSConfig {
+	clone := *c
+	clone.AllowedOrigins = cloneStrings(c.AllowedOrigins)
+	clone.AllowedMethods = cloneStrings(c.AllowedMethods)
+	clone.AllowedHeaders = cloneStrings(c.AllowedHeaders)
+	clone.ExposedHeaders = cloneStrings(c.ExposedHeaders)
+	return &clone
+}
+
+// EffectiveCORS 返回全局生效的CORS配置：cors 中未设置的字段使用 cors_origins 和默认值
+func (c *ServerConfig) EffectiveCORS() *CORSConfig {
+	base := &CORSConfig{
+		AllowedOrigins: c.CORSOrigins,
+		AllowedMethods: defaultCORSMethods,
+		AllowedHeaders: defaultCORSHeaders,
+		MaxAge:         defaultCORSMaxAge,
+	}
+	if c.CORS == nil {
+		return base
+	}
+	return c.CORS.withDefaults(base)
+}
+
+// RouteConfig 按路由覆盖中间件行为（免认证、请求体大小限制、CORS），按配置顺序匹配，第一个匹配的规则生效
+type RouteConfig struct {
+	Name           string      `json:"name" yaml:"name"`                         // 规则名称（端点类别），如"bulk"、"search"
+	Paths          []string    `json:"paths" yaml:"paths"`                       // 路径模式："*"匹配单个路径段，末尾的"**"匹配剩余任意路径，如"/_bulk"、"/*/_bulk"、"/_cat/**"
+	Methods        []string    `json:"methods" yaml:"methods"`                   // 匹配的请求方法，为空匹配全部
+	AuthExempt     bool        `json:"auth_exempt" yaml:"auth_exempt"`           // 是否免认证
+	MaxRequestSize int64       `json:"max_request_size" yaml:"max_request_size"` // 请求体大小限制，0 使用全局 max_request_size
+	CORS           *CORSConfig `json:"cors" yaml:"cors"`                         // 覆盖全局CORS配置（需启用enable_cors），未设置的字段使用全局配置
+}
+
+// Validate 验证路由配置
+func (rc *RouteConfig) Validate() error {
+	if len(rc.Paths) == 0 {
+		return fmt.Errorf("route [%s] must have at least one path", rc.Name)
+	}
+	for _, pattern := range rc.Paths {
+		if !strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf("route [%s] path [%s] must start with /", rc.Name, pattern)
+		}
+		segments := splitRoutePath(pattern)
+		for i, segment := range segments {
+			if segment == "**" && i != len(segments)-1 {
+				return fmt.Errorf("route [%s] path [%s]: ** is only allowed as the last segment", rc.Name, pattern)
+			}
+		}
+	}
+	for _, method := range rc.Methods {
+		if !isHTTPMethod(method) {
+			return fmt.Errorf("route [%s] has invalid method [%s]", rc.Name, method)
+		}
+	}
+	if rc.MaxRequestSize < 0 {
+		return fmt.Errorf("route [%s] max_request_size cannot be negative", rc.Name)
+	}
+	return nil
+}
+
+// Matches 返回请求方法和路径是否匹配该规则
+func (rc *RouteConfig) Matches(method, path string) bool {
+	if len(rc.Methods) > 0 {
+		matched := false
+		for _, m := range rc.Methods {
+			if m == method {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	segments := splitRoutePath(path)
+	for _, pattern := range rc.Paths {
+		if matchRouteSegments(splitRoutePath(pattern), segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchRoute 返回请求匹配的第一个路由规则，没有匹配时返回 nil
+func (c *ServerConfig) MatchRoute(method, path string) *RouteConfig {
+	for i := range c.Routes {
+		if c.Routes[i].Matches(method, path) {
+			return &c.Routes[i]
+		}
+	}
+	return nil
+}
+
+func matchRouteSegments(pattern, segments []string) bool {
+	for i, p := range pattern {
+		if p == "**" {
+			return true
+		}
+		if i >= len(segments) || (p != "*" && p != segments[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
+
+func splitRoutePath(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+func isHTTPMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
+
+type routeConfigContextKey struct{}
+
+// RouteConfigMiddleware 在路由分发（及请求路径改写）之前匹配路由规则，保存到请求 context 中
+func RouteConfigMiddleware(config *ServerConfig) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if rc := config.MatchRoute(r.Method, r.URL.Path); rc != nil {
+				r = r.WithContext(context.WithValue(r.Context(), routeConfigContextKey{}, rc))
+			}
+			next(w, r)
+		}
+	}
+}
+
+// RouteConfigFromContext 返回请求匹配的路由规则，没有匹配时返回 nil
+func RouteConfigFromContext(ctx context.Context) *RouteConfig {
+	rc, _ := ctx.Value(routeConfigContextKey{}).(*RouteConfig)
+	return rc
+}
@@ -26,6 +26,7 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -39,9 +40,14 @@ type Server struct {
 	httpServer *http.Server
 	middleware Middleware
 	started    bool
+	draining   bool // 正在排空：不再接受新连接，等待进行中的请求完成
 	mu         sync.RWMutex
+	inFlight   atomic.Int64 // 进行中的请求数
 	startTime  time.Time
 	listener   net.Listener // 用于端口 0 时获取实际端口
+
+	metricsSources  map[string]func() interface{} // 附加到 /_metrics 的指标来源
+	readinessChecks map[string]ReadinessCheck     // /_health/ready 执行的就绪检查
 }
 
 // NewServer 创建新的HTTP服务器
@@ -67,6 +73,11 @@ func NewServer(config *ServerConfig) (*Server, error) {
 	return server, nil
 }
 
+// Use 在默认中间件栈之后追加全局中间件（需在 Start 之前调用）
+func (s *Server) Use(middlewares ...Middleware) {
+	s.middleware = ChainMiddleware(append([]Middleware{s.middleware}, middlewares...)...)
+}
+
 // GetRouter 获取路由管理器
 func (s *Server) GetRouter() *Router {
 	return s.router
@@ -93,20 +104,12 @@ func (s *Server) Start() error {
 	s.startTime = time.Now()
 	s.mu.Unlock()
 
-	// 构建路由器
-	muxRouter := s.router.Build()
-
-	// 在构建的路由器上直接添加全局路由，确保它们有最高优先级
-	// 注意：这里假设 ESServer 有访问处理器的方法
-	// 由于这是 HTTP 服务器层，我们需要通过其他方式访问处理器
-	// 暂时注释掉，稍后在 ES 层处理
-
 	// 创建HTTP服务器
 	// 注意：Go 的 http.Server 没有 MaxRequestBodySize 字段
 	// 请求体大小限制通过中间件中的 http.MaxBytesReader 实现
 	s.httpServer = &http.Server{
 		Addr:              s.config.Address(),
-		Handler:           s.middleware(muxRouter.ServeHTTP),
+		Handler:           s.Handler(),
 		ReadTimeout:       s.config.ReadTimeout,
 		WriteTimeout:      s.config.WriteTimeout,
 		IdleTimeout:       s.config.IdleTimeout,
@@ -138,11 +141,13 @@ func (s *Server) Start() error {
 		if err != nil {
 			return fmt.Errorf("failed to listen: %w", err)
 		}
-		s.listener = listener
-		// 获取实际端口并更新配置
+		// 获取实际端口并更新配置；与 Address 并发读取，需持锁写入
 		addr := listener.Addr().(*net.TCPAddr)
+		s.mu.Lock()
+		s.listener = listener
 		s.config.Port = addr.Port
-		log.Printf("Starting TigerDB HTTP server on %s (auto-assigned port)", s.config.Address())
+		s.mu.Unlock()
+		log.Printf("Starting TigerDB HTTP server on %s (auto-assigned port)", s.Address())
 		
 		// 启动服务器
 		if s.config.TLSEnable {
@@ -161,6 +166,12 @@ func (s *Server) Start() error {
 	return s.httpServer.ListenAndServe()
 }
 
+// Handler 构建路由器并返回经过全局中间件的请求处理器
+// Start 使用它作为 HTTP 服务器的处理器；不监听端口的进程内调用（嵌入式模式）直接调用它处理请求
+func (s *Server) Handler() http.Handler {
+	return s.trackInFlight(s.middleware(s.router.Build().ServeHTTP))
+}
+
 // StartWithGracefulShutdown 启动服务器并支持优雅关闭
 func (s *Server) StartWithGracefulShutdown() error {
 	// 启动服务器
@@ -190,16 +201,43 @@ func (s *Server) StartWithGracefulShutdown() error {
 	return nil
 }
 
-// Stop 停止服务器
+// trackInFlight 统计进行中的请求数，排空时用于日志
+func (s *Server) trackInFlight(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		next(w, r)
+	}
+}
+
+// InFlight 返回进行中的请求数
+func (s *Server) InFlight() int64 {
+	return s.inFlight.Load()
+}
+
+// Stop 停止服务器：立即停止接受新连接，等待进行中的请求完成（最长到 ctx 超时）
+// 超时后强制关闭剩余连接并返回 ctx 的错误；排空期间 IsRunning 返回 false，就绪检查随之失败
 func (s *Server) Stop(ctx context.Context) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if !s.started || s.httpServer == nil {
+	if !s.started || s.httpServer == nil || s.draining {
+		s.mu.Unlock()
 		return nil
 	}
+	s.draining = true
+	httpServer := s.httpServer
+	s.mu.Unlock()
 
-	err := s.httpServer.Shutdown(ctx)
+	if n := s.InFlight(); n > 0 {
+		log.Printf("Draining %d in-flight requests", n)
+	}
+	err := httpServer.Shutdown(ctx)
+	if err != nil {
+		log.Printf("WARN: Drain timeout exceeded, force closing %d in-flight requests", s.InFlight())
+		httpServer.Close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.listener != nil {
 		s.listener.Close()
 		s.listener = nil
@@ -207,16 +245,27 @@ func (s *Server) Stop(ctx context.Context) error {
 	return err
 }
 
-// IsRunning 检查服务器是否正在运行
+// Address 返回服务器监听地址，端口为 0 时在 Start 分配端口后返回实际端口
+func (s *Server) Address() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config.Address()
+}
+
+// IsRunning 检查服务器是否正在运行（排空中的服务器不算运行）
 func (s *Server) IsRunning() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.started
+	return s.started && !s.draining
 }
 
 // AddHealthCheck 添加健康检查端点
+// {health_path}/live 为存活检查，{health_path}/ready 为就绪检查（执行 AddReadinessCheck 注册的检查），
+// {health_path} 保持兼容，等同于存活检查
 func (s *Server) AddHealthCheck() {
 	s.AddRoute(http.MethodGet, s.config.HealthPath, s.healthCheckHandler)
+	s.AddRoute(http.MethodGet, s.config.HealthPath+"/live", s.livenessHandler)
+	s.AddRoute(http.MethodGet, s.config.HealthPath+"/ready", s.readinessHandler)
 }
 
 // AddMetrics 添加指标收集端点
@@ -226,6 +275,16 @@ func (s *Server) AddMetrics() {
 	}
 }
 
+// AddMetricsSource 注册附加指标来源，其返回值以 name 为键出现在 /_metrics 响应中
+func (s *Server) AddMetricsSource(name string, source func() interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.metricsSources == nil {
+		s.metricsSources = make(map[string]func() interface{})
+	}
+	s.metricsSources[name] = source
+}
+
 // healthCheckHandler 健康检查处理器
 func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	response := common.SuccessResponse().
@@ -254,6 +313,12 @@ func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
 		"cpu_usage":          0, // CPU使用
 	}
 
+	s.mu.RLock()
+	for name, source := range s.metricsSources {
+		metrics[name] = source()
+	}
+	s.mu.RUnlock()
+
 	response := common.SuccessResponse().WithData(metrics)
 	common.HandleSuccess(w, response, http.StatusOK)
 }
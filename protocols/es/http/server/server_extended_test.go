@@ -16,6 +16,8 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -149,3 +151,164 @@ func TestServerMetricsHandler(t *testing.T) {
 		t.Errorf("expected 200 got %d", w.Code)
 	}
 }
+
+func TestServerMetricsSource(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.EnableMetrics = true
+	s, _ := NewServer(cfg)
+	s.AddMetricsSource("custom_pool", func() interface{} {
+		return map[string]interface{}{"active": 2}
+	})
+	s.AddRoute("GET", "/_metrics", s.metricsHandler)
+
+	mux := s.GetRouter().Build()
+	req := httptest.NewRequest("GET", "/_metrics", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid metrics response: %v", err)
+	}
+	pool, ok := body["custom_pool"].(map[string]interface{})
+	if !ok || pool["active"] != float64(2) {
+		t.Errorf("expected custom_pool metrics, got %v", body["custom_pool"])
+	}
+}
+
+// startDrainTestServer 在随机端口启动服务器，/slow 在 release 关闭前阻塞
+func startDrainTestServer(t *testing.T, release chan struct{}) (*Server, string, chan struct{}) {
+	cfg := DefaultServerConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 0
+	s, _ := NewServer(cfg)
+	entered := make(chan struct{}, 1)
+	s.AddRoute("GET", "/slow", func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+	go func() {
+		_ = s.Start()
+	}()
+	for i := 0; i < 100 && s.config.Port == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s.config.Port == 0 {
+		t.Fatal("server did not start")
+	}
+	return s, "http://" + cfg.Address(), entered
+}
+
+func TestServerStopDrainsInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	s, baseURL, entered := startDrainTestServer(t, release)
+
+	result := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err != nil {
+			result <- 0
+			return
+		}
+		resp.Body.Close()
+		result <- resp.StatusCode
+	}()
+	<-entered
+
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- s.Stop(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if s.IsRunning() {
+		t.Error("expected IsRunning() to return false while draining")
+	}
+	if s.InFlight() != 1 {
+		t.Errorf("expected 1 in-flight request, got %d", s.InFlight())
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Errorf("expected drain to finish without error, got %v", err)
+	}
+	if code := <-result; code != http.StatusOK {
+		t.Errorf("expected in-flight request to complete with 200, got %d", code)
+	}
+	if _, err := http.Get(baseURL + "/slow"); err == nil {
+		t.Error("expected new connections to be refused after stop")
+	}
+}
+
+func TestServerStopDrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	s, baseURL, entered := startDrainTestServer(t, release)
+
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if err := <-result; err == nil {
+		t.Error("expected in-flight request to be force closed after drain timeout")
+	}
+}
+
+func TestServerHealthLiveAndReady(t *testing.T) {
+	s, _ := NewServer(DefaultServerConfig())
+	s.AddHealthCheck()
+	var storeErr error
+	s.AddReadinessCheck("store", func(ctx context.Context) error { return storeErr })
+	s.AddReadinessCheck("disk", func(ctx context.Context) error { return nil })
+	mux := s.GetRouter().Build()
+
+	get := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var body map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	if code, body := get("/_health/ready"); code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("expected ready, got %d %v", code, body)
+	}
+
+	storeErr = errors.New("store unreachable")
+	code, body := get("/_health/ready")
+	if code != http.StatusServiceUnavailable || body["status"] != "not_ready" {
+		t.Fatalf("expected 503 not_ready, got %d %v", code, body)
+	}
+	checks := body["checks"].(map[string]interface{})
+	store := checks["store"].(map[string]interface{})
+	if store["status"] != "failed" || store["error"] != "store unreachable" {
+		t.Errorf("unexpected store check: %v", store)
+	}
+	if checks["disk"].(map[string]interface{})["status"] != "ok" {
+		t.Errorf("unexpected disk check: %v", checks["disk"])
+	}
+	if failed, _ := body["failed_checks"].([]interface{}); len(failed) != 1 || failed[0] != "store" {
+		t.Errorf("unexpected failed_checks: %v", body["failed_checks"])
+	}
+
+	// 存活检查不受依赖影响
+	if code, _ := get("/_health/live"); code != http.StatusOK {
+		t.Errorf("expected live 200, got %d", code)
+	}
+	if code, _ := get("/_health"); code != http.StatusOK {
+		t.Errorf("expected /_health 200, got %d", code)
+	}
+}
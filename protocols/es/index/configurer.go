@@ -0,0 +1,45 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	bleve "github.com/lscgzwd/tiggerdb"
+)
+
+// IndexConfigurer 索引打开后使动态设置生效的回调（如 refresh_interval、ingest_mode），
+// 在打开索引的 goroutine 中同步执行，执行完成前索引不对请求可见
+type IndexConfigurer func(indexName string, idx bleve.Index)
+
+// SetConfigurer 设置索引打开后执行的配置回调，需在打开任何索引之前调用
+func (im *IndexManager) SetConfigurer(configurer IndexConfigurer) {
+	im.openMu.Lock()
+	defer im.openMu.Unlock()
+	im.configurer = configurer
+}
+
+// LoadedIndex 返回已打开的索引，未打开时不打开
+func (im *IndexManager) LoadedIndex(indexName string) (bleve.Index, bool) {
+	val, ok := im.indices.Load(indexName)
+	if !ok {
+		return nil, false
+	}
+	return val.(bleve.Index), true
+}
+
+// indexRefresher 支持按需刷新搜索视图的底层索引（scorch）
+type indexRefresher interface {
+	Refresh()
+	AutoRefresh() bool
+}
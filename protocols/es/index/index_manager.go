@@ -15,15 +15,19 @@
 package es
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	bleve "github.com/lscgzwd/tiggerdb"
 	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/index/scorch"
+	"github.com/lscgzwd/tiggerdb/index/scorch/mergeplan"
 	"github.com/lscgzwd/tiggerdb/metadata"
 )
 
@@ -31,9 +35,18 @@ import (
 type IndexManager struct {
 	dirMgr      directory.DirectoryManager
 	metaStore   metadata.MetadataStore
-	indices     sync.Map   // 索引名称 -> bleve.Index（无锁并发安全）
-	indexStatus sync.Map   // 索引名称 -> bool（是否存在）
-	openMu      sync.Mutex // 仅用于打开索引时的互斥
+	indices     sync.Map               // 索引名称 -> bleve.Index（无锁并发安全）
+	indexStatus sync.Map               // 索引名称 -> bool（是否存在）
+	openMu      sync.Mutex             // 仅用于打开索引时的互斥
+	termsDicts  sync.Map               // bleve.Index -> *termsDictionaryCache（terms 聚合词项字典）
+	openConfig  map[string]interface{} // 打开索引时的运行时配置（如 bolt_timeout），为空时使用持久化的配置
+	quarantined sync.Map               // 索引名称 -> *QuarantinedIndex（启动恢复失败的索引）
+	warmer      IndexWarmer            // 索引打开后的预热回调，为空时不预热
+	warmerStats sync.Map               // 索引名称 -> *warmerStats
+	configurer  IndexConfigurer        // 索引打开后使动态设置生效的回调
+
+	refreshMu         sync.Mutex // 启停刷新调度器的互斥
+	refreshSchedulers sync.Map   // 索引名称 -> *refreshScheduler
 }
 
 // NewIndexManager 创建新的索引管理器
@@ -44,6 +57,14 @@ func NewIndexManager(dirMgr directory.DirectoryManager, metaStore metadata.Metad
 	}
 }
 
+// SetOpenConfig 设置打开索引时使用的运行时配置，需在打开任何索引之前调用
+// 离线管理命令通过 bolt_timeout 避免在服务运行时无限等待索引文件锁
+func (im *IndexManager) SetOpenConfig(config map[string]interface{}) {
+	im.openMu.Lock()
+	defer im.openMu.Unlock()
+	im.openConfig = config
+}
+
 // GetIndex 获取或打开索引
 func (im *IndexManager) GetIndex(indexName string) (bleve.Index, error) {
 	// 快速路径：从 sync.Map 获取已缓存的索引（无锁）
@@ -51,6 +72,11 @@ func (im *IndexManager) GetIndex(indexName string) (bleve.Index, error) {
 		return val.(bleve.Index), nil
 	}
 
+	// 启动恢复阶段隔离的索引直接返回错误，不再重复打开
+	if val, exists := im.quarantined.Load(indexName); exists {
+		return nil, val.(*QuarantinedIndex).error()
+	}
+
 	// 检查索引状态缓存
 	if val, exists := im.indexStatus.Load(indexName); exists {
 		if !val.(bool) {
@@ -75,10 +101,32 @@ func (im *IndexManager) GetIndex(indexName string) (bleve.Index, error) {
 		return nil, fmt.Errorf("index [%s] not found", indexName)
 	}
 
+	storePath, err := im.indexStorePath(indexName)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := im.openStore(indexName, storePath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 缓存索引实例
+	im.indices.Store(indexName, idx)
+
+	// 后台预热，不阻塞当前请求
+	if im.warmer != nil {
+		go im.warmIndex(indexName, idx, im.warmer)
+	}
+
+	return idx, nil
+}
+
+// indexStorePath 返回索引的 bleve 存储路径并检查其存在
+func (im *IndexManager) indexStorePath(indexName string) (string, error) {
 	// 获取索引路径
 	indexPath := im.dirMgr.GetIndexPath(indexName)
 	if indexPath == "" {
-		return nil, fmt.Errorf("invalid index path for index [%s]", indexName)
+		return "", fmt.Errorf("invalid index path for index [%s]", indexName)
 	}
 
 	// 构建完整的索引存储路径
@@ -88,24 +136,32 @@ func (im *IndexManager) GetIndex(indexName string) (bleve.Index, error) {
 	info, err := os.Stat(storePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("index [%s] exists in directory but store is missing (path: %s)", indexName, storePath)
+			return "", fmt.Errorf("index [%s] exists in directory but store is missing (path: %s)", indexName, storePath)
 		}
-		return nil, fmt.Errorf("failed to stat index store path [%s]: %w", storePath, err)
+		return "", fmt.Errorf("failed to stat index store path [%s]: %w", storePath, err)
 	}
 
 	// 确保是目录
 	if !info.IsDir() {
-		return nil, fmt.Errorf("index store path [%s] is not a directory", storePath)
+		return "", fmt.Errorf("index store path [%s] is not a directory", storePath)
 	}
+	return storePath, nil
+}
+
+// openMarkerFile 索引打开期间存在的标记文件，打开时已存在说明上次没有正常关闭
+const openMarkerFile = "open.marker"
 
-	// 打开已存在的索引
+// openStore 打开已存在的索引（调用方持有 openMu）
+// verify 为 true 或上次没有正常关闭时校验段文件，校验失败时关闭索引并返回错误
+func (im *IndexManager) openStore(indexName, storePath string, verify bool) (bleve.Index, error) {
 	// 添加重试机制，处理Windows文件锁问题
 	var idx bleve.Index
+	var err error
 	maxRetries := 3
 	retryDelay := 200 * time.Millisecond
 
 	for i := 0; i < maxRetries; i++ {
-		idx, err = bleve.Open(storePath)
+		idx, err = bleve.OpenUsing(storePath, im.openConfig)
 		if err == nil {
 			break
 		}
@@ -120,14 +176,45 @@ func (im *IndexManager) GetIndex(indexName string) (bleve.Index, error) {
 		retryDelay *= 2 // 指数退避
 	}
 
-	// 缓存索引实例
-	im.indices.Store(indexName, idx)
-
+	markerPath := filepath.Join(filepath.Dir(storePath), openMarkerFile)
+	if _, err := os.Stat(markerPath); err == nil {
+		log.Printf("[IndexManager] WARN: Index [%s] was not closed cleanly, verifying segments", indexName)
+		verify = true
+	}
+	if verify {
+		result, err := VerifyStore(idx)
+		if err == nil && !result.Valid() {
+			err = fmt.Errorf("%s", strings.Join(result.Problems, "; "))
+		}
+		if err != nil {
+			_ = idx.Close()
+			return nil, fmt.Errorf("index [%s] failed verification: %w", indexName, err)
+		}
+	}
+	if err := os.WriteFile(markerPath, []byte(time.Now().UTC().Format(time.RFC3339)), 0644); err != nil {
+		log.Printf("WARN: Failed to write open marker of index [%s]: %v", indexName, err)
+	}
+	if im.configurer != nil {
+		im.configurer(indexName, idx)
+	}
 	return idx, nil
 }
 
+// removeOpenMarker 索引正常关闭后删除打开标记
+func (im *IndexManager) removeOpenMarker(indexName string) {
+	indexPath := im.dirMgr.GetIndexPath(indexName)
+	if indexPath == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(indexPath, openMarkerFile)); err != nil && !os.IsNotExist(err) {
+		log.Printf("WARN: Failed to remove open marker of index [%s]: %v", indexName, err)
+	}
+}
+
 // CloseIndex 关闭索引
 func (im *IndexManager) CloseIndex(indexName string) error {
+	im.quarantined.Delete(indexName)
+	im.stopRefreshScheduler(indexName)
 	val, exists := im.indices.Load(indexName)
 	if !exists {
 		return nil // 已经关闭或不存在
@@ -136,10 +223,14 @@ func (im *IndexManager) CloseIndex(indexName string) error {
 	idx := val.(bleve.Index)
 	if err := idx.Close(); err != nil {
 		log.Printf("WARN: Failed to close index [%s]: %v", indexName, err)
+	} else {
+		im.removeOpenMarker(indexName)
 	}
 
+	im.termsDicts.Delete(idx)
 	im.indices.Delete(indexName)
 	im.indexStatus.Delete(indexName)
+	im.warmerStats.Delete(indexName)
 	return nil
 }
 
@@ -149,10 +240,14 @@ func (im *IndexManager) CloseAll() error {
 	im.indices.Range(func(key, value interface{}) bool {
 		name := key.(string)
 		idx := value.(bleve.Index)
+		im.stopRefreshScheduler(name)
 		if err := idx.Close(); err != nil {
 			log.Printf("WARN: Failed to close index [%s]: %v", name, err)
 			lastErr = err
+		} else {
+			im.removeOpenMarker(name)
 		}
+		im.termsDicts.Delete(idx)
 		im.indices.Delete(key)
 		return true
 	})
@@ -161,8 +256,12 @@ func (im *IndexManager) CloseAll() error {
 
 // RemoveIndex 移除索引（从缓存中移除，不关闭）
 func (im *IndexManager) RemoveIndex(indexName string) {
+	im.quarantined.Delete(indexName)
+	im.stopRefreshScheduler(indexName)
+	im.InvalidateTermsDictionaries(indexName)
 	im.indices.Delete(indexName)
 	im.indexStatus.Delete(indexName)
+	im.warmerStats.Delete(indexName)
 }
 
 // InvalidateIndexStatus 使索引状态缓存失效（当索引被创建或删除时调用）
@@ -170,36 +269,204 @@ func (im *IndexManager) InvalidateIndexStatus(indexName string) {
 	im.indexStatus.Delete(indexName)
 }
 
-// PreloadAllIndices 预加载所有索引（启动时调用，触发后台合并任务）
-func (im *IndexManager) PreloadAllIndices() {
-	indices, err := im.dirMgr.ListIndices()
+// RefreshIndex 刷新索引，使此前写入的数据对搜索可见
+// scorch 在批次引入（introduce）后即对读可见，这里通过获取一次新的 reader 确认索引可读
+// 刷新后 terms 聚合的词项字典需要重建
+func (im *IndexManager) RefreshIndex(indexName string) error {
+	idx, err := im.GetIndex(indexName)
+	if err != nil {
+		return err
+	}
+	advIdx, err := idx.Advanced()
+	if err != nil {
+		return fmt.Errorf("failed to get advanced index [%s]: %w", indexName, err)
+	}
+	im.refreshSearchView(idx)
+
+	reader, err := advIdx.Reader()
+	if err != nil {
+		return fmt.Errorf("failed to open reader for index [%s]: %w", indexName, err)
+	}
+	return reader.Close()
+}
+
+// refreshSearchView 使关闭自动刷新的索引（refresh_interval 为 -1 或正数、ingest_mode）的新写入对搜索可见，
+// 并使 terms 聚合的词项字典失效
+func (im *IndexManager) refreshSearchView(idx bleve.Index) {
+	im.termsDicts.Delete(idx)
+	advIdx, err := idx.Advanced()
 	if err != nil {
-		log.Printf("[IndexManager] Failed to list indices: %v", err)
 		return
 	}
-	log.Printf("[IndexManager] Preloading %d indices...", len(indices))
+	if refresher, ok := advIdx.(indexRefresher); ok {
+		refresher.Refresh()
+	}
+}
+
+// indexFlusher 支持强制持久化的底层索引（scorch）
+type indexFlusher interface {
+	Flush(ctx context.Context) error
+}
+
+// FlushIndex 将索引当前的内存段强制持久化到磁盘
+// 会先执行 RefreshIndex，然后等待 scorch persister 完成当前快照的持久化
+func (im *IndexManager) FlushIndex(ctx context.Context, indexName string) error {
+	if err := im.RefreshIndex(indexName); err != nil {
+		return err
+	}
+
+	idx, err := im.GetIndex(indexName)
+	if err != nil {
+		return err
+	}
+
+	advIdx, err := idx.Advanced()
+	if err != nil {
+		return fmt.Errorf("failed to get advanced index [%s]: %w", indexName, err)
+	}
+
+	flusher, ok := advIdx.(indexFlusher)
+	if !ok {
+		// upsidedown 等存储在写入时同步落盘，无需额外操作
+		return nil
+	}
+
+	if err := flusher.Flush(ctx); err != nil {
+		return fmt.Errorf("failed to flush index [%s]: %w", indexName, err)
+	}
+	return nil
+}
+
+// FlushAll 持久化所有已打开索引中尚未落盘的写入（关闭前调用），返回最后一个失败的错误
+func (im *IndexManager) FlushAll(ctx context.Context) error {
+	var names []string
+	im.indices.Range(func(key, _ interface{}) bool {
+		names = append(names, key.(string))
+		return true
+	})
+
+	var lastErr error
+	for _, name := range names {
+		if err := im.FlushIndex(ctx, name); err != nil {
+			log.Printf("WARN: Failed to flush index [%s]: %v", name, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// ForceMergeOptions 强制合并参数
+type ForceMergeOptions struct {
+	MaxNumSegments     int  // 合并后的目标段数，<=0 时合并为单个段
+	OnlyExpungeDeletes bool // 仅合并包含已删除文档的段
+}
+
+// ForceMergeResult 强制合并结果
+type ForceMergeResult struct {
+	SegmentsBefore int `json:"segments_before"`
+	SegmentsAfter  int `json:"segments_after"`
+}
+
+// forceMergeMaxRounds 单次强制合并最多执行的合并轮数
+// 每轮合并后段数不再减少时提前结束
+const forceMergeMaxRounds = 10
+
+// ForceMerge 通过已打开的索引句柄强制合并段
+// 合并前会先 Flush，确保内存段已持久化并参与合并
+func (im *IndexManager) ForceMerge(ctx context.Context, indexName string, opts ForceMergeOptions) (*ForceMergeResult, error) {
+	idx, err := im.GetIndex(indexName)
+	if err != nil {
+		return nil, err
+	}
 
-	// 并发预加载，每个索引一个 goroutine
-	var wg sync.WaitGroup
-	// 限制并发数，避免同时打开太多索引
-	semaphore := make(chan struct{}, 5)
+	advIdx, err := idx.Advanced()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get advanced index [%s]: %w", indexName, err)
+	}
 
-	for _, indexName := range indices {
-		wg.Add(1)
-		go func(name string) {
-			defer wg.Done()
-			semaphore <- struct{}{}        // 获取信号量
-			defer func() { <-semaphore }() // 释放信号量
+	sc, ok := advIdx.(*scorch.Scorch)
+	if !ok {
+		return nil, fmt.Errorf("index [%s] does not support force merge", indexName)
+	}
 
-			_, err := im.GetIndex(name)
-			if err != nil {
-				log.Printf("[IndexManager] Failed to preload index [%s]: %v", name, err)
-			} else {
-				log.Printf("[IndexManager] Preloaded index [%s]", name)
-			}
-		}(indexName)
+	if err := im.FlushIndex(ctx, indexName); err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
-	log.Printf("[IndexManager] Preload complete")
+	before, err := im.SegmentCount(indexName)
+	if err != nil {
+		return nil, err
+	}
+	result := &ForceMergeResult{SegmentsBefore: before, SegmentsAfter: before}
+
+	target := opts.MaxNumSegments
+	if target <= 0 {
+		target = 1
+	}
+
+	mo := mergeplan.SingleSegmentMergePlanOptions
+	// 目标段数由 CalcBudget 决定；不按文件大小分层，避免小段被视为无需合并
+	mo.FloorSegmentFileSize = 0
+	mo.CalcBudget = func(totalSize int64, firstTierSize int64, o *mergeplan.MergePlanOptions) int {
+		return target
+	}
+	if opts.OnlyExpungeDeletes {
+		mo.Eligible = func(seg mergeplan.Segment) bool {
+			return seg.LiveSize() < seg.FullSize()
+		}
+	}
+
+	current := before
+	for round := 0; round < forceMergeMaxRounds; round++ {
+		if !opts.OnlyExpungeDeletes && current <= target {
+			break
+		}
+
+		if err := sc.ForceMerge(ctx, &mo); err != nil {
+			return result, fmt.Errorf("failed to force merge index [%s]: %w", indexName, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if err := im.FlushIndex(ctx, indexName); err != nil {
+			return result, err
+		}
+
+		after, err := im.SegmentCount(indexName)
+		if err != nil {
+			return result, err
+		}
+		result.SegmentsAfter = after
+		if after >= current {
+			break
+		}
+		current = after
+	}
+
+	return result, nil
+}
+
+// SegmentCount 返回索引当前根快照中的段数量
+func (im *IndexManager) SegmentCount(indexName string) (int, error) {
+	idx, err := im.GetIndex(indexName)
+	if err != nil {
+		return 0, err
+	}
+
+	advIdx, err := idx.Advanced()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get advanced index [%s]: %w", indexName, err)
+	}
+
+	reader, err := advIdx.Reader()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open reader for index [%s]: %w", indexName, err)
+	}
+	defer reader.Close()
+
+	snapshot, ok := reader.(*scorch.IndexSnapshot)
+	if !ok {
+		return 0, nil
+	}
+	return len(snapshot.Segments()), nil
 }
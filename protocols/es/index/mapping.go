@@ -0,0 +1,72 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/util"
+)
+
+// ReplaceMapping 替换索引持久化的 bleve mapping，并重新打开索引使其生效
+// bleve 只在打开索引时读取 mapping；已索引的文档不受影响，调用方需要重建受影响的文档
+func (im *IndexManager) ReplaceMapping(ctx context.Context, indexName string, m *mapping.IndexMappingImpl) error {
+	if err := m.Validate(); err != nil {
+		return fmt.Errorf("invalid mapping for index [%s]: %w", indexName, err)
+	}
+	mappingBytes, err := util.MarshalJSON(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode mapping of index [%s]: %w", indexName, err)
+	}
+
+	idx, err := im.GetIndex(indexName)
+	if err != nil {
+		return err
+	}
+	if err := idx.SetInternal(util.MappingInternalKey, mappingBytes); err != nil {
+		return fmt.Errorf("failed to store mapping of index [%s]: %w", indexName, err)
+	}
+	if err := im.FlushIndex(ctx, indexName); err != nil {
+		return err
+	}
+
+	// 持有 openMu，避免关闭期间被并发请求以旧实例重新打开
+	im.openMu.Lock()
+	im.CloseIndex(indexName)
+	im.openMu.Unlock()
+	_, err = im.GetIndex(indexName)
+	return err
+}
+
+// UpdateMapping 替换已打开索引正在使用的 bleve mapping 并持久化，不重新打开索引
+// 用于只新增字段的 mapping 变更（如动态 mapping）：已索引的文档不受影响，之后索引的文档使用新 mapping
+func (im *IndexManager) UpdateMapping(indexName string, m *mapping.IndexMappingImpl) error {
+	idx, err := im.GetIndex(indexName)
+	if err != nil {
+		return err
+	}
+	updater, ok := idx.(interface {
+		SetMapping(mapping.IndexMapping) error
+	})
+	if !ok {
+		return fmt.Errorf("index [%s] does not support updating the mapping", indexName)
+	}
+	if err := updater.SetMapping(m); err != nil {
+		return fmt.Errorf("failed to update mapping of index [%s]: %w", indexName, err)
+	}
+	return nil
+}
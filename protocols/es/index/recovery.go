@@ -0,0 +1,215 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/index/scorch"
+)
+
+// 启动恢复
+// 启动时逐个打开并校验索引：打开前检查 scorch 最新快照的段文件是否完整（scorch 打开时遇到无法加载的快照会
+// 静默回退到更早的快照甚至空索引），损坏时回滚到最近一个可加载的快照（回滚后打开时校验段文件）；无法恢复的索引被隔离，
+// GetIndex 直接返回隔离原因，_cluster/health 显示为 red。隔离不修改索引文件，删除、关闭索引或重启后解除。
+
+// ErrIndexQuarantined 索引在启动恢复阶段被隔离
+var ErrIndexQuarantined = errors.New("index is quarantined")
+
+// QuarantinedIndex 启动恢复失败被隔离的索引
+type QuarantinedIndex struct {
+	Name          string    `json:"index"`
+	Reason        string    `json:"reason"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+func (q *QuarantinedIndex) error() error {
+	return fmt.Errorf("%w: index [%s] failed to recover on startup: %s", ErrIndexQuarantined, q.Name, q.Reason)
+}
+
+// RecoveryResult 启动恢复结果
+type RecoveryResult struct {
+	Opened      []string // 正常打开的索引
+	RolledBack  []string // 回滚到更早快照后打开的索引
+	Quarantined []string // 无法恢复被隔离的索引
+}
+
+// RecoverAllIndices 启动恢复阶段：打开并校验所有索引（同时启动后台合并任务），返回各索引的恢复结果
+func (im *IndexManager) RecoverAllIndices() *RecoveryResult {
+	result := &RecoveryResult{}
+	indices, err := im.dirMgr.ListIndices()
+	if err != nil {
+		log.Printf("[IndexManager] Failed to list indices: %v", err)
+		return result
+	}
+	log.Printf("[IndexManager] Recovering %d indices...", len(indices))
+
+	// 并发恢复，每个索引一个 goroutine
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	// 限制并发数，避免同时打开太多索引
+	semaphore := make(chan struct{}, 5)
+
+	for _, indexName := range indices {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			semaphore <- struct{}{}        // 获取信号量
+			defer func() { <-semaphore }() // 释放信号量
+
+			rolledBack, err := im.recoverIndex(name)
+			if err == nil {
+				// 恢复后同步预热，首个请求到达前完成
+				if val, exists := im.indices.Load(name); exists {
+					im.warmIndex(name, val.(bleve.Index), im.currentWarmer())
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				log.Printf("[IndexManager] Quarantined index [%s]: %v", name, err)
+				result.Quarantined = append(result.Quarantined, name)
+			case rolledBack:
+				result.RolledBack = append(result.RolledBack, name)
+			default:
+				result.Opened = append(result.Opened, name)
+			}
+		}(indexName)
+	}
+
+	wg.Wait()
+	sort.Strings(result.Opened)
+	sort.Strings(result.RolledBack)
+	sort.Strings(result.Quarantined)
+	log.Printf("[IndexManager] Recovery complete: %d opened, %d rolled back, %d quarantined",
+		len(result.Opened), len(result.RolledBack), len(result.Quarantined))
+	return result
+}
+
+// recoverIndex 打开并校验索引，必要时回滚到最近一个可加载的快照；失败时隔离索引
+// 返回是否发生了回滚
+func (im *IndexManager) recoverIndex(indexName string) (bool, error) {
+	im.openMu.Lock()
+	defer im.openMu.Unlock()
+
+	// 恢复前已被请求打开
+	if _, exists := im.indices.Load(indexName); exists {
+		return false, nil
+	}
+
+	idx, rolledBack, err := im.openVerified(indexName)
+	if err != nil {
+		im.quarantined.Store(indexName, &QuarantinedIndex{
+			Name:          indexName,
+			Reason:        err.Error(),
+			QuarantinedAt: time.Now().UTC(),
+		})
+		return false, err
+	}
+	im.quarantined.Delete(indexName)
+	im.indices.Store(indexName, idx)
+	im.indexStatus.Store(indexName, true)
+	return rolledBack, nil
+}
+
+// openVerified 回滚损坏的快照后打开索引，并确认可以读取
+func (im *IndexManager) openVerified(indexName string) (bleve.Index, bool, error) {
+	storePath, err := im.indexStorePath(indexName)
+	if err != nil {
+		return nil, false, err
+	}
+	rolledBackTo, err := rollbackCorruptedSnapshot(filepath.Join(storePath, "store"))
+	if err != nil {
+		return nil, false, err
+	}
+	if rolledBackTo != nil {
+		log.Printf("[IndexManager] WARN: Index [%s] rolled back to snapshot epoch %d, changes after it are lost",
+			indexName, rolledBackTo.Epoch())
+	}
+
+	// 回滚后的快照在打开时校验段文件
+	idx, err := im.openStore(indexName, storePath, rolledBackTo != nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := idx.DocCount(); err != nil {
+		_ = idx.Close()
+		return nil, false, fmt.Errorf("failed to read index [%s]: %w", indexName, err)
+	}
+	return idx, rolledBackTo != nil, nil
+}
+
+// rollbackCorruptedSnapshot 检查 scorch 存储的最新快照，无法加载时回滚到最近一个可加载的快照
+// 返回回滚到的快照，最新快照完好或存储尚未持久化任何快照时返回 nil
+func rollbackCorruptedSnapshot(scorchPath string) (*scorch.RollbackPoint, error) {
+	if _, err := os.Stat(filepath.Join(scorchPath, "root.bolt")); os.IsNotExist(err) {
+		return nil, nil // 非 scorch 存储
+	}
+	points, err := scorch.RollbackPoints(scorchPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots: %w", err)
+	}
+
+	var latestErr error
+	for i, point := range points {
+		err := scorch.CheckRollbackPoint(scorchPath, point)
+		if err != nil {
+			log.Printf("[IndexManager] Snapshot epoch %d of [%s] cannot be loaded: %v", point.Epoch(), scorchPath, err)
+			if latestErr == nil {
+				latestErr = err
+			}
+			continue
+		}
+		if i == 0 {
+			return nil, nil
+		}
+		if err := scorch.Rollback(scorchPath, point); err != nil {
+			return nil, fmt.Errorf("failed to roll back to snapshot epoch %d: %w", point.Epoch(), err)
+		}
+		return point, nil
+	}
+	if latestErr != nil {
+		return nil, fmt.Errorf("no loadable snapshot: %w", latestErr)
+	}
+	return nil, nil
+}
+
+// QuarantinedIndices 返回被隔离的索引（按名称排序）
+func (im *IndexManager) QuarantinedIndices() []*QuarantinedIndex {
+	var rv []*QuarantinedIndex
+	im.quarantined.Range(func(key, value interface{}) bool {
+		rv = append(rv, value.(*QuarantinedIndex))
+		return true
+	})
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Name < rv[j].Name })
+	return rv
+}
+
+// Quarantined 返回索引的隔离信息，未被隔离时返回 nil
+func (im *IndexManager) Quarantined(indexName string) *QuarantinedIndex {
+	if val, exists := im.quarantined.Load(indexName); exists {
+		return val.(*QuarantinedIndex)
+	}
+	return nil
+}
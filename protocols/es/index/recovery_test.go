@@ -0,0 +1,139 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/index/scorch"
+	"github.com/lscgzwd/tiggerdb/metadata"
+)
+
+func TestRecoverAllIndices(t *testing.T) {
+	// 保留所有快照，使损坏的索引可以回滚
+	numSnapshotsToKeepOrig := scorch.NumSnapshotsToKeep
+	scorch.NumSnapshotsToKeep = 100
+	defer func() { scorch.NumSnapshotsToKeep = numSnapshotsToKeepOrig }()
+
+	tempDir := t.TempDir()
+	dirMgr, err := directory.NewDirectoryManager(directory.DefaultDirectoryConfig(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaStore, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{StorageType: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metaStore.Close()
+
+	// 每个批次单独打开、写入并关闭索引，生成一个新的持久化快照与段文件
+	storePath := func(name string) string {
+		return filepath.Join(dirMgr.GetIndexPath(name), "store")
+	}
+	writeBatches := func(name string, batches int) {
+		if err := dirMgr.CreateIndex(name); err != nil {
+			t.Fatal(err)
+		}
+		idx, err := bleve.New(storePath(name), bleve.NewIndexMapping())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for b := 0; b < batches; b++ {
+			if b > 0 {
+				if idx, err = bleve.Open(storePath(name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			batch := idx.NewBatch()
+			for i := 0; i < 3; i++ {
+				if err := batch.Index(fmt.Sprintf("%d-%d", b, i), map[string]interface{}{"msg": "hello"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := idx.Batch(batch); err != nil {
+				t.Fatal(err)
+			}
+			if err := idx.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// newestSegment 返回最新写入的段文件（段 ID 递增，文件名按十六进制 ID 命名）
+	newestSegment := func(name string) string {
+		files, err := filepath.Glob(filepath.Join(storePath(name), "store", "*.zap"))
+		if err != nil || len(files) == 0 {
+			t.Fatalf("no segment files for [%s]: %v", name, err)
+		}
+		sort.Strings(files)
+		return files[len(files)-1]
+	}
+
+	writeBatches("healthy", 2)
+	writeBatches("truncated", 2)
+	writeBatches("broken", 1)
+
+	// 最新快照引用的段文件被截断：回滚到之前的快照
+	if err := os.Truncate(newestSegment("truncated"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// 快照元数据损坏：无法恢复
+	if err := os.WriteFile(filepath.Join(storePath("broken"), "store", "root.bolt"), []byte("corrupted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	im := NewIndexManager(dirMgr, metaStore)
+	defer im.CloseAll()
+	result := im.RecoverAllIndices()
+	if fmt.Sprint(result.Opened) != "[healthy]" || fmt.Sprint(result.RolledBack) != "[truncated]" ||
+		fmt.Sprint(result.Quarantined) != "[broken]" {
+		t.Fatalf("unexpected recovery result: %+v", result)
+	}
+
+	for name, expected := range map[string]uint64{"healthy": 6, "truncated": 3} {
+		idx, err := im.GetIndex(name)
+		if err != nil {
+			t.Fatalf("get [%s]: %v", name, err)
+		}
+		if count, err := idx.DocCount(); err != nil || count != expected {
+			t.Errorf("[%s]: expected %d docs, got %d (%v)", name, expected, count, err)
+		}
+	}
+
+	// 隔离的索引直接返回错误，不再尝试打开
+	_, err = im.GetIndex("broken")
+	if !errors.Is(err, ErrIndexQuarantined) {
+		t.Fatalf("expected quarantined error, got %v", err)
+	}
+	quarantined := im.QuarantinedIndices()
+	if len(quarantined) != 1 || quarantined[0].Name != "broken" || quarantined[0].Reason == "" {
+		t.Errorf("unexpected quarantined indices: %+v", quarantined)
+	}
+	if im.Quarantined("healthy") != nil {
+		t.Errorf("healthy index should not be quarantined")
+	}
+
+	// 删除索引时解除隔离
+	im.RemoveIndex("broken")
+	if im.Quarantined("broken") != nil {
+		t.Errorf("removed index should not be quarantined")
+	}
+}
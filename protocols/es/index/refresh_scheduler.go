@@ -0,0 +1,155 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+)
+
+// 刷新调度
+// index.refresh_interval 为正的索引关闭 scorch 的自动刷新，由调度器每个间隔刷新一次搜索视图，
+// 写入按固定节奏对搜索可见，不再每个批次引入后立即可见。
+// refresh=wait_for 的写请求阻塞到下一次调度刷新完成后返回；没有调度器的索引上，
+// 搜索视图已冻结（refresh_interval: -1、ingest_mode）时立即刷新一次，否则写入已经可见，直接返回。
+
+// refreshScheduler 单个索引的刷新调度器
+type refreshScheduler struct {
+	interval  time.Duration
+	mu        sync.Mutex
+	next      chan struct{} // 下一次刷新完成时关闭
+	listeners atomic.Int64  // 等待下一次刷新的请求数
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// newRefreshScheduler 创建并启动刷新调度器，每个间隔调用一次 refresh
+func newRefreshScheduler(interval time.Duration, refresh func()) *refreshScheduler {
+	rs := &refreshScheduler{
+		interval: interval,
+		next:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go rs.run(refresh)
+	return rs
+}
+
+// run 调度循环，停止前最后刷新一次，使等待中的请求看到自己的写入
+func (rs *refreshScheduler) run(refresh func()) {
+	defer close(rs.done)
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.stop:
+			refresh()
+			rs.notify()
+			return
+		case <-ticker.C:
+			refresh()
+			rs.notify()
+		}
+	}
+}
+
+// notify 唤醒等待本次刷新的请求
+func (rs *refreshScheduler) notify() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	close(rs.next)
+	rs.next = make(chan struct{})
+}
+
+// wait 阻塞到下一次刷新完成或 ctx 结束
+func (rs *refreshScheduler) wait(ctx context.Context) error {
+	rs.mu.Lock()
+	next := rs.next
+	rs.mu.Unlock()
+
+	rs.listeners.Add(1)
+	defer rs.listeners.Add(-1)
+	select {
+	case <-next:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close 停止调度器并等待调度循环退出
+func (rs *refreshScheduler) close() {
+	close(rs.stop)
+	<-rs.done
+}
+
+// ScheduleRefresh 按间隔周期刷新索引的搜索视图，interval 不为正时停止调度
+// 由索引配置回调在打开索引与刷新间隔修改后调用，间隔不变时保留当前的调度器
+func (im *IndexManager) ScheduleRefresh(indexName string, idx bleve.Index, interval time.Duration) {
+	im.refreshMu.Lock()
+	defer im.refreshMu.Unlock()
+	if val, ok := im.refreshSchedulers.Load(indexName); ok {
+		rs := val.(*refreshScheduler)
+		if rs.interval == interval {
+			return
+		}
+		im.refreshSchedulers.Delete(indexName)
+		rs.close()
+	}
+	if interval <= 0 {
+		return
+	}
+	im.refreshSchedulers.Store(indexName, newRefreshScheduler(interval, func() { im.refreshSearchView(idx) }))
+}
+
+// stopRefreshScheduler 停止索引的刷新调度，关闭或移除索引时调用
+func (im *IndexManager) stopRefreshScheduler(indexName string) {
+	im.refreshMu.Lock()
+	defer im.refreshMu.Unlock()
+	if val, ok := im.refreshSchedulers.LoadAndDelete(indexName); ok {
+		val.(*refreshScheduler).close()
+	}
+}
+
+// WaitForRefresh 等待此前的写入对搜索可见，处理写请求的 refresh=wait_for
+func (im *IndexManager) WaitForRefresh(ctx context.Context, indexName string) error {
+	if val, ok := im.refreshSchedulers.Load(indexName); ok {
+		return val.(*refreshScheduler).wait(ctx)
+	}
+	idx, ok := im.LoadedIndex(indexName)
+	if !ok {
+		return nil
+	}
+	advIdx, err := idx.Advanced()
+	if err != nil {
+		return nil
+	}
+	if refresher, ok := advIdx.(indexRefresher); ok && !refresher.AutoRefresh() {
+		im.refreshSearchView(idx)
+	}
+	return nil
+}
+
+// RefreshListeners 返回等待索引下一次调度刷新的请求数
+func (im *IndexManager) RefreshListeners(indexName string) int64 {
+	if val, ok := im.refreshSchedulers.Load(indexName); ok {
+		return val.(*refreshScheduler).listeners.Load()
+	}
+	return 0
+}
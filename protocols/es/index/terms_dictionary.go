@@ -0,0 +1,156 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+)
+
+// 词项字典缓存（类似 ES 的 global ordinals）
+// 按索引、字段缓存字段词典：词项按字典序编号（ordinal），并保存解码后的类型化值，
+// terms 聚合可直接查表，避免每次请求重复解码 PrefixCoded 词项和猜测类型。
+// 缓存在 refresh、关闭或移除索引时失效；缓存构建后新写入的词项查不到时由调用方直接解码，结果不受影响。
+
+// DefaultMaxTermsDictionarySize 单个字段可缓存的最大词项数默认值，超过时不缓存（高基数字段构建字典得不偿失）
+const DefaultMaxTermsDictionarySize = 100000
+
+var maxTermsDictionarySize atomic.Int64
+
+func init() {
+	maxTermsDictionarySize.Store(DefaultMaxTermsDictionarySize)
+}
+
+// SetMaxTermsDictionarySize 调整单个字段可缓存的最大词项数（<= 0 时恢复默认值），只影响之后构建的字典
+func SetMaxTermsDictionarySize(size int) {
+	if size <= 0 {
+		size = DefaultMaxTermsDictionarySize
+	}
+	maxTermsDictionarySize.Store(int64(size))
+}
+
+// TermDecoder 将索引中的原始词项解码为类型化值
+type TermDecoder func(term string) interface{}
+
+// TermsDictionary 单个字段的词项字典
+type TermsDictionary struct {
+	ordinals map[string]int // 原始词项 -> ordinal
+	values   []interface{}  // ordinal -> 解码后的值
+}
+
+// Ordinal 返回词项的 ordinal
+func (d *TermsDictionary) Ordinal(term string) (int, bool) {
+	if d == nil {
+		return 0, false
+	}
+	ord, ok := d.ordinals[term]
+	return ord, ok
+}
+
+// Value 返回 ordinal 对应的解码值
+func (d *TermsDictionary) Value(ord int) interface{} {
+	if d == nil || ord < 0 || ord >= len(d.values) {
+		return nil
+	}
+	return d.values[ord]
+}
+
+// Lookup 查找词项解码后的值
+func (d *TermsDictionary) Lookup(term string) (interface{}, bool) {
+	ord, ok := d.Ordinal(term)
+	if !ok {
+		return nil, false
+	}
+	return d.values[ord], true
+}
+
+// Size 返回字典中的词项数
+func (d *TermsDictionary) Size() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.values)
+}
+
+// buildTermsDictionary 遍历字段词典构建词项字典，词项数超过上限时返回 nil
+// 解码结果为空字符串的词项（如数值字段 shift>0 的中间词项）不进入字典
+func buildTermsDictionary(idx bleve.Index, field string, decode TermDecoder) (*TermsDictionary, error) {
+	dict, err := idx.FieldDict(field)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open field dictionary [%s]: %w", field, err)
+	}
+	defer dict.Close()
+
+	limit := maxTermsDictionarySize.Load()
+	d := &TermsDictionary{
+		ordinals: make(map[string]int),
+		values:   make([]interface{}, 0),
+	}
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read field dictionary [%s]: %w", field, err)
+		}
+		if entry == nil {
+			break
+		}
+		value := decode(entry.Term)
+		if s, ok := value.(string); ok && s == "" {
+			continue
+		}
+		if int64(len(d.values)) >= limit {
+			return nil, nil
+		}
+		d.ordinals[entry.Term] = len(d.values)
+		d.values = append(d.values, value)
+	}
+	return d, nil
+}
+
+// termsDictionaryCache 单个已打开索引的字段词项字典缓存
+type termsDictionaryCache struct {
+	mu     sync.Mutex
+	fields map[string]*TermsDictionary // 字段 -> 字典（nil 表示字段基数过高，不缓存）
+}
+
+// TermsDictionary 获取索引字段的词项字典，首次访问时构建并缓存
+// 返回 nil 表示该字段不缓存（词项数超过上限）
+func (im *IndexManager) TermsDictionary(idx bleve.Index, field string, decode TermDecoder) (*TermsDictionary, error) {
+	val, _ := im.termsDicts.LoadOrStore(idx, &termsDictionaryCache{fields: make(map[string]*TermsDictionary)})
+	cache := val.(*termsDictionaryCache)
+
+	// 同一字段的字典只构建一次，并发请求等待构建完成
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if d, ok := cache.fields[field]; ok {
+		return d, nil
+	}
+	d, err := buildTermsDictionary(idx, field, decode)
+	if err != nil {
+		return nil, err
+	}
+	cache.fields[field] = d
+	return d, nil
+}
+
+// InvalidateTermsDictionaries 使索引的词项字典缓存失效
+func (im *IndexManager) InvalidateTermsDictionaries(indexName string) {
+	if val, exists := im.indices.Load(indexName); exists {
+		im.termsDicts.Delete(val)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+)
+
+// MigrateIndexTier 将索引在线迁移到指定层的数据目录
+// 先把当前快照的段文件复制到目标层的临时目录（迁移期间索引保持可读），
+// 再短暂关闭索引，替换索引目录后重新打开。调用方需在迁移期间阻止写入
+func (im *IndexManager) MigrateIndexTier(ctx context.Context, indexName, tier string) error {
+	idx, err := im.GetIndex(indexName)
+	if err != nil {
+		return err
+	}
+	copyable, ok := idx.(bleve.IndexCopyable)
+	if !ok {
+		return fmt.Errorf("index [%s] does not support copying", indexName)
+	}
+	// 内存段落盘后才能被复制
+	if err := im.FlushIndex(ctx, indexName); err != nil {
+		return err
+	}
+
+	stagingPath, err := im.dirMgr.StageIndexOnTier(indexName, tier)
+	if err != nil {
+		return err
+	}
+	// 打开标记属于当前打开的实例，重新打开时会在新目录写入
+	if err := os.Remove(filepath.Join(stagingPath, openMarkerFile)); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(stagingPath)
+		return fmt.Errorf("failed to remove open marker of index [%s]: %w", indexName, err)
+	}
+	// 同一文件系统上硬链接段文件，跨文件系统时复制
+	if err := copyable.CopyTo(bleve.HardLinkDirectory(filepath.Join(stagingPath, "store"))); err != nil {
+		os.RemoveAll(stagingPath)
+		return fmt.Errorf("failed to copy index [%s] files: %w", indexName, err)
+	}
+	if err := ctx.Err(); err != nil {
+		os.RemoveAll(stagingPath)
+		return err
+	}
+
+	// 持有 openMu，避免关闭后被并发请求从原目录重新打开
+	im.openMu.Lock()
+	im.CloseIndex(indexName)
+	err = im.dirMgr.CommitIndexTier(indexName, stagingPath)
+	im.openMu.Unlock()
+	if err != nil {
+		os.RemoveAll(stagingPath)
+		if _, openErr := im.GetIndex(indexName); openErr != nil {
+			return fmt.Errorf("%v (failed to reopen index: %v)", err, openErr)
+		}
+		return err
+	}
+
+	_, err = im.GetIndex(indexName)
+	return err
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/index/scorch"
+)
+
+// 存储校验
+// 逐个检查索引当前快照中的段：持久化段按 zap 文件尾部的 CRC-32 校验和重新计算文件内容，
+// 并检查删除文档数不超过段文档数；内存段尚未落盘，跳过校验和。
+// _verify 接口在此基础上比较 mapping 字段与已索引字段；非正常关闭后重新打开时自动执行（见 openStore）。
+
+// SegmentVerification 单个段的校验结果
+type SegmentVerification struct {
+	Name        string `json:"name"`
+	Docs        uint64 `json:"num_docs"`
+	DeletedDocs uint64 `json:"deleted_docs"`
+	SizeInBytes uint64 `json:"size_in_bytes"`
+	Checksum    string `json:"checksum,omitempty"`
+	InMemory    bool   `json:"in_memory"`
+	Valid       bool   `json:"valid"`
+	Error       string `json:"error,omitempty"`
+}
+
+// StoreVerification 索引存储的校验结果
+type StoreVerification struct {
+	Segments      []*SegmentVerification
+	IndexedFields []string // 各段已索引字段的并集（已排序）
+	Problems      []string
+}
+
+// Valid 是否未发现问题
+func (v *StoreVerification) Valid() bool {
+	return len(v.Problems) == 0
+}
+
+// checksummedSegment zap 段：文件路径与写入时记录的 CRC-32
+type checksummedSegment interface {
+	Path() string
+	CRC() uint32
+}
+
+// VerifyStore 校验索引当前快照的所有段
+func VerifyStore(idx bleve.Index) (*StoreVerification, error) {
+	advIdx, err := idx.Advanced()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get advanced index: %w", err)
+	}
+	reader, err := advIdx.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reader: %w", err)
+	}
+	defer reader.Close()
+
+	rv := &StoreVerification{}
+	fields := make(map[string]struct{})
+	snapshot, ok := reader.(*scorch.IndexSnapshot)
+	if !ok {
+		// 非 scorch 存储没有段信息，只收集字段
+		names, err := idx.Fields()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list fields: %w", err)
+		}
+		rv.IndexedFields = names
+		sort.Strings(rv.IndexedFields)
+		return rv, nil
+	}
+
+	for _, ss := range snapshot.Segments() {
+		sv := &SegmentVerification{
+			Docs:        ss.Count(),
+			SizeInBytes: uint64(ss.FileSize()),
+			InMemory:    true,
+			Valid:       true,
+		}
+		if deleted := ss.Deleted(); deleted != nil {
+			sv.DeletedDocs = deleted.GetCardinality()
+		}
+		if seg, ok := ss.Segment().(checksummedSegment); ok && seg.Path() != "" {
+			sv.Name = filepath.Base(seg.Path())
+			sv.InMemory = false
+			sv.Checksum = fmt.Sprintf("%08x", seg.CRC())
+			if err := verifySegmentChecksum(seg.Path(), seg.CRC()); err != nil {
+				sv.Valid = false
+				sv.Error = err.Error()
+			}
+		} else {
+			sv.Name = fmt.Sprintf("memory_%d", ss.Id())
+		}
+		if sv.Valid && sv.DeletedDocs > sv.Docs {
+			sv.Valid = false
+			sv.Error = fmt.Sprintf("%d deleted docs exceed %d docs", sv.DeletedDocs, sv.Docs)
+		}
+		if !sv.Valid {
+			rv.Problems = append(rv.Problems, fmt.Sprintf("segment [%s]: %s", sv.Name, sv.Error))
+		}
+		for _, field := range ss.Fields() {
+			fields[field] = struct{}{}
+		}
+		rv.Segments = append(rv.Segments, sv)
+	}
+
+	for field := range fields {
+		rv.IndexedFields = append(rv.IndexedFields, field)
+	}
+	sort.Strings(rv.IndexedFields)
+	return rv, nil
+}
+
+// verifySegmentChecksum 重新计算 zap 段文件的 CRC-32（文件尾部 4 字节之前的全部内容），
+// 与文件尾部记录的校验和以及段打开时读取的校验和比较
+func verifySegmentChecksum(path string, expected uint32) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open segment file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat segment file: %w", err)
+	}
+	if info.Size() < 4 {
+		return fmt.Errorf("segment file truncated to %d bytes", info.Size())
+	}
+
+	hash := crc32.NewIEEE()
+	if _, err := io.CopyN(hash, f, info.Size()-4); err != nil {
+		return fmt.Errorf("failed to read segment file: %w", err)
+	}
+	var footer [4]byte
+	if _, err := io.ReadFull(f, footer[:]); err != nil {
+		return fmt.Errorf("failed to read segment checksum: %w", err)
+	}
+	stored := binary.BigEndian.Uint32(footer[:])
+	if stored != expected {
+		return fmt.Errorf("checksum footer changed from [%08x] to [%08x] since the segment was opened", expected, stored)
+	}
+	if actual := hash.Sum32(); actual != stored {
+		return fmt.Errorf("checksum failed (hardware problem?) : expected=%08x actual=%08x", stored, actual)
+	}
+	return nil
+}
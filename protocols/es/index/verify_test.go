@@ -0,0 +1,117 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/metadata"
+)
+
+func TestOpenAfterUncleanShutdown(t *testing.T) {
+	tempDir := t.TempDir()
+	dirMgr, err := directory.NewDirectoryManager(directory.DefaultDirectoryConfig(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaStore, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{StorageType: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metaStore.Close()
+
+	for _, name := range []string{"clean", "crashed"} {
+		if err := dirMgr.CreateIndex(name); err != nil {
+			t.Fatal(err)
+		}
+		idx, err := bleve.New(filepath.Join(dirMgr.GetIndexPath(name), "store"), bleve.NewIndexMapping())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Index("1", map[string]interface{}{"msg": "hello"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	marker := func(name string) string {
+		return filepath.Join(dirMgr.GetIndexPath(name), openMarkerFile)
+	}
+
+	// 打开期间存在标记文件，正常关闭后删除
+	im := NewIndexManager(dirMgr, metaStore)
+	if _, err := im.GetIndex("clean"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker("clean")); err != nil {
+		t.Fatalf("expected open marker: %v", err)
+	}
+	if err := im.CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker("clean")); !os.IsNotExist(err) {
+		t.Fatalf("expected open marker to be removed, got %v", err)
+	}
+
+	// 两个段文件都被损坏，只有未正常关闭的索引在打开时校验
+	for _, name := range []string{"clean", "crashed"} {
+		files, err := filepath.Glob(filepath.Join(dirMgr.GetIndexPath(name), "store", "store", "*.zap"))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("expected one segment file for [%s], got %v (%v)", name, files, err)
+		}
+		f, err := os.OpenFile(files[0], os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteAt([]byte{0xff, 0xff}, 0); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	if err := os.WriteFile(marker("crashed"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	im = NewIndexManager(dirMgr, metaStore)
+	defer im.CloseAll()
+	result := im.RecoverAllIndices()
+	if len(result.Opened) != 1 || result.Opened[0] != "clean" ||
+		len(result.Quarantined) != 1 || result.Quarantined[0] != "crashed" {
+		t.Fatalf("unexpected recovery result: %+v", result)
+	}
+	quarantined := im.Quarantined("crashed")
+	if quarantined == nil || !strings.Contains(quarantined.Reason, "failed verification") {
+		t.Errorf("expected verification failure, got %+v", quarantined)
+	}
+
+	// 显式校验可以发现未触发自动校验的损坏
+	idx, err := im.GetIndex("clean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verification, err := VerifyStore(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Valid() || len(verification.Segments) != 1 || verification.Segments[0].Valid {
+		t.Errorf("expected corrupted segment, got %+v", verification.Segments)
+	}
+}
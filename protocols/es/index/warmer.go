@@ -0,0 +1,105 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package es
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	bleve "github.com/lscgzwd/tiggerdb"
+)
+
+// 索引预热
+// 索引打开后执行上层注册的预热回调（按索引设置预加载字段词典、doc values 并执行预热查询），
+// 避免重启后的第一次查询因冷缓存慢数倍。启动恢复阶段在恢复 goroutine 中同步预热，
+// 按需打开的索引在后台预热，不阻塞打开索引的请求。
+
+// DefaultWarmupTimeout 单个索引预热的最长时间，超时后剩余的预热步骤被取消
+const DefaultWarmupTimeout = time.Minute
+
+// IndexWarmer 索引预热回调
+type IndexWarmer func(ctx context.Context, indexName string, idx bleve.Index) error
+
+// WarmerStats 索引的预热统计
+type WarmerStats struct {
+	Current   int64  `json:"current"`
+	Total     uint64 `json:"total"`
+	TotalTime uint64 `json:"total_time_in_millis"`
+	Failed    uint64 `json:"failed"`
+}
+
+// warmerStats 预热统计计数器
+type warmerStats struct {
+	current   atomic.Int64
+	total     atomic.Uint64
+	totalTime atomic.Uint64 // 纳秒
+	failed    atomic.Uint64
+}
+
+// SetWarmer 设置索引打开后执行的预热回调，需在打开任何索引之前调用
+func (im *IndexManager) SetWarmer(warmer IndexWarmer) {
+	im.openMu.Lock()
+	defer im.openMu.Unlock()
+	im.warmer = warmer
+}
+
+// currentWarmer 返回当前设置的预热回调
+func (im *IndexManager) currentWarmer() IndexWarmer {
+	im.openMu.Lock()
+	defer im.openMu.Unlock()
+	return im.warmer
+}
+
+// warmIndex 执行索引的预热回调并记录统计，未设置回调时直接返回
+func (im *IndexManager) warmIndex(indexName string, idx bleve.Index, warmer IndexWarmer) {
+	if warmer == nil {
+		return
+	}
+	val, _ := im.warmerStats.LoadOrStore(indexName, &warmerStats{})
+	stats := val.(*warmerStats)
+
+	stats.current.Add(1)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultWarmupTimeout)
+	err := warmer(ctx, indexName, idx)
+	cancel()
+	took := time.Since(start)
+	stats.current.Add(-1)
+	stats.total.Add(1)
+	stats.totalTime.Add(uint64(took))
+	if err != nil {
+		stats.failed.Add(1)
+		log.Printf("WARN: Failed to warm up index [%s]: %v", indexName, err)
+		return
+	}
+	log.Printf("[IndexManager] Warmed up index [%s] in %s", indexName, took)
+}
+
+// WarmerStats 返回索引的预热统计
+func (im *IndexManager) WarmerStats(indexName string) WarmerStats {
+	val, exists := im.warmerStats.Load(indexName)
+	if !exists {
+		return WarmerStats{}
+	}
+	stats := val.(*warmerStats)
+	return WarmerStats{
+		Current:   stats.current.Load(),
+		Total:     stats.total.Load(),
+		TotalTime: stats.totalTime.Load() / uint64(time.Millisecond),
+		Failed:    stats.failed.Load(),
+	}
+}
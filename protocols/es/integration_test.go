@@ -439,3 +439,138 @@ func TestESIntegration_Aggregations(t *testing.T) {
 		t.Error("Missing avg_price aggregation")
 	}
 }
+
+// TestESIntegration_ClientCompatibility 测试官方客户端的兼容性检查（版本号、产品头、compatible-with）
+func TestESIntegration_ClientCompatibility(t *testing.T) {
+	_, baseURL, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	req, _ := http.NewRequest("GET", baseURL+"/", nil)
+	req.Header.Set("Accept", "application/vnd.elasticsearch+json; compatible-with=8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get root info: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Elastic-Product"); got != "Elasticsearch" {
+		t.Errorf("Expected X-Elastic-Product header, got %q", got)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/vnd.elasticsearch+json;compatible-with=8" {
+		t.Errorf("Expected compatible Content-Type, got %q", got)
+	}
+	var info struct {
+		Version struct {
+			Number string `json:"number"`
+		} `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode root info: %v", err)
+	}
+	if info.Version.Number != "7.10.2" {
+		t.Errorf("Expected version.number 7.10.2, got %q", info.Version.Number)
+	}
+}
+
+// TestESIntegration_ShutdownAPI 测试 POST /_shutdown 请求优雅关闭
+func TestESIntegration_ShutdownAPI(t *testing.T) {
+	esSrv, baseURL, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	resp, err := http.Post(baseURL+"/_shutdown?drain=maybe", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Failed to request shutdown: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid drain, got %d", resp.StatusCode)
+	}
+	select {
+	case <-esSrv.ShutdownRequested():
+		t.Fatal("Expected no shutdown request for an invalid request")
+	default:
+	}
+
+	resp, err = http.Post(baseURL+"/_shutdown?drain=true&timeout=5s", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Failed to request shutdown: %v", err)
+	}
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || body["acknowledged"] != true {
+		t.Fatalf("Expected acknowledged shutdown, got %d %v", resp.StatusCode, body)
+	}
+
+	select {
+	case <-esSrv.ShutdownRequested():
+	case <-time.After(time.Second):
+		t.Fatal("Expected shutdown to be requested")
+	}
+	if err := esSrv.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if esSrv.IsRunning() {
+		t.Error("Expected server to be stopped")
+	}
+	if _, err := http.Get(baseURL + "/"); err == nil {
+		t.Error("Expected new connections to be refused after shutdown")
+	}
+}
+
+// TestESIntegration_HealthReady 测试 /_health/ready 的依赖检查
+func TestESIntegration_HealthReady(t *testing.T) {
+	esSrv, baseURL, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	getReady := func() (int, map[string]interface{}) {
+		resp, err := http.Get(baseURL + "/_health/ready")
+		if err != nil {
+			t.Fatalf("Failed to get readiness: %v", err)
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	code, body := getReady()
+	if code != http.StatusOK {
+		t.Fatalf("Expected ready, got %d %v", code, body)
+	}
+	checks, _ := body["checks"].(map[string]interface{})
+	for _, name := range []string{"metadata_store", "data_dir", "disk_watermark", "critical_indices"} {
+		if check, _ := checks[name].(map[string]interface{}); check["status"] != "ok" {
+			t.Errorf("Expected check [%s] to be ok, got %v", name, checks[name])
+		}
+	}
+
+	// 关键索引不存在时未就绪，创建后恢复就绪
+	esSrv.mu.Lock()
+	esSrv.config.Readiness = &ReadinessConfig{CriticalIndices: []string{"critical"}}
+	esSrv.mu.Unlock()
+	if code, body := getReady(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for a missing critical index, got %d %v", code, body)
+	}
+	req, _ := http.NewRequest("PUT", baseURL+"/critical", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	resp.Body.Close()
+	if code, body := getReady(); code != http.StatusOK {
+		t.Errorf("Expected ready after creating the critical index, got %d %v", code, body)
+	}
+
+	resp, err = http.Get(baseURL + "/_health/live")
+	if err != nil {
+		t.Fatalf("Failed to get liveness: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected live 200, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/metadata"
+)
+
+// APIKeyConfig 配置文件中定义的 API Key
+type APIKeyConfig struct {
+	// 列表与撤销使用的 ID，为空时由 Key 的摘要生成
+	ID   string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+	Key  string `json:"key" yaml:"key"`
+	// 过期时间（RFC 3339），未设置时永不过期
+	Expiration time.Time `json:"expiration,omitempty" yaml:"expiration,omitempty"`
+	// Key 映射的角色（与 api_key_roles 中的角色合并）
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// 每分钟请求数上限，0 表示不限制
+	RateLimitRPM int `json:"rate_limit_rpm,omitempty" yaml:"rate_limit_rpm,omitempty"`
+}
+
+// APIKey 可用于认证的 API Key（配置文件中的 Key 或通过 API 创建的 Key）
+type APIKey struct {
+	ID           string
+	Name         string
+	Roles        []string
+	RateLimitRPM int
+	Expiration   time.Time // 零值表示永不过期
+	CreatedAt    time.Time
+	Invalidated  bool
+	hash         string
+}
+
+// Active 返回 Key 在 now 时是否可用（未撤销且未过期）
+func (k *APIKey) Active(now time.Time) bool {
+	return !k.Invalidated && (k.Expiration.IsZero() || now.Before(k.Expiration))
+}
+
+// apiKeyHash 返回 Key 的 SHA-256 摘要（十六进制），存储与查找只使用摘要
+func apiKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyService API Key 认证与管理
+// 配置文件中的 Key（apikeys 与 api_keys）启动时加载，通过 API 创建的 Key 与撤销记录保存在元数据存储中
+type APIKeyService struct {
+	config *AuthConfig
+	store  metadata.APIKeyStore // 为 nil 时不能创建或撤销 Key
+	mu     sync.RWMutex
+	byHash map[string]*APIKey
+	byID   map[string]*APIKey
+}
+
+// NewAPIKeyService 创建 API Key 服务，store 为 nil 时只使用配置文件中的 Key
+func NewAPIKeyService(config *AuthConfig, store metadata.APIKeyStore) (*APIKeyService, error) {
+	s := &APIKeyService{
+		config: config,
+		store:  store,
+		byHash: make(map[string]*APIKey),
+		byID:   make(map[string]*APIKey),
+	}
+	for key, enabled := range config.ApiKeys {
+		if enabled {
+			hash := apiKeyHash(key)
+			s.add(&APIKey{ID: hash[:20], hash: hash})
+		}
+	}
+	for _, kc := range config.APIKeyDefs {
+		hash := apiKeyHash(kc.Key)
+		id := kc.ID
+		if id == "" {
+			id = hash[:20]
+		}
+		s.add(&APIKey{ID: id, Name: kc.Name, Roles: kc.Roles, RateLimitRPM: kc.RateLimitRPM, Expiration: kc.Expiration, hash: hash})
+	}
+	if store == nil {
+		return s, nil
+	}
+
+	stored, err := store.ListAPIKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load api keys: %w", err)
+	}
+	for _, sk := range stored {
+		if sk.KeyHash == "" {
+			// 配置文件中 Key 的撤销记录
+			if key := s.byID[sk.ID]; key != nil {
+				key.Invalidated = sk.Invalidated
+			}
+			continue
+		}
+		key := &APIKey{
+			ID: sk.ID, Name: sk.Name, Roles: sk.Roles, RateLimitRPM: sk.RateLimitRPM,
+			CreatedAt: sk.CreatedAt, Invalidated: sk.Invalidated, hash: sk.KeyHash,
+		}
+		if sk.Expiration != nil {
+			key.Expiration = *sk.Expiration
+		}
+		s.add(key)
+	}
+	return s, nil
+}
+
+func (s *APIKeyService) add(key *APIKey) {
+	s.byHash[key.hash] = key
+	s.byID[key.ID] = key
+}
+
+// Authenticate 返回 Key 对应的可用 API Key，Key 不存在、已撤销或已过期时返回 nil
+func (s *APIKeyService) Authenticate(secret string) *APIKey {
+	if secret == "" {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key := s.byHash[apiKeyHash(secret)]; key != nil && key.Active(time.Now()) {
+		return key
+	}
+	return nil
+}
+
+// Create 创建 API Key，返回 Key 定义与 Key 明文（明文只在创建时返回）；expiration <= 0 表示永不过期
+func (s *APIKeyService) Create(name string, expiration time.Duration, roles []string, rateLimitRPM int) (*APIKey, string, error) {
+	if s.store == nil {
+		return nil, "", fmt.Errorf("api key management is not available")
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("api key name is required")
+	}
+	if rateLimitRPM < 0 {
+		return nil, "", fmt.Errorf("rate_limit_rpm cannot be negative")
+	}
+	for _, role := range roles {
+		if s.config.Roles[role] == nil {
+			return nil, "", fmt.Errorf("unknown role [%s]", role)
+		}
+	}
+
+	idBytes := make([]byte, 10)
+	secretBytes := make([]byte, 24)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+	now := time.Now().UTC()
+	key := &APIKey{
+		ID: hex.EncodeToString(idBytes), Name: name, Roles: roles, RateLimitRPM: rateLimitRPM,
+		CreatedAt: now, hash: apiKeyHash(secret),
+	}
+	stored := &metadata.APIKey{
+		ID: key.ID, Name: name, KeyHash: key.hash, Roles: roles, RateLimitRPM: rateLimitRPM, CreatedAt: now,
+	}
+	if expiration > 0 {
+		key.Expiration = now.Add(expiration)
+		stored.Expiration = &key.Expiration
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.store.SaveAPIKey(stored); err != nil {
+		return nil, "", err
+	}
+	s.add(key)
+	return key, secret, nil
+}
+
+// Invalidate 撤销 ID 匹配 ids 或名称为 name 的 Key，返回本次撤销与之前已撤销的 Key 的 ID
+func (s *APIKeyService) Invalidate(ids []string, name string) (invalidated, previously []string, err error) {
+	if s.store == nil {
+		return nil, nil, fmt.Errorf("api key management is not available")
+	}
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.sortedKeys() {
+		if !wanted[key.ID] && (name == "" || key.Name != name) {
+			continue
+		}
+		if key.Invalidated {
+			previously = append(previously, key.ID)
+			continue
+		}
+		stored := &metadata.APIKey{ID: key.ID, Invalidated: true}
+		if !key.CreatedAt.IsZero() {
+			// 通过 API 创建的 Key 保留完整定义
+			stored = &metadata.APIKey{
+				ID: key.ID, Name: key.Name, KeyHash: key.hash, Roles: key.Roles, RateLimitRPM: key.RateLimitRPM,
+				Invalidated: true, CreatedAt: key.CreatedAt,
+			}
+			if !key.Expiration.IsZero() {
+				stored.Expiration = &key.Expiration
+			}
+		}
+		if err := s.store.SaveAPIKey(stored); err != nil {
+			return invalidated, previously, err
+		}
+		key.Invalidated = true
+		invalidated = append(invalidated, key.ID)
+	}
+	return invalidated, previously, nil
+}
+
+// List 返回可用的 Key（按 ID 排序）
+func (s *APIKeyService) List() []*APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	var rv []*APIKey
+	for _, key := range s.sortedKeys() {
+		if key.Active(now) {
+			rv = append(rv, key)
+		}
+	}
+	return rv
+}
+
+func (s *APIKeyService) sortedKeys() []*APIKey {
+	keys := make([]*APIKey, 0, len(s.byID))
+	for _, key := range s.byID {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+type apiKeyContextKey struct{}
+
+// WithAPIKey 返回携带认证所用 API Key 的 context
+func WithAPIKey(ctx context.Context, key *APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext 返回请求认证所用的 API Key，不是通过 API Key 认证的请求返回 nil
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+// apiKeyRateLimit 返回请求的按 Key 限流键与每分钟请求数
+func apiKeyRateLimit(r *http.Request) (string, int) {
+	if key := APIKeyFromContext(r.Context()); key != nil {
+		return key.ID, key.RateLimitRPM
+	}
+	return "", 0
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/audit"
+	"github.com/lscgzwd/tiggerdb/logger"
+)
+
+// maxAuditSummaryBytes 审计事件中记录的请求体摘要最大长度
+const maxAuditSummaryBytes = 512
+
+// AuditMiddleware 创建审计中间件：按请求方法和路径识别安全相关操作，请求完成后写入审计日志
+// 返回 401/403 的请求分别记录为 auth_failure/access_denied
+// 需要在多租户中间件之外注册，以便记录租户解析失败的请求
+func AuditMiddleware(auditLog *audit.Logger) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			segments := splitPath(r.URL.Path)
+			eventType := classifyAuditEvent(r.Method, segments)
+
+			event := &audit.Event{
+				User:         auditUser(r),
+				SourceIP:     remoteIP(r.RemoteAddr),
+				ForwardedFor: r.Header.Get("X-Forwarded-For"),
+				Method:       r.Method,
+				Path:         r.URL.Path,
+			}
+			if len(segments) > 0 && !strings.HasPrefix(segments[0], "_") {
+				event.Index = segments[0]
+			}
+			if eventType != "" && auditLog.Enabled(eventType) {
+				event.Summary = auditRequestSummary(r, segments)
+				// 不包含删除操作的 bulk 请求不记录
+				if segments[len(segments)-1] == "_bulk" && event.Summary == "" {
+					eventType = ""
+				}
+			}
+
+			rw := &auditResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next(rw, r.WithContext(audit.WithEvent(r.Context(), event)))
+
+			switch rw.statusCode {
+			case http.StatusUnauthorized:
+				eventType = attemptedOperation(event, eventType, audit.EventAuthFailure)
+			case http.StatusForbidden:
+				eventType = attemptedOperation(event, eventType, audit.EventAccessDenied)
+			}
+			if eventType == "" {
+				return
+			}
+
+			event.Timestamp = start
+			event.Type = eventType
+			event.Status = rw.statusCode
+			event.DurationMs = time.Since(start).Milliseconds()
+			event.Outcome = "success"
+			if rw.statusCode >= 400 {
+				event.Outcome = "failure"
+			}
+			if err := auditLog.Log(event); err != nil {
+				logger.Error("Failed to write audit event [%s %s]: %v", r.Method, r.URL.Path, err)
+			}
+		}
+	}
+}
+
+// attemptedOperation 被拒绝的请求记录为 deniedType，摘要中保留原本尝试的操作
+func attemptedOperation(event *audit.Event, eventType, deniedType string) string {
+	if eventType != "" {
+		event.Summary = strings.TrimSpace("attempted " + eventType + " " + event.Summary)
+	}
+	return deniedType
+}
+
+func splitPath(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// classifyAuditEvent 返回请求对应的审计事件类型，无需审计的请求返回空字符串
+func classifyAuditEvent(method string, segments []string) string {
+	if len(segments) == 0 || method == http.MethodGet || method == http.MethodHead {
+		return ""
+	}
+
+	if strings.HasPrefix(segments[0], "_") {
+		switch {
+		case segments[0] == "_aliases" && method == http.MethodPost:
+			return audit.EventAliasUpdate
+		case segments[0] == "_bulk" && method == http.MethodPost:
+			return audit.EventDocumentDelete
+		case segments[0] == "_cluster" && len(segments) == 2 && segments[1] == "settings" && method == http.MethodPut:
+			return audit.EventClusterSettingsUpdate
+		case segments[0] == "_scripts" && len(segments) == 2:
+			return audit.EventScriptUpdate
+		}
+		return ""
+	}
+
+	if len(segments) == 1 {
+		switch method {
+		case http.MethodPut:
+			return audit.EventIndexCreate
+		case http.MethodDelete:
+			return audit.EventIndexDelete
+		}
+		return ""
+	}
+
+	switch op := segments[1]; {
+	case op == "_mapping" && method == http.MethodPut:
+		return audit.EventMappingUpdate
+	case op == "_meta" && len(segments) == 4 && segments[2] == "rollback":
+		return audit.EventMappingUpdate
+	case (op == "_settings" || op == "_block") && method == http.MethodPut:
+		return audit.EventSettingsUpdate
+	case op == "_open" && method == http.MethodPost:
+		return audit.EventIndexOpen
+	case op == "_close" && method == http.MethodPost:
+		return audit.EventIndexClose
+	case op == "_alias" && len(segments) == 3:
+		return audit.EventAliasUpdate
+	case op == "_doc" && len(segments) == 3 && method == http.MethodDelete:
+		return audit.EventDocumentDelete
+	case op == "_delete_by_query" || op == "_bulk":
+		return audit.EventDocumentDelete
+	}
+	return ""
+}
+
+// auditRequestSummary 生成请求摘要：bulk 请求只统计删除操作数（不记录文档内容），其他请求记录截断后的请求体
+func auditRequestSummary(r *http.Request, segments []string) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		// 保留读取错误（如超出请求体大小限制），由处理器返回相应的错误响应
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+		return ""
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+
+	if segments[len(segments)-1] == "_bulk" {
+		deletes := 0
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+		for scanner.Scan() {
+			var line map[string]json.RawMessage
+			if json.Unmarshal(scanner.Bytes(), &line) == nil && len(line) == 1 && line["delete"] != nil {
+				deletes++
+			}
+		}
+		if deletes == 0 {
+			return ""
+		}
+		return fmt.Sprintf("bulk request with %d delete actions", deletes)
+	}
+
+	var compact bytes.Buffer
+	if json.Compact(&compact, body) == nil {
+		body = compact.Bytes()
+	}
+	if len(body) > maxAuditSummaryBytes {
+		return string(body[:maxAuditSummaryBytes]) + "..."
+	}
+	return string(body)
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// auditUser 返回请求的用户：Basic Auth 用户名，或脱敏后的 API Key
+func auditUser(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Basic ") {
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authHeader, "Basic ")); err == nil {
+			return strings.SplitN(string(decoded), ":", 2)[0]
+		}
+	}
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" && strings.HasPrefix(authHeader, "Bearer ") {
+		apiKey = strings.TrimPrefix(authHeader, "Bearer ")
+	}
+	if apiKey == "" {
+		return ""
+	}
+	if len(apiKey) > 4 {
+		apiKey = apiKey[:4]
+	}
+	return "api_key:" + apiKey + "****"
+}
+
+func remoteIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// auditResponseWriter 记录响应状态码，支持流式响应的 Flush
+type auditResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *auditResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 返回被包装的 ResponseWriter，供 http.ResponseController 设置写超时
+func (w *auditResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/audit"
+)
+
+func TestAuditMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.NewLogger(&audit.Config{Enabled: true, Path: path})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+
+	// 审计中间件在多租户中间件之外，内层处理器返回固定状态码
+	status := http.StatusOK
+	inner := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}
+	handler := AuditMiddleware(auditLog)(TenantMiddleware(&TenantConfig{Enabled: true, AllowUnscoped: true})(inner))
+	do := func(method, target, body string, headers map[string]string) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.RemoteAddr = "10.0.0.1:5000"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		handler(httptest.NewRecorder(), req)
+	}
+
+	do("PUT", "/logs", `{"settings": {"number_of_replicas": 0}}`, map[string]string{"X-Tenant": "team-a"})
+	do("GET", "/logs/_search", "", nil)
+	do("POST", "/_bulk", "{\"index\":{\"_index\":\"logs\"}}\n{\"a\":1}\n", nil)
+	do("POST", "/_bulk", "{\"delete\":{\"_index\":\"logs\",\"_id\":\"1\"}}\n{\"delete\":{\"_index\":\"logs\",\"_id\":\"2\"}}\n", map[string]string{"X-API-Key": "secret-key"})
+	status = http.StatusUnauthorized
+	do("DELETE", "/logs", "", map[string]string{"Authorization": "Basic YWRtaW46d3Jvbmc="})
+	auditLog.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer file.Close()
+	var events []audit.Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event audit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid audit line: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 audit events (create, bulk delete, auth failure), got %+v", events)
+	}
+	create := events[0]
+	if create.Type != audit.EventIndexCreate || create.Index != "logs" || create.Tenant != "team-a" ||
+		create.SourceIP != "10.0.0.1" || create.Outcome != "success" || !strings.Contains(create.Summary, "number_of_replicas") {
+		t.Errorf("Unexpected index create event: %+v", create)
+	}
+	bulk := events[1]
+	if bulk.Type != audit.EventDocumentDelete || bulk.Summary != "bulk request with 2 delete actions" || bulk.User != "api_key:secr****" {
+		t.Errorf("Unexpected bulk delete event: %+v", bulk)
+	}
+	failure := events[2]
+	if failure.Type != audit.EventAuthFailure || failure.User != "admin" || failure.Outcome != "failure" ||
+		failure.Status != http.StatusUnauthorized || !strings.Contains(failure.Summary, audit.EventIndexDelete) {
+		t.Errorf("Unexpected auth failure event: %+v", failure)
+	}
+}
@@ -16,10 +16,12 @@ package middleware
 
 import (
 	"encoding/base64"
+	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
 )
 
 // AuthConfig 认证配置
@@ -30,6 +32,15 @@ type AuthConfig struct {
 	Password string          // Basic Auth 密码
 	ApiKeys  map[string]bool // API Key 列表
 	Realm    string          // 认证域
+
+	// 角色定义（角色名 -> 角色），用于字段级与文档级安全
+	Roles map[string]*Role `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// Basic Auth 用户名到角色名的映射
+	UserRoles map[string][]string `json:"user_roles,omitempty" yaml:"user_roles,omitempty"`
+	// API Key（X-API-Key 或 Bearer Token）到角色名的映射
+	APIKeyRoles map[string][]string `json:"api_key_roles,omitempty" yaml:"api_key_roles,omitempty"`
+	// 带过期时间、角色与限流的 API Key 定义（与 apikeys 一样用于 bearer 与 apikey 认证）
+	APIKeyDefs []*APIKeyConfig `json:"api_keys,omitempty" yaml:"api_keys,omitempty"`
 }
 
 // DefaultAuthConfig 返回默认认证配置
@@ -44,9 +55,58 @@ func DefaultAuthConfig() *AuthConfig {
 	}
 }
 
+// Validate 验证认证配置中的角色定义与角色映射
+func (c *AuthConfig) Validate() error {
+	for name, role := range c.Roles {
+		if role == nil {
+			return fmt.Errorf("role [%s] is empty", name)
+		}
+		if err := role.Validate(name); err != nil {
+			return err
+		}
+	}
+	ids := make(map[string]bool, len(c.APIKeyDefs))
+	for i, kc := range c.APIKeyDefs {
+		if kc == nil || kc.Key == "" {
+			return fmt.Errorf("api_keys[%d]: key cannot be empty", i)
+		}
+		if kc.RateLimitRPM < 0 {
+			return fmt.Errorf("api_keys[%d]: rate_limit_rpm cannot be negative", i)
+		}
+		if kc.ID != "" {
+			if ids[kc.ID] {
+				return fmt.Errorf("api_keys[%d]: duplicate id [%s]", i, kc.ID)
+			}
+			ids[kc.ID] = true
+		}
+		for _, name := range kc.Roles {
+			if c.Roles[name] == nil {
+				return fmt.Errorf("unknown role [%s]", name)
+			}
+		}
+	}
+	for _, mapping := range []map[string][]string{c.UserRoles, c.APIKeyRoles} {
+		for _, names := range mapping {
+			for _, name := range names {
+				if c.Roles[name] == nil {
+					return fmt.Errorf("unknown role [%s]", name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // AuthMiddleware 创建认证中间件
-func AuthMiddleware(config *AuthConfig) func(http.Handler) http.Handler {
+// keys 为 nil 时只使用配置文件中的 API Key；通过 API Key 认证的请求按 Key 的 rate_limit_rpm 限流
+func AuthMiddleware(config *AuthConfig, keys *APIKeyService) func(http.Handler) http.Handler {
+	if keys == nil {
+		// 不使用元数据存储时不会返回错误
+		keys, _ = NewAPIKeyService(config, nil)
+	}
+	rateLimit := server.KeyedRateLimitMiddleware(server.NewKeyedRateLimiter(), apiKeyRateLimit)
 	return func(next http.Handler) http.Handler {
+		limited := rateLimit(next.ServeHTTP)
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// 检查是否启用认证
 			if !config.Enabled {
@@ -62,7 +122,8 @@ func AuthMiddleware(config *AuthConfig) func(http.Handler) http.Handler {
 			}
 
 			// 执行认证检查
-			if !checkAuth(r, config) {
+			ok, key := checkAuth(r, config, keys)
+			if !ok {
 				// 认证失败
 				logger.Warn("Authentication failed for %s from %s", r.URL.Path, r.RemoteAddr)
 				w.Header().Set("WWW-Authenticate", `Basic realm="`+config.Realm+`"`)
@@ -71,35 +132,43 @@ func AuthMiddleware(config *AuthConfig) func(http.Handler) http.Handler {
 				return
 			}
 
-			// 认证成功，继续处理请求
-			next.ServeHTTP(w, r)
+			// 认证成功，携带 API Key 与映射的角色继续处理请求
+			if key != nil {
+				r = r.WithContext(WithAPIKey(r.Context(), key))
+			}
+			if roles := requestRoles(r, config, key); len(roles) > 0 {
+				r = r.WithContext(WithRoles(r.Context(), roles))
+			}
+			limited(w, r)
 		})
 	}
 }
 
-// checkAuth 检查请求的认证信息
-func checkAuth(r *http.Request, config *AuthConfig) bool {
+// checkAuth 检查请求的认证信息，通过 API Key 认证时同时返回 Key
+func checkAuth(r *http.Request, config *AuthConfig, keys *APIKeyService) (bool, *APIKey) {
 	// 检查认证类型
 	switch config.Type {
 	case "basic":
 		// Basic Auth 需要 Authorization 头
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			return false
+			return false, nil
 		}
-		return checkBasicAuth(authHeader, config.Username, config.Password)
+		return checkBasicAuth(authHeader, config.Username, config.Password), nil
 	case "bearer":
 		// Bearer Token 需要 Authorization 头
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			return false
+			return false, nil
 		}
-		return checkBearerAuth(authHeader, config.ApiKeys)
+		key := checkBearerAuth(authHeader, keys)
+		return key != nil, key
 	case "apikey":
 		// API Key 使用 X-API-Key 头
-		return checkAPIKeyAuth(r, config.ApiKeys)
+		key := checkAPIKeyAuth(r, keys)
+		return key != nil, key
 	default:
-		return false
+		return false, nil
 	}
 }
 
@@ -131,23 +200,19 @@ func checkBasicAuth(authHeader, username, password string) bool {
 	return true
 }
 
-// checkBearerAuth 检查 Bearer Token
-func checkBearerAuth(authHeader string, apiKeys map[string]bool) bool {
+// checkBearerAuth 检查 Bearer Token，返回可用的 API Key（不存在、已撤销或已过期时返回 nil）
+func checkBearerAuth(authHeader string, keys *APIKeyService) *APIKey {
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return false
+		return nil
 	}
 
 	token := strings.TrimPrefix(authHeader, "Bearer ")
-	return apiKeys[token]
+	return keys.Authenticate(token)
 }
 
-// checkAPIKeyAuth 检查 API Key
-func checkAPIKeyAuth(r *http.Request, apiKeys map[string]bool) bool {
-	apiKey := r.Header.Get("X-API-Key")
-	if apiKey == "" {
-		return false
-	}
-	return apiKeys[apiKey]
+// checkAPIKeyAuth 检查 API Key，返回可用的 Key（不存在、已撤销或已过期时返回 nil）
+func checkAPIKeyAuth(r *http.Request, keys *APIKeyService) *APIKey {
+	return keys.Authenticate(r.Header.Get("X-API-Key"))
 }
 
 // shouldSkipAuth 检查是否需要跳过认证
@@ -160,9 +225,9 @@ func shouldSkipAuth(path string) bool {
 		"/_cat",            // Cat API（某些环境可能公开）
 	}
 
-	// 检查路径是否在跳过列表中
+	// 检查路径是否在跳过列表中（根路径只精确匹配，否则所有路径都会被跳过）
 	for _, skipPath := range skipPaths {
-		if path == skipPath || strings.HasPrefix(path, skipPath) {
+		if path == skipPath || (skipPath != "/" && strings.HasPrefix(path, skipPath)) {
 			return true
 		}
 	}
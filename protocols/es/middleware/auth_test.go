@@ -0,0 +1,68 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShouldSkipAuth(t *testing.T) {
+	cases := map[string]bool{
+		"/":                        true,
+		"/_ping":                   true,
+		"/_cluster/health":         true,
+		"/_cat/indices":            true,
+		"/orders/_search":          false,
+		"/_cluster/settings":       false,
+		"/orders/_doc/1":           false,
+		"/_security/_authenticate": false,
+	}
+	for path, want := range cases {
+		if got := shouldSkipAuth(path); got != want {
+			t.Errorf("shouldSkipAuth(%q): expected %v, got %v", path, want, got)
+		}
+	}
+}
+
+func TestAuthMiddleware_RequiresCredentials(t *testing.T) {
+	config := DefaultAuthConfig()
+	config.Enabled = true
+	config.Username = "elastic"
+	config.Password = "secret"
+	handler := AuthMiddleware(config, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(path string, withAuth bool) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if withAuth {
+			req.SetBasicAuth("elastic", "secret")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := do("/", false); code != http.StatusOK {
+		t.Errorf("root path: expected 200 without credentials, got %d", code)
+	}
+	if code := do("/orders/_search", false); code != http.StatusUnauthorized {
+		t.Errorf("index path: expected 401 without credentials, got %d", code)
+	}
+	if code := do("/orders/_search", true); code != http.StatusOK {
+		t.Errorf("index path: expected 200 with credentials, got %d", code)
+	}
+}
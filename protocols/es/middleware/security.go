@@ -0,0 +1,266 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Role 角色：按索引模式定义可见的字段（字段级安全）与文档（文档级安全）
+// 认证通过的请求按 Basic Auth 用户名或 API Key 映射到角色；没有映射角色的请求不受限制，
+// 有角色的请求只能看到其角色覆盖的索引中被授权的字段与文档
+type Role struct {
+	Indices []RoleIndexPrivileges `json:"indices" yaml:"indices"`
+}
+
+// RoleIndexPrivileges 角色对一组索引的访问限制
+type RoleIndexPrivileges struct {
+	// 索引名或通配符模式，多租户请求中为去掉租户前缀的索引名
+	Names []string `json:"names" yaml:"names"`
+	// 字段级安全，未设置时可见全部字段
+	FieldSecurity *FieldSecurity `json:"field_security,omitempty" yaml:"field_security,omitempty"`
+	// 文档级安全查询（Query DSL 对象或其 JSON 字符串），未设置时可见全部文档
+	Query interface{} `json:"query,omitempty" yaml:"query,omitempty"`
+}
+
+// FieldSecurity 字段级安全：可见 grant 中除 except 以外的字段，均支持 * 通配符
+type FieldSecurity struct {
+	Grant  []string `json:"grant" yaml:"grant"`
+	Except []string `json:"except,omitempty" yaml:"except,omitempty"`
+}
+
+// Validate 验证角色定义，JSON 字符串形式的查询解析为对象
+func (r *Role) Validate(name string) error {
+	for i := range r.Indices {
+		p := &r.Indices[i]
+		if len(p.Names) == 0 {
+			return fmt.Errorf("role [%s]: indices[%d].names cannot be empty", name, i)
+		}
+		for _, pattern := range append(append([]string{}, p.Names...), fieldSecurityPatterns(p.FieldSecurity)...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("role [%s]: invalid pattern [%s]", name, pattern)
+			}
+		}
+		switch q := p.Query.(type) {
+		case nil, map[string]interface{}:
+		case string:
+			var parsed map[string]interface{}
+			if err := json.Unmarshal([]byte(q), &parsed); err != nil {
+				return fmt.Errorf("role [%s]: failed to parse query: %v", name, err)
+			}
+			p.Query = parsed
+		default:
+			return fmt.Errorf("role [%s]: query must be an object or a JSON string", name)
+		}
+	}
+	return nil
+}
+
+func fieldSecurityPatterns(fs *FieldSecurity) []string {
+	if fs == nil {
+		return nil
+	}
+	return append(append([]string{}, fs.Grant...), fs.Except...)
+}
+
+type rolesContextKey struct{}
+
+// WithRoles 返回携带请求角色的 context
+func WithRoles(ctx context.Context, roles []*Role) context.Context {
+	return context.WithValue(ctx, rolesContextKey{}, roles)
+}
+
+// RolesFromContext 返回请求的角色，不受角色限制的请求返回 nil
+func RolesFromContext(ctx context.Context) []*Role {
+	roles, _ := ctx.Value(rolesContextKey{}).([]*Role)
+	return roles
+}
+
+// requestRoles 返回认证通过的请求映射到的角色，key 为认证所用的 API Key（其角色与 api_key_roles 合并）
+func requestRoles(r *http.Request, config *AuthConfig, key *APIKey) []*Role {
+	var names []string
+	switch config.Type {
+	case "basic":
+		if username, _, ok := r.BasicAuth(); ok {
+			names = config.UserRoles[username]
+		}
+	case "bearer":
+		names = config.APIKeyRoles[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	case "apikey":
+		names = config.APIKeyRoles[r.Header.Get("X-API-Key")]
+	}
+	if key != nil {
+		names = append(append([]string{}, names...), key.Roles...)
+	}
+	var roles []*Role
+	for _, name := range names {
+		if role := config.Roles[name]; role != nil {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// IndexAccess 请求角色对单个索引的字段级与文档级限制
+// 多个角色（或同一角色的多个索引条目）匹配同一索引时取并集：任一条目可见的字段或文档均可见
+type IndexAccess struct {
+	allFields bool
+	fields    []*FieldSecurity
+	allDocs   bool
+	queries   []map[string]interface{}
+}
+
+// IndexAccessFromContext 返回请求角色对索引的限制，不受限制时返回 nil
+// indexName 为请求看到的索引名（多租户请求已去掉租户前缀）；角色均未覆盖的索引不可见任何字段与文档
+func IndexAccessFromContext(ctx context.Context, indexName string) *IndexAccess {
+	roles := RolesFromContext(ctx)
+	if len(roles) == 0 {
+		return nil
+	}
+	access := &IndexAccess{}
+	for _, role := range roles {
+		for _, p := range role.Indices {
+			if !matchAnyPattern(p.Names, indexName) {
+				continue
+			}
+			if p.FieldSecurity == nil {
+				access.allFields = true
+			} else {
+				access.fields = append(access.fields, p.FieldSecurity)
+			}
+			if q, ok := p.Query.(map[string]interface{}); ok {
+				access.queries = append(access.queries, q)
+			} else {
+				access.allDocs = true
+			}
+		}
+	}
+	if access.allFields && access.allDocs {
+		return nil
+	}
+	return access
+}
+
+// FieldsRestricted 返回是否限制了可见字段
+func (a *IndexAccess) FieldsRestricted() bool {
+	return a != nil && !a.allFields
+}
+
+// FieldAllowed 返回字段是否可见，元数据字段（以下划线开头）始终可见
+// 授权或排除一个字段同时作用于其子字段（对象的子字段与 multi-fields）
+func (a *IndexAccess) FieldAllowed(field string) bool {
+	if !a.FieldsRestricted() || strings.HasPrefix(field, "_") {
+		return true
+	}
+	for _, fs := range a.fields {
+		if matchFieldOrParent(fs.Grant, field) && !matchFieldOrParent(fs.Except, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFieldOrParent 判断字段或其任一上级字段是否匹配任一模式
+func matchFieldOrParent(patterns []string, field string) bool {
+	for {
+		if matchAnyPattern(patterns, field) {
+			return true
+		}
+		i := strings.LastIndex(field, ".")
+		if i < 0 {
+			return false
+		}
+		field = field[:i]
+	}
+}
+
+// FilterSource 返回只包含可见字段的 _source 副本，对象字段保留其可见的子字段
+func (a *IndexAccess) FilterSource(source map[string]interface{}) map[string]interface{} {
+	if !a.FieldsRestricted() || source == nil {
+		return source
+	}
+	return a.filterObject(source, "")
+}
+
+func (a *IndexAccess) filterObject(obj map[string]interface{}, prefix string) map[string]interface{} {
+	rv := make(map[string]interface{})
+	for key, value := range obj {
+		field := prefix + key
+		if filtered, ok := a.filterValue(value, field); ok {
+			rv[key] = filtered
+		}
+	}
+	return rv
+}
+
+// filterValue 过滤字段值，返回 false 表示整个字段不可见；对象逐个过滤子字段（子字段可能被 except 排除）
+func (a *IndexAccess) filterValue(value interface{}, field string) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		obj := a.filterObject(v, field+".")
+		return obj, len(obj) > 0 || (len(v) == 0 && a.FieldAllowed(field))
+	case []interface{}:
+		allowed := a.FieldAllowed(field)
+		var items []interface{}
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); ok || allowed {
+				if filtered, ok := a.filterValue(item, field); ok {
+					items = append(items, filtered)
+				}
+			}
+		}
+		return items, len(items) > 0 || (len(v) == 0 && allowed)
+	}
+	return value, a.FieldAllowed(field)
+}
+
+// Query 返回文档级安全查询，可见全部文档时返回 nil
+// 多个查询以 bool.should 组合，没有可见文档时返回 match_none
+func (a *IndexAccess) Query() map[string]interface{} {
+	if a == nil || a.allDocs {
+		return nil
+	}
+	switch len(a.queries) {
+	case 0:
+		return map[string]interface{}{"match_none": map[string]interface{}{}}
+	case 1:
+		return a.queries[0]
+	}
+	should := make([]interface{}, len(a.queries))
+	for i, q := range a.queries {
+		should[i] = q
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"should": should, "minimum_should_match": 1},
+	}
+}
+
+// matchAnyPattern 判断名称是否匹配任一模式（支持 * 与 ? 通配符）
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if pattern == name {
+			return true
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestIndexAccess(t *testing.T) {
+	config := &AuthConfig{
+		Roles: map[string]*Role{
+			"eu": {Indices: []RoleIndexPrivileges{{
+				Names:         []string{"logs-*"},
+				FieldSecurity: &FieldSecurity{Grant: []string{"message", "user"}, Except: []string{"user.email"}},
+				Query:         `{"term": {"region": "eu"}}`,
+			}}},
+			"us": {Indices: []RoleIndexPrivileges{{
+				Names: []string{"logs-*"},
+				Query: map[string]interface{}{"term": map[string]interface{}{"region": "us"}},
+			}}},
+		},
+		UserRoles: map[string][]string{"alice": {"eu"}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	ctx := WithRoles(context.Background(), []*Role{config.Roles["eu"]})
+	access := IndexAccessFromContext(ctx, "logs-2024")
+	if !access.FieldsRestricted() {
+		t.Fatalf("Expected fields to be restricted")
+	}
+	source := map[string]interface{}{
+		"message": "hello",
+		"level":   "info",
+		"user":    map[string]interface{}{"name": "bob", "email": "bob@example.com"},
+	}
+	want := map[string]interface{}{
+		"message": "hello",
+		"user":    map[string]interface{}{"name": "bob"},
+	}
+	if got := access.FilterSource(source); !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterSource: expected %v, got %v", want, got)
+	}
+	if q := access.Query(); !reflect.DeepEqual(q, map[string]interface{}{"term": map[string]interface{}{"region": "eu"}}) {
+		t.Errorf("Query: unexpected %v", q)
+	}
+
+	// 角色未覆盖的索引不可见任何文档
+	if q := IndexAccessFromContext(ctx, "metrics").Query(); q["match_none"] == nil {
+		t.Errorf("Expected match_none for an index not covered by the role, got %v", q)
+	}
+
+	// 多个角色取并集：字段不受限制，查询以 should 组合
+	access = IndexAccessFromContext(WithRoles(context.Background(), []*Role{config.Roles["eu"], config.Roles["us"]}), "logs-2024")
+	if access.FieldsRestricted() {
+		t.Errorf("Expected no field restriction when one role grants all fields")
+	}
+	should, _ := access.Query()["bool"].(map[string]interface{})["should"].([]interface{})
+	if len(should) != 2 {
+		t.Errorf("Expected two should clauses, got %v", access.Query())
+	}
+
+	if IndexAccessFromContext(context.Background(), "logs-2024") != nil {
+		t.Errorf("Expected no restriction without roles")
+	}
+
+	config.APIKeyRoles = map[string][]string{"key": {"missing"}}
+	if err := config.Validate(); err == nil {
+		t.Errorf("Expected error for unknown role")
+	}
+}
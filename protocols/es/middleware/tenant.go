@@ -0,0 +1,604 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lscgzwd/tiggerdb/audit"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/common"
+)
+
+const (
+	// TenantSeparator 租户前缀与索引名之间的分隔符，物理索引名为 {tenant}__{index}
+	TenantSeparator = "__"
+	// DefaultTenantHeader 默认的租户请求头
+	DefaultTenantHeader = "X-Tenant"
+)
+
+// TenantConfig 多租户配置
+// 启用后请求通过请求头或 API Key 绑定携带租户，索引名和别名按租户透明加前缀，
+// 列表类接口只返回本租户的索引
+type TenantConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// 租户请求头，为空时使用 X-Tenant
+	Header string `json:"header" yaml:"header"`
+	// API Key（X-API-Key 或 Bearer Token）到租户的绑定；绑定的 Key 只能访问其租户，请求头不能覆盖
+	APIKeyTenants map[string]string `json:"api_key_tenants" yaml:"api_key_tenants"`
+	// 允许不携带租户的请求（不做隔离，可以看到所有租户的物理索引，用于运维）；默认拒绝
+	AllowUnscoped bool `json:"allow_unscoped" yaml:"allow_unscoped"`
+}
+
+// 租户名不能包含下划线，保证 {tenant}__ 前缀可以无歧义地解析
+var validTenantName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// ValidateTenantName 验证租户名称
+func ValidateTenantName(tenant string) error {
+	if len(tenant) > 64 {
+		return fmt.Errorf("tenant name too long (max 64 characters)")
+	}
+	if !validTenantName.MatchString(tenant) {
+		return fmt.Errorf("invalid tenant name [%s] (only lowercase letters, numbers and hyphens allowed)", tenant)
+	}
+	return nil
+}
+
+// Validate 验证多租户配置
+func (c *TenantConfig) Validate() error {
+	for _, tenant := range c.APIKeyTenants {
+		if err := ValidateTenantName(tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type tenantContextKey struct{}
+
+// WithTenant 返回携带租户的 context
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext 返回请求的租户，不受租户隔离的请求返回空字符串
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// TenantIndexPrefix 返回租户的物理索引名前缀
+func TenantIndexPrefix(tenant string) string {
+	return tenant + TenantSeparator
+}
+
+// 不需要租户的公开路径
+var tenantPublicPaths = map[string]bool{
+	"/":                true,
+	"/_ping":           true,
+	"/_cluster/health": true,
+	"/_health":         true,
+	"/_health/live":    true,
+	"/_health/ready":   true,
+	"/_metrics":        true,
+}
+
+// TenantMiddleware 创建多租户中间件（在路由匹配之前执行，改写请求路径和请求体中的索引名，并还原响应中的索引名）
+func TenantMiddleware(config *TenantConfig) func(http.HandlerFunc) http.HandlerFunc {
+	header := config.Header
+	if header == "" {
+		header = DefaultTenantHeader
+	}
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !config.Enabled || tenantPublicPaths[r.URL.Path] {
+				next(w, r)
+				return
+			}
+
+			tenant, apiErr := resolveTenant(r, header, config.APIKeyTenants)
+			if apiErr != nil {
+				common.HandleError(w, apiErr)
+				return
+			}
+			if tenant == "" {
+				if config.AllowUnscoped {
+					next(w, r)
+					return
+				}
+				common.HandleError(w, newTenantError(http.StatusUnauthorized, "missing tenant, set the ["+header+"] header or use an API key bound to a tenant"))
+				return
+			}
+
+			if event := audit.EventFromContext(r.Context()); event != nil {
+				event.Tenant = tenant
+			}
+
+			prefix := TenantIndexPrefix(tenant)
+			segments := strings.Split(r.URL.Path, "/")
+			// 集群级写操作（集群设置、存储脚本、API Key、关闭节点）在租户之间共享，租户请求只读
+			if r.Method != http.MethodGet && r.Method != http.MethodHead && len(segments) > 1 &&
+				(strings.HasPrefix(r.URL.Path, "/_cluster/settings") || segments[1] == "_scripts" || segments[1] == "_security" || segments[1] == "_shutdown") {
+				common.HandleError(w, newTenantError(http.StatusForbidden, "tenant ["+tenant+"] is not allowed to modify cluster-wide resources"))
+				return
+			}
+
+			if apiErr := rewriteTenantRequest(r, segments, prefix); apiErr != nil {
+				common.HandleError(w, apiErr)
+				return
+			}
+			logger.Debug("Tenant [%s] request %s %s", tenant, r.Method, r.URL.Path)
+
+			rw := newTenantResponseWriter(w, prefix, r.Method == http.MethodHead)
+			next(rw, r.WithContext(WithTenant(r.Context(), tenant)))
+			rw.finish()
+		}
+	}
+}
+
+// resolveTenant 解析请求的租户：绑定了租户的 API Key 优先，请求头与绑定不一致时拒绝
+func resolveTenant(r *http.Request, header string, apiKeyTenants map[string]string) (string, common.APIError) {
+	headerTenant := strings.TrimSpace(r.Header.Get(header))
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			apiKey = strings.TrimPrefix(auth, "Bearer ")
+		}
+	}
+	if bound, ok := apiKeyTenants[apiKey]; ok && apiKey != "" {
+		if headerTenant != "" && headerTenant != bound {
+			return "", newTenantError(http.StatusForbidden, "API key is bound to another tenant than ["+headerTenant+"]")
+		}
+		return bound, nil
+	}
+	if headerTenant != "" {
+		if err := ValidateTenantName(headerTenant); err != nil {
+			return "", common.NewBadRequestError(err.Error())
+		}
+	}
+	return headerTenant, nil
+}
+
+func newTenantError(status int, message string) common.APIError {
+	return &common.BaseError{
+		ErrType:    "security_exception",
+		Message:    message,
+		HTTPStatus: status,
+	}
+}
+
+// rewriteTenantRequest 为路径和请求体中的索引名、别名加上租户前缀
+func rewriteTenantRequest(r *http.Request, segments []string, prefix string) common.APIError {
+	// segments[0] 为空（路径以 / 开头）
+	if len(segments) > 1 && segments[1] != "" && !strings.HasPrefix(segments[1], "_") {
+		segments[1] = namespaceIndexExpression(segments[1], prefix)
+		if len(segments) > 3 && (segments[2] == "_alias" || segments[2] == "_clone") && segments[3] != "" {
+			segments[3] = namespaceIndexExpression(segments[3], prefix)
+		}
+	} else if len(segments) > 2 && segments[1] == "_alias" && segments[2] != "" {
+		segments[2] = namespaceIndexExpression(segments[2], prefix)
+	}
+	r.URL.Path = strings.Join(segments, "/")
+	r.URL.RawPath = ""
+
+	var rewrite func([]byte, string) ([]byte, error)
+	last := segments[len(segments)-1]
+	switch {
+	case last == "_bulk":
+		rewrite = rewriteBulkBody
+	case last == "_msearch":
+		rewrite = rewriteMsearchBody
+	case last == "_mget" || last == "_mtermvectors":
+		rewrite = rewriteMgetBody
+	case last == "_aliases" && len(segments) == 2:
+		rewrite = rewriteAliasActionsBody
+	case r.Method == http.MethodPut && len(segments) == 4 && segments[1] == "_rollup" && segments[2] == "job":
+		rewrite = rewriteRollupJobBody
+	case len(segments) == 3 && segments[1] == "_transform" && (r.Method == http.MethodPut || last == "_preview"):
+		rewrite = rewriteTransformBody
+	case r.Method == http.MethodPut && len(segments) == 2 && !strings.HasPrefix(last, "_"),
+		len(segments) == 4 && segments[2] == "_clone":
+		// 创建与克隆索引请求体中的 aliases
+		rewrite = rewriteCreateIndexBody
+	}
+	if rewrite == nil || r.Body == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return common.NewRequestBodyError("failed to read request body", err)
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if body, err = rewrite(body, prefix); err != nil {
+			return common.NewBadRequestError("invalid request body: " + err.Error())
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// namespaceIndexExpression 为逗号分隔的索引表达式加前缀；_all 保持不变（由处理器按租户过滤），排除项（-name）同样加前缀
+func namespaceIndexExpression(expr, prefix string) string {
+	parts := strings.Split(expr, ",")
+	for i, part := range parts {
+		switch {
+		case part == "" || part == "_all":
+		case strings.HasPrefix(part, "-"), strings.HasPrefix(part, "+"):
+			parts[i] = part[:1] + prefix + part[1:]
+		default:
+			parts[i] = prefix + part
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func namespaceValue(v interface{}, prefix string) interface{} {
+	switch value := v.(type) {
+	case string:
+		return namespaceIndexExpression(value, prefix)
+	case []interface{}:
+		for i, item := range value {
+			if s, ok := item.(string); ok {
+				value[i] = namespaceIndexExpression(s, prefix)
+			}
+		}
+	}
+	return v
+}
+
+// rewriteNDJSON 逐行改写 NDJSON 请求体，fn 返回 false 的行保持原样
+func rewriteNDJSON(body []byte, fn func(line map[string]interface{}) bool) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var obj map[string]interface{}
+		if len(bytes.TrimSpace(line)) > 0 && json.Unmarshal(line, &obj) == nil && fn(obj) {
+			encoded, err := json.Marshal(obj)
+			if err != nil {
+				return nil, err
+			}
+			line = encoded
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// rewriteBulkBody 改写 bulk 操作行的 _index（与 bulk 处理器一致，值为包含 _index 的对象的单键行视为操作行）
+func rewriteBulkBody(body []byte, prefix string) ([]byte, error) {
+	return rewriteNDJSON(body, func(line map[string]interface{}) bool {
+		if len(line) != 1 {
+			return false
+		}
+		for _, v := range line {
+			meta, ok := v.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if index, ok := meta["_index"].(string); ok {
+				meta["_index"] = namespaceIndexExpression(index, prefix)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// rewriteMsearchBody 改写 msearch header 行的 index
+func rewriteMsearchBody(body []byte, prefix string) ([]byte, error) {
+	return rewriteNDJSON(body, func(line map[string]interface{}) bool {
+		if v, ok := line["index"]; ok {
+			line["index"] = namespaceValue(v, prefix)
+			return true
+		}
+		return false
+	})
+}
+
+func rewriteJSONBody(body []byte, fn func(map[string]interface{})) ([]byte, error) {
+	var obj map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+	fn(obj)
+	return json.Marshal(obj)
+}
+
+// rewriteMgetBody 改写 mget、mtermvectors docs 中的 _index
+func rewriteMgetBody(body []byte, prefix string) ([]byte, error) {
+	return rewriteJSONBody(body, func(obj map[string]interface{}) {
+		docs, _ := obj["docs"].([]interface{})
+		for _, item := range docs {
+			if doc, ok := item.(map[string]interface{}); ok {
+				if index, ok := doc["_index"].(string); ok {
+					doc["_index"] = namespaceIndexExpression(index, prefix)
+				}
+			}
+		}
+	})
+}
+
+// rewriteAliasActionsBody 改写 POST /_aliases 操作中的索引名和别名
+func rewriteAliasActionsBody(body []byte, prefix string) ([]byte, error) {
+	return rewriteJSONBody(body, func(obj map[string]interface{}) {
+		actions, _ := obj["actions"].([]interface{})
+		for _, item := range actions {
+			action, _ := item.(map[string]interface{})
+			for _, v := range action {
+				params, ok := v.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for _, key := range []string{"index", "indices", "alias", "aliases"} {
+					if value, ok := params[key]; ok {
+						params[key] = namespaceValue(value, prefix)
+					}
+				}
+			}
+		}
+	})
+}
+
+// rewriteCreateIndexBody 改写创建索引请求体中 aliases 的别名
+func rewriteCreateIndexBody(body []byte, prefix string) ([]byte, error) {
+	return rewriteJSONBody(body, func(obj map[string]interface{}) {
+		aliases, ok := obj["aliases"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		namespaced := make(map[string]interface{}, len(aliases))
+		for alias, def := range aliases {
+			namespaced[prefix+alias] = def
+		}
+		obj["aliases"] = namespaced
+	})
+}
+
+// rewriteRollupJobBody 改写 rollup 作业的源索引模式与 rollup 索引（作业在后台执行，只能匹配本租户的索引）
+func rewriteRollupJobBody(body []byte, prefix string) ([]byte, error) {
+	return rewriteJSONBody(body, func(obj map[string]interface{}) {
+		for _, key := range []string{"index_pattern", "rollup_index"} {
+			if value, ok := obj[key].(string); ok && value != "" {
+				obj[key] = namespaceIndexExpression(value, prefix)
+			}
+		}
+	})
+}
+
+// rewriteTransformBody 改写 transform 配置的 source.index 与 dest.index（transform 在后台执行，只能读写本租户的索引）
+func rewriteTransformBody(body []byte, prefix string) ([]byte, error) {
+	return rewriteJSONBody(body, func(obj map[string]interface{}) {
+		if source, ok := obj["source"].(map[string]interface{}); ok {
+			source["index"] = namespaceValue(source["index"], prefix)
+		}
+		if dest, ok := obj["dest"].(map[string]interface{}); ok {
+			if index, ok := dest["index"].(string); ok && index != "" {
+				dest["index"] = namespaceIndexExpression(index, prefix)
+			}
+		}
+	})
+}
+
+// tenantResponseWriter 去掉响应中索引名和别名的租户前缀：JSON 响应缓冲后整体改写；
+// NDJSON 响应按行改写并流式写出；CSV 与二进制响应（导出）由处理器自行去掉前缀，原样流式写出
+type tenantResponseWriter struct {
+	http.ResponseWriter
+	prefix      string
+	head        bool
+	statusCode  int
+	wroteHeader bool
+	mode        tenantWriteMode
+	body        bytes.Buffer // 缓冲的 JSON 响应，或 NDJSON 响应中尚未写出的不完整行
+}
+
+// tenantWriteMode 响应的改写方式，由 WriteHeader 时的 Content-Type 决定
+type tenantWriteMode int
+
+const (
+	tenantWriteBuffered tenantWriteMode = iota
+	tenantWriteLines
+	tenantWritePassThrough
+)
+
+func newTenantResponseWriter(w http.ResponseWriter, prefix string, head bool) *tenantResponseWriter {
+	return &tenantResponseWriter{ResponseWriter: w, prefix: prefix, head: head, statusCode: http.StatusOK}
+}
+
+func (w *tenantResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.statusCode = statusCode
+	switch contentType := w.Header().Get("Content-Type"); {
+	case strings.HasPrefix(contentType, "application/x-ndjson"):
+		w.mode = tenantWriteLines
+	case strings.HasPrefix(contentType, "text/csv"), contentType == "application/gzip", contentType == "application/octet-stream":
+		w.mode = tenantWritePassThrough
+	default:
+		return
+	}
+	// 流式响应改写后长度会变化
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *tenantResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch w.mode {
+	case tenantWritePassThrough:
+		return w.ResponseWriter.Write(b)
+	case tenantWriteLines:
+		w.body.Write(b)
+		if err := w.writeLines(false); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	default:
+		return w.body.Write(b)
+	}
+}
+
+// writeLines 写出缓冲中的完整行，final 为 true 时同时写出最后的不完整行
+func (w *tenantResponseWriter) writeLines(final bool) error {
+	for w.body.Len() > 0 {
+		i := bytes.IndexByte(w.body.Bytes(), '\n')
+		if i < 0 && !final {
+			return nil
+		}
+		var line []byte
+		if i < 0 {
+			line = w.body.Next(w.body.Len())
+		} else {
+			line = w.body.Next(i + 1)
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			line = append(bytes.TrimRight(stripTenantJSON(trimmed, w.prefix), "\n"), '\n')
+		}
+		if _, err := w.ResponseWriter.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush 把流式响应已写出的内容发送给客户端；缓冲的 JSON 响应在处理结束后才写出
+func (w *tenantResponseWriter) Flush() {
+	if w.mode == tenantWriteBuffered {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 设置写超时等
+func (w *tenantResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish 处理结束后写出缓冲的响应
+func (w *tenantResponseWriter) finish() {
+	switch w.mode {
+	case tenantWritePassThrough:
+		return
+	case tenantWriteLines:
+		if err := w.writeLines(true); err != nil {
+			logger.Debug("Failed to write tenant response: %v", err)
+		}
+		return
+	}
+	body := w.body.Bytes()
+	if strings.Contains(w.Header().Get("Content-Type"), "json") {
+		body = stripTenantJSON(body, w.prefix)
+	} else {
+		body = bytes.ReplaceAll(body, []byte(w.prefix), nil)
+	}
+	// 响应已完整缓冲，改用 Content-Length（流式 bulk 响应会设置 chunked）
+	w.Header().Del("Transfer-Encoding")
+	if !w.head {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	if !w.head {
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// stripTenantJSON 去掉 JSON 响应中索引名和别名的租户前缀；无法解析时按文本处理
+func stripTenantJSON(body []byte, prefix string) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return bytes.ReplaceAll(body, []byte(prefix), nil)
+	}
+	encoded, err := json.Marshal(stripTenantValue(value, "", prefix))
+	if err != nil {
+		return body
+	}
+	return append(encoded, '\n')
+}
+
+// 值为索引名或别名的字段
+var tenantNameFields = map[string]bool{
+	"_index":        true,
+	"index":         true,
+	"indices":       true,
+	"alias":         true,
+	"aliases":       true,
+	"provided_name": true,
+	"index_pattern": true,
+	"rollup_index":  true,
+}
+
+// 包含用户数据的字段，不做改写
+var tenantDataFields = map[string]bool{
+	"_source":      true,
+	"fields":       true,
+	"highlight":    true,
+	"aggregations": true,
+	"mappings":     true,
+	"mapping":      true,
+}
+
+// stripTenantValue 去掉对象键、索引名字段以及错误原因（reason）中的租户前缀
+func stripTenantValue(v interface{}, key, prefix string) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if tenantDataFields[key] {
+			return value
+		}
+		result := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			result[strings.TrimPrefix(k, prefix)] = stripTenantValue(item, k, prefix)
+		}
+		return result
+	case []interface{}:
+		for i, item := range value {
+			value[i] = stripTenantValue(item, key, prefix)
+		}
+		return value
+	case string:
+		if tenantNameFields[key] || key == "reason" {
+			return strings.ReplaceAll(value, prefix, "")
+		}
+		return value
+	}
+	return v
+}
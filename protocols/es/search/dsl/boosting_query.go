@@ -0,0 +1,154 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"context"
+	"fmt"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// BoostingQuery 返回匹配 positive 的文档，同时匹配 negative 的文档得分乘以 negative_boost
+type BoostingQuery struct {
+	Positive      query.Query  `json:"positive"`
+	Negative      query.Query  `json:"negative"`
+	NegativeBoost float64      `json:"negative_boost"`
+	BoostVal      *query.Boost `json:"boost,omitempty"`
+}
+
+// NewBoostingQuery 创建 boosting 查询
+func NewBoostingQuery(positive, negative query.Query, negativeBoost float64) *BoostingQuery {
+	return &BoostingQuery{Positive: positive, Negative: negative, NegativeBoost: negativeBoost}
+}
+
+func (q *BoostingQuery) SetBoost(b float64) {
+	boost := query.Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *BoostingQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+// Searcher 实现 query.Query
+func (q *BoostingQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	positive, err := q.Positive.Searcher(ctx, i, m, options)
+	if err != nil {
+		return nil, err
+	}
+	negative, err := q.Negative.Searcher(ctx, i, m, search.SearcherOptions{Score: "none"})
+	if err != nil {
+		_ = positive.Close()
+		return nil, err
+	}
+	return &boostingSearcher{
+		positive:      positive,
+		negative:      negative,
+		negativeBoost: q.NegativeBoost,
+		boost:         q.BoostVal.Value(),
+		explain:       options.Explain,
+	}, nil
+}
+
+// boostingSearcher 按 positive 的结果迭代，negative 跟随推进到同一文档判断是否降权
+type boostingSearcher struct {
+	positive      search.Searcher
+	negative      search.Searcher
+	negCurr       *search.DocumentMatch
+	negativeBoost float64
+	boost         float64
+	explain       bool
+	initialized   bool
+}
+
+func (s *boostingSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.positive.Next(ctx)
+	if err != nil || dm == nil {
+		return dm, err
+	}
+	return s.score(ctx, dm)
+}
+
+func (s *boostingSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.positive.Advance(ctx, ID)
+	if err != nil || dm == nil {
+		return dm, err
+	}
+	return s.score(ctx, dm)
+}
+
+// score 把 negative 推进到 dm，同时匹配 negative 时得分乘以 negative_boost
+func (s *boostingSearcher) score(ctx *search.SearchContext, dm *search.DocumentMatch) (*search.DocumentMatch, error) {
+	if !s.initialized || (s.negCurr != nil && s.negCurr.IndexInternalID.Compare(dm.IndexInternalID) < 0) {
+		if s.negCurr != nil {
+			ctx.DocumentMatchPool.Put(s.negCurr)
+		}
+		var err error
+		if s.negCurr, err = s.negative.Advance(ctx, dm.IndexInternalID); err != nil {
+			return nil, err
+		}
+		s.initialized = true
+	}
+
+	factor := s.boost
+	if s.negCurr != nil && s.negCurr.IndexInternalID.Equals(dm.IndexInternalID) {
+		factor *= s.negativeBoost
+	}
+	if s.explain && factor != 1 {
+		dm.Expl = &search.Explanation{
+			Value:    dm.Score * factor,
+			Message:  fmt.Sprintf("product of score and boost %v of:", factor),
+			Children: []*search.Explanation{dm.Expl},
+		}
+	}
+	dm.Score *= factor
+	return dm, nil
+}
+
+func (s *boostingSearcher) Close() error {
+	err := s.positive.Close()
+	if negErr := s.negative.Close(); err == nil {
+		err = negErr
+	}
+	return err
+}
+
+func (s *boostingSearcher) Weight() float64 {
+	return s.positive.Weight()
+}
+
+func (s *boostingSearcher) SetQueryNorm(qnorm float64) {
+	s.positive.SetQueryNorm(qnorm)
+}
+
+func (s *boostingSearcher) Count() uint64 {
+	return s.positive.Count()
+}
+
+func (s *boostingSearcher) Min() int {
+	return 0
+}
+
+func (s *boostingSearcher) Size() int {
+	return s.positive.Size() + s.negative.Size()
+}
+
+func (s *boostingSearcher) DocumentMatchPoolSize() int {
+	return s.positive.DocumentMatchPoolSize() + s.negative.DocumentMatchPoolSize() + 1
+}
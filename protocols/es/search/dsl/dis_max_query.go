@@ -0,0 +1,232 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// DisMaxQuery 匹配任一子查询的文档，得分为子查询最高分加上 tie_breaker 乘以其余子查询得分之和
+// bleve 的 DisjunctionQuery 按得分之和计分，dis_max 查询与 multi_match 的 best_fields 需要取最高分
+type DisMaxQuery struct {
+	Disjuncts  []query.Query `json:"disjuncts"`
+	TieBreaker float64       `json:"tie_breaker,omitempty"`
+	BoostVal   *query.Boost  `json:"boost,omitempty"`
+}
+
+// NewDisMaxQuery 创建 dis_max 查询
+func NewDisMaxQuery(disjuncts []query.Query, tieBreaker float64) *DisMaxQuery {
+	return &DisMaxQuery{Disjuncts: disjuncts, TieBreaker: tieBreaker}
+}
+
+func (q *DisMaxQuery) SetBoost(b float64) {
+	boost := query.Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *DisMaxQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+// Searcher 实现 query.Query
+func (q *DisMaxQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	searchers := make([]search.Searcher, 0, len(q.Disjuncts))
+	closeAll := func() {
+		for _, s := range searchers {
+			_ = s.Close()
+		}
+	}
+	for _, disjunct := range q.Disjuncts {
+		s, err := disjunct.Searcher(ctx, i, m, options)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		searchers = append(searchers, s)
+	}
+
+	rv := &disMaxSearcher{
+		searchers:  searchers,
+		currs:      make([]*search.DocumentMatch, len(searchers)),
+		tieBreaker: q.TieBreaker,
+		boost:      q.BoostVal.Value(),
+		explain:    options.Explain,
+	}
+	rv.computeQueryNorm()
+	return rv, nil
+}
+
+// disMaxSearcher 按文档顺序合并子查询的结果，同一文档在多个子查询中命中时按 dis_max 规则计分
+type disMaxSearcher struct {
+	searchers   []search.Searcher
+	currs       []*search.DocumentMatch
+	tieBreaker  float64
+	boost       float64
+	explain     bool
+	initialized bool
+}
+
+func (s *disMaxSearcher) computeQueryNorm() {
+	sumOfSquaredWeights := 0.0
+	for _, searcher := range s.searchers {
+		sumOfSquaredWeights += searcher.Weight()
+	}
+	if sumOfSquaredWeights == 0 {
+		return
+	}
+	s.SetQueryNorm(1.0 / math.Sqrt(sumOfSquaredWeights))
+}
+
+func (s *disMaxSearcher) initSearchers(ctx *search.SearchContext) (err error) {
+	for k, searcher := range s.searchers {
+		if s.currs[k], err = searcher.Next(ctx); err != nil {
+			return err
+		}
+	}
+	s.initialized = true
+	return nil
+}
+
+func (s *disMaxSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	if !s.initialized {
+		if err := s.initSearchers(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// 当前最小的文档ID
+	var next index.IndexInternalID
+	for _, curr := range s.currs {
+		if curr != nil && (next == nil || curr.IndexInternalID.Compare(next) < 0) {
+			next = curr.IndexInternalID
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	var rv *search.DocumentMatch
+	var max, sum float64
+	var children []*search.Explanation
+	for k, curr := range s.currs {
+		if curr == nil || curr.IndexInternalID.Compare(next) != 0 {
+			continue
+		}
+		sum += curr.Score
+		if rv == nil || curr.Score > max {
+			max = curr.Score
+		}
+		if s.explain {
+			children = append(children, curr.Expl)
+		}
+		if rv == nil {
+			rv = curr
+		} else {
+			rv.FieldTermLocations = search.MergeFieldTermLocations(rv.FieldTermLocations, []*search.DocumentMatch{curr})
+			ctx.DocumentMatchPool.Put(curr)
+		}
+		var err error
+		if s.currs[k], err = s.searchers[k].Next(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	rv.Score = (max + s.tieBreaker*(sum-max)) * s.boost
+	if s.explain {
+		rv.Expl = &search.Explanation{
+			Value:    rv.Score,
+			Message:  fmt.Sprintf("max plus %v times others of:", s.tieBreaker),
+			Children: children,
+		}
+	}
+	return rv, nil
+}
+
+func (s *disMaxSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	if !s.initialized {
+		if err := s.initSearchers(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for k, searcher := range s.searchers {
+		if s.currs[k] == nil || s.currs[k].IndexInternalID.Compare(ID) >= 0 {
+			continue
+		}
+		ctx.DocumentMatchPool.Put(s.currs[k])
+		var err error
+		if s.currs[k], err = searcher.Advance(ctx, ID); err != nil {
+			return nil, err
+		}
+	}
+	return s.Next(ctx)
+}
+
+func (s *disMaxSearcher) Close() (rv error) {
+	for _, searcher := range s.searchers {
+		if err := searcher.Close(); err != nil && rv == nil {
+			rv = err
+		}
+	}
+	return rv
+}
+
+func (s *disMaxSearcher) Weight() float64 {
+	var rv float64
+	for _, searcher := range s.searchers {
+		rv += searcher.Weight()
+	}
+	return rv
+}
+
+func (s *disMaxSearcher) SetQueryNorm(qnorm float64) {
+	for _, searcher := range s.searchers {
+		searcher.SetQueryNorm(qnorm)
+	}
+}
+
+func (s *disMaxSearcher) Count() uint64 {
+	var sum uint64
+	for _, searcher := range s.searchers {
+		sum += searcher.Count()
+	}
+	return sum
+}
+
+func (s *disMaxSearcher) Min() int {
+	return 0
+}
+
+func (s *disMaxSearcher) Size() int {
+	var rv int
+	for _, searcher := range s.searchers {
+		rv += searcher.Size()
+	}
+	return rv
+}
+
+func (s *disMaxSearcher) DocumentMatchPoolSize() int {
+	rv := len(s.currs)
+	for _, searcher := range s.searchers {
+		rv += searcher.DocumentMatchPoolSize()
+	}
+	return rv
+}
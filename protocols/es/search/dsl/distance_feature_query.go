@@ -0,0 +1,134 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/geo"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// timeUnits ES 时间单位（长单位在前，避免 "ms" 被识别为 "s"）
+var timeUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"nanos", time.Nanosecond},
+	{"micros", time.Microsecond},
+	{"ms", time.Millisecond},
+	{"s", time.Second},
+	{"m", time.Minute},
+	{"h", time.Hour},
+	{"d", 24 * time.Hour},
+}
+
+// parseTimeValue 解析 ES 时间值（如 "12h"、"7d"）
+func parseTimeValue(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	for _, u := range timeUnits {
+		if !strings.HasSuffix(value, u.suffix) {
+			continue
+		}
+		num, err := strconv.ParseFloat(strings.TrimSuffix(value, u.suffix), 64)
+		if err != nil {
+			break
+		}
+		return time.Duration(num * float64(u.unit)), nil
+	}
+	return 0, fmt.Errorf("failed to parse [%s] as a time value: unit is missing or unrecognized", value)
+}
+
+// parseDistanceFeature 解析distance_feature查询
+// ES格式: {"distance_feature": {"field": "published", "origin": "now", "pivot": "7d"}}
+// 或 {"distance_feature": {"field": "location", "origin": [lon, lat], "pivot": "1km"}}
+func (p *QueryParser) parseDistanceFeature(body interface{}) (query.Query, error) {
+	dfMap, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("[distance_feature] query must be an object")
+	}
+	for key := range dfMap {
+		switch key {
+		case "field", "origin", "pivot", "boost", "_name":
+		default:
+			return nil, fmt.Errorf("[distance_feature] query does not support [%s]", key)
+		}
+	}
+	for _, key := range []string{"field", "origin", "pivot"} {
+		if v, ok := dfMap[key]; !ok || v == nil {
+			return nil, fmt.Errorf("[distance_feature] required field [%s] is missing", key)
+		}
+	}
+
+	field, ok := dfMap["field"].(string)
+	if !ok {
+		return nil, fmt.Errorf("[distance_feature] [field] must be a string")
+	}
+	field = p.normalizeFieldName(field)
+	pivot, ok := dfMap["pivot"].(string)
+	if !ok {
+		return nil, fmt.Errorf("[distance_feature] [pivot] must be a string")
+	}
+	origin := dfMap["origin"]
+
+	var q *query.DistanceFeatureQuery
+	switch fieldType := p.fieldTypes[field]; fieldType {
+	case "date", "date_nanos":
+		originTime, ok, err := p.parseDateValue(field, origin, "", "", false)
+		if err != nil {
+			return nil, fmt.Errorf("[distance_feature] %v", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("[distance_feature] failed to parse origin [%v]", origin)
+		}
+		pivotDuration, err := parseTimeValue(pivot)
+		if err != nil {
+			return nil, fmt.Errorf("[distance_feature] %v", err)
+		}
+		if pivotDuration <= 0 {
+			return nil, fmt.Errorf("[distance_feature] pivot must be greater than 0")
+		}
+		q = query.NewDateDistanceFeatureQuery(field, originTime, pivotDuration)
+	case "geo_point":
+		lon, lat, ok := geo.ExtractGeoPoint(origin)
+		if !ok {
+			return nil, fmt.Errorf("[distance_feature] failed to parse origin [%v] as a geo point", origin)
+		}
+		pivotMeters, err := geo.ParseDistance(pivot)
+		if err != nil {
+			return nil, fmt.Errorf("[distance_feature] failed to parse pivot [%s]: %v", pivot, err)
+		}
+		if pivotMeters <= 0 {
+			return nil, fmt.Errorf("[distance_feature] pivot must be greater than 0")
+		}
+		q = query.NewGeoDistanceFeatureQuery(field, lon, lat, pivotMeters)
+	case "":
+		return nil, fmt.Errorf("[distance_feature] Can't run [distance_feature] query on unmapped field [%s]", field)
+	default:
+		return nil, fmt.Errorf("[distance_feature] field [%s] of type [%s] is not supported, it must be of type [date], [date_nanos] or [geo_point]", field, fieldType)
+	}
+
+	if boost, ok := dfMap["boost"]; ok {
+		b, err := p.toFloat64(boost)
+		if err != nil || b < 0 {
+			return nil, fmt.Errorf("[distance_feature] [boost] must be a non-negative number")
+		}
+		q.SetBoost(b)
+	}
+	return q, nil
+}
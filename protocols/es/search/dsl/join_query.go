@@ -18,6 +18,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -73,6 +75,10 @@ func FindJoinQueries(q query.Query) []*JoinQueryInfo {
 		for _, child := range tq.Disjuncts {
 			results = append(results, FindJoinQueries(child)...)
 		}
+	case *DisMaxQuery:
+		for _, child := range tq.Disjuncts {
+			results = append(results, FindJoinQueries(child)...)
+		}
 	case *query.BooleanQuery:
 		if tq.Must != nil {
 			results = append(results, FindJoinQueries(tq.Must)...)
@@ -83,6 +89,41 @@ func FindJoinQueries(q query.Query) []*JoinQueryInfo {
 		if tq.MustNot != nil {
 			results = append(results, FindJoinQueries(tq.MustNot)...)
 		}
+		if tq.Filter != nil {
+			results = append(results, FindJoinQueries(tq.Filter)...)
+		}
+	}
+
+	return results
+}
+
+// FindPercolateQueries 递归查找查询中的所有 percolate 查询
+func FindPercolateQueries(q query.Query) []*PercolateQueryInfo {
+	var results []*PercolateQueryInfo
+
+	if info := GetPercolateQueryInfo(q); info != nil {
+		results = append(results, info)
+	}
+
+	switch tq := q.(type) {
+	case *query.ConjunctionQuery:
+		for _, child := range tq.Conjuncts {
+			results = append(results, FindPercolateQueries(child)...)
+		}
+	case *query.DisjunctionQuery:
+		for _, child := range tq.Disjuncts {
+			results = append(results, FindPercolateQueries(child)...)
+		}
+	case *DisMaxQuery:
+		for _, child := range tq.Disjuncts {
+			results = append(results, FindPercolateQueries(child)...)
+		}
+	case *query.BooleanQuery:
+		for _, child := range []query.Query{tq.Must, tq.Should, tq.MustNot, tq.Filter} {
+			if child != nil {
+				results = append(results, FindPercolateQueries(child)...)
+			}
+		}
 	}
 
 	return results
@@ -102,14 +143,44 @@ type JoinQueryInfo struct {
 	TypeName   string // 子类型名（has_child）或父类型名（has_parent）
 	InnerQuery query.Query
 	Boost      float64
+
+	ScoreMode   string            // has_child：子文档得分合并方式（默认 none）
+	MinChildren int               // has_child：父文档至少匹配的子文档数（0 表示不限制）
+	MaxChildren int               // has_child：父文档至多匹配的子文档数（0 表示不限制）
+	Score       bool              // has_parent：是否将父文档得分传递给子文档
+	InnerHits   *InnerHitsOptions // 非 nil 时记录 inner_hits
+
+	// InnerHitMatches 执行结果：命中文档ID -> 关联文档
+	// has_child 为匹配的子文档，has_parent 为父文档
+	InnerHitMatches map[string][]JoinMatch
+}
+
+// InnerHitsOptions inner_hits 配置
+type InnerHitsOptions struct {
+	Name string
+	From int
+	Size int
+}
+
+// JoinMatch join 查询中关联文档的命中信息
+type JoinMatch struct {
+	ID    string
+	Score float64
 }
 
+// maxJoinQueryHits join 查询单次最多收集的关联文档数
+const maxJoinQueryHits = 10000
+
 // PercolateQueryInfo 存储 percolate 查询的信息
 type PercolateQueryInfo struct {
 	Field     string                   // percolator 字段名
 	Document  map[string]interface{}   // 要匹配的单个文档
 	Documents []map[string]interface{} // 要匹配的多个文档
+	Name      string                   // 查询名称，用于区分多个 percolate 查询的槽位字段
 	Boost     float64
+
+	// DocumentSlots 执行后记录每个匹配的存储查询对应的文档槽位
+	DocumentSlots map[string][]int
 }
 
 // percolateQueryRegistry 存储 percolate 查询信息
@@ -139,23 +210,33 @@ func UnregisterPercolateQuery(q query.Query) {
 	delete(percolateQueryRegistry, q)
 }
 
-// ExecuteHasChildQuery 执行 has_child 查询
+// ExecuteHasChildQuery 执行 has_child 查询（score_mode 为 none，不限制子文档数）
+func ExecuteHasChildQuery(ctx context.Context, idx bleve.Index, childType string, innerQuery query.Query, boost float64) (query.Query, error) {
+	return ExecuteHasChildJoin(ctx, idx, &JoinQueryInfo{
+		Type:       JoinQueryTypeHasChild,
+		TypeName:   childType,
+		InnerQuery: innerQuery,
+		Boost:      boost,
+		ScoreMode:  ScoreModeNone,
+	})
+}
+
+// ExecuteHasChildJoin 按 JoinQueryInfo 执行 has_child 查询
 // 两阶段查询：
 // 1. 执行内部查询找到匹配的子文档
-// 2. 获取子文档的 _join_parent 字段值（父文档ID）
-// 3. 返回匹配这些父文档ID的查询
-func ExecuteHasChildQuery(ctx context.Context, idx bleve.Index, childType string, innerQuery query.Query, boost float64) (query.Query, error) {
+// 2. 按子文档的 _join_parent 字段值（父文档ID）分组，应用 min_children/max_children
+// 3. 返回匹配这些父文档的查询，得分按 score_mode 由子文档得分合并
+func ExecuteHasChildJoin(ctx context.Context, idx bleve.Index, info *JoinQueryInfo) (query.Query, error) {
 	// 第一阶段：创建子文档查询
-	// 子文档的 _join_name 字段应该等于 childType
-	typeQuery := query.NewTermQuery(childType)
+	// 子文档的 _join_name 字段应该等于 childType（只过滤，不参与评分）
+	typeQuery := query.NewTermQuery(info.TypeName)
 	typeQuery.SetField("_join_name")
-
-	// 组合：子文档类型 AND 内部查询
-	childQuery := query.NewConjunctionQuery([]query.Query{typeQuery, innerQuery})
+	childQuery := query.NewBooleanQuery([]query.Query{info.InnerQuery}, nil, nil)
+	childQuery.Filter = typeQuery
 
 	// 执行子查询
 	searchReq := bleve.NewSearchRequest(childQuery)
-	searchReq.Size = 10000 // 获取足够多的子文档
+	searchReq.Size = maxJoinQueryHits // 获取足够多的子文档
 	searchReq.Fields = []string{"_join_parent"}
 
 	searchResult, err := idx.Search(searchReq)
@@ -163,60 +244,91 @@ func ExecuteHasChildQuery(ctx context.Context, idx bleve.Index, childType string
 		return nil, err
 	}
 
-	// 收集所有父文档ID
-	parentIDs := make(map[string]struct{})
+	// 按父文档ID分组（Hits 按得分降序，分组后的子文档保持该顺序）
+	children := make(map[string][]JoinMatch)
 	for _, hit := range searchResult.Hits {
 		if parentID, ok := hit.Fields["_join_parent"].(string); ok && parentID != "" {
-			parentIDs[parentID] = struct{}{}
+			children[parentID] = append(children[parentID], JoinMatch{ID: hit.ID, Score: hit.Score})
 		}
 	}
 
-	logger.Debug("ExecuteHasChildQuery - Found %d matching children, %d unique parent IDs", searchResult.Total, len(parentIDs))
+	logger.Debug("ExecuteHasChildQuery - Found %d matching children, %d unique parent IDs", searchResult.Total, len(children))
+
+	// 应用 min_children / max_children
+	for parentID, matches := range children {
+		if (info.MinChildren > 0 && len(matches) < info.MinChildren) || (info.MaxChildren > 0 && len(matches) > info.MaxChildren) {
+			delete(children, parentID)
+		}
+	}
+	if info.InnerHits != nil {
+		info.InnerHitMatches = children
+	}
 
 	// 如果没有找到任何父文档ID，返回 match_none
-	if len(parentIDs) == 0 {
+	if len(children) == 0 {
 		return query.NewMatchNoneQuery(), nil
 	}
 
 	// 第二阶段：创建查询匹配这些父文档
-	parentIDList := make([]string, 0, len(parentIDs))
-	for id := range parentIDs {
-		parentIDList = append(parentIDList, id)
+	if info.ScoreMode == "" || info.ScoreMode == ScoreModeNone {
+		// 使用 DocIDQuery 匹配父文档（常量得分）
+		parentIDList := make([]string, 0, len(children))
+		for id := range children {
+			parentIDList = append(parentIDList, id)
+		}
+		parentQuery := query.NewDocIDQuery(parentIDList)
+		parentQuery.SetBoost(info.Boost)
+		return parentQuery, nil
 	}
 
-	// 使用 DocIDQuery 匹配父文档
-	parentQuery := query.NewDocIDQuery(parentIDList)
-	parentQuery.SetBoost(boost)
+	parentScores := make(map[string]float64, len(children))
+	for parentID, matches := range children {
+		scores := make([]float64, len(matches))
+		for i, m := range matches {
+			scores[i] = m.Score
+		}
+		parentScores[parentID] = CombineScores(scores, info.ScoreMode) * info.Boost
+	}
+	return NewScoredDocIDQuery(parentScores), nil
+}
 
-	return parentQuery, nil
+// ExecuteHasParentQuery 执行 has_parent 查询（不传递父文档得分）
+func ExecuteHasParentQuery(ctx context.Context, idx bleve.Index, parentType string, innerQuery query.Query, boost float64) (query.Query, error) {
+	return ExecuteHasParentJoin(ctx, idx, &JoinQueryInfo{
+		Type:       JoinQueryTypeHasParent,
+		TypeName:   parentType,
+		InnerQuery: innerQuery,
+		Boost:      boost,
+	})
 }
 
-// ExecuteHasParentQuery 执行 has_parent 查询
+// ExecuteHasParentJoin 按 JoinQueryInfo 执行 has_parent 查询
 // 两阶段查询：
 // 1. 执行内部查询找到匹配的父文档
 // 2. 获取父文档ID
-// 3. 返回匹配 _join_parent 等于这些ID的子文档查询
-func ExecuteHasParentQuery(ctx context.Context, idx bleve.Index, parentType string, innerQuery query.Query, boost float64) (query.Query, error) {
+// 3. 返回匹配 _join_parent 等于这些ID的子文档查询；score=true 时子文档得分取父文档得分
+func ExecuteHasParentJoin(ctx context.Context, idx bleve.Index, info *JoinQueryInfo) (query.Query, error) {
 	// 第一阶段：创建父文档查询
-	// 父文档的 _join_name 字段应该等于 parentType
-	typeQuery := query.NewTermQuery(parentType)
+	// 父文档的 _join_name 字段应该等于 parentType（只过滤，不参与评分）
+	typeQuery := query.NewTermQuery(info.TypeName)
 	typeQuery.SetField("_join_name")
-
-	// 组合：父文档类型 AND 内部查询
-	parentQuery := query.NewConjunctionQuery([]query.Query{typeQuery, innerQuery})
+	parentQuery := query.NewBooleanQuery([]query.Query{info.InnerQuery}, nil, nil)
+	parentQuery.Filter = typeQuery
 
 	// 执行父查询
 	searchReq := bleve.NewSearchRequest(parentQuery)
-	searchReq.Size = 10000 // 获取足够多的父文档
+	searchReq.Size = maxJoinQueryHits // 获取足够多的父文档
 
 	searchResult, err := idx.Search(searchReq)
 	if err != nil {
 		return nil, err
 	}
 
-	// 收集所有父文档ID
+	// 收集所有父文档ID及得分
+	parentScores := make(map[string]float64, len(searchResult.Hits))
 	parentIDs := make([]string, 0, len(searchResult.Hits))
 	for _, hit := range searchResult.Hits {
+		parentScores[hit.ID] = hit.Score
 		parentIDs = append(parentIDs, hit.ID)
 	}
 
@@ -236,62 +348,116 @@ func ExecuteHasParentQuery(ctx context.Context, idx bleve.Index, parentType stri
 		childQueries = append(childQueries, termQuery)
 	}
 
-	// 使用 DisjunctionQuery（OR）组合所有子查询
-	if len(childQueries) == 1 {
-		return childQueries[0], nil
+	if !info.Score && info.InnerHits == nil {
+		// 使用 DisjunctionQuery（OR）组合所有子查询
+		if len(childQueries) == 1 {
+			return childQueries[0], nil
+		}
+
+		disjQuery := query.NewDisjunctionQuery(childQueries)
+		disjQuery.SetMin(1)
+		disjQuery.SetBoost(info.Boost)
+
+		return disjQuery, nil
 	}
 
-	disjQuery := query.NewDisjunctionQuery(childQueries)
-	disjQuery.SetMin(1)
-	disjQuery.SetBoost(boost)
+	// 需要父文档得分或 inner_hits：先找出子文档及其父文档
+	childFilter := query.NewDisjunctionQuery(childQueries)
+	childFilter.SetMin(1)
+	childReq := bleve.NewSearchRequest(childFilter)
+	childReq.Size = maxJoinQueryHits
+	childReq.Fields = []string{"_join_parent"}
+	childResult, err := idx.Search(childReq)
+	if err != nil {
+		return nil, err
+	}
 
-	return disjQuery, nil
+	childScores := make(map[string]float64, len(childResult.Hits))
+	matches := make(map[string][]JoinMatch, len(childResult.Hits))
+	for _, hit := range childResult.Hits {
+		parentID, ok := hit.Fields["_join_parent"].(string)
+		if !ok {
+			continue
+		}
+		score := info.Boost
+		if info.Score {
+			score = parentScores[parentID] * info.Boost
+		}
+		childScores[hit.ID] = score
+		matches[hit.ID] = []JoinMatch{{ID: parentID, Score: parentScores[parentID]}}
+	}
+	if info.InnerHits != nil {
+		info.InnerHitMatches = matches
+	}
+	if len(childScores) == 0 {
+		return query.NewMatchNoneQuery(), nil
+	}
+	return NewScoredDocIDQuery(childScores), nil
 }
 
 // ExecutePercolateQuery 执行 percolate 查询
 // 两阶段查询：
-// 1. 从索引中获取所有包含 percolator 字段的文档（存储的查询）
-// 2. 对每个存储的查询，检查提供的文档是否匹配
-// 3. 返回匹配的查询文档ID
+// 1. 使用待匹配文档的词项预过滤存储的查询（词项提取不完整的查询始终作为候选）
+// 2. 将待匹配文档写入内存索引，逐个执行候选查询，记录匹配的文档槽位（_percolator_document_slot）
+// 3. 返回匹配的查询文档，得分为存储查询在匹配文档上的最高得分
 func ExecutePercolateQuery(ctx context.Context, idx bleve.Index, info *PercolateQueryInfo) (query.Query, error) {
-	// 第一阶段：获取所有包含 percolator 字段的文档
-	// 这些文档的 _percolator_query 字段存储了序列化的查询
-	percolatorFieldQuery := query.NewTermQuery("true")
-	percolatorFieldQuery.SetField("_has_percolator")
+	// 准备要匹配的文档
+	var documents []map[string]interface{}
+	if info.Document != nil {
+		documents = append(documents, info.Document)
+	}
+	documents = append(documents, info.Documents...)
+
+	if len(documents) == 0 {
+		return query.NewMatchNoneQuery(), nil
+	}
+
+	// 第一阶段：按文档词项筛选候选查询
+	var docTerms []string
+	seen := make(map[string]struct{})
+	for _, doc := range documents {
+		for _, t := range DocumentPercolatorTerms(idx.Mapping(), doc) {
+			if _, ok := seen[t]; !ok {
+				seen[t] = struct{}{}
+				docTerms = append(docTerms, t)
+			}
+		}
+	}
 
-	searchReq := bleve.NewSearchRequest(percolatorFieldQuery)
-	searchReq.Size = 10000 // 获取所有存储的查询
-	searchReq.Fields = []string{"_percolator_query"}
+	searchReq := bleve.NewSearchRequest(NewPercolatorCandidateQuery(docTerms))
+	searchReq.Size = maxPercolateCandidates
+	searchReq.Fields = []string{PercolatorQueryField}
 
 	searchResult, err := idx.Search(searchReq)
 	if err != nil {
 		return nil, err
 	}
+	if searchResult.Total > uint64(len(searchResult.Hits)) {
+		logger.Warn("ExecutePercolateQuery - %d candidate queries, only the first %d are verified", searchResult.Total, len(searchResult.Hits))
+	}
 
-	logger.Debug("ExecutePercolateQuery - Found %d stored queries", searchResult.Total)
+	logger.Debug("ExecutePercolateQuery - Found %d candidate queries for %d documents", searchResult.Total, len(documents))
 
-	// 如果没有存储的查询，返回 match_none
-	if searchResult.Total == 0 {
+	// 如果没有候选查询，返回 match_none
+	if len(searchResult.Hits) == 0 {
 		return query.NewMatchNoneQuery(), nil
 	}
 
-	// 准备要匹配的文档
-	var documents []map[string]interface{}
-	if info.Document != nil {
-		documents = append(documents, info.Document)
+	// 第二阶段：在内存索引中校验候选查询
+	docIndex, err := newPercolateDocumentIndex(idx, documents)
+	if err != nil {
+		logger.Warn("ExecutePercolateQuery - failed to build in-memory document index, falling back to simple matching: %v", err)
 	}
-	documents = append(documents, info.Documents...)
-
-	if len(documents) == 0 {
-		return query.NewMatchNoneQuery(), nil
+	if docIndex != nil {
+		defer docIndex.Close()
 	}
 
-	// 第二阶段：对每个存储的查询，检查文档是否匹配
-	matchedQueryIDs := make([]string, 0)
+	info.DocumentSlots = make(map[string][]int)
+	queryScores := make(map[string]float64)
 
 	for _, hit := range searchResult.Hits {
 		// 获取存储的查询 JSON
-		queryJSON, ok := hit.Fields["_percolator_query"].(string)
+		queryJSON, ok := hit.Fields[PercolatorQueryField].(string)
 		if !ok || queryJSON == "" {
 			continue
 		}
@@ -311,27 +477,84 @@ func ExecutePercolateQuery(ctx context.Context, idx bleve.Index, info *Percolate
 			continue
 		}
 
-		// 检查每个文档是否匹配存储的查询
-		for _, doc := range documents {
-			if matchDocumentAgainstQuery(idx, doc, storedQuery) {
-				matchedQueryIDs = append(matchedQueryIDs, hit.ID)
-				break // 文档匹配了这个查询，不需要继续检查其他文档
-			}
+		slots, score := matchPercolateDocuments(idx, docIndex, documents, storedQuery)
+		if len(slots) == 0 {
+			continue
 		}
+		info.DocumentSlots[hit.ID] = slots
+		queryScores[hit.ID] = score * info.Boost
 	}
 
-	logger.Debug("ExecutePercolateQuery - %d queries matched", len(matchedQueryIDs))
+	logger.Debug("ExecutePercolateQuery - %d queries matched", len(queryScores))
 
 	// 如果没有匹配的查询，返回 match_none
-	if len(matchedQueryIDs) == 0 {
+	if len(queryScores) == 0 {
 		return query.NewMatchNoneQuery(), nil
 	}
 
 	// 返回匹配的查询文档ID
-	resultQuery := query.NewDocIDQuery(matchedQueryIDs)
-	resultQuery.SetBoost(info.Boost)
+	return NewScoredDocIDQuery(queryScores), nil
+}
+
+// maxPercolateCandidates percolate 查询单次最多校验的存储查询数
+const maxPercolateCandidates = 10000
 
-	return resultQuery, nil
+// newPercolateDocumentIndex 将待匹配文档写入内存索引（文档ID为槽位序号），使用与 percolator 索引相同的 mapping
+func newPercolateDocumentIndex(idx bleve.Index, documents []map[string]interface{}) (bleve.Index, error) {
+	docIndex, err := bleve.NewMemOnly(idx.Mapping())
+	if err != nil {
+		return nil, err
+	}
+	batch := docIndex.NewBatch()
+	for slot, doc := range documents {
+		if err := batch.Index(strconv.Itoa(slot), doc); err != nil {
+			docIndex.Close()
+			return nil, err
+		}
+	}
+	if err := docIndex.Batch(batch); err != nil {
+		docIndex.Close()
+		return nil, err
+	}
+	return docIndex, nil
+}
+
+// matchPercolateDocuments 返回匹配存储查询的文档槽位（升序）及最高得分
+func matchPercolateDocuments(idx bleve.Index, docIndex bleve.Index, documents []map[string]interface{}, storedQuery query.Query) ([]int, float64) {
+	var slots []int
+	maxScore := 0.0
+
+	if docIndex == nil {
+		for slot, doc := range documents {
+			if matchDocumentAgainstQuery(idx, doc, storedQuery) {
+				slots = append(slots, slot)
+			}
+		}
+		if len(slots) > 0 {
+			maxScore = 1.0
+		}
+		return slots, maxScore
+	}
+
+	searchReq := bleve.NewSearchRequest(storedQuery)
+	searchReq.Size = len(documents)
+	result, err := docIndex.Search(searchReq)
+	if err != nil {
+		logger.Warn("matchPercolateDocuments - stored query failed: %v", err)
+		return nil, 0
+	}
+	for _, hit := range result.Hits {
+		slot, err := strconv.Atoi(hit.ID)
+		if err != nil {
+			continue
+		}
+		slots = append(slots, slot)
+		if hit.Score > maxScore {
+			maxScore = hit.Score
+		}
+	}
+	sort.Ints(slots)
+	return slots, maxScore
 }
 
 // matchDocumentAgainstQuery 检查文档是否匹配查询
@@ -380,6 +603,14 @@ func matchDocumentAgainstQuery(idx bleve.Index, doc map[string]interface{}, q qu
 		}
 		return false
 
+	case *DisMaxQuery:
+		for _, child := range tq.Disjuncts {
+			if matchDocumentAgainstQuery(idx, doc, child) {
+				return true
+			}
+		}
+		return false
+
 	case *query.BooleanQuery:
 		// Must 条件
 		if tq.Must != nil && !matchDocumentAgainstQuery(idx, doc, tq.Must) {
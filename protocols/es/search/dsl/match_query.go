@@ -0,0 +1,379 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+	"github.com/lscgzwd/tiggerdb/search/searcher"
+)
+
+// match 查询的高级选项（fuzziness / prefix_length / max_expansions / analyzer / minimum_should_match）
+// bleve 的 MatchQuery 不支持 max_expansions 与 minimum_should_match，且 AUTO 模糊度按字节长度计算，
+// 设置了这些选项的 match 查询由 MatchOptionsQuery 执行，语义与 ES 一致。
+
+// defaultMaxExpansions ES 中 max_expansions 的默认值
+const defaultMaxExpansions = 50
+
+// fuzziness ES 的模糊度：固定编辑距离（0/1/2）或 AUTO[:low,high]
+type fuzziness struct {
+	auto      bool
+	low, high int
+	edits     int
+}
+
+// parseFuzziness 解析 fuzziness 参数，支持 0/1/2、"AUTO" 与 "AUTO:3,6"
+func parseFuzziness(v interface{}) (fuzziness, error) {
+	var s string
+	switch f := v.(type) {
+	case float64:
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	case int:
+		s = strconv.Itoa(f)
+	case string:
+		s = strings.TrimSpace(f)
+	default:
+		return fuzziness{}, fmt.Errorf("failed to parse fuzziness [%v]", v)
+	}
+
+	upper := strings.ToUpper(s)
+	if upper == "AUTO" {
+		return fuzziness{auto: true, low: 3, high: 6}, nil
+	}
+	if strings.HasPrefix(upper, "AUTO:") {
+		bounds := strings.Split(upper[len("AUTO:"):], ",")
+		if len(bounds) == 2 {
+			low, lowErr := strconv.Atoi(strings.TrimSpace(bounds[0]))
+			high, highErr := strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if lowErr == nil && highErr == nil && low >= 0 && high >= low {
+				return fuzziness{auto: true, low: low, high: high}, nil
+			}
+		}
+		return fuzziness{}, fmt.Errorf("failed to find low and high distance values in fuzziness [%s]", s)
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || f != math.Trunc(f) {
+		return fuzziness{}, fmt.Errorf("failed to parse fuzziness [%s]", s)
+	}
+	if f > float64(searcher.MaxFuzziness) {
+		return fuzziness{}, fmt.Errorf("Valid edit distances are [0, 1, 2] but was [%s]", s)
+	}
+	return fuzziness{edits: int(f)}, nil
+}
+
+// editsFor 返回词项允许的编辑距离，AUTO 按字符数计算：小于 low 为 0，小于 high 为 1，否则为 2
+func (f fuzziness) editsFor(term string) int {
+	if !f.auto {
+		return f.edits
+	}
+	length := utf8.RuneCountInString(term)
+	switch {
+	case length < f.low:
+		return 0
+	case length < f.high:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// isZero 判断是否未启用模糊匹配
+func (f fuzziness) isZero() bool {
+	return !f.auto && f.edits == 0
+}
+
+// minimumShouldMatch 按 ES 规则计算 minimum_should_match，optional 为可选子句数量
+// 支持整数、负整数、百分比、负百分比以及 "3<90%"、"2<-25% 9<-3" 形式的条件组合
+func minimumShouldMatch(spec interface{}, optional int) (int, error) {
+	var s string
+	switch v := spec.(type) {
+	case int:
+		s = strconv.Itoa(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		s = strings.TrimSpace(v)
+	default:
+		return 0, fmt.Errorf("failed to parse minimum_should_match [%v]", spec)
+	}
+
+	if strings.Contains(s, "<") {
+		result := optional
+		for _, part := range strings.Fields(s) {
+			bound := strings.SplitN(part, "<", 2)
+			upper, err := strconv.Atoi(bound[0])
+			if err != nil || len(bound) != 2 {
+				return 0, fmt.Errorf("failed to parse minimum_should_match [%s]", s)
+			}
+			if optional <= upper {
+				return result, nil
+			}
+			if result, err = minimumShouldMatch(bound[1], optional); err != nil {
+				return 0, err
+			}
+		}
+		return result, nil
+	}
+
+	var result int
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse minimum_should_match [%s]", s)
+		}
+		// 百分比向下取整，负值表示允许缺失的比例
+		calc := int(float64(optional) * percent / 100)
+		if percent < 0 {
+			result = optional + calc
+		} else {
+			result = calc
+		}
+	} else {
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse minimum_should_match [%s]", s)
+		}
+		if n < 0 {
+			result = optional + int(n)
+		} else {
+			result = int(n)
+		}
+	}
+
+	if result > optional {
+		result = optional
+	}
+	if result < 0 {
+		result = 0
+	}
+	return result, nil
+}
+
+// MatchOptionsQuery 带高级选项的 match 查询
+type MatchOptionsQuery struct {
+	Match              string                   `json:"match"`
+	FieldVal           string                   `json:"field,omitempty"`
+	Analyzer           string                   `json:"analyzer,omitempty"`
+	Operator           query.MatchQueryOperator `json:"operator,omitempty"`
+	PrefixLength       int                      `json:"prefix_length,omitempty"`
+	MaxExpansions      int                      `json:"max_expansions,omitempty"`
+	MinimumShouldMatch interface{}              `json:"minimum_should_match,omitempty"`
+	BoostVal           *query.Boost             `json:"boost,omitempty"`
+	fuzziness          fuzziness
+}
+
+// NewMatchOptionsQuery 创建带高级选项的 match 查询
+func NewMatchOptionsQuery(match, field string) *MatchOptionsQuery {
+	return &MatchOptionsQuery{
+		Match:         match,
+		FieldVal:      field,
+		Operator:      query.MatchQueryOperatorOr,
+		MaxExpansions: defaultMaxExpansions,
+	}
+}
+
+func (q *MatchOptionsQuery) SetBoost(b float64) {
+	boost := query.Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *MatchOptionsQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *MatchOptionsQuery) SetField(f string) {
+	q.FieldVal = f
+}
+
+func (q *MatchOptionsQuery) Field() string {
+	return q.FieldVal
+}
+
+// Searcher 实现 query.Query
+// 与 bleve 的 MatchQuery 一样按分析后的词项组合查询，模糊词项最多扩展 max_expansions 个候选词
+func (q *MatchOptionsQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	field := q.FieldVal
+	if field == "" {
+		field = m.DefaultSearchField()
+	}
+	analyzerName := q.Analyzer
+	if analyzerName == "" {
+		analyzerName = m.AnalyzerNameForPath(field)
+	}
+	if m.AnalyzerNamed(analyzerName) == nil {
+		return nil, fmt.Errorf("[match] analyzer [%s] not found", analyzerName)
+	}
+
+	tokens := analyzeFieldText(m, field, analyzerName, q.Match)
+	if len(tokens) == 0 {
+		return searcher.NewMatchNoneSearcher(i)
+	}
+
+	boost := q.BoostVal.Value()
+	tqs := make([]query.Query, 0, len(tokens))
+	for _, token := range tokens {
+		if edits := q.fuzziness.editsFor(token); edits > 0 {
+			tqs = append(tqs, &fuzzyExpansionQuery{
+				term:          token,
+				field:         field,
+				edits:         edits,
+				prefixLength:  q.PrefixLength,
+				maxExpansions: q.MaxExpansions,
+				boost:         boost,
+			})
+			continue
+		}
+		tq := query.NewTermQuery(token)
+		tq.SetField(field)
+		tq.SetBoost(boost)
+		tqs = append(tqs, tq)
+	}
+
+	combined, err := combineMatchClauses(tqs, q.Operator, q.MinimumShouldMatch, boost)
+	if err != nil {
+		return nil, err
+	}
+	return combined.Searcher(ctx, i, m, options)
+}
+
+// combineMatchClauses 按 operator 组合各词项的查询，or 时至少匹配 minimum_should_match 个（至少 1 个）
+func combineMatchClauses(clauses []query.Query, operator query.MatchQueryOperator, minShould interface{}, boost float64) (query.Query, error) {
+	if operator == query.MatchQueryOperatorAnd {
+		mustQuery := query.NewConjunctionQuery(clauses)
+		mustQuery.SetBoost(boost)
+		return mustQuery, nil
+	}
+
+	min := 1
+	if minShould != nil {
+		n, err := minimumShouldMatch(minShould, len(clauses))
+		if err != nil {
+			return nil, err
+		}
+		if n > min {
+			min = n
+		}
+	}
+	shouldQuery := query.NewDisjunctionQuery(clauses)
+	shouldQuery.SetMin(float64(min))
+	shouldQuery.SetBoost(boost)
+	return shouldQuery, nil
+}
+
+// fuzzyExpansionQuery 单个词项的模糊查询，候选词按编辑距离、文档频率排序后保留前 maxExpansions 个
+type fuzzyExpansionQuery struct {
+	term          string
+	field         string
+	edits         int
+	prefixLength  int
+	maxExpansions int
+	boost         float64
+}
+
+// fuzzyCandidate 模糊查询的候选词
+type fuzzyCandidate struct {
+	term     string
+	distance uint8
+	count    uint64
+}
+
+func (q *fuzzyExpansionQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	candidates, err := q.candidates(i)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return searcher.NewTermSearcher(ctx, i, q.term, q.field, q.boost, options)
+	}
+
+	sort.Slice(candidates, func(a, b int) bool {
+		if candidates[a].distance != candidates[b].distance {
+			return candidates[a].distance < candidates[b].distance
+		}
+		if candidates[a].count != candidates[b].count {
+			return candidates[a].count > candidates[b].count
+		}
+		return candidates[a].term < candidates[b].term
+	})
+	if q.maxExpansions > 0 && len(candidates) > q.maxExpansions {
+		candidates = candidates[:q.maxExpansions]
+	}
+
+	terms := make([]string, len(candidates))
+	editDistances := make([]uint8, len(candidates))
+	for k, c := range candidates {
+		terms[k] = c.term
+		editDistances[k] = c.distance
+	}
+	return searcher.NewMultiTermSearcherBoosted(ctx, i, terms, q.field, q.boost, editDistances, options, true)
+}
+
+// candidates 枚举词典中编辑距离不超过 edits 且前缀一致的词项
+func (q *fuzzyExpansionQuery) candidates(i index.IndexReader) (rv []fuzzyCandidate, err error) {
+	// prefix_length 按字符计算
+	prefix := q.term
+	if q.prefixLength < utf8.RuneCountInString(prefix) {
+		prefix = string([]rune(prefix)[:q.prefixLength])
+	}
+
+	var fieldDict index.FieldDict
+	fuzzyReader, automaton := i.(index.IndexReaderFuzzy)
+	switch {
+	case automaton:
+		fieldDict, err = fuzzyReader.FieldDictFuzzy(q.field, q.term, q.edits, prefix)
+	case prefix != "":
+		fieldDict, err = i.FieldDictPrefix(q.field, []byte(prefix))
+	default:
+		fieldDict, err = i.FieldDict(q.field)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := fieldDict.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	var reuse []int
+	entry, err := fieldDict.Next()
+	for err == nil && entry != nil {
+		distance := int(entry.EditDistance)
+		if !automaton {
+			var exceeded bool
+			distance, exceeded, reuse = search.LevenshteinDistanceMaxReuseSlice(q.term, entry.Term, q.edits, reuse)
+			if exceeded || distance > q.edits {
+				entry, err = fieldDict.Next()
+				continue
+			}
+		}
+		rv = append(rv, fuzzyCandidate{term: entry.Term, distance: uint8(distance), count: entry.Count})
+		entry, err = fieldDict.Next()
+	}
+	return rv, err
+}
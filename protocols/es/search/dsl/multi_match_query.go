@@ -0,0 +1,340 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+	"github.com/lscgzwd/tiggerdb/search/searcher"
+)
+
+// multi_match 查询类型：
+//   - best_fields（默认）：各字段分别执行 match，取最高分（dis_max），其余字段得分乘以 tie_breaker 累加
+//   - most_fields / bool_prefix：各字段分别执行 match，得分相加
+//   - phrase / phrase_prefix：各字段分别执行 match_phrase，取最高分
+//   - cross_fields：以词项为中心，把分析器相同的字段视为一个大字段，每个词项在任一字段中出现即可
+//
+// 字段支持 "title^3" 形式的权重与 "*_name" 形式的通配符（按 mapping 展开为 text/keyword 字段）。
+
+// multiMatchOptions 转发给单字段 match 查询的参数
+var multiMatchOptions = []string{"operator", "fuzziness", "prefix_length", "max_expansions", "analyzer", "minimum_should_match"}
+
+// multiMatchField multi_match 中的一个字段及其权重
+type multiMatchField struct {
+	name  string
+	boost float64
+}
+
+// parseFieldBoost 解析 "field^boost" 形式的字段
+func parseFieldBoost(spec string) (string, float64, error) {
+	idx := strings.LastIndex(spec, "^")
+	if idx < 0 {
+		return spec, 1.0, nil
+	}
+	boost, err := strconv.ParseFloat(spec[idx+1:], 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("[multi_match] failed to parse field boost [%s]", spec)
+	}
+	return spec[:idx], boost, nil
+}
+
+// multiMatchFields 解析 fields 参数，展开通配符字段
+func (p *QueryParser) multiMatchFields(raw interface{}) ([]multiMatchField, error) {
+	var specs []interface{}
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		specs = []interface{}{v}
+	case []interface{}:
+		specs = v
+	default:
+		return nil, fmt.Errorf("[multi_match] fields must be an array of strings")
+	}
+
+	var fields []multiMatchField
+	for _, spec := range specs {
+		s, ok := spec.(string)
+		if !ok {
+			return nil, fmt.Errorf("[multi_match] fields must be an array of strings")
+		}
+		name, boost, err := parseFieldBoost(s)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(name, "*") {
+			fields = append(fields, multiMatchField{name: p.normalizeFieldName(name), boost: boost})
+			continue
+		}
+		for _, expanded := range p.expandFieldPattern(name) {
+			fields = append(fields, multiMatchField{name: expanded, boost: boost})
+		}
+	}
+	return fields, nil
+}
+
+// expandFieldPattern 返回 mapping 中匹配通配符的 text/keyword 字段
+func (p *QueryParser) expandFieldPattern(pattern string) []string {
+	var rv []string
+	for field, fieldType := range p.fieldTypes {
+		if fieldType != "text" && fieldType != "keyword" {
+			continue
+		}
+		if matched, _ := path.Match(pattern, field); matched {
+			rv = append(rv, field)
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// parseMultiMatch 解析multi_match查询
+func (p *QueryParser) parseMultiMatch(body interface{}) (query.Query, error) {
+	multiMap, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("multi_match query body must be a map")
+	}
+
+	queryText, _ := multiMap["query"].(string)
+	if queryText == "" {
+		return query.NewMatchNoneQuery(), nil
+	}
+
+	fields, err := p.multiMatchFields(multiMap["fields"])
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		matchQuery := query.NewMatchQuery(queryText)
+		return matchQuery, nil
+	}
+
+	matchType := "best_fields"
+	if t, ok := multiMap["type"].(string); ok {
+		matchType = strings.ToLower(t)
+	}
+	var tieBreaker float64
+	if tb, ok := multiMap["tie_breaker"].(float64); ok {
+		tieBreaker = tb
+	}
+	lenient, _ := multiMap["lenient"].(bool)
+
+	var rv query.Query
+	switch matchType {
+	case "best_fields", "most_fields", "bool_prefix":
+		clauses, err := p.multiMatchClauses(fields, queryText, multiMap, lenient, p.buildMatchQuery)
+		if err != nil {
+			return nil, err
+		}
+		rv = combineFieldClauses(clauses, matchType == "best_fields", tieBreaker)
+	case "phrase", "phrase_prefix":
+		clauses, err := p.multiMatchClauses(fields, queryText, multiMap, lenient, p.buildMatchPhraseQuery)
+		if err != nil {
+			return nil, err
+		}
+		rv = combineFieldClauses(clauses, true, tieBreaker)
+	case "cross_fields":
+		rv, err = p.crossFieldsQuery(fields, queryText, multiMap, lenient, tieBreaker)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("[multi_match] query does not support type [%s]", matchType)
+	}
+
+	if boost, ok := multiMap["boost"].(float64); ok {
+		if boostable, ok := rv.(query.BoostableQuery); ok {
+			boostable.SetBoost(boost * boostable.Boost())
+		}
+	}
+	return rv, nil
+}
+
+// multiMatchClauses 为每个字段构建单字段查询，lenient 时跳过值类型与字段不符的字段
+func (p *QueryParser) multiMatchClauses(fields []multiMatchField, text string, multiMap map[string]interface{}, lenient bool,
+	build func(field string, value interface{}) (query.Query, error)) ([]query.Query, error) {
+	clauses := make([]query.Query, 0, len(fields))
+	for _, field := range fields {
+		value := map[string]interface{}{"query": text, "boost": field.boost}
+		for _, key := range multiMatchOptions {
+			if v, ok := multiMap[key]; ok {
+				value[key] = v
+			}
+		}
+		clause, err := build(field.name, value)
+		if err != nil {
+			if lenient {
+				continue
+			}
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// combineFieldClauses 组合各字段的查询：disMax 为 true 时取最高分，否则得分相加
+func combineFieldClauses(clauses []query.Query, disMax bool, tieBreaker float64) query.Query {
+	switch {
+	case len(clauses) == 0:
+		return query.NewMatchNoneQuery()
+	case len(clauses) == 1:
+		return clauses[0]
+	case disMax:
+		return NewDisMaxQuery(clauses, tieBreaker)
+	default:
+		disjQuery := query.NewDisjunctionQuery(clauses)
+		disjQuery.SetMin(1)
+		return disjQuery
+	}
+}
+
+// crossFieldsQuery 构建 cross_fields 查询：text/keyword 字段合并为 CrossFieldsQuery，其余字段按字段类型单独匹配
+func (p *QueryParser) crossFieldsQuery(fields []multiMatchField, text string, multiMap map[string]interface{}, lenient bool, tieBreaker float64) (query.Query, error) {
+	cross := NewCrossFieldsQuery(text, tieBreaker)
+	var typed []multiMatchField
+	for _, field := range fields {
+		if err := p.checkFieldMapped(field.name); err != nil {
+			return nil, err
+		}
+		switch p.fieldTypes[field.name] {
+		case "", "text", "keyword":
+			cross.Fields = append(cross.Fields, field.name)
+			cross.FieldBoosts = append(cross.FieldBoosts, field.boost)
+		default:
+			typed = append(typed, field)
+		}
+	}
+	if op, ok := multiMap["operator"].(string); ok && strings.ToLower(op) == "and" {
+		cross.Operator = query.MatchQueryOperatorAnd
+	}
+	if v, ok := multiMap["analyzer"]; ok {
+		analyzer, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("[multi_match] failed to parse [analyzer] value [%v]", v)
+		}
+		cross.Analyzer = analyzer
+	}
+	if v, ok := multiMap["minimum_should_match"]; ok {
+		if _, err := minimumShouldMatch(v, 1); err != nil {
+			return nil, fmt.Errorf("[multi_match] %v", err)
+		}
+		cross.MinimumShouldMatch = v
+	}
+
+	clauses, err := p.multiMatchClauses(typed, text, map[string]interface{}{}, lenient, p.buildMatchQuery)
+	if err != nil {
+		return nil, err
+	}
+	if len(cross.Fields) > 0 {
+		clauses = append([]query.Query{cross}, clauses...)
+	}
+	return combineFieldClauses(clauses, true, tieBreaker), nil
+}
+
+// CrossFieldsQuery multi_match 的 cross_fields 查询
+// 分析器相同的字段组成一组，组内每个词项构建各字段 term 查询的 dis_max，再按 operator 组合；
+// 多个分组之间取最高分。
+type CrossFieldsQuery struct {
+	Match              string                   `json:"match"`
+	Fields             []string                 `json:"fields"`
+	FieldBoosts        []float64                `json:"field_boosts"`
+	Analyzer           string                   `json:"analyzer,omitempty"`
+	Operator           query.MatchQueryOperator `json:"operator,omitempty"`
+	MinimumShouldMatch interface{}              `json:"minimum_should_match,omitempty"`
+	TieBreaker         float64                  `json:"tie_breaker,omitempty"`
+	BoostVal           *query.Boost             `json:"boost,omitempty"`
+}
+
+// NewCrossFieldsQuery 创建 cross_fields 查询
+func NewCrossFieldsQuery(match string, tieBreaker float64) *CrossFieldsQuery {
+	return &CrossFieldsQuery{
+		Match:      match,
+		Operator:   query.MatchQueryOperatorOr,
+		TieBreaker: tieBreaker,
+	}
+}
+
+func (q *CrossFieldsQuery) SetBoost(b float64) {
+	boost := query.Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *CrossFieldsQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+// Searcher 实现 query.Query
+func (q *CrossFieldsQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	// 按分析器分组，保持字段顺序
+	var analyzers []string
+	groups := make(map[string][]int)
+	for k, field := range q.Fields {
+		analyzerName := q.Analyzer
+		if analyzerName == "" {
+			analyzerName = m.AnalyzerNameForPath(field)
+		}
+		if m.AnalyzerNamed(analyzerName) == nil {
+			return nil, fmt.Errorf("[multi_match] analyzer [%s] not found", analyzerName)
+		}
+		if _, ok := groups[analyzerName]; !ok {
+			analyzers = append(analyzers, analyzerName)
+		}
+		groups[analyzerName] = append(groups[analyzerName], k)
+	}
+
+	groupQueries := make([]query.Query, 0, len(analyzers))
+	for _, analyzerName := range analyzers {
+		members := groups[analyzerName]
+		tokens := analyzeFieldText(m, q.Fields[members[0]], analyzerName, q.Match)
+		if len(tokens) == 0 {
+			continue
+		}
+		termClauses := make([]query.Query, 0, len(tokens))
+		for _, token := range tokens {
+			fieldClauses := make([]query.Query, 0, len(members))
+			for _, k := range members {
+				tq := query.NewTermQuery(token)
+				tq.SetField(q.Fields[k])
+				tq.SetBoost(q.FieldBoosts[k])
+				fieldClauses = append(fieldClauses, tq)
+			}
+			termClauses = append(termClauses, combineFieldClauses(fieldClauses, true, q.TieBreaker))
+		}
+		groupQuery, err := combineMatchClauses(termClauses, q.Operator, q.MinimumShouldMatch, 1.0)
+		if err != nil {
+			return nil, err
+		}
+		groupQueries = append(groupQueries, groupQuery)
+	}
+	if len(groupQueries) == 0 {
+		return searcher.NewMatchNoneSearcher(i)
+	}
+
+	rv := combineFieldClauses(groupQueries, true, q.TieBreaker)
+	if boostable, ok := rv.(query.BoostableQuery); ok {
+		boostable.SetBoost(q.BoostVal.Value())
+	}
+	return rv.Searcher(ctx, i, m, options)
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/logger"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/query"
+	"github.com/lscgzwd/tiggerdb/search/searcher"
+)
+
+// 嵌套文档模型：
+// nested 字段的每个元素作为独立的子文档索引（ID 为 "root#path#position"），
+// 子文档携带 _nested_path（所属 nested 路径）和 _root_id（根文档ID），字段名保持完整路径。
+// 顶层查询通过 ExcludeNestedDocuments 排除子文档；nested 查询在子文档上执行，
+// 按 _root_id 聚合子文档得分后返回根文档。
+const (
+	NestedPathField   = "_nested_path"
+	NestedRootIDField = "_root_id"
+)
+
+// Score mode（nested / has_child 共用）
+const (
+	ScoreModeAvg   = "avg"
+	ScoreModeSum   = "sum"
+	ScoreModeTotal = "total" // has_child 中 sum 的别名
+	ScoreModeMin   = "min"
+	ScoreModeMax   = "max"
+	ScoreModeNone  = "none"
+)
+
+// maxNestedQueryHits nested 查询单次最多收集的子文档数
+const maxNestedQueryHits = 100000
+
+// NestedQuery 在 path 的子文档上执行内部查询，按 _root_id 聚合子文档得分后匹配根文档；
+// 作为普通查询参与执行，可以出现在任意复合查询（bool、function_score、boosting 等）中
+type NestedQuery struct {
+	Path       string       `json:"path"`
+	InnerQuery query.Query  `json:"query"`
+	ScoreMode  string       `json:"score_mode,omitempty"`
+	BoostVal   *query.Boost `json:"boost,omitempty"`
+}
+
+// NewNestedQuery 创建 nested 查询
+func NewNestedQuery(path string, inner query.Query, scoreMode string) *NestedQuery {
+	return &NestedQuery{Path: path, InnerQuery: inner, ScoreMode: scoreMode}
+}
+
+func (q *NestedQuery) SetBoost(b float64) {
+	boost := query.Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *NestedQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+// NewNestedDocumentsQuery 匹配嵌套子文档；path 为空时匹配所有路径的子文档
+func NewNestedDocumentsQuery(path string) query.Query {
+	if path != "" {
+		tq := query.NewTermQuery(path)
+		tq.SetField(NestedPathField)
+		return tq
+	}
+	wq := query.NewWildcardQuery("*")
+	wq.SetField(NestedPathField)
+	return wq
+}
+
+// ExcludeNestedDocuments 将查询限定在根文档上（排除所有嵌套子文档）
+func ExcludeNestedDocuments(q query.Query) query.Query {
+	bq := query.NewBooleanQuery([]query.Query{q}, nil, []query.Query{NewNestedDocumentsQuery("")})
+	return bq
+}
+
+// ValidScoreMode 校验 score_mode，allowTotal 表示是否接受 has_child 的 total
+func ValidScoreMode(mode string, allowTotal bool) bool {
+	switch mode {
+	case ScoreModeAvg, ScoreModeSum, ScoreModeMin, ScoreModeMax, ScoreModeNone:
+		return true
+	case ScoreModeTotal:
+		return allowTotal
+	}
+	return false
+}
+
+// CombineScores 按 score_mode 合并多个子文档得分
+func CombineScores(scores []float64, mode string) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+	switch mode {
+	case ScoreModeNone:
+		return 0
+	case ScoreModeSum, ScoreModeTotal:
+		sum := 0.0
+		for _, s := range scores {
+			sum += s
+		}
+		return sum
+	case ScoreModeMin:
+		min := math.MaxFloat64
+		for _, s := range scores {
+			min = math.Min(min, s)
+		}
+		return min
+	case ScoreModeMax:
+		max := -math.MaxFloat64
+		for _, s := range scores {
+			max = math.Max(max, s)
+		}
+		return max
+	default:
+		sum := 0.0
+		for _, s := range scores {
+			sum += s
+		}
+		return sum / float64(len(scores))
+	}
+}
+
+// Searcher 实现 query.Query
+// 两阶段执行：
+// 1. 在同一个 IndexReader 中对指定路径的子文档执行内部查询
+// 2. 按 _root_id 分组，按 score_mode 合并子文档得分，返回带有合并得分的根文档
+func (q *NestedQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	childQuery := query.NewBooleanQuery([]query.Query{q.InnerQuery}, nil, nil)
+	childQuery.Filter = NewNestedDocumentsQuery(q.Path)
+	childSearcher, err := childQuery.Searcher(ctx, i, m, search.SearcherOptions{Score: options.Score})
+	if err != nil {
+		return nil, err
+	}
+	defer childSearcher.Close()
+
+	sctx := &search.SearchContext{DocumentMatchPool: search.NewDocumentMatchPool(childSearcher.DocumentMatchPoolSize(), 0)}
+	childScores := make(map[string][]float64)
+	hits := 0
+	for {
+		dm, err := childSearcher.Next(sctx)
+		if err != nil {
+			return nil, err
+		}
+		if dm == nil {
+			break
+		}
+		if hits == maxNestedQueryHits {
+			logger.Warn("NestedQuery - path [%s] matched more than %d nested documents, only the first %d are used", q.Path, maxNestedQueryHits, maxNestedQueryHits)
+			break
+		}
+		hits++
+		rootID, err := nestedRootID(i, dm.IndexInternalID)
+		if err != nil {
+			return nil, err
+		}
+		if rootID != "" {
+			childScores[rootID] = append(childScores[rootID], dm.Score)
+		}
+		sctx.DocumentMatchPool.Put(dm)
+	}
+
+	logger.Debug("NestedQuery - path [%s]: %d matching nested documents, %d root documents", q.Path, hits, len(childScores))
+
+	if len(childScores) == 0 {
+		return searcher.NewMatchNoneSearcher(i)
+	}
+	rootScores := make(map[string]float64, len(childScores))
+	for rootID, scores := range childScores {
+		rootScores[rootID] = CombineScores(scores, q.ScoreMode) * q.BoostVal.Value()
+	}
+	return NewScoredDocIDQuery(rootScores).Searcher(ctx, i, m, options)
+}
+
+// nestedRootID 读取子文档存储的 _root_id
+func nestedRootID(i index.IndexReader, id index.IndexInternalID) (string, error) {
+	externalID, err := i.ExternalID(id)
+	if err != nil {
+		return "", err
+	}
+	doc, err := i.Document(externalID)
+	if err != nil || doc == nil {
+		return "", err
+	}
+	var rootID string
+	doc.VisitFields(func(field index.Field) {
+		if field.Name() == NestedRootIDField {
+			rootID = string(field.Value())
+		}
+	})
+	return rootID, nil
+}
+
+// ScoredDocIDQuery 匹配指定文档并返回预先计算的得分（用于 nested / join 查询的得分传递）
+type ScoredDocIDQuery struct {
+	Scores map[string]float64 `json:"scores"`
+}
+
+// NewScoredDocIDQuery 创建带预设得分的文档ID查询
+func NewScoredDocIDQuery(scores map[string]float64) *ScoredDocIDQuery {
+	return &ScoredDocIDQuery{Scores: scores}
+}
+
+// Searcher 实现 query.Query
+func (q *ScoredDocIDQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	ids := make([]string, 0, len(q.Scores))
+	for id := range q.Scores {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	docIDSearcher, err := searcher.NewDocIDSearcher(ctx, i, ids, 1.0, options)
+	if err != nil {
+		return nil, err
+	}
+
+	internalScores := make(map[string]float64, len(ids))
+	for _, id := range ids {
+		internalID, err := i.InternalID(id)
+		if err != nil || internalID == nil {
+			continue
+		}
+		internalScores[string(internalID)] = q.Scores[id]
+	}
+
+	return &scoredDocIDSearcher{
+		Searcher: docIDSearcher,
+		scores:   internalScores,
+		explain:  options.Explain,
+	}, nil
+}
+
+// scoredDocIDSearcher 在 DocIDSearcher 的基础上替换为预设得分
+type scoredDocIDSearcher struct {
+	search.Searcher
+	scores  map[string]float64
+	explain bool
+}
+
+func (s *scoredDocIDSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.Searcher.Next(ctx)
+	if err != nil || dm == nil {
+		return dm, err
+	}
+	s.applyScore(dm)
+	return dm, nil
+}
+
+func (s *scoredDocIDSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.Searcher.Advance(ctx, ID)
+	if err != nil || dm == nil {
+		return dm, err
+	}
+	s.applyScore(dm)
+	return dm, nil
+}
+
+func (s *scoredDocIDSearcher) applyScore(dm *search.DocumentMatch) {
+	dm.Score = s.scores[string(dm.IndexInternalID)]
+	if s.explain {
+		dm.Expl = &search.Explanation{
+			Value:   dm.Score,
+			Message: fmt.Sprintf("score from matching child documents, computed as %v", dm.Score),
+		}
+	}
+}
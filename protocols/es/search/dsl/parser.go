@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lscgzwd/tiggerdb/logger"
 	"github.com/lscgzwd/tiggerdb/script"
@@ -28,10 +29,22 @@ import (
 
 // QueryParser ES Query DSL解析器
 type QueryParser struct {
-	optimizer *QueryOptimizer      // 查询优化器
-	registry  *QueryParserRegistry // P2-2: 查询解析策略注册表（策略模式）
+	optimizer      *QueryOptimizer      // 查询优化器
+	registry       *QueryParserRegistry // P2-2: 查询解析策略注册表（策略模式）
+	fieldAliases   map[string]string    // 字段别名（alias 类型字段）到目标字段路径的映射
+	dateFields     map[string]string    // date 字段到 mapping 中 format 的映射
+	fieldTypes     map[string]string    // 字段完整路径到 mapping 类型的映射
+	parseDate      DateBoundParser      // 解析 date 字段 range 查询的边界
+	strictFields   bool                 // 严格模式：查询引用未映射的字段时返回错误
+	maxRegexLength int                  // regexp 查询模式的最大长度（index.max_regex_length）
+	fieldAllowed   func(string) bool    // 字段级安全：返回 false 的字段对请求不可见，nil 表示不限制
 }
 
+// DateBoundParser 按 format 解析 date 字段 range 查询的边界（字符串或毫秒时间戳），
+// timeZone 为查询的 time_zone 参数（不带时区的日期与 now 的取整按该时区计算，空为 UTC），
+// roundUp 为 true 时日期数学表达式的取整（"now/d"）取到该单位的最后一毫秒
+type DateBoundParser func(value interface{}, format, timeZone string, roundUp bool) (time.Time, error)
+
 // NewQueryParser 创建新的查询解析器
 func NewQueryParser() *QueryParser {
 	parser := &QueryParser{
@@ -60,11 +73,27 @@ func (p *QueryParser) SetOptimizerEnabled(enabled bool) {
 	p.optimizer.SetEnabled(enabled)
 }
 
+// SetFieldAliases 设置字段别名映射（alias 字段名 -> 目标字段路径）
+// 设置后，查询中引用的别名字段会在解析时被改写为目标字段
+func (p *QueryParser) SetFieldAliases(aliases map[string]string) {
+	p.fieldAliases = aliases
+}
+
+// resolveFieldAlias 将别名字段解析为目标字段，非别名原样返回
+func (p *QueryParser) resolveFieldAlias(field string) string {
+	if target, ok := p.fieldAliases[field]; ok {
+		return target
+	}
+	return field
+}
+
 // normalizeFieldName 规范化字段名
+// 别名字段先解析为目标字段路径
 // ES 中 .keyword 后缀表示使用 keyword 子字段进行精确匹配
 // 但 Bleve 没有这个概念，所以需要去除 .keyword 后缀
 // 同样，.text 后缀也需要去除
 func (p *QueryParser) normalizeFieldName(field string) string {
+	field = p.resolveFieldAlias(field)
 	// 去除 .keyword 后缀
 	if strings.HasSuffix(field, ".keyword") {
 		return strings.TrimSuffix(field, ".keyword")
@@ -115,6 +144,9 @@ func (p *QueryParser) ParseQuery(queryMap map[string]interface{}) (query.Query,
 		if err != nil {
 			return nil, err
 		}
+		if p.fieldAllowed != nil && parsedQuery != nil {
+			parsedQuery = p.hideFields(parsedQuery)
+		}
 
 		// 应用查询优化器
 		if parsedQuery != nil && p.optimizer != nil {
@@ -200,6 +232,31 @@ func (p *QueryParser) addPathPrefixToQuery(q query.Query, pathPrefix string) {
 		return
 	}
 
+	// 处理DisMaxQuery
+	if disMaxQuery, ok := q.(*DisMaxQuery); ok {
+		for i := range disMaxQuery.Disjuncts {
+			p.addPathPrefixToQuery(disMaxQuery.Disjuncts[i], pathPrefix)
+		}
+		return
+	}
+
+	// 处理BoostingQuery
+	if boostingQuery, ok := q.(*BoostingQuery); ok {
+		p.addPathPrefixToQuery(boostingQuery.Positive, pathPrefix)
+		p.addPathPrefixToQuery(boostingQuery.Negative, pathPrefix)
+		return
+	}
+
+	// 处理CrossFieldsQuery（multi_match cross_fields）
+	if crossQuery, ok := q.(*CrossFieldsQuery); ok {
+		for i, field := range crossQuery.Fields {
+			if !strings.HasPrefix(field, pathPrefix+".") {
+				crossQuery.Fields[i] = pathPrefix + "." + field
+			}
+		}
+		return
+	}
+
 	// 处理ConjunctionQuery（AND查询）
 	if conjQuery, ok := q.(*query.ConjunctionQuery); ok {
 		for i := range conjQuery.Conjuncts {
@@ -244,6 +301,9 @@ func (p *QueryParser) parseScript(body interface{}) (query.Query, error) {
 	if !ok {
 		return nil, fmt.Errorf("script query body must be a map")
 	}
+	if err := p.checkScriptAllowed("script"); err != nil {
+		return nil, err
+	}
 
 	// 解析脚本对象
 	var scriptData interface{}
@@ -290,6 +350,9 @@ func (p *QueryParser) parseScriptScore(body interface{}) (query.Query, error) {
 		// 没有脚本，返回内部查询
 		return innerQuery, nil
 	}
+	if err := p.checkScriptAllowed("script_score"); err != nil {
+		return nil, err
+	}
 
 	s, err := script.ParseScript(scriptData)
 	if err != nil {
@@ -333,6 +396,12 @@ func (p *QueryParser) parseFunctionScore(body interface{}) (query.Query, error)
 		innerQuery = query.NewMatchAllQuery()
 	}
 
+	if functionScoreUsesScript(funcMap) {
+		if err := p.checkScriptAllowed("function_score"); err != nil {
+			return nil, err
+		}
+	}
+
 	// 创建 FunctionScoreQuery
 	fsq := query.NewFunctionScoreQuery(innerQuery)
 
@@ -378,6 +447,22 @@ func (p *QueryParser) parseFunctionScore(body interface{}) (query.Query, error)
 	return fsq, nil
 }
 
+// functionScoreUsesScript 判断 function_score 是否包含 script_score 函数（顶层或 functions 数组中）
+func functionScoreUsesScript(funcMap map[string]interface{}) bool {
+	if _, ok := funcMap["script_score"]; ok {
+		return true
+	}
+	functions, _ := funcMap["functions"].([]interface{})
+	for _, fn := range functions {
+		if fnMap, ok := fn.(map[string]interface{}); ok {
+			if _, ok := fnMap["script_score"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // parseFunctionScoreFunction 解析单个评分函数
 func (p *QueryParser) parseFunctionScoreFunction(fsq *query.FunctionScoreQuery, fnMap map[string]interface{}) {
 	var filter query.Query
@@ -428,7 +513,7 @@ func (p *QueryParser) parseFunctionScoreFunction(fsq *query.FunctionScoreQuery,
 			missing = m
 		}
 
-		if field != "" {
+		if field != "" && p.fieldVisible(field) {
 			scoreFn = query.NewFieldValueFactorFunction(field, factor, modifier, missing)
 		}
 	}
@@ -451,7 +536,7 @@ func (p *QueryParser) parseFunctionScoreFunction(fsq *query.FunctionScoreQuery,
 		if decay, ok := fnMap[decayType].(map[string]interface{}); ok {
 			for field, spec := range decay {
 				specMap, ok := spec.(map[string]interface{})
-				if !ok {
+				if !ok || !p.fieldVisible(p.normalizeFieldName(field)) {
 					continue
 				}
 				origin := 0.0
@@ -472,7 +557,7 @@ func (p *QueryParser) parseFunctionScoreFunction(fsq *query.FunctionScoreQuery,
 					decayVal = d
 				}
 
-				scoreFn = query.NewDecayFunction(field, origin, scale, offset, decayVal, decayType)
+				scoreFn = query.NewDecayFunction(p.normalizeFieldName(field), origin, scale, offset, decayVal, decayType)
 				break
 			}
 		}
@@ -514,48 +599,6 @@ func (p *QueryParser) parseSingleFunction(fsq *query.FunctionScoreQuery, funcMap
 	}
 }
 
-// parsePinned 解析pinned查询
-// ES格式: {"pinned": {"ids": [...], "organic": {...}}}
-// 实现：使用ids查询和bool查询组合
-func (p *QueryParser) parsePinned(body interface{}) (query.Query, error) {
-	pinnedMap, ok := body.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("pinned query must be an object")
-	}
-
-	// 解析pinned ids
-	var pinnedIds []string
-	if idsVal, ok := pinnedMap["ids"].([]interface{}); ok {
-		for _, id := range idsVal {
-			if idStr, ok := id.(string); ok {
-				pinnedIds = append(pinnedIds, idStr)
-			}
-		}
-	}
-
-	// 解析organic查询
-	var organicQuery query.Query
-	if organicVal, ok := pinnedMap["organic"].(map[string]interface{}); ok {
-		var err error
-		organicQuery, err = p.ParseQuery(organicVal)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse pinned organic query: %w", err)
-		}
-	} else {
-		organicQuery = query.NewMatchAllQuery()
-	}
-
-	// 组合查询：pinned ids OR organic query
-	if len(pinnedIds) > 0 {
-		pinnedQuery := query.NewDocIDQuery(pinnedIds)
-		disjQuery := query.NewDisjunctionQuery([]query.Query{pinnedQuery, organicQuery})
-		disjQuery.SetMin(1) // 至少匹配一个子查询
-		return disjQuery, nil
-	}
-
-	return organicQuery, nil
-}
-
 // parseWrapper 解析wrapper查询
 // ES格式: {"wrapper": {"query": "base64_encoded_query"}}
 // 实现：解码base64并解析内部查询
@@ -571,21 +614,26 @@ func (p *QueryParser) parseWrapper(body interface{}) (query.Query, error) {
 		return nil, fmt.Errorf("wrapper query must have 'query' field with base64 encoded string")
 	}
 
-	// 解码base64
-	decodedBytes, err := base64.StdEncoding.DecodeString(encodedQuery)
-	if err != nil {
-		// 尝试使用URL安全的base64解码
-		decodedBytes, err = base64.URLEncoding.DecodeString(encodedQuery)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode base64 query: %w", err)
+	// 解码base64：依次尝试标准编码、URL安全编码及其无填充形式
+	var decodedBytes []byte
+	var err error
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if decodedBytes, err = encoding.DecodeString(encodedQuery); err == nil {
+			break
 		}
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 query: %w", err)
+	}
 
-	// 解析JSON
+	// 解析JSON，解码后必须是单个查询对象
 	var queryMap map[string]interface{}
 	if err := json.Unmarshal(decodedBytes, &queryMap); err != nil {
 		return nil, fmt.Errorf("failed to parse decoded query JSON: %w", err)
 	}
+	if len(queryMap) != 1 {
+		return nil, fmt.Errorf("[wrapper] query malformed, expected a single query but found %d keys", len(queryMap))
+	}
 
 	logger.Debug("parseWrapper - Decoded query: %v", queryMap)
 
@@ -593,6 +641,30 @@ func (p *QueryParser) parseWrapper(body interface{}) (query.Query, error) {
 	return p.ParseQuery(queryMap)
 }
 
+// parseRawBleve 解析x_bleve查询（TigerDB扩展）
+// 格式: {"x_bleve": <bleve 查询 JSON>}，如 {"x_bleve": {"match": "foo", "field": "title", "fuzziness": 1}}
+// 原样交给 bleve 解析，用于使用尚未通过 ES DSL 开放的 bleve 查询功能；字段名不做别名解析与 .keyword 规范化
+func (p *QueryParser) parseRawBleve(body interface{}) (query.Query, error) {
+	raw, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("[x_bleve] query must be an object")
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("[x_bleve] failed to encode query: %w", err)
+	}
+	q, err := query.ParseQuery(data)
+	if err != nil {
+		return nil, fmt.Errorf("[x_bleve] failed to parse bleve query: %w", err)
+	}
+	if vq, ok := q.(query.ValidatableQuery); ok {
+		if err := vq.Validate(); err != nil {
+			return nil, fmt.Errorf("[x_bleve] invalid bleve query: %w", err)
+		}
+	}
+	return q, nil
+}
+
 // parsePercolate 解析percolate查询
 // ES格式: {"percolate": {"field": "query", "document": {...}}}
 // 或者: {"percolate": {"field": "query", "documents": [...]}}
@@ -646,10 +718,14 @@ func (p *QueryParser) parsePercolate(body interface{}) (query.Query, error) {
 	placeholderQuery.SetBoost(boost)
 
 	// 注册 percolate 查询信息
+	// name 用于区分同一请求中多个 percolate 查询的槽位字段
+	name, _ := percolateMap["name"].(string)
+
 	RegisterPercolateQuery(placeholderQuery, &PercolateQueryInfo{
 		Field:     field,
 		Document:  document,
 		Documents: documents,
+		Name:      name,
 		Boost:     boost,
 	})
 
@@ -698,12 +774,42 @@ func (p *QueryParser) parseHasChild(body interface{}) (query.Query, error) {
 	placeholderQuery := query.NewMatchAllQuery()
 	placeholderQuery.SetBoost(boost)
 
+	// score_mode（ES has_child 默认 none）
+	scoreMode := ScoreModeNone
+	if mode, ok := hasChildMap["score_mode"].(string); ok {
+		if !ValidScoreMode(mode, false) {
+			return nil, fmt.Errorf("[has_child] query does not support [score_mode] value [%s]", mode)
+		}
+		scoreMode = mode
+	}
+
+	minChildren, err := p.parseJoinChildrenLimit(hasChildMap, "min_children")
+	if err != nil {
+		return nil, err
+	}
+	maxChildren, err := p.parseJoinChildrenLimit(hasChildMap, "max_children")
+	if err != nil {
+		return nil, err
+	}
+	if maxChildren > 0 && minChildren > maxChildren {
+		return nil, fmt.Errorf("[has_child] 'max_children' is less than 'min_children'")
+	}
+
+	innerHits, err := parseInnerHitsOptions(hasChildMap["inner_hits"], childType)
+	if err != nil {
+		return nil, err
+	}
+
 	// 注册 join 查询信息
 	RegisterJoinQuery(placeholderQuery, &JoinQueryInfo{
-		Type:       JoinQueryTypeHasChild,
-		TypeName:   childType,
-		InnerQuery: parsedInnerQuery,
-		Boost:      boost,
+		Type:        JoinQueryTypeHasChild,
+		TypeName:    childType,
+		InnerQuery:  parsedInnerQuery,
+		Boost:       boost,
+		ScoreMode:   scoreMode,
+		MinChildren: minChildren,
+		MaxChildren: maxChildren,
+		InnerHits:   innerHits,
 	})
 
 	logger.Debug("parseHasChild - Registered has_child query for child type '%s'", childType)
@@ -711,6 +817,44 @@ func (p *QueryParser) parseHasChild(body interface{}) (query.Query, error) {
 	return placeholderQuery, nil
 }
 
+// parseJoinChildrenLimit 解析 has_child 的 min_children/max_children
+func (p *QueryParser) parseJoinChildrenLimit(body map[string]interface{}, key string) (int, error) {
+	v, ok := body[key]
+	if !ok || v == nil {
+		return 0, nil
+	}
+	n, err := p.toFloat64(v)
+	if err != nil || n < 0 || n != float64(int(n)) {
+		return 0, fmt.Errorf("[has_child] '%s' must be a non-negative integer", key)
+	}
+	return int(n), nil
+}
+
+// parseInnerHitsOptions 解析 inner_hits 配置（name 默认为关联的类型名，size 默认 3）
+func parseInnerHitsOptions(v interface{}, defaultName string) (*InnerHitsOptions, error) {
+	if v == nil {
+		return nil, nil
+	}
+	innerHitsMap, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("[inner_hits] must be an object")
+	}
+	opts := &InnerHitsOptions{Name: defaultName, Size: 3}
+	if name, ok := innerHitsMap["name"].(string); ok && name != "" {
+		opts.Name = name
+	}
+	if size, ok := innerHitsMap["size"].(float64); ok {
+		opts.Size = int(size)
+	}
+	if from, ok := innerHitsMap["from"].(float64); ok {
+		opts.From = int(from)
+	}
+	if opts.Size < 0 || opts.From < 0 {
+		return nil, fmt.Errorf("[inner_hits] from and size must be non-negative")
+	}
+	return opts, nil
+}
+
 // parseHasParent 解析has_parent查询
 // ES格式: {"has_parent": {"parent_type": "parent_type", "query": {...}}}
 // 实现：创建标记查询，在搜索执行时进行两阶段查询
@@ -749,12 +893,22 @@ func (p *QueryParser) parseHasParent(body interface{}) (query.Query, error) {
 	placeholderQuery := query.NewMatchAllQuery()
 	placeholderQuery.SetBoost(boost)
 
+	// score：是否将父文档得分传递给子文档（默认 false）
+	score, _ := hasParentMap["score"].(bool)
+
+	innerHits, err := parseInnerHitsOptions(hasParentMap["inner_hits"], parentType)
+	if err != nil {
+		return nil, err
+	}
+
 	// 注册 join 查询信息
 	RegisterJoinQuery(placeholderQuery, &JoinQueryInfo{
 		Type:       JoinQueryTypeHasParent,
 		TypeName:   parentType,
 		InnerQuery: parsedInnerQuery,
 		Boost:      boost,
+		Score:      score,
+		InnerHits:  innerHits,
 	})
 
 	logger.Debug("parseHasParent - Registered has_parent query for parent type '%s'", parentType)
@@ -17,8 +17,6 @@ package dsl
 import (
 	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 
 	"github.com/lscgzwd/tiggerdb/logger"
 	"github.com/lscgzwd/tiggerdb/search/query"
@@ -125,49 +123,54 @@ func (p *QueryParser) parseBool(body interface{}) (query.Query, error) {
 
 	boolQuery := query.NewBooleanQuery(allMust, shouldQueries, mustNotQueries)
 
-	var minShould float64
 	if minShouldRaw, ok := boolMap["minimum_should_match"]; ok && len(shouldQueries) > 0 {
-		switch v := minShouldRaw.(type) {
-		case int:
-			minShould = float64(v)
-		case int64:
-			minShould = float64(v)
-		case float64:
-			minShould = v
-		case string:
-			if strings.HasSuffix(v, "%") {
-				percentStr := strings.TrimSuffix(v, "%")
-				if percent, err := strconv.ParseFloat(percentStr, 64); err == nil {
-					minShould = float64(len(shouldQueries)) * percent / 100.0
-				} else {
-					minShould = 1.0
-				}
-			} else {
-				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
-					minShould = parsed
-				} else {
-					minShould = 1.0
-				}
-			}
-		default:
-			minShould = 1.0
-		}
-
-		if minShould > float64(len(shouldQueries)) {
-			minShould = float64(len(shouldQueries))
+		minShould, err := minimumShouldMatch(minShouldRaw, len(shouldQueries))
+		if err != nil {
+			return nil, fmt.Errorf("[bool] %v", err)
 		}
-
 		if minShould > 0 {
-			boolQuery.SetMinShould(minShould)
+			boolQuery.SetMinShould(float64(minShould))
 		}
 	} else if len(shouldQueries) > 0 && len(allMust) == 0 {
-		minShould = 1.0
-		boolQuery.SetMinShould(minShould)
+		boolQuery.SetMinShould(1)
 	}
 
 	return boolQuery, nil
 }
 
+// parseBoosting 解析boosting查询
+func (p *QueryParser) parseBoosting(body interface{}) (query.Query, error) {
+	boostingMap, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("boosting query must be an object")
+	}
+
+	clauses := make(map[string]query.Query, 2)
+	for _, key := range []string{"positive", "negative"} {
+		clauseMap, ok := boostingMap[key].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("boosting query requires '%s' query", key)
+		}
+		clause, err := p.ParseQuery(clauseMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse boosting %s query: %w", key, err)
+		}
+		clauses[key] = clause
+	}
+
+	negativeBoost, ok := boostingMap["negative_boost"].(float64)
+	if !ok || negativeBoost < 0 {
+		return nil, fmt.Errorf("boosting query requires 'negative_boost' to be a non-negative number")
+	}
+	boostingQuery := NewBoostingQuery(clauses["positive"], clauses["negative"], negativeBoost)
+
+	if boost, ok := boostingMap["boost"].(float64); ok {
+		boostingQuery.SetBoost(boost)
+	}
+
+	return boostingQuery, nil
+}
+
 // parseNested 解析nested查询
 func (p *QueryParser) parseNested(body interface{}) (query.Query, error) {
 	nestedMap, ok := body.(map[string]interface{})
@@ -191,15 +194,27 @@ func (p *QueryParser) parseNested(body interface{}) (query.Query, error) {
 	}
 
 	p.addPathPrefixToQuery(nestedQuery, path)
+	if p.fieldAllowed != nil {
+		// 内部查询的字段可以省略 path，加上前缀后再检查字段是否可见
+		nestedQuery = p.hideFields(nestedQuery)
+	}
 
-	if scoreMode, ok := nestedMap["score_mode"].(string); ok {
-		validModes := map[string]bool{"avg": true, "sum": true, "max": true, "min": true, "none": true}
-		if !validModes[scoreMode] {
-			logger.Warn("Invalid score_mode '%s' in nested query, using default 'avg'", scoreMode)
+	scoreMode := ScoreModeAvg
+	if mode, ok := nestedMap["score_mode"].(string); ok {
+		if !ValidScoreMode(mode, false) {
+			return nil, fmt.Errorf("[nested] query does not support [score_mode] value [%s]", mode)
 		}
+		scoreMode = mode
+	}
+
+	boost := 1.0
+	if b, ok := nestedMap["boost"].(float64); ok {
+		boost = b
 	}
 
-	return nestedQuery, nil
+	nested := NewNestedQuery(path, nestedQuery, scoreMode)
+	nested.SetBoost(boost)
+	return nested, nil
 }
 
 // parseConstantScore 解析constant_score查询
@@ -264,12 +279,15 @@ func (p *QueryParser) parseDisMax(body interface{}) (query.Query, error) {
 		return query.NewMatchNoneQuery(), nil
 	}
 
-	disjQuery := query.NewDisjunctionQuery(disjuncts)
-	disjQuery.SetMin(1)
+	var tieBreaker float64
+	if tb, ok := disMaxMap["tie_breaker"].(float64); ok {
+		tieBreaker = tb
+	}
+	disMaxQuery := NewDisMaxQuery(disjuncts, tieBreaker)
 
 	if boost, ok := disMaxMap["boost"].(float64); ok {
-		disjQuery.SetBoost(boost)
+		disMaxQuery.SetBoost(boost)
 	}
 
-	return disjQuery, nil
+	return disMaxQuery, nil
 }
@@ -16,6 +16,7 @@ package dsl
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/lscgzwd/tiggerdb/logger"
@@ -38,51 +39,137 @@ func (p *QueryParser) parseMatch(body interface{}) (query.Query, error) {
 	}
 
 	for field, value := range matchMap {
-		field = p.normalizeFieldName(field)
+		return p.buildMatchQuery(p.normalizeFieldName(field), value)
+	}
 
-		var queryText string
-		var operator string = "or"
-		var boost float64 = 1.0
+	return nil, fmt.Errorf("match query must have a field")
+}
 
-		switch v := value.(type) {
-		case string:
-			queryText = v
-		case map[string]interface{}:
-			if q, ok := v["query"].(string); ok {
-				queryText = q
-			} else if q, ok := v["query"].(float64); ok {
-				queryText = fmt.Sprintf("%v", q)
-			}
-			if op, ok := v["operator"].(string); ok {
-				operator = strings.ToLower(op)
-			}
-			if b, ok := v["boost"].(float64); ok {
-				boost = b
-			}
-		case float64:
-			queryText = fmt.Sprintf("%v", v)
-		case bool:
-			queryText = fmt.Sprintf("%v", v)
-		default:
-			return nil, fmt.Errorf("invalid match query value type: %T", value)
+// buildMatchQuery 构建单个字段上的 match 查询（match 与 multi_match 共用）
+func (p *QueryParser) buildMatchQuery(field string, value interface{}) (query.Query, error) {
+	if err := p.checkFieldMapped(field); err != nil {
+		return nil, err
+	}
+
+	var queryText string
+	var operator string = "or"
+	var boost float64 = 1.0
+	var options map[string]interface{}
+
+	switch v := value.(type) {
+	case string:
+		queryText = v
+	case map[string]interface{}:
+		if q, ok := v["query"].(string); ok {
+			queryText = q
+		} else if q, ok := v["query"].(float64); ok {
+			queryText = fmt.Sprintf("%v", q)
 		}
+		if op, ok := v["operator"].(string); ok {
+			operator = strings.ToLower(op)
+		}
+		if b, ok := v["boost"].(float64); ok {
+			boost = b
+		}
+		options = v
+	case float64:
+		queryText = fmt.Sprintf("%v", v)
+	case bool:
+		queryText = fmt.Sprintf("%v", v)
+	default:
+		return nil, fmt.Errorf("invalid match query value type: %T", value)
+	}
 
-		if queryText == "" {
-			return query.NewMatchNoneQuery(), nil
+	rawQuery := value
+	if v, ok := value.(map[string]interface{}); ok {
+		rawQuery = v["query"]
+	}
+	if typedQuery, err := p.typedMatchQuery(field, rawQuery); typedQuery != nil || err != nil {
+		if boostable, ok := typedQuery.(query.BoostableQuery); ok {
+			boostable.SetBoost(boost)
 		}
+		return typedQuery, err
+	}
 
-		matchQuery := query.NewMatchQuery(queryText)
-		matchQuery.SetField(field)
-		matchQuery.SetBoost(boost)
+	if queryText == "" {
+		return query.NewMatchNoneQuery(), nil
+	}
 
-		if operator == "and" {
-			matchQuery.SetOperator(query.MatchQueryOperatorAnd)
+	if hasMatchOptions(options) {
+		optionsQuery, err := newMatchOptionsQuery(queryText, field, operator, options)
+		if err != nil {
+			return nil, err
 		}
+		optionsQuery.SetBoost(boost)
+		return optionsQuery, nil
+	}
 
-		return matchQuery, nil
+	matchQuery := query.NewMatchQuery(queryText)
+	matchQuery.SetField(field)
+	matchQuery.SetBoost(boost)
+
+	if operator == "and" {
+		matchQuery.SetOperator(query.MatchQueryOperatorAnd)
 	}
 
-	return nil, fmt.Errorf("match query must have a field")
+	return matchQuery, nil
+}
+
+// hasMatchOptions 判断 match 查询是否设置了需要 MatchOptionsQuery 执行的选项
+func hasMatchOptions(options map[string]interface{}) bool {
+	for _, key := range []string{"fuzziness", "prefix_length", "max_expansions", "analyzer", "minimum_should_match"} {
+		if _, ok := options[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// newMatchOptionsQuery 根据 match 查询的高级选项构建 MatchOptionsQuery
+func newMatchOptionsQuery(text, field, operator string, options map[string]interface{}) (*MatchOptionsQuery, error) {
+	q := NewMatchOptionsQuery(text, field)
+	if operator == "and" {
+		q.Operator = query.MatchQueryOperatorAnd
+	}
+	if v, ok := options["fuzziness"]; ok {
+		f, err := parseFuzziness(v)
+		if err != nil {
+			return nil, fmt.Errorf("[match] %v", err)
+		}
+		q.fuzziness = f
+	}
+	if v, ok := options["prefix_length"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < 0 || n != math.Trunc(n) {
+			return nil, fmt.Errorf("[match] failed to parse [prefix_length] value [%v]", v)
+		}
+		q.PrefixLength = int(n)
+	}
+	if v, ok := options["max_expansions"]; ok {
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return nil, fmt.Errorf("[match] failed to parse [max_expansions] value [%v]", v)
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("[match] max_expansions must be positive, got %v", v)
+		}
+		q.MaxExpansions = int(n)
+	}
+	if v, ok := options["analyzer"]; ok {
+		analyzer, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("[match] failed to parse [analyzer] value [%v]", v)
+		}
+		q.Analyzer = analyzer
+	}
+	if v, ok := options["minimum_should_match"]; ok {
+		// 提前校验格式，实际数量在执行时按词项数计算
+		if _, err := minimumShouldMatch(v, 1); err != nil {
+			return nil, fmt.Errorf("[match] %v", err)
+		}
+		q.MinimumShouldMatch = v
+	}
+	return q, nil
 }
 
 // parseMatchPhrase 解析match_phrase查询
@@ -93,28 +180,53 @@ func (p *QueryParser) parseMatchPhrase(body interface{}) (query.Query, error) {
 	}
 
 	for field, value := range matchMap {
-		field = p.normalizeFieldName(field)
+		return p.buildMatchPhraseQuery(p.normalizeFieldName(field), value)
+	}
 
-		var phraseText string
-		switch v := value.(type) {
-		case string:
-			phraseText = v
-		case map[string]interface{}:
-			if q, ok := v["query"].(string); ok {
-				phraseText = q
-			}
+	return nil, fmt.Errorf("match_phrase query must have a field")
+}
+
+// buildMatchPhraseQuery 构建单个字段上的 match_phrase 查询（match_phrase 与 multi_match 共用）
+func (p *QueryParser) buildMatchPhraseQuery(field string, value interface{}) (query.Query, error) {
+	if err := p.checkFieldMapped(field); err != nil {
+		return nil, err
+	}
+
+	var phraseText, analyzer string
+	var boost float64 = 1.0
+	rawPhrase := value
+	switch v := value.(type) {
+	case string:
+		phraseText = v
+	case map[string]interface{}:
+		if q, ok := v["query"].(string); ok {
+			phraseText = q
+		}
+		if a, ok := v["analyzer"].(string); ok {
+			analyzer = a
+		}
+		if b, ok := v["boost"].(float64); ok {
+			boost = b
 		}
+		rawPhrase = v["query"]
+	}
 
-		if phraseText == "" {
-			return query.NewMatchNoneQuery(), nil
+	if typedQuery, err := p.typedMatchQuery(field, rawPhrase); typedQuery != nil || err != nil {
+		if boostable, ok := typedQuery.(query.BoostableQuery); ok {
+			boostable.SetBoost(boost)
 		}
+		return typedQuery, err
+	}
 
-		phraseQuery := query.NewMatchPhraseQuery(phraseText)
-		phraseQuery.SetField(field)
-		return phraseQuery, nil
+	if phraseText == "" {
+		return query.NewMatchNoneQuery(), nil
 	}
 
-	return nil, fmt.Errorf("match_phrase query must have a field")
+	phraseQuery := query.NewMatchPhraseQuery(phraseText)
+	phraseQuery.SetField(field)
+	phraseQuery.Analyzer = analyzer
+	phraseQuery.SetBoost(boost)
+	return phraseQuery, nil
 }
 
 // parseMatchPhrasePrefix 解析match_phrase_prefix查询
@@ -149,43 +261,6 @@ func (p *QueryParser) parseMatchPhrasePrefix(body interface{}) (query.Query, err
 	return nil, fmt.Errorf("match_phrase_prefix query must have a field")
 }
 
-// parseMultiMatch 解析multi_match查询
-func (p *QueryParser) parseMultiMatch(body interface{}) (query.Query, error) {
-	multiMap, ok := body.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("multi_match query body must be a map")
-	}
-
-	queryText, _ := multiMap["query"].(string)
-	if queryText == "" {
-		return query.NewMatchNoneQuery(), nil
-	}
-
-	fields, _ := multiMap["fields"].([]interface{})
-	if len(fields) == 0 {
-		matchQuery := query.NewMatchQuery(queryText)
-		return matchQuery, nil
-	}
-
-	var queries []query.Query
-	for _, f := range fields {
-		if fieldName, ok := f.(string); ok {
-			fieldName = p.normalizeFieldName(fieldName)
-			mq := query.NewMatchQuery(queryText)
-			mq.SetField(fieldName)
-			queries = append(queries, mq)
-		}
-	}
-
-	if len(queries) == 1 {
-		return queries[0], nil
-	}
-
-	disjQuery := query.NewDisjunctionQuery(queries)
-	disjQuery.SetMin(1)
-	return disjQuery, nil
-}
-
 // parseQueryString 解析query_string查询
 func (p *QueryParser) parseQueryString(body interface{}) (query.Query, error) {
 	qsMap, ok := body.(map[string]interface{})
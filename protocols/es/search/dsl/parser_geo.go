@@ -34,7 +34,7 @@ func (p *QueryParser) parseGeoBoundingBox(body interface{}) (query.Query, error)
 	var topLeft, bottomRight []float64
 
 	for fieldName, fieldValue := range geoMap {
-		field = fieldName
+		field = p.normalizeFieldName(fieldName)
 		coordsMap, ok := fieldValue.(map[string]interface{})
 		if !ok {
 			continue
@@ -97,7 +97,7 @@ func (p *QueryParser) parseGeoDistance(body interface{}) (query.Query, error) {
 			continue
 		}
 
-		field = fieldName
+		field = p.normalizeFieldName(fieldName)
 		coordsMap, ok := fieldValue.(map[string]interface{})
 		if !ok {
 			if coordsArr, ok := fieldValue.([]interface{}); ok && len(coordsArr) >= 2 {
@@ -144,7 +144,7 @@ func (p *QueryParser) parseGeoPolygon(body interface{}) (query.Query, error) {
 			continue
 		}
 
-		field = fieldName
+		field = p.normalizeFieldName(fieldName)
 		coordsMap, ok := fieldValue.(map[string]interface{})
 		if !ok {
 			continue
@@ -201,7 +201,7 @@ func (p *QueryParser) parseGeoShape(body interface{}) (query.Query, error) {
 			continue
 		}
 
-		field = fieldName
+		field = p.normalizeFieldName(fieldName)
 		coordsMap, ok := fieldValue.(map[string]interface{})
 		if !ok {
 			continue
@@ -0,0 +1,293 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// 绑定索引 mapping 后解析器按字段类型构建查询：
+// - term/terms/match 在数值、date、boolean 字段上构建类型化查询，keyword 字段上为不分析的精确词项查询
+// - range 在数值字段上为数值范围查询，在 keyword/text 字段上为词项范围查询，date 字段按 mapping 中的 format 解析
+// - 严格模式下查询引用 mapping 中不存在的字段返回错误
+// 未映射的字段（或未绑定 mapping）保持按值的类型推断的行为
+
+// SetMapping 绑定索引的 ES mapping，记录各字段（包括 multi-fields）的类型与 date 字段的 format
+func (p *QueryParser) SetMapping(esMapping map[string]interface{}) {
+	types := make(map[string]string)
+	formats := make(map[string]string)
+	if props, ok := esMapping["properties"].(map[string]interface{}); ok {
+		collectMappingFields(props, "", types, formats)
+	}
+	p.fieldTypes = types
+	p.dateFields = formats
+}
+
+// SetDateParser 设置解析 date 字段查询值（range 边界、term 值）的函数
+func (p *QueryParser) SetDateParser(parse DateBoundParser) {
+	p.parseDate = parse
+}
+
+// SetStrictFields 设置严格模式：查询引用未映射的字段时返回错误
+func (p *QueryParser) SetStrictFields(strict bool) {
+	p.strictFields = strict
+}
+
+// collectMappingFields 递归收集字段完整路径到类型的映射，以及 date 字段的 format
+func collectMappingFields(props map[string]interface{}, prefix string, types, formats map[string]string) {
+	for name, def := range props {
+		fieldMap, ok := def.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fullName := name
+		if prefix != "" {
+			fullName = prefix + "." + name
+		}
+		fieldType, _ := fieldMap["type"].(string)
+		if fieldType == "" {
+			if _, ok := fieldMap["properties"]; ok {
+				fieldType = "object"
+			}
+		}
+		if fieldType != "" {
+			types[fullName] = fieldType
+		}
+		if fieldType == "date" || fieldType == "date_nanos" {
+			format, _ := fieldMap["format"].(string)
+			formats[fullName] = format
+		}
+		if sub, ok := fieldMap["properties"].(map[string]interface{}); ok {
+			collectMappingFields(sub, fullName, types, formats)
+		}
+		if sub, ok := fieldMap["fields"].(map[string]interface{}); ok {
+			collectMappingFields(sub, fullName, types, formats)
+		}
+	}
+}
+
+// isNumericFieldType 是否为按数值索引的字段类型
+func isNumericFieldType(fieldType string) bool {
+	switch fieldType {
+	case "long", "integer", "short", "byte", "double", "float":
+		return true
+	}
+	return false
+}
+
+// checkFieldMapped 严格模式下校验字段已在 mapping 中定义（"_" 开头的元数据字段除外）
+func (p *QueryParser) checkFieldMapped(field string) error {
+	if !p.strictFields || strings.HasPrefix(field, "_") {
+		return nil
+	}
+	if _, ok := p.fieldTypes[field]; ok {
+		return nil
+	}
+	return fmt.Errorf("No field mapping can be found for the field with name [%s]", field)
+}
+
+// typedTermQuery 按 mapping 中的字段类型构建单个值的 term 查询
+// 数值字段构建 min==max 的数值范围查询，date 字段按字段 format 解析为日期范围查询（取整的日期数学表达式匹配整个单位），
+// boolean 字段构建布尔查询，keyword 字段构建精确词项查询；
+// 字段类型未知（或为 text 等其他类型）时返回 nil，由调用方按值的类型推断
+func (p *QueryParser) typedTermQuery(field string, value interface{}) (query.Query, error) {
+	fieldType := p.fieldTypes[field]
+	switch {
+	case isNumericFieldType(fieldType):
+		num, err := p.toFloat64(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create query: For input string: \"%v\"", value)
+		}
+		inclusive := true
+		numQuery := query.NewNumericRangeInclusiveQuery(&num, &num, &inclusive, &inclusive)
+		numQuery.SetField(field)
+		return numQuery, nil
+	case fieldType == "date":
+		start, ok, err := p.parseDateValue(field, value, "", "", false)
+		if !ok || err != nil {
+			return nil, err
+		}
+		end, _, err := p.parseDateValue(field, value, "", "", true)
+		if err != nil {
+			return nil, err
+		}
+		inclusive := true
+		dateQuery := query.NewDateRangeInclusiveQuery(start, end, &inclusive, &inclusive)
+		dateQuery.SetField(field)
+		return dateQuery, nil
+	case fieldType == "boolean":
+		var b bool
+		switch v := value.(type) {
+		case bool:
+			b = v
+		case string:
+			if v != "true" && v != "false" {
+				return nil, fmt.Errorf("Failed to parse value [%s] as only [true] or [false] are allowed.", v)
+			}
+			b = v == "true"
+		default:
+			return nil, fmt.Errorf("Failed to parse value [%v] as only [true] or [false] are allowed.", value)
+		}
+		boolQuery := query.NewBoolFieldQuery(b)
+		boolQuery.SetField(field)
+		return boolQuery, nil
+	case fieldType == "keyword":
+		term, err := termString(value)
+		if err != nil {
+			return nil, err
+		}
+		termQuery := query.NewTermQuery(term)
+		termQuery.SetField(field)
+		return termQuery, nil
+	}
+	return nil, nil
+}
+
+// parseDateValue 按 date 字段的 format 解析查询值，format 为空时使用 mapping 中的 format，timeZone 与 roundUp 见 DateBoundParser；
+// 字段不是 date 字段或未设置解析函数时 ok 为 false
+func (p *QueryParser) parseDateValue(field string, value interface{}, format, timeZone string, roundUp bool) (t time.Time, ok bool, err error) {
+	mappingFormat, isDate := p.dateFields[field]
+	if !isDate || p.parseDate == nil {
+		return t, false, nil
+	}
+	if format == "" {
+		format = mappingFormat
+	}
+	if _, isString := value.(string); !isString {
+		if num, err := p.toFloat64(value); err == nil {
+			value = num
+		}
+	}
+	t, err = p.parseDate(value, format, timeZone, roundUp)
+	if err != nil {
+		return t, true, fmt.Errorf("failed to parse date field [%v] with format [%s]: %w", value, format, err)
+	}
+	return t, true, nil
+}
+
+// termString 将查询值转换为词项字符串
+func termString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", fmt.Errorf("[term] query value cannot be null")
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// typedMatchQuery 数值、date、boolean 字段上的 match 查询不分析查询文本，按字段类型构建精确查询；其他字段返回 nil
+func (p *QueryParser) typedMatchQuery(field string, value interface{}) (query.Query, error) {
+	fieldType := p.fieldTypes[field]
+	if !isNumericFieldType(fieldType) && fieldType != "date" && fieldType != "boolean" {
+		return nil, nil
+	}
+	return p.typedTermQuery(field, value)
+}
+
+// typedRangeQuery 按字段类型构建 range 查询：数值字段为数值范围，keyword/text 字段为词项范围；其他字段返回 nil
+func (p *QueryParser) typedRangeQuery(field string, rangeSpec map[string]interface{}) (query.Query, error) {
+	fieldType := p.fieldTypes[field]
+	if !isNumericFieldType(fieldType) && fieldType != "keyword" && fieldType != "text" {
+		return nil, nil
+	}
+	lower, upper := rangeBounds(rangeSpec)
+	if lower == nil && upper == nil {
+		return nil, fmt.Errorf("range query must have at least one range parameter")
+	}
+
+	var rangeQuery interface {
+		query.FieldableQuery
+		query.BoostableQuery
+	}
+	if isNumericFieldType(fieldType) {
+		var min, max *float64
+		var minInclusive, maxInclusive *bool
+		for _, b := range []struct {
+			bound     *rangeBound
+			value     **float64
+			inclusive **bool
+		}{{lower, &min, &minInclusive}, {upper, &max, &maxInclusive}} {
+			if b.bound == nil {
+				continue
+			}
+			num, err := p.toFloat64(b.bound.value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create query: For input string: \"%v\"", b.bound.value)
+			}
+			*b.value, *b.inclusive = &num, &b.bound.inclusive
+		}
+		rangeQuery = query.NewNumericRangeInclusiveQuery(min, max, minInclusive, maxInclusive)
+	} else {
+		var min, max string
+		var minInclusive, maxInclusive *bool
+		if lower != nil {
+			s, err := termString(lower.value)
+			if err != nil {
+				return nil, err
+			}
+			min, minInclusive = s, &lower.inclusive
+		}
+		if upper != nil {
+			s, err := termString(upper.value)
+			if err != nil {
+				return nil, err
+			}
+			max, maxInclusive = s, &upper.inclusive
+		}
+		rangeQuery = query.NewTermRangeInclusiveQuery(min, max, minInclusive, maxInclusive)
+	}
+	rangeQuery.SetField(field)
+	if boost, ok := rangeSpec["boost"].(float64); ok {
+		rangeQuery.SetBoost(boost)
+	}
+	return rangeQuery, nil
+}
+
+// rangeBound range 查询的一侧边界
+type rangeBound struct {
+	value     interface{}
+	inclusive bool
+}
+
+// rangeBounds 读取 range 查询的下界（gte/gt/from）与上界（lte/lt/to），from/to 的包含性由 include_lower/include_upper 指定
+func rangeBounds(rangeSpec map[string]interface{}) (lower, upper *rangeBound) {
+	find := func(keys []string, inclusive []bool, includeKey string) *rangeBound {
+		for i, key := range keys {
+			v, ok := rangeSpec[key]
+			if !ok || v == nil {
+				continue
+			}
+			inc := inclusive[i]
+			if key == "from" || key == "to" {
+				if b, ok := rangeSpec[includeKey].(bool); ok {
+					inc = b
+				}
+			}
+			return &rangeBound{value: v, inclusive: inc}
+		}
+		return nil
+	}
+	lower = find([]string{"gte", "gt", "from"}, []bool{true, false, true}, "include_lower")
+	upper = find([]string{"lte", "lt", "to"}, []bool{true, false, true}, "include_upper")
+	return lower, upper
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"fmt"
+
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// 字段级安全
+// 请求角色不可见的字段在查询中按未映射字段处理：引用它的查询不匹配任何文档（must_not 中则不排除任何文档），
+// 避免通过 term/range 等查询的命中结果推断出不可见字段的值。
+
+// SetFieldFilter 设置字段可见性判断，allowed 返回 false 的字段在查询中按未映射字段处理
+// 未指定字段的查询（如 query_string 搜索 _all）可能匹配不可见字段的内容，同样不匹配任何文档
+func (p *QueryParser) SetFieldFilter(allowed func(field string) bool) {
+	p.fieldAllowed = allowed
+}
+
+// fieldVisible 返回字段是否对请求可见
+func (p *QueryParser) fieldVisible(field string) bool {
+	if p.fieldAllowed == nil {
+		return true
+	}
+	return field != "" && field != "_all" && p.fieldAllowed(field)
+}
+
+// checkScriptAllowed 限制字段时拒绝脚本：脚本可以通过 doc['field'] 与 params._source 读取任意字段，无法按字段可见性改写
+func (p *QueryParser) checkScriptAllowed(queryType string) error {
+	if p.fieldAllowed != nil {
+		return fmt.Errorf("[%s] scripts are not allowed when field level security is applied", queryType)
+	}
+	return nil
+}
+
+// hideFields 将引用不可见字段的查询改写为 match_none
+// 每个查询类型解析后调用，复合查询的子查询已在各自解析时处理，这里只需展开同一查询内部生成的组合（terms 的 disjunction、query_string 等）
+func (p *QueryParser) hideFields(q query.Query) query.Query {
+	switch tq := q.(type) {
+	case *query.QueryStringQuery:
+		// query_string 在执行时才解析语法，提前解析以检查其中引用的字段
+		parsed, err := tq.Parse()
+		if err != nil {
+			return q
+		}
+		return p.hideFields(parsed)
+	case *query.ConjunctionQuery:
+		for i, child := range tq.Conjuncts {
+			tq.Conjuncts[i] = p.hideFields(child)
+		}
+	case *query.DisjunctionQuery:
+		for i, child := range tq.Disjuncts {
+			tq.Disjuncts[i] = p.hideFields(child)
+		}
+	case *DisMaxQuery:
+		for i, child := range tq.Disjuncts {
+			tq.Disjuncts[i] = p.hideFields(child)
+		}
+	case *BoostingQuery:
+		tq.Positive = p.hideFields(tq.Positive)
+		tq.Negative = p.hideFields(tq.Negative)
+	case *query.BooleanQuery:
+		if tq.Must != nil {
+			tq.Must = p.hideFields(tq.Must)
+		}
+		if tq.Should != nil {
+			tq.Should = p.hideFields(tq.Should)
+		}
+		if tq.MustNot != nil {
+			tq.MustNot = p.hideFields(tq.MustNot)
+		}
+		if tq.Filter != nil {
+			tq.Filter = p.hideFields(tq.Filter)
+		}
+	case query.FieldableQuery:
+		if !p.fieldVisible(tq.Field()) {
+			return query.NewMatchNoneQuery()
+		}
+	}
+	return q
+}
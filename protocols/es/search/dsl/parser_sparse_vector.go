@@ -0,0 +1,71 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"fmt"
+
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// sparse_vector / rank_features 存储模型：
+// 字段值是 "词项 -> 权重" 的对象（如 SPLADE、ELSER 的输出），索引时由 handler 展开为：
+//   - 字段本身：按 keyword 索引所有词项，用于召回候选文档
+//   - _sparse_weights：所有稀疏向量字段的权重词项（doc values），用于点积评分
+const SparseVectorWeightsField = "_sparse_weights"
+
+// parseSparseVector 解析sparse_vector查询
+// ES格式: {"sparse_vector": {"field": "ml.tokens", "query_vector": {"token": 0.5, ...}, "boost": 1.0}}
+// 不支持通过 inference_id 在服务端生成查询向量
+func (p *QueryParser) parseSparseVector(body interface{}) (query.Query, error) {
+	sparseMap, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("sparse_vector query must be an object")
+	}
+
+	field, _ := sparseMap["field"].(string)
+	if field == "" {
+		return nil, fmt.Errorf("[sparse_vector] requires a [field]")
+	}
+	if _, ok := sparseMap["inference_id"]; ok {
+		return nil, fmt.Errorf("[sparse_vector] [inference_id] is not supported, provide [query_vector] instead")
+	}
+	if prune, _ := sparseMap["prune"].(bool); prune {
+		return nil, fmt.Errorf("[sparse_vector] [prune] is not supported")
+	}
+
+	vectorMap, ok := sparseMap["query_vector"].(map[string]interface{})
+	if !ok || len(vectorMap) == 0 {
+		return nil, fmt.Errorf("[sparse_vector] requires a non-empty [query_vector] object")
+	}
+	vector := make(map[string]float64, len(vectorMap))
+	for token, v := range vectorMap {
+		weight, err := p.toFloat64(v)
+		if err != nil {
+			return nil, fmt.Errorf("[sparse_vector] invalid weight for token [%s]: %w", token, err)
+		}
+		vector[token] = weight
+	}
+
+	q := query.NewSparseVectorQuery(p.resolveFieldAlias(field), SparseVectorWeightsField, vector)
+	if boost, ok := sparseMap["boost"]; ok {
+		b, err := p.toFloat64(boost)
+		if err != nil {
+			return nil, fmt.Errorf("[sparse_vector] invalid boost: %w", err)
+		}
+		q.SetBoost(b)
+	}
+	return q, nil
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lscgzwd/tiggerdb/logger"
 	"github.com/lscgzwd/tiggerdb/search/query"
@@ -34,6 +35,9 @@ func (p *QueryParser) parseTerm(body interface{}) (query.Query, error) {
 
 	for field, value := range termMap {
 		field = p.normalizeFieldName(field)
+		if err := p.checkFieldMapped(field); err != nil {
+			return nil, err
+		}
 		var termValue interface{}
 
 		if valueMap, ok := value.(map[string]interface{}); ok {
@@ -52,6 +56,10 @@ func (p *QueryParser) parseTerm(body interface{}) (query.Query, error) {
 			}
 		}
 
+		if q, err := p.typedTermQuery(field, termValue); q != nil || err != nil {
+			return q, err
+		}
+
 		switch v := termValue.(type) {
 		case float64:
 			var queries []query.Query
@@ -102,31 +110,10 @@ func (p *QueryParser) parseTerm(body interface{}) (query.Query, error) {
 			return disjQuery, nil
 		case string:
 			// 处理字符串形式的 bool 值（"true"/"false"）
-			// 注意：Bleve 中 bool 字段被索引为 "T" 或 "F"（单个字符），而不是 "true"/"false"
 			if v == "true" || v == "false" {
-				var queries []query.Query
-				// 尝试匹配字符串形式（"true"/"false"）
-				termQueryStr := query.NewTermQuery(v)
-				termQueryStr.SetField(field)
-				queries = append(queries, termQueryStr)
-				
-				// 尝试匹配 Bleve bool 字段格式（"T"/"F"）
-				boolVal := v == "true"
-				if boolVal {
-					termQueryT := query.NewTermQuery("T")
-					termQueryT.SetField(field)
-					queries = append(queries, termQueryT)
-				} else {
-					termQueryF := query.NewTermQuery("F")
-					termQueryF.SetField(field)
-					queries = append(queries, termQueryF)
-				}
-				
-				disjQuery := query.NewDisjunctionQuery(queries)
-				disjQuery.SetMin(1)
-				return disjQuery, nil
+				return BoolTermQuery(field, v == "true"), nil
 			}
-			
+
 			if numVal, err := strconv.ParseFloat(v, 64); err == nil {
 				var queries []query.Query
 				inclusive := true
@@ -165,10 +152,7 @@ func (p *QueryParser) parseTerm(body interface{}) (query.Query, error) {
 			disjQuery.SetMin(1)
 			return disjQuery, nil
 		case bool:
-			boolStr := fmt.Sprintf("%v", v)
-			termQuery := query.NewTermQuery(boolStr)
-			termQuery.SetField(field)
-			return termQuery, nil
+			return BoolTermQuery(field, v), nil
 		default:
 			queryValue := fmt.Sprintf("%v", v)
 			termQuery := query.NewTermQuery(queryValue)
@@ -180,6 +164,18 @@ func (p *QueryParser) parseTerm(body interface{}) (query.Query, error) {
 	return nil, fmt.Errorf("term query must have at least one field")
 }
 
+// BoolTermQuery 构建布尔值的精确查询
+// boolean 字段在 Bleve 中索引为 "T"/"F"，keyword/text 字段保存的是 "true"/"false" 字符串，两种形式都匹配
+func BoolTermQuery(field string, value bool) query.Query {
+	boolQuery := query.NewBoolFieldQuery(value)
+	boolQuery.SetField(field)
+	termQuery := query.NewTermQuery(strconv.FormatBool(value))
+	termQuery.SetField(field)
+	disjQuery := query.NewDisjunctionQuery([]query.Query{boolQuery, termQuery})
+	disjQuery.SetMin(1)
+	return disjQuery
+}
+
 // parseTerms 解析terms查询（多值term查询）
 func (p *QueryParser) parseTerms(body interface{}) (query.Query, error) {
 	termsMap, ok := body.(map[string]interface{})
@@ -191,6 +187,9 @@ func (p *QueryParser) parseTerms(body interface{}) (query.Query, error) {
 
 	for field, value := range termsMap {
 		field = p.normalizeFieldName(field)
+		if err := p.checkFieldMapped(field); err != nil {
+			return nil, err
+		}
 		var termValues []interface{}
 
 		if arr, ok := value.([]interface{}); ok {
@@ -232,6 +231,15 @@ func (p *QueryParser) parseTerms(body interface{}) (query.Query, error) {
 		}
 
 		for _, termValue := range uniqueValues {
+			typedQuery, err := p.typedTermQuery(field, termValue)
+			if err != nil {
+				return nil, err
+			}
+			if typedQuery != nil {
+				queries = append(queries, typedQuery)
+				continue
+			}
+
 			var termQueries []query.Query
 
 			switch v := termValue.(type) {
@@ -267,7 +275,13 @@ func (p *QueryParser) parseTerms(body interface{}) (query.Query, error) {
 				tq := query.NewTermQuery(termStr)
 				tq.SetField(field)
 				termQueries = append(termQueries, tq)
+			case bool:
+				termQueries = append(termQueries, BoolTermQuery(field, v))
 			case string:
+				if v == "true" || v == "false" {
+					termQueries = append(termQueries, BoolTermQuery(field, v == "true"))
+					break
+				}
 				// 对于字符串值，首先尝试 TermQuery（精确匹配）
 				tq := query.NewTermQuery(v)
 				tq.SetField(field)
@@ -323,10 +337,21 @@ func (p *QueryParser) parseRange(body interface{}) (query.Query, error) {
 
 	for field, value := range rangeMap {
 		field = p.normalizeFieldName(field)
+		if err := p.checkFieldMapped(field); err != nil {
+			return nil, err
+		}
 		rangeSpec, ok := value.(map[string]interface{})
 		if !ok {
 			return nil, fmt.Errorf("range query value must be a map")
 		}
+		if format, ok := p.dateFields[field]; ok && p.parseDate != nil {
+			if q, err := p.parseDateRange(field, rangeSpec, format); q != nil || err != nil {
+				return q, err
+			}
+		}
+		if q, err := p.typedRangeQuery(field, rangeSpec); q != nil || err != nil {
+			return q, err
+		}
 
 		var min, max *float64
 		var minInclusive, maxInclusive *bool
@@ -465,3 +490,45 @@ func (p *QueryParser) parseRange(body interface{}) (query.Query, error) {
 
 	return nil, fmt.Errorf("range query must have at least one field")
 }
+
+// parseDateRange 解析 date 字段上的 range 查询：边界按查询的 format（默认为 mapping 中的 format）与 time_zone 解析，
+// 支持日期数学表达式（"now-15m"）与毫秒时间戳，没有任何边界时返回 nil
+func (p *QueryParser) parseDateRange(field string, rangeSpec map[string]interface{}, format string) (query.Query, error) {
+	if f, ok := rangeSpec["format"].(string); ok && f != "" {
+		format = f
+	}
+	timeZone, _ := rangeSpec["time_zone"].(string)
+	// 与 ES 一致，gt 与 lte 边界的取整取到该单位的最后一毫秒（"gt": "now/d" 不包含当天，"lte": "now/d" 包含当天）
+	parseBound := func(v interface{}, roundUp bool) (time.Time, error) {
+		t, _, err := p.parseDateValue(field, v, format, timeZone, roundUp)
+		return t, err
+	}
+
+	var start, end time.Time
+	var startInclusive, endInclusive *bool
+	lower, upper := rangeBounds(rangeSpec)
+	if lower != nil {
+		t, err := parseBound(lower.value, !lower.inclusive)
+		if err != nil {
+			return nil, err
+		}
+		start, startInclusive = t, &lower.inclusive
+	}
+	if upper != nil {
+		t, err := parseBound(upper.value, upper.inclusive)
+		if err != nil {
+			return nil, err
+		}
+		end, endInclusive = t, &upper.inclusive
+	}
+	if startInclusive == nil && endInclusive == nil {
+		return nil, nil
+	}
+
+	rangeQuery := query.NewDateRangeInclusiveQuery(start, end, startInclusive, endInclusive)
+	rangeQuery.SetField(field)
+	if boost, ok := rangeSpec["boost"].(float64); ok {
+		rangeQuery.SetBoost(boost)
+	}
+	return rangeQuery, nil
+}
@@ -33,6 +33,9 @@ func (p *QueryParser) parseWildcard(body interface{}) (query.Query, error) {
 
 	for field, value := range wildcardMap {
 		field = p.normalizeFieldName(field)
+		if err := p.checkFieldMapped(field); err != nil {
+			return nil, err
+		}
 		var wildcardValue string
 		caseInsensitive := true // 默认启用大小写不敏感（ES 默认行为）
 
@@ -78,6 +81,9 @@ func (p *QueryParser) parsePrefix(body interface{}) (query.Query, error) {
 
 	for field, value := range prefixMap {
 		field = p.normalizeFieldName(field)
+		if err := p.checkFieldMapped(field); err != nil {
+			return nil, err
+		}
 		var prefixValue string
 
 		if strValue, ok := value.(string); ok {
@@ -109,6 +115,9 @@ func (p *QueryParser) parseFuzzy(body interface{}) (query.Query, error) {
 
 	for field, value := range fuzzyMap {
 		field = p.normalizeFieldName(field)
+		if err := p.checkFieldMapped(field); err != nil {
+			return nil, err
+		}
 		var fuzzyValue string
 		var fuzziness int = 2
 
@@ -147,7 +156,14 @@ func (p *QueryParser) parseRegexp(body interface{}) (query.Query, error) {
 
 	for field, value := range regexpMap {
 		field = p.normalizeFieldName(field)
+		if err := p.checkFieldMapped(field); err != nil {
+			return nil, err
+		}
 		var regexpValue string
+		flags := RegexpFlagAll
+		caseInsensitive := false
+		maxStates := DefaultMaxDeterminizedStates
+		boost := 1.0
 
 		if strValue, ok := value.(string); ok {
 			regexpValue = strValue
@@ -157,12 +173,45 @@ func (p *QueryParser) parseRegexp(body interface{}) (query.Query, error) {
 			} else {
 				return nil, fmt.Errorf("regexp query must have 'value' field")
 			}
+			if v, ok := valueMap["flags"]; ok {
+				s, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("[regexp] failed to parse [flags] value [%v]", v)
+				}
+				f, err := parseRegexpFlags(s)
+				if err != nil {
+					return nil, err
+				}
+				flags = f
+			}
+			if v, ok := valueMap["case_insensitive"]; ok {
+				b, ok := v.(bool)
+				if !ok {
+					return nil, fmt.Errorf("[regexp] failed to parse [case_insensitive] value [%v]", v)
+				}
+				caseInsensitive = b
+			}
+			if v, ok := valueMap["max_determinized_states"]; ok {
+				n, ok := v.(float64)
+				if !ok || n < 1 || n != float64(int(n)) {
+					return nil, fmt.Errorf("[regexp] failed to parse [max_determinized_states] value [%v]", v)
+				}
+				maxStates = int(n)
+			}
+			if b, ok := valueMap["boost"].(float64); ok {
+				boost = b
+			}
 		} else {
 			return nil, fmt.Errorf("invalid regexp query value type")
 		}
 
-		regexpQuery := query.NewRegexpQuery(regexpValue)
+		pattern, err := p.compileRegexp(regexpValue, flags, caseInsensitive, maxStates)
+		if err != nil {
+			return nil, err
+		}
+		regexpQuery := query.NewRegexpQuery(pattern)
 		regexpQuery.SetField(field)
+		regexpQuery.SetBoost(boost)
 		return regexpQuery, nil
 	}
 
@@ -0,0 +1,269 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// percolator 存储模型：
+// 存储查询的文档携带以下内部字段（索引时由 handler 生成）：
+//   - _has_percolator：固定为 "true"，标识该文档包含存储的查询
+//   - _percolator_query：序列化后的查询 JSON
+//   - _percolator_terms：从查询中提取的 "字段:词项"，文档必须包含其中之一才可能匹配
+//   - _percolator_extraction：complete 表示词项提取完整可用于预过滤，failed 表示必须逐个校验
+//
+// percolate 时先用待匹配文档的词项筛选候选查询，再在内存索引中执行候选查询确认匹配。
+const (
+	PercolatorFlagField       = "_has_percolator"
+	PercolatorQueryField      = "_percolator_query"
+	PercolatorTermsField      = "_percolator_terms"
+	PercolatorExtractionField = "_percolator_extraction"
+
+	PercolatorExtractionComplete = "complete"
+	PercolatorExtractionFailed   = "failed"
+)
+
+// percolatorTermKey 组合字段与词项
+func percolatorTermKey(field, term string) string {
+	return field + ":" + term
+}
+
+// ExtractPercolatorTerms 从查询中提取词项
+// 返回的词项满足：任何匹配该查询的文档至少包含其中一个词项。
+// 无法保证该条件时（如 match_all、range、通配符等）complete 为 false，查询需要始终参与校验。
+func ExtractPercolatorTerms(m mapping.IndexMapping, q query.Query) (terms []string, complete bool) {
+	set, ok := extractQueryTerms(m, q)
+	if !ok {
+		return nil, false
+	}
+	terms = make([]string, 0, len(set))
+	for t := range set {
+		terms = append(terms, t)
+	}
+	sort.Strings(terms)
+	return terms, true
+}
+
+// extractQueryTerms 递归提取词项集合，返回 false 表示无法提取
+func extractQueryTerms(m mapping.IndexMapping, q query.Query) (map[string]struct{}, bool) {
+	switch tq := q.(type) {
+	case *query.TermQuery:
+		if tq.FieldVal == "" {
+			return nil, false
+		}
+		return map[string]struct{}{percolatorTermKey(tq.FieldVal, tq.Term): {}}, true
+
+	case *query.BoolFieldQuery:
+		// 文档中的布尔值按 "true"/"false" 提取
+		if tq.FieldVal == "" {
+			return nil, false
+		}
+		return map[string]struct{}{percolatorTermKey(tq.FieldVal, strconv.FormatBool(tq.Bool)): {}}, true
+
+	case *query.MatchQuery:
+		if tq.FieldVal == "" || tq.Fuzziness != 0 {
+			return nil, false
+		}
+		tokens := analyzeFieldText(m, tq.FieldVal, tq.Analyzer, tq.Match)
+		if len(tokens) == 0 {
+			return nil, false
+		}
+		if tq.Operator == query.MatchQueryOperatorAnd {
+			// AND：任意一个词项都是必要条件，选择最长（通常最具区分度）的词项
+			return singleTermSet(tq.FieldVal, longestToken(tokens)), true
+		}
+		set := make(map[string]struct{}, len(tokens))
+		for _, token := range tokens {
+			set[percolatorTermKey(tq.FieldVal, token)] = struct{}{}
+		}
+		return set, true
+
+	case *query.MatchPhraseQuery:
+		if tq.FieldVal == "" || tq.Fuzziness != 0 {
+			return nil, false
+		}
+		tokens := analyzeFieldText(m, tq.FieldVal, tq.Analyzer, tq.MatchPhrase)
+		if len(tokens) == 0 {
+			return nil, false
+		}
+		return singleTermSet(tq.FieldVal, longestToken(tokens)), true
+
+	case *query.PhraseQuery:
+		if tq.FieldVal == "" || tq.Fuzziness != 0 || len(tq.Terms) == 0 {
+			return nil, false
+		}
+		return singleTermSet(tq.FieldVal, longestToken(tq.Terms)), true
+
+	case *query.ConjunctionQuery:
+		return extractRequiredTerms(m, tq.Conjuncts)
+
+	case *query.DisjunctionQuery:
+		return extractAnyTerms(m, tq.Disjuncts)
+
+	case *DisMaxQuery:
+		return extractAnyTerms(m, tq.Disjuncts)
+
+	case *query.TermsSetQuery:
+		// 文档至少包含其中一个词项
+		return extractAnyTerms(m, tq.Terms())
+
+	case *query.BooleanQuery:
+		// must/filter 为必要条件，任选其一即可；否则 should 至少匹配一个
+		var required []query.Query
+		if tq.Must != nil {
+			required = append(required, tq.Must)
+		}
+		if tq.Filter != nil {
+			required = append(required, tq.Filter)
+		}
+		if len(required) > 0 {
+			return extractRequiredTerms(m, required)
+		}
+		if tq.Should != nil {
+			return extractQueryTerms(m, tq.Should)
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// extractRequiredTerms 多个必要条件：选择可提取且词项最少的子查询
+func extractRequiredTerms(m mapping.IndexMapping, queries []query.Query) (map[string]struct{}, bool) {
+	var best map[string]struct{}
+	for _, child := range queries {
+		set, ok := extractQueryTerms(m, child)
+		if !ok {
+			continue
+		}
+		if best == nil || len(set) < len(best) {
+			best = set
+		}
+	}
+	return best, best != nil
+}
+
+// extractAnyTerms 任一条件匹配即可：所有子查询都必须可提取，结果取并集
+func extractAnyTerms(m mapping.IndexMapping, queries []query.Query) (map[string]struct{}, bool) {
+	if len(queries) == 0 {
+		return nil, false
+	}
+	union := make(map[string]struct{})
+	for _, child := range queries {
+		set, ok := extractQueryTerms(m, child)
+		if !ok {
+			return nil, false
+		}
+		for t := range set {
+			union[t] = struct{}{}
+		}
+	}
+	return union, true
+}
+
+func singleTermSet(field, term string) map[string]struct{} {
+	return map[string]struct{}{percolatorTermKey(field, term): {}}
+}
+
+func longestToken(tokens []string) string {
+	longest := tokens[0]
+	for _, t := range tokens[1:] {
+		if len(t) > len(longest) {
+			longest = t
+		}
+	}
+	return longest
+}
+
+// analyzeFieldText 使用字段的分析器切分文本（与查询执行时一致）
+func analyzeFieldText(m mapping.IndexMapping, field, analyzerName, text string) []string {
+	if m == nil {
+		return nil
+	}
+	if analyzerName == "" {
+		analyzerName = m.AnalyzerNameForPath(field)
+	}
+	analyzer := m.AnalyzerNamed(analyzerName)
+	if analyzer == nil {
+		return nil
+	}
+	tokenStream := analyzer.Analyze([]byte(text))
+	tokens := make([]string, 0, len(tokenStream))
+	for _, token := range tokenStream {
+		tokens = append(tokens, string(token.Term))
+	}
+	return tokens
+}
+
+// DocumentPercolatorTerms 提取待匹配文档的词项（字段值原文以及分析后的词项）
+func DocumentPercolatorTerms(m mapping.IndexMapping, doc map[string]interface{}) []string {
+	set := make(map[string]struct{})
+	collectDocumentTerms(m, "", doc, set)
+	terms := make([]string, 0, len(set))
+	for t := range set {
+		terms = append(terms, t)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+func collectDocumentTerms(m mapping.IndexMapping, path string, value interface{}, set map[string]struct{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			collectDocumentTerms(m, childPath, child, set)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectDocumentTerms(m, path, item, set)
+		}
+	case string:
+		set[percolatorTermKey(path, v)] = struct{}{}
+		for _, token := range analyzeFieldText(m, path, "", v) {
+			set[percolatorTermKey(path, token)] = struct{}{}
+		}
+	case nil:
+	default:
+		set[percolatorTermKey(path, fmt.Sprintf("%v", v))] = struct{}{}
+	}
+}
+
+// NewPercolatorCandidateQuery 构建候选查询：包含文档词项之一，或词项提取不完整的存储查询
+func NewPercolatorCandidateQuery(docTerms []string) query.Query {
+	incomplete := query.NewBooleanQuery(nil, nil, []query.Query{newFieldTermQuery(PercolatorExtractionField, PercolatorExtractionComplete)})
+	should := make([]query.Query, 0, len(docTerms)+1)
+	should = append(should, incomplete)
+	for _, t := range docTerms {
+		should = append(should, newFieldTermQuery(PercolatorTermsField, t))
+	}
+	bq := query.NewBooleanQuery(nil, should, nil)
+	bq.Filter = newFieldTermQuery(PercolatorFlagField, "true")
+	return bq
+}
+
+func newFieldTermQuery(field, term string) *query.TermQuery {
+	tq := query.NewTermQuery(term)
+	tq.SetField(field)
+	return tq
+}
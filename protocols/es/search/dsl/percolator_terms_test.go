@@ -0,0 +1,87 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/mapping"
+)
+
+func TestExtractPercolatorTerms(t *testing.T) {
+	m := mapping.NewIndexMapping()
+	tests := []struct {
+		name         string
+		query        map[string]interface{}
+		wantTerms    []string
+		wantComplete bool
+	}{
+		{
+			name:         "match or",
+			query:        map[string]interface{}{"match": map[string]interface{}{"title": "Quick Fox"}},
+			wantTerms:    []string{"title:fox", "title:quick"},
+			wantComplete: true,
+		},
+		{
+			name:         "term",
+			query:        map[string]interface{}{"term": map[string]interface{}{"status": "active"}},
+			wantTerms:    []string{"status:active"},
+			wantComplete: true,
+		},
+		{
+			name: "bool must picks smallest clause",
+			query: map[string]interface{}{"bool": map[string]interface{}{
+				"must": []interface{}{
+					map[string]interface{}{"match": map[string]interface{}{"title": "quick brown fox"}},
+					map[string]interface{}{"term": map[string]interface{}{"status": "active"}},
+				},
+			}},
+			wantTerms:    []string{"status:active"},
+			wantComplete: true,
+		},
+		{
+			name: "should with unextractable clause",
+			query: map[string]interface{}{"bool": map[string]interface{}{
+				"should": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"status": "active"}},
+					map[string]interface{}{"match_all": map[string]interface{}{}},
+				},
+			}},
+			wantComplete: false,
+		},
+		{
+			name:         "match_all",
+			query:        map[string]interface{}{"match_all": map[string]interface{}{}},
+			wantComplete: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewQueryParser().ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery failed: %v", err)
+			}
+			terms, complete := ExtractPercolatorTerms(m, q)
+			if complete != tt.wantComplete {
+				t.Fatalf("expected complete=%v, got %v (terms %v)", tt.wantComplete, complete, terms)
+			}
+			if tt.wantComplete && !reflect.DeepEqual(terms, tt.wantTerms) {
+				t.Errorf("expected terms %v, got %v", tt.wantTerms, terms)
+			}
+		})
+	}
+}
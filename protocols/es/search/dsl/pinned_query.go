@@ -0,0 +1,114 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// maxPinnedHits pinned 查询最多可以指定的文档数（与 ES 相同）
+const maxPinnedHits = 100
+
+// maxOrganicScore 置顶文档的得分下限，与 ES 相同取 float 最大值的一半，正常查询的得分远小于该值
+const maxOrganicScore = math.MaxFloat32 / 2
+
+// parsePinned 解析pinned查询
+// ES格式: {"pinned": {"ids": [...], "organic": {...}}} 或 {"pinned": {"docs": [{"_index": ..., "_id": ...}], "organic": {...}}}
+// 指定的文档按给出的顺序排在最前面（无论是否匹配 organic 查询），其余结果按 organic 查询的得分排序
+func (p *QueryParser) parsePinned(body interface{}) (query.Query, error) {
+	pinnedMap, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("pinned query must be an object")
+	}
+	for key := range pinnedMap {
+		switch key {
+		case "ids", "docs", "organic", "boost", "_name":
+		default:
+			return nil, fmt.Errorf("[pinned] query does not support [%s]", key)
+		}
+	}
+
+	_, hasIDs := pinnedMap["ids"]
+	_, hasDocs := pinnedMap["docs"]
+	if hasIDs && hasDocs {
+		return nil, fmt.Errorf("[pinned] Cannot specify both [ids] and [docs]")
+	}
+
+	// 解析置顶文档ID，保持给出的顺序
+	var pinnedIDs []string
+	if hasIDs {
+		ids, ok := pinnedMap["ids"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[pinned] [ids] must be an array")
+		}
+		for _, id := range ids {
+			idStr, ok := id.(string)
+			if !ok || idStr == "" {
+				return nil, fmt.Errorf("[pinned] Cannot have null or empty ids")
+			}
+			pinnedIDs = append(pinnedIDs, idStr)
+		}
+	}
+	if hasDocs {
+		// 每个索引单独执行查询，_index 不区分索引，所有被搜索的索引中该ID的文档都会置顶
+		docs, ok := pinnedMap["docs"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[pinned] [docs] must be an array")
+		}
+		for _, doc := range docs {
+			docMap, _ := doc.(map[string]interface{})
+			idStr, _ := docMap["_id"].(string)
+			if idStr == "" {
+				return nil, fmt.Errorf("[pinned] docs must have a non-empty [_id]")
+			}
+			pinnedIDs = append(pinnedIDs, idStr)
+		}
+	}
+	if len(pinnedIDs) > maxPinnedHits {
+		return nil, fmt.Errorf("[pinned] Max of %d ids exceeded: %d provided.", maxPinnedHits, len(pinnedIDs))
+	}
+
+	// 解析organic查询
+	var organicQuery query.Query
+	if organicVal, ok := pinnedMap["organic"].(map[string]interface{}); ok {
+		var err error
+		organicQuery, err = p.ParseQuery(organicVal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pinned organic query: %w", err)
+		}
+	} else {
+		organicQuery = query.NewMatchAllQuery()
+	}
+	if len(pinnedIDs) == 0 {
+		return organicQuery, nil
+	}
+
+	// 置顶文档的得分在 (maxOrganicScore, 2*maxOrganicScore] 内按顺序递减，
+	// 与 organic 查询取 dis_max，同时匹配 organic 查询的置顶文档仍取置顶得分
+	scores := make(map[string]float64, len(pinnedIDs))
+	for i, id := range pinnedIDs {
+		if _, ok := scores[id]; !ok {
+			scores[id] = maxOrganicScore * (2 - float64(i)/float64(len(pinnedIDs)))
+		}
+	}
+	pinned := NewDisMaxQuery([]query.Query{organicQuery, NewScoredDocIDQuery(scores)}, 0)
+	if boost, ok := pinnedMap["boost"].(float64); ok {
+		pinned.SetBoost(boost)
+	}
+	return pinned, nil
+}
@@ -79,9 +79,11 @@ func (o *QueryOptimizer) optimizeBooleanQuery(bq *query.BooleanQuery) (query.Que
 		}
 	}
 
+	var minShould float64
 	if bq.Should != nil {
 		if disj, ok := bq.Should.(*query.DisjunctionQuery); ok {
 			shouldQueries = disj.Disjuncts
+			minShould = disj.Min
 		} else {
 			shouldQueries = []query.Query{bq.Should}
 		}
@@ -110,7 +112,10 @@ func (o *QueryOptimizer) optimizeBooleanQuery(bq *query.BooleanQuery) (query.Que
 	optimizedShould := o.optimizeShouldOrder(shouldQueries)
 
 	// 优化3: 合并相同字段的term查询为terms查询（在should中）
-	optimizedShould = o.mergeTermQueries(optimizedShould)
+	// minimum_should_match 大于 1 时按子句计数，不能合并
+	if minShould <= 1 {
+		optimizedShould = o.mergeTermQueries(optimizedShould)
+	}
 
 	// 如果优化后没有must，但有should，且should只有一个，可以简化为should
 	// 但这是语义改变，不进行此优化
@@ -162,7 +167,11 @@ func (o *QueryOptimizer) optimizeBooleanQuery(bq *query.BooleanQuery) (query.Que
 		return bq, nil
 	}
 
-	return query.NewBooleanQuery(finalMustQueries, finalShouldQueries, finalMustNotQueries), nil
+	rv := query.NewBooleanQuery(finalMustQueries, finalShouldQueries, finalMustNotQueries)
+	if minShould > 0 && len(finalShouldQueries) > 0 {
+		rv.SetMinShould(minShould)
+	}
+	return rv, nil
 }
 
 // optimizeShouldOrder 优化should子句的顺序
@@ -62,6 +62,7 @@ func (r *QueryParserRegistry) RegisterDefaultStrategies() {
 	r.Register(&MatchPhrasePrefixStrategy{})
 	r.Register(&TermStrategy{})
 	r.Register(&TermsStrategy{})
+	r.Register(&TermsSetStrategy{})
 	r.Register(&RangeStrategy{})
 	r.Register(&WildcardStrategy{})
 	r.Register(&PrefixStrategy{})
@@ -75,6 +76,7 @@ func (r *QueryParserRegistry) RegisterDefaultStrategies() {
 	r.Register(&BoolStrategy{})
 	r.Register(&ConstantScoreStrategy{})
 	r.Register(&DisMaxStrategy{})
+	r.Register(&BoostingStrategy{})
 
 	// 全文查询类型
 	r.Register(&MultiMatchStrategy{})
@@ -91,6 +93,7 @@ func (r *QueryParserRegistry) RegisterDefaultStrategies() {
 	r.Register(&GeoDistanceStrategy{})
 	r.Register(&GeoPolygonStrategy{})
 	r.Register(&GeoShapeStrategy{})
+	r.Register(&DistanceFeatureStrategy{})
 
 	// 脚本查询类型
 	r.Register(&ScriptStrategy{})
@@ -101,7 +104,9 @@ func (r *QueryParserRegistry) RegisterDefaultStrategies() {
 	r.Register(&IdsStrategy{})
 	r.Register(&PinnedStrategy{})
 	r.Register(&WrapperStrategy{})
+	r.Register(&RawBleveStrategy{})
 	r.Register(&PercolateStrategy{})
+	r.Register(&SparseVectorStrategy{})
 
 	// Span查询类型
 	r.Register(&SpanTermStrategy{})
@@ -190,6 +195,16 @@ func (s *TermsStrategy) Parse(body interface{}) (query.Query, error) {
 	return s.parser.parseTerms(body)
 }
 
+// TermsSetStrategy terms_set查询策略
+type TermsSetStrategy struct {
+	BaseStrategy
+}
+
+func (s *TermsSetStrategy) QueryType() string { return "terms_set" }
+func (s *TermsSetStrategy) Parse(body interface{}) (query.Query, error) {
+	return s.parser.parseTermsSet(body)
+}
+
 // RangeStrategy range查询策略
 type RangeStrategy struct {
 	BaseStrategy
@@ -300,6 +315,16 @@ func (s *DisMaxStrategy) Parse(body interface{}) (query.Query, error) {
 	return s.parser.parseDisMax(body)
 }
 
+// BoostingStrategy boosting查询策略
+type BoostingStrategy struct {
+	BaseStrategy
+}
+
+func (s *BoostingStrategy) QueryType() string { return "boosting" }
+func (s *BoostingStrategy) Parse(body interface{}) (query.Query, error) {
+	return s.parser.parseBoosting(body)
+}
+
 // MultiMatchStrategy multi_match查询策略
 type MultiMatchStrategy struct {
 	BaseStrategy
@@ -400,6 +425,16 @@ func (s *GeoShapeStrategy) Parse(body interface{}) (query.Query, error) {
 	return s.parser.parseGeoShape(body)
 }
 
+// DistanceFeatureStrategy distance_feature查询策略
+type DistanceFeatureStrategy struct {
+	BaseStrategy
+}
+
+func (s *DistanceFeatureStrategy) QueryType() string { return "distance_feature" }
+func (s *DistanceFeatureStrategy) Parse(body interface{}) (query.Query, error) {
+	return s.parser.parseDistanceFeature(body)
+}
+
 // ScriptStrategy script查询策略
 type ScriptStrategy struct {
 	BaseStrategy
@@ -460,6 +495,16 @@ func (s *WrapperStrategy) Parse(body interface{}) (query.Query, error) {
 	return s.parser.parseWrapper(body)
 }
 
+// RawBleveStrategy x_bleve查询策略（TigerDB扩展，原样解析 bleve 查询 JSON）
+type RawBleveStrategy struct {
+	BaseStrategy
+}
+
+func (s *RawBleveStrategy) QueryType() string { return "x_bleve" }
+func (s *RawBleveStrategy) Parse(body interface{}) (query.Query, error) {
+	return s.parser.parseRawBleve(body)
+}
+
 // PercolateStrategy percolate查询策略
 type PercolateStrategy struct {
 	BaseStrategy
@@ -470,6 +515,16 @@ func (s *PercolateStrategy) Parse(body interface{}) (query.Query, error) {
 	return s.parser.parsePercolate(body)
 }
 
+// SparseVectorStrategy sparse_vector查询策略
+type SparseVectorStrategy struct {
+	BaseStrategy
+}
+
+func (s *SparseVectorStrategy) QueryType() string { return "sparse_vector" }
+func (s *SparseVectorStrategy) Parse(body interface{}) (query.Query, error) {
+	return s.parser.parseSparseVector(body)
+}
+
 // SpanTermStrategy span_term查询策略
 type SpanTermStrategy struct {
 	BaseStrategy
@@ -0,0 +1,341 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	vellumregexp "github.com/blevesearch/vellum/regexp"
+)
+
+// regexp 查询使用 Lucene 正则语法：模式匹配整个词项，^ $ 等字符没有特殊含义，
+// flags 控制 @ # <n-m> & ~ 是否作为运算符。解析时将模式转换为 Go 正则语法，
+// 并预先构建确定化自动机，模式过长或状态过多时直接返回错误，避免执行阶段耗尽资源。
+
+// Lucene 正则的可选运算符（regexp 查询的 flags 参数）
+const (
+	RegexpFlagIntersection = 1 << iota // &
+	RegexpFlagComplement               // ~
+	RegexpFlagEmpty                    // #
+	RegexpFlagAnyString                // @
+	RegexpFlagInterval                 // <n-m>
+
+	RegexpFlagNone = 0
+	RegexpFlagAll  = RegexpFlagIntersection | RegexpFlagComplement | RegexpFlagEmpty | RegexpFlagAnyString | RegexpFlagInterval
+)
+
+const (
+	// DefaultMaxRegexLength index.max_regex_length 的默认值
+	DefaultMaxRegexLength = 1000
+	// DefaultMaxDeterminizedStates max_determinized_states 的默认值（也是底层自动机的上限）
+	DefaultMaxDeterminizedStates = vellumregexp.StateLimit
+)
+
+var regexpFlagNames = map[string]int{
+	"INTERSECTION": RegexpFlagIntersection,
+	"COMPLEMENT":   RegexpFlagComplement,
+	"EMPTY":        RegexpFlagEmpty,
+	"ANYSTRING":    RegexpFlagAnyString,
+	"INTERVAL":     RegexpFlagInterval,
+	"NONE":         RegexpFlagNone,
+	"ALL":          RegexpFlagAll,
+}
+
+// SetMaxRegexLength 设置 regexp 查询模式的最大长度（index.max_regex_length），0 表示使用默认值
+func (p *QueryParser) SetMaxRegexLength(n int) {
+	p.maxRegexLength = n
+}
+
+// parseRegexpFlags 解析 "INTERVAL|ANYSTRING" 形式的 flags，为空时启用全部运算符
+func parseRegexpFlags(s string) (int, error) {
+	if strings.TrimSpace(s) == "" {
+		return RegexpFlagAll, nil
+	}
+	flags := RegexpFlagNone
+	for _, name := range strings.Split(s, "|") {
+		flag, ok := regexpFlagNames[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return 0, fmt.Errorf("Unknown regexp flag [%s]", name)
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+// compileRegexp 将 Lucene 正则转换为 Go 正则并检查复杂度
+func (p *QueryParser) compileRegexp(pattern string, flags int, caseInsensitive bool, maxStates int) (string, error) {
+	maxLength := p.maxRegexLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxRegexLength
+	}
+	if n := len([]rune(pattern)); n > maxLength {
+		return "", fmt.Errorf("The length of regex [%d] used in the Regexp Query request has exceeded the allowed maximum of [%d]. "+
+			"This maximum can be set by changing the [index.max_regex_length] index level setting.", n, maxLength)
+	}
+
+	translated, err := translateRegexp(pattern, flags)
+	if err != nil {
+		return "", fmt.Errorf("[regexp] failed to parse regexp [%s]: %v", pattern, err)
+	}
+	prefix := "(?s)"
+	if caseInsensitive {
+		prefix = "(?is)"
+	}
+	translated = prefix + translated
+
+	if maxStates <= 0 || maxStates > DefaultMaxDeterminizedStates {
+		maxStates = DefaultMaxDeterminizedStates
+	}
+	re, err := vellumregexp.New(translated)
+	if errors.Is(err, vellumregexp.ErrTooManyStates) || (err == nil && regexpStateCount(re, maxStates) > maxStates) {
+		return "", fmt.Errorf("Determinizing automaton for regexp [%s] would result in more than %d states.", pattern, maxStates)
+	}
+	if err != nil {
+		return "", fmt.Errorf("[regexp] failed to parse regexp [%s]: %v", pattern, err)
+	}
+	return translated, nil
+}
+
+// regexpStateCount 统计确定化自动机中可达的状态数，超过 limit 后停止
+func regexpStateCount(re *vellumregexp.Regexp, limit int) int {
+	seen := map[int]struct{}{re.Start(): {}}
+	stack := []int{re.Start()}
+	for len(stack) > 0 && len(seen) <= limit {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for b := 0; b < 256; b++ {
+			next := re.Accept(s, byte(b))
+			if next == 0 {
+				continue
+			}
+			if _, ok := seen[next]; !ok {
+				seen[next] = struct{}{}
+				stack = append(stack, next)
+			}
+		}
+	}
+	return len(seen)
+}
+
+// translateRegexp 将 Lucene 正则语法转换为等价的 Go 正则语法
+func translateRegexp(pattern string, flags int) (string, error) {
+	runes := []rune(pattern)
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(runes) {
+				return "", fmt.Errorf("expected escaped character at position %d", i+1)
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case c == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return "", fmt.Errorf("expected '\"' at position %d", len(runes))
+			}
+			b.WriteString("(?:" + regexp.QuoteMeta(string(runes[i+1:end])) + ")")
+			i = end
+		case c == '[':
+			class, end, err := translateRegexpClass(runes, i)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(class)
+			i = end
+		case c == '@' && flags&RegexpFlagAnyString != 0:
+			b.WriteString("(?:.*)")
+		case c == '#' && flags&RegexpFlagEmpty != 0:
+			// 空语言，不匹配任何字符串
+			b.WriteString(`[^\x00-\x{10FFFF}]`)
+		case c == '<' && flags&RegexpFlagInterval != 0:
+			end := i + 1
+			for end < len(runes) && runes[end] != '>' {
+				end++
+			}
+			if end >= len(runes) {
+				return "", fmt.Errorf("expected '>' at position %d", len(runes))
+			}
+			interval, err := translateRegexpInterval(string(runes[i+1 : end]))
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(interval)
+			i = end
+		case c == '&' && flags&RegexpFlagIntersection != 0:
+			return "", fmt.Errorf("the intersection operator [&] is not supported, disable it with the [flags] parameter")
+		case c == '~' && flags&RegexpFlagComplement != 0:
+			return "", fmt.Errorf("the complement operator [~] is not supported, disable it with the [flags] parameter")
+		case strings.ContainsRune(".?+*|{}()", c):
+			b.WriteRune(c)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// translateRegexpClass 转换从 start 开始的字符类，返回结束位置（']' 的下标）
+func translateRegexpClass(runes []rune, start int) (string, int, error) {
+	var b strings.Builder
+	b.WriteByte('[')
+	i := start + 1
+	if i < len(runes) && runes[i] == '^' {
+		b.WriteByte('^')
+		i++
+	}
+	empty := true
+	for ; i < len(runes); i++ {
+		c := runes[i]
+		switch c {
+		case ']':
+			if empty {
+				return "", 0, fmt.Errorf("empty character class at position %d", i)
+			}
+			b.WriteByte(']')
+			return b.String(), i, nil
+		case '\\':
+			if i+1 >= len(runes) {
+				return "", 0, fmt.Errorf("expected escaped character at position %d", i+1)
+			}
+			i++
+			c = runes[i]
+		case '-':
+			// 区间运算符（不在开头或结尾时）
+			if !empty && i+1 < len(runes) && runes[i+1] != ']' {
+				b.WriteByte('-')
+				continue
+			}
+		}
+		empty = false
+		if c < 0x80 && !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return "", 0, fmt.Errorf("expected ']' at position %d", len(runes))
+}
+
+// translateRegexpInterval 转换 <n-m> 数值区间：两端位数相同时按该位数匹配（含前导零），否则允许任意前导零
+func translateRegexpInterval(spec string) (string, error) {
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("expected '-' in interval <%s>", spec)
+	}
+	min, err1 := strconv.ParseUint(parts[0], 10, 32)
+	max, err2 := strconv.ParseUint(parts[1], 10, 32)
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("interval syntax error in <%s>", spec)
+	}
+	if min > max {
+		min, max = max, min
+	}
+	width := 0
+	if len(parts[0]) == len(parts[1]) {
+		width = len(parts[0])
+	}
+
+	var alternatives []string
+	for _, r := range splitNumericRange(min, max) {
+		digits := numericRangePattern(r[0], r[1])
+		if width > 0 {
+			digits = strings.Repeat("0", width-len(strconv.FormatUint(r[1], 10))) + digits
+		}
+		alternatives = append(alternatives, digits)
+	}
+	if width > 0 {
+		return "(?:" + strings.Join(alternatives, "|") + ")", nil
+	}
+	return "(?:0*(?:" + strings.Join(alternatives, "|") + "))", nil
+}
+
+// splitNumericRange 将 [min, max] 拆分为若干子区间，每个子区间两端位数相同，且可用逐位字符类表示
+func splitNumericRange(min, max uint64) [][2]uint64 {
+	stops := map[uint64]struct{}{max: {}}
+	for nines := 1; ; nines++ {
+		stop := fillNines(min, nines)
+		if stop < min || stop >= max {
+			break
+		}
+		stops[stop] = struct{}{}
+	}
+	for zeros := 1; ; zeros++ {
+		stop := fillZeros(max+1, zeros)
+		if stop == 0 || stop-1 <= min || stop-1 > max {
+			break
+		}
+		stops[stop-1] = struct{}{}
+	}
+
+	sorted := make([]uint64, 0, len(stops))
+	for stop := range stops {
+		sorted = append(sorted, stop)
+	}
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+
+	ranges := make([][2]uint64, 0, len(sorted))
+	start := min
+	for _, stop := range sorted {
+		ranges = append(ranges, [2]uint64{start, stop})
+		start = stop + 1
+	}
+	return ranges
+}
+
+// fillNines 将 n 的最低 count 位替换为 9
+func fillNines(n uint64, count int) uint64 {
+	s := strconv.FormatUint(n, 10)
+	prefix := ""
+	if count < len(s) {
+		prefix = s[:len(s)-count]
+	}
+	v, _ := strconv.ParseUint(prefix+strings.Repeat("9", count), 10, 64)
+	return v
+}
+
+// fillZeros 将 n 的最低 count 位替换为 0
+func fillZeros(n uint64, count int) uint64 {
+	p := uint64(1)
+	for k := 0; k < count; k++ {
+		p *= 10
+	}
+	return n - n%p
+}
+
+// numericRangePattern 生成匹配 [start, stop] 的逐位模式（两端位数相同）
+func numericRangePattern(start, stop uint64) string {
+	a, b := strconv.FormatUint(start, 10), strconv.FormatUint(stop, 10)
+	var sb strings.Builder
+	for k := 0; k < len(a); k++ {
+		switch {
+		case a[k] == b[k]:
+			sb.WriteByte(a[k])
+		case a[k] == '0' && b[k] == '9':
+			sb.WriteString("[0-9]")
+		default:
+			sb.WriteString("[" + string(a[k]) + "-" + string(b[k]) + "]")
+		}
+	}
+	return sb.String()
+}
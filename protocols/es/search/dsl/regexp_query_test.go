@@ -0,0 +1,124 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTranslateRegexp(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		flags    int
+		match    []string
+		nonMatch []string
+	}{
+		{pattern: "ki.*y", flags: RegexpFlagAll, match: []string{"kimchy", "kiy"}, nonMatch: []string{"kimch"}},
+		// Lucene 正则匹配整个词项，^ $ 是普通字符
+		{pattern: "^ab$", flags: RegexpFlagAll, match: []string{"^ab$"}, nonMatch: []string{"ab"}},
+		{pattern: `a\.b`, flags: RegexpFlagAll, match: []string{"a.b"}, nonMatch: []string{"axb"}},
+		{pattern: `"a.b"c`, flags: RegexpFlagAll, match: []string{"a.bc"}, nonMatch: []string{"axbc"}},
+		{pattern: "[a-c]+[^0-9]", flags: RegexpFlagAll, match: []string{"abcx"}, nonMatch: []string{"abc1", "d"}},
+		{pattern: `[\]-]x`, flags: RegexpFlagAll, match: []string{"]x", "-x"}, nonMatch: []string{"ax"}},
+		{pattern: "a{2,3}", flags: RegexpFlagAll, match: []string{"aa", "aaa"}, nonMatch: []string{"a", "aaaa"}},
+		{pattern: "@ing", flags: RegexpFlagAll, match: []string{"ing", "testing"}, nonMatch: []string{"tested"}},
+		{pattern: "@ing", flags: RegexpFlagNone, match: []string{"@ing"}, nonMatch: []string{"testing"}},
+		{pattern: "ab#", flags: RegexpFlagAll, nonMatch: []string{"ab", "ab#"}},
+		{pattern: "ab#", flags: RegexpFlagInterval, match: []string{"ab#"}},
+		{pattern: "foo<1-100>", flags: RegexpFlagAll, match: []string{"foo1", "foo42", "foo100", "foo007"}, nonMatch: []string{"foo0", "foo101"}},
+		{pattern: "<01-10>", flags: RegexpFlagAll, match: []string{"01", "09", "10"}, nonMatch: []string{"1", "00", "11", "010"}},
+		{pattern: "<1-10>", flags: RegexpFlagAnyString, match: []string{"<1-10>"}, nonMatch: []string{"5"}},
+		{pattern: "a&b", flags: RegexpFlagNone, match: []string{"a&b"}},
+		{pattern: "a~b", flags: RegexpFlagEmpty, match: []string{"a~b"}},
+	}
+	for _, tt := range tests {
+		translated, err := translateRegexp(tt.pattern, tt.flags)
+		if err != nil {
+			t.Errorf("%s: %v", tt.pattern, err)
+			continue
+		}
+		re := regexp.MustCompile("^(?s:" + translated + ")$")
+		for _, s := range tt.match {
+			if !re.MatchString(s) {
+				t.Errorf("%s (%s): expected to match %q", tt.pattern, translated, s)
+			}
+		}
+		for _, s := range tt.nonMatch {
+			if re.MatchString(s) {
+				t.Errorf("%s (%s): expected not to match %q", tt.pattern, translated, s)
+			}
+		}
+	}
+
+	// 数值区间与逐个数字的匹配结果一致
+	for _, r := range [][2]int{{0, 0}, {0, 9}, {1, 255}, {5, 1000}, {37, 4210}, {100, 199}, {998, 1002}} {
+		re := regexp.MustCompile("^(?:" + mustTranslate(t, fmt.Sprintf("<%d-%d>", r[0], r[1])) + ")$")
+		for n := 0; n <= 5000; n++ {
+			if got, want := re.MatchString(fmt.Sprint(n)), n >= r[0] && n <= r[1]; got != want {
+				t.Errorf("<%d-%d>: %d matched %v", r[0], r[1], n, got)
+			}
+		}
+	}
+
+	for _, pattern := range []string{"a&b", "~a", `ab\`, `"ab`, "[ab", "[]", "<1-", "<a-b>"} {
+		if _, err := translateRegexp(pattern, RegexpFlagAll); err == nil {
+			t.Errorf("%s: expected an error", pattern)
+		}
+	}
+}
+
+func mustTranslate(t *testing.T, pattern string) string {
+	t.Helper()
+	translated, err := translateRegexp(pattern, RegexpFlagAll)
+	if err != nil {
+		t.Fatalf("%s: %v", pattern, err)
+	}
+	return translated
+}
+
+func TestCompileRegexp(t *testing.T) {
+	p := NewQueryParser()
+	if _, err := p.compileRegexp(strings.Repeat("a", DefaultMaxRegexLength+1), RegexpFlagAll, false, 0); err == nil ||
+		!strings.Contains(err.Error(), "index.max_regex_length") {
+		t.Errorf("expected regex length error, got %v", err)
+	}
+	p.SetMaxRegexLength(5)
+	if _, err := p.compileRegexp("abcdef", RegexpFlagAll, false, 0); err == nil {
+		t.Errorf("expected regex length error with a custom limit")
+	}
+
+	p = NewQueryParser()
+	// 每个 [ab]{n} 之前的 .* 使确定化后的状态数随 n 指数增长
+	if _, err := p.compileRegexp("@a[ab]{20}", RegexpFlagAll, false, 0); err == nil ||
+		!strings.Contains(err.Error(), "Determinizing automaton") {
+		t.Errorf("expected too many states error, got %v", err)
+	}
+	if _, err := p.compileRegexp("@a[ab]{5}", RegexpFlagAll, false, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := p.compileRegexp("@a[ab]{5}", RegexpFlagAll, false, 10); err == nil {
+		t.Errorf("expected max_determinized_states to be enforced")
+	}
+
+	if _, err := parseRegexpFlags("INTERVAL|bogus"); err == nil || !strings.Contains(err.Error(), "Unknown regexp flag [bogus]") {
+		t.Errorf("expected unknown flag error, got %v", err)
+	}
+	if flags, err := parseRegexpFlags("interval|ANYSTRING"); err != nil || flags != RegexpFlagInterval|RegexpFlagAnyString {
+		t.Errorf("unexpected flags %d: %v", flags, err)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"fmt"
+
+	"github.com/lscgzwd/tiggerdb/script"
+	"github.com/lscgzwd/tiggerdb/search/query"
+)
+
+// parseTermsSet 解析terms_set查询
+// ES格式: {"terms_set": {"tags": {"terms": ["go", "rust"], "minimum_should_match_field": "required_matches"}}}
+// 最少匹配数由 minimum_should_match_field、minimum_should_match_script 或 minimum_should_match 指定（三选一）
+func (p *QueryParser) parseTermsSet(body interface{}) (query.Query, error) {
+	termsSetMap, ok := body.(map[string]interface{})
+	if !ok || len(termsSetMap) != 1 {
+		return nil, fmt.Errorf("[terms_set] query must contain exactly one field")
+	}
+
+	for field, value := range termsSetMap {
+		field = p.normalizeFieldName(field)
+		if err := p.checkFieldMapped(field); err != nil {
+			return nil, err
+		}
+		options, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[terms_set] query malformed, no start_object after field name")
+		}
+		for key := range options {
+			switch key {
+			case "terms", "minimum_should_match_field", "minimum_should_match_script", "minimum_should_match", "boost", "_name":
+			default:
+				return nil, fmt.Errorf("[terms_set] query does not support [%s]", key)
+			}
+		}
+
+		values, ok := options["terms"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[terms_set] query requires an array of [terms]")
+		}
+		terms := make([]query.Query, 0, len(values))
+		seen := make(map[string]bool, len(values))
+		for _, v := range values {
+			term, err := termString(v)
+			if err != nil {
+				return nil, fmt.Errorf("[terms_set] %v", err)
+			}
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			termQuery, err := p.typedTermQuery(field, v)
+			if err != nil {
+				return nil, err
+			}
+			if termQuery == nil {
+				tq := query.NewTermQuery(term)
+				tq.SetField(field)
+				termQuery = tq
+			}
+			terms = append(terms, termQuery)
+		}
+
+		q := query.NewTermsSetQuery(field, terms)
+		specified := 0
+		if v, ok := options["minimum_should_match_field"]; ok {
+			minField, ok := v.(string)
+			if !ok || minField == "" {
+				return nil, fmt.Errorf("[terms_set] minimum_should_match_field must be a field name")
+			}
+			q.SetMinimumShouldMatchField(p.normalizeFieldName(minField))
+			specified++
+		}
+		if v, ok := options["minimum_should_match_script"]; ok {
+			if err := p.checkScriptAllowed("terms_set"); err != nil {
+				return nil, err
+			}
+			s, err := script.ParseScript(v)
+			if err != nil {
+				return nil, fmt.Errorf("[terms_set] failed to parse minimum_should_match_script: %w", err)
+			}
+			q.SetMinimumShouldMatchScript(s)
+			specified++
+		}
+		if v, ok := options["minimum_should_match"]; ok {
+			required, err := minimumShouldMatch(v, len(terms))
+			if err != nil {
+				return nil, fmt.Errorf("[terms_set] %v", err)
+			}
+			q.SetMinimumShouldMatch(required)
+			specified++
+		}
+		switch specified {
+		case 0:
+			return nil, fmt.Errorf("[terms_set] no minimum should match has been specified")
+		case 1:
+		default:
+			return nil, fmt.Errorf("[terms_set] only one of [minimum_should_match_field], [minimum_should_match_script] and [minimum_should_match] may be specified")
+		}
+
+		if boost, ok := options["boost"].(float64); ok {
+			q.SetBoost(boost)
+		}
+		if len(terms) == 0 {
+			return query.NewMatchNoneQuery(), nil
+		}
+		return q, nil
+	}
+	return nil, fmt.Errorf("[terms_set] query must contain exactly one field")
+}
@@ -20,10 +20,16 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/lscgzwd/tiggerdb/audit"
 	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/logger"
 	"github.com/lscgzwd/tiggerdb/metadata"
 	"github.com/lscgzwd/tiggerdb/protocols"
 	"github.com/lscgzwd/tiggerdb/protocols/es/handler"
@@ -31,21 +37,36 @@ import (
 	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
 	esIndex "github.com/lscgzwd/tiggerdb/protocols/es/index"
 	"github.com/lscgzwd/tiggerdb/protocols/es/middleware"
+	"github.com/lscgzwd/tiggerdb/rerank"
+	"github.com/lscgzwd/tiggerdb/script"
 )
 
 // ESServer Elasticsearch协议服务器
 type ESServer struct {
-	config          *Config
-	httpServer      *server.Server
-	indexHandler    *handler.IndexHandler
-	documentHandler *handler.DocumentHandler
-	clusterHandler  *handler.ClusterHandler
-	statsHandler    *handler.StatsHandler
-	indexMgr        *esIndex.IndexManager
-	dirMgr          directory.DirectoryManager
-	metaStore       metadata.MetadataStore
-	started         bool
-	mu              sync.RWMutex
+	config           *Config
+	httpServer       *server.Server
+	indexHandler     *handler.IndexHandler
+	documentHandler  *handler.DocumentHandler
+	clusterHandler   *handler.ClusterHandler
+	statsHandler     *handler.StatsHandler
+	scriptHandler    *handler.ScriptHandler
+	rollupHandler    *handler.RollupHandler
+	watcherHandler   *handler.WatcherHandler
+	transformHandler *handler.TransformHandler
+	apiKeyHandler    *handler.APIKeyHandler
+	diskMonitor      *handler.DiskWatermarkMonitor
+	indexMgr         *esIndex.IndexManager
+	dirMgr           directory.DirectoryManager
+	metaStore        metadata.MetadataStore
+	auditLog         *audit.Logger // 审计日志，未启用时为 nil
+	logLevel         string        // 配置文件中的日志级别（logger.level 动态设置的默认值）
+	started          bool
+	closed           bool // 后台任务已停止、索引已关闭
+	mu               sync.RWMutex
+
+	shutdownCh   chan struct{} // POST /_shutdown 请求关闭时发送
+	drainTimeout time.Duration // POST /_shutdown 指定的排空超时，0 使用 shutdown_timeout
+	forceStop    bool          // POST /_shutdown?drain=false：不等待进行中的请求
 }
 
 // NewServer 创建新的ES协议服务器
@@ -58,32 +79,118 @@ func NewServer(dirMgr directory.DirectoryManager, metaStore metadata.MetadataSto
 		return nil, fmt.Errorf("invalid ES config: %w", err)
 	}
 
+	// 脚本执行限制
+	if config.Script != nil {
+		script.SetLimits(*config.Script)
+	}
+	// 注册配置的重排序服务
+	if err := registerRerankers(nil, config.Rerankers); err != nil {
+		return nil, err
+	}
+
 	// 创建HTTP服务器
 	httpSrv, err := server.NewServer(config.ServerConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP server: %w", err)
 	}
 
+	// ES 客户端兼容：声明版本、产品标识头与 compatible-with 媒体类型
+	compat := config.Compatibility
+	if compat == nil {
+		compat = &CompatibilityConfig{}
+	}
+	handler.SetESVersion(compat.Version)
+	if !compat.DisableProductHeader {
+		httpSrv.Use(server.ProductHeaderMiddleware)
+	}
+	httpSrv.Use(server.CompatibleMediaTypeMiddleware)
+	// filter_path、pretty 与 human 参数：在多租户中间件之外改写最终的 JSON 响应
+	httpSrv.Use(server.ResponseFilterMiddleware)
+	// 日期数学索引名（<logs-{now/d}>）在审计与多租户改写之前解析为具体索引名
+	httpSrv.Use(handler.DateMathIndexMiddleware)
+
+	// 审计日志：注册在多租户中间件之前，租户解析失败的请求同样被记录
+	var auditLog *audit.Logger
+	if config.Audit != nil && config.Audit.Enabled {
+		if auditLog, err = audit.NewLogger(config.Audit); err != nil {
+			return nil, fmt.Errorf("failed to create audit logger: %w", err)
+		}
+		httpSrv.Use(middleware.AuditMiddleware(auditLog))
+	}
+
+	// 多租户：在路由匹配之前改写索引名，保证所有路由（包括不需要认证的全局路由）都按租户隔离
+	if config.Tenant != nil && config.Tenant.Enabled {
+		httpSrv.Use(middleware.TenantMiddleware(config.Tenant))
+	}
+
+	// 聚合 worker 池指标通过 /_metrics 暴露（并发上限由集群动态设置 search.aggregation.max_concurrency 控制）
+	httpSrv.AddMetricsSource("aggregation_pool", handler.AggregationPoolStats)
+	// mget 跨索引并发获取的 worker 池指标（并发上限由 search.mget.max_concurrency 控制）
+	httpSrv.AddMetricsSource("mget_pool", handler.MultiGetPoolStats)
+
 	// 创建索引管理器
 	indexMgr := esIndex.NewIndexManager(dirMgr, metaStore)
 
 	// 创建索引处理器
 	indexHandler := handler.NewIndexHandler(dirMgr, metaStore)
 	indexHandler.SetIndexManager(indexMgr)
+	// 索引打开后按 index.refresh_interval、index.ingest_mode 设置刷新行为
+	indexMgr.SetConfigurer(indexHandler.ConfigureIndex)
 
 	// 创建文档处理器
 	documentHandler := handler.NewDocumentHandler(indexMgr, dirMgr, metaStore)
+	// 索引打开后按 index.warmer.* 设置预热
+	indexMgr.SetWarmer(documentHandler.WarmIndex)
+	indexHandler.SetTaskManager(documentHandler.TaskManager())
+	indexHandler.SetDocumentReindexer(documentHandler.ReindexDocuments)
+	documentHandler.SetMappingConverter(indexHandler.BleveMapping)
 
 	// 创建集群处理器
 	clusterHandler := handler.NewClusterHandler(indexMgr, dirMgr, metaStore)
 
+	// 集群动态设置：配置文件中的值作为默认值，persistent 设置从元数据存储恢复
+	logLevel := strings.ToLower(logger.GetGlobalLogger().GetLevel().String())
+	clusterHandler.ClusterSettings().SetDefaults(clusterSettingDefaults(config, logLevel))
+	if err := clusterHandler.ClusterSettings().Load(); err != nil {
+		return nil, fmt.Errorf("failed to load cluster settings: %w", err)
+	}
+
+	// 磁盘水位保护：监控数据目录所在磁盘，水位由集群动态设置 cluster.routing.allocation.disk.* 控制
+	diskMonitor := handler.NewDiskWatermarkMonitor(indexHandler, dirMgr.GetBaseDir())
+	indexHandler.SetDiskWatermarkMonitor(diskMonitor)
+	httpSrv.AddMetricsSource("disk", diskMonitor.Stats)
+	diskMonitor.Start()
+
 	// 创建统计信息处理器
 	statsHandler := handler.NewStatsHandler(indexMgr, dirMgr, metaStore)
 
+	// 创建存储脚本处理器
+	scriptHandler := handler.NewScriptHandler(metaStore)
+
+	// 创建 rollup 作业处理器（启动时恢复已启动的作业）
+	rollupHandler := handler.NewRollupHandler(indexHandler, documentHandler)
+
+	// 创建 watcher 处理器（启动时加载已保存的 watch 并开始调度）
+	watcherHandler := handler.NewWatcherHandler(indexHandler, documentHandler)
+
+	// 创建 transform 处理器（启动时恢复已启动的 transform）
+	transformHandler := handler.NewTransformHandler(indexHandler, documentHandler)
+
+	// 创建 API Key 服务（配置文件中的 Key 与通过 _security/api_key 创建的 Key）
+	authConfig := config.Auth
+	if authConfig == nil {
+		authConfig = middleware.DefaultAuthConfig()
+	}
+	apiKeys, err := middleware.NewAPIKeyService(authConfig, metaStore)
+	if err != nil {
+		return nil, err
+	}
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeys)
+
 	// 创建认证中间件（处理 config.Auth 为 nil 的情况）
 	var authMiddleware func(http.Handler) http.Handler
 	if config.Auth != nil {
-		authMiddleware = middleware.AuthMiddleware(config.Auth)
+		authMiddleware = middleware.AuthMiddleware(config.Auth, apiKeys)
 	} else {
 		// 如果未配置认证，使用空中间件（直接放行）
 		authMiddleware = func(next http.Handler) http.Handler {
@@ -94,16 +201,25 @@ func NewServer(dirMgr directory.DirectoryManager, metaStore metadata.MetadataSto
 	}
 
 	esSrv := &ESServer{
-		config:          config,
-		httpServer:      httpSrv,
-		indexHandler:    indexHandler,
-		documentHandler: documentHandler,
-		clusterHandler:  clusterHandler,
-		statsHandler:    statsHandler,
-		indexMgr:        indexMgr,
-		dirMgr:          dirMgr,
-		metaStore:       metaStore,
-		started:         false,
+		config:           config,
+		httpServer:       httpSrv,
+		indexHandler:     indexHandler,
+		documentHandler:  documentHandler,
+		clusterHandler:   clusterHandler,
+		statsHandler:     statsHandler,
+		scriptHandler:    scriptHandler,
+		rollupHandler:    rollupHandler,
+		watcherHandler:   watcherHandler,
+		transformHandler: transformHandler,
+		apiKeyHandler:    apiKeyHandler,
+		diskMonitor:      diskMonitor,
+		indexMgr:         indexMgr,
+		dirMgr:           dirMgr,
+		metaStore:        metaStore,
+		auditLog:         auditLog,
+		logLevel:         logLevel,
+		started:          false,
+		shutdownCh:       make(chan struct{}, 1),
 	}
 
 	// P2-6: 设置开发模式（根据日志级别判断）
@@ -111,11 +227,18 @@ func NewServer(dirMgr directory.DirectoryManager, metaStore metadata.MetadataSto
 		common.SetDevMode(true)
 	}
 
+	// 就绪检查（GET /_health/ready）：元数据存储、数据目录、磁盘水位与关键索引
+	esSrv.registerReadinessChecks()
+
 	// 注册ES路由（传入认证中间件）
 	esSrv.registerRoutes(authMiddleware)
 
-	// 预加载所有索引（启动后台合并任务）
-	go indexMgr.PreloadAllIndices()
+	// 启动恢复：打开并校验所有索引（启动后台合并任务），无法恢复的索引被隔离；
+	// 恢复后对账元数据 mapping 与索引 mapping，记录不一致的字段
+	go func() {
+		result := indexMgr.RecoverAllIndices()
+		indexHandler.ReconcileMappings(append(result.Opened, result.RolledBack...))
+	}()
 
 	return esSrv, nil
 }
@@ -133,6 +256,29 @@ func (s *ESServer) registerRoutes(authMiddleware func(http.Handler) http.Handler
 	// 注册统计信息路由（带认证保护）
 	s.registerStatsRoutes(router, s.statsHandler, authMiddleware)
 
+	// 注册存储脚本路由（带认证保护）
+	s.registerScriptRoutes(router, s.scriptHandler, authMiddleware)
+
+	// 注册 rollup 路由（带认证保护）
+	s.registerRollupRoutes(router, s.rollupHandler, authMiddleware)
+
+	// 注册 watcher 路由（带认证保护）
+	s.registerWatcherRoutes(router, s.watcherHandler, authMiddleware)
+
+	// 注册 transform 路由（带认证保护）
+	s.registerTransformRoutes(router, s.transformHandler, authMiddleware)
+
+	// 注册集群设置路由（带认证保护）
+	s.registerClusterSettingsRoutes(router, s.clusterHandler, authMiddleware)
+
+	// 注册 API Key 管理路由（带认证保护）
+	s.registerSecurityRoutes(router, s.apiKeyHandler, authMiddleware)
+
+	// 注册关闭路由（带认证保护）
+	router.AddRoutes(s.applyAuthMiddleware([]server.Route{
+		{Method: http.MethodPost, Path: "/_shutdown", Handler: s.handleShutdown},
+	}, authMiddleware))
+
 	// 根路径处理函数（支持 GET 和 HEAD）
 	rootHandler := func(w http.ResponseWriter, r *http.Request) {
 		response := map[string]interface{}{
@@ -140,7 +286,7 @@ func (s *ESServer) registerRoutes(authMiddleware func(http.Handler) http.Handler
 			"cluster_name": handler.ClusterName,
 			"cluster_uuid": handler.ClusterUUID,
 			"version": map[string]interface{}{
-				"number":                              handler.ESVersionNumber,
+				"number":                              handler.ESVersion(),
 				"build_flavor":                        "default",
 				"build_type":                          "release",
 				"build_hash":                          handler.ESBuildHash,
@@ -177,13 +323,22 @@ func (s *ESServer) registerRoutes(authMiddleware func(http.Handler) http.Handler
 		{Method: http.MethodGet, Path: "/_cluster/state", Handler: s.clusterHandler.ClusterState},
 		{Method: http.MethodGet, Path: "/_cluster/stats", Handler: s.clusterHandler.ClusterStats},
 		{Method: http.MethodGet, Path: "/_nodes", Handler: s.clusterHandler.NodesInfo},
+		{Method: http.MethodGet, Path: "/_nodes/stats", Handler: s.clusterHandler.NodesStats},
 		{Method: http.MethodGet, Path: "/_cat/nodes", Handler: s.clusterHandler.CatNodes},
 		{Method: http.MethodGet, Path: "/_cat/nodes/", Handler: s.clusterHandler.CatNodes},
 		{Method: http.MethodGet, Path: "/_cat/indices", Handler: s.clusterHandler.CatIndices},
 		{Method: http.MethodGet, Path: "/_cat/indices/", Handler: s.clusterHandler.CatIndices},
 		{Method: http.MethodGet, Path: "/_cat/shards", Handler: s.clusterHandler.CatShards},
 		{Method: http.MethodGet, Path: "/_cat/shards/", Handler: s.clusterHandler.CatShards},
+		// _all 不匹配 {index:[^_][^/]*}，单独注册（索引表达式见 handler/index_expression.go）
+		{Method: http.MethodGet, Path: "/_all", Handler: (*s.indexHandler).GetIndex},
+		{Method: http.MethodHead, Path: "/_all", Handler: (*s.indexHandler).HeadIndex},
+		{Method: http.MethodGet, Path: "/_all/_mapping", Handler: (*s.indexHandler).GetMapping},
+		{Method: http.MethodPut, Path: "/_all/_mapping", Handler: (*s.indexHandler).UpdateMapping},
 		{Method: http.MethodGet, Path: "/_all/_settings", Handler: (*s.indexHandler).GetSettings},
+		{Method: http.MethodPut, Path: "/_all/_settings", Handler: (*s.indexHandler).UpdateSettings},
+		{Method: http.MethodGet, Path: "/_settings", Handler: (*s.indexHandler).GetSettings},
+		{Method: http.MethodPut, Path: "/_settings", Handler: (*s.indexHandler).UpdateSettings},
 		{Method: http.MethodGet, Path: "/_alias", Handler: (*s.indexHandler).GetAllAliases},
 		{Method: http.MethodGet, Path: "/_alias/{name}", Handler: (*s.indexHandler).GetAliasByName},
 		{Method: http.MethodPost, Path: "/_aliases", Handler: (*s.indexHandler).UpdateAliases},
@@ -204,16 +359,45 @@ func (s *ESServer) registerIndexRoutes(router *server.Router, indexHandler *hand
 		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_mapping", Handler: (*indexHandler).GetMapping},
 		{Method: http.MethodPut, Path: "/{index:[^_][^/]*}/_mapping", Handler: (*indexHandler).UpdateMapping},
 		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_mapping/_all", Handler: (*indexHandler).GetMapping},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_mapping/field/{field}", Handler: (*indexHandler).GetFieldMapping},
+		// 元数据 mapping 与索引 mapping 对账，reindex=true 时修复差异并重新索引文档
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_mapping/_sync", Handler: (*indexHandler).SyncMapping},
+		{Method: http.MethodGet, Path: "/_mapping/field/{field}", Handler: (*indexHandler).GetFieldMapping},
+		{Method: http.MethodHead, Path: "/{index:[^_][^/]*}/_mapping", Handler: (*indexHandler).HeadMapping},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_mapping/{type}", Handler: (*indexHandler).GetTypedMapping},
+		{Method: http.MethodGet, Path: "/_mapping", Handler: (*indexHandler).GetAllMappings},
 		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_alias", Handler: (*indexHandler).GetAlias},
 		{Method: http.MethodPut, Path: "/{index:[^_][^/]*}/_alias/{name}", Handler: (*indexHandler).PutAlias},
 		{Method: http.MethodDelete, Path: "/{index:[^_][^/]*}/_alias/{name}", Handler: (*indexHandler).DeleteAlias},
 		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_settings", Handler: (*indexHandler).GetSettings},
 		{Method: http.MethodPut, Path: "/{index:[^_][^/]*}/_settings", Handler: (*indexHandler).UpdateSettings},
+		{Method: http.MethodPut, Path: "/{index:[^_][^/]*}/_block/{block}", Handler: (*indexHandler).AddIndexBlock},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_meta/history", Handler: (*indexHandler).GetIndexMetaHistory},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_meta/rollback/{version}", Handler: (*indexHandler).RollbackIndexMeta},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_close", Handler: (*indexHandler).CloseIndex},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_open", Handler: (*indexHandler).OpenIndex},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_refresh", Handler: (*indexHandler).RefreshIndex},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_refresh", Handler: (*indexHandler).RefreshIndex},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_flush", Handler: (*indexHandler).FlushIndex},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_flush", Handler: (*indexHandler).FlushIndex},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_forcemerge", Handler: (*indexHandler).ForceMerge},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_segments", Handler: (*indexHandler).GetSegments},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_verify", Handler: (*indexHandler).VerifyIndex},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_clone/{target}", Handler: (*indexHandler).CloneIndex},
+		{Method: http.MethodPut, Path: "/{index:[^_][^/]*}/_clone/{target}", Handler: (*indexHandler).CloneIndex},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_export", Handler: (*indexHandler).ExportIndex},
+		{Method: http.MethodPost, Path: "/_import", Handler: (*indexHandler).ImportIndex},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_migrate_tier", Handler: (*indexHandler).MigrateTier},
+		{Method: http.MethodPost, Path: "/_forcemerge", Handler: (*indexHandler).ForceMerge},
+		{Method: http.MethodGet, Path: "/_segments", Handler: (*indexHandler).GetSegments},
+		{Method: http.MethodPost, Path: "/_refresh", Handler: (*indexHandler).RefreshIndex},
+		{Method: http.MethodGet, Path: "/_refresh", Handler: (*indexHandler).RefreshIndex},
+		{Method: http.MethodPost, Path: "/_flush", Handler: (*indexHandler).FlushIndex},
+		{Method: http.MethodGet, Path: "/_flush", Handler: (*indexHandler).FlushIndex},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_field_caps", Handler: (*indexHandler).FieldCaps},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_field_caps", Handler: (*indexHandler).FieldCaps},
+		{Method: http.MethodGet, Path: "/_field_caps", Handler: (*indexHandler).FieldCaps},
+		{Method: http.MethodPost, Path: "/_field_caps", Handler: (*indexHandler).FieldCaps},
 	}
 	// 应用认证中间件保护
 	routes = s.applyAuthMiddleware(routes, authMiddleware)
@@ -234,19 +418,36 @@ func (s *ESServer) registerDocumentRoutes(router *server.Router, documentHandler
 		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_doc/{id}", Handler: (*documentHandler).GetDocument},
 		{Method: http.MethodDelete, Path: "/{index:[^_][^/]*}/_doc/{id}", Handler: (*documentHandler).DeleteDocument},
 		{Method: http.MethodHead, Path: "/{index:[^_][^/]*}/_doc/{id}", Handler: (*documentHandler).HeadDocument},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_source/{id}", Handler: (*documentHandler).GetSource},
+		{Method: http.MethodHead, Path: "/{index:[^_][^/]*}/_source/{id}", Handler: (*documentHandler).HeadSource},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_update/{id}", Handler: (*documentHandler).UpdateDocument},
 		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_count", Handler: (*documentHandler).CountDocuments},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_count", Handler: (*documentHandler).CountDocuments},
 		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_search", Handler: (*documentHandler).Search},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_search", Handler: (*documentHandler).Search},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_export_search", Handler: (*documentHandler).ExportSearch},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_bulk", Handler: (*documentHandler).Bulk},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_delete_by_query", Handler: (*documentHandler).DeleteByQuery},
 		// Scroll API
 		{Method: http.MethodGet, Path: "/_search/scroll", Handler: (*documentHandler).Scroll},
 		{Method: http.MethodPost, Path: "/_search/scroll", Handler: (*documentHandler).Scroll},
 		{Method: http.MethodDelete, Path: "/_search/scroll", Handler: (*documentHandler).ClearScroll},
+		// Search Template API
+		{Method: http.MethodGet, Path: "/_search/template", Handler: (*documentHandler).SearchTemplate},
+		{Method: http.MethodPost, Path: "/_search/template", Handler: (*documentHandler).SearchTemplate},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_search/template", Handler: (*documentHandler).SearchTemplate},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_search/template", Handler: (*documentHandler).SearchTemplate},
 		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_mget", Handler: (*documentHandler).MultiGet},
 		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_mget", Handler: (*documentHandler).MultiGet},
+		// Term Vectors API
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_termvectors/{id}", Handler: (*documentHandler).TermVectors},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_termvectors/{id}", Handler: (*documentHandler).TermVectors},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_termvectors", Handler: (*documentHandler).TermVectors},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_termvectors", Handler: (*documentHandler).TermVectors},
+		{Method: http.MethodGet, Path: "/_mtermvectors", Handler: (*documentHandler).MultiTermVectors},
+		{Method: http.MethodPost, Path: "/_mtermvectors", Handler: (*documentHandler).MultiTermVectors},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_mtermvectors", Handler: (*documentHandler).MultiTermVectors},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_mtermvectors", Handler: (*documentHandler).MultiTermVectors},
 		// Tasks API (P1-3: DeleteByQuery异步任务管理)
 		{Method: http.MethodGet, Path: "/_tasks/{task_id}", Handler: (*documentHandler).GetTask},
 		{Method: http.MethodPost, Path: "/_tasks/{task_id}/_cancel", Handler: (*documentHandler).CancelTask},
@@ -268,6 +469,255 @@ func (s *ESServer) registerStatsRoutes(router *server.Router, statsHandler *hand
 	router.AddRoutes(routes)
 }
 
+// registerScriptRoutes 注册存储脚本相关路由
+func (s *ESServer) registerScriptRoutes(router *server.Router, scriptHandler *handler.ScriptHandler, authMiddleware func(http.Handler) http.Handler) {
+	routes := []server.Route{
+		{Method: http.MethodPut, Path: "/_scripts/{id}", Handler: (*scriptHandler).PutScript},
+		{Method: http.MethodPost, Path: "/_scripts/{id}", Handler: (*scriptHandler).PutScript},
+		{Method: http.MethodGet, Path: "/_scripts/{id}", Handler: (*scriptHandler).GetScript},
+		{Method: http.MethodDelete, Path: "/_scripts/{id}", Handler: (*scriptHandler).DeleteScript},
+		{Method: http.MethodGet, Path: "/_render/template", Handler: (*scriptHandler).RenderTemplate},
+		{Method: http.MethodPost, Path: "/_render/template", Handler: (*scriptHandler).RenderTemplate},
+		{Method: http.MethodGet, Path: "/_render/template/{id}", Handler: (*scriptHandler).RenderTemplate},
+		{Method: http.MethodPost, Path: "/_render/template/{id}", Handler: (*scriptHandler).RenderTemplate},
+	}
+	// 应用认证中间件保护
+	routes = s.applyAuthMiddleware(routes, authMiddleware)
+	router.AddRoutes(routes)
+}
+
+// registerRollupRoutes 注册 rollup 作业与 rollup 搜索路由
+func (s *ESServer) registerRollupRoutes(router *server.Router, rollupHandler *handler.RollupHandler, authMiddleware func(http.Handler) http.Handler) {
+	routes := []server.Route{
+		{Method: http.MethodPut, Path: "/_rollup/job/{id}", Handler: rollupHandler.PutJob},
+		{Method: http.MethodGet, Path: "/_rollup/job", Handler: rollupHandler.GetJobs},
+		{Method: http.MethodGet, Path: "/_rollup/job/{id}", Handler: rollupHandler.GetJobs},
+		{Method: http.MethodDelete, Path: "/_rollup/job/{id}", Handler: rollupHandler.DeleteJob},
+		{Method: http.MethodPost, Path: "/_rollup/job/{id}/_start", Handler: rollupHandler.StartJob},
+		{Method: http.MethodPost, Path: "/_rollup/job/{id}/_stop", Handler: rollupHandler.StopJob},
+		{Method: http.MethodGet, Path: "/{index:[^_][^/]*}/_rollup_search", Handler: rollupHandler.RollupSearch},
+		{Method: http.MethodPost, Path: "/{index:[^_][^/]*}/_rollup_search", Handler: rollupHandler.RollupSearch},
+	}
+	// 应用认证中间件保护
+	routes = s.applyAuthMiddleware(routes, authMiddleware)
+	router.AddRoutes(routes)
+}
+
+// registerWatcherRoutes 注册 watcher 路由
+// 注意：/_watcher/watch/_execute 必须在 /_watcher/watch/{id} 之前注册
+func (s *ESServer) registerWatcherRoutes(router *server.Router, watcherHandler *handler.WatcherHandler, authMiddleware func(http.Handler) http.Handler) {
+	routes := []server.Route{
+		{Method: http.MethodPost, Path: "/_watcher/watch/_execute", Handler: watcherHandler.ExecuteWatch},
+		{Method: http.MethodPut, Path: "/_watcher/watch/_execute", Handler: watcherHandler.ExecuteWatch},
+		{Method: http.MethodPut, Path: "/_watcher/watch/{id}", Handler: watcherHandler.PutWatch},
+		{Method: http.MethodPost, Path: "/_watcher/watch/{id}", Handler: watcherHandler.PutWatch},
+		{Method: http.MethodGet, Path: "/_watcher/watch/{id}", Handler: watcherHandler.GetWatch},
+		{Method: http.MethodDelete, Path: "/_watcher/watch/{id}", Handler: watcherHandler.DeleteWatch},
+		{Method: http.MethodPut, Path: "/_watcher/watch/{id}/_execute", Handler: watcherHandler.ExecuteWatch},
+		{Method: http.MethodPost, Path: "/_watcher/watch/{id}/_execute", Handler: watcherHandler.ExecuteWatch},
+		{Method: http.MethodPut, Path: "/_watcher/watch/{id}/_activate", Handler: watcherHandler.ActivateWatch},
+		{Method: http.MethodPost, Path: "/_watcher/watch/{id}/_activate", Handler: watcherHandler.ActivateWatch},
+		{Method: http.MethodPut, Path: "/_watcher/watch/{id}/_deactivate", Handler: watcherHandler.DeactivateWatch},
+		{Method: http.MethodPost, Path: "/_watcher/watch/{id}/_deactivate", Handler: watcherHandler.DeactivateWatch},
+		{Method: http.MethodGet, Path: "/_watcher/stats", Handler: watcherHandler.WatcherStats},
+	}
+	// 应用认证中间件保护
+	routes = s.applyAuthMiddleware(routes, authMiddleware)
+	router.AddRoutes(routes)
+}
+
+// registerTransformRoutes 注册 transform 路由
+// 注意：/_transform/_preview 必须在 /_transform/{id} 之前注册
+func (s *ESServer) registerTransformRoutes(router *server.Router, transformHandler *handler.TransformHandler, authMiddleware func(http.Handler) http.Handler) {
+	routes := []server.Route{
+		{Method: http.MethodPost, Path: "/_transform/_preview", Handler: transformHandler.PreviewTransform},
+		{Method: http.MethodGet, Path: "/_transform/_preview", Handler: transformHandler.PreviewTransform},
+		{Method: http.MethodGet, Path: "/_transform", Handler: transformHandler.GetTransforms},
+		{Method: http.MethodPut, Path: "/_transform/{id}", Handler: transformHandler.PutTransform},
+		{Method: http.MethodGet, Path: "/_transform/{id}", Handler: transformHandler.GetTransforms},
+		{Method: http.MethodDelete, Path: "/_transform/{id}", Handler: transformHandler.DeleteTransform},
+		{Method: http.MethodGet, Path: "/_transform/{id}/_stats", Handler: transformHandler.GetTransformStats},
+		{Method: http.MethodPost, Path: "/_transform/{id}/_start", Handler: transformHandler.StartTransform},
+		{Method: http.MethodPost, Path: "/_transform/{id}/_stop", Handler: transformHandler.StopTransform},
+		{Method: http.MethodGet, Path: "/_transform/{id}/_preview", Handler: transformHandler.PreviewTransform},
+		{Method: http.MethodPost, Path: "/_transform/{id}/_preview", Handler: transformHandler.PreviewTransform},
+	}
+	// 应用认证中间件保护
+	routes = s.applyAuthMiddleware(routes, authMiddleware)
+	router.AddRoutes(routes)
+}
+
+// registerClusterSettingsRoutes 注册集群设置路由
+func (s *ESServer) registerClusterSettingsRoutes(router *server.Router, clusterHandler *handler.ClusterHandler, authMiddleware func(http.Handler) http.Handler) {
+	routes := []server.Route{
+		{Method: http.MethodGet, Path: "/_cluster/settings", Handler: clusterHandler.GetClusterSettings},
+		{Method: http.MethodPut, Path: "/_cluster/settings", Handler: clusterHandler.PutClusterSettings},
+	}
+	// 应用认证中间件保护
+	routes = s.applyAuthMiddleware(routes, authMiddleware)
+	router.AddRoutes(routes)
+}
+
+// registerSecurityRoutes 注册 API Key 管理路由
+func (s *ESServer) registerSecurityRoutes(router *server.Router, apiKeyHandler *handler.APIKeyHandler, authMiddleware func(http.Handler) http.Handler) {
+	routes := []server.Route{
+		{Method: http.MethodPost, Path: "/_security/api_key", Handler: apiKeyHandler.CreateAPIKey},
+		{Method: http.MethodPut, Path: "/_security/api_key", Handler: apiKeyHandler.CreateAPIKey},
+		{Method: http.MethodGet, Path: "/_security/api_key", Handler: apiKeyHandler.GetAPIKeys},
+		{Method: http.MethodDelete, Path: "/_security/api_key", Handler: apiKeyHandler.InvalidateAPIKeys},
+	}
+	// 应用认证中间件保护
+	routes = s.applyAuthMiddleware(routes, authMiddleware)
+	router.AddRoutes(routes)
+}
+
+// registerReadinessChecks 注册 /_health/ready 的依赖检查
+func (s *ESServer) registerReadinessChecks() {
+	s.httpServer.AddReadinessCheck("metadata_store", func(ctx context.Context) error {
+		return s.metaStore.Ping()
+	})
+	s.httpServer.AddReadinessCheck("data_dir", func(ctx context.Context) error {
+		return checkDirWritable(s.dirMgr.GetBaseDir())
+	})
+	s.httpServer.AddReadinessCheck("disk_watermark", s.diskMonitor.ReadinessCheck)
+	s.httpServer.AddReadinessCheck("critical_indices", s.checkCriticalIndices)
+}
+
+// checkDirWritable 在目录中创建并删除一个临时文件，检查目录可写
+func checkDirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".ready-*")
+	if err != nil {
+		return fmt.Errorf("data directory [%s] is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	_, err = f.Write([]byte("ok"))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	os.Remove(name)
+	if err != nil {
+		return fmt.Errorf("data directory [%s] is not writable: %w", dir, err)
+	}
+	return nil
+}
+
+// checkCriticalIndices 检查 readiness.critical_indices 中的索引都能打开并读取
+func (s *ESServer) checkCriticalIndices(ctx context.Context) error {
+	s.mu.RLock()
+	var indices []string
+	if s.config.Readiness != nil {
+		indices = s.config.Readiness.CriticalIndices
+	}
+	s.mu.RUnlock()
+
+	var failed []string
+	for _, name := range indices {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		idx, err := s.indexMgr.GetIndex(name)
+		if err == nil {
+			_, err = idx.DocCount()
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("[%s]: %v", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("critical indices cannot be opened: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// registerRerankers 注册配置的 HTTP 重排序服务，移除旧配置中已删除的服务
+func registerRerankers(old, configs map[string]*rerank.HTTPConfig) error {
+	for name := range old {
+		if _, ok := configs[name]; !ok {
+			rerank.Register(name, nil)
+		}
+	}
+	for name, rc := range configs {
+		r, err := rerank.NewHTTPReranker(rc)
+		if err != nil {
+			return fmt.Errorf("failed to create reranker [%s]: %w", name, err)
+		}
+		rerank.Register(name, r)
+	}
+	return nil
+}
+
+// clusterSettingDefaults 由配置文件生成集群动态设置的默认值
+func clusterSettingDefaults(config *Config, logLevel string) map[string]string {
+	defaults := map[string]string{
+		"logger.level": logLevel,
+	}
+	if config.Aggregation != nil {
+		defaults["search.aggregation.max_concurrency"] = strconv.Itoa(config.Aggregation.MaxConcurrency)
+	}
+	for k, v := range config.Settings {
+		defaults[k] = v
+	}
+	return defaults
+}
+
+// Reload 重新加载配置：脚本限制、ES 版本号与集群动态设置的默认值立即生效，
+// 监听地址、认证等配置变更只记录警告，需要重启才能生效。logLevel 为空时保持原日志级别
+func (s *ESServer) Reload(config *Config, logLevel string) error {
+	if config == nil {
+		return fmt.Errorf("ES config is nil")
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid ES config: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.config
+	if old.ServerConfig.Host != config.ServerConfig.Host || old.ServerConfig.Port != config.ServerConfig.Port {
+		logger.Warn("ES server address change (%s:%d -> %s:%d) requires restart", old.ServerConfig.Host, old.ServerConfig.Port, config.ServerConfig.Host, config.ServerConfig.Port)
+	}
+	if old.ServerConfig.EnableCORS != config.ServerConfig.EnableCORS ||
+		!reflect.DeepEqual(old.ServerConfig.EffectiveCORS(), config.ServerConfig.EffectiveCORS()) ||
+		!reflect.DeepEqual(old.ServerConfig.Routes, config.ServerConfig.Routes) {
+		logger.Warn("ES CORS and route middleware config change requires restart")
+	}
+	if !reflect.DeepEqual(old.Auth, config.Auth) {
+		logger.Warn("ES auth config change requires restart")
+	}
+	if !reflect.DeepEqual(old.Tenant, config.Tenant) {
+		logger.Warn("ES tenant config change requires restart")
+	}
+	if !reflect.DeepEqual(old.Audit, config.Audit) {
+		logger.Warn("ES audit config change requires restart")
+	}
+
+	if err := registerRerankers(old.Rerankers, config.Rerankers); err != nil {
+		return err
+	}
+
+	var limits script.Limits
+	if config.Script != nil {
+		limits = *config.Script
+	}
+	script.SetLimits(limits)
+
+	compat := config.Compatibility
+	if compat == nil {
+		compat = &CompatibilityConfig{}
+	}
+	handler.SetESVersion(compat.Version)
+
+	if logLevel != "" {
+		s.logLevel = strings.ToLower(logLevel)
+	}
+	s.clusterHandler.ClusterSettings().SetDefaults(clusterSettingDefaults(config, s.logLevel))
+
+	s.config = config
+	logger.Info("ES config reloaded")
+	return nil
+}
+
 // Start 启动ES服务器
 func (s *ESServer) Start() error {
 	s.mu.Lock()
@@ -282,25 +732,88 @@ func (s *ESServer) Start() error {
 }
 
 // Stop 停止ES服务器
+// 先停止接受新连接并等待进行中的请求完成（排空，最长 shutdown_timeout），超时后强制关闭剩余连接；
+// 随后停止后台任务，将所有索引未落盘的写入持久化后关闭索引。scroll 上下文只保存在内存中，随进程退出释放
 func (s *ESServer) Stop() error {
+	// 只在读取状态时持有锁，排空期间 IsRunning 不被阻塞并返回 false
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.started {
+		s.mu.Unlock()
 		return nil
 	}
-
+	s.started = false
+	forceStop := s.forceStop
 	// 使用带超时的context，避免无限等待
-	shutdownTimeout := s.config.ServerConfig.ShutdownTimeout
-	if shutdownTimeout <= 0 {
-		shutdownTimeout = 30 * time.Second // 默认30秒超时
+	drainTimeout := s.config.ServerConfig.ShutdownTimeout
+	if s.drainTimeout > 0 {
+		drainTimeout = s.drainTimeout
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	s.mu.Unlock()
+
+	if drainTimeout <= 0 {
+		drainTimeout = 30 * time.Second // 默认30秒超时
+	}
+	if forceStop {
+		drainTimeout = 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
 	defer cancel()
 
-	if err := s.httpServer.Stop(ctx); err != nil {
-		log.Printf("ERROR: Failed to stop ES HTTP server: %v", err)
-		return err
+	// 排空超时只记录警告，继续持久化并关闭索引，保证数据完整
+	if err := s.httpServer.Stop(ctx); err != nil && !forceStop {
+		log.Printf("WARN: ES HTTP server did not drain within %s: %v", drainTimeout, err)
+	}
+
+	s.closeEngine()
+	return nil
+}
+
+// Handler 返回处理 ES 请求的处理器（包含全局中间件与认证），不监听端口
+// 嵌入式模式通过它在进程内处理请求，使用完毕后调用 Close 关闭索引
+func (s *ESServer) Handler() http.Handler {
+	return s.httpServer.Handler()
+}
+
+// Close 关闭未启动 HTTP 服务的服务器（嵌入式模式）：停止后台任务，持久化并关闭所有索引
+// 服务器已启动时等同于 Stop
+func (s *ESServer) Close() error {
+	s.mu.RLock()
+	started := s.started
+	s.mu.RUnlock()
+	if started {
+		return s.Stop()
+	}
+	s.closeEngine()
+	return nil
+}
+
+// closeEngine 停止后台任务，将所有索引未落盘的写入持久化后关闭索引，只执行一次
+func (s *ESServer) closeEngine() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	// 停止 rollup 作业，避免关闭索引时仍有写入
+	s.rollupHandler.Close()
+
+	// 停止 watcher 调度，等待正在执行的 watch 结束
+	s.watcherHandler.Close()
+
+	// 停止 transform，避免关闭索引时仍有写入
+	s.transformHandler.Close()
+
+	// 停止磁盘水位检查
+	s.diskMonitor.Close()
+
+	// 持久化尚未落盘的写入（包括关闭自动刷新的索引中待刷新的批次）
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer flushCancel()
+	if err := s.indexMgr.FlushAll(flushCtx); err != nil {
+		log.Printf("WARN: Failed to flush indices before shutdown: %v", err)
 	}
 
 	// 关闭所有索引
@@ -308,8 +821,62 @@ func (s *ESServer) Stop() error {
 		log.Printf("WARN: Failed to close all indices: %v", err)
 	}
 
-	s.started = false
-	return nil
+	if s.auditLog != nil {
+		if err := s.auditLog.Close(); err != nil {
+			log.Printf("WARN: Failed to close audit log: %v", err)
+		}
+	}
+}
+
+// ShutdownRequested 返回通过 POST /_shutdown 请求关闭时收到通知的 channel
+// 收到通知后由调用方（进程主循环）调用 Stop 完成关闭
+func (s *ESServer) ShutdownRequested() <-chan struct{} {
+	return s.shutdownCh
+}
+
+// handleShutdown 请求优雅关闭节点，供编排系统在滚动重启前调用
+// POST /_shutdown?drain=true&timeout=30s
+// drain=true（默认）时等待进行中的请求完成，最长 timeout（默认 shutdown_timeout）；drain=false 时立即关闭连接
+// 响应在关闭开始前返回，关闭期间 /_ready 返回 503
+func (s *ESServer) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if len(middleware.RolesFromContext(r.Context())) > 0 {
+		common.HandleError(w, common.NewForbiddenError("action [cluster:admin/shutdown] is unauthorized for requests restricted by roles"))
+		return
+	}
+	drain := true
+	if v := r.URL.Query().Get("drain"); v != "" {
+		var err error
+		if drain, err = strconv.ParseBool(v); err != nil {
+			common.HandleError(w, common.NewBadRequestError("invalid [drain] value ["+v+"]"))
+			return
+		}
+	}
+	var timeout time.Duration
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 {
+			common.HandleError(w, common.NewBadRequestError("invalid [timeout] value ["+v+"]"))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.forceStop = !drain
+	s.drainTimeout = timeout
+	s.mu.Unlock()
+
+	select {
+	case s.shutdownCh <- struct{}{}:
+		logger.Info("Shutdown requested via API (drain=%v)", drain)
+	default:
+		// 已经请求过关闭
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"acknowledged": true, "drain": drain}); err != nil {
+		log.Printf("ERROR: Failed to encode shutdown response: %v", err)
+	}
 }
 
 // Name 返回协议名称
@@ -319,7 +886,7 @@ func (s *ESServer) Name() string {
 
 // Address 返回监听地址
 func (s *ESServer) Address() string {
-	return s.config.ServerConfig.Address()
+	return s.httpServer.Address()
 }
 
 // IsRunning 返回服务器是否正在运行
@@ -352,10 +919,16 @@ func (s *ESServer) applyAuthMiddleware(routes []server.Route, authMiddleware fun
 			// 应用认证中间件
 			// 将 http.Handler 转换为 http.HandlerFunc
 			wrappedHandler := authMiddleware(route.Handler)
+			handler := route.Handler
 			protectedRoutes = append(protectedRoutes, server.Route{
 				Method: route.Method,
 				Path:   route.Path,
 				Handler: func(w http.ResponseWriter, r *http.Request) {
+					// 路由规则配置了 auth_exempt 的请求免认证
+					if rc := server.RouteConfigFromContext(r.Context()); rc != nil && rc.AuthExempt {
+						handler(w, r)
+						return
+					}
 					wrappedHandler.ServeHTTP(w, r)
 				},
 			})
@@ -0,0 +1,246 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocols
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lscgzwd/tiggerdb/logger"
+)
+
+// 协议服务器状态
+const (
+	StatusStarting = "starting"
+	StatusRunning  = "running"
+	StatusStopped  = "stopped"
+	StatusFailed   = "failed"
+)
+
+// ServerHealth 单个协议服务器的健康状态
+type ServerHealth struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Registry 协议服务器注册表
+// 统一管理所有已启用协议服务器的启动、停止和健康状态
+type Registry struct {
+	mu      sync.RWMutex
+	servers []ProtocolServer
+	started map[string]bool
+	failed  map[string]error
+	errChan chan error
+}
+
+// NewRegistry 创建协议服务器注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		started: make(map[string]bool),
+		failed:  make(map[string]error),
+	}
+}
+
+// Register 注册协议服务器，协议名称不能重复
+func (r *Registry) Register(server ProtocolServer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.servers {
+		if s.Name() == server.Name() {
+			return fmt.Errorf("protocol server [%s] already registered", server.Name())
+		}
+	}
+	r.servers = append(r.servers, server)
+	return nil
+}
+
+// Servers 返回已注册的协议服务器（按注册顺序）
+func (r *Registry) Servers() []ProtocolServer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	servers := make([]ProtocolServer, len(r.servers))
+	copy(servers, r.servers)
+	return servers
+}
+
+// Len 返回已注册的协议服务器数量
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.servers)
+}
+
+// StartAll 启动所有协议服务器，并等待它们进入运行状态（最多等待 startTimeout）
+// 任一服务器启动失败时停止已启动的服务器并返回错误；等待超时只记录警告，服务器可能仍在启动中
+func (r *Registry) StartAll(startTimeout time.Duration) error {
+	servers := r.Servers()
+	if len(servers) == 0 {
+		return fmt.Errorf("no protocol server is enabled")
+	}
+
+	startErrs := make(chan error, len(servers))
+	r.mu.Lock()
+	r.errChan = startErrs
+	r.mu.Unlock()
+	for _, s := range servers {
+		r.mu.Lock()
+		r.started[s.Name()] = true
+		delete(r.failed, s.Name())
+		r.mu.Unlock()
+
+		go func(s ProtocolServer) {
+			if err := s.Start(); err != nil && err != http.ErrServerClosed {
+				err = fmt.Errorf("%s server failed: %w", s.Name(), err)
+				r.mu.Lock()
+				r.failed[s.Name()] = err
+				r.mu.Unlock()
+				startErrs <- err
+			}
+		}(s)
+	}
+
+	timeout := time.NewTimer(startTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-startErrs:
+			r.StopAll()
+			return fmt.Errorf("server startup failed: %w", err)
+		case <-timeout.C:
+			logger.Warn("Protocol server startup check timeout, continuing...")
+			return nil
+		case <-ticker.C:
+			if r.allRunning(servers) {
+				return nil
+			}
+		}
+	}
+}
+
+// Errors 返回协议服务器运行期间的错误（启动完成后某个服务器异常退出）
+func (r *Registry) Errors() <-chan error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.errChan
+}
+
+func (r *Registry) allRunning(servers []ProtocolServer) bool {
+	for _, s := range servers {
+		if !s.IsRunning() {
+			return false
+		}
+	}
+	return true
+}
+
+// StopAll 按注册的逆序停止所有已启动的协议服务器，返回所有停止失败的错误
+func (r *Registry) StopAll() error {
+	servers := r.Servers()
+	var errs []error
+	for i := len(servers) - 1; i >= 0; i-- {
+		s := servers[i]
+		r.mu.Lock()
+		started := r.started[s.Name()]
+		r.started[s.Name()] = false
+		r.mu.Unlock()
+		if !started {
+			continue
+		}
+		logger.Info("Shutting down %s server...", s.Name())
+		if err := s.Stop(); err != nil {
+			logger.Error("%s server forced to shutdown: %v", s.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+			continue
+		}
+		logger.Info("%s server exited", s.Name())
+	}
+	return errors.Join(errs...)
+}
+
+// Health 返回所有协议服务器的健康状态
+func (r *Registry) Health() []ServerHealth {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	health := make([]ServerHealth, 0, len(r.servers))
+	for _, s := range r.servers {
+		h := ServerHealth{
+			Name:    s.Name(),
+			Address: s.Address(),
+		}
+		switch {
+		case r.failed[s.Name()] != nil:
+			h.Status = StatusFailed
+			h.Error = r.failed[s.Name()].Error()
+		case s.IsRunning():
+			h.Status = StatusRunning
+		case r.started[s.Name()]:
+			h.Status = StatusStarting
+		default:
+			h.Status = StatusStopped
+		}
+		health = append(health, h)
+	}
+	return health
+}
+
+// Ready 所有已注册的协议服务器都在运行时返回 true
+func (r *Registry) Ready() bool {
+	health := r.Health()
+	if len(health) == 0 {
+		return false
+	}
+	for _, h := range health {
+		if h.Status != StatusRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadinessHandler 返回聚合就绪检查的 HTTP 处理器
+// 所有协议服务器都在运行时返回 200，否则返回 503，响应体包含每个协议的状态
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		health := r.Health()
+		ready := r.Ready()
+		status := "ready"
+		code := http.StatusOK
+		if !ready {
+			status = "not_ready"
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if req.Method == http.MethodHead {
+			return
+		}
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    status,
+			"protocols": health,
+		}); err != nil {
+			logger.Error("Failed to encode readiness response: %v", err)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocols
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer 模拟阻塞运行直到 Stop 的协议服务器
+type fakeServer struct {
+	name     string
+	startErr error
+	stopped  *[]string
+
+	mu      sync.Mutex
+	running bool
+	closed  bool
+	done    chan struct{}
+}
+
+func newFakeServer(name string, stopped *[]string) *fakeServer {
+	return &fakeServer{name: name, stopped: stopped, done: make(chan struct{})}
+}
+
+func (s *fakeServer) Start() error {
+	if s.startErr != nil {
+		return s.startErr
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.running = true
+	s.mu.Unlock()
+	<-s.done
+	return http.ErrServerClosed
+}
+
+func (s *fakeServer) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.running = false
+		close(s.done)
+	}
+	*s.stopped = append(*s.stopped, s.name)
+	return nil
+}
+
+func (s *fakeServer) Name() string    { return s.name }
+func (s *fakeServer) Address() string { return s.name + ":0" }
+
+func (s *fakeServer) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+func TestRegistry_Lifecycle(t *testing.T) {
+	var stopped []string
+	r := NewRegistry()
+	if err := r.Register(newFakeServer("es", &stopped)); err != nil {
+		t.Fatalf("Failed to register es: %v", err)
+	}
+	if err := r.Register(newFakeServer("redis", &stopped)); err != nil {
+		t.Fatalf("Failed to register redis: %v", err)
+	}
+	if err := r.Register(newFakeServer("es", &stopped)); err == nil {
+		t.Errorf("Expected error for duplicate protocol name")
+	}
+
+	if r.Ready() {
+		t.Errorf("Expected registry not ready before start")
+	}
+	w := httptest.NewRecorder()
+	r.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before start, got %d", w.Code)
+	}
+
+	if err := r.StartAll(time.Second); err != nil {
+		t.Fatalf("StartAll failed: %v", err)
+	}
+	if !r.Ready() {
+		t.Fatalf("Expected registry ready after start, health: %+v", r.Health())
+	}
+
+	w = httptest.NewRecorder()
+	r.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_ready", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 after start, got %d", w.Code)
+	}
+	var resp struct {
+		Status    string         `json:"status"`
+		Protocols []ServerHealth `json:"protocols"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse readiness response: %v", err)
+	}
+	if resp.Status != "ready" || len(resp.Protocols) != 2 || resp.Protocols[0].Name != "es" || resp.Protocols[0].Status != StatusRunning {
+		t.Errorf("Unexpected readiness response: %s", w.Body.String())
+	}
+
+	if err := r.StopAll(); err != nil {
+		t.Fatalf("StopAll failed: %v", err)
+	}
+	if len(stopped) != 2 || stopped[0] != "redis" || stopped[1] != "es" {
+		t.Errorf("Expected servers stopped in reverse order, got %v", stopped)
+	}
+	for _, h := range r.Health() {
+		if h.Status != StatusStopped {
+			t.Errorf("Expected %s stopped, got %s", h.Name, h.Status)
+		}
+	}
+}
+
+func TestRegistry_StartFailure(t *testing.T) {
+	var stopped []string
+	r := NewRegistry()
+	if err := r.StartAll(time.Second); err == nil {
+		t.Errorf("Expected error when no protocol server is registered")
+	}
+
+	ok := newFakeServer("es", &stopped)
+	bad := newFakeServer("mysql", &stopped)
+	bad.startErr = fmt.Errorf("address already in use")
+	r.Register(ok)
+	r.Register(bad)
+
+	if err := r.StartAll(time.Second); err == nil {
+		t.Fatalf("Expected StartAll to fail")
+	}
+	if ok.IsRunning() {
+		t.Errorf("Expected started servers to be stopped after startup failure")
+	}
+	health := r.Health()
+	if health[1].Status != StatusFailed || health[1].Error == "" {
+		t.Errorf("Expected mysql to be reported as failed, got %+v", health[1])
+	}
+	if r.Ready() {
+		t.Errorf("Expected registry not ready after startup failure")
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rerank 提供搜索结果的语义重排序：第一阶段搜索的前 N 条结果交给重排序模型重新打分
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reranker 重排序器：返回每个文档与查询文本的相关性得分（与 documents 顺序一致，越大越相关）
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Reranker)
+)
+
+// Register 以 name 注册重排序器，r 为 nil 时移除
+func Register(name string, r Reranker) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if r == nil {
+		delete(registry, name)
+		return
+	}
+	registry[name] = r
+}
+
+// Get 返回 name 对应的重排序器
+func Get(name string) (Reranker, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[name]
+	return r, ok
+}
+
+// Names 返回已注册的重排序器名称
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 默认配置
+const (
+	DefaultTimeout = 10 * time.Second
+
+	// maxResponseBytes 重排序服务响应体大小上限
+	maxResponseBytes = 10 << 20
+)
+
+// HTTPConfig HTTP 重排序服务配置
+// 请求与响应使用通用的 rerank 接口格式（Cohere、Jina、vLLM、Xinference 等兼容）：
+// 请求 {"model": "...", "query": "...", "documents": ["...", ...]}，
+// 响应 {"results": [{"index": 0, "relevance_score": 0.98}, ...]}
+type HTTPConfig struct {
+	Endpoint string            `json:"endpoint" yaml:"endpoint"`                   // 重排序接口地址，如 http://localhost:8080/v1/rerank
+	Model    string            `json:"model,omitempty" yaml:"model,omitempty"`     // 模型名称，为空时请求中不携带
+	APIKey   string            `json:"api_key,omitempty" yaml:"api_key,omitempty"` // 以 Bearer Token 发送
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // 额外请求头
+	Timeout  time.Duration     `json:"timeout" yaml:"timeout"`                     // 单次请求超时，默认 10s
+}
+
+// Validate 验证 HTTP 重排序服务配置
+func (c *HTTPConfig) Validate() error {
+	if c.Endpoint == "" {
+		return fmt.Errorf("reranker endpoint is required")
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid reranker endpoint [%s]", c.Endpoint)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("reranker timeout cannot be negative")
+	}
+	return nil
+}
+
+// HTTPReranker 调用外部 HTTP 重排序服务
+type HTTPReranker struct {
+	config *HTTPConfig
+	client *http.Client
+}
+
+// NewHTTPReranker 创建 HTTP 重排序器
+func NewHTTPReranker(config *HTTPConfig) (*HTTPReranker, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &HTTPReranker{config: config, client: &http.Client{Timeout: timeout}}, nil
+}
+
+type httpRerankRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+type httpRerankResponse struct {
+	Results []struct {
+		Index          int      `json:"index"`
+		RelevanceScore *float64 `json:"relevance_score"`
+		Score          *float64 `json:"score"`
+	} `json:"results"`
+}
+
+// Rerank 实现 Reranker 接口，响应中未返回的文档得分为 0
+func (r *HTTPReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	body, err := json.Marshal(httpRerankRequest{Model: r.config.Model, Query: query, Documents: documents})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range r.config.Headers {
+		req.Header.Set(k, v)
+	}
+	if r.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.APIKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reranker request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reranker response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(respBody) > 256 {
+			respBody = respBody[:256]
+		}
+		return nil, fmt.Errorf("reranker returned status %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+
+	var parsed httpRerankResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid reranker response: %w", err)
+	}
+	scores := make([]float64, len(documents))
+	for _, result := range parsed.Results {
+		if result.Index < 0 || result.Index >= len(documents) {
+			return nil, fmt.Errorf("invalid reranker response: result index %d out of range", result.Index)
+		}
+		switch {
+		case result.RelevanceScore != nil:
+			scores[result.Index] = *result.RelevanceScore
+		case result.Score != nil:
+			scores[result.Index] = *result.Score
+		}
+	}
+	return scores, nil
+}
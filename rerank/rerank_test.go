@@ -0,0 +1,85 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHTTPReranker(t *testing.T) {
+	var got httpRerankRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// 只返回部分结果，顺序与请求不同
+		w.Write([]byte(`{"results":[{"index":2,"relevance_score":0.9},{"index":0,"relevance_score":0.1}]}`))
+	}))
+	defer srv.Close()
+
+	r, err := NewHTTPReranker(&HTTPConfig{Endpoint: srv.URL, Model: "bge-reranker", APIKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewHTTPReranker: %v", err)
+	}
+	scores, err := r.Rerank(context.Background(), "what is go", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if want := []float64{0.1, 0, 0.9}; !reflect.DeepEqual(scores, want) {
+		t.Fatalf("expected scores %v, got %v", want, scores)
+	}
+	if got.Model != "bge-reranker" || got.Query != "what is go" || len(got.Documents) != 3 {
+		t.Fatalf("unexpected request body: %+v", got)
+	}
+
+	bad, _ := NewHTTPReranker(&HTTPConfig{Endpoint: srv.URL})
+	if _, err := bad.Rerank(context.Background(), "q", []string{"a"}); err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestHTTPConfigValidate(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:8080", "ftp://host/rerank"} {
+		if err := (&HTTPConfig{Endpoint: endpoint}).Validate(); err == nil {
+			t.Errorf("endpoint %q: expected error", endpoint)
+		}
+	}
+	if err := (&HTTPConfig{Endpoint: "https://host/v1/rerank"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r, _ := NewHTTPReranker(&HTTPConfig{Endpoint: "http://localhost/rerank"})
+	Register("test", r)
+	if got, ok := Get("test"); !ok || got != r {
+		t.Fatalf("expected registered reranker")
+	}
+	Register("test", nil)
+	if _, ok := Get("test"); ok {
+		t.Fatalf("expected reranker to be removed")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+// exprNode 表达式语法树节点
+type exprNode interface {
+	exprNode()
+}
+
+// literalExpr 字面量：数字、字符串、布尔、null
+type literalExpr struct {
+	value interface{}
+}
+
+// identExpr 标识符：局部变量或内置对象（doc、params、ctx、_source、_score、Math 等）
+type identExpr struct {
+	name string
+}
+
+// memberExpr 成员访问：obj.name、obj?.name
+type memberExpr struct {
+	object   exprNode
+	name     string
+	nullSafe bool
+}
+
+// indexExpr 下标访问：obj[index]
+type indexExpr struct {
+	object exprNode
+	index  exprNode
+}
+
+// callExpr 函数或方法调用：fn(args)、obj.method(args)
+type callExpr struct {
+	callee exprNode
+	args   []exprNode
+}
+
+// newExpr 构造对象：new ArrayList()
+type newExpr struct {
+	typeName string
+	args     []exprNode
+}
+
+// castExpr 类型转换：(int) x
+type castExpr struct {
+	typeName string
+	operand  exprNode
+}
+
+// unaryExpr 一元运算：-x、!x
+type unaryExpr struct {
+	op      string
+	operand exprNode
+}
+
+// updateExpr 自增自减：++x、x++、--x、x--
+type updateExpr struct {
+	op     string // "++" 或 "--"
+	prefix bool
+	target exprNode
+}
+
+// binaryExpr 二元运算（算术、比较、逻辑）
+type binaryExpr struct {
+	op    string
+	left  exprNode
+	right exprNode
+}
+
+// conditionalExpr 三元运算：cond ? a : b
+type conditionalExpr struct {
+	cond      exprNode
+	then      exprNode
+	otherwise exprNode
+}
+
+// elvisExpr 空值合并：a ?: b
+type elvisExpr struct {
+	left  exprNode
+	right exprNode
+}
+
+// assignExpr 赋值：target = value、target += value
+type assignExpr struct {
+	op     string
+	target exprNode
+	value  exprNode
+}
+
+// listExpr 列表字面量：[a, b]
+type listExpr struct {
+	elements []exprNode
+}
+
+// mapExpr Map 字面量：[k: v]、[:]
+type mapExpr struct {
+	keys   []exprNode
+	values []exprNode
+}
+
+func (*literalExpr) exprNode()     {}
+func (*identExpr) exprNode()       {}
+func (*memberExpr) exprNode()      {}
+func (*indexExpr) exprNode()       {}
+func (*callExpr) exprNode()        {}
+func (*newExpr) exprNode()         {}
+func (*castExpr) exprNode()        {}
+func (*unaryExpr) exprNode()       {}
+func (*updateExpr) exprNode()      {}
+func (*binaryExpr) exprNode()      {}
+func (*conditionalExpr) exprNode() {}
+func (*elvisExpr) exprNode()       {}
+func (*assignExpr) exprNode()      {}
+func (*listExpr) exprNode()        {}
+func (*mapExpr) exprNode()         {}
+
+// stmtNode 语句语法树节点
+type stmtNode interface {
+	stmtNode()
+}
+
+// exprStmt 表达式语句
+type exprStmt struct {
+	expr exprNode
+}
+
+// declStmt 局部变量声明：def x = 1、int i = 0, j
+type declStmt struct {
+	typeName string
+	names    []string
+	values   []exprNode // 未初始化的变量为 nil
+}
+
+// blockStmt 语句块：{ ... }
+type blockStmt struct {
+	stmts []stmtNode
+}
+
+// ifStmt 条件语句：if (cond) then else otherwise
+type ifStmt struct {
+	cond      exprNode
+	then      stmtNode
+	otherwise stmtNode
+}
+
+// forStmt for 循环：for (init; cond; update) body
+type forStmt struct {
+	init   stmtNode
+	cond   exprNode
+	update []exprNode
+	body   stmtNode
+}
+
+// forEachStmt 遍历循环：for (def x : list) body、for (x in list) body
+type forEachStmt struct {
+	name     string
+	iterable exprNode
+	body     stmtNode
+}
+
+// whileStmt while 循环
+type whileStmt struct {
+	cond exprNode
+	body stmtNode
+}
+
+// doWhileStmt do-while 循环
+type doWhileStmt struct {
+	body stmtNode
+	cond exprNode
+}
+
+// switchStmt switch 语句（case 之间按 Java 语义贯穿执行）
+type switchStmt struct {
+	value exprNode
+	cases []switchCase
+}
+
+// switchCase switch 的一个分支，value 为 nil 表示 default
+type switchCase struct {
+	value exprNode
+	body  []stmtNode
+}
+
+// breakStmt break 语句
+type breakStmt struct{}
+
+// continueStmt continue 语句
+type continueStmt struct{}
+
+// returnStmt return 语句
+type returnStmt struct {
+	value exprNode
+}
+
+func (*exprStmt) stmtNode()     {}
+func (*declStmt) stmtNode()     {}
+func (*blockStmt) stmtNode()    {}
+func (*ifStmt) stmtNode()       {}
+func (*forStmt) stmtNode()      {}
+func (*forEachStmt) stmtNode()  {}
+func (*whileStmt) stmtNode()    {}
+func (*doWhileStmt) stmtNode()  {}
+func (*switchStmt) stmtNode()   {}
+func (*breakStmt) stmtNode()    {}
+func (*continueStmt) stmtNode() {}
+func (*returnStmt) stmtNode()   {}
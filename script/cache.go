@@ -23,12 +23,16 @@ import (
 
 // CompiledScript 预编译的脚本
 type CompiledScript struct {
+	ID        string                 // 存储脚本ID（内联脚本为空）
+	Lang      string                 // 脚本语言
 	Source    string                 // 原始脚本源码
 	Hash      string                 // 脚本哈希（用于缓存键）
 	Params    map[string]interface{} // 默认参数
 	CreatedAt time.Time              // 创建时间
 	LastUsed  time.Time              // 最后使用时间
 	UseCount  int64                  // 使用次数
+
+	program []stmtNode // 解析后的语句序列
 }
 
 // ScriptCache 脚本缓存
@@ -127,6 +131,80 @@ func (c *ScriptCache) Put(source string, params map[string]interface{}) *Compile
 	return script
 }
 
+// putProgram 缓存解析后的语句序列
+func (c *ScriptCache) putProgram(source string, program []stmtNode) {
+	hash := hashScript(source)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.scripts) >= c.maxSize {
+		c.evictOldest()
+	}
+
+	c.scripts[hash] = &CompiledScript{
+		Source:    source,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+		LastUsed:  time.Now(),
+		UseCount:  1,
+		program:   program,
+	}
+}
+
+// storedScriptKey 存储脚本的缓存键（与内联脚本的哈希键区分）
+func storedScriptKey(id string) string {
+	return "stored:" + id
+}
+
+// GetStored 按 ID 获取缓存的存储脚本
+func (c *ScriptCache) GetStored(id string) (*CompiledScript, bool) {
+	key := storedScriptKey(id)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	script, ok := c.scripts[key]
+	if !ok || time.Since(script.LastUsed) > c.ttl {
+		delete(c.scripts, key)
+		c.misses++
+		return nil, false
+	}
+	script.LastUsed = time.Now()
+	script.UseCount++
+	c.hits++
+	return script, true
+}
+
+// PutStored 按 ID 缓存存储脚本
+func (c *ScriptCache) PutStored(id, lang, source string) *CompiledScript {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.scripts) >= c.maxSize {
+		c.evictOldest()
+	}
+
+	script := &CompiledScript{
+		ID:        id,
+		Lang:      lang,
+		Source:    source,
+		Hash:      hashScript(source),
+		CreatedAt: time.Now(),
+		LastUsed:  time.Now(),
+		UseCount:  1,
+	}
+	c.scripts[storedScriptKey(id)] = script
+	return script
+}
+
+// InvalidateStored 移除存储脚本的缓存（存储脚本更新或删除时调用）
+func (c *ScriptCache) InvalidateStored(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.scripts, storedScriptKey(id))
+}
+
 // evictOldest 移除最旧的缓存（LRU策略）
 func (c *ScriptCache) evictOldest() {
 	var oldestHash string
@@ -196,6 +274,16 @@ func (c *ScriptCache) Clear() {
 	c.misses = 0
 }
 
+// SetMaxSize 调整最大缓存数量，超出部分按 LRU 淘汰
+func (c *ScriptCache) SetMaxSize(maxSize int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxSize = maxSize
+	for len(c.scripts) > c.maxSize {
+		c.evictOldest()
+	}
+}
+
 // Size 返回当前缓存大小
 func (c *ScriptCache) Size() int {
 	c.mu.RLock()
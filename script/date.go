@@ -0,0 +1,504 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 日期时间支持（java.time 风格）：
+//   - ZonedDateTime / Instant：doc['ts'].value.getMillis()、getYear()、plusDays(1) 等
+//   - Duration：Duration.between(a, b).toDays()、Duration.ofHours(2)
+//   - ChronoUnit：ChronoUnit.DAYS.between(a, b)
+//   - ZoneId / ZoneOffset：withZoneSameInstant(ZoneId.of('Asia/Shanghai'))
+//   - DateTimeFormatter.ofPattern('yyyy-MM-dd')
+// 字符串与毫秒时间戳调用日期方法时自动按日期解析
+
+// zonedDateTime 带时区的日期时间（Instant 按 UTC 处理）
+type zonedDateTime struct {
+	t time.Time
+}
+
+// duration 时间间隔
+type duration struct {
+	d time.Duration
+}
+
+// chronoUnit 时间单位（ChronoUnit.DAYS 等）
+type chronoUnit struct {
+	name string
+}
+
+// zoneID 时区
+type zoneID struct {
+	loc *time.Location
+}
+
+// isoDateTimeLayout ES 默认的日期输出格式
+const isoDateTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+func (z zonedDateTime) String() string {
+	return z.t.Format(isoDateTimeLayout)
+}
+
+// MarshalJSON 序列化为 ISO 8601 字符串（用于 script_fields 结果）
+func (z zonedDateTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(z.String())
+}
+
+func (d duration) String() string {
+	return "PT" + strconv.FormatFloat(d.d.Seconds(), 'f', -1, 64) + "S"
+}
+
+// MarshalJSON 序列化为 ISO 8601 时间间隔字符串
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (z zoneID) String() string {
+	return z.loc.String()
+}
+
+// 不依赖日历的固定长度时间单位
+var chronoUnitDurations = map[string]time.Duration{
+	"NANOS":     time.Nanosecond,
+	"MICROS":    time.Microsecond,
+	"MILLIS":    time.Millisecond,
+	"SECONDS":   time.Second,
+	"MINUTES":   time.Minute,
+	"HOURS":     time.Hour,
+	"HALF_DAYS": 12 * time.Hour,
+	"DAYS":      24 * time.Hour,
+	"WEEKS":     7 * 24 * time.Hour,
+}
+
+// 日期专有的方法名，字符串和数值调用这些方法时按日期解析
+var dateMethods = map[string]bool{
+	"getMillis": true, "toEpochMilli": true, "toEpochSecond": true, "toInstant": true,
+	"getYear": true, "getMonthValue": true, "getMonth": true, "getDayOfMonth": true,
+	"getDayOfYear": true, "getDayOfWeek": true, "getHour": true, "getMinute": true,
+	"getSecond": true, "getNano": true, "isBefore": true, "isAfter": true, "isEqual": true,
+	"plusYears": true, "plusMonths": true, "plusWeeks": true, "plusDays": true,
+	"plusHours": true, "plusMinutes": true, "plusSeconds": true, "plusMillis": true,
+	"minusYears": true, "minusMonths": true, "minusWeeks": true, "minusDays": true,
+	"minusHours": true, "minusMinutes": true, "minusSeconds": true, "minusMillis": true,
+	"withZoneSameInstant": true, "truncatedTo": true, "format": true,
+}
+
+// asDateTime 将日期对象、time.Time、日期字符串或毫秒时间戳转换为时间
+func asDateTime(v interface{}) (time.Time, bool) {
+	switch val := v.(type) {
+	case zonedDateTime:
+		return val.t, true
+	case time.Time:
+		return val, true
+	case docField:
+		return asDateTime(val.value())
+	case float64, int, int64:
+		return millisToTime(toFloat64(val)).UTC(), true
+	case string:
+		t, err := parseTime(val)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// parseTime 解析日期字符串或时间戳，保留字符串中的时区偏移
+func parseTime(v interface{}) (time.Time, error) {
+	switch val := v.(type) {
+	case float64:
+		return millisToTime(val).UTC(), nil
+	case zonedDateTime:
+		return val.t, nil
+	}
+	s := strings.TrimSpace(toString(v))
+
+	// 2024-01-15T10:00:00+08:00[Asia/Shanghai]
+	var loc *time.Location
+	if i := strings.IndexByte(s, '['); i > 0 && strings.HasSuffix(s, "]") {
+		l, err := time.LoadLocation(s[i+1 : len(s)-1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse date: %s", s)
+		}
+		loc = l
+		s = s[:i]
+	}
+
+	formats := []string{
+		"2006-01-02",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04:05Z",
+		time.RFC3339,
+		time.RFC3339Nano,
+		"2006/01/02",
+		"2006/01/02 15:04:05",
+		"01/02/2006",
+		"01-02-2006",
+	}
+	for _, format := range formats {
+		if t, err := time.Parse(format, s); err == nil {
+			if loc != nil {
+				t = t.In(loc)
+			}
+			return t, nil
+		}
+	}
+
+	// 时间戳（秒级自动转换为毫秒）
+	if timestamp, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if timestamp < 10000000000 {
+			timestamp *= 1000
+		}
+		return time.UnixMilli(timestamp).UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("failed to parse date: %s", s)
+}
+
+// addToTime 在时间上增加指定单位的数量（单位不区分大小写，支持单复数）
+func addToTime(t time.Time, unit string, amount float64) (time.Time, error) {
+	switch strings.ToLower(unit) {
+	case "year", "years":
+		return t.AddDate(int(amount), 0, 0), nil
+	case "month", "months":
+		return t.AddDate(0, int(amount), 0), nil
+	case "week", "weeks":
+		return t.AddDate(0, 0, int(amount)*7), nil
+	case "day", "days":
+		return t.AddDate(0, 0, int(amount)), nil
+	case "hour", "hours":
+		return t.Add(time.Duration(amount * float64(time.Hour))), nil
+	case "minute", "minutes":
+		return t.Add(time.Duration(amount * float64(time.Minute))), nil
+	case "second", "seconds":
+		return t.Add(time.Duration(amount * float64(time.Second))), nil
+	case "millisecond", "milliseconds", "ms", "millis":
+		return t.Add(time.Duration(amount * float64(time.Millisecond))), nil
+	}
+	return t, fmt.Errorf("unsupported date field: %s", unit)
+}
+
+// unitsBetween 计算两个时间之间完整的单位数（向零取整）
+func unitsBetween(unit string, from, to time.Time) (float64, error) {
+	switch unit {
+	case "MONTHS", "YEARS":
+		months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+		// 不足一个完整月时回退
+		if months > 0 && from.AddDate(0, months, 0).After(to) {
+			months--
+		} else if months < 0 && from.AddDate(0, months, 0).Before(to) {
+			months++
+		}
+		if unit == "YEARS" {
+			return float64(months / 12), nil
+		}
+		return float64(months), nil
+	}
+	size, ok := chronoUnitDurations[unit]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit [%s]", unit)
+	}
+	return math.Trunc(float64(to.Sub(from)) / float64(size)), nil
+}
+
+// getDateMember 读取日期相关静态类的常量
+func getDateMember(class, name string) (interface{}, bool) {
+	switch class {
+	case "ChronoUnit":
+		if _, ok := chronoUnitDurations[name]; ok || name == "MONTHS" || name == "YEARS" {
+			return chronoUnit{name: name}, true
+		}
+	case "ZoneOffset":
+		if name == "UTC" {
+			return zoneID{loc: time.UTC}, true
+		}
+	}
+	return nil, false
+}
+
+// callDateStatic 执行日期相关静态函数
+func callDateStatic(class, method string, args []interface{}) (interface{}, bool, error) {
+	arg := func(i int) interface{} {
+		if i < len(args) {
+			return args[i]
+		}
+		return nil
+	}
+
+	switch class + "." + method {
+	case "Instant.now", "ZonedDateTime.now":
+		return zonedDateTime{t: time.Now().UTC()}, true, nil
+	case "Instant.ofEpochMilli":
+		return zonedDateTime{t: millisToTime(toFloat64(arg(0))).UTC()}, true, nil
+	case "Instant.ofEpochSecond":
+		return zonedDateTime{t: time.Unix(int64(toFloat64(arg(0))), 0).UTC()}, true, nil
+	case "Instant.parse", "ZonedDateTime.parse":
+		t, err := parseTime(arg(0))
+		if err != nil {
+			return nil, true, err
+		}
+		return zonedDateTime{t: t}, true, nil
+	case "ZonedDateTime.ofInstant":
+		t, ok := asDateTime(arg(0))
+		if !ok {
+			return nil, true, fmt.Errorf("ZonedDateTime.ofInstant requires an instant")
+		}
+		if zone, ok := arg(1).(zoneID); ok {
+			t = t.In(zone.loc)
+		}
+		return zonedDateTime{t: t}, true, nil
+	case "ZoneId.of":
+		loc, err := loadZone(toString(arg(0)))
+		if err != nil {
+			return nil, true, err
+		}
+		return zoneID{loc: loc}, true, nil
+	case "DateTimeFormatter.ofPattern":
+		return &simpleDateFormat{pattern: toString(arg(0))}, true, nil
+	case "Duration.between":
+		from, ok1 := asDateTime(arg(0))
+		to, ok2 := asDateTime(arg(1))
+		if !ok1 || !ok2 {
+			return nil, true, fmt.Errorf("Duration.between requires two dates")
+		}
+		return duration{d: to.Sub(from)}, true, nil
+	case "Duration.ofDays":
+		return duration{d: time.Duration(toFloat64(arg(0)) * float64(24*time.Hour))}, true, nil
+	case "Duration.ofHours":
+		return duration{d: time.Duration(toFloat64(arg(0)) * float64(time.Hour))}, true, nil
+	case "Duration.ofMinutes":
+		return duration{d: time.Duration(toFloat64(arg(0)) * float64(time.Minute))}, true, nil
+	case "Duration.ofSeconds":
+		return duration{d: time.Duration(toFloat64(arg(0)) * float64(time.Second))}, true, nil
+	case "Duration.ofMillis":
+		return duration{d: time.Duration(toFloat64(arg(0)) * float64(time.Millisecond))}, true, nil
+	}
+	return nil, false, nil
+}
+
+// loadZone 解析时区 ID（Z、UTC、+08:00 或 IANA 名称）
+func loadZone(id string) (*time.Location, error) {
+	switch id {
+	case "Z", "UTC", "GMT":
+		return time.UTC, nil
+	}
+	if len(id) == 6 && (id[0] == '+' || id[0] == '-') && id[3] == ':' {
+		hours, err1 := strconv.Atoi(id[1:3])
+		minutes, err2 := strconv.Atoi(id[4:])
+		if err1 == nil && err2 == nil {
+			offset := hours*3600 + minutes*60
+			if id[0] == '-' {
+				offset = -offset
+			}
+			return time.FixedZone(id, offset), nil
+		}
+	}
+	loc, err := time.LoadLocation(id)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone [%s]", id)
+	}
+	return loc, nil
+}
+
+// callDateTimeMethod 执行 ZonedDateTime 方法
+func callDateTimeMethod(t time.Time, method string, args []interface{}) (interface{}, error) {
+	arg := func(i int) interface{} {
+		if i < len(args) {
+			return args[i]
+		}
+		return nil
+	}
+	other := func() (time.Time, error) {
+		o, ok := asDateTime(arg(0))
+		if !ok {
+			return time.Time{}, fmt.Errorf("[%s] requires a date argument", method)
+		}
+		return o, nil
+	}
+
+	switch method {
+	case "getMillis", "toEpochMilli":
+		return float64(t.UnixMilli()), nil
+	case "toEpochSecond":
+		return float64(t.Unix()), nil
+	case "toInstant":
+		return zonedDateTime{t: t.UTC()}, nil
+	case "getYear":
+		return float64(t.Year()), nil
+	case "getMonthValue":
+		return float64(t.Month()), nil
+	case "getMonth":
+		return strings.ToUpper(t.Month().String()), nil
+	case "getDayOfMonth":
+		return float64(t.Day()), nil
+	case "getDayOfYear":
+		return float64(t.YearDay()), nil
+	case "getDayOfWeek":
+		// 与 ES 7.x 的 JodaCompatibleZonedDateTime 一致：周一为 1，周日为 7
+		day := int(t.Weekday())
+		if day == 0 {
+			day = 7
+		}
+		return float64(day), nil
+	case "getHour":
+		return float64(t.Hour()), nil
+	case "getMinute":
+		return float64(t.Minute()), nil
+	case "getSecond":
+		return float64(t.Second()), nil
+	case "getNano":
+		return float64(t.Nanosecond()), nil
+	case "isBefore", "isAfter", "isEqual", "equals", "compareTo":
+		o, err := other()
+		if err != nil {
+			if method == "equals" {
+				return false, nil
+			}
+			return nil, err
+		}
+		switch method {
+		case "isBefore":
+			return t.Before(o), nil
+		case "isAfter":
+			return t.After(o), nil
+		case "compareTo":
+			return float64(t.Compare(o)), nil
+		}
+		return t.Equal(o), nil
+	case "plus", "minus":
+		sign := 1.0
+		if method == "minus" {
+			sign = -1
+		}
+		if d, ok := arg(0).(duration); ok {
+			return zonedDateTime{t: t.Add(time.Duration(sign * float64(d.d)))}, nil
+		}
+		unit, ok := arg(1).(chronoUnit)
+		if !ok {
+			return nil, fmt.Errorf("[%s] requires a Duration or an amount and a ChronoUnit", method)
+		}
+		return plusUnit(t, unit.name, sign*toFloat64(arg(0)))
+	case "withZoneSameInstant":
+		zone, ok := arg(0).(zoneID)
+		if !ok {
+			return nil, fmt.Errorf("withZoneSameInstant requires a ZoneId")
+		}
+		return zonedDateTime{t: t.In(zone.loc)}, nil
+	case "truncatedTo":
+		unit, ok := arg(0).(chronoUnit)
+		if !ok {
+			return nil, fmt.Errorf("truncatedTo requires a ChronoUnit")
+		}
+		if unit.name == "DAYS" {
+			return zonedDateTime{t: time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())}, nil
+		}
+		size, ok := chronoUnitDurations[unit.name]
+		if !ok || size > 24*time.Hour {
+			return nil, fmt.Errorf("unit [%s] is too large for truncatedTo", unit.name)
+		}
+		return zonedDateTime{t: t.Truncate(size)}, nil
+	case "format":
+		f, ok := arg(0).(*simpleDateFormat)
+		if !ok {
+			return nil, fmt.Errorf("format requires a DateTimeFormatter")
+		}
+		return formatDate(t, f.pattern), nil
+	case "toString":
+		return zonedDateTime{t: t}.String(), nil
+	}
+
+	if strings.HasPrefix(method, "plus") || strings.HasPrefix(method, "minus") {
+		sign := 1.0
+		unit := strings.TrimPrefix(method, "plus")
+		if strings.HasPrefix(method, "minus") {
+			sign = -1
+			unit = strings.TrimPrefix(method, "minus")
+		}
+		result, err := addToTime(t, unit, sign*toFloat64(arg(0)))
+		if err != nil {
+			return nil, fmt.Errorf("unknown method [%s] on [ZonedDateTime]", method)
+		}
+		return zonedDateTime{t: result}, nil
+	}
+	return nil, fmt.Errorf("unknown method [%s] on [ZonedDateTime]", method)
+}
+
+// plusUnit 按 ChronoUnit 增加时间
+func plusUnit(t time.Time, unit string, amount float64) (interface{}, error) {
+	switch unit {
+	case "MONTHS":
+		return zonedDateTime{t: t.AddDate(0, int(amount), 0)}, nil
+	case "YEARS":
+		return zonedDateTime{t: t.AddDate(int(amount), 0, 0)}, nil
+	case "DAYS":
+		return zonedDateTime{t: t.AddDate(0, 0, int(amount))}, nil
+	case "WEEKS":
+		return zonedDateTime{t: t.AddDate(0, 0, int(amount)*7)}, nil
+	}
+	size, ok := chronoUnitDurations[unit]
+	if !ok {
+		return nil, fmt.Errorf("unsupported unit [%s]", unit)
+	}
+	return zonedDateTime{t: t.Add(time.Duration(amount * float64(size)))}, nil
+}
+
+// callDurationMethod 执行 Duration 方法
+func callDurationMethod(d time.Duration, method string, args []interface{}) (interface{}, error) {
+	switch method {
+	case "toMillis":
+		return float64(d.Milliseconds()), nil
+	case "getSeconds", "toSeconds":
+		return math.Trunc(d.Seconds()), nil
+	case "toMinutes":
+		return math.Trunc(d.Minutes()), nil
+	case "toHours":
+		return math.Trunc(d.Hours()), nil
+	case "toDays":
+		return math.Trunc(d.Hours() / 24), nil
+	case "isNegative":
+		return d < 0, nil
+	case "isZero":
+		return d == 0, nil
+	case "abs":
+		if d < 0 {
+			d = -d
+		}
+		return duration{d: d}, nil
+	case "negated":
+		return duration{d: -d}, nil
+	case "multipliedBy":
+		if len(args) == 1 {
+			return duration{d: time.Duration(float64(d) * toFloat64(args[0]))}, nil
+		}
+	case "plus", "minus":
+		if len(args) == 1 {
+			if o, ok := args[0].(duration); ok {
+				if method == "minus" {
+					return duration{d: d - o.d}, nil
+				}
+				return duration{d: d + o.d}, nil
+			}
+		}
+	case "toString":
+		return duration{d: d}.String(), nil
+	}
+	return nil, fmt.Errorf("unknown method [%s] on [Duration]", method)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDateTimeMethods(t *testing.T) {
+	engine := NewEngine()
+	doc := map[string]interface{}{
+		"ts":    "2024-01-15T10:30:00Z",
+		"birth": "1990-06-20",
+		"epoch": 1705314600000.0,
+	}
+	params := map[string]interface{}{"now": "2024-06-20T00:00:00Z"}
+
+	tests := []struct {
+		name   string
+		source string
+		want   interface{}
+	}{
+		{"getMillis from string", "doc['ts'].value.getMillis()", 1705314600000.0},
+		{"getMillis from epoch", "doc['epoch'].value.toEpochMilli()", 1705314600000.0},
+		{"getYear", "doc['ts'].value.getYear()", 2024.0},
+		{"getMonthValue", "doc['ts'].value.getMonthValue()", 1.0},
+		{"getMonth", "doc['ts'].value.getMonth()", "JANUARY"},
+		{"getDayOfWeek monday", "doc['ts'].value.getDayOfWeek()", 1.0},
+		{"getHour", "doc['ts'].value.getHour()", 10.0},
+		{"plusDays", "doc['ts'].value.plusDays(20).getDayOfMonth()", 4.0},
+		{"minusMonths", "doc['ts'].value.minusMonths(1).getYear()", 2023.0},
+		{"age in days", "ChronoUnit.DAYS.between(doc['ts'].value, params.now)", 156.0},
+		{"age in years", "ChronoUnit.YEARS.between(doc['birth'].value, params.now)", 34.0},
+		{"months between", "ChronoUnit.MONTHS.between('2024-01-31', '2024-03-30')", 1.0},
+		{"duration between", "Duration.between(doc['ts'].value, ZonedDateTime.parse(params.now)).toDays()", 156.0},
+		{"duration arithmetic", "Instant.ofEpochMilli(0).plus(Duration.ofHours(36).minus(Duration.ofMinutes(30))).toString()", "1970-01-02T11:30:00.000Z"},
+		{"plus with chrono unit", "Instant.ofEpochMilli(0).plus(3, ChronoUnit.DAYS).getDayOfMonth()", 4.0},
+		{"time zone", "doc['ts'].value.withZoneSameInstant(ZoneId.of('Asia/Shanghai')).getHour()", 18.0},
+		{"offset zone", "ZonedDateTime.parse('2024-01-15T23:00:00-02:00').withZoneSameInstant(ZoneOffset.UTC).getDayOfMonth()", 16.0},
+		{"truncated to days", "doc['ts'].value.truncatedTo(ChronoUnit.DAYS).getHour()", 0.0},
+		{"formatter", "doc['ts'].value.format(DateTimeFormatter.ofPattern('yyyy/MM/dd HH:mm'))", "2024/01/15 10:30"},
+		{"isBefore", "doc['birth'].value.isBefore(doc['ts'].value)", true},
+		{"date comparison", "ZonedDateTime.parse(doc['ts'].value) > Instant.ofEpochMilli(0)", true},
+		{"date concatenation", "'at ' + Instant.ofEpochMilli(0)", "at 1970-01-01T00:00:00.000Z"},
+		{"Date.parse millis arithmetic", "(Date.parse(params.now) - doc['ts'].value.getMillis()) / 86400000 > 150", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContext(doc, doc, params)
+			got, err := engine.Execute(NewScript(tt.source, nil), ctx)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() = %v (%T), want %v", got, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateTimeJSON(t *testing.T) {
+	engine := NewEngine()
+	ctx := NewContext(nil, nil, nil)
+	got, err := engine.Execute(NewScript("Instant.ofEpochMilli(1705314600000L)", nil), ctx)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	data, err := json.Marshal(map[string]interface{}{"ts": got})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if want := `{"ts":"2024-01-15T10:30:00.000Z"}`; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+
+	if _, err := engine.Execute(NewScript("'not a date'.getMillis()", nil), ctx); err == nil {
+		t.Error("expected error for unparseable date")
+	}
+}
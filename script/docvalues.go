@@ -0,0 +1,350 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// doc 值语义（对齐 ES ScriptDocValues）：
+//   - doc['f'] 总是返回多值集合，字段缺失时为空集合
+//   - .value 返回第一个值（缺失时为 null），.values / .length / size() 访问全部值
+//   - 值按升序排列；date 字段转换为 ZonedDateTime，geo_point 字段转换为 GeoPoint
+
+// earthMeanRadius 地球平均半径（米），与 ES GeoUtils.EARTH_MEAN_RADIUS 一致
+const earthMeanRadius = 6371008.7714
+
+// docAccessor doc 对象
+type docAccessor struct {
+	ctx *Context
+}
+
+// docField doc['field'] 返回的字段值集合
+type docField struct {
+	ctx   *Context
+	field string
+}
+
+// geoPoint 地理坐标点
+type geoPoint struct {
+	lat float64
+	lon float64
+}
+
+func (p geoPoint) String() string {
+	return fmt.Sprintf("%v, %v", p.lat, p.lon)
+}
+
+// MarshalJSON 按 ES 格式输出 {"lat": .., "lon": ..}
+func (p geoPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]float64{"lat": p.lat, "lon": p.lon})
+}
+
+// call 调用 GeoPoint 方法
+func (p geoPoint) call(method string) (interface{}, error) {
+	switch method {
+	case "getLat":
+		return p.lat, nil
+	case "getLon":
+		return p.lon, nil
+	case "toString":
+		return p.String(), nil
+	}
+	return nil, fmt.Errorf("unknown method [%s] on [GeoPoint]", method)
+}
+
+// raw 返回字段原始值（优先 doc，其次 _source，支持 a.b 形式的对象路径）
+func (f docField) raw() (interface{}, bool) {
+	if f.ctx.Doc != nil {
+		if v, ok := f.ctx.Doc[f.field]; ok {
+			return v, true
+		}
+	}
+	if f.ctx.Source != nil {
+		if v, ok := f.ctx.Source[f.field]; ok {
+			return v, true
+		}
+		if strings.Contains(f.field, ".") {
+			return sourcePath(f.ctx.Source, strings.Split(f.field, "."))
+		}
+	}
+	return nil, false
+}
+
+// sourcePath 沿对象路径取值，路径上的对象数组会展开为多值
+func sourcePath(v interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return v, true
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		child, ok := val[path[0]]
+		if !ok {
+			return nil, false
+		}
+		return sourcePath(child, path[1:])
+	case []interface{}:
+		var items []interface{}
+		for _, item := range val {
+			if child, ok := sourcePath(item, path); ok {
+				items = append(items, child)
+			}
+		}
+		return items, len(items) > 0
+	}
+	return nil, false
+}
+
+// fieldType 返回字段的映射类型
+func (f docField) fieldType() string {
+	if f.ctx.FieldTypes == nil {
+		return ""
+	}
+	return f.ctx.FieldTypes[f.field]
+}
+
+// values 返回字段的全部值（已展开、转换类型并排序），缺失时为空集合
+func (f docField) values() []interface{} {
+	items := []interface{}{}
+	raw, ok := f.raw()
+	if !ok {
+		return items
+	}
+	fieldType := f.fieldType()
+	items = appendDocValues(items, raw, fieldType)
+	if fieldType != "geo_point" {
+		sort.SliceStable(items, func(i, j int) bool {
+			return lessValue(items[i], items[j])
+		})
+	}
+	return items
+}
+
+// value 返回第一个值，字段缺失时为 null
+func (f docField) value() interface{} {
+	items := f.values()
+	if len(items) == 0 {
+		return nil
+	}
+	return items[0]
+}
+
+// member 读取 doc['field'] 的属性
+func (f docField) member(name string) (interface{}, bool) {
+	switch name {
+	case "value":
+		return f.value(), true
+	case "values":
+		return f.values(), true
+	case "length":
+		return float64(len(f.values())), true
+	case "empty":
+		return len(f.values()) == 0, true
+	case "lat", "lon":
+		p, ok := f.value().(geoPoint)
+		if !ok {
+			return nil, true
+		}
+		if name == "lat" {
+			return p.lat, true
+		}
+		return p.lon, true
+	}
+	return nil, false
+}
+
+// call 调用 doc['field'] 的方法，未知方法按 List 处理
+func (f docField) call(method string, args []interface{}) (interface{}, error) {
+	items := f.values()
+	switch method {
+	case "size":
+		return float64(len(items)), nil
+	case "isEmpty":
+		return len(items) == 0, nil
+	case "getValue":
+		return f.value(), nil
+	case "getValues":
+		return items, nil
+	case "get":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("method [get] expects 1 argument")
+		}
+		return getIndex(items, args[0])
+	case "getLat", "getLon":
+		p, err := f.firstPoint()
+		if err != nil {
+			return nil, err
+		}
+		return p.call(method)
+	case "arcDistance", "planeDistance":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("method [%s] expects 2 arguments", method)
+		}
+		p, err := f.firstPoint()
+		if err != nil {
+			return nil, err
+		}
+		lat, lon := toFloat64(args[0]), toFloat64(args[1])
+		if method == "arcDistance" {
+			return arcDistance(p.lat, p.lon, lat, lon), nil
+		}
+		return planeDistance(p.lat, p.lon, lat, lon), nil
+	}
+	return callMethod(items, method, args)
+}
+
+// firstPoint 返回 geo_point 字段的第一个坐标
+func (f docField) firstPoint() (geoPoint, error) {
+	switch v := f.value().(type) {
+	case geoPoint:
+		return v, nil
+	case nil:
+		return geoPoint{}, fmt.Errorf("no value for field [%s]; use doc['%s'].size() == 0 to check if a document is missing a field", f.field, f.field)
+	}
+	return geoPoint{}, fmt.Errorf("field [%s] is not a geo_point", f.field)
+}
+
+// appendDocValues 展开多值字段并按映射类型转换
+func appendDocValues(items []interface{}, v interface{}, fieldType string) []interface{} {
+	switch val := v.(type) {
+	case nil:
+		return items
+	case []interface{}:
+		// geo_point 的 [lon, lat] 数组表示单个坐标
+		if fieldType == "geo_point" {
+			if p, ok := toGeoPoint(val); ok {
+				return append(items, p)
+			}
+		}
+		for _, item := range val {
+			items = appendDocValues(items, item, fieldType)
+		}
+		return items
+	case []float64:
+		if fieldType == "geo_point" {
+			if p, ok := toGeoPoint(val); ok {
+				return append(items, p)
+			}
+		}
+		for _, item := range val {
+			items = append(items, item)
+		}
+		return items
+	case []string:
+		for _, item := range val {
+			items = appendDocValues(items, item, fieldType)
+		}
+		return items
+	}
+	return append(items, convertDocValue(v, fieldType))
+}
+
+// convertDocValue 按映射类型转换单个值
+func convertDocValue(v interface{}, fieldType string) interface{} {
+	if t, ok := v.(time.Time); ok {
+		return zonedDateTime{t: t}
+	}
+	switch fieldType {
+	case "date", "date_nanos":
+		if t, ok := asDateTime(v); ok {
+			return zonedDateTime{t: t}
+		}
+	case "geo_point":
+		if p, ok := toGeoPoint(v); ok {
+			return p
+		}
+	case "long", "integer", "short", "byte", "double", "float", "half_float", "scaled_float", "unsigned_long":
+		if s, ok := v.(string); ok {
+			if num, err := strconv.ParseFloat(s, 64); err == nil {
+				return num
+			}
+		}
+	case "boolean":
+		if s, ok := v.(string); ok {
+			return s == "true"
+		}
+	}
+	switch val := v.(type) {
+	case int:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case float32:
+		return float64(val)
+	}
+	return v
+}
+
+// toGeoPoint 解析 geo_point 的常见表示：{"lat","lon"}、[lon, lat]、"lat,lon"
+func toGeoPoint(v interface{}) (geoPoint, bool) {
+	switch val := v.(type) {
+	case geoPoint:
+		return val, true
+	case map[string]interface{}:
+		lat, latOK := val["lat"]
+		lon, lonOK := val["lon"]
+		if latOK && lonOK {
+			return geoPoint{lat: toFloat64(lat), lon: toFloat64(lon)}, true
+		}
+	case []interface{}:
+		if len(val) == 2 && isNumber(val[0]) && isNumber(val[1]) {
+			return geoPoint{lat: toFloat64(val[1]), lon: toFloat64(val[0])}, true
+		}
+	case []float64:
+		if len(val) == 2 {
+			return geoPoint{lat: val[1], lon: val[0]}, true
+		}
+	case string:
+		parts := strings.Split(val, ",")
+		if len(parts) == 2 {
+			lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+			lon, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			if err1 == nil && err2 == nil {
+				return geoPoint{lat: lat, lon: lon}, true
+			}
+		}
+	}
+	return geoPoint{}, false
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case float64, float32, int, int64, int32:
+		return true
+	}
+	return false
+}
+
+// arcDistance 球面距离（米，haversine 公式）
+func arcDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthMeanRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// planeDistance 平面近似距离（米），较 arcDistance 快但远距离误差较大
+func planeDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	x := (lon2 - lon1) * math.Pi / 180 * math.Cos((lat1+lat2)/2*math.Pi/180)
+	y := (lat2 - lat1) * math.Pi / 180
+	return math.Sqrt(x*x+y*y) * earthMeanRadius
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDocValues(t *testing.T) {
+	engine := NewEngine()
+	source := map[string]interface{}{
+		"tags":     []interface{}{"red", "blue", "green"},
+		"scores":   []interface{}{30.0, 10.0, 20.0},
+		"price":    "19.5",
+		"created":  "2024-01-15T10:30:00Z",
+		"location": map[string]interface{}{"lat": 40.7128, "lon": -74.006},
+		"shops":    []interface{}{[]interface{}{2.3522, 48.8566}, "51.5074,-0.1278"},
+		"user":     map[string]interface{}{"name": "kimchy", "roles": []interface{}{"admin", "dev"}},
+	}
+	fieldTypes := map[string]string{
+		"price":    "double",
+		"created":  "date",
+		"location": "geo_point",
+		"shops":    "geo_point",
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   interface{}
+	}{
+		{"first value is smallest", "doc['tags'].value", "blue"},
+		{"values", "doc['tags'].values.length", 3.0},
+		{"length", "doc['tags'].length", 3.0},
+		{"size", "doc['scores'].size()", 3.0},
+		{"get", "doc['scores'].get(2)", 30.0},
+		{"index", "doc['scores'][0]", 10.0},
+		{"contains", "doc['tags'].contains('green')", true},
+		{"list method fallback", "doc['tags'].indexOf('red')", 2.0},
+		{"for each", "def sum = 0; for (def s : doc['scores']) { sum += s } return sum", 60.0},
+		{"missing size", "doc['missing'].size() == 0", true},
+		{"missing isEmpty", "doc['missing'].isEmpty()", true},
+		{"missing empty", "doc['missing'].empty", true},
+		{"missing value", "doc['missing'].value == null", true},
+		{"numeric from string", "doc['price'].value * 2", 39.0},
+		{"date value", "doc['created'].value.getYear()", 2024.0},
+		{"date millis", "doc['created'].value.toEpochMilli()", 1705314600000.0},
+		{"dotted path", "doc['user.name'].value", "kimchy"},
+		{"dotted path multi", "doc['user.roles'].size()", 2.0},
+		{"geo lat", "doc['location'].lat", 40.7128},
+		{"geo getLon", "doc['location'].getLon()", -74.006},
+		{"geo value", "doc['location'].value.getLat()", 40.7128},
+		{"geo multi", "doc['shops'].size()", 2.0},
+		{"geo array as lon lat", "doc['shops'][0].lat", 48.8566},
+		{"geo string as lat lon", "doc['shops'][1].lon", -0.1278},
+		{"arcDistance zero", "doc['location'].arcDistance(40.7128, -74.006)", 0.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContext(nil, source, nil)
+			ctx.FieldTypes = fieldTypes
+			got, err := engine.Execute(NewScript(tt.source, nil), ctx)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() = %v (%T), want %v", got, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocValuesTypedFields(t *testing.T) {
+	engine := NewEngine()
+	ts := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	doc := map[string]interface{}{
+		"ts":   ts,
+		"nums": []interface{}{5, int64(3)},
+	}
+	ctx := NewContext(doc, nil, nil)
+
+	got, err := engine.Execute(NewScript("doc['ts'].value.getMonthValue()", nil), ctx)
+	if err != nil || got != 3.0 {
+		t.Errorf("time.Time field = %v, %v; want 3", got, err)
+	}
+	got, err = engine.Execute(NewScript("doc['nums'].value", nil), ctx)
+	if err != nil || got != 3.0 {
+		t.Errorf("int field = %v, %v; want 3", got, err)
+	}
+}
+
+func TestDocValuesGeoDistance(t *testing.T) {
+	engine := NewEngine()
+	source := map[string]interface{}{"location": "48.8566,2.3522"}
+	ctx := NewContext(nil, source, map[string]interface{}{"lat": 51.5074, "lon": -0.1278})
+	ctx.FieldTypes = map[string]string{"location": "geo_point"}
+
+	// 巴黎到伦敦约 343.5 公里
+	for _, method := range []string{"arcDistance", "planeDistance"} {
+		got, err := engine.Execute(NewScript("doc['location']."+method+"(params.lat, params.lon)", nil), ctx)
+		if err != nil {
+			t.Fatalf("%s error = %v", method, err)
+		}
+		if d := toFloat64(got); math.Abs(d-343500) > 2000 {
+			t.Errorf("%s = %v, want about 343500", method, d)
+		}
+	}
+
+	ctx = NewContext(nil, map[string]interface{}{}, nil)
+	if _, err := engine.Execute(NewScript("doc['location'].getLat()", nil), ctx); err == nil {
+		t.Error("expected error for missing geo_point field")
+	}
+}
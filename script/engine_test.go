@@ -15,6 +15,7 @@
 package script
 
 import (
+	"fmt"
 	"math"
 	"testing"
 )
@@ -76,6 +77,62 @@ func TestParseScript(t *testing.T) {
 	}
 }
 
+func TestParseScriptStoredID(t *testing.T) {
+	loads := 0
+	SetStoredScriptLoader(func(id string) (string, string, error) {
+		loads++
+		switch id {
+		case "discount":
+			return "painless", "ctx._source.price *= params.factor", nil
+		case "tmpl":
+			return "mustache", `{"query":{"match_all":{}}}`, nil
+		}
+		return "", "", fmt.Errorf("not found")
+	})
+	defer SetStoredScriptLoader(nil)
+	defer GetGlobalCache().InvalidateStored("discount")
+
+	for i := 0; i < 2; i++ {
+		s, err := ParseScript(map[string]interface{}{
+			"id":     "discount",
+			"params": map[string]interface{}{"factor": 0.5},
+		})
+		if err != nil {
+			t.Fatalf("ParseScript(id) error = %v", err)
+		}
+		if s.ID != "discount" || s.Lang != "painless" || s.Params["factor"] != 0.5 {
+			t.Fatalf("unexpected stored script: %+v", s)
+		}
+
+		ctx := NewContext(nil, map[string]interface{}{"price": 10.0}, nil)
+		if _, err := NewEngine().Execute(s, ctx); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if ctx.Source["price"] != 5.0 {
+			t.Errorf("expected price 5, got %v", ctx.Source["price"])
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected stored script to be loaded once and cached, got %d loads", loads)
+	}
+
+	GetGlobalCache().InvalidateStored("discount")
+	if _, err := ParseScript(map[string]interface{}{"id": "discount"}); err != nil || loads != 2 {
+		t.Errorf("expected reload after invalidation, err = %v, loads = %d", err, loads)
+	}
+
+	if _, err := ParseScript(map[string]interface{}{"id": "missing"}); err == nil {
+		t.Error("expected error for missing stored script")
+	}
+	if _, err := ParseScript(map[string]interface{}{"id": "tmpl"}); err == nil {
+		t.Error("expected error for mustache stored script")
+	}
+	GetGlobalCache().InvalidateStored("tmpl")
+	if _, err := ParseScript(map[string]interface{}{"id": "discount", "source": "1"}); err == nil {
+		t.Error("expected error when both id and source are specified")
+	}
+}
+
 func TestEngineExecuteFilter(t *testing.T) {
 	engine := NewEngine()
 
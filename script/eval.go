@@ -0,0 +1,1109 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 表达式求值
+// 内置对象：
+//   - doc：文档字段，doc['field'].value 或 doc.field
+//   - params：脚本参数
+//   - _source / ctx._source：文档源数据（更新脚本可修改）
+//   - ctx：更新、聚合脚本上下文（ctx.op、state、states 等）
+//   - _score：文档评分
+//   - Math、Date：静态函数
+//   - Instant、ZonedDateTime、Duration、ChronoUnit 等：日期时间（见 date.go）
+
+// staticClass 静态类（Math、Date 以及 java.time 风格的日期类）
+type staticClass struct {
+	name string
+}
+
+// simpleDateFormat SimpleDateFormat 对象
+type simpleDateFormat struct {
+	pattern string
+}
+
+var staticClasses = map[string]bool{
+	"Math":              true,
+	"Date":              true,
+	"Instant":           true,
+	"ZonedDateTime":     true,
+	"Duration":          true,
+	"ChronoUnit":        true,
+	"ZoneId":            true,
+	"ZoneOffset":        true,
+	"DateTimeFormatter": true,
+}
+
+// 不能作为赋值目标的内置对象
+var readonlyIdents = map[string]bool{
+	"doc":    true,
+	"params": true,
+	"ctx":    true,
+	"_score": true,
+}
+
+// eval 对表达式求值
+func (e *Engine) eval(n exprNode, ctx *Context) (interface{}, error) {
+	switch node := n.(type) {
+	case *literalExpr:
+		return node.value, nil
+
+	case *identExpr:
+		return e.lookupIdent(node.name, ctx)
+
+	case *memberExpr:
+		obj, err := e.eval(node.object, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if isNil(obj) {
+			return nil, nil
+		}
+		return getMember(obj, node.name)
+
+	case *indexExpr:
+		obj, err := e.eval(node.object, ctx)
+		if err != nil {
+			return nil, err
+		}
+		index, err := e.eval(node.index, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return getIndex(obj, index)
+
+	case *callExpr:
+		return e.evalCall(node, ctx)
+
+	case *newExpr:
+		args, err := e.evalArgs(node.args, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return newObject(node.typeName, args)
+
+	case *castExpr:
+		v, err := e.eval(node.operand, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return castValue(node.typeName, v), nil
+
+	case *unaryExpr:
+		v, err := e.eval(node.operand, ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch node.op {
+		case "!":
+			return !toBool(v), nil
+		case "-":
+			return -toFloat64(v), nil
+		default:
+			return toFloat64(v), nil
+		}
+
+	case *updateExpr:
+		current, err := e.eval(node.target, ctx)
+		if err != nil {
+			return nil, err
+		}
+		old := toFloat64(current)
+		updated := old + 1
+		if node.op == "--" {
+			updated = old - 1
+		}
+		if err := e.assign(node.target, updated, ctx); err != nil {
+			return nil, err
+		}
+		if node.prefix {
+			return updated, nil
+		}
+		return old, nil
+
+	case *binaryExpr:
+		v, err := e.evalBinary(node, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return v, ctx.run.checkSize(v)
+
+	case *conditionalExpr:
+		cond, err := e.eval(node.cond, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if toBool(cond) {
+			return e.eval(node.then, ctx)
+		}
+		return e.eval(node.otherwise, ctx)
+
+	case *elvisExpr:
+		left, err := e.eval(node.left, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !isNil(left) {
+			return left, nil
+		}
+		return e.eval(node.right, ctx)
+
+	case *assignExpr:
+		value, err := e.eval(node.value, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if node.op != "=" {
+			current, err := e.eval(node.target, ctx)
+			if err != nil {
+				return nil, err
+			}
+			value = binaryOp(strings.TrimSuffix(node.op, "="), current, value)
+		}
+		if err := ctx.run.checkSize(value); err != nil {
+			return nil, err
+		}
+		if err := e.assign(node.target, value, ctx); err != nil {
+			return nil, err
+		}
+		return value, nil
+
+	case *listExpr:
+		return e.evalArgs(node.elements, ctx)
+
+	case *mapExpr:
+		m := make(map[string]interface{}, len(node.keys))
+		for i := range node.keys {
+			key, err := e.eval(node.keys[i], ctx)
+			if err != nil {
+				return nil, err
+			}
+			value, err := e.eval(node.values[i], ctx)
+			if err != nil {
+				return nil, err
+			}
+			m[toString(key)] = value
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported expression node %T", n)
+}
+
+// lookupIdent 解析标识符：局部变量 > 内置对象 > ctx 中的变量（如 state、states）
+func (e *Engine) lookupIdent(name string, ctx *Context) (interface{}, error) {
+	if ctx.Variables != nil {
+		if v, ok := ctx.Variables[name]; ok {
+			return v, nil
+		}
+	}
+	switch name {
+	case "doc":
+		return docAccessor{ctx: ctx}, nil
+	case "params":
+		return ctx.Params, nil
+	case "_source":
+		return ctx.Source, nil
+	case "ctx":
+		return ctx.Ctx, nil
+	case "_score":
+		return ctx.Score, nil
+	}
+	if staticClasses[name] {
+		return staticClass{name: name}, nil
+	}
+	if v, ok := ctx.Ctx[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot resolve symbol [%s]", name)
+}
+
+// isLocal 判断标识符是否为局部变量
+func isLocal(name string, ctx *Context) bool {
+	_, ok := ctx.Variables[name]
+	return ok
+}
+
+// getMember 读取对象成员
+func getMember(obj interface{}, name string) (interface{}, error) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		return o[name], nil
+	case docAccessor:
+		return docField{ctx: o.ctx, field: name}.value(), nil
+	case docField:
+		if v, ok := o.member(name); ok {
+			return v, nil
+		}
+	case geoPoint:
+		switch name {
+		case "lat":
+			return o.lat, nil
+		case "lon":
+			return o.lon, nil
+		}
+	case []interface{}:
+		if name == "length" {
+			return float64(len(o)), nil
+		}
+	case staticClass:
+		if o.name == "Math" {
+			switch name {
+			case "PI":
+				return math.Pi, nil
+			case "E":
+				return math.E, nil
+			}
+		}
+		if v, ok := getDateMember(o.name, name); ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot access field [%s] on [%s]", name, typeName(obj))
+}
+
+// getIndex 读取下标
+func getIndex(obj, index interface{}) (interface{}, error) {
+	switch o := obj.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return o[toString(index)], nil
+	case docAccessor:
+		return docField{ctx: o.ctx, field: toString(index)}, nil
+	case docField:
+		return getIndex(o.values(), index)
+	case []interface{}:
+		i := int(toFloat64(index))
+		if i < 0 || i >= len(o) {
+			return nil, fmt.Errorf("index [%d] out of bounds for length [%d]", i, len(o))
+		}
+		return o[i], nil
+	case string:
+		i := int(toFloat64(index))
+		if i < 0 || i >= len(o) {
+			return nil, fmt.Errorf("index [%d] out of bounds for length [%d]", i, len(o))
+		}
+		return o[i : i+1], nil
+	}
+	return nil, fmt.Errorf("cannot index [%s]", typeName(obj))
+}
+
+// assign 写入赋值目标
+func (e *Engine) assign(target exprNode, value interface{}, ctx *Context) error {
+	switch t := target.(type) {
+	case *identExpr:
+		if t.name == "_source" && !isLocal(t.name, ctx) {
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("_source must be a map")
+			}
+			ctx.Source = m
+			ctx.Ctx["_source"] = m
+			return nil
+		}
+		if readonlyIdents[t.name] && !isLocal(t.name, ctx) {
+			return fmt.Errorf("cannot assign a value to [%s]", t.name)
+		}
+		if _, ok := ctx.Ctx[t.name]; ok && !isLocal(t.name, ctx) {
+			ctx.Ctx[t.name] = value
+			return nil
+		}
+		if ctx.Variables == nil {
+			ctx.Variables = make(map[string]interface{})
+		}
+		ctx.Variables[t.name] = value
+		return nil
+
+	case *memberExpr:
+		container, err := e.container(t.object, ctx)
+		if err != nil {
+			return err
+		}
+		container[t.name] = value
+		return nil
+
+	case *indexExpr:
+		obj, err := e.eval(t.object, ctx)
+		if err != nil {
+			return err
+		}
+		index, err := e.eval(t.index, ctx)
+		if err != nil {
+			return err
+		}
+		if list, ok := obj.([]interface{}); ok {
+			i := int(toFloat64(index))
+			switch {
+			case i >= 0 && i < len(list):
+				list[i] = value
+				return nil
+			case i == len(list) && isAssignable(t.object):
+				return e.assign(t.object, append(list, value), ctx)
+			}
+			return fmt.Errorf("index [%d] out of bounds for length [%d]", i, len(list))
+		}
+		container, err := e.container(t.object, ctx)
+		if err != nil {
+			return err
+		}
+		container[toString(index)] = value
+		return nil
+	}
+	return fmt.Errorf("invalid assignment target")
+}
+
+// container 返回可写入成员的 Map，目标不存在时自动创建（如 ctx._source.a.b = 1）
+func (e *Engine) container(n exprNode, ctx *Context) (map[string]interface{}, error) {
+	v, err := e.eval(n, ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch m := v.(type) {
+	case map[string]interface{}:
+		if m != nil {
+			return m, nil
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("cannot assign field on [%s]", typeName(v))
+	}
+	if !isAssignable(n) {
+		return nil, fmt.Errorf("cannot assign field on null")
+	}
+	m := make(map[string]interface{})
+	if err := e.assign(n, m, ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (e *Engine) evalArgs(nodes []exprNode, ctx *Context) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		v, err := e.eval(n, ctx)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	return args, nil
+}
+
+// evalCall 执行函数或方法调用
+func (e *Engine) evalCall(n *callExpr, ctx *Context) (interface{}, error) {
+	switch callee := n.callee.(type) {
+	case *memberExpr:
+		if id, ok := callee.object.(*identExpr); ok && staticClasses[id.name] && !isLocal(id.name, ctx) {
+			args, err := e.evalArgs(n.args, ctx)
+			if err != nil {
+				return nil, err
+			}
+			return callStatic(id.name, callee.name, args)
+		}
+
+		recv, err := e.eval(callee.object, ctx)
+		if err != nil {
+			return nil, err
+		}
+		args, err := e.evalArgs(n.args, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// List 修改类方法：结果写回接收者（目标不存在时按空列表处理）
+		if list, ok := recv.([]interface{}); ok || recv == nil {
+			if updated, result, handled, err := mutateList(list, callee.name, args); handled {
+				if err != nil {
+					return nil, err
+				}
+				if err := ctx.run.checkSize(updated); err != nil {
+					return nil, err
+				}
+				if isAssignable(callee.object) {
+					if err := e.assign(callee.object, updated, ctx); err != nil {
+						return nil, err
+					}
+				}
+				return result, nil
+			}
+		}
+
+		if isNil(recv) {
+			if callee.nullSafe {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("cannot invoke method [%s] on null", callee.name)
+		}
+		result, err := callMethod(recv, callee.name, args)
+		if err != nil {
+			return nil, err
+		}
+		// Map.put 等方法原地修改接收者
+		if err := ctx.run.checkSize(recv); err != nil {
+			return nil, err
+		}
+		return result, ctx.run.checkSize(result)
+
+	case *identExpr:
+		args, err := e.evalArgs(n.args, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if callee.name == "SimpleDateFormat" {
+			return newObject(callee.name, args)
+		}
+		return nil, fmt.Errorf("unknown function [%s]", callee.name)
+	}
+	return nil, fmt.Errorf("invalid call expression")
+}
+
+// evalBinary 二元运算（&& / || 短路求值）
+func (e *Engine) evalBinary(n *binaryExpr, ctx *Context) (interface{}, error) {
+	left, err := e.eval(n.left, ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&":
+		if !toBool(left) {
+			return false, nil
+		}
+		right, err := e.eval(n.right, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(right), nil
+	case "||":
+		if toBool(left) {
+			return true, nil
+		}
+		right, err := e.eval(n.right, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(right), nil
+	}
+
+	right, err := e.eval(n.right, ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==", "!=", "<", ">", "<=", ">=":
+		return compare(left, right, n.op), nil
+	}
+	return binaryOp(n.op, left, right), nil
+}
+
+// binaryOp 算术运算（+ 在任一操作数为字符串时执行拼接）
+func binaryOp(op string, left, right interface{}) interface{} {
+	if op == "+" {
+		_, ls := left.(string)
+		_, rs := right.(string)
+		if ls || rs {
+			return toString(left) + toString(right)
+		}
+	}
+	l := toFloat64(left)
+	r := toFloat64(right)
+	switch op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			return 0.0
+		}
+		return l / r
+	case "%":
+		if int64(r) == 0 {
+			return 0.0
+		}
+		return float64(int64(l) % int64(r))
+	}
+	return nil
+}
+
+// castValue 类型转换
+func castValue(typeName string, v interface{}) interface{} {
+	switch typeName {
+	case "int", "long", "short", "byte", "char", "Integer", "Long":
+		return math.Trunc(toFloat64(v))
+	case "double", "float", "Double", "Float":
+		return toFloat64(v)
+	case "boolean", "Boolean":
+		return toBool(v)
+	case "String":
+		if v == nil {
+			return nil
+		}
+		return toString(v)
+	}
+	return v
+}
+
+// newObject 构造对象
+func newObject(typeName string, args []interface{}) (interface{}, error) {
+	switch typeName {
+	case "ArrayList", "LinkedList", "List", "HashSet", "TreeSet", "Set":
+		list := make([]interface{}, 0)
+		if len(args) > 0 {
+			if src, ok := args[0].([]interface{}); ok {
+				list = append(list, src...)
+			}
+		}
+		return list, nil
+	case "HashMap", "LinkedHashMap", "TreeMap", "Map":
+		m := make(map[string]interface{})
+		if len(args) > 0 {
+			if src, ok := args[0].(map[string]interface{}); ok {
+				for k, v := range src {
+					m[k] = v
+				}
+			}
+		}
+		return m, nil
+	case "SimpleDateFormat":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("SimpleDateFormat requires a pattern")
+		}
+		return &simpleDateFormat{pattern: toString(args[0])}, nil
+	}
+	return nil, fmt.Errorf("cannot resolve type [%s]", typeName)
+}
+
+// mutateList 执行 List 的修改类方法，返回修改后的列表与方法返回值
+func mutateList(list []interface{}, method string, args []interface{}) (updated []interface{}, result interface{}, handled bool, err error) {
+	switch method {
+	case "add":
+		switch len(args) {
+		case 1:
+			return append(list, args[0]), true, true, nil
+		case 2:
+			i := int(toFloat64(args[0]))
+			if i < 0 || i > len(list) {
+				return nil, nil, true, fmt.Errorf("index [%d] out of bounds for length [%d]", i, len(list))
+			}
+			updated = make([]interface{}, 0, len(list)+1)
+			updated = append(updated, list[:i]...)
+			updated = append(updated, args[1])
+			updated = append(updated, list[i:]...)
+			return updated, nil, true, nil
+		}
+		return nil, nil, true, fmt.Errorf("add requires 1 or 2 arguments")
+
+	case "addAll":
+		if len(args) != 1 {
+			return nil, nil, true, fmt.Errorf("addAll requires 1 argument")
+		}
+		items, _ := args[0].([]interface{})
+		return append(list, items...), len(items) > 0, true, nil
+
+	case "remove":
+		if len(args) != 1 {
+			return nil, nil, true, fmt.Errorf("remove requires 1 argument")
+		}
+		// 数字参数按下标删除，其他按值删除
+		if _, isNum := args[0].(float64); isNum {
+			i := int(toFloat64(args[0]))
+			if i < 0 || i >= len(list) {
+				return nil, nil, true, fmt.Errorf("index [%d] out of bounds for length [%d]", i, len(list))
+			}
+			removed := list[i]
+			updated = make([]interface{}, 0, len(list)-1)
+			updated = append(updated, list[:i]...)
+			updated = append(updated, list[i+1:]...)
+			return updated, removed, true, nil
+		}
+		updated = make([]interface{}, 0, len(list))
+		found := false
+		for _, item := range list {
+			if !found && compare(item, args[0], "==") {
+				found = true
+				continue
+			}
+			updated = append(updated, item)
+		}
+		return updated, found, true, nil
+
+	case "removeAll":
+		if len(args) != 1 {
+			return nil, nil, true, fmt.Errorf("removeAll requires 1 argument")
+		}
+		items, _ := args[0].([]interface{})
+		updated = make([]interface{}, 0, len(list))
+		for _, item := range list {
+			if !listContains(items, item) {
+				updated = append(updated, item)
+			}
+		}
+		return updated, len(updated) != len(list), true, nil
+
+	case "clear":
+		return make([]interface{}, 0), nil, true, nil
+	}
+	return nil, nil, false, nil
+}
+
+// callMethod 执行对象方法
+func callMethod(obj interface{}, method string, args []interface{}) (interface{}, error) {
+	arg := func(i int) interface{} {
+		if i < len(args) {
+			return args[i]
+		}
+		return nil
+	}
+
+	switch o := obj.(type) {
+	case docField:
+		return o.call(method, args)
+	case geoPoint:
+		return o.call(method)
+	}
+
+	// 字符串、时间戳调用日期方法时按日期解析（如 doc['ts'].value.getMillis()）
+	if dateMethods[method] {
+		if t, ok := asDateTime(obj); ok {
+			return callDateTimeMethod(t, method, args)
+		}
+	}
+
+	switch o := obj.(type) {
+	case string:
+		switch method {
+		case "length":
+			return float64(len(o)), nil
+		case "isEmpty":
+			return o == "", nil
+		case "contains":
+			return strings.Contains(o, toString(arg(0))), nil
+		case "startsWith":
+			return strings.HasPrefix(o, toString(arg(0))), nil
+		case "endsWith":
+			return strings.HasSuffix(o, toString(arg(0))), nil
+		case "toLowerCase":
+			return strings.ToLower(o), nil
+		case "toUpperCase":
+			return strings.ToUpper(o), nil
+		case "trim":
+			return strings.TrimSpace(o), nil
+		case "substring":
+			start := clampIndex(int(toFloat64(arg(0))), len(o))
+			end := len(o)
+			if len(args) >= 2 {
+				end = clampIndex(int(toFloat64(arg(1))), len(o))
+			}
+			if end < start {
+				end = start
+			}
+			return o[start:end], nil
+		case "indexOf":
+			return float64(strings.Index(o, toString(arg(0)))), nil
+		case "lastIndexOf":
+			return float64(strings.LastIndex(o, toString(arg(0)))), nil
+		case "charAt":
+			i := int(toFloat64(arg(0)))
+			if i < 0 || i >= len(o) {
+				return nil, fmt.Errorf("index [%d] out of bounds for length [%d]", i, len(o))
+			}
+			return o[i : i+1], nil
+		case "replace":
+			return strings.Replace(o, toString(arg(0)), toString(arg(1)), -1), nil
+		case "split":
+			parts := strings.Split(o, toString(arg(0)))
+			result := make([]interface{}, len(parts))
+			for i, p := range parts {
+				result[i] = p
+			}
+			return result, nil
+		case "matches":
+			re, err := regexp.Compile("^(?:" + toString(arg(0)) + ")$")
+			if err != nil {
+				return false, fmt.Errorf("invalid regex pattern: %w", err)
+			}
+			return re.MatchString(o), nil
+		case "replaceAll":
+			re, err := regexp.Compile(toString(arg(0)))
+			if err != nil {
+				return "", fmt.Errorf("invalid regex pattern: %w", err)
+			}
+			return re.ReplaceAllString(o, toString(arg(1))), nil
+		case "equals":
+			return o == toString(arg(0)), nil
+		case "equalsIgnoreCase":
+			return strings.EqualFold(o, toString(arg(0))), nil
+		case "compareTo":
+			return float64(strings.Compare(o, toString(arg(0)))), nil
+		case "concat":
+			return o + toString(arg(0)), nil
+		case "toString":
+			return o, nil
+		}
+
+	case []interface{}:
+		switch method {
+		case "size", "length":
+			return float64(len(o)), nil
+		case "isEmpty":
+			return len(o) == 0, nil
+		case "get":
+			i := int(toFloat64(arg(0)))
+			if i < 0 || i >= len(o) {
+				return nil, fmt.Errorf("index [%d] out of bounds for length [%d]", i, len(o))
+			}
+			return o[i], nil
+		case "set":
+			i := int(toFloat64(arg(0)))
+			if i < 0 || i >= len(o) {
+				return nil, fmt.Errorf("index [%d] out of bounds for length [%d]", i, len(o))
+			}
+			old := o[i]
+			o[i] = arg(1)
+			return old, nil
+		case "contains":
+			return listContains(o, arg(0)), nil
+		case "indexOf":
+			for i, item := range o {
+				if compare(item, arg(0), "==") {
+					return float64(i), nil
+				}
+			}
+			return -1.0, nil
+		case "sort":
+			sort.SliceStable(o, func(i, j int) bool { return lessValue(o[i], o[j]) })
+			return nil, nil
+		}
+
+	case map[string]interface{}:
+		switch method {
+		case "size":
+			return float64(len(o)), nil
+		case "isEmpty":
+			return len(o) == 0, nil
+		case "get":
+			return o[toString(arg(0))], nil
+		case "getOrDefault":
+			if v, ok := o[toString(arg(0))]; ok {
+				return v, nil
+			}
+			return arg(1), nil
+		case "containsKey", "contains":
+			_, ok := o[toString(arg(0))]
+			return ok, nil
+		case "containsValue":
+			for _, v := range o {
+				if compare(v, arg(0), "==") {
+					return true, nil
+				}
+			}
+			return false, nil
+		case "put":
+			key := toString(arg(0))
+			old := o[key]
+			o[key] = arg(1)
+			return old, nil
+		case "remove":
+			key := toString(arg(0))
+			old := o[key]
+			delete(o, key)
+			return old, nil
+		case "keySet":
+			keys := make([]string, 0, len(o))
+			for k := range o {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			result := make([]interface{}, len(keys))
+			for i, k := range keys {
+				result[i] = k
+			}
+			return result, nil
+		case "values":
+			keys := make([]string, 0, len(o))
+			for k := range o {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			result := make([]interface{}, len(keys))
+			for i, k := range keys {
+				result[i] = o[k]
+			}
+			return result, nil
+		}
+
+	case float64:
+		switch method {
+		case "intValue", "longValue":
+			return math.Trunc(o), nil
+		case "doubleValue", "floatValue":
+			return o, nil
+		case "toString":
+			return toString(o), nil
+		}
+
+	case *simpleDateFormat:
+		if method == "format" {
+			t, ok := asDateTime(arg(0))
+			if !ok {
+				return nil, fmt.Errorf("cannot format [%s] as a date", typeName(arg(0)))
+			}
+			return formatDate(t, o.pattern), nil
+		}
+
+	case zonedDateTime:
+		return callDateTimeMethod(o.t, method, args)
+
+	case duration:
+		return callDurationMethod(o.d, method, args)
+
+	case chronoUnit:
+		if method == "between" {
+			from, ok1 := asDateTime(arg(0))
+			to, ok2 := asDateTime(arg(1))
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("ChronoUnit.%s.between requires two dates", o.name)
+			}
+			return unitsBetween(o.name, from, to)
+		}
+	}
+
+	switch method {
+	case "toString":
+		return toString(obj), nil
+	case "equals":
+		return compare(obj, arg(0), "=="), nil
+	}
+	return nil, fmt.Errorf("unknown method [%s] on [%s]", method, typeName(obj))
+}
+
+// callStatic 执行静态函数（Math.*、Date.*）
+func callStatic(class, method string, args []interface{}) (interface{}, error) {
+	num := func(i int) float64 {
+		if i < len(args) {
+			return toFloat64(args[i])
+		}
+		return 0
+	}
+
+	if result, ok, err := callDateStatic(class, method, args); ok {
+		return result, err
+	}
+
+	if class == "Math" {
+		unary := map[string]func(float64) float64{
+			"abs":   math.Abs,
+			"ceil":  math.Ceil,
+			"floor": math.Floor,
+			"round": math.Round,
+			"sqrt":  math.Sqrt,
+			"cbrt":  math.Cbrt,
+			"log":   math.Log,
+			"log10": math.Log10,
+			"exp":   math.Exp,
+			"sin":   math.Sin,
+			"cos":   math.Cos,
+			"tan":   math.Tan,
+			"asin":  math.Asin,
+			"acos":  math.Acos,
+			"atan":  math.Atan,
+		}
+		if fn, ok := unary[method]; ok {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("Math.%s requires 1 argument", method)
+			}
+			return fn(num(0)), nil
+		}
+		switch method {
+		case "min", "max":
+			if len(args) == 0 {
+				return nil, fmt.Errorf("Math.%s requires arguments", method)
+			}
+			result := num(0)
+			for i := 1; i < len(args); i++ {
+				if (method == "min" && num(i) < result) || (method == "max" && num(i) > result) {
+					result = num(i)
+				}
+			}
+			return result, nil
+		case "pow":
+			if len(args) != 2 {
+				return nil, fmt.Errorf("Math.pow requires 2 arguments")
+			}
+			return math.Pow(num(0), num(1)), nil
+		case "signum":
+			switch v := num(0); {
+			case v > 0:
+				return 1.0, nil
+			case v < 0:
+				return -1.0, nil
+			}
+			return 0.0, nil
+		case "random":
+			return rand.Float64(), nil
+		}
+	}
+
+	if class == "Date" {
+		switch method {
+		case "now":
+			return float64(time.Now().UnixMilli()), nil
+		case "parse":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("Date.parse requires 1 argument")
+			}
+			return parseDateValue(args[0])
+		case "add", "subtract":
+			if len(args) != 3 {
+				return nil, fmt.Errorf("Date.%s requires 3 arguments: timestamp, field, amount", method)
+			}
+			amount := num(2)
+			if method == "subtract" {
+				amount = -amount
+			}
+			return addDateInterval(num(0), toString(args[1]), amount)
+		}
+	}
+
+	return nil, fmt.Errorf("unknown function [%s.%s]", class, method)
+}
+
+// parseDateValue 解析日期字符串或时间戳为毫秒时间戳
+func parseDateValue(v interface{}) (interface{}, error) {
+	if num, ok := v.(float64); ok {
+		return num, nil
+	}
+	t, err := parseTime(v)
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.UnixMilli()), nil
+}
+
+// addDateInterval 在毫秒时间戳上增加时间间隔
+func addDateInterval(ts float64, unit string, amount float64) (interface{}, error) {
+	t, err := addToTime(millisToTime(ts), unit, amount)
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.UnixMilli()), nil
+}
+
+func millisToTime(ms float64) time.Time {
+	return time.UnixMilli(int64(ms))
+}
+
+// formatDate 格式化日期
+func formatDate(t time.Time, pattern string) string {
+	result := pattern
+	result = strings.ReplaceAll(result, "yyyy", fmt.Sprintf("%04d", t.Year()))
+	result = strings.ReplaceAll(result, "MM", fmt.Sprintf("%02d", int(t.Month())))
+	result = strings.ReplaceAll(result, "dd", fmt.Sprintf("%02d", t.Day()))
+	result = strings.ReplaceAll(result, "HH", fmt.Sprintf("%02d", t.Hour()))
+	result = strings.ReplaceAll(result, "mm", fmt.Sprintf("%02d", t.Minute()))
+	result = strings.ReplaceAll(result, "ss", fmt.Sprintf("%02d", t.Second()))
+	return result
+}
+
+func clampIndex(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+func listContains(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if compare(item, v, "==") {
+			return true
+		}
+	}
+	return false
+}
+
+// lessValue 排序比较：字符串按字典序，其他按数值
+func lessValue(a, b interface{}) bool {
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return as < bs
+	}
+	return toFloat64(a) < toFloat64(b)
+}
+
+// isNil 判断值是否为 null（包括值为 nil 的 Map/List）
+func isNil(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return val == nil
+	case []interface{}:
+		return val == nil
+	}
+	return false
+}
+
+// typeName 返回值的脚本类型名（用于错误信息）
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "String"
+	case float64, int, int64, float32, int32:
+		return "Number"
+	case bool:
+		return "Boolean"
+	case []interface{}:
+		return "List"
+	case map[string]interface{}:
+		return "Map"
+	case docAccessor:
+		return "doc"
+	case docField:
+		return "ScriptDocValues"
+	case geoPoint:
+		return "GeoPoint"
+	case staticClass:
+		return "Class"
+	case *simpleDateFormat:
+		return "SimpleDateFormat"
+	case zonedDateTime:
+		return "ZonedDateTime"
+	case duration:
+		return "Duration"
+	case chronoUnit:
+		return "ChronoUnit"
+	case zoneID:
+		return "ZoneId"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"fmt"
+)
+
+// flow 语句执行后的控制流
+type flow int
+
+const (
+	flowNormal flow = iota
+	flowBreak
+	flowContinue
+	flowReturn
+)
+
+// execProgram 执行语句序列
+// 返回 return 的值；没有 return 时返回最后一条语句的值（如单个表达式脚本）
+func (e *Engine) execProgram(stmts []stmtNode, ctx *Context) (interface{}, error) {
+	_, value, err := e.execBlock(stmts, ctx)
+	return value, err
+}
+
+// execBlock 顺序执行语句，遇到 break/continue/return 时中止并向上传递
+func (e *Engine) execBlock(stmts []stmtNode, ctx *Context) (flow, interface{}, error) {
+	var last interface{}
+	for _, stmt := range stmts {
+		f, value, err := e.exec(stmt, ctx)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		if f != flowNormal {
+			return f, value, nil
+		}
+		last = value
+	}
+	return flowNormal, last, nil
+}
+
+// exec 执行单条语句
+func (e *Engine) exec(s stmtNode, ctx *Context) (flow, interface{}, error) {
+	if err := ctx.run.step(); err != nil {
+		return flowNormal, nil, err
+	}
+
+	switch n := s.(type) {
+	case *exprStmt:
+		value, err := e.eval(n.expr, ctx)
+		return flowNormal, value, err
+
+	case *declStmt:
+		var value interface{}
+		for i, name := range n.names {
+			value = zeroValue(n.typeName)
+			if n.values[i] != nil {
+				v, err := e.eval(n.values[i], ctx)
+				if err != nil {
+					return flowNormal, nil, err
+				}
+				value = castValue(n.typeName, v)
+			}
+			ctx.Variables[name] = value
+		}
+		return flowNormal, value, nil
+
+	case *blockStmt:
+		return e.execBlock(n.stmts, ctx)
+
+	case *ifStmt:
+		cond, err := e.eval(n.cond, ctx)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		if toBool(cond) {
+			return e.exec(n.then, ctx)
+		}
+		if n.otherwise != nil {
+			return e.exec(n.otherwise, ctx)
+		}
+		return flowNormal, nil, nil
+
+	case *whileStmt:
+		for {
+			cond, err := e.eval(n.cond, ctx)
+			if err != nil {
+				return flowNormal, nil, err
+			}
+			if !toBool(cond) {
+				return flowNormal, nil, nil
+			}
+			if f, value, err := e.execLoopBody(n.body, ctx); err != nil || f != flowNormal {
+				return loopExit(f, value, err)
+			}
+		}
+
+	case *doWhileStmt:
+		for {
+			if f, value, err := e.execLoopBody(n.body, ctx); err != nil || f != flowNormal {
+				return loopExit(f, value, err)
+			}
+			cond, err := e.eval(n.cond, ctx)
+			if err != nil {
+				return flowNormal, nil, err
+			}
+			if !toBool(cond) {
+				return flowNormal, nil, nil
+			}
+		}
+
+	case *forStmt:
+		if n.init != nil {
+			if _, _, err := e.exec(n.init, ctx); err != nil {
+				return flowNormal, nil, err
+			}
+		}
+		for {
+			if n.cond != nil {
+				cond, err := e.eval(n.cond, ctx)
+				if err != nil {
+					return flowNormal, nil, err
+				}
+				if !toBool(cond) {
+					return flowNormal, nil, nil
+				}
+			}
+			if f, value, err := e.execLoopBody(n.body, ctx); err != nil || f != flowNormal {
+				return loopExit(f, value, err)
+			}
+			for _, update := range n.update {
+				if _, err := e.eval(update, ctx); err != nil {
+					return flowNormal, nil, err
+				}
+			}
+		}
+
+	case *forEachStmt:
+		iterable, err := e.eval(n.iterable, ctx)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		items, err := iterableValues(iterable)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		for _, item := range items {
+			ctx.Variables[n.name] = item
+			if f, value, err := e.execLoopBody(n.body, ctx); err != nil || f != flowNormal {
+				return loopExit(f, value, err)
+			}
+		}
+		return flowNormal, nil, nil
+
+	case *switchStmt:
+		return e.execSwitch(n, ctx)
+
+	case *breakStmt:
+		return flowBreak, nil, nil
+
+	case *continueStmt:
+		return flowContinue, nil, nil
+
+	case *returnStmt:
+		if n.value == nil {
+			return flowReturn, nil, nil
+		}
+		value, err := e.eval(n.value, ctx)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		return flowReturn, value, nil
+	}
+	return flowNormal, nil, fmt.Errorf("unsupported statement node %T", s)
+}
+
+// execLoopBody 执行循环体，continue 视为正常结束本次迭代
+func (e *Engine) execLoopBody(body stmtNode, ctx *Context) (flow, interface{}, error) {
+	f, value, err := e.exec(body, ctx)
+	if f == flowContinue {
+		f = flowNormal
+	}
+	return f, value, err
+}
+
+// loopExit 处理循环的退出：break 结束循环，return 继续向上传递
+func loopExit(f flow, value interface{}, err error) (flow, interface{}, error) {
+	if err != nil {
+		return flowNormal, nil, err
+	}
+	if f == flowBreak {
+		return flowNormal, nil, nil
+	}
+	return f, value, nil
+}
+
+// execSwitch 执行 switch：从第一个匹配的 case（否则 default）开始贯穿执行到 break
+func (e *Engine) execSwitch(n *switchStmt, ctx *Context) (flow, interface{}, error) {
+	value, err := e.eval(n.value, ctx)
+	if err != nil {
+		return flowNormal, nil, err
+	}
+
+	start := -1
+	for i, c := range n.cases {
+		if c.value == nil {
+			continue
+		}
+		caseValue, err := e.eval(c.value, ctx)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		if e.valuesEqual(value, caseValue) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		for i, c := range n.cases {
+			if c.value == nil {
+				start = i
+				break
+			}
+		}
+	}
+	if start < 0 {
+		return flowNormal, nil, nil
+	}
+
+	var last interface{}
+	for _, c := range n.cases[start:] {
+		f, result, err := e.execBlock(c.body, ctx)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		if f == flowBreak {
+			return flowNormal, result, nil
+		}
+		if f != flowNormal {
+			return f, result, nil
+		}
+		last = result
+	}
+	return flowNormal, last, nil
+}
+
+// zeroValue 未初始化变量的默认值
+func zeroValue(typeName string) interface{} {
+	switch typeName {
+	case "int", "long", "short", "byte", "char", "double", "float":
+		return 0.0
+	case "boolean":
+		return false
+	}
+	return nil
+}
+
+// iterableValues 返回可遍历对象的元素
+func iterableValues(v interface{}) ([]interface{}, error) {
+	switch val := v.(type) {
+	case []interface{}:
+		return val, nil
+	case []string:
+		items := make([]interface{}, len(val))
+		for i, s := range val {
+			items[i] = s
+		}
+		return items, nil
+	case docField:
+		return val.values(), nil
+	case nil:
+		return nil, fmt.Errorf("cannot iterate over null")
+	}
+	return nil, fmt.Errorf("cannot iterate over [%s]", typeName(v))
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatements(t *testing.T) {
+	engine := NewEngine()
+
+	tests := []struct {
+		name   string
+		source string
+		params map[string]interface{}
+		want   interface{}
+	}{
+		{
+			name:   "declaration and return",
+			source: "def x = 0; for (int i = 0; i < 5; i++) { x += i; } return x;",
+			want:   10.0,
+		},
+		{
+			name:   "typed declarations",
+			source: "int a = 7 / 2, b; double c = 1; String s = 'v' + a; return s + b + c;",
+			want:   "v301",
+		},
+		{
+			name:   "if else chain",
+			source: "def grade = params.score >= 90 ? 'A' : null; if (grade != null) { return grade; } else if (params.score >= 60) { return 'pass'; } else { return 'fail'; }",
+			params: map[string]interface{}{"score": 75.0},
+			want:   "pass",
+		},
+		{
+			name:   "if without braces",
+			source: "def x = 1; if (x > 0) x = 2; else x = 3; return x;",
+			want:   2.0,
+		},
+		{
+			name:   "while with break",
+			source: "def n = 0; while (true) { n++; if (n >= 4) break; } return n;",
+			want:   4.0,
+		},
+		{
+			name:   "do while with continue",
+			source: "def i = 0; def odd = 0; do { i++; if (i % 2 == 0) { continue; } odd += i; } while (i < 6); return odd;",
+			want:   9.0,
+		},
+		{
+			name:   "nested loops break inner only",
+			source: "def count = 0; for (def i = 0; i < 3; i++) { for (def j = 0; j < 3; j++) { if (j == 1) { break; } count++; } } return count;",
+			want:   3.0,
+		},
+		{
+			name:   "return inside loop",
+			source: "for (def i = 0; i < 10; i++) { if (i * i > 10) { return i; } } return -1;",
+			want:   4.0,
+		},
+		{
+			name:   "for each with colon",
+			source: "def total = 0; for (def v : params.values) { total += v; } return total;",
+			params: map[string]interface{}{"values": []interface{}{1.0, 2.0, 3.0}},
+			want:   6.0,
+		},
+		{
+			name:   "for each with in",
+			source: "def out = []; for (item in params.values) { out.add(item * 2); } return out;",
+			params: map[string]interface{}{"values": []interface{}{1.0, 2.0}},
+			want:   []interface{}{2.0, 4.0},
+		},
+		{
+			name:   "generic declaration",
+			source: "List<String> names = new ArrayList<>(); Map<String, Object> m = new HashMap(); names.add('a'); m.put('n', names.size()); return m.n;",
+			want:   1.0,
+		},
+		{
+			name:   "switch fall through",
+			source: "def r = ''; switch (params.k) { case 1: r += 'a'; case 2: r += 'b'; break; default: r += 'c'; } return r;",
+			params: map[string]interface{}{"k": 1.0},
+			want:   "ab",
+		},
+		{
+			name:   "newline separated statements",
+			source: "def a = 1\ndef b = 2 // comment\nreturn a + b",
+			want:   3.0,
+		},
+		{
+			name:   "last expression value",
+			source: "def a = 5; a * 2",
+			want:   10.0,
+		},
+		{
+			name:   "braces inside strings",
+			source: "def s = '{;}'; if (s.length() == 3) { return s; } return null;",
+			want:   "{;}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContext(nil, nil, tt.params)
+			got, err := engine.Execute(NewScript(tt.source, tt.params), ctx)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Execute() = %v (%T), want %v", got, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatementUpdateScript(t *testing.T) {
+	engine := NewEngine()
+	source := map[string]interface{}{"tags": []interface{}{"a", "b", "c"}}
+	ctx := NewContext(nil, source, map[string]interface{}{"tag": "b"})
+
+	script := "if (ctx._source.tags.contains(params.tag)) { ctx._source.tags.remove(ctx._source.tags.indexOf(params.tag)) } else { ctx.op = 'noop' }"
+	if _, err := engine.Execute(NewScript(script, nil), ctx); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if want := []interface{}{"a", "c"}; !reflect.DeepEqual(ctx.Source["tags"], want) {
+		t.Errorf("tags = %v, want %v", ctx.Source["tags"], want)
+	}
+	if _, ok := ctx.Ctx["op"]; ok {
+		t.Errorf("unexpected ctx.op = %v", ctx.Ctx["op"])
+	}
+}
+
+func TestStatementCompileErrors(t *testing.T) {
+	for _, source := range []string{
+		"break;",
+		"if (true) { continue; }",
+		"def x = 1; if (x > 0 { return x; }",
+		"for (def i = 0; i < 3) { }",
+		"switch (1) { return 1; }",
+		"def x = 1 def y = 2",
+		"{ def x = 1;",
+	} {
+		if _, err := parseProgram(source); err == nil {
+			t.Errorf("parseProgram(%q) expected error", source)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenKind 词法单元类型
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+// token 词法单元
+type token struct {
+	kind    tokenKind
+	text    string      // 原始文本（标识符、运算符）
+	value   interface{} // 字面量值（数字、字符串）
+	pos     int         // 在源码中的位置
+	newline bool        // 与前一个词法单元之间是否有换行（用于省略分号）
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "EOF"
+	case tokString:
+		return strconv.Quote(t.value.(string))
+	}
+	return t.text
+}
+
+// 多字符运算符（按长度从长到短匹配）
+var multiCharOps = []string{
+	"===", "!==",
+	"==", "!=", "<=", ">=", "&&", "||", "+=", "-=", "*=", "/=", "%=", "++", "--", "?.", "?:",
+}
+
+// tokenize 将脚本源码切分为词法单元
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+	newline := false
+	emit := func(t token) {
+		t.newline = newline
+		tokens = append(tokens, t)
+		newline = false
+	}
+	for i < len(source) {
+		c := source[i]
+
+		// 空白
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			if c == '\n' {
+				newline = true
+			}
+			i++
+			continue
+		}
+
+		// 注释
+		if c == '/' && i+1 < len(source) {
+			if source[i+1] == '/' {
+				for i < len(source) && source[i] != '\n' {
+					i++
+				}
+				continue
+			}
+			if source[i+1] == '*' {
+				end := strings.Index(source[i+2:], "*/")
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated comment at position %d", i)
+				}
+				if strings.Contains(source[i:i+end+4], "\n") {
+					newline = true
+				}
+				i += end + 4
+				continue
+			}
+		}
+
+		start := i
+
+		// 字符串字面量
+		if c == '\'' || c == '"' {
+			s, next, err := scanString(source, i)
+			if err != nil {
+				return nil, err
+			}
+			emit(token{kind: tokString, value: s, pos: start})
+			i = next
+			continue
+		}
+
+		// 数字字面量
+		if isDigit(c) || (c == '.' && i+1 < len(source) && isDigit(source[i+1])) {
+			num, next, err := scanNumber(source, i)
+			if err != nil {
+				return nil, err
+			}
+			emit(token{kind: tokNumber, text: source[start:next], value: num, pos: start})
+			i = next
+			continue
+		}
+
+		// 标识符
+		if isIdentStart(c) {
+			for i < len(source) && isIdentPart(source[i]) {
+				i++
+			}
+			emit(token{kind: tokIdent, text: source[start:i], pos: start})
+			continue
+		}
+
+		// 运算符与分隔符
+		matched := false
+		for _, op := range multiCharOps {
+			if strings.HasPrefix(source[i:], op) {
+				text := op
+				// === / !== 按 == / != 处理
+				if op == "===" || op == "!==" {
+					text = op[:2]
+				}
+				emit(token{kind: tokOp, text: text, pos: start})
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		if strings.IndexByte("+-*/%<>=!?:.,()[]{};", c) >= 0 {
+			emit(token{kind: tokOp, text: string(c), pos: start})
+			i++
+			continue
+		}
+
+		return nil, fmt.Errorf("unexpected character [%c] at position %d", c, i)
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(source)})
+	return tokens, nil
+}
+
+// scanString 扫描字符串字面量，返回解码后的内容与结束位置
+func scanString(source string, start int) (string, int, error) {
+	quote := source[start]
+	var b strings.Builder
+	i := start + 1
+	for i < len(source) {
+		c := source[i]
+		if c == quote {
+			return b.String(), i + 1, nil
+		}
+		if c == '\\' && i+1 < len(source) {
+			i++
+			switch source[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(source[i])
+			}
+			i++
+			continue
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", start)
+}
+
+// scanNumber 扫描数字字面量（支持小数、科学计数法以及 L/F/D 后缀）
+func scanNumber(source string, start int) (float64, int, error) {
+	i := start
+	for i < len(source) && isDigit(source[i]) {
+		i++
+	}
+	if i < len(source) && source[i] == '.' && i+1 < len(source) && isDigit(source[i+1]) {
+		i++
+		for i < len(source) && isDigit(source[i]) {
+			i++
+		}
+	}
+	if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+		j := i + 1
+		if j < len(source) && (source[j] == '+' || source[j] == '-') {
+			j++
+		}
+		if j < len(source) && isDigit(source[j]) {
+			i = j
+			for i < len(source) && isDigit(source[i]) {
+				i++
+			}
+		}
+	}
+	num, err := strconv.ParseFloat(source[start:i], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid number [%s] at position %d", source[start:i], start)
+	}
+	if i < len(source) && strings.IndexByte("lLfFdD", source[i]) >= 0 {
+		i++
+	}
+	if i < len(source) && isIdentPart(source[i]) {
+		return 0, 0, fmt.Errorf("invalid number [%s] at position %d", source[start:i+1], start)
+	}
+	return num, i, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
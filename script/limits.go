@@ -0,0 +1,159 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 默认执行限制
+const (
+	DefaultMaxStatements     = 1000000
+	DefaultMaxStringLength   = 1024 * 1024
+	DefaultMaxCollectionSize = 100000
+	DefaultTimeout           = time.Second
+)
+
+// 每执行多少条语句检查一次超时
+const timeoutCheckInterval = 256
+
+// Limits 脚本执行限制（每次执行独立计算）
+// 字段为 0 时使用默认值，小于 0 表示不限制
+type Limits struct {
+	MaxStatements     int64         `json:"max_statements" yaml:"max_statements"`           // 最多执行的语句数（含每次循环迭代），默认 1000000
+	MaxStringLength   int           `json:"max_string_length" yaml:"max_string_length"`     // 字符串最大长度，默认 1MB
+	MaxCollectionSize int           `json:"max_collection_size" yaml:"max_collection_size"` // List/Map 最大元素数，默认 100000
+	Timeout           time.Duration `json:"timeout" yaml:"timeout"`                         // 单次执行超时，默认 1s
+}
+
+// DefaultLimits 返回默认执行限制
+func DefaultLimits() Limits {
+	return Limits{
+		MaxStatements:     DefaultMaxStatements,
+		MaxStringLength:   DefaultMaxStringLength,
+		MaxCollectionSize: DefaultMaxCollectionSize,
+		Timeout:           DefaultTimeout,
+	}
+}
+
+// withDefaults 将未设置的字段替换为默认值
+func (l Limits) withDefaults() Limits {
+	if l.MaxStatements == 0 {
+		l.MaxStatements = DefaultMaxStatements
+	}
+	if l.MaxStringLength == 0 {
+		l.MaxStringLength = DefaultMaxStringLength
+	}
+	if l.MaxCollectionSize == 0 {
+		l.MaxCollectionSize = DefaultMaxCollectionSize
+	}
+	if l.Timeout == 0 {
+		l.Timeout = DefaultTimeout
+	}
+	return l
+}
+
+var (
+	limitsMu     sync.RWMutex
+	globalLimits = DefaultLimits()
+)
+
+// SetLimits 设置全局脚本执行限制
+func SetLimits(limits Limits) {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	globalLimits = limits.withDefaults()
+}
+
+// GetLimits 获取全局脚本执行限制
+func GetLimits() Limits {
+	limitsMu.RLock()
+	defer limitsMu.RUnlock()
+	return globalLimits
+}
+
+// ScriptException 脚本超出执行限制，对应 ES 的 script_exception
+type ScriptException struct {
+	Reason string
+}
+
+func (e *ScriptException) Error() string {
+	return e.Reason
+}
+
+// IsScriptException 判断错误是否为超出执行限制
+func IsScriptException(err error) bool {
+	var scriptErr *ScriptException
+	return errors.As(err, &scriptErr)
+}
+
+// runState 单次执行的资源计数
+type runState struct {
+	limits   Limits
+	steps    int64
+	deadline time.Time
+}
+
+func newRunState(limits Limits) *runState {
+	r := &runState{limits: limits}
+	if limits.Timeout > 0 {
+		r.deadline = time.Now().Add(limits.Timeout)
+	}
+	return r
+}
+
+// step 记录一条语句的执行，超出语句数或超时返回错误
+func (r *runState) step() error {
+	if r == nil {
+		return nil
+	}
+	r.steps++
+	if r.limits.MaxStatements > 0 && r.steps > r.limits.MaxStatements {
+		return &ScriptException{Reason: fmt.Sprintf(
+			"The maximum number of statements that can be executed has been reached [%d]", r.limits.MaxStatements)}
+	}
+	if !r.deadline.IsZero() && r.steps%timeoutCheckInterval == 0 && time.Now().After(r.deadline) {
+		return &ScriptException{Reason: fmt.Sprintf("script execution timed out after [%s]", r.limits.Timeout)}
+	}
+	return nil
+}
+
+// checkSize 检查字符串长度与集合大小
+func (r *runState) checkSize(v interface{}) error {
+	if r == nil {
+		return nil
+	}
+	switch val := v.(type) {
+	case string:
+		if r.limits.MaxStringLength > 0 && len(val) > r.limits.MaxStringLength {
+			return &ScriptException{Reason: fmt.Sprintf(
+				"string length [%d] exceeds the maximum of [%d]", len(val), r.limits.MaxStringLength)}
+		}
+	case []interface{}:
+		if r.limits.MaxCollectionSize > 0 && len(val) > r.limits.MaxCollectionSize {
+			return &ScriptException{Reason: fmt.Sprintf(
+				"collection size [%d] exceeds the maximum of [%d]", len(val), r.limits.MaxCollectionSize)}
+		}
+	case map[string]interface{}:
+		if r.limits.MaxCollectionSize > 0 && len(val) > r.limits.MaxCollectionSize {
+			return &ScriptException{Reason: fmt.Sprintf(
+				"collection size [%d] exceeds the maximum of [%d]", len(val), r.limits.MaxCollectionSize)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecutionLimits(t *testing.T) {
+	defer SetLimits(DefaultLimits())
+	engine := NewEngine()
+
+	tests := []struct {
+		name   string
+		limits Limits
+		source string
+		reason string
+	}{
+		{
+			name:   "statement budget",
+			limits: Limits{MaxStatements: 1000, Timeout: -1},
+			source: "def i = 0; while (true) { i++; }",
+			reason: "maximum number of statements",
+		},
+		{
+			name:   "empty loop body",
+			limits: Limits{MaxStatements: 1000, Timeout: -1},
+			source: "for (;;) {}",
+			reason: "maximum number of statements",
+		},
+		{
+			name:   "timeout",
+			limits: Limits{MaxStatements: -1, Timeout: 20 * time.Millisecond},
+			source: "while (true) { def x = 1; }",
+			reason: "timed out",
+		},
+		{
+			name:   "string length",
+			limits: Limits{MaxStringLength: 1024},
+			source: "def s = 'ab'; while (true) { s += s; }",
+			reason: "string length",
+		},
+		{
+			name:   "list size",
+			limits: Limits{MaxCollectionSize: 100},
+			source: "def l = []; for (def i = 0; i < 1000; i++) { l.add(i); }",
+			reason: "collection size",
+		},
+		{
+			name:   "map size",
+			limits: Limits{MaxCollectionSize: 100},
+			source: "def m = [:]; for (def i = 0; i < 1000; i++) { m.put('k' + i, i); }",
+			reason: "collection size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetLimits(tt.limits)
+			_, err := engine.Execute(NewScript(tt.source, nil), NewContext(nil, nil, nil))
+			if !IsScriptException(err) {
+				t.Fatalf("expected ScriptException, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("error = %q, want reason containing %q", err, tt.reason)
+			}
+		})
+	}
+
+	// 限制内的脚本正常执行
+	SetLimits(Limits{MaxStatements: 1000})
+	got, err := engine.Execute(NewScript("def x = 0; for (def i = 0; i < 100; i++) { x += i; } return x;", nil), NewContext(nil, nil, nil))
+	if err != nil || got != 4950.0 {
+		t.Errorf("Execute() = %v, %v; want 4950", got, err)
+	}
+}
+
+func TestSetLimitsDefaults(t *testing.T) {
+	defer SetLimits(DefaultLimits())
+
+	SetLimits(Limits{Timeout: 5 * time.Second, MaxStringLength: -1})
+	got := GetLimits()
+	if got.Timeout != 5*time.Second || got.MaxStringLength != -1 {
+		t.Errorf("configured limits not kept: %+v", got)
+	}
+	if got.MaxStatements != DefaultMaxStatements || got.MaxCollectionSize != DefaultMaxCollectionSize {
+		t.Errorf("unset limits should use defaults: %+v", got)
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// mustache 模板（search template 使用）
+// 支持的语法：
+//   - {{name}}：变量（按 JSON 字符串规则转义），支持点号路径 a.b、数组下标 a.0 以及当前上下文 {{.}}
+//   - {{{name}}} / {{& name}}：不转义的变量
+//   - {{#name}}...{{/name}}：section（列表逐项渲染，对象压入上下文，真值渲染一次）
+//   - {{^name}}...{{/name}}：反向 section（值缺失或为假时渲染）
+//   - {{! comment}}：注释
+//   - ES 扩展：{{#toJson}}param{{/toJson}}、{{#join}}param{{/join}}（可选 delimiter='x'）、{{#url}}...{{/url}}
+//
+// 不支持 partials 与自定义分隔符。
+
+// MustacheTemplate 解析后的 mustache 模板
+type MustacheTemplate struct {
+	nodes []*mustacheNode
+}
+
+type mustacheNodeKind int
+
+const (
+	mustacheText mustacheNodeKind = iota
+	mustacheVar
+	mustacheSection
+	mustacheInverted
+)
+
+type mustacheNode struct {
+	kind     mustacheNodeKind
+	text     string // 文本内容或变量/section 名称
+	raw      bool   // 变量不转义
+	args     string // section 参数（如 join 的 delimiter='x'）
+	inner    string // section 的原始内容（toJson/join 使用）
+	children []*mustacheNode
+}
+
+// CompileMustache 解析 mustache 模板
+func CompileMustache(source string) (*MustacheTemplate, error) {
+	type frame struct {
+		node       *mustacheNode
+		innerStart int
+	}
+	root := &mustacheNode{}
+	stack := []frame{{node: root}}
+
+	appendNode := func(n *mustacheNode) {
+		parent := stack[len(stack)-1].node
+		parent.children = append(parent.children, n)
+	}
+
+	pos := 0
+	for pos < len(source) {
+		open := strings.Index(source[pos:], "{{")
+		if open < 0 {
+			appendNode(&mustacheNode{kind: mustacheText, text: source[pos:]})
+			break
+		}
+		open += pos
+		if open > pos {
+			appendNode(&mustacheNode{kind: mustacheText, text: source[pos:open]})
+		}
+
+		// 三重括号：不转义变量
+		if strings.HasPrefix(source[open:], "{{{") {
+			end := strings.Index(source[open+3:], "}}}")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed tag at position %d", open)
+			}
+			name := strings.TrimSpace(source[open+3 : open+3+end])
+			appendNode(&mustacheNode{kind: mustacheVar, text: name, raw: true})
+			pos = open + 3 + end + 3
+			continue
+		}
+
+		end := strings.Index(source[open+2:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed tag at position %d", open)
+		}
+		tag := strings.TrimSpace(source[open+2 : open+2+end])
+		tagEnd := open + 2 + end + 2
+		pos = tagEnd
+		if tag == "" {
+			return nil, fmt.Errorf("empty tag at position %d", open)
+		}
+
+		switch tag[0] {
+		case '!':
+			// 注释
+		case '&':
+			appendNode(&mustacheNode{kind: mustacheVar, text: strings.TrimSpace(tag[1:]), raw: true})
+		case '#', '^':
+			name, args := splitMustacheTag(strings.TrimSpace(tag[1:]))
+			kind := mustacheSection
+			if tag[0] == '^' {
+				kind = mustacheInverted
+			}
+			n := &mustacheNode{kind: kind, text: name, args: args}
+			appendNode(n)
+			stack = append(stack, frame{node: n, innerStart: tagEnd})
+		case '/':
+			name, _ := splitMustacheTag(strings.TrimSpace(tag[1:]))
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unexpected closing tag [%s]", name)
+			}
+			top := stack[len(stack)-1]
+			if top.node.text != name {
+				return nil, fmt.Errorf("mismatched closing tag [%s], expected [%s]", name, top.node.text)
+			}
+			top.node.inner = source[top.innerStart:open]
+			stack = stack[:len(stack)-1]
+		case '>', '=':
+			return nil, fmt.Errorf("unsupported mustache tag [%s]", tag)
+		default:
+			appendNode(&mustacheNode{kind: mustacheVar, text: tag})
+		}
+	}
+
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("unclosed section [%s]", stack[len(stack)-1].node.text)
+	}
+	return &MustacheTemplate{nodes: root.children}, nil
+}
+
+// splitMustacheTag 拆分 section 名称与参数，如 "join delimiter='||'"
+func splitMustacheTag(tag string) (name, args string) {
+	if i := strings.IndexAny(tag, " \t"); i >= 0 {
+		return tag[:i], strings.TrimSpace(tag[i+1:])
+	}
+	return tag, ""
+}
+
+// RenderMustache 解析并渲染 mustache 模板
+func RenderMustache(source string, params map[string]interface{}) (string, error) {
+	tmpl, err := CompileMustache(source)
+	if err != nil {
+		return "", err
+	}
+	return tmpl.Render(params), nil
+}
+
+// Render 使用参数渲染模板
+func (t *MustacheTemplate) Render(params map[string]interface{}) string {
+	var b strings.Builder
+	renderMustacheNodes(&b, t.nodes, []interface{}{params})
+	return b.String()
+}
+
+func renderMustacheNodes(b *strings.Builder, nodes []*mustacheNode, stack []interface{}) {
+	for _, n := range nodes {
+		switch n.kind {
+		case mustacheText:
+			b.WriteString(n.text)
+		case mustacheVar:
+			value, _ := lookupMustacheValue(n.text, stack)
+			s := mustacheString(value)
+			if !n.raw {
+				s = escapeJSONString(s)
+			}
+			b.WriteString(s)
+		case mustacheSection:
+			renderMustacheSection(b, n, stack)
+		case mustacheInverted:
+			value, _ := lookupMustacheValue(n.text, stack)
+			if isMustacheFalsy(value) {
+				renderMustacheNodes(b, n.children, stack)
+			}
+		}
+	}
+}
+
+func renderMustacheSection(b *strings.Builder, n *mustacheNode, stack []interface{}) {
+	switch n.text {
+	case "toJson":
+		value, _ := lookupMustacheValue(strings.TrimSpace(n.inner), stack)
+		data, err := json.Marshal(value)
+		if err != nil {
+			return
+		}
+		b.WriteString(string(data))
+		return
+	case "join":
+		value, _ := lookupMustacheValue(strings.TrimSpace(n.inner), stack)
+		delimiter := ","
+		if strings.HasPrefix(n.args, "delimiter=") {
+			delimiter = strings.Trim(strings.TrimPrefix(n.args, "delimiter="), `'"`)
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			b.WriteString(escapeJSONString(mustacheString(value)))
+			return
+		}
+		parts := make([]string, 0, len(items))
+		for _, item := range items {
+			parts = append(parts, escapeJSONString(mustacheString(item)))
+		}
+		b.WriteString(strings.Join(parts, delimiter))
+		return
+	case "url":
+		var inner strings.Builder
+		renderMustacheNodes(&inner, n.children, stack)
+		b.WriteString(url.QueryEscape(inner.String()))
+		return
+	}
+
+	value, _ := lookupMustacheValue(n.text, stack)
+	if isMustacheFalsy(value) {
+		return
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			renderMustacheNodes(b, n.children, append(stack, item))
+		}
+	default:
+		renderMustacheNodes(b, n.children, append(stack, v))
+	}
+}
+
+// lookupMustacheValue 从上下文栈顶向下查找变量
+func lookupMustacheValue(name string, stack []interface{}) (interface{}, bool) {
+	if name == "." {
+		return stack[len(stack)-1], true
+	}
+	parts := strings.Split(name, ".")
+	for i := len(stack) - 1; i >= 0; i-- {
+		value, ok := mustacheChild(stack[i], parts[0])
+		if !ok {
+			continue
+		}
+		for _, part := range parts[1:] {
+			value, ok = mustacheChild(value, part)
+			if !ok {
+				return nil, false
+			}
+		}
+		return value, true
+	}
+	return nil, false
+}
+
+func mustacheChild(ctx interface{}, key string) (interface{}, bool) {
+	switch c := ctx.(type) {
+	case map[string]interface{}:
+		v, ok := c[key]
+		return v, ok
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(c) {
+			return nil, false
+		}
+		return c[i], true
+	}
+	return nil, false
+}
+
+func isMustacheFalsy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// mustacheString 将值转换为模板输出
+func mustacheString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// escapeJSONString 按 JSON 字符串规则转义（不含外层引号）
+func escapeJSONString(s string) string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return s
+	}
+	return string(data[1 : len(data)-1])
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import "testing"
+
+func TestRenderMustache(t *testing.T) {
+	params := map[string]interface{}{
+		"q":      `say "hi"`,
+		"size":   float64(10),
+		"tags":   []interface{}{"a", "b"},
+		"filter": map[string]interface{}{"term": map[string]interface{}{"x": "y"}},
+		"user":   map[string]interface{}{"name": "bob"},
+		"empty":  []interface{}{},
+		"flag":   true,
+	}
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"variable escaped as JSON", `{"q":"{{q}}"}`, `{"q":"say \"hi\""}`},
+		{"number", `{"size":{{size}}}`, `{"size":10}`},
+		{"raw variable", `{{{q}}}|{{& q}}`, `say "hi"|say "hi"`},
+		{"dotted path", `{{user.name}} {{tags.1}}`, `bob b`},
+		{"missing variable", `[{{nope}}]`, `[]`},
+		{"section iterates list", `{{#tags}}<{{.}}>{{/tags}}`, `<a><b>`},
+		{"section pushes object", `{{#user}}{{name}}{{/user}}`, `bob`},
+		{"section on truthy", `{{#flag}}yes{{/flag}}{{#empty}}no{{/empty}}`, `yes`},
+		{"inverted default", `{{size}}{{^size}}20{{/size}} {{from}}{{^from}}0{{/from}}`, `10 0`},
+		{"toJson", `{"filter":{{#toJson}}filter{{/toJson}}}`, `{"filter":{"term":{"x":"y"}}}`},
+		{"join", `{{#join}}tags{{/join}} {{#join delimiter='|'}}tags{{/join delimiter='|'}}`, `a,b a|b`},
+		{"url", `{{#url}}a b&c{{/url}}`, `a+b%26c`},
+		{"comment", `x{{! ignored }}y`, `xy`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderMustache(tt.template, params)
+			if err != nil {
+				t.Fatalf("RenderMustache error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompileMustache_Errors(t *testing.T) {
+	for _, tmpl := range []string{`{{#a}}x`, `{{/a}}`, `{{#a}}x{{/b}}`, `{{q`, `{{> partial}}`} {
+		if _, err := CompileMustache(tmpl); err == nil {
+			t.Errorf("expected compile error for %q", tmpl)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"fmt"
+)
+
+// 运算符优先级（数值越大绑定越紧）
+const (
+	precLowest = iota
+	precAssign
+	precTernary
+	precOr
+	precAnd
+	precEquality
+	precRelational
+	precAdditive
+	precMultiplicative
+)
+
+var binaryPrecedence = map[string]int{
+	"=": precAssign, "+=": precAssign, "-=": precAssign, "*=": precAssign, "/=": precAssign, "%=": precAssign,
+	"?": precTernary, "?:": precTernary,
+	"||": precOr,
+	"&&": precAnd,
+	"==": precEquality, "!=": precEquality,
+	"<": precRelational, ">": precRelational, "<=": precRelational, ">=": precRelational,
+	"+": precAdditive, "-": precAdditive,
+	"*": precMultiplicative, "/": precMultiplicative, "%": precMultiplicative,
+}
+
+// parser 基于 Pratt 算法的表达式解析器（语句解析见 parser_stmt.go）
+type parser struct {
+	tokens      []token
+	pos         int
+	loopDepth   int // 当前所处循环层数（校验 break/continue）
+	switchDepth int // 当前所处 switch 层数（校验 break）
+}
+
+// parseExpression 将完整的源码解析为单个表达式
+func parseExpression(source string) (exprNode, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("compile error: %v", err)
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseExpr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isOp 判断当前词法单元是否为指定运算符
+func (p *parser) isOp(text string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == text
+}
+
+func (p *parser) expectOp(text string) error {
+	if !p.isOp(text) {
+		return p.unexpected(p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) unexpected(t token) error {
+	return fmt.Errorf("compile error: unexpected token [%s] at position %d", t, t.pos)
+}
+
+// parseExpr 解析优先级高于 minPrec 的表达式
+func (p *parser) parseExpr(minPrec int) (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.kind != tokOp {
+			return left, nil
+		}
+		prec, ok := binaryPrecedence[t.text]
+		if !ok || prec <= minPrec {
+			return left, nil
+		}
+		p.next()
+
+		switch {
+		case prec == precAssign:
+			// 赋值右结合
+			if !isAssignable(left) {
+				return nil, fmt.Errorf("compile error: invalid assignment target at position %d", t.pos)
+			}
+			value, err := p.parseExpr(precAssign - 1)
+			if err != nil {
+				return nil, err
+			}
+			left = &assignExpr{op: t.text, target: left, value: value}
+
+		case t.text == "?":
+			then, err := p.parseExpr(precLowest)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(":"); err != nil {
+				return nil, err
+			}
+			otherwise, err := p.parseExpr(precTernary - 1)
+			if err != nil {
+				return nil, err
+			}
+			left = &conditionalExpr{cond: left, then: then, otherwise: otherwise}
+
+		case t.text == "?:":
+			right, err := p.parseExpr(precTernary - 1)
+			if err != nil {
+				return nil, err
+			}
+			left = &elvisExpr{left: left, right: right}
+
+		default:
+			right, err := p.parseExpr(prec)
+			if err != nil {
+				return nil, err
+			}
+			left = &binaryExpr{op: t.text, left: left, right: right}
+		}
+	}
+}
+
+// parseUnary 解析前缀运算
+func (p *parser) parseUnary() (exprNode, error) {
+	t := p.peek()
+	if t.kind == tokOp {
+		switch t.text {
+		case "-", "+", "!":
+			p.next()
+			operand, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			// 负数字面量直接折叠
+			if lit, ok := operand.(*literalExpr); ok && t.text == "-" {
+				if num, ok := lit.value.(float64); ok {
+					return &literalExpr{value: -num}, nil
+				}
+			}
+			return &unaryExpr{op: t.text, operand: operand}, nil
+		case "++", "--":
+			p.next()
+			target, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			if !isAssignable(target) {
+				return nil, fmt.Errorf("compile error: invalid %s target at position %d", t.text, t.pos)
+			}
+			return &updateExpr{op: t.text, prefix: true, target: target}, nil
+		}
+	}
+
+	primary, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return p.parsePostfix(primary)
+}
+
+// parsePostfix 解析成员访问、下标、调用与后置自增
+func (p *parser) parsePostfix(left exprNode) (exprNode, error) {
+	for {
+		t := p.peek()
+		if t.kind != tokOp {
+			return left, nil
+		}
+		switch t.text {
+		case ".", "?.":
+			p.next()
+			name := p.next()
+			if name.kind != tokIdent {
+				return nil, p.unexpected(name)
+			}
+			left = &memberExpr{object: left, name: name.text, nullSafe: t.text == "?."}
+		case "[":
+			p.next()
+			index, err := p.parseExpr(precLowest)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			left = &indexExpr{object: left, index: index}
+		case "(":
+			p.next()
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			left = &callExpr{callee: left, args: args}
+		case "++", "--":
+			if !isAssignable(left) {
+				return left, nil
+			}
+			p.next()
+			left = &updateExpr{op: t.text, target: left}
+		default:
+			return left, nil
+		}
+	}
+}
+
+// parseArgs 解析调用参数（左括号已消费）
+func (p *parser) parseArgs() ([]exprNode, error) {
+	var args []exprNode
+	if p.isOp(")") {
+		p.next()
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.isOp(",") {
+			p.next()
+			continue
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return args, nil
+	}
+}
+
+// parsePrimary 解析基本表达式
+func (p *parser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber, tokString:
+		return &literalExpr{value: t.value}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalExpr{value: true}, nil
+		case "false":
+			return &literalExpr{value: false}, nil
+		case "null":
+			return &literalExpr{value: nil}, nil
+		case "new":
+			return p.parseNew()
+		}
+		return &identExpr{name: t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			// 类型转换：(int) x、(double) doc['a'].value
+			if typeName, ok := p.castType(); ok {
+				operand, err := p.parseUnary()
+				if err != nil {
+					return nil, err
+				}
+				return &castExpr{typeName: typeName, operand: operand}, nil
+			}
+			expr, err := p.parseExpr(precLowest)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		case "[":
+			return p.parseCollection()
+		}
+	}
+	return nil, p.unexpected(t)
+}
+
+// castTypes 支持的类型转换
+var castTypes = map[string]bool{
+	"int": true, "long": true, "short": true, "byte": true, "char": true,
+	"double": true, "float": true, "boolean": true, "String": true, "def": true,
+	"Integer": true, "Long": true, "Double": true, "Float": true, "Boolean": true,
+}
+
+// castType 识别类型转换前缀（左括号已消费），成功时消费类型名与右括号
+func (p *parser) castType() (string, bool) {
+	t := p.peek()
+	if t.kind != tokIdent || !castTypes[t.text] || p.pos+1 >= len(p.tokens) {
+		return "", false
+	}
+	closing := p.tokens[p.pos+1]
+	if closing.kind != tokOp || closing.text != ")" {
+		return "", false
+	}
+	p.pos += 2
+	return t.text, true
+}
+
+// parseNew 解析 new Type(args)，忽略包名与泛型参数
+func (p *parser) parseNew() (exprNode, error) {
+	name := p.next()
+	if name.kind != tokIdent {
+		return nil, p.unexpected(name)
+	}
+	typeName := name.text
+	for p.isOp(".") {
+		p.next()
+		part := p.next()
+		if part.kind != tokIdent {
+			return nil, p.unexpected(part)
+		}
+		typeName = part.text
+	}
+	if p.isOp("<") {
+		depth := 0
+		for {
+			t := p.next()
+			if t.kind == tokEOF {
+				return nil, p.unexpected(t)
+			}
+			if t.kind == tokOp && t.text == "<" {
+				depth++
+			} else if t.kind == tokOp && t.text == ">" {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+	}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+	return &newExpr{typeName: typeName, args: args}, nil
+}
+
+// parseCollection 解析列表 [a, b] 或 Map [k: v] 字面量（左方括号已消费）
+func (p *parser) parseCollection() (exprNode, error) {
+	if p.isOp(":") {
+		p.next()
+		if err := p.expectOp("]"); err != nil {
+			return nil, err
+		}
+		return &mapExpr{}, nil
+	}
+	if p.isOp("]") {
+		p.next()
+		return &listExpr{}, nil
+	}
+
+	first, err := p.parseExpr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp(":") {
+		m := &mapExpr{}
+		key := first
+		for {
+			if err := p.expectOp(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.parseExpr(precLowest)
+			if err != nil {
+				return nil, err
+			}
+			m.keys = append(m.keys, key)
+			m.values = append(m.values, value)
+			if !p.isOp(",") {
+				break
+			}
+			p.next()
+			if key, err = p.parseExpr(precLowest); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectOp("]"); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	list := &listExpr{elements: []exprNode{first}}
+	for p.isOp(",") {
+		p.next()
+		elem, err := p.parseExpr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+		list.elements = append(list.elements, elem)
+	}
+	if err := p.expectOp("]"); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// isAssignable 判断表达式能否作为赋值目标
+func isAssignable(n exprNode) bool {
+	switch n.(type) {
+	case *identExpr, *memberExpr, *indexExpr:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,503 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"fmt"
+)
+
+// 语句关键字，不能作为变量类型或变量名
+var statementKeywords = map[string]bool{
+	"if": true, "else": true, "for": true, "while": true, "do": true, "switch": true,
+	"case": true, "default": true, "break": true, "continue": true, "return": true,
+	"new": true, "true": true, "false": true, "null": true, "in": true, "instanceof": true,
+}
+
+// parseProgram 将脚本源码解析为语句序列
+// 最后一条语句可省略分号；换行也可作为语句结束
+func parseProgram(source string) ([]stmtNode, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("compile error: %v", err)
+	}
+	p := &parser{tokens: tokens}
+	var stmts []stmtNode
+	for p.peek().kind != tokEOF {
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		if stmt != nil {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts, nil
+}
+
+// isKeyword 判断当前词法单元是否为指定关键字
+func (p *parser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.text == word
+}
+
+func (p *parser) expectKeyword(word string) error {
+	if !p.isKeyword(word) {
+		return p.unexpected(p.peek())
+	}
+	p.next()
+	return nil
+}
+
+// atStatementEnd 判断当前位置是否为语句结尾
+func (p *parser) atStatementEnd() bool {
+	t := p.peek()
+	return t.kind == tokEOF || (t.kind == tokOp && (t.text == ";" || t.text == "}"))
+}
+
+// endStatement 消费语句结束符：分号，或位于 }、EOF、换行之前时可省略
+func (p *parser) endStatement() error {
+	if p.isOp(";") {
+		p.next()
+		return nil
+	}
+	if t := p.peek(); p.atStatementEnd() || t.newline {
+		return nil
+	}
+	return p.unexpected(p.peek())
+}
+
+// parseStatement 解析单条语句，空语句返回 nil
+func (p *parser) parseStatement() (stmtNode, error) {
+	t := p.peek()
+	if t.kind == tokOp {
+		switch t.text {
+		case "{":
+			p.next()
+			return p.parseBlock()
+		case ";":
+			p.next()
+			return nil, nil
+		}
+	}
+
+	if t.kind == tokIdent {
+		switch t.text {
+		case "if":
+			return p.parseIf()
+		case "for":
+			return p.parseFor()
+		case "while":
+			return p.parseWhile()
+		case "do":
+			return p.parseDoWhile()
+		case "switch":
+			return p.parseSwitch()
+		case "break":
+			p.next()
+			if p.loopDepth == 0 && p.switchDepth == 0 {
+				return nil, fmt.Errorf("compile error: break outside of loop or switch at position %d", t.pos)
+			}
+			return &breakStmt{}, p.endStatement()
+		case "continue":
+			p.next()
+			if p.loopDepth == 0 {
+				return nil, fmt.Errorf("compile error: continue outside of loop at position %d", t.pos)
+			}
+			return &continueStmt{}, p.endStatement()
+		case "return":
+			p.next()
+			stmt := &returnStmt{}
+			if !p.atStatementEnd() {
+				value, err := p.parseExpr(precLowest)
+				if err != nil {
+					return nil, err
+				}
+				stmt.value = value
+			}
+			return stmt, p.endStatement()
+		}
+
+		if p.isDeclaration() {
+			decl, err := p.parseDeclaration()
+			if err != nil {
+				return nil, err
+			}
+			return decl, p.endStatement()
+		}
+	}
+
+	expr, err := p.parseExpr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+	return &exprStmt{expr: expr}, p.endStatement()
+}
+
+// parseBlock 解析语句块（左花括号已消费）
+func (p *parser) parseBlock() (stmtNode, error) {
+	block := &blockStmt{}
+	for !p.isOp("}") {
+		if p.peek().kind == tokEOF {
+			return nil, p.unexpected(p.peek())
+		}
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		if stmt != nil {
+			block.stmts = append(block.stmts, stmt)
+		}
+	}
+	p.next()
+	return block, nil
+}
+
+// parseBody 解析控制语句的主体，空语句返回空语句块
+func (p *parser) parseBody() (stmtNode, error) {
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return &blockStmt{}, nil
+	}
+	return stmt, nil
+}
+
+// parseLoopBody 解析循环主体
+func (p *parser) parseLoopBody() (stmtNode, error) {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBody()
+}
+
+// parseCondition 解析括号内的条件表达式
+func (p *parser) parseCondition() (exprNode, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseExpr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	return cond, nil
+}
+
+// parseIf 解析 if (cond) stmt [else stmt]
+func (p *parser) parseIf() (stmtNode, error) {
+	p.next()
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	then, err := p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &ifStmt{cond: cond, then: then}
+	if p.isKeyword("else") {
+		p.next()
+		if stmt.otherwise, err = p.parseBody(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseWhile 解析 while (cond) body
+func (p *parser) parseWhile() (stmtNode, error) {
+	p.next()
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+	return &whileStmt{cond: cond, body: body}, nil
+}
+
+// parseDoWhile 解析 do body while (cond);
+func (p *parser) parseDoWhile() (stmtNode, error) {
+	p.next()
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("while"); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	return &doWhileStmt{body: body, cond: cond}, p.endStatement()
+}
+
+// parseFor 解析 for (init; cond; update) body 以及 for (def x : list)、for (x in list)
+func (p *parser) parseFor() (stmtNode, error) {
+	p.next()
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	// 遍历循环
+	start := p.pos
+	name := ""
+	if p.isDeclaration() {
+		p.skipTypeTokens()
+		if t := p.next(); p.isOp(":") {
+			name = t.text
+		}
+	} else if t := p.peek(); t.kind == tokIdent && p.pos+1 < len(p.tokens) &&
+		p.tokens[p.pos+1].kind == tokIdent && p.tokens[p.pos+1].text == "in" {
+		p.next()
+		name = t.text
+	}
+	if name != "" {
+		p.next()
+		iterable, err := p.parseExpr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		body, err := p.parseLoopBody()
+		if err != nil {
+			return nil, err
+		}
+		return &forEachStmt{name: name, iterable: iterable, body: body}, nil
+	}
+	p.pos = start
+
+	stmt := &forStmt{}
+	if !p.isOp(";") {
+		if p.isDeclaration() {
+			decl, err := p.parseDeclaration()
+			if err != nil {
+				return nil, err
+			}
+			stmt.init = decl
+		} else {
+			exprs, err := p.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			init := &blockStmt{}
+			for _, expr := range exprs {
+				init.stmts = append(init.stmts, &exprStmt{expr: expr})
+			}
+			stmt.init = init
+		}
+	}
+	if err := p.expectOp(";"); err != nil {
+		return nil, err
+	}
+	if !p.isOp(";") {
+		cond, err := p.parseExpr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+		stmt.cond = cond
+	}
+	if err := p.expectOp(";"); err != nil {
+		return nil, err
+	}
+	if !p.isOp(")") {
+		update, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.update = update
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+	stmt.body = body
+	return stmt, nil
+}
+
+// parseExprList 解析逗号分隔的表达式列表（for 循环的初始化与更新部分）
+func (p *parser) parseExprList() ([]exprNode, error) {
+	var exprs []exprNode
+	for {
+		expr, err := p.parseExpr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if !p.isOp(",") {
+			return exprs, nil
+		}
+		p.next()
+	}
+}
+
+// parseSwitch 解析 switch (value) { case v: ... default: ... }
+func (p *parser) parseSwitch() (stmtNode, error) {
+	p.next()
+	value, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectOp("{"); err != nil {
+		return nil, err
+	}
+
+	p.switchDepth++
+	defer func() { p.switchDepth-- }()
+
+	stmt := &switchStmt{value: value}
+	for !p.isOp("}") {
+		switch {
+		case p.isKeyword("case"):
+			p.next()
+			caseValue, err := p.parseExpr(precLowest)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(":"); err != nil {
+				return nil, err
+			}
+			stmt.cases = append(stmt.cases, switchCase{value: caseValue})
+		case p.isKeyword("default"):
+			p.next()
+			if err := p.expectOp(":"); err != nil {
+				return nil, err
+			}
+			stmt.cases = append(stmt.cases, switchCase{})
+		default:
+			if len(stmt.cases) == 0 || p.peek().kind == tokEOF {
+				return nil, p.unexpected(p.peek())
+			}
+			body, err := p.parseStatement()
+			if err != nil {
+				return nil, err
+			}
+			if body != nil {
+				last := &stmt.cases[len(stmt.cases)-1]
+				last.body = append(last.body, body)
+			}
+		}
+	}
+	p.next()
+	return stmt, nil
+}
+
+// isDeclaration 判断当前位置是否为变量声明（类型名后紧跟变量名）
+func (p *parser) isDeclaration() bool {
+	t := p.peek()
+	if t.kind != tokIdent || statementKeywords[t.text] {
+		return false
+	}
+	end, ok := p.scanType(p.pos)
+	if !ok || end >= len(p.tokens) {
+		return false
+	}
+	name := p.tokens[end]
+	return name.kind == tokIdent && !statementKeywords[name.text]
+}
+
+// scanType 从位置 i 扫描类型名（包名、泛型参数与数组维度），返回类型之后的位置
+func (p *parser) scanType(i int) (int, bool) {
+	isOpAt := func(j int, text string) bool {
+		return j < len(p.tokens) && p.tokens[j].kind == tokOp && p.tokens[j].text == text
+	}
+	i++
+	for isOpAt(i, ".") && i+1 < len(p.tokens) && p.tokens[i+1].kind == tokIdent {
+		i += 2
+	}
+	if isOpAt(i, "<") {
+		depth := 0
+	generics:
+		for ; i < len(p.tokens); i++ {
+			t := p.tokens[i]
+			if t.kind == tokIdent {
+				continue
+			}
+			if t.kind != tokOp {
+				return 0, false
+			}
+			switch t.text {
+			case "<":
+				depth++
+			case ">":
+				depth--
+			case ",", ".", "?", "[", "]":
+			default:
+				return 0, false
+			}
+			if depth == 0 {
+				i++
+				break generics
+			}
+		}
+		if depth != 0 {
+			return 0, false
+		}
+	}
+	for isOpAt(i, "[") && isOpAt(i+1, "]") {
+		i += 2
+	}
+	return i, true
+}
+
+// skipTypeTokens 跳过类型名，返回类型名（数组类型按 def 处理）
+func (p *parser) skipTypeTokens() string {
+	typeName := p.peek().text
+	end, _ := p.scanType(p.pos)
+	if p.tokens[end-1].kind == tokOp && p.tokens[end-1].text == "]" {
+		typeName = "def"
+	} else if end > p.pos+1 && p.tokens[end-1].kind == tokIdent {
+		// 带包名的类型取最后一段
+		typeName = p.tokens[end-1].text
+	}
+	p.pos = end
+	return typeName
+}
+
+// parseDeclaration 解析变量声明：Type a [= expr] [, b [= expr]]
+func (p *parser) parseDeclaration() (*declStmt, error) {
+	decl := &declStmt{typeName: p.skipTypeTokens()}
+	for {
+		name := p.next()
+		if name.kind != tokIdent || statementKeywords[name.text] {
+			return nil, p.unexpected(name)
+		}
+		var value exprNode
+		if p.isOp("=") {
+			p.next()
+			var err error
+			if value, err = p.parseExpr(precLowest); err != nil {
+				return nil, err
+			}
+		}
+		decl.names = append(decl.names, name.text)
+		decl.values = append(decl.values, value)
+		if !p.isOp(",") {
+			return decl, nil
+		}
+		p.next()
+	}
+}
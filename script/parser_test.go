@@ -0,0 +1,159 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpressionParser(t *testing.T) {
+	engine := NewEngine()
+
+	tests := []struct {
+		name   string
+		source string
+		doc    map[string]interface{}
+		params map[string]interface{}
+		want   interface{}
+	}{
+		{
+			name:   "minus inside string",
+			source: "doc['date'].value == '2024-01-15'",
+			doc:    map[string]interface{}{"date": "2024-01-15"},
+			want:   true,
+		},
+		{
+			name:   "string concatenation with minus",
+			source: "'a-b' + '-' + doc['n'].value",
+			doc:    map[string]interface{}{"n": 1.0},
+			want:   "a-b-1",
+		},
+		{
+			name:   "nested parentheses with operators",
+			source: "((doc['a'].value - 2) * (3 + doc['b'].value)) / (10 - (2 * 4))",
+			doc:    map[string]interface{}{"a": 4.0, "b": 1.0},
+			want:   4.0,
+		},
+		{
+			name:   "left associative subtraction",
+			source: "10 - 4 - 3",
+			want:   3.0,
+		},
+		{
+			name:   "precedence",
+			source: "2 + 3 * 4 == 14 && !(1 > 2)",
+			want:   true,
+		},
+		{
+			name:   "method args with commas inside strings",
+			source: "'a,b;c'.replace(',', ', ').split(';').get(0)",
+			want:   "a, b",
+		},
+		{
+			name:   "math call inside expression",
+			source: "Math.max(1, Math.min(params.x, 5)) * -2",
+			params: map[string]interface{}{"x": 3.0},
+			want:   -6.0,
+		},
+		{
+			name:   "question mark and colon inside strings",
+			source: "params.q == '?' ? 'a:b' : 'c'",
+			params: map[string]interface{}{"q": "?"},
+			want:   "a:b",
+		},
+		{
+			name:   "escaped quote",
+			source: "'it\\'s'.length()",
+			want:   4.0,
+		},
+		{
+			name:   "cast",
+			source: "(int) (params.x / 2)",
+			params: map[string]interface{}{"x": 7.0},
+			want:   3.0,
+		},
+		{
+			name:   "elvis and null safe access",
+			source: "params.user?.name ?: 'anonymous'",
+			params: map[string]interface{}{},
+			want:   "anonymous",
+		},
+		{
+			name:   "list and map literals",
+			source: "[1, 2, 3].contains(2) && ['k': 'v'].get('k') == 'v'",
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContext(tt.doc, tt.doc, tt.params)
+			got, err := engine.Execute(NewScript(tt.source, tt.params), ctx)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Execute() = %v (%T), want %v", got, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpressionParserErrors(t *testing.T) {
+	for _, source := range []string{
+		"1 +",
+		"(1 + 2",
+		"'unterminated",
+		"doc['a'].value = ",
+		"1 = 2",
+		"a b",
+	} {
+		if _, err := parseExpression(source); err == nil {
+			t.Errorf("parseExpression(%q) expected error", source)
+		}
+	}
+}
+
+func TestExpressionAssignment(t *testing.T) {
+	engine := NewEngine()
+	ctx := NewContext(nil, map[string]interface{}{"tags": []interface{}{"a"}}, nil)
+
+	for _, source := range []string{
+		"ctx._source.tags.add('b')",
+		"ctx._source.counter += 2",
+		"ctx._source.counter++",
+		"ctx._source.meta.owner = 'x-y'",
+		"ctx._source['title'] = 'T' + ctx._source.counter",
+	} {
+		if _, err := engine.Execute(NewScript(source, nil), ctx); err != nil {
+			t.Fatalf("Execute(%q) error = %v", source, err)
+		}
+	}
+
+	want := map[string]interface{}{
+		"tags":    []interface{}{"a", "b"},
+		"counter": 3.0,
+		"meta":    map[string]interface{}{"owner": "x-y"},
+		"title":   "T3",
+	}
+	if !reflect.DeepEqual(ctx.Source, want) {
+		t.Errorf("source = %v, want %v", ctx.Source, want)
+	}
+
+	if _, err := engine.Execute(NewScript("doc = 1", nil), ctx); err == nil {
+		t.Error("expected error when assigning to doc")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"fmt"
+	"sync"
+)
+
+// StoredScriptLoader 按 ID 加载存储脚本（由持有元数据存储的上层注册）
+type StoredScriptLoader func(id string) (lang, source string, err error)
+
+var (
+	storedLoaderMu sync.RWMutex
+	storedLoader   StoredScriptLoader
+)
+
+// SetStoredScriptLoader 注册存储脚本加载器
+func SetStoredScriptLoader(loader StoredScriptLoader) {
+	storedLoaderMu.Lock()
+	defer storedLoaderMu.Unlock()
+	storedLoader = loader
+}
+
+// LoadStoredScript 按 ID 获取存储脚本，优先使用缓存
+func LoadStoredScript(id string) (*CompiledScript, error) {
+	cache := GetGlobalCache()
+	if compiled, ok := cache.GetStored(id); ok {
+		return compiled, nil
+	}
+
+	storedLoaderMu.RLock()
+	loader := storedLoader
+	storedLoaderMu.RUnlock()
+	if loader == nil {
+		return nil, fmt.Errorf("stored script [%s] does not exist", id)
+	}
+
+	lang, source, err := loader(id)
+	if err != nil || source == "" {
+		return nil, fmt.Errorf("stored script [%s] does not exist", id)
+	}
+	if lang == "" {
+		lang = "painless"
+	}
+	return cache.PutStored(id, lang, source), nil
+}
@@ -149,6 +149,12 @@ type FacetRequest struct {
 	Field          string           `json:"field"`
 	NumericRanges  []*numericRange  `json:"numeric_ranges,omitempty"`
 	DateTimeRanges []*dateTimeRange `json:"date_ranges,omitempty"`
+	Cardinality    *cardinality     `json:"cardinality,omitempty"`
+}
+
+type cardinality struct {
+	PrecisionThreshold int    `json:"precision_threshold,omitempty"`
+	Missing            []byte `json:"missing,omitempty"`
 }
 
 // NewFacetRequest creates a facet on the specified
@@ -161,12 +167,39 @@ func NewFacetRequest(field string, size int) *FacetRequest {
 	}
 }
 
+// NewCardinalityFacetRequest creates a facet counting
+// the approximate number of distinct terms of the
+// specified field. Counts below precisionThreshold
+// are expected to be close to exact; values <= 0 use
+// search.DefaultPrecisionThreshold.
+func NewCardinalityFacetRequest(field string, precisionThreshold int) *FacetRequest {
+	return &FacetRequest{
+		Field:       field,
+		Cardinality: &cardinality{PrecisionThreshold: precisionThreshold},
+	}
+}
+
+// SetCardinalityMissing sets the indexed term counted
+// for documents without a value for the field.
+func (fr *FacetRequest) SetCardinalityMissing(term []byte) {
+	if fr.Cardinality == nil {
+		fr.Cardinality = &cardinality{}
+	}
+	fr.Cardinality.Missing = term
+}
+
 func (fr *FacetRequest) Validate() error {
 	nrCount := len(fr.NumericRanges)
 	drCount := len(fr.DateTimeRanges)
 	if nrCount > 0 && drCount > 0 {
 		return fmt.Errorf("facet can only contain numeric ranges or date ranges, not both")
 	}
+	if fr.Cardinality != nil && (nrCount > 0 || drCount > 0) {
+		return fmt.Errorf("cardinality facet cannot contain numeric ranges or date ranges")
+	}
+	if fr.Cardinality != nil && fr.Cardinality.PrecisionThreshold > search.MaxPrecisionThreshold {
+		return fmt.Errorf("cardinality precision threshold must be at most %d", search.MaxPrecisionThreshold)
+	}
 
 	if nrCount > 0 {
 		nrNames := map[string]interface{}{}
@@ -519,6 +552,9 @@ type SearchResult struct {
 	MaxScore float64                        `json:"max_score"`
 	Took     time.Duration                  `json:"took"`
 	Facets   search.FacetResults            `json:"facets"`
+	// TimedOut is set when the search stopped early at its deadline and
+	// the hits are partial (see search.PartialResultsOnTimeoutKey)
+	TimedOut bool `json:"timed_out,omitempty"`
 	// special fields that are applicable only for search
 	// results that are obtained from a presearch
 	SynonymResult search.FieldTermSynonymMap `json:"synonym_result,omitempty"`
@@ -18,6 +18,7 @@ import (
 	"context"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lscgzwd/tiggerdb/numeric"
@@ -79,11 +80,86 @@ type TopNCollector struct {
 
 	knnHits             map[string]*search.DocumentMatch
 	computeNewScoreExpl search.ScoreExplCorrectionCallbackFunc
+
+	// timedOut is set when collection stopped early because the context
+	// deadline was reached and partial results were requested
+	timedOut bool
+
+	// earlyTerminated is set when documents were skipped because they
+	// could not be competitive under the index sort
+	earlyTerminated bool
 }
 
 // CheckDoneEvery controls how frequently we check the context deadline
 const CheckDoneEvery = uint64(1024)
 
+// stopOnTimeout reports whether collection should stop gracefully, keeping
+// the hits gathered so far, instead of failing with the context error. This
+// only applies to deadline expiry when search.PartialResultsOnTimeoutKey is
+// set; cancellation always aborts the search.
+func (hc *TopNCollector) stopOnTimeout(ctx context.Context) bool {
+	if ctx.Err() != context.DeadlineExceeded {
+		return false
+	}
+	if partial, ok := ctx.Value(search.PartialResultsOnTimeoutKey).(bool); !ok || !partial {
+		return false
+	}
+	hc.timedOut = true
+	return true
+}
+
+// TimedOut reports whether collection stopped early because the search
+// timeout was reached
+func (hc *TopNCollector) TimedOut() bool {
+	return hc.timedOut
+}
+
+// EarlyTerminated reports whether documents were skipped because the
+// index is sorted by the primary sort, in which case the total hit count
+// is a lower bound
+func (hc *TopNCollector) EarlyTerminated() bool {
+	return hc.earlyTerminated
+}
+
+// sortedIndexReader is implemented by index readers whose segments store
+// documents in runs sorted by the index sort
+type sortedIndexReader interface {
+	IndexSort() search.SortOrder
+	NextSortedRun(id index.IndexInternalID) (index.IndexInternalID, bool)
+}
+
+// sortedReader returns the reader as a sortedIndexReader if early
+// termination was requested and the primary sort of the collector is the
+// primary index sort, so that the hits of each sorted run arrive in
+// sort order
+func (hc *TopNCollector) sortedReader(ctx context.Context, reader index.IndexReader) sortedIndexReader {
+	if early, ok := ctx.Value(search.EarlyTerminationKey).(bool); !ok || !early {
+		return nil
+	}
+	if hc.facetsBuilder != nil || hc.knnHits != nil || ctx.Value(search.MakeDocumentMatchHandlerKey) != nil {
+		return nil
+	}
+	sr, ok := reader.(sortedIndexReader)
+	if !ok || len(hc.sort) == 0 {
+		return nil
+	}
+	indexSort := sr.IndexSort()
+	if len(indexSort) == 0 {
+		return nil
+	}
+	primary, ok := hc.sort[0].(*search.SortField)
+	if !ok {
+		return nil
+	}
+	indexPrimary, ok := indexSort[0].(*search.SortField)
+	if !ok || primary.Field != indexPrimary.Field || primary.Desc != indexPrimary.Desc ||
+		primary.Type != indexPrimary.Type || primary.Mode != indexPrimary.Mode ||
+		primary.Missing != indexPrimary.Missing || primary.MissingValue != indexPrimary.MissingValue {
+		return nil
+	}
+	return sr
+}
+
 // NewTopNCollector builds a collector to find the top 'size' hits
 // skipping over the first 'skip' hits
 // ordering hits by the provided sort order
@@ -276,10 +352,14 @@ func (hc *TopNCollector) Collect(ctx context.Context, searcher search.Searcher,
 	}
 
 	hc.needDocIds = hc.needDocIds || loadID
+	sr := hc.sortedReader(ctx, reader)
+	var runID index.IndexInternalID
 	select {
 	case <-ctx.Done():
-		search.RecordSearchCost(ctx, search.AbortM, 0)
-		return ctx.Err()
+		if !hc.stopOnTimeout(ctx) {
+			search.RecordSearchCost(ctx, search.AbortM, 0)
+			return ctx.Err()
+		}
 	default:
 		next, err = searcher.Next(searchContext)
 	}
@@ -287,10 +367,15 @@ func (hc *TopNCollector) Collect(ctx context.Context, searcher search.Searcher,
 		if hc.total%CheckDoneEvery == 0 {
 			select {
 			case <-ctx.Done():
-				search.RecordSearchCost(ctx, search.AbortM, 0)
-				return ctx.Err()
+				if !hc.stopOnTimeout(ctx) {
+					search.RecordSearchCost(ctx, search.AbortM, 0)
+					return ctx.Err()
+				}
 			default:
 			}
+			if hc.timedOut {
+				break
+			}
 		}
 
 		err = hc.adjustDocumentMatch(searchContext, reader, next)
@@ -303,11 +388,35 @@ func (hc *TopNCollector) Collect(ctx context.Context, searcher search.Searcher,
 			break
 		}
 
+		// the handler may return next to the pool, keep what's needed to
+		// skip the rest of its sorted run
+		var primary string
+		var sorted bool
+		if sr != nil {
+			primary = next.Sort[0]
+			runID, sorted = sr.NextSortedRun(next.IndexInternalID)
+		}
+
 		err = dmHandler(next)
 		if err != nil {
 			break
 		}
 
+		// the remaining documents of the run sort after this one, if it
+		// sorts after the best hit left out of the results, none of them
+		// can make it into the results
+		if sorted && hc.lowestMatchOutsideResults != nil {
+			c := strings.Compare(primary, hc.lowestMatchOutsideResults.Sort[0])
+			if hc.cachedDesc[0] {
+				c = -c
+			}
+			if c > 0 || (c == 0 && len(hc.sort) == 1) {
+				hc.earlyTerminated = true
+				next, err = searcher.Advance(searchContext, runID)
+				continue
+			}
+		}
+
 		next, err = searcher.Next(searchContext)
 	}
 	if err != nil {
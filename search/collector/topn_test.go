@@ -1114,3 +1114,50 @@ func BenchmarkTop10000of1000000Scores(b *testing.B) {
 		return NewTopNCollector(10000, 0, search.SortOrder{&search.SortScore{Desc: true}})
 	}, b)
 }
+
+func TestCollectPartialResultsOnTimeout(t *testing.T) {
+	newSearcher := func() *stubSearcher {
+		return &stubSearcher{
+			matches: []*search.DocumentMatch{
+				{IndexInternalID: index.IndexInternalID("a"), Score: 1},
+				{IndexInternalID: index.IndexInternalID("b"), Score: 2},
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	// without the partial results flag the deadline fails the search
+	collector := NewTopNCollector(10, 0, search.SortOrder{&search.SortScore{Desc: true}})
+	err := collector.Collect(ctx, newSearcher(), &stubReader{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if collector.TimedOut() {
+		t.Errorf("expected collector not to be marked timed out")
+	}
+
+	// with the flag the collector stops and keeps what it has
+	partialCtx := context.WithValue(ctx, search.PartialResultsOnTimeoutKey, true)
+	collector = NewTopNCollector(10, 0, search.SortOrder{&search.SortScore{Desc: true}})
+	err = collector.Collect(partialCtx, newSearcher(), &stubReader{})
+	if err != nil {
+		t.Fatalf("expected partial results, got error %v", err)
+	}
+	if !collector.TimedOut() {
+		t.Errorf("expected collector to be marked timed out")
+	}
+	if len(collector.Results()) != 0 {
+		t.Errorf("expected no results, got %d", len(collector.Results()))
+	}
+
+	// cancellation always aborts, even with the flag
+	cancelCtx, cancelAll := context.WithCancel(context.Background())
+	cancelAll()
+	cancelCtx = context.WithValue(cancelCtx, search.PartialResultsOnTimeoutKey, true)
+	collector = NewTopNCollector(10, 0, search.SortOrder{&search.SortScore{Desc: true}})
+	if err := collector.Collect(cancelCtx, newSearcher(), &stubReader{}); err != context.Canceled {
+		t.Errorf("expected canceled, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facet
+
+import (
+	"reflect"
+
+	"github.com/lscgzwd/tiggerdb/numeric"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/size"
+)
+
+var reflectStaticSizeCardinalityFacetBuilder int
+
+func init() {
+	var cfb CardinalityFacetBuilder
+	reflectStaticSizeCardinalityFacetBuilder = int(reflect.TypeOf(cfb).Size())
+}
+
+// CardinalityFacetBuilder counts the approximate number of
+// distinct terms of a field using a HyperLogLog++ sketch.
+type CardinalityFacetBuilder struct {
+	field    string
+	sketch   *search.HyperLogLog
+	missing  []byte
+	total    int
+	missed   int
+	sawValue bool
+}
+
+func NewCardinalityFacetBuilder(field string, precisionThreshold int) *CardinalityFacetBuilder {
+	return &CardinalityFacetBuilder{
+		field:  field,
+		sketch: search.NewHyperLogLog(precisionThreshold),
+	}
+}
+
+// SetMissing sets the term added for documents which have
+// no value for the field.
+func (fb *CardinalityFacetBuilder) SetMissing(term []byte) {
+	fb.missing = term
+}
+
+func (fb *CardinalityFacetBuilder) Size() int {
+	return reflectStaticSizeCardinalityFacetBuilder + size.SizeOfPtr +
+		len(fb.field) + len(fb.missing) + fb.sketch.Size()
+}
+
+func (fb *CardinalityFacetBuilder) Field() string {
+	return fb.field
+}
+
+func (fb *CardinalityFacetBuilder) UpdateVisitor(term []byte) {
+	// numeric values are indexed with additional shifted terms,
+	// only the unshifted one represents the value
+	if valid, shift := numeric.ValidPrefixCodedTermBytes(term); valid && shift > 0 {
+		return
+	}
+	fb.sawValue = true
+	fb.sketch.Add(term)
+	fb.total++
+}
+
+func (fb *CardinalityFacetBuilder) StartDoc() {
+	fb.sawValue = false
+}
+
+func (fb *CardinalityFacetBuilder) EndDoc() {
+	if !fb.sawValue {
+		fb.missed++
+		if fb.missing != nil {
+			fb.sketch.Add(fb.missing)
+		}
+	}
+}
+
+func (fb *CardinalityFacetBuilder) Result() *search.FacetResult {
+	return &search.FacetResult{
+		Field:       fb.field,
+		Total:       fb.total,
+		Missing:     fb.missed,
+		Cardinality: search.NewCardinalityFacet(fb.sketch),
+	}
+}
@@ -307,20 +307,57 @@ type FacetResult struct {
 	Terms         *TermFacets        `json:"terms,omitempty"`
 	NumericRanges NumericRangeFacets `json:"numeric_ranges,omitempty"`
 	DateRanges    DateRangeFacets    `json:"date_ranges,omitempty"`
+	Cardinality   *CardinalityFacet  `json:"cardinality,omitempty"`
+}
+
+// CardinalityFacet is the approximate number of distinct terms of a field,
+// along with the sketch it was computed from so results can be merged.
+type CardinalityFacet struct {
+	Value  uint64 `json:"value"`
+	sketch *HyperLogLog
+}
+
+func NewCardinalityFacet(sketch *HyperLogLog) *CardinalityFacet {
+	return &CardinalityFacet{
+		Value:  sketch.Cardinality(),
+		sketch: sketch,
+	}
+}
+
+func (cf *CardinalityFacet) Merge(other *CardinalityFacet) {
+	if cf.sketch != nil && other.sketch != nil {
+		cf.sketch.Merge(other.sketch)
+		cf.Value = cf.sketch.Cardinality()
+		return
+	}
+	// sketches are not serialized, an upper bound is the best we can do
+	cf.sketch = nil
+	cf.Value += other.Value
 }
 
 func (fr *FacetResult) Size() int {
-	return reflectStaticSizeFacetResult + size.SizeOfPtr +
+	sizeInBytes := reflectStaticSizeFacetResult + size.SizeOfPtr +
 		len(fr.Field) +
 		fr.Terms.Len()*(reflectStaticSizeTermFacet+size.SizeOfPtr) +
 		len(fr.NumericRanges)*(reflectStaticSizeNumericRangeFacet+size.SizeOfPtr) +
 		len(fr.DateRanges)*(reflectStaticSizeDateRangeFacet+size.SizeOfPtr)
+	if fr.Cardinality != nil && fr.Cardinality.sketch != nil {
+		sizeInBytes += fr.Cardinality.sketch.Size()
+	}
+	return sizeInBytes
 }
 
 func (fr *FacetResult) Merge(other *FacetResult) {
 	fr.Total += other.Total
 	fr.Missing += other.Missing
 	fr.Other += other.Other
+	if other.Cardinality != nil {
+		if fr.Cardinality == nil {
+			fr.Cardinality = other.Cardinality
+		} else {
+			fr.Cardinality.Merge(other.Cardinality)
+		}
+	}
 	if other.Terms != nil {
 		if fr.Terms == nil {
 			fr.Terms = other.Terms
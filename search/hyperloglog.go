@@ -0,0 +1,203 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+
+	"github.com/lscgzwd/tiggerdb/size"
+)
+
+const (
+	// DefaultPrecisionThreshold is the number of distinct values below
+	// which cardinality is counted exactly, unless configured otherwise.
+	DefaultPrecisionThreshold = 3000
+	// MaxPrecisionThreshold is the largest supported precision threshold.
+	MaxPrecisionThreshold = 40000
+
+	minHyperLogLogPrecision = 4
+	maxHyperLogLogPrecision = 18
+)
+
+// hyperLogLogThresholds are the cardinalities below which linear counting
+// is more accurate than the raw HyperLogLog estimate, indexed by
+// precision-4 (from the HyperLogLog++ paper).
+var hyperLogLogThresholds = []float64{
+	10, 20, 40, 80, 220, 400, 900, 1800, 3100,
+	6500, 11500, 20000, 50000, 120000, 350000,
+}
+
+// HyperLogLog estimates the number of distinct values added to it using
+// the HyperLogLog++ algorithm. Hashes are kept in a set, and counted
+// exactly, until there are more of them than the precision threshold;
+// the sketch then switches to 2^precision registers.
+type HyperLogLog struct {
+	precision uint8
+	threshold int
+	hashes    map[uint64]struct{}
+	registers []uint8
+}
+
+// NewHyperLogLog returns an empty sketch. precisionThreshold is clamped to
+// [0, MaxPrecisionThreshold]; values <= 0 use DefaultPrecisionThreshold.
+func NewHyperLogLog(precisionThreshold int) *HyperLogLog {
+	if precisionThreshold <= 0 {
+		precisionThreshold = DefaultPrecisionThreshold
+	}
+	if precisionThreshold > MaxPrecisionThreshold {
+		precisionThreshold = MaxPrecisionThreshold
+	}
+	return &HyperLogLog{
+		precision: precisionFromThreshold(precisionThreshold),
+		threshold: precisionThreshold,
+		hashes:    make(map[uint64]struct{}),
+	}
+}
+
+// precisionFromThreshold picks the number of register bits so that the
+// registers take about as much memory as the exact hash set would at the
+// threshold (same rule as Elasticsearch).
+func precisionFromThreshold(threshold int) uint8 {
+	hashTableEntries := uint64(math.Ceil(float64(threshold) / 0.75))
+	precision := bits.Len64(hashTableEntries * 4)
+	if precision < minHyperLogLogPrecision {
+		precision = minHyperLogLogPrecision
+	}
+	if precision > maxHyperLogLogPrecision {
+		precision = maxHyperLogLogPrecision
+	}
+	return uint8(precision)
+}
+
+// Add adds a value to the sketch.
+func (h *HyperLogLog) Add(value []byte) {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write(value)
+	h.AddHash(mix64(hasher.Sum64()))
+}
+
+// AddHash adds an already hashed value to the sketch. The hash must be
+// well distributed over all 64 bits.
+func (h *HyperLogLog) AddHash(x uint64) {
+	if h.registers != nil {
+		h.setRegister(x)
+		return
+	}
+	h.hashes[x] = struct{}{}
+	if len(h.hashes) > h.threshold {
+		h.toRegisters()
+	}
+}
+
+// Merge adds all values of other to the sketch. Both sketches should use
+// the same precision threshold.
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	if other == nil {
+		return
+	}
+	if other.registers == nil {
+		for x := range other.hashes {
+			h.AddHash(x)
+		}
+		return
+	}
+	if h.registers == nil {
+		h.toRegisters()
+	}
+	if len(other.registers) != len(h.registers) {
+		// different precision, fall back to an upper bound
+		for i := range h.registers {
+			h.registers[i] = max(h.registers[i], other.registers[i%len(other.registers)])
+		}
+		return
+	}
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// Cardinality returns the estimated number of distinct values.
+func (h *HyperLogLog) Cardinality() uint64 {
+	if h.registers == nil {
+		return uint64(len(h.hashes))
+	}
+
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	if zeros > 0 {
+		linearCounting := m * math.Log(m/float64(zeros))
+		if linearCounting <= hyperLogLogThresholds[h.precision-minHyperLogLogPrecision] {
+			return uint64(math.Round(linearCounting))
+		}
+	}
+	return uint64(math.Round(hyperLogLogAlpha(m) * m * m / sum))
+}
+
+// Size returns the approximate memory used by the sketch in bytes.
+func (h *HyperLogLog) Size() int {
+	return size.SizeOfPtr + len(h.registers) + len(h.hashes)*(size.SizeOfUint64+size.SizeOfPtr)
+}
+
+func (h *HyperLogLog) toRegisters() {
+	h.registers = make([]uint8, 1<<h.precision)
+	for x := range h.hashes {
+		h.setRegister(x)
+	}
+	h.hashes = nil
+}
+
+func (h *HyperLogLog) setRegister(x uint64) {
+	index := x >> (64 - h.precision)
+	// the remaining bits with a sentinel so rho never exceeds 64-precision+1
+	w := x<<h.precision | 1<<(h.precision-1)
+	rho := uint8(bits.LeadingZeros64(w)) + 1
+	if rho > h.registers[index] {
+		h.registers[index] = rho
+	}
+}
+
+func hyperLogLogAlpha(m float64) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/m)
+}
+
+// mix64 is the murmur3 64-bit finalizer, spreading the entropy of the
+// FNV hash over all bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
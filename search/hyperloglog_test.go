@@ -0,0 +1,83 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	tests := []struct {
+		threshold int
+		distinct  int
+		maxError  float64
+	}{
+		{threshold: 100, distinct: 0, maxError: 0},
+		{threshold: 100, distinct: 100, maxError: 0},
+		{threshold: 3000, distinct: 2500, maxError: 0},
+		{threshold: 100, distinct: 5000, maxError: 0.1},
+		{threshold: 3000, distinct: 100000, maxError: 0.03},
+		{threshold: 40000, distinct: 200000, maxError: 0.01},
+	}
+
+	for _, test := range tests {
+		hll := NewHyperLogLog(test.threshold)
+		for i := 0; i < test.distinct; i++ {
+			// every value is added twice
+			hll.Add([]byte(fmt.Sprintf("value-%d", i)))
+			hll.Add([]byte(fmt.Sprintf("value-%d", i)))
+		}
+		got := float64(hll.Cardinality())
+		relErr := 0.0
+		if test.distinct > 0 {
+			relErr = math.Abs(got-float64(test.distinct)) / float64(test.distinct)
+		} else if got != 0 {
+			relErr = math.Inf(1)
+		}
+		if relErr > test.maxError {
+			t.Errorf("threshold %d, distinct %d: got %v, error %.4f exceeds %.4f",
+				test.threshold, test.distinct, got, relErr, test.maxError)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a := NewHyperLogLog(1000)
+	b := NewHyperLogLog(1000)
+	for i := 0; i < 800; i++ {
+		a.Add([]byte(fmt.Sprintf("value-%d", i)))
+	}
+	// overlaps a by 400 values
+	for i := 400; i < 1200; i++ {
+		b.Add([]byte(fmt.Sprintf("value-%d", i)))
+	}
+
+	small := NewHyperLogLog(1000)
+	for i := 0; i < 300; i++ {
+		small.Add([]byte(fmt.Sprintf("value-%d", i)))
+	}
+	small.Merge(a)
+	if got := small.Cardinality(); got != 800 {
+		t.Errorf("expected exact merge of 800 values, got %d", got)
+	}
+
+	a.Merge(b)
+	got := float64(a.Cardinality())
+	if math.Abs(got-1200)/1200 > 0.05 {
+		t.Errorf("expected about 1200 values after merge, got %v", got)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/geo"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/numeric"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/searcher"
+)
+
+// DistanceFeatureQuery 距离特征查询
+// ES格式: {"distance_feature": {"field": "published", "origin": "now", "pivot": "7d"}}
+// 匹配字段有值的文档，得分为 boost * pivot / (pivot + distance)，distance 为字段值与 origin 的距离
+// （date 字段为时间差，geo_point 字段为米），多值字段取最近的值。
+// 字段值从 doc values 读取，不加载文档。
+type DistanceFeatureQuery struct {
+	field     string
+	geo       bool
+	origin    int64   // date：origin 的纳秒时间戳
+	originLon float64 // geo_point：origin 坐标
+	originLat float64
+	pivot     float64 // date 为纳秒，geo_point 为米
+	boost     float64
+}
+
+// NewDateDistanceFeatureQuery 创建 date 字段上的距离特征查询
+func NewDateDistanceFeatureQuery(field string, origin time.Time, pivot time.Duration) *DistanceFeatureQuery {
+	return &DistanceFeatureQuery{
+		field:  field,
+		origin: origin.UnixNano(),
+		pivot:  float64(pivot),
+		boost:  1.0,
+	}
+}
+
+// NewGeoDistanceFeatureQuery 创建 geo_point 字段上的距离特征查询，pivot 单位为米
+func NewGeoDistanceFeatureQuery(field string, lon, lat, pivot float64) *DistanceFeatureQuery {
+	return &DistanceFeatureQuery{
+		field:     field,
+		geo:       true,
+		originLon: lon,
+		originLat: lat,
+		pivot:     pivot,
+		boost:     1.0,
+	}
+}
+
+// SetBoost 设置权重
+func (q *DistanceFeatureQuery) SetBoost(b float64) {
+	q.boost = b
+}
+
+// Boost 返回权重
+func (q *DistanceFeatureQuery) Boost() float64 {
+	return q.boost
+}
+
+// Field 返回字段
+func (q *DistanceFeatureQuery) Field() string {
+	return q.field
+}
+
+// SetField 设置字段
+func (q *DistanceFeatureQuery) SetField(f string) {
+	q.field = f
+}
+
+// Searcher 实现 Query 接口
+func (q *DistanceFeatureQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	// 召回所有有值的文档：date 字段取全范围的数值区间，geo_point 字段取覆盖全球的矩形
+	var inner search.Searcher
+	var err error
+	if q.geo {
+		inner, err = searcher.NewGeoBoundingBoxSearcher(ctx, i, -180, -90, 180, 90, q.field, 1.0, options, false)
+	} else {
+		min, max := -math.MaxFloat64, math.MaxFloat64
+		inclusive := true
+		inner, err = searcher.NewNumericRangeSearcher(ctx, i, &min, &max, &inclusive, &inclusive, q.field, 1.0, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+	dvReader, err := i.DocValueReader([]string{q.field})
+	if err != nil {
+		_ = inner.Close()
+		return nil, err
+	}
+
+	return &DistanceFeatureSearcher{
+		inner:    inner,
+		dvReader: dvReader,
+		query:    q,
+		explain:  options.Explain,
+	}, nil
+}
+
+// DistanceFeatureSearcher 距离特征搜索器，按 doc values 中的字段值计算得分
+type DistanceFeatureSearcher struct {
+	inner    search.Searcher
+	dvReader index.DocValueReader
+	query    *DistanceFeatureQuery
+	explain  bool
+}
+
+// distance 计算前缀编码的字段值与 origin 的距离
+func (s *DistanceFeatureSearcher) distance(value int64) float64 {
+	q := s.query
+	if q.geo {
+		lon := geo.MortonUnhashLon(uint64(value))
+		lat := geo.MortonUnhashLat(uint64(value))
+		return geo.Haversin(q.originLon, q.originLat, lon, lat) * 1000
+	}
+	return math.Abs(float64(value) - float64(q.origin))
+}
+
+// score 计算文档的得分，取字段各个值中距离最近的值
+func (s *DistanceFeatureSearcher) score(match *search.DocumentMatch) error {
+	distance := math.Inf(1)
+	err := s.dvReader.VisitDocValues(match.IndexInternalID, func(field string, term []byte) {
+		if field != s.query.field {
+			return
+		}
+		// 只取全精度（shift 为 0）的词项
+		prefixCoded := numeric.PrefixCoded(term)
+		if shift, err := prefixCoded.Shift(); err != nil || shift != 0 {
+			return
+		}
+		value, err := prefixCoded.Int64()
+		if err != nil {
+			return
+		}
+		if d := s.distance(value); d < distance {
+			distance = d
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	q := s.query
+	match.Score = 0
+	if !math.IsInf(distance, 1) {
+		match.Score = q.boost * q.pivot / (q.pivot + distance)
+	}
+	if s.explain {
+		match.Expl = &search.Explanation{
+			Value: match.Score,
+			Message: "distance_feature, boost " + strconv.FormatFloat(q.boost, 'g', -1, 64) +
+				" * pivot " + strconv.FormatFloat(q.pivot, 'g', -1, 64) +
+				" / (pivot + distance " + strconv.FormatFloat(distance, 'g', -1, 64) + ")",
+		}
+	}
+	return nil
+}
+
+// Next 返回下一个匹配的文档
+func (s *DistanceFeatureSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	match, err := s.inner.Next(ctx)
+	if err != nil || match == nil {
+		return match, err
+	}
+	if err := s.score(match); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// Advance 跳到指定文档
+func (s *DistanceFeatureSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	match, err := s.inner.Advance(ctx, ID)
+	if err != nil || match == nil {
+		return match, err
+	}
+	if err := s.score(match); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// Close 关闭搜索器
+func (s *DistanceFeatureSearcher) Close() error {
+	return s.inner.Close()
+}
+
+// Weight 返回权重
+func (s *DistanceFeatureSearcher) Weight() float64 {
+	return s.query.boost
+}
+
+// SetQueryNorm 距离得分不做查询规范化
+func (s *DistanceFeatureSearcher) SetQueryNorm(qnorm float64) {
+}
+
+// Count 返回文档数量
+func (s *DistanceFeatureSearcher) Count() uint64 {
+	return s.inner.Count()
+}
+
+// Min 返回最小匹配数
+func (s *DistanceFeatureSearcher) Min() int {
+	return s.inner.Min()
+}
+
+// Size 返回大小
+func (s *DistanceFeatureSearcher) Size() int {
+	return s.inner.Size()
+}
+
+// DocumentMatchPoolSize 返回文档匹配池大小
+func (s *DistanceFeatureSearcher) DocumentMatchPoolSize() int {
+	return s.inner.DocumentMatchPoolSize()
+}
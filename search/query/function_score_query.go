@@ -345,16 +345,11 @@ func (s *FunctionScoreSearcher) Next(ctx *search.SearchContext) (*search.Documen
 		}
 
 		// 获取文档内容
-		doc, err := s.reader.Document(match.ID)
+		docFields, err := s.documentFields(match)
 		if err != nil {
 			continue
 		}
 
-		docFields := make(map[string]interface{})
-		doc.VisitFields(func(field index.Field) {
-			docFields[field.Name()] = string(field.Value())
-		})
-
 		// 计算新评分
 		newScore := s.calculateScore(docFields, match.Score)
 		match.Score = newScore
@@ -368,6 +363,33 @@ func (s *FunctionScoreSearcher) Next(ctx *search.SearchContext) (*search.Documen
 	}
 }
 
+// documentFields 读取命中文档的存储字段：数值字段解码为 float64，其余字段为字符串
+// 搜索器返回的 DocumentMatch 只有内部ID，外部ID需要通过 reader 转换
+func (s *FunctionScoreSearcher) documentFields(match *search.DocumentMatch) (map[string]interface{}, error) {
+	id := match.ID
+	if id == "" {
+		var err error
+		if id, err = s.reader.ExternalID(match.IndexInternalID); err != nil {
+			return nil, err
+		}
+	}
+	docFields := make(map[string]interface{})
+	doc, err := s.reader.Document(id)
+	if err != nil || doc == nil {
+		return docFields, err
+	}
+	doc.VisitFields(func(field index.Field) {
+		if numeric, ok := field.(index.NumericField); ok {
+			if n, err := numeric.Number(); err == nil {
+				docFields[field.Name()] = n
+				return
+			}
+		}
+		docFields[field.Name()] = string(field.Value())
+	})
+	return docFields, nil
+}
+
 // calculateScore 计算最终评分
 func (s *FunctionScoreSearcher) calculateScore(doc map[string]interface{}, originalScore float64) float64 {
 	if len(s.query.functions) == 0 {
@@ -451,16 +473,11 @@ func (s *FunctionScoreSearcher) Advance(ctx *search.SearchContext, ID index.Inde
 		return match, err
 	}
 
-	doc, err := s.reader.Document(match.ID)
+	docFields, err := s.documentFields(match)
 	if err != nil {
 		return match, nil
 	}
 
-	docFields := make(map[string]interface{})
-	doc.VisitFields(func(field index.Field) {
-		docFields[field.Name()] = string(field.Value())
-	})
-
 	match.Score = s.calculateScore(docFields, match.Score)
 	return match, nil
 }
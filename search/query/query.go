@@ -21,6 +21,7 @@ import (
 	"io"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/lscgzwd/tiggerdb/analysis"
 	"github.com/lscgzwd/tiggerdb/mapping"
@@ -505,6 +506,41 @@ func ExtractFields(q Query, m mapping.IndexMapping, fs FieldSet) (FieldSet, erro
 	return fs, err
 }
 
+// ExtractDateRange returns the range of the date field which every document
+// matching the query has to fall in, false if the query doesn't restrict the
+// field. A zero start or end leaves that side of the range unbounded.
+func ExtractDateRange(q Query, field string) (start, end time.Time, ok bool) {
+	restrict := func(s, e time.Time) {
+		if !s.IsZero() && (start.IsZero() || s.After(start)) {
+			start = s
+		}
+		if !e.IsZero() && (end.IsZero() || e.Before(end)) {
+			end = e
+		}
+		ok = true
+	}
+	switch q := q.(type) {
+	case *DateRangeQuery:
+		if q.FieldVal == field && (!q.Start.IsZero() || !q.End.IsZero()) {
+			restrict(q.Start.Time, q.End.Time)
+		}
+	case *BooleanQuery:
+		// only the must and filter clauses apply to every hit
+		for _, subq := range []Query{q.Must, q.Filter} {
+			if s, e, subOk := ExtractDateRange(subq, field); subOk {
+				restrict(s, e)
+			}
+		}
+	case *ConjunctionQuery:
+		for _, subq := range q.Conjuncts {
+			if s, e, subOk := ExtractDateRange(subq, field); subOk {
+				restrict(s, e)
+			}
+		}
+	}
+	return start, end, ok
+}
+
 const (
 	FuzzyMatchType = iota
 	RegexpMatchType
@@ -16,6 +16,8 @@ package query
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 
 	index "github.com/blevesearch/bleve_index_api"
 	"github.com/lscgzwd/tiggerdb/mapping"
@@ -107,23 +109,22 @@ func (s *ScriptFilterSearcher) Next(ctx *search.SearchContext) (*search.Document
 		}
 
 		// 获取文档内容
-		doc, err := s.reader.Document(match.ID)
+		doc, err := matchDocument(s.reader, match)
 		if err != nil {
 			continue
 		}
 
 		// 构建脚本上下文
-		docFields := make(map[string]interface{})
-		doc.VisitFields(func(field index.Field) {
-			docFields[field.Name()] = string(field.Value())
-		})
-
-		scriptCtx := script.NewContext(docFields, docFields, s.script.Params)
+		scriptCtx := newScriptDocContext(doc, s.script.Params)
 		scriptCtx.Score = match.Score
 
 		// 执行脚本过滤
 		passed, err := s.engine.ExecuteFilter(s.script, scriptCtx)
 		if err != nil {
+			// 超出执行限制时中止搜索，其他错误视为不匹配
+			if script.IsScriptException(err) {
+				return nil, err
+			}
 			continue
 		}
 
@@ -145,20 +146,18 @@ func (s *ScriptFilterSearcher) Advance(ctx *search.SearchContext, ID index.Index
 	}
 
 	// 获取文档内容并执行脚本
-	doc, err := s.reader.Document(match.ID)
+	doc, err := matchDocument(s.reader, match)
 	if err != nil {
 		return s.Next(ctx)
 	}
 
-	docFields := make(map[string]interface{})
-	doc.VisitFields(func(field index.Field) {
-		docFields[field.Name()] = string(field.Value())
-	})
-
-	scriptCtx := script.NewContext(docFields, docFields, s.script.Params)
+	scriptCtx := newScriptDocContext(doc, s.script.Params)
 	scriptCtx.Score = match.Score
 
 	passed, err := s.engine.ExecuteFilter(s.script, scriptCtx)
+	if script.IsScriptException(err) {
+		return nil, err
+	}
 	if err != nil || !passed {
 		return s.Next(ctx)
 	}
@@ -201,3 +200,77 @@ func (s *ScriptFilterSearcher) SetQueryNorm(qnorm float64) {
 func (s *ScriptFilterSearcher) Size() int {
 	return s.base.Size()
 }
+
+// matchDocument 读取命中文档的存储字段
+// 搜索器返回的 DocumentMatch 只有内部ID，外部ID需要通过 reader 转换
+func matchDocument(reader index.IndexReader, match *search.DocumentMatch) (index.Document, error) {
+	id := match.ID
+	if id == "" {
+		var err error
+		if id, err = reader.ExternalID(match.IndexInternalID); err != nil {
+			return nil, err
+		}
+	}
+	doc, err := reader.Document(id)
+	if err == nil && doc == nil {
+		err = fmt.Errorf("document [%s] not found", id)
+	}
+	return doc, err
+}
+
+// newScriptDocContext 由存储字段构建脚本上下文：
+// doc 使用类型化的字段值（同名字段出现多次时收集为多值），_source 优先取存储的 _source JSON
+func newScriptDocContext(doc index.Document, params map[string]interface{}) *script.Context {
+	docFields := make(map[string]interface{})
+	var source map[string]interface{}
+	doc.VisitFields(func(field index.Field) {
+		name := field.Name()
+		if name == "_source" {
+			if textField, ok := field.(index.TextField); ok {
+				_ = json.Unmarshal([]byte(textField.Text()), &source)
+			}
+			return
+		}
+		value := storedFieldValue(field)
+		if existing, ok := docFields[name]; ok {
+			if values, ok := existing.([]interface{}); ok {
+				docFields[name] = append(values, value)
+			} else {
+				docFields[name] = []interface{}{existing, value}
+			}
+			return
+		}
+		docFields[name] = value
+	})
+	if source == nil {
+		source = docFields
+	}
+	return script.NewContext(docFields, source, params)
+}
+
+// storedFieldValue 按字段类型读取存储值
+func storedFieldValue(field index.Field) interface{} {
+	switch f := field.(type) {
+	case index.NumericField:
+		if n, err := f.Number(); err == nil {
+			return n
+		}
+	case index.DateTimeField:
+		if t, _, err := f.DateTime(); err == nil {
+			return t
+		}
+	case index.BooleanField:
+		if b, err := f.Boolean(); err == nil {
+			return b
+		}
+	case index.GeoPointField:
+		lon, lonErr := f.Lon()
+		lat, latErr := f.Lat()
+		if lonErr == nil && latErr == nil {
+			return map[string]interface{}{"lat": lat, "lon": lon}
+		}
+	case index.TextField:
+		return f.Text()
+	}
+	return string(field.Value())
+}
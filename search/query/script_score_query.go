@@ -112,7 +112,7 @@ func (s *ScriptScoreSearcher) Next(ctx *search.SearchContext) (*search.DocumentM
 		}
 
 		// 获取文档内容
-		doc, err := s.reader.Document(match.ID)
+		doc, err := matchDocument(s.reader, match)
 		if err != nil {
 			// 文档获取失败，使用原始评分
 			match.Score = match.Score * s.boost
@@ -123,16 +123,14 @@ func (s *ScriptScoreSearcher) Next(ctx *search.SearchContext) (*search.DocumentM
 		}
 
 		// 构建脚本上下文
-		docFields := make(map[string]interface{})
-		doc.VisitFields(func(field index.Field) {
-			docFields[field.Name()] = string(field.Value())
-		})
-
-		scriptCtx := script.NewContext(docFields, docFields, s.script.Params)
+		scriptCtx := newScriptDocContext(doc, s.script.Params)
 		scriptCtx.Score = match.Score
 
 		// 执行脚本计算新评分
 		newScore, err := s.engine.ExecuteScore(s.script, scriptCtx)
+		if script.IsScriptException(err) {
+			return nil, err
+		}
 		if err != nil {
 			// 脚本执行失败，使用原始评分
 			match.Score = match.Score * s.boost
@@ -160,21 +158,19 @@ func (s *ScriptScoreSearcher) Advance(ctx *search.SearchContext, ID index.IndexI
 	}
 
 	// 获取文档并计算评分
-	doc, err := s.reader.Document(match.ID)
+	doc, err := matchDocument(s.reader, match)
 	if err != nil {
 		match.Score = match.Score * s.boost
 		return match, nil
 	}
 
-	docFields := make(map[string]interface{})
-	doc.VisitFields(func(field index.Field) {
-		docFields[field.Name()] = string(field.Value())
-	})
-
-	scriptCtx := script.NewContext(docFields, docFields, s.script.Params)
+	scriptCtx := newScriptDocContext(doc, s.script.Params)
 	scriptCtx.Score = match.Score
 
 	newScore, err := s.engine.ExecuteScore(s.script, scriptCtx)
+	if script.IsScriptException(err) {
+		return nil, err
+	}
 	if err != nil {
 		match.Score = match.Score * s.boost
 	} else {
@@ -0,0 +1,224 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/search"
+	"github.com/lscgzwd/tiggerdb/search/searcher"
+)
+
+// 稀疏向量（学习型稀疏检索，如 SPLADE、ELSER 的输出）的存储方式：
+//   - 向量字段本身按 keyword 索引所有词项，用于召回包含任一查询词项的候选文档
+//   - 权重以 "字段\x00词项\x00权重" 的词项写入单独的 doc values 字段，评分时按文档读取
+//
+// 与 ES 相同，权重以降低的精度存储（保留 4 位有效数字）。
+
+const sparseWeightSeparator = '\x00'
+
+// SparseWeightTerm 返回稀疏向量权重字段中表示 field 字段 token 词项权重的词项
+func SparseWeightTerm(field, token string, weight float64) string {
+	return field + string(sparseWeightSeparator) + token + string(sparseWeightSeparator) +
+		strconv.FormatFloat(weight, 'g', 4, 32)
+}
+
+// parseSparseWeightTerm 解析 SparseWeightTerm 生成的词项
+func parseSparseWeightTerm(term []byte) (field, token []byte, weight float64, ok bool) {
+	first := bytes.IndexByte(term, sparseWeightSeparator)
+	last := bytes.LastIndexByte(term, sparseWeightSeparator)
+	if first < 0 || last <= first {
+		return nil, nil, 0, false
+	}
+	weight, err := strconv.ParseFloat(string(term[last+1:]), 64)
+	if err != nil {
+		return nil, nil, 0, false
+	}
+	return term[:first], term[first+1 : last], weight, true
+}
+
+// SparseVectorQuery 稀疏向量查询
+// ES格式: {"sparse_vector": {"field": "ml.tokens", "query_vector": {"token": weight, ...}}}
+// 文档得分为查询向量与文档向量在共有词项上的权重点积
+type SparseVectorQuery struct {
+	field        string             // 稀疏向量字段
+	weightsField string             // 保存权重的 doc values 字段
+	vector       map[string]float64 // 查询向量
+	boost        float64            // 权重
+}
+
+// NewSparseVectorQuery 创建稀疏向量查询
+func NewSparseVectorQuery(field, weightsField string, vector map[string]float64) *SparseVectorQuery {
+	return &SparseVectorQuery{
+		field:        field,
+		weightsField: weightsField,
+		vector:       vector,
+		boost:        1.0,
+	}
+}
+
+// SetBoost 设置权重
+func (q *SparseVectorQuery) SetBoost(b float64) {
+	q.boost = b
+}
+
+// Boost 返回权重
+func (q *SparseVectorQuery) Boost() float64 {
+	return q.boost
+}
+
+// Field 返回稀疏向量字段
+func (q *SparseVectorQuery) Field() string {
+	return q.field
+}
+
+// Vector 返回查询向量
+func (q *SparseVectorQuery) Vector() map[string]float64 {
+	return q.vector
+}
+
+// Searcher 实现 Query 接口
+func (q *SparseVectorQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	tokens := make([]string, 0, len(q.vector))
+	for token := range q.vector {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+
+	// 召回包含任一查询词项的文档
+	inner, err := searcher.NewMultiTermSearcher(ctx, i, tokens, q.field, 1.0, options, false)
+	if err != nil {
+		return nil, err
+	}
+	dvReader, err := i.DocValueReader([]string{q.weightsField})
+	if err != nil {
+		_ = inner.Close()
+		return nil, err
+	}
+
+	return &SparseVectorSearcher{
+		inner:    inner,
+		dvReader: dvReader,
+		field:    []byte(q.field),
+		vector:   q.vector,
+		boost:    q.boost,
+		explain:  options.Explain,
+	}, nil
+}
+
+// SparseVectorSearcher 稀疏向量搜索器，按 doc values 中的权重计算点积评分
+type SparseVectorSearcher struct {
+	inner    search.Searcher
+	dvReader index.DocValueReader
+	field    []byte
+	vector   map[string]float64
+	boost    float64
+	explain  bool
+}
+
+// score 计算文档的点积评分
+func (s *SparseVectorSearcher) score(match *search.DocumentMatch) error {
+	var score float64
+	var children []*search.Explanation
+	err := s.dvReader.VisitDocValues(match.IndexInternalID, func(_ string, term []byte) {
+		field, token, weight, ok := parseSparseWeightTerm(term)
+		if !ok || !bytes.Equal(field, s.field) {
+			return
+		}
+		queryWeight, ok := s.vector[string(token)]
+		if !ok {
+			return
+		}
+		score += queryWeight * weight
+		if s.explain {
+			children = append(children, &search.Explanation{
+				Value:   queryWeight * weight,
+				Message: "weight(" + string(token) + ") query weight " + strconv.FormatFloat(queryWeight, 'g', -1, 64) + " * document weight " + strconv.FormatFloat(weight, 'g', -1, 64),
+			})
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	match.Score = score * s.boost
+	if s.explain {
+		match.Expl = &search.Explanation{Value: match.Score, Message: "sparse_vector dot product, boost " + strconv.FormatFloat(s.boost, 'g', -1, 64), Children: children}
+	}
+	return nil
+}
+
+// Next 返回下一个匹配的文档
+func (s *SparseVectorSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	match, err := s.inner.Next(ctx)
+	if err != nil || match == nil {
+		return match, err
+	}
+	if err := s.score(match); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// Advance 跳到指定文档
+func (s *SparseVectorSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	match, err := s.inner.Advance(ctx, ID)
+	if err != nil || match == nil {
+		return match, err
+	}
+	if err := s.score(match); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// Close 关闭搜索器
+func (s *SparseVectorSearcher) Close() error {
+	return s.inner.Close()
+}
+
+// Weight 返回权重
+func (s *SparseVectorSearcher) Weight() float64 {
+	return s.boost
+}
+
+// SetQueryNorm 点积评分不做查询规范化
+func (s *SparseVectorSearcher) SetQueryNorm(qnorm float64) {
+}
+
+// Count 返回文档数量
+func (s *SparseVectorSearcher) Count() uint64 {
+	return s.inner.Count()
+}
+
+// Min 返回最小匹配数
+func (s *SparseVectorSearcher) Min() int {
+	return s.inner.Min()
+}
+
+// Size 返回大小
+func (s *SparseVectorSearcher) Size() int {
+	return s.inner.Size()
+}
+
+// DocumentMatchPoolSize 返回文档匹配池大小
+func (s *SparseVectorSearcher) DocumentMatchPoolSize() int {
+	return s.inner.DocumentMatchPoolSize()
+}
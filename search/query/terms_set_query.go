@@ -0,0 +1,338 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/mapping"
+	"github.com/lscgzwd/tiggerdb/script"
+	"github.com/lscgzwd/tiggerdb/search"
+)
+
+// TermsSetQuery terms_set 查询
+// ES格式: {"terms_set": {"tags": {"terms": [...], "minimum_should_match_field": "required_matches"}}}
+// 文档至少匹配 N 个词项才命中，N 按文档计算：取数值字段的值或执行脚本（params.num_terms 为词项个数），
+// 也可以是固定值。得分为命中词项的得分之和。
+type TermsSetQuery struct {
+	field       string
+	terms       []Query        // 每个词项一个子查询
+	minField    string         // minimum_should_match_field
+	minScript   *script.Script // minimum_should_match_script
+	minRequired int            // 固定的最少匹配数（未设置字段与脚本时使用）
+	boost       float64
+}
+
+// NewTermsSetQuery 创建 terms_set 查询，terms 为 field 字段上每个词项的查询
+func NewTermsSetQuery(field string, terms []Query) *TermsSetQuery {
+	return &TermsSetQuery{
+		field:       field,
+		terms:       terms,
+		minRequired: len(terms),
+		boost:       1.0,
+	}
+}
+
+// SetMinimumShouldMatchField 设置保存最少匹配数的数值字段
+func (q *TermsSetQuery) SetMinimumShouldMatchField(field string) {
+	q.minField = field
+}
+
+// SetMinimumShouldMatchScript 设置计算最少匹配数的脚本
+func (q *TermsSetQuery) SetMinimumShouldMatchScript(s *script.Script) {
+	q.minScript = s
+}
+
+// SetMinimumShouldMatch 设置固定的最少匹配数
+func (q *TermsSetQuery) SetMinimumShouldMatch(n int) {
+	q.minRequired = n
+}
+
+// SetBoost 设置权重
+func (q *TermsSetQuery) SetBoost(b float64) {
+	q.boost = b
+}
+
+// Boost 返回权重
+func (q *TermsSetQuery) Boost() float64 {
+	return q.boost
+}
+
+// Field 返回词项字段
+func (q *TermsSetQuery) Field() string {
+	return q.field
+}
+
+// SetField 设置词项字段，同时更新每个词项的子查询
+func (q *TermsSetQuery) SetField(f string) {
+	q.field = f
+	for _, term := range q.terms {
+		if fq, ok := term.(FieldableQuery); ok {
+			fq.SetField(f)
+		}
+	}
+}
+
+// Terms 返回词项子查询
+func (q *TermsSetQuery) Terms() []Query {
+	return q.terms
+}
+
+// Searcher 实现 Query 接口
+func (q *TermsSetQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	searchers := make([]search.Searcher, 0, len(q.terms))
+	for _, term := range q.terms {
+		s, err := term.Searcher(ctx, i, m, options)
+		if err != nil {
+			for _, opened := range searchers {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		searchers = append(searchers, s)
+	}
+
+	rv := &termsSetSearcher{
+		query:     q,
+		reader:    i,
+		searchers: searchers,
+		currs:     make([]*search.DocumentMatch, len(searchers)),
+		explain:   options.Explain,
+	}
+	if q.minScript != nil {
+		rv.engine = script.NewEngine()
+	}
+	rv.computeQueryNorm()
+	return rv, nil
+}
+
+// termsSetSearcher 按文档顺序合并各词项的结果，统计文档命中的词项数并与该文档要求的最少匹配数比较
+type termsSetSearcher struct {
+	query       *TermsSetQuery
+	reader      index.IndexReader
+	engine      *script.Engine
+	searchers   []search.Searcher
+	currs       []*search.DocumentMatch
+	explain     bool
+	initialized bool
+}
+
+func (s *termsSetSearcher) computeQueryNorm() {
+	sumOfSquaredWeights := 0.0
+	for _, searcher := range s.searchers {
+		sumOfSquaredWeights += searcher.Weight()
+	}
+	if sumOfSquaredWeights == 0 {
+		return
+	}
+	s.SetQueryNorm(1.0 / math.Sqrt(sumOfSquaredWeights))
+}
+
+func (s *termsSetSearcher) initSearchers(ctx *search.SearchContext) (err error) {
+	for k, searcher := range s.searchers {
+		if s.currs[k], err = searcher.Next(ctx); err != nil {
+			return err
+		}
+	}
+	s.initialized = true
+	return nil
+}
+
+func (s *termsSetSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	if !s.initialized {
+		if err := s.initSearchers(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		// 当前最小的文档ID
+		var next index.IndexInternalID
+		for _, curr := range s.currs {
+			if curr != nil && (next == nil || curr.IndexInternalID.Compare(next) < 0) {
+				next = curr.IndexInternalID
+			}
+		}
+		if next == nil {
+			return nil, nil
+		}
+
+		var rv *search.DocumentMatch
+		var matched int
+		var score float64
+		var children []*search.Explanation
+		for k, curr := range s.currs {
+			if curr == nil || curr.IndexInternalID.Compare(next) != 0 {
+				continue
+			}
+			matched++
+			score += curr.Score
+			if s.explain {
+				children = append(children, curr.Expl)
+			}
+			if rv == nil {
+				rv = curr
+			} else {
+				rv.FieldTermLocations = search.MergeFieldTermLocations(rv.FieldTermLocations, []*search.DocumentMatch{curr})
+				ctx.DocumentMatchPool.Put(curr)
+			}
+			var err error
+			if s.currs[k], err = s.searchers[k].Next(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		required, ok, err := s.required(rv)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || matched < required {
+			ctx.DocumentMatchPool.Put(rv)
+			continue
+		}
+
+		rv.Score = score * s.query.boost
+		if s.explain {
+			rv.Expl = &search.Explanation{
+				Value:    rv.Score,
+				Message:  fmt.Sprintf("sum of %d matching terms, at least %d required:", matched, required),
+				Children: children,
+			}
+		}
+		return rv, nil
+	}
+}
+
+// required 计算文档要求的最少匹配数，ok 为 false 表示无法计算（字段缺失、脚本出错），文档不匹配
+func (s *termsSetSearcher) required(match *search.DocumentMatch) (int, bool, error) {
+	q := s.query
+	if q.minField == "" && q.minScript == nil {
+		return q.minRequired, true, nil
+	}
+
+	// 子搜索器返回的匹配还没有外部ID
+	id, err := s.reader.ExternalID(match.IndexInternalID)
+	if err != nil {
+		return 0, false, nil
+	}
+	doc, err := s.reader.Document(id)
+	if err != nil || doc == nil {
+		return 0, false, nil
+	}
+
+	if q.minScript == nil {
+		required, ok := 0, false
+		doc.VisitFields(func(field index.Field) {
+			if ok || field.Name() != q.minField {
+				return
+			}
+			switch v := storedFieldValue(field).(type) {
+			case float64:
+				required, ok = int(v), true
+			case string:
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					required, ok = int(n), true
+				}
+			}
+		})
+		return required, ok, nil
+	}
+
+	scriptCtx := newScriptDocContext(doc, map[string]interface{}{"num_terms": len(q.terms)})
+	scriptCtx.Score = match.Score
+	required, err := s.engine.ExecuteScore(q.minScript, scriptCtx)
+	if err != nil {
+		// 超出执行限制时中止搜索，其他错误视为不匹配
+		if script.IsScriptException(err) {
+			return 0, false, err
+		}
+		return 0, false, nil
+	}
+	return int(required), true, nil
+}
+
+func (s *termsSetSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	if !s.initialized {
+		if err := s.initSearchers(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for k, searcher := range s.searchers {
+		if s.currs[k] == nil || s.currs[k].IndexInternalID.Compare(ID) >= 0 {
+			continue
+		}
+		ctx.DocumentMatchPool.Put(s.currs[k])
+		var err error
+		if s.currs[k], err = searcher.Advance(ctx, ID); err != nil {
+			return nil, err
+		}
+	}
+	return s.Next(ctx)
+}
+
+func (s *termsSetSearcher) Close() (rv error) {
+	for _, searcher := range s.searchers {
+		if err := searcher.Close(); err != nil && rv == nil {
+			rv = err
+		}
+	}
+	return rv
+}
+
+func (s *termsSetSearcher) Weight() float64 {
+	var rv float64
+	for _, searcher := range s.searchers {
+		rv += searcher.Weight()
+	}
+	return rv
+}
+
+func (s *termsSetSearcher) SetQueryNorm(qnorm float64) {
+	for _, searcher := range s.searchers {
+		searcher.SetQueryNorm(qnorm)
+	}
+}
+
+func (s *termsSetSearcher) Count() uint64 {
+	var sum uint64
+	for _, searcher := range s.searchers {
+		sum += searcher.Count()
+	}
+	return sum
+}
+
+func (s *termsSetSearcher) Min() int {
+	return 0
+}
+
+func (s *termsSetSearcher) Size() int {
+	var rv int
+	for _, searcher := range s.searchers {
+		rv += searcher.Size()
+	}
+	return rv
+}
+
+func (s *termsSetSearcher) DocumentMatchPoolSize() int {
+	rv := len(s.currs)
+	for _, searcher := range s.searchers {
+		rv += searcher.DocumentMatchPoolSize()
+	}
+	return rv
+}
@@ -128,6 +128,12 @@ func ParseSearchSortObj(input map[string]interface{}) (SearchSort, error) {
 				rv.Mode = SortFieldMin
 			case "max":
 				rv.Mode = SortFieldMax
+			case "avg":
+				rv.Mode = SortFieldAvg
+			case "sum":
+				rv.Mode = SortFieldSum
+			case "median":
+				rv.Mode = SortFieldMedian
 			default:
 				return nil, fmt.Errorf("unknown sort field mode: %s", mode)
 			}
@@ -347,6 +353,12 @@ const (
 	SortFieldMin
 	// SortFieldMax uses the maximum value
 	SortFieldMax
+	// SortFieldAvg uses the average of the numeric values
+	SortFieldAvg
+	// SortFieldSum uses the sum of the numeric values
+	SortFieldSum
+	// SortFieldMedian uses the median of the numeric values
+	SortFieldMedian
 )
 
 // SortFieldMissing controls where documents missing a field value should be sorted
@@ -367,14 +379,16 @@ const (
 //	Type allows forcing of string/number/date behavior (default auto)
 //	Mode controls behavior for multi-values fields (default first)
 //	Missing controls behavior of missing values (default last)
+//	MissingValue if set, is used as the term of documents missing the field
 type SortField struct {
-	Field   string
-	Desc    bool
-	Type    SortFieldType
-	Mode    SortFieldMode
-	Missing SortFieldMissing
-	values  [][]byte
-	tmp     [][]byte
+	Field        string
+	Desc         bool
+	Type         SortFieldType
+	Mode         SortFieldMode
+	Missing      SortFieldMissing
+	MissingValue string
+	values       [][]byte
+	tmp          [][]byte
 }
 
 // UpdateVisitor notifies this sort field that in this document
@@ -430,10 +444,15 @@ func (s *SortField) filterTermsByMode(terms [][]byte) string {
 		case SortFieldMax:
 			sort.Sort(BytesSlice(terms))
 			return string(terms[len(terms)-1])
+		case SortFieldAvg, SortFieldSum, SortFieldMedian:
+			return s.aggregateNumericTerms(terms)
 		}
 	}
 
 	// handle missing terms
+	if s.MissingValue != "" {
+		return s.MissingValue
+	}
 	if s.Missing == SortFieldMissingLast {
 		if s.Desc {
 			return LowTerm
@@ -446,6 +465,46 @@ func (s *SortField) filterTermsByMode(terms [][]byte) string {
 	return LowTerm
 }
 
+// aggregateNumericTerms combines prefix coded numeric terms according
+// to the avg, sum or median mode, falling back to the minimum term
+// if any of the terms is not a prefix coded number with shift of 0
+func (s *SortField) aggregateNumericTerms(terms [][]byte) string {
+	nums := make([]float64, 0, len(terms))
+	for _, term := range terms {
+		valid, shift := numeric.ValidPrefixCodedTermBytes(term)
+		if !valid || shift != 0 {
+			sort.Sort(BytesSlice(terms))
+			return string(terms[0])
+		}
+		i64, err := numeric.PrefixCoded(term).Int64()
+		if err != nil {
+			sort.Sort(BytesSlice(terms))
+			return string(terms[0])
+		}
+		nums = append(nums, numeric.Int64ToFloat64(i64))
+	}
+
+	var rv float64
+	switch s.Mode {
+	case SortFieldMedian:
+		sort.Float64s(nums)
+		mid := len(nums) / 2
+		if len(nums)%2 == 0 {
+			rv = (nums[mid-1] + nums[mid]) / 2
+		} else {
+			rv = nums[mid]
+		}
+	default:
+		for _, num := range nums {
+			rv += num
+		}
+		if s.Mode == SortFieldAvg {
+			rv /= float64(len(nums))
+		}
+	}
+	return string(numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(rv), 0))
+}
+
 // filterTermsByType attempts to make one pass on the terms
 // if we are in auto-mode AND all the terms look like prefix-coded numbers
 // return only the terms which had shift of 0
@@ -498,6 +557,7 @@ func (s *SortField) RequiresFields() []string { return []string{s.Field} }
 func (s *SortField) MarshalJSON() ([]byte, error) {
 	// see if simple format can be used
 	if s.Missing == SortFieldMissingLast &&
+		s.MissingValue == "" &&
 		s.Mode == SortFieldDefault &&
 		s.Type == SortFieldAuto {
 		if s.Desc {
@@ -524,6 +584,12 @@ func (s *SortField) MarshalJSON() ([]byte, error) {
 			sfm["mode"] = "min"
 		case SortFieldMax:
 			sfm["mode"] = "max"
+		case SortFieldAvg:
+			sfm["mode"] = "avg"
+		case SortFieldSum:
+			sfm["mode"] = "sum"
+		case SortFieldMedian:
+			sfm["mode"] = "median"
 		}
 	}
 	if s.Type > SortFieldAuto {
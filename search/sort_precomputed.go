@@ -0,0 +1,100 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"encoding/json"
+)
+
+// SortPrecomputed 按预先计算的排序键排序（用于带 filter 的 nested 排序等无法从文档自身字段得到排序值的场景）
+// Values 为文档ID到排序键的映射，排序键与 SortField 的词项编码一致
+type SortPrecomputed struct {
+	Field        string
+	Values       map[string]string
+	Desc         bool
+	Missing      SortFieldMissing
+	MissingValue string
+}
+
+// UpdateVisitor 更新访问器
+func (s *SortPrecomputed) UpdateVisitor(field string, term []byte) {
+	// 预计算排序不依赖字段访问器
+}
+
+// Value 返回文档的排序值，没有预计算值的文档按 Missing/MissingValue 处理
+func (s *SortPrecomputed) Value(d *DocumentMatch) string {
+	if d != nil {
+		if val, ok := s.Values[d.ID]; ok {
+			return val
+		}
+	}
+	if s.MissingValue != "" {
+		return s.MissingValue
+	}
+	if (s.Missing == SortFieldMissingLast) != s.Desc {
+		return HighTerm
+	}
+	return LowTerm
+}
+
+// DecodeValue 解码排序值
+func (s *SortPrecomputed) DecodeValue(value string) string {
+	return value
+}
+
+// Descending 返回是否降序
+func (s *SortPrecomputed) Descending() bool {
+	return s.Desc
+}
+
+// RequiresDocID 是否需要文档ID
+func (s *SortPrecomputed) RequiresDocID() bool {
+	return true
+}
+
+// RequiresScoring 是否需要评分
+func (s *SortPrecomputed) RequiresScoring() bool {
+	return false
+}
+
+// RequiresFields 是否需要字段
+func (s *SortPrecomputed) RequiresFields() []string {
+	return nil
+}
+
+// Reverse 反转排序方向
+func (s *SortPrecomputed) Reverse() {
+	s.Desc = !s.Desc
+	if s.Missing == SortFieldMissingFirst {
+		s.Missing = SortFieldMissingLast
+	} else {
+		s.Missing = SortFieldMissingFirst
+	}
+}
+
+// MarshalJSON JSON 序列化
+func (s *SortPrecomputed) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"by":    "precomputed",
+		"field": s.Field,
+		"desc":  s.Desc,
+	})
+}
+
+// Copy 复制排序器
+func (s *SortPrecomputed) Copy() SearchSort {
+	rv := *s
+	return &rv
+}
@@ -3,6 +3,8 @@ package search
 import (
 	"reflect"
 	"testing"
+
+	"github.com/lscgzwd/tiggerdb/numeric"
 )
 
 func TestParseSearchSortObj(t *testing.T) {
@@ -336,3 +338,39 @@ func TestParseSearchSortObj(t *testing.T) {
 		})
 	}
 }
+
+func TestSortFieldNumericModes(t *testing.T) {
+	term := func(f float64) []byte {
+		return numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(f), 0)
+	}
+	tests := []struct {
+		mode SortFieldMode
+		want float64
+	}{
+		{SortFieldMin, 1},
+		{SortFieldMax, 10},
+		{SortFieldAvg, 5},
+		{SortFieldSum, 15},
+		{SortFieldMedian, 4},
+	}
+	for _, test := range tests {
+		sf := &SortField{Field: "price", Mode: test.mode}
+		for _, f := range []float64{10, 1, 4} {
+			sf.UpdateVisitor("price", term(f))
+		}
+		got := sf.Value(nil)
+		i64, err := numeric.PrefixCoded(got).Int64()
+		if err != nil {
+			t.Fatalf("mode %d: expected prefix coded value, got %q", test.mode, got)
+		}
+		if f := numeric.Int64ToFloat64(i64); f != test.want {
+			t.Errorf("mode %d: expected %v, got %v", test.mode, test.want, f)
+		}
+	}
+
+	// documents missing the field use MissingValue when set
+	sf := &SortField{Field: "price", MissingValue: string(term(2))}
+	if got := sf.Value(nil); got != string(term(2)) {
+		t.Errorf("expected missing value term, got %q", got)
+	}
+}
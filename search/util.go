@@ -156,6 +156,24 @@ const (
 	// ScoreFusionKey is used to communicate whether KNN hits need to be preserved for
 	// hybrid search algorithms (like RRF)
 	ScoreFusionKey ContextKey = "_fusion_rescoring_key"
+
+	// PartialResultsOnTimeoutKey (bool) asks the collector to stop and return the
+	// hits collected so far when the context deadline expires, rather than
+	// failing the search with context.DeadlineExceeded
+	PartialResultsOnTimeoutKey ContextKey = "_partial_results_on_timeout_key"
+
+	// EarlyTerminationKey (bool) allows the collector to skip documents which
+	// can't be competitive when the primary sort matches the index sort, at
+	// the cost of an inexact total hit count
+	EarlyTerminationKey ContextKey = "_early_termination_key"
+
+	// TimePruningStatsKey (*TimePruningStats) asks the search to report
+	// the segments skipped because none of their timestamps can match
+	TimePruningStatsKey ContextKey = "_time_pruning_stats_key"
+
+	// SearchConcurrencyKey (int) splits the segments of the index snapshot
+	// into as many partitions, searched in parallel and merged
+	SearchConcurrencyKey ContextKey = "_search_concurrency_key"
 )
 
 func RecordSearchCost(ctx context.Context,
@@ -241,3 +259,11 @@ type BM25Stats struct {
 	// 用于 GlobalScoring 场景下正确计算 IDF
 	TermDocCounts map[string]map[string]uint64 `json:"term_doc_counts,omitempty"`
 }
+
+// TimePruningStats counts the segments searched and skipped by searches
+// whose query restricts the timestamp field of the index to a range
+type TimePruningStats struct {
+	Field          string `json:"field"`
+	SegmentsTotal  int    `json:"segments_total"`
+	SegmentsPruned int    `json:"segments_pruned"`
+}
@@ -0,0 +1,162 @@
+//  Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/lscgzwd/tiggerdb/index/scorch"
+	"github.com/lscgzwd/tiggerdb/search"
+)
+
+// searchPartitionKey (bool) marks the search of a single partition of the
+// index snapshot, whose stats are accounted for by the merged search
+const searchPartitionKey = search.ContextKey("_search_partition_key")
+
+// partitionReader splits the reader into the partitions requested by
+// search.SearchConcurrencyKey, nil if the search must run on the whole
+// snapshot. Searches needing a global view of the snapshot (knn, score
+// fusion, presearch) aren't partitioned.
+func partitionReader(ctx context.Context, req *SearchRequest, reader index.IndexReader) []*scorch.IndexSnapshot {
+	n, ok := ctx.Value(search.SearchConcurrencyKey).(int)
+	if !ok || n < 2 {
+		return nil
+	}
+	if _, ok := ctx.Value(search.PreSearchKey).(bool); ok {
+		return nil
+	}
+	if _, ok := ctx.Value(search.ScoreFusionKey).(bool); ok {
+		return nil
+	}
+	if req.PreSearchData != nil || requestHasKNN(req) || IsScoreFusionRequested(req) {
+		return nil
+	}
+	is, ok := reader.(*scorch.IndexSnapshot)
+	if !ok || len(is.Segments()) < 2 {
+		return nil
+	}
+	return is.Partition(n)
+}
+
+// searchPartitions executes the search request on every partition in
+// parallel and merges the hits, totals and facets like MultiSearch does for
+// the indexes of an alias. As for shards, scores are computed with the term
+// statistics of each partition.
+func (i *indexImpl) searchPartitions(ctx context.Context, req *SearchRequest,
+	partitions []*scorch.IndexSnapshot, searchStart time.Time,
+) (*SearchResult, error) {
+	var reverseQueryExecution bool
+	if req.SearchBefore != nil {
+		reverseQueryExecution = true
+		req.Sort.Reverse()
+		req.SearchAfter = req.SearchBefore
+		req.SearchBefore = nil
+	}
+
+	// every partition reports the segments it pruned on its own
+	pruningStats, _ := ctx.Value(search.TimePruningStatsKey).(*search.TimePruningStats)
+
+	ctx = context.WithValue(ctx, searchPartitionKey, true)
+	results := make([]*SearchResult, len(partitions))
+	errs := make([]error, len(partitions))
+	partitionStats := make([]*search.TimePruningStats, len(partitions))
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(len(partitions))
+	for p, partition := range partitions {
+		partitionCtx := ctx
+		if pruningStats != nil {
+			partitionStats[p] = &search.TimePruningStats{}
+			partitionCtx = context.WithValue(ctx, search.TimePruningStatsKey, partitionStats[p])
+		}
+		go func(p int, partition *scorch.IndexSnapshot) {
+			defer waitGroup.Done()
+			results[p], errs[p] = i.searchReader(partitionCtx, createChildSearchRequest(req, nil),
+				partition, time.Now())
+		}(p, partition)
+	}
+	waitGroup.Wait()
+
+	if reverseQueryExecution {
+		defer func() {
+			req.SearchBefore = req.SearchAfter
+			req.SearchAfter = nil
+		}()
+	}
+
+	var sr *SearchResult
+	var timedOut bool
+	for p, res := range results {
+		if errs[p] != nil {
+			if reverseQueryExecution {
+				req.Sort.Reverse()
+			}
+			return nil, errs[p]
+		}
+		timedOut = timedOut || res.TimedOut
+		if sr == nil {
+			sr = res
+		} else {
+			sr.Merge(res)
+		}
+	}
+	if pruningStats != nil {
+		for _, stats := range partitionStats {
+			if stats.Field != "" {
+				pruningStats.Field = stats.Field
+			}
+			pruningStats.SegmentsTotal += stats.SegmentsTotal
+			pruningStats.SegmentsPruned += stats.SegmentsPruned
+		}
+	}
+
+	sr.Hits = hitsInCurrentPage(req, sr.Hits)
+	for name, fr := range req.Facets {
+		sr.Facets.Fixup(name, fr.Size)
+	}
+
+	if reverseQueryExecution {
+		// reverse the sort back to the original
+		req.Sort.Reverse()
+		// resort using the original order
+		mhs := newSearchHitSorter(req.Sort, sr.Hits)
+		req.SortFunc()(mhs)
+	}
+
+	// the partitions are the same index
+	sr.Status = &SearchStatus{
+		Total:      1,
+		Successful: 1,
+	}
+	sr.TimedOut = timedOut
+	sr.Request = nil
+	if req.Explain {
+		sr.Request = req
+	}
+
+	searchDuration := time.Since(searchStart)
+	sr.Took = searchDuration
+	atomic.AddUint64(&i.stats.searches, 1)
+	atomic.AddUint64(&i.stats.searchTime, uint64(searchDuration))
+	if Config.SlowSearchLogThreshold > 0 &&
+		searchDuration > Config.SlowSearchLogThreshold {
+		logger.Printf("slow search took %s - %v", searchDuration, req)
+	}
+
+	return sr, nil
+}
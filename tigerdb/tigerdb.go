@@ -0,0 +1,229 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tigerdb 以嵌入式方式在进程内运行 TigerDB：打开数据目录后直接通过函数调用写入、搜索与聚合，
+// 不启动 HTTP 服务，也不占用端口
+//
+//	db, err := tigerdb.Open(&tigerdb.Config{DataDir: "./data"})
+//	defer db.Close()
+//	_, err = db.Index().Index("orders").Id("1").BodyJson(order).Refresh("true").Do(ctx)
+//	result, err := db.Search("orders").Query(client.NewTermQuery("region", "eu")).Do(ctx)
+//
+// 请求在进程内交给与 HTTP 服务相同的处理器执行（包括全局中间件、认证与审计），
+// 因此行为与 ES 兼容接口完全一致；索引、搜索与聚合的构造器复用 client 包。
+// 同一数据目录同一时间只能被一个进程打开。
+package tigerdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"github.com/lscgzwd/tiggerdb/client"
+	"github.com/lscgzwd/tiggerdb/directory"
+	"github.com/lscgzwd/tiggerdb/metadata"
+	es "github.com/lscgzwd/tiggerdb/protocols/es"
+)
+
+// embeddedAddress 进程内请求使用的地址，请求不经过网络
+const embeddedAddress = "http://tigerdb.embedded"
+
+// Config 嵌入式配置
+type Config struct {
+	DataDir             string     // 数据目录，必填
+	MetadataStorageType string     // 元数据存储类型：file（默认）、bolt 或 memory
+	ES                  *es.Config // ES 兼容层配置（认证、多租户、审计等），为 nil 时使用默认配置；监听地址不使用
+}
+
+// Validate 验证嵌入式配置
+func (c *Config) Validate() error {
+	if c.DataDir == "" {
+		return fmt.Errorf("data dir is required")
+	}
+	switch c.MetadataStorageType {
+	case "", "file", "bolt", "memory":
+	default:
+		return fmt.Errorf("unsupported metadata storage type [%s]", c.MetadataStorageType)
+	}
+	return nil
+}
+
+// DB 嵌入式 TigerDB 实例，可被多个 goroutine 并发使用
+// 内嵌的 client.Client 提供索引管理、文档写入、搜索与批量写入，使用完毕后必须调用 Close
+type DB struct {
+	*client.Client
+
+	server    *es.ESServer
+	handler   http.Handler
+	dirMgr    directory.DirectoryManager
+	metaStore metadata.MetadataStore
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Open 打开数据目录并创建嵌入式实例：创建目录管理器、元数据存储与索引管理器并恢复已有索引
+func Open(config *Config) (*DB, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config is required")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	esConfig := config.ES
+	if esConfig == nil {
+		esConfig = es.DefaultConfig()
+	}
+
+	dirMgr, err := directory.NewDirectoryManager(directory.DefaultDirectoryConfig(config.DataDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory manager: %w", err)
+	}
+	storageType := config.MetadataStorageType
+	if storageType == "" {
+		storageType = "file"
+	}
+	metaStore, err := metadata.NewMetadataStore(&metadata.MetadataStoreConfig{
+		StorageType:      storageType,
+		FilePath:         filepath.Join(config.DataDir, "metadata"),
+		EnableCache:      true,
+		EnableVersioning: true,
+	})
+	if err != nil {
+		dirMgr.Cleanup()
+		return nil, fmt.Errorf("failed to create metadata store: %w", err)
+	}
+	server, err := es.NewServer(dirMgr, metaStore, esConfig)
+	if err != nil {
+		metaStore.Close()
+		dirMgr.Cleanup()
+		return nil, fmt.Errorf("failed to create ES server: %w", err)
+	}
+
+	db := &DB{
+		server:    server,
+		handler:   server.Handler(),
+		dirMgr:    dirMgr,
+		metaStore: metaStore,
+	}
+	db.Client, err = client.New(&client.Config{
+		Address:    embeddedAddress,
+		HTTPClient: &http.Client{Transport: &handlerTransport{handler: db.handler}},
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Handler 返回处理 ES 兼容请求的处理器，可挂载到应用自己的 HTTP 服务上对外提供接口
+func (db *DB) Handler() http.Handler {
+	return db.handler
+}
+
+// Aggregate 对匹配查询的文档执行聚合（请求 size=0），query 为 nil 时聚合所有文档
+// 结果通过 SearchResult.Buckets 与 SearchResult.Metric 读取
+func (db *DB) Aggregate(ctx context.Context, query client.Query, aggs map[string]client.Aggregation, indices ...string) (*client.SearchResult, error) {
+	if len(aggs) == 0 {
+		return nil, fmt.Errorf("at least one aggregation is required")
+	}
+	search := db.Search(indices...).Size(0)
+	if query != nil {
+		search.Query(query)
+	}
+	for name, agg := range aggs {
+		search.Aggregation(name, agg)
+	}
+	return search.Do(ctx)
+}
+
+// Close 停止后台任务，持久化并关闭所有索引后关闭元数据存储，可重复调用
+func (db *DB) Close() error {
+	db.closeOnce.Do(func() {
+		db.closeErr = db.server.Close()
+		if err := db.metaStore.Close(); err != nil && db.closeErr == nil {
+			db.closeErr = fmt.Errorf("failed to close metadata store: %w", err)
+		}
+		db.dirMgr.Cleanup()
+	})
+	return db.closeErr
+}
+
+// handlerTransport 把客户端请求直接交给处理器执行的 RoundTripper，不经过网络
+type handlerTransport struct {
+	handler http.Handler
+}
+
+// RoundTrip 实现 http.RoundTripper 接口
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// 转换为服务端请求：处理器依赖 RequestURI、RemoteAddr 与非 nil 的 Body
+	serverReq := req.Clone(req.Context())
+	serverReq.RequestURI = req.URL.RequestURI()
+	serverReq.RemoteAddr = "127.0.0.1:0"
+	if serverReq.Body == nil {
+		serverReq.Body = http.NoBody
+	}
+
+	rec := &responseRecorder{header: make(http.Header)}
+	t.handler.ServeHTTP(rec, serverReq)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.status, http.StatusText(rec.status)),
+		StatusCode:    rec.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.header,
+		Body:          io.NopCloser(bytes.NewReader(rec.body.Bytes())),
+		ContentLength: int64(rec.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// responseRecorder 在内存中收集处理器写出的响应
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+// Flush 实现 http.Flusher 接口，流式响应在处理器返回后一次性交给客户端
+func (r *responseRecorder) Flush() {}
@@ -0,0 +1,132 @@
+// Copyright (c) 2024 TigerDB Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tigerdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lscgzwd/tiggerdb/client"
+	es "github.com/lscgzwd/tiggerdb/protocols/es"
+	"github.com/lscgzwd/tiggerdb/protocols/es/http/server"
+)
+
+type order struct {
+	Region string `json:"region"`
+	Amount int    `json:"amount"`
+}
+
+func openTestDB(t *testing.T, dataDir string) *DB {
+	esConfig := es.DefaultConfig()
+	esConfig.ServerConfig = server.DefaultServerConfig()
+	esConfig.ServerConfig.LogLevel = "error"
+	db, err := Open(&Config{DataDir: dataDir, ES: esConfig})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return db
+}
+
+func TestEmbedded(t *testing.T) {
+	dataDir := t.TempDir()
+	ctx := context.Background()
+
+	db := openTestDB(t, dataDir)
+	err := db.CreateIndex(ctx, "orders", map[string]interface{}{
+		"mappings": map[string]interface{}{"properties": map[string]interface{}{
+			"region": map[string]interface{}{"type": "keyword"},
+			"amount": map[string]interface{}{"type": "long"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("CreateIndex: %v", err)
+	}
+	for i, o := range []order{{"eu", 10}, {"us", 20}, {"eu", 30}} {
+		if _, err := db.Index().Index("orders").Id(fmt.Sprint(i + 1)).BodyJson(o).Refresh("true").Do(ctx); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+
+	result, err := db.Search("orders").Query(client.NewTermQuery("region", "eu")).Sort("amount", false).Do(ctx)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if result.Hits.Total.Value != 2 || len(result.Hits.Hits) != 2 || result.Hits.Hits[0].ID != "3" {
+		t.Fatalf("Unexpected hits: %+v", result.Hits)
+	}
+
+	result, err = db.Aggregate(ctx, nil, map[string]client.Aggregation{
+		"regions": client.NewTermsAggregation("region").SubAggregation("total", client.NewSumAggregation("amount")),
+	}, "orders")
+	if err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	if result.Hits.Total.Value != 3 {
+		t.Errorf("Expected aggregation over 3 documents, got %d", result.Hits.Total.Value)
+	}
+	buckets, err := result.Buckets("regions")
+	if err != nil || len(buckets) != 2 {
+		t.Fatalf("Buckets: %+v, %v", buckets, err)
+	}
+	for _, bucket := range buckets {
+		total, err := bucket.Metric("total")
+		if want := map[string]float64{"eu": 40, "us": 20}[fmt.Sprint(bucket.Key)]; err != nil || total == nil || *total != want {
+			t.Errorf("Expected total %v for [%v], got %v, %v", want, bucket.Key, total, err)
+		}
+	}
+
+	// 处理器可挂载到应用自己的 HTTP 服务
+	srv := httptest.NewServer(db.Handler())
+	resp, err := http.Get(srv.URL + "/orders/_doc/1")
+	srv.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET through Handler: %v, %v", resp, err)
+	}
+	resp.Body.Close()
+
+	if _, err := db.Search("missing").Do(ctx); !client.IsNotFound(err) {
+		t.Errorf("Expected index_not_found_exception, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Expected Close to be idempotent, got %v", err)
+	}
+
+	// 重新打开后数据仍然存在
+	db = openTestDB(t, dataDir)
+	defer db.Close()
+	got, err := db.Get(ctx, "orders", "2", "")
+	if err != nil || !got.Found {
+		t.Fatalf("Get after reopen: %+v, %v", got, err)
+	}
+	var doc order
+	if err := got.Decode(&doc); err != nil || doc != (order{"us", 20}) {
+		t.Errorf("Unexpected document after reopen: %+v, %v", doc, err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if _, err := Open(&Config{}); err == nil {
+		t.Errorf("Expected an empty data dir to be rejected")
+	}
+	if _, err := Open(&Config{DataDir: t.TempDir(), MetadataStorageType: "redis"}); err == nil {
+		t.Errorf("Expected an unsupported metadata storage type to be rejected")
+	}
+}
@@ -26,6 +26,8 @@ var (
 	BoltMetaDataTimeStamp         = []byte("timeStamp")
 	BoltStatsKey                  = []byte("stats")
 	BoltUpdatedFieldsKey          = []byte("fields")
+	BoltSortRunsKey               = []byte("sortRuns")
+	BoltTimeRangeKey              = []byte("timeRange")
 	TotBytesWrittenKey            = []byte("TotBytesWritten")
 
 	MappingInternalKey = []byte("_mapping")